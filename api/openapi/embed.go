@@ -0,0 +1,14 @@
+// Package openapi embeds the OpenAPI specs generated by cmd/openapi from the handler annotations
+package openapi
+
+import _ "embed"
+
+// Public is the spec of the public API, served at /openapi.json
+//
+//go:embed openapi.json
+var Public []byte
+
+// Admin is the spec of the admin API, served at /openapi.json on the admin listener
+//
+//go:embed admin.json
+var Admin []byte
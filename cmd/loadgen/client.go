@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"octopus/internal/model"
+)
+
+// generateResponse is the API envelope of the generate endpoint
+type generateResponse struct {
+	Code    int                    `json:"code"`
+	Message string                 `json:"message"`
+	Data    model.GenerateResponse `json:"data"`
+}
+
+// generateLinks creates n short links with unique destinations and returns their codes
+func generateLinks(ctx context.Context, client *http.Client, target, urlPrefix string, n, concurrency int) ([]string, error) {
+	// Unique per run so the service's URL deduplication does not collapse the links
+	run := time.Now().UnixNano()
+
+	codes := make([]string, n)
+	indexes := make(chan int)
+	errs := make(chan error, concurrency)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				url := fmt.Sprintf("%s%d?run=%d", urlPrefix, idx, run)
+				code, err := generateLink(ctx, client, target, url)
+				if err != nil {
+					errs <- err
+					return
+				}
+				codes[idx] = code
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case indexes <- i:
+		case err = <-errs:
+			break feed
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate links: %w", err)
+	}
+	return codes, nil
+}
+
+// generateLink creates a single short link
+func generateLink(ctx context.Context, client *http.Client, target, url string) (string, error) {
+	body, err := json.Marshal(model.GenerateRequest{URL: url})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(target, "/")+"/api/v1/shortlink/generate", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var out generateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("unexpected response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || out.Data.ShortCode == "" {
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, out.Message)
+	}
+	return out.Data.ShortCode, nil
+}
+
+// redirect requests a short code without following the redirect
+func redirect(ctx context.Context, client *http.Client, target string, r redirectRequest) (int, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(target, "/")+"/"+r.code, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("User-Agent", r.userAgent)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		// Requests cut short by the end of the run are not failures of the target
+		if ctx.Err() != nil {
+			return 0, 0, errStopped
+		}
+		return 0, time.Since(start), err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return resp.StatusCode, time.Since(start), nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"octopus/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateLinksAndRedirect(t *testing.T) {
+	var generated atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/api/v1/shortlink/generate" {
+			var req model.GenerateRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Contains(t, req.URL, "https://example.com/lg/")
+
+			n := generated.Add(1)
+			_ = json.NewEncoder(w).Encode(generateResponse{
+				Message: "success",
+				Data:    model.GenerateResponse{ShortCode: fmt.Sprintf("CODE%02d", n)},
+			})
+			return
+		}
+		http.Redirect(w, r, "https://example.com", http.StatusFound)
+	}))
+	defer server.Close()
+
+	client := server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	codes, err := generateLinks(context.Background(), client, server.URL, "https://example.com/lg/", 10, 3)
+	require.NoError(t, err)
+	assert.Len(t, codes, 10)
+	assert.Equal(t, int64(10), generated.Load())
+
+	status, latency, err := redirect(context.Background(), client, server.URL, redirectRequest{code: codes[0], userAgent: visitorUserAgent})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusFound, status)
+	assert.Greater(t, latency, time.Duration(0))
+}
+
+func TestGenerateLinks_Failure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"code":500,"message":"boom"}`))
+	}))
+	defer server.Close()
+
+	_, err := generateLinks(context.Background(), server.Client(), server.URL, "https://example.com/", 5, 2)
+	assert.ErrorContains(t, err, "boom")
+}
@@ -0,0 +1,157 @@
+// Command loadgen generates short links on a running instance and replays
+// redirect traffic against them, reporting latency percentiles per traffic class.
+//
+// Usage:
+//
+//	go run ./cmd/loadgen -target http://localhost:8080 -links 1000 -duration 30s -pattern zipf -bot-ratio 0.1
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// options holds the command line flags of a load test run
+type options struct {
+	target      string
+	links       int
+	urlPrefix   string
+	requests    int
+	duration    time.Duration
+	concurrency int
+	rate        int
+	timeout     time.Duration
+	traffic     trafficOptions
+}
+
+func main() {
+	opts := parseFlags()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, opts); err != nil {
+		fmt.Fprintln(os.Stderr, "loadgen:", err)
+		os.Exit(1)
+	}
+}
+
+// parseFlags reads and validates the command line flags
+func parseFlags() *options {
+	opts := &options{}
+	flag.StringVar(&opts.target, "target", "http://localhost:8080", "base URL of the instance under test")
+	flag.IntVar(&opts.links, "links", 1000, "number of short links to generate before replaying traffic")
+	flag.StringVar(&opts.urlPrefix, "url-prefix", "https://example.com/loadgen/", "prefix of the generated destination URLs")
+	flag.IntVar(&opts.requests, "requests", 0, "stop after this many redirect requests (0 for no limit)")
+	flag.DurationVar(&opts.duration, "duration", 30*time.Second, "stop after this long (0 for no limit)")
+	flag.IntVar(&opts.concurrency, "concurrency", 32, "number of concurrent clients")
+	flag.IntVar(&opts.rate, "rate", 0, "target requests per second across all clients (0 for as fast as possible)")
+	flag.DurationVar(&opts.timeout, "timeout", 5*time.Second, "timeout of a single request")
+	flag.StringVar(&opts.traffic.pattern, "pattern", patternZipf, "key popularity: uniform or zipf")
+	flag.Float64Var(&opts.traffic.zipfS, "zipf-s", 1.1, "zipf skew, must be > 1 (higher is hotter)")
+	flag.Float64Var(&opts.traffic.botRatio, "bot-ratio", 0, "share of requests sent as crawler bursts")
+	flag.IntVar(&opts.traffic.botBurst, "bot-burst", 50, "consecutive crawler requests per burst")
+	flag.Float64Var(&opts.traffic.missingRatio, "missing-ratio", 0, "share of requests for codes that do not exist")
+	flag.Parse()
+
+	if opts.requests <= 0 && opts.duration <= 0 {
+		fmt.Fprintln(os.Stderr, "loadgen: set -requests or -duration")
+		os.Exit(2)
+	}
+	if err := opts.traffic.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "loadgen:", err)
+		os.Exit(2)
+	}
+	if opts.links <= 0 || opts.concurrency <= 0 {
+		fmt.Fprintln(os.Stderr, "loadgen: -links and -concurrency must be positive")
+		os.Exit(2)
+	}
+	return opts
+}
+
+// run generates the links, replays the traffic and prints the report
+func run(ctx context.Context, opts *options) error {
+	client := &http.Client{
+		Timeout: opts.timeout,
+		// Measure the redirect itself, not the destination
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Transport: &http.Transport{
+			MaxIdleConns:        opts.concurrency,
+			MaxIdleConnsPerHost: opts.concurrency,
+		},
+	}
+
+	fmt.Printf("Generating %d links on %s...\n", opts.links, opts.target)
+	start := time.Now()
+	codes, err := generateLinks(ctx, client, opts.target, opts.urlPrefix, opts.links, opts.concurrency)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Generated %d links in %s\n\n", len(codes), time.Since(start).Round(time.Millisecond))
+
+	if opts.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.duration)
+		defer cancel()
+	}
+
+	fmt.Printf("Replaying %s traffic with %d clients...\n", opts.traffic.pattern, opts.concurrency)
+	requests := make(chan redirectRequest, opts.concurrency)
+	go produce(ctx, newTraffic(codes, &opts.traffic), opts.requests, opts.rate, requests)
+
+	rec := newRecorder()
+	start = time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range requests {
+				status, latency, err := redirect(ctx, client, opts.target, req)
+				rec.record(req.class, status, latency, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	rec.report(os.Stdout, time.Since(start))
+	return nil
+}
+
+// produce feeds redirect requests to the clients until the limit, the deadline or cancellation
+func produce(ctx context.Context, t *traffic, limit, rate int, out chan<- redirectRequest) {
+	defer close(out)
+
+	var tick <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for sent := 0; limit <= 0 || sent < limit; sent++ {
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case out <- t.next():
+		case <-ctx.Done():
+			return
+		}
+	}
+}
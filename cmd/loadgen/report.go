@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// errStopped marks requests interrupted by the end of the run
+var errStopped = errors.New("stopped")
+
+// classStats collects the outcomes of one traffic class
+type classStats struct {
+	latencies []time.Duration
+	statuses  map[int]int
+	errors    int
+}
+
+// recorder collects request outcomes from concurrent clients
+type recorder struct {
+	mu      sync.Mutex
+	classes map[string]*classStats
+}
+
+// newRecorder creates an empty recorder
+func newRecorder() *recorder {
+	return &recorder{classes: make(map[string]*classStats)}
+}
+
+// record adds the outcome of a request
+func (r *recorder) record(class string, status int, latency time.Duration, err error) {
+	if errors.Is(err, errStopped) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats, ok := r.classes[class]
+	if !ok {
+		stats = &classStats{statuses: make(map[int]int)}
+		r.classes[class] = stats
+	}
+	if err != nil {
+		stats.errors++
+		return
+	}
+	stats.latencies = append(stats.latencies, latency)
+	stats.statuses[status]++
+}
+
+// report writes throughput, status codes and latency percentiles per traffic class
+func (r *recorder) report(w io.Writer, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var total int
+	for _, stats := range r.classes {
+		total += len(stats.latencies) + stats.errors
+	}
+	fmt.Fprintf(w, "\n%d requests in %s (%.1f req/s)\n\n", total, elapsed.Round(time.Millisecond),
+		float64(total)/elapsed.Seconds())
+
+	fmt.Fprintf(w, "%-8s %8s %6s %9s %9s %9s %9s %9s  %s\n",
+		"class", "requests", "errors", "p50", "p90", "p95", "p99", "max", "statuses")
+
+	classes := make([]string, 0, len(r.classes))
+	for class := range r.classes {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	for _, class := range classes {
+		stats := r.classes[class]
+		sorted := slices.Clone(stats.latencies)
+		slices.Sort(sorted)
+
+		fmt.Fprintf(w, "%-8s %8d %6d %9s %9s %9s %9s %9s  %s\n",
+			class, len(sorted)+stats.errors, stats.errors,
+			formatLatency(percentile(sorted, 50)),
+			formatLatency(percentile(sorted, 90)),
+			formatLatency(percentile(sorted, 95)),
+			formatLatency(percentile(sorted, 99)),
+			formatLatency(percentile(sorted, 100)),
+			formatStatuses(stats.statuses))
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// formatLatency rounds a latency for display
+func formatLatency(d time.Duration) string {
+	return d.Round(10 * time.Microsecond).String()
+}
+
+// formatStatuses renders status code counts, e.g. "302:980 404:20"
+func formatStatuses(statuses map[int]int) string {
+	codes := make([]int, 0, len(statuses))
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	var out string
+	for i, code := range codes {
+		if i > 0 {
+			out += " "
+		}
+		out += fmt.Sprintf("%d:%d", code, statuses[code])
+	}
+	return out
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	assert.Equal(t, 50*time.Millisecond, percentile(sorted, 50))
+	assert.Equal(t, 99*time.Millisecond, percentile(sorted, 99))
+	assert.Equal(t, 100*time.Millisecond, percentile(sorted, 100))
+	assert.Equal(t, time.Millisecond, percentile(sorted, 0))
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+	assert.Equal(t, 3*time.Millisecond, percentile([]time.Duration{time.Millisecond, 3 * time.Millisecond}, 90))
+}
+
+func TestRecorder_Report(t *testing.T) {
+	rec := newRecorder()
+	rec.record(classVisitor, http.StatusFound, 2*time.Millisecond, nil)
+	rec.record(classVisitor, http.StatusFound, 4*time.Millisecond, nil)
+	rec.record(classMissing, http.StatusNotFound, time.Millisecond, nil)
+	rec.record(classVisitor, 0, time.Second, errors.New("connection refused"))
+	rec.record(classVisitor, 0, 0, errStopped)
+
+	var out bytes.Buffer
+	rec.report(&out, time.Second)
+
+	report := out.String()
+	assert.Contains(t, report, "4 requests in 1s")
+	assert.Contains(t, report, "302:2")
+	assert.Contains(t, report, "404:1")
+	assert.Regexp(t, `visitor\s+3\s+1\s`, report)
+	assert.Regexp(t, `missing\s+1\s+0\s`, report)
+}
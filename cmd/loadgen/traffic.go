@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"math/rand/v2"
+
+	"octopus/internal/encoder"
+)
+
+// Key popularity patterns
+const (
+	patternUniform = "uniform"
+	patternZipf    = "zipf"
+)
+
+// Traffic classes reported separately
+const (
+	classVisitor = "visitor"
+	classBot     = "bot"
+	classMissing = "missing"
+)
+
+const (
+	visitorUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36 octopus-loadgen"
+	botUserAgent     = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html) octopus-loadgen"
+)
+
+// trafficOptions configures the shape of the replayed traffic
+type trafficOptions struct {
+	pattern      string
+	zipfS        float64
+	botRatio     float64
+	botBurst     int
+	missingRatio float64
+}
+
+// validate checks the traffic options for consistency
+func (o *trafficOptions) validate() error {
+	if o.pattern != patternUniform && o.pattern != patternZipf {
+		return errors.New("-pattern must be uniform or zipf")
+	}
+	if o.pattern == patternZipf && o.zipfS <= 1 {
+		return errors.New("-zipf-s must be greater than 1")
+	}
+	if o.botRatio < 0 || o.missingRatio < 0 || o.botRatio+o.missingRatio > 1 {
+		return errors.New("-bot-ratio and -missing-ratio must be between 0 and 1 in total")
+	}
+	if o.botRatio > 0 && o.botBurst <= 0 {
+		return errors.New("-bot-burst must be positive")
+	}
+	return nil
+}
+
+// redirectRequest is a single redirect to replay
+type redirectRequest struct {
+	code      string
+	userAgent string
+	class     string
+}
+
+// traffic produces redirect requests following the configured pattern.
+// It is not safe for concurrent use.
+type traffic struct {
+	codes   []string
+	opts    *trafficOptions
+	rnd     *rand.Rand
+	zipf    *rand.Zipf
+	encoder *encoder.Base32Encoder
+	burst   int // crawler requests left in the current burst
+}
+
+// newTraffic creates a traffic pattern over the given codes
+func newTraffic(codes []string, opts *trafficOptions) *traffic {
+	rnd := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	t := &traffic{
+		codes:   codes,
+		opts:    opts,
+		rnd:     rnd,
+		encoder: encoder.NewBase32Encoder(),
+	}
+	if opts.pattern == patternZipf {
+		t.zipf = rand.NewZipf(rnd, opts.zipfS, 1, uint64(len(codes)-1))
+	}
+	return t
+}
+
+// next returns the next request to replay
+func (t *traffic) next() redirectRequest {
+	if t.burst > 0 {
+		t.burst--
+		// Crawlers walk the link space rather than following popularity
+		return redirectRequest{code: t.codes[t.rnd.IntN(len(t.codes))], userAgent: botUserAgent, class: classBot}
+	}
+
+	roll := t.rnd.Float64()
+	switch {
+	case roll < t.opts.missingRatio:
+		code := t.encoder.Encode(t.rnd.Uint64(), len(t.codes[0]))
+		return redirectRequest{code: code, userAgent: visitorUserAgent, class: classMissing}
+	case roll < t.opts.missingRatio+t.opts.botRatio/float64(t.opts.botBurst):
+		// Bursts start rarely enough for crawler requests to make up botRatio of the traffic
+		t.burst = t.opts.botBurst
+		return t.next()
+	default:
+		return redirectRequest{code: t.codes[t.hotIndex()], userAgent: visitorUserAgent, class: classVisitor}
+	}
+}
+
+// hotIndex picks a link following the key popularity pattern
+func (t *traffic) hotIndex() int {
+	if t.zipf != nil {
+		return int(t.zipf.Uint64())
+	}
+	return t.rnd.IntN(len(t.codes))
+}
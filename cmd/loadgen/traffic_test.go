@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testCodes(n int) []string {
+	codes := make([]string, n)
+	for i := range codes {
+		codes[i] = string(rune('A'+i%26)) + "CODE" + string(rune('A'+i/26))
+	}
+	return codes
+}
+
+func TestTrafficOptions_Validate(t *testing.T) {
+	valid := trafficOptions{pattern: patternZipf, zipfS: 1.1, botBurst: 10}
+	assert.NoError(t, valid.validate())
+
+	tests := map[string]trafficOptions{
+		"unknown pattern":  {pattern: "random"},
+		"flat zipf":        {pattern: patternZipf, zipfS: 1},
+		"ratios above one": {pattern: patternUniform, botRatio: 0.6, missingRatio: 0.5, botBurst: 10},
+		"empty bot burst":  {pattern: patternUniform, botRatio: 0.1},
+	}
+	for name, opts := range tests {
+		assert.Error(t, opts.validate(), name)
+	}
+}
+
+func TestTraffic_Next(t *testing.T) {
+	codes := testCodes(100)
+
+	t.Run("zipf concentrates on hot keys", func(t *testing.T) {
+		tr := newTraffic(codes, &trafficOptions{pattern: patternZipf, zipfS: 1.5})
+
+		counts := make(map[string]int)
+		for i := 0; i < 10000; i++ {
+			req := tr.next()
+			assert.Equal(t, classVisitor, req.class)
+			counts[req.code]++
+		}
+		// The hottest key alone takes a large share with s=1.5
+		assert.Greater(t, counts[codes[0]], 2000)
+	})
+
+	t.Run("bots arrive in bursts at the configured share", func(t *testing.T) {
+		tr := newTraffic(codes, &trafficOptions{pattern: patternUniform, botRatio: 0.2, botBurst: 20})
+
+		var bots, run, longest int
+		for i := 0; i < 50000; i++ {
+			req := tr.next()
+			if req.class == classBot {
+				bots++
+				run++
+				assert.Equal(t, botUserAgent, req.userAgent)
+			} else {
+				run = 0
+			}
+			longest = max(longest, run)
+		}
+		assert.InDelta(t, 0.2, float64(bots)/50000, 0.05)
+		assert.GreaterOrEqual(t, longest, 20)
+	})
+
+	t.Run("missing codes look like real codes", func(t *testing.T) {
+		tr := newTraffic(codes, &trafficOptions{pattern: patternUniform, missingRatio: 1})
+
+		req := tr.next()
+		assert.Equal(t, classMissing, req.class)
+		assert.Len(t, req.code, len(codes[0]))
+	})
+}
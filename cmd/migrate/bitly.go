@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"octopus/internal/model"
+)
+
+const (
+	// defaultBitlyURL is the base URL of the Bitly API v4
+	defaultBitlyURL = "https://api-ssl.bitly.com/v4"
+	// bitlyPageSize is the number of links listed per request, the most Bitly allows
+	bitlyPageSize = 100
+	// bitlyTimeLayout is the layout of the times in Bitly responses, e.g. 2021-04-01T12:00:00+0000
+	bitlyTimeLayout = "2006-01-02T15:04:05-0700"
+)
+
+// bitlyClient lists the links of a Bitly group through the API v4
+type bitlyClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// bitlink is a link listed by Bitly, its ID being its domain and code, e.g. bit.ly/3xYzAbc
+type bitlink struct {
+	ID             string   `json:"id"`
+	LongURL        string   `json:"long_url"`
+	Title          string   `json:"title"`
+	CreatedAt      string   `json:"created_at"`
+	CustomBitlinks []string `json:"custom_bitlinks"`
+}
+
+// newBitlyClient creates a client of the Bitly API at baseURL authenticating with token
+func newBitlyClient(baseURL, token string, client *http.Client) *bitlyClient {
+	return &bitlyClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		http:    client,
+	}
+}
+
+// Links lists the links of a group, the default group of the token's user when group is empty.
+// Custom back-halves are imported as links of their own, without clicks, as Bitly counts the
+// clicks of a link and its back-halves together; with clicks the daily clicks of every link are
+// fetched, one request per link.
+func (c *bitlyClient) Links(ctx context.Context, group string, clicks bool) ([]model.ImportedLink, error) {
+	if group == "" {
+		var user struct {
+			DefaultGroupGUID string `json:"default_group_guid"`
+		}
+		if err := c.get(ctx, c.baseURL+"/user", &user); err != nil {
+			return nil, err
+		}
+		group = user.DefaultGroupGUID
+	}
+
+	var links []model.ImportedLink
+	next := fmt.Sprintf("%s/groups/%s/bitlinks?size=%d", c.baseURL, url.PathEscape(group), bitlyPageSize)
+	for next != "" {
+		var page struct {
+			Links      []bitlink `json:"links"`
+			Pagination struct {
+				Next string `json:"next"`
+			} `json:"pagination"`
+		}
+		if err := c.get(ctx, next, &page); err != nil {
+			return nil, err
+		}
+
+		for _, bl := range page.Links {
+			createdAt, err := parseBitlyTime(bl.CreatedAt)
+			if err != nil {
+				return nil, fmt.Errorf("bitly: %s: invalid created_at: %w", bl.ID, err)
+			}
+			link := model.ImportedLink{Code: bitlyCode(bl.ID), URL: bl.LongURL, Title: bl.Title, CreatedAt: createdAt}
+			if clicks {
+				if link.Clicks, err = c.clicks(ctx, bl.ID); err != nil {
+					return nil, err
+				}
+			}
+			links = append(links, link)
+
+			for _, custom := range bl.CustomBitlinks {
+				link.Code = bitlyCode(custom)
+				link.Clicks = nil
+				links = append(links, link)
+			}
+		}
+		next = page.Pagination.Next
+	}
+	return links, nil
+}
+
+// clicks returns the clicks of a link on every day it was clicked
+func (c *bitlyClient) clicks(ctx context.Context, id string) ([]model.DailyClicks, error) {
+	var resp struct {
+		LinkClicks []struct {
+			Date   string `json:"date"`
+			Clicks int64  `json:"clicks"`
+		} `json:"link_clicks"`
+	}
+	if err := c.get(ctx, c.baseURL+"/bitlinks/"+id+"/clicks?unit=day&units=-1", &resp); err != nil {
+		return nil, err
+	}
+
+	clicks := make([]model.DailyClicks, 0, len(resp.LinkClicks))
+	for _, lc := range resp.LinkClicks {
+		if lc.Clicks == 0 {
+			continue
+		}
+		day, err := parseBitlyTime(lc.Date)
+		if err != nil {
+			return nil, fmt.Errorf("bitly: %s: invalid click date: %w", id, err)
+		}
+		clicks = append(clicks, model.DailyClicks{Day: day, Clicks: lc.Clicks})
+	}
+	return clicks, nil
+}
+
+// get decodes the JSON response to an authenticated GET request into v
+func (c *bitlyClient) get(ctx context.Context, rawURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("bitly: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message     string `json:"message"`
+			Description string `json:"description"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		_ = json.Unmarshal(body, &apiErr)
+		return fmt.Errorf("bitly: GET %s: %s %s %s", req.URL.Path, resp.Status, apiErr.Message, apiErr.Description)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("bitly: GET %s: %w", req.URL.Path, err)
+	}
+	return nil
+}
+
+// bitlyCode returns the code of a Bitly link ID or URL, the path after its domain
+func bitlyCode(id string) string {
+	return id[strings.LastIndex(id, "/")+1:]
+}
+
+// parseBitlyTime parses a time of a Bitly response as UTC
+func parseBitlyTime(value string) (time.Time, error) {
+	t, err := time.Parse(bitlyTimeLayout, value)
+	if err != nil {
+		if t, err = time.Parse(time.RFC3339, value); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return t.UTC(), nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"octopus/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitlyClient_Links(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/v4/user":
+			fmt.Fprint(w, `{"default_group_guid": "Bg1"}`)
+		case "/v4/groups/Bg1/bitlinks":
+			if r.URL.Query().Get("page") == "" {
+				assert.Equal(t, "100", r.URL.Query().Get("size"))
+				fmt.Fprintf(w, `{"links": [{"id": "bit.ly/3xYzAbc", "long_url": "https://example.com/docs", "title": "Docs",
+					"created_at": "2021-04-01T12:00:00+0000", "custom_bitlinks": ["https://bit.ly/DOCS"]}],
+					"pagination": {"next": "%s/v4/groups/Bg1/bitlinks?size=100&page=2"}}`, server.URL)
+				return
+			}
+			fmt.Fprint(w, `{"links": [{"id": "bit.ly/BLOG", "long_url": "https://example.com/blog",
+				"created_at": "2022-01-02T03:04:05+0100"}], "pagination": {"next": ""}}`)
+		case "/v4/bitlinks/bit.ly/3xYzAbc/clicks":
+			assert.Equal(t, "day", r.URL.Query().Get("unit"))
+			fmt.Fprint(w, `{"link_clicks": [{"date": "2021-04-02T00:00:00+0000", "clicks": 3}, {"date": "2021-04-01T00:00:00+0000", "clicks": 0}]}`)
+		case "/v4/bitlinks/bit.ly/BLOG/clicks":
+			fmt.Fprint(w, `{"link_clicks": []}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := newBitlyClient(server.URL+"/v4/", "secret", server.Client())
+	links, err := client.Links(context.Background(), "", true)
+	require.NoError(t, err)
+
+	created := time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, []model.ImportedLink{
+		{Code: "3xYzAbc", URL: "https://example.com/docs", Title: "Docs", CreatedAt: created, Clicks: []model.DailyClicks{
+			{Day: time.Date(2021, 4, 2, 0, 0, 0, 0, time.UTC), Clicks: 3},
+		}},
+		{Code: "DOCS", URL: "https://example.com/docs", Title: "Docs", CreatedAt: created},
+		{Code: "BLOG", URL: "https://example.com/blog", CreatedAt: time.Date(2022, 1, 2, 2, 4, 5, 0, time.UTC), Clicks: []model.DailyClicks{}},
+	}, links)
+}
+
+func TestBitlyClient_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "FORBIDDEN", "description": "You are currently forbidden to access this resource."}`)
+	}))
+	defer server.Close()
+
+	client := newBitlyClient(server.URL, "secret", server.Client())
+	_, err := client.Links(context.Background(), "Bg1", false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "403 Forbidden FORBIDDEN")
+}
@@ -0,0 +1,204 @@
+// Command migrate imports the links of another shortener under their own codes, keeping their
+// creation dates and seeding their past clicks into the daily aggregates. Bitly links are read
+// through its API, YOURLS links from a CSV export of its yourls_url table. Links whose code is
+// taken by another URL or cannot be served are reported as conflicts and left out.
+//
+// Usage:
+//
+//	go run ./cmd/migrate -config configs/config.yaml -from bitly -token $BITLY_TOKEN -dry-run
+//	go run ./cmd/migrate -config configs/config.yaml -from yourls -file yourls_url.csv -report conflicts.csv
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/encoder"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/internal/service"
+)
+
+// Shorteners links are imported from
+const (
+	fromBitly  = "bitly"
+	fromYOURLS = "yourls"
+)
+
+// options holds the command line flags of an import
+type options struct {
+	configPath string
+	profile    string
+	from       string
+	token      string
+	group      string
+	bitlyURL   string
+	clicks     bool
+	file       string
+	location   *time.Location
+	report     string
+	dryRun     bool
+}
+
+func main() {
+	opts := parseFlags()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, opts); err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		os.Exit(1)
+	}
+}
+
+// parseFlags reads and validates the command line flags
+func parseFlags() *options {
+	opts := &options{}
+	var timezone string
+	flag.StringVar(&opts.configPath, "config", "configs/config.yaml", "configuration file of the instance importing the links")
+	flag.StringVar(&opts.profile, "profile", os.Getenv(config.EnvPrefix+"_PROFILE"), "profile overriding the configuration file")
+	flag.StringVar(&opts.from, "from", "", "shortener the links come from: bitly or yourls")
+	flag.StringVar(&opts.token, "token", os.Getenv("BITLY_TOKEN"), "Bitly access token")
+	flag.StringVar(&opts.group, "group", "", "Bitly group GUID, the default group of the token's user when empty")
+	flag.StringVar(&opts.bitlyURL, "bitly-url", defaultBitlyURL, "base URL of the Bitly API")
+	flag.BoolVar(&opts.clicks, "clicks", true, "import the past clicks of the links")
+	flag.StringVar(&opts.file, "file", "", "CSV export of the YOURLS yourls_url table")
+	flag.StringVar(&timezone, "timezone", "UTC", "time zone of the YOURLS timestamps")
+	flag.StringVar(&opts.report, "report", "", "write the conflicts to this CSV file instead of stdout")
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "only report what would be imported")
+	flag.Parse()
+
+	switch opts.from {
+	case fromBitly:
+		if opts.token == "" {
+			fmt.Fprintln(os.Stderr, "migrate: -token or BITLY_TOKEN is required to import from bitly")
+			os.Exit(2)
+		}
+	case fromYOURLS:
+		if opts.file == "" {
+			fmt.Fprintln(os.Stderr, "migrate: -file is required to import from yourls")
+			os.Exit(2)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "migrate: -from must be bitly or yourls")
+		os.Exit(2)
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate: invalid -timezone:", err)
+		os.Exit(2)
+	}
+	opts.location = location
+	return opts
+}
+
+// run reads the links, imports them and prints the report
+func run(ctx context.Context, opts *options) error {
+	cfg, err := config.LoadSources(&config.Sources{Path: opts.configPath, Profile: opts.profile})
+	if err != nil {
+		return err
+	}
+	codeEncoder, err := encoder.NewBase32EncoderWithAlphabet(cfg.ShortCode.Alphabet)
+	if err != nil {
+		return fmt.Errorf("invalid short_code.alphabet: %w", err)
+	}
+
+	links, err := readLinks(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	database, err := repository.NewMySQLRepository(&cfg.Database.MySQL)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	redisRepo, err := repository.NewRedisRepository(&cfg.Database.Redis)
+	if err != nil {
+		return err
+	}
+	defer redisRepo.Close()
+
+	bloomSvc := service.NewBloomService(redisRepo.GetClient(), &cfg.Bloom)
+	importSvc := service.NewImportService(database, bloomSvc)
+	importSvc.SetEncoder(codeEncoder)
+	if cfg.SMS.Enabled {
+		importSvc.SetSMSCodeLength(service.NewSMSPoolService(database, redisRepo, bloomSvc, &cfg.SMS).CodeLength())
+	}
+
+	report, err := importSvc.Import(ctx, links, opts.dryRun)
+	if report != nil {
+		if werr := writeReport(opts, report); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return err
+}
+
+// readLinks reads the links of the shortener they come from
+func readLinks(ctx context.Context, opts *options) ([]model.ImportedLink, error) {
+	if opts.from == fromBitly {
+		client := newBitlyClient(opts.bitlyURL, opts.token, &http.Client{Timeout: 30 * time.Second})
+		return client.Links(ctx, opts.group, opts.clicks)
+	}
+
+	f, err := os.Open(opts.file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readYOURLS(f, opts.location, opts.clicks, time.Now())
+}
+
+// writeReport prints the outcome of an import and writes its conflicts
+func writeReport(opts *options, report *model.ImportReport) error {
+	verb := "imported"
+	if report.DryRun {
+		verb = "to import"
+	}
+	fmt.Printf("%d links %s with %d clicks, %d imported before, %d conflicts\n",
+		len(report.Imported), verb, report.Clicks, len(report.Skipped), len(report.Conflicts))
+	if len(report.Conflicts) == 0 {
+		return nil
+	}
+
+	if opts.report == "" {
+		return writeConflicts(os.Stdout, report.Conflicts)
+	}
+	f, err := os.Create(opts.report)
+	if err != nil {
+		return err
+	}
+	if err := writeConflicts(f, report.Conflicts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeConflicts writes conflicts as CSV rows of code, URL and reason
+func writeConflicts(w io.Writer, conflicts []model.ImportConflict) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"code", "url", "reason"}); err != nil {
+		return err
+	}
+	for _, conflict := range conflicts {
+		if err := cw.Write([]string{conflict.Code, conflict.URL, conflict.Reason}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"octopus/internal/model"
+)
+
+// yourlsTimeLayout is the layout of the timestamp column of yourls_url
+const yourlsTimeLayout = "2006-01-02 15:04:05"
+
+// readYOURLS reads links from a CSV export of the yourls_url table, with a header row naming at
+// least the keyword and url columns. Timestamps are in loc. YOURLS keeps only the total clicks of
+// a link, so with clicks they are seeded on the day it was created, or now when its timestamp is
+// missing.
+func readYOURLS(r io.Reader, loc *time.Location, clicks bool, now time.Time) ([]model.ImportedLink, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("yourls: failed to read the header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, name := range []string{"keyword", "url"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("yourls: no %s column", name)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var links []model.ImportedLink
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return links, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("yourls: %w", err)
+		}
+
+		link := model.ImportedLink{
+			Code:  field(record, "keyword"),
+			URL:   field(record, "url"),
+			Title: field(record, "title"),
+		}
+		if ts := field(record, "timestamp"); ts != "" && !strings.HasPrefix(ts, "0000") {
+			createdAt, err := time.ParseInLocation(yourlsTimeLayout, ts, loc)
+			if err != nil {
+				return nil, fmt.Errorf("yourls: line %d: invalid timestamp %q", line, ts)
+			}
+			link.CreatedAt = createdAt.UTC()
+		}
+		if total := field(record, "clicks"); clicks && total != "" {
+			n, err := strconv.ParseInt(total, 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("yourls: line %d: invalid clicks %q", line, total)
+			}
+			day := link.CreatedAt
+			if day.IsZero() {
+				day = now.UTC()
+			}
+			if n > 0 {
+				link.Clicks = []model.DailyClicks{{Day: day, Clicks: n}}
+			}
+		}
+		links = append(links, link)
+	}
+}
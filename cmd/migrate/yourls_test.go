@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"octopus/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadYOURLS(t *testing.T) {
+	export := "\ufeffkeyword,url,title,timestamp,ip,clicks\n" +
+		"docs,https://example.com/docs,\"Docs, guides\",2021-04-01 14:00:00,10.0.0.1,42\n" +
+		"blog,https://example.com/blog,,0000-00-00 00:00:00,10.0.0.1,5\n" +
+		"help,https://example.com/help,Help,2021-05-01 00:30:00,10.0.0.1,0\n"
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	links, err := readYOURLS(strings.NewReader(export), paris, true, now)
+	require.NoError(t, err)
+	assert.Equal(t, []model.ImportedLink{
+		{Code: "docs", URL: "https://example.com/docs", Title: "Docs, guides", CreatedAt: time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC),
+			Clicks: []model.DailyClicks{{Day: time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC), Clicks: 42}}},
+		{Code: "blog", URL: "https://example.com/blog", Clicks: []model.DailyClicks{{Day: now, Clicks: 5}}},
+		{Code: "help", URL: "https://example.com/help", Title: "Help", CreatedAt: time.Date(2021, 4, 30, 22, 30, 0, 0, time.UTC)},
+	}, links)
+
+	links, err = readYOURLS(strings.NewReader(export), time.UTC, false, now)
+	require.NoError(t, err)
+	assert.Nil(t, links[0].Clicks)
+
+	_, err = readYOURLS(strings.NewReader("keyword,title\ndocs,Docs\n"), time.UTC, true, now)
+	assert.EqualError(t, err, "yourls: no url column")
+
+	_, err = readYOURLS(strings.NewReader("keyword,url,clicks\ndocs,https://example.com,many\n"), time.UTC, true, now)
+	assert.EqualError(t, err, `yourls: line 2: invalid clicks "many"`)
+}
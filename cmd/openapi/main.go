@@ -0,0 +1,98 @@
+// Command openapi generates the OpenAPI specs of the service from the annotations of its handlers,
+// one for the public API and one for the admin API. The specs are committed under api/openapi,
+// served at /openapi.json and used to generate the client SDKs; -check fails when they are stale.
+//
+// Usage:
+//
+//	go run ./cmd/openapi -check
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/swaggo/swag"
+)
+
+// specs maps the generated files to the tags of the operations they document
+var specs = []struct {
+	file string
+	tags string
+}{
+	{file: "openapi.json", tags: "shortlink,analytics,drains,crawler,static,build"},
+	{file: "admin.json", tags: "admin"},
+}
+
+// options holds the command line flags of a generation run
+type options struct {
+	root   string
+	main   string
+	output string
+	check  bool
+}
+
+func main() {
+	opts := &options{}
+	flag.StringVar(&opts.root, "root", ".", "root of the module")
+	flag.StringVar(&opts.main, "main", "cmd/server/main.go", "file holding the general API annotations, relative to -root")
+	flag.StringVar(&opts.output, "output", "api/openapi", "directory of the specs, relative to -root")
+	flag.BoolVar(&opts.check, "check", false, "fail if the committed specs differ from the generated ones")
+	flag.Parse()
+
+	if err := run(opts); err != nil {
+		fmt.Fprintln(os.Stderr, "openapi:", err)
+		os.Exit(1)
+	}
+}
+
+// run generates every spec and writes it, or compares it with the committed one
+func run(opts *options) error {
+	var stale []string
+	for _, s := range specs {
+		generated, err := generate(opts.root, opts.main, s.tags)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.file, err)
+		}
+
+		path := filepath.Join(opts.root, opts.output, s.file)
+		if opts.check {
+			committed, err := os.ReadFile(path)
+			if err != nil || !bytes.Equal(committed, generated) {
+				stale = append(stale, path)
+			}
+			continue
+		}
+		if err := os.WriteFile(path, generated, 0o644); err != nil {
+			return err
+		}
+		fmt.Println("wrote", path)
+	}
+
+	if len(stale) > 0 {
+		return fmt.Errorf("%v out of date, run make openapi", stale)
+	}
+	return nil
+}
+
+// generate parses the annotations of the operations carrying the given tags into an indented spec
+func generate(root, mainFile, tags string) ([]byte, error) {
+	parser := swag.New(
+		swag.SetTags(tags),
+		swag.SetDebugger(log.New(io.Discard, "", 0)),
+	)
+	if err := parser.ParseAPI(root, mainFile, 100); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(parser.GetSwagger(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,10 @@
+package main
+
+import "testing"
+
+// TestSpecsUpToDate fails when handler annotations changed without regenerating the specs
+func TestSpecsUpToDate(t *testing.T) {
+	if err := run(&options{root: "../..", main: "cmd/server/main.go", output: "api/openapi", check: true}); err != nil {
+		t.Fatal(err)
+	}
+}
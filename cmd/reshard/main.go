@@ -0,0 +1,109 @@
+// Command reshard moves the keys of short links to the Redis shard owning them, after shards were
+// added to or removed from database.redis_shards or sharding was turned on. Keys left on
+// database.redis by an unsharded deployment are moved too; shards being removed are drained by
+// listing them with -drain.
+//
+// Usage:
+//
+//	go run ./cmd/reshard -config configs/config.yaml -profile prod -drain redis-old:6379 -dry-run
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"octopus/internal/config"
+	"octopus/internal/repository"
+)
+
+// options holds the command line flags of a resharding run
+type options struct {
+	configPath    string
+	profile       string
+	drain         []string
+	drainPassword string
+	batch         int64
+	dryRun        bool
+}
+
+func main() {
+	opts := parseFlags()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, opts); err != nil {
+		fmt.Fprintln(os.Stderr, "reshard:", err)
+		os.Exit(1)
+	}
+}
+
+// parseFlags reads and validates the command line flags
+func parseFlags() *options {
+	opts := &options{}
+	var drain string
+	flag.StringVar(&opts.configPath, "config", "configs/config.yaml", "configuration file listing the shards")
+	flag.StringVar(&opts.profile, "profile", os.Getenv(config.EnvPrefix+"_PROFILE"), "profile overriding the configuration file")
+	flag.StringVar(&drain, "drain", "", "comma-separated addresses of Redis instances leaving the ring")
+	flag.StringVar(&opts.drainPassword, "drain-password", os.Getenv("REDIS_DRAIN_PASSWORD"), "password of the drained instances")
+	flag.Int64Var(&opts.batch, "batch", 1000, "keys scanned per round trip")
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "only count the keys to move")
+	flag.Parse()
+
+	for _, addr := range strings.Split(drain, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			opts.drain = append(opts.drain, addr)
+		}
+	}
+	if opts.batch <= 0 {
+		fmt.Fprintln(os.Stderr, "reshard: -batch must be positive")
+		os.Exit(2)
+	}
+	return opts
+}
+
+// run moves the keys and prints how many were moved
+func run(ctx context.Context, opts *options) error {
+	cfg, err := config.LoadSources(&config.Sources{Path: opts.configPath, Profile: opts.profile})
+	if err != nil {
+		return err
+	}
+	if len(cfg.Database.RedisShards.Shards) == 0 {
+		return errors.New("no shards in database.redis_shards")
+	}
+
+	shared, err := repository.NewRedisRepository(&cfg.Database.Redis)
+	if err != nil {
+		return err
+	}
+	defer shared.Close()
+
+	drained := []*repository.RedisRepository{shared}
+	for _, addr := range opts.drain {
+		repo, err := repository.NewRedisRepository(&config.RedisConfig{Addr: addr, Password: opts.drainPassword})
+		if err != nil {
+			return fmt.Errorf("%s: %w", addr, err)
+		}
+		defer repo.Close()
+		drained = append(drained, repo)
+	}
+
+	shards := repository.NewShardedRedisRepository(shared, &cfg.Database.RedisShards)
+	defer shards.Close()
+
+	result, err := shards.Reshard(ctx, drained, opts.batch, opts.dryRun)
+	if result != nil {
+		verb := "moved"
+		if opts.dryRun {
+			verb = "to move"
+		}
+		fmt.Printf("scanned %d keys, %d %s, %d left to the newer copy on their shard\n", result.Scanned, result.Moved, verb, result.Kept)
+	}
+	return err
+}
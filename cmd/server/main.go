@@ -2,27 +2,52 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	"octopus/api/openapi"
 	"octopus/internal/config"
+	"octopus/internal/encoder"
 	"octopus/internal/handler"
 	"octopus/internal/model"
 	"octopus/internal/mq"
 	"octopus/internal/repository"
 	"octopus/internal/service"
+	"octopus/internal/storage"
+	"octopus/pkg/apiversion"
+	"octopus/pkg/async"
+	"octopus/pkg/buildinfo"
+	"octopus/pkg/cdn"
+	"octopus/pkg/chaos"
+	"octopus/pkg/geoip"
+	"octopus/pkg/logging"
+	"octopus/pkg/mailer"
 	"octopus/pkg/middleware"
+	"octopus/pkg/objstore"
+	"octopus/pkg/retry"
+	"octopus/pkg/shutdown"
+	"octopus/pkg/slowlog"
+	"octopus/pkg/warehouse"
+	"octopus/web"
 
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 // @title Short Link Service API
@@ -39,73 +64,450 @@ import (
 // @host localhost:8080
 // @BasePath /
 func main() {
-	// Load configuration
-	cfg, err := config.Load("configs/config.yaml")
+	waitForDeps := flag.Bool("wait-for-deps", false, "wait until MySQL and Redis are reachable, then exit")
+	inMemory := flag.Bool("in-memory", false, "keep all data in memory instead of MySQL and Redis, losing it on exit")
+	sources := &config.Sources{}
+	flag.StringVar(&sources.Path, "config", "configs/config.yaml", "base configuration file")
+	flag.StringVar(&sources.Profile, "profile", os.Getenv(config.EnvPrefix+"_PROFILE"), "profile overriding the base configuration, config.<profile>.yaml next to it")
+	flag.Func("set", "override a setting, e.g. --set server.port=9090 (repeatable)", func(override string) error {
+		sources.Overrides = append(sources.Overrides, override)
+		return nil
+	})
+	flag.Parse()
+
+	// Load configuration: defaults, base file, profile, environment, then --set overrides
+	cfg, err := config.LoadSources(sources)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to load configuration")
 	}
 
 	// Setup logger
-	setupLogger(cfg.Server.Mode)
+	build := buildinfo.Get()
+	setupLogger(&cfg.Log, cfg.Server.Mode, build)
+	log.Info().Str("version", build.Version).Str("commit", build.Commit).Str("build_time", build.Time).
+		Str("go_version", build.GoVersion).Bool("modified", build.Modified).Msg("Starting octopus")
+	log.Info().Str("config", sources.Path).Str("profile", sources.Profile).Int("overrides", len(sources.Overrides)).Msg("Configuration loaded")
 
-	// Initialize repositories
-	redisRepo := repository.NewRedisRepository(&cfg.Database.Redis)
-	defer func() {
-		if err := redisRepo.Close(); err != nil {
-			log.Error().Err(err).Msg("Failed to close redis connection")
+	// Initialize repositories, in memory for demos
+	var redisRepo *repository.RedisRepository
+	var mysqlRepo *repository.MySQLRepository
+	var database ownedDatabase
+	if *inMemory {
+		useInMemoryStorage(cfg)
+		redisRepo, database = openMemoryRepositories()
+	} else {
+		redisRepo, mysqlRepo = connectRepositories(&cfg.Server.Startup, &cfg.Database)
+		database = mysqlRepo
+	}
+	if *waitForDeps {
+		log.Info().Msg("Dependencies are reachable")
+		if err := errors.Join(database.Close(), redisRepo.Close()); err != nil {
+			log.Error().Err(err).Msg("Failed to close connections")
 		}
-	}()
+		return
+	}
+	redisRepo.SetRetention(&cfg.Analytics.Retention)
 
-	mysqlRepo := repository.NewMySQLRepository(&cfg.Database.MySQL)
-	defer func() {
-		if err := mysqlRepo.Close(); err != nil {
-			log.Error().Err(err).Msg("Failed to close mysql connection")
+	// Views BI tools query instead of the raw tables (optional), missing views only cost dashboards
+	if mysqlRepo != nil && cfg.Database.MySQL.AnalyticsViews {
+		if err := mysqlRepo.CreateAnalyticsViews(context.Background(), cfg.Reports.Param); err != nil {
+			log.Error().Err(err).Msg("Failed to create analytics views")
 		}
-	}()
+	}
+
+	// Feature flags roll risky features out per share of traffic or per API key
+	flags := service.NewFeatureFlags(redisRepo.GetClient(), &cfg.Flags)
+
+	// Bot, reserved word, URL blocklist and traffic source rules set on the admin port
+	rules := service.NewRules(database, redisRepo.GetClient(), &cfg.Rules)
+	if err := rules.Refresh(context.Background()); err != nil {
+		log.Error().Err(err).Msg("Failed to load rules")
+	}
+
+	// Spread the keys of short links over Redis shards (optional), the Bloom Filter and streams
+	// stay on database.redis
+	var linkRedis storage.Cache = redisRepo
+	var redisShards *repository.ShardedRedisRepository
+	if len(cfg.Database.RedisShards.Shards) > 0 {
+		redisShards = repository.NewShardedRedisRepository(redisRepo, &cfg.Database.RedisShards)
+		redisShards.SetRetention(&cfg.Analytics.Retention)
+		if !cfg.Database.Shadow.RedisShards {
+			linkRedis = redisShards
+		}
+	}
+
+	// Mirror links to the storage a migration moves them to (optional)
+	var linkMySQL storage.Database = database
+	shadowMySQL, shadowRedis := setupShadowing(&cfg.Database, flags, mysqlRepo, redisRepo, redisShards)
+	if shadowMySQL != nil {
+		linkMySQL = shadowMySQL
+	}
+	if shadowRedis != nil {
+		linkRedis = shadowRedis
+	}
+
+	// Log and count slow dependency calls, with the faults injected below
+	slowMySQL := slowlog.NewDetector("mysql", cfg.Log.Slow.MySQL)
+	slowRedis := slowlog.NewDetector("redis", cfg.Log.Slow.Redis)
+	slowHTTP := slowlog.NewDetector("http", cfg.Log.Slow.HTTP)
+	if slowRedis.Active() {
+		redisRepo.EnableSlowLog(slowRedis)
+		if redisShards != nil {
+			redisShards.EnableSlowLog(slowRedis)
+		}
+	}
+	if slowMySQL.Active() && mysqlRepo != nil {
+		if err := mysqlRepo.EnableSlowLog(slowMySQL); err != nil {
+			log.Fatal().Err(err).Msg("Failed to enable the MySQL slow log")
+		}
+	}
+
+	// Inject faults into dependency calls (resilience testing only)
+	if cfg.Chaos.Enabled {
+		log.Warn().Msg("Chaos mode enabled, injecting faults into dependency calls")
+		if injector := newFaultInjector("redis", &cfg.Chaos.Redis); injector.Active() {
+			redisRepo.EnableFaultInjection(injector)
+			if redisShards != nil {
+				redisShards.EnableFaultInjection(injector)
+			}
+		}
+		if injector := newFaultInjector("mysql", &cfg.Chaos.MySQL); injector.Active() && mysqlRepo != nil {
+			if err := mysqlRepo.EnableFaultInjection(injector); err != nil {
+				log.Fatal().Err(err).Msg("Failed to enable MySQL fault injection")
+			}
+		}
+	}
+
+	// Short code format
+	codeEncoder, err := encoder.NewBase32EncoderWithAlphabet(cfg.ShortCode.Alphabet)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid short code alphabet")
+	}
 
 	// Initialize services
 	bloomSvc := service.NewBloomService(redisRepo.GetClient(), &cfg.Bloom)
-	shortLinkSvc := service.NewShortLinkService(mysqlRepo, redisRepo, bloomSvc, getDomain(cfg))
-	analyticsSvc := service.NewAnalyticsService(redisRepo)
+	shortLinkSvc := service.NewShortLinkService(linkMySQL, linkRedis, bloomSvc, cfg.Server.BaseURL)
+	shortLinkSvc.SetEncoder(codeEncoder)
+	if cfg.ShortCode.Generator == config.GeneratorSequence {
+		shortLinkSvc.SetSequence(service.NewCodeSequence(redisRepo.GetClient(), &cfg.ShortCode.Sequence))
+	}
+	analyticsSvc := service.NewAnalyticsService(linkRedis, linkMySQL)
+	shortLinkSvc.SetFlags(flags)
+	analyticsSvc.SetFlags(flags)
+	shortLinkSvc.SetRules(rules)
+	analyticsSvc.SetRules(rules)
+	shortLinkSvc.SetParamSigner(service.NewParamSigner(&cfg.Signing))
+	// Checked when the configuration was validated
+	scheduleLocation, _ := cfg.Redirect.Location()
+	shortLinkSvc.SetTimezone(scheduleLocation)
+	shortLinkSvc.SetCampaignParam(cfg.Reports.Param)
+	// Self-serve mode: links belong to the API key creating or claiming them (optional)
+	var claims *service.ClaimService
+	if cfg.Claims.Enabled {
+		claims = service.NewClaimService(linkMySQL, redisRepo.GetClient(), &cfg.Claims)
+		shortLinkSvc.SetClaims(claims)
+	}
+	// Expiry reminders: tell owners of links about to expire, and let them extend links (optional)
+	var reminders *service.ExpiryReminders
+	if cfg.Reminders.Enabled {
+		reminders = service.NewExpiryReminders(redisRepo.GetClient(), linkMySQL, shortLinkSvc, &cfg.Reminders, newMailer(&cfg.Mail))
+	}
+	// Domain reputation: preview or refuse destinations reported, dead or unsafe (optional)
+	var reputation *service.Reputation
+	if cfg.Reputation.Enabled {
+		reputation = service.NewReputation(linkMySQL, database, redisRepo.GetClient(), &cfg.Reputation)
+		if err := reputation.Refresh(context.Background()); err != nil {
+			log.Warn().Err(err).Msg("Failed to load domain reputations")
+		}
+		shortLinkSvc.SetReputation(reputation)
+	}
+
+	analyticsSvc.SetRetention(&cfg.Analytics.Retention)
+	analyticsSvc.SetCampaignParam(cfg.Reports.Param)
+	if cfg.Analytics.Snapshot.Enabled {
+		analyticsSvc.SetSnapshots(service.NewAnalyticsSnapshots(&cfg.Analytics.Snapshot))
+	}
+
+	// Batch analytics counter writes to Redis (optional)
+	var counterBuffer *service.CounterBuffer
+	if cfg.Analytics.WriteBehind.Enabled {
+		counterBuffer = service.NewCounterBuffer(linkRedis, &cfg.Analytics.WriteBehind)
+		analyticsSvc.SetCounterBuffer(counterBuffer)
+	}
+
+	// Initialize expired code recycling (optional)
+	var recyclerSvc *service.RecyclerService
+	if cfg.Recycle.Enabled {
+		recyclerSvc = service.NewRecyclerService(linkMySQL, linkRedis, bloomSvc, &cfg.Recycle)
+		shortLinkSvc.SetRecycler(recyclerSvc)
+	}
+
+	// Initialize SMS code pool (optional)
+	var smsPoolSvc *service.SMSPoolService
+	if cfg.SMS.Enabled {
+		smsBloomSvc := service.NewBloomService(redisRepo.GetClient(), &cfg.SMS.Bloom)
+		smsPoolSvc = service.NewSMSPoolService(linkMySQL, linkRedis, smsBloomSvc, &cfg.SMS)
+		smsPoolSvc.SetEncoder(codeEncoder)
+		shortLinkSvc.SetSMSPool(smsPoolSvc)
+	}
+
+	// Initialize conversion tracking (optional)
+	var conversionSvc *service.ConversionService
+	if cfg.Conversion.Enabled {
+		conversionSvc = service.NewConversionService(linkMySQL, linkRedis, &cfg.Conversion)
+		conversionSvc.SetRules(rules)
+	}
 
 	// Initialize MQ (optional, can be nil)
-	var mqProducer *mq.Producer
-	if cfg.RocketMQ.NameServer != "" {
-		mqProducer, err = mq.NewProducer(&cfg.RocketMQ)
+	mqProducer, err := newMQProducer(cfg, redisRepo.GetClient())
+	if err != nil {
+		log.Warn().Err(err).Str("driver", cfg.MQ.Driver).Msg("Failed to initialize MQ producer, running without MQ")
+	}
+
+	producer := mqProducer
+	if mqProducer != nil && cfg.Chaos.Enabled {
+		if injector := newFaultInjector("mq", &cfg.Chaos.MQ); injector.Active() {
+			producer = mq.NewFaultInjectingProducer(mqProducer, injector)
+		}
+	}
+
+	// Buffer sends so that a slow or unreachable broker never holds up redirects
+	var producerBuffer *mq.BufferedProducer
+	if producer != nil && cfg.MQ.Buffer.Enabled {
+		producerBuffer, err = mq.NewBufferedProducer(producer, &cfg.MQ.Buffer)
 		if err != nil {
-			log.Warn().Err(err).Msg("Failed to initialize RocketMQ producer, running without MQ")
+			log.Fatal().Err(err).Msg("Failed to initialize MQ producer buffer")
+		}
+		producer = producerBuffer
+	}
+
+	// Stream access events and link mutations to data warehouses (optional)
+	warehouseSvc, err := newWarehouseService(&cfg.Warehouse)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up the warehouse connector")
+	}
+
+	// Forward access events to the log drains link owners register (optional)
+	var logDrains *service.LogDrainService
+	if cfg.Analytics.Drains.Enabled {
+		logDrains = service.NewLogDrainService(redisRepo.GetClient(), linkMySQL, &cfg.Analytics.Drains, cfg.Reports.Param)
+		if claims != nil {
+			logDrains.SetClaims(claims)
+		}
+	}
+
+	// Publish link lifecycle events for downstream systems (optional)
+	var publishers service.EventPublishers
+	if producer != nil && cfg.MQ.LinkEvents {
+		var publisher service.EventPublisherInterface = producer
+		// A primary streams its link mutations to the replicas
+		if cfg.Replication.Role == config.ReplicationRolePrimary {
+			publisher = mq.NewRegionalProducer(producer, cfg.Replication.Region)
+		}
+		publishers = append(publishers, publisher)
+	}
+	if warehouseSvc != nil {
+		publishers = append(publishers, warehouseSvc)
+	}
+	if len(publishers) > 0 {
+		var publisher service.EventPublisherInterface = publishers
+		if len(publishers) == 1 {
+			publisher = publishers[0]
+		}
+		shortLinkSvc.SetEventPublisher(publisher)
+		if recyclerSvc != nil {
+			recyclerSvc.SetEventPublisher(publisher)
+		}
+		if smsPoolSvc != nil {
+			smsPoolSvc.SetEventPublisher(publisher)
 		}
 	}
 
+	// Purge the redirects the CDN edge cached for links once they change (optional)
+	var edgePurgeSvc *service.EdgePurgeService
+	if purger := newEdgePurger(&cfg.Edge.Purge); purger != nil {
+		baseURLs := []string{cfg.Server.BaseURL}
+		if cfg.SMS.Enabled {
+			baseURLs = append(baseURLs, cfg.SMS.Domain)
+		}
+		edgePurgeSvc = service.NewEdgePurgeService(purger, &cfg.Edge.Purge, baseURLs)
+		shortLinkSvc.SetEdgePurger(edgePurgeSvc)
+		if recyclerSvc != nil {
+			recyclerSvc.SetEdgePurger(edgePurgeSvc)
+		}
+		if smsPoolSvc != nil {
+			smsPoolSvc.SetEdgePurger(edgePurgeSvc)
+		}
+	}
+
+	// Replicas serve the primary region's links from local copies and reject changes (optional)
+	var replicationSvc *service.ReplicationService
+	if cfg.Replication.Role == config.ReplicationRoleReplica {
+		shortLinkSvc.SetReadOnly(true)
+		replicationSvc = service.NewReplicationService(linkMySQL, linkRedis, bloomSvc, &cfg.Replication)
+	}
+
 	// Setup Gin
 	gin.SetMode(cfg.Server.Mode)
 	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal().Err(err).Msg("Failed to set trusted proxies")
+	}
 
 	// Middleware
+	requestCounter := middleware.NewRequestCounter()
+	router.Use(requestCounter.Middleware())
+	if slowMySQL.Active() || slowRedis.Active() || slowHTTP.Active() {
+		router.Use(middleware.SlowRequests(slowHTTP))
+	}
 	router.Use(middleware.Logger())
 	router.Use(middleware.Recovery())
+	router.Use(middleware.APIKey())
 	router.Use(corsMiddleware())
 
 	// Setup static files for 404 page
 	router.LoadHTMLGlob("templates/*")
 
-	// API v1 routes
-	v1 := router.Group("/api/v1")
-	{
-		generateHandler := handler.NewGenerateHandler(shortLinkSvc)
-		v1.POST("/shortlink/generate", generateHandler.Generate)
-	}
+	// Maintenance mode suspends writes to links while redirects keep working
+	maintenance := service.NewMaintenanceMode(redisRepo.GetClient(), &cfg.Maintenance)
+	writeGuard := middleware.Maintenance(maintenance.Active)
 
 	// Redirect handler (short codes)
-	redirectHandler := handler.NewRedirectHandler(shortLinkSvc, analyticsSvc, mqProducer)
-	router.GET("/:shortCode", redirectHandler.Redirect)
+	redirectHandler := handler.NewRedirectHandler(shortLinkSvc, analyticsSvc, producer)
+	redirectHandler.SetCodeFormat(codeEncoder, cfg.ShortCode.StaticPaths)
+	redirectHandler.SetVisitorIdentity(service.NewVisitorIdentity(&cfg.Analytics.Visitor))
+	if smsPoolSvc != nil {
+		redirectHandler.SetSMSDomain(smsPoolSvc.Host(), smsPoolSvc.CodeLength())
+	}
+	if conversionSvc != nil {
+		redirectHandler.SetConversionTracking(conversionSvc)
+	}
+	redirectHandler.SetCrawlerPolicy(cfg.Crawler.Policy, cfg.Crawler.UserAgents)
+	redirectHandler.SetRules(rules)
+	redirectHandler.SetReputation(reputation)
+	redirectHandler.SetCacheControl(cfg.Redirect.CacheControl)
+	// Links restricted to countries locate visitors by the CDN header or the GeoIP database
+	if cfg.GeoIP.Database != "" || cfg.GeoIP.Header != "" {
+		var geoDB *geoip.Database
+		if cfg.GeoIP.Database != "" {
+			if geoDB, err = geoip.Load(cfg.GeoIP.Database); err != nil {
+				log.Fatal().Err(err).Str("path", cfg.GeoIP.Database).Msg("Failed to load the GeoIP database")
+			}
+			log.Info().Int("ranges", geoDB.Len()).Msg("GeoIP database loaded")
+		}
+		redirectHandler.SetGeoIP(geoip.NewLocator(geoDB, cfg.GeoIP.Header))
+	}
+	if cfg.Analytics.PublicStats.Enabled {
+		redirectHandler.SetPublicStats(handler.NewPublicStatsHandler(service.NewPublicStatsPages(linkMySQL, &cfg.Analytics.PublicStats)))
+	}
+	// Requests forwarded by the CDN edge carry a signed token telling its cache hits from misses
+	if cfg.Edge.Enabled {
+		edgeVerifier := middleware.NewEdgeVerifier(cfg.Edge.Secrets(), cfg.Edge.MaxAge)
+		router.GET("/:shortCode", middleware.EdgeAuth(edgeVerifier, cfg.Edge.Header, cfg.Edge.Required), redirectHandler.Redirect)
+	} else {
+		router.GET("/:shortCode", redirectHandler.Redirect)
+	}
 
-	// Analytics routes
-	v1.GET("/analytics/:shortCode", redirectHandler.GetStats)
+	// Public API routes, served under every version with the same handlers responding in its format
+	apiVersions, err := newAPIVersions(&cfg.API)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up the API versions")
+	}
+	generateHandler := handler.NewGenerateHandler(shortLinkSvc)
+	shortLinkHandler := handler.NewShortLinkHandler(shortLinkSvc)
+	analyticsHandler := handler.NewAnalyticsHandler(analyticsSvc)
+	analyticsHandler.SetCodeFormat(codeEncoder)
+	// Analytics and changes of links are restricted to their owners in self-serve mode
+	ownerGuard := func(c *gin.Context) { c.Next() }
+	var claimHandler *handler.ClaimHandler
+	if claims != nil {
+		claimHandler = handler.NewClaimHandler(claims)
+		ownerGuard = claimHandler.Authorize
+		analyticsHandler.SetClaims(claims)
+	}
+	// Bursts of generate requests over the rate limit are rejected, or queued in the queue mode
+	generateLimit := func(c *gin.Context) { c.Next() }
+	var generateLimiter *middleware.RateLimiter
+	if cfg.RateLimit.Enabled {
+		generateLimiter = middleware.NewRateLimiter(cfg.RateLimit.Rate, cfg.RateLimit.Burst)
+		if cfg.RateLimit.Mode == config.RateLimitModeQueue {
+			generateLimiter.SetQueue(cfg.RateLimit.QueueSize, cfg.RateLimit.QueueTimeout)
+		}
+		generateLimit = generateLimiter.Middleware()
+	}
+	for _, version := range apiVersions.Versions() {
+		api := router.Group("/api/"+version.Name, apiVersions.Handler(version.Name), handler.ShortCodeParam(codeEncoder))
+
+		api.POST("/shortlink/generate", writeGuard, generateLimit, generateHandler.Generate)
+		api.GET("/shortlink/lookup", shortLinkHandler.Lookup)
+		api.GET("/shortlink/search", shortLinkHandler.Search)
+		api.POST("/shortlink/batchGet", shortLinkHandler.BatchGet)
+		api.GET("/shortlink/:shortCode/resolve", shortLinkHandler.Resolve)
+		api.PATCH("/shortlink/:shortCode", ownerGuard, writeGuard, shortLinkHandler.Update)
+		api.POST("/shortlink/:shortCode/sign", ownerGuard, writeGuard, shortLinkHandler.Sign)
+		api.PUT("/shortlink/declarative", writeGuard, shortLinkHandler.Reconcile)
+		api.POST("/shortlink/bulk/status", writeGuard, shortLinkHandler.BulkStatus)
+		api.POST("/shortlink/bulk/expire", writeGuard, shortLinkHandler.BulkExpire)
 
-	// Swagger documentation
+		if claimHandler != nil {
+			api.POST("/shortlink/:shortCode/claim", claimHandler.Start)
+			api.POST("/shortlink/:shortCode/claim/verify", writeGuard, claimHandler.Verify)
+		}
+
+		if reminders != nil {
+			reminderHandler := handler.NewReminderHandler(reminders)
+			api.POST("/shortlink/:shortCode/extend", ownerGuard, writeGuard, reminderHandler.Extend)
+			api.PUT("/reminders", reminderHandler.Subscribe)
+			api.GET("/reminders", reminderHandler.Get)
+			api.DELETE("/reminders", reminderHandler.Unsubscribe)
+		}
+
+		if reputation != nil {
+			api.POST("/shortlink/:shortCode/report", handler.NewReputationHandler(reputation).Report)
+		}
+
+		if smsPoolSvc != nil {
+			poolHandler := handler.NewPoolHandler(smsPoolSvc)
+			api.GET("/shortlink/pools/sms", poolHandler.GetSMSUsage)
+		}
+
+		if conversionSvc != nil {
+			conversionHandler := handler.NewConversionHandler(conversionSvc)
+			api.POST("/conversions", conversionHandler.Convert)
+		}
+
+		if logDrains != nil {
+			logDrainHandler := handler.NewLogDrainHandler(logDrains)
+			api.POST("/drains", writeGuard, logDrainHandler.Create)
+			api.GET("/drains", logDrainHandler.List)
+			api.DELETE("/drains/:id", writeGuard, logDrainHandler.Delete)
+		}
+
+		api.GET("/analytics/:shortCode", ownerGuard, redirectHandler.GetStats)
+		api.GET("/analytics/:shortCode/decay", ownerGuard, analyticsHandler.GetDecay)
+		api.GET("/analytics/:shortCode/compare", ownerGuard, analyticsHandler.Compare)
+		api.GET("/analytics/:shortCode/sources/daily", ownerGuard, analyticsHandler.GetSourcesDaily)
+		api.GET("/analytics/:shortCode/realtime", ownerGuard, analyticsHandler.GetRealtime)
+		api.POST("/analytics/aggregate", analyticsHandler.Aggregate)
+		api.GET("/analytics/:shortCode/logs", ownerGuard, analyticsHandler.GetLogs)
+	}
+
+	// Crawler rules
+	robotsHandler := handler.NewRobotsHandler(&cfg.Crawler.Robots)
+	router.GET("/robots.txt", robotsHandler.Robots)
+
+	// Static assets, registered explicitly so they never reach short code resolution
+	staticHandler := handler.NewStaticHandler(web.Static())
+	router.GET("/favicon.ico", staticHandler.Favicon)
+	router.GET("/static/*filepath", staticHandler.Static)
+
+	// OpenAPI spec and its Swagger UI
+	router.GET("/openapi.json", handler.NewOpenAPIHandler(openapi.Public).Spec)
 	setupSwagger(router)
 
+	// Build serving traffic
+	router.GET("/version", handler.NewVersionHandler(buildInfo()).Version)
+
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -114,35 +516,222 @@ func main() {
 		})
 	})
 
-	// Start MQ consumer if configured
-	var mqConsumer *mq.Consumer
-	if cfg.RocketMQ.NameServer != "" {
-		// Create consumer with handler that saves to MySQL
-		mqConsumer, err = mq.NewConsumer(&cfg.RocketMQ, func(ctx context.Context, msg *mq.AccessLogMessage) error {
-			accessLog := &model.AccessLog{
-				ShortCode:  msg.ShortCode,
-				ClientIP:   msg.ClientIP,
-				UserAgent:  msg.UserAgent,
-				Referer:    msg.Referer,
-				AccessTime: msg.AccessTime,
-			}
-			return mysqlRepo.SaveAccessLog(ctx, accessLog)
+	// Events failing repeatedly are parked in the dead-letter queue instead of being retried forever
+	var deadLetters *mq.DeadLetterQueue
+	if cfg.MQ.DeadLetter.Enabled {
+		deadLetters = mq.NewDeadLetterQueue(redisRepo.GetClient(), mqProducer, &cfg.MQ.DeadLetter)
+	}
+
+	// Access events stored in MySQL are also exported to object storage for long-term retention
+	var accessArchive *service.AccessArchiveService
+	if cfg.Analytics.Archive.Enabled {
+		accessArchive, err = newAccessArchive(&cfg.Analytics.Archive)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to set up the access archive")
+		}
+	}
+
+	// Start MQ consumer if configured, with handler that saves to MySQL
+	saveAccessLog := func(ctx context.Context, msg *mq.AccessLogMessage) error {
+		eventID := msg.DedupID()
+		accessLog := &model.AccessLog{
+			EventID:         &eventID,
+			ShortCode:       msg.ShortCode,
+			ClientIP:        msg.ClientIP,
+			UserAgent:       msg.UserAgent,
+			Referer:         msg.Referer,
+			Source:          rules.Source(msg.Referer),
+			Device:          rules.DeviceType(msg.UserAgent),
+			ClickID:         msg.ClickID,
+			Edge:            msg.Edge,
+			AccessTime:      msg.AccessTime,
+			VisitorID:       msg.VisitorID,
+			VisitorStrategy: msg.VisitorStrategy,
+		}
+		// Redelivered events are stored and counted once
+		recorded, err := database.RecordAccessLog(ctx, accessLog)
+		if err != nil {
+			return err
+		}
+		if !recorded {
+			log.Debug().Str("event_id", eventID).Msg("Skipping duplicate access log")
+			return nil
+		}
+		if accessArchive != nil {
+			accessArchive.Add(accessLog)
+		}
+		if warehouseSvc != nil {
+			warehouseSvc.AddAccessLog(accessLog)
+		}
+		if logDrains != nil {
+			logDrains.AddAccessLog(ctx, accessLog)
+		}
+		// Decay and access log responses change with every stored access
+		if err := linkRedis.TouchStats(ctx, msg.ShortCode); err != nil {
+			log.Warn().Err(err).Str("short_code", msg.ShortCode).Msg("Failed to touch stats")
+		}
+		return nil
+	}
+	if deadLetters != nil {
+		saveAccessLog = deadLetters.Guard(saveAccessLog)
+	}
+	mqConsumer, err := newMQConsumer(cfg, redisRepo.GetClient(), saveAccessLog)
+
+	if err != nil {
+		log.Warn().Err(err).Str("driver", cfg.MQ.Driver).Msg("Failed to initialize MQ consumer")
+	} else if mqConsumer != nil {
+		if deadLetters != nil {
+			mqConsumer.SetDeadLetterQueue(deadLetters)
+		}
+		async.Go(func() {
+			if err := mqConsumer.Subscribe(); err != nil {
+				log.Error().Err(err).Str("driver", cfg.MQ.Driver).Msg("Failed to subscribe to MQ")
+			}
 		})
+	}
 
+	// Apply the link events of the primary region on replicas
+	var linkConsumer mq.ConsumerInterface
+	var sourceRedis *redis.Client
+	if replicationSvc != nil {
+		// Replicas on Redis Streams read the link stream from the primary's Redis
+		streamClient := redis.Cmdable(redisRepo.GetClient())
+		if cfg.Replication.Source.Addr != "" {
+			sourceRedis = redis.NewClient(&redis.Options{
+				Addr:     cfg.Replication.Source.Addr,
+				Password: cfg.Replication.Source.Password,
+				DB:       cfg.Replication.Source.DB,
+			})
+			streamClient = sourceRedis
+		}
+
+		linkConsumer, err = newReplicationConsumer(cfg, streamClient, replicationSvc.Apply)
 		if err != nil {
-			log.Warn().Err(err).Msg("Failed to initialize RocketMQ consumer")
-		} else {
-			go func() {
-				if err := mqConsumer.Subscribe(); err != nil {
-					log.Error().Err(err).Msg("Failed to subscribe to RocketMQ")
-				}
-			}()
-			defer func() {
-				if err := mqConsumer.Close(); err != nil {
-					log.Error().Err(err).Msg("Failed to close RocketMQ consumer")
-				}
-			}()
+			log.Fatal().Err(err).Str("driver", cfg.MQ.Driver).Msg("Failed to initialize replication consumer")
 		}
+		async.Go(func() {
+			if err := linkConsumer.Subscribe(); err != nil {
+				log.Error().Err(err).Str("driver", cfg.MQ.Driver).Msg("Failed to subscribe to link events")
+			}
+		})
+		log.Info().Str("region", cfg.Replication.Region).Msg("Replicating links from the primary region")
+	}
+
+	// Background workers stop together during shutdown
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+
+	// Start SMS code recycler, on replicas codes expire through the primary's link events
+	if smsPoolSvc != nil && replicationSvc == nil {
+		workers.Add(1)
+		async.Go(func() {
+			defer workers.Done()
+			smsPoolSvc.Run(workerCtx, cfg.SMS.RecycleInterval)
+		})
+	}
+
+	// Start expired code recycler
+	if recyclerSvc != nil && replicationSvc == nil {
+		workers.Add(1)
+		async.Go(func() {
+			defer workers.Done()
+			recyclerSvc.Run(workerCtx, cfg.Recycle.Interval)
+		})
+	}
+
+	// Pick up feature flags set at runtime by any instance
+	workers.Add(1)
+	async.Go(func() {
+		defer workers.Done()
+		flags.Run(workerCtx, cfg.Flags.RefreshInterval)
+	})
+
+	// Pick up rules changed by any instance as soon as they are announced
+	workers.Add(1)
+	async.Go(func() {
+		defer workers.Done()
+		rules.Run(workerCtx, cfg.Rules.RefreshInterval)
+	})
+
+	// Reload domain verdicts and check the domains due, one instance checking each batch
+	if reputation != nil {
+		workers.Add(1)
+		async.Go(func() {
+			defer workers.Done()
+			reputation.Run(workerCtx)
+		})
+	}
+
+	// Pick up the maintenance mode turned on or off by any instance
+	workers.Add(1)
+	async.Go(func() {
+		defer workers.Done()
+		maintenance.Run(workerCtx, cfg.Maintenance.RefreshInterval)
+	})
+
+	// Deliver the weekly campaign reports, one instance claiming each week
+	var reportSvc *service.ReportService
+	if cfg.Reports.Enabled {
+		reportSvc = service.NewReportService(linkMySQL, redisRepo.GetClient(), &cfg.Reports, newMailer(&cfg.Mail))
+		workers.Add(1)
+		async.Go(func() {
+			defer workers.Done()
+			reportSvc.Run(workerCtx, cfg.Reports.CheckInterval)
+		})
+	}
+
+	// Remind owners of links about to expire, one instance checking at a time
+	if reminders != nil {
+		workers.Add(1)
+		async.Go(func() {
+			defer workers.Done()
+			reminders.Run(workerCtx)
+		})
+	}
+
+	// Check the health of the Redis shards, bringing down ones back once they answer
+	if redisShards != nil {
+		workers.Add(1)
+		async.Go(func() {
+			defer workers.Done()
+			redisShards.Run(workerCtx, cfg.Database.RedisShards.CheckInterval)
+		})
+	}
+
+	// Deliver the purges of cached redirects to the CDN
+	if edgePurgeSvc != nil {
+		workers.Add(1)
+		async.Go(func() {
+			defer workers.Done()
+			edgePurgeSvc.Run(workerCtx)
+		})
+	}
+
+	// Write the buffered access events to object storage
+	if accessArchive != nil {
+		workers.Add(1)
+		async.Go(func() {
+			defer workers.Done()
+			accessArchive.Run(workerCtx)
+		})
+	}
+
+	// Insert the buffered events into the warehouses
+	if warehouseSvc != nil {
+		workers.Add(1)
+		async.Go(func() {
+			defer workers.Done()
+			warehouseSvc.Run(workerCtx)
+		})
+	}
+
+	// Reload the log drains and post the buffered events to them
+	if logDrains != nil {
+		workers.Add(1)
+		async.Go(func() {
+			defer workers.Done()
+			logDrains.Run(workerCtx)
+		})
 	}
 
 	// Start server
@@ -159,6 +748,21 @@ func main() {
 		}
 	}()
 
+	// Start admin server (metrics and profiling)
+	var adminSrv *http.Server
+	if cfg.Admin.Enabled {
+		adminSrv = &http.Server{
+			Addr:    fmt.Sprintf(":%d", cfg.Admin.Port),
+			Handler: setupAdminRouter(&cfg.Admin, requestCounter, producerBuffer, deadLetters, mqConsumer, replicationSvc, redisShards, shadowStats(shadowMySQL, shadowRedis), flags, rules, reputation, maintenance, reportSvc, edgePurgeSvc, accessArchive, warehouseSvc, logDrains, slowStats(slowMySQL, slowRedis, slowHTTP), rateLimitStats(generateLimiter, cfg.RateLimit.Mode)),
+		}
+		go func() {
+			log.Info().Msgf("Starting admin server on port %d", cfg.Admin.Port)
+			if err := adminSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Msg("Failed to start admin server")
+			}
+		}()
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -166,41 +770,660 @@ func main() {
 
 	log.Info().Msg("Shutting down server...")
 
-	// Close producer
-	if mqProducer != nil {
-		if err := mqProducer.Close(); err != nil {
-			log.Error().Err(err).Msg("Failed to close RocketMQ producer")
+	// Every stage only starts once the ones producing its input are done
+	shutdowns := shutdown.New()
+	timeouts := cfg.Server.Shutdown
+
+	shutdowns.Add("http", timeouts.HTTP, func(ctx context.Context) error {
+		if adminSrv != nil {
+			if err := adminSrv.Shutdown(ctx); err != nil {
+				log.Error().Err(err).Msg("Failed to shut down admin server")
+			}
+		}
+		return srv.Shutdown(ctx)
+	})
+
+	shutdowns.Add("workers", timeouts.Workers, func(ctx context.Context) error {
+		stopWorkers()
+		var errs []error
+		if err := redirectHandler.Drain(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("redirect background work: %w", err))
 		}
+		if mqConsumer != nil {
+			if err := mqConsumer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("MQ consumer: %w", err))
+			}
+		}
+		if linkConsumer != nil {
+			if err := linkConsumer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("replication consumer: %w", err))
+			}
+		}
+		workers.Wait()
+		return errors.Join(errs...)
+	})
+
+	// Flush buffered analytics counters and events once no more clicks come in
+	if counterBuffer != nil || accessArchive != nil || warehouseSvc != nil || logDrains != nil {
+		shutdowns.Add("analytics", timeouts.Analytics, func(ctx context.Context) error {
+			if counterBuffer != nil {
+				counterBuffer.Close()
+			}
+			var errs []error
+			if accessArchive != nil {
+				errs = append(errs, accessArchive.Close(ctx))
+			}
+			if warehouseSvc != nil {
+				errs = append(errs, warehouseSvc.Close(ctx))
+			}
+			if logDrains != nil {
+				errs = append(errs, logDrains.Close(ctx))
+			}
+			return errors.Join(errs...)
+		})
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// Close producer, flushing its buffer, once no more access logs are sent
+	if producer != nil {
+		shutdowns.Add("mq", timeouts.MQ, func(ctx context.Context) error {
+			return producer.Close()
+		})
+	}
+
+	shutdowns.Add("storage", timeouts.Storage, func(ctx context.Context) error {
+		if sourceRedis != nil {
+			if err := sourceRedis.Close(); err != nil {
+				log.Error().Err(err).Msg("Failed to close primary Redis connection")
+			}
+		}
+		if shadowRedis != nil {
+			// Closes the Redis shards too when they are the target
+			if err := shadowRedis.Close(); err != nil {
+				log.Error().Err(err).Msg("Failed to close shadow Redis connections")
+			}
+		} else if redisShards != nil {
+			if err := redisShards.Close(); err != nil {
+				log.Error().Err(err).Msg("Failed to close Redis shard connections")
+			}
+		}
+		if shadowMySQL != nil {
+			if err := shadowMySQL.Close(); err != nil {
+				log.Error().Err(err).Msg("Failed to close shadow MySQL connection")
+			}
+		}
+		return errors.Join(database.Close(), redisRepo.Close())
+	})
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal().Err(err).Msg("Server forced to shutdown")
+	if err := shutdowns.Shutdown(); err != nil {
+		log.Error().Err(err).Msg("Server shut down with errors")
+		return
 	}
 
 	log.Info().Msg("Server exited")
 }
 
-// setupLogger configures the logger
-func setupLogger(mode string) {
+// setupAdminRouter builds the router of the admin server, with dead-letter endpoints when a queue is given
+// and consumer endpoints when access logs are consumed
+func setupAdminRouter(cfg *config.AdminConfig, requests *middleware.RequestCounter, producerBuffer *mq.BufferedProducer,
+	deadLetters *mq.DeadLetterQueue, consumer mq.ConsumerInterface, replication *service.ReplicationService, redisShards *repository.ShardedRedisRepository,
+	shadow func() []model.ShadowStats, flags *service.FeatureFlags, rules *service.Rules, reputation *service.Reputation, maintenance *service.MaintenanceMode,
+	reports *service.ReportService, edgePurge *service.EdgePurgeService, archive *service.AccessArchiveService,
+	warehouseSvc *service.WarehouseService, logDrains *service.LogDrainService, slow func() []model.SlowStats,
+	rateLimit func() *model.RateLimitStats) *gin.Engine {
+	router := gin.New()
+	router.Use(middleware.Recovery())
+
+	adminHandler := handler.NewAdminHandler(requests)
+	adminHandler.SetBuildInfo(buildInfo())
+	router.GET("/metrics", adminHandler.Metrics)
+	router.GET("/openapi.json", handler.NewOpenAPIHandler(openapi.Admin).Spec)
+
+	flagHandler := handler.NewFeatureFlagHandler(flags)
+	router.GET("/flags", flagHandler.List)
+	router.PUT("/flags/:name", flagHandler.Set)
+	router.DELETE("/flags/:name", flagHandler.Delete)
+
+	ruleHandler := handler.NewRuleHandler(rules)
+	router.GET("/rules", ruleHandler.List)
+	router.POST("/rules", ruleHandler.Create)
+	router.PUT("/rules/:id", ruleHandler.Update)
+	router.DELETE("/rules/:id", ruleHandler.Delete)
+
+	if reputation != nil {
+		reputationHandler := handler.NewReputationHandler(reputation)
+		router.GET("/reputation", reputationHandler.List)
+		router.GET("/reputation/:domain", reputationHandler.Get)
+		router.PUT("/reputation/:domain/override", reputationHandler.Override)
+		router.DELETE("/reputation/:domain/override", reputationHandler.ClearOverride)
+	}
+
+	maintenanceHandler := handler.NewMaintenanceHandler(maintenance)
+	router.GET("/maintenance", maintenanceHandler.Get)
+	router.PUT("/maintenance", maintenanceHandler.Enable)
+	router.DELETE("/maintenance", maintenanceHandler.Disable)
+
+	if reports != nil {
+		router.GET("/reports/weekly", handler.NewReportHandler(reports).Weekly)
+	}
+
+	if producerBuffer != nil {
+		adminHandler.SetProducerBuffer(producerBuffer.Stats)
+	}
+
+	if replication != nil {
+		adminHandler.SetReplication(replication.Stats)
+	}
+
+	if redisShards != nil {
+		adminHandler.SetRedisShards(redisShards.Stats)
+	}
+
+	if shadow != nil {
+		adminHandler.SetShadow(shadow)
+	}
+
+	if edgePurge != nil {
+		adminHandler.SetEdgePurge(edgePurge.Stats)
+	}
+
+	if archive != nil {
+		adminHandler.SetAccessArchive(archive.Stats)
+	}
+
+	if warehouseSvc != nil {
+		adminHandler.SetWarehouse(warehouseSvc.Stats)
+	}
+
+	if logDrains != nil {
+		adminHandler.SetLogDrains(logDrains.Stats)
+	}
+
+	if slow != nil {
+		adminHandler.SetSlow(slow)
+	}
+
+	if rateLimit != nil {
+		adminHandler.SetRateLimit(rateLimit)
+	}
+
+	if deadLetters != nil {
+		adminHandler.SetDeadLetterDepth(deadLetters.Depth)
+		deadLetterHandler := handler.NewDeadLetterHandler(deadLetters)
+		router.GET("/dlq", deadLetterHandler.List)
+		router.POST("/dlq/replay", deadLetterHandler.Replay)
+		router.DELETE("/dlq/:id", deadLetterHandler.Delete)
+	}
+
+	if consumer != nil {
+		consumerHandler := handler.NewConsumerHandler(consumer)
+		router.GET("/consumer", consumerHandler.Status)
+		router.POST("/consumer/restart", consumerHandler.Restart)
+	}
+
+	if cfg.Pprof {
+		pprofGroup := router.Group("/debug/pprof")
+		pprofGroup.GET("/", gin.WrapF(pprof.Index))
+		pprofGroup.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+		pprofGroup.GET("/profile", gin.WrapF(pprof.Profile))
+		pprofGroup.GET("/symbol", gin.WrapF(pprof.Symbol))
+		pprofGroup.POST("/symbol", gin.WrapF(pprof.Symbol))
+		pprofGroup.GET("/trace", gin.WrapF(pprof.Trace))
+		// Named profiles such as heap, goroutine and allocs
+		pprofGroup.GET("/:profile", gin.WrapF(pprof.Index))
+	}
+
+	return router
+}
+
+// newMQProducer creates the access log producer of the configured driver and encoding, nil when MQ is
+// not configured
+func newMQProducer(cfg *config.Config, redisClient redis.Cmdable) (mq.ProducerInterface, error) {
+	codec, err := mq.NewCodec(cfg.MQ.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.MQ.Driver {
+	case mq.DriverRedisStream:
+		p := mq.NewRedisStreamProducer(redisClient, &cfg.MQ.RedisStream)
+		p.SetCodec(codec)
+		return p, nil
+	case mq.DriverNATS:
+		if cfg.MQ.NATS.URL == "" {
+			return nil, nil
+		}
+		p, err := mq.NewNATSProducer(&cfg.MQ.NATS)
+		if err != nil {
+			return nil, err
+		}
+		p.SetCodec(codec)
+		return p, nil
+	case mq.DriverSQS:
+		if cfg.MQ.SQS.QueueURL == "" {
+			return nil, nil
+		}
+		p, err := mq.NewSQSProducer(&cfg.MQ.SQS)
+		if err != nil {
+			return nil, err
+		}
+		p.SetCodec(codec)
+		return p, nil
+	case mq.DriverRocketMQ, "":
+		if cfg.RocketMQ.NameServer == "" {
+			return nil, nil
+		}
+		p, err := mq.NewProducer(&cfg.RocketMQ)
+		if err != nil {
+			return nil, err
+		}
+		p.SetCodec(codec)
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown MQ driver %q", cfg.MQ.Driver)
+}
+
+// newMQConsumer creates the access log consumer of the configured driver, nil when MQ is not configured
+func newMQConsumer(cfg *config.Config, redisClient redis.Cmdable, handler mq.AccessLogHandler) (mq.ConsumerInterface, error) {
+	switch cfg.MQ.Driver {
+	case mq.DriverRedisStream:
+		return mq.NewRedisStreamConsumer(redisClient, &cfg.MQ.RedisStream, handler), nil
+	case mq.DriverNATS:
+		if cfg.MQ.NATS.URL == "" {
+			return nil, nil
+		}
+		c, err := mq.NewNATSConsumer(&cfg.MQ.NATS, handler)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	case mq.DriverSQS:
+		if cfg.MQ.SQS.QueueURL == "" {
+			return nil, nil
+		}
+		c, err := mq.NewSQSConsumer(&cfg.MQ.SQS, handler)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	case mq.DriverRocketMQ, "":
+		if cfg.RocketMQ.NameServer == "" {
+			return nil, nil
+		}
+		c, err := mq.NewConsumer(&cfg.RocketMQ, handler)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("unknown MQ driver %q", cfg.MQ.Driver)
+}
+
+// newReplicationConsumer creates the consumer of the primary region's link events, in a group of
+// the replica's region so that every region receives all of them
+func newReplicationConsumer(cfg *config.Config, redisClient redis.Cmdable, handler mq.LinkEventHandler) (mq.ConsumerInterface, error) {
+	group := "octopus_replica_" + cfg.Replication.Region
+
+	switch cfg.MQ.Driver {
+	case mq.DriverRedisStream:
+		return mq.NewRedisStreamLinkConsumer(redisClient, &cfg.MQ.RedisStream, group, handler), nil
+	case mq.DriverNATS:
+		if cfg.MQ.NATS.URL == "" {
+			return nil, errors.New("mq.nats.url is not set")
+		}
+		c, err := mq.NewNATSLinkConsumer(&cfg.MQ.NATS, group, handler)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("MQ driver %q cannot replicate links, use nats or redis-stream", cfg.MQ.Driver)
+}
+
+// newFaultInjector creates the fault injector of a dependency from its chaos configuration, warning
+// about it only when it injects any fault
+func newFaultInjector(target string, cfg *config.FaultConfig) *chaos.Injector {
+	injector := chaos.NewInjector(target, cfg.ErrorRate, cfg.LatencyRate, cfg.Latency)
+	if injector.Active() {
+		log.Warn().
+			Str("target", target).
+			Float64("error_rate", cfg.ErrorRate).
+			Float64("latency_rate", cfg.LatencyRate).
+			Dur("latency", cfg.Latency).
+			Msg("Fault injection configured")
+	}
+	return injector
+}
+
+// newMailer creates the mailer sending emails through the configured SMTP server
+func newMailer(cfg *config.MailConfig) *mailer.Mailer {
+	if cfg.DryRunDir != "" {
+		log.Warn().Str("dir", cfg.DryRunDir).Msg("Mail dry run enabled, writing emails to disk instead of sending them")
+	}
+	return mailer.New(mailer.Config{
+		Addr:      cfg.Addr,
+		Username:  cfg.Username,
+		Password:  cfg.Password,
+		From:      cfg.From,
+		DryRunDir: cfg.DryRunDir,
+		Attempts:  cfg.Attempts,
+		Backoff:   cfg.Backoff,
+	})
+}
+
+// newEdgePurger creates the adapter of the CDN API cached redirects are purged through, nil when
+// no provider is configured
+func newEdgePurger(cfg *config.EdgePurgeConfig) cdn.Purger {
+	switch cfg.Provider {
+	case config.PurgeProviderCloudflare:
+		return cdn.NewCloudflare(cfg.Cloudflare.ZoneID, cfg.Cloudflare.APIToken, cfg.Timeout)
+	case config.PurgeProviderFastly:
+		return cdn.NewFastly(cfg.Fastly.APIKey, cfg.Timeout)
+	}
+	return nil
+}
+
+// newAccessArchive creates the export of access events to the configured bucket, authenticating
+// with the credentials of the AWS environment
+func newAccessArchive(cfg *config.ArchiveConfig) (*service.AccessArchiveService, error) {
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(cfg.Region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	store := objstore.NewS3(cfg.Bucket, cfg.Region, cfg.Endpoint, awsCfg.Credentials, cfg.Timeout)
+	return service.NewAccessArchiveService(store, cfg), nil
+}
+
+// newWarehouseService creates the connector streaming events to the configured warehouses, nil
+// without destinations
+func newWarehouseService(cfg *config.WarehouseConfig) (*service.WarehouseService, error) {
+	if len(cfg.Destinations) == 0 {
+		return nil, nil
+	}
+
+	warehouseSvc := service.NewWarehouseService()
+	for i := range cfg.Destinations {
+		dest := &cfg.Destinations[i]
+		writer, err := newWarehouseWriter(dest)
+		if err != nil {
+			return nil, fmt.Errorf("warehouse %s: %w", dest.Name, err)
+		}
+		warehouseSvc.AddDestination(dest, writer)
+		log.Info().Str("warehouse", dest.Name).Str("type", dest.Type).Msg("Streaming events to warehouse")
+	}
+	return warehouseSvc, nil
+}
+
+// newWarehouseWriter creates the writer of a warehouse destination. BigQuery authenticates with the
+// configured service account key, or the service account of the GCE or GKE instance without one.
+func newWarehouseWriter(cfg *config.WarehouseDestinationConfig) (warehouse.Writer, error) {
+	if cfg.Type == config.WarehouseTypeSQL {
+		// The MySQL driver is registered by the repositories
+		db, err := sql.Open("mysql", cfg.SQL.DSN)
+		if err != nil {
+			return nil, err
+		}
+		return warehouse.NewSQL(db), nil
+	}
+
+	var tokens warehouse.TokenSource = warehouse.NewMetadataTokens(cfg.Timeout)
+	if cfg.BigQuery.CredentialsFile != "" {
+		keyFile, err := os.ReadFile(cfg.BigQuery.CredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		if tokens, err = warehouse.NewServiceAccountTokens(keyFile, cfg.Timeout); err != nil {
+			return nil, err
+		}
+	}
+	return warehouse.NewBigQuery(cfg.BigQuery.Project, cfg.BigQuery.Dataset, tokens, cfg.Timeout), nil
+}
+
+// setupLogger configures the logger from the log section, tagging every line with the build in
+// release mode so the logs of different builds can be told apart during a rollout
+func setupLogger(cfg *config.LogConfig, mode string, build buildinfo.Info) {
+	level := zerolog.DebugLevel
 	if mode == "release" {
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	} else {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		level = zerolog.InfoLevel
+	}
+	if cfg.Level != "" {
+		level, _ = zerolog.ParseLevel(cfg.Level)
+	}
+
+	var out io.Writer = os.Stdout
+	if cfg.File.Path != "" {
+		out = &lumberjack.Logger{
+			Filename:   cfg.File.Path,
+			MaxSize:    cfg.File.MaxSize,
+			MaxBackups: cfg.File.MaxBackups,
+			MaxAge:     cfg.File.MaxAge,
+			Compress:   cfg.File.Compress,
+		}
+	}
+	if cfg.Format != config.LogFormatJSON {
+		// Use console writer for pretty output, without colors in files
+		out = zerolog.ConsoleWriter{Out: out, NoColor: cfg.File.Path != ""}
+	}
+	logger := zerolog.New(out).With().Timestamp().Logger()
+
+	// Module levels and sampling filter events in a hook, the logger letting through the lowest level
+	if len(cfg.Modules) > 0 || cfg.Sampling.Enabled {
+		filter := logging.NewFilter(level)
+		for module, moduleLevel := range cfg.Modules {
+			l, _ := zerolog.ParseLevel(moduleLevel)
+			filter.SetModuleLevel(module, l)
+		}
+		if cfg.Sampling.Enabled {
+			for _, message := range cfg.Sampling.Messages {
+				filter.Sample(message, &zerolog.BurstSampler{
+					Burst:       cfg.Sampling.Burst,
+					Period:      cfg.Sampling.Period,
+					NextSampler: &zerolog.BasicSampler{N: cfg.Sampling.Thereafter},
+				})
+			}
+		}
+		level = filter.MinLevel()
+		logger = logger.Hook(filter)
+	}
+	zerolog.SetGlobalLevel(level)
+
+	if mode == "release" {
+		logger = logger.With().Str("version", build.Version).Str("commit", build.ShortCommit()).Logger()
+	}
+	log.Logger = logger
+}
+
+// buildInfo returns the build of the running binary
+func buildInfo() *model.BuildInfo {
+	info := buildinfo.Get()
+	return &model.BuildInfo{
+		Version:   info.Version,
+		Commit:    info.Commit,
+		BuildTime: info.Time,
+		GoVersion: info.GoVersion,
+		Modified:  info.Modified,
+	}
+}
+
+// setupShadowing wraps the repositories serving links in ones mirroring them to the storage a
+// migration moves them to, rolled out by the shadow feature flags. Either is nil when its storage
+// is not migrated.
+func setupShadowing(db *config.DatabaseConfig, flags *service.FeatureFlags, mysqlRepo *repository.MySQLRepository,
+	redisRepo *repository.RedisRepository, redisShards *repository.ShardedRedisRepository) (*repository.ShadowMySQLRepository, *repository.ShadowRedisRepository) {
+	writes := shadowGate(flags, service.FlagShadowWrites)
+	reads := shadowGate(flags, service.FlagShadowReads)
+
+	var shadowMySQL *repository.ShadowMySQLRepository
+	if db.Shadow.MySQL.DSN != "" {
+		target, err := repository.NewMySQLRepository(&db.Shadow.MySQL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to connect to the shadow MySQL")
+		}
+		shadowMySQL = repository.NewShadowMySQLRepository(mysqlRepo, target, db.Shadow.Timeout)
+		shadowMySQL.SetGates(writes, reads)
+		log.Info().Msg("Shadowing MySQL links to database.shadow.mysql")
+	}
+
+	var shadowRedis *repository.ShadowRedisRepository
+	switch {
+	case db.Shadow.RedisShards:
+		shadowRedis = repository.NewShadowRedisRepository(redisRepo, redisShards, "database.redis_shards", db.Shadow.Timeout)
+	case db.Shadow.Redis.Addr != "":
+		target, err := repository.NewRedisRepository(&db.Shadow.Redis)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to connect to the shadow Redis")
+		}
+		shadowRedis = repository.NewShadowRedisRepository(redisRepo, target, "database.shadow.redis", db.Shadow.Timeout)
+	}
+	if shadowRedis != nil {
+		shadowRedis.SetGates(writes, reads)
+		log.Info().Str("target", shadowRedis.Stats().Target).Msg("Shadowing cached Redis links")
+	}
+
+	return shadowMySQL, shadowRedis
+}
+
+// shadowGate rolls shadowing out to the short links a feature flag is on for
+func shadowGate(flags *service.FeatureFlags, flag string) repository.ShadowGate {
+	return func(ctx context.Context, shortCode string) bool {
+		return flags.Enabled(ctx, flag, shortCode)
+	}
+}
+
+// shadowStats reports the shadowed storages in the admin metrics, nil when none is
+func shadowStats(shadowMySQL *repository.ShadowMySQLRepository, shadowRedis *repository.ShadowRedisRepository) func() []model.ShadowStats {
+	if shadowMySQL == nil && shadowRedis == nil {
+		return nil
+	}
+	return func() []model.ShadowStats {
+		var stats []model.ShadowStats
+		if shadowMySQL != nil {
+			stats = append(stats, shadowMySQL.Stats())
+		}
+		if shadowRedis != nil {
+			stats = append(stats, shadowRedis.Stats())
+		}
+		return stats
 	}
+}
 
-	// Use console writer for pretty output
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout})
+// slowStats reports the slow calls found by the active detectors, nil when none is
+func slowStats(detectors ...*slowlog.Detector) func() []model.SlowStats {
+	var active []*slowlog.Detector
+	for _, detector := range detectors {
+		if detector.Active() {
+			active = append(active, detector)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+	return func() []model.SlowStats {
+		stats := make([]model.SlowStats, len(active))
+		for i, detector := range active {
+			stats[i] = model.SlowStats{
+				Target:           detector.Target(),
+				ThresholdSeconds: detector.Threshold().Seconds(),
+				Slow:             detector.Slow(),
+				LastOperation:    detector.LastOperation(),
+			}
+		}
+		return stats
+	}
 }
 
-// getDomain returns the domain for short links
-func getDomain(cfg *config.Config) string {
-	if port := cfg.Server.Port; port != 80 && port != 443 {
-		return fmt.Sprintf("http://localhost:%d", port)
+// rateLimitStats reports the generate requests queued and rejected by the rate limit, nil without
+// one
+func rateLimitStats(limiter *middleware.RateLimiter, mode string) func() *model.RateLimitStats {
+	if limiter == nil {
+		return nil
+	}
+	return func() *model.RateLimitStats {
+		stats := limiter.Stats()
+		return &model.RateLimitStats{
+			Mode:             mode,
+			QueueSize:        stats.QueueSize,
+			QueueDepth:       stats.QueueDepth,
+			Allowed:          stats.Allowed,
+			Queued:           stats.Queued,
+			Rejected:         stats.Rejected,
+			Abandoned:        stats.Abandoned,
+			WaitSecondsTotal: stats.WaitTotal.Seconds(),
+			WaitSecondsMax:   stats.WaitMax.Seconds(),
+		}
 	}
-	return "http://localhost"
+}
+
+// ownedDatabase is the Database of the server, closed once it shut down
+type ownedDatabase interface {
+	storage.Database
+	Close() error
+}
+
+// newAPIVersions returns the versions of the public API with their configured deprecations
+func newAPIVersions(cfg *config.APIConfig) (*apiversion.Registry, error) {
+	versions := handler.APIVersions()
+	for name, d := range cfg.Deprecations {
+		version, ok := versions.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("invalid api.deprecations.%s: no such API version", name)
+		}
+		version.Deprecated = d.DeprecatedAt()
+		version.Sunset = d.SunsetAt()
+		version.Link = d.Link
+	}
+	return versions, nil
+}
+
+// useInMemoryStorage turns off the settings needing storage other than the in-memory repositories,
+// and sends access events through Redis Streams on the in-memory Redis
+func useInMemoryStorage(cfg *config.Config) {
+	cfg.Database.RedisShards.Shards = nil
+	cfg.Database.Shadow = config.ShadowConfig{}
+	cfg.Log.Slow.MySQL = 0
+	cfg.MQ.Driver = mq.DriverRedisStream
+}
+
+// openMemoryRepositories creates the in-memory repositories of a demo instance, needing neither
+// MySQL nor Redis
+func openMemoryRepositories() (*repository.RedisRepository, *repository.MemoryRepository) {
+	redisRepo, err := repository.NewMemoryRedisRepository()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to start in-memory Redis")
+	}
+	log.Warn().Msg("Running in memory, all data is lost on exit")
+	return redisRepo, repository.NewMemoryRepository()
+}
+
+// connectRepositories connects to Redis and MySQL, retrying both until the startup timeout
+// passes and exiting when either stays unavailable
+func connectRepositories(cfg *config.StartupConfig, db *config.DatabaseConfig) (*repository.RedisRepository, *repository.MySQLRepository) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	var redisRepo *repository.RedisRepository
+	err := retry.Do(ctx, cfg.InitialBackoff, cfg.MaxBackoff, func() (err error) {
+		if redisRepo, err = repository.NewRedisRepository(&db.Redis); err != nil {
+			log.Warn().Err(err).Msg("Redis unavailable, retrying")
+		}
+		return err
+	})
+	if err != nil {
+		log.Fatal().Err(err).Dur("timeout", cfg.Timeout).Msg("Failed to connect to Redis")
+	}
+
+	var mysqlRepo *repository.MySQLRepository
+	err = retry.Do(ctx, cfg.InitialBackoff, cfg.MaxBackoff, func() (err error) {
+		if mysqlRepo, err = repository.NewMySQLRepository(&db.MySQL); err != nil {
+			log.Warn().Err(err).Msg("MySQL unavailable, retrying")
+		}
+		return err
+	})
+	if err != nil {
+		redisRepo.Close()
+		log.Fatal().Err(err).Dur("timeout", cfg.Timeout).Msg("Failed to connect to MySQL")
+	}
+
+	return redisRepo, mysqlRepo
 }
 
 // corsMiddleware adds CORS headers
@@ -208,8 +1431,8 @@ func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-API-Key")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -220,7 +1443,7 @@ func corsMiddleware() gin.HandlerFunc {
 	}
 }
 
-// setupSwagger sets up Swagger UI
+// setupSwagger sets up Swagger UI on the spec served at /openapi.json
 func setupSwagger(router *gin.Engine) {
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL("/openapi.json")))
 }
@@ -1,65 +1,947 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 
+	"octopus/pkg/util"
+
+	"github.com/rs/zerolog"
 	"github.com/spf13/viper"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Bloom    BloomConfig    `mapstructure:"bloom"`
-	RocketMQ RocketMQConfig `mapstructure:"rocketmq"`
+	Server      ServerConfig      `mapstructure:"server"`
+	API         APIConfig         `mapstructure:"api"`
+	Log         LogConfig         `mapstructure:"log"`
+	Database    DatabaseConfig    `mapstructure:"database"`
+	Bloom       BloomConfig       `mapstructure:"bloom"`
+	ShortCode   ShortCodeConfig   `mapstructure:"shortcode"`
+	MQ          MQConfig          `mapstructure:"mq"`
+	RocketMQ    RocketMQConfig    `mapstructure:"rocketmq"`
+	SMS         SMSConfig         `mapstructure:"sms"`
+	Recycle     RecycleConfig     `mapstructure:"recycle"`
+	Conversion  ConversionConfig  `mapstructure:"conversion"`
+	Analytics   AnalyticsConfig   `mapstructure:"analytics"`
+	Crawler     CrawlerConfig     `mapstructure:"crawler"`
+	Redirect    RedirectConfig    `mapstructure:"redirect"`
+	GeoIP       GeoIPConfig       `mapstructure:"geoip"`
+	Edge        EdgeConfig        `mapstructure:"edge"`
+	Signing     SigningConfig     `mapstructure:"signing"`
+	Admin       AdminConfig       `mapstructure:"admin"`
+	Chaos       ChaosConfig       `mapstructure:"chaos"`
+	Replication ReplicationConfig `mapstructure:"replication"`
+	Flags       FlagsConfig       `mapstructure:"flags"`
+	Maintenance MaintenanceConfig `mapstructure:"maintenance"`
+	RateLimit   RateLimitConfig   `mapstructure:"rate_limit"`
+	Rules       RulesConfig       `mapstructure:"rules"`
+	Claims      ClaimsConfig      `mapstructure:"claims"`
+	Reputation  ReputationConfig  `mapstructure:"reputation"`
+	Reports     ReportsConfig     `mapstructure:"reports"`
+	Reminders   RemindersConfig   `mapstructure:"reminders"`
+	Mail        MailConfig        `mapstructure:"mail"`
+	Warehouse   WarehouseConfig   `mapstructure:"warehouse"`
 }
 
 // ServerConfig represents server configuration
 type ServerConfig struct {
-	Port int    `mapstructure:"port"`
-	Mode string `mapstructure:"mode"`
+	Port     int            `mapstructure:"port"`
+	Mode     string         `mapstructure:"mode"`
+	BaseURL  string         `mapstructure:"base_url"`
+	Startup  StartupConfig  `mapstructure:"startup"`
+	Shutdown ShutdownConfig `mapstructure:"shutdown"`
+	// TrustedProxies are the IPs and CIDRs whose X-Forwarded-For and X-Real-IP headers give the
+	// client IP. Without any, the client IP is the remote address of the connection.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+}
+
+// APIConfig represents the deprecation schedule of the public API versions, keyed by their name
+// such as v1. The versions and their response formats are defined by the handlers.
+type APIConfig struct {
+	Deprecations map[string]DeprecationConfig `mapstructure:"deprecations"`
+}
+
+// DeprecationConfig schedules the deprecation of an API version. Deprecated and Sunset are dates
+// (2006-01-02) or RFC 3339 times; Link is the URL of the migration guide.
+type DeprecationConfig struct {
+	Deprecated string `mapstructure:"deprecated"`
+	Sunset     string `mapstructure:"sunset"`
+	Link       string `mapstructure:"link"`
+}
+
+// DeprecatedAt returns when the version is deprecated, zero when it is not
+func (c *DeprecationConfig) DeprecatedAt() time.Time {
+	t, _ := parseDeprecationTime(c.Deprecated)
+	return t
+}
+
+// SunsetAt returns when the version stops being served, zero when no date is set
+func (c *DeprecationConfig) SunsetAt() time.Time {
+	t, _ := parseDeprecationTime(c.Sunset)
+	return t
+}
+
+// parseDeprecationTime parses a date, as midnight UTC, or an RFC 3339 time, zero when empty
+func parseDeprecationTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// LogConfig represents the logging configuration. Level is the level of modules without their own
+// in Modules, debug in debug mode and info in release mode when empty. Modules are the last element
+// of the package path logging, such as repository or handler.
+type LogConfig struct {
+	Level    string            `mapstructure:"level"`
+	Format   string            `mapstructure:"format"`
+	File     LogFileConfig     `mapstructure:"file"`
+	Sampling LogSamplingConfig `mapstructure:"sampling"`
+	Modules  map[string]string `mapstructure:"modules"`
+	Slow     SlowLogConfig     `mapstructure:"slow"`
+}
+
+// Log formats
+const (
+	LogFormatConsole = "console"
+	LogFormatJSON    = "json"
+)
+
+// LogFileConfig represents a log file rotated once it reaches MaxSize megabytes, logs going to
+// stdout when Path is empty. Rotated files are removed beyond MaxBackups of them or MaxAge days.
+type LogFileConfig struct {
+	Path       string `mapstructure:"path"`
+	MaxSize    int    `mapstructure:"max_size"`
+	MaxBackups int    `mapstructure:"max_backups"`
+	MaxAge     int    `mapstructure:"max_age"`
+	Compress   bool   `mapstructure:"compress"`
+}
+
+// LogSamplingConfig represents the sampling of high-volume messages: each of Messages is logged
+// Burst times per Period, then once every Thereafter times. Warnings and errors are never sampled.
+type LogSamplingConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Messages   []string      `mapstructure:"messages"`
+	Burst      uint32        `mapstructure:"burst"`
+	Period     time.Duration `mapstructure:"period"`
+	Thereafter uint32        `mapstructure:"thereafter"`
+}
+
+// SlowLogConfig represents the durations from which MySQL statements, Redis commands and HTTP
+// requests are logged and counted as slow, 0 turning detection off for that dependency
+type SlowLogConfig struct {
+	MySQL time.Duration `mapstructure:"mysql"`
+	Redis time.Duration `mapstructure:"redis"`
+	HTTP  time.Duration `mapstructure:"http"`
+}
+
+// StartupConfig represents how long to retry connecting to MySQL and Redis at startup before giving up
+type StartupConfig struct {
+	Timeout        time.Duration `mapstructure:"timeout"`
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+}
+
+// ShutdownConfig represents the timeouts of the shutdown stages, which run in this order
+type ShutdownConfig struct {
+	HTTP      time.Duration `mapstructure:"http"`
+	Workers   time.Duration `mapstructure:"workers"`
+	Analytics time.Duration `mapstructure:"analytics"`
+	MQ        time.Duration `mapstructure:"mq"`
+	Storage   time.Duration `mapstructure:"storage"`
 }
 
 // DatabaseConfig represents database configuration
 type DatabaseConfig struct {
-	MySQL MySQLConfig `mapstructure:"mysql"`
-	Redis RedisConfig `mapstructure:"redis"`
+	MySQL       MySQLConfig       `mapstructure:"mysql"`
+	Redis       RedisConfig       `mapstructure:"redis"`
+	RedisShards RedisShardsConfig `mapstructure:"redis_shards"`
+	Shadow      ShadowConfig      `mapstructure:"shadow"`
 }
 
-// MySQLConfig represents MySQL configuration
+// MySQLConfig represents MySQL configuration. With AnalyticsViews, the views BI tools query are
+// created or replaced on startup, campaigns being the values of reports.param.
 type MySQLConfig struct {
-	DSN string `mapstructure:"dsn"`
+	DSN            string `mapstructure:"dsn"`
+	AnalyticsViews bool   `mapstructure:"analytics_views"`
 }
 
 // RedisConfig represents Redis configuration
 type RedisConfig struct {
+	Addr        string `mapstructure:"addr"`
+	Password    string `mapstructure:"password"`
+	DB          int    `mapstructure:"db"`
+	LegacyReads bool   `mapstructure:"legacy_reads"`
+}
+
+// RedisShardsConfig represents the Redis instances the keys of short links are spread over by
+// consistent hashing, database.redis keeping the Bloom Filter, streams and other shared state.
+// Sharding is off without shards.
+type RedisShardsConfig struct {
+	Shards           []RedisShardConfig `mapstructure:"shards"`
+	VirtualNodes     int                `mapstructure:"virtual_nodes"`
+	CheckInterval    time.Duration      `mapstructure:"check_interval"`
+	FailureThreshold int                `mapstructure:"failure_threshold"`
+}
+
+// RedisShardConfig represents one Redis shard. The name places it on the hash ring, so keys stay
+// on the shard when its address changes.
+type RedisShardConfig struct {
+	Name     string `mapstructure:"name"`
 	Addr     string `mapstructure:"addr"`
 	Password string `mapstructure:"password"`
 	DB       int    `mapstructure:"db"`
 }
 
+// ShadowConfig represents the storage a migration moves links to. Writes of links are mirrored to
+// it and reads repeated on it in the background to report divergences, so the cutover can be
+// validated with production traffic; the shadow_writes and shadow_reads feature flags roll both out.
+type ShadowConfig struct {
+	// MySQL is the target database, an empty DSN leaves MySQL unshadowed
+	MySQL MySQLConfig `mapstructure:"mysql"`
+	// Redis is the target instance, an empty addr leaves Redis unshadowed unless RedisShards is set
+	Redis RedisConfig `mapstructure:"redis"`
+	// RedisShards makes database.redis_shards the target instead of serving the links from them
+	RedisShards bool          `mapstructure:"redis_shards"`
+	Timeout     time.Duration `mapstructure:"timeout"`
+}
+
 // BloomConfig represents Bloom Filter configuration
 type BloomConfig struct {
+	Type      string  `mapstructure:"type"`
+	Key       string  `mapstructure:"key"`
 	Capacity  int64   `mapstructure:"capacity"`
 	ErrorRate float64 `mapstructure:"error_rate"`
 }
 
-// RocketMQConfig represents RocketMQ configuration
+// ShortCodeConfig represents the format of short codes accepted by the redirect handler, and how
+// new codes are generated
+type ShortCodeConfig struct {
+	Alphabet    string         `mapstructure:"alphabet"`
+	StaticPaths []string       `mapstructure:"static_paths"`
+	Generator   string         `mapstructure:"generator"`
+	Sequence    SequenceConfig `mapstructure:"sequence"`
+}
+
+// Generators of new short codes
+const (
+	// GeneratorHash derives codes from the hash of their URL, probing the next ones on collisions
+	GeneratorHash = "hash"
+	// GeneratorSequence numbers codes from a counter shared by every instance
+	GeneratorSequence = "sequence"
+)
+
+// Obfuscations of the codes numbered in sequence
+const (
+	// ObfuscationNone gives codes out in order, so each code tells which come next
+	ObfuscationNone = "none"
+	// ObfuscationFeistel scatters codes over those of their length with a Feistel network keyed by
+	// the secret
+	ObfuscationFeistel = "feistel"
+)
+
+// SequenceConfig represents the counter numbering short codes, kept in Redis under Key. Numbers are
+// scattered over the codes of their length by Obfuscation, keyed by Secret.
+type SequenceConfig struct {
+	Key         string `mapstructure:"key"`
+	Obfuscation string `mapstructure:"obfuscation"`
+	Secret      string `mapstructure:"secret"`
+}
+
+// SMSConfig represents the SMS-friendly short code pool configuration
+type SMSConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	Domain          string        `mapstructure:"domain"`
+	CodeLength      int           `mapstructure:"code_length"`
+	Capacity        int64         `mapstructure:"capacity"`
+	DefaultTTL      time.Duration `mapstructure:"default_ttl"`
+	RecycleInterval time.Duration `mapstructure:"recycle_interval"`
+	Bloom           BloomConfig   `mapstructure:"bloom"`
+}
+
+// RecycleConfig represents expired code recycling configuration
+type RecycleConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Quarantine time.Duration `mapstructure:"quarantine"`
+	Interval   time.Duration `mapstructure:"interval"`
+	BatchSize  int           `mapstructure:"batch_size"`
+}
+
+// ConversionConfig represents conversion tracking configuration
+type ConversionConfig struct {
+	Enabled           bool              `mapstructure:"enabled"`
+	Param             string            `mapstructure:"param"`
+	AttributionWindow time.Duration     `mapstructure:"attribution_window"`
+	RespectDoNotTrack bool              `mapstructure:"respect_do_not_track"`
+	Cookie            ClickCookieConfig `mapstructure:"cookie"`
+}
+
+// AnalyticsConfig represents real-time analytics configuration
+type AnalyticsConfig struct {
+	WriteBehind WriteBehindConfig `mapstructure:"write_behind"`
+	Retention   RetentionConfig   `mapstructure:"retention"`
+	Snapshot    SnapshotConfig    `mapstructure:"snapshot"`
+	PublicStats PublicStatsConfig `mapstructure:"public_stats"`
+	Archive     ArchiveConfig     `mapstructure:"archive"`
+	Drains      DrainsConfig      `mapstructure:"drains"`
+	Visitor     VisitorConfig     `mapstructure:"visitor"`
+}
+
+// Strategies identifying the unique visitors of short links
+const (
+	// VisitorStrategyIP counts a client IP once a day, so offices behind a NAT are one visitor
+	VisitorStrategyIP = "ip"
+	// VisitorStrategyIPUserAgent tells apart the browsers sharing an IP by their User-Agent
+	VisitorStrategyIPUserAgent = "ip_ua"
+	// VisitorStrategyCookie counts the first-party cookie ID set on the first redirect
+	VisitorStrategyCookie = "cookie"
+	// VisitorStrategyHeader counts the ID a trusted proxy or app sends in a header
+	VisitorStrategyHeader = "header"
+)
+
+// VisitorConfig represents how the unique visitors (UV) of short links are identified. Requests
+// without the header of the header strategy are identified by their IP, and visitors sending DNT or
+// Sec-GPC get no cookie with the cookie strategy and are identified by their IP and User-Agent.
+// Access logs record the strategy each visitor was identified with.
+type VisitorConfig struct {
+	Strategy string              `mapstructure:"strategy"`
+	Header   string              `mapstructure:"header"`
+	Cookie   VisitorCookieConfig `mapstructure:"cookie"`
+}
+
+// VisitorCookieConfig represents the first-party cookie carrying the ID of a visitor
+type VisitorCookieConfig struct {
+	Name   string        `mapstructure:"name"`
+	Domain string        `mapstructure:"domain"`
+	MaxAge time.Duration `mapstructure:"max_age"`
+	Secure bool          `mapstructure:"secure"`
+}
+
+// ArchiveConfig represents the export of raw access events to S3-compatible object storage, kept
+// there for as long as the bucket lifecycle says and queried with Athena or Spark. Stored events are
+// buffered and written every FlushInterval, or once BatchSize are buffered, as gzipped NDJSON objects
+// partitioned by day and short code. Failed writes are retried on the next flush while fewer than
+// BufferSize events are buffered. Credentials come from the AWS environment, as for SQS.
+type ArchiveConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	Bucket        string        `mapstructure:"bucket"`
+	Prefix        string        `mapstructure:"prefix"`
+	Region        string        `mapstructure:"region"`
+	Endpoint      string        `mapstructure:"endpoint"`
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	BatchSize     int           `mapstructure:"batch_size"`
+	BufferSize    int           `mapstructure:"buffer_size"`
+	Timeout       time.Duration `mapstructure:"timeout"`
+}
+
+// DrainsConfig represents the forwarding of stored access events to the endpoints link owners
+// register for a link or a campaign, the links whose reports.param has that value. Drains are kept
+// in a Redis hash under Key, which every instance reloads every RefreshInterval. Events are posted
+// in signed batches of up to BatchSize every FlushInterval, a failed batch retried Attempts times
+// with an exponential backoff from Backoff before it is dropped. Every drain buffers up to
+// BufferSize events, further ones being dropped while its endpoint is slow.
+type DrainsConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	Key             string        `mapstructure:"key"`
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+	FlushInterval   time.Duration `mapstructure:"flush_interval"`
+	BatchSize       int           `mapstructure:"batch_size"`
+	BufferSize      int           `mapstructure:"buffer_size"`
+	Timeout         time.Duration `mapstructure:"timeout"`
+	Attempts        int           `mapstructure:"attempts"`
+	Backoff         time.Duration `mapstructure:"backoff"`
+	// MaxPerScope caps the drains of a link or campaign
+	MaxPerScope int `mapstructure:"max_per_scope"`
+}
+
+// PublicStatsConfig represents the public stats pages served at /{shortCode}+ for the links their
+// owner made public, covering the last Days days from the daily aggregates
+type PublicStatsConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Days       int           `mapstructure:"days"`
+	TopSources int           `mapstructure:"top_sources"`
+	CacheTTL   time.Duration `mapstructure:"cache_ttl"`
+	MaxEntries int           `mapstructure:"max_entries"`
+}
+
+// SnapshotConfig represents the per-instance cache of analytics responses served to dashboards
+type SnapshotConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	TTL        time.Duration `mapstructure:"ttl"`
+	Jitter     time.Duration `mapstructure:"jitter"`
+	MaxEntries int           `mapstructure:"max_entries"`
+}
+
+// RetentionConfig represents how long each real-time metric is kept in Redis, 0 keeping it forever
+type RetentionConfig struct {
+	PV      time.Duration `mapstructure:"pv"`
+	UV      time.Duration `mapstructure:"uv"`
+	Sources time.Duration `mapstructure:"sources"`
+}
+
+// WriteBehindConfig represents the in-memory buffer batching analytics counter writes to Redis
+type WriteBehindConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	MaxKeys       int           `mapstructure:"max_keys"`
+}
+
+// ClickCookieConfig represents the first-party click ID cookie configuration
+type ClickCookieConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Name     string        `mapstructure:"name"`
+	Domain   string        `mapstructure:"domain"`
+	Path     string        `mapstructure:"path"`
+	MaxAge   time.Duration `mapstructure:"max_age"`
+	Secure   bool          `mapstructure:"secure"`
+	HTTPOnly bool          `mapstructure:"http_only"`
+	SameSite string        `mapstructure:"same_site"`
+}
+
+// CrawlerConfig represents the handling of crawler requests to short links
+type CrawlerConfig struct {
+	Policy     string       `mapstructure:"policy"`
+	UserAgents []string     `mapstructure:"user_agents"`
+	Robots     RobotsConfig `mapstructure:"robots"`
+}
+
+// RedirectConfig represents the responses redirecting to the destination of short links.
+// CacheControl applies to links without a Cache-Control of their own, none is sent when empty.
+// Timezone is the IANA timezone of the schedules of links without their own.
+type RedirectConfig struct {
+	CacheControl string `mapstructure:"cache_control"`
+	Timezone     string `mapstructure:"timezone"`
+}
+
+// Location returns the timezone of link schedules, UTC when not set
+func (c *RedirectConfig) Location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(c.Timezone)
+}
+
+// GeoIPConfig represents where the country of visitors is found for the links restricted to
+// countries: Header, such as CF-IPCountry, is trusted when a CDN in front of the service sets it,
+// and Database is a CSV file of start_ip,end_ip,country ranges, like the DB-IP country lite
+// database, the client IP is looked up in otherwise. Without either, countries are unknown.
+type GeoIPConfig struct {
+	Database string `mapstructure:"database"`
+	Header   string `mapstructure:"header"`
+}
+
+// EdgeConfig represents the tokens a CDN edge signs the requests it forwards to short links with,
+// telling the analytics edge cache hits from misses and direct requests. Every key is accepted,
+// so keys rotate by adding the new one, switching the edge to it and removing the old one. With
+// Required, requests to short links without a valid token are rejected. Purge works without tokens.
+type EdgeConfig struct {
+	Enabled  bool            `mapstructure:"enabled"`
+	Header   string          `mapstructure:"header"`
+	Required bool            `mapstructure:"required"`
+	MaxAge   time.Duration   `mapstructure:"max_age"`
+	Keys     []HMACKeyConfig `mapstructure:"keys"`
+	Purge    EdgePurgeConfig `mapstructure:"purge"`
+}
+
+// CDN providers cached redirects are purged from
+const (
+	PurgeProviderCloudflare = "cloudflare"
+	PurgeProviderFastly     = "fastly"
+)
+
+// EdgePurgeConfig represents the CDN API cached redirects are purged through when links change,
+// off without a provider. Purges are queued and delivered in the background, failures being
+// retried Attempts times at most after Backoff, doubled on every retry.
+type EdgePurgeConfig struct {
+	Provider   string                `mapstructure:"provider"`
+	Cloudflare CloudflarePurgeConfig `mapstructure:"cloudflare"`
+	Fastly     FastlyPurgeConfig     `mapstructure:"fastly"`
+	Timeout    time.Duration         `mapstructure:"timeout"`
+	Attempts   int                   `mapstructure:"attempts"`
+	Backoff    time.Duration         `mapstructure:"backoff"`
+	QueueSize  int                   `mapstructure:"queue_size"`
+}
+
+// CloudflarePurgeConfig represents the Cloudflare zone serving the short links, APIToken being
+// allowed to purge its cache
+type CloudflarePurgeConfig struct {
+	ZoneID   string `mapstructure:"zone_id"`
+	APIToken string `mapstructure:"api_token"`
+}
+
+// FastlyPurgeConfig represents the Fastly API key allowed to purge the services of the short links
+type FastlyPurgeConfig struct {
+	APIKey string `mapstructure:"api_key"`
+}
+
+// HMACKeyConfig represents a key signatures are made with, named by its ID in the signatures
+type HMACKeyConfig struct {
+	ID     string `mapstructure:"id"`
+	Secret string `mapstructure:"secret"`
+}
+
+// minHMACSecretLength is the shortest secret accepted for signing
+const minHMACSecretLength = 32
+
+// hmacKeyID matches the IDs of HMAC keys, which are embedded in signatures next to separators
+var hmacKeyID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// SigningConfig represents the signing of the params appended to the short links created with
+// signed_params, sent in the Param query parameter. The first key signs and every key verifies,
+// so keys rotate by putting the new one first and removing the old one once the links signed with
+// it are no longer in use. Signing is off without keys.
+type SigningConfig struct {
+	Param string          `mapstructure:"param"`
+	Keys  []HMACKeyConfig `mapstructure:"keys"`
+}
+
+// Secrets maps the IDs of the signing keys to their secrets
+func (c *SigningConfig) Secrets() map[string]string {
+	return hmacSecrets(c.Keys)
+}
+
+// RobotsConfig represents the rules served at /robots.txt
+type RobotsConfig struct {
+	Allow      []string `mapstructure:"allow"`
+	Disallow   []string `mapstructure:"disallow"`
+	CrawlDelay int      `mapstructure:"crawl_delay"`
+}
+
+// AdminConfig represents the admin server serving metrics and profiling endpoints
+type AdminConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	Port    int  `mapstructure:"port"`
+	Pprof   bool `mapstructure:"pprof"`
+}
+
+// Replication roles of an instance in a multi-region deployment
+const (
+	// ReplicationRolePrimary serves writes and streams link mutations to the replicas
+	ReplicationRolePrimary = "primary"
+	// ReplicationRoleReplica serves redirects from local copies of the primary's links
+	ReplicationRoleReplica = "replica"
+)
+
+// ReplicationConfig represents multi-region replication of links from a primary region to replicas.
+// Source is the primary's Redis, read by replicas using the redis-stream MQ driver.
+type ReplicationConfig struct {
+	Role   string      `mapstructure:"role"`
+	Region string      `mapstructure:"region"`
+	Source RedisConfig `mapstructure:"source"`
+}
+
+// FlagsConfig represents the feature flags gating the rollout of risky features. The rules set
+// here are overridden at runtime on the admin port, overrides being kept in Redis under key.
+type FlagsConfig struct {
+	Key             string                `mapstructure:"key"`
+	RefreshInterval time.Duration         `mapstructure:"refresh_interval"`
+	Features        map[string]FlagConfig `mapstructure:"features"`
+}
+
+// FlagConfig represents the rollout rule of a feature
+type FlagConfig struct {
+	Enabled    bool     `mapstructure:"enabled"`
+	Percentage int      `mapstructure:"percentage"`
+	APIKeys    []string `mapstructure:"api_keys"`
+}
+
+// RulesConfig represents the bot, reserved word, URL blocklist and traffic source rules set on the
+// admin port. Rules are kept in MySQL, a change being announced on the Redis pub/sub channel so
+// every instance reloads them at once, and reloaded every refresh interval in case an announcement
+// was missed.
+type RulesConfig struct {
+	Channel         string        `mapstructure:"channel"`
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+}
+
+// ClaimsConfig represents the self-serve mode, where links belong to the API key creating them and
+// anonymous links are claimed by proving control of their destination domain. Claims started are
+// kept in Redis under Key for TTL, and destinations are checked within Timeout.
+type ClaimsConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Key     string        `mapstructure:"key"`
+	TTL     time.Duration `mapstructure:"ttl"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// ReputationConfig represents the scoring of link destination domains from their abuse reports,
+// dead links and Safe Browsing listings. Domains scoring below InterstitialBelow are redirected
+// through a preview, and links to domains scoring below BlockBelow are refused. Every
+// CheckInterval, one instance checks up to CheckBatch domains not checked for RecheckAfter.
+type ReputationConfig struct {
+	Enabled           bool               `mapstructure:"enabled"`
+	Key               string             `mapstructure:"key"`
+	InterstitialBelow int                `mapstructure:"interstitial_below"`
+	BlockBelow        int                `mapstructure:"block_below"`
+	RefreshInterval   time.Duration      `mapstructure:"refresh_interval"`
+	CheckInterval     time.Duration      `mapstructure:"check_interval"`
+	CheckBatch        int                `mapstructure:"check_batch"`
+	RecheckAfter      time.Duration      `mapstructure:"recheck_after"`
+	Timeout           time.Duration      `mapstructure:"timeout"`
+	ReportWindow      time.Duration      `mapstructure:"report_window"`
+	SafeBrowsing      SafeBrowsingConfig `mapstructure:"safe_browsing"`
+}
+
+// SafeBrowsingConfig represents the Google Safe Browsing Lookup API, left out without an API key
+type SafeBrowsingConfig struct {
+	APIKey string `mapstructure:"api_key"`
+	URL    string `mapstructure:"url"`
+}
+
+// MaintenanceConfig represents the maintenance mode turned on from the admin port, its state being
+// kept in Redis under key so every instance honors it
+type MaintenanceConfig struct {
+	Key             string        `mapstructure:"key"`
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+	// RetryAfter is advertised to rejected writes when maintenance is turned on without an estimate
+	RetryAfter time.Duration `mapstructure:"retry_after"`
+}
+
+// Modes of the rate limit over the limit
+const (
+	// RateLimitModeReject rejects requests over the limit with 429 right away
+	RateLimitModeReject = "reject"
+	// RateLimitModeQueue holds requests over the limit until the limit lets them through
+	RateLimitModeQueue = "queue"
+)
+
+// RateLimitConfig represents the limit of generate requests per client IP: Rate requests per
+// second with bursts of Burst, counted by each instance. In the queue mode, up to QueueSize
+// requests over the limit are held until their turn rather than rejected, as long as it comes
+// within QueueTimeout.
+type RateLimitConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	Rate         float64       `mapstructure:"rate"`
+	Burst        int           `mapstructure:"burst"`
+	Mode         string        `mapstructure:"mode"`
+	QueueSize    int           `mapstructure:"queue_size"`
+	QueueTimeout time.Duration `mapstructure:"queue_timeout"`
+}
+
+// ReportsConfig represents the weekly campaign summaries delivered by email or webhook. Links are
+// grouped into campaigns by the value of their Param param, and the week before Weekday is
+// reported at Hour (UTC) on that day.
+type ReportsConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	Param         string        `mapstructure:"param"`
+	Weekday       string        `mapstructure:"weekday"`
+	Hour          int           `mapstructure:"hour"`
+	TopLinks      int           `mapstructure:"top_links"`
+	TopSources    int           `mapstructure:"top_sources"`
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+	// Key prefixes the Redis keys claiming the delivery of a week, so one instance sends it
+	Key string `mapstructure:"key"`
+	// To lists the addresses reports are emailed to through the mail server
+	To      []string      `mapstructure:"to"`
+	Webhook WebhookConfig `mapstructure:"webhook"`
+}
+
+// RemindersConfig represents the reminders sent to the owners of links expiring within Window, by
+// webhook or email as each owner subscribed, and the ExtendBy links are extended by in one call.
+// Every CheckInterval, one instance looks for up to Batch links newly entering the window.
+type RemindersConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	Key           string        `mapstructure:"key"`
+	Window        time.Duration `mapstructure:"window"`
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+	Batch         int           `mapstructure:"batch"`
+	ExtendBy      time.Duration `mapstructure:"extend_by"`
+	Timeout       time.Duration `mapstructure:"timeout"`
+}
+
+// SendDay returns the day of the week reports are sent on
+func (c *ReportsConfig) SendDay() time.Weekday {
+	return weekdays[strings.ToLower(c.Weekday)]
+}
+
+// weekdays maps the configurable days of the week
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// MailConfig represents the SMTP server emails are sent through, off without an address. With
+// DryRunDir set, emails are written there as .eml files instead, for development.
+type MailConfig struct {
+	Addr      string        `mapstructure:"addr"`
+	Username  string        `mapstructure:"username"`
+	Password  string        `mapstructure:"password"`
+	From      string        `mapstructure:"from"`
+	DryRunDir string        `mapstructure:"dry_run_dir"`
+	Attempts  int           `mapstructure:"attempts"`
+	Backoff   time.Duration `mapstructure:"backoff"`
+}
+
+// Enabled reports whether emails go anywhere
+func (c *MailConfig) Enabled() bool {
+	return c.Addr != "" || c.DryRunDir != ""
+}
+
+// WarehouseConfig represents the connector streaming access events and link mutations to data
+// warehouses, so analysts query them without running a consumer of their own
+type WarehouseConfig struct {
+	Destinations []WarehouseDestinationConfig `mapstructure:"destinations"`
+}
+
+// Types of warehouses the connector streams to
+const (
+	WarehouseTypeBigQuery = "bigquery"
+	WarehouseTypeSQL      = "sql"
+)
+
+// Streams of events sent to warehouses
+const (
+	WarehouseStreamAccess = "access"
+	WarehouseStreamLinks  = "links"
+)
+
+// Defaults of warehouse destinations, filled in by Validate as list entries get no viper defaults
+const (
+	defaultWarehouseAccessTable   = "access_events"
+	defaultWarehouseLinkTable     = "link_events"
+	defaultWarehouseFlushInterval = 10 * time.Second
+	defaultWarehouseBatchSize     = 500
+	defaultWarehouseBufferSize    = 100000
+	defaultWarehouseTimeout       = 30 * time.Second
+)
+
+// warehouseTable matches the table names accepted by every warehouse
+var warehouseTable = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// WarehouseDestinationConfig represents a warehouse the connector streams the events of Streams
+// to, access events, link mutations or both when empty. Rows are buffered and inserted every
+// FlushInterval, or once BatchSize are buffered, failed inserts being retried on the next flush
+// while fewer than BufferSize rows are buffered. Tables are created, or given the columns they
+// miss, before the first insert.
+type WarehouseDestinationConfig struct {
+	Name          string                  `mapstructure:"name"`
+	Type          string                  `mapstructure:"type"`
+	BigQuery      BigQueryWarehouseConfig `mapstructure:"bigquery"`
+	SQL           SQLWarehouseConfig      `mapstructure:"sql"`
+	Streams       []string                `mapstructure:"streams"`
+	AccessTable   string                  `mapstructure:"access_table"`
+	LinkTable     string                  `mapstructure:"link_table"`
+	FlushInterval time.Duration           `mapstructure:"flush_interval"`
+	BatchSize     int                     `mapstructure:"batch_size"`
+	BufferSize    int                     `mapstructure:"buffer_size"`
+	Timeout       time.Duration           `mapstructure:"timeout"`
+}
+
+// BigQueryWarehouseConfig represents the BigQuery dataset tables are created in. Without a
+// service account key file, tokens come from the metadata server of GCE and GKE.
+type BigQueryWarehouseConfig struct {
+	Project         string `mapstructure:"project"`
+	Dataset         string `mapstructure:"dataset"`
+	CredentialsFile string `mapstructure:"credentials_file"`
+}
+
+// SQLWarehouseConfig represents a SQL warehouse speaking the MySQL protocol, tables being created
+// in the database of the DSN
+type SQLWarehouseConfig struct {
+	DSN string `mapstructure:"dsn"`
+}
+
+// Receives reports whether the destination receives the events of a stream
+func (c *WarehouseDestinationConfig) Receives(stream string) bool {
+	if len(c.Streams) == 0 {
+		return true
+	}
+	for _, s := range c.Streams {
+		if s == stream {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookConfig represents the URL reports are posted to as JSON, off without a URL
+type WebhookConfig struct {
+	URL     string        `mapstructure:"url"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// ChaosConfig represents fault injection into dependency calls for resilience testing
+type ChaosConfig struct {
+	Enabled bool        `mapstructure:"enabled"`
+	Redis   FaultConfig `mapstructure:"redis"`
+	MySQL   FaultConfig `mapstructure:"mysql"`
+	MQ      FaultConfig `mapstructure:"mq"`
+}
+
+// FaultConfig represents the faults injected into calls to one dependency
+type FaultConfig struct {
+	ErrorRate   float64       `mapstructure:"error_rate"`
+	LatencyRate float64       `mapstructure:"latency_rate"`
+	Latency     time.Duration `mapstructure:"latency"`
+}
+
+// MQConfig represents the selection of the message queue carrying access log events
+type MQConfig struct {
+	Driver      string               `mapstructure:"driver"`
+	Encoding    string               `mapstructure:"encoding"`
+	LinkEvents  bool                 `mapstructure:"link_events"`
+	NATS        NATSConfig           `mapstructure:"nats"`
+	SQS         SQSConfig            `mapstructure:"sqs"`
+	RedisStream RedisStreamConfig    `mapstructure:"redis_stream"`
+	DeadLetter  DeadLetterConfig     `mapstructure:"dead_letter"`
+	Buffer      ProducerBufferConfig `mapstructure:"buffer"`
+}
+
+// NATSConfig represents NATS JetStream configuration
+type NATSConfig struct {
+	URL         string        `mapstructure:"url"`
+	Stream      string        `mapstructure:"stream"`
+	Subject     string        `mapstructure:"subject"`
+	LinkSubject string        `mapstructure:"link_subject"`
+	Durable     string        `mapstructure:"durable"`
+	AckPolicy   string        `mapstructure:"ack_policy"`
+	AckWait     time.Duration `mapstructure:"ack_wait"`
+	MaxDeliver  int           `mapstructure:"max_deliver"`
+	MaxAge      time.Duration `mapstructure:"max_age"`
+	DedupWindow time.Duration `mapstructure:"dedup_window"`
+}
+
+// SQSConfig represents Amazon SQS configuration, optionally publishing through an SNS topic
+type SQSConfig struct {
+	Region            string        `mapstructure:"region"`
+	Endpoint          string        `mapstructure:"endpoint"`
+	QueueURL          string        `mapstructure:"queue_url"`
+	TopicARN          string        `mapstructure:"topic_arn"`
+	BatchSize         int           `mapstructure:"batch_size"`
+	BatchInterval     time.Duration `mapstructure:"batch_interval"`
+	WaitTime          time.Duration `mapstructure:"wait_time"`
+	VisibilityTimeout time.Duration `mapstructure:"visibility_timeout"`
+	RetryDelay        time.Duration `mapstructure:"retry_delay"`
+}
+
+// RedisStreamConfig represents Redis Streams configuration
+type RedisStreamConfig struct {
+	Stream        string        `mapstructure:"stream"`
+	LinkStream    string        `mapstructure:"link_stream"`
+	Group         string        `mapstructure:"group"`
+	Consumer      string        `mapstructure:"consumer"`
+	MaxLen        int64         `mapstructure:"max_len"`
+	BatchSize     int64         `mapstructure:"batch_size"`
+	Block         time.Duration `mapstructure:"block"`
+	ClaimMinIdle  time.Duration `mapstructure:"claim_min_idle"`
+	ClaimInterval time.Duration `mapstructure:"claim_interval"`
+	MaxDeliver    int64         `mapstructure:"max_deliver"`
+}
+
+// DeadLetterConfig represents the Redis-backed queue of access log events that keep failing
+type DeadLetterConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	Stream      string        `mapstructure:"stream"`
+	MaxAttempts int64         `mapstructure:"max_attempts"`
+	AttemptTTL  time.Duration `mapstructure:"attempt_ttl"`
+	MaxLen      int64         `mapstructure:"max_len"`
+}
+
+// ProducerBufferConfig represents the local buffer decoupling access log sends from the broker
+type ProducerBufferConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	Size          int           `mapstructure:"size"`
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	SendTimeout   time.Duration `mapstructure:"send_timeout"`
+	Overflow      string        `mapstructure:"overflow"`
+	SpillDir      string        `mapstructure:"spill_dir"`
+	SpillMaxBytes int64         `mapstructure:"spill_max_bytes"`
+}
+
+// RocketMQConfig represents RocketMQ configuration. Topic carries every kind of message that Topics
+// does not route to a topic of its own.
 type RocketMQConfig struct {
-	NameServer string `mapstructure:"nameserver"`
-	Topic      string `mapstructure:"topic"`
-	Group      string `mapstructure:"group"`
+	NameServer string               `mapstructure:"nameserver"`
+	Topic      string               `mapstructure:"topic"`
+	Group      string               `mapstructure:"group"`
+	Topics     RocketMQTopicsConfig `mapstructure:"topics"`
+}
+
+// RocketMQTopicsConfig routes access logs, link lifecycle events and alerts to their topics
+type RocketMQTopicsConfig struct {
+	AccessLog  RocketMQTopicConfig `mapstructure:"access_log"`
+	LinkEvents RocketMQTopicConfig `mapstructure:"link_events"`
+	Alerts     RocketMQTopicConfig `mapstructure:"alerts"`
+}
+
+// RocketMQTopicConfig represents a topic and the settings of its producer. Without a name the
+// messages go to the shared topic.
+type RocketMQTopicConfig struct {
+	Name        string        `mapstructure:"name"`
+	Retries     int           `mapstructure:"retries"`
+	SendTimeout time.Duration `mapstructure:"send_timeout"`
+}
+
+// TopicName returns the topic of a kind of message, the shared one when it has none
+func (c *RocketMQConfig) TopicName(topic *RocketMQTopicConfig) string {
+	if topic.Name != "" {
+		return topic.Name
+	}
+	return c.Topic
+}
+
+// validate checks the producer settings of the topics
+func (c *RocketMQTopicsConfig) validate() error {
+	topics := []struct {
+		name  string
+		topic *RocketMQTopicConfig
+	}{{"access_log", &c.AccessLog}, {"link_events", &c.LinkEvents}, {"alerts", &c.Alerts}}
+	for _, t := range topics {
+		if t.topic.Retries < 0 {
+			return fmt.Errorf("invalid rocketmq.topics.%s.retries: %d is negative", t.name, t.topic.Retries)
+		}
+		if t.topic.SendTimeout <= 0 {
+			return fmt.Errorf("invalid rocketmq.topics.%s.send_timeout: %s is not positive", t.name, t.topic.SendTimeout)
+		}
+	}
+	return nil
 }
 
 // Global config instance
 var cfg *Config
 
-// Load loads configuration from file
+// EnvPrefix prefixes the environment variables overriding settings, OCTOPUS_SERVER_PORT setting
+// server.port
+const EnvPrefix = "OCTOPUS"
+
+// Sources locates the layers of the configuration. Each layer overrides the ones before it: the
+// defaults, the base file, the profile file, the environment and the overrides.
+type Sources struct {
+	// Path is the base file
+	Path string
+	// Profile names the file overriding the base one for an environment, config.<profile>.yaml
+	// next to config.yaml, none when empty
+	Profile string
+	// Overrides are key=value settings of the command line, keys in dotted form like server.port
+	Overrides []string
+}
+
+// ProfilePath returns the file of the profile, next to the base file
+func (s *Sources) ProfilePath() string {
+	ext := filepath.Ext(s.Path)
+	return strings.TrimSuffix(s.Path, ext) + "." + s.Profile + ext
+}
+
+// Load loads configuration from file, overridden by the environment
 func Load(configPath string) (*Config, error) {
+	return LoadSources(&Sources{Path: configPath})
+}
+
+// LoadSources loads configuration from all its layers
+func LoadSources(sources *Sources) (*Config, error) {
 	v := viper.New()
 
-	v.SetConfigFile(configPath)
+	v.SetConfigFile(sources.Path)
 	v.SetConfigType("yaml")
 
 	// Set defaults
@@ -69,6 +951,27 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	// Settings of the profile are merged into the base ones, lists replaced as a whole
+	if sources.Profile != "" {
+		v.SetConfigFile(sources.ProfilePath())
+		if err := v.MergeInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read profile %s: %w", sources.Profile, err)
+		}
+	}
+
+	// Only settings found in a file or with a default can be set from the environment
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	for _, override := range sources.Overrides {
+		key, value, ok := strings.Cut(override, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid override %q: want key=value", override)
+		}
+		v.Set(key, value)
+	}
+
 	cfg = &Config{}
 	if err := v.Unmarshal(cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
@@ -77,10 +980,230 @@ func Load(configPath string) (*Config, error) {
 	// Expand environment variables
 	cfg.Database.Redis.Password = expandEnv(cfg.Database.Redis.Password)
 	cfg.Database.MySQL.DSN = expandEnv(cfg.Database.MySQL.DSN)
+	cfg.Server.BaseURL = expandEnv(cfg.Server.BaseURL)
+	cfg.Replication.Source.Password = expandEnv(cfg.Replication.Source.Password)
+	for i := range cfg.Database.RedisShards.Shards {
+		cfg.Database.RedisShards.Shards[i].Password = expandEnv(cfg.Database.RedisShards.Shards[i].Password)
+	}
+	cfg.Database.Shadow.MySQL.DSN = expandEnv(cfg.Database.Shadow.MySQL.DSN)
+	cfg.Database.Shadow.Redis.Password = expandEnv(cfg.Database.Shadow.Redis.Password)
+	cfg.Mail.Password = expandEnv(cfg.Mail.Password)
+	cfg.Reports.Webhook.URL = expandEnv(cfg.Reports.Webhook.URL)
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 
 	return cfg, nil
 }
 
+// Validate checks the settings the service cannot run without, normalizing the base URLs
+func (c *Config) Validate() error {
+	baseURL, err := validateBaseURL(c.Server.BaseURL)
+	if err != nil {
+		return fmt.Errorf("invalid server.base_url: %w", err)
+	}
+	c.Server.BaseURL = baseURL
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return fmt.Errorf("invalid server.trusted_proxies: %q is not an IP or CIDR", proxy)
+			}
+		}
+	}
+
+	if err := c.Log.validate(); err != nil {
+		return err
+	}
+	if err := c.API.validate(); err != nil {
+		return err
+	}
+
+	switch c.ShortCode.Generator {
+	case "", GeneratorHash:
+	case GeneratorSequence:
+		if err := c.ShortCode.Sequence.validate(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid shortcode.generator: %q is not hash or sequence", c.ShortCode.Generator)
+	}
+
+	// The SMS pool is served on its own domain, which overrides the base URL for its links
+	if c.SMS.Enabled {
+		domain, err := validateBaseURL(c.SMS.Domain)
+		if err != nil {
+			return fmt.Errorf("invalid sms.domain: %w", err)
+		}
+		c.SMS.Domain = domain
+	}
+
+	names := make(map[string]bool, len(c.Database.RedisShards.Shards))
+	for i, shard := range c.Database.RedisShards.Shards {
+		if shard.Addr == "" {
+			return fmt.Errorf("invalid database.redis_shards.shards[%d].addr: not set", i)
+		}
+		if shard.Name == "" {
+			return fmt.Errorf("invalid database.redis_shards.shards[%d].name: not set", i)
+		}
+		if names[shard.Name] {
+			return fmt.Errorf("invalid database.redis_shards.shards[%d].name: %q is used twice", i, shard.Name)
+		}
+		names[shard.Name] = true
+	}
+
+	if c.Database.Shadow.RedisShards {
+		if len(c.Database.RedisShards.Shards) == 0 {
+			return errors.New("invalid database.shadow.redis_shards: no shards in database.redis_shards")
+		}
+		if c.Database.Shadow.Redis.Addr != "" {
+			return errors.New("invalid database.shadow.redis_shards: database.shadow.redis is set too")
+		}
+	} else if c.Database.Shadow.Redis.Addr != "" && len(c.Database.RedisShards.Shards) > 0 {
+		// Only links served from database.redis are shadowed
+		return errors.New("invalid database.shadow.redis: links are served from database.redis_shards")
+	}
+
+	if c.Analytics.PublicStats.Enabled && (c.Analytics.PublicStats.Days < 1 || c.Analytics.PublicStats.Days > 365) {
+		return fmt.Errorf("invalid analytics.public_stats.days: %d is not between 1 and 365", c.Analytics.PublicStats.Days)
+	}
+	if c.Analytics.Archive.Enabled {
+		if err := c.Analytics.Archive.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Analytics.Drains.Enabled {
+		if err := c.Analytics.Drains.validate(); err != nil {
+			return err
+		}
+	}
+	if err := c.Analytics.Visitor.validate(); err != nil {
+		return err
+	}
+	if c.Redirect.CacheControl != "" {
+		if err := util.ValidateCacheControl(c.Redirect.CacheControl); err != nil {
+			return fmt.Errorf("invalid redirect.cache_control: %w", err)
+		}
+	}
+	if _, err := c.Redirect.Location(); err != nil {
+		return fmt.Errorf("invalid redirect.timezone: %w", err)
+	}
+	if c.Edge.Enabled {
+		if err := c.Edge.validate(); err != nil {
+			return err
+		}
+	}
+	if len(c.Signing.Keys) > 0 {
+		if c.Signing.Param == "" {
+			return errors.New("invalid signing.param: not set")
+		}
+		if err := validateHMACKeys("signing.keys", c.Signing.Keys); err != nil {
+			return err
+		}
+	}
+	if c.Edge.Purge.Provider != "" {
+		if err := c.Edge.Purge.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Mail.Enabled() && c.Mail.From == "" {
+		return errors.New("invalid mail.from: required to send emails")
+	}
+	if c.Reports.Enabled {
+		if err := c.Reports.validate(&c.Mail); err != nil {
+			return err
+		}
+	}
+
+	if c.Claims.Enabled {
+		if err := c.Claims.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Reputation.Enabled {
+		if err := c.Reputation.validate(); err != nil {
+			return err
+		}
+	}
+	if c.RateLimit.Enabled {
+		if err := c.RateLimit.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Reminders.Enabled {
+		if !c.Claims.Enabled {
+			return errors.New("invalid reminders: links only have owners to remind with claims.enabled")
+		}
+		if err := c.Reminders.validate(); err != nil {
+			return err
+		}
+	}
+
+	for name, flag := range c.Flags.Features {
+		if flag.Percentage < 0 || flag.Percentage > 100 {
+			return fmt.Errorf("invalid flags.features.%s.percentage: %d is not between 0 and 100", name, flag.Percentage)
+		}
+	}
+
+	names = make(map[string]bool, len(c.Warehouse.Destinations))
+	for i := range c.Warehouse.Destinations {
+		dest := &c.Warehouse.Destinations[i]
+		if err := dest.validate(i); err != nil {
+			return err
+		}
+		if names[dest.Name] {
+			return fmt.Errorf("invalid warehouse.destinations[%d].name: %q is used twice", i, dest.Name)
+		}
+		names[dest.Name] = true
+	}
+
+	if c.RocketMQ.NameServer != "" {
+		if err := c.RocketMQ.Topics.validate(); err != nil {
+			return err
+		}
+	}
+
+	switch c.Replication.Role {
+	case "":
+	case ReplicationRolePrimary, ReplicationRoleReplica:
+		if c.Replication.Region == "" {
+			return errors.New("invalid replication.region: not set")
+		}
+		// Replicas only learn about links through the primary's link events
+		if c.Replication.Role == ReplicationRolePrimary && !c.MQ.LinkEvents {
+			return errors.New("invalid replication.role: primary requires mq.link_events")
+		}
+	default:
+		return fmt.Errorf("invalid replication.role: %q is neither primary nor replica", c.Replication.Role)
+	}
+
+	return nil
+}
+
+// validateBaseURL checks that short links can be built by appending "/<code>" to a base URL, and
+// returns it without a trailing slash
+func validateBaseURL(raw string) (string, error) {
+	if raw == "" {
+		return "", errors.New("not set")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("%q must be an http or https URL", raw)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("%q has no host", raw)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" || strings.Trim(u.Path, "/") != "" {
+		return "", fmt.Errorf("%q must only consist of scheme, host and port", raw)
+	}
+
+	return u.Scheme + "://" + u.Host, nil
+}
+
 // Get returns the global config instance
 func Get() *Config {
 	return cfg
@@ -90,10 +1213,599 @@ func Get() *Config {
 func setDefaults(v *viper.Viper) {
 	v.SetDefault("server.port", 8080)
 	v.SetDefault("server.mode", "debug")
+
+	// Log defaults
+	v.SetDefault("log.format", LogFormatConsole)
+	v.SetDefault("log.file.max_size", 100)
+	v.SetDefault("log.file.max_backups", 5)
+	v.SetDefault("log.file.max_age", 30)
+	v.SetDefault("log.file.compress", true)
+	v.SetDefault("log.sampling.messages", []string{"HTTP request"})
+	v.SetDefault("log.sampling.burst", 100)
+	v.SetDefault("log.sampling.period", time.Second)
+	v.SetDefault("log.sampling.thereafter", 100)
+	v.SetDefault("log.slow.mysql", 200*time.Millisecond)
+	v.SetDefault("log.slow.redis", 50*time.Millisecond)
+	v.SetDefault("log.slow.http", time.Second)
+	v.SetDefault("server.startup.timeout", 30*time.Second)
+	v.SetDefault("server.startup.initial_backoff", 500*time.Millisecond)
+	v.SetDefault("server.startup.max_backoff", 5*time.Second)
+	v.SetDefault("server.shutdown.http", 10*time.Second)
+	v.SetDefault("server.shutdown.workers", 5*time.Second)
+	v.SetDefault("server.shutdown.analytics", 5*time.Second)
+	v.SetDefault("server.shutdown.mq", 5*time.Second)
+	v.SetDefault("server.shutdown.storage", 2*time.Second)
+	v.SetDefault("database.redis.legacy_reads", true)
+	v.SetDefault("database.redis_shards.virtual_nodes", 160)
+	v.SetDefault("database.redis_shards.check_interval", 5*time.Second)
+	v.SetDefault("database.redis_shards.failure_threshold", 3)
+	v.SetDefault("database.shadow.timeout", 500*time.Millisecond)
+	v.SetDefault("bloom.type", "bloom")
+	v.SetDefault("bloom.key", "shortlink:bloom")
 	v.SetDefault("bloom.capacity", 1000000000)
 	v.SetDefault("bloom.error_rate", 0.01)
+	v.SetDefault("shortcode.alphabet", "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567")
+	v.SetDefault("shortcode.generator", GeneratorHash)
+	v.SetDefault("shortcode.sequence.key", "octopus:shortcode:sequence")
+	v.SetDefault("shortcode.sequence.obfuscation", ObfuscationFeistel)
+	v.SetDefault("shortcode.static_paths", []string{
+		"apple-touch-icon.png", "apple-touch-icon-precomposed.png",
+		"sitemap.xml", "ads.txt", "manifest.json", "browserconfig.xml",
+	})
+	v.SetDefault("sms.enabled", false)
+	v.SetDefault("sms.code_length", 4)
+	v.SetDefault("sms.default_ttl", 7*24*time.Hour)
+	v.SetDefault("sms.recycle_interval", time.Minute)
+	v.SetDefault("sms.bloom.type", "bloom")
+	v.SetDefault("sms.bloom.key", "shortlink:bloom:sms")
+	v.SetDefault("sms.bloom.capacity", 1048576)
+	v.SetDefault("sms.bloom.error_rate", 0.001)
+	v.SetDefault("recycle.enabled", false)
+	v.SetDefault("recycle.quarantine", 30*24*time.Hour)
+	v.SetDefault("recycle.interval", 10*time.Minute)
+	v.SetDefault("recycle.batch_size", 500)
+	v.SetDefault("conversion.enabled", false)
+	v.SetDefault("conversion.param", "octo_cid")
+	v.SetDefault("conversion.attribution_window", 30*24*time.Hour)
+	v.SetDefault("conversion.respect_do_not_track", true)
+	v.SetDefault("conversion.cookie.enabled", false)
+	v.SetDefault("conversion.cookie.name", "octo_cid")
+	v.SetDefault("conversion.cookie.path", "/")
+	v.SetDefault("conversion.cookie.max_age", 30*24*time.Hour)
+	v.SetDefault("conversion.cookie.http_only", true)
+	v.SetDefault("conversion.cookie.same_site", "lax")
+	v.SetDefault("analytics.write_behind.enabled", false)
+	v.SetDefault("analytics.write_behind.flush_interval", 100*time.Millisecond)
+	v.SetDefault("analytics.write_behind.max_keys", 10000)
+	v.SetDefault("analytics.retention.pv", 24*time.Hour)
+	v.SetDefault("analytics.retention.uv", 24*time.Hour)
+	v.SetDefault("analytics.retention.sources", 24*time.Hour)
+	v.SetDefault("analytics.snapshot.enabled", true)
+	v.SetDefault("analytics.snapshot.ttl", 5*time.Second)
+	v.SetDefault("analytics.snapshot.jitter", time.Second)
+	v.SetDefault("analytics.snapshot.max_entries", 10000)
+	v.SetDefault("analytics.public_stats.enabled", false)
+	v.SetDefault("analytics.public_stats.days", 30)
+	v.SetDefault("analytics.public_stats.top_sources", 5)
+	v.SetDefault("analytics.public_stats.cache_ttl", 5*time.Minute)
+	v.SetDefault("analytics.public_stats.max_entries", 10000)
+	v.SetDefault("analytics.archive.enabled", false)
+	v.SetDefault("analytics.archive.prefix", "access-events")
+	v.SetDefault("analytics.archive.flush_interval", 5*time.Minute)
+	v.SetDefault("analytics.archive.batch_size", 50000)
+	v.SetDefault("analytics.archive.buffer_size", 500000)
+	v.SetDefault("analytics.archive.timeout", 30*time.Second)
+	v.SetDefault("analytics.drains.enabled", false)
+	v.SetDefault("analytics.drains.key", "octopus:drains")
+	v.SetDefault("analytics.drains.refresh_interval", 10*time.Second)
+	v.SetDefault("analytics.drains.flush_interval", 5*time.Second)
+	v.SetDefault("analytics.drains.batch_size", 500)
+	v.SetDefault("analytics.drains.buffer_size", 10000)
+	v.SetDefault("analytics.drains.timeout", 10*time.Second)
+	v.SetDefault("analytics.drains.attempts", 5)
+	v.SetDefault("analytics.drains.backoff", time.Second)
+	v.SetDefault("analytics.drains.max_per_scope", 5)
+	v.SetDefault("analytics.visitor.strategy", VisitorStrategyIP)
+	v.SetDefault("analytics.visitor.header", "X-Visitor-ID")
+	v.SetDefault("analytics.visitor.cookie.name", "octo_vid")
+	v.SetDefault("analytics.visitor.cookie.max_age", 365*24*time.Hour)
+	v.SetDefault("crawler.policy", "redirect")
+	v.SetDefault("crawler.user_agents", []string{
+		"bot", "crawler", "spider", "slurp", "facebookexternalhit", "embedly", "preview",
+	})
+	v.SetDefault("crawler.robots.disallow", []string{})
+	v.SetDefault("redirect.cache_control", "no-store")
+	v.SetDefault("redirect.timezone", "UTC")
+	v.SetDefault("geoip.database", "")
+	v.SetDefault("geoip.header", "")
+	v.SetDefault("edge.enabled", false)
+	v.SetDefault("edge.header", "X-Edge-Token")
+	v.SetDefault("edge.max_age", 5*time.Minute)
+	v.SetDefault("signing.param", "sig")
+	v.SetDefault("edge.purge.timeout", 10*time.Second)
+	v.SetDefault("edge.purge.attempts", 5)
+	v.SetDefault("edge.purge.backoff", time.Second)
+	v.SetDefault("edge.purge.queue_size", 10000)
+	v.SetDefault("admin.enabled", false)
+	v.SetDefault("admin.port", 6060)
+	v.SetDefault("admin.pprof", true)
+	v.SetDefault("chaos.enabled", false)
+	v.SetDefault("flags.key", "octopus:flags")
+	v.SetDefault("flags.refresh_interval", 10*time.Second)
+	v.SetDefault("maintenance.key", "octopus:maintenance")
+	v.SetDefault("maintenance.refresh_interval", 2*time.Second)
+	v.SetDefault("maintenance.retry_after", time.Minute)
+	v.SetDefault("rules.channel", "octopus:rules")
+	v.SetDefault("rules.refresh_interval", 5*time.Minute)
+	v.SetDefault("claims.enabled", false)
+	v.SetDefault("claims.key", "octopus:claims")
+	v.SetDefault("claims.ttl", 48*time.Hour)
+	v.SetDefault("claims.timeout", 5*time.Second)
+	v.SetDefault("rate_limit.enabled", false)
+	v.SetDefault("rate_limit.rate", 10)
+	v.SetDefault("rate_limit.burst", 20)
+	v.SetDefault("rate_limit.mode", RateLimitModeReject)
+	v.SetDefault("rate_limit.queue_size", 100)
+	v.SetDefault("rate_limit.queue_timeout", 5*time.Second)
+	v.SetDefault("reputation.enabled", false)
+	v.SetDefault("reputation.key", "octopus:reputation")
+	v.SetDefault("reputation.interstitial_below", 60)
+	v.SetDefault("reputation.block_below", 30)
+	v.SetDefault("reputation.refresh_interval", time.Minute)
+	v.SetDefault("reputation.check_interval", time.Minute)
+	v.SetDefault("reputation.check_batch", 50)
+	v.SetDefault("reputation.recheck_after", 24*time.Hour)
+	v.SetDefault("reputation.timeout", 5*time.Second)
+	v.SetDefault("reputation.report_window", 24*time.Hour)
+	v.SetDefault("reputation.safe_browsing.url", "https://safebrowsing.googleapis.com/v4/threatMatches:find")
+	v.SetDefault("reports.param", "campaign")
+	v.SetDefault("reports.weekday", "monday")
+	v.SetDefault("reports.hour", 8)
+	v.SetDefault("reports.top_links", 5)
+	v.SetDefault("reports.top_sources", 5)
+	v.SetDefault("reports.check_interval", 10*time.Minute)
+	v.SetDefault("reports.key", "octopus:reports")
+	v.SetDefault("reports.webhook.timeout", 10*time.Second)
+	v.SetDefault("reminders.enabled", false)
+	v.SetDefault("reminders.key", "octopus:reminders")
+	v.SetDefault("reminders.window", 72*time.Hour)
+	v.SetDefault("reminders.check_interval", 10*time.Minute)
+	v.SetDefault("reminders.batch", 500)
+	v.SetDefault("reminders.extend_by", 30*24*time.Hour)
+	v.SetDefault("reminders.timeout", 10*time.Second)
+
+	// Mail defaults
+	v.SetDefault("mail.attempts", 3)
+	v.SetDefault("mail.backoff", 2*time.Second)
+	v.SetDefault("mq.driver", "rocketmq")
+	v.SetDefault("mq.encoding", "json")
+	v.SetDefault("mq.link_events", false)
+	v.SetDefault("mq.nats.stream", "ACCESS_LOG")
+	v.SetDefault("mq.nats.subject", "octopus.access_log")
+	v.SetDefault("mq.nats.link_subject", "octopus.link_events")
+	v.SetDefault("mq.nats.durable", "shortlink_consumer")
+	v.SetDefault("mq.nats.ack_policy", "explicit")
+	v.SetDefault("mq.nats.ack_wait", 30*time.Second)
+	v.SetDefault("mq.nats.max_deliver", 5)
+	v.SetDefault("mq.nats.max_age", 72*time.Hour)
+	v.SetDefault("mq.nats.dedup_window", 2*time.Minute)
+	v.SetDefault("mq.sqs.batch_size", 10)
+	v.SetDefault("mq.sqs.batch_interval", 100*time.Millisecond)
+	v.SetDefault("mq.sqs.wait_time", 20*time.Second)
+	v.SetDefault("mq.sqs.visibility_timeout", 30*time.Second)
+	v.SetDefault("mq.sqs.retry_delay", 10*time.Second)
+	v.SetDefault("mq.redis_stream.stream", "octopus:access_log")
+	v.SetDefault("mq.redis_stream.link_stream", "octopus:link_events")
+	v.SetDefault("mq.redis_stream.group", "shortlink_consumer_group")
+	v.SetDefault("mq.redis_stream.max_len", 1000000)
+	v.SetDefault("mq.redis_stream.batch_size", 100)
+	v.SetDefault("mq.redis_stream.block", 5*time.Second)
+	v.SetDefault("mq.redis_stream.claim_min_idle", time.Minute)
+	v.SetDefault("mq.redis_stream.claim_interval", 30*time.Second)
+	v.SetDefault("mq.redis_stream.max_deliver", 5)
+	v.SetDefault("mq.dead_letter.enabled", false)
+	v.SetDefault("mq.dead_letter.stream", "octopus:dlq:access_log")
+	v.SetDefault("mq.dead_letter.max_attempts", 5)
+	v.SetDefault("mq.dead_letter.attempt_ttl", 24*time.Hour)
+	v.SetDefault("mq.dead_letter.max_len", 100000)
+	v.SetDefault("mq.buffer.enabled", true)
+	v.SetDefault("mq.buffer.size", 10000)
+	v.SetDefault("mq.buffer.flush_interval", 100*time.Millisecond)
+	v.SetDefault("mq.buffer.send_timeout", 3*time.Second)
+	v.SetDefault("mq.buffer.overflow", "drop")
+	v.SetDefault("mq.buffer.spill_dir", "data/spill")
+	v.SetDefault("mq.buffer.spill_max_bytes", 64<<20)
 	v.SetDefault("rocketmq.topic", "access_log")
 	v.SetDefault("rocketmq.group", "shortlink_consumer_group")
+	for _, topic := range []string{"access_log", "link_events", "alerts"} {
+		v.SetDefault("rocketmq.topics."+topic+".retries", 3)
+		v.SetDefault("rocketmq.topics."+topic+".send_timeout", 3*time.Second)
+	}
+}
+
+// validate checks that enabled edge tokens can be verified
+func (c *EdgeConfig) validate() error {
+	if c.Header == "" {
+		return errors.New("invalid edge.header: not set")
+	}
+	if c.MaxAge <= 0 {
+		return fmt.Errorf("invalid edge.max_age: %s is not positive", c.MaxAge)
+	}
+	if len(c.Keys) == 0 {
+		return errors.New("invalid edge.keys: no key to verify tokens with")
+	}
+	return validateHMACKeys("edge.keys", c.Keys)
+}
+
+// validateHMACKeys checks that keys have distinct IDs made of letters, digits, dashes and
+// underscores, and secrets long enough
+func validateHMACKeys(path string, keys []HMACKeyConfig) error {
+	ids := make(map[string]bool, len(keys))
+	for i, key := range keys {
+		switch {
+		case !hmacKeyID.MatchString(key.ID):
+			return fmt.Errorf("invalid %s[%d].id: %q must only have letters, digits, dashes and underscores", path, i, key.ID)
+		case ids[key.ID]:
+			return fmt.Errorf("invalid %s[%d].id: %q is used twice", path, i, key.ID)
+		case len(key.Secret) < minHMACSecretLength:
+			return fmt.Errorf("invalid %s[%d].secret: shorter than %d characters", path, i, minHMACSecretLength)
+		}
+		ids[key.ID] = true
+	}
+	return nil
+}
+
+// hmacSecrets maps the IDs of keys to their secrets
+func hmacSecrets(keys []HMACKeyConfig) map[string]string {
+	secrets := make(map[string]string, len(keys))
+	for _, key := range keys {
+		secrets[key.ID] = key.Secret
+	}
+	return secrets
+}
+
+// validate checks that rows can be inserted into the destination, filling in the defaults of the
+// settings left out
+func (c *WarehouseDestinationConfig) validate(i int) error {
+	field := fmt.Sprintf("warehouse.destinations[%d]", i)
+	if c.Name == "" {
+		return fmt.Errorf("invalid %s.name: not set", field)
+	}
+	switch c.Type {
+	case WarehouseTypeBigQuery:
+		if c.BigQuery.Project == "" || c.BigQuery.Dataset == "" {
+			return fmt.Errorf("invalid %s.bigquery: project and dataset are required", field)
+		}
+	case WarehouseTypeSQL:
+		if c.SQL.DSN == "" {
+			return fmt.Errorf("invalid %s.sql.dsn: not set", field)
+		}
+	default:
+		return fmt.Errorf("invalid %s.type: %q is neither bigquery nor sql", field, c.Type)
+	}
+	for _, stream := range c.Streams {
+		if stream != WarehouseStreamAccess && stream != WarehouseStreamLinks {
+			return fmt.Errorf("invalid %s.streams: %q is neither access nor links", field, stream)
+		}
+	}
+
+	if c.AccessTable == "" {
+		c.AccessTable = defaultWarehouseAccessTable
+	}
+	if c.LinkTable == "" {
+		c.LinkTable = defaultWarehouseLinkTable
+	}
+	if c.FlushInterval == 0 {
+		c.FlushInterval = defaultWarehouseFlushInterval
+	}
+	if c.BatchSize == 0 {
+		c.BatchSize = defaultWarehouseBatchSize
+	}
+	if c.BufferSize == 0 {
+		c.BufferSize = max(defaultWarehouseBufferSize, c.BatchSize)
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultWarehouseTimeout
+	}
+
+	for name, table := range map[string]string{"access_table": c.AccessTable, "link_table": c.LinkTable} {
+		if !warehouseTable.MatchString(table) {
+			return fmt.Errorf("invalid %s.%s: %q is not a valid table name", field, name, table)
+		}
+	}
+	if c.FlushInterval < 0 {
+		return fmt.Errorf("invalid %s.flush_interval: %s is negative", field, c.FlushInterval)
+	}
+	if c.BatchSize < 1 {
+		return fmt.Errorf("invalid %s.batch_size: %d is less than 1", field, c.BatchSize)
+	}
+	if c.BufferSize < c.BatchSize {
+		return fmt.Errorf("invalid %s.buffer_size: %d is less than batch_size", field, c.BufferSize)
+	}
+	return nil
+}
+
+// validate checks that events can be written to the bucket and buffered
+func (c *ArchiveConfig) validate() error {
+	if c.Bucket == "" {
+		return errors.New("invalid analytics.archive.bucket: not set")
+	}
+	if c.Region == "" {
+		return errors.New("invalid analytics.archive.region: not set")
+	}
+	if c.FlushInterval <= 0 {
+		return fmt.Errorf("invalid analytics.archive.flush_interval: %s is not positive", c.FlushInterval)
+	}
+	if c.BatchSize < 1 {
+		return fmt.Errorf("invalid analytics.archive.batch_size: %d is less than 1", c.BatchSize)
+	}
+	if c.BufferSize < c.BatchSize {
+		return fmt.Errorf("invalid analytics.archive.buffer_size: %d is less than batch_size", c.BufferSize)
+	}
+	return nil
+}
+
+// validate checks that drains are reloaded and flushed, and their batches fit their buffers
+func (c *DrainsConfig) validate() error {
+	if c.Key == "" {
+		return errors.New("invalid analytics.drains.key: not set")
+	}
+	if c.RefreshInterval <= 0 {
+		return fmt.Errorf("invalid analytics.drains.refresh_interval: %s is not positive", c.RefreshInterval)
+	}
+	if c.FlushInterval <= 0 {
+		return fmt.Errorf("invalid analytics.drains.flush_interval: %s is not positive", c.FlushInterval)
+	}
+	if c.BatchSize < 1 {
+		return fmt.Errorf("invalid analytics.drains.batch_size: %d is less than 1", c.BatchSize)
+	}
+	if c.BufferSize < c.BatchSize {
+		return fmt.Errorf("invalid analytics.drains.buffer_size: %d is less than batch_size", c.BufferSize)
+	}
+	if c.Attempts < 1 {
+		return fmt.Errorf("invalid analytics.drains.attempts: %d is less than 1", c.Attempts)
+	}
+	if c.MaxPerScope < 1 {
+		return fmt.Errorf("invalid analytics.drains.max_per_scope: %d is less than 1", c.MaxPerScope)
+	}
+	return nil
+}
+
+// validate checks that claims are kept somewhere for a while and destinations checked in time
+func (c *ClaimsConfig) validate() error {
+	if c.Key == "" {
+		return errors.New("invalid claims.key: not set")
+	}
+	if c.TTL <= 0 {
+		return fmt.Errorf("invalid claims.ttl: %s is not positive", c.TTL)
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("invalid claims.timeout: %s is not positive", c.Timeout)
+	}
+	return nil
+}
+
+// validate checks that the thresholds are ordered scores and that domains are checked at all
+func (c *ReputationConfig) validate() error {
+	if c.Key == "" {
+		return errors.New("invalid reputation.key: not set")
+	}
+	if c.BlockBelow < 0 || c.InterstitialBelow > 101 || c.BlockBelow > c.InterstitialBelow {
+		return fmt.Errorf("invalid reputation.block_below: %d is not between 0 and interstitial_below (%d, at most 101)", c.BlockBelow, c.InterstitialBelow)
+	}
+	if c.RefreshInterval <= 0 {
+		return fmt.Errorf("invalid reputation.refresh_interval: %s is not positive", c.RefreshInterval)
+	}
+	if c.CheckInterval <= 0 {
+		return fmt.Errorf("invalid reputation.check_interval: %s is not positive", c.CheckInterval)
+	}
+	if c.CheckBatch < 1 {
+		return fmt.Errorf("invalid reputation.check_batch: %d is less than 1", c.CheckBatch)
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("invalid reputation.timeout: %s is not positive", c.Timeout)
+	}
+	if c.SafeBrowsing.APIKey != "" && c.SafeBrowsing.URL == "" {
+		return errors.New("invalid reputation.safe_browsing.url: not set")
+	}
+	return nil
+}
+
+// validate checks that the counter is kept somewhere and that obfuscated codes are keyed by a
+// secret long enough not to be guessed
+func (c *SequenceConfig) validate() error {
+	if c.Key == "" {
+		return errors.New("invalid shortcode.sequence.key: not set")
+	}
+	switch c.Obfuscation {
+	case ObfuscationNone:
+	case ObfuscationFeistel:
+		if len(c.Secret) < minHMACSecretLength {
+			return fmt.Errorf("invalid shortcode.sequence.secret: shorter than %d characters", minHMACSecretLength)
+		}
+	default:
+		return fmt.Errorf("invalid shortcode.sequence.obfuscation: %q is not none or feistel", c.Obfuscation)
+	}
+	return nil
+}
+
+// validate checks that requests are let through at some rate, and queued for a while in the queue
+// mode
+func (c *RateLimitConfig) validate() error {
+	if c.Rate <= 0 {
+		return fmt.Errorf("invalid rate_limit.rate: %g is not positive", c.Rate)
+	}
+	if c.Burst < 1 {
+		return fmt.Errorf("invalid rate_limit.burst: %d is less than 1", c.Burst)
+	}
+	switch c.Mode {
+	case RateLimitModeReject:
+	case RateLimitModeQueue:
+		if c.QueueSize < 1 {
+			return fmt.Errorf("invalid rate_limit.queue_size: %d is less than 1", c.QueueSize)
+		}
+		if c.QueueTimeout <= 0 {
+			return fmt.Errorf("invalid rate_limit.queue_timeout: %s is not positive", c.QueueTimeout)
+		}
+	default:
+		return fmt.Errorf("invalid rate_limit.mode: %q is not reject or queue", c.Mode)
+	}
+	return nil
+}
+
+// validate checks that the visitor strategy is known and has what it reads visitor IDs from
+func (c *VisitorConfig) validate() error {
+	switch c.Strategy {
+	case "", VisitorStrategyIP, VisitorStrategyIPUserAgent:
+	case VisitorStrategyCookie:
+		if c.Cookie.Name == "" {
+			return errors.New("invalid analytics.visitor.cookie.name: not set")
+		}
+		if c.Cookie.MaxAge <= 0 {
+			return fmt.Errorf("invalid analytics.visitor.cookie.max_age: %s is not positive", c.Cookie.MaxAge)
+		}
+	case VisitorStrategyHeader:
+		if c.Header == "" {
+			return errors.New("invalid analytics.visitor.header: not set")
+		}
+	default:
+		return fmt.Errorf("invalid analytics.visitor.strategy: %q is not ip, ip_ua, cookie or header", c.Strategy)
+	}
+	return nil
+}
+
+// validate checks the levels, format and sampling of logs
+func (c *LogConfig) validate() error {
+	if _, err := zerolog.ParseLevel(c.Level); err != nil {
+		return fmt.Errorf("invalid log.level: %w", err)
+	}
+	for module, level := range c.Modules {
+		if _, err := zerolog.ParseLevel(level); err != nil || level == "" {
+			return fmt.Errorf("invalid log.modules.%s: unknown level %q", module, level)
+		}
+	}
+	switch c.Format {
+	case "", LogFormatConsole, LogFormatJSON:
+	default:
+		return fmt.Errorf("invalid log.format: %q is not console or json", c.Format)
+	}
+	if c.File.Path != "" && c.File.MaxSize < 1 {
+		return fmt.Errorf("invalid log.file.max_size: %d is less than 1", c.File.MaxSize)
+	}
+	if c.Sampling.Enabled {
+		if c.Sampling.Period <= 0 {
+			return fmt.Errorf("invalid log.sampling.period: %s is not positive", c.Sampling.Period)
+		}
+		if c.Sampling.Thereafter < 1 {
+			return errors.New("invalid log.sampling.thereafter: not set")
+		}
+	}
+	for name, threshold := range map[string]time.Duration{"mysql": c.Slow.MySQL, "redis": c.Slow.Redis, "http": c.Slow.HTTP} {
+		if threshold < 0 {
+			return fmt.Errorf("invalid log.slow.%s: %s is negative", name, threshold)
+		}
+	}
+	return nil
+}
+
+// validate checks that purges can be delivered to the configured provider
+func (c *EdgePurgeConfig) validate() error {
+	switch c.Provider {
+	case PurgeProviderCloudflare:
+		if c.Cloudflare.ZoneID == "" || c.Cloudflare.APIToken == "" {
+			return errors.New("invalid edge.purge.cloudflare: zone_id and api_token are required")
+		}
+	case PurgeProviderFastly:
+		if c.Fastly.APIKey == "" {
+			return errors.New("invalid edge.purge.fastly.api_key: not set")
+		}
+	default:
+		return fmt.Errorf("invalid edge.purge.provider: %q is neither cloudflare nor fastly", c.Provider)
+	}
+	if c.Attempts < 1 {
+		return fmt.Errorf("invalid edge.purge.attempts: %d is less than 1", c.Attempts)
+	}
+	if c.QueueSize < 1 {
+		return fmt.Errorf("invalid edge.purge.queue_size: %d is less than 1", c.QueueSize)
+	}
+	return nil
+}
+
+// Secrets maps the IDs of the edge keys to their secrets
+func (c *EdgeConfig) Secrets() map[string]string {
+	return hmacSecrets(c.Keys)
+}
+
+// apiVersionName matches the names of API versions
+var apiVersionName = regexp.MustCompile(`^v[1-9][0-9]*$`)
+
+// validate checks the deprecation schedule of the API versions
+func (c *APIConfig) validate() error {
+	for name, d := range c.Deprecations {
+		if !apiVersionName.MatchString(name) {
+			return fmt.Errorf("invalid api.deprecations.%s: not a version name such as v1", name)
+		}
+		deprecated, err := parseDeprecationTime(d.Deprecated)
+		if err != nil {
+			return fmt.Errorf("invalid api.deprecations.%s.deprecated: %q is not a date or RFC 3339 time", name, d.Deprecated)
+		}
+		sunset, err := parseDeprecationTime(d.Sunset)
+		if err != nil {
+			return fmt.Errorf("invalid api.deprecations.%s.sunset: %q is not a date or RFC 3339 time", name, d.Sunset)
+		}
+		if !deprecated.IsZero() && !sunset.IsZero() && !sunset.After(deprecated) {
+			return fmt.Errorf("invalid api.deprecations.%s.sunset: %s is not after the deprecation", name, d.Sunset)
+		}
+		if d.Link != "" {
+			if u, err := url.Parse(d.Link); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("invalid api.deprecations.%s.link: %q is not an http or https URL", name, d.Link)
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks the schedule and delivery of enabled reports
+func (c *ReportsConfig) validate(mail *MailConfig) error {
+	if c.Param == "" {
+		return errors.New("invalid reports.param: not set")
+	}
+	if _, ok := weekdays[strings.ToLower(c.Weekday)]; !ok {
+		return fmt.Errorf("invalid reports.weekday: %q is not a day of the week", c.Weekday)
+	}
+	if c.Hour < 0 || c.Hour > 23 {
+		return fmt.Errorf("invalid reports.hour: %d is not between 0 and 23", c.Hour)
+	}
+	if len(c.To) == 0 && c.Webhook.URL == "" {
+		return errors.New("invalid reports: neither reports.to nor reports.webhook.url is set")
+	}
+	if len(c.To) > 0 && !mail.Enabled() {
+		return errors.New("invalid reports.to: emails need mail.addr or mail.dry_run_dir")
+	}
+	return nil
+}
+
+// validate checks that reminders are looked for, sent and extend links at all
+func (c *RemindersConfig) validate() error {
+	if c.Key == "" {
+		return errors.New("invalid reminders.key: not set")
+	}
+	if c.Window <= 0 {
+		return fmt.Errorf("invalid reminders.window: %s is not positive", c.Window)
+	}
+	if c.CheckInterval <= 0 {
+		return fmt.Errorf("invalid reminders.check_interval: %s is not positive", c.CheckInterval)
+	}
+	if c.Batch <= 0 {
+		return fmt.Errorf("invalid reminders.batch: %d is not positive", c.Batch)
+	}
+	if c.ExtendBy <= 0 {
+		return fmt.Errorf("invalid reminders.extend_by: %s is not positive", c.ExtendBy)
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("invalid reminders.timeout: %s is not positive", c.Timeout)
+	}
+	return nil
 }
 
 // expandEnv expands environment variables in the string
@@ -0,0 +1,622 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantURL string
+		wantSMS string
+		wantErr string
+	}{
+		{
+			name:    "base URL",
+			cfg:     Config{Server: ServerConfig{BaseURL: "https://sho.rt"}},
+			wantURL: "https://sho.rt",
+		},
+		{
+			name:    "trailing slash and port",
+			cfg:     Config{Server: ServerConfig{BaseURL: "http://localhost:8080/"}},
+			wantURL: "http://localhost:8080",
+		},
+		{
+			name:    "missing base URL",
+			cfg:     Config{},
+			wantErr: "invalid server.base_url: not set",
+		},
+		{
+			name:    "no scheme",
+			cfg:     Config{Server: ServerConfig{BaseURL: "sho.rt"}},
+			wantErr: "invalid server.base_url",
+		},
+		{
+			name:    "path",
+			cfg:     Config{Server: ServerConfig{BaseURL: "https://example.com/s"}},
+			wantErr: "invalid server.base_url",
+		},
+		{
+			name:    "query",
+			cfg:     Config{Server: ServerConfig{BaseURL: "https://sho.rt?a=1"}},
+			wantErr: "invalid server.base_url",
+		},
+		{
+			name: "trusted proxies",
+			cfg: Config{Server: ServerConfig{
+				BaseURL:        "https://sho.rt",
+				TrustedProxies: []string{"10.0.0.1", "172.16.0.0/12", "::1"},
+			}},
+			wantURL: "https://sho.rt",
+		},
+		{
+			name:    "invalid trusted proxy",
+			cfg:     Config{Server: ServerConfig{BaseURL: "https://sho.rt", TrustedProxies: []string{"lb.internal"}}},
+			wantErr: `invalid server.trusted_proxies: "lb.internal" is not an IP or CIDR`,
+		},
+		{
+			name: "SMS domain overrides base URL",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				SMS:    SMSConfig{Enabled: true, Domain: "https://s.ms/"},
+			},
+			wantURL: "https://sho.rt",
+			wantSMS: "https://s.ms",
+		},
+		{
+			name: "SMS enabled without domain",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				SMS:    SMSConfig{Enabled: true},
+			},
+			wantErr: "invalid sms.domain: not set",
+		},
+		{
+			name: "SMS disabled without domain",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+			},
+			wantURL: "https://sho.rt",
+		},
+		{
+			name: "replication primary",
+			cfg: Config{
+				Server:      ServerConfig{BaseURL: "https://sho.rt"},
+				MQ:          MQConfig{LinkEvents: true},
+				Replication: ReplicationConfig{Role: ReplicationRolePrimary, Region: "eu-west"},
+			},
+			wantURL: "https://sho.rt",
+		},
+		{
+			name: "replication primary without link events",
+			cfg: Config{
+				Server:      ServerConfig{BaseURL: "https://sho.rt"},
+				Replication: ReplicationConfig{Role: ReplicationRolePrimary, Region: "eu-west"},
+			},
+			wantErr: "primary requires mq.link_events",
+		},
+		{
+			name: "replication without region",
+			cfg: Config{
+				Server:      ServerConfig{BaseURL: "https://sho.rt"},
+				Replication: ReplicationConfig{Role: ReplicationRoleReplica},
+			},
+			wantErr: "invalid replication.region: not set",
+		},
+		{
+			name: "unknown replication role",
+			cfg: Config{
+				Server:      ServerConfig{BaseURL: "https://sho.rt"},
+				Replication: ReplicationConfig{Role: "secondary", Region: "eu-west"},
+			},
+			wantErr: "invalid replication.role",
+		},
+		{
+			name: "redis shards",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Database: DatabaseConfig{RedisShards: RedisShardsConfig{Shards: []RedisShardConfig{
+					{Name: "a", Addr: "redis-a:6379"},
+					{Name: "b", Addr: "redis-b:6379"},
+				}}},
+			},
+			wantURL: "https://sho.rt",
+		},
+		{
+			name: "redis shard without name",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Database: DatabaseConfig{RedisShards: RedisShardsConfig{Shards: []RedisShardConfig{
+					{Addr: "redis-a:6379"},
+				}}},
+			},
+			wantErr: "invalid database.redis_shards.shards[0].name: not set",
+		},
+		{
+			name: "redis shard names used twice",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Database: DatabaseConfig{RedisShards: RedisShardsConfig{Shards: []RedisShardConfig{
+					{Name: "a", Addr: "redis-a:6379"},
+					{Name: "a", Addr: "redis-b:6379"},
+				}}},
+			},
+			wantErr: "invalid database.redis_shards.shards[1].name",
+		},
+		{
+			name: "redis shards shadowed without shards",
+			cfg: Config{
+				Server:   ServerConfig{BaseURL: "https://sho.rt"},
+				Database: DatabaseConfig{Shadow: ShadowConfig{RedisShards: true}},
+			},
+			wantErr: "invalid database.shadow.redis_shards",
+		},
+		{
+			name: "flag percentage out of range",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Flags:  FlagsConfig{Features: map[string]FlagConfig{"recycled_codes": {Enabled: true, Percentage: 120}}},
+			},
+			wantErr: "invalid flags.features.recycled_codes.percentage",
+		},
+		{
+			name: "reports without delivery",
+			cfg: Config{
+				Server:  ServerConfig{BaseURL: "https://sho.rt"},
+				Reports: ReportsConfig{Enabled: true, Param: "campaign", Weekday: "Monday", Hour: 8},
+			},
+			wantErr: "invalid reports: neither",
+		},
+		{
+			name: "reports on an unknown day",
+			cfg: Config{
+				Server:  ServerConfig{BaseURL: "https://sho.rt"},
+				Reports: ReportsConfig{Enabled: true, Param: "campaign", Weekday: "mon", Webhook: WebhookConfig{URL: "https://hooks.example.com"}},
+			},
+			wantErr: "invalid reports.weekday",
+		},
+		{
+			name: "reports emailed without mail server",
+			cfg: Config{
+				Server:  ServerConfig{BaseURL: "https://sho.rt"},
+				Reports: ReportsConfig{Enabled: true, Param: "campaign", Weekday: "friday", To: []string{"team@example.com"}},
+			},
+			wantErr: "invalid reports.to",
+		},
+		{
+			name: "claims without expiry",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Claims: ClaimsConfig{Enabled: true, Key: "octopus:claims", Timeout: 5 * time.Second},
+			},
+			wantErr: "invalid claims.ttl",
+		},
+		{
+			name: "reminders without claims",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Reminders: RemindersConfig{Enabled: true, Key: "octopus:reminders", Window: 72 * time.Hour,
+					CheckInterval: 10 * time.Minute, Batch: 500, ExtendBy: 720 * time.Hour, Timeout: 10 * time.Second},
+			},
+			wantErr: "invalid reminders",
+		},
+		{
+			name: "reminders without extension",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Claims: ClaimsConfig{Enabled: true, Key: "octopus:claims", TTL: time.Hour, Timeout: 5 * time.Second},
+				Reminders: RemindersConfig{Enabled: true, Key: "octopus:reminders", Window: 72 * time.Hour,
+					CheckInterval: 10 * time.Minute, Batch: 500, Timeout: 10 * time.Second},
+			},
+			wantErr: "invalid reminders.extend_by",
+		},
+		{
+			name: "reputation blocking above the interstitial",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Reputation: ReputationConfig{Enabled: true, Key: "octopus:reputation", InterstitialBelow: 30, BlockBelow: 60,
+					RefreshInterval: time.Minute, CheckInterval: time.Minute, CheckBatch: 50, Timeout: 5 * time.Second},
+			},
+			wantErr: "invalid reputation.block_below",
+		},
+		{
+			name: "sequence obfuscated without a secret",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				ShortCode: ShortCodeConfig{Generator: GeneratorSequence, Sequence: SequenceConfig{
+					Key: "octopus:shortcode:sequence", Obfuscation: ObfuscationFeistel, Secret: "short"}},
+			},
+			wantErr: "invalid shortcode.sequence.secret",
+		},
+		{
+			name: "sequence in order",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				ShortCode: ShortCodeConfig{Generator: GeneratorSequence, Sequence: SequenceConfig{
+					Key: "octopus:shortcode:sequence", Obfuscation: ObfuscationNone}},
+			},
+			wantURL: "https://sho.rt",
+		},
+		{
+			name: "rate limit queue without a timeout",
+			cfg: Config{
+				Server:    ServerConfig{BaseURL: "https://sho.rt"},
+				RateLimit: RateLimitConfig{Enabled: true, Rate: 10, Burst: 20, Mode: RateLimitModeQueue, QueueSize: 100},
+			},
+			wantErr: "invalid rate_limit.queue_timeout",
+		},
+		{
+			name: "unknown rate limit mode",
+			cfg: Config{
+				Server:    ServerConfig{BaseURL: "https://sho.rt"},
+				RateLimit: RateLimitConfig{Enabled: true, Rate: 10, Burst: 20, Mode: "drop"},
+			},
+			wantErr: "invalid rate_limit.mode",
+		},
+		{
+			name: "public stats over too many days",
+			cfg: Config{
+				Server:    ServerConfig{BaseURL: "https://sho.rt"},
+				Analytics: AnalyticsConfig{PublicStats: PublicStatsConfig{Enabled: true, Days: 400}},
+			},
+			wantErr: "invalid analytics.public_stats.days",
+		},
+		{
+			name: "redirect cache control",
+			cfg: Config{
+				Server:   ServerConfig{BaseURL: "https://sho.rt"},
+				Redirect: RedirectConfig{CacheControl: "public, max-age=300"},
+			},
+			wantURL: "https://sho.rt",
+		},
+		{
+			name: "invalid redirect cache control",
+			cfg: Config{
+				Server:   ServerConfig{BaseURL: "https://sho.rt"},
+				Redirect: RedirectConfig{CacheControl: "max-age=5m"},
+			},
+			wantErr: "invalid redirect.cache_control",
+		},
+		{
+			name: "unknown redirect timezone",
+			cfg: Config{
+				Server:   ServerConfig{BaseURL: "https://sho.rt"},
+				Redirect: RedirectConfig{Timezone: "Europe/Atlantis"},
+			},
+			wantErr: "invalid redirect.timezone",
+		},
+		{
+			name: "negative RocketMQ retries",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				RocketMQ: RocketMQConfig{
+					NameServer: "127.0.0.1:9876",
+					Topics: RocketMQTopicsConfig{
+						AccessLog:  RocketMQTopicConfig{SendTimeout: time.Second},
+						LinkEvents: RocketMQTopicConfig{SendTimeout: time.Second},
+						Alerts:     RocketMQTopicConfig{Retries: -1, SendTimeout: time.Second},
+					},
+				},
+			},
+			wantErr: "invalid rocketmq.topics.alerts.retries",
+		},
+		{
+			name: "edge keys being rotated",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Edge: EdgeConfig{Enabled: true, Header: "X-Edge-Token", MaxAge: time.Minute, Keys: []HMACKeyConfig{
+					{ID: "2026-10", Secret: strings.Repeat("n", 32)},
+					{ID: "2026-07", Secret: strings.Repeat("o", 32)},
+				}},
+			},
+			wantURL: "https://sho.rt",
+		},
+		{
+			name: "edge enabled without keys",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Edge:   EdgeConfig{Enabled: true, Header: "X-Edge-Token", MaxAge: time.Minute},
+			},
+			wantErr: "invalid edge.keys",
+		},
+		{
+			name: "edge key with a short secret",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Edge: EdgeConfig{Enabled: true, Header: "X-Edge-Token", MaxAge: time.Minute, Keys: []HMACKeyConfig{
+					{ID: "2026-10", Secret: "secret"},
+				}},
+			},
+			wantErr: "invalid edge.keys[0].secret",
+		},
+		{
+			name: "edge key used twice",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Edge: EdgeConfig{Enabled: true, Header: "X-Edge-Token", MaxAge: time.Minute, Keys: []HMACKeyConfig{
+					{ID: "2026-10", Secret: strings.Repeat("n", 32)},
+					{ID: "2026-10", Secret: strings.Repeat("o", 32)},
+				}},
+			},
+			wantErr: "invalid edge.keys[1].id",
+		},
+		{
+			name: "edge key with a separator",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Edge: EdgeConfig{Enabled: true, Header: "X-Edge-Token", MaxAge: time.Minute, Keys: []HMACKeyConfig{
+					{ID: "2026:10", Secret: strings.Repeat("n", 32)},
+				}},
+			},
+			wantErr: "invalid edge.keys[0].id",
+		},
+		{
+			name: "signing keys",
+			cfg: Config{
+				Server:  ServerConfig{BaseURL: "https://sho.rt"},
+				Signing: SigningConfig{Param: "sig", Keys: []HMACKeyConfig{{ID: "k2", Secret: strings.Repeat("s", 32)}}},
+			},
+			wantURL: "https://sho.rt",
+		},
+		{
+			name: "signing key with a short secret",
+			cfg: Config{
+				Server:  ServerConfig{BaseURL: "https://sho.rt"},
+				Signing: SigningConfig{Param: "sig", Keys: []HMACKeyConfig{{ID: "k2", Secret: "secret"}}},
+			},
+			wantErr: "invalid signing.keys[0].secret",
+		},
+		{
+			name: "edge purge through Fastly",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Edge: EdgeConfig{Purge: EdgePurgeConfig{
+					Provider: PurgeProviderFastly, Fastly: FastlyPurgeConfig{APIKey: "key"}, Attempts: 3, QueueSize: 100,
+				}},
+			},
+			wantURL: "https://sho.rt",
+		},
+		{
+			name: "edge purge through Cloudflare without zone",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Edge: EdgeConfig{Purge: EdgePurgeConfig{
+					Provider: PurgeProviderCloudflare, Cloudflare: CloudflarePurgeConfig{APIToken: "token"}, Attempts: 3, QueueSize: 100,
+				}},
+			},
+			wantErr: "invalid edge.purge.cloudflare",
+		},
+		{
+			name: "unknown edge purge provider",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Edge:   EdgeConfig{Purge: EdgePurgeConfig{Provider: "akamai"}},
+			},
+			wantErr: "invalid edge.purge.provider",
+		},
+		{
+			name: "access archive",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Analytics: AnalyticsConfig{Archive: ArchiveConfig{
+					Enabled: true, Bucket: "events", Region: "eu-west-1", FlushInterval: time.Minute, BatchSize: 100, BufferSize: 1000,
+				}},
+			},
+			wantURL: "https://sho.rt",
+		},
+		{
+			name: "access archive buffering less than a batch",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Analytics: AnalyticsConfig{Archive: ArchiveConfig{
+					Enabled: true, Bucket: "events", Region: "eu-west-1", FlushInterval: time.Minute, BatchSize: 100, BufferSize: 10,
+				}},
+			},
+			wantErr: "invalid analytics.archive.buffer_size",
+		},
+		{
+			name: "API version sunset before its deprecation",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				API: APIConfig{Deprecations: map[string]DeprecationConfig{
+					"v1": {Deprecated: "2027-01-01", Sunset: "2026-12-31T00:00:00Z"},
+				}},
+			},
+			wantErr: "invalid api.deprecations.v1.sunset",
+		},
+		{
+			name: "API deprecation of an invalid version name",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				API:    APIConfig{Deprecations: map[string]DeprecationConfig{"latest": {Deprecated: "2027-01-01"}}},
+			},
+			wantErr: "invalid api.deprecations.latest",
+		},
+		{
+			name: "log drains without attempts",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Analytics: AnalyticsConfig{Drains: DrainsConfig{
+					Enabled: true, Key: "octopus:drains", RefreshInterval: time.Second, FlushInterval: time.Second, BatchSize: 10, BufferSize: 100, MaxPerScope: 5,
+				}},
+			},
+			wantErr: "invalid analytics.drains.attempts",
+		},
+		{
+			name: "unknown visitor strategy",
+			cfg: Config{
+				Server:    ServerConfig{BaseURL: "https://sho.rt"},
+				Analytics: AnalyticsConfig{Visitor: VisitorConfig{Strategy: "fingerprint"}},
+			},
+			wantErr: "invalid analytics.visitor.strategy",
+		},
+		{
+			name: "header visitor strategy without header",
+			cfg: Config{
+				Server:    ServerConfig{BaseURL: "https://sho.rt"},
+				Analytics: AnalyticsConfig{Visitor: VisitorConfig{Strategy: VisitorStrategyHeader}},
+			},
+			wantErr: "invalid analytics.visitor.header",
+		},
+		{
+			name: "warehouse of unknown type",
+			cfg: Config{
+				Server:    ServerConfig{BaseURL: "https://sho.rt"},
+				Warehouse: WarehouseConfig{Destinations: []WarehouseDestinationConfig{{Name: "dw", Type: "snowflake"}}},
+			},
+			wantErr: "invalid warehouse.destinations[0].type",
+		},
+		{
+			name: "warehouse destinations of the same name",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Warehouse: WarehouseConfig{Destinations: []WarehouseDestinationConfig{
+					{Name: "dw", Type: WarehouseTypeSQL, SQL: SQLWarehouseConfig{DSN: "root@tcp(tidb:4000)/analytics"}},
+					{Name: "dw", Type: WarehouseTypeBigQuery, BigQuery: BigQueryWarehouseConfig{Project: "proj", Dataset: "links"}},
+				}},
+			},
+			wantErr: "invalid warehouse.destinations[1].name",
+		},
+		{
+			name: "warehouse table name",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Warehouse: WarehouseConfig{Destinations: []WarehouseDestinationConfig{
+					{Name: "dw", Type: WarehouseTypeSQL, SQL: SQLWarehouseConfig{DSN: "root@tcp(tidb:4000)/analytics"}, LinkTable: "links; DROP"},
+				}},
+			},
+			wantErr: "invalid warehouse.destinations[0].link_table",
+		},
+		{
+			name: "mail without sender",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Mail:   MailConfig{DryRunDir: "tmp/mail"},
+			},
+			wantErr: "invalid mail.from",
+		},
+		{
+			name: "log module level",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Log:    LogConfig{Modules: map[string]string{"repository": "loud"}},
+			},
+			wantErr: `invalid log.modules.repository: unknown level "loud"`,
+		},
+		{
+			name: "log format",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Log:    LogConfig{Format: "xml"},
+			},
+			wantErr: "invalid log.format",
+		},
+		{
+			name: "log sampling",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Log:    LogConfig{Sampling: LogSamplingConfig{Enabled: true, Period: time.Second}},
+			},
+			wantErr: "invalid log.sampling.thereafter",
+		},
+		{
+			name: "slow log threshold",
+			cfg: Config{
+				Server: ServerConfig{BaseURL: "https://sho.rt"},
+				Log:    LogConfig{Slow: SlowLogConfig{Redis: -time.Millisecond}},
+			},
+			wantErr: "invalid log.slow.redis",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantURL, tt.cfg.Server.BaseURL)
+			assert.Equal(t, tt.wantSMS, tt.cfg.SMS.Domain)
+		})
+	}
+}
+
+func TestWarehouseDestinationConfig_Defaults(t *testing.T) {
+	cfg := Config{
+		Server: ServerConfig{BaseURL: "https://sho.rt"},
+		Warehouse: WarehouseConfig{Destinations: []WarehouseDestinationConfig{{
+			Name:     "bq",
+			Type:     WarehouseTypeBigQuery,
+			BigQuery: BigQueryWarehouseConfig{Project: "proj", Dataset: "links"},
+			Streams:  []string{WarehouseStreamLinks},
+		}}},
+	}
+	require.NoError(t, cfg.Validate())
+
+	dest := cfg.Warehouse.Destinations[0]
+	assert.Equal(t, "access_events", dest.AccessTable)
+	assert.Equal(t, "link_events", dest.LinkTable)
+	assert.Equal(t, 10*time.Second, dest.FlushInterval)
+	assert.Equal(t, 500, dest.BatchSize)
+	assert.Equal(t, 100000, dest.BufferSize)
+	assert.True(t, dest.Receives(WarehouseStreamLinks))
+	assert.False(t, dest.Receives(WarehouseStreamAccess))
+	assert.True(t, (&WarehouseDestinationConfig{}).Receives(WarehouseStreamAccess))
+}
+
+func TestLoadSources(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+server:
+  port: 8080
+  mode: debug
+  base_url: "http://localhost:8080"
+database:
+  redis:
+    addr: "localhost:6379"
+    db: 0
+`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.prod.yaml"), []byte(`
+server:
+  mode: release
+  base_url: "https://sho.rt"
+database:
+  redis:
+    addr: "redis:6379"
+`), 0o600))
+
+	// Every layer overrides the ones before it
+	t.Setenv("OCTOPUS_DATABASE_REDIS_ADDR", "redis-env:6379")
+	t.Setenv("OCTOPUS_SERVER_BASE_URL", "https://env.sho.rt")
+	cfg, err := LoadSources(&Sources{Path: path, Profile: "prod", Overrides: []string{"server.base_url=https://flag.sho.rt/", "database.redis.db=2"}})
+	require.NoError(t, err)
+	assert.Equal(t, 8080, cfg.Server.Port)
+	assert.Equal(t, "release", cfg.Server.Mode)
+	assert.Equal(t, "redis-env:6379", cfg.Database.Redis.Addr)
+	assert.Equal(t, "https://flag.sho.rt", cfg.Server.BaseURL)
+	assert.Equal(t, 2, cfg.Database.Redis.DB)
+	// Defaults stay below all layers
+	assert.Equal(t, 10*time.Second, cfg.Server.Shutdown.HTTP)
+
+	_, err = LoadSources(&Sources{Path: path, Profile: "staging"})
+	assert.ErrorContains(t, err, "failed to read profile staging")
+
+	_, err = LoadSources(&Sources{Path: path, Overrides: []string{"server.port"}})
+	assert.ErrorContains(t, err, `invalid override "server.port": want key=value`)
+}
+
+func TestSources_ProfilePath(t *testing.T) {
+	assert.Equal(t, "configs/config.prod.yaml", (&Sources{Path: "configs/config.yaml", Profile: "prod"}).ProfilePath())
+}
@@ -1,7 +1,8 @@
 package encoder
 
 import (
-	"strings"
+	"errors"
+	"unicode/utf8"
 
 	"octopus/pkg/util"
 )
@@ -13,14 +14,59 @@ const (
 	MinLength = 4
 	// MaxLength is the maximum short code length
 	MaxLength = 6
+
+	base32Bits = 5
+	base32Mask = 1<<base32Bits - 1
+	invalidIdx = 0xFF
 )
 
+// ErrInvalidAlphabet is returned for alphabets that are not 32 distinct URL-safe characters
+var ErrInvalidAlphabet = errors.New("alphabet must be 32 distinct ASCII letters or digits")
+
 // Base32Encoder encodes numbers to Base32 strings
-type Base32Encoder struct{}
+type Base32Encoder struct {
+	alphabet string
+	// decode maps every byte to its index in the alphabet; letters whose other
+	// case is not part of the alphabet are accepted case-insensitively, and
+	// bytes outside the alphabet map to invalidIdx
+	decode [256]byte
+}
 
-// NewBase32Encoder creates a new Base32Encoder
+// NewBase32Encoder creates a new Base32Encoder using Base32Alphabet
 func NewBase32Encoder() *Base32Encoder {
-	return &Base32Encoder{}
+	e, _ := NewBase32EncoderWithAlphabet(Base32Alphabet)
+	return e
+}
+
+// NewBase32EncoderWithAlphabet creates a new Base32Encoder using a custom alphabet
+func NewBase32EncoderWithAlphabet(alphabet string) (*Base32Encoder, error) {
+	if len(alphabet) != 1<<base32Bits {
+		return nil, ErrInvalidAlphabet
+	}
+
+	e := &Base32Encoder{alphabet: alphabet}
+	for i := range e.decode {
+		e.decode[i] = invalidIdx
+	}
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		if !isAlphanumeric(c) || e.decode[c] != invalidIdx {
+			return nil, ErrInvalidAlphabet
+		}
+		e.decode[c] = byte(i)
+	}
+	for i := 0; i < len(alphabet); i++ {
+		if other := swapCase(alphabet[i]); other != alphabet[i] && e.decode[other] == invalidIdx {
+			e.decode[other] = byte(i)
+		}
+	}
+
+	return e, nil
+}
+
+// Alphabet returns the character set used by the encoder
+func (e *Base32Encoder) Alphabet() string {
+	return e.alphabet
 }
 
 // Encode encodes a uint64 to a Base32 string of specified length
@@ -29,12 +75,12 @@ func (e *Base32Encoder) Encode(n uint64, length int) string {
 		length = MinLength
 	}
 
-	result := make([]byte, length)
-	alphabetLen := uint64(len(Base32Alphabet))
+	var buf [MaxLength]byte
+	result := buf[:length]
 
 	for i := length - 1; i >= 0; i-- {
-		result[i] = Base32Alphabet[n%alphabetLen]
-		n = n / alphabetLen
+		result[i] = e.alphabet[n&base32Mask]
+		n >>= base32Bits
 	}
 
 	return string(result)
@@ -48,24 +94,15 @@ func (e *Base32Encoder) EncodeString(s string, length int) string {
 
 // Decode decodes a Base32 string to uint64
 func (e *Base32Encoder) Decode(s string) (uint64, error) {
-	s = strings.ToUpper(s)
 	var result uint64
-	alphabetLen := uint64(len(Base32Alphabet))
-
-	for _, c := range s {
-		index := uint64(0)
-		found := false
-		for i := 0; i < len(Base32Alphabet); i++ {
-			if c == rune(Base32Alphabet[i]) {
-				index = uint64(i)
-				found = true
-				break
-			}
-		}
-		if !found {
+
+	for i := 0; i < len(s); i++ {
+		index := e.decode[s[i]]
+		if index == invalidIdx {
+			c, _ := utf8.DecodeRuneInString(s[i:])
 			return 0, &InvalidCharacterError{Char: c}
 		}
-		result = result*alphabetLen + index
+		result = result<<base32Bits | uint64(index)
 	}
 
 	return result, nil
@@ -77,16 +114,8 @@ func (e *Base32Encoder) IsValid(s string) bool {
 		return false
 	}
 
-	s = strings.ToUpper(s)
-	for _, c := range s {
-		valid := false
-		for i := 0; i < len(Base32Alphabet); i++ {
-			if c == rune(Base32Alphabet[i]) {
-				valid = true
-				break
-			}
-		}
-		if !valid {
+	for i := 0; i < len(s); i++ {
+		if e.decode[s[i]] == invalidIdx {
 			return false
 		}
 	}
@@ -96,7 +125,7 @@ func (e *Base32Encoder) IsValid(s string) bool {
 
 // MaxCapacity returns the maximum capacity for a given length
 func (e *Base32Encoder) MaxCapacity(length int) uint64 {
-	alphabetLen := uint64(len(Base32Alphabet))
+	alphabetLen := uint64(len(e.alphabet))
 	capacity := uint64(1)
 	for i := 0; i < length; i++ {
 		capacity *= alphabetLen
@@ -112,3 +141,17 @@ type InvalidCharacterError struct {
 func (e *InvalidCharacterError) Error() string {
 	return "invalid character: " + string(e.Char)
 }
+
+func isAlphanumeric(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9'
+}
+
+func swapCase(c byte) byte {
+	switch {
+	case c >= 'A' && c <= 'Z':
+		return c + 'a' - 'A'
+	case c >= 'a' && c <= 'z':
+		return c - ('a' - 'A')
+	}
+	return c
+}
@@ -1,6 +1,7 @@
 package encoder
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -309,6 +310,94 @@ func TestInvalidCharacterError(t *testing.T) {
 	assert.Equal(t, "invalid character: 1", err.Error())
 }
 
+func TestBase32Encoder_DecodeTable(t *testing.T) {
+	encoder := NewBase32Encoder()
+
+	for i := 0; i < len(Base32Alphabet); i++ {
+		c := Base32Alphabet[i]
+		assert.Equal(t, byte(i), encoder.decode[c], "char %q", c)
+		if c >= 'A' && c <= 'Z' {
+			assert.Equal(t, byte(i), encoder.decode[c+'a'-'A'], "char %q", c+'a'-'A')
+		}
+	}
+
+	valid := 0
+	for _, idx := range encoder.decode {
+		if idx != invalidIdx {
+			valid++
+		}
+	}
+	assert.Equal(t, len(Base32Alphabet)+26, valid)
+}
+
+func TestNewBase32EncoderWithAlphabet(t *testing.T) {
+	tests := []struct {
+		name     string
+		alphabet string
+		wantErr  bool
+	}{
+		{name: "default alphabet", alphabet: Base32Alphabet},
+		{name: "crockford style", alphabet: "0123456789ABCDEFGHJKMNPQRSTVWXYZ"},
+		{name: "mixed case", alphabet: "abcdefghijkmnpqrstuvwxyzABCDEFGH"},
+		{name: "too short", alphabet: "ABCDEFGH", wantErr: true},
+		{name: "too long", alphabet: Base32Alphabet + "8", wantErr: true},
+		{name: "duplicate character", alphabet: "AACDEFGHIJKLMNOPQRSTUVWXYZ234567", wantErr: true},
+		{name: "not url safe", alphabet: "ABCDEFGHIJKLMNOPQRSTUVWXYZ23456/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder, err := NewBase32EncoderWithAlphabet(tt.alphabet)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidAlphabet)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.alphabet, encoder.Alphabet())
+
+			for _, n := range []uint64{0, 1, 31, 32, 1000000} {
+				code := encoder.Encode(n, MaxLength)
+				assert.True(t, encoder.IsValid(code), code)
+				decoded, err := encoder.Decode(code)
+				require.NoError(t, err)
+				assert.Equal(t, n, decoded)
+			}
+		})
+	}
+}
+
+func TestBase32Encoder_CustomAlphabetCase(t *testing.T) {
+	// Both cases of "a" are distinct symbols, "B" also accepts "b"
+	encoder, err := NewBase32EncoderWithAlphabet("aABCDEFGHIJKLMNOPQRSTUVWXYZ23456")
+	require.NoError(t, err)
+
+	lower, err := encoder.Decode("aaaa")
+	require.NoError(t, err)
+	upper, err := encoder.Decode("AAAA")
+	require.NoError(t, err)
+	assert.NotEqual(t, lower, upper)
+
+	folded, err := encoder.Decode("bbbb")
+	require.NoError(t, err)
+	expected, err := encoder.Decode("BBBB")
+	require.NoError(t, err)
+	assert.Equal(t, expected, folded)
+
+	assert.False(t, encoder.IsValid("777A"))
+}
+
+func TestBase32Encoder_DecodeNonASCII(t *testing.T) {
+	encoder := NewBase32Encoder()
+
+	_, err := encoder.Decode("AAé")
+	require.Error(t, err)
+	var charErr *InvalidCharacterError
+	require.ErrorAs(t, err, &charErr)
+	assert.Equal(t, 'é', charErr.Char)
+
+	assert.False(t, encoder.IsValid("AAAé"))
+}
+
 func TestBase32Encoder_Concurrent(t *testing.T) {
 	encoder := NewBase32Encoder()
 	done := make(chan bool)
@@ -324,3 +413,42 @@ func TestBase32Encoder_Concurrent(t *testing.T) {
 		<-done
 	}
 }
+
+// benchSink keeps benchmark results alive so the compiler cannot drop the calls
+var benchSink interface{}
+
+func BenchmarkBase32Encoder_Encode(b *testing.B) {
+	encoder := NewBase32Encoder()
+	for _, length := range []int{MinLength, MaxLength} {
+		b.Run(fmt.Sprintf("length=%d", length), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				benchSink = encoder.Encode(uint64(i)*2654435761, length)
+			}
+		})
+	}
+}
+
+func BenchmarkBase32Encoder_Decode(b *testing.B) {
+	encoder := NewBase32Encoder()
+	for _, code := range []string{"ABCD", "ZZ7654", "abcdef"} {
+		b.Run(code, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				benchSink, _ = encoder.Decode(code)
+			}
+		})
+	}
+}
+
+func BenchmarkBase32Encoder_IsValid(b *testing.B) {
+	encoder := NewBase32Encoder()
+	for _, code := range []string{"ABCD", "ZZ7654", "favicon.ico"} {
+		b.Run(code, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				benchSink = encoder.IsValid(code)
+			}
+		})
+	}
+}
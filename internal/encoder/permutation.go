@@ -0,0 +1,104 @@
+package encoder
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// feistelRounds is the number of rounds of the Feistel network, enough for the halves of every
+// round function output to depend on every input bit several times over
+const feistelRounds = 8
+
+// Permutation reorders the numbers short codes of a length are encoded from, one to one, so that
+// codes numbered in sequence do not give away the codes numbered next
+type Permutation interface {
+	// Permute maps n, below the capacity of length, to the number its code is encoded from
+	Permute(n uint64, length int) uint64
+	// Invert maps a number permuted for length back to n
+	Invert(n uint64, length int) uint64
+}
+
+// Identity is the Permutation leaving numbers in order
+type Identity struct{}
+
+// Permute returns n
+func (Identity) Permute(n uint64, _ int) uint64 {
+	return n
+}
+
+// Invert returns n
+func (Identity) Invert(n uint64, _ int) uint64 {
+	return n
+}
+
+// Feistel is a Permutation keyed by a secret: a balanced Feistel network over the bits of the codes
+// of a length, rounded up to an even count, walking the cycle of numbers left out of the codes
+// until it lands back on one. Without the secret, the codes of consecutive numbers look random.
+type Feistel struct {
+	key []byte
+}
+
+// NewFeistel creates a Feistel permutation keyed by secret
+func NewFeistel(secret string) *Feistel {
+	return &Feistel{key: []byte(secret)}
+}
+
+// Permute maps n, below the capacity of length, to the number its code is encoded from
+func (f *Feistel) Permute(n uint64, length int) uint64 {
+	half, limit := feistelDomain(length)
+	for {
+		n = f.encrypt(n, half, length)
+		if n < limit {
+			return n
+		}
+	}
+}
+
+// Invert maps a number permuted for length back to n
+func (f *Feistel) Invert(n uint64, length int) uint64 {
+	half, limit := feistelDomain(length)
+	for {
+		n = f.decrypt(n, half, length)
+		if n < limit {
+			return n
+		}
+	}
+}
+
+// feistelDomain returns the bits of each half of the network for the codes of length, and the
+// number of these codes
+func feistelDomain(length int) (uint, uint64) {
+	bits := uint(length * base32Bits)
+	return (bits + 1) / 2, 1 << bits
+}
+
+func (f *Feistel) encrypt(n uint64, half uint, length int) uint64 {
+	mask := uint64(1)<<half - 1
+	left, right := n>>half, n&mask
+	for round := 0; round < feistelRounds; round++ {
+		left, right = right, left^f.round(round, length, right)&mask
+	}
+	return left<<half | right
+}
+
+func (f *Feistel) decrypt(n uint64, half uint, length int) uint64 {
+	mask := uint64(1)<<half - 1
+	left, right := n>>half, n&mask
+	for round := feistelRounds - 1; round >= 0; round-- {
+		left, right = right^f.round(round, length, left)&mask, left
+	}
+	return left<<half | right
+}
+
+// round is the round function, an HMAC of the round, the code length and the half
+func (f *Feistel) round(round, length int, half uint64) uint64 {
+	var msg [10]byte
+	msg[0] = byte(round)
+	msg[1] = byte(length)
+	binary.BigEndian.PutUint64(msg[2:], half)
+
+	mac := hmac.New(sha256.New, f.key)
+	mac.Write(msg[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
@@ -0,0 +1,41 @@
+package encoder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeistel_Bijection(t *testing.T) {
+	f := NewFeistel("0123456789abcdef0123456789abcdef")
+
+	// Numbers map back from the codes of their length, walking back into them from the numbers of
+	// the network left out, so no two numbers share a code
+	for _, length := range []int{4, 5, 6} {
+		capacity := NewBase32Encoder().MaxCapacity(length)
+		for n := uint64(0); n < capacity; n += capacity/5000 + 1 {
+			permuted := f.Permute(n, length)
+			if !assert.Less(t, permuted, capacity) || !assert.Equal(t, n, f.Invert(permuted, length)) {
+				return
+			}
+		}
+	}
+}
+
+func TestFeistel_Secret(t *testing.T) {
+	a := NewFeistel("0123456789abcdef0123456789abcdef")
+	b := NewFeistel("fedcba9876543210fedcba9876543210")
+	enc := NewBase32Encoder()
+
+	// Consecutive numbers are scattered, differently under each secret
+	codes := make(map[string]bool)
+	for n := uint64(0); n < 3; n++ {
+		codes[enc.Encode(a.Permute(n, 5), 5)] = true
+		assert.NotEqual(t, a.Permute(n, 5), b.Permute(n, 5))
+	}
+	assert.Len(t, codes, 3)
+	assert.NotEqual(t, enc.Encode(1, 5)[:4], enc.Encode(a.Permute(1, 5), 5)[:4])
+
+	assert.Equal(t, uint64(42), Identity{}.Permute(42, 5))
+	assert.Equal(t, uint64(42), Identity{}.Invert(42, 5))
+}
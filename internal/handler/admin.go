@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"octopus/internal/model"
+	"octopus/pkg/apiresp"
+	"octopus/pkg/async"
+	"octopus/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// recentGCPauses is the number of most recent GC pauses reported by the metrics endpoint
+const recentGCPauses = 16
+
+// AdminHandler serves operational endpoints on the admin port
+type AdminHandler struct {
+	requests    *middleware.RequestCounter
+	build       *model.BuildInfo
+	deadLetter  func(ctx context.Context) (int64, error)
+	buffer      func() *model.ProducerBufferStats
+	replication func() *model.ReplicationStats
+	redisShards func() []model.RedisShardStats
+	shadow      func() []model.ShadowStats
+	edgePurge   func() *model.EdgePurgeStats
+	archive     func() *model.AccessArchiveStats
+	warehouse   func() []model.WarehouseStats
+	logDrains   func() *model.LogDrainStats
+	slow        func() []model.SlowStats
+	rateLimit   func() *model.RateLimitStats
+	started     time.Time
+}
+
+// NewAdminHandler creates a new AdminHandler
+func NewAdminHandler(requests *middleware.RequestCounter) *AdminHandler {
+	return &AdminHandler{
+		requests: requests,
+		started:  time.Now(),
+	}
+}
+
+// SetBuildInfo reports the build of the running binary in the metrics
+func (h *AdminHandler) SetBuildInfo(info *model.BuildInfo) {
+	h.build = info
+}
+
+// SetDeadLetterDepth reports the depth of the dead-letter queue in the metrics
+func (h *AdminHandler) SetDeadLetterDepth(depth func(ctx context.Context) (int64, error)) {
+	h.deadLetter = depth
+}
+
+// SetProducerBuffer reports the state of the MQ producer buffer in the metrics
+func (h *AdminHandler) SetProducerBuffer(stats func() *model.ProducerBufferStats) {
+	h.buffer = stats
+}
+
+// SetReplication reports the replication lag of a replica in the metrics
+func (h *AdminHandler) SetReplication(stats func() *model.ReplicationStats) {
+	h.replication = stats
+}
+
+// SetRedisShards reports the health of the Redis shards in the metrics
+func (h *AdminHandler) SetRedisShards(stats func() []model.RedisShardStats) {
+	h.redisShards = stats
+}
+
+// SetShadow reports the writes mirrored and reads compared during a storage migration in the metrics
+func (h *AdminHandler) SetShadow(stats func() []model.ShadowStats) {
+	h.shadow = stats
+}
+
+// SetEdgePurge reports the purges of cached redirects delivered to the CDN in the metrics
+func (h *AdminHandler) SetEdgePurge(stats func() *model.EdgePurgeStats) {
+	h.edgePurge = stats
+}
+
+// SetAccessArchive reports the export of access events to object storage in the metrics
+func (h *AdminHandler) SetAccessArchive(stats func() *model.AccessArchiveStats) {
+	h.archive = stats
+}
+
+// SetWarehouse reports the events streamed to data warehouses in the metrics
+func (h *AdminHandler) SetWarehouse(stats func() []model.WarehouseStats) {
+	h.warehouse = stats
+}
+
+// SetLogDrains reports the access events forwarded to the log drains of link owners in the metrics
+func (h *AdminHandler) SetLogDrains(stats func() *model.LogDrainStats) {
+	h.logDrains = stats
+}
+
+// SetSlow reports the slow MySQL statements, Redis commands and HTTP requests in the metrics
+func (h *AdminHandler) SetSlow(stats func() []model.SlowStats) {
+	h.slow = stats
+}
+
+// SetRateLimit reports the generate requests queued and rejected by the rate limit in the metrics
+func (h *AdminHandler) SetRateLimit(stats func() *model.RateLimitStats) {
+	h.rateLimit = stats
+}
+
+// Metrics handles GET /metrics
+// @Summary Get runtime metrics
+// @ID getMetrics
+// @Description Returns build, goroutine, recovered panic, heap, GC, request load, MQ producer buffer, dead-letter queue, replication, Redis shard, storage migration, CDN purge, access archive, warehouse, log drain, slow call and rate limit metrics of the process
+// @Tags admin
+// @Produce json
+// @Success 200 {object} apiresp.Response{data=model.RuntimeMetrics}
+// @Router /metrics [get]
+func (h *AdminHandler) Metrics(c *gin.Context) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	metrics := &model.RuntimeMetrics{
+		BuildInfo:       h.build,
+		UptimeSeconds:   int64(time.Since(h.started).Seconds()),
+		Goroutines:      runtime.NumGoroutine(),
+		HeapAllocBytes:  mem.HeapAlloc,
+		HeapInuseBytes:  mem.HeapInuse,
+		HeapObjects:     mem.HeapObjects,
+		SysBytes:        mem.Sys,
+		NumGC:           mem.NumGC,
+		GCPauseTotalNs:  mem.PauseTotalNs,
+		GCPauseRecentNs: recentPauses(&mem, recentGCPauses),
+		GoroutinePanics: async.Panics(),
+	}
+	if h.requests != nil {
+		metrics.RequestsTotal = h.requests.Total()
+		metrics.RequestsInFlight = h.requests.InFlight()
+	}
+	if h.deadLetter != nil {
+		depth, err := h.deadLetter(c.Request.Context())
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to get dead-letter depth")
+		} else {
+			metrics.DeadLetterDepth = &depth
+		}
+	}
+	if h.buffer != nil {
+		metrics.ProducerBuffer = h.buffer()
+	}
+	if h.replication != nil {
+		metrics.Replication = h.replication()
+	}
+	if h.redisShards != nil {
+		metrics.RedisShards = h.redisShards()
+	}
+
+	if h.shadow != nil {
+		metrics.Shadow = h.shadow()
+	}
+	if h.edgePurge != nil {
+		metrics.EdgePurge = h.edgePurge()
+	}
+	if h.archive != nil {
+		metrics.AccessArchive = h.archive()
+	}
+	if h.warehouse != nil {
+		metrics.Warehouse = h.warehouse()
+	}
+	if h.logDrains != nil {
+		metrics.LogDrains = h.logDrains()
+	}
+	if h.slow != nil {
+		metrics.Slow = h.slow()
+	}
+	if h.rateLimit != nil {
+		metrics.RateLimit = h.rateLimit()
+	}
+
+	apiresp.OK(c, metrics)
+}
+
+// recentPauses returns up to n of the latest GC pause durations, newest first
+func recentPauses(mem *runtime.MemStats, n int) []uint64 {
+	if uint32(n) > mem.NumGC {
+		n = int(mem.NumGC)
+	}
+	if n > len(mem.PauseNs) {
+		n = len(mem.PauseNs)
+	}
+
+	pauses := make([]uint64, 0, n)
+	for i := 0; i < n; i++ {
+		// PauseNs is a circular buffer, the latest pause is at (NumGC+255)%256
+		idx := (int(mem.NumGC) - 1 - i + len(mem.PauseNs)) % len(mem.PauseNs)
+		pauses = append(pauses, mem.PauseNs[idx])
+	}
+	return pauses
+}
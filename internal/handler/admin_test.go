@@ -0,0 +1,311 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"octopus/internal/model"
+	"octopus/pkg/middleware"
+)
+
+func TestAdminHandler_Metrics(t *testing.T) {
+	counter := middleware.NewRequestCounter()
+	router := gin.New()
+	router.Use(counter.Middleware())
+	router.GET("/metrics", NewAdminHandler(counter).Metrics)
+
+	runtime.GC()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Data model.RuntimeMetrics `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Greater(t, resp.Data.Goroutines, 0)
+	assert.Greater(t, resp.Data.HeapAllocBytes, uint64(0))
+	assert.GreaterOrEqual(t, resp.Data.NumGC, uint32(1))
+	assert.NotEmpty(t, resp.Data.GCPauseRecentNs)
+	assert.Equal(t, int64(1), resp.Data.RequestsTotal)
+	assert.Equal(t, int64(1), resp.Data.RequestsInFlight)
+	assert.Nil(t, resp.Data.DeadLetterDepth)
+	assert.Nil(t, resp.Data.ProducerBuffer)
+	assert.Nil(t, resp.Data.Replication)
+}
+
+func TestAdminHandler_MetricsProducerBuffer(t *testing.T) {
+	h := NewAdminHandler(nil)
+	h.SetProducerBuffer(func() *model.ProducerBufferStats {
+		return &model.ProducerBufferStats{Buffered: 3, Sent: 10, Dropped: 2}
+	})
+	router := gin.New()
+	router.GET("/metrics", h.Metrics)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+
+	var resp struct {
+		Data model.RuntimeMetrics `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, &model.ProducerBufferStats{Buffered: 3, Sent: 10, Dropped: 2}, resp.Data.ProducerBuffer)
+}
+
+func TestAdminHandler_MetricsReplication(t *testing.T) {
+	h := NewAdminHandler(nil)
+	h.SetReplication(func() *model.ReplicationStats {
+		return &model.ReplicationStats{Region: "us-east", Applied: 7, Skipped: 1, LagSeconds: 0.25}
+	})
+	router := gin.New()
+	router.GET("/metrics", h.Metrics)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+
+	var resp struct {
+		Data model.RuntimeMetrics `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, &model.ReplicationStats{Region: "us-east", Applied: 7, Skipped: 1, LagSeconds: 0.25}, resp.Data.Replication)
+}
+
+func TestAdminHandler_MetricsRedisShards(t *testing.T) {
+	shards := []model.RedisShardStats{
+		{Name: "a", Addr: "redis-a:6379", Healthy: true},
+		{Name: "b", Addr: "redis-b:6379", Failures: 3, LastError: "storage unavailable: dial tcp: connection refused"},
+	}
+	h := NewAdminHandler(nil)
+	h.SetRedisShards(func() []model.RedisShardStats { return shards })
+	router := gin.New()
+	router.GET("/metrics", h.Metrics)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+
+	var resp struct {
+		Data model.RuntimeMetrics `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, shards, resp.Data.RedisShards)
+}
+
+func TestAdminHandler_MetricsShadow(t *testing.T) {
+	shadow := []model.ShadowStats{
+		{Storage: "mysql", Target: "database.shadow.mysql", Writes: 10, Reads: 4, Divergences: 1, LastDivergence: "get ABCD: title"},
+	}
+	h := NewAdminHandler(nil)
+	h.SetShadow(func() []model.ShadowStats { return shadow })
+	router := gin.New()
+	router.GET("/metrics", h.Metrics)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+
+	var resp struct {
+		Data model.RuntimeMetrics `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, shadow, resp.Data.Shadow)
+}
+
+func TestAdminHandler_MetricsEdgePurge(t *testing.T) {
+	stats := &model.EdgePurgeStats{
+		Provider: "fastly",
+		Purged:   3,
+		Failed:   1,
+		Recent: []model.PurgeDelivery{
+			{ShortCode: "ABCD", Status: model.PurgeStatusFailed, Attempts: 5, Error: "cdn: fastly responded 503", DeliveredAt: time.Unix(1700000000, 0).UTC()},
+		},
+	}
+	h := NewAdminHandler(nil)
+	h.SetEdgePurge(func() *model.EdgePurgeStats { return stats })
+	router := gin.New()
+	router.GET("/metrics", h.Metrics)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+
+	var resp struct {
+		Data model.RuntimeMetrics `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, stats, resp.Data.EdgePurge)
+}
+
+func TestAdminHandler_MetricsAccessArchive(t *testing.T) {
+	lastFlush := time.Unix(1700000000, 0).UTC()
+	stats := &model.AccessArchiveStats{Bucket: "events", Buffered: 2, Archived: 40, Objects: 3, LastFlush: &lastFlush}
+	h := NewAdminHandler(nil)
+	h.SetAccessArchive(func() *model.AccessArchiveStats { return stats })
+	router := gin.New()
+	router.GET("/metrics", h.Metrics)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+
+	var resp struct {
+		Data model.RuntimeMetrics `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, stats, resp.Data.AccessArchive)
+}
+
+func TestAdminHandler_MetricsWarehouse(t *testing.T) {
+	stats := []model.WarehouseStats{{Name: "bq", Type: "bigquery", Inserted: 120, Failed: 1, LastError: "warehouse: bigquery: backend error"}}
+	h := NewAdminHandler(nil)
+	h.SetWarehouse(func() []model.WarehouseStats { return stats })
+	router := gin.New()
+	router.GET("/metrics", h.Metrics)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+
+	var resp struct {
+		Data model.RuntimeMetrics `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, stats, resp.Data.Warehouse)
+}
+
+func TestAdminHandler_MetricsLogDrains(t *testing.T) {
+	stats := &model.LogDrainStats{Drains: 2, Buffered: 10, Delivered: 500, Failed: 1, Retries: 3, Dropped: 20}
+	h := NewAdminHandler(nil)
+	h.SetLogDrains(func() *model.LogDrainStats { return stats })
+	router := gin.New()
+	router.GET("/metrics", h.Metrics)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+
+	var resp struct {
+		Data model.RuntimeMetrics `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, stats, resp.Data.LogDrains)
+}
+
+func TestAdminHandler_MetricsSlow(t *testing.T) {
+	stats := []model.SlowStats{{Target: "mysql", ThresholdSeconds: 0.2, Slow: 3, LastOperation: "SELECT * FROM `short_links`"}}
+	h := NewAdminHandler(nil)
+	h.SetSlow(func() []model.SlowStats { return stats })
+	router := gin.New()
+	router.GET("/metrics", h.Metrics)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+
+	var resp struct {
+		Data model.RuntimeMetrics `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, stats, resp.Data.Slow)
+}
+
+func TestAdminHandler_MetricsRateLimit(t *testing.T) {
+	stats := &model.RateLimitStats{Mode: "queue", QueueSize: 100, QueueDepth: 4, Allowed: 120, Queued: 30, Rejected: 2, WaitSecondsTotal: 6, WaitSecondsMax: 0.8}
+	h := NewAdminHandler(nil)
+	h.SetRateLimit(func() *model.RateLimitStats { return stats })
+	router := gin.New()
+	router.GET("/metrics", h.Metrics)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+
+	var resp struct {
+		Data model.RuntimeMetrics `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, stats, resp.Data.RateLimit)
+}
+
+func TestAdminHandler_MetricsBuildInfo(t *testing.T) {
+	info := &model.BuildInfo{Version: "v1.4.0", Commit: "0c1d2e3f", BuildTime: "2026-10-16T09:00:00Z", GoVersion: "go1.26.0"}
+	h := NewAdminHandler(nil)
+	h.SetBuildInfo(info)
+	router := gin.New()
+	router.GET("/metrics", h.Metrics)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+
+	var resp struct {
+		Data model.RuntimeMetrics `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, info, resp.Data.BuildInfo)
+}
+
+func TestAdminHandler_MetricsDeadLetterDepth(t *testing.T) {
+	depth := int64(7)
+	tests := []struct {
+		name  string
+		depth func(ctx context.Context) (int64, error)
+		want  *int64
+	}{
+		{
+			name:  "reports depth",
+			depth: func(ctx context.Context) (int64, error) { return depth, nil },
+			want:  &depth,
+		},
+		{
+			name:  "omits depth on error",
+			depth: func(ctx context.Context) (int64, error) { return 0, errors.New("redis down") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAdminHandler(nil)
+			h.SetDeadLetterDepth(tt.depth)
+			router := gin.New()
+			router.GET("/metrics", h.Metrics)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/metrics", nil)
+			router.ServeHTTP(w, req)
+
+			var resp struct {
+				Data model.RuntimeMetrics `json:"data"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.want, resp.Data.DeadLetterDepth)
+		})
+	}
+}
+
+func TestRecentPauses(t *testing.T) {
+	var mem runtime.MemStats
+	mem.NumGC = 3
+	mem.PauseNs[0], mem.PauseNs[1], mem.PauseNs[2] = 10, 20, 30
+
+	assert.Equal(t, []uint64{30, 20, 10}, recentPauses(&mem, 16))
+	assert.Equal(t, []uint64{30, 20}, recentPauses(&mem, 2))
+
+	mem.NumGC = 257
+	mem.PauseNs[0] = 40
+	assert.Equal(t, []uint64{40, 0}, recentPauses(&mem, 2))
+}
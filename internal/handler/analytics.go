@@ -0,0 +1,385 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"octopus/internal/model"
+	"octopus/internal/service"
+	"octopus/pkg/apiresp"
+	"octopus/pkg/apiversion"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// AnalyticsHandler handles detailed analytics queries
+type AnalyticsHandler struct {
+	analyticsService service.AnalyticsServiceInterface
+	codeValidator    CodeValidator
+	claims           service.ClaimServiceInterface
+}
+
+// NewAnalyticsHandler creates a new AnalyticsHandler
+func NewAnalyticsHandler(analyticsService service.AnalyticsServiceInterface) *AnalyticsHandler {
+	return &AnalyticsHandler{analyticsService: analyticsService}
+}
+
+// SetCodeFormat rejects malformed short codes in request bodies before any storage access
+func (h *AnalyticsHandler) SetCodeFormat(validator CodeValidator) {
+	h.codeValidator = validator
+}
+
+// SetClaims restricts the aggregated analytics of links to their owners
+func (h *AnalyticsHandler) SetClaims(claims service.ClaimServiceInterface) {
+	h.claims = claims
+}
+
+// GetDecay handles GET /api/v1/analytics/:shortCode/decay
+// @Summary Get the click decay curve of a short link
+// @ID getDecay
+// @Description Returns the click distribution across the link's lifetime, computed from daily aggregates
+// @Tags analytics
+// @Param shortCode path string true "Short code"
+// @Success 200 {object} apiresp.Response{data=model.DecayResponse}
+// @Router /api/v1/analytics/{shortCode}/decay [get]
+func (h *AnalyticsHandler) GetDecay(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+	if notModified(c, h.analyticsService, shortCode) {
+		return
+	}
+
+	decay, err := h.analyticsService.GetDecay(c.Request.Context(), shortCode)
+	if err != nil {
+		if errors.Is(err, service.ErrShortLinkNotFound) {
+			apiresp.Fail(c, http.StatusNotFound, "Short link not found")
+			return
+		}
+		respondError(c, err, "Failed to get decay analytics")
+		return
+	}
+
+	apiresp.OK(c, decay)
+}
+
+// Aggregate handles POST /api/v1/analytics/aggregate
+// @Summary Get the combined analytics of several short links
+// @ID aggregateAnalytics
+// @Description Returns combined PV, estimated UV and top sources of up to 100 short links, listed or those of a campaign, plus each link's analytics
+// @Tags analytics
+// @Accept json
+// @Produce json
+// @Param request body model.AggregateRequest true "Short codes or campaign"
+// @Success 200 {object} apiresp.Response{data=model.AggregateResponse}
+// @Failure 400 {object} apiresp.ErrorResponse
+// @Router /api/v1/analytics/aggregate [post]
+func (h *AnalyticsHandler) Aggregate(c *gin.Context) {
+	var req model.AggregateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiresp.Fail(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	if (len(req.ShortCodes) == 0) == (req.Campaign == "") {
+		apiresp.Fail(c, http.StatusBadRequest, "Invalid request: "+service.ErrInvalidSelector.Error())
+		return
+	}
+
+	shortCodes := req.ShortCodes
+	if req.Campaign != "" {
+		// Campaigns only cover the caller's links in self-serve mode
+		var owner string
+		if h.claims != nil {
+			if owner = h.claims.Owner(c.Request.Context()); owner == "" {
+				respondClaimError(c, service.ErrClaimUnauthenticated, "Failed to authorize")
+				return
+			}
+		}
+		var err error
+		shortCodes, err = h.analyticsService.CampaignShortCodes(c.Request.Context(), req.Campaign, owner)
+		if err != nil {
+			if errors.Is(err, service.ErrTooManyLinks) {
+				apiresp.Fail(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+				return
+			}
+			respondError(c, err, "Failed to get campaign links")
+			return
+		}
+	} else {
+		if h.codeValidator != nil {
+			if errs := validateShortCodes(h.codeValidator, "short_codes", req.ShortCodes); len(errs) > 0 {
+				respondInvalid(c, errs)
+				return
+			}
+		}
+		if h.claims != nil {
+			for _, shortCode := range req.ShortCodes {
+				if err := h.claims.Authorize(c.Request.Context(), shortCode); err != nil {
+					respondClaimError(c, err, "Failed to authorize")
+					return
+				}
+			}
+		}
+	}
+
+	aggregate, err := h.analyticsService.AggregateAnalytics(c.Request.Context(), shortCodes)
+	if err != nil {
+		respondError(c, err, "Failed to aggregate analytics")
+		return
+	}
+
+	apiresp.OK(c, aggregate)
+}
+
+// maxCompareDays bounds the period of a comparison, older daily aggregates are rarely useful
+const maxCompareDays = 365
+
+// Compare handles GET /api/v1/analytics/:shortCode/compare
+// @Summary Compare a period with the previous one
+// @ID compareAnalytics
+// @Description Returns PV, UV and source changes between the last period and the one before it, computed from daily aggregates
+// @Tags analytics
+// @Produce json
+// @Param shortCode path string true "Short code"
+// @Param period query string false "Period length in days, e.g. 7d (default) or 30d"
+// @Success 200 {object} apiresp.Response{data=model.CompareResponse}
+// @Router /api/v1/analytics/{shortCode}/compare [get]
+func (h *AnalyticsHandler) Compare(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+	days, err := parseComparePeriod(c.DefaultQuery("period", "7d"))
+	if err != nil {
+		apiresp.Fail(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	if notModified(c, h.analyticsService, shortCode) {
+		return
+	}
+
+	compare, err := h.analyticsService.CompareAnalytics(c.Request.Context(), shortCode, days)
+	if err != nil {
+		if errors.Is(err, service.ErrShortLinkNotFound) {
+			apiresp.Fail(c, http.StatusNotFound, "Short link not found")
+			return
+		}
+		respondError(c, err, "Failed to compare analytics")
+		return
+	}
+
+	apiresp.OK(c, compare)
+}
+
+// parseComparePeriod parses a comparison period such as 7d into its number of days
+func parseComparePeriod(period string) (int, error) {
+	days, err := strconv.Atoi(strings.TrimSuffix(period, "d"))
+	if !strings.HasSuffix(period, "d") || err != nil || days < 1 || days > maxCompareDays {
+		return 0, fmt.Errorf("period must be between 1d and %dd", maxCompareDays)
+	}
+	return days, nil
+}
+
+// maxSourcesDailyDays bounds the days of a sources heatmap, a year of daily cells
+const maxSourcesDailyDays = 366
+
+// GetSourcesDaily handles GET /api/v1/analytics/:shortCode/sources/daily
+// @Summary Get the clicks per source and day of a short link
+// @ID getSourcesDaily
+// @Description Returns a source by day matrix of clicks over the last days, today included, computed from daily aggregates, for calendar heatmaps
+// @Tags analytics
+// @Produce json
+// @Param shortCode path string true "Short code"
+// @Param days query int false "Number of days, 30 by default, at most 366"
+// @Success 200 {object} apiresp.Response{data=model.SourcesDailyResponse}
+// @Router /api/v1/analytics/{shortCode}/sources/daily [get]
+func (h *AnalyticsHandler) GetSourcesDaily(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > maxSourcesDailyDays {
+		apiresp.Fail(c, http.StatusBadRequest, fmt.Sprintf("Invalid request: days must be between 1 and %d", maxSourcesDailyDays))
+		return
+	}
+	if notModified(c, h.analyticsService, shortCode) {
+		return
+	}
+
+	sources, err := h.analyticsService.GetSourcesDaily(c.Request.Context(), shortCode, days)
+	if err != nil {
+		if errors.Is(err, service.ErrShortLinkNotFound) {
+			apiresp.Fail(c, http.StatusNotFound, "Short link not found")
+			return
+		}
+		respondError(c, err, "Failed to get daily source analytics")
+		return
+	}
+
+	apiresp.OK(c, sources)
+}
+
+// GetRealtime handles GET /api/v1/analytics/:shortCode/realtime
+// @Summary Get the clicks per minute of a short link over the last hour
+// @ID getRealtime
+// @Description Returns the clicks of each of the last 60 minutes, oldest first, the current minute last, for "last hour" sparklines. Counts come from Redis and include the clicks the write-behind buffer has flushed.
+// @Tags analytics
+// @Produce json
+// @Param shortCode path string true "Short code"
+// @Success 200 {object} apiresp.Response{data=model.RealtimeResponse}
+// @Router /api/v1/analytics/{shortCode}/realtime [get]
+func (h *AnalyticsHandler) GetRealtime(c *gin.Context) {
+	realtime, err := h.analyticsService.GetRealtime(c.Request.Context(), c.Param("shortCode"))
+	if err != nil {
+		if errors.Is(err, service.ErrShortLinkNotFound) {
+			apiresp.Fail(c, http.StatusNotFound, "Short link not found")
+			return
+		}
+		respondError(c, err, "Failed to get real-time analytics")
+		return
+	}
+
+	apiresp.OK(c, realtime)
+}
+
+// GetLogs handles GET /api/v1/analytics/:shortCode/logs
+// @Summary List access logs of a short link
+// @ID listAccessLogs
+// @Description Returns access logs page by page, newest first unless order=asc
+// @Tags analytics
+// @Produce json
+// @Param shortCode path string true "Short code"
+// @Param from query string false "Start of the time range (RFC3339, inclusive)"
+// @Param to query string false "End of the time range (RFC3339, exclusive)"
+// @Param source query string false "Traffic source, e.g. google or direct"
+// @Param device query string false "Device type: desktop, mobile, tablet, bot or unknown"
+// @Param order query string false "Sort order by access time: desc (default) or asc"
+// @Param cursor query string false "Cursor from the previous page's next_cursor"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Success 200 {object} apiresp.Response{data=model.AccessLogPage}
+// @Router /api/v1/analytics/{shortCode}/logs [get]
+func (h *AnalyticsHandler) GetLogs(c *gin.Context) {
+	q, err := parseAccessLogQuery(c)
+	if err != nil {
+		apiresp.Fail(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	if notModified(c, h.analyticsService, q.ShortCode) {
+		return
+	}
+
+	page, err := h.analyticsService.GetAccessLogs(c.Request.Context(), q)
+	if err != nil {
+		respondError(c, err, "Failed to get access logs")
+		return
+	}
+
+	if apiversion.From(c).Cursors {
+		apiresp.OK(c, apiresp.NewPage(page.Logs, page.NextCursor))
+		return
+	}
+	apiresp.OK(c, page)
+}
+
+// parseAccessLogQuery builds an access log query from the request's query parameters
+func parseAccessLogQuery(c *gin.Context) (*model.AccessLogQuery, error) {
+	q := &model.AccessLogQuery{
+		ShortCode: c.Param("shortCode"),
+		Source:    c.Query("source"),
+		Device:    c.Query("device"),
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return nil, errors.New("from must be an RFC3339 time")
+		}
+		q.From = t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return nil, errors.New("to must be an RFC3339 time")
+		}
+		q.To = t
+	}
+
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		q.Ascending = true
+	case "desc":
+	default:
+		return nil, errors.New("order must be asc or desc")
+	}
+
+	page, err := apiresp.ParsePageQuery(c)
+	if err != nil {
+		return nil, err
+	}
+	if page.Cursor != "" {
+		if q.Cursor, err = model.ParseAccessLogCursor(page.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	q.Limit = page.Limit
+
+	return q, nil
+}
+
+// notModified sets the ETag and Last-Modified headers of an analytics response from
+// the link's stats update time, and answers 304 if the client's copy is still current
+func notModified(c *gin.Context, analyticsService service.AnalyticsServiceInterface, shortCode string) bool {
+	lastModified, err := analyticsService.GetLastModified(c.Request.Context(), shortCode)
+	if err != nil {
+		log.Warn().Err(err).Str("short_code", shortCode).Msg("Failed to get analytics last modified time")
+		return false
+	}
+	return notModifiedSince(c, lastModified)
+}
+
+// notModifiedSince sets the ETag and Last-Modified headers of an analytics response from the given
+// stats update time, and answers 304 if the client's copy is still current
+func notModifiedSince(c *gin.Context, lastModified time.Time) bool {
+	if lastModified.IsZero() {
+		return false
+	}
+
+	etag := analyticsETag(c.Request.URL.RequestURI(), lastModified)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+
+	// If-None-Match takes precedence over If-Modified-Since (RFC 9110)
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		if !etagMatches(match, etag) {
+			return false
+		}
+	} else if since := c.GetHeader("If-Modified-Since"); since != "" {
+		t, err := http.ParseTime(since)
+		if err != nil || lastModified.Truncate(time.Second).After(t) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+// analyticsETag derives a weak ETag from the request URI and the stats update time
+func analyticsETag(requestURI string, lastModified time.Time) string {
+	h := fnv.New64a()
+	h.Write([]byte(requestURI))
+	return fmt.Sprintf(`W/"%x-%x"`, h.Sum64(), lastModified.UnixNano())
+}
+
+// etagMatches checks an If-None-Match header against an ETag using weak comparison
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
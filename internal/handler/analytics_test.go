@@ -0,0 +1,476 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"octopus/internal/encoder"
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/service"
+)
+
+func newTestAnalyticsRouter(h *AnalyticsHandler) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.GET("/api/v1/analytics/:shortCode/decay", h.GetDecay)
+	router.GET("/api/v1/analytics/:shortCode/logs", h.GetLogs)
+	router.GET("/api/v1/analytics/:shortCode/compare", h.Compare)
+	router.GET("/api/v1/analytics/:shortCode/sources/daily", h.GetSourcesDaily)
+	router.GET("/api/v1/analytics/:shortCode/realtime", h.GetRealtime)
+	router.POST("/api/v1/analytics/aggregate", h.Aggregate)
+	return router
+}
+
+func TestAnalyticsHandler_GetDecay(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+	router := newTestAnalyticsRouter(NewAnalyticsHandler(mockAnalyticsService))
+	mockAnalyticsService.EXPECT().GetLastModified(gomock.Any(), gomock.Any()).Return(time.Time{}, nil).AnyTimes()
+
+	t.Run("get decay successfully", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().GetDecay(gomock.Any(), "ABCD").Return(&model.DecayResponse{
+			ShortCode:   "ABCD",
+			TotalClicks: 10,
+		}, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/ABCD/decay", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"total_clicks":10`)
+	})
+
+	t.Run("short link not found", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().GetDecay(gomock.Any(), "NONE").Return(nil, service.ErrShortLinkNotFound)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/NONE/decay", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().GetDecay(gomock.Any(), "ABCD").Return(nil, errors.New("db error"))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/ABCD/decay", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func TestAnalyticsHandler_Aggregate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+	router := newTestAnalyticsRouter(NewAnalyticsHandler(mockAnalyticsService))
+
+	t.Run("aggregate successfully", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().AggregateAnalytics(gomock.Any(), []string{"ABCD", "XYZ"}).Return(&model.AggregateResponse{
+			PV: 30,
+			UV: 12,
+			Links: []model.AnalyticsResponse{
+				{ShortCode: "ABCD", PV: 20},
+				{ShortCode: "XYZ", PV: 10},
+			},
+		}, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/analytics/aggregate", strings.NewReader(`{"short_codes":["ABCD","XYZ"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"uv":12`)
+		assert.Contains(t, w.Body.String(), `"short_code":"XYZ"`)
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		tooMany := `"A"` + strings.Repeat(`,"A"`, 100)
+		for _, body := range []string{`{}`, `{"short_codes":[]}`, `{"short_codes":[""]}`, `{"short_codes":[` + tooMany + `]}`, `not json`,
+			`{"short_codes":["ABCD"],"campaign":"spring"}`} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/analytics/aggregate", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		}
+	})
+
+	t.Run("campaign", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().CampaignShortCodes(gomock.Any(), "spring", "").Return([]string{"ABCD", "XYZ"}, nil)
+		mockAnalyticsService.EXPECT().AggregateAnalytics(gomock.Any(), []string{"ABCD", "XYZ"}).Return(&model.AggregateResponse{PV: 30}, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/analytics/aggregate", strings.NewReader(`{"campaign":"spring"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"pv":30`)
+	})
+
+	t.Run("campaign of too many links", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().CampaignShortCodes(gomock.Any(), "spring", "").Return(nil, service.ErrTooManyLinks)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/analytics/aggregate", strings.NewReader(`{"campaign":"spring"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("campaign of the caller in self-serve mode", func(t *testing.T) {
+		mockClaims := mocks.NewMockClaimServiceInterface(ctrl)
+		h := NewAnalyticsHandler(mockAnalyticsService)
+		h.SetClaims(mockClaims)
+
+		mockClaims.EXPECT().Owner(gomock.Any()).Return("")
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/analytics/aggregate", strings.NewReader(`{"campaign":"spring"}`))
+		req.Header.Set("Content-Type", "application/json")
+		newTestAnalyticsRouter(h).ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		mockClaims.EXPECT().Owner(gomock.Any()).Return("owner-1")
+		mockAnalyticsService.EXPECT().CampaignShortCodes(gomock.Any(), "spring", "owner-1").Return([]string{"ABCD"}, nil)
+		mockAnalyticsService.EXPECT().AggregateAnalytics(gomock.Any(), []string{"ABCD"}).Return(&model.AggregateResponse{}, nil)
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", "/api/v1/analytics/aggregate", strings.NewReader(`{"campaign":"spring"}`))
+		req.Header.Set("Content-Type", "application/json")
+		newTestAnalyticsRouter(h).ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("malformed short codes", func(t *testing.T) {
+		h := NewAnalyticsHandler(mockAnalyticsService)
+		h.SetCodeFormat(encoder.NewBase32Encoder())
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/analytics/aggregate", strings.NewReader(`{"short_codes":["ABCD","AB*","ABCD:2024-01-01"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		newTestAnalyticsRouter(h).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"short_codes[1]"`)
+		assert.Contains(t, w.Body.String(), `"field":"short_codes[2]"`)
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().AggregateAnalytics(gomock.Any(), []string{"ABCD"}).Return(nil, errors.New("redis error"))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/analytics/aggregate", strings.NewReader(`{"short_codes":["ABCD"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func TestAnalyticsHandler_Compare(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+	router := newTestAnalyticsRouter(NewAnalyticsHandler(mockAnalyticsService))
+	mockAnalyticsService.EXPECT().GetLastModified(gomock.Any(), gomock.Any()).Return(time.Time{}, nil).AnyTimes()
+
+	t.Run("defaults to 7 days", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().CompareAnalytics(gomock.Any(), "ABCD", 7).Return(&model.CompareResponse{
+			ShortCode: "ABCD",
+			Days:      7,
+			PV:        model.MetricChange{Current: 20, Previous: 10, Delta: 10},
+		}, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/ABCD/compare", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"days":7`)
+		assert.Contains(t, w.Body.String(), `"delta":10`)
+	})
+
+	t.Run("custom period", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().CompareAnalytics(gomock.Any(), "ABCD", 30).Return(&model.CompareResponse{ShortCode: "ABCD", Days: 30}, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/ABCD/compare?period=30d", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("invalid periods", func(t *testing.T) {
+		for _, period := range []string{"7", "7h", "0d", "-1d", "366d", "d"} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/analytics/ABCD/compare?period="+period, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, period)
+		}
+	})
+
+	t.Run("short link not found", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().CompareAnalytics(gomock.Any(), "NONE", 7).Return(nil, service.ErrShortLinkNotFound)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/NONE/compare", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().CompareAnalytics(gomock.Any(), "ABCD", 7).Return(nil, errors.New("db error"))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/ABCD/compare", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func TestAnalyticsHandler_GetSourcesDaily(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+	router := newTestAnalyticsRouter(NewAnalyticsHandler(mockAnalyticsService))
+	mockAnalyticsService.EXPECT().GetLastModified(gomock.Any(), gomock.Any()).Return(time.Time{}, nil).AnyTimes()
+
+	t.Run("defaults to 30 days", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().GetSourcesDaily(gomock.Any(), "ABCD", 30).Return(&model.SourcesDailyResponse{
+			ShortCode: "ABCD",
+			Days:      []string{"2026-10-15", "2026-10-16"},
+			Sources:   []model.SourceDailyClicks{{Source: "google", Total: 5, Clicks: []int64{2, 3}}},
+			Max:       3,
+		}, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/ABCD/sources/daily", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"clicks":[2,3]`)
+		assert.Contains(t, w.Body.String(), `"max":3`)
+	})
+
+	t.Run("custom days", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().GetSourcesDaily(gomock.Any(), "ABCD", 90).Return(&model.SourcesDailyResponse{ShortCode: "ABCD"}, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/ABCD/sources/daily?days=90", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("invalid days", func(t *testing.T) {
+		for _, days := range []string{"0", "-1", "367", "30d", "x"} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/analytics/ABCD/sources/daily?days="+days, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, days)
+		}
+	})
+
+	t.Run("short link not found", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().GetSourcesDaily(gomock.Any(), "NONE", 30).Return(nil, service.ErrShortLinkNotFound)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/NONE/sources/daily", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestAnalyticsHandler_GetRealtime(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+	router := newTestAnalyticsRouter(NewAnalyticsHandler(mockAnalyticsService))
+
+	t.Run("clicks of the last hour", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().GetRealtime(gomock.Any(), "ABCD").Return(&model.RealtimeResponse{
+			ShortCode: "ABCD",
+			From:      time.Date(2026, 10, 16, 11, 31, 0, 0, time.UTC),
+			Clicks:    []int64{2, 0, 3},
+			Total:     5,
+			Max:       3,
+		}, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/ABCD/realtime", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"clicks":[2,0,3]`)
+		assert.Contains(t, w.Body.String(), `"total":5`)
+	})
+
+	t.Run("short link not found", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().GetRealtime(gomock.Any(), "NONE").Return(nil, service.ErrShortLinkNotFound)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/NONE/realtime", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestAnalyticsHandler_GetLogs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+	router := newTestAnalyticsRouter(NewAnalyticsHandler(mockAnalyticsService))
+	mockAnalyticsService.EXPECT().GetLastModified(gomock.Any(), gomock.Any()).Return(time.Time{}, nil).AnyTimes()
+
+	t.Run("get logs with filters", func(t *testing.T) {
+		cursor := model.AccessLogCursor{AccessTime: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), ID: 42}
+		mockAnalyticsService.EXPECT().GetAccessLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, q *model.AccessLogQuery) (*model.AccessLogPage, error) {
+				assert.Equal(t, "ABCD", q.ShortCode)
+				assert.Equal(t, "google", q.Source)
+				assert.Equal(t, "mobile", q.Device)
+				assert.True(t, q.Ascending)
+				assert.Equal(t, 20, q.Limit)
+				assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), q.From)
+				assert.Equal(t, int64(42), q.Cursor.ID)
+				return &model.AccessLogPage{
+					Logs:       []model.AccessLog{{ID: 43, ShortCode: "ABCD"}},
+					NextCursor: "next",
+				}, nil
+			})
+
+		w := httptest.NewRecorder()
+		url := "/api/v1/analytics/ABCD/logs?source=google&device=mobile&order=asc&limit=20" +
+			"&from=2024-01-01T00:00:00Z&cursor=" + cursor.Encode()
+		req, _ := http.NewRequest("GET", url, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"next_cursor":"next"`)
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"from=yesterday", "to=1", "order=random", "limit=0", "limit=abc", "cursor=%21%21"} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/analytics/ABCD/logs?"+query, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().GetAccessLogs(gomock.Any(), gomock.Any()).Return(nil, errors.New("db error"))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/ABCD/logs", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+
+	t.Run("cursor page in v2", func(t *testing.T) {
+		versions := APIVersions()
+		v2 := gin.New()
+		v2.GET("/api/v2/analytics/:shortCode/logs", versions.Handler("v2"), NewAnalyticsHandler(mockAnalyticsService).GetLogs)
+		mockAnalyticsService.EXPECT().GetAccessLogs(gomock.Any(), gomock.Any()).Return(&model.AccessLogPage{
+			Logs:       []model.AccessLog{},
+			NextCursor: "next",
+		}, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v2/analytics/ABCD/logs", nil)
+		v2.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"items": [], "next_cursor": "next", "has_more": true}`, w.Body.String())
+	})
+}
+
+func TestAnalyticsHandler_ConditionalRequests(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	lastModified := time.Date(2024, 3, 1, 10, 0, 0, 500, time.UTC)
+	mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+	mockAnalyticsService.EXPECT().GetLastModified(gomock.Any(), "ABCD").Return(lastModified, nil).AnyTimes()
+	router := newTestAnalyticsRouter(NewAnalyticsHandler(mockAnalyticsService))
+
+	get := func(header, value string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/ABCD/decay", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	mockAnalyticsService.EXPECT().GetDecay(gomock.Any(), "ABCD").Return(&model.DecayResponse{ShortCode: "ABCD"}, nil).Times(3)
+
+	first := get("", "")
+	assert.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, "Fri, 01 Mar 2024 10:00:00 GMT", first.Header().Get("Last-Modified"))
+
+	t.Run("matching etag", func(t *testing.T) {
+		w := get("If-None-Match", etag)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+	})
+
+	t.Run("etag in list", func(t *testing.T) {
+		w := get("If-None-Match", `"other", `+etag)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+	})
+
+	t.Run("stale etag", func(t *testing.T) {
+		w := get("If-None-Match", `W/"stale"`)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("not modified since", func(t *testing.T) {
+		w := get("If-Modified-Since", "Fri, 01 Mar 2024 10:00:00 GMT")
+		assert.Equal(t, http.StatusNotModified, w.Code)
+	})
+
+	t.Run("modified since", func(t *testing.T) {
+		w := get("If-Modified-Since", "Fri, 01 Mar 2024 09:59:59 GMT")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("etag depends on query", func(t *testing.T) {
+		assert.NotEqual(t, analyticsETag("/api/v1/analytics/ABCD/logs?limit=10", lastModified),
+			analyticsETag("/api/v1/analytics/ABCD/logs?limit=20", lastModified))
+	})
+}
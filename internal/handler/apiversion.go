@@ -0,0 +1,13 @@
+package handler
+
+import "octopus/pkg/apiversion"
+
+// APIVersions returns the registry of the public API versions, oldest first. v1 wraps responses in
+// the code and message envelope and pages search results with offsets; v2 returns data as is,
+// reports errors as problem details and pages with cursors.
+func APIVersions() *apiversion.Registry {
+	return apiversion.NewRegistry(
+		&apiversion.Version{Name: "v1", Envelope: true, Successor: "v2"},
+		&apiversion.Version{Name: "v2", Cursors: true},
+	)
+}
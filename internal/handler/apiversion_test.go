@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/service"
+	"octopus/pkg/apiresp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestVersionedRouter serves the handlers under every API version, like the server
+func newTestVersionedRouter(links *ShortLinkHandler, drains *LogDrainHandler) *gin.Engine {
+	router := gin.New()
+	versions := APIVersions()
+	for _, version := range versions.Versions() {
+		api := router.Group("/api/"+version.Name, versions.Handler(version.Name))
+		api.GET("/shortlink/search", links.Search)
+		api.GET("/shortlink/:shortCode/resolve", links.Resolve)
+		api.PATCH("/shortlink/:shortCode", links.Update)
+		api.POST("/drains", drains.Create)
+		api.DELETE("/drains/:id", drains.Delete)
+	}
+	return router
+}
+
+func TestAPIVersions_Responses(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	mockDrains := mocks.NewMockLogDrainsInterface(ctrl)
+	router := newTestVersionedRouter(NewShortLinkHandler(mockService), NewLogDrainHandler(mockDrains))
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("data is not wrapped in v2", func(t *testing.T) {
+		resp := &model.ResolveResponse{ShortCode: "ABCD", OriginalURL: "https://example.com"}
+		mockService.EXPECT().Resolve(gomock.Any(), "ABCD").Return(resp, nil).Times(2)
+
+		w := serve("GET", "/api/v1/shortlink/ABCD/resolve", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"message":"success","data":{"short_link":""`)
+
+		w = serve("GET", "/api/v2/shortlink/ABCD/resolve", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var got model.ResolveResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		assert.Equal(t, *resp, got)
+	})
+
+	t.Run("errors are problem details in v2", func(t *testing.T) {
+		mockService.EXPECT().Resolve(gomock.Any(), "WXYZ").Return(nil, service.ErrShortLinkNotFound).Times(2)
+
+		w := serve("GET", "/api/v1/shortlink/WXYZ/resolve", "")
+		assert.JSONEq(t, `{"code": 404, "message": "Short link not found"}`, w.Body.String())
+
+		w = serve("GET", "/api/v2/shortlink/WXYZ/resolve", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, apiresp.ProblemContentType, w.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"type": "about:blank", "title": "Not Found", "status": 404,
+			"detail": "Short link not found", "instance": "/api/v2/shortlink/WXYZ/resolve"}`, w.Body.String())
+	})
+
+	t.Run("rejected fields are listed in problem details", func(t *testing.T) {
+		w := serve("POST", "/api/v2/drains", `{"short_code": "ABCD"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var problem struct {
+			Detail string               `json:"detail"`
+			Errors []apiresp.FieldError `json:"errors"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, "Invalid request: url is required", problem.Detail)
+		assert.Equal(t, []apiresp.FieldError{{Field: "url", Message: "is required"}}, problem.Errors)
+	})
+
+	t.Run("search is paged with cursors in v2", func(t *testing.T) {
+		page := &model.SearchResponse{Query: "sale", Links: []model.ResolveResponse{{ShortCode: "ABCD"}}, NextOffset: 40}
+		mockService.EXPECT().Search(gomock.Any(), &model.SearchQuery{Query: "sale", Limit: 20}).Return(page, nil)
+
+		w := serve("GET", "/api/v2/shortlink/search?q=sale&limit=20", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var got apiresp.Page
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		assert.NotEmpty(t, got.NextCursor)
+		assert.True(t, got.HasMore)
+		assert.Nil(t, got.Total)
+		assert.NotContains(t, w.Body.String(), "next_offset")
+
+		mockService.EXPECT().Search(gomock.Any(), &model.SearchQuery{Query: "sale", Offset: 40, Limit: 20}).
+			Return(&model.SearchResponse{Query: "sale", Links: []model.ResolveResponse{}}, nil)
+		w = serve("GET", "/api/v2/shortlink/search?q=sale&limit=20&cursor="+got.NextCursor, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"items": [], "has_more": false, "total": 40}`, w.Body.String())
+
+		w = serve("GET", "/api/v2/shortlink/search?q=sale&cursor=bm90LWFuLW9mZnNldA", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid cursor")
+	})
+
+	t.Run("deletes answer 204 in v2", func(t *testing.T) {
+		mockDrains.EXPECT().Delete(gomock.Any(), "d1").Return(true, nil).Times(2)
+
+		w := serve("DELETE", "/api/v1/drains/d1", "")
+		assert.JSONEq(t, `{"code": 0, "message": "success"}`, w.Body.String())
+
+		w = serve("DELETE", "/api/v2/drains/d1", "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, w.Body.String())
+	})
+}
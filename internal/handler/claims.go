@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"errors"
+
+	"octopus/internal/repository"
+	"octopus/internal/service"
+	"octopus/pkg/apiresp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClaimHandler serves the claims of links by the API keys proving control of their destination,
+// and restricts analytics to the owners of links
+type ClaimHandler struct {
+	claims service.ClaimServiceInterface
+}
+
+// NewClaimHandler creates a new ClaimHandler
+func NewClaimHandler(claims service.ClaimServiceInterface) *ClaimHandler {
+	return &ClaimHandler{claims: claims}
+}
+
+// Start handles POST /api/v1/shortlink/:shortCode/claim
+// @Summary Start claiming a short link
+// @ID startClaim
+// @Description Starts the claim of a link by the X-API-Key of the caller, returning a token to publish either as the TXT record dns_value at dns_name, or as meta_tag in the head of meta_url. Starting again returns the same token until it expires. Links claimed belong to the key, which then reads their analytics.
+// @Tags shortlink
+// @Produce json
+// @Param shortCode path string true "Short code"
+// @Param X-API-Key header string true "API key claiming the link"
+// @Success 200 {object} apiresp.Response{data=model.Claim}
+// @Failure 401 {object} apiresp.ErrorResponse
+// @Failure 404 {object} apiresp.ErrorResponse
+// @Failure 409 {object} apiresp.ErrorResponse
+// @Router /api/v1/shortlink/{shortCode}/claim [post]
+func (h *ClaimHandler) Start(c *gin.Context) {
+	claim, err := h.claims.Start(c.Request.Context(), c.Param("shortCode"))
+	if err != nil {
+		respondClaimError(c, err, "Failed to start claim")
+		return
+	}
+
+	apiresp.OK(c, claim)
+}
+
+// Verify handles POST /api/v1/shortlink/:shortCode/claim/verify
+// @Summary Verify the claim of a short link
+// @ID verifyClaim
+// @Description Looks for the token of the caller's claim in DNS, then in the meta tags of the destination's home page, and hands the link over to the X-API-Key of the caller once found. Links already owned by an API key cannot be claimed.
+// @Tags shortlink
+// @Produce json
+// @Param shortCode path string true "Short code"
+// @Param X-API-Key header string true "API key claiming the link"
+// @Success 200 {object} apiresp.Response{data=model.ClaimVerification}
+// @Failure 401 {object} apiresp.ErrorResponse
+// @Failure 404 {object} apiresp.ErrorResponse
+// @Failure 409 {object} apiresp.ErrorResponse
+// @Failure 422 {object} apiresp.ErrorResponse
+// @Router /api/v1/shortlink/{shortCode}/claim/verify [post]
+func (h *ClaimHandler) Verify(c *gin.Context) {
+	verification, err := h.claims.Verify(c.Request.Context(), c.Param("shortCode"))
+	if err != nil {
+		respondClaimError(c, err, "Failed to verify claim")
+		return
+	}
+
+	apiresp.OK(c, verification)
+}
+
+// Authorize is a middleware letting only the owner of the link of the path through
+func (h *ClaimHandler) Authorize(c *gin.Context) {
+	if err := h.claims.Authorize(c.Request.Context(), c.Param("shortCode")); err != nil {
+		respondClaimError(c, err, "Failed to authorize")
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// respondClaimError responds to a refused claim or analytics request with its reason, and to other
+// errors with their status
+func respondClaimError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrClaimUnauthenticated):
+		apiresp.Fail(c, errorStatus(err), "An X-API-Key header is required")
+	case errors.Is(err, service.ErrNotOwner):
+		apiresp.Fail(c, errorStatus(err), "Only the owner of the link may do this, claim it first")
+	case errors.Is(err, service.ErrShortLinkNotFound):
+		apiresp.Fail(c, errorStatus(err), "Short link not found")
+	case errors.Is(err, service.ErrClaimNotStarted), errors.Is(err, service.ErrClaimUnverified),
+		errors.Is(err, service.ErrInvalidURL), errors.Is(err, repository.ErrConflict):
+		apiresp.Fail(c, errorStatus(err), err.Error())
+	default:
+		respondError(c, err, message)
+	}
+}
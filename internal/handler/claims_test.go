@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/service"
+	"octopus/pkg/apiresp"
+)
+
+func newTestClaimRouter(h *ClaimHandler, analytics *AnalyticsHandler) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.POST("/shortlink/:shortCode/claim", h.Start)
+	router.POST("/shortlink/:shortCode/claim/verify", h.Verify)
+	router.GET("/analytics/:shortCode/realtime", h.Authorize, func(c *gin.Context) {
+		apiresp.OK(c, "realtime")
+	})
+	router.POST("/analytics/aggregate", analytics.Aggregate)
+	return router
+}
+
+func TestClaimHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClaims := mocks.NewMockClaimServiceInterface(ctrl)
+	mockAnalytics := mocks.NewMockAnalyticsServiceInterface(ctrl)
+	analytics := NewAnalyticsHandler(mockAnalytics)
+	analytics.SetClaims(mockClaims)
+	router := newTestClaimRouter(NewClaimHandler(mockClaims), analytics)
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("starts a claim", func(t *testing.T) {
+		mockClaims.EXPECT().Start(gomock.Any(), "abc123").Return(&model.Claim{
+			ShortCode: "abc123",
+			Domain:    "example.com",
+			DNSName:   "_octopus-claim.example.com",
+			DNSValue:  "octopus-claim=t0k",
+		}, nil)
+		mockClaims.EXPECT().Start(gomock.Any(), "abc123").Return(nil, service.ErrClaimUnauthenticated)
+		mockClaims.EXPECT().Start(gomock.Any(), "zzz999").Return(nil, service.ErrShortLinkNotFound)
+
+		w := serve("POST", "/shortlink/abc123/claim", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"dns_value":"octopus-claim=t0k"`)
+		assert.Equal(t, http.StatusUnauthorized, serve("POST", "/shortlink/abc123/claim", "").Code)
+		assert.Equal(t, http.StatusNotFound, serve("POST", "/shortlink/zzz999/claim", "").Code)
+	})
+
+	t.Run("verifies a claim", func(t *testing.T) {
+		mockClaims.EXPECT().Verify(gomock.Any(), "abc123").Return(nil, fmt.Errorf("%w: token found nowhere", service.ErrClaimUnverified))
+		mockClaims.EXPECT().Verify(gomock.Any(), "abc123").Return(nil, service.ErrClaimNotStarted)
+		mockClaims.EXPECT().Verify(gomock.Any(), "abc123").Return(&model.ClaimVerification{ShortCode: "abc123", Method: "dns"}, nil)
+
+		w := serve("POST", "/shortlink/abc123/claim/verify", "")
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "token found nowhere")
+		assert.Equal(t, http.StatusNotFound, serve("POST", "/shortlink/abc123/claim/verify", "").Code)
+		w = serve("POST", "/shortlink/abc123/claim/verify", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"method":"dns"`)
+	})
+
+	t.Run("restricts analytics to owners", func(t *testing.T) {
+		mockClaims.EXPECT().Authorize(gomock.Any(), "abc123").Return(service.ErrNotOwner)
+		mockClaims.EXPECT().Authorize(gomock.Any(), "abc123").Return(nil)
+
+		assert.Equal(t, http.StatusForbidden, serve("GET", "/analytics/abc123/realtime", "").Code)
+		assert.Equal(t, http.StatusOK, serve("GET", "/analytics/abc123/realtime", "").Code)
+	})
+
+	t.Run("restricts aggregates to owners of every link", func(t *testing.T) {
+		mockClaims.EXPECT().Authorize(gomock.Any(), "abc123").Return(nil)
+		mockClaims.EXPECT().Authorize(gomock.Any(), "def456").Return(service.ErrNotOwner)
+
+		w := serve("POST", "/analytics/aggregate", `{"short_codes":["abc123","def456"]}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
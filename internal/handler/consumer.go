@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+
+	"octopus/internal/mq"
+	"octopus/pkg/apiresp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// ConsumerHandler reports and restarts the access log consumer from the admin port
+type ConsumerHandler struct {
+	consumer mq.ConsumerInterface
+}
+
+// NewConsumerHandler creates a new ConsumerHandler
+func NewConsumerHandler(consumer mq.ConsumerInterface) *ConsumerHandler {
+	return &ConsumerHandler{consumer: consumer}
+}
+
+// Status handles GET /consumer
+// @Summary Get the state of the access log consumer
+// @ID getConsumer
+// @Description Returns whether the consumer is started, its topic, when it last received a message, the messages it processed and failed since the process started, and its lag when the broker reports it (Redis Streams, NATS and SQS)
+// @Tags admin
+// @Produce json
+// @Success 200 {object} apiresp.Response{data=model.ConsumerStatus}
+// @Router /consumer [get]
+func (h *ConsumerHandler) Status(c *gin.Context) {
+	apiresp.OK(c, h.consumer.Status(c.Request.Context()))
+}
+
+// Restart handles POST /consumer/restart
+// @Summary Restart the access log consumer
+// @ID restartConsumer
+// @Description Stops the consumer and subscribes again without restarting the process, also starting a consumer that failed to subscribe on startup. Messages being processed finish first.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} apiresp.Response{data=model.ConsumerStatus}
+// @Router /consumer/restart [post]
+func (h *ConsumerHandler) Restart(c *gin.Context) {
+	if err := h.consumer.Restart(); err != nil {
+		log.Error().Err(err).Msg("Failed to restart the MQ consumer")
+		apiresp.Fail(c, http.StatusInternalServerError, "Failed to restart the consumer: "+err.Error())
+		return
+	}
+
+	log.Info().Msg("MQ consumer restarted")
+	apiresp.OK(c, h.consumer.Status(c.Request.Context()))
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/mq"
+)
+
+func newTestConsumerRouter(h *ConsumerHandler) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.GET("/consumer", h.Status)
+	router.POST("/consumer/restart", h.Restart)
+	return router
+}
+
+func TestConsumerHandler_Status(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	consumer := mocks.NewMockConsumerInterface(ctrl)
+	lag := int64(3)
+	consumer.EXPECT().Status(gomock.Any()).Return(&model.ConsumerStatus{
+		Driver:    mq.DriverRedisStream,
+		Topic:     "octopus:access_log",
+		Status:    mq.ConsumerStarted,
+		Processed: 42,
+		Lag:       &lag,
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/consumer", nil)
+	newTestConsumerRouter(NewConsumerHandler(consumer)).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"started"`)
+	assert.Contains(t, w.Body.String(), `"processed":42`)
+	assert.Contains(t, w.Body.String(), `"lag":3`)
+}
+
+func TestConsumerHandler_Restart(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	consumer := mocks.NewMockConsumerInterface(ctrl)
+	router := newTestConsumerRouter(NewConsumerHandler(consumer))
+
+	t.Run("restarted", func(t *testing.T) {
+		consumer.EXPECT().Restart().Return(nil)
+		consumer.EXPECT().Status(gomock.Any()).Return(&model.ConsumerStatus{Status: mq.ConsumerStarted})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/consumer/restart", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"started"`)
+	})
+
+	t.Run("restart fails", func(t *testing.T) {
+		consumer.EXPECT().Restart().Return(errors.New("failed to create consumer group: connection refused"))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/consumer/restart", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), "connection refused")
+	})
+}
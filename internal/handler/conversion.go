@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"octopus/internal/model"
+	"octopus/internal/service"
+	"octopus/pkg/apiresp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConversionHandler handles conversion postbacks
+type ConversionHandler struct {
+	conversionService service.ConversionServiceInterface
+}
+
+// NewConversionHandler creates a new ConversionHandler
+func NewConversionHandler(conversionService service.ConversionServiceInterface) *ConversionHandler {
+	return &ConversionHandler{conversionService: conversionService}
+}
+
+// Convert handles POST /api/v1/conversions
+// @Summary Report a conversion
+// @ID recordConversion
+// @Description Attributes a conversion to the click ID appended to a redirect
+// @Tags analytics
+// @Accept json
+// @Produce json
+// @Param request body model.ConversionRequest true "Conversion postback"
+// @Success 200 {object} apiresp.Response{data=model.ConversionResponse}
+// @Router /api/v1/conversions [post]
+func (h *ConversionHandler) Convert(c *gin.Context) {
+	var req model.ConversionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiresp.Fail(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	resp, err := h.conversionService.Convert(c.Request.Context(), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrClickNotFound) {
+			apiresp.Fail(c, http.StatusNotFound, "Click not found")
+			return
+		}
+		respondError(c, err, "Failed to record conversion")
+		return
+	}
+
+	apiresp.OK(c, resp)
+}
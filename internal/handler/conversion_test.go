@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/service"
+)
+
+func TestConversionHandler_Convert(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConversionService := mocks.NewMockConversionServiceInterface(ctrl)
+	router := gin.New()
+	router.POST("/api/v1/conversions", NewConversionHandler(mockConversionService).Convert)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/conversions", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("record conversion successfully", func(t *testing.T) {
+		mockConversionService.EXPECT().Convert(gomock.Any(), &model.ConversionRequest{
+			ClickID: "c1d2",
+			Event:   "purchase",
+			Value:   9.99,
+		}).Return(&model.ConversionResponse{
+			ClickID:   "c1d2",
+			ShortCode: "ABCD",
+			Source:    "google",
+			Event:     "purchase",
+		}, nil)
+
+		w := post(`{"click_id":"c1d2","event":"purchase","value":9.99}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"short_code":"ABCD"`)
+	})
+
+	t.Run("missing click ID", func(t *testing.T) {
+		w := post(`{"event":"purchase"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("unknown click ID", func(t *testing.T) {
+		mockConversionService.EXPECT().Convert(gomock.Any(), gomock.Any()).Return(nil, service.ErrClickNotFound)
+
+		w := post(`{"click_id":"unknown"}`)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		mockConversionService.EXPECT().Convert(gomock.Any(), gomock.Any()).Return(nil, errors.New("db error"))
+
+		w := post(`{"click_id":"c1d2"}`)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"octopus/internal/model"
+	"octopus/internal/mq"
+	"octopus/pkg/apiresp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Page sizes of the dead-letter listing
+const (
+	defaultDeadLetterCount = 50
+	maxDeadLetterCount     = 500
+)
+
+// DeadLetterHandler serves dead-letter inspection and replay on the admin port
+type DeadLetterHandler struct {
+	dlq mq.DeadLetterQueueInterface
+}
+
+// NewDeadLetterHandler creates a new DeadLetterHandler
+func NewDeadLetterHandler(dlq mq.DeadLetterQueueInterface) *DeadLetterHandler {
+	return &DeadLetterHandler{dlq: dlq}
+}
+
+// List handles GET /dlq
+// @Summary List dead-lettered access log events
+// @ID listDeadLetters
+// @Description Returns dead letters oldest first, page by page
+// @Tags admin
+// @Produce json
+// @Param after query string false "Cursor from the previous page's next"
+// @Param count query int false "Page size (default 50, max 500)"
+// @Success 200 {object} apiresp.Response{data=model.DeadLetterPage}
+// @Router /dlq [get]
+func (h *DeadLetterHandler) List(c *gin.Context) {
+	count := int64(defaultDeadLetterCount)
+	if raw := c.Query("count"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 || n > maxDeadLetterCount {
+			apiresp.Fail(c, http.StatusBadRequest, "Invalid request: count must be between 1 and 500")
+			return
+		}
+		count = n
+	}
+
+	page, err := h.dlq.List(c.Request.Context(), c.Query("after"), count)
+	if err != nil {
+		apiresp.Fail(c, http.StatusInternalServerError, "Failed to list dead letters")
+		return
+	}
+
+	apiresp.OK(c, page)
+}
+
+// Replay handles POST /dlq/replay
+// @Summary Replay dead-lettered access log events
+// @ID replayDeadLetters
+// @Description Sends the selected dead letters, or the oldest 100 without a selection, back to the MQ
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body model.DeadLetterRequest false "Dead letter IDs"
+// @Success 200 {object} apiresp.Response{data=model.ReplayResponse}
+// @Router /dlq/replay [post]
+func (h *DeadLetterHandler) Replay(c *gin.Context) {
+	var req model.DeadLetterRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apiresp.Fail(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+			return
+		}
+	}
+
+	replayed, err := h.dlq.Replay(c.Request.Context(), req.IDs)
+	if errors.Is(err, mq.ErrReplayUnavailable) {
+		apiresp.Fail(c, http.StatusServiceUnavailable, "MQ producer is not configured")
+		return
+	}
+	if err != nil {
+		apiresp.Fail(c, http.StatusInternalServerError, "Failed to replay dead letters")
+		return
+	}
+
+	apiresp.OK(c, &model.ReplayResponse{Replayed: replayed})
+}
+
+// Delete handles DELETE /dlq/:id
+// @Summary Discard a dead-lettered access log event
+// @ID deleteDeadLetter
+// @Tags admin
+// @Produce json
+// @Param id path string true "Dead letter ID"
+// @Success 200 {object} apiresp.Response
+// @Router /dlq/{id} [delete]
+func (h *DeadLetterHandler) Delete(c *gin.Context) {
+	deleted, err := h.dlq.Delete(c.Request.Context(), []string{c.Param("id")})
+	if err != nil {
+		apiresp.Fail(c, http.StatusInternalServerError, "Failed to delete dead letter")
+		return
+	}
+	if deleted == 0 {
+		apiresp.Fail(c, http.StatusNotFound, "Dead letter not found")
+		return
+	}
+
+	apiresp.NoContent(c)
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/mq"
+)
+
+func newTestDeadLetterRouter(h *DeadLetterHandler) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.GET("/dlq", h.List)
+	router.POST("/dlq/replay", h.Replay)
+	router.DELETE("/dlq/:id", h.Delete)
+	return router
+}
+
+func TestDeadLetterHandler_List(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		name       string
+		query      string
+		setupMock  func(m *mocks.MockDeadLetterQueueInterface)
+		wantStatus int
+	}{
+		{
+			name:  "default page",
+			query: "",
+			setupMock: func(m *mocks.MockDeadLetterQueueInterface) {
+				m.EXPECT().List(gomock.Any(), "", int64(50)).Return(&model.DeadLetterPage{Depth: 0}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:  "next page",
+			query: "?after=1-0&count=10",
+			setupMock: func(m *mocks.MockDeadLetterQueueInterface) {
+				m.EXPECT().List(gomock.Any(), "1-0", int64(10)).Return(&model.DeadLetterPage{Depth: 11}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid count",
+			query:      "?count=1000",
+			setupMock:  func(m *mocks.MockDeadLetterQueueInterface) {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "redis error",
+			query: "",
+			setupMock: func(m *mocks.MockDeadLetterQueueInterface) {
+				m.EXPECT().List(gomock.Any(), "", int64(50)).Return(nil, errors.New("redis down"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDLQ := mocks.NewMockDeadLetterQueueInterface(ctrl)
+			tt.setupMock(mockDLQ)
+			router := newTestDeadLetterRouter(NewDeadLetterHandler(mockDLQ))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/dlq"+tt.query, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestDeadLetterHandler_Replay(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		name       string
+		body       string
+		setupMock  func(m *mocks.MockDeadLetterQueueInterface)
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "oldest without body",
+			body: "",
+			setupMock: func(m *mocks.MockDeadLetterQueueInterface) {
+				m.EXPECT().Replay(gomock.Any(), gomock.Nil()).Return(3, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `"replayed":3`,
+		},
+		{
+			name: "selected IDs",
+			body: `{"ids":["1-0","2-0"]}`,
+			setupMock: func(m *mocks.MockDeadLetterQueueInterface) {
+				m.EXPECT().Replay(gomock.Any(), []string{"1-0", "2-0"}).Return(2, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `"replayed":2`,
+		},
+		{
+			name:       "invalid body",
+			body:       `{"ids":`,
+			setupMock:  func(m *mocks.MockDeadLetterQueueInterface) {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "no producer",
+			body: "",
+			setupMock: func(m *mocks.MockDeadLetterQueueInterface) {
+				m.EXPECT().Replay(gomock.Any(), gomock.Any()).Return(0, mq.ErrReplayUnavailable)
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "send error",
+			body: "",
+			setupMock: func(m *mocks.MockDeadLetterQueueInterface) {
+				m.EXPECT().Replay(gomock.Any(), gomock.Any()).Return(1, errors.New("broker down"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDLQ := mocks.NewMockDeadLetterQueueInterface(ctrl)
+			tt.setupMock(mockDLQ)
+			router := newTestDeadLetterRouter(NewDeadLetterHandler(mockDLQ))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/dlq/replay", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantBody != "" {
+				assert.Contains(t, w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestDeadLetterHandler_Delete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		name       string
+		deleted    int64
+		err        error
+		wantStatus int
+	}{
+		{name: "deleted", deleted: 1, wantStatus: http.StatusOK},
+		{name: "not found", deleted: 0, wantStatus: http.StatusNotFound},
+		{name: "redis error", err: errors.New("redis down"), wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDLQ := mocks.NewMockDeadLetterQueueInterface(ctrl)
+			mockDLQ.EXPECT().Delete(gomock.Any(), []string{"1-0"}).Return(tt.deleted, tt.err)
+			router := newTestDeadLetterRouter(NewDeadLetterHandler(mockDLQ))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("DELETE", "/dlq/1-0", nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
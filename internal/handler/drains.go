@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"octopus/internal/model"
+	"octopus/internal/service"
+	"octopus/pkg/apiresp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LogDrainHandler serves the log drains link owners forward their access events to
+type LogDrainHandler struct {
+	drains service.LogDrainsInterface
+}
+
+// NewLogDrainHandler creates a new LogDrainHandler
+func NewLogDrainHandler(drains service.LogDrainsInterface) *LogDrainHandler {
+	return &LogDrainHandler{drains: drains}
+}
+
+// Create handles POST /api/v1/drains
+// @Summary Register a log drain
+// @ID createLogDrain
+// @Description Forwards the access events of a link, or of the links of a campaign, to an endpoint. Events are posted as JSON batches signed with the returned secret: the X-Octopus-Signature header is sha256= followed by the hex HMAC-SHA256 of the X-Octopus-Timestamp header, a dot and the body. The secret is only returned here. In self-serve mode, only the owner of a link registers its drains, and the drains of a campaign only get the events of the links of the X-API-Key registering them.
+// @Tags drains
+// @Accept json
+// @Produce json
+// @Param request body model.LogDrainRequest true "Drain to register"
+// @Success 200 {object} apiresp.Response{data=model.LogDrain}
+// @Failure 400 {object} apiresp.ErrorResponse
+// @Failure 401 {object} apiresp.ErrorResponse
+// @Failure 403 {object} apiresp.ErrorResponse
+// @Failure 404 {object} apiresp.ErrorResponse
+// @Failure 409 {object} apiresp.ErrorResponse
+// @Router /api/v1/drains [post]
+func (h *LogDrainHandler) Create(c *gin.Context) {
+	var req model.LogDrainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if errs := validateLogDrainRequest(&req); errs != nil {
+		respondInvalid(c, errs)
+		return
+	}
+
+	drain, err := h.drains.Create(c.Request.Context(), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrDrainLimit) {
+			apiresp.Fail(c, http.StatusConflict, "Too many log drains for this short link or campaign")
+			return
+		}
+		respondClaimError(c, err, "Failed to register log drain")
+		return
+	}
+
+	apiresp.OK(c, drain)
+}
+
+// List handles GET /api/v1/drains
+// @Summary List log drains
+// @ID listLogDrains
+// @Description Returns the log drains of a link or of a campaign, without their secrets. In self-serve mode, only the owner of a link lists its drains, and the drains of a campaign listed are the ones of the X-API-Key of the caller.
+// @Tags drains
+// @Produce json
+// @Param short_code query string false "Short code"
+// @Param campaign query string false "Campaign"
+// @Success 200 {object} apiresp.Response{data=[]model.LogDrain}
+// @Failure 400 {object} apiresp.ErrorResponse
+// @Failure 401 {object} apiresp.ErrorResponse
+// @Failure 403 {object} apiresp.ErrorResponse
+// @Router /api/v1/drains [get]
+func (h *LogDrainHandler) List(c *gin.Context) {
+	shortCode, campaign := c.Query("short_code"), c.Query("campaign")
+	if (shortCode == "") == (campaign == "") {
+		apiresp.Fail(c, http.StatusBadRequest, "Invalid request: either short_code or campaign is required")
+		return
+	}
+
+	drains, err := h.drains.List(c.Request.Context(), shortCode, campaign)
+	if err != nil {
+		respondClaimError(c, err, "Failed to list log drains")
+		return
+	}
+
+	apiresp.OK(c, drains)
+}
+
+// Delete handles DELETE /api/v1/drains/:id
+// @Summary Remove a log drain
+// @ID deleteLogDrain
+// @Description Stops forwarding access events to a drain, the events not posted yet being dropped
+// @Tags drains
+// @Produce json
+// @Param id path string true "Drain ID"
+// @Success 200 {object} apiresp.Response
+// @Failure 401 {object} apiresp.ErrorResponse
+// @Failure 403 {object} apiresp.ErrorResponse
+// @Failure 404 {object} apiresp.ErrorResponse
+// @Router /api/v1/drains/{id} [delete]
+func (h *LogDrainHandler) Delete(c *gin.Context) {
+	deleted, err := h.drains.Delete(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondClaimError(c, err, "Failed to delete log drain")
+		return
+	}
+	if !deleted {
+		apiresp.Fail(c, http.StatusNotFound, "Log drain not found")
+		return
+	}
+
+	apiresp.NoContent(c)
+}
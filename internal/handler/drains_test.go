@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/service"
+)
+
+func newTestLogDrainRouter(h *LogDrainHandler) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.POST("/api/v1/drains", h.Create)
+	router.GET("/api/v1/drains", h.List)
+	router.DELETE("/api/v1/drains/:id", h.Delete)
+	return router
+}
+
+func TestLogDrainHandler_Create(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		name       string
+		body       string
+		setupMock  func(m *mocks.MockLogDrainsInterface)
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "for a link",
+			body: `{"short_code":"ABCD","url":"https://logs.example.com/octopus"}`,
+			setupMock: func(m *mocks.MockLogDrainsInterface) {
+				m.EXPECT().Create(gomock.Any(), &model.LogDrainRequest{ShortCode: "ABCD", URL: "https://logs.example.com/octopus"}).
+					Return(&model.LogDrain{ID: "d1", ShortCode: "ABCD", URL: "https://logs.example.com/octopus", Secret: "s3cret"}, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `"secret":"s3cret"`,
+		},
+		{
+			name:       "for a link and a campaign",
+			body:       `{"short_code":"ABCD","campaign":"launch","url":"https://logs.example.com"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "campaign cannot be combined with short_code",
+		},
+		{
+			name:       "for nothing",
+			body:       `{"url":"https://logs.example.com"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "short_code or campaign is required",
+		},
+		{
+			name:       "to a non-HTTP endpoint",
+			body:       `{"campaign":"launch","url":"ftp://logs.example.com"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "url must be an http or https URL",
+		},
+		{
+			name: "for an unknown link",
+			body: `{"short_code":"NONE","url":"https://logs.example.com"}`,
+			setupMock: func(m *mocks.MockLogDrainsInterface) {
+				m.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil, service.ErrShortLinkNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "beyond the limit",
+			body: `{"campaign":"launch","url":"https://logs.example.com"}`,
+			setupMock: func(m *mocks.MockLogDrainsInterface) {
+				m.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil, service.ErrDrainLimit)
+			},
+			wantStatus: http.StatusConflict,
+			wantBody:   "Too many log drains",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDrains := mocks.NewMockLogDrainsInterface(ctrl)
+			if tt.setupMock != nil {
+				tt.setupMock(mockDrains)
+			}
+			router := newTestLogDrainRouter(NewLogDrainHandler(mockDrains))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/drains", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestLogDrainHandler_List(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDrains := mocks.NewMockLogDrainsInterface(ctrl)
+	mockDrains.EXPECT().List(gomock.Any(), "", "launch").Return([]model.LogDrain{{ID: "d1", Campaign: "launch", URL: "https://logs.example.com"}}, nil)
+	mockDrains.EXPECT().List(gomock.Any(), "ABCD", "").Return(nil, errors.New("redis down"))
+	router := newTestLogDrainRouter(NewLogDrainHandler(mockDrains))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/drains?campaign=launch", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":"d1"`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/drains?short_code=ABCD", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/drains", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestLogDrainHandler_Delete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDrains := mocks.NewMockLogDrainsInterface(ctrl)
+	mockDrains.EXPECT().Delete(gomock.Any(), "d1").Return(true, nil)
+	mockDrains.EXPECT().Delete(gomock.Any(), "d2").Return(false, nil)
+	router := newTestLogDrainRouter(NewLogDrainHandler(mockDrains))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/api/v1/drains/d1", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/api/v1/drains/d2", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
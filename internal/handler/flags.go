@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"net/http"
+
+	"octopus/internal/model"
+	"octopus/internal/service"
+	"octopus/pkg/apiresp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FeatureFlagHandler serves the feature flags on the admin port
+type FeatureFlagHandler struct {
+	flags service.FeatureFlagsInterface
+}
+
+// NewFeatureFlagHandler creates a new FeatureFlagHandler
+func NewFeatureFlagHandler(flags service.FeatureFlagsInterface) *FeatureFlagHandler {
+	return &FeatureFlagHandler{flags: flags}
+}
+
+// List handles GET /flags
+// @Summary List feature flags
+// @ID listFlags
+// @Description Returns the rule in effect of every configured or overridden feature
+// @Tags admin
+// @Produce json
+// @Success 200 {object} apiresp.Response{data=[]model.FeatureFlag}
+// @Router /flags [get]
+func (h *FeatureFlagHandler) List(c *gin.Context) {
+	flags, err := h.flags.List(c.Request.Context())
+	if err != nil {
+		apiresp.Fail(c, http.StatusInternalServerError, "Failed to list feature flags")
+		return
+	}
+
+	apiresp.OK(c, flags)
+}
+
+// Set handles PUT /flags/:name
+// @Summary Override a feature flag
+// @ID setFlag
+// @Description Overrides the rule of a feature on every instance, taking effect on their next refresh
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param name path string true "Feature name"
+// @Param request body model.FeatureFlagRequest true "Rule of the feature"
+// @Success 200 {object} apiresp.Response{data=model.FeatureFlag}
+// @Router /flags/{name} [put]
+func (h *FeatureFlagHandler) Set(c *gin.Context) {
+	var req model.FeatureFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiresp.Fail(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	flag, err := h.flags.Set(c.Request.Context(), c.Param("name"), &req)
+	if err != nil {
+		apiresp.Fail(c, http.StatusInternalServerError, "Failed to save feature flag")
+		return
+	}
+
+	apiresp.OK(c, flag)
+}
+
+// Delete handles DELETE /flags/:name
+// @Summary Remove a feature flag override
+// @ID deleteFlag
+// @Description Restores the configured rule of a feature
+// @Tags admin
+// @Produce json
+// @Param name path string true "Feature name"
+// @Success 200 {object} apiresp.Response
+// @Router /flags/{name} [delete]
+func (h *FeatureFlagHandler) Delete(c *gin.Context) {
+	deleted, err := h.flags.Delete(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		apiresp.Fail(c, http.StatusInternalServerError, "Failed to delete feature flag")
+		return
+	}
+	if !deleted {
+		apiresp.Fail(c, http.StatusNotFound, "Feature flag override not found")
+		return
+	}
+
+	apiresp.NoContent(c)
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+)
+
+func newTestFeatureFlagRouter(h *FeatureFlagHandler) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.GET("/flags", h.List)
+	router.PUT("/flags/:name", h.Set)
+	router.DELETE("/flags/:name", h.Delete)
+	return router
+}
+
+func TestFeatureFlagHandler_List(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockFlags := mocks.NewMockFeatureFlagsInterface(ctrl)
+	mockFlags.EXPECT().List(gomock.Any()).Return([]model.FeatureFlag{
+		{Name: "recycled_codes", Enabled: true, Percentage: 10, Source: model.FeatureFlagSourceConfig},
+	}, nil)
+	mockFlags.EXPECT().List(gomock.Any()).Return(nil, errors.New("redis down"))
+	router := newTestFeatureFlagRouter(NewFeatureFlagHandler(mockFlags))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/flags", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"recycled_codes"`)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestFeatureFlagHandler_Set(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		name       string
+		body       string
+		setupMock  func(m *mocks.MockFeatureFlagsInterface)
+		wantStatus int
+	}{
+		{
+			name: "rolled out to a percentage",
+			body: `{"enabled":true,"percentage":25,"api_keys":["partner-1"]}`,
+			setupMock: func(m *mocks.MockFeatureFlagsInterface) {
+				m.EXPECT().Set(gomock.Any(), "recycled_codes", gomock.Any()).DoAndReturn(
+					func(_ interface{}, name string, req *model.FeatureFlagRequest) (*model.FeatureFlag, error) {
+						assert.True(t, *req.Enabled)
+						assert.Equal(t, 25, req.Percentage)
+						assert.Equal(t, []string{"partner-1"}, req.APIKeys)
+						return &model.FeatureFlag{Name: name, Enabled: true, Percentage: 25}, nil
+					})
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "turned off",
+			body: `{"enabled":false}`,
+			setupMock: func(m *mocks.MockFeatureFlagsInterface) {
+				m.EXPECT().Set(gomock.Any(), "recycled_codes", gomock.Any()).Return(&model.FeatureFlag{Name: "recycled_codes"}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "missing enabled",
+			body:       `{"percentage":25}`,
+			setupMock:  func(m *mocks.MockFeatureFlagsInterface) {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "percentage out of range",
+			body:       `{"enabled":true,"percentage":101}`,
+			setupMock:  func(m *mocks.MockFeatureFlagsInterface) {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "redis error",
+			body: `{"enabled":true,"percentage":100}`,
+			setupMock: func(m *mocks.MockFeatureFlagsInterface) {
+				m.EXPECT().Set(gomock.Any(), "recycled_codes", gomock.Any()).Return(nil, errors.New("redis down"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockFlags := mocks.NewMockFeatureFlagsInterface(ctrl)
+			tt.setupMock(mockFlags)
+			router := newTestFeatureFlagRouter(NewFeatureFlagHandler(mockFlags))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", "/flags/recycled_codes", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestFeatureFlagHandler_Delete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		name       string
+		deleted    bool
+		err        error
+		wantStatus int
+	}{
+		{name: "deleted", deleted: true, wantStatus: http.StatusOK},
+		{name: "not overridden", deleted: false, wantStatus: http.StatusNotFound},
+		{name: "redis error", err: errors.New("redis down"), wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockFlags := mocks.NewMockFeatureFlagsInterface(ctrl)
+			mockFlags.EXPECT().Delete(gomock.Any(), "recycled_codes").Return(tt.deleted, tt.err)
+			router := newTestFeatureFlagRouter(NewFeatureFlagHandler(mockFlags))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("DELETE", "/flags/recycled_codes", nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"octopus/internal/model"
+	"octopus/internal/repository"
 	"octopus/internal/service"
+	"octopus/pkg/apiresp"
 
 	"github.com/gin-gonic/gin"
 )
@@ -21,48 +25,64 @@ func NewGenerateHandler(service service.ShortLinkServiceInterface) *GenerateHand
 
 // Generate handles POST /api/v1/shortlink/generate
 // @Summary Generate a short link
-// @Description Generates a short link for the given URL
+// @ID generateShortLink
+// @Description Generates a short link for the given URL. expire_at must be a future RFC 3339 time, or the link expires after ttl (like 72h) or expire_in_seconds counted on the server clock; params take at most 50 keys of string, number or boolean values and 4 KiB as JSON; tracking_enabled false redirects without recording analytics; single_use links redirect once and answer 410 afterwards; links with allowed_referrers only redirect visitors referred from these domains or their subdomains and answer 403 otherwise; allowed_countries or blocked_countries (ISO 3166-1 alpha-2 codes, not both) restrict redirects by the country of visitors and answer 451 elsewhere; a schedule routes redirects to the url of its first rule matching the day (cron day-of-week like mon-fri) and time (from, to as HH:MM) in its timezone; rejected fields are listed in errors
 // @Tags shortlink
 // @Accept json
 // @Produce json
 // @Param request body model.GenerateRequest true "Generate request"
-// @Success 200 {object} Response{data=model.GenerateResponse}
+// @Success 200 {object} apiresp.Response{data=model.GenerateResponse}
+// @Failure 400 {object} apiresp.ErrorResponse
+// @Failure 429 {object} apiresp.ErrorResponse
 // @Router /api/v1/shortlink/generate [post]
 func (h *GenerateHandler) Generate(c *gin.Context) {
 	var req model.GenerateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid request: " + err.Error(),
-		})
+		respondBindError(c, err)
+		return
+	}
+	if errs := validateGenerateRequest(&req, time.Now()); len(errs) > 0 {
+		respondInvalid(c, errs)
 		return
 	}
 
 	resp, err := h.service.Generate(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to generate short link: " + err.Error(),
-		})
+		respondError(c, err, "Failed to generate short link: "+err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, Response{
-		Code:    0,
-		Message: "success",
-		Data:    resp,
-	})
+	apiresp.OK(c, resp)
 }
 
-// Response is the standard API response
-type Response struct {
-	Code    int         `json:"code"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
+// errorStatus maps service and repository errors to the HTTP status reported for them
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidURL), errors.Is(err, service.ErrInvalidExpireAt),
+		errors.Is(err, service.ErrParamSigningDisabled), errors.Is(err, service.ErrParamsNotSigned),
+		errors.Is(err, service.ErrInvalidSelector), errors.Is(err, service.ErrBlockedURL),
+		errors.Is(err, service.ErrInvalidDomain), errors.Is(err, service.ErrInvalidSubscription):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrShortLinkNotFound), errors.Is(err, service.ErrShortLinkExpired),
+		errors.Is(err, service.ErrShortLinkUsed), errors.Is(err, service.ErrClickNotFound),
+		errors.Is(err, repository.ErrNotFound), errors.Is(err, service.ErrClaimNotStarted),
+		errors.Is(err, service.ErrReminderNotSubscribed):
+		return http.StatusNotFound
+	case errors.Is(err, repository.ErrConflict), errors.Is(err, service.ErrAliasTaken):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrClaimUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrReadOnlyReplica), errors.Is(err, service.ErrNotOwner):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrClaimUnverified):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, repository.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
 }
 
-// ErrorResponse is the error API response
-type ErrorResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+// respondError responds with the status of the error and the given message
+func respondError(c *gin.Context, err error, message string) {
+	apiresp.Fail(c, errorStatus(err), message)
 }
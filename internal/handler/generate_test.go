@@ -3,6 +3,7 @@ package handler
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -14,6 +15,9 @@ import (
 
 	"octopus/internal/mocks"
 	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/internal/service"
+	"octopus/pkg/apiresp"
 )
 
 func init() {
@@ -53,7 +57,7 @@ func TestGenerateHandler_Generate(t *testing.T) {
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 
-		var resp ErrorResponse
+		var resp apiresp.ErrorResponse
 		err := json.Unmarshal(w.Body.Bytes(), &resp)
 		require.NoError(t, err)
 		assert.Contains(t, resp.Message, "Invalid request")
@@ -72,7 +76,7 @@ func TestGenerateHandler_Generate(t *testing.T) {
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 
-		var resp ErrorResponse
+		var resp apiresp.ErrorResponse
 		err := json.Unmarshal(w.Body.Bytes(), &resp)
 		require.NoError(t, err)
 		assert.Contains(t, resp.Message, "Invalid request")
@@ -106,7 +110,7 @@ func TestGenerateHandler_Generate(t *testing.T) {
 		// Empty URL is caught by validation (400)
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 
-		var resp ErrorResponse
+		var resp apiresp.ErrorResponse
 		err := json.Unmarshal(w.Body.Bytes(), &resp)
 		require.NoError(t, err)
 		assert.Contains(t, resp.Message, "Invalid request")
@@ -131,7 +135,7 @@ func TestGenerateHandler_Generate(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var resp Response
+		var resp apiresp.Response
 		err := json.Unmarshal(w.Body.Bytes(), &resp)
 		require.NoError(t, err)
 		assert.Equal(t, 0, resp.Code)
@@ -141,7 +145,7 @@ func TestGenerateHandler_Generate(t *testing.T) {
 	t.Run("valid URL with expire_at", func(t *testing.T) {
 		reqBody := map[string]string{
 			"url":       "https://example.com",
-			"expire_at": "2025-12-31T23:59:59Z",
+			"expire_at": "2099-12-31T23:59:59Z",
 		}
 		jsonBody, _ := json.Marshal(reqBody)
 
@@ -199,7 +203,7 @@ func TestGenerateHandler_Generate(t *testing.T) {
 
 func TestResponse(t *testing.T) {
 	t.Run("success response", func(t *testing.T) {
-		resp := Response{
+		resp := apiresp.Response{
 			Code:    0,
 			Message: "success",
 			Data:    "test data",
@@ -208,7 +212,7 @@ func TestResponse(t *testing.T) {
 		jsonBytes, err := json.Marshal(resp)
 		require.NoError(t, err)
 
-		var unmarshaled Response
+		var unmarshaled apiresp.Response
 		err = json.Unmarshal(jsonBytes, &unmarshaled)
 		require.NoError(t, err)
 
@@ -218,7 +222,7 @@ func TestResponse(t *testing.T) {
 	})
 
 	t.Run("response without data", func(t *testing.T) {
-		resp := Response{
+		resp := apiresp.Response{
 			Code:    0,
 			Message: "success",
 		}
@@ -226,7 +230,7 @@ func TestResponse(t *testing.T) {
 		jsonBytes, err := json.Marshal(resp)
 		require.NoError(t, err)
 
-		var unmarshaled Response
+		var unmarshaled apiresp.Response
 		err = json.Unmarshal(jsonBytes, &unmarshaled)
 		require.NoError(t, err)
 
@@ -242,7 +246,7 @@ func TestResponse(t *testing.T) {
 			OriginalURL: "https://example.com",
 		}
 
-		resp := Response{
+		resp := apiresp.Response{
 			Code:    0,
 			Message: "success",
 			Data:    data,
@@ -251,7 +255,7 @@ func TestResponse(t *testing.T) {
 		jsonBytes, err := json.Marshal(resp)
 		require.NoError(t, err)
 
-		var unmarshaled Response
+		var unmarshaled apiresp.Response
 		err = json.Unmarshal(jsonBytes, &unmarshaled)
 		require.NoError(t, err)
 
@@ -261,7 +265,7 @@ func TestResponse(t *testing.T) {
 	})
 
 	t.Run("error response", func(t *testing.T) {
-		resp := ErrorResponse{
+		resp := apiresp.ErrorResponse{
 			Code:    http.StatusBadRequest,
 			Message: "Invalid request",
 		}
@@ -269,7 +273,7 @@ func TestResponse(t *testing.T) {
 		jsonBytes, err := json.Marshal(resp)
 		require.NoError(t, err)
 
-		var unmarshaled ErrorResponse
+		var unmarshaled apiresp.ErrorResponse
 		err = json.Unmarshal(jsonBytes, &unmarshaled)
 		require.NoError(t, err)
 
@@ -278,7 +282,7 @@ func TestResponse(t *testing.T) {
 	})
 
 	t.Run("error response with custom code", func(t *testing.T) {
-		resp := ErrorResponse{
+		resp := apiresp.ErrorResponse{
 			Code:    1001,
 			Message: "Custom error message",
 		}
@@ -286,7 +290,7 @@ func TestResponse(t *testing.T) {
 		jsonBytes, err := json.Marshal(resp)
 		require.NoError(t, err)
 
-		var unmarshaled ErrorResponse
+		var unmarshaled apiresp.ErrorResponse
 		err = json.Unmarshal(jsonBytes, &unmarshaled)
 		require.NoError(t, err)
 
@@ -329,3 +333,29 @@ func TestGenerateRequest(t *testing.T) {
 		assert.Equal(t, "google", unmarshaled.Params["utm_source"])
 	})
 }
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "invalid URL", err: service.ErrInvalidURL, want: http.StatusBadRequest},
+		{name: "invalid expiry", err: fmt.Errorf("%w: bad format", service.ErrInvalidExpireAt), want: http.StatusBadRequest},
+		{name: "short link not found", err: service.ErrShortLinkNotFound, want: http.StatusNotFound},
+		{name: "short link expired", err: service.ErrShortLinkExpired, want: http.StatusNotFound},
+		{name: "click not found", err: service.ErrClickNotFound, want: http.StatusNotFound},
+		{name: "record not found", err: fmt.Errorf("failed to get daily stats: %w", repository.ErrNotFound), want: http.StatusNotFound},
+		{name: "conflict", err: fmt.Errorf("failed to save short link: %w", repository.ErrConflict), want: http.StatusConflict},
+		{name: "alias taken", err: fmt.Errorf("%w: \"DOCS\"", service.ErrAliasTaken), want: http.StatusConflict},
+		{name: "read-only replica", err: service.ErrReadOnlyReplica, want: http.StatusForbidden},
+		{name: "unavailable", err: fmt.Errorf("failed to get short link: %w", repository.ErrUnavailable), want: http.StatusServiceUnavailable},
+		{name: "other", err: assert.AnError, want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, errorStatus(tt.err))
+		})
+	}
+}
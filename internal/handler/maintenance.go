@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"net/http"
+
+	"octopus/internal/model"
+	"octopus/internal/service"
+	"octopus/pkg/apiresp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaintenanceHandler turns the maintenance mode on and off from the admin port
+type MaintenanceHandler struct {
+	maintenance service.MaintenanceModeInterface
+}
+
+// NewMaintenanceHandler creates a new MaintenanceHandler
+func NewMaintenanceHandler(maintenance service.MaintenanceModeInterface) *MaintenanceHandler {
+	return &MaintenanceHandler{maintenance: maintenance}
+}
+
+// Get handles GET /maintenance
+// @Summary Get the maintenance mode
+// @ID getMaintenance
+// @Tags admin
+// @Produce json
+// @Success 200 {object} apiresp.Response{data=model.Maintenance}
+// @Router /maintenance [get]
+func (h *MaintenanceHandler) Get(c *gin.Context) {
+	state, err := h.maintenance.Get(c.Request.Context())
+	if err != nil {
+		apiresp.Fail(c, http.StatusInternalServerError, "Failed to get maintenance mode")
+		return
+	}
+
+	apiresp.OK(c, state)
+}
+
+// Enable handles PUT /maintenance
+// @Summary Turn the maintenance mode on
+// @ID enableMaintenance
+// @Description Rejects link writes with 503 on every instance within seconds, redirects keep working
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body model.MaintenanceRequest false "Reason and seconds clients should wait"
+// @Success 200 {object} apiresp.Response{data=model.Maintenance}
+// @Router /maintenance [put]
+func (h *MaintenanceHandler) Enable(c *gin.Context) {
+	var req model.MaintenanceRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apiresp.Fail(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+			return
+		}
+	}
+
+	state, err := h.maintenance.Enable(c.Request.Context(), &req)
+	if err != nil {
+		apiresp.Fail(c, http.StatusInternalServerError, "Failed to turn maintenance mode on")
+		return
+	}
+
+	apiresp.OK(c, state)
+}
+
+// Disable handles DELETE /maintenance
+// @Summary Turn the maintenance mode off
+// @ID disableMaintenance
+// @Tags admin
+// @Produce json
+// @Success 200 {object} apiresp.Response
+// @Router /maintenance [delete]
+func (h *MaintenanceHandler) Disable(c *gin.Context) {
+	if err := h.maintenance.Disable(c.Request.Context()); err != nil {
+		apiresp.Fail(c, http.StatusInternalServerError, "Failed to turn maintenance mode off")
+		return
+	}
+
+	apiresp.NoContent(c)
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+)
+
+func newTestMaintenanceRouter(h *MaintenanceHandler) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.GET("/maintenance", h.Get)
+	router.PUT("/maintenance", h.Enable)
+	router.DELETE("/maintenance", h.Disable)
+	return router
+}
+
+func TestMaintenanceHandler_Get(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMaintenance := mocks.NewMockMaintenanceModeInterface(ctrl)
+	mockMaintenance.EXPECT().Get(gomock.Any()).Return(&model.Maintenance{Enabled: true, Reason: "migration"}, nil)
+	mockMaintenance.EXPECT().Get(gomock.Any()).Return(nil, errors.New("redis down"))
+	router := newTestMaintenanceRouter(NewMaintenanceHandler(mockMaintenance))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/maintenance", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"reason":"migration"`)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestMaintenanceHandler_Enable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		name       string
+		body       string
+		setupMock  func(m *mocks.MockMaintenanceModeInterface)
+		wantStatus int
+	}{
+		{
+			name: "without body",
+			body: "",
+			setupMock: func(m *mocks.MockMaintenanceModeInterface) {
+				m.EXPECT().Enable(gomock.Any(), &model.MaintenanceRequest{}).Return(&model.Maintenance{Enabled: true, RetryAfter: 60}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "with reason and estimate",
+			body: `{"reason":"migration","retry_after":300}`,
+			setupMock: func(m *mocks.MockMaintenanceModeInterface) {
+				m.EXPECT().Enable(gomock.Any(), &model.MaintenanceRequest{Reason: "migration", RetryAfter: 300}).
+					Return(&model.Maintenance{Enabled: true, Reason: "migration", RetryAfter: 300}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "negative estimate",
+			body:       `{"retry_after":-1}`,
+			setupMock:  func(m *mocks.MockMaintenanceModeInterface) {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "redis error",
+			body: "",
+			setupMock: func(m *mocks.MockMaintenanceModeInterface) {
+				m.EXPECT().Enable(gomock.Any(), gomock.Any()).Return(nil, errors.New("redis down"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMaintenance := mocks.NewMockMaintenanceModeInterface(ctrl)
+			tt.setupMock(mockMaintenance)
+			router := newTestMaintenanceRouter(NewMaintenanceHandler(mockMaintenance))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", "/maintenance", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestMaintenanceHandler_Disable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{name: "disabled", wantStatus: http.StatusOK},
+		{name: "redis error", err: errors.New("redis down"), wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMaintenance := mocks.NewMockMaintenanceModeInterface(ctrl)
+			mockMaintenance.EXPECT().Disable(gomock.Any()).Return(tt.err)
+			router := newTestMaintenanceRouter(NewMaintenanceHandler(mockMaintenance))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("DELETE", "/maintenance", nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAPIHandler serves an OpenAPI spec generated from the handler annotations
+type OpenAPIHandler struct {
+	spec []byte
+}
+
+// NewOpenAPIHandler creates a new OpenAPIHandler
+func NewOpenAPIHandler(spec []byte) *OpenAPIHandler {
+	return &OpenAPIHandler{spec: spec}
+}
+
+// Spec handles GET /openapi.json
+// @Summary Get the OpenAPI spec
+// @ID getOpenAPI
+// @Description Returns the OpenAPI spec of the API, from which client SDKs are generated
+// @Tags static
+// @Produce json
+// @Success 200 {object} object
+// @Router /openapi.json [get]
+func (h *OpenAPIHandler) Spec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", h.spec)
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"octopus/api/openapi"
+)
+
+func TestOpenAPIHandler_Spec(t *testing.T) {
+	tests := []struct {
+		name string
+		spec []byte
+		path string
+	}{
+		{name: "public", spec: openapi.Public, path: "/api/v1/shortlink/generate"},
+		{name: "admin", spec: openapi.Admin, path: "/maintenance"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/openapi.json", NewOpenAPIHandler(tt.spec).Spec)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			var spec struct {
+				Swagger string                     `json:"swagger"`
+				Paths   map[string]json.RawMessage `json:"paths"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec))
+			assert.Equal(t, "2.0", spec.Swagger)
+			assert.Contains(t, spec.Paths, tt.path)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"octopus/internal/service"
+	"octopus/pkg/apiresp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PoolHandler handles reserved code pool operations
+type PoolHandler struct {
+	smsPool service.SMSPoolServiceInterface
+}
+
+// NewPoolHandler creates a new PoolHandler
+func NewPoolHandler(smsPool service.SMSPoolServiceInterface) *PoolHandler {
+	return &PoolHandler{smsPool: smsPool}
+}
+
+// GetSMSUsage handles GET /api/v1/shortlink/pools/sms
+// @Summary Get SMS code pool usage
+// @ID getSMSPoolUsage
+// @Description Returns the capacity accounting of the SMS code pool
+// @Tags shortlink
+// @Produce json
+// @Success 200 {object} apiresp.Response{data=model.PoolUsage}
+// @Router /api/v1/shortlink/pools/sms [get]
+func (h *PoolHandler) GetSMSUsage(c *gin.Context) {
+	usage, err := h.smsPool.Usage(c.Request.Context())
+	if err != nil {
+		respondError(c, err, "Failed to get SMS pool usage")
+		return
+	}
+
+	apiresp.OK(c, usage)
+}
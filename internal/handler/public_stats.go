@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// PublicStatsHandler renders the public stats pages of links, served at /{shortCode}+
+type PublicStatsHandler struct {
+	pages service.PublicStatsPagesInterface
+}
+
+// NewPublicStatsHandler creates a new PublicStatsHandler
+func NewPublicStatsHandler(pages service.PublicStatsPagesInterface) *PublicStatsHandler {
+	return &PublicStatsHandler{pages: pages}
+}
+
+// Show handles GET /:shortCode+
+// @Summary Show the public stats of a short link
+// @ID showPublicStats
+// @Description Renders clicks over time and top traffic sources of a link its owner made public, from daily aggregates only
+// @Tags shortlink
+// @Produce html
+// @Param shortCode path string true "Short code followed by +"
+// @Success 200
+// @Failure 404
+// @Router /{shortCode}+ [get]
+func (h *PublicStatsHandler) Show(c *gin.Context, shortCode string) {
+	stats, err := h.pages.Get(c.Request.Context(), shortCode)
+	if errors.Is(err, service.ErrShortLinkNotFound) {
+		c.HTML(http.StatusNotFound, "404.html", gin.H{
+			"code": shortCode,
+		})
+		return
+	}
+	if errors.Is(err, repository.ErrUnavailable) {
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("short_code", shortCode).Msg("Failed to get public stats")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	page, err := renderPublicStats(stats)
+	if err != nil {
+		log.Error().Err(err).Str("short_code", shortCode).Msg("Failed to render public stats")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// Shared caches may keep the page as long as this instance does, search engines may not list it
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.pages.CacheTTL().Seconds())))
+	c.Header("X-Robots-Tag", "noindex")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+}
+
+// publicStatsBar is one day of the clicks chart, its height relative to the busiest day
+type publicStatsBar struct {
+	Day     string
+	Clicks  int64
+	Percent int
+}
+
+var publicStatsTemplate = template.Must(template.New("public_stats").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Stats of /{{.Stats.ShortCode}}</title>
+</head>
+<body style="font-family: sans-serif; max-width: 48em; margin: 2em auto">
+<h1>/{{.Stats.ShortCode}}{{if .Stats.Title}} &middot; {{.Stats.Title}}{{end}}</h1>
+<p><a href="{{.Stats.OriginalURL}}" rel="nofollow noopener">{{.Stats.OriginalURL}}</a></p>
+<p><strong>{{.Stats.Clicks}}</strong> clicks by <strong>{{.Stats.Visitors}}</strong> daily visitors from {{.From}} to {{.To}}</p>
+<div style="display: flex; align-items: flex-end; gap: 2px; height: 10em; border-bottom: 1px solid #999">
+{{range .Bars}}<div title="{{.Day}}: {{.Clicks}} clicks" style="flex: 1; background: #4a7bd0; height: {{.Percent}}%"></div>
+{{end}}</div>
+<h2>Top sources</h2>
+<table cellpadding="4">
+{{range .Stats.TopSources}}<tr><td>{{.Source}}</td><td>{{.Count}}</td></tr>
+{{else}}<tr><td>No clicks yet</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// renderPublicStats renders the public stats page of a link
+func renderPublicStats(stats *model.PublicStats) ([]byte, error) {
+	var busiest int64
+	for _, day := range stats.Daily {
+		busiest = max(busiest, day.Clicks)
+	}
+	bars := make([]publicStatsBar, len(stats.Daily))
+	for i, day := range stats.Daily {
+		bars[i] = publicStatsBar{Day: day.Day.Format("2006-01-02"), Clicks: day.Clicks}
+		if busiest > 0 {
+			bars[i].Percent = int(day.Clicks * 100 / busiest)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := publicStatsTemplate.Execute(&buf, map[string]any{
+		"Stats": stats,
+		"Bars":  bars,
+		"From":  stats.Period.From.Format("2006-01-02"),
+		"To":    stats.Period.To.Format("2006-01-02"),
+	})
+	return buf.Bytes(), err
+}
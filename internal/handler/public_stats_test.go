@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"octopus/internal/encoder"
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/internal/service"
+)
+
+func newTestPublicStatsRouter(ctrl *gomock.Controller, pages service.PublicStatsPagesInterface) *gin.Engine {
+	h := NewRedirectHandler(mocks.NewMockShortLinkServiceInterface(ctrl), mocks.NewMockAnalyticsServiceInterface(ctrl), nil)
+	h.SetCodeFormat(encoder.NewBase32Encoder(), nil)
+	h.SetPublicStats(NewPublicStatsHandler(pages))
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.SetHTMLTemplate(template.Must(template.New("404.html").Parse("no link {{.code}}")))
+	router.GET("/:shortCode", h.Redirect)
+	return router
+}
+
+func TestPublicStatsHandler_Show(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	stats := &model.PublicStats{
+		ShortCode:   "abcd",
+		OriginalURL: "https://example.com/?a=1&b=2",
+		Title:       "<Spring sale>",
+		Period:      model.Period{From: time.Date(2024, 1, 9, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)},
+		Clicks:      12,
+		Visitors:    10,
+		Daily: []model.DailyClicks{
+			{Day: time.Date(2024, 1, 9, 0, 0, 0, 0, time.UTC), Clicks: 3},
+			{Day: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC), Clicks: 9},
+		},
+		TopSources: []model.SourceStat{{Source: "google", Count: 7}},
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		setupMock  func(m *mocks.MockPublicStatsPagesInterface)
+		wantStatus int
+		wantBody   []string
+	}{
+		{
+			name: "public link",
+			path: "/abcd+",
+			setupMock: func(m *mocks.MockPublicStatsPagesInterface) {
+				m.EXPECT().Get(gomock.Any(), "abcd").Return(stats, nil)
+				m.EXPECT().CacheTTL().Return(5 * time.Minute)
+			},
+			wantStatus: http.StatusOK,
+			wantBody: []string{
+				"&lt;Spring sale&gt;",
+				`href="https://example.com/?a=1&amp;b=2"`,
+				"<strong>12</strong> clicks by <strong>10</strong> daily visitors from 2024-01-09 to 2024-01-10",
+				`title="2024-01-09: 3 clicks" style="flex: 1; background: #4a7bd0; height: 33%"`,
+				"<td>google</td><td>7</td>",
+			},
+		},
+		{
+			name: "private link",
+			path: "/abcd+",
+			setupMock: func(m *mocks.MockPublicStatsPagesInterface) {
+				m.EXPECT().Get(gomock.Any(), "abcd").Return(nil, service.ErrShortLinkNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+			wantBody:   []string{"no link abcd"},
+		},
+		{
+			name:       "malformed code",
+			path:       "/AAA1+",
+			setupMock:  func(m *mocks.MockPublicStatsPagesInterface) {},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "storage unavailable",
+			path: "/abcd+",
+			setupMock: func(m *mocks.MockPublicStatsPagesInterface) {
+				m.EXPECT().Get(gomock.Any(), "abcd").Return(nil, repository.ErrUnavailable)
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPages := mocks.NewMockPublicStatsPagesInterface(ctrl)
+			tt.setupMock(mockPages)
+			router := newTestPublicStatsRouter(ctrl, mockPages)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			for _, body := range tt.wantBody {
+				assert.Contains(t, w.Body.String(), body)
+			}
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, "public, max-age=300", w.Header().Get("Cache-Control"))
+				assert.Equal(t, "noindex", w.Header().Get("X-Robots-Tag"))
+			}
+		})
+	}
+}
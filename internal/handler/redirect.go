@@ -1,21 +1,73 @@
 package handler
 
 import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"html"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"octopus/internal/config"
+	"octopus/internal/model"
 	"octopus/internal/mq"
+	"octopus/internal/repository"
 	"octopus/internal/service"
+	"octopus/pkg/apiresp"
+	"octopus/pkg/async"
+	"octopus/pkg/geoip"
+	"octopus/pkg/middleware"
+	"octopus/pkg/util"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 )
 
+// Crawler policies for requests to short links
+const (
+	// CrawlerPolicyRedirect redirects crawlers like any other client
+	CrawlerPolicyRedirect = "redirect"
+	// CrawlerPolicyMetaRefresh serves crawlers a 200 page with a meta refresh to the destination
+	CrawlerPolicyMetaRefresh = "meta_refresh"
+	// CrawlerPolicyForbid rejects crawlers with 403
+	CrawlerPolicyForbid = "forbid"
+)
+
+// asyncWorkTimeout bounds each piece of work a redirect leaves running after the response
+const asyncWorkTimeout = 5 * time.Second
+
+// proceedParam marks the redirects of visitors going on from the preview of a link
+const proceedParam = "_proceed"
+
 // RedirectHandler handles short link redirection
 type RedirectHandler struct {
-	shortLinkService service.ShortLinkServiceInterface
-	analyticsService service.AnalyticsServiceInterface
-	mqProducer       mq.ProducerInterface
+	shortLinkService  service.ShortLinkServiceInterface
+	analyticsService  service.AnalyticsServiceInterface
+	mqProducer        mq.ProducerInterface
+	conversionService service.ConversionServiceInterface
+	smsHost           string
+	smsCodeLength     int
+	crawlerPolicy     string
+	crawlerAgents     []string
+	rules             *service.Rules
+	reputation        *service.Reputation
+	codeValidator     CodeValidator
+	staticPaths       map[string]struct{}
+	publicStats       *PublicStatsHandler
+	visitors          *service.VisitorIdentity
+	geo               *geoip.Locator
+	cacheControl      string
+	inflight          sync.WaitGroup
+}
+
+// CodeValidator reports whether a path segment is a well-formed short code
+type CodeValidator interface {
+	IsValid(code string) bool
 }
 
 // NewRedirectHandler creates a new RedirectHandler
@@ -31,18 +83,129 @@ func NewRedirectHandler(
 	}
 }
 
+// SetSMSDomain restricts the dedicated SMS host to codes of the SMS pool length
+func (h *RedirectHandler) SetSMSDomain(host string, codeLength int) {
+	h.smsHost = host
+	h.smsCodeLength = codeLength
+}
+
+// SetCrawlerPolicy configures how requests from crawler User-Agents are answered
+func (h *RedirectHandler) SetCrawlerPolicy(policy string, userAgents []string) {
+	switch policy {
+	case CrawlerPolicyMetaRefresh, CrawlerPolicyForbid:
+		h.crawlerPolicy = policy
+	default:
+		h.crawlerPolicy = CrawlerPolicyRedirect
+	}
+	h.crawlerAgents = userAgents
+}
+
+// SetRules answers User-Agents matching the bot rules set at runtime like configured crawlers
+func (h *RedirectHandler) SetRules(rules *service.Rules) {
+	h.rules = rules
+}
+
+// SetReputation sends the visitors of links to domains of low reputation through a preview of the
+// destination instead of redirecting them
+func (h *RedirectHandler) SetReputation(reputation *service.Reputation) {
+	h.reputation = reputation
+}
+
+// SetVisitorIdentity identifies the unique visitors of redirects with a strategy other than their IP
+func (h *RedirectHandler) SetVisitorIdentity(visitors *service.VisitorIdentity) {
+	h.visitors = visitors
+}
+
+// SetGeoIP locates the visitors of links restricted to countries, whose countries are unknown
+// otherwise
+func (h *RedirectHandler) SetGeoIP(geo *geoip.Locator) {
+	h.geo = geo
+}
+
+// SetCodeFormat rejects malformed short codes and static asset paths before any storage access
+func (h *RedirectHandler) SetCodeFormat(validator CodeValidator, staticPaths []string) {
+	h.codeValidator = validator
+	h.staticPaths = make(map[string]struct{}, len(staticPaths))
+	for _, p := range staticPaths {
+		h.staticPaths[strings.TrimPrefix(p, "/")] = struct{}{}
+	}
+}
+
+// SetPublicStats serves the public stats page of a link at its short code followed by a plus
+func (h *RedirectHandler) SetPublicStats(publicStats *PublicStatsHandler) {
+	h.publicStats = publicStats
+}
+
+// SetCacheControl sets the Cache-Control of redirects from links without their own, none being
+// sent when empty
+func (h *RedirectHandler) SetCacheControl(value string) {
+	h.cacheControl = value
+}
+
+// SetConversionTracking enables appending click IDs to redirects
+func (h *RedirectHandler) SetConversionTracking(conversionService service.ConversionServiceInterface) {
+	h.conversionService = conversionService
+}
+
 // Redirect handles GET /:shortCode
 // @Summary Redirect to original URL
-// @Description Redirects to the original URL for the given short code
+// @ID redirect
+// @Description Redirects to the original URL for the given short code, with the Cache-Control of the link or the configured one
 // @Tags shortlink
 // @Param shortCode path string true "Short code"
+// @Param X-Edge-Token header string false "Token signed by the CDN edge forwarding the request, required when edge.required is on"
 // @Success 302
-// @Router /:shortCode [get]
+// @Failure 403
+// @Failure 410 "Single-use link used already"
+// @Router /{shortCode} [get]
 func (h *RedirectHandler) Redirect(c *gin.Context) {
 	shortCode := c.Param("shortCode")
 
+	// Browsers probe for static assets on every host, answer them without a lookup
+	if _, ok := h.staticPaths[shortCode]; ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	// A trailing plus asks for the public stats of the link instead of the destination
+	if code, ok := strings.CutSuffix(shortCode, "+"); ok && h.publicStats != nil {
+		if h.codeValidator != nil && !h.codeValidator.IsValid(code) {
+			c.HTML(http.StatusNotFound, "404.html", gin.H{
+				"code": code,
+			})
+			return
+		}
+		h.publicStats.Show(c, code)
+		return
+	}
+
+	// Codes the encoder could never have produced cannot exist in storage
+	if h.codeValidator != nil && !h.codeValidator.IsValid(shortCode) {
+		c.HTML(http.StatusNotFound, "404.html", gin.H{
+			"code": shortCode,
+		})
+		return
+	}
+
+	// The SMS domain only serves codes from the reserved pool
+	if h.smsHost != "" && c.Request.Host == h.smsHost && len(shortCode) != h.smsCodeLength {
+		c.HTML(http.StatusNotFound, "404.html", gin.H{
+			"code": shortCode,
+		})
+		return
+	}
+
 	// Get short link
 	sl, err := h.shortLinkService.Get(c.Request.Context(), shortCode)
+	if errors.Is(err, repository.ErrUnavailable) {
+		// Not a 404, which browsers and CDNs could cache for a link that exists
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, service.ErrShortLinkUsed) {
+		c.Data(http.StatusGone, "text/html; charset=utf-8", usedLinkPage)
+		return
+	}
 	if err != nil {
 		c.HTML(http.StatusNotFound, "404.html", gin.H{
 			"code": shortCode,
@@ -50,84 +213,332 @@ func (h *RedirectHandler) Redirect(c *gin.Context) {
 		return
 	}
 
-	// Expand URL with query params
-	queryParams := make(map[string]string)
-	for key, values := range c.Request.URL.Query() {
-		if len(values) > 0 {
-			queryParams[key] = values[0]
+	// Crawlers are answered by policy rather than by accident
+	crawler := h.crawlerPolicy != "" && h.crawlerPolicy != CrawlerPolicyRedirect &&
+		(util.IsBot(c.Request.UserAgent(), h.crawlerAgents) || h.rules.IsBot(c.Request.UserAgent()))
+	if crawler && h.crawlerPolicy == CrawlerPolicyForbid {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	// Links restricted to referrers are not redirected from elsewhere, nor without a Referer
+	if !sl.AllowsReferrer(c.Request.Header.Get("Referer")) {
+		c.Header("Cache-Control", "no-store")
+		c.Data(http.StatusForbidden, "text/html; charset=utf-8", forbiddenReferrerPage)
+		return
+	}
+
+	// Links restricted to countries are only redirected where their content may be shown
+	if sl.GeoRestricted() {
+		var country string
+		if h.geo != nil {
+			country = h.geo.Country(c.Request, c.ClientIP())
+		}
+		if !sl.AllowsCountry(country) {
+			lang, page := unavailablePage(c.GetHeader("Accept-Language"))
+			c.Header("Cache-Control", "no-store")
+			c.Header("Content-Language", lang)
+			c.Header("Vary", "Accept-Language")
+			c.Data(http.StatusUnavailableForLegalReasons, "text/html; charset=utf-8", page)
+			return
 		}
 	}
 
-	targetURL, err := h.shortLinkService.ExpandURL(c.Request.Context(), shortCode, queryParams)
-	if err != nil {
-		targetURL = sl.OriginalURL
+	// Visitors going on from the preview of a link come back with a marker, not part of the params
+	query := c.Request.URL.Query()
+	proceed := query.Has(proceedParam)
+	query.Del(proceedParam)
+
+	// Links signing their params only take them as signed, tampered params are not redirected at all
+	if sl.SignedParams {
+		if query, err = h.shortLinkService.VerifyParams(sl, query); err != nil {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+	}
+
+	// Expand URL with query params, from the link loaded above: the last click may be
+	// deactivating it meanwhile
+	targetURL := h.shortLinkService.ExpandURL(sl, query)
+
+	// Visitors of links to domains of low reputation see where they are going first, a verdict
+	// that may change any time so the preview is never cached. The click only counts, against the
+	// limit and in the analytics, once they go on.
+	if !proceed && h.reputation.Interstitial(targetURL) {
+		query.Set(proceedParam, "1")
+		proceedURL := url.URL{Path: c.Request.URL.Path, RawQuery: query.Encode()}
+		c.Header("Cache-Control", "no-store")
+		c.Data(http.StatusOK, "text/html; charset=utf-8", interstitialPage(targetURL, proceedURL.String()))
+		return
+	}
+
+	// Links with a click limit stop redirecting exactly at the limit. Without Redis the limit
+	// cannot be checked, the click is let through like any other, except for single-use links
+	// that must never be claimed twice.
+	allowed, lastClick := true, false
+	if sl.MaxClicks > 0 {
+		if allowed, lastClick, err = h.shortLinkService.ConsumeClick(c.Request.Context(), shortCode); err != nil {
+			log.Warn().Err(err).Str("short_code", shortCode).Msg("Failed to check click limit")
+			if sl.SingleUse {
+				c.AbortWithStatus(http.StatusServiceUnavailable)
+				return
+			}
+			allowed, lastClick = true, false
+		}
+	}
+	if !allowed && sl.SingleUse {
+		c.Data(http.StatusGone, "text/html; charset=utf-8", usedLinkPage)
+		return
+	}
+	if !allowed {
+		c.HTML(http.StatusNotFound, "404.html", gin.H{
+			"code": shortCode,
+		})
+		return
+	}
+	if lastClick {
+		h.detach(c, func(ctx context.Context) {
+			if err := h.shortLinkService.Deactivate(ctx, shortCode); err != nil {
+				log.Error().Err(err).Str("short_code", shortCode).Msg("Failed to deactivate short link")
+			}
+		})
+	}
+
+	// Links opted out of analytics are only redirected: no click ID, stats or access log
+	if !sl.NoTracking {
+		targetURL = h.track(c, sl, targetURL)
+	}
+
+	// Caches and CDNs replay a redirect without reaching the service only as far as allowed here,
+	// never for single-use links, links whose referrers or countries are checked nor scheduled ones
+	cacheControl := cmp.Or(sl.CacheControl, h.cacheControl)
+	if sl.SingleUse || sl.Referrers != "" || sl.GeoRestricted() || len(sl.Schedule) > 0 {
+		cacheControl = "no-store"
+	}
+	if cacheControl != "" {
+		c.Header("Cache-Control", cacheControl)
+	}
+
+	if crawler && h.crawlerPolicy == CrawlerPolicyMetaRefresh {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", metaRefreshPage(targetURL))
+		return
 	}
 
-	// Record analytics
+	// 302 Redirect
+	c.Redirect(http.StatusFound, targetURL)
+}
+
+// track records a redirect to a short link in the analytics and the access log, returning the
+// destination tagged with a click ID for conversion postbacks
+func (h *RedirectHandler) track(c *gin.Context, sl *model.ShortLink, targetURL string) string {
+	shortCode := sl.ShortCode
 	clientIP := c.ClientIP()
 	userAgent := c.Request.UserAgent()
 	referer := c.Request.Header.Get("Referer")
+	edge := middleware.EdgeCacheFrom(c.Request.Context())
+
+	visitor := service.Visitor{ID: clientIP, Strategy: config.VisitorStrategyIP}
+	if h.visitors != nil {
+		var cookie *http.Cookie
+		if visitor, cookie = h.visitors.Identify(c.Request, clientIP); cookie != nil {
+			http.SetCookie(c.Writer, cookie)
+		}
+	}
+
+	// Tag the destination with a click ID for conversion postbacks
+	var clickID string
+	if h.conversionService != nil && !h.conversionService.OptedOut(c.Request.Context(), sl, c.Request.Header) {
+		clickID = h.clickID(c)
+		targetURL = h.conversionService.TagURL(targetURL, clickID)
+		if cookie := h.conversionService.ClickCookie(clickID); cookie != nil {
+			http.SetCookie(c.Writer, cookie)
+		}
+
+		h.detach(c, func(ctx context.Context) {
+			if err := h.conversionService.RecordClick(ctx, clickID, shortCode, referer); err != nil {
+				log.Error().Err(err).Str("short_code", shortCode).Msg("Failed to record click")
+			}
+		})
+	}
 
 	// Record in Redis for real-time stats
-	go func() {
-		if err := h.analyticsService.RecordAccess(c.Request.Context(), shortCode, clientIP, userAgent, referer); err != nil {
+	h.detach(c, func(ctx context.Context) {
+		if err := h.analyticsService.RecordAccess(ctx, shortCode, visitor.ID, referer); err != nil {
 			log.Error().Err(err).Str("short_code", shortCode).Msg("Failed to record access")
 		}
-	}()
+	})
 
 	// Send to MQ for async processing
 	if h.mqProducer != nil {
-		go func() {
+		h.detach(c, func(ctx context.Context) {
 			msg := &mq.AccessLogMessage{
-				ShortCode:  shortCode,
-				ClientIP:   clientIP,
-				UserAgent:  userAgent,
-				Referer:    referer,
-				AccessTime: time.Now(),
+				EventID:         util.GenerateUUID(),
+				ShortCode:       shortCode,
+				ClientIP:        clientIP,
+				UserAgent:       userAgent,
+				Referer:         referer,
+				ClickID:         clickID,
+				Edge:            edge,
+				VisitorID:       visitor.ID,
+				VisitorStrategy: visitor.Strategy,
+				AccessTime:      time.Now(),
 			}
-			if err := h.mqProducer.SendAccessLog(c.Request.Context(), msg); err != nil {
+			if err := h.mqProducer.SendAccessLog(ctx, msg); err != nil {
 				log.Error().Err(err).Str("short_code", shortCode).Msg("Failed to send access log to MQ")
 			}
-		}()
+		})
 	}
 
-	// 302 Redirect
-	c.Redirect(http.StatusFound, targetURL)
+	return targetURL
+}
+
+// detach runs work in the background once the request may be gone: the context keeps the request's
+// values but not its cancellation, and gets its own timeout. It is derived before the handler returns,
+// as gin reuses its Context for the next request.
+func (h *RedirectHandler) detach(c *gin.Context, work func(ctx context.Context)) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), asyncWorkTimeout)
+	h.inflight.Add(1)
+	async.Go(func() {
+		defer h.inflight.Done()
+		defer cancel()
+		work(ctx)
+	})
+}
+
+// Drain waits for the background work of finished redirects, call it once the server stopped
+// accepting requests
+func (h *RedirectHandler) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// metaRefreshPage renders a minimal page that sends the client on to the target URL
+func metaRefreshPage(targetURL string) []byte {
+	escaped := html.EscapeString(targetURL)
+	return []byte(fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="0; url=%s">
+<link rel="canonical" href="%s">
+<title>Redirecting</title>
+</head>
+<body><a href="%s">%s</a></body>
+</html>
+`, escaped, escaped, escaped, escaped))
+}
+
+// interstitialPage warns the visitor of a link to a domain of low reputation, leaving it to them to
+// go on to the target URL through proceedURL
+func interstitialPage(targetURL, proceedURL string) []byte {
+	host := targetURL
+	if u, err := url.Parse(targetURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return []byte(fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Leaving for %s</title>
+</head>
+<body>
+<p>This link leads to <strong>%s</strong>, a site other visitors reported or that could not be
+checked lately. Only go on if you trust it.</p>
+<p><a href="%s" rel="noopener noreferrer nofollow">%s</a></p>
+</body>
+</html>
+`, html.EscapeString(host), html.EscapeString(host), html.EscapeString(proceedURL), html.EscapeString(targetURL)))
+}
+
+// usedLinkPage tells the visitors of a single-use link that it was redirected already
+var usedLinkPage = []byte(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Link already used</title>
+</head>
+<body style="font-family: sans-serif; max-width: 48em; margin: 2em auto">
+<h1>This link was already used</h1>
+<p>It could only be opened once. Ask its sender for a new one.</p>
+</body>
+</html>
+`)
+
+// forbiddenReferrerPage is shown to visitors of a link restricted to referrers they do not come from
+var forbiddenReferrerPage = []byte(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Link not available here</title>
+</head>
+<body style="font-family: sans-serif; max-width: 48em; margin: 2em auto">
+<h1>This link cannot be opened from here</h1>
+<p>It only works from the pages it was shared on. Go back to where you found it and open it from there.</p>
+</body>
+</html>
+`)
+
+// clickID reuses the click ID of a returning visitor's cookie so repeat visits share it
+func (h *RedirectHandler) clickID(c *gin.Context) string {
+	if name := h.conversionService.CookieName(); name != "" {
+		if value, err := c.Cookie(name); err == nil && h.conversionService.ValidClickID(value) {
+			return value
+		}
+	}
+	return h.conversionService.NewClickID()
 }
 
 // GetStats handles GET /api/v1/analytics/:shortCode
 // @Summary Get analytics for a short link
+// @ID getAnalytics
 // @Description Returns PV/UV statistics for a short link
 // @Tags analytics
 // @Param shortCode path string true "Short code"
-// @Success 200 {object} Response{data=service.AnalyticsResponse}
-// @Router /api/v1/analytics/:shortCode [get]
+// @Param fresh query bool false "Read from Redis instead of this instance's recent snapshot"
+// @Success 200 {object} apiresp.Response{data=model.AnalyticsResponse}
+// @Router /api/v1/analytics/{shortCode} [get]
 func (h *RedirectHandler) GetStats(c *gin.Context) {
 	shortCode := c.Param("shortCode")
+	fresh, err := strconv.ParseBool(c.DefaultQuery("fresh", "false"))
+	if err != nil {
+		apiresp.Fail(c, http.StatusBadRequest, "Invalid request: fresh must be a boolean")
+		return
+	}
 
 	// Check if short link exists
-	_, err := h.shortLinkService.Get(c.Request.Context(), shortCode)
+	_, err = h.shortLinkService.Get(c.Request.Context(), shortCode)
+	if errors.Is(err, repository.ErrUnavailable) {
+		respondError(c, err, "Failed to get short link")
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{
-			Code:    http.StatusNotFound,
-			Message: "Short link not found",
-		})
+		apiresp.Fail(c, http.StatusNotFound, "Short link not found")
 		return
 	}
 
-	// Get analytics
-	analytics, err := h.analyticsService.GetAnalytics(c.Request.Context(), shortCode)
+	// Get analytics, validated against the update time they were read at so that a snapshot is
+	// never sent with the ETag of newer stats
+	analytics, err := h.analyticsService.GetAnalytics(c.Request.Context(), shortCode, fresh)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to get analytics",
-		})
+		respondError(c, err, "Failed to get analytics")
+		return
+	}
+	if notModifiedSince(c, analytics.UpdatedAt) {
 		return
 	}
 
-	c.JSON(http.StatusOK, Response{
-		Code:    0,
-		Message: "success",
-		Data:    analytics,
-	})
+	apiresp.OK(c, analytics)
 }
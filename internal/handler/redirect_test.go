@@ -1,19 +1,30 @@
 package handler
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"octopus/internal/config"
+	"octopus/internal/encoder"
 	"octopus/internal/mocks"
 	"octopus/internal/mq"
 	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/internal/service"
+	"octopus/pkg/async"
+	"octopus/pkg/geoip"
+	"octopus/pkg/middleware"
 )
 
 func init() {
@@ -59,9 +70,9 @@ func TestRedirectHandler_Redirect(t *testing.T) {
 			ShortCode:   shortCode,
 			OriginalURL: originalURL,
 		}, nil)
-		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), shortCode, gomock.Any()).Return(originalURL, nil)
+		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return(originalURL)
 		// Async calls in goroutines
-		mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), shortCode, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), shortCode, gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 		mockProducer.EXPECT().SendAccessLog(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
 		w := httptest.NewRecorder()
@@ -93,8 +104,8 @@ func TestRedirectHandler_Redirect(t *testing.T) {
 			ShortCode:   shortCode,
 			OriginalURL: "https://example.com",
 		}, nil)
-		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), shortCode, gomock.Any()).Return(originalURL, nil)
-		mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), shortCode, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return(originalURL)
+		mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), shortCode, gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 		mockProducer.EXPECT().SendAccessLog(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
 		w := httptest.NewRecorder()
@@ -106,6 +117,57 @@ func TestRedirectHandler_Redirect(t *testing.T) {
 		assert.Equal(t, http.StatusFound, w.Code)
 	})
 
+	t.Run("redirect forwards repeated query params", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+		mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+		mockProducer := mocks.NewMockProducerInterface(ctrl)
+
+		handler := NewRedirectHandler(mockShortLinkService, mockAnalyticsService, mockProducer)
+		router := newTestRedirectRouter(handler)
+
+		shortCode := "ABCD"
+		expandedURL := "https://example.com?tag=a&tag=b&q=a+b"
+
+		mockShortLinkService.EXPECT().Get(gomock.Any(), shortCode).Return(&model.ShortLink{
+			ShortCode:   shortCode,
+			OriginalURL: "https://example.com",
+		}, nil)
+		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), url.Values{"tag": {"a", "b"}, "q": {"a b"}}).Return(expandedURL)
+		mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), shortCode, gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		mockProducer.EXPECT().SendAccessLog(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/"+shortCode+"?tag=a&tag=b&q=a%20b", nil)
+		router.ServeHTTP(w, req)
+
+		time.Sleep(50 * time.Millisecond)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, expandedURL, w.Header().Get("Location"))
+	})
+
+	t.Run("storage unavailable", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+		mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+
+		handler := NewRedirectHandler(mockShortLinkService, mockAnalyticsService, nil)
+		router := newTestRedirectRouter(handler)
+
+		mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(nil, fmt.Errorf("failed to get short link: %w", repository.ErrUnavailable))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+
 	t.Run("non-existent short code", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
@@ -130,7 +192,7 @@ func TestRedirectHandler_Redirect(t *testing.T) {
 		assert.Equal(t, http.StatusInternalServerError, w.Code)
 	})
 
-	t.Run("redirect with ExpandURL error falls back to original URL", func(t *testing.T) {
+	t.Run("redirect without click limit expands the loaded link", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
 
@@ -144,12 +206,13 @@ func TestRedirectHandler_Redirect(t *testing.T) {
 		shortCode := "ABCD"
 		originalURL := "https://example.com"
 
-		mockShortLinkService.EXPECT().Get(gomock.Any(), shortCode).Return(&model.ShortLink{
+		sl := &model.ShortLink{
 			ShortCode:   shortCode,
 			OriginalURL: originalURL,
-		}, nil)
-		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), shortCode, gomock.Any()).Return("", errors.New("expand error"))
-		mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), shortCode, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		}
+		mockShortLinkService.EXPECT().Get(gomock.Any(), shortCode).Return(sl, nil)
+		mockShortLinkService.EXPECT().ExpandURL(sl, gomock.Any()).Return(originalURL)
+		mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), shortCode, gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 		mockProducer.EXPECT().SendAccessLog(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
 		w := httptest.NewRecorder()
@@ -179,8 +242,8 @@ func TestRedirectHandler_Redirect(t *testing.T) {
 			ShortCode:   shortCode,
 			OriginalURL: originalURL,
 		}, nil)
-		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), shortCode, gomock.Any()).Return(originalURL, nil)
-		mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), shortCode, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return(originalURL)
+		mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), shortCode, gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/"+shortCode, nil)
@@ -192,6 +255,781 @@ func TestRedirectHandler_Redirect(t *testing.T) {
 	})
 }
 
+func TestRedirectHandler_RedirectClickLimit(t *testing.T) {
+	t.Run("last click redirects and deactivates the link", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+		mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+
+		handler := NewRedirectHandler(mockShortLinkService, mockAnalyticsService, nil)
+		router := newTestRedirectRouter(handler)
+
+		deactivated := make(chan struct{})
+		mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com", MaxClicks: 3}, nil)
+		mockShortLinkService.EXPECT().ConsumeClick(gomock.Any(), "ABCD").Return(true, true, nil)
+		mockShortLinkService.EXPECT().Deactivate(gomock.Any(), "ABCD").DoAndReturn(func(_ interface{}, _ string) error {
+			close(deactivated)
+			return nil
+		})
+		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com")
+		mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), "ABCD", gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		select {
+		case <-deactivated:
+		case <-time.After(time.Second):
+			t.Fatal("short link was not deactivated")
+		}
+	})
+
+	t.Run("clicks beyond the limit are not redirected", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+		mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+
+		handler := NewRedirectHandler(mockShortLinkService, mockAnalyticsService, nil)
+		router := newTestRedirectRouter(handler)
+
+		mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com", MaxClicks: 3}, nil)
+		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com")
+		mockShortLinkService.EXPECT().ConsumeClick(gomock.Any(), "ABCD").Return(false, false, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		router.ServeHTTP(w, req)
+
+		// Without HTML render setup the 404 page panics and returns 500
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+	})
+
+	t.Run("redirects when the limit cannot be checked", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+		mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+
+		handler := NewRedirectHandler(mockShortLinkService, mockAnalyticsService, nil)
+		router := newTestRedirectRouter(handler)
+
+		mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com", MaxClicks: 3}, nil)
+		mockShortLinkService.EXPECT().ConsumeClick(gomock.Any(), "ABCD").Return(false, false, errors.New("redis error"))
+		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com")
+		mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), "ABCD", gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		router.ServeHTTP(w, req)
+
+		time.Sleep(50 * time.Millisecond)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+	})
+}
+
+func TestRedirectHandler_RedirectAsyncWork(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+	mockProducer := mocks.NewMockProducerInterface(ctrl)
+
+	handler := NewRedirectHandler(mockShortLinkService, mockAnalyticsService, mockProducer)
+	router := newTestRedirectRouter(handler)
+
+	// The background work only runs once the response is written and the request canceled
+	responded := make(chan struct{})
+	recorded := make(chan error, 1)
+	sent := make(chan error, 1)
+	checkContext := func(ctx context.Context) error {
+		<-responded
+		if _, ok := ctx.Deadline(); !ok {
+			return errors.New("context has no deadline")
+		}
+		return ctx.Err()
+	}
+
+	mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com"}, nil)
+	mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com")
+	mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), "ABCD", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _, _, _ string) error {
+			recorded <- checkContext(ctx)
+			return nil
+		})
+	mockProducer.EXPECT().SendAccessLog(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _ *mq.AccessLogMessage) error {
+			sent <- checkContext(ctx)
+			return nil
+		})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/ABCD", nil)
+	router.ServeHTTP(w, req)
+	cancel()
+	close(responded)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	for name, result := range map[string]chan error{"access": recorded, "access log": sent} {
+		select {
+		case err := <-result:
+			assert.NoError(t, err, name)
+		case <-time.After(time.Second):
+			t.Fatalf("%s was not recorded after the response", name)
+		}
+	}
+}
+
+func TestRedirectHandler_RedirectNoTracking(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// No analytics, access log or conversion call is expected
+	mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	handler := NewRedirectHandler(mockShortLinkService, mocks.NewMockAnalyticsServiceInterface(ctrl), mocks.NewMockProducerInterface(ctrl))
+	handler.SetConversionTracking(mocks.NewMockConversionServiceInterface(ctrl))
+	router := newTestRedirectRouter(handler)
+
+	mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com", NoTracking: true}, nil)
+	mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com?ref=sms")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ABCD?ref=sms", nil)
+	router.ServeHTTP(w, req)
+	require.NoError(t, handler.Drain(context.Background()))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://example.com?ref=sms", w.Header().Get("Location"))
+	assert.Empty(t, w.Header().Values("Set-Cookie"))
+}
+
+func TestRedirectHandler_RedirectSingleUse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	handler := NewRedirectHandler(mockShortLinkService, mocks.NewMockAnalyticsServiceInterface(ctrl), nil)
+	handler.SetCacheControl("public, max-age=300")
+	router := newTestRedirectRouter(handler)
+	sl := &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/ticket", NoTracking: true, MaxClicks: 1, SingleUse: true}
+
+	t.Run("first visitor claims the link", func(t *testing.T) {
+		deactivated := make(chan struct{})
+		mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(sl, nil)
+		mockShortLinkService.EXPECT().ConsumeClick(gomock.Any(), "ABCD").Return(true, true, nil)
+		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com/ticket")
+		mockShortLinkService.EXPECT().Deactivate(gomock.Any(), "ABCD").DoAndReturn(func(context.Context, string) error {
+			close(deactivated)
+			return nil
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		router.ServeHTTP(w, req)
+		require.NoError(t, handler.Drain(context.Background()))
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		<-deactivated
+	})
+
+	t.Run("claimed before the link is disabled", func(t *testing.T) {
+		mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(sl, nil)
+		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com/ticket")
+		mockShortLinkService.EXPECT().ConsumeClick(gomock.Any(), "ABCD").Return(false, false, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusGone, w.Code)
+		assert.Contains(t, w.Body.String(), "already used")
+	})
+
+	t.Run("disabled link", func(t *testing.T) {
+		mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(nil, service.ErrShortLinkUsed)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusGone, w.Code)
+		assert.Contains(t, w.Body.String(), "already used")
+	})
+
+	t.Run("claim unavailable", func(t *testing.T) {
+		// Unlike click limits, the claim is never let through without Redis
+		mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(sl, nil)
+		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com/ticket")
+		mockShortLinkService.EXPECT().ConsumeClick(gomock.Any(), "ABCD").Return(false, false, repository.ErrUnavailable)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+}
+
+func TestRedirectHandler_RedirectSignedParams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	handler := NewRedirectHandler(mockShortLinkService, mocks.NewMockAnalyticsServiceInterface(ctrl), nil)
+	router := newTestRedirectRouter(handler)
+	sl := &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com", NoTracking: true, SignedParams: true}
+
+	t.Run("signed params", func(t *testing.T) {
+		verified := url.Values{"coupon": {"SPRING10"}}
+		mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(sl, nil)
+		mockShortLinkService.EXPECT().VerifyParams(sl, url.Values{"coupon": {"SPRING10"}, "sig": {"k1.c2ln"}}).Return(verified, nil)
+		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), verified).Return("https://example.com?coupon=SPRING10")
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD?coupon=SPRING10&sig=k1.c2ln", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://example.com?coupon=SPRING10", w.Header().Get("Location"))
+	})
+
+	t.Run("tampered params", func(t *testing.T) {
+		// The click is not consumed for a redirect that never happens
+		mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(sl, nil)
+		mockShortLinkService.EXPECT().VerifyParams(sl, gomock.Any()).Return(nil, service.ErrTamperedParams)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD?coupon=SPRING90&sig=k1.c2ln", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+	})
+}
+
+func TestRedirectHandler_RedirectReferrers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	handler := NewRedirectHandler(mockShortLinkService, mocks.NewMockAnalyticsServiceInterface(ctrl), nil)
+	handler.SetCacheControl("public, max-age=300")
+	router := newTestRedirectRouter(handler)
+	sl := &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/gated", NoTracking: true, Referrers: "news.example.com"}
+
+	t.Run("allowed referrer", func(t *testing.T) {
+		mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(sl, nil)
+		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com/gated")
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		req.Header.Set("Referer", "https://mail.news.example.com/issues/42")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		// Caches would replay the redirect to visitors from anywhere
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	})
+
+	for name, referer := range map[string]string{
+		"other domain":     "https://forum.example.org/thread/7",
+		"lookalike domain": "https://fakenews.example.com/",
+		"missing referer":  "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			// The click is not consumed for a redirect that never happens
+			mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(sl, nil)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/ABCD", nil)
+			if referer != "" {
+				req.Header.Set("Referer", referer)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+			assert.Empty(t, w.Header().Get("Location"))
+			assert.Contains(t, w.Body.String(), "cannot be opened from here")
+		})
+	}
+}
+
+func TestRedirectHandler_RedirectCountries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	handler := NewRedirectHandler(mockShortLinkService, mocks.NewMockAnalyticsServiceInterface(ctrl), nil)
+	handler.SetGeoIP(geoip.NewLocator(nil, "CF-IPCountry"))
+	router := newTestRedirectRouter(handler)
+	allowed := &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/stream", NoTracking: true, GeoAllow: "FR,BE"}
+	blocked := &model.ShortLink{ShortCode: "EFGH", OriginalURL: "https://example.com/stream", NoTracking: true, GeoDeny: "US"}
+
+	t.Run("licensed country", func(t *testing.T) {
+		mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(allowed, nil)
+		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com/stream")
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		req.Header.Set("CF-IPCountry", "BE")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	})
+
+	for name, tt := range map[string]struct {
+		sl      *model.ShortLink
+		country string
+	}{
+		"country not allowed": {sl: allowed, country: "DE"},
+		"unknown country":     {sl: allowed, country: "XX"},
+		"blocked country":     {sl: blocked, country: "US"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// The click is not consumed for a redirect that never happens
+			mockShortLinkService.EXPECT().Get(gomock.Any(), tt.sl.ShortCode).Return(tt.sl, nil)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/"+tt.sl.ShortCode, nil)
+			req.Header.Set("CF-IPCountry", tt.country)
+			req.Header.Set("Accept-Language", "fr-FR,fr;q=0.9,en;q=0.8")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusUnavailableForLegalReasons, w.Code)
+			assert.Empty(t, w.Header().Get("Location"))
+			assert.Equal(t, "fr", w.Header().Get("Content-Language"))
+			assert.Contains(t, w.Body.String(), "Non disponible dans votre région")
+		})
+	}
+
+	t.Run("country not blocked", func(t *testing.T) {
+		mockShortLinkService.EXPECT().Get(gomock.Any(), "EFGH").Return(blocked, nil)
+		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com/stream")
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/EFGH", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+	})
+}
+
+func TestRedirectHandler_RedirectFromEdge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+	mockProducer := mocks.NewMockProducerInterface(ctrl)
+	handler := NewRedirectHandler(mockShortLinkService, mockAnalyticsService, mockProducer)
+	router := gin.New()
+	router.GET("/:shortCode", middleware.EdgeAuth(middleware.NewEdgeVerifier(map[string]string{"k1": "secret"}, time.Minute), middleware.EdgeTokenHeader, false), handler.Redirect)
+
+	mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com"}, nil)
+	mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com")
+	mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), "ABCD", gomock.Any(), gomock.Any()).Return(nil)
+	mockProducer.EXPECT().SendAccessLog(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msg *mq.AccessLogMessage) error {
+		assert.Equal(t, middleware.EdgeCacheMiss, msg.Edge)
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ABCD", nil)
+	req.Header.Set(middleware.EdgeTokenHeader, middleware.SignEdgeToken("k1", "secret", time.Now(), middleware.EdgeCacheMiss, "/ABCD"))
+	router.ServeHTTP(w, req)
+	require.NoError(t, handler.Drain(context.Background()))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+}
+
+func TestRedirectHandler_RedirectVisitorIdentity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+	mockProducer := mocks.NewMockProducerInterface(ctrl)
+	handler := NewRedirectHandler(mockShortLinkService, mockAnalyticsService, mockProducer)
+	handler.SetVisitorIdentity(service.NewVisitorIdentity(&config.VisitorConfig{
+		Strategy: config.VisitorStrategyCookie,
+		Cookie:   config.VisitorCookieConfig{Name: "octo_vid", MaxAge: time.Hour},
+	}))
+	router := newTestRedirectRouter(handler)
+
+	visitorID := "0123456789abcdef0123456789abcdef"
+	mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com"}, nil).Times(2)
+	mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com").Times(2)
+
+	t.Run("returning visitor is counted under its cookie", func(t *testing.T) {
+		mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), "ABCD", visitorID, gomock.Any()).Return(nil)
+		mockProducer.EXPECT().SendAccessLog(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msg *mq.AccessLogMessage) error {
+			assert.Equal(t, visitorID, msg.VisitorID)
+			assert.Equal(t, config.VisitorStrategyCookie, msg.VisitorStrategy)
+			return nil
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		req.AddCookie(&http.Cookie{Name: "octo_vid", Value: visitorID})
+		router.ServeHTTP(w, req)
+		require.NoError(t, handler.Drain(context.Background()))
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Empty(t, w.Header().Get("Set-Cookie"))
+	})
+
+	t.Run("new visitor gets a cookie", func(t *testing.T) {
+		var recorded string
+		mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), "ABCD", gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _, visitorID, _ string) error {
+			recorded = visitorID
+			return nil
+		})
+		mockProducer.EXPECT().SendAccessLog(gomock.Any(), gomock.Any()).Return(nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		router.ServeHTTP(w, req)
+		require.NoError(t, handler.Drain(context.Background()))
+
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, "octo_vid", cookies[0].Name)
+		assert.Equal(t, cookies[0].Value, recorded)
+	})
+}
+
+func TestRedirectHandler_RedirectCacheControl(t *testing.T) {
+	tests := []struct {
+		name     string
+		link     string
+		fallback string
+		want     string
+	}{
+		{name: "link value", link: "public, max-age=300", fallback: "no-store", want: "public, max-age=300"},
+		{name: "configured value", fallback: "no-store", want: "no-store"},
+		{name: "none"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+			handler := NewRedirectHandler(mockShortLinkService, mocks.NewMockAnalyticsServiceInterface(ctrl), nil)
+			handler.SetCacheControl(tt.fallback)
+			router := newTestRedirectRouter(handler)
+
+			mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(&model.ShortLink{
+				ShortCode: "ABCD", OriginalURL: "https://example.com", NoTracking: true, CacheControl: tt.link,
+			}, nil)
+			mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com")
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/ABCD", nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusFound, w.Code)
+			assert.Equal(t, tt.want, w.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestRedirectHandler_Drain(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+
+	handler := NewRedirectHandler(mockShortLinkService, mockAnalyticsService, nil)
+	router := newTestRedirectRouter(handler)
+
+	release := make(chan struct{})
+	mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com"}, nil)
+	mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com")
+	mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), "ABCD", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _, _, _ string) error {
+			<-release
+			return nil
+		})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ABCD", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	// Work still running holds up the drain until its deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, handler.Drain(ctx), context.DeadlineExceeded)
+
+	close(release)
+	assert.NoError(t, handler.Drain(context.Background()))
+}
+
+func TestRedirectHandler_RedirectAsyncPanic(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+
+	handler := NewRedirectHandler(mockShortLinkService, mockAnalyticsService, nil)
+	router := newTestRedirectRouter(handler)
+
+	mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com"}, nil)
+	mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com")
+	mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), "ABCD", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _, _, _ string) error {
+			panic("analytics bug")
+		})
+
+	before := async.Panics()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ABCD", nil)
+	router.ServeHTTP(w, req)
+
+	// The panic is recovered in the background goroutine instead of crashing the test binary
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.NoError(t, handler.Drain(context.Background()))
+	assert.Eventually(t, func() bool { return async.Panics() == before+1 }, time.Second, time.Millisecond)
+}
+
+func TestRedirectHandler_RedirectSMSDomain(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+
+	handler := NewRedirectHandler(mockShortLinkService, mockAnalyticsService, nil)
+	handler.SetSMSDomain("s.ms", 4)
+	router := newTestRedirectRouter(handler)
+
+	t.Run("non-pool code on SMS domain is rejected without lookup", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCDE", nil)
+		req.Host = "s.ms"
+		router.ServeHTTP(w, req)
+
+		// Without HTML render setup the 404 page panics and returns 500
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+
+	t.Run("pool code on SMS domain redirects", func(t *testing.T) {
+		mockShortLinkService.EXPECT().Get(gomock.Any(), "WXYZ").Return(&model.ShortLink{
+			ShortCode:   "WXYZ",
+			OriginalURL: "https://example.com",
+		}, nil)
+		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com")
+		mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), "WXYZ", gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/WXYZ", nil)
+		req.Host = "s.ms"
+		router.ServeHTTP(w, req)
+
+		time.Sleep(50 * time.Millisecond)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+	})
+}
+
+func TestRedirectHandler_RedirectCodeFormat(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+
+	handler := NewRedirectHandler(mockShortLinkService, mockAnalyticsService, nil)
+	handler.SetCodeFormat(encoder.NewBase32Encoder(), []string{"/favicon.ico", "sitemap.xml"})
+	router := newTestRedirectRouter(handler)
+
+	t.Run("static asset paths get a bare 404 without lookup", func(t *testing.T) {
+		for _, path := range []string{"/favicon.ico", "/sitemap.xml"} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusNotFound, w.Code, path)
+			assert.Empty(t, w.Body.String(), path)
+		}
+	})
+
+	t.Run("malformed codes are rejected without lookup", func(t *testing.T) {
+		for _, path := range []string{"/%20", "/AB", "/ABCDEFG", "/AAA1", "/apple-touch-icon.png"} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			router.ServeHTTP(w, req)
+
+			// Without HTML render setup the 404 page panics and returns 500
+			assert.Equal(t, http.StatusInternalServerError, w.Code, path)
+		}
+	})
+
+	t.Run("well-formed codes are looked up", func(t *testing.T) {
+		mockShortLinkService.EXPECT().Get(gomock.Any(), "abcd").Return(&model.ShortLink{
+			ShortCode:   "abcd",
+			OriginalURL: "https://example.com",
+		}, nil)
+		mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com")
+		mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), "abcd", gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/abcd", nil)
+		router.ServeHTTP(w, req)
+
+		time.Sleep(50 * time.Millisecond)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+	})
+}
+
+func TestRedirectHandler_RedirectConversionTracking(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+	mockConversionService := mocks.NewMockConversionServiceInterface(ctrl)
+
+	handler := NewRedirectHandler(mockShortLinkService, mockAnalyticsService, nil)
+	handler.SetConversionTracking(mockConversionService)
+	router := newTestRedirectRouter(handler)
+
+	sl := &model.ShortLink{
+		ShortCode:   "ABCD",
+		OriginalURL: "https://example.com",
+	}
+	mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(sl, nil).AnyTimes()
+	mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com").AnyTimes()
+	mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), "ABCD", gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	t.Run("new visitor gets a click ID and cookie", func(t *testing.T) {
+		mockConversionService.EXPECT().OptedOut(gomock.Any(), sl, gomock.Any()).Return(false)
+		mockConversionService.EXPECT().CookieName().Return("octo_cid")
+		mockConversionService.EXPECT().NewClickID().Return("c1d2")
+		mockConversionService.EXPECT().TagURL("https://example.com", "c1d2").Return("https://example.com?octo_cid=c1d2")
+		mockConversionService.EXPECT().ClickCookie("c1d2").Return(&http.Cookie{Name: "octo_cid", Value: "c1d2"})
+		mockConversionService.EXPECT().RecordClick(gomock.Any(), "c1d2", "ABCD", "https://google.com").Return(nil).AnyTimes()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		req.Header.Set("Referer", "https://google.com")
+		router.ServeHTTP(w, req)
+
+		time.Sleep(50 * time.Millisecond)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://example.com?octo_cid=c1d2", w.Header().Get("Location"))
+		assert.Contains(t, w.Header().Get("Set-Cookie"), "octo_cid=c1d2")
+	})
+
+	t.Run("returning visitor reuses the cookie click ID", func(t *testing.T) {
+		mockConversionService.EXPECT().OptedOut(gomock.Any(), sl, gomock.Any()).Return(false)
+		mockConversionService.EXPECT().CookieName().Return("octo_cid")
+		mockConversionService.EXPECT().ValidClickID("e5f6").Return(true)
+		mockConversionService.EXPECT().TagURL("https://example.com", "e5f6").Return("https://example.com?octo_cid=e5f6")
+		mockConversionService.EXPECT().ClickCookie("e5f6").Return(nil)
+		mockConversionService.EXPECT().RecordClick(gomock.Any(), "e5f6", "ABCD", "").Return(nil).AnyTimes()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		req.AddCookie(&http.Cookie{Name: "octo_cid", Value: "e5f6"})
+		router.ServeHTTP(w, req)
+
+		time.Sleep(50 * time.Millisecond)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://example.com?octo_cid=e5f6", w.Header().Get("Location"))
+	})
+
+	t.Run("opted out redirect carries no click ID", func(t *testing.T) {
+		mockConversionService.EXPECT().OptedOut(gomock.Any(), sl, gomock.Any()).Return(true)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		req.Header.Set("DNT", "1")
+		router.ServeHTTP(w, req)
+
+		time.Sleep(50 * time.Millisecond)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://example.com", w.Header().Get("Location"))
+		assert.Empty(t, w.Header().Get("Set-Cookie"))
+	})
+}
+
+func TestRedirectHandler_RedirectCrawlerPolicy(t *testing.T) {
+	const googlebot = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	mockAnalyticsService := mocks.NewMockAnalyticsServiceInterface(ctrl)
+	mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(&model.ShortLink{
+		ShortCode:   "ABCD",
+		OriginalURL: "https://example.com/?a=1&b=2",
+	}, nil).AnyTimes()
+	mockShortLinkService.EXPECT().ExpandURL(gomock.Any(), gomock.Any()).Return("https://example.com/?a=1&b=2").AnyTimes()
+	mockAnalyticsService.EXPECT().RecordAccess(gomock.Any(), "ABCD", gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	request := func(router *gin.Engine, userAgent string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		req.Header.Set("User-Agent", userAgent)
+		router.ServeHTTP(w, req)
+		time.Sleep(50 * time.Millisecond)
+		return w
+	}
+
+	t.Run("meta refresh for crawlers", func(t *testing.T) {
+		handler := NewRedirectHandler(mockShortLinkService, mockAnalyticsService, nil)
+		handler.SetCrawlerPolicy(CrawlerPolicyMetaRefresh, []string{"googlebot"})
+		router := newTestRedirectRouter(handler)
+
+		w := request(router, googlebot)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `<meta http-equiv="refresh" content="0; url=https://example.com/?a=1&amp;b=2">`)
+
+		w = request(router, "Mozilla/5.0 Chrome/120.0")
+		assert.Equal(t, http.StatusFound, w.Code)
+	})
+
+	t.Run("forbid crawlers", func(t *testing.T) {
+		handler := NewRedirectHandler(mockShortLinkService, mockAnalyticsService, nil)
+		handler.SetCrawlerPolicy(CrawlerPolicyForbid, []string{"googlebot"})
+		router := newTestRedirectRouter(handler)
+
+		w := request(router, googlebot)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("unknown policy redirects", func(t *testing.T) {
+		handler := NewRedirectHandler(mockShortLinkService, mockAnalyticsService, nil)
+		handler.SetCrawlerPolicy("index", []string{"googlebot"})
+		router := newTestRedirectRouter(handler)
+
+		w := request(router, googlebot)
+		assert.Equal(t, http.StatusFound, w.Code)
+	})
+}
+
 func TestRedirectHandler_GetStats(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -209,7 +1047,7 @@ func TestRedirectHandler_GetStats(t *testing.T) {
 			ShortCode:   shortCode,
 			OriginalURL: "https://example.com",
 		}, nil)
-		mockAnalyticsService.EXPECT().GetAnalytics(gomock.Any(), shortCode).Return(&model.AnalyticsResponse{
+		mockAnalyticsService.EXPECT().GetAnalytics(gomock.Any(), shortCode, false).Return(&model.AnalyticsResponse{
 			ShortCode:  shortCode,
 			PV:         100,
 			UV:         50,
@@ -242,7 +1080,7 @@ func TestRedirectHandler_GetStats(t *testing.T) {
 			ShortCode:   shortCode,
 			OriginalURL: "https://example.com",
 		}, nil)
-		mockAnalyticsService.EXPECT().GetAnalytics(gomock.Any(), shortCode).Return(nil, errors.New("analytics error"))
+		mockAnalyticsService.EXPECT().GetAnalytics(gomock.Any(), shortCode, false).Return(nil, errors.New("analytics error"))
 
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/api/v1/analytics/"+shortCode, nil)
@@ -250,6 +1088,53 @@ func TestRedirectHandler_GetStats(t *testing.T) {
 
 		assert.Equal(t, http.StatusInternalServerError, w.Code)
 	})
+
+	t.Run("get fresh stats", func(t *testing.T) {
+		shortCode := "ABCD"
+
+		mockShortLinkService.EXPECT().Get(gomock.Any(), shortCode).Return(&model.ShortLink{ShortCode: shortCode}, nil)
+		mockAnalyticsService.EXPECT().GetAnalytics(gomock.Any(), shortCode, true).Return(&model.AnalyticsResponse{
+			ShortCode: shortCode,
+		}, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/"+shortCode+"?fresh=true", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("get stats with invalid fresh", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/ABCD?fresh=maybe", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("get stats not modified since snapshot", func(t *testing.T) {
+		shortCode := "ABCD"
+		updatedAt := time.Unix(1700000000, 0)
+
+		mockShortLinkService.EXPECT().Get(gomock.Any(), shortCode).Return(&model.ShortLink{ShortCode: shortCode}, nil).Times(2)
+		mockAnalyticsService.EXPECT().GetAnalytics(gomock.Any(), shortCode, false).Return(&model.AnalyticsResponse{
+			ShortCode: shortCode,
+			UpdatedAt: updatedAt,
+		}, nil).Times(2)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/analytics/"+shortCode, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		etag := w.Header().Get("ETag")
+		assert.NotEmpty(t, etag)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/api/v1/analytics/"+shortCode, nil)
+		req.Header.Set("If-None-Match", etag)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+	})
 }
 
 func TestAccessLogMessage(t *testing.T) {
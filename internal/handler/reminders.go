@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"octopus/internal/model"
+	"octopus/internal/service"
+	"octopus/pkg/apiresp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReminderHandler serves the subscriptions of link owners to the reminders of their links about to
+// expire, and the extension of these links
+type ReminderHandler struct {
+	reminders service.ExpiryRemindersInterface
+}
+
+// NewReminderHandler creates a new ReminderHandler
+func NewReminderHandler(reminders service.ExpiryRemindersInterface) *ReminderHandler {
+	return &ReminderHandler{reminders: reminders}
+}
+
+// Subscribe handles PUT /api/v1/reminders
+// @Summary Subscribe to expiry reminders
+// @ID subscribeReminders
+// @Description Reminds the X-API-Key of the caller of its links about to expire, once per expiry, replacing any subscription it had. Reminders are posted to the webhook as JSON signed with the returned secret like log drain batches, and emailed. The secret is only returned here.
+// @Tags shortlink
+// @Accept json
+// @Produce json
+// @Param X-API-Key header string true "API key owning the links"
+// @Param request body model.ReminderSubscriptionRequest true "Where to send reminders"
+// @Success 200 {object} apiresp.Response{data=model.ReminderSubscription}
+// @Failure 400 {object} apiresp.ErrorResponse
+// @Failure 401 {object} apiresp.ErrorResponse
+// @Router /api/v1/reminders [put]
+func (h *ReminderHandler) Subscribe(c *gin.Context) {
+	var req model.ReminderSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if errs := validateReminderSubscriptionRequest(&req); errs != nil {
+		respondInvalid(c, errs)
+		return
+	}
+
+	sub, err := h.reminders.Subscribe(c.Request.Context(), &req)
+	if err != nil {
+		respondReminderError(c, err, "Failed to subscribe to reminders")
+		return
+	}
+
+	apiresp.OK(c, sub)
+}
+
+// Get handles GET /api/v1/reminders
+// @Summary Get the expiry reminder subscription
+// @ID getReminders
+// @Description Returns where the X-API-Key of the caller is reminded of its links about to expire, without the secret
+// @Tags shortlink
+// @Produce json
+// @Param X-API-Key header string true "API key owning the links"
+// @Success 200 {object} apiresp.Response{data=model.ReminderSubscription}
+// @Failure 401 {object} apiresp.ErrorResponse
+// @Failure 404 {object} apiresp.ErrorResponse
+// @Router /api/v1/reminders [get]
+func (h *ReminderHandler) Get(c *gin.Context) {
+	sub, err := h.reminders.Get(c.Request.Context())
+	if err != nil {
+		respondReminderError(c, err, "Failed to get reminder subscription")
+		return
+	}
+
+	apiresp.OK(c, sub)
+}
+
+// Unsubscribe handles DELETE /api/v1/reminders
+// @Summary Unsubscribe from expiry reminders
+// @ID unsubscribeReminders
+// @Description Stops reminding the X-API-Key of the caller of its links about to expire
+// @Tags shortlink
+// @Produce json
+// @Param X-API-Key header string true "API key owning the links"
+// @Success 200 {object} apiresp.Response
+// @Failure 401 {object} apiresp.ErrorResponse
+// @Failure 404 {object} apiresp.ErrorResponse
+// @Router /api/v1/reminders [delete]
+func (h *ReminderHandler) Unsubscribe(c *gin.Context) {
+	deleted, err := h.reminders.Unsubscribe(c.Request.Context())
+	if err != nil {
+		respondReminderError(c, err, "Failed to unsubscribe from reminders")
+		return
+	}
+	if !deleted {
+		apiresp.Fail(c, http.StatusNotFound, "Not subscribed to reminders")
+		return
+	}
+
+	apiresp.NoContent(c)
+}
+
+// Extend handles POST /api/v1/shortlink/:shortCode/extend
+// @Summary Extend a short link
+// @ID extendShortLink
+// @Description Pushes the expiry of a link owned by the X-API-Key of the caller back by the configured duration, counting from now for a link already expired. Reminders list this URL for each link about to expire.
+// @Tags shortlink
+// @Produce json
+// @Param shortCode path string true "Short code"
+// @Param X-API-Key header string true "API key owning the link"
+// @Success 200 {object} apiresp.Response{data=model.ExtendResponse}
+// @Failure 401 {object} apiresp.ErrorResponse
+// @Failure 403 {object} apiresp.ErrorResponse
+// @Failure 404 {object} apiresp.ErrorResponse
+// @Failure 409 {object} apiresp.ErrorResponse
+// @Router /api/v1/shortlink/{shortCode}/extend [post]
+func (h *ReminderHandler) Extend(c *gin.Context) {
+	resp, err := h.reminders.Extend(c.Request.Context(), c.Param("shortCode"))
+	if err != nil {
+		respondReminderError(c, err, "Failed to extend short link")
+		return
+	}
+
+	apiresp.OK(c, resp)
+}
+
+// respondReminderError responds to a refused subscription or extension with its reason, and to
+// other errors like claims do
+func respondReminderError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidSubscription):
+		apiresp.Fail(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrReminderNotSubscribed):
+		apiresp.Fail(c, http.StatusNotFound, "Not subscribed to reminders")
+	default:
+		respondClaimError(c, err, message)
+	}
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/internal/service"
+)
+
+func newTestReminderRouter(h *ReminderHandler) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.PUT("/api/v1/reminders", h.Subscribe)
+	router.GET("/api/v1/reminders", h.Get)
+	router.DELETE("/api/v1/reminders", h.Unsubscribe)
+	router.POST("/api/v1/shortlink/:shortCode/extend", h.Extend)
+	return router
+}
+
+func TestReminderHandler_Subscribe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		name       string
+		body       string
+		setupMock  func(m *mocks.MockExpiryRemindersInterface)
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "by webhook",
+			body: `{"webhook_url":"https://hooks.example.com/expiring"}`,
+			setupMock: func(m *mocks.MockExpiryRemindersInterface) {
+				m.EXPECT().Subscribe(gomock.Any(), &model.ReminderSubscriptionRequest{WebhookURL: "https://hooks.example.com/expiring"}).
+					Return(&model.ReminderSubscription{WebhookURL: "https://hooks.example.com/expiring", Secret: "s3cret"}, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `"secret":"s3cret"`,
+		},
+		{
+			name:       "to nowhere",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "webhook_url or email is required",
+		},
+		{
+			name:       "to a non-HTTP webhook",
+			body:       `{"webhook_url":"ftp://hooks.example.com"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "webhook_url must be an http or https URL",
+		},
+		{
+			name: "by email without mail",
+			body: `{"email":"owner@example.com"}`,
+			setupMock: func(m *mocks.MockExpiryRemindersInterface) {
+				m.EXPECT().Subscribe(gomock.Any(), gomock.Any()).Return(nil, service.ErrInvalidSubscription)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "anonymously",
+			body: `{"email":"owner@example.com"}`,
+			setupMock: func(m *mocks.MockExpiryRemindersInterface) {
+				m.EXPECT().Subscribe(gomock.Any(), gomock.Any()).Return(nil, service.ErrClaimUnauthenticated)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockReminders := mocks.NewMockExpiryRemindersInterface(ctrl)
+			if tt.setupMock != nil {
+				tt.setupMock(mockReminders)
+			}
+			router := newTestReminderRouter(NewReminderHandler(mockReminders))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", "/api/v1/reminders", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestReminderHandler_GetAndUnsubscribe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReminders := mocks.NewMockExpiryRemindersInterface(ctrl)
+	mockReminders.EXPECT().Get(gomock.Any()).Return(&model.ReminderSubscription{Email: "owner@example.com"}, nil)
+	mockReminders.EXPECT().Unsubscribe(gomock.Any()).Return(true, nil)
+	mockReminders.EXPECT().Get(gomock.Any()).Return(nil, service.ErrReminderNotSubscribed)
+	mockReminders.EXPECT().Unsubscribe(gomock.Any()).Return(false, nil)
+	router := newTestReminderRouter(NewReminderHandler(mockReminders))
+
+	serve := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/api/v1/reminders", nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("GET")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"email":"owner@example.com"`)
+	assert.Equal(t, http.StatusOK, serve("DELETE").Code)
+	assert.Equal(t, http.StatusNotFound, serve("GET").Code)
+	assert.Equal(t, http.StatusNotFound, serve("DELETE").Code)
+}
+
+func TestReminderHandler_Extend(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	expireAt := time.Date(2026, 11, 15, 12, 0, 0, 0, time.UTC)
+	mockReminders := mocks.NewMockExpiryRemindersInterface(ctrl)
+	mockReminders.EXPECT().Extend(gomock.Any(), "ABCD").Return(&model.ExtendResponse{ShortCode: "ABCD", ExpireAt: expireAt}, nil)
+	mockReminders.EXPECT().Extend(gomock.Any(), "EFGH").Return(nil, repository.ErrConflict)
+	mockReminders.EXPECT().Extend(gomock.Any(), "IJKL").Return(nil, service.ErrReadOnlyReplica)
+	router := newTestReminderRouter(NewReminderHandler(mockReminders))
+
+	serve := func(shortCode string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/shortlink/"+shortCode+"/extend", nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("ABCD")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"expire_at":"2026-11-15T12:00:00Z"`)
+	// Links that never expire are not extended
+	assert.Equal(t, http.StatusConflict, serve("EFGH").Code)
+	assert.Equal(t, http.StatusForbidden, serve("IJKL").Code)
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+
+	"octopus/internal/service"
+	"octopus/pkg/apiresp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReportHandler previews the weekly campaign report from the admin port
+type ReportHandler struct {
+	reports service.ReportServiceInterface
+}
+
+// NewReportHandler creates a new ReportHandler
+func NewReportHandler(reports service.ReportServiceInterface) *ReportHandler {
+	return &ReportHandler{reports: reports}
+}
+
+// Weekly handles GET /reports/weekly
+// @Summary Preview the weekly campaign report
+// @ID getWeeklyReport
+// @Description Compiles the report of the latest week due, as delivered by email or webhook
+// @Tags admin
+// @Produce json,html
+// @Param format query string false "json or html" default(json)
+// @Success 200 {object} apiresp.Response{data=model.WeeklyReport}
+// @Failure 400 {object} apiresp.ErrorResponse
+// @Router /reports/weekly [get]
+func (h *ReportHandler) Weekly(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "html" {
+		apiresp.Fail(c, http.StatusBadRequest, "Invalid format: must be json or html")
+		return
+	}
+
+	report, err := h.reports.LastWeek(c.Request.Context())
+	if err != nil {
+		apiresp.Fail(c, http.StatusInternalServerError, "Failed to compile report")
+		return
+	}
+
+	if format == "html" {
+		html, err := h.reports.RenderHTML(report)
+		if err != nil {
+			apiresp.Fail(c, http.StatusInternalServerError, "Failed to render report")
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", html)
+		return
+	}
+
+	apiresp.OK(c, report)
+}
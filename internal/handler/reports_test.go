@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+)
+
+func newTestReportRouter(h *ReportHandler) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.GET("/reports/weekly", h.Weekly)
+	return router
+}
+
+func TestReportHandler_Weekly(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	report := &model.WeeklyReport{Campaigns: []model.CampaignSummary{{Campaign: "spring", Links: 2}}}
+
+	tests := []struct {
+		name       string
+		query      string
+		setupMock  func(m *mocks.MockReportServiceInterface)
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:  "json",
+			query: "",
+			setupMock: func(m *mocks.MockReportServiceInterface) {
+				m.EXPECT().LastWeek(gomock.Any()).Return(report, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `"campaign":"spring"`,
+		},
+		{
+			name:  "html",
+			query: "?format=html",
+			setupMock: func(m *mocks.MockReportServiceInterface) {
+				m.EXPECT().LastWeek(gomock.Any()).Return(report, nil)
+				m.EXPECT().RenderHTML(report).Return([]byte("<h2>spring</h2>"), nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "<h2>spring</h2>",
+		},
+		{
+			name:       "invalid format",
+			query:      "?format=csv",
+			setupMock:  func(m *mocks.MockReportServiceInterface) {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "storage failure",
+			query: "",
+			setupMock: func(m *mocks.MockReportServiceInterface) {
+				m.EXPECT().LastWeek(gomock.Any()).Return(nil, errors.New("db down"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockReports := mocks.NewMockReportServiceInterface(ctrl)
+			tt.setupMock(mockReports)
+			router := newTestReportRouter(NewReportHandler(mockReports))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/reports/weekly"+tt.query, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"errors"
+
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/internal/service"
+	"octopus/pkg/apiresp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReputationHandler serves the abuse reports of links, and the reputation of their destination
+// domains on the admin port
+type ReputationHandler struct {
+	reputation service.ReputationInterface
+}
+
+// NewReputationHandler creates a new ReputationHandler
+func NewReputationHandler(reputation service.ReputationInterface) *ReputationHandler {
+	return &ReputationHandler{reputation: reputation}
+}
+
+// Report handles POST /api/v1/shortlink/:shortCode/report
+// @Summary Report a short link
+// @ID reportShortLink
+// @Description Reports a link as abusive, lowering the reputation of its destination domain. Reports of a domain count once per client IP within the report window. Domains of low reputation are redirected through a preview of the destination, and lower ones refuse new links.
+// @Tags shortlink
+// @Produce json
+// @Param shortCode path string true "Short code"
+// @Success 200 {object} apiresp.Response
+// @Failure 404 {object} apiresp.ErrorResponse
+// @Router /api/v1/shortlink/{shortCode}/report [post]
+func (h *ReputationHandler) Report(c *gin.Context) {
+	if err := h.reputation.Report(c.Request.Context(), c.Param("shortCode"), c.ClientIP()); err != nil {
+		if errors.Is(err, service.ErrShortLinkNotFound) {
+			apiresp.Fail(c, errorStatus(err), "Short link not found")
+			return
+		}
+		respondError(c, err, "Failed to report short link")
+		return
+	}
+
+	apiresp.NoContent(c)
+}
+
+// List handles GET /reputation
+// @Summary List domain reputations
+// @ID listReputations
+// @Description Returns the destination domains reported, found dead, listed by Safe Browsing or overridden, with their score from 0 to 100 and their verdict
+// @Tags admin
+// @Produce json
+// @Success 200 {object} apiresp.Response{data=[]model.DomainReputation}
+// @Router /reputation [get]
+func (h *ReputationHandler) List(c *gin.Context) {
+	reps, err := h.reputation.List(c.Request.Context())
+	if err != nil {
+		respondError(c, err, "Failed to list domain reputations")
+		return
+	}
+
+	apiresp.OK(c, reps)
+}
+
+// Get handles GET /reputation/:domain
+// @Summary Get a domain reputation
+// @ID getReputation
+// @Description Returns the reputation of the registrable domain of a host, such as example.co.uk for shop.example.co.uk
+// @Tags admin
+// @Produce json
+// @Param domain path string true "Domain"
+// @Success 200 {object} apiresp.Response{data=model.DomainReputation}
+// @Failure 400 {object} apiresp.ErrorResponse
+// @Failure 404 {object} apiresp.ErrorResponse
+// @Router /reputation/{domain} [get]
+func (h *ReputationHandler) Get(c *gin.Context) {
+	rep, err := h.reputation.Get(c.Request.Context(), c.Param("domain"))
+	if err != nil {
+		respondReputationError(c, err, "Failed to get domain reputation")
+		return
+	}
+
+	apiresp.OK(c, rep)
+}
+
+// Override handles PUT /reputation/:domain/override
+// @Summary Override a domain reputation
+// @ID overrideReputation
+// @Description Sets the verdict of a domain whatever its score, on every instance within the refresh interval: allow to clear a false positive, interstitial or block to quarantine a domain before its score does
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param domain path string true "Domain"
+// @Param request body model.ReputationOverrideRequest true "Verdict"
+// @Success 200 {object} apiresp.Response{data=model.DomainReputation}
+// @Failure 400 {object} apiresp.ErrorResponse
+// @Router /reputation/{domain}/override [put]
+func (h *ReputationHandler) Override(c *gin.Context) {
+	var req model.ReputationOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	rep, err := h.reputation.Override(c.Request.Context(), c.Param("domain"), req.Verdict)
+	if err != nil {
+		respondReputationError(c, err, "Failed to override domain reputation")
+		return
+	}
+
+	apiresp.OK(c, rep)
+}
+
+// ClearOverride handles DELETE /reputation/:domain/override
+// @Summary Clear a domain reputation override
+// @ID clearReputationOverride
+// @Description Lets the score of a domain decide its verdict again
+// @Tags admin
+// @Produce json
+// @Param domain path string true "Domain"
+// @Success 200 {object} apiresp.Response{data=model.DomainReputation}
+// @Failure 400 {object} apiresp.ErrorResponse
+// @Failure 404 {object} apiresp.ErrorResponse
+// @Router /reputation/{domain}/override [delete]
+func (h *ReputationHandler) ClearOverride(c *gin.Context) {
+	rep, err := h.reputation.ClearOverride(c.Request.Context(), c.Param("domain"))
+	if err != nil {
+		respondReputationError(c, err, "Failed to clear domain reputation override")
+		return
+	}
+
+	apiresp.OK(c, rep)
+}
+
+// respondReputationError responds to an invalid or unknown domain with its reason, and to other
+// errors with their status
+func respondReputationError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidDomain):
+		apiresp.Fail(c, errorStatus(err), "Invalid request: "+err.Error())
+	case errors.Is(err, repository.ErrNotFound):
+		apiresp.Fail(c, errorStatus(err), "Domain not found")
+	default:
+		respondError(c, err, message)
+	}
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"octopus/internal/config"
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/internal/service"
+)
+
+func newTestReputationRouter(h *ReputationHandler) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.POST("/shortlink/:shortCode/report", h.Report)
+	router.GET("/reputation", h.List)
+	router.GET("/reputation/:domain", h.Get)
+	router.PUT("/reputation/:domain/override", h.Override)
+	router.DELETE("/reputation/:domain/override", h.ClearOverride)
+	return router
+}
+
+func TestReputationHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReputation := mocks.NewMockReputationInterface(ctrl)
+	router := newTestReputationRouter(NewReputationHandler(mockReputation))
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("reports a link", func(t *testing.T) {
+		mockReputation.EXPECT().Report(gomock.Any(), "abc123", gomock.Any()).Return(nil)
+		mockReputation.EXPECT().Report(gomock.Any(), "zzz999", gomock.Any()).Return(service.ErrShortLinkNotFound)
+
+		assert.Equal(t, http.StatusOK, serve("POST", "/shortlink/abc123/report", "").Code)
+		assert.Equal(t, http.StatusNotFound, serve("POST", "/shortlink/zzz999/report", "").Code)
+	})
+
+	t.Run("lists and gets domains", func(t *testing.T) {
+		mockReputation.EXPECT().List(gomock.Any()).Return([]model.DomainReputation{
+			{Domain: "example.com", Reports: 5, Score: 50, Verdict: model.ReputationInterstitial},
+		}, nil)
+		mockReputation.EXPECT().Get(gomock.Any(), "example.org").Return(nil, fmt.Errorf("%w: domain example.org", repository.ErrNotFound))
+
+		w := serve("GET", "/reputation", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"verdict":"interstitial"`)
+		assert.Equal(t, http.StatusNotFound, serve("GET", "/reputation/example.org", "").Code)
+	})
+
+	t.Run("overrides verdicts", func(t *testing.T) {
+		mockReputation.EXPECT().Override(gomock.Any(), "example.com", model.ReputationAllow).
+			Return(&model.DomainReputation{Domain: "example.com", Override: "allow", Verdict: model.ReputationAllow}, nil)
+		mockReputation.EXPECT().ClearOverride(gomock.Any(), "example.com").
+			Return(&model.DomainReputation{Domain: "example.com", Verdict: model.ReputationInterstitial}, nil)
+		mockReputation.EXPECT().Override(gomock.Any(), "bad host", model.ReputationBlock).
+			Return(nil, fmt.Errorf("%w: %q is not a host name", service.ErrInvalidDomain, "bad host"))
+
+		w := serve("PUT", "/reputation/example.com/override", `{"verdict":"allow"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"override":"allow"`)
+		assert.Equal(t, http.StatusBadRequest, serve("PUT", "/reputation/example.com/override", `{"verdict":"maybe"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, serve("PUT", "/reputation/bad%20host/override", `{"verdict":"block"}`).Code)
+		assert.Equal(t, http.StatusOK, serve("DELETE", "/reputation/example.com/override", "").Code)
+	})
+}
+
+func TestRedirectHandler_RedirectInterstitial(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := repository.NewMemoryRepository()
+	reputation := service.NewReputation(store, store, nil, &config.ReputationConfig{InterstitialBelow: 60, BlockBelow: 30})
+	_, err := reputation.Override(context.Background(), "example.com", model.ReputationInterstitial)
+	require.NoError(t, err)
+
+	mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	handler := NewRedirectHandler(mockShortLinkService, mocks.NewMockAnalyticsServiceInterface(ctrl), nil)
+	handler.SetCacheControl("public, max-age=300")
+	handler.SetReputation(reputation)
+	router := newTestRedirectRouter(handler)
+
+	for code, target := range map[string]string{"ABCD": "https://www.example.com/?a=1&b=<2>", "EFGH": "https://example.org/"} {
+		sl := &model.ShortLink{ShortCode: code, OriginalURL: target, NoTracking: true}
+		mockShortLinkService.EXPECT().Get(gomock.Any(), code).Return(sl, nil)
+		mockShortLinkService.EXPECT().ExpandURL(sl, gomock.Any()).Return(target)
+	}
+
+	// Visitors see the destination of a quarantined domain before going on, escaped
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ABCD", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Body.String(), `<strong>www.example.com</strong>`)
+	assert.Contains(t, w.Body.String(), `>https://www.example.com/?a=1&amp;b=&lt;2&gt;</a>`)
+	assert.Contains(t, w.Body.String(), `href="/ABCD?_proceed=1"`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/EFGH", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "public, max-age=300", w.Header().Get("Cache-Control"))
+}
+
+func TestRedirectHandler_RedirectInterstitialClickLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := repository.NewMemoryRepository()
+	reputation := service.NewReputation(store, store, nil, &config.ReputationConfig{InterstitialBelow: 60, BlockBelow: 30})
+	_, err := reputation.Override(context.Background(), "example.com", model.ReputationInterstitial)
+	require.NoError(t, err)
+
+	mockShortLinkService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	handler := NewRedirectHandler(mockShortLinkService, mocks.NewMockAnalyticsServiceInterface(ctrl), nil)
+	handler.SetReputation(reputation)
+	router := newTestRedirectRouter(handler)
+
+	sl := &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/", MaxClicks: 3, NoTracking: true}
+	mockShortLinkService.EXPECT().Get(gomock.Any(), "ABCD").Return(sl, nil).Times(2)
+	mockShortLinkService.EXPECT().ExpandURL(sl, url.Values{"utm_source": {"mail"}}).Return("https://example.com/?utm_source=mail").Times(2)
+
+	// Showing the preview uses none of the clicks of the link
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ABCD?utm_source=mail", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `href="/ABCD?_proceed=1&amp;utm_source=mail"`)
+
+	// Going on does, and is redirected without the marker
+	mockShortLinkService.EXPECT().ConsumeClick(gomock.Any(), "ABCD").Return(true, false, nil)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/ABCD?_proceed=1&utm_source=mail", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://example.com/?utm_source=mail", w.Header().Get("Location"))
+}
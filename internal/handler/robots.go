@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"octopus/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RobotsHandler serves /robots.txt generated from the crawler configuration
+type RobotsHandler struct {
+	body string
+}
+
+// NewRobotsHandler creates a new RobotsHandler
+func NewRobotsHandler(cfg *config.RobotsConfig) *RobotsHandler {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	for _, path := range cfg.Allow {
+		fmt.Fprintf(&b, "Allow: %s\n", path)
+	}
+	for _, path := range cfg.Disallow {
+		fmt.Fprintf(&b, "Disallow: %s\n", path)
+	}
+	// An empty Disallow allows everything, state it explicitly when nothing is restricted
+	if len(cfg.Allow) == 0 && len(cfg.Disallow) == 0 {
+		b.WriteString("Disallow:\n")
+	}
+	if cfg.CrawlDelay > 0 {
+		fmt.Fprintf(&b, "Crawl-delay: %d\n", cfg.CrawlDelay)
+	}
+
+	return &RobotsHandler{body: b.String()}
+}
+
+// Robots handles GET /robots.txt
+// @Summary Get crawler rules
+// @ID getRobots
+// @Description Returns the robots.txt rules for the short link domain
+// @Tags crawler
+// @Produce plain
+// @Success 200 {string} string
+// @Router /robots.txt [get]
+func (h *RobotsHandler) Robots(c *gin.Context) {
+	c.String(http.StatusOK, h.body)
+}
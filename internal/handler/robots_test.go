@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"octopus/internal/config"
+)
+
+func TestRobotsHandler_Robots(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.RobotsConfig
+		expected string
+	}{
+		{
+			name:     "allow everything by default",
+			cfg:      config.RobotsConfig{},
+			expected: "User-agent: *\nDisallow:\n",
+		},
+		{
+			name: "configured rules",
+			cfg: config.RobotsConfig{
+				Allow:      []string{"/health"},
+				Disallow:   []string{"/"},
+				CrawlDelay: 10,
+			},
+			expected: "User-agent: *\nAllow: /health\nDisallow: /\nCrawl-delay: 10\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/robots.txt", NewRobotsHandler(&tt.cfg).Robots)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/robots.txt", nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expected, w.Body.String())
+			assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+		})
+	}
+}
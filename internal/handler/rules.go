@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"octopus/internal/model"
+	"octopus/internal/service"
+	"octopus/pkg/apiresp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RuleHandler serves the bot, reserved word, URL blocklist and traffic source rules on the admin
+// port
+type RuleHandler struct {
+	rules service.RulesInterface
+}
+
+// NewRuleHandler creates a new RuleHandler
+func NewRuleHandler(rules service.RulesInterface) *RuleHandler {
+	return &RuleHandler{rules: rules}
+}
+
+// List handles GET /rules
+// @Summary List rules
+// @ID listRules
+// @Description Returns the rules set at runtime, of one kind or of all kinds, by kind and pattern
+// @Tags admin
+// @Produce json
+// @Param kind query string false "Kind of rules" Enums(bot_ua, reserved_word, url_blocklist, source)
+// @Success 200 {object} apiresp.Response{data=[]model.Rule}
+// @Router /rules [get]
+func (h *RuleHandler) List(c *gin.Context) {
+	rules, err := h.rules.List(c.Request.Context(), c.Query("kind"))
+	if err != nil {
+		respondError(c, err, "Failed to list rules")
+		return
+	}
+
+	apiresp.OK(c, rules)
+}
+
+// Create handles POST /rules
+// @Summary Add a rule
+// @ID createRule
+// @Description Adds a rule applied by every instance once announced on the rules channel. User-Agents containing a bot_ua pattern count as bots; short codes spelling a reserved_word are never generated; links to a url_blocklist domain or its subdomains are refused; referers whose host contains a source pattern are reported under its source. Patterns are matched case-insensitively.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body model.RuleRequest true "Rule to add"
+// @Success 200 {object} apiresp.Response{data=model.Rule}
+// @Failure 400 {object} apiresp.ErrorResponse
+// @Failure 409 {object} apiresp.ErrorResponse
+// @Router /rules [post]
+func (h *RuleHandler) Create(c *gin.Context) {
+	var req model.RuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	rule, err := h.rules.Create(c.Request.Context(), &req)
+	if err != nil {
+		h.respondRuleError(c, err, "Failed to create rule")
+		return
+	}
+
+	apiresp.OK(c, rule)
+}
+
+// Update handles PUT /rules/:id
+// @Summary Replace a rule
+// @ID updateRule
+// @Description Replaces the kind, pattern and source of a rule on every instance
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Rule ID"
+// @Param request body model.RuleRequest true "New rule"
+// @Success 200 {object} apiresp.Response{data=model.Rule}
+// @Failure 400 {object} apiresp.ErrorResponse
+// @Failure 404 {object} apiresp.ErrorResponse
+// @Failure 409 {object} apiresp.ErrorResponse
+// @Router /rules/{id} [put]
+func (h *RuleHandler) Update(c *gin.Context) {
+	id, ok := parseRuleID(c)
+	if !ok {
+		return
+	}
+	var req model.RuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	rule, err := h.rules.Update(c.Request.Context(), id, &req)
+	if err != nil {
+		h.respondRuleError(c, err, "Failed to update rule")
+		return
+	}
+
+	apiresp.OK(c, rule)
+}
+
+// Delete handles DELETE /rules/:id
+// @Summary Remove a rule
+// @ID deleteRule
+// @Description Removes a rule from every instance
+// @Tags admin
+// @Produce json
+// @Param id path int true "Rule ID"
+// @Success 200 {object} apiresp.Response
+// @Failure 404 {object} apiresp.ErrorResponse
+// @Router /rules/{id} [delete]
+func (h *RuleHandler) Delete(c *gin.Context) {
+	id, ok := parseRuleID(c)
+	if !ok {
+		return
+	}
+
+	deleted, err := h.rules.Delete(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "Failed to delete rule")
+		return
+	}
+	if !deleted {
+		apiresp.Fail(c, http.StatusNotFound, "Rule not found")
+		return
+	}
+
+	apiresp.NoContent(c)
+}
+
+// respondRuleError responds to a rejected rule with 400, and to other errors with their status
+func (h *RuleHandler) respondRuleError(c *gin.Context, err error, message string) {
+	if errors.Is(err, service.ErrInvalidRule) {
+		apiresp.Fail(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	respondError(c, err, message)
+}
+
+// parseRuleID parses the rule ID of the path, responding with 400 when it is not one
+func parseRuleID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		apiresp.Fail(c, http.StatusBadRequest, "Invalid request: id must be a positive integer")
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/internal/service"
+)
+
+func newTestRuleRouter(h *RuleHandler) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.GET("/rules", h.List)
+	router.POST("/rules", h.Create)
+	router.PUT("/rules/:id", h.Update)
+	router.DELETE("/rules/:id", h.Delete)
+	return router
+}
+
+func TestRuleHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRules := mocks.NewMockRulesInterface(ctrl)
+	router := newTestRuleRouter(NewRuleHandler(mockRules))
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("lists the rules of a kind", func(t *testing.T) {
+		mockRules.EXPECT().List(gomock.Any(), model.RuleKindBotUA).Return([]model.Rule{
+			{ID: 1, Kind: model.RuleKindBotUA, Pattern: "headlesschrome"},
+		}, nil)
+
+		w := serve("GET", "/rules?kind=bot_ua", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"pattern":"headlesschrome"`)
+	})
+
+	t.Run("creates a source rule", func(t *testing.T) {
+		req := &model.RuleRequest{Kind: model.RuleKindSource, Pattern: "news.example.com", Source: "newsletter"}
+		mockRules.EXPECT().Create(gomock.Any(), req).Return(&model.Rule{ID: 2, Kind: req.Kind, Pattern: req.Pattern, Source: req.Source}, nil)
+
+		w := serve("POST", "/rules", `{"kind":"source","pattern":"news.example.com","source":"newsletter"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"source":"newsletter"`)
+	})
+
+	t.Run("rejected rules", func(t *testing.T) {
+		mockRules.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("%w: source rules need a source", service.ErrInvalidRule))
+		mockRules.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("failed to save rule: %w", repository.ErrConflict))
+
+		assert.Equal(t, http.StatusBadRequest, serve("POST", "/rules", `{"kind":"source","pattern":"example.com"}`).Code)
+		assert.Equal(t, http.StatusConflict, serve("POST", "/rules", `{"kind":"bot_ua","pattern":"curl"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, serve("POST", "/rules", `{"kind":"regex","pattern":"curl"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, serve("POST", "/rules", `{"kind":"bot_ua"}`).Code)
+	})
+
+	t.Run("updates a rule", func(t *testing.T) {
+		mockRules.EXPECT().Update(gomock.Any(), int64(1), gomock.Any()).Return(&model.Rule{ID: 1, Kind: model.RuleKindBotUA, Pattern: "wget"}, nil)
+		mockRules.EXPECT().Update(gomock.Any(), int64(9), gomock.Any()).Return(nil, fmt.Errorf("failed to update rule: %w", repository.ErrNotFound))
+
+		assert.Equal(t, http.StatusOK, serve("PUT", "/rules/1", `{"kind":"bot_ua","pattern":"wget"}`).Code)
+		assert.Equal(t, http.StatusNotFound, serve("PUT", "/rules/9", `{"kind":"bot_ua","pattern":"wget"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, serve("PUT", "/rules/abc", `{"kind":"bot_ua","pattern":"wget"}`).Code)
+	})
+
+	t.Run("deletes a rule", func(t *testing.T) {
+		mockRules.EXPECT().Delete(gomock.Any(), int64(1)).Return(true, nil)
+		mockRules.EXPECT().Delete(gomock.Any(), int64(2)).Return(false, nil)
+
+		assert.Equal(t, http.StatusOK, serve("DELETE", "/rules/1", "").Code)
+		assert.Equal(t, http.StatusNotFound, serve("DELETE", "/rules/2", "").Code)
+	})
+}
@@ -0,0 +1,379 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"octopus/internal/model"
+	"octopus/internal/service"
+	"octopus/pkg/apiresp"
+	"octopus/pkg/apiversion"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ShortLinkHandler handles short link inspection
+type ShortLinkHandler struct {
+	service service.ShortLinkServiceInterface
+}
+
+// NewShortLinkHandler creates a new ShortLinkHandler
+func NewShortLinkHandler(service service.ShortLinkServiceInterface) *ShortLinkHandler {
+	return &ShortLinkHandler{service: service}
+}
+
+// Lookup handles GET /api/v1/shortlink/lookup
+// @Summary Find existing short links for a URL
+// @ID lookupShortLinks
+// @Description Returns all short links pointing at the normalized destination URL, across params variants
+// @Tags shortlink
+// @Produce json
+// @Param url query string true "Destination URL"
+// @Success 200 {object} apiresp.Response{data=model.LookupResponse}
+// @Router /api/v1/shortlink/lookup [get]
+func (h *ShortLinkHandler) Lookup(c *gin.Context) {
+	rawURL := c.Query("url")
+	if rawURL == "" {
+		apiresp.Fail(c, http.StatusBadRequest, "Invalid request: url is required")
+		return
+	}
+
+	resp, err := h.service.Lookup(c.Request.Context(), rawURL)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidURL) {
+			apiresp.Fail(c, http.StatusBadRequest, "Invalid request: url must be an absolute URL")
+			return
+		}
+		respondError(c, err, "Failed to look up short links")
+		return
+	}
+
+	apiresp.OK(c, resp)
+}
+
+// Search handles GET /api/v1/shortlink/search
+// @Summary Search short links
+// @ID searchShortLinks
+// @Description Full-text search over the title, notes and destination URL of short links, most relevant first
+// @Tags shortlink
+// @Produce json
+// @Param q query string true "Search terms"
+// @Param offset query int false "Results to skip, from the previous page's next_offset"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Success 200 {object} apiresp.Response{data=model.SearchResponse}
+// @Router /api/v1/shortlink/search [get]
+func (h *ShortLinkHandler) Search(c *gin.Context) {
+	cursors := apiversion.From(c).Cursors
+	q, err := parseSearchQuery(c, cursors)
+	if err != nil {
+		apiresp.Fail(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	resp, err := h.service.Search(c.Request.Context(), q)
+	if err != nil {
+		respondError(c, err, "Failed to search short links")
+		return
+	}
+
+	if cursors {
+		if resp.NextOffset > 0 {
+			apiresp.OK(c, apiresp.NewPage(resp.Links, apiresp.EncodeOffset(resp.NextOffset)))
+			return
+		}
+		// The last page tells the number of matches without counting them
+		apiresp.OK(c, apiresp.NewPage(resp.Links, "").WithTotal(int64(q.Offset+len(resp.Links))))
+		return
+	}
+	apiresp.OK(c, resp)
+}
+
+// BatchGet handles POST /api/v1/shortlink/batchGet
+// @Summary Get many short links at once
+// @ID batchGetShortLinks
+// @Description Returns the destination URL, status, expiry and metadata of up to 500 short links in one call, in request order. Cached links are read with one MGET and the others with one MySQL query. Codes of links that do not exist are listed in missing.
+// @Tags shortlink
+// @Accept json
+// @Produce json
+// @Param request body model.BatchGetRequest true "Short codes to get"
+// @Success 200 {object} apiresp.Response{data=model.BatchGetResponse}
+// @Failure 400 {object} apiresp.ErrorResponse
+// @Router /api/v1/shortlink/batchGet [post]
+func (h *ShortLinkHandler) BatchGet(c *gin.Context) {
+	var req model.BatchGetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	resp, err := h.service.BatchGet(c.Request.Context(), req.ShortCodes)
+	if err != nil {
+		respondError(c, err, "Failed to get short links")
+		return
+	}
+
+	apiresp.OK(c, resp)
+}
+
+// parseSearchQuery builds a search query from the request's query parameters, the page starting
+// at the cursor parameter rather than the offset one with cursors
+func parseSearchQuery(c *gin.Context, cursors bool) (*model.SearchQuery, error) {
+	q := &model.SearchQuery{Query: strings.TrimSpace(c.Query("q"))}
+	if q.Query == "" {
+		return nil, errors.New("q is required")
+	}
+
+	if cursors {
+		page, err := apiresp.ParsePageQuery(c)
+		if err != nil {
+			return nil, err
+		}
+		if page.Cursor != "" {
+			if q.Offset, err = apiresp.OffsetOf(page.Cursor); err != nil {
+				return nil, err
+			}
+		}
+		q.Limit = page.Limit
+		return q, nil
+	}
+
+	if offset := c.Query("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return nil, errors.New("offset must be a non-negative integer")
+		}
+		q.Offset = n
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return nil, errors.New("limit must be a positive integer")
+		}
+		q.Limit = n
+	}
+
+	return q, nil
+}
+
+// Resolve handles GET /api/v1/shortlink/:shortCode/resolve
+// @Summary Resolve a short link without redirecting
+// @ID resolveShortLink
+// @Description Returns the destination URL, status, expiry and metadata of a short link
+// @Tags shortlink
+// @Produce json
+// @Param shortCode path string true "Short code"
+// @Success 200 {object} apiresp.Response{data=model.ResolveResponse}
+// @Router /api/v1/shortlink/{shortCode}/resolve [get]
+func (h *ShortLinkHandler) Resolve(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+
+	resp, err := h.service.Resolve(c.Request.Context(), shortCode)
+	if err != nil {
+		if errors.Is(err, service.ErrShortLinkNotFound) {
+			apiresp.Fail(c, http.StatusNotFound, "Short link not found")
+			return
+		}
+		respondError(c, err, "Failed to resolve short link")
+		return
+	}
+
+	apiresp.OK(c, resp)
+}
+
+// Update handles PATCH /api/v1/shortlink/:shortCode
+// @Summary Update the metadata of a short link
+// @ID updateShortLink
+// @Description Sets the title, description, notes, public stats, tracking, Cache-Control, allowed referrers and country settings of a short link, omitted fields are left unchanged. An empty cache_control falls back to the configured one, empty allowed_referrers let the link be opened from anywhere. Countries set in allowed_countries clear blocked_countries and the other way around. A schedule without rules removes the schedule.
+// @Tags shortlink
+// @Accept json
+// @Produce json
+// @Param shortCode path string true "Short code"
+// @Param request body model.UpdateRequest true "Update request"
+// @Success 200 {object} apiresp.Response{data=model.ResolveResponse}
+// @Router /api/v1/shortlink/{shortCode} [patch]
+func (h *ShortLinkHandler) Update(c *gin.Context) {
+	var req model.UpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiresp.Fail(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	if req.CacheControl != nil && *req.CacheControl != "" {
+		if errs := validateCacheControl(*req.CacheControl); errs != nil {
+			respondInvalid(c, errs)
+			return
+		}
+	}
+	if req.AllowedReferrers != nil {
+		if errs := validateReferrers(*req.AllowedReferrers); errs != nil {
+			respondInvalid(c, errs)
+			return
+		}
+	}
+	if req.AllowedCountries != nil || req.BlockedCountries != nil {
+		var allowed, blocked []string
+		if req.AllowedCountries != nil {
+			allowed = *req.AllowedCountries
+		}
+		if req.BlockedCountries != nil {
+			blocked = *req.BlockedCountries
+		}
+		if errs := validateCountries(allowed, blocked); errs != nil {
+			respondInvalid(c, errs)
+			return
+		}
+	}
+	if errs := validateSchedule(req.Schedule); errs != nil {
+		respondInvalid(c, errs)
+		return
+	}
+
+	resp, err := h.service.Update(c.Request.Context(), c.Param("shortCode"), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrShortLinkNotFound) {
+			apiresp.Fail(c, http.StatusNotFound, "Short link not found")
+			return
+		}
+		respondError(c, err, "Failed to update short link")
+		return
+	}
+
+	apiresp.OK(c, resp)
+}
+
+// Sign handles POST /api/v1/shortlink/:shortCode/sign
+// @Summary Sign params appended to a short link
+// @ID signShortLinkParams
+// @Description Returns the short link with the params appended and signed, for links created with signed_params. Redirects of these links refuse params without a matching signature with 403. In self-serve mode only the owner of the link, by X-API-Key, may sign its params.
+// @Tags shortlink
+// @Accept json
+// @Produce json
+// @Param shortCode path string true "Short code"
+// @Param request body model.SignParamsRequest true "Params to sign"
+// @Success 200 {object} apiresp.Response{data=model.SignParamsResponse}
+// @Failure 400 {object} apiresp.ErrorResponse
+// @Failure 401 {object} apiresp.ErrorResponse
+// @Failure 403 {object} apiresp.ErrorResponse
+// @Failure 404 {object} apiresp.ErrorResponse
+// @Router /api/v1/shortlink/{shortCode}/sign [post]
+func (h *ShortLinkHandler) Sign(c *gin.Context) {
+	var req model.SignParamsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if errs := validateParams(req.Params); len(errs) > 0 {
+		respondInvalid(c, errs)
+		return
+	}
+
+	resp, err := h.service.SignParams(c.Request.Context(), c.Param("shortCode"), req.Params)
+	if err != nil {
+		respondClaimError(c, err, "Failed to sign params: "+err.Error())
+		return
+	}
+
+	apiresp.OK(c, resp)
+}
+
+// BulkStatus handles POST /api/v1/shortlink/bulk/status
+// @Summary Disable or enable many short links
+// @ID bulkUpdateShortLinkStatus
+// @Description Disables the links of short_codes or of a campaign, the value of the param campaigns are reported under, or enables them again, in one transaction. Their cached copies are dropped and their redirects purged from the CDN edge. Only the links whose status changed are listed.
+// @Tags shortlink
+// @Accept json
+// @Produce json
+// @Param request body model.BulkStatusRequest true "Links to change and their new status"
+// @Success 200 {object} apiresp.Response{data=model.BulkResponse}
+// @Failure 400 {object} apiresp.ErrorResponse
+// @Router /api/v1/shortlink/bulk/status [post]
+func (h *ShortLinkHandler) BulkStatus(c *gin.Context) {
+	var req model.BulkStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if errs := validateBulkSelector(&req.BulkSelector); errs != nil {
+		respondInvalid(c, errs)
+		return
+	}
+
+	resp, err := h.service.BulkUpdateStatus(c.Request.Context(), &req)
+	if err != nil {
+		respondError(c, err, "Failed to change short links: "+err.Error())
+		return
+	}
+
+	apiresp.OK(c, resp)
+}
+
+// BulkExpire handles POST /api/v1/shortlink/bulk/expire
+// @Summary Set when many short links expire
+// @ID bulkUpdateShortLinkExpiry
+// @Description Sets the expiry of the links of short_codes or of a campaign in one transaction. A time in the past expires them right away, no expire_at makes them never expire. Their cached copies are dropped and their redirects purged from the CDN edge. Only the links whose expiry changed are listed.
+// @Tags shortlink
+// @Accept json
+// @Produce json
+// @Param request body model.BulkExpireRequest true "Links to change and their new expiry"
+// @Success 200 {object} apiresp.Response{data=model.BulkResponse}
+// @Failure 400 {object} apiresp.ErrorResponse
+// @Router /api/v1/shortlink/bulk/expire [post]
+func (h *ShortLinkHandler) BulkExpire(c *gin.Context) {
+	var req model.BulkExpireRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if errs := validateBulkExpireRequest(&req); errs != nil {
+		respondInvalid(c, errs)
+		return
+	}
+
+	resp, err := h.service.BulkUpdateExpiry(c.Request.Context(), &req)
+	if err != nil {
+		respondError(c, err, "Failed to change short links: "+err.Error())
+		return
+	}
+
+	apiresp.OK(c, resp)
+}
+
+// Reconcile handles PUT /api/v1/shortlink/declarative
+// @Summary Reconcile links managed as code
+// @ID reconcileShortLinks
+// @Description Creates, updates and disables managed links to match the desired state and returns the diff
+// @Tags shortlink
+// @Accept json
+// @Produce json
+// @Param request body model.DeclarativeRequest true "Desired state of all managed links"
+// @Param dry_run query bool false "Compute the diff without applying it"
+// @Success 200 {object} apiresp.Response{data=model.DeclarativeResponse}
+// @Failure 401 {object} apiresp.ErrorResponse
+// @Failure 403 {object} apiresp.ErrorResponse
+// @Router /api/v1/shortlink/declarative [put]
+func (h *ShortLinkHandler) Reconcile(c *gin.Context) {
+	var req model.DeclarativeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiresp.Fail(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		apiresp.Fail(c, http.StatusBadRequest, "Invalid request: dry_run must be a boolean")
+		return
+	}
+
+	resp, err := h.service.Reconcile(c.Request.Context(), &req, dryRun)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAlias) {
+			apiresp.Fail(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+			return
+		}
+		respondClaimError(c, err, "Failed to reconcile short links: "+err.Error())
+		return
+	}
+
+	apiresp.OK(c, resp)
+}
@@ -0,0 +1,515 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/internal/service"
+)
+
+func newTestShortLinkRouter(h *ShortLinkHandler) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.GET("/api/v1/shortlink/lookup", h.Lookup)
+	router.GET("/api/v1/shortlink/search", h.Search)
+	router.POST("/api/v1/shortlink/batchGet", h.BatchGet)
+	router.GET("/api/v1/shortlink/:shortCode/resolve", h.Resolve)
+	router.PATCH("/api/v1/shortlink/:shortCode", h.Update)
+	router.POST("/api/v1/shortlink/:shortCode/sign", h.Sign)
+	router.PUT("/api/v1/shortlink/declarative", h.Reconcile)
+	router.POST("/api/v1/shortlink/bulk/status", h.BulkStatus)
+	router.POST("/api/v1/shortlink/bulk/expire", h.BulkExpire)
+	return router
+}
+
+func TestShortLinkHandler_Resolve(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	router := newTestShortLinkRouter(NewShortLinkHandler(mockService))
+
+	t.Run("resolve successfully", func(t *testing.T) {
+		mockService.EXPECT().Resolve(gomock.Any(), "ABCD").Return(&model.ResolveResponse{
+			ShortCode:   "ABCD",
+			OriginalURL: "https://example.com",
+			Status:      model.LinkStatusActive,
+		}, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/shortlink/ABCD/resolve", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"original_url":"https://example.com"`)
+		assert.Contains(t, w.Body.String(), `"status":"active"`)
+	})
+
+	t.Run("short link not found", func(t *testing.T) {
+		mockService.EXPECT().Resolve(gomock.Any(), "NONE").Return(nil, service.ErrShortLinkNotFound)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/shortlink/NONE/resolve", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("service error", func(t *testing.T) {
+		mockService.EXPECT().Resolve(gomock.Any(), "ABCD").Return(nil, errors.New("db error"))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/shortlink/ABCD/resolve", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+
+	t.Run("storage unavailable", func(t *testing.T) {
+		mockService.EXPECT().Resolve(gomock.Any(), "ABCD").Return(nil, fmt.Errorf("failed to get short link: %w", repository.ErrUnavailable))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/shortlink/ABCD/resolve", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":503`)
+	})
+}
+
+func TestShortLinkHandler_Lookup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	router := newTestShortLinkRouter(NewShortLinkHandler(mockService))
+
+	t.Run("lookup successfully", func(t *testing.T) {
+		mockService.EXPECT().Lookup(gomock.Any(), "https://example.com/?a=1").Return(&model.LookupResponse{
+			URL: "https://example.com/?a=1",
+			Links: []model.ResolveResponse{
+				{ShortCode: "ABCD", OriginalURL: "https://example.com/?a=1"},
+				{ShortCode: "EFGH", OriginalURL: "https://EXAMPLE.com?a=1"},
+			},
+		}, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/shortlink/lookup?url="+url.QueryEscape("https://example.com/?a=1"), nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"short_code":"ABCD"`)
+		assert.Contains(t, w.Body.String(), `"short_code":"EFGH"`)
+	})
+
+	t.Run("missing url", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/shortlink/lookup", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("invalid url", func(t *testing.T) {
+		mockService.EXPECT().Lookup(gomock.Any(), "not-a-url").Return(nil, service.ErrInvalidURL)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/shortlink/lookup?url=not-a-url", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("service error", func(t *testing.T) {
+		mockService.EXPECT().Lookup(gomock.Any(), gomock.Any()).Return(nil, errors.New("db error"))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/shortlink/lookup?url=https://example.com", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func TestShortLinkHandler_Update(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	router := newTestShortLinkRouter(NewShortLinkHandler(mockService))
+
+	t.Run("update successfully", func(t *testing.T) {
+		mockService.EXPECT().Update(gomock.Any(), "ABCD", gomock.Any()).DoAndReturn(
+			func(_ interface{}, _ string, req *model.UpdateRequest) (*model.ResolveResponse, error) {
+				assert.Equal(t, "Spring sale", *req.Title)
+				assert.Nil(t, req.Description)
+				return &model.ResolveResponse{ShortCode: "ABCD", Title: *req.Title}, nil
+			})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PATCH", "/api/v1/shortlink/ABCD", strings.NewReader(`{"title":"Spring sale"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"title":"Spring sale"`)
+	})
+
+	t.Run("title too long", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		body := `{"title":"` + strings.Repeat("a", 256) + `"}`
+		req, _ := http.NewRequest("PATCH", "/api/v1/shortlink/ABCD", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("invalid cache control", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PATCH", "/api/v1/shortlink/ABCD", strings.NewReader(`{"cache_control":"forever"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"cache_control"`)
+	})
+
+	t.Run("invalid allowed referrers", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PATCH", "/api/v1/shortlink/ABCD", strings.NewReader(`{"allowed_referrers":["*.example.com"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"allowed_referrers[0]"`)
+	})
+
+	t.Run("short link not found", func(t *testing.T) {
+		mockService.EXPECT().Update(gomock.Any(), "NONE", gomock.Any()).Return(nil, service.ErrShortLinkNotFound)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PATCH", "/api/v1/shortlink/NONE", strings.NewReader(`{"notes":"x"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestShortLinkHandler_Sign(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	router := newTestShortLinkRouter(NewShortLinkHandler(mockService))
+
+	t.Run("sign successfully", func(t *testing.T) {
+		mockService.EXPECT().SignParams(gomock.Any(), "ABCD", map[string]interface{}{"coupon": "SPRING10"}).Return(&model.SignParamsResponse{
+			ShortLink: "https://s.example.com/ABCD?coupon=SPRING10&sig=k1.c2ln",
+			Sig:       "k1.c2ln",
+		}, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/shortlink/ABCD/sign", strings.NewReader(`{"params":{"coupon":"SPRING10"}}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"sig":"k1.c2ln"`)
+	})
+
+	t.Run("invalid param", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/shortlink/ABCD/sign", strings.NewReader(`{"params":{"coupon":["A","B"]}}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"params.coupon"`)
+	})
+
+	t.Run("signing not configured", func(t *testing.T) {
+		mockService.EXPECT().SignParams(gomock.Any(), "ABCD", gomock.Any()).Return(nil, service.ErrParamSigningDisabled)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/shortlink/ABCD/sign", strings.NewReader(`{"params":{"coupon":"SPRING10"}}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("short link not found", func(t *testing.T) {
+		mockService.EXPECT().SignParams(gomock.Any(), "NONE", gomock.Any()).Return(nil, service.ErrShortLinkNotFound)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/shortlink/NONE/sign", strings.NewReader(`{"params":{"coupon":"SPRING10"}}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("only the owner signs", func(t *testing.T) {
+		for err, status := range map[error]int{service.ErrClaimUnauthenticated: http.StatusUnauthorized, service.ErrNotOwner: http.StatusForbidden} {
+			mockService.EXPECT().SignParams(gomock.Any(), "ABCD", gomock.Any()).Return(nil, err)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/shortlink/ABCD/sign", strings.NewReader(`{"params":{"coupon":"SPRING10"}}`))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, status, w.Code)
+		}
+	})
+}
+
+func TestShortLinkHandler_Search(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	router := newTestShortLinkRouter(NewShortLinkHandler(mockService))
+
+	t.Run("search successfully", func(t *testing.T) {
+		mockService.EXPECT().Search(gomock.Any(), &model.SearchQuery{Query: "spring sale", Offset: 20, Limit: 10}).Return(&model.SearchResponse{
+			Query:      "spring sale",
+			Links:      []model.ResolveResponse{{ShortCode: "ABCD", Title: "Spring sale"}},
+			NextOffset: 30,
+		}, nil)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/shortlink/search?q=spring+sale&offset=20&limit=10", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"title":"Spring sale"`)
+		assert.Contains(t, w.Body.String(), `"next_offset":30`)
+	})
+
+	for _, query := range []string{"", "?q=+", "?q=a&offset=-1", "?q=a&limit=0", "?q=a&limit=x"} {
+		t.Run("invalid query "+query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/shortlink/search"+query, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+
+	t.Run("storage unavailable", func(t *testing.T) {
+		mockService.EXPECT().Search(gomock.Any(), gomock.Any()).Return(nil, repository.ErrUnavailable)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/shortlink/search?q=spring", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+}
+
+func TestShortLinkHandler_Reconcile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	router := newTestShortLinkRouter(NewShortLinkHandler(mockService))
+
+	body := `{"links":[{"alias":"DOCS","url":"https://docs.example.com","title":"Docs"}]}`
+
+	t.Run("dry run", func(t *testing.T) {
+		mockService.EXPECT().Reconcile(gomock.Any(), gomock.Any(), true).DoAndReturn(
+			func(_ interface{}, req *model.DeclarativeRequest, _ bool) (*model.DeclarativeResponse, error) {
+				assert.Equal(t, []model.DeclarativeLink{{Alias: "DOCS", URL: "https://docs.example.com", Title: "Docs"}}, req.Links)
+				return &model.DeclarativeResponse{DryRun: true, Created: []string{"DOCS"}}, nil
+			})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/shortlink/declarative?dry_run=true", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"created":["DOCS"]`)
+		assert.Contains(t, w.Body.String(), `"dry_run":true`)
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		for _, body := range []string{`{}`, `{"links":[{"alias":"DOCS"}]}`, `{"links":[{"alias":"DOCS","url":"not a url"}]}`} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", "/api/v1/shortlink/declarative", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		}
+	})
+
+	t.Run("invalid alias", func(t *testing.T) {
+		mockService.EXPECT().Reconcile(gomock.Any(), gomock.Any(), false).Return(nil, fmt.Errorf("%w: \"d\"", service.ErrInvalidAlias))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/shortlink/declarative", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("alias taken", func(t *testing.T) {
+		mockService.EXPECT().Reconcile(gomock.Any(), gomock.Any(), false).Return(nil, fmt.Errorf("%w: \"DOCS\"", service.ErrAliasTaken))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/shortlink/declarative", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("no API key in self-serve mode", func(t *testing.T) {
+		mockService.EXPECT().Reconcile(gomock.Any(), gomock.Any(), false).Return(nil, service.ErrClaimUnauthenticated)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/shortlink/declarative", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("alias of another API key", func(t *testing.T) {
+		mockService.EXPECT().Reconcile(gomock.Any(), gomock.Any(), false).Return(nil, fmt.Errorf("%w: \"DOCS\"", service.ErrNotOwner))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/shortlink/declarative", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestShortLinkHandler_Bulk(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	router := newTestShortLinkRouter(NewShortLinkHandler(mockService))
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("disables links by short code", func(t *testing.T) {
+		mockService.EXPECT().BulkUpdateStatus(gomock.Any(), &model.BulkStatusRequest{
+			BulkSelector: model.BulkSelector{ShortCodes: []string{"ABCD", "EFGH"}},
+			Status:       model.BulkStatusDisabled,
+		}).Return(&model.BulkResponse{Updated: []string{"ABCD"}}, nil)
+
+		w := post("/api/v1/shortlink/bulk/status", `{"short_codes":["ABCD","EFGH"],"status":"disabled"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"updated":["ABCD"]`)
+	})
+
+	t.Run("expires the links of a campaign", func(t *testing.T) {
+		mockService.EXPECT().BulkUpdateExpiry(gomock.Any(), &model.BulkExpireRequest{
+			BulkSelector: model.BulkSelector{Campaign: "spring"},
+			ExpireAt:     "2026-10-16T12:00:00Z",
+		}).Return(&model.BulkResponse{Updated: []string{}}, nil)
+
+		w := post("/api/v1/shortlink/bulk/expire", `{"campaign":"spring","expire_at":"2026-10-16T12:00:00Z"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		for path, bodies := range map[string][]string{
+			"/api/v1/shortlink/bulk/status": {
+				`{"status":"disabled"}`,
+				`{"short_codes":["ABCD"],"campaign":"spring","status":"disabled"}`,
+				`{"short_codes":["ABCD"],"status":"deleted"}`,
+			},
+			"/api/v1/shortlink/bulk/expire": {
+				`{"expire_at":"2026-10-16T12:00:00Z"}`,
+				`{"campaign":"spring","expire_at":"tomorrow"}`,
+			},
+		} {
+			for _, body := range bodies {
+				w := post(path, body)
+				assert.Equal(t, http.StatusBadRequest, w.Code, body)
+			}
+		}
+	})
+
+	t.Run("read-only replica", func(t *testing.T) {
+		mockService.EXPECT().BulkUpdateStatus(gomock.Any(), gomock.Any()).Return(nil, service.ErrReadOnlyReplica)
+
+		w := post("/api/v1/shortlink/bulk/status", `{"campaign":"spring","status":"active"}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestShortLinkHandler_BatchGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockShortLinkServiceInterface(ctrl)
+	router := newTestShortLinkRouter(NewShortLinkHandler(mockService))
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/shortlink/batchGet", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("returns links and missing codes", func(t *testing.T) {
+		mockService.EXPECT().BatchGet(gomock.Any(), []string{"ABCD", "EFGH"}).Return(&model.BatchGetResponse{
+			Links:   []model.ResolveResponse{{ShortCode: "ABCD", OriginalURL: "https://example.com"}},
+			Missing: []string{"EFGH"},
+		}, nil)
+
+		w := post(`{"short_codes":["ABCD","EFGH"]}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"short_code":"ABCD"`)
+		assert.Contains(t, w.Body.String(), `"missing":["EFGH"]`)
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		codes := make([]string, 501)
+		for i := range codes {
+			codes[i] = fmt.Sprintf(`"C%03d"`, i)
+		}
+		for _, body := range []string{
+			`{}`,
+			`{"short_codes":[]}`,
+			`{"short_codes":[` + strings.Join(codes, ",") + `]}`,
+		} {
+			w := post(body)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("storage failure", func(t *testing.T) {
+		mockService.EXPECT().BatchGet(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection refused"))
+
+		w := post(`{"short_codes":["ABCD"]}`)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
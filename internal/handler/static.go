@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// staticMaxAge is how long browsers and CDNs may cache static assets
+const staticMaxAge = "public, max-age=86400"
+
+// StaticHandler serves the favicon and embedded static assets
+type StaticHandler struct {
+	assets  fs.FS
+	modTime time.Time
+}
+
+// NewStaticHandler creates a new StaticHandler
+func NewStaticHandler(assets fs.FS) *StaticHandler {
+	// Embedded files carry no modification time, the build is the best approximation
+	return &StaticHandler{
+		assets:  assets,
+		modTime: time.Now(),
+	}
+}
+
+// Favicon handles GET /favicon.ico
+// @Summary Get favicon
+// @ID getFavicon
+// @Description Returns the favicon of the short link domain
+// @Tags static
+// @Produce image/x-icon
+// @Success 200 {file} binary
+// @Router /favicon.ico [get]
+func (h *StaticHandler) Favicon(c *gin.Context) {
+	h.serve(c, "favicon.ico")
+}
+
+// Static handles GET /static/*filepath
+// @Summary Get static asset
+// @ID getStatic
+// @Description Returns an embedded static asset
+// @Tags static
+// @Param filepath path string true "Asset path"
+// @Success 200 {file} binary
+// @Failure 404
+// @Router /static/{filepath} [get]
+func (h *StaticHandler) Static(c *gin.Context) {
+	name := strings.TrimPrefix(path.Clean(c.Param("filepath")), "/")
+	h.serve(c, name)
+}
+
+// serve writes the named asset, answering directories and missing files with a bare 404
+func (h *StaticHandler) serve(c *gin.Context, name string) {
+	f, err := h.assets.Open(name)
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	content, ok := f.(io.ReadSeeker)
+	if err != nil || info.IsDir() || !ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	c.Header("Cache-Control", staticMaxAge)
+	http.ServeContent(c.Writer, c.Request, info.Name(), h.modTime, content)
+}
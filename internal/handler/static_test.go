@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"octopus/web"
+)
+
+func newTestStaticRouter(h *StaticHandler) *gin.Engine {
+	router := gin.New()
+	router.GET("/favicon.ico", h.Favicon)
+	router.GET("/static/*filepath", h.Static)
+	// Short code resolution must never see static asset requests
+	router.GET("/:shortCode", func(c *gin.Context) {
+		c.String(http.StatusTeapot, c.Param("shortCode"))
+	})
+	return router
+}
+
+func TestStaticHandler(t *testing.T) {
+	assets := fstest.MapFS{
+		"favicon.ico":  {Data: []byte("icon")},
+		"css/site.css": {Data: []byte("body{}")},
+	}
+	router := newTestStaticRouter(NewStaticHandler(assets))
+
+	tests := []struct {
+		name        string
+		path        string
+		code        int
+		body        string
+		contentType string
+	}{
+		{name: "favicon", path: "/favicon.ico", code: http.StatusOK, body: "icon", contentType: "image/vnd.microsoft.icon"},
+		{name: "nested asset", path: "/static/css/site.css", code: http.StatusOK, body: "body{}", contentType: "text/css; charset=utf-8"},
+		{name: "missing asset", path: "/static/missing.js", code: http.StatusNotFound},
+		{name: "directory", path: "/static/css", code: http.StatusNotFound},
+		{name: "static root", path: "/static/", code: http.StatusNotFound},
+		{name: "path traversal", path: "/static/../../go.mod", code: http.StatusNotFound},
+		{name: "short code", path: "/ABCD", code: http.StatusTeapot, body: "ABCD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if tt.body != "" {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+			if tt.contentType != "" {
+				assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+				assert.Equal(t, staticMaxAge, w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestStaticHandler_NotModified(t *testing.T) {
+	h := NewStaticHandler(fstest.MapFS{"favicon.ico": {Data: []byte("icon")}})
+	router := newTestStaticRouter(h)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/favicon.ico", nil)
+	req.Header.Set("If-Modified-Since", h.modTime.UTC().Format(http.TimeFormat))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
+
+func TestStaticHandler_EmbeddedAssets(t *testing.T) {
+	router := newTestStaticRouter(NewStaticHandler(web.Static()))
+
+	for _, path := range []string{"/favicon.ico", "/static/favicon.ico", "/static/logo.svg"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.NotEmpty(t, w.Body.Bytes(), path)
+	}
+}
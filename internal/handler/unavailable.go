@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// unavailableText is the "not available in your region" page in one language
+type unavailableText struct {
+	title   string
+	message string
+}
+
+// defaultUnavailableLanguage is the language of the page for visitors accepting none of the others
+const defaultUnavailableLanguage = "en"
+
+// unavailableTexts holds the translations of the page shown where a link restricted to countries
+// may not be opened, keyed by language
+var unavailableTexts = map[string]unavailableText{
+	"de": {"In Ihrer Region nicht verfügbar", "Dieser Link ist in Ihrem Land oder Ihrer Region nicht verfügbar."},
+	"en": {"Not available in your region", "This link is not available in your country or region."},
+	"es": {"No disponible en tu región", "Este enlace no está disponible en tu país o región."},
+	"fr": {"Non disponible dans votre région", "Ce lien n'est pas disponible dans votre pays ou votre région."},
+	"it": {"Non disponibile nella tua regione", "Questo link non è disponibile nel tuo paese o nella tua regione."},
+	"ja": {"お住まいの地域ではご利用いただけません", "このリンクはお住まいの国または地域ではご利用いただけません。"},
+	"nl": {"Niet beschikbaar in jouw regio", "Deze link is niet beschikbaar in jouw land of regio."},
+	"pt": {"Indisponível na sua região", "Este link não está disponível no seu país ou região."},
+	"zh": {"您所在的地区无法访问", "此链接在您所在的国家或地区不可用。"},
+}
+
+// unavailablePage returns the page shown where a link restricted to countries may not be opened,
+// in the language preferred by an Accept-Language header among those translated, and that language
+func unavailablePage(acceptLanguage string) (string, []byte) {
+	lang := preferredLanguage(acceptLanguage)
+	text := unavailableTexts[lang]
+	return lang, []byte(fmt.Sprintf(`<!DOCTYPE html>
+<html lang="%s">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>%s</title>
+</head>
+<body style="font-family: sans-serif; max-width: 48em; margin: 2em auto">
+<h1>%s</h1>
+<p>%s</p>
+</body>
+</html>
+`, lang, text.title, text.title, text.message))
+}
+
+// preferredLanguage picks the translated language an Accept-Language header weighs the most,
+// matching on primary subtags so that fr-CA gets French. Ties go to the language listed first.
+func preferredLanguage(acceptLanguage string) string {
+	type weighted struct {
+		lang   string
+		weight float64
+	}
+	var candidates []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if _, ok := unavailableTexts[lang]; !ok {
+			continue
+		}
+		weight := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if weight, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if weight > 0 {
+			candidates = append(candidates, weighted{lang: lang, weight: weight})
+		}
+	}
+	if len(candidates) == 0 {
+		return defaultUnavailableLanguage
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].weight > candidates[j].weight
+	})
+	return candidates[0].lang
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreferredLanguage(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                            "en",
+		"fr-CA,fr;q=0.9,en;q=0.8":     "fr",
+		"sv-SE,sv;q=0.9,de;q=0.5":     "de",
+		"en;q=0.4, ja;q=0.8":          "ja",
+		"pt-BR, es":                   "pt",
+		"de;q=0, it":                  "it",
+		"zh-Hans-CN;q=oops, nl;q=0.1": "nl",
+		"*":                           "en",
+	} {
+		assert.Equal(t, want, preferredLanguage(header), header)
+	}
+}
+
+func TestUnavailablePage(t *testing.T) {
+	lang, page := unavailablePage("de-AT")
+	assert.Equal(t, "de", lang)
+	assert.Contains(t, string(page), `<html lang="de">`)
+	assert.Contains(t, string(page), "In Ihrer Region nicht verfügbar")
+}
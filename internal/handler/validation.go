@@ -0,0 +1,311 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"octopus/internal/model"
+	"octopus/pkg/apiresp"
+	"octopus/pkg/geoip"
+	"octopus/pkg/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Limits of the params of a short link, which are stored with it and appended to its destination
+const (
+	maxParams     = 50
+	maxParamsSize = 4 << 10
+)
+
+// referrerDomainPattern matches the domain names referrers of a short link are allowed from
+var referrerDomainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+func init() {
+	// Name fields after their JSON keys in validation errors, as clients know them
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// respondInvalid responds 400 listing the rejected fields of a request
+func respondInvalid(c *gin.Context, errs []apiresp.FieldError) {
+	details := make([]string, len(errs))
+	for i, e := range errs {
+		details[i] = e.Field + " " + e.Message
+	}
+	apiresp.FailFields(c, http.StatusBadRequest, "Invalid request: "+strings.Join(details, "; "), errs)
+}
+
+// respondBindError responds 400 to a request body failing to bind, per field when it failed
+// validation rather than decoding
+func respondBindError(c *gin.Context, err error) {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		apiresp.Fail(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	errs := make([]apiresp.FieldError, len(validationErrs))
+	for i, fe := range validationErrs {
+		errs[i] = apiresp.FieldError{Field: fieldPath(fe), Message: validationMessage(fe)}
+	}
+	respondInvalid(c, errs)
+}
+
+// ShortCodeParam returns a gin middleware answering 400 to requests whose shortCode path param is
+// not a well-formed short code, before it reaches a storage key
+func ShortCodeParam(validator CodeValidator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if shortCode, ok := c.Params.Get("shortCode"); ok && !validator.IsValid(shortCode) {
+			c.Abort()
+			respondInvalid(c, []apiresp.FieldError{{Field: "shortCode", Message: "must be a short code"}})
+			return
+		}
+		c.Next()
+	}
+}
+
+// validateShortCodes checks that every short code of a request body is well-formed
+func validateShortCodes(validator CodeValidator, field string, shortCodes []string) []apiresp.FieldError {
+	var errs []apiresp.FieldError
+	for i, shortCode := range shortCodes {
+		if !validator.IsValid(shortCode) {
+			errs = append(errs, apiresp.FieldError{Field: fmt.Sprintf("%s[%d]", field, i), Message: "must be a short code"})
+		}
+	}
+	return errs
+}
+
+// fieldPath returns the JSON path of a field failing validation, without the request type
+func fieldPath(fe validator.FieldError) string {
+	_, path, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return path
+}
+
+// validationMessage describes the rule a field failed
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "url":
+		return "must be an absolute URL"
+	case "min", "max":
+		bound := "at least"
+		if fe.Tag() == "max" {
+			bound = "at most"
+		}
+		switch fe.Kind() {
+		case reflect.String:
+			return fmt.Sprintf("must be %s %s characters long", bound, fe.Param())
+		case reflect.Slice, reflect.Map:
+			return fmt.Sprintf("must have %s %s items", bound, fe.Param())
+		}
+		return fmt.Sprintf("must be %s %s", bound, fe.Param())
+	}
+	return fmt.Sprintf("failed the %s rule", fe.Tag())
+}
+
+// validateGenerateRequest checks what binding tags cannot express: that expire_at is a future
+// RFC 3339 time, ttl a positive duration, only one of them or expire_in_seconds is set, params
+// are query values within their limits, cache_control a list of Cache-Control directives,
+// allowed_referrers domain names, countries ISO codes allowed or blocked but not both and the
+// rules of schedule weekly windows
+func validateGenerateRequest(req *model.GenerateRequest, now time.Time) []apiresp.FieldError {
+	var errs []apiresp.FieldError
+	switch {
+	case req.ExpireAt != "" && req.TTL != "":
+		errs = append(errs, apiresp.FieldError{Field: "ttl", Message: "cannot be combined with expire_at"})
+	case req.ExpireInSeconds != 0 && (req.ExpireAt != "" || req.TTL != ""):
+		errs = append(errs, apiresp.FieldError{Field: "expire_in_seconds", Message: "cannot be combined with expire_at or ttl"})
+	}
+	if req.TTL != "" {
+		if ttl, err := time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+			errs = append(errs, apiresp.FieldError{Field: "ttl", Message: "must be a positive duration like 72h or 90m"})
+		}
+	}
+	if req.ExpireAt != "" {
+		expireAt, err := time.Parse(time.RFC3339, req.ExpireAt)
+		switch {
+		case err != nil:
+			errs = append(errs, apiresp.FieldError{Field: "expire_at", Message: "must be an RFC 3339 time like 2030-01-02T15:04:05Z"})
+		case !expireAt.After(now):
+			errs = append(errs, apiresp.FieldError{Field: "expire_at", Message: "must be in the future"})
+		}
+	}
+	if req.SingleUse && req.MaxClicks > 1 {
+		errs = append(errs, apiresp.FieldError{Field: "max_clicks", Message: "cannot be combined with single_use"})
+	}
+	if req.CacheControl != "" {
+		errs = append(errs, validateCacheControl(req.CacheControl)...)
+	}
+	errs = append(errs, validateReferrers(req.AllowedReferrers)...)
+	errs = append(errs, validateCountries(req.AllowedCountries, req.BlockedCountries)...)
+	errs = append(errs, validateSchedule(req.Schedule)...)
+	return append(errs, validateParams(req.Params)...)
+}
+
+// validateLogDrainRequest checks that a log drain follows either a link or a campaign, and posts to
+// an HTTP endpoint
+func validateLogDrainRequest(req *model.LogDrainRequest) []apiresp.FieldError {
+	var errs []apiresp.FieldError
+	switch {
+	case req.ShortCode == "" && req.Campaign == "":
+		errs = append(errs, apiresp.FieldError{Field: "short_code", Message: "or campaign is required"})
+	case req.ShortCode != "" && req.Campaign != "":
+		errs = append(errs, apiresp.FieldError{Field: "campaign", Message: "cannot be combined with short_code"})
+	}
+	if u, err := url.Parse(req.URL); err == nil && u.Scheme != "http" && u.Scheme != "https" {
+		errs = append(errs, apiresp.FieldError{Field: "url", Message: "must be an http or https URL"})
+	}
+	return errs
+}
+
+// validateReminderSubscriptionRequest checks that reminders are sent somewhere, webhooks to an HTTP
+// endpoint
+func validateReminderSubscriptionRequest(req *model.ReminderSubscriptionRequest) []apiresp.FieldError {
+	var errs []apiresp.FieldError
+	if req.WebhookURL == "" && req.Email == "" {
+		errs = append(errs, apiresp.FieldError{Field: "webhook_url", Message: "or email is required"})
+	}
+	if u, err := url.Parse(req.WebhookURL); req.WebhookURL != "" && err == nil && u.Scheme != "http" && u.Scheme != "https" {
+		errs = append(errs, apiresp.FieldError{Field: "webhook_url", Message: "must be an http or https URL"})
+	}
+	return errs
+}
+
+// validateBulkSelector checks that a bulk change selects links by either short codes or campaign
+func validateBulkSelector(selector *model.BulkSelector) []apiresp.FieldError {
+	switch {
+	case len(selector.ShortCodes) == 0 && selector.Campaign == "":
+		return []apiresp.FieldError{{Field: "short_codes", Message: "or campaign is required"}}
+	case len(selector.ShortCodes) > 0 && selector.Campaign != "":
+		return []apiresp.FieldError{{Field: "campaign", Message: "cannot be combined with short_codes"}}
+	}
+	return nil
+}
+
+// validateBulkExpireRequest checks the selector of a bulk expiry change and that its expire_at is
+// an RFC 3339 time, past times being allowed to expire links right away
+func validateBulkExpireRequest(req *model.BulkExpireRequest) []apiresp.FieldError {
+	errs := validateBulkSelector(&req.BulkSelector)
+	if req.ExpireAt != "" {
+		if _, err := time.Parse(time.RFC3339, req.ExpireAt); err != nil {
+			errs = append(errs, apiresp.FieldError{Field: "expire_at", Message: "must be an RFC 3339 time like 2030-01-02T15:04:05Z"})
+		}
+	}
+	return errs
+}
+
+// validateCacheControl checks the Cache-Control a short link sends with its redirects
+func validateCacheControl(value string) []apiresp.FieldError {
+	if err := util.ValidateCacheControl(value); err != nil {
+		return []apiresp.FieldError{{Field: "cache_control", Message: "must be Cache-Control directives like \"public, max-age=300\": " + err.Error()}}
+	}
+	return nil
+}
+
+// validateReferrers checks that the allowed referrers of a short link are domain names, which
+// match their subdomains too, rather than URLs
+func validateReferrers(domains []string) []apiresp.FieldError {
+	var errs []apiresp.FieldError
+	for i, domain := range domains {
+		if !referrerDomainPattern.MatchString(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")) {
+			errs = append(errs, apiresp.FieldError{
+				Field:   fmt.Sprintf("allowed_referrers[%d]", i),
+				Message: "must be a domain name like news.example.com",
+			})
+		}
+	}
+	return errs
+}
+
+// validateCountries checks that a short link is limited to or refused in countries given by their
+// ISO 3166-1 alpha-2 codes, such as FR
+func validateCountries(allowed, blocked []string) []apiresp.FieldError {
+	if len(allowed) > 0 && len(blocked) > 0 {
+		return []apiresp.FieldError{{Field: "blocked_countries", Message: "cannot be combined with allowed_countries"}}
+	}
+	field, countries := "allowed_countries", allowed
+	if len(blocked) > 0 {
+		field, countries = "blocked_countries", blocked
+	}
+	var errs []apiresp.FieldError
+	for i, country := range countries {
+		if _, ok := geoip.NormalizeCountry(country); !ok {
+			errs = append(errs, apiresp.FieldError{
+				Field:   fmt.Sprintf("%s[%d]", field, i),
+				Message: "must be an ISO 3166-1 alpha-2 country code like FR",
+			})
+		}
+	}
+	return errs
+}
+
+// validateSchedule checks that a schedule is in a known timezone and that its rules are weekly
+// windows routing to http or https URLs
+func validateSchedule(schedule *model.Schedule) []apiresp.FieldError {
+	if schedule == nil {
+		return nil
+	}
+	var errs []apiresp.FieldError
+	if schedule.Timezone != "" {
+		if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+			errs = append(errs, apiresp.FieldError{Field: "schedule.timezone", Message: "must be an IANA timezone like Europe/Paris"})
+		}
+	}
+	for i, rule := range schedule.Rules {
+		field := fmt.Sprintf("schedule.rules[%d]", i)
+		var ruleErr *model.ScheduleRuleError
+		if err := rule.Validate(); errors.As(err, &ruleErr) {
+			errs = append(errs, apiresp.FieldError{Field: field + "." + ruleErr.Field, Message: ruleErr.Message})
+		}
+		if u, err := url.Parse(rule.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, apiresp.FieldError{Field: field + ".url", Message: "must be an http or https URL"})
+		}
+	}
+	return errs
+}
+
+// validateParams checks that params fit their limits and that every value can be sent as a query
+// value, rejecting null, objects and arrays key by key
+func validateParams(params map[string]interface{}) []apiresp.FieldError {
+	if len(params) > maxParams {
+		return []apiresp.FieldError{{Field: "params", Message: fmt.Sprintf("must have at most %d keys", maxParams)}}
+	}
+
+	var errs []apiresp.FieldError
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := model.ParamString(params[key]); !ok {
+			errs = append(errs, apiresp.FieldError{Field: "params." + key, Message: "must be a string, number or boolean"})
+		}
+	}
+	if data, err := json.Marshal(params); err == nil && len(data) > maxParamsSize {
+		errs = append(errs, apiresp.FieldError{Field: "params", Message: fmt.Sprintf("must be at most %d bytes as JSON", maxParamsSize)})
+	}
+	return errs
+}
@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"octopus/internal/encoder"
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/pkg/apiresp"
+)
+
+func TestGenerateHandler_Validation(t *testing.T) {
+	manyParams := make(map[string]interface{}, maxParams+1)
+	for i := 0; i <= maxParams; i++ {
+		manyParams[fmt.Sprintf("p%d", i)] = i
+	}
+
+	tests := []struct {
+		name    string
+		body    map[string]interface{}
+		errors  []apiresp.FieldError
+		message string
+	}{
+		{
+			name:    "missing url",
+			body:    map[string]interface{}{"title": "Spring sale"},
+			errors:  []apiresp.FieldError{{Field: "url", Message: "is required"}},
+			message: "Invalid request: url is required",
+		},
+		{
+			name:   "relative url",
+			body:   map[string]interface{}{"url": "/spring-sale"},
+			errors: []apiresp.FieldError{{Field: "url", Message: "must be an absolute URL"}},
+		},
+		{
+			name:   "expire_at not RFC 3339",
+			body:   map[string]interface{}{"url": "https://example.com", "expire_at": "2030-01-02 15:04:05"},
+			errors: []apiresp.FieldError{{Field: "expire_at", Message: "must be an RFC 3339 time like 2030-01-02T15:04:05Z"}},
+		},
+		{
+			name: "expire_at in the past and too many params",
+			body: map[string]interface{}{"url": "https://example.com", "expire_at": "2020-01-02T15:04:05Z", "params": manyParams},
+			errors: []apiresp.FieldError{
+				{Field: "expire_at", Message: "must be in the future"},
+				{Field: "params", Message: "must have at most 50 keys"},
+			},
+			message: "Invalid request: expire_at must be in the future; params must have at most 50 keys",
+		},
+		{
+			name:   "ttl with expire_at",
+			body:   map[string]interface{}{"url": "https://example.com", "expire_at": "2099-01-02T15:04:05Z", "ttl": "72h"},
+			errors: []apiresp.FieldError{{Field: "ttl", Message: "cannot be combined with expire_at"}},
+		},
+		{
+			name:   "expire_in_seconds with ttl",
+			body:   map[string]interface{}{"url": "https://example.com", "ttl": "72h", "expire_in_seconds": 60},
+			errors: []apiresp.FieldError{{Field: "expire_in_seconds", Message: "cannot be combined with expire_at or ttl"}},
+		},
+		{
+			name:   "ttl not a duration",
+			body:   map[string]interface{}{"url": "https://example.com", "ttl": "3d"},
+			errors: []apiresp.FieldError{{Field: "ttl", Message: "must be a positive duration like 72h or 90m"}},
+		},
+		{
+			name:   "negative ttl",
+			body:   map[string]interface{}{"url": "https://example.com", "ttl": "-1h"},
+			errors: []apiresp.FieldError{{Field: "ttl", Message: "must be a positive duration like 72h or 90m"}},
+		},
+		{
+			name:   "expire_in_seconds not positive",
+			body:   map[string]interface{}{"url": "https://example.com", "expire_in_seconds": -5},
+			errors: []apiresp.FieldError{{Field: "expire_in_seconds", Message: "must be at least 1"}},
+		},
+		{
+			name: "params without a query form",
+			body: map[string]interface{}{"url": "https://example.com", "params": map[string]interface{}{
+				"a": map[string]interface{}{"b": 1}, "b": []interface{}{1}, "c": nil, "d": "ok", "e": 2.5, "f": true,
+			}},
+			errors: []apiresp.FieldError{
+				{Field: "params.a", Message: "must be a string, number or boolean"},
+				{Field: "params.b", Message: "must be a string, number or boolean"},
+				{Field: "params.c", Message: "must be a string, number or boolean"},
+			},
+		},
+		{
+			name:   "params too large",
+			body:   map[string]interface{}{"url": "https://example.com", "params": map[string]interface{}{"note": strings.Repeat("a", maxParamsSize)}},
+			errors: []apiresp.FieldError{{Field: "params", Message: "must be at most 4096 bytes as JSON"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			router := newTestRouter(NewGenerateHandler(mocks.NewMockShortLinkServiceInterface(ctrl)))
+
+			body, _ := json.Marshal(tt.body)
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/shortlink/generate", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var resp apiresp.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Contains(t, resp.Message, "Invalid request")
+			if tt.errors != nil {
+				assert.Equal(t, tt.errors, resp.Errors)
+			}
+			if tt.message != "" {
+				assert.Equal(t, tt.message, resp.Message)
+			}
+		})
+	}
+
+	t.Run("fields failing binding rules", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		router := newTestRouter(NewGenerateHandler(mocks.NewMockShortLinkServiceInterface(ctrl)))
+
+		body, _ := json.Marshal(map[string]interface{}{"url": "https://example.com", "max_clicks": -1, "title": strings.Repeat("a", 256)})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/shortlink/generate", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		var resp apiresp.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, []apiresp.FieldError{
+			{Field: "max_clicks", Message: "must be at least 1"},
+			{Field: "title", Message: "must be at most 255 characters long"},
+		}, resp.Errors)
+	})
+}
+
+func TestValidateGenerateRequest(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Empty(t, validateGenerateRequest(&model.GenerateRequest{URL: "https://example.com"}, now))
+	assert.Empty(t, validateGenerateRequest(&model.GenerateRequest{
+		// Offsets are honored: this is a second after now
+		ExpireAt: "2025-01-01T01:00:01+01:00",
+		Params:   map[string]interface{}{"a": "b", "n": 1.5, "ok": false},
+	}, now))
+	assert.Equal(t, []apiresp.FieldError{{Field: "expire_at", Message: "must be in the future"}},
+		validateGenerateRequest(&model.GenerateRequest{ExpireAt: "2025-01-01T01:00:00+01:00"}, now))
+	assert.Empty(t, validateGenerateRequest(&model.GenerateRequest{CacheControl: "public, max-age=300"}, now))
+	errs := validateGenerateRequest(&model.GenerateRequest{CacheControl: "public, max-age=soon"}, now)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "cache_control", errs[0].Field)
+	assert.Empty(t, validateGenerateRequest(&model.GenerateRequest{SingleUse: true, MaxClicks: 1}, now))
+	assert.Equal(t, []apiresp.FieldError{{Field: "max_clicks", Message: "cannot be combined with single_use"}},
+		validateGenerateRequest(&model.GenerateRequest{SingleUse: true, MaxClicks: 5}, now))
+	assert.Empty(t, validateGenerateRequest(&model.GenerateRequest{AllowedReferrers: []string{"news.example.com", "Example.org."}}, now))
+	assert.Equal(t, []apiresp.FieldError{{Field: "allowed_referrers[1]", Message: "must be a domain name like news.example.com"}},
+		validateGenerateRequest(&model.GenerateRequest{AllowedReferrers: []string{"example.org", "https://news.example.com/"}}, now))
+	assert.Empty(t, validateGenerateRequest(&model.GenerateRequest{BlockedCountries: []string{"us", "CA"}}, now))
+	assert.Equal(t, []apiresp.FieldError{{Field: "allowed_countries[1]", Message: "must be an ISO 3166-1 alpha-2 country code like FR"}},
+		validateGenerateRequest(&model.GenerateRequest{AllowedCountries: []string{"FR", "FRA"}}, now))
+	assert.Equal(t, []apiresp.FieldError{{Field: "blocked_countries", Message: "cannot be combined with allowed_countries"}},
+		validateGenerateRequest(&model.GenerateRequest{AllowedCountries: []string{"FR"}, BlockedCountries: []string{"US"}}, now))
+	assert.Empty(t, validateGenerateRequest(&model.GenerateRequest{Schedule: &model.Schedule{
+		Timezone: "Europe/Paris",
+		Rules:    []model.ScheduleRule{{Days: "sat-sun", From: "22:00", To: "02:00", URL: "https://example.com/late"}},
+	}}, now))
+	assert.Equal(t, []apiresp.FieldError{
+		{Field: "schedule.timezone", Message: "must be an IANA timezone like Europe/Paris"},
+		{Field: "schedule.rules[0].from", Message: "must be a time like 09:00"},
+		{Field: "schedule.rules[1].url", Message: "must be an http or https URL"},
+	}, validateGenerateRequest(&model.GenerateRequest{Schedule: &model.Schedule{
+		Timezone: "Mars/Olympus",
+		Rules: []model.ScheduleRule{
+			{Days: "mon", From: "9am", URL: "https://example.com/a"},
+			{Days: "tue", URL: "ftp://example.com/b"},
+		},
+	}}, now))
+}
+
+func TestShortCodeParam(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api := router.Group("/api/v1", ShortCodeParam(encoder.NewBase32Encoder()))
+	api.GET("/analytics/:shortCode", func(c *gin.Context) { apiresp.OK(c, c.Param("shortCode")) })
+	api.GET("/drains", func(c *gin.Context) { apiresp.OK(c, nil) })
+
+	for path, status := range map[string]int{
+		"/api/v1/analytics/ABCD":                      http.StatusOK,
+		"/api/v1/analytics/AB*":                       http.StatusBadRequest,
+		"/api/v1/analytics/ABCD:2024-01-01":           http.StatusBadRequest,
+		"/api/v1/analytics/%2A":                       http.StatusBadRequest,
+		"/api/v1/analytics/ABCD%3Auv":                 http.StatusBadRequest,
+		"/api/v1/analytics/" + strings.Repeat("A", 7): http.StatusBadRequest,
+		"/api/v1/drains":                              http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, status, w.Code, path)
+		if status == http.StatusBadRequest {
+			assert.Contains(t, w.Body.String(), `"field":"shortCode"`, path)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"octopus/internal/model"
+	"octopus/pkg/apiresp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VersionHandler serves the build of the running binary, telling which build serves traffic
+type VersionHandler struct {
+	info *model.BuildInfo
+}
+
+// NewVersionHandler creates a new VersionHandler
+func NewVersionHandler(info *model.BuildInfo) *VersionHandler {
+	return &VersionHandler{info: info}
+}
+
+// Version handles GET /version
+// @Summary Get the build
+// @ID getVersion
+// @Description Returns the version, commit and build time of the running binary
+// @Tags build
+// @Produce json
+// @Success 200 {object} apiresp.Response{data=model.BuildInfo}
+// @Router /version [get]
+func (h *VersionHandler) Version(c *gin.Context) {
+	apiresp.OK(c, h.info)
+}
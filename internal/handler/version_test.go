@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"octopus/internal/model"
+)
+
+func TestVersionHandler_Version(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	info := &model.BuildInfo{Version: "v1.4.0", Commit: "0c1d2e3f", BuildTime: "2026-10-16T09:00:00Z", GoVersion: "go1.26.0"}
+
+	router := gin.New()
+	router.GET("/version", NewVersionHandler(info).Version)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Data model.BuildInfo `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, *info, resp.Data)
+}
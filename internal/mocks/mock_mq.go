@@ -6,6 +6,7 @@ package mocks
 
 import (
 	context "context"
+	model "octopus/internal/model"
 	mq "octopus/internal/mq"
 	reflect "reflect"
 
@@ -63,6 +64,20 @@ func (mr *MockProducerInterfaceMockRecorder) SendAccessLog(ctx, msg interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendAccessLog", reflect.TypeOf((*MockProducerInterface)(nil).SendAccessLog), ctx, msg)
 }
 
+// SendLinkEvent mocks base method.
+func (m *MockProducerInterface) SendLinkEvent(ctx context.Context, msg *mq.LinkEventMessage) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendLinkEvent", ctx, msg)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendLinkEvent indicates an expected call of SendLinkEvent.
+func (mr *MockProducerInterfaceMockRecorder) SendLinkEvent(ctx, msg interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendLinkEvent", reflect.TypeOf((*MockProducerInterface)(nil).SendLinkEvent), ctx, msg)
+}
+
 // MockConsumerInterface is a mock of ConsumerInterface interface.
 type MockConsumerInterface struct {
 	ctrl     *gomock.Controller
@@ -100,6 +115,46 @@ func (mr *MockConsumerInterfaceMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockConsumerInterface)(nil).Close))
 }
 
+// Restart mocks base method.
+func (m *MockConsumerInterface) Restart() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Restart")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Restart indicates an expected call of Restart.
+func (mr *MockConsumerInterfaceMockRecorder) Restart() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restart", reflect.TypeOf((*MockConsumerInterface)(nil).Restart))
+}
+
+// SetDeadLetterQueue mocks base method.
+func (m *MockConsumerInterface) SetDeadLetterQueue(dlq *mq.DeadLetterQueue) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetDeadLetterQueue", dlq)
+}
+
+// SetDeadLetterQueue indicates an expected call of SetDeadLetterQueue.
+func (mr *MockConsumerInterfaceMockRecorder) SetDeadLetterQueue(dlq interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDeadLetterQueue", reflect.TypeOf((*MockConsumerInterface)(nil).SetDeadLetterQueue), dlq)
+}
+
+// Status mocks base method.
+func (m *MockConsumerInterface) Status(ctx context.Context) *model.ConsumerStatus {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Status", ctx)
+	ret0, _ := ret[0].(*model.ConsumerStatus)
+	return ret0
+}
+
+// Status indicates an expected call of Status.
+func (mr *MockConsumerInterfaceMockRecorder) Status(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Status", reflect.TypeOf((*MockConsumerInterface)(nil).Status), ctx)
+}
+
 // Subscribe mocks base method.
 func (m *MockConsumerInterface) Subscribe() error {
 	m.ctrl.T.Helper()
@@ -113,3 +168,86 @@ func (mr *MockConsumerInterfaceMockRecorder) Subscribe() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockConsumerInterface)(nil).Subscribe))
 }
+
+// MockDeadLetterQueueInterface is a mock of DeadLetterQueueInterface interface.
+type MockDeadLetterQueueInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeadLetterQueueInterfaceMockRecorder
+}
+
+// MockDeadLetterQueueInterfaceMockRecorder is the mock recorder for MockDeadLetterQueueInterface.
+type MockDeadLetterQueueInterfaceMockRecorder struct {
+	mock *MockDeadLetterQueueInterface
+}
+
+// NewMockDeadLetterQueueInterface creates a new mock instance.
+func NewMockDeadLetterQueueInterface(ctrl *gomock.Controller) *MockDeadLetterQueueInterface {
+	mock := &MockDeadLetterQueueInterface{ctrl: ctrl}
+	mock.recorder = &MockDeadLetterQueueInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeadLetterQueueInterface) EXPECT() *MockDeadLetterQueueInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockDeadLetterQueueInterface) Delete(ctx context.Context, ids []string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, ids)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockDeadLetterQueueInterfaceMockRecorder) Delete(ctx, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockDeadLetterQueueInterface)(nil).Delete), ctx, ids)
+}
+
+// Depth mocks base method.
+func (m *MockDeadLetterQueueInterface) Depth(ctx context.Context) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Depth", ctx)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Depth indicates an expected call of Depth.
+func (mr *MockDeadLetterQueueInterfaceMockRecorder) Depth(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Depth", reflect.TypeOf((*MockDeadLetterQueueInterface)(nil).Depth), ctx)
+}
+
+// List mocks base method.
+func (m *MockDeadLetterQueueInterface) List(ctx context.Context, after string, count int64) (*model.DeadLetterPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, after, count)
+	ret0, _ := ret[0].(*model.DeadLetterPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockDeadLetterQueueInterfaceMockRecorder) List(ctx, after, count interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockDeadLetterQueueInterface)(nil).List), ctx, after, count)
+}
+
+// Replay mocks base method.
+func (m *MockDeadLetterQueueInterface) Replay(ctx context.Context, ids []string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Replay", ctx, ids)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Replay indicates an expected call of Replay.
+func (mr *MockDeadLetterQueueInterfaceMockRecorder) Replay(ctx, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Replay", reflect.TypeOf((*MockDeadLetterQueueInterface)(nil).Replay), ctx, ids)
+}
@@ -6,8 +6,11 @@ package mocks
 
 import (
 	context "context"
+	"net/http"
+	url "net/url"
 	model "octopus/internal/model"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -35,19 +38,93 @@ func (m *MockShortLinkServiceInterface) EXPECT() *MockShortLinkServiceInterfaceM
 	return m.recorder
 }
 
-// ExpandURL mocks base method.
-func (m *MockShortLinkServiceInterface) ExpandURL(ctx context.Context, shortCode string, queryParams map[string]string) (string, error) {
+// BatchGet mocks base method.
+func (m *MockShortLinkServiceInterface) BatchGet(ctx context.Context, shortCodes []string) (*model.BatchGetResponse, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ExpandURL", ctx, shortCode, queryParams)
-	ret0, _ := ret[0].(string)
+	ret := m.ctrl.Call(m, "BatchGet", ctx, shortCodes)
+	ret0, _ := ret[0].(*model.BatchGetResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BatchGet indicates an expected call of BatchGet.
+func (mr *MockShortLinkServiceInterfaceMockRecorder) BatchGet(ctx, shortCodes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BatchGet", reflect.TypeOf((*MockShortLinkServiceInterface)(nil).BatchGet), ctx, shortCodes)
+}
+
+// BulkUpdateExpiry mocks base method.
+func (m *MockShortLinkServiceInterface) BulkUpdateExpiry(ctx context.Context, req *model.BulkExpireRequest) (*model.BulkResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BulkUpdateExpiry", ctx, req)
+	ret0, _ := ret[0].(*model.BulkResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BulkUpdateExpiry indicates an expected call of BulkUpdateExpiry.
+func (mr *MockShortLinkServiceInterfaceMockRecorder) BulkUpdateExpiry(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BulkUpdateExpiry", reflect.TypeOf((*MockShortLinkServiceInterface)(nil).BulkUpdateExpiry), ctx, req)
+}
+
+// BulkUpdateStatus mocks base method.
+func (m *MockShortLinkServiceInterface) BulkUpdateStatus(ctx context.Context, req *model.BulkStatusRequest) (*model.BulkResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BulkUpdateStatus", ctx, req)
+	ret0, _ := ret[0].(*model.BulkResponse)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
+// BulkUpdateStatus indicates an expected call of BulkUpdateStatus.
+func (mr *MockShortLinkServiceInterfaceMockRecorder) BulkUpdateStatus(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BulkUpdateStatus", reflect.TypeOf((*MockShortLinkServiceInterface)(nil).BulkUpdateStatus), ctx, req)
+}
+
+// ConsumeClick mocks base method.
+func (m *MockShortLinkServiceInterface) ConsumeClick(ctx context.Context, shortCode string) (bool, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeClick", ctx, shortCode)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ConsumeClick indicates an expected call of ConsumeClick.
+func (mr *MockShortLinkServiceInterfaceMockRecorder) ConsumeClick(ctx, shortCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeClick", reflect.TypeOf((*MockShortLinkServiceInterface)(nil).ConsumeClick), ctx, shortCode)
+}
+
+// Deactivate mocks base method.
+func (m *MockShortLinkServiceInterface) Deactivate(ctx context.Context, shortCode string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Deactivate", ctx, shortCode)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Deactivate indicates an expected call of Deactivate.
+func (mr *MockShortLinkServiceInterfaceMockRecorder) Deactivate(ctx, shortCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Deactivate", reflect.TypeOf((*MockShortLinkServiceInterface)(nil).Deactivate), ctx, shortCode)
+}
+
+// ExpandURL mocks base method.
+func (m *MockShortLinkServiceInterface) ExpandURL(sl *model.ShortLink, queryParams url.Values) string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpandURL", sl, queryParams)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
 // ExpandURL indicates an expected call of ExpandURL.
-func (mr *MockShortLinkServiceInterfaceMockRecorder) ExpandURL(ctx, shortCode, queryParams interface{}) *gomock.Call {
+func (mr *MockShortLinkServiceInterfaceMockRecorder) ExpandURL(sl, queryParams interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpandURL", reflect.TypeOf((*MockShortLinkServiceInterface)(nil).ExpandURL), ctx, shortCode, queryParams)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpandURL", reflect.TypeOf((*MockShortLinkServiceInterface)(nil).ExpandURL), sl, queryParams)
 }
 
 // Generate mocks base method.
@@ -80,6 +157,111 @@ func (mr *MockShortLinkServiceInterfaceMockRecorder) Get(ctx, shortCode interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockShortLinkServiceInterface)(nil).Get), ctx, shortCode)
 }
 
+// Lookup mocks base method.
+func (m *MockShortLinkServiceInterface) Lookup(ctx context.Context, rawURL string) (*model.LookupResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Lookup", ctx, rawURL)
+	ret0, _ := ret[0].(*model.LookupResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Lookup indicates an expected call of Lookup.
+func (mr *MockShortLinkServiceInterfaceMockRecorder) Lookup(ctx, rawURL interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Lookup", reflect.TypeOf((*MockShortLinkServiceInterface)(nil).Lookup), ctx, rawURL)
+}
+
+// Reconcile mocks base method.
+func (m *MockShortLinkServiceInterface) Reconcile(ctx context.Context, req *model.DeclarativeRequest, dryRun bool) (*model.DeclarativeResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reconcile", ctx, req, dryRun)
+	ret0, _ := ret[0].(*model.DeclarativeResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reconcile indicates an expected call of Reconcile.
+func (mr *MockShortLinkServiceInterfaceMockRecorder) Reconcile(ctx, req, dryRun interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reconcile", reflect.TypeOf((*MockShortLinkServiceInterface)(nil).Reconcile), ctx, req, dryRun)
+}
+
+// Resolve mocks base method.
+func (m *MockShortLinkServiceInterface) Resolve(ctx context.Context, shortCode string) (*model.ResolveResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Resolve", ctx, shortCode)
+	ret0, _ := ret[0].(*model.ResolveResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Resolve indicates an expected call of Resolve.
+func (mr *MockShortLinkServiceInterfaceMockRecorder) Resolve(ctx, shortCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resolve", reflect.TypeOf((*MockShortLinkServiceInterface)(nil).Resolve), ctx, shortCode)
+}
+
+// Search mocks base method.
+func (m *MockShortLinkServiceInterface) Search(ctx context.Context, q *model.SearchQuery) (*model.SearchResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", ctx, q)
+	ret0, _ := ret[0].(*model.SearchResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Search indicates an expected call of Search.
+func (mr *MockShortLinkServiceInterfaceMockRecorder) Search(ctx, q interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockShortLinkServiceInterface)(nil).Search), ctx, q)
+}
+
+// SignParams mocks base method.
+func (m *MockShortLinkServiceInterface) SignParams(ctx context.Context, shortCode string, params map[string]interface{}) (*model.SignParamsResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SignParams", ctx, shortCode, params)
+	ret0, _ := ret[0].(*model.SignParamsResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SignParams indicates an expected call of SignParams.
+func (mr *MockShortLinkServiceInterfaceMockRecorder) SignParams(ctx, shortCode, params interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SignParams", reflect.TypeOf((*MockShortLinkServiceInterface)(nil).SignParams), ctx, shortCode, params)
+}
+
+// Update mocks base method.
+func (m *MockShortLinkServiceInterface) Update(ctx context.Context, shortCode string, req *model.UpdateRequest) (*model.ResolveResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, shortCode, req)
+	ret0, _ := ret[0].(*model.ResolveResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockShortLinkServiceInterfaceMockRecorder) Update(ctx, shortCode, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockShortLinkServiceInterface)(nil).Update), ctx, shortCode, req)
+}
+
+// VerifyParams mocks base method.
+func (m *MockShortLinkServiceInterface) VerifyParams(sl *model.ShortLink, query url.Values) (url.Values, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyParams", sl, query)
+	ret0, _ := ret[0].(url.Values)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyParams indicates an expected call of VerifyParams.
+func (mr *MockShortLinkServiceInterfaceMockRecorder) VerifyParams(sl, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyParams", reflect.TypeOf((*MockShortLinkServiceInterface)(nil).VerifyParams), sl, query)
+}
+
 // MockAnalyticsServiceInterface is a mock of AnalyticsServiceInterface interface.
 type MockAnalyticsServiceInterface struct {
 	ctrl     *gomock.Controller
@@ -103,19 +285,139 @@ func (m *MockAnalyticsServiceInterface) EXPECT() *MockAnalyticsServiceInterfaceM
 	return m.recorder
 }
 
+// AggregateAnalytics mocks base method.
+func (m *MockAnalyticsServiceInterface) AggregateAnalytics(ctx context.Context, shortCodes []string) (*model.AggregateResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AggregateAnalytics", ctx, shortCodes)
+	ret0, _ := ret[0].(*model.AggregateResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AggregateAnalytics indicates an expected call of AggregateAnalytics.
+func (mr *MockAnalyticsServiceInterfaceMockRecorder) AggregateAnalytics(ctx, shortCodes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AggregateAnalytics", reflect.TypeOf((*MockAnalyticsServiceInterface)(nil).AggregateAnalytics), ctx, shortCodes)
+}
+
+// CampaignShortCodes mocks base method.
+func (m *MockAnalyticsServiceInterface) CampaignShortCodes(ctx context.Context, campaign, owner string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CampaignShortCodes", ctx, campaign, owner)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CampaignShortCodes indicates an expected call of CampaignShortCodes.
+func (mr *MockAnalyticsServiceInterfaceMockRecorder) CampaignShortCodes(ctx, campaign, owner interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CampaignShortCodes", reflect.TypeOf((*MockAnalyticsServiceInterface)(nil).CampaignShortCodes), ctx, campaign, owner)
+}
+
+// CompareAnalytics mocks base method.
+func (m *MockAnalyticsServiceInterface) CompareAnalytics(ctx context.Context, shortCode string, days int) (*model.CompareResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompareAnalytics", ctx, shortCode, days)
+	ret0, _ := ret[0].(*model.CompareResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompareAnalytics indicates an expected call of CompareAnalytics.
+func (mr *MockAnalyticsServiceInterfaceMockRecorder) CompareAnalytics(ctx, shortCode, days interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompareAnalytics", reflect.TypeOf((*MockAnalyticsServiceInterface)(nil).CompareAnalytics), ctx, shortCode, days)
+}
+
+// GetAccessLogs mocks base method.
+func (m *MockAnalyticsServiceInterface) GetAccessLogs(ctx context.Context, q *model.AccessLogQuery) (*model.AccessLogPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccessLogs", ctx, q)
+	ret0, _ := ret[0].(*model.AccessLogPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAccessLogs indicates an expected call of GetAccessLogs.
+func (mr *MockAnalyticsServiceInterfaceMockRecorder) GetAccessLogs(ctx, q interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccessLogs", reflect.TypeOf((*MockAnalyticsServiceInterface)(nil).GetAccessLogs), ctx, q)
+}
+
 // GetAnalytics mocks base method.
-func (m *MockAnalyticsServiceInterface) GetAnalytics(ctx context.Context, shortCode string) (*model.AnalyticsResponse, error) {
+func (m *MockAnalyticsServiceInterface) GetAnalytics(ctx context.Context, shortCode string, fresh bool) (*model.AnalyticsResponse, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAnalytics", ctx, shortCode)
+	ret := m.ctrl.Call(m, "GetAnalytics", ctx, shortCode, fresh)
 	ret0, _ := ret[0].(*model.AnalyticsResponse)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAnalytics indicates an expected call of GetAnalytics.
-func (mr *MockAnalyticsServiceInterfaceMockRecorder) GetAnalytics(ctx, shortCode interface{}) *gomock.Call {
+func (mr *MockAnalyticsServiceInterfaceMockRecorder) GetAnalytics(ctx, shortCode, fresh interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAnalytics", reflect.TypeOf((*MockAnalyticsServiceInterface)(nil).GetAnalytics), ctx, shortCode, fresh)
+}
+
+// GetDecay mocks base method.
+func (m *MockAnalyticsServiceInterface) GetDecay(ctx context.Context, shortCode string) (*model.DecayResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDecay", ctx, shortCode)
+	ret0, _ := ret[0].(*model.DecayResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDecay indicates an expected call of GetDecay.
+func (mr *MockAnalyticsServiceInterfaceMockRecorder) GetDecay(ctx, shortCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDecay", reflect.TypeOf((*MockAnalyticsServiceInterface)(nil).GetDecay), ctx, shortCode)
+}
+
+// GetLastModified mocks base method.
+func (m *MockAnalyticsServiceInterface) GetLastModified(ctx context.Context, shortCode string) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastModified", ctx, shortCode)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLastModified indicates an expected call of GetLastModified.
+func (mr *MockAnalyticsServiceInterfaceMockRecorder) GetLastModified(ctx, shortCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastModified", reflect.TypeOf((*MockAnalyticsServiceInterface)(nil).GetLastModified), ctx, shortCode)
+}
+
+// GetRealtime mocks base method.
+func (m *MockAnalyticsServiceInterface) GetRealtime(ctx context.Context, shortCode string) (*model.RealtimeResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRealtime", ctx, shortCode)
+	ret0, _ := ret[0].(*model.RealtimeResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRealtime indicates an expected call of GetRealtime.
+func (mr *MockAnalyticsServiceInterfaceMockRecorder) GetRealtime(ctx, shortCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRealtime", reflect.TypeOf((*MockAnalyticsServiceInterface)(nil).GetRealtime), ctx, shortCode)
+}
+
+// GetSourcesDaily mocks base method.
+func (m *MockAnalyticsServiceInterface) GetSourcesDaily(ctx context.Context, shortCode string, days int) (*model.SourcesDailyResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSourcesDaily", ctx, shortCode, days)
+	ret0, _ := ret[0].(*model.SourcesDailyResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSourcesDaily indicates an expected call of GetSourcesDaily.
+func (mr *MockAnalyticsServiceInterfaceMockRecorder) GetSourcesDaily(ctx, shortCode, days interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAnalytics", reflect.TypeOf((*MockAnalyticsServiceInterface)(nil).GetAnalytics), ctx, shortCode)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSourcesDaily", reflect.TypeOf((*MockAnalyticsServiceInterface)(nil).GetSourcesDaily), ctx, shortCode, days)
 }
 
 // GetStats mocks base method.
@@ -134,17 +436,17 @@ func (mr *MockAnalyticsServiceInterfaceMockRecorder) GetStats(ctx, shortCode int
 }
 
 // RecordAccess mocks base method.
-func (m *MockAnalyticsServiceInterface) RecordAccess(ctx context.Context, shortCode, clientIP, userAgent, referer string) error {
+func (m *MockAnalyticsServiceInterface) RecordAccess(ctx context.Context, shortCode, visitorID, referer string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RecordAccess", ctx, shortCode, clientIP, userAgent, referer)
+	ret := m.ctrl.Call(m, "RecordAccess", ctx, shortCode, visitorID, referer)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // RecordAccess indicates an expected call of RecordAccess.
-func (mr *MockAnalyticsServiceInterfaceMockRecorder) RecordAccess(ctx, shortCode, clientIP, userAgent, referer interface{}) *gomock.Call {
+func (mr *MockAnalyticsServiceInterfaceMockRecorder) RecordAccess(ctx, shortCode, visitorID, referer interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordAccess", reflect.TypeOf((*MockAnalyticsServiceInterface)(nil).RecordAccess), ctx, shortCode, clientIP, userAgent, referer)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordAccess", reflect.TypeOf((*MockAnalyticsServiceInterface)(nil).RecordAccess), ctx, shortCode, visitorID, referer)
 }
 
 // MockBloomServiceInterface is a mock of BloomServiceInterface interface.
@@ -165,6 +467,20 @@ func NewMockBloomServiceInterface(ctrl *gomock.Controller) *MockBloomServiceInte
 	return mock
 }
 
+// Delete mocks base method.
+func (m *MockBloomServiceInterface) Delete(ctx context.Context, shortCode string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, shortCode)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockBloomServiceInterfaceMockRecorder) Delete(ctx, shortCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockBloomServiceInterface)(nil).Delete), ctx, shortCode)
+}
+
 // EXPECT returns an object that allows the caller to indicate expected use.
 func (m *MockBloomServiceInterface) EXPECT() *MockBloomServiceInterfaceMockRecorder {
 	return m.recorder
@@ -240,3 +556,1024 @@ func (mr *MockBloomServiceInterfaceMockRecorder) Reset(ctx interface{}) *gomock.
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reset", reflect.TypeOf((*MockBloomServiceInterface)(nil).Reset), ctx)
 }
+
+// SupportsDelete mocks base method.
+func (m *MockBloomServiceInterface) SupportsDelete() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SupportsDelete")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// SupportsDelete indicates an expected call of SupportsDelete.
+func (mr *MockBloomServiceInterfaceMockRecorder) SupportsDelete() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SupportsDelete", reflect.TypeOf((*MockBloomServiceInterface)(nil).SupportsDelete))
+}
+
+// MockSMSPoolServiceInterface is a mock of SMSPoolServiceInterface interface.
+type MockSMSPoolServiceInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockSMSPoolServiceInterfaceMockRecorder
+}
+
+// MockSMSPoolServiceInterfaceMockRecorder is the mock recorder for MockSMSPoolServiceInterface.
+type MockSMSPoolServiceInterfaceMockRecorder struct {
+	mock *MockSMSPoolServiceInterface
+}
+
+// NewMockSMSPoolServiceInterface creates a new mock instance.
+func NewMockSMSPoolServiceInterface(ctrl *gomock.Controller) *MockSMSPoolServiceInterface {
+	mock := &MockSMSPoolServiceInterface{ctrl: ctrl}
+	mock.recorder = &MockSMSPoolServiceInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSMSPoolServiceInterface) EXPECT() *MockSMSPoolServiceInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Allocate mocks base method.
+func (m *MockSMSPoolServiceInterface) Allocate(ctx context.Context, originalURL string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Allocate", ctx, originalURL)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Allocate indicates an expected call of Allocate.
+func (mr *MockSMSPoolServiceInterfaceMockRecorder) Allocate(ctx, originalURL interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Allocate", reflect.TypeOf((*MockSMSPoolServiceInterface)(nil).Allocate), ctx, originalURL)
+}
+
+// CodeLength mocks base method.
+func (m *MockSMSPoolServiceInterface) CodeLength() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CodeLength")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// CodeLength indicates an expected call of CodeLength.
+func (mr *MockSMSPoolServiceInterfaceMockRecorder) CodeLength() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CodeLength", reflect.TypeOf((*MockSMSPoolServiceInterface)(nil).CodeLength))
+}
+
+// Confirm mocks base method.
+func (m *MockSMSPoolServiceInterface) Confirm(ctx context.Context, shortCode string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Confirm", ctx, shortCode)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Confirm indicates an expected call of Confirm.
+func (mr *MockSMSPoolServiceInterfaceMockRecorder) Confirm(ctx, shortCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Confirm", reflect.TypeOf((*MockSMSPoolServiceInterface)(nil).Confirm), ctx, shortCode)
+}
+
+// DefaultTTL mocks base method.
+func (m *MockSMSPoolServiceInterface) DefaultTTL() time.Duration {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DefaultTTL")
+	ret0, _ := ret[0].(time.Duration)
+	return ret0
+}
+
+// DefaultTTL indicates an expected call of DefaultTTL.
+func (mr *MockSMSPoolServiceInterfaceMockRecorder) DefaultTTL() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DefaultTTL", reflect.TypeOf((*MockSMSPoolServiceInterface)(nil).DefaultTTL))
+}
+
+// Domain mocks base method.
+func (m *MockSMSPoolServiceInterface) Domain() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Domain")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Domain indicates an expected call of Domain.
+func (mr *MockSMSPoolServiceInterfaceMockRecorder) Domain() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Domain", reflect.TypeOf((*MockSMSPoolServiceInterface)(nil).Domain))
+}
+
+// Host mocks base method.
+func (m *MockSMSPoolServiceInterface) Host() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Host")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Host indicates an expected call of Host.
+func (mr *MockSMSPoolServiceInterfaceMockRecorder) Host() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Host", reflect.TypeOf((*MockSMSPoolServiceInterface)(nil).Host))
+}
+
+// RecycleExpired mocks base method.
+func (m *MockSMSPoolServiceInterface) RecycleExpired(ctx context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecycleExpired", ctx)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RecycleExpired indicates an expected call of RecycleExpired.
+func (mr *MockSMSPoolServiceInterfaceMockRecorder) RecycleExpired(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecycleExpired", reflect.TypeOf((*MockSMSPoolServiceInterface)(nil).RecycleExpired), ctx)
+}
+
+// Release mocks base method.
+func (m *MockSMSPoolServiceInterface) Release(ctx context.Context, shortCode string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Release", ctx, shortCode)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Release indicates an expected call of Release.
+func (mr *MockSMSPoolServiceInterfaceMockRecorder) Release(ctx, shortCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Release", reflect.TypeOf((*MockSMSPoolServiceInterface)(nil).Release), ctx, shortCode)
+}
+
+// Usage mocks base method.
+func (m *MockSMSPoolServiceInterface) Usage(ctx context.Context) (*model.PoolUsage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Usage", ctx)
+	ret0, _ := ret[0].(*model.PoolUsage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Usage indicates an expected call of Usage.
+func (mr *MockSMSPoolServiceInterfaceMockRecorder) Usage(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Usage", reflect.TypeOf((*MockSMSPoolServiceInterface)(nil).Usage), ctx)
+}
+
+// MockRecyclerServiceInterface is a mock of RecyclerServiceInterface interface.
+type MockRecyclerServiceInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockRecyclerServiceInterfaceMockRecorder
+}
+
+// MockRecyclerServiceInterfaceMockRecorder is the mock recorder for MockRecyclerServiceInterface.
+type MockRecyclerServiceInterfaceMockRecorder struct {
+	mock *MockRecyclerServiceInterface
+}
+
+// NewMockRecyclerServiceInterface creates a new mock instance.
+func NewMockRecyclerServiceInterface(ctrl *gomock.Controller) *MockRecyclerServiceInterface {
+	mock := &MockRecyclerServiceInterface{ctrl: ctrl}
+	mock.recorder = &MockRecyclerServiceInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRecyclerServiceInterface) EXPECT() *MockRecyclerServiceInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Acquire mocks base method.
+func (m *MockRecyclerServiceInterface) Acquire(ctx context.Context) (string, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Acquire", ctx)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// Acquire indicates an expected call of Acquire.
+func (mr *MockRecyclerServiceInterfaceMockRecorder) Acquire(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Acquire", reflect.TypeOf((*MockRecyclerServiceInterface)(nil).Acquire), ctx)
+}
+
+// RecycleExpired mocks base method.
+func (m *MockRecyclerServiceInterface) RecycleExpired(ctx context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecycleExpired", ctx)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RecycleExpired indicates an expected call of RecycleExpired.
+func (mr *MockRecyclerServiceInterfaceMockRecorder) RecycleExpired(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecycleExpired", reflect.TypeOf((*MockRecyclerServiceInterface)(nil).RecycleExpired), ctx)
+}
+
+// MockConversionServiceInterface is a mock of ConversionServiceInterface interface.
+type MockConversionServiceInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockConversionServiceInterfaceMockRecorder
+}
+
+// MockConversionServiceInterfaceMockRecorder is the mock recorder for MockConversionServiceInterface.
+type MockConversionServiceInterfaceMockRecorder struct {
+	mock *MockConversionServiceInterface
+}
+
+// NewMockConversionServiceInterface creates a new mock instance.
+func NewMockConversionServiceInterface(ctrl *gomock.Controller) *MockConversionServiceInterface {
+	mock := &MockConversionServiceInterface{ctrl: ctrl}
+	mock.recorder = &MockConversionServiceInterfaceMockRecorder{mock}
+	return mock
+}
+
+// ClickCookie mocks base method.
+func (m *MockConversionServiceInterface) ClickCookie(clickID string) *http.Cookie {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClickCookie", clickID)
+	ret0, _ := ret[0].(*http.Cookie)
+	return ret0
+}
+
+// ClickCookie indicates an expected call of ClickCookie.
+func (mr *MockConversionServiceInterfaceMockRecorder) ClickCookie(clickID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClickCookie", reflect.TypeOf((*MockConversionServiceInterface)(nil).ClickCookie), clickID)
+}
+
+// CookieName mocks base method.
+func (m *MockConversionServiceInterface) CookieName() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CookieName")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// CookieName indicates an expected call of CookieName.
+func (mr *MockConversionServiceInterfaceMockRecorder) CookieName() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CookieName", reflect.TypeOf((*MockConversionServiceInterface)(nil).CookieName))
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockConversionServiceInterface) EXPECT() *MockConversionServiceInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Convert mocks base method.
+func (m *MockConversionServiceInterface) Convert(ctx context.Context, req *model.ConversionRequest) (*model.ConversionResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Convert", ctx, req)
+	ret0, _ := ret[0].(*model.ConversionResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Convert indicates an expected call of Convert.
+func (mr *MockConversionServiceInterfaceMockRecorder) Convert(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Convert", reflect.TypeOf((*MockConversionServiceInterface)(nil).Convert), ctx, req)
+}
+
+// NewClickID mocks base method.
+func (m *MockConversionServiceInterface) NewClickID() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewClickID")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// NewClickID indicates an expected call of NewClickID.
+func (mr *MockConversionServiceInterfaceMockRecorder) NewClickID() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewClickID", reflect.TypeOf((*MockConversionServiceInterface)(nil).NewClickID))
+}
+
+// OptedOut mocks base method.
+func (m *MockConversionServiceInterface) OptedOut(ctx context.Context, sl *model.ShortLink, header http.Header) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OptedOut", ctx, sl, header)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// OptedOut indicates an expected call of OptedOut.
+func (mr *MockConversionServiceInterfaceMockRecorder) OptedOut(ctx, sl, header interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OptedOut", reflect.TypeOf((*MockConversionServiceInterface)(nil).OptedOut), ctx, sl, header)
+}
+
+// Param mocks base method.
+func (m *MockConversionServiceInterface) Param() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Param")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Param indicates an expected call of Param.
+func (mr *MockConversionServiceInterfaceMockRecorder) Param() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Param", reflect.TypeOf((*MockConversionServiceInterface)(nil).Param))
+}
+
+// RecordClick mocks base method.
+func (m *MockConversionServiceInterface) RecordClick(ctx context.Context, clickID, shortCode, referer string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordClick", ctx, clickID, shortCode, referer)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordClick indicates an expected call of RecordClick.
+func (mr *MockConversionServiceInterfaceMockRecorder) RecordClick(ctx, clickID, shortCode, referer interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordClick", reflect.TypeOf((*MockConversionServiceInterface)(nil).RecordClick), ctx, clickID, shortCode, referer)
+}
+
+// TagURL mocks base method.
+func (m *MockConversionServiceInterface) TagURL(targetURL, clickID string) string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TagURL", targetURL, clickID)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// TagURL indicates an expected call of TagURL.
+func (mr *MockConversionServiceInterfaceMockRecorder) TagURL(targetURL, clickID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TagURL", reflect.TypeOf((*MockConversionServiceInterface)(nil).TagURL), targetURL, clickID)
+}
+
+// ValidClickID mocks base method.
+func (m *MockConversionServiceInterface) ValidClickID(clickID string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ValidClickID", clickID)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// ValidClickID indicates an expected call of ValidClickID.
+func (mr *MockConversionServiceInterfaceMockRecorder) ValidClickID(clickID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidClickID", reflect.TypeOf((*MockConversionServiceInterface)(nil).ValidClickID), clickID)
+}
+
+// MockFeatureFlagsInterface is a mock of FeatureFlagsInterface interface.
+type MockFeatureFlagsInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockFeatureFlagsInterfaceMockRecorder
+}
+
+// MockFeatureFlagsInterfaceMockRecorder is the mock recorder for MockFeatureFlagsInterface.
+type MockFeatureFlagsInterfaceMockRecorder struct {
+	mock *MockFeatureFlagsInterface
+}
+
+// NewMockFeatureFlagsInterface creates a new mock instance.
+func NewMockFeatureFlagsInterface(ctrl *gomock.Controller) *MockFeatureFlagsInterface {
+	mock := &MockFeatureFlagsInterface{ctrl: ctrl}
+	mock.recorder = &MockFeatureFlagsInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockFeatureFlagsInterface) EXPECT() *MockFeatureFlagsInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockFeatureFlagsInterface) Delete(ctx context.Context, name string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, name)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockFeatureFlagsInterfaceMockRecorder) Delete(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockFeatureFlagsInterface)(nil).Delete), ctx, name)
+}
+
+// List mocks base method.
+func (m *MockFeatureFlagsInterface) List(ctx context.Context) ([]model.FeatureFlag, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx)
+	ret0, _ := ret[0].([]model.FeatureFlag)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockFeatureFlagsInterfaceMockRecorder) List(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockFeatureFlagsInterface)(nil).List), ctx)
+}
+
+// Set mocks base method.
+func (m *MockFeatureFlagsInterface) Set(ctx context.Context, name string, req *model.FeatureFlagRequest) (*model.FeatureFlag, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Set", ctx, name, req)
+	ret0, _ := ret[0].(*model.FeatureFlag)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Set indicates an expected call of Set.
+func (mr *MockFeatureFlagsInterfaceMockRecorder) Set(ctx, name, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockFeatureFlagsInterface)(nil).Set), ctx, name, req)
+}
+
+// MockRulesInterface is a mock of RulesInterface interface.
+type MockRulesInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockRulesInterfaceMockRecorder
+}
+
+// MockRulesInterfaceMockRecorder is the mock recorder for MockRulesInterface.
+type MockRulesInterfaceMockRecorder struct {
+	mock *MockRulesInterface
+}
+
+// NewMockRulesInterface creates a new mock instance.
+func NewMockRulesInterface(ctrl *gomock.Controller) *MockRulesInterface {
+	mock := &MockRulesInterface{ctrl: ctrl}
+	mock.recorder = &MockRulesInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRulesInterface) EXPECT() *MockRulesInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockRulesInterface) Create(ctx context.Context, req *model.RuleRequest) (*model.Rule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, req)
+	ret0, _ := ret[0].(*model.Rule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockRulesInterfaceMockRecorder) Create(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRulesInterface)(nil).Create), ctx, req)
+}
+
+// Delete mocks base method.
+func (m *MockRulesInterface) Delete(ctx context.Context, id int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockRulesInterfaceMockRecorder) Delete(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockRulesInterface)(nil).Delete), ctx, id)
+}
+
+// List mocks base method.
+func (m *MockRulesInterface) List(ctx context.Context, kind string) ([]model.Rule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, kind)
+	ret0, _ := ret[0].([]model.Rule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockRulesInterfaceMockRecorder) List(ctx, kind interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockRulesInterface)(nil).List), ctx, kind)
+}
+
+// Update mocks base method.
+func (m *MockRulesInterface) Update(ctx context.Context, id int64, req *model.RuleRequest) (*model.Rule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, id, req)
+	ret0, _ := ret[0].(*model.Rule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockRulesInterfaceMockRecorder) Update(ctx, id, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockRulesInterface)(nil).Update), ctx, id, req)
+}
+
+// MockClaimServiceInterface is a mock of ClaimServiceInterface interface.
+type MockClaimServiceInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockClaimServiceInterfaceMockRecorder
+}
+
+// MockClaimServiceInterfaceMockRecorder is the mock recorder for MockClaimServiceInterface.
+type MockClaimServiceInterfaceMockRecorder struct {
+	mock *MockClaimServiceInterface
+}
+
+// NewMockClaimServiceInterface creates a new mock instance.
+func NewMockClaimServiceInterface(ctrl *gomock.Controller) *MockClaimServiceInterface {
+	mock := &MockClaimServiceInterface{ctrl: ctrl}
+	mock.recorder = &MockClaimServiceInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockClaimServiceInterface) EXPECT() *MockClaimServiceInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Authorize mocks base method.
+func (m *MockClaimServiceInterface) Authorize(ctx context.Context, shortCode string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Authorize", ctx, shortCode)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Authorize indicates an expected call of Authorize.
+func (mr *MockClaimServiceInterfaceMockRecorder) Authorize(ctx, shortCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Authorize", reflect.TypeOf((*MockClaimServiceInterface)(nil).Authorize), ctx, shortCode)
+}
+
+// Owner mocks base method.
+func (m *MockClaimServiceInterface) Owner(ctx context.Context) string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Owner", ctx)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Owner indicates an expected call of Owner.
+func (mr *MockClaimServiceInterfaceMockRecorder) Owner(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Owner", reflect.TypeOf((*MockClaimServiceInterface)(nil).Owner), ctx)
+}
+
+// Start mocks base method.
+func (m *MockClaimServiceInterface) Start(ctx context.Context, shortCode string) (*model.Claim, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Start", ctx, shortCode)
+	ret0, _ := ret[0].(*model.Claim)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Start indicates an expected call of Start.
+func (mr *MockClaimServiceInterfaceMockRecorder) Start(ctx, shortCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockClaimServiceInterface)(nil).Start), ctx, shortCode)
+}
+
+// Verify mocks base method.
+func (m *MockClaimServiceInterface) Verify(ctx context.Context, shortCode string) (*model.ClaimVerification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Verify", ctx, shortCode)
+	ret0, _ := ret[0].(*model.ClaimVerification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Verify indicates an expected call of Verify.
+func (mr *MockClaimServiceInterfaceMockRecorder) Verify(ctx, shortCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockClaimServiceInterface)(nil).Verify), ctx, shortCode)
+}
+
+// MockReputationInterface is a mock of ReputationInterface interface.
+type MockReputationInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockReputationInterfaceMockRecorder
+}
+
+// MockReputationInterfaceMockRecorder is the mock recorder for MockReputationInterface.
+type MockReputationInterfaceMockRecorder struct {
+	mock *MockReputationInterface
+}
+
+// NewMockReputationInterface creates a new mock instance.
+func NewMockReputationInterface(ctrl *gomock.Controller) *MockReputationInterface {
+	mock := &MockReputationInterface{ctrl: ctrl}
+	mock.recorder = &MockReputationInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockReputationInterface) EXPECT() *MockReputationInterfaceMockRecorder {
+	return m.recorder
+}
+
+// ClearOverride mocks base method.
+func (m *MockReputationInterface) ClearOverride(ctx context.Context, domain string) (*model.DomainReputation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClearOverride", ctx, domain)
+	ret0, _ := ret[0].(*model.DomainReputation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClearOverride indicates an expected call of ClearOverride.
+func (mr *MockReputationInterfaceMockRecorder) ClearOverride(ctx, domain interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClearOverride", reflect.TypeOf((*MockReputationInterface)(nil).ClearOverride), ctx, domain)
+}
+
+// Get mocks base method.
+func (m *MockReputationInterface) Get(ctx context.Context, domain string) (*model.DomainReputation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, domain)
+	ret0, _ := ret[0].(*model.DomainReputation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockReputationInterfaceMockRecorder) Get(ctx, domain interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockReputationInterface)(nil).Get), ctx, domain)
+}
+
+// List mocks base method.
+func (m *MockReputationInterface) List(ctx context.Context) ([]model.DomainReputation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx)
+	ret0, _ := ret[0].([]model.DomainReputation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockReputationInterfaceMockRecorder) List(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockReputationInterface)(nil).List), ctx)
+}
+
+// Override mocks base method.
+func (m *MockReputationInterface) Override(ctx context.Context, domain string, verdict string) (*model.DomainReputation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Override", ctx, domain, verdict)
+	ret0, _ := ret[0].(*model.DomainReputation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Override indicates an expected call of Override.
+func (mr *MockReputationInterfaceMockRecorder) Override(ctx, domain, verdict interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Override", reflect.TypeOf((*MockReputationInterface)(nil).Override), ctx, domain, verdict)
+}
+
+// Report mocks base method.
+func (m *MockReputationInterface) Report(ctx context.Context, shortCode string, clientIP string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Report", ctx, shortCode, clientIP)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Report indicates an expected call of Report.
+func (mr *MockReputationInterfaceMockRecorder) Report(ctx, shortCode, clientIP interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Report", reflect.TypeOf((*MockReputationInterface)(nil).Report), ctx, shortCode, clientIP)
+}
+
+// MockLogDrainsInterface is a mock of LogDrainsInterface interface.
+type MockLogDrainsInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockLogDrainsInterfaceMockRecorder
+}
+
+// MockLogDrainsInterfaceMockRecorder is the mock recorder for MockLogDrainsInterface.
+type MockLogDrainsInterfaceMockRecorder struct {
+	mock *MockLogDrainsInterface
+}
+
+// NewMockLogDrainsInterface creates a new mock instance.
+func NewMockLogDrainsInterface(ctrl *gomock.Controller) *MockLogDrainsInterface {
+	mock := &MockLogDrainsInterface{ctrl: ctrl}
+	mock.recorder = &MockLogDrainsInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLogDrainsInterface) EXPECT() *MockLogDrainsInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockLogDrainsInterface) Create(ctx context.Context, req *model.LogDrainRequest) (*model.LogDrain, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, req)
+	ret0, _ := ret[0].(*model.LogDrain)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockLogDrainsInterfaceMockRecorder) Create(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockLogDrainsInterface)(nil).Create), ctx, req)
+}
+
+// Delete mocks base method.
+func (m *MockLogDrainsInterface) Delete(ctx context.Context, id string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockLogDrainsInterfaceMockRecorder) Delete(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockLogDrainsInterface)(nil).Delete), ctx, id)
+}
+
+// List mocks base method.
+func (m *MockLogDrainsInterface) List(ctx context.Context, shortCode, campaign string) ([]model.LogDrain, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, shortCode, campaign)
+	ret0, _ := ret[0].([]model.LogDrain)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockLogDrainsInterfaceMockRecorder) List(ctx, shortCode, campaign interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockLogDrainsInterface)(nil).List), ctx, shortCode, campaign)
+}
+
+// MockMaintenanceModeInterface is a mock of MaintenanceModeInterface interface.
+type MockMaintenanceModeInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockMaintenanceModeInterfaceMockRecorder
+}
+
+// MockMaintenanceModeInterfaceMockRecorder is the mock recorder for MockMaintenanceModeInterface.
+type MockMaintenanceModeInterfaceMockRecorder struct {
+	mock *MockMaintenanceModeInterface
+}
+
+// NewMockMaintenanceModeInterface creates a new mock instance.
+func NewMockMaintenanceModeInterface(ctrl *gomock.Controller) *MockMaintenanceModeInterface {
+	mock := &MockMaintenanceModeInterface{ctrl: ctrl}
+	mock.recorder = &MockMaintenanceModeInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMaintenanceModeInterface) EXPECT() *MockMaintenanceModeInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Disable mocks base method.
+func (m *MockMaintenanceModeInterface) Disable(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Disable", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Disable indicates an expected call of Disable.
+func (mr *MockMaintenanceModeInterfaceMockRecorder) Disable(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Disable", reflect.TypeOf((*MockMaintenanceModeInterface)(nil).Disable), ctx)
+}
+
+// Enable mocks base method.
+func (m *MockMaintenanceModeInterface) Enable(ctx context.Context, req *model.MaintenanceRequest) (*model.Maintenance, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Enable", ctx, req)
+	ret0, _ := ret[0].(*model.Maintenance)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Enable indicates an expected call of Enable.
+func (mr *MockMaintenanceModeInterfaceMockRecorder) Enable(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Enable", reflect.TypeOf((*MockMaintenanceModeInterface)(nil).Enable), ctx, req)
+}
+
+// Get mocks base method.
+func (m *MockMaintenanceModeInterface) Get(ctx context.Context) (*model.Maintenance, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx)
+	ret0, _ := ret[0].(*model.Maintenance)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockMaintenanceModeInterfaceMockRecorder) Get(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockMaintenanceModeInterface)(nil).Get), ctx)
+}
+
+// MockReportServiceInterface is a mock of ReportServiceInterface interface.
+type MockReportServiceInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockReportServiceInterfaceMockRecorder
+}
+
+// MockReportServiceInterfaceMockRecorder is the mock recorder for MockReportServiceInterface.
+type MockReportServiceInterfaceMockRecorder struct {
+	mock *MockReportServiceInterface
+}
+
+// NewMockReportServiceInterface creates a new mock instance.
+func NewMockReportServiceInterface(ctrl *gomock.Controller) *MockReportServiceInterface {
+	mock := &MockReportServiceInterface{ctrl: ctrl}
+	mock.recorder = &MockReportServiceInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockReportServiceInterface) EXPECT() *MockReportServiceInterfaceMockRecorder {
+	return m.recorder
+}
+
+// LastWeek mocks base method.
+func (m *MockReportServiceInterface) LastWeek(ctx context.Context) (*model.WeeklyReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LastWeek", ctx)
+	ret0, _ := ret[0].(*model.WeeklyReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LastWeek indicates an expected call of LastWeek.
+func (mr *MockReportServiceInterfaceMockRecorder) LastWeek(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LastWeek", reflect.TypeOf((*MockReportServiceInterface)(nil).LastWeek), ctx)
+}
+
+// RenderHTML mocks base method.
+func (m *MockReportServiceInterface) RenderHTML(report *model.WeeklyReport) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenderHTML", report)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RenderHTML indicates an expected call of RenderHTML.
+func (mr *MockReportServiceInterfaceMockRecorder) RenderHTML(report interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenderHTML", reflect.TypeOf((*MockReportServiceInterface)(nil).RenderHTML), report)
+}
+
+// MockPublicStatsPagesInterface is a mock of PublicStatsPagesInterface interface.
+type MockPublicStatsPagesInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockPublicStatsPagesInterfaceMockRecorder
+}
+
+// MockPublicStatsPagesInterfaceMockRecorder is the mock recorder for MockPublicStatsPagesInterface.
+type MockPublicStatsPagesInterfaceMockRecorder struct {
+	mock *MockPublicStatsPagesInterface
+}
+
+// NewMockPublicStatsPagesInterface creates a new mock instance.
+func NewMockPublicStatsPagesInterface(ctrl *gomock.Controller) *MockPublicStatsPagesInterface {
+	mock := &MockPublicStatsPagesInterface{ctrl: ctrl}
+	mock.recorder = &MockPublicStatsPagesInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPublicStatsPagesInterface) EXPECT() *MockPublicStatsPagesInterfaceMockRecorder {
+	return m.recorder
+}
+
+// CacheTTL mocks base method.
+func (m *MockPublicStatsPagesInterface) CacheTTL() time.Duration {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CacheTTL")
+	ret0, _ := ret[0].(time.Duration)
+	return ret0
+}
+
+// CacheTTL indicates an expected call of CacheTTL.
+func (mr *MockPublicStatsPagesInterfaceMockRecorder) CacheTTL() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CacheTTL", reflect.TypeOf((*MockPublicStatsPagesInterface)(nil).CacheTTL))
+}
+
+// Get mocks base method.
+func (m *MockPublicStatsPagesInterface) Get(ctx context.Context, shortCode string) (*model.PublicStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, shortCode)
+	ret0, _ := ret[0].(*model.PublicStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockPublicStatsPagesInterfaceMockRecorder) Get(ctx, shortCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockPublicStatsPagesInterface)(nil).Get), ctx, shortCode)
+}
+
+// MockExpiryRemindersInterface is a mock of ExpiryRemindersInterface interface.
+type MockExpiryRemindersInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockExpiryRemindersInterfaceMockRecorder
+}
+
+// MockExpiryRemindersInterfaceMockRecorder is the mock recorder for MockExpiryRemindersInterface.
+type MockExpiryRemindersInterfaceMockRecorder struct {
+	mock *MockExpiryRemindersInterface
+}
+
+// NewMockExpiryRemindersInterface creates a new mock instance.
+func NewMockExpiryRemindersInterface(ctrl *gomock.Controller) *MockExpiryRemindersInterface {
+	mock := &MockExpiryRemindersInterface{ctrl: ctrl}
+	mock.recorder = &MockExpiryRemindersInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockExpiryRemindersInterface) EXPECT() *MockExpiryRemindersInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Extend mocks base method.
+func (m *MockExpiryRemindersInterface) Extend(ctx context.Context, shortCode string) (*model.ExtendResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Extend", ctx, shortCode)
+	ret0, _ := ret[0].(*model.ExtendResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Extend indicates an expected call of Extend.
+func (mr *MockExpiryRemindersInterfaceMockRecorder) Extend(ctx, shortCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Extend", reflect.TypeOf((*MockExpiryRemindersInterface)(nil).Extend), ctx, shortCode)
+}
+
+// Get mocks base method.
+func (m *MockExpiryRemindersInterface) Get(ctx context.Context) (*model.ReminderSubscription, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx)
+	ret0, _ := ret[0].(*model.ReminderSubscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockExpiryRemindersInterfaceMockRecorder) Get(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockExpiryRemindersInterface)(nil).Get), ctx)
+}
+
+// Subscribe mocks base method.
+func (m *MockExpiryRemindersInterface) Subscribe(ctx context.Context, req *model.ReminderSubscriptionRequest) (*model.ReminderSubscription, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Subscribe", ctx, req)
+	ret0, _ := ret[0].(*model.ReminderSubscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Subscribe indicates an expected call of Subscribe.
+func (mr *MockExpiryRemindersInterfaceMockRecorder) Subscribe(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockExpiryRemindersInterface)(nil).Subscribe), ctx, req)
+}
+
+// Unsubscribe mocks base method.
+func (m *MockExpiryRemindersInterface) Unsubscribe(ctx context.Context) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unsubscribe", ctx)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Unsubscribe indicates an expected call of Unsubscribe.
+func (mr *MockExpiryRemindersInterfaceMockRecorder) Unsubscribe(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unsubscribe", reflect.TypeOf((*MockExpiryRemindersInterface)(nil).Unsubscribe), ctx)
+}
@@ -1,17 +1,32 @@
 package model
 
 import (
+	"cmp"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
-// AccessLog represents an access log entity
+// AccessLog represents an access log entity. Edge is the cache status reported by the CDN edge
+// forwarding the access, hit or miss, and empty for direct requests to the origin. VisitorID is
+// what the visitor is counted under in the unique visitors, identified with VisitorStrategy.
 type AccessLog struct {
-	ID         int64     `json:"id" gorm:"primaryKey;autoIncrement"`
-	ShortCode  string    `json:"short_code" gorm:"type:varchar(6);index;not null"`
-	ClientIP   string    `json:"client_ip" gorm:"type:varchar(64)"`
-	UserAgent  string    `json:"user_agent" gorm:"type:varchar(512)"`
-	Referer    string    `json:"referer" gorm:"type:varchar(512)"`
-	AccessTime time.Time `json:"access_time" gorm:"autoCreateTime"`
+	ID              int64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	EventID         *string   `json:"-" gorm:"type:varchar(64);uniqueIndex:idx_event_id"`
+	ShortCode       string    `json:"short_code" gorm:"type:varchar(6);index;index:idx_code_time,priority:1;not null"`
+	ClientIP        string    `json:"client_ip" gorm:"type:varchar(64)"`
+	UserAgent       string    `json:"user_agent" gorm:"type:varchar(512)"`
+	Referer         string    `json:"referer" gorm:"type:varchar(512)"`
+	Source          string    `json:"source" gorm:"type:varchar(64);index"`
+	Device          string    `json:"device" gorm:"type:varchar(16);index"`
+	ClickID         string    `json:"click_id,omitempty" gorm:"type:varchar(32);index"`
+	Edge            string    `json:"edge,omitempty" gorm:"type:varchar(8)"`
+	AccessTime      time.Time `json:"access_time" gorm:"autoCreateTime;index:idx_code_time,priority:2"`
+	VisitorID       string    `json:"visitor_id,omitempty" gorm:"type:varchar(64)"`
+	VisitorStrategy string    `json:"visitor_strategy,omitempty" gorm:"type:varchar(8)"`
 }
 
 // TableName returns the table name for AccessLog
@@ -19,27 +34,168 @@ func (AccessLog) TableName() string {
 	return "access_logs"
 }
 
+// Visitor returns what the access is counted under in the unique visitors, the client IP for access
+// logs recorded without a visitor ID
+func (l *AccessLog) Visitor() string {
+	return cmp.Or(l.VisitorID, l.ClientIP)
+}
+
+// AccessEvent represents an access log as archived to object storage, one line of the NDJSON
+// objects of the archive
+type AccessEvent struct {
+	EventID         string    `json:"event_id"`
+	ShortCode       string    `json:"short_code"`
+	ClientIP        string    `json:"client_ip"`
+	UserAgent       string    `json:"user_agent"`
+	Referer         string    `json:"referer"`
+	Source          string    `json:"source"`
+	Device          string    `json:"device"`
+	ClickID         string    `json:"click_id,omitempty"`
+	Edge            string    `json:"edge,omitempty"`
+	AccessTime      time.Time `json:"access_time"`
+	VisitorID       string    `json:"visitor_id,omitempty"`
+	VisitorStrategy string    `json:"visitor_strategy,omitempty"`
+}
+
+// NewAccessEvent returns the archived form of an access log
+func NewAccessEvent(accessLog *AccessLog) AccessEvent {
+	event := AccessEvent{
+		ShortCode:       accessLog.ShortCode,
+		ClientIP:        accessLog.ClientIP,
+		UserAgent:       accessLog.UserAgent,
+		Referer:         accessLog.Referer,
+		Source:          accessLog.Source,
+		Device:          accessLog.Device,
+		ClickID:         accessLog.ClickID,
+		Edge:            accessLog.Edge,
+		AccessTime:      accessLog.AccessTime,
+		VisitorID:       accessLog.VisitorID,
+		VisitorStrategy: accessLog.VisitorStrategy,
+	}
+	if accessLog.EventID != nil {
+		event.EventID = *accessLog.EventID
+	}
+	return event
+}
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// AccessLogCursor marks the position after the last access log of a page
+type AccessLogCursor struct {
+	AccessTime time.Time
+	ID         int64
+}
+
+// Encode returns the opaque string form of the cursor
+func (c AccessLogCursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Position()))
+}
+
+// Position returns the position of the cursor in the logs, which Encode makes opaque
+func (c AccessLogCursor) Position() string {
+	return fmt.Sprintf("%d:%d", c.AccessTime.UnixNano(), c.ID)
+}
+
+// DecodeAccessLogCursor parses a cursor produced by AccessLogCursor.Encode
+func DecodeAccessLogCursor(s string) (*AccessLogCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return ParseAccessLogCursor(string(raw))
+}
+
+// ParseAccessLogCursor parses the position of a cursor, as returned by AccessLogCursor.Position
+func ParseAccessLogCursor(position string) (*AccessLogCursor, error) {
+	parts := strings.SplitN(position, ":", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &AccessLogCursor{AccessTime: time.Unix(0, nanos).UTC(), ID: id}, nil
+}
+
+// AccessLogQuery filters and pages access logs of a short link
+type AccessLogQuery struct {
+	ShortCode string
+	From      time.Time // inclusive, zero for unbounded
+	To        time.Time // exclusive, zero for unbounded
+	Source    string
+	Device    string
+	Ascending bool
+	Cursor    *AccessLogCursor
+	Limit     int
+}
+
+// AccessLogPage represents one page of access logs
+type AccessLogPage struct {
+	Logs       []AccessLog `json:"logs"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
 // AccessLogMessage represents the message sent to RocketMQ
 type AccessLogMessage struct {
 	ShortCode  string    `json:"short_code"`
 	ClientIP   string    `json:"client_ip"`
 	UserAgent  string    `json:"user_agent"`
 	Referer    string    `json:"referer"`
+	ClickID    string    `json:"click_id,omitempty"`
 	AccessTime time.Time `json:"access_time"`
 }
 
 // AnalyticsResponse represents the analytics data
 type AnalyticsResponse struct {
-	ShortCode  string          `json:"short_code"`
-	PV         int64           `json:"pv"`
-	UV         int64           `json:"uv"`
-	TopSources []SourceStat    `json:"top_sources"`
+	ShortCode      string         `json:"short_code"`
+	PV             int64          `json:"pv"`
+	UV             int64          `json:"uv"`
+	Conversions    int64          `json:"conversions"`
+	ConversionRate float64        `json:"conversion_rate"`
+	TopSources     []SourceStat   `json:"top_sources"`
+	Retention      StatsRetention `json:"retention"`
+	// UpdatedAt is the stats update time read before the counters, zero if unknown
+	UpdatedAt time.Time `json:"-"`
+}
+
+// AggregateRequest represents a query for the combined analytics of several short links, listed by
+// short code or selected by campaign
+type AggregateRequest struct {
+	ShortCodes []string `json:"short_codes" binding:"omitempty,max=100,dive,required"`
+	Campaign   string   `json:"campaign" binding:"max=255" example:"spring-sale"`
+}
+
+// AggregateResponse represents the combined analytics of several short links and each link's own
+type AggregateResponse struct {
+	PV             int64               `json:"pv"`
+	UV             int64               `json:"uv"`
+	Conversions    int64               `json:"conversions"`
+	ConversionRate float64             `json:"conversion_rate"`
+	TopSources     []SourceStat        `json:"top_sources"`
+	Links          []AnalyticsResponse `json:"links"`
+	Retention      StatsRetention      `json:"retention"`
+}
+
+// StatsRetention represents how long each metric is kept, as a duration or "infinite"
+type StatsRetention struct {
+	PV      string `json:"pv"`
+	UV      string `json:"uv"`
+	Sources string `json:"sources"`
 }
 
 // SourceStat represents source statistics
 type SourceStat struct {
-	Source string `json:"source"`
-	Count  int64  `json:"count"`
+	Source         string  `json:"source"`
+	Count          int64   `json:"count"`
+	Conversions    int64   `json:"conversions"`
+	ConversionRate float64 `json:"conversion_rate"`
 }
 
 // Stats represents general statistics
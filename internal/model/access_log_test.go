@@ -32,6 +32,21 @@ func TestAccessLog_Structure(t *testing.T) {
 	assert.Equal(t, now, log.AccessTime)
 }
 
+func TestAccessLogCursor_RoundTrip(t *testing.T) {
+	cursor := AccessLogCursor{AccessTime: time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC), ID: 42}
+
+	decoded, err := DecodeAccessLogCursor(cursor.Encode())
+	assert.NoError(t, err)
+	assert.Equal(t, cursor, *decoded)
+}
+
+func TestDecodeAccessLogCursor_Invalid(t *testing.T) {
+	for _, s := range []string{"", "!!", "bm9jb2xvbg", "YWJjOjE", "MTI6eHl6"} {
+		_, err := DecodeAccessLogCursor(s)
+		assert.ErrorIs(t, err, ErrInvalidCursor, s)
+	}
+}
+
 func TestAccessLogMessage_Structure(t *testing.T) {
 	now := time.Now()
 
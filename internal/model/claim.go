@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// Claim represents the claim of a link started by a caller, verified once its token is published
+// either in a DNS TXT record of the destination domain or in a meta tag of the destination's home
+// page
+type Claim struct {
+	ShortCode string    `json:"short_code"`
+	Domain    string    `json:"domain"`
+	Token     string    `json:"token"`
+	DNSName   string    `json:"dns_name"`
+	DNSValue  string    `json:"dns_value"`
+	MetaURL   string    `json:"meta_url"`
+	MetaTag   string    `json:"meta_tag"`
+	ExpireAt  time.Time `json:"expire_at"`
+}
+
+// ClaimVerification represents a verified claim, the link now belonging to the caller
+type ClaimVerification struct {
+	ShortCode string `json:"short_code"`
+	// Method is how control of the destination domain was proven, dns or meta
+	Method string `json:"method"`
+}
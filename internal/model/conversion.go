@@ -0,0 +1,40 @@
+package model
+
+import (
+	"time"
+)
+
+// DefaultConversionEvent is the event name used when a postback omits it
+const DefaultConversionEvent = "conversion"
+
+// Conversion represents a conversion reported by an advertiser for a redirected click
+type Conversion struct {
+	ID          int64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	ClickID     string    `json:"click_id" gorm:"type:varchar(32);uniqueIndex:idx_click_event;not null"`
+	Event       string    `json:"event" gorm:"type:varchar(64);uniqueIndex:idx_click_event;not null"`
+	ShortCode   string    `json:"short_code" gorm:"type:varchar(6);index;not null"`
+	Source      string    `json:"source" gorm:"type:varchar(64)"`
+	Value       float64   `json:"value"`
+	ConvertedAt time.Time `json:"converted_at" gorm:"autoCreateTime"`
+}
+
+// TableName returns the table name for Conversion
+func (Conversion) TableName() string {
+	return "conversions"
+}
+
+// ConversionRequest represents the conversion postback payload
+type ConversionRequest struct {
+	ClickID string  `json:"click_id" binding:"required"`
+	Event   string  `json:"event"`
+	Value   float64 `json:"value"`
+}
+
+// ConversionResponse represents the result of a conversion postback
+type ConversionResponse struct {
+	ClickID   string `json:"click_id"`
+	ShortCode string `json:"short_code"`
+	Source    string `json:"source"`
+	Event     string `json:"event"`
+	Duplicate bool   `json:"duplicate"`
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+)
+
+// DeadLetter represents an access log event set aside after it could not be processed
+type DeadLetter struct {
+	ID       string    `json:"id"`
+	Payload  string    `json:"payload"`
+	Reason   string    `json:"reason"`
+	Attempts int64     `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// DeadLetterPage represents one page of the dead-letter queue, oldest first
+type DeadLetterPage struct {
+	DeadLetters []*DeadLetter `json:"dead_letters"`
+	Depth       int64         `json:"depth"`
+	Next        string        `json:"next,omitempty"`
+}
+
+// DeadLetterRequest represents a request selecting dead letters by ID
+type DeadLetterRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// ReplayResponse represents the outcome of replaying dead letters
+type ReplayResponse struct {
+	Replayed int `json:"replayed"`
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// LogDrain represents an endpoint the stored access events of a link, or of the links of a
+// campaign, are posted to in batches signed with its secret. The secret is only returned when the
+// drain is registered.
+type LogDrain struct {
+	ID        string    `json:"id"`
+	ShortCode string    `json:"short_code,omitempty"`
+	Campaign  string    `json:"campaign,omitempty"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Owner     string    `json:"owner,omitempty" swaggerignore:"true"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LogDrainRequest represents the registration of a log drain for either a link or a campaign
+type LogDrainRequest struct {
+	ShortCode string `json:"short_code" binding:"max=16"`
+	Campaign  string `json:"campaign" binding:"max=255"`
+	URL       string `json:"url" binding:"required,url,max=2048"`
+}
+
+// LogDrainBatch represents the body posted to a log drain
+type LogDrainBatch struct {
+	DrainID string        `json:"drain_id"`
+	Events  []AccessEvent `json:"events"`
+}
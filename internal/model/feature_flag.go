@@ -0,0 +1,24 @@
+package model
+
+// Sources of the rule of a feature flag
+const (
+	FeatureFlagSourceConfig   = "config"
+	FeatureFlagSourceOverride = "override"
+)
+
+// FeatureFlag represents the rollout of a feature. An enabled feature is on for the listed API
+// keys and for the given percentage of the remaining traffic.
+type FeatureFlag struct {
+	Name       string   `json:"name"`
+	Enabled    bool     `json:"enabled"`
+	Percentage int      `json:"percentage"`
+	APIKeys    []string `json:"api_keys,omitempty"`
+	Source     string   `json:"source"`
+}
+
+// FeatureFlagRequest represents a runtime override of a feature flag
+type FeatureFlagRequest struct {
+	Enabled    *bool    `json:"enabled" binding:"required"`
+	Percentage int      `json:"percentage" binding:"min=0,max=100"`
+	APIKeys    []string `json:"api_keys"`
+}
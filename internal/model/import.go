@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// ImportedLink is a short link exported from another shortener, imported under its own code.
+// Clicks are its past clicks per UTC day, without visitors.
+type ImportedLink struct {
+	Code      string
+	URL       string
+	Title     string
+	CreatedAt time.Time
+	Clicks    []DailyClicks
+}
+
+// ImportConflict is an imported link left out, with the reason why
+type ImportConflict struct {
+	Code   string
+	URL    string
+	Reason string
+}
+
+// ImportReport lists the codes an import created, those imported by an earlier run and the
+// conflicts left out, along with the clicks seeded. In a dry run nothing is stored.
+type ImportReport struct {
+	DryRun    bool
+	Imported  []string
+	Skipped   []string
+	Conflicts []ImportConflict
+	Clicks    int64
+}
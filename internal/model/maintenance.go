@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// Maintenance represents the maintenance mode. While it is on, redirects keep working and writes to
+// links are rejected.
+type Maintenance struct {
+	Enabled bool       `json:"enabled"`
+	Reason  string     `json:"reason,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+	// RetryAfter is the number of seconds rejected clients are asked to wait before retrying
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// MaintenanceRequest represents a request turning the maintenance mode on
+type MaintenanceRequest struct {
+	Reason     string `json:"reason"`
+	RetryAfter int    `json:"retry_after" binding:"min=0"`
+}
@@ -0,0 +1,185 @@
+package model
+
+import "time"
+
+// RuntimeMetrics represents a snapshot of the process runtime and request load
+type RuntimeMetrics struct {
+	BuildInfo        *BuildInfo           `json:"build_info,omitempty"`
+	UptimeSeconds    int64                `json:"uptime_seconds"`
+	Goroutines       int                  `json:"goroutines"`
+	HeapAllocBytes   uint64               `json:"heap_alloc_bytes"`
+	HeapInuseBytes   uint64               `json:"heap_inuse_bytes"`
+	HeapObjects      uint64               `json:"heap_objects"`
+	SysBytes         uint64               `json:"sys_bytes"`
+	NumGC            uint32               `json:"num_gc"`
+	GCPauseTotalNs   uint64               `json:"gc_pause_total_ns"`
+	GCPauseRecentNs  []uint64             `json:"gc_pause_recent_ns"`
+	RequestsTotal    int64                `json:"requests_total"`
+	RequestsInFlight int64                `json:"requests_in_flight"`
+	GoroutinePanics  int64                `json:"goroutine_panics"`
+	DeadLetterDepth  *int64               `json:"dead_letter_depth,omitempty"`
+	ProducerBuffer   *ProducerBufferStats `json:"producer_buffer,omitempty"`
+	Replication      *ReplicationStats    `json:"replication,omitempty"`
+	RedisShards      []RedisShardStats    `json:"redis_shards,omitempty"`
+	Shadow           []ShadowStats        `json:"shadow,omitempty"`
+	EdgePurge        *EdgePurgeStats      `json:"edge_purge,omitempty"`
+	AccessArchive    *AccessArchiveStats  `json:"access_archive,omitempty"`
+	Warehouse        []WarehouseStats     `json:"warehouse,omitempty"`
+	LogDrains        *LogDrainStats       `json:"log_drains,omitempty"`
+	Slow             []SlowStats          `json:"slow,omitempty"`
+	RateLimit        *RateLimitStats      `json:"rate_limit,omitempty"`
+}
+
+// BuildInfo represents the build of the running binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// ProducerBufferStats represents the state of the local buffer in front of the MQ producer
+type ProducerBufferStats struct {
+	Buffered   int   `json:"buffered"`
+	Sent       int64 `json:"sent"`
+	Spilled    int64 `json:"spilled"`
+	Dropped    int64 `json:"dropped"`
+	SpillBytes int64 `json:"spill_bytes"`
+}
+
+// ConsumerStatus represents the state of the access log consumer. Lag is the number of messages
+// waiting to be consumed, omitted when the broker does not report it.
+type ConsumerStatus struct {
+	Driver        string     `json:"driver"`
+	Topic         string     `json:"topic"`
+	Group         string     `json:"group,omitempty"`
+	Status        string     `json:"status" enums:"started,stopped"`
+	LastMessageAt *time.Time `json:"last_message_at,omitempty"`
+	Processed     int64      `json:"processed"`
+	Errors        int64      `json:"errors"`
+	Lag           *int64     `json:"lag,omitempty"`
+}
+
+// ReplicationStats represents how far a replica is behind the primary region. The lag is measured
+// on the latest event, from when its change was made on the primary until it was applied.
+type ReplicationStats struct {
+	Region      string     `json:"region"`
+	Applied     int64      `json:"applied"`
+	Skipped     int64      `json:"skipped"`
+	LagSeconds  float64    `json:"lag_seconds"`
+	LastEventAt *time.Time `json:"last_event_at,omitempty"`
+}
+
+// RedisShardStats represents the health of one Redis shard. Failures counts the consecutive
+// commands that could not reach it, a down shard failing fast until a health check passes.
+type RedisShardStats struct {
+	Name      string `json:"name"`
+	Addr      string `json:"addr"`
+	Healthy   bool   `json:"healthy"`
+	Failures  int64  `json:"failures"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// ShadowStats represents the writes mirrored to and reads compared against the storage a migration
+// moves links to. Divergences counts reads whose result differed from the current storage.
+type ShadowStats struct {
+	Storage        string `json:"storage"`
+	Target         string `json:"target"`
+	Writes         int64  `json:"writes"`
+	WriteErrors    int64  `json:"write_errors"`
+	Reads          int64  `json:"reads"`
+	ReadErrors     int64  `json:"read_errors"`
+	Divergences    int64  `json:"divergences"`
+	LastDivergence string `json:"last_divergence,omitempty"`
+}
+
+// Statuses of a purge delivered to the CDN
+const (
+	PurgeStatusPurged = "purged"
+	PurgeStatusFailed = "failed"
+)
+
+// EdgePurgeStats represents the purges of cached redirects delivered to the CDN. Queued counts the
+// purges waiting for delivery, Dropped those lost to a full queue, and Recent lists the latest
+// deliveries, newest first.
+type EdgePurgeStats struct {
+	Provider string          `json:"provider"`
+	Queued   int             `json:"queued"`
+	Purged   int64           `json:"purged"`
+	Failed   int64           `json:"failed"`
+	Retries  int64           `json:"retries"`
+	Dropped  int64           `json:"dropped"`
+	Recent   []PurgeDelivery `json:"recent"`
+}
+
+// PurgeDelivery represents the delivery of the purge of a short link, purged or failed after its
+// attempts
+type PurgeDelivery struct {
+	ShortCode   string    `json:"short_code"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	Error       string    `json:"error,omitempty"`
+	DeliveredAt time.Time `json:"delivered_at"`
+}
+
+// AccessArchiveStats represents the export of access events to object storage. Buffered counts the
+// events waiting for the next flush, failed writes included, Dropped those lost to a full buffer.
+type AccessArchiveStats struct {
+	Bucket    string     `json:"bucket"`
+	Buffered  int        `json:"buffered"`
+	Archived  int64      `json:"archived"`
+	Objects   int64      `json:"objects"`
+	Failed    int64      `json:"failed"`
+	Dropped   int64      `json:"dropped"`
+	LastFlush *time.Time `json:"last_flush,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// WarehouseStats represents the events streamed to a warehouse destination. Buffered counts the
+// rows waiting for the next insert, failed inserts included, Dropped those lost to a full buffer.
+type WarehouseStats struct {
+	Name      string     `json:"name"`
+	Type      string     `json:"type"`
+	Buffered  int        `json:"buffered"`
+	Inserted  int64      `json:"inserted"`
+	Failed    int64      `json:"failed"`
+	Dropped   int64      `json:"dropped"`
+	LastFlush *time.Time `json:"last_flush,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// LogDrainStats represents the access events forwarded to the log drains of link owners. Delivered
+// and Dropped count events, Failed the batches given up after their attempts, their events dropped.
+type LogDrainStats struct {
+	Drains    int   `json:"drains"`
+	Buffered  int   `json:"buffered"`
+	Delivered int64 `json:"delivered"`
+	Failed    int64 `json:"failed"`
+	Retries   int64 `json:"retries"`
+	Dropped   int64 `json:"dropped"`
+}
+
+// SlowStats represents the calls to a dependency that took at least its threshold. LastOperation is
+// the statement, command or route of the latest one.
+type SlowStats struct {
+	Target           string  `json:"target"`
+	ThresholdSeconds float64 `json:"threshold_seconds"`
+	Slow             int64   `json:"slow"`
+	LastOperation    string  `json:"last_operation,omitempty"`
+}
+
+// RateLimitStats represents the generate requests let through, queued and rejected by the rate
+// limit. Queued requests wait for their turn, and WaitSecondsTotal over Queued is their mean wait.
+// Abandoned counts the queued requests whose client went away before their turn.
+type RateLimitStats struct {
+	Mode             string  `json:"mode" enums:"reject,queue"`
+	QueueSize        int     `json:"queue_size"`
+	QueueDepth       int     `json:"queue_depth"`
+	Allowed          int64   `json:"allowed"`
+	Queued           int64   `json:"queued"`
+	Rejected         int64   `json:"rejected"`
+	Abandoned        int64   `json:"abandoned"`
+	WaitSecondsTotal float64 `json:"wait_seconds_total"`
+	WaitSecondsMax   float64 `json:"wait_seconds_max"`
+}
@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+// ReminderSubscription represents where the owner of links is reminded of the ones about to expire:
+// a webhook, posted reminders signed with the secret, and an email address. The secret is only
+// returned when subscribing.
+type ReminderSubscription struct {
+	WebhookURL string    `json:"webhook_url,omitempty"`
+	Email      string    `json:"email,omitempty"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ReminderSubscriptionRequest represents the subscription of the caller to expiry reminders, by
+// webhook, email or both
+type ReminderSubscriptionRequest struct {
+	WebhookURL string `json:"webhook_url" binding:"omitempty,url,max=2048"`
+	Email      string `json:"email" binding:"omitempty,email,max=254"`
+}
+
+// ExpiryReminder represents the body posted to the webhook of an owner, listing their links
+// entering the reminder window, soonest first
+type ExpiryReminder struct {
+	Links []ExpiringLink `json:"links"`
+}
+
+// ExpiringLink represents a link about to expire, and where its owner extends it
+type ExpiringLink struct {
+	ShortCode   string    `json:"short_code"`
+	ShortLink   string    `json:"short_link"`
+	OriginalURL string    `json:"original_url"`
+	ExpireAt    time.Time `json:"expire_at"`
+	ExtendURL   string    `json:"extend_url"`
+}
+
+// ExtendResponse represents the new expiry of an extended link
+type ExtendResponse struct {
+	ShortCode string    `json:"short_code"`
+	ExpireAt  time.Time `json:"expire_at"`
+}
@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+// CampaignDailyStat represents the clicks of one link of a campaign on one day
+type CampaignDailyStat struct {
+	Campaign    string
+	ShortCode   string
+	OriginalURL string
+	Title       string
+	Day         time.Time
+	Clicks      int64
+	Visitors    int64
+}
+
+// CampaignDailySourceStat represents the clicks of a campaign's links from one source on one day
+type CampaignDailySourceStat struct {
+	Campaign string
+	Day      time.Time
+	Source   string
+	Clicks   int64
+}
+
+// LinkClicks represents how the clicks of one link of a campaign changed between periods
+type LinkClicks struct {
+	ShortCode   string `json:"short_code"`
+	OriginalURL string `json:"original_url"`
+	Title       string `json:"title,omitempty"`
+	MetricChange
+}
+
+// CampaignSummary represents the week of one campaign compared with the week before it
+type CampaignSummary struct {
+	Campaign   string         `json:"campaign"`
+	Links      int            `json:"links"`
+	Clicks     MetricChange   `json:"clicks"`
+	Visitors   MetricChange   `json:"visitors"`
+	TopLinks   []LinkClicks   `json:"top_links"`
+	TopSources []SourceChange `json:"top_sources"`
+}
+
+// WeeklyReport represents the summaries of the campaigns clicked during a week, busiest first
+type WeeklyReport struct {
+	Current     Period            `json:"current"`
+	Previous    Period            `json:"previous"`
+	GeneratedAt time.Time         `json:"generated_at"`
+	Campaigns   []CampaignSummary `json:"campaigns"`
+}
@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// Verdicts of the reputation of a destination domain
+const (
+	// ReputationAllow lets links to the domain be created and redirected as usual
+	ReputationAllow = "allow"
+	// ReputationInterstitial shows visitors a preview of the destination before they go on
+	ReputationInterstitial = "interstitial"
+	// ReputationBlock refuses new links to the domain, existing ones being redirected through the
+	// preview
+	ReputationBlock = "block"
+)
+
+// DomainReputation represents what is known of a destination domain, its registrable domain such
+// as example.co.uk for shop.example.co.uk. Score and Verdict are computed from the counts, unless
+// an operator overrode the verdict.
+type DomainReputation struct {
+	Domain     string     `json:"domain" gorm:"primaryKey;type:varchar(255)"`
+	Links      int64      `json:"links" gorm:"not null;default:0"`
+	Reports    int64      `json:"reports" gorm:"not null;default:0"`
+	ReportedAt *time.Time `json:"reported_at,omitempty"`
+	Checks     int64      `json:"checks" gorm:"not null;default:0"`
+	DeadChecks int64      `json:"dead_checks" gorm:"not null;default:0"`
+	Flagged    bool       `json:"flagged" gorm:"not null;default:false;comment:1-listed by Safe Browsing at the last check"`
+	SampleURL  string     `json:"sample_url" gorm:"type:varchar(2048);not null;default:''"`
+	Override   string     `json:"override,omitempty" gorm:"type:varchar(16);not null;default:''"`
+	CheckedAt  *time.Time `json:"checked_at,omitempty" gorm:"index"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Score      int        `json:"score" gorm:"-"`
+	Verdict    string     `json:"verdict" gorm:"-"`
+}
+
+// TableName returns the table name for DomainReputation
+func (DomainReputation) TableName() string {
+	return "domain_reputation"
+}
+
+// ReputationOverrideRequest sets the verdict of a domain whatever its score
+type ReputationOverrideRequest struct {
+	Verdict string `json:"verdict" binding:"required,oneof=allow interstitial block" example:"block"`
+}
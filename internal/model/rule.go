@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// Kinds of the rules set at runtime on the admin port
+const (
+	// RuleKindBotUA counts redirects of User-Agents containing the pattern as bot traffic
+	RuleKindBotUA = "bot_ua"
+	// RuleKindReservedWord keeps short codes spelling the pattern from being handed out
+	RuleKindReservedWord = "reserved_word"
+	// RuleKindURLBlocklist refuses links to the pattern's domain and its subdomains
+	RuleKindURLBlocklist = "url_blocklist"
+	// RuleKindSource reports referers whose host contains the pattern under the rule's source
+	RuleKindSource = "source"
+)
+
+// Rule is a pattern of the bot, reserved word, URL blocklist or traffic source rules, kept in
+// MySQL and applied by every instance without a redeploy. Patterns are matched case-insensitively.
+type Rule struct {
+	ID        int64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	Kind      string    `json:"kind" gorm:"type:varchar(32);uniqueIndex:idx_kind_pattern;not null"`
+	Pattern   string    `json:"pattern" gorm:"type:varchar(255);uniqueIndex:idx_kind_pattern;not null"`
+	Source    string    `json:"source,omitempty" gorm:"type:varchar(64);not null;default:''"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName returns the table name for Rule
+func (Rule) TableName() string {
+	return "rules"
+}
+
+// RuleRequest creates a rule or replaces one. Source names the traffic source of source rules
+// and is left empty by the other kinds.
+type RuleRequest struct {
+	Kind    string `json:"kind" binding:"required,oneof=bot_ua reserved_word url_blocklist source" example:"bot_ua"`
+	Pattern string `json:"pattern" binding:"required,max=255" example:"headlesschrome"`
+	Source  string `json:"source" binding:"max=64" example:"newsletter"`
+}
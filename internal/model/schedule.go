@@ -0,0 +1,191 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule routes the redirects of a short link to other destinations by day of the week and time
+// of day, in Timezone or the configured one when empty. The first rule matching the time of a
+// redirect gives its destination, the original URL of the link being kept when none does.
+type Schedule struct {
+	Timezone string         `json:"timezone,omitempty" example:"Europe/Paris"`
+	Rules    []ScheduleRule `json:"rules" binding:"max=20"`
+}
+
+// ScheduleRule is a weekly window of a schedule. Days is a cron day-of-week field: numbers from 0
+// to 7, 0 and 7 being Sunday, or names like mon, in lists and ranges like mon-fri,sun, with * for
+// every day. From and To are the HH:MM times the window starts and ends at, omitted for the start
+// and end of the day; a window ending before it starts spans midnight into the next day.
+type ScheduleRule struct {
+	Days string `json:"days" example:"mon-fri"`
+	From string `json:"from,omitempty" example:"09:00"`
+	To   string `json:"to,omitempty" example:"18:00"`
+	URL  string `json:"url" example:"https://example.com/booking"`
+}
+
+// ScheduleRuleError tells which field of a schedule rule is malformed and why
+type ScheduleRuleError struct {
+	Field   string
+	Message string
+}
+
+// Error implements error
+func (e *ScheduleRuleError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// minutesPerDay bounds the times of day of schedule windows, in minutes since midnight
+const minutesPerDay = 24 * 60
+
+// dayNames are the names of the days of the week in cron fields, Sunday first
+var dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Location returns the timezone of the schedule, fallback when it has none or it is unknown
+func (s *Schedule) Location(fallback *time.Location) *time.Location {
+	if s.Timezone == "" {
+		return fallback
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return fallback
+	}
+	return loc
+}
+
+// Destination returns the destination of a redirect at now, the URL of the first matching rule,
+// "" when no rule matches. Times are taken in the timezone of the schedule, loc without one.
+func (s *Schedule) Destination(now time.Time, loc *time.Location) string {
+	now = now.In(s.Location(loc))
+	for _, rule := range s.Rules {
+		if rule.Matches(now) {
+			return rule.URL
+		}
+	}
+	return ""
+}
+
+// Matches checks if a time, in the timezone of the schedule, falls in the window of the rule.
+// Malformed rules match nothing.
+func (r *ScheduleRule) Matches(t time.Time) bool {
+	days, from, to, err := r.parse()
+	if err != nil {
+		return false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	today := int(t.Weekday())
+	if from < to {
+		return days[today] && minute >= from && minute < to
+	}
+	// The window spans midnight, its end belonging to the day after one of its days
+	yesterday := (today + 6) % 7
+	return (days[today] && minute >= from) || (days[yesterday] && minute < to)
+}
+
+// Validate checks that the days and times of the rule are well-formed, returning a
+// *ScheduleRuleError when they are not
+func (r *ScheduleRule) Validate() error {
+	_, _, _, err := r.parse()
+	return err
+}
+
+// parse returns the days of the week of the rule, Sunday first, and the minutes of the day its
+// window starts and ends at
+func (r *ScheduleRule) parse() (days [7]bool, from, to int, err error) {
+	if days, err = parseDays(r.Days); err != nil {
+		return days, 0, 0, &ScheduleRuleError{Field: "days", Message: err.Error()}
+	}
+	from, to = 0, minutesPerDay
+	if r.From != "" {
+		if from, err = parseTimeOfDay(r.From); err != nil || from == minutesPerDay {
+			return days, 0, 0, &ScheduleRuleError{Field: "from", Message: "must be a time like 09:00"}
+		}
+	}
+	if r.To != "" {
+		if to, err = parseTimeOfDay(r.To); err != nil {
+			return days, 0, 0, &ScheduleRuleError{Field: "to", Message: "must be a time like 18:00 or 24:00"}
+		}
+	}
+	if from == to {
+		return days, 0, 0, &ScheduleRuleError{Field: "to", Message: "must differ from from"}
+	}
+	return days, from, to, nil
+}
+
+// parseDays parses a cron day-of-week field
+func parseDays(field string) ([7]bool, error) {
+	var days [7]bool
+	if strings.TrimSpace(field) == "" {
+		return days, errors.New("must be days like mon-fri or *")
+	}
+	for _, part := range strings.Split(field, ",") {
+		part = strings.TrimSpace(part)
+		if part == "*" {
+			for i := range days {
+				days[i] = true
+			}
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := parseDay(first)
+		if err != nil {
+			return days, err
+		}
+		end := start
+		if isRange {
+			if end, err = parseDay(last); err != nil {
+				return days, err
+			}
+			// Sunday ends ranges as 7, so that sat-sun reads as a weekend
+			if end == 0 && start > 0 {
+				end = 7
+			}
+			if end < start {
+				return days, fmt.Errorf("%q ends before it starts", part)
+			}
+		}
+		for day := start; day <= end; day++ {
+			days[day%7] = true
+		}
+	}
+	return days, nil
+}
+
+// parseDay parses a day of the week of a cron field, by number or name. Sunday is 0 by name and
+// either 0 or 7 by number.
+func parseDay(value string) (int, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for i, name := range dayNames {
+		if value == name {
+			return i, nil
+		}
+	}
+	day, err := strconv.Atoi(value)
+	if err != nil || day < 0 || day > 7 {
+		return 0, fmt.Errorf("%q is not a day, use 0-7 or sun-sat", value)
+	}
+	return day, nil
+}
+
+// parseTimeOfDay parses an HH:MM time into minutes since midnight, up to 24:00
+func parseTimeOfDay(value string) (int, error) {
+	hours, minutes, ok := strings.Cut(value, ":")
+	if !ok || len(hours) != 2 || len(minutes) != 2 {
+		return 0, errors.New("not an HH:MM time")
+	}
+	h, err := strconv.Atoi(hours)
+	if err != nil {
+		return 0, err
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil {
+		return 0, err
+	}
+	if h < 0 || m < 0 || m > 59 || h*60+m > minutesPerDay {
+		return 0, errors.New("not a time of day")
+	}
+	return h*60 + m, nil
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDays(t *testing.T) {
+	tests := []struct {
+		field   string
+		want    [7]bool
+		wantErr bool
+	}{
+		{field: "*", want: [7]bool{true, true, true, true, true, true, true}},
+		{field: "mon-fri", want: [7]bool{false, true, true, true, true, true, false}},
+		{field: "sat-sun", want: [7]bool{true, false, false, false, false, false, true}},
+		{field: "1,3, 7", want: [7]bool{true, true, false, true, false, false, false}},
+		{field: "Fri-6", want: [7]bool{false, false, false, false, false, true, true}},
+		{field: "", wantErr: true},
+		{field: "fri-mon", wantErr: true},
+		{field: "8", wantErr: true},
+		{field: "weekend", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			days, err := parseDays(tt.field)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, days)
+		})
+	}
+}
+
+func TestScheduleRule_Matches(t *testing.T) {
+	// 2026-10-16 is a Friday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.UTC)
+	}
+	office := &ScheduleRule{Days: "mon-fri", From: "09:00", To: "18:00"}
+	assert.True(t, office.Matches(at(16, 9, 0)))
+	assert.False(t, office.Matches(at(16, 18, 0)))
+	assert.False(t, office.Matches(at(17, 12, 0)))
+
+	// Windows ending before they start run into the next day
+	night := &ScheduleRule{Days: "fri", From: "22:00", To: "06:00"}
+	assert.True(t, night.Matches(at(16, 23, 30)))
+	assert.True(t, night.Matches(at(17, 5, 59)))
+	assert.False(t, night.Matches(at(16, 5, 0)))
+	assert.False(t, night.Matches(at(17, 22, 0)))
+
+	allDay := &ScheduleRule{Days: "sat", To: "24:00"}
+	assert.True(t, allDay.Matches(at(17, 23, 59)))
+
+	// Malformed rules match nothing
+	assert.False(t, (&ScheduleRule{Days: "*", From: "9:00"}).Matches(at(16, 12, 0)))
+}
+
+func TestScheduleRule_Validate(t *testing.T) {
+	assert.NoError(t, (&ScheduleRule{Days: "*"}).Validate())
+
+	var ruleErr *ScheduleRuleError
+	require.ErrorAs(t, (&ScheduleRule{Days: "mon", From: "24:00"}).Validate(), &ruleErr)
+	assert.Equal(t, "from", ruleErr.Field)
+	require.ErrorAs(t, (&ScheduleRule{Days: "mon", To: "18:60"}).Validate(), &ruleErr)
+	assert.Equal(t, "to", ruleErr.Field)
+	require.ErrorAs(t, (&ScheduleRule{Days: "mon", From: "09:00", To: "09:00"}).Validate(), &ruleErr)
+	assert.Equal(t, "to", ruleErr.Field)
+	require.ErrorAs(t, (&ScheduleRule{Days: "someday"}).Validate(), &ruleErr)
+	assert.Equal(t, "days", ruleErr.Field)
+}
+
+func TestSchedule_Destination(t *testing.T) {
+	schedule := &Schedule{
+		Timezone: "Asia/Tokyo",
+		Rules: []ScheduleRule{
+			{Days: "mon-fri", From: "09:00", To: "18:00", URL: "https://example.com/open"},
+			{Days: "*", URL: "https://example.com/closed"},
+		},
+	}
+	// 01:00 UTC on a Friday is 10:00 in Tokyo
+	now := time.Date(2026, 10, 16, 1, 0, 0, 0, time.UTC)
+	assert.Equal(t, "https://example.com/open", schedule.Destination(now, time.UTC))
+	assert.Equal(t, "https://example.com/closed", schedule.Destination(now.Add(9*time.Hour), time.UTC))
+
+	// Without a timezone of their own schedules run in the fallback one
+	schedule.Timezone = ""
+	assert.Equal(t, "https://example.com/closed", schedule.Destination(now, time.UTC))
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/open", schedule.Destination(now, tokyo))
+
+	schedule.Rules = schedule.Rules[:1]
+	assert.Empty(t, schedule.Destination(now, time.UTC))
+}
@@ -1,21 +1,50 @@
 package model
 
 import (
+	"bytes"
 	"encoding/json"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // ShortLink represents a short link entity
 type ShortLink struct {
-	ID          int64           `json:"id" gorm:"primaryKey;autoIncrement"`
-	ShortCode   string          `json:"short_code" gorm:"type:varchar(6);uniqueIndex;not null"`
-	OriginalURL string          `json:"original_url" gorm:"type:varchar(2048);not null"`
-	Params      json.RawMessage `json:"params" gorm:"type:json"`
-	CreatedAt   time.Time       `json:"created_at" gorm:"autoCreateTime"`
-	ExpireAt    *time.Time      `json:"expire_at" gorm:"index"`
-	Status      int             `json:"status" gorm:"default:1;comment:1-active,0-disabled"`
+	ID             int64           `json:"id" gorm:"primaryKey;autoIncrement"`
+	ShortCode      string          `json:"short_code" gorm:"type:varchar(6);uniqueIndex;not null"`
+	OriginalURL    string          `json:"original_url" gorm:"type:varchar(2048);not null;index:idx_search,class:FULLTEXT,priority:3"`
+	URLHash        string          `json:"-" gorm:"type:char(64);index"`
+	DedupHash      string          `json:"-" gorm:"type:char(64);index"`
+	Params         json.RawMessage `json:"params" gorm:"type:json" swaggertype:"object"`
+	CreatedAt      time.Time       `json:"created_at" gorm:"autoCreateTime"`
+	ExpireAt       *time.Time      `json:"expire_at" gorm:"index"`
+	Status         int             `json:"status" gorm:"default:1;comment:1-active,0-disabled"`
+	Pool           string          `json:"pool,omitempty" gorm:"type:varchar(16);index;default:''"`
+	NoClickID      bool            `json:"no_click_id,omitempty" gorm:"default:false"`
+	MaxClicks      int64           `json:"max_clicks,omitempty" gorm:"default:0;comment:0-unlimited"`
+	PreserveQuery  bool            `json:"preserve_query,omitempty" gorm:"default:false"`
+	Title          string          `json:"title,omitempty" gorm:"type:varchar(255);index:idx_search,class:FULLTEXT,priority:1"`
+	Description    string          `json:"description,omitempty" gorm:"type:varchar(1024)"`
+	Notes          string          `json:"notes,omitempty" gorm:"type:text;index:idx_search,class:FULLTEXT,priority:2"`
+	Managed        bool            `json:"managed,omitempty" gorm:"default:false;index"`
+	PublicStats    bool            `json:"public_stats,omitempty" gorm:"default:false"`
+	NoTracking     bool            `json:"no_tracking,omitempty" gorm:"default:false;comment:1-redirect without recording analytics"`
+	CacheControl   string          `json:"cache_control,omitempty" gorm:"type:varchar(128);default:''"`
+	SignedParams   bool            `json:"signed_params,omitempty" gorm:"default:false;comment:1-params appended to the link must be signed"`
+	SingleUse      bool            `json:"single_use,omitempty" gorm:"default:false;comment:1-disabled by its first redirect"`
+	Referrers      string          `json:"referrers,omitempty" gorm:"type:varchar(1024);default:'';comment:comma separated domains redirects must be referred from"`
+	GeoAllow       string          `json:"geo_allow,omitempty" gorm:"type:varchar(1024);default:'';comment:comma separated countries redirects are limited to"`
+	GeoDeny        string          `json:"geo_deny,omitempty" gorm:"type:varchar(1024);default:'';comment:comma separated countries redirects are refused in"`
+	Schedule       json.RawMessage `json:"schedule,omitempty" gorm:"type:json" swaggertype:"object"`
+	Owner          string          `json:"-" gorm:"type:char(64);index;default:'';comment:SHA-256 of the API key owning the link, empty for anonymous links"`
+	ReplicaVersion int64           `json:"-" gorm:"default:0;comment:unix nanoseconds of the last change replicated from the primary"`
 }
 
+// PoolSMS is the pool of ultra-short codes served on the dedicated SMS domain
+const PoolSMS = "sms"
+
 // TableName returns the table name for ShortLink
 func (ShortLink) TableName() string {
 	return "short_links"
@@ -23,26 +52,389 @@ func (ShortLink) TableName() string {
 
 // IsActive checks if the short link is active and not expired
 func (sl *ShortLink) IsActive() bool {
+	return sl.IsActiveAt(time.Now())
+}
+
+// IsActiveAt checks if the short link is active and not expired at the given time
+func (sl *ShortLink) IsActiveAt(now time.Time) bool {
 	if sl.Status != 1 {
 		return false
 	}
-	if sl.ExpireAt != nil && time.Now().After(*sl.ExpireAt) {
+	if sl.ExpireAt != nil && now.After(*sl.ExpireAt) {
 		return false
 	}
 	return true
 }
 
-// GenerateRequest represents the request to generate a short link
+// IsUsed reports whether the short link is a single-use link its redirect disabled
+func (sl *ShortLink) IsUsed() bool {
+	return sl.SingleUse && sl.Status != 1
+}
+
+// AllowedReferrers returns the domains the redirects of the short link must be referred from, nil
+// when they may come from anywhere
+func (sl *ShortLink) AllowedReferrers() []string {
+	return splitList(sl.Referrers)
+}
+
+// AllowsReferrer checks if a redirect referred by the given Referer may be served: any when the
+// short link has no allowed referrers, otherwise only those from one of their domains or
+// subdomains. Requests without a Referer are refused then, as nothing tells where they come from.
+func (sl *ShortLink) AllowsReferrer(referer string) bool {
+	if sl.Referrers == "" {
+		return true
+	}
+	u, err := url.Parse(referer)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return false
+	}
+	for _, domain := range sl.AllowedReferrers() {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedCountries returns the countries the redirects of the short link are limited to, nil when
+// they are not
+func (sl *ShortLink) AllowedCountries() []string {
+	return splitList(sl.GeoAllow)
+}
+
+// BlockedCountries returns the countries the redirects of the short link are refused in
+func (sl *ShortLink) BlockedCountries() []string {
+	return splitList(sl.GeoDeny)
+}
+
+// GeoRestricted reports whether the redirects of the short link depend on the country of visitors
+func (sl *ShortLink) GeoRestricted() bool {
+	return sl.GeoAllow != "" || sl.GeoDeny != ""
+}
+
+// AllowsCountry checks if a redirect to a visitor from the given country, "" when unknown, may be
+// served. Visitors from unknown countries are refused by links limited to countries, as they could
+// be anywhere, and let through by links only refused in some.
+func (sl *ShortLink) AllowsCountry(country string) bool {
+	if sl.GeoAllow != "" {
+		return country != "" && slices.Contains(sl.AllowedCountries(), country)
+	}
+	return country == "" || !slices.Contains(sl.BlockedCountries(), country)
+}
+
+// JoinReferrers stores the allowed referrers of a short link, lowercase and without duplicates
+func JoinReferrers(domains []string) string {
+	return joinList(domains, func(domain string) string {
+		return strings.TrimSuffix(strings.ToLower(domain), ".")
+	})
+}
+
+// JoinCountries stores the countries a short link is limited to or refused in, as upper case ISO
+// 3166-1 alpha-2 codes without duplicates
+func JoinCountries(countries []string) string {
+	return joinList(countries, strings.ToUpper)
+}
+
+// joinList joins normalized values with commas, leaving out empty values and duplicates
+func joinList(values []string, normalize func(string) string) string {
+	seen := make(map[string]struct{}, len(values))
+	joined := make([]string, 0, len(values))
+	for _, value := range values {
+		value = normalize(strings.TrimSpace(value))
+		if _, ok := seen[value]; ok || value == "" {
+			continue
+		}
+		seen[value] = struct{}{}
+		joined = append(joined, value)
+	}
+	return strings.Join(joined, ",")
+}
+
+// splitList splits values joined by joinList, nil when there are none
+func splitList(joined string) []string {
+	if joined == "" {
+		return nil
+	}
+	return strings.Split(joined, ",")
+}
+
+// DecodedParams returns the params of the short link, nil when it has none or they are not a JSON
+// object. Numbers keep the form they were stored in.
+func (sl *ShortLink) DecodedParams() map[string]interface{} {
+	if len(sl.Params) == 0 {
+		return nil
+	}
+	var params map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(sl.Params))
+	dec.UseNumber()
+	if err := dec.Decode(&params); err != nil || len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+// DecodedSchedule returns the schedule routing the redirects of the short link, nil when it has none
+func (sl *ShortLink) DecodedSchedule() *Schedule {
+	if len(sl.Schedule) == 0 {
+		return nil
+	}
+	var schedule Schedule
+	if err := json.Unmarshal(sl.Schedule, &schedule); err != nil || len(schedule.Rules) == 0 {
+		return nil
+	}
+	return &schedule
+}
+
+// QueryParams returns the params of the short link as query parameters of its destination.
+// Strings, numbers and booleans become values, params of other types stored before they were
+// rejected are left out.
+func (sl *ShortLink) QueryParams() url.Values {
+	values := url.Values{}
+	for key, value := range sl.DecodedParams() {
+		if v, ok := ParamString(value); ok {
+			values.Set(key, v)
+		}
+	}
+	return values
+}
+
+// ParamString formats a decoded param value as a query value, reporting false for values that
+// have no string form: null, objects and arrays
+func ParamString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// GenerateRequest represents the request to generate a short link. The link expires at ExpireAt, or
+// after TTL or ExpireInSeconds counted from its creation on the clock of the service. Its redirects
+// are tracked in the analytics unless TrackingEnabled is false, and carry CacheControl instead of the
+// configured Cache-Control when set. With SignedParams, params appended to the link are only honored
+// with the signature returned by the sign API. A SingleUse link redirects once, like a MaxClicks of
+// 1, and shows later visitors that it was used. With AllowedReferrers, the link only redirects
+// visitors referred from these domains or their subdomains. AllowedCountries limits its redirects
+// to visitors from these countries, BlockedCountries refuses them in these countries instead. A
+// Schedule sends its redirects to other destinations on the days and times of its rules.
 type GenerateRequest struct {
-	URL    string                 `json:"url" binding:"required,url"`
-	Params map[string]interface{} `json:"params"`
-	ExpireAt string                `json:"expire_at"`
+	URL              string                 `json:"url" binding:"required,url"`
+	Params           map[string]interface{} `json:"params"`
+	ExpireAt         string                 `json:"expire_at"`
+	TTL              string                 `json:"ttl"`
+	ExpireInSeconds  int64                  `json:"expire_in_seconds" binding:"omitempty,min=1"`
+	SMS              bool                   `json:"sms"`
+	NoClickID        bool                   `json:"no_click_id"`
+	MaxClicks        int64                  `json:"max_clicks" binding:"omitempty,min=1"`
+	PreserveQuery    bool                   `json:"preserve_query"`
+	Title            string                 `json:"title" binding:"max=255"`
+	Description      string                 `json:"description" binding:"max=1024"`
+	Notes            string                 `json:"notes" binding:"max=4096"`
+	PublicStats      bool                   `json:"public_stats"`
+	TrackingEnabled  *bool                  `json:"tracking_enabled"`
+	CacheControl     string                 `json:"cache_control" binding:"max=128"`
+	SignedParams     bool                   `json:"signed_params"`
+	SingleUse        bool                   `json:"single_use"`
+	AllowedReferrers []string               `json:"allowed_referrers" binding:"omitempty,max=20"`
+	AllowedCountries []string               `json:"allowed_countries" binding:"omitempty,max=250"`
+	BlockedCountries []string               `json:"blocked_countries" binding:"omitempty,max=250"`
+	Schedule         *Schedule              `json:"schedule"`
+}
+
+// Tracked reports whether the redirects of the requested link are to be tracked, the default
+func (r *GenerateRequest) Tracked() bool {
+	return r.TrackingEnabled == nil || *r.TrackingEnabled
+}
+
+// UpdateRequest represents the request to update the metadata of a short link. Omitted fields are
+// left unchanged, empty strings and lists clear them. A link is either limited to countries or
+// refused in some: setting either list to countries clears the other. A schedule without rules
+// removes the schedule of the link.
+type UpdateRequest struct {
+	Title            *string   `json:"title" binding:"omitempty,max=255"`
+	Description      *string   `json:"description" binding:"omitempty,max=1024"`
+	Notes            *string   `json:"notes" binding:"omitempty,max=4096"`
+	PublicStats      *bool     `json:"public_stats"`
+	TrackingEnabled  *bool     `json:"tracking_enabled"`
+	CacheControl     *string   `json:"cache_control" binding:"omitempty,max=128"`
+	AllowedReferrers *[]string `json:"allowed_referrers" binding:"omitempty,max=20"`
+	AllowedCountries *[]string `json:"allowed_countries" binding:"omitempty,max=250"`
+	BlockedCountries *[]string `json:"blocked_countries" binding:"omitempty,max=250"`
+	Schedule         *Schedule `json:"schedule"`
+}
+
+// Link statuses reported by the resolve API
+const (
+	LinkStatusActive   = "active"
+	LinkStatusDisabled = "disabled"
+	LinkStatusExpired  = "expired"
+	LinkStatusUsed     = "used"
+)
+
+// ResolveResponse represents where a short link points, without redirecting. TrackingEnabled tells
+// whether its redirects are recorded in the analytics.
+type ResolveResponse struct {
+	ShortLink        string                 `json:"short_link"`
+	ShortCode        string                 `json:"short_code"`
+	OriginalURL      string                 `json:"original_url"`
+	Status           string                 `json:"status"`
+	Params           map[string]interface{} `json:"params,omitempty"`
+	Pool             string                 `json:"pool,omitempty"`
+	CreatedAt        time.Time              `json:"created_at"`
+	ExpireAt         *time.Time             `json:"expire_at,omitempty"`
+	MaxClicks        int64                  `json:"max_clicks,omitempty"`
+	Title            string                 `json:"title,omitempty"`
+	Description      string                 `json:"description,omitempty"`
+	Notes            string                 `json:"notes,omitempty"`
+	Managed          bool                   `json:"managed,omitempty"`
+	PublicStats      bool                   `json:"public_stats,omitempty"`
+	TrackingEnabled  bool                   `json:"tracking_enabled"`
+	CacheControl     string                 `json:"cache_control,omitempty"`
+	SignedParams     bool                   `json:"signed_params,omitempty"`
+	SingleUse        bool                   `json:"single_use,omitempty"`
+	AllowedReferrers []string               `json:"allowed_referrers,omitempty"`
+	AllowedCountries []string               `json:"allowed_countries,omitempty"`
+	BlockedCountries []string               `json:"blocked_countries,omitempty"`
+	Schedule         *Schedule              `json:"schedule,omitempty"`
+}
+
+// SignParamsRequest represents the params to append to a short link created with signed params,
+// values being strings, numbers or booleans
+type SignParamsRequest struct {
+	Params map[string]interface{} `json:"params" binding:"required,min=1"`
+}
+
+// SignParamsResponse represents a short link with signed params appended. Sig is the signature
+// carried by ShortLink, for callers appending the params themselves.
+type SignParamsResponse struct {
+	ShortLink string `json:"short_link"`
+	Sig       string `json:"sig"`
+}
+
+// LookupResponse represents the existing short links for a destination URL
+type LookupResponse struct {
+	URL   string            `json:"url"`
+	Links []ResolveResponse `json:"links"`
+}
+
+// DeclarativeLink is the desired state of a link managed as code, under a fixed alias
+type DeclarativeLink struct {
+	Alias       string `json:"alias" binding:"required"`
+	URL         string `json:"url" binding:"required,url"`
+	Title       string `json:"title" binding:"max=255"`
+	Description string `json:"description" binding:"max=1024"`
+	Notes       string `json:"notes" binding:"max=4096"`
+}
+
+// DeclarativeRequest is the complete desired state of the links managed as code. Managed links
+// missing from it are disabled.
+type DeclarativeRequest struct {
+	Links []DeclarativeLink `json:"links" binding:"required,max=1000,dive"`
+}
+
+// DeclarativeResponse lists the aliases a reconciliation created, updated, disabled or left
+// unchanged. In a dry run nothing is applied.
+type DeclarativeResponse struct {
+	DryRun    bool     `json:"dry_run"`
+	Created   []string `json:"created"`
+	Updated   []string `json:"updated"`
+	Disabled  []string `json:"disabled"`
+	Unchanged []string `json:"unchanged"`
+}
+
+// Statuses a bulk status change sets links to
+const (
+	BulkStatusActive   = "active"
+	BulkStatusDisabled = "disabled"
+)
+
+// BulkSelector selects the links of a bulk change, either by short code or by campaign, the value
+// of the param campaigns are reported under
+type BulkSelector struct {
+	ShortCodes []string `json:"short_codes" binding:"omitempty,max=1000"`
+	Campaign   string   `json:"campaign" binding:"max=255" example:"spring-sale"`
+}
+
+// BulkStatusRequest disables the selected links, or enables them again
+type BulkStatusRequest struct {
+	BulkSelector
+	Status string `json:"status" binding:"required,oneof=active disabled" example:"disabled"`
+}
+
+// BulkExpireRequest sets when the selected links expire, as an RFC 3339 time. Links expire right
+// away with a time in the past and never without one.
+type BulkExpireRequest struct {
+	BulkSelector
+	ExpireAt string `json:"expire_at" example:"2030-01-02T15:04:05Z"`
+}
+
+// BulkResponse lists the short codes a bulk change updated. Selected links already in the
+// requested state are left out.
+type BulkResponse struct {
+	Updated []string `json:"updated"`
+}
+
+// BatchGetRequest lists the short links to return the details of in one call
+type BatchGetRequest struct {
+	ShortCodes []string `json:"short_codes" binding:"required,min=1,max=500"`
+}
+
+// BatchGetResponse holds the details of the requested short links in request order, the codes of
+// links that do not exist listed apart
+type BatchGetResponse struct {
+	Links   []ResolveResponse `json:"links"`
+	Missing []string          `json:"missing"`
+}
+
+// LinkFilter selects the stored links of a bulk change: those of ShortCodes, or without short codes
+// those whose Param param has the value Value. With an Owner, only the links it owns are selected.
+type LinkFilter struct {
+	ShortCodes []string
+	Param      string
+	Value      string
+	Owner      string
+}
+
+// SearchQuery pages the full-text search over the title, notes and URL of short links
+type SearchQuery struct {
+	Query  string
+	Offset int
+	Limit  int
+}
+
+// SearchResponse represents one page of short links matching a search, most relevant first
+type SearchResponse struct {
+	Query      string            `json:"query"`
+	Links      []ResolveResponse `json:"links"`
+	NextOffset int               `json:"next_offset,omitempty"`
+}
+
+// PoolUsage represents the capacity accounting of a reserved code pool
+type PoolUsage struct {
+	Pool     string `json:"pool"`
+	Used     int64  `json:"used"`
+	Free     int64  `json:"free"`
+	Capacity int64  `json:"capacity"`
 }
 
 // GenerateResponse represents the response of short link generation
 type GenerateResponse struct {
-	ShortLink   string    `json:"short_link"`
-	ShortCode   string    `json:"short_code"`
-	OriginalURL string    `json:"original_url"`
-	ExpireAt    time.Time `json:"expire_at,omitempty"`
+	ShortLink       string                 `json:"short_link"`
+	ShortCode       string                 `json:"short_code"`
+	OriginalURL     string                 `json:"original_url"`
+	Params          map[string]interface{} `json:"params,omitempty"`
+	ExpireAt        time.Time              `json:"expire_at,omitempty"`
+	TrackingEnabled bool                   `json:"tracking_enabled"`
+	SignedParams    bool                   `json:"signed_params,omitempty"`
+	SingleUse       bool                   `json:"single_use,omitempty"`
 }
@@ -1,6 +1,8 @@
 package model
 
 import (
+	"encoding/json"
+	"net/url"
 	"testing"
 	"time"
 
@@ -73,6 +75,78 @@ func TestShortLink_IsActive(t *testing.T) {
 	}
 }
 
+func TestShortLink_IsActiveAt(t *testing.T) {
+	expireAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	sl := &ShortLink{Status: 1, ExpireAt: &expireAt}
+
+	assert.True(t, sl.IsActiveAt(expireAt.Add(-time.Nanosecond)))
+	assert.True(t, sl.IsActiveAt(expireAt))
+	assert.False(t, sl.IsActiveAt(expireAt.Add(time.Nanosecond)))
+}
+
+func TestShortLink_Params(t *testing.T) {
+	sl := &ShortLink{Params: []byte(`{"utm_source":"mail","week":12,"ratio":0.5,"vip":true,"legacy":{"a":1}}`)}
+
+	assert.Equal(t, map[string]interface{}{
+		"utm_source": "mail", "week": json.Number("12"), "ratio": json.Number("0.5"), "vip": true,
+		"legacy": map[string]interface{}{"a": json.Number("1")},
+	}, sl.DecodedParams())
+	assert.Equal(t, url.Values{"utm_source": {"mail"}, "week": {"12"}, "ratio": {"0.5"}, "vip": {"true"}}, sl.QueryParams())
+
+	assert.Nil(t, (&ShortLink{}).DecodedParams())
+	assert.Nil(t, (&ShortLink{Params: []byte(`null`)}).DecodedParams())
+	assert.Empty(t, (&ShortLink{}).QueryParams())
+}
+
+func TestShortLink_AllowsReferrer(t *testing.T) {
+	sl := &ShortLink{Referrers: JoinReferrers([]string{" News.Example.com. ", "example.org", "news.example.com"})}
+	assert.Equal(t, "news.example.com,example.org", sl.Referrers)
+	assert.Equal(t, []string{"news.example.com", "example.org"}, sl.AllowedReferrers())
+
+	assert.True(t, sl.AllowsReferrer("https://news.example.com/issues/42"))
+	assert.True(t, sl.AllowsReferrer("http://mail.news.example.com:8080/"))
+	assert.True(t, sl.AllowsReferrer("https://EXAMPLE.org."))
+	assert.False(t, sl.AllowsReferrer("https://fakenews.example.com/"))
+	assert.False(t, sl.AllowsReferrer("https://example.com/"))
+	assert.False(t, sl.AllowsReferrer("android-app://news.example.com/"))
+	assert.False(t, sl.AllowsReferrer(""))
+
+	// Links without allowed referrers may be opened from anywhere
+	assert.Nil(t, (&ShortLink{}).AllowedReferrers())
+	assert.True(t, (&ShortLink{}).AllowsReferrer(""))
+}
+
+func TestShortLink_AllowsCountry(t *testing.T) {
+	allowed := &ShortLink{GeoAllow: JoinCountries([]string{"fr", " BE", "FR"})}
+	assert.Equal(t, "FR,BE", allowed.GeoAllow)
+	assert.Equal(t, []string{"FR", "BE"}, allowed.AllowedCountries())
+	assert.True(t, allowed.GeoRestricted())
+	assert.True(t, allowed.AllowsCountry("BE"))
+	assert.False(t, allowed.AllowsCountry("DE"))
+	assert.False(t, allowed.AllowsCountry(""))
+
+	blocked := &ShortLink{GeoDeny: "US"}
+	assert.Equal(t, []string{"US"}, blocked.BlockedCountries())
+	assert.False(t, blocked.AllowsCountry("US"))
+	assert.True(t, blocked.AllowsCountry("CA"))
+	assert.True(t, blocked.AllowsCountry(""))
+
+	assert.False(t, (&ShortLink{}).GeoRestricted())
+	assert.True(t, (&ShortLink{}).AllowsCountry(""))
+}
+
+func TestParamString(t *testing.T) {
+	for value, want := range map[interface{}]string{"a b": "a b", 1.0: "1", 2.5: "2.5", 1e21: "1000000000000000000000", false: "false"} {
+		got, ok := ParamString(value)
+		assert.True(t, ok)
+		assert.Equal(t, want, got)
+	}
+	for _, value := range []interface{}{nil, []interface{}{1}, map[string]interface{}{}} {
+		_, ok := ParamString(value)
+		assert.False(t, ok)
+	}
+}
+
 func TestGenerateRequest_Validation(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -0,0 +1,166 @@
+package model
+
+import (
+	"time"
+)
+
+// StatsDay returns the day a click at t is counted under: its UTC date, whatever the time zone
+// of the instance, as days of the daily aggregates are
+func StatsDay(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// DailyStat represents the daily click aggregate of a short link
+type DailyStat struct {
+	ID        int64     `json:"-" gorm:"primaryKey;autoIncrement"`
+	ShortCode string    `json:"short_code" gorm:"type:varchar(6);uniqueIndex:idx_code_day;not null"`
+	Day       time.Time `json:"day" gorm:"type:date;uniqueIndex:idx_code_day;not null"`
+	Clicks    int64     `json:"clicks" gorm:"not null;default:0"`
+	Visitors  int64     `json:"visitors" gorm:"not null;default:0"`
+}
+
+// TableName returns the table name for DailyStat
+func (DailyStat) TableName() string {
+	return "daily_stats"
+}
+
+// DailySourceStat represents the daily clicks of a short link from one traffic source
+type DailySourceStat struct {
+	ID        int64     `json:"-" gorm:"primaryKey;autoIncrement"`
+	ShortCode string    `json:"short_code" gorm:"type:varchar(6);uniqueIndex:idx_code_day_source;not null"`
+	Day       time.Time `json:"day" gorm:"type:date;uniqueIndex:idx_code_day_source;not null"`
+	Source    string    `json:"source" gorm:"type:varchar(64);uniqueIndex:idx_code_day_source;not null"`
+	Clicks    int64     `json:"clicks" gorm:"not null;default:0"`
+}
+
+// TableName returns the table name for DailySourceStat
+func (DailySourceStat) TableName() string {
+	return "daily_source_stats"
+}
+
+// DailyVisitor represents a visitor seen on a short link on a day, so that it counts once in the
+// visitors of the day whatever the number of its accesses
+type DailyVisitor struct {
+	ID        int64     `json:"-" gorm:"primaryKey;autoIncrement"`
+	ShortCode string    `json:"short_code" gorm:"type:varchar(6);uniqueIndex:idx_code_day_visitor;not null"`
+	Day       time.Time `json:"day" gorm:"type:date;uniqueIndex:idx_code_day_visitor;not null"`
+	Visitor   string    `json:"visitor" gorm:"type:varchar(64);uniqueIndex:idx_code_day_visitor;not null"`
+}
+
+// TableName returns the table name for DailyVisitor
+func (DailyVisitor) TableName() string {
+	return "daily_visitors"
+}
+
+// CounterDelta represents the analytics counter changes of a short link buffered since the last flush
+type CounterDelta struct {
+	ShortCode string
+	PV        int64
+	Visitors  []string
+	Sources   map[string]int64
+	// AccessTime is when the clicks happened, picking their minute and day counters; zero for now
+	AccessTime time.Time
+}
+
+// Period represents a range of days, both ends inclusive
+type Period struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// MetricChange represents how a metric changed from the previous period to the current one
+type MetricChange struct {
+	Current  int64 `json:"current"`
+	Previous int64 `json:"previous"`
+	Delta    int64 `json:"delta"`
+	// ChangePercent is nil when the previous period had nothing to compare with
+	ChangePercent *float64 `json:"change_percent"`
+}
+
+// SourceChange represents how the clicks from one traffic source changed between periods
+type SourceChange struct {
+	Source string `json:"source"`
+	MetricChange
+}
+
+// CompareResponse represents the analytics of a period compared with the period before it
+type CompareResponse struct {
+	ShortCode string         `json:"short_code"`
+	Days      int            `json:"days"`
+	Current   Period         `json:"current"`
+	Previous  Period         `json:"previous"`
+	PV        MetricChange   `json:"pv"`
+	UV        MetricChange   `json:"uv"`
+	Sources   []SourceChange `json:"sources"`
+}
+
+// SourceDailyClicks represents the clicks from one traffic source on each day of a period
+type SourceDailyClicks struct {
+	Source string `json:"source"`
+	Total  int64  `json:"total"`
+	// Clicks holds the clicks of each day, aligned with the days of the response
+	Clicks []int64 `json:"clicks"`
+}
+
+// SourcesDailyResponse represents the clicks of a short link per source and day, a matrix for
+// calendar heatmaps with a row per source, busiest first, and a column per day, oldest first
+type SourcesDailyResponse struct {
+	ShortCode string              `json:"short_code"`
+	Period    Period              `json:"period"`
+	Days      []string            `json:"days"`
+	Sources   []SourceDailyClicks `json:"sources"`
+	// Max is the largest count of a source on a day, scaling the heatmap colors
+	Max int64 `json:"max"`
+}
+
+// RealtimeResponse represents the clicks of a short link in each minute of the last hour, oldest
+// first, for "last hour" sparklines. The last minute is the current one, still being counted.
+type RealtimeResponse struct {
+	ShortCode string `json:"short_code"`
+	// From is the start of the first minute
+	From   time.Time `json:"from"`
+	Clicks []int64   `json:"clicks"`
+	Total  int64     `json:"total"`
+	// Max is the largest count of a minute, scaling the sparkline
+	Max int64 `json:"max"`
+}
+
+// DecayBucket represents the clicks received in one window of a link's lifetime
+type DecayBucket struct {
+	Label      string  `json:"label"`
+	Clicks     int64   `json:"clicks"`
+	Share      float64 `json:"share"`
+	Cumulative float64 `json:"cumulative"`
+}
+
+// DecayResponse represents the click distribution across a link's lifetime
+type DecayResponse struct {
+	ShortCode       string        `json:"short_code"`
+	CreatedAt       time.Time     `json:"created_at"`
+	TotalClicks     int64         `json:"total_clicks"`
+	FirstHourClicks int64         `json:"first_hour_clicks"`
+	HalfLifeDays    int           `json:"half_life_days"`
+	Buckets         []DecayBucket `json:"buckets"`
+}
+
+// PublicStats represents the stats of a link its owner made public. They come from the daily
+// aggregates only, so nothing identifies individual visitors.
+type PublicStats struct {
+	ShortCode   string        `json:"short_code"`
+	OriginalURL string        `json:"original_url"`
+	Title       string        `json:"title,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	Period      Period        `json:"period"`
+	Clicks      int64         `json:"clicks"`
+	Visitors    int64         `json:"visitors"`
+	Daily       []DailyClicks `json:"daily"`
+	TopSources  []SourceStat  `json:"top_sources"`
+	GeneratedAt time.Time     `json:"generated_at"`
+}
+
+// DailyClicks represents the clicks of a link on one day, zero on days without any
+type DailyClicks struct {
+	Day      time.Time `json:"day"`
+	Clicks   int64     `json:"clicks"`
+	Visitors int64     `json:"visitors"`
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDailyStat_TableName(t *testing.T) {
+	stat := DailyStat{}
+	assert.Equal(t, "daily_stats", stat.TableName())
+}
+
+func TestStatsDay(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	newYork := time.FixedZone("EST", -5*3600)
+
+	// The same instant is one day everywhere
+	assert.Equal(t, "2024-03-01", StatsDay(time.Date(2024, 3, 2, 7, 0, 0, 0, shanghai)))
+	assert.Equal(t, "2024-03-01", StatsDay(time.Date(2024, 2, 29, 23, 0, 0, 0, newYork)))
+	assert.Equal(t, "2024-03-01", StatsDay(time.Date(2024, 3, 1, 23, 59, 59, 0, time.UTC)))
+}
+
+func TestDecayResponse_Structure(t *testing.T) {
+	now := time.Now()
+
+	resp := DecayResponse{
+		ShortCode:       "ABCD",
+		CreatedAt:       now,
+		TotalClicks:     100,
+		FirstHourClicks: 40,
+		HalfLifeDays:    0,
+		Buckets: []DecayBucket{
+			{Label: "day_1", Clicks: 60, Share: 0.6, Cumulative: 0.6},
+		},
+	}
+
+	assert.Equal(t, "ABCD", resp.ShortCode)
+	assert.Equal(t, int64(100), resp.TotalClicks)
+	assert.Len(t, resp.Buckets, 1)
+	assert.Equal(t, "day_1", resp.Buckets[0].Label)
+}
@@ -0,0 +1,374 @@
+package mq
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/pkg/async"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Overflow policies of the buffered producer
+const (
+	// OverflowDrop drops messages that do not fit into the buffer
+	OverflowDrop = "drop"
+	// OverflowSpill appends messages that do not fit into the buffer to a file, sent once the broker recovers
+	OverflowSpill = "spill"
+)
+
+// spillFileName is the name of the spill file within the spill directory
+const spillFileName = "access_log.spill"
+
+// errSpillFull is returned when the spill file reached its size limit
+var errSpillFull = errors.New("spill file is full")
+
+// BufferedProducer decouples access log sends from the broker: messages are queued in a bounded
+// in-memory buffer and sent in the background, so slow or unreachable brokers never block clicks
+type BufferedProducer struct {
+	inner         ProducerInterface
+	queue         chan *AccessLogMessage
+	flushInterval time.Duration
+	sendTimeout   time.Duration
+	spill         *spillFile
+	retry         *AccessLogMessage
+	sent          atomic.Int64
+	spilled       atomic.Int64
+	dropped       atomic.Int64
+	mu            sync.RWMutex
+	closed        bool
+	stop          chan struct{}
+	done          chan struct{}
+}
+
+// NewBufferedProducer wraps a producer with a local buffer and starts flushing it
+func NewBufferedProducer(inner ProducerInterface, cfg *config.ProducerBufferConfig) (*BufferedProducer, error) {
+	var spill *spillFile
+	switch cfg.Overflow {
+	case OverflowSpill:
+		s, err := openSpillFile(filepath.Join(cfg.SpillDir, spillFileName), cfg.SpillMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		spill = s
+	case OverflowDrop, "":
+	default:
+		return nil, fmt.Errorf("unknown overflow policy %q", cfg.Overflow)
+	}
+
+	p := newBufferedProducer(inner, cfg, spill)
+	async.Go(p.run)
+
+	log.Info().
+		Int("size", cfg.Size).
+		Str("overflow", cfg.Overflow).
+		Msg("MQ producer buffer started")
+
+	return p, nil
+}
+
+// newBufferedProducer creates a buffered producer without starting it
+func newBufferedProducer(inner ProducerInterface, cfg *config.ProducerBufferConfig, spill *spillFile) *BufferedProducer {
+	return &BufferedProducer{
+		inner:         inner,
+		queue:         make(chan *AccessLogMessage, cfg.Size),
+		flushInterval: cfg.FlushInterval,
+		sendTimeout:   cfg.SendTimeout,
+		spill:         spill,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// SendAccessLog queues an access log message without waiting for the broker
+func (p *BufferedProducer) SendAccessLog(ctx context.Context, msg *AccessLogMessage) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrProducerClosed
+	}
+
+	select {
+	case p.queue <- msg:
+	default:
+		p.overflow(msg)
+	}
+	return nil
+}
+
+// SendLinkEvent sends a link event straight to the broker within the send timeout. Link events are
+// rare compared to clicks and are not buffered.
+func (p *BufferedProducer) SendLinkEvent(ctx context.Context, msg *LinkEventMessage) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrProducerClosed
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.sendTimeout)
+	defer cancel()
+	return p.inner.SendLinkEvent(ctx, msg)
+}
+
+// Stats returns the buffer and delivery counters
+func (p *BufferedProducer) Stats() *model.ProducerBufferStats {
+	stats := &model.ProducerBufferStats{
+		Buffered: len(p.queue),
+		Sent:     p.sent.Load(),
+		Spilled:  p.spilled.Load(),
+		Dropped:  p.dropped.Load(),
+	}
+	if p.spill != nil {
+		stats.SpillBytes = p.spill.Size()
+	}
+	return stats
+}
+
+// run flushes the buffer periodically until closed
+func (p *BufferedProducer) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.flush()
+		case <-p.stop:
+			p.flush()
+			p.evict()
+			return
+		}
+	}
+}
+
+// flush sends spilled messages, then buffered ones, until the buffer is empty or a send fails.
+// A failed message is retried first on the next flush.
+func (p *BufferedProducer) flush() {
+	if p.spill != nil {
+		if err := p.replay(); err != nil {
+			log.Warn().Err(err).Msg("Broker unavailable, keeping spilled access logs")
+			return
+		}
+	}
+
+	for {
+		if p.retry == nil {
+			select {
+			case p.retry = <-p.queue:
+			default:
+				return
+			}
+		}
+		if err := p.send(p.retry); err != nil {
+			log.Warn().Err(err).Int("buffered", len(p.queue)).Msg("Broker unavailable, buffering access logs")
+			return
+		}
+		p.retry = nil
+	}
+}
+
+// replay sends the spilled messages, spilling the unsent rest back on failure
+func (p *BufferedProducer) replay() error {
+	lines, err := p.spill.Take()
+	if err != nil {
+		return err
+	}
+
+	for i, line := range lines {
+		var msg AccessLogMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			log.Warn().Err(err).Msg("Skipping malformed spilled access log")
+			continue
+		}
+		if err := p.send(&msg); err != nil {
+			p.spill.Restore(lines[i:])
+			return err
+		}
+	}
+
+	if len(lines) > 0 {
+		log.Info().Int("count", len(lines)).Msg("Spilled access logs sent")
+	}
+	return nil
+}
+
+// send sends one message to the broker within the send timeout
+func (p *BufferedProducer) send(msg *AccessLogMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.sendTimeout)
+	defer cancel()
+
+	if err := p.inner.SendAccessLog(ctx, msg); err != nil {
+		return err
+	}
+	p.sent.Add(1)
+	return nil
+}
+
+// overflow spills a message that cannot be buffered or sent, or drops it without a spill file
+func (p *BufferedProducer) overflow(msg *AccessLogMessage) {
+	if p.spill != nil {
+		err := p.spill.Append(msg)
+		if err == nil {
+			p.spilled.Add(1)
+			return
+		}
+		log.Error().Err(err).Str("short_code", msg.ShortCode).Msg("Failed to spill access log")
+	}
+	p.dropped.Add(1)
+}
+
+// evict moves whatever the final flush could not send out of memory
+func (p *BufferedProducer) evict() {
+	if p.retry != nil {
+		p.overflow(p.retry)
+		p.retry = nil
+	}
+	for {
+		select {
+		case msg := <-p.queue:
+			p.overflow(msg)
+		default:
+			return
+		}
+	}
+}
+
+// Close flushes the buffer, spilling or dropping what the broker does not take, and closes the
+// wrapped producer
+func (p *BufferedProducer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	close(p.stop)
+	<-p.done
+
+	if dropped := p.dropped.Load(); dropped > 0 {
+		log.Warn().Int64("dropped", dropped).Msg("Access logs dropped by the MQ producer buffer")
+	}
+	return p.inner.Close()
+}
+
+// spillFile stores messages as JSON lines on disk while the broker is unreachable
+type spillFile struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	size     int64
+}
+
+// openSpillFile prepares the spill file, keeping messages spilled before a restart
+func openSpillFile(path string, maxBytes int64) (*spillFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+
+	s := &spillFile{path: path, maxBytes: maxBytes}
+	info, err := os.Stat(path)
+	if err == nil {
+		s.size = info.Size()
+		log.Info().Str("path", path).Int64("bytes", s.size).Msg("Found spilled access logs")
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to open spill file: %w", err)
+	}
+	return s, nil
+}
+
+// Append adds a message to the spill file unless it would exceed the size limit
+func (s *spillFile) Append(msg *AccessLogMessage) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return s.write([][]byte{line}, true)
+}
+
+// Take reads and removes all spilled messages
+func (s *spillFile) Take() ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size == 0 {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spill file: %w", err)
+	}
+	if err := os.Remove(s.path); err != nil {
+		return nil, fmt.Errorf("failed to remove spill file: %w", err)
+	}
+	s.size = 0
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+		}
+	}
+	return lines, nil
+}
+
+// Restore puts back taken messages that could not be sent, regardless of the size limit
+func (s *spillFile) Restore(lines [][]byte) {
+	if err := s.write(lines, false); err != nil {
+		log.Error().Err(err).Int("count", len(lines)).Msg("Failed to restore spilled access logs")
+	}
+}
+
+// Size returns the size of the spill file in bytes
+func (s *spillFile) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// write appends lines to the spill file, optionally within the size limit
+func (s *spillFile) write(lines [][]byte, limited bool) error {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if limited && s.maxBytes > 0 && s.size+int64(buf.Len()) > s.maxBytes {
+		return errSpillFull
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open spill file: %w", err)
+	}
+	n, err := f.Write(buf.Bytes())
+	s.size += int64(n)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write spill file: %w", err)
+	}
+	return nil
+}
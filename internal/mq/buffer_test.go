@@ -0,0 +1,177 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyProducer fails sends while the broker is down
+type flakyProducer struct {
+	mu     sync.Mutex
+	down   bool
+	sent   []string
+	closed bool
+}
+
+func (p *flakyProducer) SendAccessLog(ctx context.Context, msg *AccessLogMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return errors.New("broker unreachable")
+	}
+	p.sent = append(p.sent, msg.ShortCode)
+	return nil
+}
+
+func (p *flakyProducer) SendLinkEvent(ctx context.Context, msg *LinkEventMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return errors.New("broker unreachable")
+	}
+	p.sent = append(p.sent, msg.Type+":"+msg.ShortCode)
+	return nil
+}
+
+func (p *flakyProducer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+func (p *flakyProducer) setDown(down bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.down = down
+}
+
+func (p *flakyProducer) sentCodes() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.sent...)
+}
+
+func bufferConfig(size int) *config.ProducerBufferConfig {
+	return &config.ProducerBufferConfig{
+		Size:          size,
+		FlushInterval: 5 * time.Millisecond,
+		SendTimeout:   time.Second,
+	}
+}
+
+func TestBufferedProducer_SendAccessLog(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("sends in the background", func(t *testing.T) {
+		inner := &flakyProducer{}
+		p, err := NewBufferedProducer(inner, bufferConfig(10))
+		require.NoError(t, err)
+
+		require.NoError(t, p.SendAccessLog(ctx, &AccessLogMessage{ShortCode: "ABCD"}))
+		assert.Eventually(t, func() bool { return len(inner.sentCodes()) == 1 }, time.Second, time.Millisecond)
+		assert.Equal(t, int64(1), p.Stats().Sent)
+
+		require.NoError(t, p.Close())
+		require.NoError(t, p.Close())
+		assert.True(t, inner.closed)
+		assert.ErrorIs(t, p.SendAccessLog(ctx, &AccessLogMessage{ShortCode: "ABCD"}), ErrProducerClosed)
+	})
+
+	t.Run("full buffer drops", func(t *testing.T) {
+		p := newBufferedProducer(&flakyProducer{}, bufferConfig(1), nil)
+
+		require.NoError(t, p.SendAccessLog(ctx, &AccessLogMessage{ShortCode: "ABCD"}))
+		require.NoError(t, p.SendAccessLog(ctx, &AccessLogMessage{ShortCode: "ABCE"}))
+
+		stats := p.Stats()
+		assert.Equal(t, 1, stats.Buffered)
+		assert.Equal(t, int64(1), stats.Dropped)
+	})
+
+	t.Run("unknown overflow policy", func(t *testing.T) {
+		cfg := bufferConfig(1)
+		cfg.Overflow = "block"
+		_, err := NewBufferedProducer(&flakyProducer{}, cfg)
+		assert.Error(t, err)
+	})
+}
+
+func TestBufferedProducer_flush(t *testing.T) {
+	ctx := context.Background()
+	inner := &flakyProducer{down: true}
+	spill, err := openSpillFile(t.TempDir()+"/"+spillFileName, 0)
+	require.NoError(t, err)
+	p := newBufferedProducer(inner, bufferConfig(1), spill)
+
+	// One message fits into the buffer, the other is spilled
+	require.NoError(t, p.SendAccessLog(ctx, &AccessLogMessage{ShortCode: "ABCD"}))
+	require.NoError(t, p.SendAccessLog(ctx, &AccessLogMessage{ShortCode: "ABCE"}))
+
+	// While the broker is down nothing is lost
+	p.flush()
+	p.flush()
+	stats := p.Stats()
+	assert.Equal(t, int64(1), stats.Spilled)
+	assert.Greater(t, stats.SpillBytes, int64(0))
+	assert.Empty(t, inner.sentCodes())
+
+	// Spilled messages go first once it recovers
+	inner.setDown(false)
+	p.flush()
+	assert.Equal(t, []string{"ABCE", "ABCD"}, inner.sentCodes())
+	stats = p.Stats()
+	assert.Equal(t, int64(2), stats.Sent)
+	assert.Equal(t, int64(0), stats.SpillBytes)
+	assert.Equal(t, 0, stats.Buffered)
+}
+
+func TestBufferedProducer_CloseSpills(t *testing.T) {
+	ctx := context.Background()
+	cfg := bufferConfig(10)
+	cfg.Overflow = OverflowSpill
+	cfg.SpillDir = t.TempDir()
+
+	inner := &flakyProducer{down: true}
+	p, err := NewBufferedProducer(inner, cfg)
+	require.NoError(t, err)
+	require.NoError(t, p.SendAccessLog(ctx, &AccessLogMessage{ShortCode: "ABCD"}))
+	require.NoError(t, p.Close())
+	assert.Equal(t, int64(1), p.Stats().Spilled)
+
+	// The next instance sends what the previous one spilled
+	next := &flakyProducer{}
+	p, err = NewBufferedProducer(next, cfg)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return len(next.sentCodes()) == 1 }, time.Second, time.Millisecond)
+	require.NoError(t, p.Close())
+}
+
+func TestSpillFile_Limit(t *testing.T) {
+	spill, err := openSpillFile(t.TempDir()+"/"+spillFileName, 200)
+	require.NoError(t, err)
+	p := newBufferedProducer(&flakyProducer{}, bufferConfig(0), spill)
+
+	p.overflow(&AccessLogMessage{ShortCode: "ABCD"})
+	p.overflow(&AccessLogMessage{ShortCode: "ABCE"})
+
+	stats := p.Stats()
+	assert.Equal(t, int64(1), stats.Spilled)
+	assert.Equal(t, int64(1), stats.Dropped)
+	assert.LessOrEqual(t, stats.SpillBytes, int64(200))
+
+	// Taken messages are restored even beyond the limit
+	lines, err := spill.Take()
+	require.NoError(t, err)
+	require.Len(t, lines, 1)
+	spill.Restore(append(lines, lines...))
+	assert.Greater(t, spill.Size(), int64(200))
+}
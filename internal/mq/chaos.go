@@ -0,0 +1,37 @@
+package mq
+
+import (
+	"context"
+
+	"octopus/pkg/chaos"
+)
+
+// FaultInjectingProducer injects latency and errors into event sends
+type FaultInjectingProducer struct {
+	ProducerInterface
+	injector *chaos.Injector
+}
+
+// NewFaultInjectingProducer wraps a producer with a fault injector
+func NewFaultInjectingProducer(producer ProducerInterface, injector *chaos.Injector) *FaultInjectingProducer {
+	return &FaultInjectingProducer{
+		ProducerInterface: producer,
+		injector:          injector,
+	}
+}
+
+// SendAccessLog sends an access log message unless a fault is injected
+func (p *FaultInjectingProducer) SendAccessLog(ctx context.Context, msg *AccessLogMessage) error {
+	if err := p.injector.Inject(ctx); err != nil {
+		return err
+	}
+	return p.ProducerInterface.SendAccessLog(ctx, msg)
+}
+
+// SendLinkEvent sends a link event unless a fault is injected
+func (p *FaultInjectingProducer) SendLinkEvent(ctx context.Context, msg *LinkEventMessage) error {
+	if err := p.injector.Inject(ctx); err != nil {
+		return err
+	}
+	return p.ProducerInterface.SendLinkEvent(ctx, msg)
+}
@@ -0,0 +1,50 @@
+package mq
+
+import (
+	"context"
+	"testing"
+
+	"octopus/pkg/chaos"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingProducer counts the messages it is asked to send
+type recordingProducer struct {
+	sent int
+}
+
+func (p *recordingProducer) SendAccessLog(ctx context.Context, msg *AccessLogMessage) error {
+	p.sent++
+	return nil
+}
+
+func (p *recordingProducer) SendLinkEvent(ctx context.Context, msg *LinkEventMessage) error {
+	p.sent++
+	return nil
+}
+
+func (p *recordingProducer) Close() error {
+	return nil
+}
+
+func TestFaultInjectingProducer_SendAccessLog(t *testing.T) {
+	msg := &AccessLogMessage{ShortCode: "ABCD"}
+
+	t.Run("passes through without faults", func(t *testing.T) {
+		inner := &recordingProducer{}
+		p := NewFaultInjectingProducer(inner, chaos.NewInjector("mq", 0, 0, 0))
+
+		assert.NoError(t, p.SendAccessLog(context.Background(), msg))
+		assert.Equal(t, 1, inner.sent)
+		assert.NoError(t, p.Close())
+	})
+
+	t.Run("drops the message on injected error", func(t *testing.T) {
+		inner := &recordingProducer{}
+		p := NewFaultInjectingProducer(inner, chaos.NewInjector("mq", 1, 0, 0))
+
+		assert.ErrorIs(t, p.SendAccessLog(context.Background(), msg), chaos.ErrInjected)
+		assert.Equal(t, 0, inner.sent)
+	})
+}
@@ -0,0 +1,498 @@
+package mq
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Payload encodings of events on the bus
+const (
+	// EncodingJSON encodes events as JSON objects, readable by consumers predating schema versions
+	EncodingJSON = "json"
+	// EncodingProtobuf encodes events as protobuf envelopes, see api/proto/access_log.proto
+	EncodingProtobuf = "protobuf"
+)
+
+// SchemaVersion is the current schema version of events. It is only bumped for changes that
+// consumers of the previous version cannot read.
+const SchemaVersion = 1
+
+// EventTypeAccessLog is the envelope type of access log events
+const EventTypeAccessLog = "access_log"
+
+// Field numbers of the protobuf messages
+const (
+	envelopeSchemaVersion protowire.Number = 1
+	envelopeType          protowire.Number = 2
+	envelopePayload       protowire.Number = 3
+
+	accessLogEventID         protowire.Number = 1
+	accessLogShortCode       protowire.Number = 2
+	accessLogClientIP        protowire.Number = 3
+	accessLogUserAgent       protowire.Number = 4
+	accessLogReferer         protowire.Number = 5
+	accessLogClickID         protowire.Number = 6
+	accessLogAccessTime      protowire.Number = 7
+	accessLogEdge            protowire.Number = 8
+	accessLogVisitorID       protowire.Number = 9
+	accessLogVisitorStrategy protowire.Number = 10
+
+	linkEventEventID       protowire.Number = 1
+	linkEventShortCode     protowire.Number = 2
+	linkEventOriginalURL   protowire.Number = 3
+	linkEventPool          protowire.Number = 4
+	linkEventExpireAt      protowire.Number = 5
+	linkEventOccurredAt    protowire.Number = 6
+	linkEventRegion        protowire.Number = 7
+	linkEventNoClickID     protowire.Number = 8
+	linkEventMaxClicks     protowire.Number = 9
+	linkEventPreserveQuery protowire.Number = 10
+	linkEventNoTracking    protowire.Number = 11
+	linkEventCacheControl  protowire.Number = 12
+	linkEventSignedParams  protowire.Number = 13
+	linkEventSingleUse     protowire.Number = 14
+	linkEventReferrers     protowire.Number = 15
+	linkEventGeoAllow      protowire.Number = 16
+	linkEventGeoDeny       protowire.Number = 17
+	linkEventSchedule      protowire.Number = 18
+	linkEventPublicStats   protowire.Number = 19
+	linkEventParams        protowire.Number = 20
+)
+
+var (
+	// ErrUnsupportedSchema is returned for events of a schema version newer than this consumer knows
+	ErrUnsupportedSchema = errors.New("unsupported schema version")
+	// ErrUnexpectedEventType is returned for events of another type than the one decoded
+	ErrUnexpectedEventType = errors.New("unexpected event type")
+)
+
+// jsonCodec is the codec of producers without a configured one
+var jsonCodec = &Codec{encoding: EncodingJSON}
+
+// Codec encodes events in the configured encoding
+type Codec struct {
+	encoding string
+}
+
+// NewCodec creates a codec for the given encoding, JSON when empty
+func NewCodec(encoding string) (*Codec, error) {
+	switch encoding {
+	case EncodingJSON, "":
+		return jsonCodec, nil
+	case EncodingProtobuf:
+		return &Codec{encoding: EncodingProtobuf}, nil
+	}
+	return nil, fmt.Errorf("unknown MQ encoding %q", encoding)
+}
+
+// Binary reports whether encoded events are binary rather than text
+func (c *Codec) Binary() bool {
+	return c.encoding == EncodingProtobuf
+}
+
+// Encode encodes an access log event with the current schema version
+func (c *Codec) Encode(msg *AccessLogMessage) ([]byte, error) {
+	if c.encoding == EncodingProtobuf {
+		return encodeProtobuf(msg), nil
+	}
+
+	// Versioned JSON keeps the fields at the top level so that older consumers still read it
+	return json.Marshal(&struct {
+		SchemaVersion int    `json:"schema_version"`
+		Type          string `json:"type"`
+		*AccessLogMessage
+	}{SchemaVersion, EventTypeAccessLog, msg})
+}
+
+// EncodeLinkEvent encodes a link event with the current schema version
+func (c *Codec) EncodeLinkEvent(msg *LinkEventMessage) ([]byte, error) {
+	if !IsLinkEvent(msg.Type) {
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedEventType, msg.Type)
+	}
+	if c.encoding == EncodingProtobuf {
+		return encodeLinkEventProtobuf(msg), nil
+	}
+
+	return json.Marshal(&struct {
+		SchemaVersion int    `json:"schema_version"`
+		Type          string `json:"type"`
+		*LinkEventMessage
+	}{SchemaVersion, msg.Type, msg})
+}
+
+// IsLinkEvent reports whether an envelope type is one of the link lifecycle events
+func IsLinkEvent(eventType string) bool {
+	switch eventType {
+	case EventTypeLinkCreated, EventTypeLinkUpdated, EventTypeLinkExpired, EventTypeLinkDeleted:
+		return true
+	}
+	return false
+}
+
+// DecodeAccessLog decodes an access log event in any encoding: unversioned JSON as sent before
+// schema versions, versioned JSON and protobuf envelopes
+func DecodeAccessLog(data []byte) (*AccessLogMessage, error) {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		return decodeJSON(trimmed)
+	}
+	return decodeProtobuf(data)
+}
+
+// DecodeLinkEvent decodes a link event in JSON or protobuf
+func DecodeLinkEvent(data []byte) (*LinkEventMessage, error) {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var event struct {
+			SchemaVersion int    `json:"schema_version"`
+			Type          string `json:"type"`
+			LinkEventMessage
+		}
+		if err := json.Unmarshal(trimmed, &event); err != nil {
+			return nil, err
+		}
+		if err := checkLinkEnvelope(event.SchemaVersion, event.Type); err != nil {
+			return nil, err
+		}
+		event.LinkEventMessage.Type = event.Type
+		return &event.LinkEventMessage, nil
+	}
+	return decodeLinkEventProtobuf(data)
+}
+
+// decodeJSON decodes a JSON event, unversioned events being treated as the first version
+func decodeJSON(data []byte) (*AccessLogMessage, error) {
+	var event struct {
+		SchemaVersion int    `json:"schema_version"`
+		Type          string `json:"type"`
+		AccessLogMessage
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	if err := checkEnvelope(event.SchemaVersion, event.Type); err != nil {
+		return nil, err
+	}
+	return &event.AccessLogMessage, nil
+}
+
+// checkEnvelope rejects access log events this consumer cannot interpret
+func checkEnvelope(version int, eventType string) error {
+	if version > SchemaVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedSchema, version)
+	}
+	if eventType != "" && eventType != EventTypeAccessLog {
+		return fmt.Errorf("%w: %s", ErrUnexpectedEventType, eventType)
+	}
+	return nil
+}
+
+// checkLinkEnvelope rejects link events this consumer cannot interpret
+func checkLinkEnvelope(version int, eventType string) error {
+	if version > SchemaVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedSchema, version)
+	}
+	if !IsLinkEvent(eventType) {
+		return fmt.Errorf("%w: %s", ErrUnexpectedEventType, eventType)
+	}
+	return nil
+}
+
+// encodeProtobuf encodes an access log into a protobuf envelope
+func encodeProtobuf(msg *AccessLogMessage) []byte {
+	var payload []byte
+	payload = appendString(payload, accessLogEventID, msg.EventID)
+	payload = appendString(payload, accessLogShortCode, msg.ShortCode)
+	payload = appendString(payload, accessLogClientIP, msg.ClientIP)
+	payload = appendString(payload, accessLogUserAgent, msg.UserAgent)
+	payload = appendString(payload, accessLogReferer, msg.Referer)
+	payload = appendString(payload, accessLogClickID, msg.ClickID)
+	if !msg.AccessTime.IsZero() {
+		payload = protowire.AppendTag(payload, accessLogAccessTime, protowire.VarintType)
+		payload = protowire.AppendVarint(payload, uint64(msg.AccessTime.UnixNano()))
+	}
+	payload = appendString(payload, accessLogEdge, msg.Edge)
+	payload = appendString(payload, accessLogVisitorID, msg.VisitorID)
+	payload = appendString(payload, accessLogVisitorStrategy, msg.VisitorStrategy)
+	return appendEnvelope(nil, EventTypeAccessLog, payload)
+}
+
+// encodeLinkEventProtobuf encodes a link event into a protobuf envelope
+func encodeLinkEventProtobuf(msg *LinkEventMessage) []byte {
+	var payload []byte
+	payload = appendString(payload, linkEventEventID, msg.EventID)
+	payload = appendString(payload, linkEventShortCode, msg.ShortCode)
+	payload = appendString(payload, linkEventOriginalURL, msg.OriginalURL)
+	payload = appendString(payload, linkEventPool, msg.Pool)
+	if msg.ExpireAt != nil {
+		payload = protowire.AppendTag(payload, linkEventExpireAt, protowire.VarintType)
+		payload = protowire.AppendVarint(payload, uint64(msg.ExpireAt.UnixNano()))
+	}
+	if !msg.OccurredAt.IsZero() {
+		payload = protowire.AppendTag(payload, linkEventOccurredAt, protowire.VarintType)
+		payload = protowire.AppendVarint(payload, uint64(msg.OccurredAt.UnixNano()))
+	}
+	payload = appendString(payload, linkEventRegion, msg.Region)
+	payload = appendBool(payload, linkEventNoClickID, msg.NoClickID)
+	if msg.MaxClicks != 0 {
+		payload = protowire.AppendTag(payload, linkEventMaxClicks, protowire.VarintType)
+		payload = protowire.AppendVarint(payload, uint64(msg.MaxClicks))
+	}
+	payload = appendBool(payload, linkEventPreserveQuery, msg.PreserveQuery)
+	payload = appendBool(payload, linkEventNoTracking, msg.NoTracking)
+	payload = appendString(payload, linkEventCacheControl, msg.CacheControl)
+	payload = appendBool(payload, linkEventSignedParams, msg.SignedParams)
+	payload = appendBool(payload, linkEventSingleUse, msg.SingleUse)
+	payload = appendString(payload, linkEventReferrers, msg.Referrers)
+	payload = appendString(payload, linkEventGeoAllow, msg.GeoAllow)
+	payload = appendString(payload, linkEventGeoDeny, msg.GeoDeny)
+	if len(msg.Schedule) > 0 {
+		payload = protowire.AppendTag(payload, linkEventSchedule, protowire.BytesType)
+		payload = protowire.AppendBytes(payload, msg.Schedule)
+	}
+	payload = appendBool(payload, linkEventPublicStats, msg.PublicStats)
+	if len(msg.Params) > 0 {
+		payload = protowire.AppendTag(payload, linkEventParams, protowire.BytesType)
+		payload = protowire.AppendBytes(payload, msg.Params)
+	}
+	return appendEnvelope(nil, msg.Type, payload)
+}
+
+// appendEnvelope appends the envelope of an encoded event with the current schema version
+func appendEnvelope(b []byte, eventType string, payload []byte) []byte {
+	b = protowire.AppendTag(b, envelopeSchemaVersion, protowire.VarintType)
+	b = protowire.AppendVarint(b, SchemaVersion)
+	b = appendString(b, envelopeType, eventType)
+	b = protowire.AppendTag(b, envelopePayload, protowire.BytesType)
+	return protowire.AppendBytes(b, payload)
+}
+
+// appendString appends a string field, omitting empty strings like proto3 does
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendBool appends a bool field, omitting false like proto3 does
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeBool(v))
+}
+
+// decodeProtobuf decodes a protobuf envelope holding an access log, skipping unknown fields
+func decodeProtobuf(data []byte) (*AccessLogMessage, error) {
+	version, eventType, payload, err := decodeEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEnvelope(version, eventType); err != nil {
+		return nil, err
+	}
+
+	msg := &AccessLogMessage{}
+	textFields := map[protowire.Number]*string{
+		accessLogEventID:         &msg.EventID,
+		accessLogShortCode:       &msg.ShortCode,
+		accessLogClientIP:        &msg.ClientIP,
+		accessLogUserAgent:       &msg.UserAgent,
+		accessLogReferer:         &msg.Referer,
+		accessLogClickID:         &msg.ClickID,
+		accessLogEdge:            &msg.Edge,
+		accessLogVisitorID:       &msg.VisitorID,
+		accessLogVisitorStrategy: &msg.VisitorStrategy,
+	}
+	err = consumeFields(payload, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if field, ok := textFields[num]; ok && typ == protowire.BytesType {
+			v, n := protowire.ConsumeString(b)
+			*field = v
+			return n
+		}
+		if num == accessLogAccessTime && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			msg.AccessTime = time.Unix(0, int64(v))
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid access log: %w", err)
+	}
+	return msg, nil
+}
+
+// decodeLinkEventProtobuf decodes a protobuf envelope holding a link event, skipping unknown fields
+func decodeLinkEventProtobuf(data []byte) (*LinkEventMessage, error) {
+	version, eventType, payload, err := decodeEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLinkEnvelope(version, eventType); err != nil {
+		return nil, err
+	}
+
+	msg := &LinkEventMessage{Type: eventType}
+	textFields := map[protowire.Number]*string{
+		linkEventEventID:      &msg.EventID,
+		linkEventShortCode:    &msg.ShortCode,
+		linkEventOriginalURL:  &msg.OriginalURL,
+		linkEventPool:         &msg.Pool,
+		linkEventRegion:       &msg.Region,
+		linkEventCacheControl: &msg.CacheControl,
+		linkEventReferrers:    &msg.Referrers,
+		linkEventGeoAllow:     &msg.GeoAllow,
+		linkEventGeoDeny:      &msg.GeoDeny,
+	}
+	err = consumeFields(payload, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if field, ok := textFields[num]; ok && typ == protowire.BytesType {
+			v, n := protowire.ConsumeString(b)
+			*field = v
+			return n
+		}
+		if typ == protowire.VarintType && (num == linkEventExpireAt || num == linkEventOccurredAt) {
+			v, n := protowire.ConsumeVarint(b)
+			t := time.Unix(0, int64(v))
+			if num == linkEventExpireAt {
+				msg.ExpireAt = &t
+			} else {
+				msg.OccurredAt = t
+			}
+			return n
+		}
+		if typ == protowire.VarintType && (num == linkEventNoClickID || num == linkEventPreserveQuery || num == linkEventNoTracking ||
+			num == linkEventSignedParams || num == linkEventSingleUse || num == linkEventPublicStats) {
+			v, n := protowire.ConsumeVarint(b)
+			switch num {
+			case linkEventNoClickID:
+				msg.NoClickID = protowire.DecodeBool(v)
+			case linkEventPreserveQuery:
+				msg.PreserveQuery = protowire.DecodeBool(v)
+			case linkEventSignedParams:
+				msg.SignedParams = protowire.DecodeBool(v)
+			case linkEventSingleUse:
+				msg.SingleUse = protowire.DecodeBool(v)
+			case linkEventPublicStats:
+				msg.PublicStats = protowire.DecodeBool(v)
+			default:
+				msg.NoTracking = protowire.DecodeBool(v)
+			}
+			return n
+		}
+		if (num == linkEventSchedule || num == linkEventParams) && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			if num == linkEventSchedule {
+				msg.Schedule = append(json.RawMessage(nil), v...)
+			} else {
+				msg.Params = append(json.RawMessage(nil), v...)
+			}
+			return n
+		}
+		if num == linkEventMaxClicks && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			msg.MaxClicks = int64(v)
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid link event: %w", err)
+	}
+	return msg, nil
+}
+
+// decodeEnvelope reads the schema version, type and payload of a protobuf envelope
+func decodeEnvelope(data []byte) (int, string, []byte, error) {
+	var (
+		version   uint64
+		eventType string
+		payload   []byte
+	)
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == envelopeSchemaVersion && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			version = v
+			return n
+		case num == envelopeType && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			eventType = v
+			return n
+		case num == envelopePayload && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			payload = v
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("invalid envelope: %w", err)
+	}
+	if version == 0 {
+		return 0, "", nil, errors.New("invalid envelope: missing schema version")
+	}
+	return int(version), eventType, payload, nil
+}
+
+// consumeFields walks the fields of a protobuf message, the callback consuming each value
+func consumeFields(b []byte, field func(num protowire.Number, typ protowire.Type, b []byte) int) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n = field(num, typ, b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// encoding lets a producer encode events with a configured codec
+type encoding struct {
+	codec *Codec
+}
+
+// SetCodec sets the codec encoding sent events
+func (e *encoding) SetCodec(codec *Codec) {
+	e.codec = codec
+}
+
+// encode encodes an event, as JSON without a configured codec
+func (e *encoding) encode(msg *AccessLogMessage) ([]byte, error) {
+	codec := e.codec
+	if codec == nil {
+		codec = jsonCodec
+	}
+	data, err := codec.Encode(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return data, nil
+}
+
+// encodeLinkEvent encodes a link event, as JSON without a configured codec
+func (e *encoding) encodeLinkEvent(msg *LinkEventMessage) ([]byte, error) {
+	codec := e.codec
+	if codec == nil {
+		codec = jsonCodec
+	}
+	data, err := codec.EncodeLinkEvent(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal link event: %w", err)
+	}
+	return data, nil
+}
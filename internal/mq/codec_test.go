@@ -0,0 +1,179 @@
+package mq
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestCodec_RoundTrip(t *testing.T) {
+	msg := &AccessLogMessage{
+		EventID:         "3f2a9c1e-0000-4000-8000-000000000001",
+		ShortCode:       "ABCD",
+		ClientIP:        "192.168.1.1",
+		UserAgent:       "Mozilla/5.0",
+		Referer:         "https://google.com",
+		ClickID:         "c1d2",
+		Edge:            "hit",
+		AccessTime:      time.Unix(1700000000, 123456789),
+		VisitorID:       "192.168.1.1/3b5d5c3712955042",
+		VisitorStrategy: "ip_ua",
+	}
+
+	for _, encoding := range []string{EncodingJSON, EncodingProtobuf} {
+		t.Run(encoding, func(t *testing.T) {
+			codec, err := NewCodec(encoding)
+			require.NoError(t, err)
+
+			data, err := codec.Encode(msg)
+			require.NoError(t, err)
+
+			decoded, err := DecodeAccessLog(data)
+			require.NoError(t, err)
+			assert.True(t, msg.AccessTime.Equal(decoded.AccessTime))
+			decoded.AccessTime = msg.AccessTime
+			assert.Equal(t, msg, decoded)
+		})
+	}
+}
+
+func TestNewCodec(t *testing.T) {
+	codec, err := NewCodec("")
+	require.NoError(t, err)
+	assert.False(t, codec.Binary())
+
+	codec, err = NewCodec(EncodingProtobuf)
+	require.NoError(t, err)
+	assert.True(t, codec.Binary())
+
+	_, err = NewCodec("avro")
+	assert.Error(t, err)
+}
+
+func TestCodec_JSONReadableByOlderConsumers(t *testing.T) {
+	data, err := jsonCodec.Encode(&AccessLogMessage{ShortCode: "ABCD"})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"schema_version":1`)
+
+	// Consumers predating schema versions unmarshal the message directly
+	var legacy AccessLogMessage
+	require.NoError(t, json.Unmarshal(data, &legacy))
+	assert.Equal(t, "ABCD", legacy.ShortCode)
+}
+
+func TestDecodeAccessLog(t *testing.T) {
+	t.Run("unversioned JSON", func(t *testing.T) {
+		msg, err := DecodeAccessLog([]byte(` {"short_code":"ABCD","client_ip":"10.0.0.1"}`))
+		require.NoError(t, err)
+		assert.Equal(t, "ABCD", msg.ShortCode)
+		assert.Equal(t, "10.0.0.1", msg.ClientIP)
+	})
+
+	t.Run("newer JSON schema", func(t *testing.T) {
+		_, err := DecodeAccessLog([]byte(`{"schema_version":2,"short_code":"ABCD"}`))
+		assert.ErrorIs(t, err, ErrUnsupportedSchema)
+	})
+
+	t.Run("other JSON event type", func(t *testing.T) {
+		_, err := DecodeAccessLog([]byte(`{"schema_version":1,"type":"link_created"}`))
+		assert.ErrorIs(t, err, ErrUnexpectedEventType)
+	})
+
+	t.Run("malformed JSON", func(t *testing.T) {
+		_, err := DecodeAccessLog([]byte("{"))
+		assert.Error(t, err)
+	})
+
+	t.Run("protobuf with unknown fields", func(t *testing.T) {
+		var payload []byte
+		payload = appendString(payload, accessLogShortCode, "ABCD")
+		payload = appendString(payload, 99, "added later")
+
+		var envelope []byte
+		envelope = protowire.AppendTag(envelope, envelopeSchemaVersion, protowire.VarintType)
+		envelope = protowire.AppendVarint(envelope, SchemaVersion)
+		envelope = protowire.AppendTag(envelope, envelopePayload, protowire.BytesType)
+		envelope = protowire.AppendBytes(envelope, payload)
+		envelope = protowire.AppendTag(envelope, 42, protowire.Fixed64Type)
+		envelope = protowire.AppendFixed64(envelope, 7)
+
+		msg, err := DecodeAccessLog(envelope)
+		require.NoError(t, err)
+		assert.Equal(t, "ABCD", msg.ShortCode)
+		assert.True(t, msg.AccessTime.IsZero())
+	})
+
+	t.Run("newer protobuf schema", func(t *testing.T) {
+		envelope := protowire.AppendTag(nil, envelopeSchemaVersion, protowire.VarintType)
+		envelope = protowire.AppendVarint(envelope, SchemaVersion+1)
+
+		_, err := DecodeAccessLog(envelope)
+		assert.ErrorIs(t, err, ErrUnsupportedSchema)
+	})
+
+	t.Run("garbage", func(t *testing.T) {
+		for _, data := range [][]byte{nil, {0xff, 0xff}, []byte("not an event")} {
+			_, err := DecodeAccessLog(data)
+			assert.Error(t, err)
+		}
+	})
+}
+
+func TestCodec_LinkEventRoundTrip(t *testing.T) {
+	expireAt := time.Unix(1800000000, 0)
+	msg := &LinkEventMessage{
+		EventID:       "3f2a9c1e-0000-4000-8000-000000000002",
+		Type:          EventTypeLinkCreated,
+		ShortCode:     "ABCD",
+		OriginalURL:   "https://example.com",
+		Pool:          "sms",
+		ExpireAt:      &expireAt,
+		OccurredAt:    time.Unix(1700000000, 123456789),
+		Region:        "eu-west",
+		NoClickID:     true,
+		MaxClicks:     100,
+		PreserveQuery: true,
+		NoTracking:    true,
+		CacheControl:  "public, max-age=300",
+		SignedParams:  true,
+		SingleUse:     true,
+		Referrers:     "news.example.com,example.org",
+		GeoAllow:      "FR,BE",
+		Schedule:      json.RawMessage(`{"rules":[{"days":"sat,sun","url":"https://example.com/voicemail"}]}`),
+		PublicStats:   true,
+		Params:        json.RawMessage(`{"utm_source":"newsletter"}`),
+	}
+
+	for _, encoding := range []string{EncodingJSON, EncodingProtobuf} {
+		t.Run(encoding, func(t *testing.T) {
+			codec, err := NewCodec(encoding)
+			require.NoError(t, err)
+
+			data, err := codec.EncodeLinkEvent(msg)
+			require.NoError(t, err)
+
+			decoded, err := DecodeLinkEvent(data)
+			require.NoError(t, err)
+			assert.True(t, msg.OccurredAt.Equal(decoded.OccurredAt))
+			assert.True(t, msg.ExpireAt.Equal(*decoded.ExpireAt))
+			decoded.OccurredAt, decoded.ExpireAt = msg.OccurredAt, msg.ExpireAt
+			assert.Equal(t, msg, decoded)
+
+			// Access log consumers recognize link events as not theirs
+			_, err = DecodeAccessLog(data)
+			assert.ErrorIs(t, err, ErrUnexpectedEventType)
+		})
+	}
+
+	t.Run("unknown types are rejected", func(t *testing.T) {
+		_, err := jsonCodec.EncodeLinkEvent(&LinkEventMessage{Type: EventTypeAccessLog})
+		assert.ErrorIs(t, err, ErrUnexpectedEventType)
+
+		_, err = DecodeLinkEvent([]byte(`{"schema_version":1,"type":"access_log"}`))
+		assert.ErrorIs(t, err, ErrUnexpectedEventType)
+	})
+}
@@ -3,10 +3,14 @@ package mq
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
 	"octopus/internal/config"
+	"octopus/internal/model"
 
 	"github.com/apache/rocketmq-client-go/v2"
 	"github.com/apache/rocketmq-client-go/v2/consumer"
@@ -17,18 +21,130 @@ import (
 // AccessLogHandler is the handler for access log messages
 type AccessLogHandler func(ctx context.Context, msg *AccessLogMessage) error
 
+// LinkEventHandler is the handler for link lifecycle events
+type LinkEventHandler func(ctx context.Context, msg *LinkEventMessage) error
+
+// AlertHandler is the handler for operational alerts
+type AlertHandler func(ctx context.Context, msg *AlertMessage) error
+
+// MessageHandler processes one RocketMQ message, failed messages being consumed again later
+type MessageHandler func(ctx context.Context, msg *primitive.MessageExt) error
+
+// TopicRegistry maps the topics a RocketMQ consumer subscribes to, then the tags of their messages,
+// to the handlers processing them
+type TopicRegistry map[string]map[string]MessageHandler
+
+// Register routes the messages of a topic with the given tags to a handler
+func (r TopicRegistry) Register(topic string, tags []string, handler MessageHandler) {
+	if r[topic] == nil {
+		r[topic] = make(map[string]MessageHandler)
+	}
+	for _, tag := range tags {
+		r[topic][tag] = handler
+	}
+}
+
+// expression returns the tag expression selecting the messages of a topic that have a handler
+func (r TopicRegistry) expression(topic string) string {
+	tags := make([]string, 0, len(r[topic]))
+	for tag := range r[topic] {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return strings.Join(tags, " || ")
+}
+
+// linkEventTypes are the tags of link events
+var linkEventTypes = []string{EventTypeLinkCreated, EventTypeLinkUpdated, EventTypeLinkExpired, EventTypeLinkDeleted}
+
 // Consumer handles message consumption from RocketMQ
 type Consumer struct {
 	client   rocketmq.PushConsumer
+	cfg      *config.RocketMQConfig
 	topic    string
 	group    string
 	handler  AccessLogHandler
+	routes   TopicRegistry
 	once     sync.Once
 	started  bool
+	deadLettering
+	consumerStats
 }
 
-// NewConsumer creates a new RocketMQ consumer
+// NewConsumer creates a new RocketMQ consumer of the access log topic. Handlers of other topics
+// are registered before subscribing.
 func NewConsumer(cfg *config.RocketMQConfig, handler AccessLogHandler) (*Consumer, error) {
+	client, err := newPushConsumer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newConsumer(cfg, client, handler), nil
+}
+
+// newConsumer creates a consumer on the given client, routing access logs to handler
+func newConsumer(cfg *config.RocketMQConfig, client rocketmq.PushConsumer, handler AccessLogHandler) *Consumer {
+	c := &Consumer{
+		client:  client,
+		cfg:     cfg,
+		topic:   cfg.TopicName(&cfg.Topics.AccessLog),
+		group:   cfg.Group,
+		handler: handler,
+		routes:  TopicRegistry{},
+	}
+	c.routes.Register(c.topic, []string{EventTypeAccessLog}, c.handleAccessLog)
+	return c
+}
+
+// Handle registers the handler of the messages of a topic with the given tags. Topics are
+// subscribed to once with the tags of all their handlers, so kinds of messages sharing a topic
+// share the subscription.
+func (c *Consumer) Handle(topic string, tags []string, handler MessageHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.routes.Register(topic, tags, handler)
+}
+
+// HandleLinkEvents registers the handler of the link events of the link events topic
+func (c *Consumer) HandleLinkEvents(handler LinkEventHandler) {
+	c.Handle(c.cfg.TopicName(&c.cfg.Topics.LinkEvents), linkEventTypes, func(ctx context.Context, msg *primitive.MessageExt) error {
+		event, err := DecodeLinkEvent(msg.Body)
+		if err != nil {
+			log.Error().Err(err).Str("msg_id", msg.MsgId).Msg("Failed to unmarshal link event")
+			c.record(err)
+			return err
+		}
+		if err := handler(ctx, event); err != nil {
+			log.Error().Err(err).Str("msg_id", msg.MsgId).Msg("Link event handler failed")
+			c.record(err)
+			return err
+		}
+		c.record(nil)
+		return nil
+	})
+}
+
+// HandleAlerts registers the handler of the alerts of the alerts topic. Malformed alerts are
+// dropped, they never succeed.
+func (c *Consumer) HandleAlerts(handler AlertHandler) {
+	c.Handle(c.cfg.TopicName(&c.cfg.Topics.Alerts), []string{EventTypeAlert}, func(ctx context.Context, msg *primitive.MessageExt) error {
+		var alert AlertMessage
+		if err := json.Unmarshal(msg.Body, &alert); err != nil {
+			log.Error().Err(err).Str("msg_id", msg.MsgId).Msg("Failed to unmarshal alert")
+			c.record(err)
+			return nil
+		}
+		if err := handler(ctx, &alert); err != nil {
+			log.Error().Err(err).Str("msg_id", msg.MsgId).Msg("Alert handler failed")
+			c.record(err)
+			return err
+		}
+		c.record(nil)
+		return nil
+	})
+}
+
+// newPushConsumer creates a RocketMQ push consumer in the configured group
+func newPushConsumer(cfg *config.RocketMQConfig) (rocketmq.PushConsumer, error) {
 	c, err := rocketmq.NewPushConsumer(
 		consumer.WithNameServer([]string{cfg.NameServer}),
 		consumer.WithConsumerModel(consumer.Clustering),
@@ -37,62 +153,131 @@ func NewConsumer(cfg *config.RocketMQConfig, handler AccessLogHandler) (*Consume
 	if err != nil {
 		return nil, fmt.Errorf("failed to create RocketMQ consumer: %w", err)
 	}
-
-	return &Consumer{
-		client:  c,
-		topic:   cfg.Topic,
-		group:   cfg.Group,
-		handler: handler,
-	}, nil
+	return c, nil
 }
 
 // Subscribe subscribes to the topic and starts consuming messages
 func (c *Consumer) Subscribe() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subscribe()
+}
+
+// subscribe starts consuming, with a new client when the previous one was shut down by a restart
+func (c *Consumer) subscribe() error {
 	if c.started {
 		return nil
 	}
+	if c.client == nil {
+		client, err := newPushConsumer(c.cfg)
+		if err != nil {
+			return err
+		}
+		c.client = client
+	}
 
-	err := c.client.Subscribe(c.topic, consumer.MessageSelector{}, func(ctx context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
-		for _, msg := range msgs {
-			var accessLog AccessLogMessage
-			if err := json.Unmarshal(msg.Body, &accessLog); err != nil {
-				log.Error().Err(err).Str("msg_id", msg.MsgId).Msg("Failed to unmarshal message")
-				return consumer.ConsumeRetryLater, err
-			}
+	// Kinds of messages sharing a topic are told apart by their tags
+	for topic, handlers := range c.routes {
+		selector := consumer.MessageSelector{Type: consumer.TAG, Expression: c.routes.expression(topic)}
+		if err := c.client.Subscribe(topic, selector, consumeWith(handlers)); err != nil {
+			return fmt.Errorf("failed to subscribe to topic %s: %w", topic, err)
+		}
+	}
 
-			log.Debug().
-				Str("msg_id", msg.MsgId).
-				Str("short_code", accessLog.ShortCode).
-				Msg("Processing access log")
+	if err := c.client.Start(); err != nil {
+		return fmt.Errorf("failed to start consumer: %w", err)
+	}
 
-			if c.handler != nil {
-				if err := c.handler(ctx, &accessLog); err != nil {
-					log.Error().Err(err).Str("msg_id", msg.MsgId).Msg("Handler failed")
-					return consumer.ConsumeRetryLater, err
-				}
+	c.started = true
+	log.Info().Str("topic", c.topic).Msg("RocketMQ consumer started")
+
+	return nil
+}
+
+// consumeWith dispatches the messages of a topic to the handlers of their tags, consuming the batch
+// again later from the first failed message
+func consumeWith(handlers map[string]MessageHandler) func(ctx context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+	return func(ctx context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+		for _, msg := range msgs {
+			handler, ok := handlers[msg.GetTags()]
+			if !ok {
+				continue
+			}
+			if err := handler(ctx, msg); err != nil {
+				return consumer.ConsumeRetryLater, err
 			}
 		}
 		return consumer.ConsumeSuccess, nil
-	})
+	}
+}
 
+// handleAccessLog processes an access log, dead-lettering those that cannot be decoded
+func (c *Consumer) handleAccessLog(ctx context.Context, msg *primitive.MessageExt) error {
+	accessLog, err := DecodeAccessLog(msg.Body)
+	if errors.Is(err, ErrUnexpectedEventType) {
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to subscribe to topic: %w", err)
+		log.Error().Err(err).Str("msg_id", msg.MsgId).Msg("Failed to unmarshal message")
+		c.record(err)
+		if c.deadLetter(ctx, msg.Body, err) {
+			return nil
+		}
+		return err
 	}
 
-	if err := c.client.Start(); err != nil {
-		return fmt.Errorf("failed to start consumer: %w", err)
+	log.Debug().
+		Str("msg_id", msg.MsgId).
+		Str("short_code", accessLog.ShortCode).
+		Msg("Processing access log")
+
+	if c.handler != nil {
+		if err := c.handler(ctx, accessLog); err != nil {
+			log.Error().Err(err).Str("msg_id", msg.MsgId).Msg("Handler failed")
+			c.record(err)
+			return err
+		}
 	}
+	c.record(nil)
+	return nil
+}
 
-	c.started = true
-	log.Info().Str("topic", c.topic).Msg("RocketMQ consumer started")
+// Status reports the state and counters of the consumer. RocketMQ lag is only known to its admin
+// tools, it is not reported.
+func (c *Consumer) Status(ctx context.Context) *model.ConsumerStatus {
+	c.mu.Lock()
+	started := c.started
+	c.mu.Unlock()
+	return c.status(DriverRocketMQ, c.topic, c.group, started, nil)
+}
 
-	return nil
+// Restart shuts the client down and subscribes again with a new one
+func (c *Consumer) Restart() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.stop(); err != nil {
+		return err
+	}
+	return c.subscribe()
+}
+
+// stop shuts the client down, a shut down client cannot start again
+func (c *Consumer) stop() error {
+	if c.client == nil {
+		return nil
+	}
+	err := c.client.Shutdown()
+	c.client = nil
+	c.started = false
+	return err
 }
 
 // Close closes the consumer
 func (c *Consumer) Close() error {
-	if c != nil && c.client != nil {
-		return c.client.Shutdown()
+	if c == nil {
+		return nil
 	}
-	return nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stop()
 }
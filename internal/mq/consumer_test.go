@@ -5,7 +5,13 @@ import (
 	"testing"
 	"time"
 
+	"octopus/internal/config"
+
+	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestConsumer_Subscribe_AlreadyStarted(t *testing.T) {
@@ -92,3 +98,94 @@ func TestConsumer_NewConsumer_Structure(t *testing.T) {
 		assert.NotNil(t, c.handler)
 	})
 }
+
+func TestConsumer_Status(t *testing.T) {
+	c := &Consumer{topic: "test-topic", group: "test-group", started: true}
+	c.record(nil)
+	c.record(assert.AnError)
+
+	status := c.Status(context.Background())
+	assert.Equal(t, DriverRocketMQ, status.Driver)
+	assert.Equal(t, "test-topic", status.Topic)
+	assert.Equal(t, ConsumerStarted, status.Status)
+	assert.Equal(t, int64(1), status.Processed)
+	assert.Equal(t, int64(1), status.Errors)
+	assert.Nil(t, status.Lag)
+}
+
+// fakePushConsumer records the subscriptions of a consumer
+type fakePushConsumer struct {
+	rocketmq.PushConsumer
+	selectors map[string]string
+	consume   map[string]func(context.Context, ...*primitive.MessageExt) (consumer.ConsumeResult, error)
+}
+
+func (c *fakePushConsumer) Subscribe(topic string, selector consumer.MessageSelector, f func(context.Context, ...*primitive.MessageExt) (consumer.ConsumeResult, error)) error {
+	c.selectors[topic] = selector.Expression
+	c.consume[topic] = f
+	return nil
+}
+
+func (c *fakePushConsumer) Start() error { return nil }
+
+func TestConsumer_Topics(t *testing.T) {
+	cfg := &config.RocketMQConfig{
+		Topic:  "octopus",
+		Topics: config.RocketMQTopicsConfig{Alerts: config.RocketMQTopicConfig{Name: "alerts"}},
+	}
+	client := &fakePushConsumer{
+		selectors: map[string]string{},
+		consume:   map[string]func(context.Context, ...*primitive.MessageExt) (consumer.ConsumeResult, error){},
+	}
+
+	var handled []string
+	c := newConsumer(cfg, client, func(ctx context.Context, msg *AccessLogMessage) error {
+		handled = append(handled, "access:"+msg.ShortCode)
+		return nil
+	})
+	c.HandleLinkEvents(func(ctx context.Context, msg *LinkEventMessage) error {
+		handled = append(handled, msg.Type+":"+msg.ShortCode)
+		return nil
+	})
+	c.HandleAlerts(func(ctx context.Context, msg *AlertMessage) error {
+		handled = append(handled, "alert:"+msg.Name)
+		if msg.Name == "fail" {
+			return assert.AnError
+		}
+		return nil
+	})
+	require.NoError(t, c.Subscribe())
+
+	// Access logs and link events share the topic, each topic is subscribed to once
+	assert.Equal(t, map[string]string{
+		"octopus": "access_log || link_created || link_deleted || link_expired || link_updated",
+		"alerts":  "alert",
+	}, client.selectors)
+
+	message := func(tag string, body string) *primitive.MessageExt {
+		msg := &primitive.MessageExt{Message: primitive.Message{Body: []byte(body)}}
+		msg.WithTag(tag)
+		return msg
+	}
+	var p Producer
+	linkEvent, err := p.encodeLinkEvent(&LinkEventMessage{Type: EventTypeLinkDeleted, ShortCode: "EFGH"})
+	require.NoError(t, err)
+
+	result, err := client.consume["octopus"](context.Background(),
+		message(EventTypeAccessLog, `{"short_code":"ABCD"}`),
+		message(EventTypeLinkDeleted, string(linkEvent)),
+		message("other", `{}`),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, consumer.ConsumeSuccess, result)
+
+	result, err = client.consume["alerts"](context.Background(),
+		message(EventTypeAlert, `{"name":"redis_down"}`),
+		message(EventTypeAlert, `{"name":"fail"}`),
+	)
+	assert.Error(t, err)
+	assert.Equal(t, consumer.ConsumeRetryLater, result)
+
+	assert.Equal(t, []string{"access:ABCD", "link_deleted:EFGH", "alert:redis_down", "alert:fail"}, handled)
+	assert.Equal(t, int64(3), c.Status(context.Background()).Processed)
+}
@@ -0,0 +1,255 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// Stream entry fields of a dead letter
+const (
+	deadLetterPayloadField  = "payload"
+	deadLetterReasonField   = "reason"
+	deadLetterAttemptsField = "attempts"
+	deadLetterFailedAtField = "failed_at"
+)
+
+// defaultReplayCount is the number of oldest dead letters replayed when none are selected
+const defaultReplayCount = 100
+
+// ErrReplayUnavailable is returned when dead letters are replayed without a producer
+var ErrReplayUnavailable = errors.New("no MQ producer to replay dead letters to")
+
+// DeadLetterQueue parks access log events that keep failing in a Redis stream for inspection and replay
+type DeadLetterQueue struct {
+	client      redis.Cmdable
+	producer    ProducerInterface
+	stream      string
+	maxAttempts int64
+	attemptTTL  time.Duration
+	maxLen      int64
+}
+
+// NewDeadLetterQueue creates a new dead-letter queue, replaying events through the given producer
+func NewDeadLetterQueue(client redis.Cmdable, producer ProducerInterface, cfg *config.DeadLetterConfig) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		client:      client,
+		producer:    producer,
+		stream:      cfg.Stream,
+		maxAttempts: cfg.MaxAttempts,
+		attemptTTL:  cfg.AttemptTTL,
+		maxLen:      cfg.MaxLen,
+	}
+}
+
+// Add parks a payload in the dead-letter queue
+func (q *DeadLetterQueue) Add(ctx context.Context, payload []byte, reason string, attempts int64) error {
+	id, err := q.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: q.stream,
+		MaxLen: q.maxLen,
+		Approx: q.maxLen > 0,
+		Values: map[string]interface{}{
+			deadLetterPayloadField:  payload,
+			deadLetterReasonField:   reason,
+			deadLetterAttemptsField: attempts,
+			deadLetterFailedAtField: time.Now().UnixMilli(),
+		},
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to add dead letter: %w", err)
+	}
+
+	log.Warn().Str("dead_letter_id", id).Str("reason", reason).Int64("attempts", attempts).Msg("Message dead-lettered")
+
+	return nil
+}
+
+// Guard wraps a handler to dead-letter messages once they failed max attempts times. Attempts are
+// counted per message across redeliveries, a dead-lettered message reports success so the broker
+// stops redelivering it.
+func (q *DeadLetterQueue) Guard(handler AccessLogHandler) AccessLogHandler {
+	return func(ctx context.Context, msg *AccessLogMessage) error {
+		key := q.stream + ":attempts:" + msg.DedupID()
+
+		err := handler(ctx, msg)
+		if err == nil {
+			if delErr := q.client.Del(ctx, key).Err(); delErr != nil {
+				log.Warn().Err(delErr).Str("short_code", msg.ShortCode).Msg("Failed to clear delivery attempts")
+			}
+			return nil
+		}
+
+		attempts, incrErr := q.client.Incr(ctx, key).Result()
+		if incrErr != nil {
+			// Without a count the broker's own redelivery takes over
+			return err
+		}
+		q.client.Expire(ctx, key, q.attemptTTL)
+		if attempts < q.maxAttempts {
+			return err
+		}
+
+		payload, marshalErr := json.Marshal(msg)
+		if marshalErr != nil {
+			return err
+		}
+		if addErr := q.Add(ctx, payload, err.Error(), attempts); addErr != nil {
+			log.Error().Err(addErr).Str("short_code", msg.ShortCode).Msg("Failed to dead-letter message")
+			return err
+		}
+		q.client.Del(ctx, key)
+		return nil
+	}
+}
+
+// List returns up to count dead letters, oldest first, starting after the given ID
+func (q *DeadLetterQueue) List(ctx context.Context, after string, count int64) (*model.DeadLetterPage, error) {
+	start := "-"
+	if after != "" {
+		start = "(" + after
+	}
+
+	msgs, err := q.client.XRangeN(ctx, q.stream, start, "+", count).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+	depth, err := q.Depth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.DeadLetterPage{
+		DeadLetters: make([]*model.DeadLetter, 0, len(msgs)),
+		Depth:       depth,
+	}
+	for _, msg := range msgs {
+		page.DeadLetters = append(page.DeadLetters, toDeadLetter(msg))
+	}
+	if count > 0 && int64(len(msgs)) == count {
+		page.Next = msgs[len(msgs)-1].ID
+	}
+	return page, nil
+}
+
+// Depth returns the number of dead letters
+func (q *DeadLetterQueue) Depth(ctx context.Context) (int64, error) {
+	depth, err := q.client.XLen(ctx, q.stream).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count dead letters: %w", err)
+	}
+	return depth, nil
+}
+
+// Replay sends the selected dead letters, or the oldest ones when none are selected, back through the
+// producer and removes them. Dead letters that cannot be decoded are kept.
+func (q *DeadLetterQueue) Replay(ctx context.Context, ids []string) (int, error) {
+	if q.producer == nil {
+		return 0, ErrReplayUnavailable
+	}
+
+	msgs, err := q.load(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, msg := range msgs {
+		payload, _ := msg.Values[deadLetterPayloadField].(string)
+		accessLog, err := DecodeAccessLog([]byte(payload))
+		if err != nil {
+			log.Warn().Err(err).Str("dead_letter_id", msg.ID).Msg("Skipping undecodable dead letter")
+			continue
+		}
+		if err := q.producer.SendAccessLog(ctx, accessLog); err != nil {
+			return replayed, fmt.Errorf("failed to replay dead letter %s: %w", msg.ID, err)
+		}
+		if err := q.client.XDel(ctx, q.stream, msg.ID).Err(); err != nil {
+			return replayed, fmt.Errorf("failed to remove dead letter %s: %w", msg.ID, err)
+		}
+		replayed++
+	}
+
+	log.Info().Int("replayed", replayed).Msg("Dead letters replayed")
+
+	return replayed, nil
+}
+
+// Delete discards the given dead letters, returning how many existed
+func (q *DeadLetterQueue) Delete(ctx context.Context, ids []string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	deleted, err := q.client.XDel(ctx, q.stream, ids...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete dead letters: %w", err)
+	}
+	return deleted, nil
+}
+
+// load reads the selected dead letters, or the oldest ones when none are selected
+func (q *DeadLetterQueue) load(ctx context.Context, ids []string) ([]redis.XMessage, error) {
+	if len(ids) == 0 {
+		msgs, err := q.client.XRangeN(ctx, q.stream, "-", "+", defaultReplayCount).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dead letters: %w", err)
+		}
+		return msgs, nil
+	}
+
+	var msgs []redis.XMessage
+	for _, id := range ids {
+		found, err := q.client.XRange(ctx, q.stream, id, id).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dead letter %s: %w", id, err)
+		}
+		msgs = append(msgs, found...)
+	}
+	return msgs, nil
+}
+
+// toDeadLetter converts a stream entry to a dead letter
+func toDeadLetter(msg redis.XMessage) *model.DeadLetter {
+	dl := &model.DeadLetter{ID: msg.ID}
+	dl.Payload, _ = msg.Values[deadLetterPayloadField].(string)
+	dl.Reason, _ = msg.Values[deadLetterReasonField].(string)
+	if attempts, ok := msg.Values[deadLetterAttemptsField].(string); ok {
+		dl.Attempts, _ = strconv.ParseInt(attempts, 10, 64)
+	}
+	if failedAt, ok := msg.Values[deadLetterFailedAtField].(string); ok {
+		if ms, err := strconv.ParseInt(failedAt, 10, 64); err == nil {
+			dl.FailedAt = time.UnixMilli(ms)
+		}
+	}
+	return dl
+}
+
+// deadLettering lets a consumer park payloads it cannot decode instead of dropping them
+type deadLettering struct {
+	dlq *DeadLetterQueue
+}
+
+// SetDeadLetterQueue sets the dead-letter queue receiving undecodable messages
+func (d *deadLettering) SetDeadLetterQueue(dlq *DeadLetterQueue) {
+	d.dlq = dlq
+}
+
+// deadLetter parks an undecodable payload, reporting whether it was stored
+func (d *deadLettering) deadLetter(ctx context.Context, payload []byte, cause error) bool {
+	if d.dlq == nil {
+		return false
+	}
+	if err := d.dlq.Add(ctx, payload, cause.Error(), 1); err != nil {
+		log.Error().Err(err).Msg("Failed to dead-letter malformed message")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,212 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replayProducer collects replayed messages
+type replayProducer struct {
+	sent []*AccessLogMessage
+	err  error
+}
+
+func (p *replayProducer) SendAccessLog(ctx context.Context, msg *AccessLogMessage) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.sent = append(p.sent, msg)
+	return nil
+}
+
+func (p *replayProducer) SendLinkEvent(ctx context.Context, msg *LinkEventMessage) error {
+	return p.err
+}
+
+func (p *replayProducer) Close() error {
+	return nil
+}
+
+func setupDeadLetterQueue(t *testing.T, producer ProducerInterface) (*miniredis.Miniredis, *redis.Client, *DeadLetterQueue) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return mr, client, NewDeadLetterQueue(client, producer, &config.DeadLetterConfig{
+		Stream:      "octopus:dlq:access_log",
+		MaxAttempts: 3,
+		AttemptTTL:  time.Hour,
+		MaxLen:      1000,
+	})
+}
+
+func TestDeadLetterQueue_Guard(t *testing.T) {
+	ctx := context.Background()
+	msg := &AccessLogMessage{ShortCode: "ABCD", AccessTime: time.Unix(1700000000, 0)}
+
+	t.Run("dead-letters after max attempts", func(t *testing.T) {
+		mr, _, q := setupDeadLetterQueue(t, nil)
+		calls := 0
+		handler := q.Guard(func(ctx context.Context, msg *AccessLogMessage) error {
+			calls++
+			return errors.New("db down")
+		})
+
+		assert.Error(t, handler(ctx, msg))
+		assert.Error(t, handler(ctx, msg))
+		assert.NoError(t, handler(ctx, msg), "the broker must stop redelivering")
+		assert.Equal(t, 3, calls)
+
+		page, err := q.List(ctx, "", 10)
+		require.NoError(t, err)
+		require.Len(t, page.DeadLetters, 1)
+		assert.Equal(t, "db down", page.DeadLetters[0].Reason)
+		assert.Equal(t, int64(3), page.DeadLetters[0].Attempts)
+		assert.False(t, page.DeadLetters[0].FailedAt.IsZero())
+
+		var parked AccessLogMessage
+		require.NoError(t, json.Unmarshal([]byte(page.DeadLetters[0].Payload), &parked))
+		assert.Equal(t, "ABCD", parked.ShortCode)
+
+		// The attempt counter is cleared
+		assert.False(t, mr.Exists("octopus:dlq:access_log:attempts:"+msg.DedupID()))
+	})
+
+	t.Run("success clears the attempts", func(t *testing.T) {
+		mr, _, q := setupDeadLetterQueue(t, nil)
+		fail := true
+		handler := q.Guard(func(ctx context.Context, msg *AccessLogMessage) error {
+			if fail {
+				return errors.New("db down")
+			}
+			return nil
+		})
+
+		assert.Error(t, handler(ctx, msg))
+		assert.True(t, mr.Exists("octopus:dlq:access_log:attempts:"+msg.DedupID()))
+		assert.Equal(t, time.Hour, mr.TTL("octopus:dlq:access_log:attempts:"+msg.DedupID()))
+
+		fail = false
+		assert.NoError(t, handler(ctx, msg))
+		assert.False(t, mr.Exists("octopus:dlq:access_log:attempts:"+msg.DedupID()))
+
+		depth, err := q.Depth(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), depth)
+	})
+
+	t.Run("redis errors leave retries to the broker", func(t *testing.T) {
+		mr, _, q := setupDeadLetterQueue(t, nil)
+		handler := q.Guard(func(ctx context.Context, msg *AccessLogMessage) error {
+			return errors.New("db down")
+		})
+		mr.SetError("LOADING")
+
+		for i := 0; i < 5; i++ {
+			assert.Error(t, handler(ctx, msg))
+		}
+	})
+}
+
+func TestDeadLetterQueue_List(t *testing.T) {
+	ctx := context.Background()
+	_, _, q := setupDeadLetterQueue(t, nil)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, q.Add(ctx, []byte("{"), "malformed", 1))
+	}
+
+	page, err := q.List(ctx, "", 2)
+	require.NoError(t, err)
+	assert.Len(t, page.DeadLetters, 2)
+	assert.Equal(t, int64(3), page.Depth)
+	require.NotEmpty(t, page.Next)
+
+	page, err = q.List(ctx, page.Next, 2)
+	require.NoError(t, err)
+	assert.Len(t, page.DeadLetters, 1)
+	assert.Empty(t, page.Next)
+}
+
+func TestDeadLetterQueue_Replay(t *testing.T) {
+	ctx := context.Background()
+	payload, _ := json.Marshal(&AccessLogMessage{ShortCode: "ABCD"})
+
+	t.Run("without producer", func(t *testing.T) {
+		_, _, q := setupDeadLetterQueue(t, nil)
+		_, err := q.Replay(ctx, nil)
+		assert.ErrorIs(t, err, ErrReplayUnavailable)
+	})
+
+	t.Run("replays the oldest and keeps undecodable ones", func(t *testing.T) {
+		producer := &replayProducer{}
+		_, _, q := setupDeadLetterQueue(t, producer)
+		require.NoError(t, q.Add(ctx, payload, "db down", 5))
+		require.NoError(t, q.Add(ctx, []byte("{"), "malformed", 1))
+
+		replayed, err := q.Replay(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 1, replayed)
+		require.Len(t, producer.sent, 1)
+		assert.Equal(t, "ABCD", producer.sent[0].ShortCode)
+
+		depth, err := q.Depth(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), depth)
+	})
+
+	t.Run("replays selected IDs", func(t *testing.T) {
+		producer := &replayProducer{}
+		_, _, q := setupDeadLetterQueue(t, producer)
+		require.NoError(t, q.Add(ctx, payload, "db down", 5))
+		require.NoError(t, q.Add(ctx, payload, "db down", 5))
+		page, err := q.List(ctx, "", 10)
+		require.NoError(t, err)
+
+		replayed, err := q.Replay(ctx, []string{page.DeadLetters[1].ID, "1-0"})
+		require.NoError(t, err)
+		assert.Equal(t, 1, replayed)
+
+		page, err = q.List(ctx, "", 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), page.Depth)
+	})
+
+	t.Run("send failure keeps the dead letter", func(t *testing.T) {
+		_, _, q := setupDeadLetterQueue(t, &replayProducer{err: errors.New("broker down")})
+		require.NoError(t, q.Add(ctx, payload, "db down", 5))
+
+		replayed, err := q.Replay(ctx, nil)
+		assert.Error(t, err)
+		assert.Equal(t, 0, replayed)
+
+		depth, err := q.Depth(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), depth)
+	})
+}
+
+func TestDeadLetterQueue_Delete(t *testing.T) {
+	ctx := context.Background()
+	_, _, q := setupDeadLetterQueue(t, nil)
+	require.NoError(t, q.Add(ctx, []byte("{"), "malformed", 1))
+	page, err := q.List(ctx, "", 10)
+	require.NoError(t, err)
+
+	deleted, err := q.Delete(ctx, []string{page.DeadLetters[0].ID})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	deleted, err = q.Delete(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), deleted)
+}
@@ -2,16 +2,30 @@ package mq
 
 import (
 	"context"
+
+	"octopus/internal/model"
 )
 
 // ProducerInterface defines the interface for message production
 type ProducerInterface interface {
 	SendAccessLog(ctx context.Context, msg *AccessLogMessage) error
+	SendLinkEvent(ctx context.Context, msg *LinkEventMessage) error
 	Close() error
 }
 
 // ConsumerInterface defines the interface for message consumption
 type ConsumerInterface interface {
 	Subscribe() error
+	SetDeadLetterQueue(dlq *DeadLetterQueue)
+	Status(ctx context.Context) *model.ConsumerStatus
+	Restart() error
 	Close() error
 }
+
+// DeadLetterQueueInterface defines the interface for inspecting and replaying dead letters
+type DeadLetterQueueInterface interface {
+	List(ctx context.Context, after string, count int64) (*model.DeadLetterPage, error)
+	Depth(ctx context.Context) (int64, error)
+	Replay(ctx context.Context, ids []string) (int, error)
+	Delete(ctx context.Context, ids []string) (int64, error)
+}
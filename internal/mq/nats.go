@@ -0,0 +1,375 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog/log"
+)
+
+// natsSetupTimeout bounds stream and consumer creation on startup
+const natsSetupTimeout = 10 * time.Second
+
+// NATSProducer handles message production to a NATS JetStream stream
+type NATSProducer struct {
+	conn        *nats.Conn
+	js          jetstream.JetStream
+	subject     string
+	linkSubject string
+	encoding
+}
+
+// NewNATSProducer creates a new NATS JetStream producer, creating the stream if needed
+func NewNATSProducer(cfg *config.NATSConfig) (*NATSProducer, error) {
+	nc, js, err := connectJetStream(cfg, "octopus-producer")
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("stream", cfg.Stream).Str("subject", cfg.Subject).Msg("NATS producer started")
+
+	return &NATSProducer{
+		conn:        nc,
+		js:          js,
+		subject:     cfg.Subject,
+		linkSubject: cfg.LinkSubject,
+	}, nil
+}
+
+// SendAccessLog publishes an access log message, deduplicated by its message ID
+func (p *NATSProducer) SendAccessLog(ctx context.Context, msg *AccessLogMessage) error {
+	if p == nil {
+		return nil // Producer disabled
+	}
+
+	bytes, err := p.encode(msg)
+	if err != nil {
+		return err
+	}
+
+	ack, err := p.js.Publish(ctx, p.subject, bytes, jetstream.WithMsgID(msg.DedupID()))
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+
+	log.Debug().
+		Uint64("seq", ack.Sequence).
+		Bool("duplicate", ack.Duplicate).
+		Str("short_code", msg.ShortCode).
+		Msg("Access log sent to NATS")
+
+	return nil
+}
+
+// SendLinkEvent publishes a link event to the link subject, deduplicated by its event ID
+func (p *NATSProducer) SendLinkEvent(ctx context.Context, msg *LinkEventMessage) error {
+	if p == nil {
+		return nil // Producer disabled
+	}
+
+	bytes, err := p.encodeLinkEvent(msg)
+	if err != nil {
+		return err
+	}
+
+	ack, err := p.js.Publish(ctx, p.linkSubject, bytes, jetstream.WithMsgID(msg.EventID))
+	if err != nil {
+		return fmt.Errorf("failed to publish link event: %w", err)
+	}
+
+	log.Debug().
+		Uint64("seq", ack.Sequence).
+		Str("type", msg.Type).
+		Str("short_code", msg.ShortCode).
+		Msg("Link event sent to NATS")
+
+	return nil
+}
+
+// Close closes the producer
+func (p *NATSProducer) Close() error {
+	if p != nil && p.conn != nil {
+		return p.conn.Drain()
+	}
+	return nil
+}
+
+// NATSConsumer handles message consumption from a durable NATS JetStream consumer
+type NATSConsumer struct {
+	conn        *nats.Conn
+	js          jetstream.JetStream
+	stream      string
+	consumer    jetstream.ConsumerConfig
+	handler     AccessLogHandler
+	linkHandler LinkEventHandler
+	cons        jetstream.Consumer
+	consumeCtx  jetstream.ConsumeContext
+	started     bool
+	deadLettering
+	consumerStats
+}
+
+// NewNATSConsumer creates a new NATS JetStream consumer
+func NewNATSConsumer(cfg *config.NATSConfig, handler AccessLogHandler) (*NATSConsumer, error) {
+	ackPolicy, err := parseAckPolicy(cfg.AckPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	nc, js, err := connectJetStream(cfg, "octopus-consumer")
+	if err != nil {
+		return nil, err
+	}
+
+	consumerCfg := jetstream.ConsumerConfig{
+		Durable:       cfg.Durable,
+		FilterSubject: cfg.Subject,
+		AckPolicy:     ackPolicy,
+		MaxDeliver:    cfg.MaxDeliver,
+	}
+	// Ack wait only applies when messages are acknowledged at all
+	if ackPolicy != jetstream.AckNonePolicy {
+		consumerCfg.AckWait = cfg.AckWait
+	}
+
+	return &NATSConsumer{
+		conn:     nc,
+		js:       js,
+		stream:   cfg.Stream,
+		consumer: consumerCfg,
+		handler:  handler,
+	}, nil
+}
+
+// NewNATSLinkConsumer creates a consumer of the link subject under its own durable name, so that it
+// sees every link event whatever other consumers read
+func NewNATSLinkConsumer(cfg *config.NATSConfig, durable string, handler LinkEventHandler) (*NATSConsumer, error) {
+	linkCfg := *cfg
+	linkCfg.Subject = cfg.LinkSubject
+	linkCfg.Durable = durable
+
+	c, err := NewNATSConsumer(&linkCfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.linkHandler = handler
+	return c, nil
+}
+
+// Subscribe creates or updates the durable consumer and starts consuming messages
+func (c *NATSConsumer) Subscribe() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subscribe()
+}
+
+// subscribe starts consuming unless the consumer already does
+func (c *NATSConsumer) subscribe() error {
+	if c.started {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsSetupTimeout)
+	defer cancel()
+
+	cons, err := c.js.CreateOrUpdateConsumer(ctx, c.stream, c.consumer)
+	if err != nil {
+		return fmt.Errorf("failed to create consumer: %w", err)
+	}
+
+	consumeCtx, err := cons.Consume(c.handle)
+	if err != nil {
+		return fmt.Errorf("failed to start consumer: %w", err)
+	}
+
+	c.cons = cons
+	c.consumeCtx = consumeCtx
+	c.started = true
+	log.Info().Str("stream", c.stream).Str("durable", c.consumer.Durable).Msg("NATS consumer started")
+
+	return nil
+}
+
+// handle processes one message and settles it according to the ack policy
+func (c *NATSConsumer) handle(msg jetstream.Msg) {
+	if c.linkHandler != nil {
+		c.handleLinkEvent(msg)
+		return
+	}
+
+	accessLog, err := DecodeAccessLog(msg.Data())
+	if errors.Is(err, ErrUnexpectedEventType) {
+		// Events of other types are not ours to process
+		c.settle(msg, msg.Ack)
+		return
+	}
+	if err != nil {
+		// Malformed messages never succeed, stop redelivering them
+		log.Error().Err(err).Str("subject", msg.Subject()).Msg("Failed to unmarshal message")
+		c.record(err)
+		c.deadLetter(context.Background(), msg.Data(), err)
+		c.settle(msg, msg.Term)
+		return
+	}
+
+	log.Debug().
+		Str("short_code", accessLog.ShortCode).
+		Msg("Processing access log")
+
+	if c.handler != nil {
+		if err := c.handler(context.Background(), accessLog); err != nil {
+			log.Error().Err(err).Str("short_code", accessLog.ShortCode).Msg("Handler failed")
+			c.record(err)
+			c.settle(msg, msg.Nak)
+			return
+		}
+	}
+
+	c.record(nil)
+	c.settle(msg, msg.Ack)
+}
+
+// handleLinkEvent processes one link event, redelivering it when it could not be applied
+func (c *NATSConsumer) handleLinkEvent(msg jetstream.Msg) {
+	event, err := DecodeLinkEvent(msg.Data())
+	if err != nil {
+		log.Error().Err(err).Str("subject", msg.Subject()).Msg("Failed to unmarshal link event")
+		c.record(err)
+		c.settle(msg, msg.Term)
+		return
+	}
+
+	log.Debug().
+		Str("type", event.Type).
+		Str("short_code", event.ShortCode).
+		Msg("Processing link event")
+
+	if err := c.linkHandler(context.Background(), event); err != nil {
+		log.Error().Err(err).Str("short_code", event.ShortCode).Msg("Link event handler failed")
+		c.record(err)
+		c.settle(msg, msg.Nak)
+		return
+	}
+
+	c.record(nil)
+	c.settle(msg, msg.Ack)
+}
+
+// settle acknowledges a message unless the consumer runs without acks
+func (c *NATSConsumer) settle(msg jetstream.Msg, ack func() error) {
+	if c.consumer.AckPolicy == jetstream.AckNonePolicy {
+		return
+	}
+	if err := ack(); err != nil {
+		log.Error().Err(err).Str("subject", msg.Subject()).Msg("Failed to acknowledge message")
+	}
+}
+
+// Status reports the state and counters of the consumer, with the messages of its subject not yet
+// delivered to the durable consumer as lag
+func (c *NATSConsumer) Status(ctx context.Context) *model.ConsumerStatus {
+	c.mu.Lock()
+	started, cons := c.started, c.cons
+	c.mu.Unlock()
+
+	var lag *int64
+	if cons != nil {
+		info, err := cons.Info(ctx)
+		if err != nil {
+			log.Warn().Err(err).Str("durable", c.consumer.Durable).Msg("Failed to get NATS consumer info")
+		} else {
+			pending := int64(info.NumPending)
+			lag = &pending
+		}
+	}
+	return c.status(DriverNATS, c.consumer.FilterSubject, c.consumer.Durable, started, lag)
+}
+
+// Restart stops consuming and starts again on the same connection, the durable consumer keeping
+// its position
+func (c *NATSConsumer) Restart() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stop()
+	return c.subscribe()
+}
+
+// stop stops delivering messages to the handler
+func (c *NATSConsumer) stop() {
+	if c.consumeCtx != nil {
+		c.consumeCtx.Stop()
+		c.consumeCtx = nil
+	}
+	c.started = false
+}
+
+// Close stops consuming and closes the connection
+func (c *NATSConsumer) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stop()
+	if c.conn != nil {
+		return c.conn.Drain()
+	}
+	return nil
+}
+
+// connectJetStream connects to NATS and makes sure the access log stream exists, capturing link
+// events too
+func connectJetStream(cfg *config.NATSConfig, name string) (*nats.Conn, jetstream.JetStream, error) {
+	nc, err := nats.Connect(cfg.URL, nats.Name(name))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsSetupTimeout)
+	defer cancel()
+
+	subjects := []string{cfg.Subject}
+	if cfg.LinkSubject != "" {
+		subjects = append(subjects, cfg.LinkSubject)
+	}
+
+	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:       cfg.Stream,
+		Subjects:   subjects,
+		Storage:    jetstream.FileStorage,
+		MaxAge:     cfg.MaxAge,
+		Duplicates: cfg.DedupWindow,
+	})
+	if err != nil {
+		nc.Close()
+		return nil, nil, fmt.Errorf("failed to create stream: %w", err)
+	}
+
+	return nc, js, nil
+}
+
+// parseAckPolicy maps the configured ack policy to JetStream
+func parseAckPolicy(policy string) (jetstream.AckPolicy, error) {
+	switch policy {
+	case "", "explicit":
+		return jetstream.AckExplicitPolicy, nil
+	case "all":
+		return jetstream.AckAllPolicy, nil
+	case "none":
+		return jetstream.AckNonePolicy, nil
+	}
+	return 0, fmt.Errorf("unknown NATS ack policy %q", policy)
+}
@@ -0,0 +1,280 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeJetStream records publishes and hands out a fake consumer
+type fakeJetStream struct {
+	jetstream.JetStream
+	subject  string
+	data     []byte
+	opts     int
+	consumer *fakeConsumer
+	cfg      jetstream.ConsumerConfig
+	err      error
+}
+
+func (js *fakeJetStream) Publish(ctx context.Context, subject string, payload []byte, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	if js.err != nil {
+		return nil, js.err
+	}
+	js.subject = subject
+	js.data = payload
+	js.opts = len(opts)
+	return &jetstream.PubAck{Stream: "ACCESS_LOG", Sequence: 1}, nil
+}
+
+func (js *fakeJetStream) CreateOrUpdateConsumer(ctx context.Context, stream string, cfg jetstream.ConsumerConfig) (jetstream.Consumer, error) {
+	if js.err != nil {
+		return nil, js.err
+	}
+	js.cfg = cfg
+	return js.consumer, nil
+}
+
+// fakeConsumer keeps the message handler so tests can deliver messages
+type fakeConsumer struct {
+	jetstream.Consumer
+	handler jetstream.MessageHandler
+	stopped bool
+	pending uint64
+}
+
+func (c *fakeConsumer) Info(ctx context.Context) (*jetstream.ConsumerInfo, error) {
+	return &jetstream.ConsumerInfo{NumPending: c.pending}, nil
+}
+
+func (c *fakeConsumer) Consume(handler jetstream.MessageHandler, opts ...jetstream.PullConsumeOpt) (jetstream.ConsumeContext, error) {
+	c.handler = handler
+	return &fakeConsumeContext{consumer: c}, nil
+}
+
+type fakeConsumeContext struct {
+	jetstream.ConsumeContext
+	consumer *fakeConsumer
+}
+
+func (cc *fakeConsumeContext) Stop() {
+	cc.consumer.stopped = true
+}
+
+// fakeMsg records how a message was settled
+type fakeMsg struct {
+	jetstream.Msg
+	data    []byte
+	settled string
+}
+
+func (m *fakeMsg) Data() []byte    { return m.data }
+func (m *fakeMsg) Subject() string { return "octopus.access_log" }
+func (m *fakeMsg) Ack() error      { m.settled = "ack"; return nil }
+func (m *fakeMsg) Nak() error      { m.settled = "nak"; return nil }
+func (m *fakeMsg) Term() error     { m.settled = "term"; return nil }
+
+func TestNATSProducer_SendAccessLog(t *testing.T) {
+	msg := &AccessLogMessage{
+		ShortCode:  "ABCD",
+		ClientIP:   "192.168.1.1",
+		AccessTime: time.Unix(1700000000, 0),
+	}
+
+	t.Run("nil producer returns nil", func(t *testing.T) {
+		var p *NATSProducer
+		assert.NoError(t, p.SendAccessLog(context.Background(), msg))
+		assert.NoError(t, p.Close())
+	})
+
+	t.Run("publishes JSON to the subject", func(t *testing.T) {
+		js := &fakeJetStream{}
+		p := &NATSProducer{js: js, subject: "octopus.access_log"}
+
+		require.NoError(t, p.SendAccessLog(context.Background(), msg))
+		assert.Equal(t, "octopus.access_log", js.subject)
+		assert.Equal(t, 1, js.opts, "publish must carry the dedup message ID")
+
+		var sent AccessLogMessage
+		require.NoError(t, json.Unmarshal(js.data, &sent))
+		assert.Equal(t, "ABCD", sent.ShortCode)
+	})
+
+	t.Run("publish error is returned", func(t *testing.T) {
+		p := &NATSProducer{js: &fakeJetStream{err: errors.New("no responders")}, subject: "octopus.access_log"}
+		assert.Error(t, p.SendAccessLog(context.Background(), msg))
+	})
+}
+
+func TestNATSConsumer_Subscribe(t *testing.T) {
+	t.Run("subscribe when already started returns nil", func(t *testing.T) {
+		c := &NATSConsumer{started: true}
+		assert.NoError(t, c.Subscribe())
+	})
+
+	t.Run("creates the durable consumer and stops on close", func(t *testing.T) {
+		cons := &fakeConsumer{}
+		js := &fakeJetStream{consumer: cons}
+		c := &NATSConsumer{
+			js:       js,
+			stream:   "ACCESS_LOG",
+			consumer: jetstream.ConsumerConfig{Durable: "shortlink_consumer", AckPolicy: jetstream.AckExplicitPolicy},
+		}
+
+		require.NoError(t, c.Subscribe())
+		assert.Equal(t, "shortlink_consumer", js.cfg.Durable)
+		assert.NotNil(t, cons.handler)
+
+		require.NoError(t, c.Close())
+		assert.True(t, cons.stopped)
+	})
+
+	t.Run("consumer creation error is returned", func(t *testing.T) {
+		c := &NATSConsumer{js: &fakeJetStream{err: errors.New("stream not found")}, stream: "ACCESS_LOG"}
+		assert.Error(t, c.Subscribe())
+		assert.False(t, c.started)
+	})
+}
+
+func TestNATSConsumer_StatusAndRestart(t *testing.T) {
+	cons := &fakeConsumer{pending: 7}
+	c := &NATSConsumer{
+		js:       &fakeJetStream{consumer: cons},
+		stream:   "ACCESS_LOG",
+		consumer: jetstream.ConsumerConfig{Durable: "shortlink_consumer", FilterSubject: "octopus.access_log"},
+		handler:  func(ctx context.Context, msg *AccessLogMessage) error { return nil },
+	}
+
+	// Lag is only known once the durable consumer exists
+	status := c.Status(context.Background())
+	assert.Equal(t, ConsumerStopped, status.Status)
+	assert.Nil(t, status.Lag)
+
+	require.NoError(t, c.Subscribe())
+	cons.handler(&fakeMsg{data: []byte(`{"short_code":"ABCD"}`)})
+	cons.handler(&fakeMsg{data: []byte("{")})
+
+	status = c.Status(context.Background())
+	assert.Equal(t, DriverNATS, status.Driver)
+	assert.Equal(t, "octopus.access_log", status.Topic)
+	assert.Equal(t, "shortlink_consumer", status.Group)
+	assert.Equal(t, ConsumerStarted, status.Status)
+	assert.Equal(t, int64(1), status.Processed)
+	assert.Equal(t, int64(1), status.Errors)
+	require.NotNil(t, status.Lag)
+	assert.Equal(t, int64(7), *status.Lag)
+
+	// Restarts consume again on the same connection
+	cons.handler = nil
+	require.NoError(t, c.Restart())
+	assert.True(t, cons.stopped)
+	assert.NotNil(t, cons.handler)
+	assert.Equal(t, ConsumerStarted, c.Status(context.Background()).Status)
+}
+
+func TestNATSConsumer_handle(t *testing.T) {
+	valid, _ := json.Marshal(&AccessLogMessage{ShortCode: "ABCD"})
+
+	tests := []struct {
+		name       string
+		ackPolicy  jetstream.AckPolicy
+		data       []byte
+		handlerErr error
+		expected   string
+	}{
+		{name: "ack on success", ackPolicy: jetstream.AckExplicitPolicy, data: valid, expected: "ack"},
+		{name: "nak on handler failure", ackPolicy: jetstream.AckExplicitPolicy, data: valid, handlerErr: errors.New("db down"), expected: "nak"},
+		{name: "term on malformed message", ackPolicy: jetstream.AckExplicitPolicy, data: []byte("{"), expected: "term"},
+		{name: "ack all policy acks", ackPolicy: jetstream.AckAllPolicy, data: valid, expected: "ack"},
+		{name: "no acks without ack policy", ackPolicy: jetstream.AckNonePolicy, data: valid, handlerErr: errors.New("db down"), expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handled *AccessLogMessage
+			c := &NATSConsumer{
+				consumer: jetstream.ConsumerConfig{AckPolicy: tt.ackPolicy},
+				handler: func(ctx context.Context, msg *AccessLogMessage) error {
+					handled = msg
+					return tt.handlerErr
+				},
+			}
+
+			msg := &fakeMsg{data: tt.data}
+			c.handle(msg)
+
+			assert.Equal(t, tt.expected, msg.settled)
+			if tt.expected != "term" {
+				require.NotNil(t, handled)
+				assert.Equal(t, "ABCD", handled.ShortCode)
+			}
+		})
+	}
+}
+
+func TestNATSConsumer_handleLinkEvent(t *testing.T) {
+	codec, _ := NewCodec(EncodingJSON)
+	valid, _ := codec.EncodeLinkEvent(&LinkEventMessage{Type: EventTypeLinkCreated, ShortCode: "ABCD"})
+
+	tests := []struct {
+		name       string
+		data       []byte
+		handlerErr error
+		expected   string
+	}{
+		{name: "ack on success", data: valid, expected: "ack"},
+		{name: "nak on handler failure", data: valid, handlerErr: errors.New("db down"), expected: "nak"},
+		{name: "term on malformed message", data: []byte("{"), expected: "term"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handled *LinkEventMessage
+			c := &NATSConsumer{
+				consumer: jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy},
+				linkHandler: func(ctx context.Context, msg *LinkEventMessage) error {
+					handled = msg
+					return tt.handlerErr
+				},
+			}
+
+			msg := &fakeMsg{data: tt.data}
+			c.handle(msg)
+
+			assert.Equal(t, tt.expected, msg.settled)
+			if tt.expected != "term" {
+				require.NotNil(t, handled)
+				assert.Equal(t, "ABCD", handled.ShortCode)
+			}
+		})
+	}
+}
+
+func TestNATSConsumer_Close(t *testing.T) {
+	var c *NATSConsumer
+	assert.NoError(t, c.Close())
+	assert.NoError(t, (&NATSConsumer{}).Close())
+}
+
+func TestParseAckPolicy(t *testing.T) {
+	tests := map[string]jetstream.AckPolicy{
+		"":         jetstream.AckExplicitPolicy,
+		"explicit": jetstream.AckExplicitPolicy,
+		"all":      jetstream.AckAllPolicy,
+		"none":     jetstream.AckNonePolicy,
+	}
+	for policy, expected := range tests {
+		got, err := parseAckPolicy(policy)
+		require.NoError(t, err, policy)
+		assert.Equal(t, expected, got, policy)
+	}
+
+	_, err := parseAckPolicy("sometimes")
+	assert.Error(t, err)
+}
@@ -3,7 +3,10 @@ package mq
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
 
 	"octopus/internal/config"
 
@@ -13,19 +16,85 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-// Producer handles message production to RocketMQ
+// Producer handles message production to RocketMQ, access logs, link events and alerts each going
+// to their topic through a client with the producer settings of that topic
 type Producer struct {
-	client rocketmq.Producer
+	clients    []rocketmq.Producer
+	accessLog  topicRoute
+	linkEvents topicRoute
+	alerts     topicRoute
+	encoding
+}
+
+// topicRoute is the topic of a kind of message and the client sending to it
+type topicRoute struct {
 	topic  string
+	client rocketmq.Producer
 }
 
-// NewProducer creates a new RocketMQ producer
+// NewProducer creates a new RocketMQ producer, with one client per distinct producer settings of
+// the topics
 func NewProducer(cfg *config.RocketMQConfig) (*Producer, error) {
-	p, err := rocketmq.NewProducer(
+	p, err := newProducer(cfg, startProducer)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("topic", p.accessLog.topic).
+		Str("link_topic", p.linkEvents.topic).
+		Str("alert_topic", p.alerts.topic).
+		Msg("RocketMQ producer started")
+
+	return p, nil
+}
+
+// newProducer routes every kind of message to its topic, starting a client with start for each
+// distinct producer settings
+func newProducer(cfg *config.RocketMQConfig, start func(cfg *config.RocketMQConfig, topic *config.RocketMQTopicConfig, instance int) (rocketmq.Producer, error)) (*Producer, error) {
+	p := &Producer{}
+	routes := []struct {
+		route *topicRoute
+		topic *config.RocketMQTopicConfig
+	}{
+		{&p.accessLog, &cfg.Topics.AccessLog},
+		{&p.linkEvents, &cfg.Topics.LinkEvents},
+		{&p.alerts, &cfg.Topics.Alerts},
+	}
+
+	clients := make(map[config.RocketMQTopicConfig]rocketmq.Producer)
+	for _, r := range routes {
+		settings := *r.topic
+		settings.Name = ""
+		client, ok := clients[settings]
+		if !ok {
+			var err error
+			if client, err = start(cfg, &settings, len(p.clients)); err != nil {
+				_ = p.Close()
+				return nil, err
+			}
+			clients[settings] = client
+			p.clients = append(p.clients, client)
+		}
+		*r.route = topicRoute{topic: cfg.TopicName(r.topic), client: client}
+	}
+	return p, nil
+}
+
+// startProducer starts a RocketMQ client with the producer settings of a topic. Clients of the
+// process share the producer group, they need instance names of their own to register in it.
+func startProducer(cfg *config.RocketMQConfig, topic *config.RocketMQTopicConfig, instance int) (rocketmq.Producer, error) {
+	opts := []producer.Option{
 		producer.WithNameServer([]string{cfg.NameServer}),
-		producer.WithRetry(3),
-		producer.WithGroupName(cfg.Group+"_producer"),
-	)
+		producer.WithRetry(topic.Retries),
+		producer.WithGroupName(cfg.Group + "_producer"),
+		producer.WithInstanceName(strconv.Itoa(os.Getpid()) + "#" + strconv.Itoa(instance)),
+	}
+	if topic.SendTimeout > 0 {
+		opts = append(opts, producer.WithSendMsgTimeout(topic.SendTimeout))
+	}
+
+	p, err := rocketmq.NewProducer(opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create RocketMQ producer: %w", err)
 	}
@@ -33,13 +102,7 @@ func NewProducer(cfg *config.RocketMQConfig) (*Producer, error) {
 	if err := p.Start(); err != nil {
 		return nil, fmt.Errorf("failed to start RocketMQ producer: %w", err)
 	}
-
-	log.Info().Str("topic", cfg.Topic).Msg("RocketMQ producer started")
-
-	return &Producer{
-		client: p,
-		topic:  cfg.Topic,
-	}, nil
+	return p, nil
 }
 
 // SendAccessLog sends an access log message to RocketMQ
@@ -48,16 +111,16 @@ func (p *Producer) SendAccessLog(ctx context.Context, msg *AccessLogMessage) err
 		return nil // Producer disabled
 	}
 
-	bytes, err := json.Marshal(msg)
+	bytes, err := p.encode(msg)
 	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+		return err
 	}
 
-	m := primitive.NewMessage(p.topic, bytes)
-	m.WithTag("access_log")
+	m := primitive.NewMessage(p.accessLog.topic, bytes)
+	m.WithTag(EventTypeAccessLog)
 	m.WithKeys([]string{msg.ShortCode})
 
-	result, err := p.client.SendSync(ctx, m)
+	result, err := p.accessLog.client.SendSync(ctx, m)
 	if err != nil {
 		return fmt.Errorf("failed to send message: %w", err)
 	}
@@ -70,10 +133,74 @@ func (p *Producer) SendAccessLog(ctx context.Context, msg *AccessLogMessage) err
 	return nil
 }
 
+// SendLinkEvent sends a link event to RocketMQ, tagged with its type so that the access log
+// consumers never see it
+func (p *Producer) SendLinkEvent(ctx context.Context, msg *LinkEventMessage) error {
+	if p == nil {
+		return nil // Producer disabled
+	}
+
+	bytes, err := p.encodeLinkEvent(msg)
+	if err != nil {
+		return err
+	}
+
+	m := primitive.NewMessage(p.linkEvents.topic, bytes)
+	m.WithTag(msg.Type)
+	m.WithKeys([]string{msg.ShortCode})
+
+	result, err := p.linkEvents.client.SendSync(ctx, m)
+	if err != nil {
+		return fmt.Errorf("failed to send link event: %w", err)
+	}
+
+	log.Debug().
+		Str("msg_id", result.MsgID).
+		Str("type", msg.Type).
+		Str("short_code", msg.ShortCode).
+		Msg("Link event sent to RocketMQ")
+
+	return nil
+}
+
+// SendAlert sends an operational alert to RocketMQ as JSON, keyed by its name
+func (p *Producer) SendAlert(ctx context.Context, msg *AlertMessage) error {
+	if p == nil {
+		return nil // Producer disabled
+	}
+
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+
+	m := primitive.NewMessage(p.alerts.topic, bytes)
+	m.WithTag(EventTypeAlert)
+	m.WithKeys([]string{msg.Name})
+
+	result, err := p.alerts.client.SendSync(ctx, m)
+	if err != nil {
+		return fmt.Errorf("failed to send alert: %w", err)
+	}
+
+	log.Debug().
+		Str("msg_id", result.MsgID).
+		Str("name", msg.Name).
+		Msg("Alert sent to RocketMQ")
+
+	return nil
+}
+
 // Close closes the producer
 func (p *Producer) Close() error {
-	if p != nil && p.client != nil {
-		return p.client.Shutdown()
+	if p == nil {
+		return nil
 	}
-	return nil
+	var errs []error
+	for _, client := range p.clients {
+		if err := client.Shutdown(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
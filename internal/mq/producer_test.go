@@ -3,10 +3,16 @@ package mq
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 
+	"octopus/internal/config"
+
+	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestProducer_SendAccessLog_NilProducer(t *testing.T) {
@@ -66,3 +72,101 @@ func TestAccessLogMessage(t *testing.T) {
 		assert.NotEmpty(t, data)
 	})
 }
+
+func TestAccessLogMessage_DedupID(t *testing.T) {
+	now := time.Now()
+	msg := &AccessLogMessage{ShortCode: "ABCD", ClientIP: "192.168.1.1", AccessTime: now}
+
+	same := *msg
+	assert.Equal(t, msg.DedupID(), same.DedupID())
+
+	later := *msg
+	later.AccessTime = now.Add(time.Nanosecond)
+	assert.NotEqual(t, msg.DedupID(), later.DedupID())
+
+	other := *msg
+	other.ShortCode = "ABCE"
+	assert.NotEqual(t, msg.DedupID(), other.DedupID())
+
+	// Event IDs take precedence, two identical accesses stay distinct events
+	first, second := *msg, *msg
+	first.EventID, second.EventID = "e1", "e2"
+	assert.Equal(t, "e1", first.DedupID())
+	assert.NotEqual(t, first.DedupID(), second.DedupID())
+}
+
+// fakeRocketMQProducer records the messages sent through it
+type fakeRocketMQProducer struct {
+	rocketmq.Producer
+	sent     []*primitive.Message
+	shutdown bool
+}
+
+func (p *fakeRocketMQProducer) SendSync(ctx context.Context, msgs ...*primitive.Message) (*primitive.SendResult, error) {
+	p.sent = append(p.sent, msgs...)
+	return &primitive.SendResult{MsgID: "1"}, nil
+}
+
+func (p *fakeRocketMQProducer) Shutdown() error {
+	p.shutdown = true
+	return nil
+}
+
+func TestProducer_Topics(t *testing.T) {
+	cfg := &config.RocketMQConfig{
+		Topic: "octopus",
+		Topics: config.RocketMQTopicsConfig{
+			AccessLog:  config.RocketMQTopicConfig{Retries: 3, SendTimeout: 3 * time.Second},
+			LinkEvents: config.RocketMQTopicConfig{Name: "link_events", Retries: 3, SendTimeout: 3 * time.Second},
+			Alerts:     config.RocketMQTopicConfig{Name: "alerts", Retries: 0, SendTimeout: time.Second},
+		},
+	}
+
+	var clients []*fakeRocketMQProducer
+	p, err := newProducer(cfg, func(_ *config.RocketMQConfig, topic *config.RocketMQTopicConfig, instance int) (rocketmq.Producer, error) {
+		assert.Equal(t, len(clients), instance)
+		client := &fakeRocketMQProducer{}
+		clients = append(clients, client)
+		return client, nil
+	})
+	require.NoError(t, err)
+	// Topics with the same producer settings share a client
+	require.Len(t, clients, 2)
+
+	ctx := context.Background()
+	require.NoError(t, p.SendAccessLog(ctx, &AccessLogMessage{ShortCode: "ABCD"}))
+	require.NoError(t, p.SendLinkEvent(ctx, &LinkEventMessage{Type: EventTypeLinkCreated, ShortCode: "ABCD"}))
+	require.NoError(t, p.SendAlert(ctx, &AlertMessage{Name: "redis_down", Severity: "critical"}))
+
+	require.Len(t, clients[0].sent, 2)
+	assert.Equal(t, "octopus", clients[0].sent[0].Topic)
+	assert.Equal(t, EventTypeAccessLog, clients[0].sent[0].GetTags())
+	assert.Equal(t, "link_events", clients[0].sent[1].Topic)
+	assert.Equal(t, EventTypeLinkCreated, clients[0].sent[1].GetTags())
+	require.Len(t, clients[1].sent, 1)
+	assert.Equal(t, "alerts", clients[1].sent[0].Topic)
+	assert.Equal(t, EventTypeAlert, clients[1].sent[0].GetTags())
+
+	var alert AlertMessage
+	require.NoError(t, json.Unmarshal(clients[1].sent[0].Body, &alert))
+	assert.Equal(t, "redis_down", alert.Name)
+
+	require.NoError(t, p.Close())
+	assert.True(t, clients[0].shutdown)
+	assert.True(t, clients[1].shutdown)
+}
+
+func TestProducer_TopicsStartError(t *testing.T) {
+	cfg := &config.RocketMQConfig{Topics: config.RocketMQTopicsConfig{Alerts: config.RocketMQTopicConfig{Retries: 1}}}
+
+	started := &fakeRocketMQProducer{}
+	_, err := newProducer(cfg, func(_ *config.RocketMQConfig, topic *config.RocketMQTopicConfig, _ int) (rocketmq.Producer, error) {
+		if topic.Retries == 1 {
+			return nil, errors.New("no route info")
+		}
+		return started, nil
+	})
+	assert.Error(t, err)
+	// Clients started before the failure are shut down
+	assert.True(t, started.shutdown)
+}
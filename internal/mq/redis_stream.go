@@ -0,0 +1,447 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/pkg/async"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// redisStreamDataField is the stream entry field carrying the encoded event
+const redisStreamDataField = "data"
+
+// RedisStreamProducer handles message production to a Redis stream
+type RedisStreamProducer struct {
+	client     redis.Cmdable
+	stream     string
+	linkStream string
+	maxLen     int64
+	encoding
+}
+
+// NewRedisStreamProducer creates a new Redis Streams producer on an existing Redis client
+func NewRedisStreamProducer(client redis.Cmdable, cfg *config.RedisStreamConfig) *RedisStreamProducer {
+	log.Info().Str("stream", cfg.Stream).Msg("Redis Streams producer started")
+
+	return &RedisStreamProducer{
+		client:     client,
+		stream:     cfg.Stream,
+		linkStream: cfg.LinkStream,
+		maxLen:     cfg.MaxLen,
+	}
+}
+
+// SendAccessLog appends an access log message to the stream, trimming it to roughly its max length
+func (p *RedisStreamProducer) SendAccessLog(ctx context.Context, msg *AccessLogMessage) error {
+	if p == nil {
+		return nil // Producer disabled
+	}
+
+	bytes, err := p.encode(msg)
+	if err != nil {
+		return err
+	}
+
+	id, err := p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.stream,
+		MaxLen: p.maxLen,
+		Approx: p.maxLen > 0,
+		Values: map[string]interface{}{redisStreamDataField: bytes},
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to add message to stream: %w", err)
+	}
+
+	log.Debug().
+		Str("msg_id", id).
+		Str("short_code", msg.ShortCode).
+		Msg("Access log sent to Redis stream")
+
+	return nil
+}
+
+// SendLinkEvent appends a link event to the link stream, trimmed like the access log stream
+func (p *RedisStreamProducer) SendLinkEvent(ctx context.Context, msg *LinkEventMessage) error {
+	if p == nil {
+		return nil // Producer disabled
+	}
+
+	bytes, err := p.encodeLinkEvent(msg)
+	if err != nil {
+		return err
+	}
+
+	id, err := p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.linkStream,
+		MaxLen: p.maxLen,
+		Approx: p.maxLen > 0,
+		Values: map[string]interface{}{redisStreamDataField: bytes},
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to add link event to stream: %w", err)
+	}
+
+	log.Debug().
+		Str("msg_id", id).
+		Str("type", msg.Type).
+		Str("short_code", msg.ShortCode).
+		Msg("Link event sent to Redis stream")
+
+	return nil
+}
+
+// Close closes the producer, the Redis client is owned by the caller
+func (p *RedisStreamProducer) Close() error {
+	return nil
+}
+
+// RedisStreamConsumer handles message consumption from a Redis stream consumer group
+type RedisStreamConsumer struct {
+	client        redis.Cmdable
+	stream        string
+	group         string
+	consumer      string
+	deadStream    string
+	batchSize     int64
+	block         time.Duration
+	claimMinIdle  time.Duration
+	claimInterval time.Duration
+	maxDeliver    int64
+	handler       AccessLogHandler
+	linkHandler   LinkEventHandler
+	cancel        context.CancelFunc
+	done          chan struct{}
+	started       bool
+	deadLettering
+	consumerStats
+}
+
+// NewRedisStreamConsumer creates a new Redis Streams consumer on an existing Redis client
+func NewRedisStreamConsumer(client redis.Cmdable, cfg *config.RedisStreamConfig, handler AccessLogHandler) *RedisStreamConsumer {
+	// Every instance needs its own name within the group to own pending entries
+	consumer := cfg.Consumer
+	if consumer == "" {
+		hostname, _ := os.Hostname()
+		consumer = hostname + "-" + strconv.Itoa(os.Getpid())
+	}
+
+	return &RedisStreamConsumer{
+		client:        client,
+		stream:        cfg.Stream,
+		group:         cfg.Group,
+		consumer:      consumer,
+		deadStream:    cfg.Stream + ":dead",
+		batchSize:     cfg.BatchSize,
+		block:         cfg.Block,
+		claimMinIdle:  cfg.ClaimMinIdle,
+		claimInterval: cfg.ClaimInterval,
+		maxDeliver:    cfg.MaxDeliver,
+		handler:       handler,
+	}
+}
+
+// NewRedisStreamLinkConsumer creates a consumer of the link stream in its own group, so that it
+// sees every link event whatever other groups consume
+func NewRedisStreamLinkConsumer(client redis.Cmdable, cfg *config.RedisStreamConfig, group string, handler LinkEventHandler) *RedisStreamConsumer {
+	linkCfg := *cfg
+	linkCfg.Stream = cfg.LinkStream
+	linkCfg.Group = group
+
+	c := NewRedisStreamConsumer(client, &linkCfg, nil)
+	c.linkHandler = handler
+	return c
+}
+
+// Subscribe creates the consumer group if needed and starts consuming in the background
+func (c *RedisStreamConsumer) Subscribe() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subscribe()
+}
+
+// subscribe starts the consuming loop unless it runs
+func (c *RedisStreamConsumer) subscribe() error {
+	if c.started {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Start at the beginning so entries added before the group existed are processed too
+	err := c.client.XGroupCreateMkStream(ctx, c.stream, c.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		cancel()
+		return fmt.Errorf("failed to create consumer group: %w", err)
+	}
+
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	c.started = true
+
+	async.Go(func() { c.run(ctx) })
+
+	log.Info().
+		Str("stream", c.stream).
+		Str("group", c.group).
+		Str("consumer", c.consumer).
+		Msg("Redis Streams consumer started")
+
+	return nil
+}
+
+// run reads new entries and periodically reclaims entries left pending by failed consumers
+func (c *RedisStreamConsumer) run(ctx context.Context) {
+	defer close(c.done)
+
+	var lastClaim time.Time
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) >= c.claimInterval {
+			if err := c.reclaim(ctx); err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Str("stream", c.stream).Msg("Failed to reclaim pending messages")
+			}
+			lastClaim = time.Now()
+		}
+
+		if err := c.read(ctx); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Str("stream", c.stream).Msg("Failed to read from Redis stream")
+			// Back off instead of hammering an unavailable Redis
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+// read processes the next batch of entries never delivered to the group
+func (c *RedisStreamConsumer) read(ctx context.Context) error {
+	streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    c.group,
+		Consumer: c.consumer,
+		Streams:  []string{c.stream, ">"},
+		Count:    c.batchSize,
+		Block:    c.block,
+	}).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			c.process(ctx, msg)
+		}
+	}
+	return nil
+}
+
+// reclaim takes over entries pending longer than the min idle time, dead-lettering those
+// delivered too often
+func (c *RedisStreamConsumer) reclaim(ctx context.Context) error {
+	pending, err := c.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: c.stream,
+		Group:  c.group,
+		Idle:   c.claimMinIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  c.batchSize,
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list pending messages: %w", err)
+	}
+
+	var ids []string
+	for _, p := range pending {
+		if c.maxDeliver > 0 && p.RetryCount >= c.maxDeliver {
+			if err := c.bury(ctx, p.ID, p.RetryCount); err != nil {
+				return err
+			}
+			continue
+		}
+		ids = append(ids, p.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	msgs, err := c.client.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   c.stream,
+		Group:    c.group,
+		Consumer: c.consumer,
+		MinIdle:  c.claimMinIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to claim pending messages: %w", err)
+	}
+
+	log.Debug().Int("claimed", len(msgs)).Str("stream", c.stream).Msg("Reclaimed pending messages")
+
+	for _, msg := range msgs {
+		c.process(ctx, msg)
+	}
+	return nil
+}
+
+// bury moves an entry that keeps failing to the dead-letter queue, or the driver's own dead-letter
+// stream without one, and acknowledges it
+func (c *RedisStreamConsumer) bury(ctx context.Context, id string, deliveries int64) error {
+	msgs, err := c.client.XRange(ctx, c.stream, id, id).Result()
+	if err != nil {
+		return fmt.Errorf("failed to read pending message: %w", err)
+	}
+
+	// Entries trimmed from the stream meanwhile only need their pending entry cleared
+	if len(msgs) > 0 && c.dlq != nil {
+		data, _ := msgs[0].Values[redisStreamDataField].(string)
+		if err := c.dlq.Add(ctx, []byte(data), "exceeded max deliveries", deliveries); err != nil {
+			return err
+		}
+	} else if len(msgs) > 0 {
+		values := msgs[0].Values
+		values["source_id"] = id
+		if err := c.client.XAdd(ctx, &redis.XAddArgs{Stream: c.deadStream, Values: values}).Err(); err != nil {
+			return fmt.Errorf("failed to dead-letter message: %w", err)
+		}
+	}
+
+	log.Warn().Str("msg_id", id).Int64("deliveries", deliveries).Msg("Message exceeded max deliveries")
+
+	return c.client.XAck(ctx, c.stream, c.group, id).Err()
+}
+
+// process handles one entry, acknowledging it unless the handler failed so it can be reclaimed
+func (c *RedisStreamConsumer) process(ctx context.Context, msg redis.XMessage) {
+	data, _ := msg.Values[redisStreamDataField].(string)
+	if c.linkHandler != nil {
+		c.processLinkEvent(ctx, msg.ID, []byte(data))
+		return
+	}
+
+	accessLog, err := DecodeAccessLog([]byte(data))
+	if errors.Is(err, ErrUnexpectedEventType) {
+		c.ack(ctx, msg.ID)
+		return
+	}
+	if err != nil {
+		// Malformed entries never succeed, drop them instead of redelivering
+		log.Error().Err(err).Str("msg_id", msg.ID).Msg("Failed to unmarshal message")
+		c.record(err)
+		c.deadLetter(ctx, []byte(data), err)
+		c.ack(ctx, msg.ID)
+		return
+	}
+
+	log.Debug().
+		Str("msg_id", msg.ID).
+		Str("short_code", accessLog.ShortCode).
+		Msg("Processing access log")
+
+	if c.handler != nil {
+		if err := c.handler(ctx, accessLog); err != nil {
+			log.Error().Err(err).Str("msg_id", msg.ID).Msg("Handler failed")
+			c.record(err)
+			return
+		}
+	}
+
+	c.record(nil)
+	c.ack(ctx, msg.ID)
+}
+
+// processLinkEvent handles one link event. Events that cannot be decoded or applied stay pending,
+// so they are dead-lettered once delivered too often instead of being lost.
+func (c *RedisStreamConsumer) processLinkEvent(ctx context.Context, id string, data []byte) {
+	event, err := DecodeLinkEvent(data)
+	if err != nil {
+		log.Error().Err(err).Str("msg_id", id).Msg("Failed to unmarshal link event")
+		c.record(err)
+		return
+	}
+
+	log.Debug().
+		Str("msg_id", id).
+		Str("type", event.Type).
+		Str("short_code", event.ShortCode).
+		Msg("Processing link event")
+
+	if err := c.linkHandler(ctx, event); err != nil {
+		log.Error().Err(err).Str("msg_id", id).Msg("Link event handler failed")
+		c.record(err)
+		return
+	}
+
+	c.record(nil)
+	c.ack(ctx, id)
+}
+
+// ack acknowledges an entry, removing it from the pending entries list
+func (c *RedisStreamConsumer) ack(ctx context.Context, id string) {
+	if err := c.client.XAck(ctx, c.stream, c.group, id).Err(); err != nil {
+		log.Error().Err(err).Str("msg_id", id).Msg("Failed to acknowledge message")
+	}
+}
+
+// Status reports the state and counters of the consumer, with the entries of the stream not yet
+// delivered to its group as lag
+func (c *RedisStreamConsumer) Status(ctx context.Context) *model.ConsumerStatus {
+	c.mu.Lock()
+	started := c.started
+	c.mu.Unlock()
+
+	var lag *int64
+	groups, err := c.client.XInfoGroups(ctx, c.stream).Result()
+	if err != nil {
+		log.Warn().Err(err).Str("stream", c.stream).Msg("Failed to get consumer group lag")
+	}
+	for _, group := range groups {
+		// Redis reports -1 when the lag cannot be told, after entries were deleted
+		if group.Name == c.group && group.Lag >= 0 {
+			lag = &group.Lag
+		}
+	}
+	return c.status(DriverRedisStream, c.stream, c.group, started, lag)
+}
+
+// Restart stops the consuming loop and starts it again, entries left pending meanwhile being
+// reclaimed as usual
+func (c *RedisStreamConsumer) Restart() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stop()
+	return c.subscribe()
+}
+
+// stop cancels the consuming loop and waits for the current batch to finish
+func (c *RedisStreamConsumer) stop() {
+	if c.cancel == nil {
+		return
+	}
+	c.cancel()
+	<-c.done
+	c.cancel = nil
+	c.started = false
+}
+
+// Close stops consuming and waits for the current batch to finish
+func (c *RedisStreamConsumer) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stop()
+	return nil
+}
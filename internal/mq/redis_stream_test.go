@@ -0,0 +1,355 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupRedisStream(t *testing.T) (*miniredis.Miniredis, *redis.Client, *config.RedisStreamConfig) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return mr, client, &config.RedisStreamConfig{
+		Stream:        "octopus:access_log",
+		Group:         "shortlink_consumer_group",
+		Consumer:      "test",
+		MaxLen:        1000,
+		BatchSize:     10,
+		Block:         10 * time.Millisecond,
+		ClaimMinIdle:  time.Minute,
+		ClaimInterval: time.Hour,
+		MaxDeliver:    3,
+	}
+}
+
+func TestRedisStreamProducer_SendAccessLog(t *testing.T) {
+	t.Run("nil producer returns nil", func(t *testing.T) {
+		var p *RedisStreamProducer
+		assert.NoError(t, p.SendAccessLog(context.Background(), &AccessLogMessage{}))
+		assert.NoError(t, p.Close())
+	})
+
+	t.Run("appends JSON entries to the stream", func(t *testing.T) {
+		_, client, cfg := setupRedisStream(t)
+		p := NewRedisStreamProducer(client, cfg)
+
+		require.NoError(t, p.SendAccessLog(context.Background(), &AccessLogMessage{ShortCode: "ABCD"}))
+
+		msgs, err := client.XRange(context.Background(), cfg.Stream, "-", "+").Result()
+		require.NoError(t, err)
+		require.Len(t, msgs, 1)
+
+		var sent AccessLogMessage
+		require.NoError(t, json.Unmarshal([]byte(msgs[0].Values[redisStreamDataField].(string)), &sent))
+		assert.Equal(t, "ABCD", sent.ShortCode)
+	})
+}
+
+func TestRedisStreamConsumer_read(t *testing.T) {
+	ctx := context.Background()
+	_, client, cfg := setupRedisStream(t)
+	p := NewRedisStreamProducer(client, cfg)
+
+	var handled []string
+	c := NewRedisStreamConsumer(client, cfg, func(ctx context.Context, msg *AccessLogMessage) error {
+		handled = append(handled, msg.ShortCode)
+		if msg.ShortCode == "FAIL" {
+			return errors.New("db down")
+		}
+		return nil
+	})
+	require.NoError(t, client.XGroupCreateMkStream(ctx, cfg.Stream, cfg.Group, "0").Err())
+
+	require.NoError(t, p.SendAccessLog(ctx, &AccessLogMessage{ShortCode: "ABCD"}))
+	require.NoError(t, p.SendAccessLog(ctx, &AccessLogMessage{ShortCode: "FAIL"}))
+	require.NoError(t, client.XAdd(ctx, &redis.XAddArgs{Stream: cfg.Stream, Values: map[string]interface{}{"data": "{"}}).Err())
+
+	require.NoError(t, c.read(ctx))
+	assert.Equal(t, []string{"ABCD", "FAIL"}, handled)
+
+	// Only the failed entry stays pending for reclaiming
+	pending, err := client.XPending(ctx, cfg.Stream, cfg.Group).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pending.Count)
+
+	// Nothing new to read
+	require.NoError(t, c.read(ctx))
+	assert.Len(t, handled, 2)
+}
+
+func TestRedisStreamConsumer_reclaim(t *testing.T) {
+	ctx := context.Background()
+	mr, client, cfg := setupRedisStream(t)
+	p := NewRedisStreamProducer(client, cfg)
+	require.NoError(t, client.XGroupCreateMkStream(ctx, cfg.Stream, cfg.Group, "0").Err())
+	require.NoError(t, p.SendAccessLog(ctx, &AccessLogMessage{ShortCode: "ABCD"}))
+
+	// A consumer crashes after reading the entry
+	crashed := *cfg
+	crashed.Consumer = "crashed"
+	require.NoError(t, NewRedisStreamConsumer(client, &crashed, func(ctx context.Context, msg *AccessLogMessage) error {
+		return errors.New("crash")
+	}).read(ctx))
+
+	var handled int
+	c := NewRedisStreamConsumer(client, cfg, func(ctx context.Context, msg *AccessLogMessage) error {
+		handled++
+		return nil
+	})
+
+	t.Run("recently delivered entries are left alone", func(t *testing.T) {
+		require.NoError(t, c.reclaim(ctx))
+		assert.Equal(t, 0, handled)
+	})
+
+	t.Run("idle entries are taken over and acknowledged", func(t *testing.T) {
+		mr.SetTime(time.Now().Add(2 * time.Minute))
+		require.NoError(t, c.reclaim(ctx))
+		assert.Equal(t, 1, handled)
+
+		pending, err := client.XPending(ctx, cfg.Stream, cfg.Group).Result()
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), pending.Count)
+	})
+}
+
+func TestRedisStreamConsumer_reclaimDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	mr, client, cfg := setupRedisStream(t)
+	require.NoError(t, client.XGroupCreateMkStream(ctx, cfg.Stream, cfg.Group, "0").Err())
+	require.NoError(t, NewRedisStreamProducer(client, cfg).SendAccessLog(ctx, &AccessLogMessage{ShortCode: "FAIL"}))
+
+	var handled int
+	c := NewRedisStreamConsumer(client, cfg, func(ctx context.Context, msg *AccessLogMessage) error {
+		handled++
+		return errors.New("db down")
+	})
+
+	require.NoError(t, c.read(ctx))
+	now := time.Now()
+	for i := 1; i <= int(cfg.MaxDeliver); i++ {
+		mr.SetTime(now.Add(time.Duration(i) * 2 * time.Minute))
+		require.NoError(t, c.reclaim(ctx))
+	}
+
+	// Delivered max_deliver times, then moved to the dead-letter stream
+	assert.Equal(t, int(cfg.MaxDeliver), handled)
+	dead, err := client.XRange(ctx, cfg.Stream+":dead", "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Contains(t, dead[0].Values, "source_id")
+
+	pending, err := client.XPending(ctx, cfg.Stream, cfg.Group).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), pending.Count)
+}
+
+func TestRedisStreamConsumer_SubscribeAndClose(t *testing.T) {
+	t.Run("nil consumer close returns nil", func(t *testing.T) {
+		var c *RedisStreamConsumer
+		assert.NoError(t, c.Close())
+		assert.NoError(t, (&RedisStreamConsumer{}).Close())
+	})
+
+	t.Run("consumes until closed", func(t *testing.T) {
+		_, client, cfg := setupRedisStream(t)
+
+		var mu sync.Mutex
+		var handled []string
+		c := NewRedisStreamConsumer(client, cfg, func(ctx context.Context, msg *AccessLogMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled = append(handled, msg.ShortCode)
+			return nil
+		})
+
+		require.NoError(t, c.Subscribe())
+		require.NoError(t, c.Subscribe())
+
+		// An existing group is reused
+		other := NewRedisStreamConsumer(client, cfg, nil)
+		require.NoError(t, other.Subscribe())
+		require.NoError(t, other.Close())
+
+		require.NoError(t, NewRedisStreamProducer(client, cfg).SendAccessLog(context.Background(), &AccessLogMessage{ShortCode: "ABCD"}))
+		assert.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(handled) == 1
+		}, time.Second, 5*time.Millisecond)
+
+		require.NoError(t, c.Close())
+	})
+}
+
+func TestRedisStreamConsumer_StatusAndRestart(t *testing.T) {
+	_, client, cfg := setupRedisStream(t)
+	producer := NewRedisStreamProducer(client, cfg)
+
+	var mu sync.Mutex
+	var handled []string
+	c := NewRedisStreamConsumer(client, cfg, func(ctx context.Context, msg *AccessLogMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, msg.ShortCode)
+		return nil
+	})
+	require.NoError(t, c.Subscribe())
+	require.NoError(t, c.Restart())
+
+	require.NoError(t, producer.SendAccessLog(context.Background(), &AccessLogMessage{ShortCode: "ABCD"}))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(handled) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	status := c.Status(context.Background())
+	assert.Equal(t, DriverRedisStream, status.Driver)
+	assert.Equal(t, cfg.Stream, status.Topic)
+	assert.Equal(t, cfg.Group, status.Group)
+	assert.Equal(t, ConsumerStarted, status.Status)
+	assert.Equal(t, int64(1), status.Processed)
+	assert.NotNil(t, status.LastMessageAt)
+	require.NotNil(t, status.Lag)
+	lag := *status.Lag
+
+	// Entries added while stopped wait in the stream
+	require.NoError(t, c.Close())
+	require.NoError(t, producer.SendAccessLog(context.Background(), &AccessLogMessage{ShortCode: "EFGH"}))
+	status = c.Status(context.Background())
+	assert.Equal(t, ConsumerStopped, status.Status)
+	require.NotNil(t, status.Lag)
+	assert.Equal(t, lag+1, *status.Lag)
+}
+
+func TestNewRedisStreamConsumer_DefaultName(t *testing.T) {
+	c := NewRedisStreamConsumer(nil, &config.RedisStreamConfig{Stream: "s"}, nil)
+	assert.NotEmpty(t, c.consumer)
+	assert.Equal(t, "s:dead", c.deadStream)
+}
+
+func TestRedisStreamConsumer_DeadLetterQueue(t *testing.T) {
+	ctx := context.Background()
+	mr, client, cfg := setupRedisStream(t)
+	require.NoError(t, client.XGroupCreateMkStream(ctx, cfg.Stream, cfg.Group, "0").Err())
+	require.NoError(t, NewRedisStreamProducer(client, cfg).SendAccessLog(ctx, &AccessLogMessage{ShortCode: "FAIL"}))
+	require.NoError(t, client.XAdd(ctx, &redis.XAddArgs{Stream: cfg.Stream, Values: map[string]interface{}{"data": "{"}}).Err())
+
+	dlq := NewDeadLetterQueue(client, nil, &config.DeadLetterConfig{Stream: "dlq"})
+	c := NewRedisStreamConsumer(client, cfg, func(ctx context.Context, msg *AccessLogMessage) error {
+		return errors.New("db down")
+	})
+	c.SetDeadLetterQueue(dlq)
+
+	// Malformed entries are parked right away
+	require.NoError(t, c.read(ctx))
+	depth, err := dlq.Depth(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), depth)
+
+	// Entries exceeding max deliveries go to the queue instead of <stream>:dead
+	now := time.Now()
+	for i := 1; i <= int(cfg.MaxDeliver); i++ {
+		mr.SetTime(now.Add(time.Duration(i) * 2 * time.Minute))
+		require.NoError(t, c.reclaim(ctx))
+	}
+
+	page, err := dlq.List(ctx, "", 10)
+	require.NoError(t, err)
+	require.Len(t, page.DeadLetters, 2)
+	assert.Contains(t, page.DeadLetters[1].Payload, "FAIL")
+	assert.Equal(t, "exceeded max deliveries", page.DeadLetters[1].Reason)
+	assert.False(t, mr.Exists(cfg.Stream+":dead"))
+}
+
+func TestRedisStreamProducer_SendLinkEvent(t *testing.T) {
+	ctx := context.Background()
+	_, client, cfg := setupRedisStream(t)
+	cfg.LinkStream = "octopus:link_events"
+	p := NewRedisStreamProducer(client, cfg)
+
+	require.NoError(t, p.SendLinkEvent(ctx, &LinkEventMessage{EventID: "e1", Type: EventTypeLinkDeleted, ShortCode: "ABCD"}))
+
+	msgs, err := client.XRange(ctx, cfg.LinkStream, "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	event, err := DecodeLinkEvent([]byte(msgs[0].Values[redisStreamDataField].(string)))
+	require.NoError(t, err)
+	assert.Equal(t, EventTypeLinkDeleted, event.Type)
+	assert.Equal(t, "ABCD", event.ShortCode)
+
+	// Access logs are kept apart
+	n, err := client.XLen(ctx, cfg.Stream).Result()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestRedisStreamConsumer_SkipsOtherEventTypes(t *testing.T) {
+	ctx := context.Background()
+	_, client, cfg := setupRedisStream(t)
+	require.NoError(t, client.XGroupCreateMkStream(ctx, cfg.Stream, cfg.Group, "0").Err())
+	require.NoError(t, client.XAdd(ctx, &redis.XAddArgs{Stream: cfg.Stream, Values: map[string]interface{}{
+		"data": `{"schema_version":1,"type":"link_created","short_code":"ABCD"}`,
+	}}).Err())
+
+	dlq := NewDeadLetterQueue(client, nil, &config.DeadLetterConfig{Stream: "dlq"})
+	var handled int
+	c := NewRedisStreamConsumer(client, cfg, func(ctx context.Context, msg *AccessLogMessage) error {
+		handled++
+		return nil
+	})
+	c.SetDeadLetterQueue(dlq)
+
+	require.NoError(t, c.read(ctx))
+	assert.Zero(t, handled)
+
+	// Acknowledged without being dead-lettered
+	depth, err := dlq.Depth(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, depth)
+	pending, err := client.XPending(ctx, cfg.Stream, cfg.Group).Result()
+	require.NoError(t, err)
+	assert.Zero(t, pending.Count)
+}
+
+func TestRedisStreamLinkConsumer_read(t *testing.T) {
+	ctx := context.Background()
+	_, client, cfg := setupRedisStream(t)
+	cfg.LinkStream = "octopus:link_events"
+	p := NewRedisStreamProducer(client, cfg)
+
+	var handled []string
+	c := NewRedisStreamLinkConsumer(client, cfg, "octopus_replica_eu-west", func(ctx context.Context, msg *LinkEventMessage) error {
+		handled = append(handled, msg.ShortCode)
+		if msg.ShortCode == "FAIL" {
+			return errors.New("db down")
+		}
+		return nil
+	})
+	require.NoError(t, client.XGroupCreateMkStream(ctx, cfg.LinkStream, "octopus_replica_eu-west", "0").Err())
+
+	require.NoError(t, p.SendAccessLog(ctx, &AccessLogMessage{ShortCode: "LOG"}))
+	require.NoError(t, p.SendLinkEvent(ctx, &LinkEventMessage{Type: EventTypeLinkCreated, ShortCode: "ABCD"}))
+	require.NoError(t, p.SendLinkEvent(ctx, &LinkEventMessage{Type: EventTypeLinkCreated, ShortCode: "FAIL"}))
+
+	require.NoError(t, c.read(ctx))
+	assert.Equal(t, []string{"ABCD", "FAIL"}, handled, "access logs are on another stream")
+
+	// The failed event stays pending to be applied again
+	pending, err := client.XPending(ctx, cfg.LinkStream, "octopus_replica_eu-west").Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pending.Count)
+}
@@ -0,0 +1,24 @@
+package mq
+
+import "context"
+
+// RegionalProducer stamps link events with the region they originate from, so that replicas can
+// tell where a change was made
+type RegionalProducer struct {
+	ProducerInterface
+	region string
+}
+
+// NewRegionalProducer wraps a producer publishing the link events of a region
+func NewRegionalProducer(producer ProducerInterface, region string) *RegionalProducer {
+	return &RegionalProducer{
+		ProducerInterface: producer,
+		region:            region,
+	}
+}
+
+// SendLinkEvent sends a link event stamped with the region
+func (p *RegionalProducer) SendLinkEvent(ctx context.Context, msg *LinkEventMessage) error {
+	msg.Region = p.region
+	return p.ProducerInterface.SendLinkEvent(ctx, msg)
+}
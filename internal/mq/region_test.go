@@ -0,0 +1,31 @@
+package mq
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lastEventProducer keeps the last link event it is asked to send
+type lastEventProducer struct {
+	recordingProducer
+	last *LinkEventMessage
+}
+
+func (p *lastEventProducer) SendLinkEvent(ctx context.Context, msg *LinkEventMessage) error {
+	p.last = msg
+	return p.recordingProducer.SendLinkEvent(ctx, msg)
+}
+
+func TestRegionalProducer_SendLinkEvent(t *testing.T) {
+	inner := &lastEventProducer{}
+	p := NewRegionalProducer(inner, "eu-west")
+
+	assert.NoError(t, p.SendLinkEvent(context.Background(), &LinkEventMessage{ShortCode: "ABCD"}))
+	assert.Equal(t, "eu-west", inner.last.Region)
+
+	// Access logs pass through untouched
+	assert.NoError(t, p.SendAccessLog(context.Background(), &AccessLogMessage{ShortCode: "ABCD"}))
+	assert.Equal(t, 2, inner.sent)
+}
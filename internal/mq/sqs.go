@@ -0,0 +1,625 @@
+package mq
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/pkg/async"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/rs/zerolog/log"
+)
+
+// sqsMaxBatchSize is the largest batch SQS and SNS accept per call
+const sqsMaxBatchSize = 10
+
+// sqsEventTypeAttribute is the message attribute carrying the event type, for SNS filter policies
+const sqsEventTypeAttribute = "event_type"
+
+// ErrProducerClosed is returned when sending through a producer that has been closed
+var ErrProducerClosed = errors.New("producer closed")
+
+// sqsAPI is the subset of the SQS client used by the driver
+type sqsAPI interface {
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessageBatch(ctx context.Context, params *sqs.DeleteMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error)
+	ChangeMessageVisibilityBatch(ctx context.Context, params *sqs.ChangeMessageVisibilityBatchInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityBatchOutput, error)
+	GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error)
+}
+
+// snsAPI is the subset of the SNS client used by the driver
+type snsAPI interface {
+	PublishBatch(ctx context.Context, params *sns.PublishBatchInput, optFns ...func(*sns.Options)) (*sns.PublishBatchOutput, error)
+}
+
+// sqsEntry is one message waiting in the producer batch for its send result
+type sqsEntry struct {
+	body      string
+	eventType string
+	dedupID   string
+	groupID   string
+	done      chan error
+}
+
+// SQSProducer handles message production to SQS, or to an SNS topic feeding the queue
+type SQSProducer struct {
+	sqs           sqsAPI
+	sns           snsAPI
+	queueURL      string
+	topicARN      string
+	fifo          bool
+	batchSize     int
+	batchInterval time.Duration
+	entries       chan *sqsEntry
+	stop          chan struct{}
+	stopped       chan struct{}
+	once          sync.Once
+	encoding
+}
+
+// NewSQSProducer creates a new SQS producer that sends messages in batches
+func NewSQSProducer(cfg *config.SQSConfig) (*SQSProducer, error) {
+	awsCfg, err := loadAWSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	p := newSQSProducer(cfg, newSQSClient(awsCfg, cfg), nil)
+	if cfg.TopicARN != "" {
+		p.sns = sns.NewFromConfig(awsCfg, func(o *sns.Options) {
+			if cfg.Endpoint != "" {
+				o.BaseEndpoint = aws.String(cfg.Endpoint)
+			}
+		})
+	}
+	async.Go(p.run)
+
+	log.Info().Str("queue_url", cfg.QueueURL).Str("topic_arn", cfg.TopicARN).Msg("SQS producer started")
+
+	return p, nil
+}
+
+// newSQSProducer creates an SQS producer without starting its batch loop
+func newSQSProducer(cfg *config.SQSConfig, sqsClient sqsAPI, snsClient snsAPI) *SQSProducer {
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 || batchSize > sqsMaxBatchSize {
+		batchSize = sqsMaxBatchSize
+	}
+
+	// FIFO queues and topics require a group ID and deduplicate by message ID
+	fifo := strings.HasSuffix(cfg.QueueURL, ".fifo")
+	if cfg.TopicARN != "" {
+		fifo = strings.HasSuffix(cfg.TopicARN, ".fifo")
+	}
+
+	return &SQSProducer{
+		sqs:           sqsClient,
+		sns:           snsClient,
+		queueURL:      cfg.QueueURL,
+		topicARN:      cfg.TopicARN,
+		fifo:          fifo,
+		batchSize:     batchSize,
+		batchInterval: cfg.BatchInterval,
+		entries:       make(chan *sqsEntry, batchSize),
+		stop:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+}
+
+// SendAccessLog adds an access log message to the next batch and waits for its result
+func (p *SQSProducer) SendAccessLog(ctx context.Context, msg *AccessLogMessage) error {
+	if p == nil {
+		return nil // Producer disabled
+	}
+
+	bytes, err := p.encode(msg)
+	if err != nil {
+		return err
+	}
+	return p.enqueue(ctx, &sqsEntry{
+		body:      p.body(bytes),
+		eventType: EventTypeAccessLog,
+		dedupID:   msg.DedupID(),
+		groupID:   msg.ShortCode,
+		done:      make(chan error, 1),
+	})
+}
+
+// SendLinkEvent adds a link event to the next batch and waits for its result. Link events share the
+// queue or topic with access logs, subscribers tell them apart by the event_type attribute.
+func (p *SQSProducer) SendLinkEvent(ctx context.Context, msg *LinkEventMessage) error {
+	if p == nil {
+		return nil // Producer disabled
+	}
+
+	bytes, err := p.encodeLinkEvent(msg)
+	if err != nil {
+		return err
+	}
+	return p.enqueue(ctx, &sqsEntry{
+		body:      p.body(bytes),
+		eventType: msg.Type,
+		dedupID:   msg.EventID,
+		groupID:   msg.ShortCode,
+		done:      make(chan error, 1),
+	})
+}
+
+// body turns an encoded event into a message body: bodies are text, binary encodings travel base64 encoded
+func (p *SQSProducer) body(data []byte) string {
+	if p.codec != nil && p.codec.Binary() {
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	return string(data)
+}
+
+// enqueue hands an entry to the batch loop and waits for its send result
+func (p *SQSProducer) enqueue(ctx context.Context, entry *sqsEntry) error {
+	select {
+	case <-p.stop:
+		return ErrProducerClosed
+	default:
+	}
+
+	select {
+	case p.entries <- entry:
+	case <-p.stop:
+		return ErrProducerClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-entry.done:
+		return err
+	case <-p.stopped:
+		// Entries handed over before shutdown are flushed before the batch loop exits
+		select {
+		case err := <-entry.done:
+			return err
+		default:
+			return ErrProducerClosed
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run collects entries into batches, sending when a batch is full or the interval elapses
+func (p *SQSProducer) run() {
+	defer close(p.stopped)
+
+	batch := make([]*sqsEntry, 0, p.batchSize)
+	timer := time.NewTimer(p.batchInterval)
+	timer.Stop()
+
+	flush := func() {
+		if len(batch) > 0 {
+			p.send(batch)
+			batch = make([]*sqsEntry, 0, p.batchSize)
+		}
+	}
+
+	for {
+		select {
+		case entry := <-p.entries:
+			if len(batch) == 0 {
+				timer.Reset(p.batchInterval)
+			}
+			batch = append(batch, entry)
+			if len(batch) >= p.batchSize {
+				timer.Stop()
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		case <-p.stop:
+			timer.Stop()
+			// Send what callers already handed over before shutting down
+			for {
+				select {
+				case entry := <-p.entries:
+					batch = append(batch, entry)
+					if len(batch) >= p.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// send delivers one batch and reports the result of every entry to its caller
+func (p *SQSProducer) send(batch []*sqsEntry) {
+	// The batch outlives the request contexts of its callers
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var failed map[string]string
+	var err error
+	if p.topicARN != "" {
+		failed, err = p.publishToTopic(ctx, batch)
+	} else {
+		failed, err = p.sendToQueue(ctx, batch)
+	}
+
+	for i, entry := range batch {
+		switch reason, ok := failed[strconv.Itoa(i)]; {
+		case err != nil:
+			entry.done <- fmt.Errorf("failed to send message batch: %w", err)
+		case ok:
+			entry.done <- fmt.Errorf("failed to send message: %s", reason)
+		default:
+			entry.done <- nil
+		}
+	}
+
+	log.Debug().
+		Int("batch_size", len(batch)).
+		Int("failed", len(failed)).
+		Msg("Access log batch sent to SQS")
+}
+
+// sendToQueue sends a batch with SendMessageBatch, returning the failed entry IDs
+func (p *SQSProducer) sendToQueue(ctx context.Context, batch []*sqsEntry) (map[string]string, error) {
+	entries := make([]sqstypes.SendMessageBatchRequestEntry, len(batch))
+	for i, e := range batch {
+		entries[i] = sqstypes.SendMessageBatchRequestEntry{
+			Id:          aws.String(strconv.Itoa(i)),
+			MessageBody: aws.String(e.body),
+			MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+				sqsEventTypeAttribute: {DataType: aws.String("String"), StringValue: aws.String(e.eventType)},
+			},
+		}
+		if p.fifo {
+			entries[i].MessageDeduplicationId = aws.String(e.dedupID)
+			entries[i].MessageGroupId = aws.String(e.groupID)
+		}
+	}
+
+	out, err := p.sqs.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(p.queueURL),
+		Entries:  entries,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	failed := make(map[string]string, len(out.Failed))
+	for _, f := range out.Failed {
+		failed[aws.ToString(f.Id)] = aws.ToString(f.Code) + ": " + aws.ToString(f.Message)
+	}
+	return failed, nil
+}
+
+// publishToTopic publishes a batch with PublishBatch, returning the failed entry IDs
+func (p *SQSProducer) publishToTopic(ctx context.Context, batch []*sqsEntry) (map[string]string, error) {
+	entries := make([]snstypes.PublishBatchRequestEntry, len(batch))
+	for i, e := range batch {
+		entries[i] = snstypes.PublishBatchRequestEntry{
+			Id:      aws.String(strconv.Itoa(i)),
+			Message: aws.String(e.body),
+			MessageAttributes: map[string]snstypes.MessageAttributeValue{
+				sqsEventTypeAttribute: {DataType: aws.String("String"), StringValue: aws.String(e.eventType)},
+			},
+		}
+		if p.fifo {
+			entries[i].MessageDeduplicationId = aws.String(e.dedupID)
+			entries[i].MessageGroupId = aws.String(e.groupID)
+		}
+	}
+
+	out, err := p.sns.PublishBatch(ctx, &sns.PublishBatchInput{
+		TopicArn:                   aws.String(p.topicARN),
+		PublishBatchRequestEntries: entries,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	failed := make(map[string]string, len(out.Failed))
+	for _, f := range out.Failed {
+		failed[aws.ToString(f.Id)] = aws.ToString(f.Code) + ": " + aws.ToString(f.Message)
+	}
+	return failed, nil
+}
+
+// Close sends the pending batch and stops the producer
+func (p *SQSProducer) Close() error {
+	if p == nil {
+		return nil
+	}
+	p.once.Do(func() {
+		close(p.stop)
+	})
+	<-p.stopped
+	return nil
+}
+
+// SQSConsumer handles message consumption from SQS by long polling
+type SQSConsumer struct {
+	client            sqsAPI
+	queueURL          string
+	batchSize         int32
+	waitTime          time.Duration
+	visibilityTimeout time.Duration
+	retryDelay        time.Duration
+	handler           AccessLogHandler
+	cancel            context.CancelFunc
+	done              chan struct{}
+	started           bool
+	deadLettering
+	consumerStats
+}
+
+// NewSQSConsumer creates a new SQS consumer
+func NewSQSConsumer(cfg *config.SQSConfig, handler AccessLogHandler) (*SQSConsumer, error) {
+	awsCfg, err := loadAWSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newSQSConsumer(cfg, newSQSClient(awsCfg, cfg), handler), nil
+}
+
+// newSQSConsumer creates an SQS consumer on the given client
+func newSQSConsumer(cfg *config.SQSConfig, client sqsAPI, handler AccessLogHandler) *SQSConsumer {
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 || batchSize > sqsMaxBatchSize {
+		batchSize = sqsMaxBatchSize
+	}
+
+	return &SQSConsumer{
+		client:            client,
+		queueURL:          cfg.QueueURL,
+		batchSize:         int32(batchSize),
+		waitTime:          cfg.WaitTime,
+		visibilityTimeout: cfg.VisibilityTimeout,
+		retryDelay:        cfg.RetryDelay,
+		handler:           handler,
+	}
+}
+
+// Subscribe starts polling the queue in the background
+func (c *SQSConsumer) Subscribe() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subscribe()
+}
+
+// subscribe starts the polling loop unless it runs
+func (c *SQSConsumer) subscribe() error {
+	if c.started {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	c.started = true
+
+	async.Go(func() {
+		defer close(c.done)
+		for ctx.Err() == nil {
+			if err := c.poll(ctx); err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Str("queue_url", c.queueURL).Msg("Failed to poll SQS")
+				// Back off instead of hammering an unavailable queue
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+				}
+			}
+		}
+	})
+
+	log.Info().Str("queue_url", c.queueURL).Msg("SQS consumer started")
+
+	return nil
+}
+
+// poll receives one batch of messages, deleting processed ones and delaying failed ones
+func (c *SQSConsumer) poll(ctx context.Context) error {
+	out, err := c.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:                    aws.String(c.queueURL),
+		MaxNumberOfMessages:         c.batchSize,
+		WaitTimeSeconds:             int32(c.waitTime / time.Second),
+		VisibilityTimeout:           int32(c.visibilityTimeout / time.Second),
+		MessageSystemAttributeNames: []sqstypes.MessageSystemAttributeName{sqstypes.MessageSystemAttributeNameApproximateReceiveCount},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to receive messages: %w", err)
+	}
+	if len(out.Messages) == 0 {
+		return nil
+	}
+
+	var processed []sqstypes.DeleteMessageBatchRequestEntry
+	var retries []sqstypes.ChangeMessageVisibilityBatchRequestEntry
+	for i, msg := range out.Messages {
+		id := aws.String(strconv.Itoa(i))
+		if err := c.handle(ctx, msg); err != nil {
+			retries = append(retries, sqstypes.ChangeMessageVisibilityBatchRequestEntry{
+				Id:                id,
+				ReceiptHandle:     msg.ReceiptHandle,
+				VisibilityTimeout: c.retryVisibility(msg),
+			})
+			continue
+		}
+		processed = append(processed, sqstypes.DeleteMessageBatchRequestEntry{
+			Id:            id,
+			ReceiptHandle: msg.ReceiptHandle,
+		})
+	}
+
+	if len(processed) > 0 {
+		if _, err := c.client.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String(c.queueURL),
+			Entries:  processed,
+		}); err != nil {
+			return fmt.Errorf("failed to delete messages: %w", err)
+		}
+	}
+
+	if len(retries) > 0 {
+		if _, err := c.client.ChangeMessageVisibilityBatch(ctx, &sqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws.String(c.queueURL),
+			Entries:  retries,
+		}); err != nil {
+			return fmt.Errorf("failed to change message visibility: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// handle processes one message; malformed messages are dead-lettered or dropped as they never succeed
+func (c *SQSConsumer) handle(ctx context.Context, msg sqstypes.Message) error {
+	body := []byte(aws.ToString(msg.Body))
+
+	// Messages from SNS without raw message delivery arrive in a notification envelope
+	var envelope struct {
+		Type    string `json:"Type"`
+		Message string `json:"Message"`
+	}
+	if json.Unmarshal(body, &envelope) == nil && envelope.Type == "Notification" {
+		body = []byte(envelope.Message)
+	}
+
+	if decoded, err := base64.StdEncoding.DecodeString(string(body)); err == nil {
+		body = decoded
+	}
+
+	accessLog, err := DecodeAccessLog(body)
+	if errors.Is(err, ErrUnexpectedEventType) {
+		// Link events published to the same queue are not ours to process
+		return nil
+	}
+	if err != nil {
+		log.Error().Err(err).Str("msg_id", aws.ToString(msg.MessageId)).Msg("Failed to unmarshal message")
+		c.record(err)
+		c.deadLetter(ctx, body, err)
+		return nil
+	}
+
+	log.Debug().
+		Str("msg_id", aws.ToString(msg.MessageId)).
+		Str("short_code", accessLog.ShortCode).
+		Msg("Processing access log")
+
+	if c.handler != nil {
+		if err := c.handler(ctx, accessLog); err != nil {
+			log.Error().Err(err).Str("msg_id", aws.ToString(msg.MessageId)).Msg("Handler failed")
+			c.record(err)
+			return err
+		}
+	}
+
+	c.record(nil)
+	return nil
+}
+
+// retryVisibility delays the next delivery of a failed message, backing off with every receive
+func (c *SQSConsumer) retryVisibility(msg sqstypes.Message) int32 {
+	receives, _ := strconv.Atoi(msg.Attributes[string(sqstypes.MessageSystemAttributeNameApproximateReceiveCount)])
+	if receives < 1 {
+		receives = 1
+	}
+
+	delay := time.Duration(receives) * c.retryDelay
+	if c.visibilityTimeout > 0 && delay > c.visibilityTimeout {
+		delay = c.visibilityTimeout
+	}
+	return int32(delay / time.Second)
+}
+
+// Status reports the state and counters of the consumer, with the approximate number of messages
+// available in the queue as lag
+func (c *SQSConsumer) Status(ctx context.Context) *model.ConsumerStatus {
+	c.mu.Lock()
+	started := c.started
+	c.mu.Unlock()
+
+	var lag *int64
+	attribute := sqstypes.QueueAttributeNameApproximateNumberOfMessages
+	out, err := c.client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(c.queueURL),
+		AttributeNames: []sqstypes.QueueAttributeName{attribute},
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("queue_url", c.queueURL).Msg("Failed to get SQS queue attributes")
+	} else if n, err := strconv.ParseInt(out.Attributes[string(attribute)], 10, 64); err == nil {
+		lag = &n
+	}
+	return c.status(DriverSQS, c.queueURL, "", started, lag)
+}
+
+// Restart stops the polling loop and starts it again, messages received meanwhile becoming
+// visible again after their visibility timeout
+func (c *SQSConsumer) Restart() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stop()
+	return c.subscribe()
+}
+
+// stop cancels the polling loop and waits for the current batch to finish
+func (c *SQSConsumer) stop() {
+	if c.cancel == nil {
+		return
+	}
+	c.cancel()
+	<-c.done
+	c.cancel = nil
+	c.started = false
+}
+
+// Close stops polling and waits for the current batch to finish
+func (c *SQSConsumer) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stop()
+	return nil
+}
+
+// loadAWSConfig loads AWS credentials and region from the environment and the SQS configuration
+func loadAWSConfig(cfg *config.SQSConfig) (aws.Config, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return awsCfg, nil
+}
+
+// newSQSClient creates an SQS client, pointing it at a custom endpoint such as LocalStack if configured
+func newSQSClient(awsCfg aws.Config, cfg *config.SQSConfig) *sqs.Client {
+	return sqs.NewFromConfig(awsCfg, func(o *sqs.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	})
+}
@@ -0,0 +1,322 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSQS records batch calls and serves queued receive results
+type fakeSQS struct {
+	mu         sync.Mutex
+	sent       [][]sqstypes.SendMessageBatchRequestEntry
+	failID     string
+	sendErr    error
+	receive    []sqstypes.Message
+	deleted    []sqstypes.DeleteMessageBatchRequestEntry
+	visibility []sqstypes.ChangeMessageVisibilityBatchRequestEntry
+	receiveIn  *sqs.ReceiveMessageInput
+}
+
+func (f *fakeSQS) SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sendErr != nil {
+		return nil, f.sendErr
+	}
+	f.sent = append(f.sent, params.Entries)
+	out := &sqs.SendMessageBatchOutput{}
+	if f.failID != "" {
+		out.Failed = []sqstypes.BatchResultErrorEntry{{Id: aws.String(f.failID), Code: aws.String("InternalError")}}
+	}
+	return out, nil
+}
+
+func (f *fakeSQS) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.receiveIn = params
+	msgs := f.receive
+	f.receive = nil
+	return &sqs.ReceiveMessageOutput{Messages: msgs}, nil
+}
+
+func (f *fakeSQS) DeleteMessageBatch(ctx context.Context, params *sqs.DeleteMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleted = append(f.deleted, params.Entries...)
+	return &sqs.DeleteMessageBatchOutput{}, nil
+}
+
+func (f *fakeSQS) ChangeMessageVisibilityBatch(ctx context.Context, params *sqs.ChangeMessageVisibilityBatchInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.visibility = append(f.visibility, params.Entries...)
+	return &sqs.ChangeMessageVisibilityBatchOutput{}, nil
+}
+
+func (f *fakeSQS) GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &sqs.GetQueueAttributesOutput{Attributes: map[string]string{
+		string(sqstypes.QueueAttributeNameApproximateNumberOfMessages): strconv.Itoa(len(f.receive)),
+	}}, nil
+}
+
+// fakeSNS records published batches
+type fakeSNS struct {
+	published []*sns.PublishBatchInput
+}
+
+func (f *fakeSNS) PublishBatch(ctx context.Context, params *sns.PublishBatchInput, optFns ...func(*sns.Options)) (*sns.PublishBatchOutput, error) {
+	f.published = append(f.published, params)
+	return &sns.PublishBatchOutput{}, nil
+}
+
+func TestSQSProducer_SendAccessLog(t *testing.T) {
+	msg := &AccessLogMessage{ShortCode: "ABCD", AccessTime: time.Unix(1700000000, 0)}
+
+	t.Run("nil producer returns nil", func(t *testing.T) {
+		var p *SQSProducer
+		assert.NoError(t, p.SendAccessLog(context.Background(), msg))
+		assert.NoError(t, p.Close())
+	})
+
+	t.Run("full batch is sent at once", func(t *testing.T) {
+		client := &fakeSQS{}
+		p := newSQSProducer(&config.SQSConfig{QueueURL: "https://sqs/queue", BatchSize: 3, BatchInterval: time.Hour}, client, nil)
+		go p.run()
+		defer p.Close()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, p.SendAccessLog(context.Background(), msg))
+			}()
+		}
+		wg.Wait()
+
+		require.Len(t, client.sent, 1)
+		assert.Len(t, client.sent[0], 3)
+		assert.Nil(t, client.sent[0][0].MessageGroupId, "standard queues take no group ID")
+	})
+
+	t.Run("partial batch is sent after the interval", func(t *testing.T) {
+		client := &fakeSQS{}
+		p := newSQSProducer(&config.SQSConfig{QueueURL: "https://sqs/queue", BatchInterval: 10 * time.Millisecond}, client, nil)
+		go p.run()
+		defer p.Close()
+
+		require.NoError(t, p.SendAccessLog(context.Background(), msg))
+		require.Len(t, client.sent, 1)
+
+		var sent AccessLogMessage
+		require.NoError(t, json.Unmarshal([]byte(aws.ToString(client.sent[0][0].MessageBody)), &sent))
+		assert.Equal(t, "ABCD", sent.ShortCode)
+	})
+
+	t.Run("fifo queue deduplicates by message ID", func(t *testing.T) {
+		client := &fakeSQS{}
+		p := newSQSProducer(&config.SQSConfig{QueueURL: "https://sqs/queue.fifo", BatchInterval: time.Millisecond}, client, nil)
+		go p.run()
+		defer p.Close()
+
+		require.NoError(t, p.SendAccessLog(context.Background(), msg))
+		entry := client.sent[0][0]
+		assert.Equal(t, msg.DedupID(), aws.ToString(entry.MessageDeduplicationId))
+		assert.Equal(t, "ABCD", aws.ToString(entry.MessageGroupId))
+	})
+
+	t.Run("failed entry is reported to its caller", func(t *testing.T) {
+		client := &fakeSQS{failID: "0"}
+		p := newSQSProducer(&config.SQSConfig{QueueURL: "https://sqs/queue", BatchInterval: time.Millisecond}, client, nil)
+		go p.run()
+		defer p.Close()
+
+		assert.Error(t, p.SendAccessLog(context.Background(), msg))
+	})
+
+	t.Run("batch error is reported", func(t *testing.T) {
+		client := &fakeSQS{sendErr: errors.New("throttled")}
+		p := newSQSProducer(&config.SQSConfig{QueueURL: "https://sqs/queue", BatchInterval: time.Millisecond}, client, nil)
+		go p.run()
+		defer p.Close()
+
+		assert.Error(t, p.SendAccessLog(context.Background(), msg))
+	})
+
+	t.Run("topic publishes through SNS", func(t *testing.T) {
+		topic := &fakeSNS{}
+		p := newSQSProducer(&config.SQSConfig{TopicARN: "arn:aws:sns:eu-west-1:1:access-log", BatchInterval: time.Millisecond}, &fakeSQS{}, topic)
+		go p.run()
+		defer p.Close()
+
+		require.NoError(t, p.SendAccessLog(context.Background(), msg))
+		require.Len(t, topic.published, 1)
+		assert.Equal(t, "arn:aws:sns:eu-west-1:1:access-log", aws.ToString(topic.published[0].TopicArn))
+	})
+
+	t.Run("binary encodings are sent as base64 text", func(t *testing.T) {
+		client := &fakeSQS{}
+		p := newSQSProducer(&config.SQSConfig{QueueURL: "https://sqs/queue", BatchInterval: time.Millisecond}, client, nil)
+		codec, _ := NewCodec(EncodingProtobuf)
+		p.SetCodec(codec)
+		go p.run()
+		defer p.Close()
+
+		require.NoError(t, p.SendAccessLog(context.Background(), msg))
+
+		var handled *AccessLogMessage
+		c := newSQSConsumer(&config.SQSConfig{QueueURL: "https://sqs/queue"}, client, func(ctx context.Context, m *AccessLogMessage) error {
+			handled = m
+			return nil
+		})
+		require.NoError(t, c.handle(context.Background(), sqstypes.Message{Body: client.sent[0][0].MessageBody}))
+		require.NotNil(t, handled)
+		assert.Equal(t, "ABCD", handled.ShortCode)
+	})
+
+	t.Run("closed producer rejects messages", func(t *testing.T) {
+		p := newSQSProducer(&config.SQSConfig{QueueURL: "https://sqs/queue", BatchInterval: time.Millisecond}, &fakeSQS{}, nil)
+		go p.run()
+		require.NoError(t, p.Close())
+		require.NoError(t, p.Close())
+
+		assert.ErrorIs(t, p.SendAccessLog(context.Background(), msg), ErrProducerClosed)
+	})
+}
+
+func TestSQSConsumer_poll(t *testing.T) {
+	body, _ := json.Marshal(&AccessLogMessage{ShortCode: "ABCD"})
+	envelope, _ := json.Marshal(map[string]string{"Type": "Notification", "Message": string(body)})
+
+	client := &fakeSQS{receive: []sqstypes.Message{
+		{MessageId: aws.String("1"), ReceiptHandle: aws.String("r1"), Body: aws.String(string(body))},
+		{MessageId: aws.String("2"), ReceiptHandle: aws.String("r2"), Body: aws.String(string(envelope))},
+		{MessageId: aws.String("3"), ReceiptHandle: aws.String("r3"), Body: aws.String("{")},
+		{
+			MessageId:     aws.String("4"),
+			ReceiptHandle: aws.String("r4"),
+			Body:          aws.String(`{"short_code":"FAIL"}`),
+			Attributes:    map[string]string{"ApproximateReceiveCount": "2"},
+		},
+	}}
+
+	var handled []string
+	c := newSQSConsumer(&config.SQSConfig{
+		QueueURL:          "https://sqs/queue",
+		WaitTime:          20 * time.Second,
+		VisibilityTimeout: 30 * time.Second,
+		RetryDelay:        10 * time.Second,
+	}, client, func(ctx context.Context, msg *AccessLogMessage) error {
+		handled = append(handled, msg.ShortCode)
+		if msg.ShortCode == "FAIL" {
+			return errors.New("db down")
+		}
+		return nil
+	})
+
+	require.NoError(t, c.poll(context.Background()))
+
+	assert.Equal(t, int32(20), client.receiveIn.WaitTimeSeconds)
+	assert.Equal(t, int32(sqsMaxBatchSize), client.receiveIn.MaxNumberOfMessages)
+	assert.Equal(t, []string{"ABCD", "ABCD", "FAIL"}, handled)
+
+	// Processed and malformed messages are deleted, failed ones come back later
+	var deleted []string
+	for _, e := range client.deleted {
+		deleted = append(deleted, aws.ToString(e.ReceiptHandle))
+	}
+	assert.Equal(t, []string{"r1", "r2", "r3"}, deleted)
+	require.Len(t, client.visibility, 1)
+	assert.Equal(t, "r4", aws.ToString(client.visibility[0].ReceiptHandle))
+	assert.Equal(t, int32(20), client.visibility[0].VisibilityTimeout)
+
+	status := c.Status(context.Background())
+	assert.Equal(t, int64(2), status.Processed)
+	assert.Equal(t, int64(2), status.Errors)
+	assert.NotNil(t, status.LastMessageAt)
+}
+
+func TestSQSConsumer_retryVisibility(t *testing.T) {
+	c := &SQSConsumer{retryDelay: 10 * time.Second, visibilityTimeout: 30 * time.Second}
+
+	tests := map[string]int32{
+		"":  10,
+		"1": 10,
+		"2": 20,
+		"9": 30,
+	}
+	for receives, expected := range tests {
+		msg := sqstypes.Message{Attributes: map[string]string{"ApproximateReceiveCount": receives}}
+		assert.Equal(t, expected, c.retryVisibility(msg), receives)
+	}
+}
+
+func TestSQSConsumer_SubscribeAndClose(t *testing.T) {
+	t.Run("nil consumer close returns nil", func(t *testing.T) {
+		var c *SQSConsumer
+		assert.NoError(t, c.Close())
+		assert.NoError(t, (&SQSConsumer{}).Close())
+	})
+
+	t.Run("polls until closed", func(t *testing.T) {
+		client := &fakeSQS{}
+		c := newSQSConsumer(&config.SQSConfig{QueueURL: "https://sqs/queue"}, client, nil)
+
+		require.NoError(t, c.Subscribe())
+		require.NoError(t, c.Subscribe())
+		assert.Eventually(t, func() bool {
+			client.mu.Lock()
+			defer client.mu.Unlock()
+			return client.receiveIn != nil
+		}, time.Second, time.Millisecond)
+		require.NoError(t, c.Close())
+	})
+}
+
+func TestSQSConsumer_StatusAndRestart(t *testing.T) {
+	client := &fakeSQS{receive: []sqstypes.Message{{MessageId: aws.String("1"), Body: aws.String("{}")}}}
+	c := newSQSConsumer(&config.SQSConfig{QueueURL: "https://sqs/queue"}, &blockingSQS{fakeSQS: client}, nil)
+
+	status := c.Status(context.Background())
+	assert.Equal(t, DriverSQS, status.Driver)
+	assert.Equal(t, "https://sqs/queue", status.Topic)
+	assert.Equal(t, ConsumerStopped, status.Status)
+	require.NotNil(t, status.Lag)
+	assert.Equal(t, int64(1), *status.Lag)
+
+	// Restarting a stopped consumer starts it
+	require.NoError(t, c.Restart())
+	assert.Equal(t, ConsumerStarted, c.Status(context.Background()).Status)
+	require.NoError(t, c.Restart())
+	assert.Equal(t, ConsumerStarted, c.Status(context.Background()).Status)
+
+	require.NoError(t, c.Close())
+	assert.Equal(t, ConsumerStopped, c.Status(context.Background()).Status)
+}
+
+// blockingSQS waits for the context of receives instead of serving messages, keeping them queued
+type blockingSQS struct {
+	*fakeSQS
+}
+
+func (b *blockingSQS) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
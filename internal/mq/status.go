@@ -0,0 +1,56 @@
+package mq
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"octopus/internal/model"
+)
+
+// States of a consumer in its status
+const (
+	ConsumerStarted = "started"
+	ConsumerStopped = "stopped"
+)
+
+// consumerStats counts the messages a consumer handles for its status, and serializes subscribing,
+// restarting and closing the consumer with its mutex
+type consumerStats struct {
+	mu          sync.Mutex
+	processed   atomic.Int64
+	failed      atomic.Int64
+	lastMessage atomic.Int64
+}
+
+// record counts a handled message, as an error when it failed
+func (s *consumerStats) record(err error) {
+	s.lastMessage.Store(time.Now().UnixNano())
+	if err != nil {
+		s.failed.Add(1)
+		return
+	}
+	s.processed.Add(1)
+}
+
+// status returns the counters of the consumer with its driver, topic and group, lag being nil when
+// the broker does not report it
+func (s *consumerStats) status(driver, topic, group string, started bool, lag *int64) *model.ConsumerStatus {
+	status := &model.ConsumerStatus{
+		Driver:    driver,
+		Topic:     topic,
+		Group:     group,
+		Status:    ConsumerStopped,
+		Processed: s.processed.Load(),
+		Errors:    s.failed.Load(),
+		Lag:       lag,
+	}
+	if started {
+		status.Status = ConsumerStarted
+	}
+	if last := s.lastMessage.Load(); last > 0 {
+		at := time.Unix(0, last).UTC()
+		status.LastMessageAt = &at
+	}
+	return status
+}
@@ -1,14 +1,101 @@
 package mq
 
 import (
+	"encoding/json"
+	"hash/fnv"
+	"strconv"
 	"time"
 )
 
-// AccessLogMessage represents an access log message
+// Message queue drivers carrying access log events
+const (
+	// DriverRocketMQ sends access logs through RocketMQ
+	DriverRocketMQ = "rocketmq"
+	// DriverNATS sends access logs through a NATS JetStream stream
+	DriverNATS = "nats"
+	// DriverSQS sends access logs through an Amazon SQS queue, optionally via an SNS topic
+	DriverSQS = "sqs"
+	// DriverRedisStream sends access logs through a Redis stream on the cache Redis
+	DriverRedisStream = "redis-stream"
+)
+
+// AccessLogMessage represents an access log message, Edge being the cache status of the CDN edge
+// forwarding the access, empty for direct requests. VisitorID is what the visitor is counted under
+// in the unique visitors, identified with VisitorStrategy; messages without one count the client IP.
 type AccessLogMessage struct {
-	ShortCode  string    `json:"short_code"`
-	ClientIP   string    `json:"client_ip"`
-	UserAgent  string    `json:"user_agent"`
-	Referer    string    `json:"referer"`
-	AccessTime time.Time `json:"access_time"`
+	EventID         string    `json:"event_id,omitempty"`
+	ShortCode       string    `json:"short_code"`
+	ClientIP        string    `json:"client_ip"`
+	UserAgent       string    `json:"user_agent"`
+	Referer         string    `json:"referer"`
+	ClickID         string    `json:"click_id,omitempty"`
+	Edge            string    `json:"edge,omitempty"`
+	AccessTime      time.Time `json:"access_time"`
+	VisitorID       string    `json:"visitor_id,omitempty"`
+	VisitorStrategy string    `json:"visitor_strategy,omitempty"`
+}
+
+// DedupID identifies the access across retried sends and redeliveries: the event ID
+// assigned at redirect time, or for messages without one an ID derived from the content
+func (m *AccessLogMessage) DedupID() string {
+	if m.EventID != "" {
+		return m.EventID
+	}
+	h := fnv.New64a()
+	for _, part := range []string{m.ShortCode, m.ClientIP, m.UserAgent, m.Referer, m.ClickID} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return strconv.FormatUint(h.Sum64(), 16) + "-" + strconv.FormatInt(m.AccessTime.UnixNano(), 36)
+}
+
+// Link lifecycle event types, published next to access logs for downstream systems
+const (
+	// EventTypeLinkCreated is published when a short link is created
+	EventTypeLinkCreated = "link_created"
+	// EventTypeLinkUpdated is published when the destination or expiry of a short link changes
+	EventTypeLinkUpdated = "link_updated"
+	// EventTypeLinkExpired is published when an expired short link is purged
+	EventTypeLinkExpired = "link_expired"
+	// EventTypeLinkDeleted is published when a short link is deleted before it expired
+	EventTypeLinkDeleted = "link_deleted"
+)
+
+// LinkEventMessage represents a link lifecycle event, its type travelling in the event envelope.
+// It carries everything redirects depend on, so that replicas can serve the link from the event.
+type LinkEventMessage struct {
+	EventID       string          `json:"event_id"`
+	Type          string          `json:"-"`
+	ShortCode     string          `json:"short_code"`
+	OriginalURL   string          `json:"original_url,omitempty"`
+	Pool          string          `json:"pool,omitempty"`
+	ExpireAt      *time.Time      `json:"expire_at,omitempty"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Region        string          `json:"region,omitempty"`
+	NoClickID     bool            `json:"no_click_id,omitempty"`
+	MaxClicks     int64           `json:"max_clicks,omitempty"`
+	PreserveQuery bool            `json:"preserve_query,omitempty"`
+	PublicStats   bool            `json:"public_stats,omitempty"`
+	NoTracking    bool            `json:"no_tracking,omitempty"`
+	CacheControl  string          `json:"cache_control,omitempty"`
+	SignedParams  bool            `json:"signed_params,omitempty"`
+	SingleUse     bool            `json:"single_use,omitempty"`
+	Referrers     string          `json:"referrers,omitempty"`
+	GeoAllow      string          `json:"geo_allow,omitempty"`
+	GeoDeny       string          `json:"geo_deny,omitempty"`
+	Schedule      json.RawMessage `json:"schedule,omitempty"`
+	Params        json.RawMessage `json:"params,omitempty"`
+}
+
+// EventTypeAlert tags operational alerts, published on their own topic for on-call tooling
+const EventTypeAlert = "alert"
+
+// AlertMessage represents an operational alert, like a dependency failing or a link under abuse
+type AlertMessage struct {
+	EventID    string    `json:"event_id"`
+	Name       string    `json:"name"`
+	Severity   string    `json:"severity"`
+	Message    string    `json:"message"`
+	ShortCode  string    `json:"short_code,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
 }
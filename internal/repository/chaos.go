@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+
+	"octopus/pkg/chaos"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// EnableFaultInjection injects latency and errors into every Redis command
+func (r *RedisRepository) EnableFaultInjection(injector *chaos.Injector) {
+	r.client.AddHook(faultHook{injector: injector})
+}
+
+// EnableFaultInjection injects latency and errors into every MySQL statement
+func (r *MySQLRepository) EnableFaultInjection(injector *chaos.Injector) error {
+	inject := func(db *gorm.DB) {
+		if err := injector.Inject(db.Statement.Context); err != nil {
+			// Later callbacks skip executing the statement once an error is set
+			_ = db.AddError(err)
+		}
+	}
+
+	callbacks := r.db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("chaos:create", inject); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("chaos:query", inject); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("chaos:update", inject); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("chaos:delete", inject); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("chaos:row", inject); err != nil {
+		return err
+	}
+	return callbacks.Raw().Before("gorm:raw").Register("chaos:raw", inject)
+}
+
+// faultHook is a go-redis hook running commands through a fault injector
+type faultHook struct {
+	injector *chaos.Injector
+}
+
+func (h faultHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h faultHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := h.injector.Inject(ctx); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h faultHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := h.injector.Inject(ctx); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		return next(ctx, cmds)
+	}
+}
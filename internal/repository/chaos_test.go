@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"octopus/pkg/chaos"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisRepository_EnableFaultInjection(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("fails commands and pipelines", func(t *testing.T) {
+		repo, _ := newTestRedisRepo(t)
+		repo.EnableFaultInjection(chaos.NewInjector("redis", 1, 0, 0))
+
+		_, err := repo.GetShortLink(ctx, "ABCD")
+		assert.ErrorIs(t, err, chaos.ErrInjected)
+
+		err = repo.SaveClick(ctx, "cid", "ABCD", "google", 0)
+		assert.ErrorIs(t, err, chaos.ErrInjected)
+	})
+
+	t.Run("passes commands through without faults", func(t *testing.T) {
+		repo, _ := newTestRedisRepo(t)
+		repo.EnableFaultInjection(chaos.NewInjector("redis", 0, 0, 0))
+
+		assert.NoError(t, repo.SaveShortLink(ctx, "ABCD", "https://example.com", 0))
+		url, err := repo.GetShortLink(ctx, "ABCD")
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com", url)
+	})
+}
+
+func TestMySQLRepository_EnableFaultInjection(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("fails statements before they reach the database", func(t *testing.T) {
+		db, mock := newTestDB(t)
+		repo := &MySQLRepository{db: db}
+		assert.NoError(t, repo.EnableFaultInjection(chaos.NewInjector("mysql", 1, 0, 0)))
+
+		_, err := repo.GetShortLinkByCode(ctx, "ABCD")
+		assert.ErrorIs(t, err, chaos.ErrInjected)
+
+		_, err = repo.GetTotalLinksCount(ctx)
+		assert.ErrorIs(t, err, chaos.ErrInjected)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("passes statements through without faults", func(t *testing.T) {
+		db, mock := newTestDB(t)
+		repo := &MySQLRepository{db: db}
+		assert.NoError(t, repo.EnableFaultInjection(chaos.NewInjector("mysql", 0, 0, 0)))
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM `short_links`")).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+		count, err := repo.GetTotalLinksCount(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), count)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
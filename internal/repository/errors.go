@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"octopus/pkg/chaos"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Errors returned by both repositories, wrapping the error of the driver so callers can tell
+// failures apart with errors.Is without depending on gorm or go-redis
+var (
+	// ErrNotFound is returned when the requested record or key does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write violates a unique constraint
+	ErrConflict = errors.New("conflict")
+	// ErrUnavailable is returned when the storage cannot be reached or did not answer in time
+	ErrUnavailable = errors.New("storage unavailable")
+)
+
+// mysqlDuplicateEntry is the MySQL error number of unique constraint violations
+const mysqlDuplicateEntry = 1062
+
+// mysqlError classifies an error of a MySQL operation
+func mysqlError(err error) error {
+	var mysqlErr *mysqldriver.MySQLError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case errors.Is(err, gorm.ErrDuplicatedKey),
+		errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry:
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone),
+		errors.Is(err, mysqldriver.ErrInvalidConn), unavailable(err):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
+
+// redisError classifies an error of a Redis operation
+func redisError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, redis.Nil):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case errors.Is(err, redis.ErrClosed), errors.Is(err, io.EOF), unavailable(err):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
+
+// unavailable checks for the network failures and timeouts both storages report alike, including
+// faults injected in chaos mode
+func unavailable(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, chaos.ErrInjected)
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"octopus/pkg/chaos"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestMySQLError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "record not found", err: gorm.ErrRecordNotFound, want: ErrNotFound},
+		{name: "duplicate entry", err: &mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'ABCD'"}, want: ErrConflict},
+		{name: "translated duplicate", err: gorm.ErrDuplicatedKey, want: ErrConflict},
+		{name: "bad connection", err: driver.ErrBadConn, want: ErrUnavailable},
+		{name: "invalid connection", err: mysqldriver.ErrInvalidConn, want: ErrUnavailable},
+		{name: "dial error", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, want: ErrUnavailable},
+		{name: "timeout", err: fmt.Errorf("query: %w", context.DeadlineExceeded), want: ErrUnavailable},
+		{name: "injected fault", err: chaos.ErrInjected, want: ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mysqlError(tt.err)
+			assert.ErrorIs(t, err, tt.want)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	assert.NoError(t, mysqlError(nil))
+
+	other := &mysqldriver.MySQLError{Number: 1146, Message: "Table doesn't exist"}
+	assert.Equal(t, error(other), mysqlError(other))
+}
+
+func TestRedisError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "missing key", err: redis.Nil, want: ErrNotFound},
+		{name: "client closed", err: redis.ErrClosed, want: ErrUnavailable},
+		{name: "dial error", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, want: ErrUnavailable},
+		{name: "timeout", err: context.DeadlineExceeded, want: ErrUnavailable},
+		{name: "injected fault", err: chaos.ErrInjected, want: ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := redisError(tt.err)
+			assert.ErrorIs(t, err, tt.want)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	assert.NoError(t, redisError(nil))
+
+	wrongType := errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	assert.Equal(t, wrongType, redisError(wrongType))
+}
@@ -0,0 +1,1000 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/pkg/async"
+	"octopus/pkg/clock"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// MemoryRepository keeps links, stats and logs in maps instead of MySQL, for demo instances and
+// as a test fixture. It enforces the unique keys of the MySQL tables and loses everything on exit.
+type MemoryRepository struct {
+	mu          sync.RWMutex
+	clock       clock.Clock
+	links       map[string]*model.ShortLink
+	accessLogs  []*model.AccessLog
+	eventIDs    map[string]bool
+	dailyStats  map[dailyStatKey]*model.DailyStat
+	sourceStats map[dailySourceStatKey]*model.DailySourceStat
+	conversions map[conversionKey]*model.Conversion
+	rules       map[int64]*model.Rule
+	domains     map[string]*model.DomainReputation
+	lastIDs     map[string]int64
+}
+
+// Unique keys of the daily aggregates and the conversions
+type (
+	dailyStatKey struct {
+		shortCode string
+		day       time.Time
+	}
+	dailySourceStatKey struct {
+		shortCode string
+		day       time.Time
+		source    string
+	}
+	conversionKey struct {
+		clickID string
+		event   string
+	}
+)
+
+// NewMemoryRepository creates an empty in-memory repository
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		clock:       clock.Real,
+		links:       make(map[string]*model.ShortLink),
+		eventIDs:    make(map[string]bool),
+		dailyStats:  make(map[dailyStatKey]*model.DailyStat),
+		sourceStats: make(map[dailySourceStatKey]*model.DailySourceStat),
+		conversions: make(map[conversionKey]*model.Conversion),
+		rules:       make(map[int64]*model.Rule),
+		domains:     make(map[string]*model.DomainReputation),
+		lastIDs:     make(map[string]int64),
+	}
+}
+
+// nextID returns the next auto-increment ID of a table
+func (r *MemoryRepository) nextID(table string) int64 {
+	r.lastIDs[table]++
+	return r.lastIDs[table]
+}
+
+// SaveShortLink saves a short link, failing with ErrConflict when its short code exists
+func (r *MemoryRepository) SaveShortLink(_ context.Context, sl *model.ShortLink) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.links[sl.ShortCode]; ok {
+		return fmt.Errorf("%w: short code %s exists", ErrConflict, sl.ShortCode)
+	}
+	r.createShortLink(sl)
+	return nil
+}
+
+// createShortLink stores a copy of a new short link, filling in the column defaults like MySQL
+func (r *MemoryRepository) createShortLink(sl *model.ShortLink) {
+	sl.ID = r.nextID(sl.TableName())
+	if sl.CreatedAt.IsZero() {
+		sl.CreatedAt = r.clock.Now().UTC()
+	}
+	if sl.Status == 0 {
+		sl.Status = 1
+	}
+	stored := *sl
+	r.links[sl.ShortCode] = &stored
+}
+
+// GetShortLinkByCode retrieves an active short link by short code
+func (r *MemoryRepository) GetShortLinkByCode(_ context.Context, shortCode string) (*model.ShortLink, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if sl, ok := r.links[shortCode]; ok && sl.Status == 1 {
+		found := *sl
+		return &found, nil
+	}
+	return nil, fmt.Errorf("%w: short link %s", ErrNotFound, shortCode)
+}
+
+// GetShortLinkByDedupHash retrieves the first active short link with the hash of a URL and params
+func (r *MemoryRepository) GetShortLinkByDedupHash(_ context.Context, dedupHash string) (*model.ShortLink, error) {
+	links := r.findShortLinks(func(sl *model.ShortLink) bool {
+		return sl.DedupHash == dedupHash && sl.Status == 1
+	})
+	if len(links) == 0 {
+		return nil, fmt.Errorf("%w: short link with dedup hash %s", ErrNotFound, dedupHash)
+	}
+	return &links[0], nil
+}
+
+// GetShortLinksByURLHash retrieves all active short links for a normalized URL hash
+func (r *MemoryRepository) GetShortLinksByURLHash(_ context.Context, urlHash string) ([]model.ShortLink, error) {
+	return r.findShortLinks(func(sl *model.ShortLink) bool {
+		return sl.URLHash == urlHash && sl.Status == 1
+	}), nil
+}
+
+// SearchShortLinks retrieves the short links whose title, notes or URL contain words of the query,
+// the ones containing the most words first, as a rough take on the MySQL full-text search
+func (r *MemoryRepository) SearchShortLinks(_ context.Context, q *model.SearchQuery) ([]model.ShortLink, error) {
+	words := strings.Fields(strings.ToLower(q.Query))
+	relevance := func(sl *model.ShortLink) int {
+		text := strings.ToLower(sl.Title + " " + sl.Notes + " " + sl.OriginalURL)
+		matches := 0
+		for _, word := range words {
+			if strings.Contains(text, word) {
+				matches++
+			}
+		}
+		return matches
+	}
+
+	links := r.findShortLinks(func(sl *model.ShortLink) bool { return relevance(sl) > 0 })
+	sort.SliceStable(links, func(i, j int) bool {
+		ri, rj := relevance(&links[i]), relevance(&links[j])
+		if ri != rj {
+			return ri > rj
+		}
+		return links[i].ID > links[j].ID
+	})
+	return page(links, q.Offset, q.Limit), nil
+}
+
+// GetShortLinksByCodes retrieves the short links of the given codes, whatever their status
+func (r *MemoryRepository) GetShortLinksByCodes(_ context.Context, shortCodes []string) ([]model.ShortLink, error) {
+	codes := make(map[string]bool, len(shortCodes))
+	for _, code := range shortCodes {
+		codes[code] = true
+	}
+	return r.findShortLinks(func(sl *model.ShortLink) bool { return codes[sl.ShortCode] }), nil
+}
+
+// GetShortLinksByFilter retrieves up to limit short links matching a filter, oldest first
+func (r *MemoryRepository) GetShortLinksByFilter(_ context.Context, filter *model.LinkFilter, limit int) ([]model.ShortLink, error) {
+	links := r.findShortLinks(linkFilterMatcher(filter))
+	sort.Slice(links, func(i, j int) bool { return links[i].ID < links[j].ID })
+	if len(links) > limit {
+		links = links[:limit]
+	}
+	return links, nil
+}
+
+// GetManagedShortLinks retrieves the active short links of owner provisioned declaratively
+func (r *MemoryRepository) GetManagedShortLinks(_ context.Context, owner string) ([]model.ShortLink, error) {
+	links := r.findShortLinks(func(sl *model.ShortLink) bool {
+		return sl.Managed && sl.Status == 1 && sl.Owner == owner
+	})
+	sort.Slice(links, func(i, j int) bool { return links[i].ShortCode < links[j].ShortCode })
+	return links, nil
+}
+
+// CheckExistsByCode checks if a short code exists
+func (r *MemoryRepository) CheckExistsByCode(_ context.Context, shortCode string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.links[shortCode]
+	return ok, nil
+}
+
+// GetExpiredLinksByPool retrieves short links of a code pool that expired before the given time
+func (r *MemoryRepository) GetExpiredLinksByPool(_ context.Context, pool string, before time.Time, limit int) ([]model.ShortLink, error) {
+	links := r.findShortLinks(func(sl *model.ShortLink) bool {
+		return sl.Pool == pool && sl.ExpireAt != nil && sl.ExpireAt.Before(before)
+	})
+	sort.SliceStable(links, func(i, j int) bool { return links[i].ExpireAt.Before(*links[j].ExpireAt) })
+	return page(links, 0, limit), nil
+}
+
+// GetExpiringShortLinks retrieves a page of the active short links with an owner expiring after from
+// and up to to, in ID order after afterID
+func (r *MemoryRepository) GetExpiringShortLinks(_ context.Context, from, to time.Time, afterID int64, limit int) ([]model.ShortLink, error) {
+	links := r.findShortLinks(func(sl *model.ShortLink) bool {
+		return sl.Status == 1 && sl.Owner != "" && sl.ExpireAt != nil && sl.ExpireAt.After(from) && !sl.ExpireAt.After(to) && sl.ID > afterID
+	})
+	return page(links, 0, limit), nil
+}
+
+// DeleteShortLinkByCode permanently removes a short link by short code
+func (r *MemoryRepository) DeleteShortLinkByCode(_ context.Context, shortCode string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.links, shortCode)
+	return nil
+}
+
+// DeactivateShortLink disables a short link, keeping it for inspection
+func (r *MemoryRepository) DeactivateShortLink(_ context.Context, shortCode string) error {
+	r.updateShortLink(shortCode, func(sl *model.ShortLink) { sl.Status = 0 })
+	return nil
+}
+
+// SetShortLinkOwner transfers a short link to an owner, identified by the hash of its API key
+func (r *MemoryRepository) SetShortLinkOwner(_ context.Context, shortCode, owner string) error {
+	r.updateShortLink(shortCode, func(sl *model.ShortLink) { sl.Owner = owner })
+	return nil
+}
+
+// SetShortLinksStatus sets the status of the links matching a filter and returns the links it
+// changed, with their new status
+func (r *MemoryRepository) SetShortLinksStatus(_ context.Context, filter *model.LinkFilter, status int) ([]model.ShortLink, error) {
+	return r.updateShortLinks(filter, func(sl *model.ShortLink) bool {
+		if sl.Status == status {
+			return false
+		}
+		sl.Status = status
+		return true
+	}), nil
+}
+
+// SetShortLinksExpiry sets the expiry of the links matching a filter, nil for never, and returns the
+// links it changed, with their new expiry
+func (r *MemoryRepository) SetShortLinksExpiry(_ context.Context, filter *model.LinkFilter, expireAt *time.Time) ([]model.ShortLink, error) {
+	return r.updateShortLinks(filter, func(sl *model.ShortLink) bool {
+		if sameTime(sl.ExpireAt, expireAt) {
+			return false
+		}
+		sl.ExpireAt = expireAt
+		return true
+	}), nil
+}
+
+// UpdateShortLink writes the destination, metadata and status of a short link
+func (r *MemoryRepository) UpdateShortLink(_ context.Context, sl *model.ShortLink) error {
+	r.updateShortLink(sl.ShortCode, func(stored *model.ShortLink) {
+		stored.OriginalURL = sl.OriginalURL
+		stored.URLHash = sl.URLHash
+		stored.Title = sl.Title
+		stored.Description = sl.Description
+		stored.Notes = sl.Notes
+		stored.Status = sl.Status
+		stored.ExpireAt = sl.ExpireAt
+	})
+	return nil
+}
+
+// UpdateShortLinkMetadata writes the title, description, notes, public stats, tracking,
+// Cache-Control, allowed referrers, country and schedule settings of a short link
+func (r *MemoryRepository) UpdateShortLinkMetadata(_ context.Context, sl *model.ShortLink) error {
+	r.updateShortLink(sl.ShortCode, func(stored *model.ShortLink) {
+		stored.Title = sl.Title
+		stored.Description = sl.Description
+		stored.Notes = sl.Notes
+		stored.PublicStats = sl.PublicStats
+		stored.NoTracking = sl.NoTracking
+		stored.CacheControl = sl.CacheControl
+		stored.Referrers = sl.Referrers
+		stored.GeoAllow = sl.GeoAllow
+		stored.GeoDeny = sl.GeoDeny
+		stored.Schedule = sl.Schedule
+	})
+	return nil
+}
+
+// ApplyReplicatedShortLink writes a link replicated from the primary region unless a change made
+// later on the primary was applied already, and reports whether it was written. Links never seen
+// are created even when disabled, so that changes arriving out of order cannot revive them.
+func (r *MemoryRepository) ApplyReplicatedShortLink(_ context.Context, sl *model.ShortLink) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.links[sl.ShortCode]
+	if !ok {
+		disabled := sl.Status == 0
+		r.createShortLink(sl)
+		if disabled {
+			sl.Status = 0
+			r.links[sl.ShortCode].Status = 0
+		}
+		return true, nil
+	}
+	if current.ReplicaVersion >= sl.ReplicaVersion {
+		return false, nil
+	}
+
+	current.OriginalURL = sl.OriginalURL
+	current.URLHash = sl.URLHash
+	current.Pool = sl.Pool
+	current.ExpireAt = sl.ExpireAt
+	current.Status = sl.Status
+	current.NoClickID = sl.NoClickID
+	current.MaxClicks = sl.MaxClicks
+	current.PreserveQuery = sl.PreserveQuery
+	current.PublicStats = sl.PublicStats
+	current.NoTracking = sl.NoTracking
+	current.CacheControl = sl.CacheControl
+	current.SignedParams = sl.SignedParams
+	current.SingleUse = sl.SingleUse
+	current.Referrers = sl.Referrers
+	current.GeoAllow = sl.GeoAllow
+	current.GeoDeny = sl.GeoDeny
+	current.Schedule = sl.Schedule
+	current.Params = sl.Params
+	current.ReplicaVersion = sl.ReplicaVersion
+	return true, nil
+}
+
+// memoryTxKey marks a context running in a transaction of a memory repository
+type memoryTxKey struct{ repo *MemoryRepository }
+
+// WithTx runs fn, restoring the short links it changed when it fails. Nested calls join the
+// outermost one. The memory repository has no isolation: writers running alongside fn see its
+// changes, and lose theirs when it rolls back.
+func (r *MemoryRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(memoryTxKey{r}) != nil {
+		return fn(ctx)
+	}
+
+	r.mu.RLock()
+	snapshot := make(map[string]*model.ShortLink, len(r.links))
+	for shortCode, sl := range r.links {
+		copied := *sl
+		snapshot[shortCode] = &copied
+	}
+	r.mu.RUnlock()
+
+	if err := fn(context.WithValue(ctx, memoryTxKey{r}, true)); err != nil {
+		r.mu.Lock()
+		r.links = snapshot
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// findShortLinks returns copies of the short links matching a filter, in creation order
+func (r *MemoryRepository) findShortLinks(match func(sl *model.ShortLink) bool) []model.ShortLink {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	links := []model.ShortLink{}
+	for _, sl := range r.links {
+		if match(sl) {
+			links = append(links, *sl)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].ID < links[j].ID })
+	return links
+}
+
+// updateShortLink applies an update to the stored short link of a code, if any
+func (r *MemoryRepository) updateShortLink(shortCode string, update func(sl *model.ShortLink)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if sl, ok := r.links[shortCode]; ok {
+		update(sl)
+	}
+}
+
+// updateShortLinks applies change to the stored links matching a filter at once, returning copies
+// of the ones it changed
+func (r *MemoryRepository) updateShortLinks(filter *model.LinkFilter, change func(sl *model.ShortLink) bool) []model.ShortLink {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	match := linkFilterMatcher(filter)
+	changed := []model.ShortLink{}
+	for _, sl := range r.links {
+		if !match(sl) {
+			continue
+		}
+		if change(sl) {
+			changed = append(changed, *sl)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].ID < changed[j].ID })
+	return changed
+}
+
+// linkFilterMatcher returns a function checking if a link matches a filter
+func linkFilterMatcher(filter *model.LinkFilter) func(sl *model.ShortLink) bool {
+	codes := make(map[string]bool, len(filter.ShortCodes))
+	for _, code := range filter.ShortCodes {
+		codes[code] = true
+	}
+	return func(sl *model.ShortLink) bool {
+		if len(codes) > 0 {
+			if !codes[sl.ShortCode] {
+				return false
+			}
+		} else if value, ok := paramValue(sl, filter.Param); !ok || value != filter.Value {
+			return false
+		}
+		return filter.Owner == "" || sl.Owner == filter.Owner
+	}
+}
+
+// SaveAccessLog saves an access log, failing with ErrConflict when its event ID was saved already
+func (r *MemoryRepository) SaveAccessLog(_ context.Context, accessLog *model.AccessLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.createAccessLog(accessLog) {
+		return fmt.Errorf("%w: access event %s exists", ErrConflict, *accessLog.EventID)
+	}
+	return nil
+}
+
+// RecordAccessLog saves an access log and counts it in the daily aggregates, returning false
+// without counting when an access log with the same event ID was already recorded
+func (r *MemoryRepository) RecordAccessLog(_ context.Context, accessLog *model.AccessLog) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.createAccessLog(accessLog) {
+		return false, nil
+	}
+
+	// A visitor counts once per day, on its first access
+	day := accessLog.AccessTime.UTC().Truncate(24 * time.Hour)
+	var visitors int64 = 1
+	for _, l := range r.accessLogs {
+		if l.ID != accessLog.ID && l.ShortCode == accessLog.ShortCode && l.Visitor() == accessLog.Visitor() &&
+			!l.AccessTime.Before(day) && l.AccessTime.Before(day.Add(24*time.Hour)) {
+			visitors = 0
+			break
+		}
+	}
+
+	r.addDailyStat(accessLog.ShortCode, day, 1, visitors)
+	if accessLog.Source != "" {
+		key := dailySourceStatKey{shortCode: accessLog.ShortCode, day: day, source: accessLog.Source}
+		stat, ok := r.sourceStats[key]
+		if !ok {
+			stat = &model.DailySourceStat{ID: r.nextID(model.DailySourceStat{}.TableName()), ShortCode: key.shortCode, Day: day, Source: key.source}
+			r.sourceStats[key] = stat
+		}
+		stat.Clicks++
+	}
+	return true, nil
+}
+
+// createAccessLog stores a copy of a new access log, returning false when its event ID exists
+func (r *MemoryRepository) createAccessLog(accessLog *model.AccessLog) bool {
+	if accessLog.EventID != nil {
+		if r.eventIDs[*accessLog.EventID] {
+			return false
+		}
+		r.eventIDs[*accessLog.EventID] = true
+	}
+	accessLog.ID = r.nextID(accessLog.TableName())
+	if accessLog.AccessTime.IsZero() {
+		accessLog.AccessTime = r.clock.Now().UTC()
+	}
+	stored := *accessLog
+	r.accessLogs = append(r.accessLogs, &stored)
+	return true
+}
+
+// GetAccessLogs retrieves access logs for a short code, ordered by (access_time, id) and paged by cursor
+func (r *MemoryRepository) GetAccessLogs(_ context.Context, q *model.AccessLogQuery) ([]model.AccessLog, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// before orders access logs oldest first
+	before := func(a, b *model.AccessLog) bool {
+		if !a.AccessTime.Equal(b.AccessTime) {
+			return a.AccessTime.Before(b.AccessTime)
+		}
+		return a.ID < b.ID
+	}
+	var cursor *model.AccessLog
+	if q.Cursor != nil {
+		cursor = &model.AccessLog{ID: q.Cursor.ID, AccessTime: q.Cursor.AccessTime}
+	}
+
+	logs := []model.AccessLog{}
+	for _, l := range r.accessLogs {
+		switch {
+		case l.ShortCode != q.ShortCode,
+			!q.From.IsZero() && l.AccessTime.Before(q.From),
+			!q.To.IsZero() && !l.AccessTime.Before(q.To),
+			q.Source != "" && l.Source != q.Source,
+			q.Device != "" && l.Device != q.Device,
+			cursor != nil && q.Ascending && !before(cursor, l),
+			cursor != nil && !q.Ascending && !before(l, cursor):
+			continue
+		}
+		logs = append(logs, *l)
+	}
+
+	sort.Slice(logs, func(i, j int) bool {
+		if q.Ascending {
+			return before(&logs[i], &logs[j])
+		}
+		return before(&logs[j], &logs[i])
+	})
+	return page(logs, 0, q.Limit), nil
+}
+
+// CountAccessLogsBetween counts the access logs of a short code within [from, to)
+func (r *MemoryRepository) CountAccessLogsBetween(_ context.Context, shortCode string, from, to time.Time) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var count int64
+	for _, l := range r.accessLogs {
+		if l.ShortCode == shortCode && !l.AccessTime.Before(from) && l.AccessTime.Before(to) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// DeleteAccessLogs removes every access log of a short code
+func (r *MemoryRepository) DeleteAccessLogs(_ context.Context, shortCode string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.accessLogs[:0]
+	for _, l := range r.accessLogs {
+		if l.ShortCode == shortCode {
+			if l.EventID != nil {
+				delete(r.eventIDs, *l.EventID)
+			}
+			continue
+		}
+		kept = append(kept, l)
+	}
+	r.accessLogs = kept
+	return nil
+}
+
+// IncrementDailyStat adds one click to the daily aggregate of a short code
+func (r *MemoryRepository) IncrementDailyStat(_ context.Context, shortCode string, day time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.addDailyStat(shortCode, day, 1, 0)
+	return nil
+}
+
+// AddDailyClicks adds clicks to the daily aggregate of a short code, without visitors
+func (r *MemoryRepository) AddDailyClicks(_ context.Context, shortCode string, day time.Time, clicks int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.addDailyStat(shortCode, day, clicks, 0)
+	return nil
+}
+
+// addDailyStat adds clicks and new visitors to the daily aggregate of a short code on the UTC day
+// of day
+func (r *MemoryRepository) addDailyStat(shortCode string, day time.Time, clicks, visitors int64) {
+	key := dailyStatKey{shortCode: shortCode, day: utcDay(day.UTC())}
+	stat, ok := r.dailyStats[key]
+	if !ok {
+		stat = &model.DailyStat{ID: r.nextID(model.DailyStat{}.TableName()), ShortCode: shortCode, Day: key.day}
+		r.dailyStats[key] = stat
+	}
+	stat.Clicks += clicks
+	stat.Visitors += visitors
+}
+
+// GetDailyStats retrieves the daily aggregates of a short code within [from, to]
+func (r *MemoryRepository) GetDailyStats(_ context.Context, shortCode string, from, to time.Time) ([]model.DailyStat, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := []model.DailyStat{}
+	for _, stat := range r.dailyStats {
+		if stat.ShortCode == shortCode && withinDays(stat.Day, from, to) {
+			stats = append(stats, *stat)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Day.Before(stats[j].Day) })
+	return stats, nil
+}
+
+// GetDailySourceStats retrieves the daily per-source aggregates of a short code within [from, to]
+func (r *MemoryRepository) GetDailySourceStats(_ context.Context, shortCode string, from, to time.Time) ([]model.DailySourceStat, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := []model.DailySourceStat{}
+	for _, stat := range r.sourceStats {
+		if stat.ShortCode == shortCode && withinDays(stat.Day, from, to) {
+			stats = append(stats, *stat)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if !stats[i].Day.Equal(stats[j].Day) {
+			return stats[i].Day.Before(stats[j].Day)
+		}
+		return stats[i].Source < stats[j].Source
+	})
+	return stats, nil
+}
+
+// GetCampaignDailyStats retrieves the daily aggregates within [from, to] of the links carrying the
+// given param, its value naming their campaign
+func (r *MemoryRepository) GetCampaignDailyStats(_ context.Context, param string, from, to time.Time) ([]model.CampaignDailyStat, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := []model.CampaignDailyStat{}
+	for _, stat := range r.dailyStats {
+		sl, ok := r.links[stat.ShortCode]
+		if !ok || !withinDays(stat.Day, from, to) {
+			continue
+		}
+		campaign, ok := paramValue(sl, param)
+		if !ok {
+			continue
+		}
+		stats = append(stats, model.CampaignDailyStat{
+			Campaign:    campaign,
+			ShortCode:   stat.ShortCode,
+			OriginalURL: sl.OriginalURL,
+			Title:       sl.Title,
+			Day:         stat.Day,
+			Clicks:      stat.Clicks,
+			Visitors:    stat.Visitors,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if !stats[i].Day.Equal(stats[j].Day) {
+			return stats[i].Day.Before(stats[j].Day)
+		}
+		return stats[i].ShortCode < stats[j].ShortCode
+	})
+	return stats, nil
+}
+
+// GetCampaignDailySourceStats retrieves the daily per-source aggregates within [from, to] of the
+// links carrying the given param, summed per campaign
+func (r *MemoryRepository) GetCampaignDailySourceStats(_ context.Context, param string, from, to time.Time) ([]model.CampaignDailySourceStat, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sums := make(map[model.CampaignDailySourceStat]int64)
+	for _, stat := range r.sourceStats {
+		sl, ok := r.links[stat.ShortCode]
+		if !ok || !withinDays(stat.Day, from, to) {
+			continue
+		}
+		campaign, ok := paramValue(sl, param)
+		if !ok {
+			continue
+		}
+		sums[model.CampaignDailySourceStat{Campaign: campaign, Day: stat.Day, Source: stat.Source}] += stat.Clicks
+	}
+
+	stats := make([]model.CampaignDailySourceStat, 0, len(sums))
+	for stat, clicks := range sums {
+		stat.Clicks = clicks
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		if a.Campaign != b.Campaign {
+			return a.Campaign < b.Campaign
+		}
+		if !a.Day.Equal(b.Day) {
+			return a.Day.Before(b.Day)
+		}
+		return a.Source < b.Source
+	})
+	return stats, nil
+}
+
+// SaveConversion saves a conversion, returning false if the click already converted for the event
+func (r *MemoryRepository) SaveConversion(_ context.Context, conversion *model.Conversion) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := conversionKey{clickID: conversion.ClickID, event: conversion.Event}
+	if _, ok := r.conversions[key]; ok {
+		return false, nil
+	}
+	conversion.ID = r.nextID(conversion.TableName())
+	if conversion.ConvertedAt.IsZero() {
+		conversion.ConvertedAt = r.clock.Now().UTC()
+	}
+	stored := *conversion
+	r.conversions[key] = &stored
+	return true, nil
+}
+
+// DeleteStats removes the daily aggregates and conversions of a short code
+func (r *MemoryRepository) DeleteStats(_ context.Context, shortCode string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key := range r.dailyStats {
+		if key.shortCode == shortCode {
+			delete(r.dailyStats, key)
+		}
+	}
+	for key := range r.sourceStats {
+		if key.shortCode == shortCode {
+			delete(r.sourceStats, key)
+		}
+	}
+	for key, conversion := range r.conversions {
+		if conversion.ShortCode == shortCode {
+			delete(r.conversions, key)
+		}
+	}
+	return nil
+}
+
+// ListRules retrieves all the rules, by kind and pattern
+func (r *MemoryRepository) ListRules(_ context.Context) ([]model.Rule, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rules := make([]model.Rule, 0, len(r.rules))
+	for _, rule := range r.rules {
+		rules = append(rules, *rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Kind != rules[j].Kind {
+			return rules[i].Kind < rules[j].Kind
+		}
+		return rules[i].Pattern < rules[j].Pattern
+	})
+	return rules, nil
+}
+
+// SaveRule saves a new rule, failing with ErrConflict when its kind already has the pattern
+func (r *MemoryRepository) SaveRule(_ context.Context, rule *model.Rule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.ruleConflict(rule); err != nil {
+		return err
+	}
+	rule.ID = r.nextID(rule.TableName())
+	rule.CreatedAt = r.clock.Now().UTC()
+	rule.UpdatedAt = rule.CreatedAt
+	stored := *rule
+	r.rules[rule.ID] = &stored
+	return nil
+}
+
+// UpdateRule replaces the kind, pattern and source of a rule, failing with ErrNotFound when it
+// does not exist
+func (r *MemoryRepository) UpdateRule(_ context.Context, rule *model.Rule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.rules[rule.ID]
+	if !ok {
+		return fmt.Errorf("%w: rule %d", ErrNotFound, rule.ID)
+	}
+	if err := r.ruleConflict(rule); err != nil {
+		return err
+	}
+	stored.Kind, stored.Pattern, stored.Source = rule.Kind, rule.Pattern, rule.Source
+	stored.UpdatedAt = r.clock.Now().UTC()
+	return nil
+}
+
+// ruleConflict enforces the unique kind and pattern of the rules table
+func (r *MemoryRepository) ruleConflict(rule *model.Rule) error {
+	for id, stored := range r.rules {
+		if id != rule.ID && stored.Kind == rule.Kind && stored.Pattern == rule.Pattern {
+			return fmt.Errorf("%w: %s rule %q exists", ErrConflict, rule.Kind, rule.Pattern)
+		}
+	}
+	return nil
+}
+
+// DeleteRule removes a rule, reporting whether it existed
+func (r *MemoryRepository) DeleteRule(_ context.Context, id int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.rules[id]
+	delete(r.rules, id)
+	return ok, nil
+}
+
+// TrackDomain counts a link created to a domain, keeping the destination of its first link as the
+// one to check, so that later links cannot point the checks elsewhere
+func (r *MemoryRepository) TrackDomain(_ context.Context, domain, sampleURL string) error {
+	r.updateDomain(domain, func(rep *model.DomainReputation) {
+		rep.Links++
+		if rep.SampleURL == "" {
+			rep.SampleURL = sampleURL
+		}
+	})
+	return nil
+}
+
+// AddDomainReport counts an abuse report of a link to a domain made at a time, counting again from
+// one when the last report was before since
+func (r *MemoryRepository) AddDomainReport(_ context.Context, domain string, at, since time.Time) error {
+	r.updateDomain(domain, func(rep *model.DomainReputation) {
+		if rep.ReportedAt == nil || rep.ReportedAt.Before(since) {
+			rep.Reports = 0
+		}
+		rep.Reports++
+		rep.ReportedAt = &at
+	})
+	return nil
+}
+
+// RecordDomainCheck counts a check of a domain, dead when its link did not answer and flagged when
+// Safe Browsing lists it
+func (r *MemoryRepository) RecordDomainCheck(_ context.Context, domain string, dead, flagged bool, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if rep, ok := r.domains[domain]; ok {
+		rep.Checks++
+		if dead {
+			rep.DeadChecks++
+		}
+		rep.Flagged = flagged
+		checkedAt := at
+		rep.CheckedAt = &checkedAt
+		rep.UpdatedAt = r.clock.Now().UTC()
+	}
+	return nil
+}
+
+// SetDomainOverride sets the verdict of a domain whatever its score, empty to compute it again
+func (r *MemoryRepository) SetDomainOverride(_ context.Context, domain, verdict string) error {
+	r.updateDomain(domain, func(rep *model.DomainReputation) { rep.Override = verdict })
+	return nil
+}
+
+// updateDomain applies change to the reputation of a domain, tracking the domain if needed
+func (r *MemoryRepository) updateDomain(domain string, change func(rep *model.DomainReputation)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rep, ok := r.domains[domain]
+	if !ok {
+		rep = &model.DomainReputation{Domain: domain}
+		r.domains[domain] = rep
+	}
+	change(rep)
+	rep.UpdatedAt = r.clock.Now().UTC()
+}
+
+// GetDomainReputation retrieves the reputation of a domain, ErrNotFound if it was never tracked
+func (r *MemoryRepository) GetDomainReputation(_ context.Context, domain string) (*model.DomainReputation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rep, ok := r.domains[domain]
+	if !ok {
+		return nil, fmt.Errorf("%w: domain %s", ErrNotFound, domain)
+	}
+	found := *rep
+	return &found, nil
+}
+
+// ListDomainReputations retrieves the domains with reports, dead checks, a Safe Browsing listing or
+// an override, by domain
+func (r *MemoryRepository) ListDomainReputations(_ context.Context) ([]model.DomainReputation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	reps := make([]model.DomainReputation, 0)
+	for _, rep := range r.domains {
+		if rep.Reports > 0 || rep.DeadChecks > 0 || rep.Flagged || rep.Override != "" {
+			reps = append(reps, *rep)
+		}
+	}
+	sort.Slice(reps, func(i, j int) bool { return reps[i].Domain < reps[j].Domain })
+	return reps, nil
+}
+
+// ListDomainsToCheck retrieves up to limit domains never checked or last checked before a time,
+// the least recently checked first
+func (r *MemoryRepository) ListDomainsToCheck(_ context.Context, before time.Time, limit int) ([]model.DomainReputation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	reps := make([]model.DomainReputation, 0)
+	for _, rep := range r.domains {
+		if rep.SampleURL != "" && (rep.CheckedAt == nil || rep.CheckedAt.Before(before)) {
+			reps = append(reps, *rep)
+		}
+	}
+	sort.Slice(reps, func(i, j int) bool {
+		a, b := reps[i].CheckedAt, reps[j].CheckedAt
+		if (a == nil) != (b == nil) {
+			return a == nil
+		}
+		if a != nil && !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		return reps[i].Domain < reps[j].Domain
+	})
+	if len(reps) > limit {
+		reps = reps[:limit]
+	}
+	return reps, nil
+}
+
+// Close releases nothing, the data is gone once the repository is no longer referenced
+func (r *MemoryRepository) Close() error {
+	return nil
+}
+
+// withinDays checks whether a UTC day is within the UTC days of [from, to]
+func withinDays(day, from, to time.Time) bool {
+	return !day.Before(utcDay(from.UTC())) && !day.After(utcDay(to.UTC()))
+}
+
+// paramValue returns the value of a link param the way JSON_UNQUOTE(JSON_EXTRACT()) reads it:
+// strings unquoted, other values as JSON
+func paramValue(sl *model.ShortLink, param string) (string, bool) {
+	value, ok := sl.DecodedParams()[param]
+	if !ok || value == nil {
+		return "", false
+	}
+	if s, ok := value.(string); ok {
+		return s, true
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// page returns the items of a page, all the items after offset when limit is 0
+func page[T any](items []T, offset, limit int) []T {
+	if offset >= len(items) {
+		return items[:0]
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// memoryRedisTick is how often the in-memory Redis moves its clock on, expiring keys
+const memoryRedisTick = time.Second
+
+// NewMemoryRedisRepository creates a Redis repository on a Redis server embedded in the process,
+// for demo instances and as a test fixture. Keys expire as time passes, as on Redis.
+func NewMemoryRedisRepository() (*RedisRepository, error) {
+	server, err := miniredis.Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start in-memory Redis: %w", err)
+	}
+
+	// The embedded server only expires keys when told time passed
+	done := make(chan struct{})
+	async.Go(func() {
+		ticker := time.NewTicker(memoryRedisTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				server.FastForward(memoryRedisTick)
+			}
+		}
+	})
+
+	r := newRedisRepository(&config.RedisConfig{Addr: server.Addr()})
+	r.stopServer = func() {
+		close(done)
+		server.Close()
+	}
+	return r, nil
+}
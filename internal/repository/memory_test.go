@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"octopus/internal/model"
+	"octopus/pkg/clock"
+)
+
+func TestMemoryRepository_ShortLinks(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	repo.clock = clock.NewFake(now)
+
+	sl := &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/docs", URLHash: "u1", DedupHash: "d1", Title: "Docs"}
+	require.NoError(t, repo.SaveShortLink(ctx, sl))
+	assert.Equal(t, int64(1), sl.ID)
+	assert.Equal(t, 1, sl.Status)
+	assert.Equal(t, now, sl.CreatedAt)
+
+	// Short codes are unique
+	err := repo.SaveShortLink(ctx, &model.ShortLink{ShortCode: "ABCD"})
+	assert.ErrorIs(t, err, ErrConflict)
+
+	found, err := repo.GetShortLinkByDedupHash(ctx, "d1")
+	require.NoError(t, err)
+	assert.Equal(t, "ABCD", found.ShortCode)
+
+	// Returned links are copies
+	found.OriginalURL = "https://example.com/changed"
+	found, err = repo.GetShortLinkByCode(ctx, "ABCD")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/docs", found.OriginalURL)
+
+	require.NoError(t, repo.SaveShortLink(ctx, &model.ShortLink{ShortCode: "EFGH", OriginalURL: "https://example.com/blog", Notes: "docs blog"}))
+	links, err := repo.SearchShortLinks(ctx, &model.SearchQuery{Query: "docs blog"})
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	assert.Equal(t, "EFGH", links[0].ShortCode)
+
+	require.NoError(t, repo.DeactivateShortLink(ctx, "ABCD"))
+	_, err = repo.GetShortLinkByCode(ctx, "ABCD")
+	assert.ErrorIs(t, err, ErrNotFound)
+	exists, err := repo.CheckExistsByCode(ctx, "ABCD")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	links, err = repo.GetShortLinksByCodes(ctx, []string{"ABCD", "WXYZ"})
+	require.NoError(t, err)
+	assert.Len(t, links, 1)
+}
+
+func TestMemoryRepository_ApplyReplicatedShortLink(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+
+	// Links never seen are created even when disabled
+	applied, err := repo.ApplyReplicatedShortLink(ctx, &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/a", ReplicaVersion: 2})
+	require.NoError(t, err)
+	assert.True(t, applied)
+	links, err := repo.GetShortLinksByCodes(ctx, []string{"ABCD"})
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, 0, links[0].Status)
+
+	// Changes made before the applied one are skipped
+	applied, err = repo.ApplyReplicatedShortLink(ctx, &model.ShortLink{ShortCode: "ABCD", Status: 1, ReplicaVersion: 1})
+	require.NoError(t, err)
+	assert.False(t, applied)
+
+	applied, err = repo.ApplyReplicatedShortLink(ctx, &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/b", Status: 1, ReplicaVersion: 3})
+	require.NoError(t, err)
+	assert.True(t, applied)
+	sl, err := repo.GetShortLinkByCode(ctx, "ABCD")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/b", sl.OriginalURL)
+}
+
+func TestMemoryRepository_SetShortLinks(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	require.NoError(t, repo.SaveShortLink(ctx, &model.ShortLink{ShortCode: "ABCD", Params: json.RawMessage(`{"campaign":"spring"}`)}))
+	require.NoError(t, repo.SaveShortLink(ctx, &model.ShortLink{ShortCode: "EFGH", Params: json.RawMessage(`{"campaign":"spring"}`)}))
+	require.NoError(t, repo.SaveShortLink(ctx, &model.ShortLink{ShortCode: "JKLM", Params: json.RawMessage(`{"campaign":"fall"}`)}))
+	require.NoError(t, repo.DeactivateShortLink(ctx, "EFGH"))
+
+	// Links already in the requested state are left out
+	links, err := repo.SetShortLinksStatus(ctx, &model.LinkFilter{Param: "campaign", Value: "spring"}, 0)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "ABCD", links[0].ShortCode)
+	_, err = repo.GetShortLinkByCode(ctx, "ABCD")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	expireAt := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	links, err = repo.SetShortLinksExpiry(ctx, &model.LinkFilter{ShortCodes: []string{"EFGH", "JKLM"}}, &expireAt)
+	require.NoError(t, err)
+	assert.Len(t, links, 2)
+	links, err = repo.SetShortLinksExpiry(ctx, &model.LinkFilter{ShortCodes: []string{"JKLM"}}, &expireAt)
+	require.NoError(t, err)
+	assert.Empty(t, links)
+	links, err = repo.SetShortLinksExpiry(ctx, &model.LinkFilter{ShortCodes: []string{"JKLM"}}, nil)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Nil(t, links[0].ExpireAt)
+
+	// With an owner, links of others are left out
+	require.NoError(t, repo.SaveShortLink(ctx, &model.ShortLink{ShortCode: "NOPQ", Params: json.RawMessage(`{"campaign":"fall"}`), Owner: "owner-1"}))
+	links, err = repo.SetShortLinksExpiry(ctx, &model.LinkFilter{Param: "campaign", Value: "fall", Owner: "owner-1"}, &expireAt)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "NOPQ", links[0].ShortCode)
+}
+
+func TestMemoryRepository_RecordAccessLog(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	day := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, repo.SaveShortLink(ctx, &model.ShortLink{ShortCode: "ABCD", Params: json.RawMessage(`{"campaign":"launch"}`)}))
+
+	record := func(eventID, clientIP, source string, accessTime time.Time) bool {
+		recorded, err := repo.RecordAccessLog(ctx, &model.AccessLog{
+			EventID: &eventID, ShortCode: "ABCD", ClientIP: clientIP, Source: source, AccessTime: accessTime,
+		})
+		require.NoError(t, err)
+		return recorded
+	}
+	assert.True(t, record("e1", "10.0.0.1", "twitter", day.Add(9*time.Hour)))
+	assert.True(t, record("e2", "10.0.0.1", "twitter", day.Add(10*time.Hour)))
+	assert.True(t, record("e3", "10.0.0.2", "", day.Add(11*time.Hour)))
+	assert.True(t, record("e4", "10.0.0.1", "direct", day.Add(33*time.Hour)))
+	// Redelivered events are counted once
+	assert.False(t, record("e1", "10.0.0.1", "twitter", day.Add(9*time.Hour)))
+
+	stats, err := repo.GetDailyStats(ctx, "ABCD", day, day.Add(24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []model.DailyStat{
+		{ID: 1, ShortCode: "ABCD", Day: day, Clicks: 3, Visitors: 2},
+		{ID: 2, ShortCode: "ABCD", Day: day.AddDate(0, 0, 1), Clicks: 1, Visitors: 1},
+	}, stats)
+
+	sourceStats, err := repo.GetDailySourceStats(ctx, "ABCD", day, day)
+	require.NoError(t, err)
+	assert.Equal(t, []model.DailySourceStat{{ID: 1, ShortCode: "ABCD", Day: day, Source: "twitter", Clicks: 2}}, sourceStats)
+
+	campaignStats, err := repo.GetCampaignDailySourceStats(ctx, "campaign", day, day.Add(24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []model.CampaignDailySourceStat{
+		{Campaign: "launch", Day: day, Source: "twitter", Clicks: 2},
+		{Campaign: "launch", Day: day.AddDate(0, 0, 1), Source: "direct", Clicks: 1},
+	}, campaignStats)
+
+	campaignDaily, err := repo.GetCampaignDailyStats(ctx, "utm_campaign", day, day.Add(24*time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, campaignDaily)
+
+	// Imported clicks add to the aggregates without visitors
+	require.NoError(t, repo.AddDailyClicks(ctx, "ABCD", day, 40))
+	stats, err = repo.GetDailyStats(ctx, "ABCD", day, day)
+	require.NoError(t, err)
+	assert.Equal(t, []model.DailyStat{{ID: 1, ShortCode: "ABCD", Day: day, Clicks: 43, Visitors: 2}}, stats)
+
+	count, err := repo.CountAccessLogsBetween(ctx, "ABCD", day, day.Add(24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	// Visitors sharing an IP are told apart by their visitor IDs
+	other := "e5"
+	_, err = repo.RecordAccessLog(ctx, &model.AccessLog{
+		EventID: &other, ShortCode: "ABCD", ClientIP: "10.0.0.1", VisitorID: "10.0.0.1/3b5d5c3712955042", AccessTime: day.Add(12 * time.Hour),
+	})
+	require.NoError(t, err)
+	stats, err = repo.GetDailyStats(ctx, "ABCD", day, day)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats[0].Visitors)
+}
+
+func TestMemoryRepository_GetAccessLogs(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	accessTime := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	for _, offset := range []time.Duration{0, time.Minute, time.Minute, 2 * time.Minute} {
+		require.NoError(t, repo.SaveAccessLog(ctx, &model.AccessLog{ShortCode: "ABCD", Device: "mobile", AccessTime: accessTime.Add(offset)}))
+	}
+	require.NoError(t, repo.SaveAccessLog(ctx, &model.AccessLog{ShortCode: "EFGH", AccessTime: accessTime}))
+
+	logs, err := repo.GetAccessLogs(ctx, &model.AccessLogQuery{ShortCode: "ABCD", Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	assert.Equal(t, []int64{4, 3}, []int64{logs[0].ID, logs[1].ID})
+
+	// The next page starts after the cursor, ties broken by ID
+	logs, err = repo.GetAccessLogs(ctx, &model.AccessLogQuery{
+		ShortCode: "ABCD", Cursor: &model.AccessLogCursor{AccessTime: logs[1].AccessTime, ID: logs[1].ID},
+	})
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	assert.Equal(t, []int64{2, 1}, []int64{logs[0].ID, logs[1].ID})
+
+	logs, err = repo.GetAccessLogs(ctx, &model.AccessLogQuery{
+		ShortCode: "ABCD", Ascending: true, From: accessTime.Add(time.Minute), Device: "mobile",
+	})
+	require.NoError(t, err)
+	require.Len(t, logs, 3)
+	assert.Equal(t, int64(2), logs[0].ID)
+}
+
+func TestMemoryRepository_SaveConversion(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+
+	saved, err := repo.SaveConversion(ctx, &model.Conversion{ClickID: "c1", Event: "signup", ShortCode: "ABCD"})
+	require.NoError(t, err)
+	assert.True(t, saved)
+	saved, err = repo.SaveConversion(ctx, &model.Conversion{ClickID: "c1", Event: "signup", ShortCode: "ABCD"})
+	require.NoError(t, err)
+	assert.False(t, saved)
+	saved, err = repo.SaveConversion(ctx, &model.Conversion{ClickID: "c1", Event: "purchase", ShortCode: "ABCD"})
+	require.NoError(t, err)
+	assert.True(t, saved)
+}
+
+func TestMemoryRepository_Rules(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+
+	bot := &model.Rule{Kind: model.RuleKindBotUA, Pattern: "headlesschrome"}
+	require.NoError(t, repo.SaveRule(ctx, bot))
+	require.NoError(t, repo.SaveRule(ctx, &model.Rule{Kind: model.RuleKindBotUA, Pattern: "curl"}))
+	assert.ErrorIs(t, repo.SaveRule(ctx, &model.Rule{Kind: model.RuleKindBotUA, Pattern: "curl"}), ErrConflict)
+	// Patterns are unique per kind only
+	require.NoError(t, repo.SaveRule(ctx, &model.Rule{Kind: model.RuleKindReservedWord, Pattern: "curl"}))
+
+	bot.Pattern = "phantomjs"
+	require.NoError(t, repo.UpdateRule(ctx, bot))
+	assert.ErrorIs(t, repo.UpdateRule(ctx, &model.Rule{ID: 42, Kind: model.RuleKindBotUA, Pattern: "wget"}), ErrNotFound)
+
+	rules, err := repo.ListRules(ctx)
+	require.NoError(t, err)
+	require.Len(t, rules, 3)
+	assert.Equal(t, "curl", rules[0].Pattern)
+	assert.Equal(t, "phantomjs", rules[1].Pattern)
+	assert.Equal(t, model.RuleKindReservedWord, rules[2].Kind)
+
+	deleted, err := repo.DeleteRule(ctx, bot.ID)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = repo.DeleteRule(ctx, bot.ID)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+}
+
+func TestNewMemoryRedisRepository(t *testing.T) {
+	ctx := context.Background()
+	repo, err := NewMemoryRedisRepository()
+	require.NoError(t, err)
+
+	pv, err := repo.IncrementPV(ctx, "ABCD")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pv)
+
+	require.NoError(t, repo.Close())
+	_, err = repo.GetPV(ctx, "ABCD")
+	assert.Error(t, err)
+}
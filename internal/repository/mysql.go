@@ -2,13 +2,18 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"octopus/internal/config"
 	"octopus/internal/model"
+	"octopus/pkg/clock"
 
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -17,10 +22,13 @@ import (
 // MySQLRepository handles MySQL operations
 type MySQLRepository struct {
 	db *gorm.DB
+	// loc is the location the driver exchanges times in, the loc parameter of the DSN
+	loc   *time.Location
+	clock clock.Clock
 }
 
-// NewMySQLRepository creates a new MySQL repository
-func NewMySQLRepository(cfg *config.MySQLConfig) *MySQLRepository {
+// NewMySQLRepository connects to MySQL and migrates the tables
+func NewMySQLRepository(cfg *config.MySQLConfig) (*MySQLRepository, error) {
 	// Configure GORM logger
 	var gormLogger logger.Interface
 	if zerolog.GlobalLevel() > zerolog.DebugLevel {
@@ -29,24 +37,37 @@ func NewMySQLRepository(cfg *config.MySQLConfig) *MySQLRepository {
 		gormLogger = logger.Default.LogMode(logger.Info)
 	}
 
+	repo := &MySQLRepository{clock: clock.Real}
 	db, err := gorm.Open(mysql.Open(cfg.DSN), &gorm.Config{
 		Logger: gormLogger,
 		NowFunc: func() time.Time {
-			return time.Now().UTC()
+			return repo.clock.Now().UTC()
 		},
 	})
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to connect to MySQL")
+		// The connection pool is opened before the ping fails
+		if db != nil {
+			if sqlDB, dbErr := db.DB(); dbErr == nil {
+				sqlDB.Close()
+			}
+		}
+		return nil, fmt.Errorf("failed to connect to MySQL: %w", mysqlError(err))
+	}
+
+	repo.db = db
+	if dsn, err := mysqldriver.ParseDSN(cfg.DSN); err == nil {
+		repo.loc = dsn.Loc
 	}
 
 	// Auto migrate tables
-	if err := db.AutoMigrate(&model.ShortLink{}, &model.AccessLog{}); err != nil {
-		log.Fatal().Err(err).Msg("Failed to migrate database")
+	if err := db.AutoMigrate(&model.ShortLink{}, &model.AccessLog{}, &model.DailyStat{}, &model.DailySourceStat{}, &model.DailyVisitor{}, &model.Conversion{}, &model.Rule{}, &model.DomainReputation{}); err != nil {
+		repo.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
 	log.Info().Msg("MySQL connected successfully")
 
-	return &MySQLRepository{db: db}
+	return repo, nil
 }
 
 // GetDB returns the GORM DB instance
@@ -54,79 +75,742 @@ func (r *MySQLRepository) GetDB() *gorm.DB {
 	return r.db
 }
 
+// txKey keys in a context the transaction WithTx opened on a repository
+type txKey struct{ repo *MySQLRepository }
+
+// WithTx runs fn in a transaction, committed when fn returns nil and rolled back otherwise. The
+// calls fn makes on the repository with the context it is given join the transaction, as do the
+// WithTx calls nested in fn.
+func (r *MySQLRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{r}).(*gorm.DB); ok {
+		return fn(ctx)
+	}
+
+	// Errors of fn are returned as is, only those of the transaction itself are classified
+	var fnErr error
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		fnErr = fn(context.WithValue(ctx, txKey{r}, tx))
+		return fnErr
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return mysqlError(err)
+}
+
+// conn returns the transaction of a context on the repository, or the connection pool outside of
+// one
+func (r *MySQLRepository) conn(ctx context.Context) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{r}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return r.db.WithContext(ctx)
+}
+
 // SaveShortLink saves a short link to MySQL
 func (r *MySQLRepository) SaveShortLink(ctx context.Context, sl *model.ShortLink) error {
-	return r.db.WithContext(ctx).Create(sl).Error
+	return mysqlError(r.conn(ctx).Create(sl).Error)
 }
 
 // GetShortLinkByCode retrieves a short link by short code
 func (r *MySQLRepository) GetShortLinkByCode(ctx context.Context, shortCode string) (*model.ShortLink, error) {
 	var sl model.ShortLink
-	err := r.db.WithContext(ctx).
+	err := r.conn(ctx).
 		Where("short_code = ? AND status = 1", shortCode).
 		First(&sl).Error
 	if err != nil {
-		return nil, err
+		return nil, mysqlError(err)
 	}
 	return &sl, nil
 }
 
-// GetShortLinkByURL retrieves a short link by original URL (for deduplication)
-func (r *MySQLRepository) GetShortLinkByURL(ctx context.Context, url string) (*model.ShortLink, error) {
+// GetShortLinkByDedupHash retrieves a short link by the hash of its URL and params (for deduplication)
+func (r *MySQLRepository) GetShortLinkByDedupHash(ctx context.Context, dedupHash string) (*model.ShortLink, error) {
 	var sl model.ShortLink
-	err := r.db.WithContext(ctx).
-		Where("original_url = ? AND status = 1", url).
+	err := r.conn(ctx).
+		Where("dedup_hash = ? AND status = 1", dedupHash).
 		First(&sl).Error
 	if err != nil {
-		return nil, err
+		return nil, mysqlError(err)
 	}
 	return &sl, nil
 }
 
+// GetShortLinksByURLHash retrieves all active short links for a normalized URL hash
+func (r *MySQLRepository) GetShortLinksByURLHash(ctx context.Context, urlHash string) ([]model.ShortLink, error) {
+	var links []model.ShortLink
+	err := r.conn(ctx).
+		Where("url_hash = ? AND status = 1", urlHash).
+		Order("created_at ASC").
+		Find(&links).Error
+	return links, mysqlError(err)
+}
+
+// searchMatch ranks short links by relevance of their title, notes and URL, using the FULLTEXT index
+const searchMatch = "MATCH(title, notes, original_url) AGAINST (? IN NATURAL LANGUAGE MODE)"
+
+// SearchShortLinks retrieves short links matching a full-text query, most relevant first
+func (r *MySQLRepository) SearchShortLinks(ctx context.Context, q *model.SearchQuery) ([]model.ShortLink, error) {
+	var links []model.ShortLink
+	query := r.conn(ctx).
+		Where(searchMatch, q.Query).
+		Order(clause.OrderBy{Expression: clause.Expr{SQL: searchMatch + " DESC, id DESC", Vars: []interface{}{q.Query}}}).
+		Offset(q.Offset)
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+
+	err := query.Find(&links).Error
+	return links, mysqlError(err)
+}
+
+// GetShortLinksByCodes retrieves the short links of the given codes, whatever their status
+func (r *MySQLRepository) GetShortLinksByCodes(ctx context.Context, shortCodes []string) ([]model.ShortLink, error) {
+	var links []model.ShortLink
+	if len(shortCodes) == 0 {
+		return links, nil
+	}
+	err := r.conn(ctx).
+		Where("short_code IN ?", shortCodes).
+		Find(&links).Error
+	return links, mysqlError(err)
+}
+
+// GetShortLinksByFilter retrieves up to limit short links matching a filter, oldest first
+func (r *MySQLRepository) GetShortLinksByFilter(ctx context.Context, filter *model.LinkFilter, limit int) ([]model.ShortLink, error) {
+	var links []model.ShortLink
+	err := whereLinkFilter(r.conn(ctx), filter).
+		Order("id ASC").
+		Limit(limit).
+		Find(&links).Error
+	return links, mysqlError(err)
+}
+
+// GetManagedShortLinks retrieves the active short links of owner provisioned declaratively
+func (r *MySQLRepository) GetManagedShortLinks(ctx context.Context, owner string) ([]model.ShortLink, error) {
+	var links []model.ShortLink
+	err := r.conn(ctx).
+		Where("managed = ? AND status = 1 AND owner = ?", true, owner).
+		Order("short_code ASC").
+		Find(&links).Error
+	return links, mysqlError(err)
+}
+
 // CheckExistsByCode checks if a short code exists
 func (r *MySQLRepository) CheckExistsByCode(ctx context.Context, shortCode string) (bool, error) {
 	var count int64
-	err := r.db.WithContext(ctx).
+	err := r.conn(ctx).
 		Model(&model.ShortLink{}).
 		Where("short_code = ?", shortCode).
 		Count(&count).Error
-	return count > 0, err
+	return count > 0, mysqlError(err)
 }
 
 // SaveAccessLog saves an access log to MySQL
 func (r *MySQLRepository) SaveAccessLog(ctx context.Context, accessLog *model.AccessLog) error {
-	return r.db.WithContext(ctx).Create(accessLog).Error
+	return mysqlError(r.conn(ctx).Create(accessLog).Error)
 }
 
-// GetAccessLogs retrieves access logs for a short code
-func (r *MySQLRepository) GetAccessLogs(ctx context.Context, shortCode string, limit int) ([]model.AccessLog, error) {
+// RecordAccessLog saves an access log and counts it in the daily aggregates in one transaction,
+// returning false without counting when an access log with the same event ID was already recorded
+func (r *MySQLRepository) RecordAccessLog(ctx context.Context, accessLog *model.AccessLog) (bool, error) {
+	recorded := false
+	err := r.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(accessLog)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		recorded = true
+
+		// A visitor counts once per day, on its first access: the one inserting its row of the day
+		// in daily_visitors, later ones being ignored by the unique key. Access logs without a
+		// visitor ID, recorded before visitor strategies, are counted under their IP.
+		day := accessLog.AccessTime.UTC().Truncate(24 * time.Hour)
+		seen := tx.Clauses(clause.Insert{Modifier: "IGNORE"}).Create(&model.DailyVisitor{
+			ShortCode: accessLog.ShortCode, Day: r.dbDay(day), Visitor: accessLog.Visitor(),
+		})
+		if seen.Error != nil {
+			return seen.Error
+		}
+		var visitors int64
+		if seen.RowsAffected == 1 {
+			visitors = 1
+		}
+
+		if err := addDailyStat(tx, accessLog.ShortCode, r.dbDay(day), 1, visitors); err != nil {
+			return err
+		}
+		if accessLog.Source == "" {
+			return nil
+		}
+		return incrementDailySourceStat(tx, accessLog.ShortCode, r.dbDay(day), accessLog.Source)
+	})
+	return recorded, mysqlError(err)
+}
+
+// GetAccessLogs retrieves access logs for a short code, ordered by (access_time, id) and paged by cursor
+func (r *MySQLRepository) GetAccessLogs(ctx context.Context, q *model.AccessLogQuery) ([]model.AccessLog, error) {
 	var logs []model.AccessLog
-	query := r.db.WithContext(ctx).
-		Where("short_code = ?", shortCode).
-		Order("access_time DESC")
+	query := r.conn(ctx).
+		Where("short_code = ?", q.ShortCode)
+
+	if !q.From.IsZero() {
+		query = query.Where("access_time >= ?", q.From)
+	}
+	if !q.To.IsZero() {
+		query = query.Where("access_time < ?", q.To)
+	}
+	if q.Source != "" {
+		query = query.Where("source = ?", q.Source)
+	}
+	if q.Device != "" {
+		query = query.Where("device = ?", q.Device)
+	}
+
+	if q.Ascending {
+		if q.Cursor != nil {
+			query = query.Where("access_time > ? OR (access_time = ? AND id > ?)",
+				q.Cursor.AccessTime, q.Cursor.AccessTime, q.Cursor.ID)
+		}
+		query = query.Order("access_time ASC, id ASC")
+	} else {
+		if q.Cursor != nil {
+			query = query.Where("access_time < ? OR (access_time = ? AND id < ?)",
+				q.Cursor.AccessTime, q.Cursor.AccessTime, q.Cursor.ID)
+		}
+		query = query.Order("access_time DESC, id DESC")
+	}
 
-	if limit > 0 {
-		query = query.Limit(limit)
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
 	}
 
 	err := query.Find(&logs).Error
-	return logs, err
+	return logs, mysqlError(err)
+}
+
+// CountAccessLogsBetween counts the access logs of a short code within [from, to)
+func (r *MySQLRepository) CountAccessLogsBetween(ctx context.Context, shortCode string, from, to time.Time) (int64, error) {
+	var count int64
+	err := r.conn(ctx).
+		Model(&model.AccessLog{}).
+		Where("short_code = ? AND access_time >= ? AND access_time < ?", shortCode, from, to).
+		Count(&count).Error
+	return count, mysqlError(err)
+}
+
+// DeleteAccessLogs removes every access log of a short code
+func (r *MySQLRepository) DeleteAccessLogs(ctx context.Context, shortCode string) error {
+	return mysqlError(r.conn(ctx).
+		Where("short_code = ?", shortCode).
+		Delete(&model.AccessLog{}).Error)
+}
+
+// IncrementDailyStat adds one click to the daily aggregate of a short code
+func (r *MySQLRepository) IncrementDailyStat(ctx context.Context, shortCode string, day time.Time) error {
+	return mysqlError(addDailyStat(r.conn(ctx), shortCode, r.dbDay(day), 1, 0))
+}
+
+// AddDailyClicks adds clicks to the daily aggregate of a short code, without visitors, as when
+// seeding the clicks of links imported from another shortener
+func (r *MySQLRepository) AddDailyClicks(ctx context.Context, shortCode string, day time.Time, clicks int64) error {
+	return mysqlError(addDailyStat(r.conn(ctx), shortCode, r.dbDay(day), clicks, 0))
+}
+
+// dbDay returns the UTC day of t as midnight in the location of the connection, so the driver
+// stores the date of the UTC day whatever the loc of the DSN
+func (r *MySQLRepository) dbDay(t time.Time) time.Time {
+	loc := r.loc
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// utcDay returns the date of a DATE value, scanned at midnight in the location of the connection,
+// as a UTC day
+func utcDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// addDailyStat adds clicks and new visitors to the daily aggregate of a short code on the given
+// connection, day being converted by dbDay
+func addDailyStat(db *gorm.DB, shortCode string, day time.Time, clicks, visitors int64) error {
+	stat := &model.DailyStat{
+		ShortCode: shortCode,
+		Day:       day,
+		Clicks:    clicks,
+		Visitors:  visitors,
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "short_code"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"clicks":   gorm.Expr("clicks + ?", clicks),
+			"visitors": gorm.Expr("visitors + ?", visitors),
+		}),
+	}).Create(stat).Error
+}
+
+// incrementDailySourceStat adds one click to the daily aggregate of a short code's source, day
+// being converted by dbDay
+func incrementDailySourceStat(db *gorm.DB, shortCode string, day time.Time, source string) error {
+	stat := &model.DailySourceStat{
+		ShortCode: shortCode,
+		Day:       day,
+		Source:    source,
+		Clicks:    1,
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "short_code"}, {Name: "day"}, {Name: "source"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"clicks": gorm.Expr("clicks + ?", 1)}),
+	}).Create(stat).Error
+}
+
+// GetDailyStats retrieves the daily aggregates of a short code within [from, to]
+func (r *MySQLRepository) GetDailyStats(ctx context.Context, shortCode string, from, to time.Time) ([]model.DailyStat, error) {
+	var stats []model.DailyStat
+	err := r.conn(ctx).
+		Where("short_code = ? AND day >= ? AND day <= ?", shortCode, r.dbDay(from), r.dbDay(to)).
+		Order("day ASC").
+		Find(&stats).Error
+	for i := range stats {
+		stats[i].Day = utcDay(stats[i].Day)
+	}
+	return stats, mysqlError(err)
+}
+
+// GetDailySourceStats retrieves the daily per-source aggregates of a short code within [from, to]
+func (r *MySQLRepository) GetDailySourceStats(ctx context.Context, shortCode string, from, to time.Time) ([]model.DailySourceStat, error) {
+	var stats []model.DailySourceStat
+	err := r.conn(ctx).
+		Where("short_code = ? AND day >= ? AND day <= ?", shortCode, r.dbDay(from), r.dbDay(to)).
+		Order("day ASC").
+		Find(&stats).Error
+	for i := range stats {
+		stats[i].Day = utcDay(stats[i].Day)
+	}
+	return stats, mysqlError(err)
+}
+
+// GetCampaignDailyStats retrieves the daily aggregates within [from, to] of the links carrying the
+// given param, its value naming their campaign
+func (r *MySQLRepository) GetCampaignDailyStats(ctx context.Context, param string, from, to time.Time) ([]model.CampaignDailyStat, error) {
+	var stats []model.CampaignDailyStat
+	path := paramPath(param)
+	err := r.conn(ctx).
+		Table("daily_stats").
+		Select("JSON_UNQUOTE(JSON_EXTRACT(short_links.params, ?)) AS campaign, daily_stats.short_code, "+
+			"short_links.original_url, short_links.title, daily_stats.day, daily_stats.clicks, daily_stats.visitors", path).
+		Joins("JOIN short_links ON short_links.short_code = daily_stats.short_code").
+		Where("daily_stats.day >= ? AND daily_stats.day <= ? AND JSON_EXTRACT(short_links.params, ?) IS NOT NULL", r.dbDay(from), r.dbDay(to), path).
+		Scan(&stats).Error
+	for i := range stats {
+		stats[i].Day = utcDay(stats[i].Day)
+	}
+	return stats, mysqlError(err)
+}
+
+// GetCampaignDailySourceStats retrieves the daily per-source aggregates within [from, to] of the
+// links carrying the given param, summed per campaign
+func (r *MySQLRepository) GetCampaignDailySourceStats(ctx context.Context, param string, from, to time.Time) ([]model.CampaignDailySourceStat, error) {
+	var stats []model.CampaignDailySourceStat
+	path := paramPath(param)
+	err := r.conn(ctx).
+		Table("daily_source_stats").
+		Select("JSON_UNQUOTE(JSON_EXTRACT(short_links.params, ?)) AS campaign, daily_source_stats.day, "+
+			"daily_source_stats.source, SUM(daily_source_stats.clicks) AS clicks", path).
+		Joins("JOIN short_links ON short_links.short_code = daily_source_stats.short_code").
+		Where("daily_source_stats.day >= ? AND daily_source_stats.day <= ? AND JSON_EXTRACT(short_links.params, ?) IS NOT NULL", r.dbDay(from), r.dbDay(to), path).
+		Group("campaign, daily_source_stats.day, daily_source_stats.source").
+		Scan(&stats).Error
+	for i := range stats {
+		stats[i].Day = utcDay(stats[i].Day)
+	}
+	return stats, mysqlError(err)
+}
+
+// paramPath returns the JSON path of a link param
+func paramPath(param string) string {
+	return `$."` + param + `"`
+}
+
+// SaveConversion saves a conversion, returning false if the click already converted for the event
+func (r *MySQLRepository) SaveConversion(ctx context.Context, conversion *model.Conversion) (bool, error) {
+	result := r.conn(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(conversion)
+	if result.Error != nil {
+		return false, mysqlError(result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteStats removes the daily aggregates, daily visitors and conversions of a short code
+func (r *MySQLRepository) DeleteStats(ctx context.Context, shortCode string) error {
+	return r.WithTx(ctx, func(ctx context.Context) error {
+		for _, table := range []interface{}{&model.DailyStat{}, &model.DailySourceStat{}, &model.DailyVisitor{}, &model.Conversion{}} {
+			if err := r.conn(ctx).Where("short_code = ?", shortCode).Delete(table).Error; err != nil {
+				return mysqlError(err)
+			}
+		}
+		return nil
+	})
 }
 
 // GetTotalLinksCount returns the total count of short links
 func (r *MySQLRepository) GetTotalLinksCount(ctx context.Context) (int64, error) {
 	var count int64
-	err := r.db.WithContext(ctx).Model(&model.ShortLink{}).Count(&count).Error
-	return count, err
+	err := r.conn(ctx).Model(&model.ShortLink{}).Count(&count).Error
+	return count, mysqlError(err)
 }
 
 // CleanupExpiredLinks removes expired short links
 func (r *MySQLRepository) CleanupExpiredLinks(ctx context.Context) (int64, error) {
-	now := time.Now()
-	result := r.db.WithContext(ctx).
+	now := r.clock.Now()
+	result := r.conn(ctx).
 		Where("expire_at IS NOT NULL AND expire_at < ?", now).
 		Delete(&model.ShortLink{})
-	return result.RowsAffected, result.Error
+	return result.RowsAffected, mysqlError(result.Error)
+}
+
+// GetExpiredLinksByPool retrieves short links of a code pool that expired before the given time
+func (r *MySQLRepository) GetExpiredLinksByPool(ctx context.Context, pool string, before time.Time, limit int) ([]model.ShortLink, error) {
+	var links []model.ShortLink
+	err := r.conn(ctx).
+		Where("pool = ? AND expire_at IS NOT NULL AND expire_at < ?", pool, before).
+		Order("expire_at ASC").
+		Limit(limit).
+		Find(&links).Error
+	return links, mysqlError(err)
+}
+
+// GetExpiringShortLinks retrieves a page of the active short links with an owner expiring after from
+// and up to to, in ID order after afterID
+func (r *MySQLRepository) GetExpiringShortLinks(ctx context.Context, from, to time.Time, afterID int64, limit int) ([]model.ShortLink, error) {
+	var links []model.ShortLink
+	err := r.conn(ctx).
+		Where("status = 1 AND owner <> '' AND expire_at > ? AND expire_at <= ? AND id > ?", from, to, afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&links).Error
+	return links, mysqlError(err)
+}
+
+// DeleteShortLinkByCode permanently removes a short link by short code
+func (r *MySQLRepository) DeleteShortLinkByCode(ctx context.Context, shortCode string) error {
+	return mysqlError(r.conn(ctx).
+		Where("short_code = ?", shortCode).
+		Delete(&model.ShortLink{}).Error)
+}
+
+// DeactivateShortLink disables a short link, keeping it for inspection
+func (r *MySQLRepository) DeactivateShortLink(ctx context.Context, shortCode string) error {
+	return mysqlError(r.conn(ctx).
+		Model(&model.ShortLink{}).
+		Where("short_code = ?", shortCode).
+		Update("status", 0).Error)
+}
+
+// SetShortLinkOwner transfers a short link to an owner, identified by the hash of its API key
+func (r *MySQLRepository) SetShortLinkOwner(ctx context.Context, shortCode, owner string) error {
+	return mysqlError(r.conn(ctx).
+		Model(&model.ShortLink{}).
+		Where("short_code = ?", shortCode).
+		Update("owner", owner).Error)
+}
+
+// SetShortLinksStatus sets the status of the links matching a filter in one transaction and returns
+// the links it changed, with their new status
+func (r *MySQLRepository) SetShortLinksStatus(ctx context.Context, filter *model.LinkFilter, status int) ([]model.ShortLink, error) {
+	return r.updateShortLinks(ctx, filter, "status", status, func(sl *model.ShortLink) bool {
+		if sl.Status == status {
+			return false
+		}
+		sl.Status = status
+		return true
+	})
+}
+
+// SetShortLinksExpiry sets the expiry of the links matching a filter in one transaction, nil for
+// never, and returns the links it changed, with their new expiry
+func (r *MySQLRepository) SetShortLinksExpiry(ctx context.Context, filter *model.LinkFilter, expireAt *time.Time) ([]model.ShortLink, error) {
+	return r.updateShortLinks(ctx, filter, "expire_at", expireAt, func(sl *model.ShortLink) bool {
+		if sameTime(sl.ExpireAt, expireAt) {
+			return false
+		}
+		sl.ExpireAt = expireAt
+		return true
+	})
+}
+
+// updateShortLinks locks the links matching a filter, applies change to each and writes value to
+// column for the ones it changed, all in one transaction
+func (r *MySQLRepository) updateShortLinks(ctx context.Context, filter *model.LinkFilter, column string, value interface{},
+	change func(sl *model.ShortLink) bool) ([]model.ShortLink, error) {
+	changed := []model.ShortLink{}
+	err := r.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		query := whereLinkFilter(tx.Clauses(clause.Locking{Strength: "UPDATE"}), filter)
+		var links []model.ShortLink
+		if err := query.Order("id ASC").Find(&links).Error; err != nil {
+			return err
+		}
+
+		ids := []int64{}
+		for i := range links {
+			if change(&links[i]) {
+				changed = append(changed, links[i])
+				ids = append(ids, links[i].ID)
+			}
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		return tx.Model(&model.ShortLink{}).Where("id IN ?", ids).Update(column, value).Error
+	})
+	if err != nil {
+		return nil, mysqlError(err)
+	}
+	return changed, nil
+}
+
+// whereLinkFilter restricts a query to the links matching a filter
+func whereLinkFilter(query *gorm.DB, filter *model.LinkFilter) *gorm.DB {
+	if len(filter.ShortCodes) > 0 {
+		query = query.Where("short_code IN ?", filter.ShortCodes)
+	} else {
+		query = query.Where("JSON_UNQUOTE(JSON_EXTRACT(params, ?)) = ?", paramPath(filter.Param), filter.Value)
+	}
+	if filter.Owner != "" {
+		query = query.Where("owner = ?", filter.Owner)
+	}
+	return query
+}
+
+// sameTime checks if two optional times are both unset or the same instant
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// UpdateShortLink writes the destination, metadata and status of a short link
+func (r *MySQLRepository) UpdateShortLink(ctx context.Context, sl *model.ShortLink) error {
+	return mysqlError(r.conn(ctx).
+		Model(&model.ShortLink{}).
+		Where("short_code = ?", sl.ShortCode).
+		Updates(map[string]interface{}{
+			"original_url": sl.OriginalURL,
+			"url_hash":     sl.URLHash,
+			"title":        sl.Title,
+			"description":  sl.Description,
+			"notes":        sl.Notes,
+			"status":       sl.Status,
+			"expire_at":    sl.ExpireAt,
+		}).Error)
+}
+
+// UpdateShortLinkMetadata writes the title, description, notes, public stats, tracking,
+// Cache-Control, allowed referrers, country and schedule settings of a short link
+func (r *MySQLRepository) UpdateShortLinkMetadata(ctx context.Context, sl *model.ShortLink) error {
+	return mysqlError(r.conn(ctx).
+		Model(&model.ShortLink{}).
+		Where("short_code = ?", sl.ShortCode).
+		Updates(map[string]interface{}{
+			"title":         sl.Title,
+			"description":   sl.Description,
+			"notes":         sl.Notes,
+			"public_stats":  sl.PublicStats,
+			"no_tracking":   sl.NoTracking,
+			"cache_control": sl.CacheControl,
+			"referrers":     sl.Referrers,
+			"geo_allow":     sl.GeoAllow,
+			"geo_deny":      sl.GeoDeny,
+			"schedule":      sl.Schedule,
+		}).Error)
+}
+
+// ApplyReplicatedShortLink writes a link replicated from the primary region unless a change made
+// later on the primary was applied already, and reports whether it was written. Links never seen
+// are created even when disabled, so that changes arriving out of order cannot revive them.
+func (r *MySQLRepository) ApplyReplicatedShortLink(ctx context.Context, sl *model.ShortLink) (bool, error) {
+	applied := false
+	err := r.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		var current model.ShortLink
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("short_code = ?", sl.ShortCode).
+			Take(&current).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			applied = true
+			// Create replaces zero values by the column defaults, disabled links are disabled afterwards
+			disabled := sl.Status == 0
+			if err := tx.Create(sl).Error; err != nil {
+				return err
+			}
+			if disabled {
+				sl.Status = 0
+				return tx.Model(&model.ShortLink{}).Where("id = ?", sl.ID).Update("status", 0).Error
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if current.ReplicaVersion >= sl.ReplicaVersion {
+			return nil
+		}
+
+		applied = true
+		return tx.Model(&model.ShortLink{}).
+			Where("id = ?", current.ID).
+			Updates(map[string]interface{}{
+				"original_url":    sl.OriginalURL,
+				"url_hash":        sl.URLHash,
+				"pool":            sl.Pool,
+				"expire_at":       sl.ExpireAt,
+				"status":          sl.Status,
+				"no_click_id":     sl.NoClickID,
+				"max_clicks":      sl.MaxClicks,
+				"preserve_query":  sl.PreserveQuery,
+				"public_stats":    sl.PublicStats,
+				"no_tracking":     sl.NoTracking,
+				"cache_control":   sl.CacheControl,
+				"signed_params":   sl.SignedParams,
+				"single_use":      sl.SingleUse,
+				"referrers":       sl.Referrers,
+				"geo_allow":       sl.GeoAllow,
+				"geo_deny":        sl.GeoDeny,
+				"schedule":        sl.Schedule,
+				"params":          sl.Params,
+				"replica_version": sl.ReplicaVersion,
+			}).Error
+	})
+	if err != nil {
+		return false, mysqlError(err)
+	}
+	return applied, nil
+}
+
+// ListRules retrieves all the rules set at runtime, by kind and pattern
+func (r *MySQLRepository) ListRules(ctx context.Context) ([]model.Rule, error) {
+	var rules []model.Rule
+	err := r.conn(ctx).Order("kind, pattern").Find(&rules).Error
+	return rules, mysqlError(err)
+}
+
+// SaveRule saves a new rule, returning ErrConflict when its kind already has the pattern
+func (r *MySQLRepository) SaveRule(ctx context.Context, rule *model.Rule) error {
+	return mysqlError(r.conn(ctx).Create(rule).Error)
+}
+
+// UpdateRule replaces the kind, pattern and source of a rule, returning ErrNotFound when it does not
+// exist
+func (r *MySQLRepository) UpdateRule(ctx context.Context, rule *model.Rule) error {
+	result := r.conn(ctx).Model(&model.Rule{}).
+		Where("id = ?", rule.ID).
+		Updates(map[string]interface{}{
+			"kind":    rule.Kind,
+			"pattern": rule.Pattern,
+			"source":  rule.Source,
+		})
+	if result.Error != nil {
+		return mysqlError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return mysqlError(r.conn(ctx).First(&model.Rule{}, rule.ID).Error)
+	}
+	return nil
+}
+
+// DeleteRule removes a rule, reporting whether it existed
+func (r *MySQLRepository) DeleteRule(ctx context.Context, id int64) (bool, error) {
+	result := r.conn(ctx).Delete(&model.Rule{}, id)
+	return result.RowsAffected > 0, mysqlError(result.Error)
+}
+
+// TrackDomain counts a link created to a domain, keeping the destination of its first link as the
+// one to check, so that later links cannot point the checks elsewhere
+func (r *MySQLRepository) TrackDomain(ctx context.Context, domain, sampleURL string) error {
+	rep := &model.DomainReputation{Domain: domain, Links: 1, SampleURL: sampleURL}
+	return mysqlError(r.conn(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"links":      gorm.Expr("links + ?", 1),
+			"sample_url": gorm.Expr("IF(sample_url = '', ?, sample_url)", sampleURL),
+		}),
+	}).Create(rep).Error)
+}
+
+// AddDomainReport counts an abuse report of a link to a domain made at a time, counting again from
+// one when the last report was before since. Reports are counted before their time is set, MySQL
+// assigning in order.
+func (r *MySQLRepository) AddDomainReport(ctx context.Context, domain string, at, since time.Time) error {
+	rep := &model.DomainReputation{Domain: domain, Reports: 1, ReportedAt: &at}
+	return mysqlError(r.conn(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "reports"}, Value: gorm.Expr("IF(reported_at IS NULL OR reported_at < ?, 1, reports + 1)", since)},
+			{Column: clause.Column{Name: "reported_at"}, Value: at},
+		},
+	}).Create(rep).Error)
+}
+
+// RecordDomainCheck counts a check of a domain, dead when its link did not answer and flagged when
+// Safe Browsing lists it
+func (r *MySQLRepository) RecordDomainCheck(ctx context.Context, domain string, dead, flagged bool, at time.Time) error {
+	deadChecks := 0
+	if dead {
+		deadChecks = 1
+	}
+	return mysqlError(r.conn(ctx).
+		Model(&model.DomainReputation{}).
+		Where("domain = ?", domain).
+		Updates(map[string]interface{}{
+			"checks":      gorm.Expr("checks + ?", 1),
+			"dead_checks": gorm.Expr("dead_checks + ?", deadChecks),
+			"flagged":     flagged,
+			"checked_at":  at,
+		}).Error)
+}
+
+// SetDomainOverride sets the verdict of a domain whatever its score, empty to compute it again
+func (r *MySQLRepository) SetDomainOverride(ctx context.Context, domain, verdict string) error {
+	rep := &model.DomainReputation{Domain: domain, Override: verdict}
+	return mysqlError(r.conn(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{"override": verdict}),
+	}).Create(rep).Error)
+}
+
+// GetDomainReputation retrieves the reputation of a domain, ErrNotFound if it was never tracked
+func (r *MySQLRepository) GetDomainReputation(ctx context.Context, domain string) (*model.DomainReputation, error) {
+	var rep model.DomainReputation
+	if err := r.conn(ctx).Where("domain = ?", domain).First(&rep).Error; err != nil {
+		return nil, mysqlError(err)
+	}
+	return &rep, nil
+}
+
+// ListDomainReputations retrieves the domains with reports, dead checks, a Safe Browsing listing or
+// an override, by domain
+func (r *MySQLRepository) ListDomainReputations(ctx context.Context) ([]model.DomainReputation, error) {
+	var reps []model.DomainReputation
+	err := r.conn(ctx).
+		Where("reports > 0 OR dead_checks > 0 OR flagged = ? OR override <> ''", true).
+		Order("domain").
+		Find(&reps).Error
+	return reps, mysqlError(err)
+}
+
+// ListDomainsToCheck retrieves up to limit domains never checked or last checked before a time,
+// the least recently checked first
+func (r *MySQLRepository) ListDomainsToCheck(ctx context.Context, before time.Time, limit int) ([]model.DomainReputation, error) {
+	var reps []model.DomainReputation
+	err := r.conn(ctx).
+		Where("sample_url <> '' AND (checked_at IS NULL OR checked_at < ?)", before).
+		Order("checked_at IS NOT NULL, checked_at, domain").
+		Limit(limit).
+		Find(&reps).Error
+	return reps, mysqlError(err)
 }
 
 // Close closes the database connection
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"regexp"
 	"testing"
 	"time"
@@ -13,6 +15,7 @@ import (
 	"gorm.io/gorm"
 
 	"octopus/internal/model"
+	"octopus/pkg/clock"
 )
 
 func newTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
@@ -95,42 +98,107 @@ func TestMySQLRepository_GetShortLinkByCode(t *testing.T) {
 		sl, err := repo.GetShortLinkByCode(ctx, "NONEXIST")
 		assert.Error(t, err)
 		assert.Nil(t, sl)
-		assert.Equal(t, gorm.ErrRecordNotFound, err)
+		assert.ErrorIs(t, err, ErrNotFound)
 	})
 }
 
-func TestMySQLRepository_GetShortLinkByURL(t *testing.T) {
+func TestMySQLRepository_GetShortLinkByDedupHash(t *testing.T) {
 	db, mock := newTestDB(t)
 
 	repo := &MySQLRepository{db: db}
 	ctx := context.Background()
 
-	t.Run("get by existing URL", func(t *testing.T) {
+	t.Run("get by existing hash", func(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"id", "short_code", "original_url", "params", "created_at", "expire_at", "status"}).
 			AddRow(1, "ABCD", "https://example.com", nil, time.Now(), nil, 1)
 
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `short_links` WHERE original_url = ? AND status = 1 ORDER BY `short_links`.`id` LIMIT ?")).
-			WithArgs("https://example.com", 1).
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `short_links` WHERE dedup_hash = ? AND status = 1 ORDER BY `short_links`.`id` LIMIT ?")).
+			WithArgs("hash1", 1).
 			WillReturnRows(rows)
 
-		sl, err := repo.GetShortLinkByURL(ctx, "https://example.com")
+		sl, err := repo.GetShortLinkByDedupHash(ctx, "hash1")
 		assert.NoError(t, err)
 		assert.NotNil(t, sl)
 		assert.Equal(t, "ABCD", sl.ShortCode)
 	})
 
-	t.Run("get by non-existent URL", func(t *testing.T) {
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `short_links` WHERE original_url = ? AND status = 1 ORDER BY `short_links`.`id` LIMIT ?")).
-			WithArgs("https://nonexistent.com", 1).
+	t.Run("get by non-existent hash", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `short_links` WHERE dedup_hash = ? AND status = 1 ORDER BY `short_links`.`id` LIMIT ?")).
+			WithArgs("hash2", 1).
 			WillReturnError(gorm.ErrRecordNotFound)
 
-		sl, err := repo.GetShortLinkByURL(ctx, "https://nonexistent.com")
+		sl, err := repo.GetShortLinkByDedupHash(ctx, "hash2")
 		assert.Error(t, err)
 		assert.Nil(t, sl)
-		assert.Equal(t, gorm.ErrRecordNotFound, err)
+		assert.ErrorIs(t, err, ErrNotFound)
 	})
 }
 
+func TestMySQLRepository_SearchShortLinks(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+
+	rows := sqlmock.NewRows([]string{"id", "short_code", "original_url", "title", "status"}).
+		AddRow(2, "EFGH", "https://example.com/spring", "Spring sale", 1).
+		AddRow(1, "ABCD", "https://example.com/sale", "", 1)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `short_links` WHERE MATCH(title, notes, original_url) AGAINST (? IN NATURAL LANGUAGE MODE) " +
+		"ORDER BY MATCH(title, notes, original_url) AGAINST (? IN NATURAL LANGUAGE MODE) DESC, id DESC LIMIT ? OFFSET ?")).
+		WithArgs("spring sale", "spring sale", 21, 20).
+		WillReturnRows(rows)
+
+	links, err := repo.SearchShortLinks(ctx, &model.SearchQuery{Query: "spring sale", Offset: 20, Limit: 21})
+	assert.NoError(t, err)
+	assert.Len(t, links, 2)
+	assert.Equal(t, "EFGH", links[0].ShortCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLRepository_GetShortLinksByCodes(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+
+	rows := sqlmock.NewRows([]string{"id", "short_code", "original_url", "status", "managed"}).
+		AddRow(1, "DOCS", "https://docs.example.com", 0, true)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `short_links` WHERE short_code IN (?,?)")).
+		WithArgs("DOCS", "STAT").
+		WillReturnRows(rows)
+
+	links, err := repo.GetShortLinksByCodes(ctx, []string{"DOCS", "STAT"})
+	assert.NoError(t, err)
+	assert.Len(t, links, 1)
+	assert.True(t, links[0].Managed)
+
+	links, err = repo.GetShortLinksByCodes(ctx, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, links)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLRepository_GetManagedShortLinks(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+
+	rows := sqlmock.NewRows([]string{"id", "short_code", "original_url", "status", "managed"}).
+		AddRow(1, "DOCS", "https://docs.example.com", 1, true)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `short_links` WHERE managed = ? AND status = 1 AND owner = ? ORDER BY short_code ASC")).
+		WithArgs(true, "").
+		WillReturnRows(rows)
+
+	links, err := repo.GetManagedShortLinks(ctx, "")
+	assert.NoError(t, err)
+	assert.Len(t, links, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestMySQLRepository_CheckExistsByCode(t *testing.T) {
 	db, mock := newTestDB(t)
 
@@ -185,6 +253,80 @@ func TestMySQLRepository_SaveAccessLog(t *testing.T) {
 	})
 }
 
+func TestMySQLRepository_RecordAccessLog(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+	eventID := "3f2a9c1e-0000-4000-8000-000000000001"
+	accessTime := time.Date(2024, 3, 1, 15, 30, 0, 0, time.UTC)
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("new event is saved and counted", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `access_logs`")).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `daily_visitors` (`short_code`,`day`,`visitor`) VALUES (?,?,?)")).
+			WithArgs("ABCD", day, "1.1.1.1").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `daily_stats`")).
+			WithArgs("ABCD", day, 1, 1, 1, 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `daily_source_stats` (`short_code`,`day`,`source`,`clicks`) VALUES (?,?,?,?) ON DUPLICATE KEY UPDATE `clicks`=clicks + ?")).
+			WithArgs("ABCD", day, "google", 1, 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		recorded, err := repo.RecordAccessLog(ctx, &model.AccessLog{EventID: &eventID, ShortCode: "ABCD", ClientIP: "1.1.1.1", Source: "google", AccessTime: accessTime})
+		assert.NoError(t, err)
+		assert.True(t, recorded)
+	})
+
+	t.Run("returning visitor is counted as a click only", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `access_logs`")).
+			WillReturnResult(sqlmock.NewResult(3, 1))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `daily_visitors`")).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `daily_stats`")).
+			WithArgs("ABCD", day, 1, 0, 1, 0).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		recorded, err := repo.RecordAccessLog(ctx, &model.AccessLog{EventID: &eventID, ShortCode: "ABCD", ClientIP: "1.1.1.1", AccessTime: accessTime})
+		assert.NoError(t, err)
+		assert.True(t, recorded)
+	})
+
+	t.Run("redelivered event is not counted again", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `access_logs`")).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		recorded, err := repo.RecordAccessLog(ctx, &model.AccessLog{EventID: &eventID, ShortCode: "ABCD", AccessTime: accessTime})
+		assert.NoError(t, err)
+		assert.False(t, recorded)
+	})
+
+	t.Run("failed aggregation rolls back the access log", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `access_logs`")).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `daily_visitors`")).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `daily_stats`")).
+			WillReturnError(assert.AnError)
+		mock.ExpectRollback()
+
+		_, err := repo.RecordAccessLog(ctx, &model.AccessLog{EventID: &eventID, ShortCode: "ABCD", AccessTime: accessTime})
+		assert.Error(t, err)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestMySQLRepository_GetAccessLogs(t *testing.T) {
 	db, mock := newTestDB(t)
 
@@ -197,11 +339,11 @@ func TestMySQLRepository_GetAccessLogs(t *testing.T) {
 			AddRow(1, "ABCD", "192.168.1.1", "Mozilla/5.0", "https://google.com", "google", now).
 			AddRow(2, "ABCD", "192.168.1.2", "Safari", "https://baidu.com", "baidu", now.Add(-time.Hour))
 
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `access_logs` WHERE short_code = ? ORDER BY access_time DESC LIMIT ?")).
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `access_logs` WHERE short_code = ? ORDER BY access_time DESC, id DESC LIMIT ?")).
 			WithArgs("ABCD", 10).
 			WillReturnRows(rows)
 
-		logs, err := repo.GetAccessLogs(ctx, "ABCD", 10)
+		logs, err := repo.GetAccessLogs(ctx, &model.AccessLogQuery{ShortCode: "ABCD", Limit: 10})
 		assert.NoError(t, err)
 		assert.Len(t, logs, 2)
 		assert.Equal(t, "ABCD", logs[0].ShortCode)
@@ -212,13 +354,36 @@ func TestMySQLRepository_GetAccessLogs(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"id", "short_code", "client_ip", "user_agent", "referer", "source", "access_time"}).
 			AddRow(1, "ABCD", "192.168.1.1", "Mozilla/5.0", "https://google.com", "google", now)
 
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `access_logs` WHERE short_code = ? ORDER BY access_time DESC")).
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `access_logs` WHERE short_code = ? ORDER BY access_time DESC, id DESC")).
 			WithArgs("ABCD").
 			WillReturnRows(rows)
 
-		logs, err := repo.GetAccessLogs(ctx, "ABCD", 0)
+		logs, err := repo.GetAccessLogs(ctx, &model.AccessLogQuery{ShortCode: "ABCD"})
+		assert.NoError(t, err)
+		assert.Len(t, logs, 1)
+	})
+
+	t.Run("get access logs with filters and cursor", func(t *testing.T) {
+		from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cursorTime := from.Add(time.Hour)
+		rows := sqlmock.NewRows([]string{"id", "short_code", "source", "device", "access_time"}).
+			AddRow(8, "ABCD", "google", "mobile", from.Add(30*time.Minute))
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `access_logs` WHERE short_code = ? AND access_time >= ? AND source = ? AND device = ? AND (access_time < ? OR (access_time = ? AND id < ?)) ORDER BY access_time DESC, id DESC LIMIT ?")).
+			WithArgs("ABCD", from, "google", "mobile", cursorTime, cursorTime, int64(9), 5).
+			WillReturnRows(rows)
+
+		logs, err := repo.GetAccessLogs(ctx, &model.AccessLogQuery{
+			ShortCode: "ABCD",
+			From:      from,
+			Source:    "google",
+			Device:    "mobile",
+			Cursor:    &model.AccessLogCursor{AccessTime: cursorTime, ID: 9},
+			Limit:     5,
+		})
 		assert.NoError(t, err)
 		assert.Len(t, logs, 1)
+		assert.Equal(t, "mobile", logs[0].Device)
 	})
 }
 
@@ -254,12 +419,14 @@ func TestMySQLRepository_GetTotalLinksCount(t *testing.T) {
 func TestMySQLRepository_CleanupExpiredLinks(t *testing.T) {
 	db, mock := newTestDB(t)
 
-	repo := &MySQLRepository{db: db}
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	repo := &MySQLRepository{db: db, clock: clock.NewFake(now)}
 	ctx := context.Background()
 
 	t.Run("cleanup expired links", func(t *testing.T) {
 		mock.ExpectBegin()
 		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `short_links` WHERE expire_at IS NOT NULL AND expire_at < ?")).
+			WithArgs(now).
 			WillReturnResult(sqlmock.NewResult(0, 5))
 		mock.ExpectCommit()
 
@@ -301,3 +468,621 @@ func TestMySQLRepository_Close(t *testing.T) {
 	// Verify all expectations were met
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestMySQLRepository_GetExpiredLinksByPool(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+
+	rows := sqlmock.NewRows([]string{"id", "short_code", "original_url", "expire_at", "status", "pool"}).
+		AddRow(1, "ABCD", "https://example.com", time.Now().Add(-time.Hour), 1, "sms")
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `short_links` WHERE pool = ? AND expire_at IS NOT NULL AND expire_at < ? ORDER BY expire_at ASC LIMIT ?")).
+		WithArgs("sms", sqlmock.AnyArg(), 10).
+		WillReturnRows(rows)
+
+	links, err := repo.GetExpiredLinksByPool(ctx, "sms", time.Now(), 10)
+	assert.NoError(t, err)
+	assert.Len(t, links, 1)
+	assert.Equal(t, "sms", links[0].Pool)
+}
+
+func TestMySQLRepository_GetExpiringShortLinks(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+	now := time.Now()
+
+	rows := sqlmock.NewRows([]string{"id", "short_code", "original_url", "expire_at", "status", "owner"}).
+		AddRow(1, "ABCD", "https://example.com", now.Add(time.Hour), 1, "owner")
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `short_links` WHERE status = 1 AND owner <> '' AND expire_at > ? AND expire_at <= ? AND id > ? ORDER BY id ASC LIMIT ?")).
+		WithArgs(now, now.Add(72*time.Hour), 0, 100).
+		WillReturnRows(rows)
+
+	links, err := repo.GetExpiringShortLinks(ctx, now, now.Add(72*time.Hour), 0, 100)
+	assert.NoError(t, err)
+	assert.Len(t, links, 1)
+	assert.Equal(t, "owner", links[0].Owner)
+}
+
+func TestMySQLRepository_DeleteShortLinkByCode(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `short_links` WHERE short_code = ?")).
+		WithArgs("ABCD").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := repo.DeleteShortLinkByCode(ctx, "ABCD")
+	assert.NoError(t, err)
+}
+
+func TestMySQLRepository_DeleteStats(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	for _, table := range []string{"daily_stats", "daily_source_stats", "daily_visitors", "conversions"} {
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `" + table + "` WHERE short_code = ?")).
+			WithArgs("ABCD").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+	}
+	mock.ExpectCommit()
+
+	assert.NoError(t, repo.DeleteStats(ctx, "ABCD"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLRepository_DeactivateShortLink(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `short_links` SET `status`=? WHERE short_code = ?")).
+		WithArgs(0, "ABCD").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := repo.DeactivateShortLink(ctx, "ABCD")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLRepository_WithTx(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("commits the writes together", func(t *testing.T) {
+		db, mock := newTestDB(t)
+		repo := &MySQLRepository{db: db}
+
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE `short_links` SET `status`=? WHERE short_code = ?")).
+			WithArgs(0, "ABCD").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE `short_links` SET `owner`=? WHERE short_code = ?")).
+			WithArgs("5e884898da28", "EFGH").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := repo.WithTx(ctx, func(ctx context.Context) error {
+			if err := repo.DeactivateShortLink(ctx, "ABCD"); err != nil {
+				return err
+			}
+			// Nested calls join the transaction
+			return repo.WithTx(ctx, func(ctx context.Context) error {
+				return repo.SetShortLinkOwner(ctx, "EFGH", "5e884898da28")
+			})
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rolls back on error", func(t *testing.T) {
+		errLockWait := errors.New("lock wait timeout exceeded")
+		db, mock := newTestDB(t)
+		repo := &MySQLRepository{db: db}
+
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE `short_links` SET `status`=? WHERE short_code = ?")).
+			WithArgs(0, "ABCD").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE `short_links` SET `owner`=? WHERE short_code = ?")).
+			WithArgs("5e884898da28", "EFGH").
+			WillReturnError(errLockWait)
+		mock.ExpectRollback()
+
+		err := repo.WithTx(ctx, func(ctx context.Context) error {
+			if err := repo.DeactivateShortLink(ctx, "ABCD"); err != nil {
+				return err
+			}
+			return repo.SetShortLinkOwner(ctx, "EFGH", "5e884898da28")
+		})
+		assert.ErrorIs(t, err, errLockWait)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMySQLRepository_SetShortLinkOwner(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `short_links` SET `owner`=? WHERE short_code = ?")).
+		WithArgs("5e884898da28", "ABCD").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := repo.SetShortLinkOwner(ctx, "ABCD", "5e884898da28")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLRepository_TrackDomain(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `domain_reputation` (`domain`,`links`,`reports`,`reported_at`,`checks`,`dead_checks`,`flagged`,`sample_url`,`override`,`checked_at`,`updated_at`) VALUES (?,?,?,?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE `links`=links + ?,`sample_url`=IF(sample_url = '', ?, sample_url)")).
+		WithArgs("example.com", 1, 0, nil, 0, 0, false, "https://example.com/a", "", nil, sqlmock.AnyArg(), 1, "https://example.com/a").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := repo.TrackDomain(ctx, "example.com", "https://example.com/a")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLRepository_AddDomainReport(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	since := at.Add(-24 * time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `domain_reputation` (`domain`,`links`,`reports`,`reported_at`,`checks`,`dead_checks`,`flagged`,`sample_url`,`override`,`checked_at`,`updated_at`) VALUES (?,?,?,?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE `reports`=IF(reported_at IS NULL OR reported_at < ?, 1, reports + 1),`reported_at`=?")).
+		WithArgs("example.com", 0, 1, at, 0, 0, false, "", "", nil, sqlmock.AnyArg(), since, at).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := repo.AddDomainReport(ctx, "example.com", at, since)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLRepository_UpdateShortLinkMetadata(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+	schedule := json.RawMessage(`{"rules":[{"days":"sat,sun","url":"https://example.com/closed"}]}`)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `short_links` SET `cache_control`=?,`description`=?,`geo_allow`=?,`geo_deny`=?,`no_tracking`=?,`notes`=?,`public_stats`=?,`referrers`=?,`schedule`=?,`title`=? WHERE short_code = ?")).
+		WithArgs("public, max-age=300", "Newsletter banner", "", "DE,AT", true, "", true, "news.example.com", schedule, "Spring sale", "ABCD").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := repo.UpdateShortLinkMetadata(ctx, &model.ShortLink{ShortCode: "ABCD", Title: "Spring sale", Description: "Newsletter banner", PublicStats: true, NoTracking: true, CacheControl: "public, max-age=300", Referrers: "news.example.com", GeoDeny: "DE,AT", Schedule: schedule})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLRepository_ApplyReplicatedShortLink(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+	selectLocked := regexp.QuoteMeta("SELECT * FROM `short_links` WHERE short_code = ?") + ".*FOR UPDATE"
+	columns := []string{"id", "short_code", "original_url", "status", "replica_version"}
+
+	t.Run("creates a link never seen", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectLocked).WillReturnRows(sqlmock.NewRows(columns))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `short_links`")).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		applied, err := repo.ApplyReplicatedShortLink(ctx, &model.ShortLink{
+			ShortCode: "ABCD", OriginalURL: "https://example.com", Status: 1, ReplicaVersion: 200,
+		})
+		assert.NoError(t, err)
+		assert.True(t, applied)
+	})
+
+	t.Run("creates a disabled link never seen", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectLocked).WillReturnRows(sqlmock.NewRows(columns))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `short_links`")).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE `short_links` SET `status`=? WHERE id = ?")).
+			WithArgs(0, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		applied, err := repo.ApplyReplicatedShortLink(ctx, &model.ShortLink{
+			ShortCode: "EFGH", OriginalURL: "https://example.com", ReplicaVersion: 200,
+		})
+		assert.NoError(t, err)
+		assert.True(t, applied)
+	})
+
+	t.Run("updates a link changed later", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectLocked).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "ABCD", "https://example.com", 1, 200))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE `short_links` SET")).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		applied, err := repo.ApplyReplicatedShortLink(ctx, &model.ShortLink{
+			ShortCode: "ABCD", OriginalURL: "https://example.org", Status: 1, ReplicaVersion: 300,
+		})
+		assert.NoError(t, err)
+		assert.True(t, applied)
+	})
+
+	t.Run("skips a stale change", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectLocked).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "ABCD", "https://example.org", 1, 300))
+		mock.ExpectCommit()
+
+		applied, err := repo.ApplyReplicatedShortLink(ctx, &model.ShortLink{
+			ShortCode: "ABCD", OriginalURL: "https://example.com", Status: 1, ReplicaVersion: 200,
+		})
+		assert.NoError(t, err)
+		assert.False(t, applied)
+	})
+
+	t.Run("failure rolls back", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectLocked).WillReturnError(assert.AnError)
+		mock.ExpectRollback()
+
+		applied, err := repo.ApplyReplicatedShortLink(ctx, &model.ShortLink{ShortCode: "ABCD", ReplicaVersion: 400})
+		assert.Error(t, err)
+		assert.False(t, applied)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLRepository_SetShortLinks(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+	columns := []string{"id", "short_code", "status", "expire_at"}
+
+	t.Run("disables the links of short codes still active", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `short_links` WHERE short_code IN (?,?,?)")+".*FOR UPDATE").
+			WithArgs("ABCD", "EFGH", "WXYZ").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "ABCD", 1, nil).AddRow(2, "EFGH", 0, nil))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE `short_links` SET `status`=? WHERE id IN (?)")).
+			WithArgs(0, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		links, err := repo.SetShortLinksStatus(ctx, &model.LinkFilter{ShortCodes: []string{"ABCD", "EFGH", "WXYZ"}}, 0)
+		require.NoError(t, err)
+		require.Len(t, links, 1)
+		assert.Equal(t, "ABCD", links[0].ShortCode)
+		assert.Equal(t, 0, links[0].Status)
+	})
+
+	t.Run("sets the expiry of the links of a campaign", func(t *testing.T) {
+		expireAt := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `short_links` WHERE JSON_UNQUOTE(JSON_EXTRACT(params, ?)) = ?")+".*FOR UPDATE").
+			WithArgs(`$."campaign"`, "spring").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "ABCD", 1, expireAt).AddRow(2, "EFGH", 1, nil))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE `short_links` SET `expire_at`=? WHERE id IN (?)")).
+			WithArgs(expireAt, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		links, err := repo.SetShortLinksExpiry(ctx, &model.LinkFilter{Param: "campaign", Value: "spring"}, &expireAt)
+		require.NoError(t, err)
+		require.Len(t, links, 1)
+		assert.Equal(t, "EFGH", links[0].ShortCode)
+	})
+
+	t.Run("failure rolls back", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT").WillReturnError(assert.AnError)
+		mock.ExpectRollback()
+
+		_, err := repo.SetShortLinksStatus(ctx, &model.LinkFilter{ShortCodes: []string{"ABCD"}}, 1)
+		assert.Error(t, err)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLRepository_CountAccessLogsBetween(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+	from := time.Now().Add(-time.Hour)
+	to := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM `access_logs` WHERE short_code = ? AND access_time >= ? AND access_time < ?")).
+		WithArgs("ABCD", from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+
+	count, err := repo.CountAccessLogsBetween(ctx, "ABCD", from, to)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), count)
+}
+
+func TestMySQLRepository_IncrementDailyStat(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `daily_stats` (`short_code`,`day`,`clicks`,`visitors`) VALUES (?,?,?,?) ON DUPLICATE KEY UPDATE `clicks`=clicks + ?,`visitors`=visitors + ?")).
+		WithArgs("ABCD", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), 1, 0, 1, 0).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := repo.IncrementDailyStat(ctx, "ABCD", time.Date(2024, 3, 1, 15, 30, 0, 0, time.UTC))
+	assert.NoError(t, err)
+}
+
+func TestMySQLRepository_AddDailyClicks(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `daily_stats` (`short_code`,`day`,`clicks`,`visitors`) VALUES (?,?,?,?) ON DUPLICATE KEY UPDATE `clicks`=clicks + ?,`visitors`=visitors + ?")).
+		WithArgs("ABCD", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), 42, 0, 42, 0).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := repo.AddDailyClicks(ctx, "ABCD", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), 42)
+	assert.NoError(t, err)
+}
+
+func TestMySQLRepository_GetDailyStats(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC)
+
+	rows := sqlmock.NewRows([]string{"id", "short_code", "day", "clicks"}).
+		AddRow(1, "ABCD", from, 10).
+		AddRow(2, "ABCD", from.AddDate(0, 0, 1), 5)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `daily_stats` WHERE short_code = ? AND day >= ? AND day <= ? ORDER BY day ASC")).
+		WithArgs("ABCD", from, to).
+		WillReturnRows(rows)
+
+	stats, err := repo.GetDailyStats(ctx, "ABCD", from, to)
+	assert.NoError(t, err)
+	assert.Len(t, stats, 2)
+	assert.Equal(t, int64(10), stats[0].Clicks)
+}
+
+func TestMySQLRepository_DailyStatsLocation(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	// A DSN with loc=Local on an instance west of UTC
+	newYork := time.FixedZone("EST", -5*3600)
+	repo := &MySQLRepository{db: db, loc: newYork}
+	ctx := context.Background()
+
+	// The UTC day is sent as midnight in the location, which the driver formats to the same date
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `daily_stats`")).
+		WithArgs("ABCD", time.Date(2024, 3, 1, 0, 0, 0, 0, newYork), 1, 0, 1, 0).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	require.NoError(t, repo.IncrementDailyStat(ctx, "ABCD", time.Date(2024, 3, 1, 23, 30, 0, 0, time.UTC)))
+
+	// Dates scanned at midnight in the location are read back as UTC days
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `daily_stats` WHERE short_code = ? AND day >= ? AND day <= ? ORDER BY day ASC")).
+		WithArgs("ABCD", time.Date(2024, 3, 1, 0, 0, 0, 0, newYork), time.Date(2024, 3, 7, 0, 0, 0, 0, newYork)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "short_code", "day", "clicks"}).
+			AddRow(1, "ABCD", time.Date(2024, 3, 1, 0, 0, 0, 0, newYork), 10))
+
+	stats, err := repo.GetDailyStats(ctx, "ABCD", from, from.AddDate(0, 0, 6))
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.Equal(t, from, stats[0].Day)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLRepository_GetDailySourceStats(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC)
+
+	rows := sqlmock.NewRows([]string{"id", "short_code", "day", "source", "clicks"}).
+		AddRow(1, "ABCD", from, "google", 4).
+		AddRow(2, "ABCD", from, "direct", 1)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `daily_source_stats` WHERE short_code = ? AND day >= ? AND day <= ? ORDER BY day ASC")).
+		WithArgs("ABCD", from, to).
+		WillReturnRows(rows)
+
+	stats, err := repo.GetDailySourceStats(ctx, "ABCD", from, to)
+	assert.NoError(t, err)
+	assert.Len(t, stats, 2)
+	assert.Equal(t, "google", stats[0].Source)
+	assert.Equal(t, int64(4), stats[0].Clicks)
+}
+
+func TestMySQLRepository_GetCampaignDailyStats(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC)
+
+	rows := sqlmock.NewRows([]string{"campaign", "short_code", "original_url", "title", "day", "clicks", "visitors"}).
+		AddRow("spring2024", "ABCD", "https://example.com", "Sale", from, 10, 4)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT JSON_UNQUOTE(JSON_EXTRACT(short_links.params, ?)) AS campaign, daily_stats.short_code, " +
+		"short_links.original_url, short_links.title, daily_stats.day, daily_stats.clicks, daily_stats.visitors FROM `daily_stats` " +
+		"JOIN short_links ON short_links.short_code = daily_stats.short_code " +
+		"WHERE daily_stats.day >= ? AND daily_stats.day <= ? AND JSON_EXTRACT(short_links.params, ?) IS NOT NULL")).
+		WithArgs(`$."campaign"`, from, to, `$."campaign"`).
+		WillReturnRows(rows)
+
+	stats, err := repo.GetCampaignDailyStats(ctx, "campaign", from, to)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.CampaignDailyStat{
+		{Campaign: "spring2024", ShortCode: "ABCD", OriginalURL: "https://example.com", Title: "Sale", Day: from, Clicks: 10, Visitors: 4},
+	}, stats)
+}
+
+func TestMySQLRepository_GetCampaignDailySourceStats(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC)
+
+	rows := sqlmock.NewRows([]string{"campaign", "day", "source", "clicks"}).
+		AddRow("spring2024", from, "google", 7)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT JSON_UNQUOTE(JSON_EXTRACT(short_links.params, ?)) AS campaign, daily_source_stats.day, " +
+		"daily_source_stats.source, SUM(daily_source_stats.clicks) AS clicks FROM `daily_source_stats` " +
+		"JOIN short_links ON short_links.short_code = daily_source_stats.short_code " +
+		"WHERE daily_source_stats.day >= ? AND daily_source_stats.day <= ? AND JSON_EXTRACT(short_links.params, ?) IS NOT NULL " +
+		"GROUP BY campaign, daily_source_stats.day, daily_source_stats.source")).
+		WithArgs(`$."utm_campaign"`, from, to, `$."utm_campaign"`).
+		WillReturnRows(rows)
+
+	stats, err := repo.GetCampaignDailySourceStats(ctx, "utm_campaign", from, to)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.CampaignDailySourceStat{{Campaign: "spring2024", Day: from, Source: "google", Clicks: 7}}, stats)
+}
+
+func TestMySQLRepository_SaveConversion(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+	conversion := &model.Conversion{ClickID: "c1d2", Event: "purchase", ShortCode: "ABCD", Source: "google", Value: 9.99}
+
+	t.Run("new conversion", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `conversions`")).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		created, err := repo.SaveConversion(ctx, conversion)
+		assert.NoError(t, err)
+		assert.True(t, created)
+	})
+
+	t.Run("duplicate conversion", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `conversions`")).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		created, err := repo.SaveConversion(ctx, &model.Conversion{ClickID: "c1d2", Event: "purchase", ShortCode: "ABCD"})
+		assert.NoError(t, err)
+		assert.False(t, created)
+	})
+}
+
+func TestMySQLRepository_GetShortLinksByURLHash(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+
+	rows := sqlmock.NewRows([]string{"id", "short_code", "original_url", "url_hash", "status"}).
+		AddRow(1, "ABCD", "https://example.com/", "hash", 1).
+		AddRow(2, "EFGH", "https://EXAMPLE.com", "hash", 1)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `short_links` WHERE url_hash = ? AND status = 1 ORDER BY created_at ASC")).
+		WithArgs("hash").
+		WillReturnRows(rows)
+
+	links, err := repo.GetShortLinksByURLHash(ctx, "hash")
+	assert.NoError(t, err)
+	assert.Len(t, links, 2)
+	assert.Equal(t, "EFGH", links[1].ShortCode)
+}
+
+func TestMySQLRepository_UpdateRule(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `rules` SET `kind`=?,`pattern`=?,`source`=?,`updated_at`=? WHERE id = ?")).
+		WithArgs(model.RuleKindSource, "news.example.com", "newsletter", sqlmock.AnyArg(), int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := repo.UpdateRule(ctx, &model.Rule{ID: 7, Kind: model.RuleKindSource, Pattern: "news.example.com", Source: "newsletter"})
+	assert.NoError(t, err)
+
+	// Nothing updated, the rule is looked up to tell a missing one from an unchanged one
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `rules`")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `rules` WHERE `rules`.`id` = ?")).
+		WithArgs(int64(8), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	err = repo.UpdateRule(ctx, &model.Rule{ID: 8, Kind: model.RuleKindBotUA, Pattern: "headlesschrome"})
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLRepository_DeleteRule(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	repo := &MySQLRepository{db: db}
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `rules` WHERE `rules`.`id` = ?")).
+		WithArgs(int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	deleted, err := repo.DeleteRule(ctx, 7)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -2,78 +2,283 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/pkg/clock"
+	"octopus/pkg/util"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
 )
 
 const (
-	// Redis key prefixes
-	ShortLinkKeyPrefix  = "sl:"
+	// Redis key prefixes, lookup keys are versioned in their own namespaces
+	URLKeyPrefix        = "sl:v2:url:"
 	ShortLinkCacheTTL   = 24 * time.Hour
+	CodeKeyPrefix       = "sl:v2:code:"
 	PVKeyPrefix         = "sl:pv:"
 	UVKeyPrefix         = "sl:uv:"
+	UVSketchKeyPrefix   = "sl:hll:"
 	SourceKeyPrefix     = "sl:source:"
 	StatsExpireDuration = 24 * time.Hour
+	PoolKeyPrefix       = "sl:pool:"
+	ClickKeyPrefix      = "sl:click:"
+	ConversionKeyPrefix = "sl:conv:"
+	StatsUpdatedPrefix  = "sl:updated:"
+	ClickLimitPrefix    = "sl:limit:"
+	MinuteClicksPrefix  = "sl:minutes:"
+
+	// MinuteClicksWindow is the number of minutes the ring of per-minute clicks of a link covers
+	MinuteClicksWindow = 60
+
+	// mergeKeyPrefix names the temporary keys HyperLogLog sketches are merged into
+	mergeKeyPrefix = "sl:hll-merge:"
+
+	// Lookup key prefixes before v2, where URL lookup keys shared "sl:" with all other keys. They
+	// are read as a fallback and moved to the v2 keys on a hit while legacy reads are enabled.
+	LegacyURLKeyPrefix  = "sl:"
+	LegacyCodeKeyPrefix = "sl:link:"
 )
 
+// consumeClickScript counts a click against the limit of a short link. It returns 1 while clicks
+// are left, 0 for the click reaching the limit, after dropping the cached link (KEYS[2], and its
+// legacy key KEYS[3]) so it is looked up again, and -1 once the limit is used up. Links without a limit always get 1.
+var consumeClickScript = redis.NewScript(`
+local limit = tonumber(redis.call('HGET', KEYS[1], 'limit'))
+if not limit then
+	return 1
+end
+local clicks = tonumber(redis.call('HGET', KEYS[1], 'clicks') or '0')
+if clicks >= limit then
+	return -1
+end
+clicks = redis.call('HINCRBY', KEYS[1], 'clicks', 1)
+if clicks == limit then
+	redis.call('DEL', KEYS[2], KEYS[3])
+	return 0
+end
+return 1
+`)
+
+// minuteClicksScript adds clicks to the current minute of the ring of per-minute clicks of a short
+// link, a hash of MinuteClicksWindow slots holding the clicks (c<slot>) of the minute (m<slot>) they
+// count. Slots of a minute a full ring ago are reset before counting. KEYS[1] is the ring, ARGV the
+// minute since the epoch, the clicks and the TTL of the ring in seconds.
+var minuteClicksScript = redis.NewScript(`
+local slot = tostring(tonumber(ARGV[1]) % 60)
+if redis.call('HGET', KEYS[1], 'm' .. slot) == ARGV[1] then
+	redis.call('HINCRBY', KEYS[1], 'c' .. slot, ARGV[2])
+else
+	redis.call('HSET', KEYS[1], 'm' .. slot, ARGV[1], 'c' .. slot, ARGV[2])
+end
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// defaultRetention keeps every real-time metric for StatsExpireDuration
+var defaultRetention = config.RetentionConfig{
+	PV:      StatsExpireDuration,
+	UV:      StatsExpireDuration,
+	Sources: StatsExpireDuration,
+}
+
 // RedisRepository handles Redis operations
 type RedisRepository struct {
-	client *redis.Client
-	cfg    *config.RedisConfig
+	client      *redis.Client
+	cfg         *config.RedisConfig
+	retention   config.RetentionConfig
+	legacyReads bool
+	clock       clock.Clock
+	// stopServer stops the embedded server of an in-memory repository
+	stopServer func()
 }
 
-// NewRedisRepository creates a new Redis repository
-func NewRedisRepository(cfg *config.RedisConfig) *RedisRepository {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     cfg.Addr,
-		Password: cfg.Password,
-		DB:       cfg.DB,
-	})
+// NewRedisRepository creates a new Redis repository, failing when Redis does not answer a ping
+func NewRedisRepository(cfg *config.RedisConfig) (*RedisRepository, error) {
+	r := newRedisRepository(cfg)
 
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := rdb.Ping(ctx).Err(); err != nil {
-		log.Error().Err(err).Msg("Failed to connect to Redis")
-	} else {
-		log.Info().Msg("Redis connected successfully")
+	if err := r.client.Ping(ctx).Err(); err != nil {
+		r.client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", redisError(err))
 	}
 
+	log.Info().Msg("Redis connected successfully")
+
+	return r, nil
+}
+
+// newRedisRepository creates a Redis repository without checking that Redis answers
+func newRedisRepository(cfg *config.RedisConfig) *RedisRepository {
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
 	return &RedisRepository{
-		client: rdb,
-		cfg:    cfg,
+		client:      rdb,
+		cfg:         cfg,
+		retention:   defaultRetention,
+		legacyReads: cfg.LegacyReads,
+		clock:       clock.Real,
 	}
 }
 
+// SetRetention sets how long PV, UV and source stats are kept, 0 keeping a metric forever
+func (r *RedisRepository) SetRetention(retention *config.RetentionConfig) {
+	r.retention = *retention
+}
+
 // GetClient returns the Redis client
 func (r *RedisRepository) GetClient() *redis.Client {
 	return r.client
 }
 
-// SaveShortLink saves a short link to Redis
-func (r *RedisRepository) SaveShortLink(ctx context.Context, shortCode, originalURL string, ttl time.Duration) error {
-	key := r.shortLinkKey(shortCode)
-	return r.client.Set(ctx, key, originalURL, ttl).Err()
+// SaveShortLink caches the short code generated for a lookup key (URL and params)
+func (r *RedisRepository) SaveShortLink(ctx context.Context, cacheKey, shortCode string, ttl time.Duration) error {
+	key := r.urlKey(cacheKey)
+	return redisError(r.client.Set(ctx, key, shortCode, ttl).Err())
+}
+
+// SaveShortLinkPair caches a new short link under both its lookup key and its code in one round trip
+func (r *RedisRepository) SaveShortLinkPair(ctx context.Context, cacheKey string, sl *model.ShortLink, ttl time.Duration) error {
+	data, err := json.Marshal(sl)
+	if err != nil {
+		return fmt.Errorf("failed to encode short link: %w", err)
+	}
+
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, r.urlKey(cacheKey), sl.ShortCode, ttl)
+		pipe.Set(ctx, r.codeKey(sl.ShortCode), data, ttl)
+		return nil
+	})
+	return redisError(err)
+}
+
+// GetShortLink retrieves the short code cached for a lookup key
+func (r *RedisRepository) GetShortLink(ctx context.Context, cacheKey string) (string, error) {
+	key := r.urlKey(cacheKey)
+	shortCode, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		shortCode, err = r.readLegacy(ctx, LegacyURLKeyPrefix+cacheKey, key)
+	}
+	return shortCode, redisError(err)
+}
+
+// CacheShortLink caches a short link with all its fields, so cache hits can be checked for status
+// and expiry like links read from MySQL
+func (r *RedisRepository) CacheShortLink(ctx context.Context, sl *model.ShortLink, ttl time.Duration) error {
+	data, err := json.Marshal(sl)
+	if err != nil {
+		return fmt.Errorf("failed to encode short link: %w", err)
+	}
+	return redisError(r.client.Set(ctx, r.codeKey(sl.ShortCode), data, ttl).Err())
+}
+
+// GetCachedShortLink retrieves a short link cached by CacheShortLink, returning ErrNotFound on a miss
+func (r *RedisRepository) GetCachedShortLink(ctx context.Context, shortCode string) (*model.ShortLink, error) {
+	key := r.codeKey(shortCode)
+	data, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		data, err = r.readLegacy(ctx, r.legacyCodeKey(shortCode), key)
+	}
+	if err != nil {
+		return nil, redisError(err)
+	}
+
+	var sl model.ShortLink
+	if err := json.Unmarshal([]byte(data), &sl); err != nil {
+		return nil, fmt.Errorf("failed to decode cached short link: %w", err)
+	}
+	return &sl, nil
 }
 
-// GetShortLink retrieves a short link from Redis
-func (r *RedisRepository) GetShortLink(ctx context.Context, shortCode string) (string, error) {
-	key := r.shortLinkKey(shortCode)
-	return r.client.Get(ctx, key).Result()
+// GetCachedShortLinks retrieves the cached short links of several codes with one MGET, keyed by
+// code. Misses, including links only cached under a legacy key, are left out of the result.
+func (r *RedisRepository) GetCachedShortLinks(ctx context.Context, shortCodes []string) (map[string]*model.ShortLink, error) {
+	links := make(map[string]*model.ShortLink, len(shortCodes))
+	if len(shortCodes) == 0 {
+		return links, nil
+	}
+
+	keys := make([]string, len(shortCodes))
+	for i, shortCode := range shortCodes {
+		keys[i] = r.codeKey(shortCode)
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, redisError(err)
+	}
+
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var sl model.ShortLink
+		if err := json.Unmarshal([]byte(data), &sl); err != nil {
+			log.Warn().Err(err).Str("short_code", shortCodes[i]).Msg("Failed to decode cached short link")
+			continue
+		}
+		links[shortCodes[i]] = &sl
+	}
+	return links, nil
 }
 
 // ExistsShortLink checks if a short link exists in Redis
 func (r *RedisRepository) ExistsShortLink(ctx context.Context, shortCode string) (bool, error) {
-	key := r.shortLinkKey(shortCode)
-	result, err := r.client.Exists(ctx, key).Result()
-	return result > 0, err
+	keys := []string{r.codeKey(shortCode)}
+	if r.legacyReads {
+		keys = append(keys, r.legacyCodeKey(shortCode))
+	}
+	result, err := r.client.Exists(ctx, keys...).Result()
+	return result > 0, redisError(err)
+}
+
+// DeleteShortLink removes a cached short link from Redis, including its legacy key, which could
+// otherwise be read back
+func (r *RedisRepository) DeleteShortLink(ctx context.Context, shortCode string) error {
+	return redisError(r.client.Del(ctx, r.codeKey(shortCode), r.legacyCodeKey(shortCode)).Err())
+}
+
+// readLegacy reads a lookup key of the layout before v2 and moves its value to the v2 key with
+// the TTL it had left, returning redis.Nil when legacy reads are disabled
+func (r *RedisRepository) readLegacy(ctx context.Context, legacyKey, key string) (string, error) {
+	if !r.legacyReads {
+		return "", redis.Nil
+	}
+
+	value, err := r.client.Get(ctx, legacyKey).Result()
+	if err != nil {
+		return "", err
+	}
+	ttl, err := r.client.PTTL(ctx, legacyKey).Result()
+	if err != nil {
+		return "", err
+	}
+
+	// A negative TTL means the key never expires, or expired since it was read
+	if ttl < 0 {
+		ttl = 0
+	}
+	if _, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, value, ttl)
+		pipe.Del(ctx, legacyKey)
+		return nil
+	}); err != nil {
+		log.Warn().Err(err).Str("key", legacyKey).Msg("Failed to migrate legacy cache key")
+	}
+	return value, nil
 }
 
 // IncrementPV increments the page view count for a short link
@@ -81,11 +286,11 @@ func (r *RedisRepository) IncrementPV(ctx context.Context, shortCode string) (in
 	key := r.pvKey(shortCode)
 	count, err := r.client.Incr(ctx, key).Result()
 	if err != nil {
-		return 0, err
+		return 0, redisError(err)
 	}
 	// Set expiration if this is the first increment
-	if count == 1 {
-		r.client.Expire(ctx, key, StatsExpireDuration)
+	if count == 1 && r.retention.PV > 0 {
+		r.client.Expire(ctx, key, r.retention.PV)
 	}
 	return count, nil
 }
@@ -93,25 +298,76 @@ func (r *RedisRepository) IncrementPV(ctx context.Context, shortCode string) (in
 // GetPV gets the page view count for a short link
 func (r *RedisRepository) GetPV(ctx context.Context, shortCode string) (int64, error) {
 	key := r.pvKey(shortCode)
-	return r.client.Get(ctx, key).Int64()
+	pv, err := r.client.Get(ctx, key).Int64()
+	return pv, redisError(err)
 }
 
 // AddUV adds a unique visitor for a short link
 func (r *RedisRepository) AddUV(ctx context.Context, shortCode, visitorID string) (bool, error) {
 	key := r.uvKey(shortCode)
-	day := time.Now().Format("2006-01-02")
+	day := model.StatsDay(r.clock.Now())
 	dailyKey := fmt.Sprintf("%s:%s", key, day)
 
 	added, err := r.client.SAdd(ctx, dailyKey, visitorID).Result()
 	if err != nil {
-		return false, err
+		return false, redisError(err)
 	}
+	sketchKey := fmt.Sprintf("%s:%s", r.uvSketchKey(shortCode), day)
+	r.client.PFAdd(ctx, sketchKey, visitorID)
 	// Set expiration
-	r.client.Expire(ctx, dailyKey, StatsExpireDuration)
+	if r.retention.UV > 0 {
+		r.client.Expire(ctx, dailyKey, r.retention.UV)
+		r.client.Expire(ctx, sketchKey, r.retention.UV)
+	}
 
 	return added > 0, nil
 }
 
+// GetMergedUV estimates the unique visitors of several short links over the days of period by
+// merging their HyperLogLog sketches, so a visitor of more than one of them counts once
+func (r *RedisRepository) GetMergedUV(ctx context.Context, shortCodes []string, period model.Period) (int64, error) {
+	keys := r.uvSketchKeys(shortCodes, period)
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	// Merge into a temporary key dropped in the same transaction, outside the sketch key space
+	mergedKey := mergeKeyPrefix + util.GenerateUUID()
+	var count *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pfMerge(ctx, pipe, mergedKey, keys)
+		count = pipe.PFCount(ctx, mergedKey)
+		pipe.Del(ctx, mergedKey)
+		return nil
+	})
+	if err != nil {
+		return 0, redisError(err)
+	}
+	return count.Val(), nil
+}
+
+// uvSketchKeys lists the daily HyperLogLog sketch keys of short links over the days of period,
+// built from the days rather than scanned: keys of days without visitors merge as empty sketches
+func (r *RedisRepository) uvSketchKeys(shortCodes []string, period model.Period) []string {
+	var keys []string
+	for day := period.From.UTC(); !day.After(period.To); day = day.AddDate(0, 0, 1) {
+		for _, shortCode := range shortCodes {
+			keys = append(keys, fmt.Sprintf("%s:%s", r.uvSketchKey(shortCode), model.StatsDay(day)))
+		}
+	}
+	return keys
+}
+
+// mergeBatchSize bounds the sketches merged by a single PFMERGE
+const mergeBatchSize = 1000
+
+// pfMerge merges sketches into dest in batches, each PFMERGE adding to what dest already holds
+func pfMerge(ctx context.Context, pipe redis.Pipeliner, dest string, keys []string) {
+	for start := 0; start < len(keys); start += mergeBatchSize {
+		pipe.PFMerge(ctx, dest, keys[start:min(start+mergeBatchSize, len(keys))]...)
+	}
+}
+
 // GetUV gets the unique visitor count for a short link
 func (r *RedisRepository) GetUV(ctx context.Context, shortCode string) (int64, error) {
 	pattern := fmt.Sprintf("%s:*", r.uvKey(shortCode))
@@ -123,7 +379,7 @@ func (r *RedisRepository) GetUV(ctx context.Context, shortCode string) (int64, e
 	}
 
 	if err := iter.Err(); err != nil {
-		return 0, err
+		return 0, redisError(err)
 	}
 
 	var totalUV int64
@@ -142,21 +398,85 @@ func (r *RedisRepository) GetUV(ctx context.Context, shortCode string) (int64, e
 // AddSource adds a source visit for a short link
 func (r *RedisRepository) AddSource(ctx context.Context, shortCode, source string) error {
 	key := r.sourceKey(shortCode)
-	day := time.Now().Format("2006-01-02")
+	day := model.StatsDay(r.clock.Now())
 	dailyKey := fmt.Sprintf("%s:%s:%s", key, source, day)
 
 	count, err := r.client.Incr(ctx, dailyKey).Result()
 	if err != nil {
-		return err
+		return redisError(err)
 	}
 	// Set expiration
-	if count == 1 {
-		r.client.Expire(ctx, dailyKey, StatsExpireDuration)
+	if count == 1 && r.retention.Sources > 0 {
+		r.client.Expire(ctx, dailyKey, r.retention.Sources)
 	}
 
 	return nil
 }
 
+// RecordAccessPipelined counts one click in the PV, UV and source counters in one round trip, like
+// IncrementPV, AddUV, AddSource and TouchStats do in four or more
+func (r *RedisRepository) RecordAccessPipelined(ctx context.Context, shortCode, visitorID, source string) error {
+	delta := &model.CounterDelta{ShortCode: shortCode, PV: 1, Visitors: []string{visitorID}}
+	if source != "" {
+		delta.Sources = map[string]int64{source: 1}
+	}
+	return r.ApplyCounters(ctx, []*model.CounterDelta{delta})
+}
+
+// ApplyCounters adds buffered PV, UV and source counts to Redis in a single pipeline, marking the
+// stats of every short link as changed. Counts go to the minute and day of their access time rather
+// than of the flush, and keys expire like the ones written per click.
+func (r *RedisRepository) ApplyCounters(ctx context.Context, deltas []*model.CounterDelta) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	now := r.clock.Now()
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, d := range deltas {
+			at := d.AccessTime
+			if at.IsZero() {
+				at = now
+			}
+			day := model.StatsDay(at)
+			if d.PV > 0 {
+				pvKey := r.pvKey(d.ShortCode)
+				pipe.IncrBy(ctx, pvKey, d.PV)
+				if r.retention.PV > 0 {
+					pipe.ExpireNX(ctx, pvKey, r.retention.PV)
+				}
+				// Sent whole rather than by SHA, pipelines cannot load scripts missing from the server
+				minuteClicksScript.Eval(ctx, pipe, []string{r.minuteClicksKey(d.ShortCode)},
+					at.Unix()/60, d.PV, int((MinuteClicksWindow * time.Minute).Seconds()))
+			}
+			if len(d.Visitors) > 0 {
+				uvKey := fmt.Sprintf("%s:%s", r.uvKey(d.ShortCode), day)
+				members := make([]interface{}, len(d.Visitors))
+				for i, v := range d.Visitors {
+					members[i] = v
+				}
+				sketchKey := fmt.Sprintf("%s:%s", r.uvSketchKey(d.ShortCode), day)
+				pipe.SAdd(ctx, uvKey, members...)
+				pipe.PFAdd(ctx, sketchKey, members...)
+				if r.retention.UV > 0 {
+					pipe.Expire(ctx, uvKey, r.retention.UV)
+					pipe.Expire(ctx, sketchKey, r.retention.UV)
+				}
+			}
+			for source, count := range d.Sources {
+				sourceKey := fmt.Sprintf("%s:%s:%s", r.sourceKey(d.ShortCode), source, day)
+				pipe.IncrBy(ctx, sourceKey, count)
+				if r.retention.Sources > 0 {
+					pipe.ExpireNX(ctx, sourceKey, r.retention.Sources)
+				}
+			}
+			pipe.Set(ctx, r.statsUpdatedKey(d.ShortCode), now.UnixNano(), r.statsUpdatedTTL())
+		}
+		return nil
+	})
+	return redisError(err)
+}
+
 // GetSources gets the top sources for a short link
 func (r *RedisRepository) GetSources(ctx context.Context, shortCode string) (map[string]int64, error) {
 	pattern := fmt.Sprintf("%s:*", r.sourceKey(shortCode))
@@ -180,28 +500,299 @@ func (r *RedisRepository) GetSources(ctx context.Context, shortCode string) (map
 		sources[sourceName] += count
 	}
 
-	return sources, iter.Err()
+	return sources, redisError(iter.Err())
+}
+
+// GetMinuteClicks gets the clicks of a short link in each of the MinuteClicksWindow minutes ending
+// with the minute of to, oldest first
+func (r *RedisRepository) GetMinuteClicks(ctx context.Context, shortCode string, to time.Time) ([]int64, error) {
+	fields, err := r.client.HGetAll(ctx, r.minuteClicksKey(shortCode)).Result()
+	if err != nil {
+		return nil, redisError(err)
+	}
+
+	clicks := make([]int64, MinuteClicksWindow)
+	last := to.Unix() / 60
+	for i := range clicks {
+		minute := last - int64(MinuteClicksWindow-1-i)
+		slot := strconv.FormatInt(minute%MinuteClicksWindow, 10)
+		// Slots still holding a minute of the previous turn of the ring count nothing
+		if fields["m"+slot] != strconv.FormatInt(minute, 10) {
+			continue
+		}
+		clicks[i], _ = strconv.ParseInt(fields["c"+slot], 10, 64)
+	}
+	return clicks, nil
+}
+
+// ReserveCapacity reserves one slot in a code pool, failing when the pool is full
+func (r *RedisRepository) ReserveCapacity(ctx context.Context, pool string, capacity int64) (bool, error) {
+	key := r.poolUsedKey(pool)
+	used, err := r.client.Incr(ctx, key).Result()
+	if err != nil {
+		return false, redisError(err)
+	}
+	if used > capacity {
+		// Roll back the reservation, the pool is exhausted
+		if err := r.client.Decr(ctx, key).Err(); err != nil {
+			log.Warn().Err(err).Str("pool", pool).Msg("Failed to roll back pool reservation")
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// ReleaseCapacity releases one slot in a code pool
+func (r *RedisRepository) ReleaseCapacity(ctx context.Context, pool string) error {
+	key := r.poolUsedKey(pool)
+	used, err := r.client.Decr(ctx, key).Result()
+	if err != nil {
+		return redisError(err)
+	}
+	if used < 0 {
+		return redisError(r.client.Set(ctx, key, 0, 0).Err())
+	}
+	return nil
+}
+
+// GetPoolUsage gets the number of reserved slots in a code pool
+func (r *RedisRepository) GetPoolUsage(ctx context.Context, pool string) (int64, error) {
+	used, err := r.client.Get(ctx, r.poolUsedKey(pool)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return used, redisError(err)
+}
+
+// PushFreeCode returns a short code to the free list of a code pool
+func (r *RedisRepository) PushFreeCode(ctx context.Context, pool, shortCode string) error {
+	return redisError(r.client.SAdd(ctx, r.poolFreeKey(pool), shortCode).Err())
+}
+
+// PopFreeCode takes a short code from the free list of a code pool
+func (r *RedisRepository) PopFreeCode(ctx context.Context, pool string) (string, error) {
+	shortCode, err := r.client.SPop(ctx, r.poolFreeKey(pool)).Result()
+	return shortCode, redisError(err)
+}
+
+// CountFreeCodes counts the short codes in the free list of a code pool
+func (r *RedisRepository) CountFreeCodes(ctx context.Context, pool string) (int64, error) {
+	count, err := r.client.SCard(ctx, r.poolFreeKey(pool)).Result()
+	return count, redisError(err)
+}
+
+// SaveClick records the link and source a click ID was issued for
+func (r *RedisRepository) SaveClick(ctx context.Context, clickID, shortCode, source string, ttl time.Duration) error {
+	key := r.clickKey(clickID)
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, "short_code", shortCode, "source", source)
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	return redisError(err)
+}
+
+// GetClick returns the link and source a click ID was issued for, ErrNotFound if unknown
+func (r *RedisRepository) GetClick(ctx context.Context, clickID string) (string, string, error) {
+	fields, err := r.client.HGetAll(ctx, r.clickKey(clickID)).Result()
+	if err != nil {
+		return "", "", redisError(err)
+	}
+	if len(fields) == 0 {
+		return "", "", redisError(redis.Nil)
+	}
+	return fields["short_code"], fields["source"], nil
+}
+
+// SetClickLimit sets the number of clicks a short link redirects before it expires, keeping the
+// clicks counted so far. A ttl of 0 keeps the limit as long as the link exists.
+func (r *RedisRepository) SetClickLimit(ctx context.Context, shortCode string, limit int64, ttl time.Duration) error {
+	key := r.clickLimitKey(shortCode)
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, "limit", limit)
+		if ttl > 0 {
+			pipe.Expire(ctx, key, ttl)
+		}
+		return nil
+	})
+	return redisError(err)
+}
+
+// ConsumeClick atomically counts a click against the click limit of a short link. It reports
+// whether the click may be redirected and whether it was the last one, so the link can be
+// deactivated exactly at the limit. The script runs by its cached SHA, loaded on first use.
+func (r *RedisRepository) ConsumeClick(ctx context.Context, shortCode string) (bool, bool, error) {
+	keys := []string{r.clickLimitKey(shortCode), r.codeKey(shortCode), r.legacyCodeKey(shortCode)}
+	verdict, err := consumeClickScript.Run(ctx, r.client, keys).Int()
+	if err != nil {
+		return false, false, redisError(err)
+	}
+	return verdict >= 0, verdict == 0, nil
+}
+
+// DeleteCounters removes every counter of a short link: PV, daily UV sets and sketches, sources,
+// conversions, minute clicks, the stats update time and the click limit
+func (r *RedisRepository) DeleteCounters(ctx context.Context, shortCode string) error {
+	keys := []string{r.pvKey(shortCode), r.conversionKey(shortCode), r.minuteClicksKey(shortCode),
+		r.statsUpdatedKey(shortCode), r.clickLimitKey(shortCode)}
+	for _, key := range []string{r.uvKey(shortCode), r.uvSketchKey(shortCode), r.sourceKey(shortCode)} {
+		iter := r.client.Scan(ctx, 0, key+":*", 0).Iterator()
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			return redisError(err)
+		}
+	}
+
+	// One key per DEL, the daily keys are not guaranteed to share a cluster slot
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	return redisError(err)
+}
+
+// IncrementConversion increments the conversion count of a short link for a source
+func (r *RedisRepository) IncrementConversion(ctx context.Context, shortCode, source string) error {
+	key := r.conversionKey(shortCode)
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, key, source, 1)
+		// Expire alongside the PV counter the conversion rate is computed against
+		if r.retention.PV > 0 {
+			pipe.ExpireNX(ctx, key, r.retention.PV)
+		}
+		return nil
+	})
+	return redisError(err)
+}
+
+// GetConversions gets the conversion counts of a short link by source
+func (r *RedisRepository) GetConversions(ctx context.Context, shortCode string) (map[string]int64, error) {
+	fields, err := r.client.HGetAll(ctx, r.conversionKey(shortCode)).Result()
+	if err != nil {
+		return nil, redisError(err)
+	}
+
+	conversions := make(map[string]int64, len(fields))
+	for source, value := range fields {
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			log.Warn().Err(err).Str("source", source).Msg("Failed to parse conversion count from Redis")
+			continue
+		}
+		conversions[source] = count
+	}
+	return conversions, nil
+}
+
+// TouchStats records that the stats of a short link changed just now
+func (r *RedisRepository) TouchStats(ctx context.Context, shortCode string) error {
+	return redisError(r.client.Set(ctx, r.statsUpdatedKey(shortCode), r.clock.Now().UnixNano(), r.statsUpdatedTTL()).Err())
+}
+
+// statsUpdatedTTL keeps the last change time as long as any stats it describes, 0 meaning forever
+func (r *RedisRepository) statsUpdatedTTL() time.Duration {
+	if r.retention.PV <= 0 || r.retention.UV <= 0 || r.retention.Sources <= 0 {
+		return 0
+	}
+	return max(r.retention.PV, r.retention.UV, r.retention.Sources)
+}
+
+// GetStatsUpdatedAt gets when the stats of a short link last changed, zero if unknown
+func (r *RedisRepository) GetStatsUpdatedAt(ctx context.Context, shortCode string) (time.Time, error) {
+	nanos, err := r.client.Get(ctx, r.statsUpdatedKey(shortCode)).Int64()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, redisError(err)
+	}
+	return time.Unix(0, nanos), nil
 }
 
-// Close closes the Redis connection
+// Close closes the Redis connection, stopping the embedded server of an in-memory repository
 func (r *RedisRepository) Close() error {
-	return r.client.Close()
+	err := r.client.Close()
+	if r.stopServer != nil {
+		r.stopServer()
+	}
+	return err
 }
 
 // Helper functions to build Redis keys
 
-func (r *RedisRepository) shortLinkKey(shortCode string) string {
-	return ShortLinkKeyPrefix + shortCode
+// keySegmentEscaper percent-encodes the characters of a user-derived key segment that would let it
+// reach the keys of another segment: the ":" separating key suffixes and the glob metacharacters of
+// the SCAN patterns built from it. Short codes contain none of them, their keys are unchanged.
+var keySegmentEscaper = strings.NewReplacer(
+	"%", "%25", ":", "%3A", "*", "%2A", "?", "%3F", "[", "%5B", "]", "%5D", `\`, "%5C",
+)
+
+// keySegmentUnescaper reverses keySegmentEscaper
+var keySegmentUnescaper = strings.NewReplacer(
+	"%25", "%", "%3A", ":", "%2A", "*", "%3F", "?", "%5B", "[", "%5D", "]", "%5C", `\`,
+)
+
+// keySegment escapes a user-derived segment of a key
+func keySegment(segment string) string {
+	return keySegmentEscaper.Replace(segment)
+}
+
+func (r *RedisRepository) urlKey(cacheKey string) string {
+	return URLKeyPrefix + cacheKey
+}
+
+func (r *RedisRepository) codeKey(shortCode string) string {
+	return CodeKeyPrefix + keySegment(shortCode)
 }
 
 func (r *RedisRepository) pvKey(shortCode string) string {
-	return PVKeyPrefix + shortCode
+	return PVKeyPrefix + keySegment(shortCode)
 }
 
 func (r *RedisRepository) uvKey(shortCode string) string {
-	return UVKeyPrefix + shortCode
+	return UVKeyPrefix + keySegment(shortCode)
+}
+
+func (r *RedisRepository) uvSketchKey(shortCode string) string {
+	return UVSketchKeyPrefix + keySegment(shortCode)
 }
 
 func (r *RedisRepository) sourceKey(shortCode string) string {
-	return SourceKeyPrefix + shortCode
+	return SourceKeyPrefix + keySegment(shortCode)
+}
+
+func (r *RedisRepository) poolUsedKey(pool string) string {
+	return PoolKeyPrefix + pool + ":used"
+}
+
+func (r *RedisRepository) poolFreeKey(pool string) string {
+	return PoolKeyPrefix + pool + ":free"
+}
+
+func (r *RedisRepository) clickKey(clickID string) string {
+	return ClickKeyPrefix + keySegment(clickID)
+}
+
+func (r *RedisRepository) conversionKey(shortCode string) string {
+	return ConversionKeyPrefix + keySegment(shortCode)
+}
+
+func (r *RedisRepository) statsUpdatedKey(shortCode string) string {
+	return StatsUpdatedPrefix + keySegment(shortCode)
+}
+
+func (r *RedisRepository) clickLimitKey(shortCode string) string {
+	return ClickLimitPrefix + keySegment(shortCode)
+}
+
+func (r *RedisRepository) minuteClicksKey(shortCode string) string {
+	return MinuteClicksPrefix + keySegment(shortCode)
+}
+
+func (r *RedisRepository) legacyCodeKey(shortCode string) string {
+	return LegacyCodeKeyPrefix + keySegment(shortCode)
 }
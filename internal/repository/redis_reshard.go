@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// ReshardResult counts the keys of short links checked and moved by Reshard
+type ReshardResult struct {
+	Scanned int64
+	Moved   int64
+	// Kept counts the keys already written on their new shard, where the newer copy is kept
+	Kept int64
+}
+
+// Reshard moves the keys of short links to the shard owning them, after shards were added or
+// removed. Besides the shards, it drains the given instances: the former shared instance when
+// sharding is turned on, or shards being removed. Keys are copied with DUMP and RESTORE keeping
+// their TTL and deleted from where they were; a key already written on its new shard since the
+// ring changed is newer and kept there. With dryRun only the keys to move are counted.
+func (r *ShardedRedisRepository) Reshard(ctx context.Context, drained []*RedisRepository, batch int64, dryRun bool) (*ReshardResult, error) {
+	result := &ReshardResult{}
+	for _, shard := range r.order {
+		if err := r.reshardFrom(ctx, shard.repo, shard, batch, dryRun, result); err != nil {
+			return result, fmt.Errorf("failed to reshard %s: %w", shard.name, err)
+		}
+	}
+
+	for _, repo := range drained {
+		// Draining a shard of the ring would move the keys it owns out and back in
+		if shard := r.shardAt(repo); shard != nil {
+			log.Warn().Str("addr", repo.cfg.Addr).Str("shard", shard.name).Msg("Not draining a Redis instance still on the ring")
+			continue
+		}
+		if err := r.reshardFrom(ctx, repo, nil, batch, dryRun, result); err != nil {
+			return result, fmt.Errorf("failed to drain %s: %w", repo.cfg.Addr, err)
+		}
+	}
+	return result, nil
+}
+
+// shardAt returns the shard stored in the same Redis database as repo, if any
+func (r *ShardedRedisRepository) shardAt(repo *RedisRepository) *redisShard {
+	for _, shard := range r.order {
+		if shard.repo.cfg.Addr == repo.cfg.Addr && shard.repo.cfg.DB == repo.cfg.DB {
+			return shard
+		}
+	}
+	return nil
+}
+
+// reshardFrom moves the keys of an instance that belong to other shards, current being the shard
+// stored in it or nil for an instance being drained
+func (r *ShardedRedisRepository) reshardFrom(ctx context.Context, repo *RedisRepository, current *redisShard,
+	batch int64, dryRun bool, result *ReshardResult) error {
+	iter := repo.client.Scan(ctx, 0, LegacyURLKeyPrefix+"*", batch).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		token, ok := shardToken(key)
+		if !ok {
+			continue
+		}
+		result.Scanned++
+
+		owner := r.shardFor(token)
+		if owner == current {
+			continue
+		}
+		if dryRun {
+			result.Moved++
+			continue
+		}
+
+		moved, err := moveKey(ctx, repo.client, owner.repo.client, key)
+		if err != nil {
+			return fmt.Errorf("failed to move %s to %s: %w", key, owner.name, err)
+		}
+		if moved {
+			result.Moved++
+		} else {
+			result.Kept++
+		}
+	}
+	return redisError(iter.Err())
+}
+
+// moveKey copies a key to another instance and deletes it, reporting false when the target
+// already had the key and kept its own copy. Keys expiring meanwhile are just gone.
+func moveKey(ctx context.Context, from, to *redis.Client, key string) (bool, error) {
+	dump, err := from.Dump(ctx, key).Result()
+	if err == redis.Nil {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	ttl, err := from.PTTL(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	switch ttl {
+	case -2:
+		// Expired since it was dumped
+		return true, nil
+	case -1:
+		// Never expires
+		ttl = 0
+	}
+
+	moved := true
+	if err := to.Restore(ctx, key, ttl, dump).Err(); err != nil {
+		if !strings.HasPrefix(err.Error(), "BUSYKEY") {
+			return false, err
+		}
+		moved = false
+	}
+	return moved, from.Del(ctx, key).Err()
+}
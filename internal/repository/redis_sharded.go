@@ -0,0 +1,619 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/pkg/chaos"
+	"octopus/pkg/hashring"
+	"octopus/pkg/util"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// shardedKeyPrefixes are the prefixes of the keys spread over the shards, routed by the short code,
+// lookup key, pool or click ID following them. Keys with a ":"-separated suffix (day, source, pool
+// counter) are routed by their first part, so all keys of a short link live on the same shard.
+var shardedKeyPrefixes = []struct {
+	prefix string
+	suffix bool
+}{
+	{URLKeyPrefix, false},
+	{CodeKeyPrefix, false},
+	{PVKeyPrefix, false},
+	{UVKeyPrefix, true},
+	{UVSketchKeyPrefix, true},
+	{SourceKeyPrefix, true},
+	{PoolKeyPrefix, true},
+	{ClickKeyPrefix, false},
+	{ConversionKeyPrefix, false},
+	{StatsUpdatedPrefix, false},
+	{ClickLimitPrefix, false},
+	{MinuteClicksPrefix, false},
+	{LegacyCodeKeyPrefix, false},
+}
+
+// shardToken returns what a key is routed by, reporting false for keys that are not sharded
+func shardToken(key string) (string, bool) {
+	for _, p := range shardedKeyPrefixes {
+		if !strings.HasPrefix(key, p.prefix) {
+			continue
+		}
+		token := key[len(p.prefix):]
+		if p.suffix {
+			token, _, _ = strings.Cut(token, ":")
+		}
+		return keySegmentUnescaper.Replace(token), true
+	}
+	// Merge keys only live for a transaction, any other key is a lookup key of the legacy layout
+	if strings.HasPrefix(key, mergeKeyPrefix) || !strings.HasPrefix(key, LegacyURLKeyPrefix) {
+		return "", false
+	}
+	return key[len(LegacyURLKeyPrefix):], true
+}
+
+// redisShard is one Redis instance of a sharded repository and its health
+type redisShard struct {
+	name     string
+	repo     *RedisRepository
+	failures atomic.Int64
+	down     atomic.Bool
+	mu       sync.Mutex
+	lastErr  string
+}
+
+// run runs an operation on the shard unless it is down, counting failures to reach it
+func (s *redisShard) run(threshold int64, op func(*RedisRepository) error) error {
+	if s.down.Load() {
+		return fmt.Errorf("%w: redis shard %s is down", ErrUnavailable, s.name)
+	}
+	err := op(s.repo)
+	s.observe(threshold, err)
+	return err
+}
+
+// observe tracks the outcome of a command, taking the shard down after threshold consecutive
+// failures to reach it. Any other outcome proves the shard is reachable.
+func (s *redisShard) observe(threshold int64, err error) {
+	if !errors.Is(err, ErrUnavailable) {
+		s.failures.Store(0)
+		return
+	}
+
+	s.mu.Lock()
+	s.lastErr = err.Error()
+	s.mu.Unlock()
+
+	if s.failures.Add(1) >= threshold && !s.down.Swap(true) {
+		log.Warn().Err(err).Str("shard", s.name).Msg("Redis shard down, failing fast until it answers again")
+	}
+}
+
+// stats returns the health of the shard
+func (s *redisShard) stats() model.RedisShardStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return model.RedisShardStats{
+		Name:      s.name,
+		Addr:      s.repo.cfg.Addr,
+		Healthy:   !s.down.Load(),
+		Failures:  s.failures.Load(),
+		LastError: s.lastErr,
+	}
+}
+
+// ShardedRedisRepository spreads the keys of short links over several Redis instances by
+// consistent hashing, all keys of a short link landing on the same shard. The Bloom Filter,
+// streams and other state shared by all links stay on the Redis instance returned by GetClient.
+// Shards failing to answer are taken down and fail fast, like an unreachable Redis, until a
+// health check passes.
+type ShardedRedisRepository struct {
+	shared    *RedisRepository
+	ring      *hashring.Ring
+	shards    map[string]*redisShard
+	order     []*redisShard
+	threshold int64
+}
+
+// NewShardedRedisRepository creates a repository sharding the keys of short links over the
+// configured shards. Shards are not required to answer yet, unreachable ones are taken down by
+// the first commands or health checks.
+func NewShardedRedisRepository(shared *RedisRepository, cfg *config.RedisShardsConfig) *ShardedRedisRepository {
+	threshold := int64(cfg.FailureThreshold)
+	if threshold <= 0 {
+		threshold = 1
+	}
+
+	r := &ShardedRedisRepository{
+		shared:    shared,
+		shards:    make(map[string]*redisShard, len(cfg.Shards)),
+		threshold: threshold,
+	}
+	names := make([]string, 0, len(cfg.Shards))
+	for _, shardCfg := range cfg.Shards {
+		shard := &redisShard{
+			name: shardCfg.Name,
+			repo: newRedisRepository(&config.RedisConfig{
+				Addr:        shardCfg.Addr,
+				Password:    shardCfg.Password,
+				DB:          shardCfg.DB,
+				LegacyReads: shared.legacyReads,
+			}),
+		}
+		r.shards[shard.name] = shard
+		r.order = append(r.order, shard)
+		names = append(names, shard.name)
+	}
+	r.ring = hashring.New(cfg.VirtualNodes, names...)
+
+	log.Info().Strs("shards", names).Msg("Redis sharding enabled")
+
+	return r
+}
+
+// SetRetention sets how long PV, UV and source stats are kept on every shard
+func (r *ShardedRedisRepository) SetRetention(retention *config.RetentionConfig) {
+	for _, shard := range r.order {
+		shard.repo.SetRetention(retention)
+	}
+}
+
+// EnableFaultInjection injects latency and errors into every command sent to the shards
+func (r *ShardedRedisRepository) EnableFaultInjection(injector *chaos.Injector) {
+	for _, shard := range r.order {
+		shard.repo.EnableFaultInjection(injector)
+	}
+}
+
+// Run checks the health of the shards every interval until ctx is done
+func (r *ShardedRedisRepository) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.checkHealth(ctx, interval)
+		}
+	}
+}
+
+// checkHealth pings every shard, bringing down shards back once they answer
+func (r *ShardedRedisRepository) checkHealth(ctx context.Context, timeout time.Duration) {
+	for _, shard := range r.order {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := redisError(shard.repo.client.Ping(pingCtx).Err())
+		cancel()
+
+		if err != nil {
+			shard.observe(r.threshold, err)
+			continue
+		}
+		shard.failures.Store(0)
+		if shard.down.Swap(false) {
+			log.Info().Str("shard", shard.name).Msg("Redis shard is back up")
+		}
+	}
+}
+
+// Stats returns the health of every shard
+func (r *ShardedRedisRepository) Stats() []model.RedisShardStats {
+	stats := make([]model.RedisShardStats, 0, len(r.order))
+	for _, shard := range r.order {
+		stats = append(stats, shard.stats())
+	}
+	return stats
+}
+
+// shardFor returns the shard owning a short code, lookup key, pool or click ID
+func (r *ShardedRedisRepository) shardFor(token string) *redisShard {
+	return r.shards[r.ring.Get(token)]
+}
+
+// call runs an operation on the shard owning token
+func (r *ShardedRedisRepository) call(token string, op func(*RedisRepository) error) error {
+	return r.shardFor(token).run(r.threshold, op)
+}
+
+// query runs an operation returning a value on the shard owning token
+func query[T any](r *ShardedRedisRepository, token string, op func(*RedisRepository) (T, error)) (T, error) {
+	var value T
+	err := r.call(token, func(repo *RedisRepository) (err error) {
+		value, err = op(repo)
+		return err
+	})
+	return value, err
+}
+
+// group splits short codes by the shard owning them, keeping the order of the shards
+func (r *ShardedRedisRepository) group(shortCodes []string) ([]*redisShard, map[*redisShard][]string) {
+	var shards []*redisShard
+	groups := make(map[*redisShard][]string)
+	for _, shortCode := range shortCodes {
+		shard := r.shardFor(shortCode)
+		if _, ok := groups[shard]; !ok {
+			shards = append(shards, shard)
+		}
+		groups[shard] = append(groups[shard], shortCode)
+	}
+	return shards, groups
+}
+
+// GetClient returns the client of the Redis instance holding the state shared by all links
+func (r *ShardedRedisRepository) GetClient() *redis.Client {
+	return r.shared.GetClient()
+}
+
+// SaveShortLink caches the short code generated for a lookup key (URL and params)
+func (r *ShardedRedisRepository) SaveShortLink(ctx context.Context, cacheKey, shortCode string, ttl time.Duration) error {
+	return r.call(cacheKey, func(repo *RedisRepository) error {
+		return repo.SaveShortLink(ctx, cacheKey, shortCode, ttl)
+	})
+}
+
+// SaveShortLinkPair caches a new short link under both its lookup key and its code, in one round
+// trip when both keys live on the same shard. The link is cached first, so the lookup key never
+// points to a code missing from the cache because of a failed write.
+func (r *ShardedRedisRepository) SaveShortLinkPair(ctx context.Context, cacheKey string, sl *model.ShortLink, ttl time.Duration) error {
+	if r.shardFor(cacheKey) == r.shardFor(sl.ShortCode) {
+		return r.call(cacheKey, func(repo *RedisRepository) error {
+			return repo.SaveShortLinkPair(ctx, cacheKey, sl, ttl)
+		})
+	}
+
+	if err := r.CacheShortLink(ctx, sl, ttl); err != nil {
+		return err
+	}
+	return r.SaveShortLink(ctx, cacheKey, sl.ShortCode, ttl)
+}
+
+// GetShortLink retrieves the short code cached for a lookup key
+func (r *ShardedRedisRepository) GetShortLink(ctx context.Context, cacheKey string) (string, error) {
+	return query(r, cacheKey, func(repo *RedisRepository) (string, error) {
+		return repo.GetShortLink(ctx, cacheKey)
+	})
+}
+
+// CacheShortLink caches a short link with all its fields
+func (r *ShardedRedisRepository) CacheShortLink(ctx context.Context, sl *model.ShortLink, ttl time.Duration) error {
+	return r.call(sl.ShortCode, func(repo *RedisRepository) error {
+		return repo.CacheShortLink(ctx, sl, ttl)
+	})
+}
+
+// GetCachedShortLink retrieves a short link cached by CacheShortLink, returning ErrNotFound on a miss
+func (r *ShardedRedisRepository) GetCachedShortLink(ctx context.Context, shortCode string) (*model.ShortLink, error) {
+	return query(r, shortCode, func(repo *RedisRepository) (*model.ShortLink, error) {
+		return repo.GetCachedShortLink(ctx, shortCode)
+	})
+}
+
+// GetCachedShortLinks retrieves the cached short links of several codes with one MGET per shard
+// owning some of them, keyed by code
+func (r *ShardedRedisRepository) GetCachedShortLinks(ctx context.Context, shortCodes []string) (map[string]*model.ShortLink, error) {
+	links := make(map[string]*model.ShortLink, len(shortCodes))
+	shards, groups := r.group(shortCodes)
+	for _, shard := range shards {
+		err := shard.run(r.threshold, func(repo *RedisRepository) error {
+			found, err := repo.GetCachedShortLinks(ctx, groups[shard])
+			for shortCode, sl := range found {
+				links[shortCode] = sl
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return links, nil
+}
+
+// ExistsShortLink checks if a short link is cached
+func (r *ShardedRedisRepository) ExistsShortLink(ctx context.Context, shortCode string) (bool, error) {
+	return query(r, shortCode, func(repo *RedisRepository) (bool, error) {
+		return repo.ExistsShortLink(ctx, shortCode)
+	})
+}
+
+// DeleteShortLink removes a cached short link
+func (r *ShardedRedisRepository) DeleteShortLink(ctx context.Context, shortCode string) error {
+	return r.call(shortCode, func(repo *RedisRepository) error {
+		return repo.DeleteShortLink(ctx, shortCode)
+	})
+}
+
+// IncrementPV increments the page view count for a short link
+func (r *ShardedRedisRepository) IncrementPV(ctx context.Context, shortCode string) (int64, error) {
+	return query(r, shortCode, func(repo *RedisRepository) (int64, error) {
+		return repo.IncrementPV(ctx, shortCode)
+	})
+}
+
+// GetPV gets the page view count for a short link
+func (r *ShardedRedisRepository) GetPV(ctx context.Context, shortCode string) (int64, error) {
+	return query(r, shortCode, func(repo *RedisRepository) (int64, error) {
+		return repo.GetPV(ctx, shortCode)
+	})
+}
+
+// AddUV adds a unique visitor for a short link
+func (r *ShardedRedisRepository) AddUV(ctx context.Context, shortCode, visitorID string) (bool, error) {
+	return query(r, shortCode, func(repo *RedisRepository) (bool, error) {
+		return repo.AddUV(ctx, shortCode, visitorID)
+	})
+}
+
+// GetUV gets the unique visitor count for a short link
+func (r *ShardedRedisRepository) GetUV(ctx context.Context, shortCode string) (int64, error) {
+	return query(r, shortCode, func(repo *RedisRepository) (int64, error) {
+		return repo.GetUV(ctx, shortCode)
+	})
+}
+
+// GetMergedUV estimates the unique visitors of several short links over period. As PFMERGE only
+// works within an instance, the sketches of every shard are merged there first and the merged
+// sketches copied with DUMP and RESTORE to the first shard to be counted together.
+func (r *ShardedRedisRepository) GetMergedUV(ctx context.Context, shortCodes []string, period model.Period) (int64, error) {
+	shards, groups := r.group(shortCodes)
+	if len(shards) == 0 {
+		return 0, nil
+	}
+	if len(shards) == 1 {
+		return query(r, shortCodes[0], func(repo *RedisRepository) (int64, error) {
+			return repo.GetMergedUV(ctx, shortCodes, period)
+		})
+	}
+
+	var sketches []string
+	for _, shard := range shards {
+		err := shard.run(r.threshold, func(repo *RedisRepository) error {
+			sketch, err := repo.dumpMergedUV(ctx, groups[shard], period)
+			if sketch != "" {
+				sketches = append(sketches, sketch)
+			}
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	if len(sketches) == 0 {
+		return 0, nil
+	}
+
+	var count int64
+	err := shards[0].run(r.threshold, func(repo *RedisRepository) (err error) {
+		count, err = repo.countDumpedUV(ctx, sketches)
+		return err
+	})
+	return count, err
+}
+
+// AddSource adds a source visit for a short link
+func (r *ShardedRedisRepository) AddSource(ctx context.Context, shortCode, source string) error {
+	return r.call(shortCode, func(repo *RedisRepository) error {
+		return repo.AddSource(ctx, shortCode, source)
+	})
+}
+
+// RecordAccessPipelined counts one click in the PV, UV and source counters in one round trip
+func (r *ShardedRedisRepository) RecordAccessPipelined(ctx context.Context, shortCode, visitorID, source string) error {
+	return r.call(shortCode, func(repo *RedisRepository) error {
+		return repo.RecordAccessPipelined(ctx, shortCode, visitorID, source)
+	})
+}
+
+// ApplyCounters adds buffered PV, UV and source counts in one pipeline per shard. The counts of
+// healthy shards are applied even when others fail.
+func (r *ShardedRedisRepository) ApplyCounters(ctx context.Context, deltas []*model.CounterDelta) error {
+	var shards []*redisShard
+	groups := make(map[*redisShard][]*model.CounterDelta)
+	for _, d := range deltas {
+		shard := r.shardFor(d.ShortCode)
+		if _, ok := groups[shard]; !ok {
+			shards = append(shards, shard)
+		}
+		groups[shard] = append(groups[shard], d)
+	}
+
+	var errs []error
+	for _, shard := range shards {
+		if err := shard.run(r.threshold, func(repo *RedisRepository) error {
+			return repo.ApplyCounters(ctx, groups[shard])
+		}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GetMinuteClicks gets the per-minute clicks of a short link over the last hour up to to
+func (r *ShardedRedisRepository) GetMinuteClicks(ctx context.Context, shortCode string, to time.Time) ([]int64, error) {
+	return query(r, shortCode, func(repo *RedisRepository) ([]int64, error) {
+		return repo.GetMinuteClicks(ctx, shortCode, to)
+	})
+}
+
+// GetSources gets the top sources for a short link
+func (r *ShardedRedisRepository) GetSources(ctx context.Context, shortCode string) (map[string]int64, error) {
+	return query(r, shortCode, func(repo *RedisRepository) (map[string]int64, error) {
+		return repo.GetSources(ctx, shortCode)
+	})
+}
+
+// ReserveCapacity reserves one slot in a code pool, failing when the pool is full
+func (r *ShardedRedisRepository) ReserveCapacity(ctx context.Context, pool string, capacity int64) (bool, error) {
+	return query(r, pool, func(repo *RedisRepository) (bool, error) {
+		return repo.ReserveCapacity(ctx, pool, capacity)
+	})
+}
+
+// ReleaseCapacity releases one slot in a code pool
+func (r *ShardedRedisRepository) ReleaseCapacity(ctx context.Context, pool string) error {
+	return r.call(pool, func(repo *RedisRepository) error {
+		return repo.ReleaseCapacity(ctx, pool)
+	})
+}
+
+// GetPoolUsage gets the number of reserved slots in a code pool
+func (r *ShardedRedisRepository) GetPoolUsage(ctx context.Context, pool string) (int64, error) {
+	return query(r, pool, func(repo *RedisRepository) (int64, error) {
+		return repo.GetPoolUsage(ctx, pool)
+	})
+}
+
+// PushFreeCode returns a short code to the free list of a code pool
+func (r *ShardedRedisRepository) PushFreeCode(ctx context.Context, pool, shortCode string) error {
+	return r.call(pool, func(repo *RedisRepository) error {
+		return repo.PushFreeCode(ctx, pool, shortCode)
+	})
+}
+
+// PopFreeCode takes a short code from the free list of a code pool
+func (r *ShardedRedisRepository) PopFreeCode(ctx context.Context, pool string) (string, error) {
+	return query(r, pool, func(repo *RedisRepository) (string, error) {
+		return repo.PopFreeCode(ctx, pool)
+	})
+}
+
+// CountFreeCodes counts the short codes in the free list of a code pool
+func (r *ShardedRedisRepository) CountFreeCodes(ctx context.Context, pool string) (int64, error) {
+	return query(r, pool, func(repo *RedisRepository) (int64, error) {
+		return repo.CountFreeCodes(ctx, pool)
+	})
+}
+
+// SaveClick records the link and source a click ID was issued for
+func (r *ShardedRedisRepository) SaveClick(ctx context.Context, clickID, shortCode, source string, ttl time.Duration) error {
+	return r.call(clickID, func(repo *RedisRepository) error {
+		return repo.SaveClick(ctx, clickID, shortCode, source, ttl)
+	})
+}
+
+// GetClick returns the link and source a click ID was issued for, ErrNotFound if unknown
+func (r *ShardedRedisRepository) GetClick(ctx context.Context, clickID string) (string, string, error) {
+	var shortCode, source string
+	err := r.call(clickID, func(repo *RedisRepository) (err error) {
+		shortCode, source, err = repo.GetClick(ctx, clickID)
+		return err
+	})
+	return shortCode, source, err
+}
+
+// SetClickLimit sets the number of clicks a short link redirects before it expires
+func (r *ShardedRedisRepository) SetClickLimit(ctx context.Context, shortCode string, limit int64, ttl time.Duration) error {
+	return r.call(shortCode, func(repo *RedisRepository) error {
+		return repo.SetClickLimit(ctx, shortCode, limit, ttl)
+	})
+}
+
+// ConsumeClick atomically counts a click against the click limit of a short link, the limit and
+// the cached link living on the same shard
+func (r *ShardedRedisRepository) ConsumeClick(ctx context.Context, shortCode string) (bool, bool, error) {
+	var allowed, last bool
+	err := r.call(shortCode, func(repo *RedisRepository) (err error) {
+		allowed, last, err = repo.ConsumeClick(ctx, shortCode)
+		return err
+	})
+	return allowed, last, err
+}
+
+// IncrementConversion increments the conversion count of a short link for a source
+func (r *ShardedRedisRepository) IncrementConversion(ctx context.Context, shortCode, source string) error {
+	return r.call(shortCode, func(repo *RedisRepository) error {
+		return repo.IncrementConversion(ctx, shortCode, source)
+	})
+}
+
+// GetConversions gets the conversion counts of a short link by source
+func (r *ShardedRedisRepository) GetConversions(ctx context.Context, shortCode string) (map[string]int64, error) {
+	return query(r, shortCode, func(repo *RedisRepository) (map[string]int64, error) {
+		return repo.GetConversions(ctx, shortCode)
+	})
+}
+
+// DeleteCounters removes every counter of a short link
+func (r *ShardedRedisRepository) DeleteCounters(ctx context.Context, shortCode string) error {
+	return r.call(shortCode, func(repo *RedisRepository) error {
+		return repo.DeleteCounters(ctx, shortCode)
+	})
+}
+
+// TouchStats records that the stats of a short link changed just now
+func (r *ShardedRedisRepository) TouchStats(ctx context.Context, shortCode string) error {
+	return r.call(shortCode, func(repo *RedisRepository) error {
+		return repo.TouchStats(ctx, shortCode)
+	})
+}
+
+// GetStatsUpdatedAt gets when the stats of a short link last changed, zero if unknown
+func (r *ShardedRedisRepository) GetStatsUpdatedAt(ctx context.Context, shortCode string) (time.Time, error) {
+	return query(r, shortCode, func(repo *RedisRepository) (time.Time, error) {
+		return repo.GetStatsUpdatedAt(ctx, shortCode)
+	})
+}
+
+// Close closes the connections to the shards, the shared instance is closed by its owner
+func (r *ShardedRedisRepository) Close() error {
+	var errs []error
+	for _, shard := range r.order {
+		errs = append(errs, shard.repo.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// dumpMergedUV merges the UV sketches of short links over period and returns the merged sketch
+// serialized by DUMP, empty when the period has no days
+func (r *RedisRepository) dumpMergedUV(ctx context.Context, shortCodes []string, period model.Period) (string, error) {
+	keys := r.uvSketchKeys(shortCodes, period)
+	if len(keys) == 0 {
+		return "", nil
+	}
+
+	mergedKey := mergeKeyPrefix + util.GenerateUUID()
+	var dump *redis.StringCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pfMerge(ctx, pipe, mergedKey, keys)
+		dump = pipe.Dump(ctx, mergedKey)
+		pipe.Del(ctx, mergedKey)
+		return nil
+	})
+	if err != nil {
+		return "", redisError(err)
+	}
+	return dump.Val(), nil
+}
+
+// countDumpedUV counts the union of sketches serialized by DUMP, restoring them into temporary
+// keys dropped in the same transaction
+func (r *RedisRepository) countDumpedUV(ctx context.Context, sketches []string) (int64, error) {
+	keys := make([]string, len(sketches))
+	for i := range sketches {
+		keys[i] = mergeKeyPrefix + util.GenerateUUID()
+	}
+
+	var count *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, sketch := range sketches {
+			pipe.Restore(ctx, keys[i], 0, sketch)
+		}
+		count = pipe.PFCount(ctx, keys...)
+		pipe.Del(ctx, keys...)
+		return nil
+	})
+	if err != nil {
+		return 0, redisError(err)
+	}
+	return count.Val(), nil
+}
@@ -0,0 +1,281 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+)
+
+func newTestShardedRepo(t *testing.T, names ...string) (*ShardedRedisRepository, map[string]*miniredis.Miniredis) {
+	shared, _ := newTestRedisRepo(t)
+
+	servers := make(map[string]*miniredis.Miniredis, len(names))
+	cfg := &config.RedisShardsConfig{VirtualNodes: 160, FailureThreshold: 2}
+	for _, name := range names {
+		servers[name] = miniredis.RunT(t)
+		cfg.Shards = append(cfg.Shards, config.RedisShardConfig{Name: name, Addr: servers[name].Addr()})
+	}
+
+	r := NewShardedRedisRepository(shared, cfg)
+	t.Cleanup(func() { r.Close() })
+	return r, servers
+}
+
+// codeOn finds a short code owned by a shard
+func codeOn(t *testing.T, r *ShardedRedisRepository, shard string) string {
+	for i := 0; i < 1000; i++ {
+		code := fmt.Sprintf("C%03d", i)
+		if r.ring.Get(code) == shard {
+			return code
+		}
+	}
+	t.Fatalf("no short code on shard %s", shard)
+	return ""
+}
+
+func TestShardToken(t *testing.T) {
+	tests := []struct {
+		key   string
+		token string
+		ok    bool
+	}{
+		{key: "sl:v2:url:https://example.com:abc", token: "https://example.com:abc", ok: true},
+		{key: "sl:v2:code:ABCD", token: "ABCD", ok: true},
+		{key: "sl:pv:ABCD", token: "ABCD", ok: true},
+		{key: "sl:uv:ABCD:2024-01-01", token: "ABCD", ok: true},
+		{key: "sl:hll:ABCD:2024-01-01", token: "ABCD", ok: true},
+		{key: "sl:source:ABCD:google:2024-01-01", token: "ABCD", ok: true},
+		{key: "sl:pool:sms:free", token: "sms", ok: true},
+		{key: "sl:click:3f2a", token: "3f2a", ok: true},
+		{key: "sl:limit:ABCD", token: "ABCD", ok: true},
+		{key: "sl:minutes:ABCD", token: "ABCD", ok: true},
+		{key: "sl:link:ABCD", token: "ABCD", ok: true},
+		{key: "sl:uv:AB%3ACD:2024-01-01", token: "AB:CD", ok: true},
+		{key: "sl:https://example.com", token: "https://example.com", ok: true},
+		{key: "sl:hll-merge:3f2a", ok: false},
+		{key: "shortlink:bloom", ok: false},
+		{key: "octopus:access_log", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			token, ok := shardToken(tt.key)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.token, token)
+		})
+	}
+}
+
+func TestShardedRedisRepository_Routing(t *testing.T) {
+	ctx := context.Background()
+	r, servers := newTestShardedRepo(t, "a", "b", "c")
+
+	for _, name := range []string{"a", "b", "c"} {
+		code := codeOn(t, r, name)
+		require.NoError(t, r.CacheShortLink(ctx, &model.ShortLink{ShortCode: code, OriginalURL: "https://example.com"}, time.Hour))
+		_, err := r.IncrementPV(ctx, code)
+		require.NoError(t, err)
+		require.NoError(t, r.SetClickLimit(ctx, code, 5, 0))
+
+		// Every key of a short link lives on its shard
+		for other, s := range servers {
+			assert.Equal(t, other == name, s.Exists(CodeKeyPrefix+code), "%s on %s", code, other)
+			assert.Equal(t, other == name, s.Exists(PVKeyPrefix+code), "%s on %s", code, other)
+			assert.Equal(t, other == name, s.Exists(ClickLimitPrefix+code), "%s on %s", code, other)
+		}
+
+		cached, err := r.GetCachedShortLink(ctx, code)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com", cached.OriginalURL)
+		allowed, last, err := r.ConsumeClick(ctx, code)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+		assert.False(t, last)
+	}
+}
+
+func TestShardedRedisRepository_SaveShortLinkPair(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestShardedRepo(t, "a", "b")
+
+	code := codeOn(t, r, "a")
+	cacheKey := "https://example.com/0"
+	for i := 1; r.ring.Get(cacheKey) == "a"; i++ {
+		cacheKey = fmt.Sprintf("https://example.com/%d", i)
+	}
+
+	require.NoError(t, r.SaveShortLinkPair(ctx, cacheKey, &model.ShortLink{ShortCode: code}, time.Hour))
+
+	shortCode, err := r.GetShortLink(ctx, cacheKey)
+	require.NoError(t, err)
+	assert.Equal(t, code, shortCode)
+	cached, err := r.GetCachedShortLink(ctx, code)
+	require.NoError(t, err)
+	assert.Equal(t, code, cached.ShortCode)
+}
+
+func TestShardedRedisRepository_GetCachedShortLinks(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestShardedRepo(t, "a", "b")
+
+	codes := []string{codeOn(t, r, "a"), codeOn(t, r, "b"), "NONEXIST"}
+	for _, code := range codes[:2] {
+		require.NoError(t, r.CacheShortLink(ctx, &model.ShortLink{ShortCode: code, OriginalURL: "https://example.com/" + code}, time.Hour))
+	}
+
+	links, err := r.GetCachedShortLinks(ctx, codes)
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	for _, code := range codes[:2] {
+		assert.Equal(t, "https://example.com/"+code, links[code].OriginalURL)
+	}
+}
+
+func TestShardedRedisRepository_ApplyCounters(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestShardedRepo(t, "a", "b")
+	codeA, codeB := codeOn(t, r, "a"), codeOn(t, r, "b")
+
+	require.NoError(t, r.ApplyCounters(ctx, []*model.CounterDelta{
+		{ShortCode: codeA, PV: 2, Visitors: []string{"v1"}},
+		{ShortCode: codeB, PV: 3, Sources: map[string]int64{"google": 3}},
+	}))
+
+	pv, err := r.GetPV(ctx, codeA)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), pv)
+	pv, err = r.GetPV(ctx, codeB)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), pv)
+	sources, err := r.GetSources(ctx, codeB)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"google": 3}, sources)
+}
+
+func TestShardedRedisRepository_GetMergedUV(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestShardedRepo(t, "a", "b")
+
+	// Links on the same shard are merged there
+	code1 := codeOn(t, r, "a")
+	code2 := "C999"
+	for i := 998; r.ring.Get(code2) != "a" || code2 == code1; i-- {
+		code2 = fmt.Sprintf("C%03d", i)
+	}
+	_, err := r.AddUV(ctx, code1, "v1")
+	require.NoError(t, err)
+	_, err = r.AddUV(ctx, code2, "v1")
+	require.NoError(t, err)
+	_, err = r.AddUV(ctx, code2, "v2")
+	require.NoError(t, err)
+
+	today := model.Period{From: time.Now(), To: time.Now()}
+	uv, err := r.GetMergedUV(ctx, []string{code1, code2}, today)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), uv)
+
+	uv, err = r.GetMergedUV(ctx, nil, today)
+	require.NoError(t, err)
+	assert.Zero(t, uv)
+}
+
+func TestShardedRedisRepository_Health(t *testing.T) {
+	ctx := context.Background()
+	r, servers := newTestShardedRepo(t, "a", "b")
+	codeA, codeB := codeOn(t, r, "a"), codeOn(t, r, "b")
+
+	servers["b"].Close()
+
+	// Failures to reach a shard are counted until the threshold takes it down
+	for i := 0; i < 2; i++ {
+		_, err := r.GetPV(ctx, codeB)
+		assert.ErrorIs(t, err, ErrUnavailable)
+	}
+	_, err := r.GetPV(ctx, codeB)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.ErrorContains(t, err, "redis shard b is down")
+
+	// Other shards keep serving
+	_, err = r.IncrementPV(ctx, codeA)
+	assert.NoError(t, err)
+
+	stats := r.Stats()
+	require.Len(t, stats, 2)
+	assert.True(t, stats[0].Healthy)
+	assert.False(t, stats[1].Healthy)
+	assert.Equal(t, int64(2), stats[1].Failures)
+	assert.NotEmpty(t, stats[1].LastError)
+
+	// A passing health check brings the shard back
+	r.checkHealth(ctx, time.Second)
+	assert.False(t, r.Stats()[1].Healthy)
+
+	require.NoError(t, servers["b"].Restart())
+	r.checkHealth(ctx, time.Second)
+	stats = r.Stats()
+	assert.True(t, stats[1].Healthy)
+	assert.Zero(t, stats[1].Failures)
+
+	_, err = r.IncrementPV(ctx, codeB)
+	assert.NoError(t, err)
+}
+
+func TestShardedRedisRepository_Reshard(t *testing.T) {
+	ctx := context.Background()
+	r, servers := newTestShardedRepo(t, "a", "b")
+	old, oldServer := newTestRedisRepo(t)
+	codeA, codeB := codeOn(t, r, "a"), codeOn(t, r, "b")
+
+	// Keys left on an instance leaving the ring, and on the wrong shard
+	require.NoError(t, oldServer.Set(CodeKeyPrefix+codeA, "link a"))
+	oldServer.SetTTL(CodeKeyPrefix+codeA, time.Hour)
+	require.NoError(t, oldServer.Set(PVKeyPrefix+codeB, "7"))
+	require.NoError(t, oldServer.Set("shortlink:bloom", "filter"))
+	require.NoError(t, servers["a"].Set(CodeKeyPrefix+codeB, "link b"))
+	require.NoError(t, servers["a"].Set(PVKeyPrefix+codeA, "3"))
+	// Written on its new shard since the ring changed
+	require.NoError(t, oldServer.Set(ClickLimitPrefix+codeB, "stale"))
+	require.NoError(t, servers["b"].Set(ClickLimitPrefix+codeB, "fresh"))
+
+	t.Run("dry run only counts", func(t *testing.T) {
+		result, err := r.Reshard(ctx, []*RedisRepository{old}, 100, true)
+		require.NoError(t, err)
+		assert.Equal(t, &ReshardResult{Scanned: 6, Moved: 4}, result)
+		assert.True(t, oldServer.Exists(CodeKeyPrefix+codeA))
+	})
+
+	t.Run("moves keys to their shard", func(t *testing.T) {
+		result, err := r.Reshard(ctx, []*RedisRepository{old}, 100, false)
+		require.NoError(t, err)
+		// The key moved from shard a is checked again on shard b
+		assert.Equal(t, &ReshardResult{Scanned: 7, Moved: 3, Kept: 1}, result)
+
+		value, _ := servers["a"].Get(CodeKeyPrefix + codeA)
+		assert.Equal(t, "link a", value)
+		assert.Equal(t, time.Hour, servers["a"].TTL(CodeKeyPrefix+codeA))
+		value, _ = servers["b"].Get(PVKeyPrefix + codeB)
+		assert.Equal(t, "7", value)
+		value, _ = servers["b"].Get(CodeKeyPrefix + codeB)
+		assert.Equal(t, "link b", value)
+		value, _ = servers["b"].Get(ClickLimitPrefix + codeB)
+		assert.Equal(t, "fresh", value)
+
+		assert.Equal(t, []string{"shortlink:bloom"}, oldServer.Keys(), "shared state stays")
+		assert.Equal(t, []string{PVKeyPrefix + codeA, CodeKeyPrefix + codeA}, servers["a"].Keys())
+	})
+
+	t.Run("never drains a shard", func(t *testing.T) {
+		result, err := r.Reshard(ctx, []*RedisRepository{r.shards["a"].repo}, 100, false)
+		require.NoError(t, err)
+		assert.Equal(t, &ReshardResult{Scanned: 5}, result)
+		assert.Len(t, servers["a"].Keys(), 2)
+	})
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
@@ -10,6 +11,8 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/pkg/clock"
 )
 
 func newTestRedisRepo(t *testing.T) (*RedisRepository, *miniredis.Miniredis) {
@@ -23,6 +26,8 @@ func newTestRedisRepo(t *testing.T) (*RedisRepository, *miniredis.Miniredis) {
 			Password: "",
 			DB:       0,
 		},
+		retention: defaultRetention,
+		clock:     clock.Real,
 	}, s
 }
 
@@ -36,7 +41,8 @@ func TestNewRedisRepository(t *testing.T) {
 		DB:       0,
 	}
 
-	repo := NewRedisRepository(cfg)
+	repo, err := NewRedisRepository(cfg)
+	require.NoError(t, err)
 
 	assert.NotNil(t, repo)
 	assert.NotNil(t, repo.client)
@@ -46,19 +52,119 @@ func TestNewRedisRepository(t *testing.T) {
 	repo.Close()
 }
 
+func TestNewRedisRepository_Unavailable(t *testing.T) {
+	s := miniredis.RunT(t)
+	addr := s.Addr()
+	s.Close()
+
+	repo, err := NewRedisRepository(&config.RedisConfig{Addr: addr})
+
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.Nil(t, repo)
+}
+
 func TestRedisRepository_SaveShortLink(t *testing.T) {
 	repo, _ := newTestRedisRepo(t)
 	defer repo.Close()
 
 	ctx := context.Background()
 
-	err := repo.SaveShortLink(ctx, "ABCD", "https://example.com", ShortLinkCacheTTL)
+	err := repo.SaveShortLink(ctx, "https://example.com", "ABCD", ShortLinkCacheTTL)
 	require.NoError(t, err)
 
 	// Verify it was saved
-	url, err := repo.GetShortLink(ctx, "ABCD")
+	shortCode, err := repo.GetShortLink(ctx, "https://example.com")
 	assert.NoError(t, err)
-	assert.Equal(t, "https://example.com", url)
+	assert.Equal(t, "ABCD", shortCode)
+}
+
+func TestRedisRepository_SaveShortLinkPair(t *testing.T) {
+	repo, s := newTestRedisRepo(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+
+	sl := &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com", Status: 1}
+	err := repo.SaveShortLinkPair(ctx, "https://example.com", sl, ShortLinkCacheTTL)
+	require.NoError(t, err)
+
+	shortCode, err := repo.GetShortLink(ctx, "https://example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "ABCD", shortCode)
+	cached, err := repo.GetCachedShortLink(ctx, "ABCD")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com", cached.OriginalURL)
+	assert.Equal(t, ShortLinkCacheTTL, s.TTL(CodeKeyPrefix+"ABCD"))
+}
+
+func TestRedisRepository_CacheShortLink(t *testing.T) {
+	repo, s := newTestRedisRepo(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+
+	t.Run("caches all fields", func(t *testing.T) {
+		expireAt := time.Now().Add(time.Hour).Truncate(time.Second)
+		sl := &model.ShortLink{
+			ID:          42,
+			ShortCode:   "ABCD",
+			OriginalURL: "https://example.com",
+			Params:      []byte(`{"utm_source":"google"}`),
+			ExpireAt:    &expireAt,
+			Status:      1,
+			NoClickID:   true,
+			MaxClicks:   3,
+			Referrers:   "news.example.com",
+			GeoDeny:     "US",
+		}
+		require.NoError(t, repo.CacheShortLink(ctx, sl, time.Hour))
+
+		cached, err := repo.GetCachedShortLink(ctx, "ABCD")
+		require.NoError(t, err)
+		assert.Equal(t, sl.ID, cached.ID)
+		assert.Equal(t, sl.OriginalURL, cached.OriginalURL)
+		assert.JSONEq(t, string(sl.Params), string(cached.Params))
+		assert.True(t, expireAt.Equal(*cached.ExpireAt))
+		assert.Equal(t, 1, cached.Status)
+		assert.True(t, cached.NoClickID)
+		assert.Equal(t, int64(3), cached.MaxClicks)
+		assert.Equal(t, "news.example.com", cached.Referrers)
+		assert.Equal(t, "US", cached.GeoDeny)
+		assert.Equal(t, time.Hour, s.TTL(CodeKeyPrefix+"ABCD"))
+	})
+
+	t.Run("miss", func(t *testing.T) {
+		_, err := repo.GetCachedShortLink(ctx, "NONEXIST")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("undecodable entry", func(t *testing.T) {
+		s.Set(CodeKeyPrefix+"WXYZ", "https://example.com")
+
+		_, err := repo.GetCachedShortLink(ctx, "WXYZ")
+		assert.Error(t, err)
+	})
+}
+
+func TestRedisRepository_GetCachedShortLinks(t *testing.T) {
+	repo, s := newTestRedisRepo(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+	require.NoError(t, repo.CacheShortLink(ctx, &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/a"}, time.Hour))
+	require.NoError(t, repo.CacheShortLink(ctx, &model.ShortLink{ShortCode: "EFGH", OriginalURL: "https://example.com/e"}, time.Hour))
+	s.Set(CodeKeyPrefix+"WXYZ", "https://example.com")
+
+	// Misses and undecodable entries are left out
+	links, err := repo.GetCachedShortLinks(ctx, []string{"ABCD", "NONEXIST", "WXYZ", "EFGH"})
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	assert.Equal(t, "https://example.com/a", links["ABCD"].OriginalURL)
+	assert.Equal(t, "https://example.com/e", links["EFGH"].OriginalURL)
+
+	links, err = repo.GetCachedShortLinks(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, links)
 }
 
 func TestRedisRepository_GetShortLink(t *testing.T) {
@@ -68,7 +174,7 @@ func TestRedisRepository_GetShortLink(t *testing.T) {
 	ctx := context.Background()
 
 	t.Run("existing short link", func(t *testing.T) {
-		s.Set(ShortLinkKeyPrefix+"ABCD", "https://example.com")
+		s.Set(URLKeyPrefix+"ABCD", "https://example.com")
 
 		url, err := repo.GetShortLink(ctx, "ABCD")
 		assert.NoError(t, err)
@@ -78,7 +184,70 @@ func TestRedisRepository_GetShortLink(t *testing.T) {
 	t.Run("non-existent short link", func(t *testing.T) {
 		_, err := repo.GetShortLink(ctx, "NONEXIST")
 		assert.Error(t, err)
-		assert.Equal(t, redis.Nil, err)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestRedisRepository_LegacyKeys(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("cached link moved to the v2 key", func(t *testing.T) {
+		repo, s := newTestRedisRepo(t)
+		defer repo.Close()
+		repo.legacyReads = true
+
+		s.Set(LegacyCodeKeyPrefix+"ABCD", `{"short_code":"ABCD","original_url":"https://example.com"}`)
+		s.SetTTL(LegacyCodeKeyPrefix+"ABCD", time.Hour)
+
+		sl, err := repo.GetCachedShortLink(ctx, "ABCD")
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com", sl.OriginalURL)
+		assert.False(t, s.Exists(LegacyCodeKeyPrefix+"ABCD"))
+		assert.True(t, s.Exists(CodeKeyPrefix+"ABCD"))
+		assert.Equal(t, time.Hour, s.TTL(CodeKeyPrefix+"ABCD"))
+	})
+
+	t.Run("lookup key moved to the v2 key", func(t *testing.T) {
+		repo, s := newTestRedisRepo(t)
+		defer repo.Close()
+		repo.legacyReads = true
+
+		s.Set(LegacyURLKeyPrefix+"https://example.com", "ABCD")
+
+		shortCode, err := repo.GetShortLink(ctx, "https://example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "ABCD", shortCode)
+		assert.False(t, s.Exists(LegacyURLKeyPrefix+"https://example.com"))
+		got, _ := s.Get(URLKeyPrefix + "https://example.com")
+		assert.Equal(t, "ABCD", got)
+		assert.Zero(t, s.TTL(URLKeyPrefix+"https://example.com"))
+	})
+
+	t.Run("legacy reads disabled", func(t *testing.T) {
+		repo, s := newTestRedisRepo(t)
+		defer repo.Close()
+
+		s.Set(LegacyCodeKeyPrefix+"ABCD", `{"short_code":"ABCD"}`)
+
+		_, err := repo.GetCachedShortLink(ctx, "ABCD")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.True(t, s.Exists(LegacyCodeKeyPrefix+"ABCD"))
+
+		exists, err := repo.ExistsShortLink(ctx, "ABCD")
+		assert.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("delete drops the legacy key", func(t *testing.T) {
+		repo, s := newTestRedisRepo(t)
+		defer repo.Close()
+		repo.legacyReads = true
+
+		s.Set(LegacyCodeKeyPrefix+"ABCD", `{"short_code":"ABCD"}`)
+
+		require.NoError(t, repo.DeleteShortLink(ctx, "ABCD"))
+		_, err := repo.GetCachedShortLink(ctx, "ABCD")
+		assert.ErrorIs(t, err, ErrNotFound)
 	})
 }
 
@@ -89,7 +258,7 @@ func TestRedisRepository_ExistsShortLink(t *testing.T) {
 	ctx := context.Background()
 
 	t.Run("existing short link", func(t *testing.T) {
-		s.Set(ShortLinkKeyPrefix+"ABCD", "https://example.com")
+		s.Set(CodeKeyPrefix+"ABCD", `{"short_code":"ABCD"}`)
 
 		exists, err := repo.ExistsShortLink(ctx, "ABCD")
 		assert.NoError(t, err)
@@ -150,7 +319,7 @@ func TestRedisRepository_GetPV(t *testing.T) {
 	t.Run("non-existent PV", func(t *testing.T) {
 		_, err := repo.GetPV(ctx, "NONEXIST")
 		assert.Error(t, err)
-		assert.Equal(t, redis.Nil, err)
+		assert.ErrorIs(t, err, ErrNotFound)
 	})
 }
 
@@ -196,6 +365,28 @@ func TestRedisRepository_AddUV(t *testing.T) {
 	})
 }
 
+func TestRedisRepository_AddUVMidnightRollover(t *testing.T) {
+	repo, s := newTestRedisRepo(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+	now := clock.NewFake(time.Date(2024, 3, 1, 23, 59, 59, 0, time.UTC))
+	repo.clock = now
+
+	added, err := repo.AddUV(ctx, "ABCD", "visitor1")
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	// The same visitor counts again on the next UTC day
+	now.Advance(time.Second)
+	added, err = repo.AddUV(ctx, "ABCD", "visitor1")
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	assert.True(t, s.Exists(UVKeyPrefix+"ABCD:2024-03-01"))
+	assert.True(t, s.Exists(UVKeyPrefix+"ABCD:2024-03-02"))
+}
+
 func TestRedisRepository_GetUV(t *testing.T) {
 	repo, _ := newTestRedisRepo(t)
 	defer repo.Close()
@@ -219,6 +410,91 @@ func TestRedisRepository_GetUV(t *testing.T) {
 	})
 }
 
+func TestRedisRepository_DeleteCounters(t *testing.T) {
+	repo, _ := newTestRedisRepo(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+	require.NoError(t, repo.RecordAccessPipelined(ctx, "ABCD", "visitor1", "google"))
+	require.NoError(t, repo.RecordAccessPipelined(ctx, "ABCDE", "visitor1", "google"))
+	require.NoError(t, repo.IncrementConversion(ctx, "ABCD", "google"))
+	require.NoError(t, repo.SetClickLimit(ctx, "ABCD", 2, 0))
+
+	require.NoError(t, repo.DeleteCounters(ctx, "ABCD"))
+
+	_, err := repo.GetPV(ctx, "ABCD")
+	assert.ErrorIs(t, err, ErrNotFound)
+	uv, err := repo.GetUV(ctx, "ABCD")
+	assert.NoError(t, err)
+	assert.Zero(t, uv)
+	sources, err := repo.GetSources(ctx, "ABCD")
+	assert.NoError(t, err)
+	assert.Empty(t, sources)
+	conversions, err := repo.GetConversions(ctx, "ABCD")
+	assert.NoError(t, err)
+	assert.Empty(t, conversions)
+	merged, err := repo.GetMergedUV(ctx, []string{"ABCD"}, model.Period{From: repo.clock.Now().UTC().Truncate(24 * time.Hour), To: repo.clock.Now().UTC()})
+	assert.NoError(t, err)
+	assert.Zero(t, merged)
+	updated, err := repo.GetStatsUpdatedAt(ctx, "ABCD")
+	assert.NoError(t, err)
+	assert.True(t, updated.IsZero())
+
+	// Links whose code starts the same are left alone
+	pv, err := repo.GetPV(ctx, "ABCDE")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), pv)
+}
+
+func TestRedisRepository_GetMergedUV(t *testing.T) {
+	repo, _ := newTestRedisRepo(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+	today := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	repo.clock = clock.NewFake(today.Add(12 * time.Hour))
+	period := model.Period{From: today.AddDate(0, 0, -1), To: today}
+
+	_, _ = repo.AddUV(ctx, "ABCD", "visitor1")
+	_, _ = repo.AddUV(ctx, "ABCD", "visitor2")
+	_, _ = repo.AddUV(ctx, "XYZ", "visitor2")
+	require.NoError(t, repo.ApplyCounters(ctx, []*model.CounterDelta{
+		{ShortCode: "XYZ", PV: 2, Visitors: []string{"visitor3", "visitor1"}},
+	}))
+
+	t.Run("visitors of several links count once", func(t *testing.T) {
+		uv, err := repo.GetMergedUV(ctx, []string{"ABCD", "XYZ"}, period)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), uv)
+	})
+
+	t.Run("single link", func(t *testing.T) {
+		uv, err := repo.GetMergedUV(ctx, []string{"XYZ"}, period)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), uv)
+	})
+
+	t.Run("links without visitors", func(t *testing.T) {
+		uv, err := repo.GetMergedUV(ctx, []string{"NONEXIST"}, period)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), uv)
+	})
+
+	t.Run("days outside the period", func(t *testing.T) {
+		require.NoError(t, repo.ApplyCounters(ctx, []*model.CounterDelta{
+			{ShortCode: "OLD", PV: 1, Visitors: []string{"visitor1"}, AccessTime: today.AddDate(0, 0, -5)},
+		}))
+
+		uv, err := repo.GetMergedUV(ctx, []string{"OLD", "XYZ"}, period)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), uv)
+
+		uv, err = repo.GetMergedUV(ctx, []string{"OLD"}, model.Period{From: today.AddDate(0, 0, -7), To: today})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), uv)
+	})
+}
+
 func TestRedisRepository_AddSource(t *testing.T) {
 	repo, _ := newTestRedisRepo(t)
 	defer repo.Close()
@@ -246,6 +522,136 @@ func TestRedisRepository_AddSource(t *testing.T) {
 	})
 }
 
+func TestRedisRepository_RecordAccessPipelined(t *testing.T) {
+	repo, _ := newTestRedisRepo(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+
+	require.NoError(t, repo.RecordAccessPipelined(ctx, "ABCD", "1.1.1.1", "google"))
+	require.NoError(t, repo.RecordAccessPipelined(ctx, "ABCD", "1.1.1.1", ""))
+
+	pv, err := repo.GetPV(ctx, "ABCD")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), pv)
+	uv, err := repo.GetUV(ctx, "ABCD")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), uv)
+	sources, err := repo.GetSources(ctx, "ABCD")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"google": 1}, sources)
+
+	updatedAt, err := repo.GetStatsUpdatedAt(ctx, "ABCD")
+	assert.NoError(t, err)
+	assert.False(t, updatedAt.IsZero())
+}
+
+func TestRedisRepository_ApplyCounters(t *testing.T) {
+	repo, s := newTestRedisRepo(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+
+	require.NoError(t, repo.AddSource(ctx, "ABCD", "google"))
+	require.NoError(t, repo.ApplyCounters(ctx, []*model.CounterDelta{
+		{ShortCode: "ABCD", PV: 3, Visitors: []string{"1.1.1.1", "2.2.2.2"}, Sources: map[string]int64{"google": 2, "direct": 1}},
+		{ShortCode: "XYZ", PV: 1, Visitors: []string{"1.1.1.1"}},
+	}))
+
+	pv, err := repo.GetPV(ctx, "ABCD")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), pv)
+	uv, err := repo.GetUV(ctx, "ABCD")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), uv)
+	sources, err := repo.GetSources(ctx, "ABCD")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"google": 3, "direct": 1}, sources)
+
+	updatedAt, err := repo.GetStatsUpdatedAt(ctx, "XYZ")
+	assert.NoError(t, err)
+	assert.False(t, updatedAt.IsZero())
+	assert.Equal(t, StatsExpireDuration, s.TTL(PVKeyPrefix+"XYZ"))
+
+	assert.NoError(t, repo.ApplyCounters(ctx, nil))
+
+	// Clicks buffered before midnight are counted in their own day once flushed after it
+	repo.clock = clock.NewFake(time.Date(2026, 10, 17, 0, 0, 5, 0, time.UTC))
+	require.NoError(t, repo.ApplyCounters(ctx, []*model.CounterDelta{{
+		ShortCode: "LATE", PV: 1, Visitors: []string{"1.1.1.1"}, Sources: map[string]int64{"google": 1},
+		AccessTime: time.Date(2026, 10, 16, 23, 59, 58, 0, time.UTC),
+	}}))
+	assert.True(t, s.Exists(UVKeyPrefix+"LATE:2026-10-16"))
+	assert.True(t, s.Exists(SourceKeyPrefix+"LATE:google:2026-10-16"))
+	assert.False(t, s.Exists(UVKeyPrefix+"LATE:2026-10-17"))
+}
+
+func TestRedisRepository_MinuteClicks(t *testing.T) {
+	repo, s := newTestRedisRepo(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+	now := clock.NewFake(time.Date(2026, 10, 16, 9, 0, 30, 0, time.UTC))
+	repo.clock = now
+	apply := func(pv int64) {
+		require.NoError(t, repo.ApplyCounters(ctx, []*model.CounterDelta{{ShortCode: "ABCD", PV: pv}}))
+	}
+
+	apply(2)
+	apply(3)
+	now.Advance(time.Minute)
+	apply(1)
+	assert.Equal(t, time.Hour, s.TTL(MinuteClicksPrefix+"ABCD"))
+
+	clicks, err := repo.GetMinuteClicks(ctx, "ABCD", now.Now())
+	require.NoError(t, err)
+	require.Len(t, clicks, MinuteClicksWindow)
+	assert.Equal(t, []int64{5, 1}, clicks[MinuteClicksWindow-2:])
+	assert.Equal(t, make([]int64, MinuteClicksWindow-2), clicks[:MinuteClicksWindow-2])
+
+	// An hour later the slot of 09:00 counts 10:00 from scratch, and 09:01 has left the window
+	now.Advance(59 * time.Minute)
+	apply(4)
+	clicks, err = repo.GetMinuteClicks(ctx, "ABCD", now.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), clicks[MinuteClicksWindow-1])
+	assert.Equal(t, int64(1), clicks[0])
+	now.Advance(time.Minute)
+	clicks, err = repo.GetMinuteClicks(ctx, "ABCD", now.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), clicks[MinuteClicksWindow-2])
+	assert.Zero(t, clicks[0])
+
+	clicks, err = repo.GetMinuteClicks(ctx, "WXYZ", now.Now())
+	require.NoError(t, err)
+	assert.Equal(t, make([]int64, MinuteClicksWindow), clicks)
+}
+
+func TestRedisRepository_Retention(t *testing.T) {
+	repo, s := newTestRedisRepo(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+	repo.SetRetention(&config.RetentionConfig{PV: 0, UV: time.Hour, Sources: 7 * 24 * time.Hour})
+
+	require.NoError(t, repo.ApplyCounters(ctx, []*model.CounterDelta{
+		{ShortCode: "ABCD", PV: 2, Visitors: []string{"1.1.1.1"}, Sources: map[string]int64{"google": 2}},
+	}))
+	require.NoError(t, repo.IncrementConversion(ctx, "ABCD", "google"))
+
+	day := time.Now().Format("2006-01-02")
+	assert.Zero(t, s.TTL(PVKeyPrefix+"ABCD"))
+	assert.Zero(t, s.TTL(ConversionKeyPrefix+"ABCD"))
+	assert.Equal(t, time.Hour, s.TTL(UVKeyPrefix+"ABCD:"+day))
+	assert.Equal(t, 7*24*time.Hour, s.TTL(SourceKeyPrefix+"ABCD:google:"+day))
+	// The last change time outlives the stats kept forever
+	assert.Zero(t, s.TTL(StatsUpdatedPrefix+"ABCD"))
+
+	repo.SetRetention(&config.RetentionConfig{PV: time.Hour, UV: 2 * time.Hour, Sources: time.Hour})
+	require.NoError(t, repo.TouchStats(ctx, "XYZ"))
+	assert.Equal(t, 2*time.Hour, s.TTL(StatsUpdatedPrefix+"XYZ"))
+}
+
 func TestRedisRepository_GetSources(t *testing.T) {
 	repo, _ := newTestRedisRepo(t)
 	defer repo.Close()
@@ -272,6 +678,43 @@ func TestRedisRepository_GetSources(t *testing.T) {
 	})
 }
 
+func TestRedisRepository_KeySegments(t *testing.T) {
+	repo, s := newTestRedisRepo(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+	_, err := repo.IncrementPV(ctx, "ABCD")
+	require.NoError(t, err)
+	_, err = repo.AddUV(ctx, "ABCD", "visitor1")
+	require.NoError(t, err)
+	require.NoError(t, repo.AddSource(ctx, "ABCD", "google"))
+
+	// Keys of short codes are unchanged
+	assert.True(t, s.Exists("sl:pv:ABCD"))
+
+	// Glob metacharacters do not widen the patterns of other links
+	for _, code := range []string{"*", "AB*", "ABC?", "[A]BCD"} {
+		uv, err := repo.GetUV(ctx, code)
+		require.NoError(t, err)
+		assert.Zero(t, uv, code)
+		sources, err := repo.GetSources(ctx, code)
+		require.NoError(t, err)
+		assert.Empty(t, sources, code)
+		merged, err := repo.GetMergedUV(ctx, []string{code}, model.Period{From: time.Now(), To: time.Now()})
+		require.NoError(t, err)
+		assert.Zero(t, merged, code)
+	}
+
+	// Separators cannot reach the suffixed keys of another link
+	day := model.StatsDay(time.Now())
+	_, err = repo.IncrementPV(ctx, "ABCD:"+day)
+	require.NoError(t, err)
+	assert.True(t, s.Exists("sl:pv:ABCD%3A"+day))
+	pv, err := repo.GetPV(ctx, "ABCD")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pv)
+}
+
 func TestRedisRepository_Close(t *testing.T) {
 	repo, s := newTestRedisRepo(t)
 
@@ -287,12 +730,20 @@ func TestRedisRepository_Close(t *testing.T) {
 	s.Close()
 }
 
-func TestRedisRepository_shortLinkKey(t *testing.T) {
+func TestRedisRepository_urlKey(t *testing.T) {
+	repo, _ := newTestRedisRepo(t)
+	defer repo.Close()
+
+	assert.Equal(t, "sl:v2:url:https://example.com", repo.urlKey("https://example.com"))
+	assert.Equal(t, "sl:v2:url:ABCD", repo.urlKey("ABCD"))
+}
+
+func TestRedisRepository_codeKey(t *testing.T) {
 	repo, _ := newTestRedisRepo(t)
 	defer repo.Close()
 
-	assert.Equal(t, "sl:ABCD", repo.shortLinkKey("ABCD"))
-	assert.Equal(t, "sl:TEST", repo.shortLinkKey("TEST"))
+	assert.Equal(t, "sl:v2:code:ABCD", repo.codeKey("ABCD"))
+	assert.NotEqual(t, repo.urlKey("ABCD"), repo.codeKey("ABCD"))
 }
 
 func TestRedisRepository_pvKey(t *testing.T) {
@@ -330,3 +781,160 @@ func TestRedisRepository_GetClient(t *testing.T) {
 	err := client.Ping(ctx).Err()
 	assert.NoError(t, err)
 }
+
+func TestRedisRepository_DeleteShortLink(t *testing.T) {
+	repo, s := newTestRedisRepo(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+	s.Set(CodeKeyPrefix+"ABCD", `{"short_code":"ABCD"}`)
+
+	err := repo.DeleteShortLink(ctx, "ABCD")
+	assert.NoError(t, err)
+	assert.False(t, s.Exists(CodeKeyPrefix+"ABCD"))
+}
+
+func TestRedisRepository_ClickLimit(t *testing.T) {
+	repo, s := newTestRedisRepo(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+
+	t.Run("links without a limit always redirect", func(t *testing.T) {
+		allowed, last, err := repo.ConsumeClick(ctx, "FREE")
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+		assert.False(t, last)
+	})
+
+	t.Run("the click reaching the limit is the last one", func(t *testing.T) {
+		require.NoError(t, repo.SetClickLimit(ctx, "ABCD", 2, time.Hour))
+		require.NoError(t, repo.CacheShortLink(ctx, &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com"}, ShortLinkCacheTTL))
+		assert.Equal(t, time.Hour, s.TTL(ClickLimitPrefix+"ABCD"))
+
+		allowed, last, err := repo.ConsumeClick(ctx, "ABCD")
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+		assert.False(t, last)
+
+		allowed, last, err = repo.ConsumeClick(ctx, "ABCD")
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+		assert.True(t, last)
+		// The cached link is dropped with the last click
+		assert.False(t, s.Exists(CodeKeyPrefix+"ABCD"))
+
+		allowed, last, err = repo.ConsumeClick(ctx, "ABCD")
+		assert.NoError(t, err)
+		assert.False(t, allowed)
+		assert.False(t, last)
+	})
+
+	t.Run("restoring the limit keeps the clicks", func(t *testing.T) {
+		require.NoError(t, repo.SetClickLimit(ctx, "WXYZ", 2, 0))
+		_, _, err := repo.ConsumeClick(ctx, "WXYZ")
+		require.NoError(t, err)
+
+		require.NoError(t, repo.SetClickLimit(ctx, "WXYZ", 2, 0))
+		allowed, last, err := repo.ConsumeClick(ctx, "WXYZ")
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+		assert.True(t, last)
+	})
+}
+
+func TestRedisRepository_PoolCapacity(t *testing.T) {
+	repo, _ := newTestRedisRepo(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+
+	t.Run("reserve up to capacity", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			ok, err := repo.ReserveCapacity(ctx, "sms", 2)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}
+
+		ok, err := repo.ReserveCapacity(ctx, "sms", 2)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		used, err := repo.GetPoolUsage(ctx, "sms")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), used)
+	})
+
+	t.Run("release never goes negative", func(t *testing.T) {
+		assert.NoError(t, repo.ReleaseCapacity(ctx, "empty"))
+
+		used, err := repo.GetPoolUsage(ctx, "empty")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), used)
+	})
+}
+
+func TestRedisRepository_FreeCodes(t *testing.T) {
+	repo, _ := newTestRedisRepo(t)
+	defer repo.Close()
+
+	ctx := context.Background()
+
+	_, err := repo.PopFreeCode(ctx, "sms")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, repo.PushFreeCode(ctx, "sms", "ABCD"))
+	count, err := repo.CountFreeCodes(ctx, "sms")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	code, err := repo.PopFreeCode(ctx, "sms")
+	assert.NoError(t, err)
+	assert.Equal(t, "ABCD", code)
+}
+
+func TestRedisRepository_Click(t *testing.T) {
+	repo, s := newTestRedisRepo(t)
+	ctx := context.Background()
+
+	_, _, err := repo.GetClick(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, repo.SaveClick(ctx, "c1d2", "ABCD", "google", time.Hour))
+	assert.Equal(t, time.Hour, s.TTL(ClickKeyPrefix+"c1d2"))
+
+	shortCode, source, err := repo.GetClick(ctx, "c1d2")
+	assert.NoError(t, err)
+	assert.Equal(t, "ABCD", shortCode)
+	assert.Equal(t, "google", source)
+}
+
+func TestRedisRepository_Conversions(t *testing.T) {
+	repo, s := newTestRedisRepo(t)
+	ctx := context.Background()
+
+	require.NoError(t, repo.IncrementConversion(ctx, "ABCD", "google"))
+	require.NoError(t, repo.IncrementConversion(ctx, "ABCD", "google"))
+	require.NoError(t, repo.IncrementConversion(ctx, "ABCD", "direct"))
+	assert.Equal(t, StatsExpireDuration, s.TTL(ConversionKeyPrefix+"ABCD"))
+
+	conversions, err := repo.GetConversions(ctx, "ABCD")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"google": 2, "direct": 1}, conversions)
+}
+
+func TestRedisRepository_StatsUpdatedAt(t *testing.T) {
+	repo, _ := newTestRedisRepo(t)
+	ctx := context.Background()
+
+	updatedAt, err := repo.GetStatsUpdatedAt(ctx, "ABCD")
+	assert.NoError(t, err)
+	assert.True(t, updatedAt.IsZero())
+
+	before := time.Now()
+	assert.NoError(t, repo.TouchStats(ctx, "ABCD"))
+
+	updatedAt, err = repo.GetStatsUpdatedAt(ctx, "ABCD")
+	assert.NoError(t, err)
+	assert.False(t, updatedAt.Before(before))
+}
@@ -0,0 +1,471 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"octopus/internal/model"
+	"octopus/pkg/async"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ShadowGate decides whether the writes or reads of a short link are shadowed, rolling a
+// migration out to a share of the links. A nil gate shadows every link.
+type ShadowGate func(ctx context.Context, shortCode string) bool
+
+// shadowing mirrors writes of links to the storage a migration moves them to, and repeats reads
+// there in the background to count the results diverging from the current storage. The target
+// never fails a request: its errors are logged and counted.
+type shadowing struct {
+	storage string
+	target  string
+	timeout time.Duration
+	writes  ShadowGate
+	reads   ShadowGate
+
+	writeCount  atomic.Int64
+	writeErrors atomic.Int64
+	readCount   atomic.Int64
+	readErrors  atomic.Int64
+	divergences atomic.Int64
+
+	mu             sync.Mutex
+	lastDivergence string
+
+	// pending tracks the reads being compared, waited for on close
+	pending sync.WaitGroup
+}
+
+// SetGates sets the gates rolling shadow writes and shadow reads out
+func (s *shadowing) SetGates(writes, reads ShadowGate) {
+	s.writes = writes
+	s.reads = reads
+}
+
+// Stats returns the writes mirrored and the reads compared so far
+func (s *shadowing) Stats() model.ShadowStats {
+	s.mu.Lock()
+	last := s.lastDivergence
+	s.mu.Unlock()
+
+	return model.ShadowStats{
+		Storage:        s.storage,
+		Target:         s.target,
+		Writes:         s.writeCount.Load(),
+		WriteErrors:    s.writeErrors.Load(),
+		Reads:          s.readCount.Load(),
+		ReadErrors:     s.readErrors.Load(),
+		Divergences:    s.divergences.Load(),
+		LastDivergence: last,
+	}
+}
+
+// shadowWritesKey keys in a context the writes mirrored once its transaction commits
+type shadowWritesKey struct{}
+
+// shadowWrites are the writes of a transaction of the current storage, mirrored once it commits
+type shadowWrites struct {
+	mu     sync.Mutex
+	writes []func()
+}
+
+// add defers a write until the transaction commits
+func (w *shadowWrites) add(write func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writes = append(w.writes, write)
+}
+
+// flush mirrors the writes of a committed transaction in order
+func (w *shadowWrites) flush() {
+	w.mu.Lock()
+	writes := w.writes
+	w.writes = nil
+	w.mu.Unlock()
+
+	for _, write := range writes {
+		write()
+	}
+}
+
+// write mirrors a write of a short link that succeeded on the current storage. Writes made in a
+// transaction are mirrored once it commits, and dropped when it rolls back.
+func (s *shadowing) write(ctx context.Context, op, shortCode string, fn func(ctx context.Context) error) {
+	if pending, ok := ctx.Value(shadowWritesKey{}).(*shadowWrites); ok && pending != nil {
+		pending.add(func() {
+			s.write(context.WithValue(ctx, shadowWritesKey{}, (*shadowWrites)(nil)), op, shortCode, fn)
+		})
+		return
+	}
+	if s.writes != nil && !s.writes(ctx, shortCode) {
+		return
+	}
+
+	// The request may be over before the target answers
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.timeout)
+	defer cancel()
+
+	s.writeCount.Add(1)
+	if err := fn(ctx); err != nil {
+		s.writeErrors.Add(1)
+		log.Warn().Err(err).Str("storage", s.storage).Str("op", op).Str("short_code", shortCode).
+			Msg("Shadow write failed")
+	}
+}
+
+// read repeats a read of a short link on the target in the background and compares the results.
+// Reads that failed on the current storage have nothing to compare against.
+func (s *shadowing) read(ctx context.Context, op, shortCode string, current *model.ShortLink, err error,
+	fn func(ctx context.Context) (*model.ShortLink, error)) {
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return
+	}
+	if s.reads != nil && !s.reads(ctx, shortCode) {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	s.pending.Add(1)
+	async.Go(func() {
+		defer s.pending.Done()
+		ctx, cancel := context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+
+		s.readCount.Add(1)
+		target, err := fn(ctx)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			s.readErrors.Add(1)
+			log.Warn().Err(err).Str("storage", s.storage).Str("op", op).Str("short_code", shortCode).
+				Msg("Shadow read failed")
+			return
+		}
+
+		fields := diffShortLinks(current, target)
+		if len(fields) == 0 {
+			return
+		}
+		s.divergences.Add(1)
+		divergence := fmt.Sprintf("%s %s: %s", op, shortCode, strings.Join(fields, ", "))
+		s.mu.Lock()
+		s.lastDivergence = divergence
+		s.mu.Unlock()
+		log.Warn().Str("storage", s.storage).Str("op", op).Str("short_code", shortCode).Strs("fields", fields).
+			Msg("Shadow read diverged")
+	})
+}
+
+// diffShortLinks lists the fields of a short link differing between the current storage and the
+// target, nil standing for a link not found
+func diffShortLinks(current, target *model.ShortLink) []string {
+	switch {
+	case current == nil && target == nil:
+		return nil
+	case target == nil:
+		return []string{"missing"}
+	case current == nil:
+		return []string{"unexpected"}
+	}
+
+	var fields []string
+	check := func(field string, equal bool) {
+		if !equal {
+			fields = append(fields, field)
+		}
+	}
+	check("original_url", current.OriginalURL == target.OriginalURL)
+	check("status", current.Status == target.Status)
+	check("expire_at", equalTimes(current.ExpireAt, target.ExpireAt))
+	check("pool", current.Pool == target.Pool)
+	check("no_click_id", current.NoClickID == target.NoClickID)
+	check("max_clicks", current.MaxClicks == target.MaxClicks)
+	check("preserve_query", current.PreserveQuery == target.PreserveQuery)
+	check("title", current.Title == target.Title)
+	check("description", current.Description == target.Description)
+	check("notes", current.Notes == target.Notes)
+	check("public_stats", current.PublicStats == target.PublicStats)
+	check("no_tracking", current.NoTracking == target.NoTracking)
+	check("cache_control", current.CacheControl == target.CacheControl)
+	check("signed_params", current.SignedParams == target.SignedParams)
+	check("single_use", current.SingleUse == target.SingleUse)
+	check("referrers", current.Referrers == target.Referrers)
+	check("geo_allow", current.GeoAllow == target.GeoAllow)
+	check("geo_deny", current.GeoDeny == target.GeoDeny)
+	check("owner", current.Owner == target.Owner)
+	// MySQL reformats JSON columns, schedules are compared decoded
+	check("schedule", reflect.DeepEqual(current.DecodedSchedule(), target.DecodedSchedule()))
+	return fields
+}
+
+// equalTimes compares optional times by instant, storages keeping them at different precisions
+func equalTimes(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
+
+// ShadowMySQLRepository serves links from the current MySQL database while mirroring their writes
+// to the database a migration moves them to and comparing reads of links by short code there.
+// Other tables, such as access logs and stats, stay on the current database only.
+type ShadowMySQLRepository struct {
+	*MySQLRepository
+	target *MySQLRepository
+	shadowing
+}
+
+// NewShadowMySQLRepository creates a MySQL repository shadowing current with target
+func NewShadowMySQLRepository(current, target *MySQLRepository, timeout time.Duration) *ShadowMySQLRepository {
+	return &ShadowMySQLRepository{
+		MySQLRepository: current,
+		target:          target,
+		shadowing:       shadowing{storage: "mysql", target: "database.shadow.mysql", timeout: timeout},
+	}
+}
+
+// WithTx runs fn in a transaction of the current database, mirroring the writes it made to the
+// target once it committed. Nested calls join the outermost one. The target writes them outside
+// of a transaction, as best effort.
+func (r *ShadowMySQLRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if pending, ok := ctx.Value(shadowWritesKey{}).(*shadowWrites); ok && pending != nil {
+		return r.MySQLRepository.WithTx(ctx, fn)
+	}
+
+	pending := &shadowWrites{}
+	if err := r.MySQLRepository.WithTx(context.WithValue(ctx, shadowWritesKey{}, pending), fn); err != nil {
+		return err
+	}
+	pending.flush()
+	return nil
+}
+
+// SaveShortLink saves a short link to both databases, the target assigning its own ID
+func (r *ShadowMySQLRepository) SaveShortLink(ctx context.Context, sl *model.ShortLink) error {
+	if err := r.MySQLRepository.SaveShortLink(ctx, sl); err != nil {
+		return err
+	}
+	r.write(ctx, "save", sl.ShortCode, func(ctx context.Context) error {
+		copied := *sl
+		copied.ID = 0
+		return r.target.SaveShortLink(ctx, &copied)
+	})
+	return nil
+}
+
+// GetShortLinkByCode retrieves a short link from the current database, comparing the target's
+func (r *ShadowMySQLRepository) GetShortLinkByCode(ctx context.Context, shortCode string) (*model.ShortLink, error) {
+	sl, err := r.MySQLRepository.GetShortLinkByCode(ctx, shortCode)
+	r.read(ctx, "get", shortCode, sl, err, func(ctx context.Context) (*model.ShortLink, error) {
+		return r.target.GetShortLinkByCode(ctx, shortCode)
+	})
+	return sl, err
+}
+
+// DeleteShortLinkByCode removes a short link from both databases
+func (r *ShadowMySQLRepository) DeleteShortLinkByCode(ctx context.Context, shortCode string) error {
+	if err := r.MySQLRepository.DeleteShortLinkByCode(ctx, shortCode); err != nil {
+		return err
+	}
+	r.write(ctx, "delete", shortCode, func(ctx context.Context) error {
+		return r.target.DeleteShortLinkByCode(ctx, shortCode)
+	})
+	return nil
+}
+
+// DeactivateShortLink disables a short link in both databases
+func (r *ShadowMySQLRepository) DeactivateShortLink(ctx context.Context, shortCode string) error {
+	if err := r.MySQLRepository.DeactivateShortLink(ctx, shortCode); err != nil {
+		return err
+	}
+	r.write(ctx, "deactivate", shortCode, func(ctx context.Context) error {
+		return r.target.DeactivateShortLink(ctx, shortCode)
+	})
+	return nil
+}
+
+// SetShortLinkOwner transfers a short link to an owner in both databases
+func (r *ShadowMySQLRepository) SetShortLinkOwner(ctx context.Context, shortCode, owner string) error {
+	if err := r.MySQLRepository.SetShortLinkOwner(ctx, shortCode, owner); err != nil {
+		return err
+	}
+	r.write(ctx, "owner", shortCode, func(ctx context.Context) error {
+		return r.target.SetShortLinkOwner(ctx, shortCode, owner)
+	})
+	return nil
+}
+
+// SetShortLinksStatus sets the status of the links matching a filter in both databases, the target
+// getting the links the current database changed
+func (r *ShadowMySQLRepository) SetShortLinksStatus(ctx context.Context, filter *model.LinkFilter, status int) ([]model.ShortLink, error) {
+	links, err := r.MySQLRepository.SetShortLinksStatus(ctx, filter, status)
+	if err != nil {
+		return nil, err
+	}
+	r.writeLinks(ctx, "set_status", links)
+	return links, nil
+}
+
+// SetShortLinksExpiry sets the expiry of the links matching a filter in both databases, the target
+// getting the links the current database changed
+func (r *ShadowMySQLRepository) SetShortLinksExpiry(ctx context.Context, filter *model.LinkFilter, expireAt *time.Time) ([]model.ShortLink, error) {
+	links, err := r.MySQLRepository.SetShortLinksExpiry(ctx, filter, expireAt)
+	if err != nil {
+		return nil, err
+	}
+	r.writeLinks(ctx, "set_expiry", links)
+	return links, nil
+}
+
+// writeLinks writes links changed in bulk to the target one by one, so that shadow writes keep
+// following the links they cover
+func (r *ShadowMySQLRepository) writeLinks(ctx context.Context, op string, links []model.ShortLink) {
+	for i := range links {
+		sl := &links[i]
+		r.write(ctx, op, sl.ShortCode, func(ctx context.Context) error {
+			return r.target.UpdateShortLink(ctx, sl)
+		})
+	}
+}
+
+// UpdateShortLink writes a short link to both databases
+func (r *ShadowMySQLRepository) UpdateShortLink(ctx context.Context, sl *model.ShortLink) error {
+	if err := r.MySQLRepository.UpdateShortLink(ctx, sl); err != nil {
+		return err
+	}
+	r.write(ctx, "update", sl.ShortCode, func(ctx context.Context) error {
+		return r.target.UpdateShortLink(ctx, sl)
+	})
+	return nil
+}
+
+// UpdateShortLinkMetadata writes the metadata of a short link to both databases
+func (r *ShadowMySQLRepository) UpdateShortLinkMetadata(ctx context.Context, sl *model.ShortLink) error {
+	if err := r.MySQLRepository.UpdateShortLinkMetadata(ctx, sl); err != nil {
+		return err
+	}
+	r.write(ctx, "update_metadata", sl.ShortCode, func(ctx context.Context) error {
+		return r.target.UpdateShortLinkMetadata(ctx, sl)
+	})
+	return nil
+}
+
+// ApplyReplicatedShortLink applies a replicated link to both databases, each settling conflicts
+// against its own copy
+func (r *ShadowMySQLRepository) ApplyReplicatedShortLink(ctx context.Context, sl *model.ShortLink) (bool, error) {
+	copied := *sl
+	applied, err := r.MySQLRepository.ApplyReplicatedShortLink(ctx, sl)
+	if err != nil {
+		return applied, err
+	}
+	r.write(ctx, "apply", sl.ShortCode, func(ctx context.Context) error {
+		copied.ID = 0
+		_, err := r.target.ApplyReplicatedShortLink(ctx, &copied)
+		return err
+	})
+	return applied, nil
+}
+
+// Close waits for the reads being compared and closes the target, the current database being
+// closed by its owner
+func (r *ShadowMySQLRepository) Close() error {
+	r.pending.Wait()
+	return r.target.Close()
+}
+
+// ShadowLinkStore is the storage of cached links a Redis migration moves them to, such as another
+// instance or the Redis shards
+type ShadowLinkStore interface {
+	SaveShortLink(ctx context.Context, cacheKey, shortCode string, ttl time.Duration) error
+	SaveShortLinkPair(ctx context.Context, cacheKey string, sl *model.ShortLink, ttl time.Duration) error
+	CacheShortLink(ctx context.Context, sl *model.ShortLink, ttl time.Duration) error
+	GetCachedShortLink(ctx context.Context, shortCode string) (*model.ShortLink, error)
+	DeleteShortLink(ctx context.Context, shortCode string) error
+	Close() error
+}
+
+// ShadowRedisRepository serves from the current Redis while mirroring the cached links to the
+// storage a migration moves them to and comparing cached link reads there. Counters, code pools
+// and clicks stay on the current Redis only, cmd/reshard moving them at the cutover to shards.
+type ShadowRedisRepository struct {
+	*RedisRepository
+	target ShadowLinkStore
+	shadowing
+}
+
+// NewShadowRedisRepository creates a Redis repository shadowing current with target, named by its
+// configuration key in the stats
+func NewShadowRedisRepository(current *RedisRepository, target ShadowLinkStore, name string, timeout time.Duration) *ShadowRedisRepository {
+	return &ShadowRedisRepository{
+		RedisRepository: current,
+		target:          target,
+		shadowing:       shadowing{storage: "redis", target: name, timeout: timeout},
+	}
+}
+
+// SaveShortLink saves the short code of a cache key to both storages
+func (r *ShadowRedisRepository) SaveShortLink(ctx context.Context, cacheKey, shortCode string, ttl time.Duration) error {
+	if err := r.RedisRepository.SaveShortLink(ctx, cacheKey, shortCode, ttl); err != nil {
+		return err
+	}
+	r.write(ctx, "save", shortCode, func(ctx context.Context) error {
+		return r.target.SaveShortLink(ctx, cacheKey, shortCode, ttl)
+	})
+	return nil
+}
+
+// SaveShortLinkPair saves a cache key and its short link to both storages
+func (r *ShadowRedisRepository) SaveShortLinkPair(ctx context.Context, cacheKey string, sl *model.ShortLink, ttl time.Duration) error {
+	if err := r.RedisRepository.SaveShortLinkPair(ctx, cacheKey, sl, ttl); err != nil {
+		return err
+	}
+	r.write(ctx, "save_pair", sl.ShortCode, func(ctx context.Context) error {
+		return r.target.SaveShortLinkPair(ctx, cacheKey, sl, ttl)
+	})
+	return nil
+}
+
+// CacheShortLink caches a short link in both storages
+func (r *ShadowRedisRepository) CacheShortLink(ctx context.Context, sl *model.ShortLink, ttl time.Duration) error {
+	if err := r.RedisRepository.CacheShortLink(ctx, sl, ttl); err != nil {
+		return err
+	}
+	r.write(ctx, "cache", sl.ShortCode, func(ctx context.Context) error {
+		return r.target.CacheShortLink(ctx, sl, ttl)
+	})
+	return nil
+}
+
+// GetCachedShortLink retrieves a cached short link from the current storage, comparing the
+// target's. Links cached before shadow writes started are missing from the target until they
+// expire.
+func (r *ShadowRedisRepository) GetCachedShortLink(ctx context.Context, shortCode string) (*model.ShortLink, error) {
+	sl, err := r.RedisRepository.GetCachedShortLink(ctx, shortCode)
+	r.read(ctx, "get_cached", shortCode, sl, err, func(ctx context.Context) (*model.ShortLink, error) {
+		return r.target.GetCachedShortLink(ctx, shortCode)
+	})
+	return sl, err
+}
+
+// DeleteShortLink purges a cached short link from both storages
+func (r *ShadowRedisRepository) DeleteShortLink(ctx context.Context, shortCode string) error {
+	if err := r.RedisRepository.DeleteShortLink(ctx, shortCode); err != nil {
+		return err
+	}
+	r.write(ctx, "delete", shortCode, func(ctx context.Context) error {
+		return r.target.DeleteShortLink(ctx, shortCode)
+	})
+	return nil
+}
+
+// Close waits for the reads being compared and closes the target, the current Redis being
+// closed by its owner
+func (r *ShadowRedisRepository) Close() error {
+	r.pending.Wait()
+	return r.target.Close()
+}
@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"octopus/internal/model"
+)
+
+func TestDiffShortLinks(t *testing.T) {
+	expireAt := time.Unix(1700000000, 0)
+	truncated := expireAt.Add(300 * time.Millisecond)
+	link := func(modify func(sl *model.ShortLink)) *model.ShortLink {
+		sl := &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com", Status: 1, ExpireAt: &expireAt}
+		if modify != nil {
+			modify(sl)
+		}
+		return sl
+	}
+
+	tests := []struct {
+		name    string
+		current *model.ShortLink
+		target  *model.ShortLink
+		want    []string
+	}{
+		{name: "both missing"},
+		{name: "equal", current: link(nil), target: link(func(sl *model.ShortLink) { sl.ID = 42 })},
+		{name: "same second", current: link(nil), target: link(func(sl *model.ShortLink) { sl.ExpireAt = &truncated })},
+		{name: "missing from target", current: link(nil), want: []string{"missing"}},
+		{name: "only on target", target: link(nil), want: []string{"unexpected"}},
+		{
+			name:    "fields differ",
+			current: link(nil),
+			target: link(func(sl *model.ShortLink) {
+				sl.OriginalURL = "https://example.org"
+				sl.ExpireAt = nil
+				sl.Title = "Sale"
+			}),
+			want: []string{"original_url", "expire_at", "title"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, diffShortLinks(tt.current, tt.target))
+		})
+	}
+}
+
+func TestShadowRedisRepository(t *testing.T) {
+	ctx := context.Background()
+	current, _ := newTestRedisRepo(t)
+	target, targetServer := newTestRedisRepo(t)
+	r := NewShadowRedisRepository(current, target, "database.shadow.redis", time.Second)
+	r.SetGates(func(_ context.Context, shortCode string) bool { return shortCode != "SKIP" }, nil)
+
+	sl := &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com", Status: 1}
+	require.NoError(t, r.CacheShortLink(ctx, sl, time.Hour))
+	require.NoError(t, r.CacheShortLink(ctx, &model.ShortLink{ShortCode: "SKIP"}, time.Hour))
+	assert.True(t, targetServer.Exists(CodeKeyPrefix+"ABCD"))
+	assert.False(t, targetServer.Exists(CodeKeyPrefix+"SKIP"), "gated off")
+
+	t.Run("matching read", func(t *testing.T) {
+		cached, err := r.GetCachedShortLink(ctx, "ABCD")
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com", cached.OriginalURL)
+		r.pending.Wait()
+		assert.Zero(t, r.Stats().Divergences)
+	})
+
+	t.Run("diverging read", func(t *testing.T) {
+		require.NoError(t, target.CacheShortLink(ctx, &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.org", Status: 1}, time.Hour))
+		cached, err := r.GetCachedShortLink(ctx, "ABCD")
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com", cached.OriginalURL, "served from the current storage")
+
+		_, err = r.GetCachedShortLink(ctx, "SKIP")
+		require.NoError(t, err)
+		r.pending.Wait()
+
+		stats := r.Stats()
+		assert.Equal(t, int64(3), stats.Reads)
+		assert.Equal(t, int64(2), stats.Divergences)
+		assert.Equal(t, "get_cached SKIP: missing", stats.LastDivergence)
+	})
+
+	t.Run("target failures never fail requests", func(t *testing.T) {
+		targetServer.Close()
+		require.NoError(t, r.DeleteShortLink(ctx, "ABCD"))
+		_, err := r.GetCachedShortLink(ctx, "ABCD")
+		assert.ErrorIs(t, err, ErrNotFound)
+		r.pending.Wait()
+
+		stats := r.Stats()
+		assert.Equal(t, model.ShadowStats{
+			Storage: "redis", Target: "database.shadow.redis",
+			Writes: 2, WriteErrors: 1, Reads: 4, ReadErrors: 1, Divergences: 2,
+			LastDivergence: "get_cached SKIP: missing",
+		}, stats)
+	})
+}
+
+func TestShadowMySQLRepository(t *testing.T) {
+	ctx := context.Background()
+	currentDB, currentMock := newTestDB(t)
+	targetDB, targetMock := newTestDB(t)
+	r := NewShadowMySQLRepository(&MySQLRepository{db: currentDB}, &MySQLRepository{db: targetDB}, time.Second)
+
+	t.Run("writes go to both databases", func(t *testing.T) {
+		currentMock.ExpectBegin()
+		currentMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `short_links`")).WillReturnResult(sqlmock.NewResult(7, 1))
+		currentMock.ExpectCommit()
+		targetMock.ExpectBegin()
+		targetMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `short_links`")).WillReturnResult(sqlmock.NewResult(3, 1))
+		targetMock.ExpectCommit()
+
+		sl := &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com", Status: 1}
+		require.NoError(t, r.SaveShortLink(ctx, sl))
+		assert.Equal(t, int64(7), sl.ID, "the current database assigns the ID")
+		assert.NoError(t, currentMock.ExpectationsWereMet())
+		assert.NoError(t, targetMock.ExpectationsWereMet())
+	})
+
+	t.Run("failed writes are not mirrored", func(t *testing.T) {
+		currentMock.ExpectBegin()
+		currentMock.ExpectExec(regexp.QuoteMeta("UPDATE `short_links`")).WillReturnError(errors.New("db down"))
+		currentMock.ExpectRollback()
+
+		assert.Error(t, r.DeactivateShortLink(ctx, "ABCD"))
+		assert.NoError(t, targetMock.ExpectationsWereMet())
+	})
+
+	t.Run("target failures are counted", func(t *testing.T) {
+		currentMock.ExpectBegin()
+		currentMock.ExpectExec(regexp.QuoteMeta("UPDATE `short_links`")).WillReturnResult(sqlmock.NewResult(0, 1))
+		currentMock.ExpectCommit()
+		targetMock.ExpectBegin()
+		targetMock.ExpectExec(regexp.QuoteMeta("UPDATE `short_links`")).WillReturnError(errors.New("db down"))
+		targetMock.ExpectRollback()
+
+		assert.NoError(t, r.DeactivateShortLink(ctx, "ABCD"))
+		assert.Equal(t, int64(1), r.Stats().WriteErrors)
+	})
+
+	t.Run("reads are compared", func(t *testing.T) {
+		query := regexp.QuoteMeta("SELECT * FROM `short_links` WHERE short_code = ? AND status = 1")
+		currentMock.ExpectQuery(query).WithArgs("ABCD", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "short_code", "original_url", "status"}).AddRow(7, "ABCD", "https://example.com", 1))
+		targetMock.ExpectQuery(query).WithArgs("ABCD", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "short_code", "original_url", "status"}).AddRow(3, "ABCD", "https://example.com", 1))
+
+		sl, err := r.GetShortLinkByCode(ctx, "ABCD")
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), sl.ID)
+		r.pending.Wait()
+
+		stats := r.Stats()
+		assert.Equal(t, int64(2), stats.Writes)
+		assert.Equal(t, int64(1), stats.Reads)
+		assert.Zero(t, stats.Divergences)
+	})
+
+	t.Run("transactions are mirrored once committed", func(t *testing.T) {
+		update := regexp.QuoteMeta("UPDATE `short_links`")
+		currentMock.ExpectBegin()
+		currentMock.ExpectExec(update).WillReturnResult(sqlmock.NewResult(0, 1))
+		currentMock.ExpectExec(update).WillReturnResult(sqlmock.NewResult(0, 1))
+		currentMock.ExpectCommit()
+
+		err := r.WithTx(ctx, func(ctx context.Context) error {
+			require.NoError(t, r.DeactivateShortLink(ctx, "ABCD"))
+			require.NoError(t, r.SetShortLinkOwner(ctx, "ABCD", "5e884898da28"))
+			// The target hears of nothing before the commit
+			assert.NoError(t, targetMock.ExpectationsWereMet())
+			targetMock.ExpectBegin()
+			targetMock.ExpectExec(update).WillReturnResult(sqlmock.NewResult(0, 1))
+			targetMock.ExpectCommit()
+			targetMock.ExpectBegin()
+			targetMock.ExpectExec(update).WillReturnResult(sqlmock.NewResult(0, 1))
+			targetMock.ExpectCommit()
+			return nil
+		})
+		require.NoError(t, err)
+		assert.NoError(t, currentMock.ExpectationsWereMet())
+		assert.NoError(t, targetMock.ExpectationsWereMet())
+
+		// Writes of a rolled back transaction are dropped
+		currentMock.ExpectBegin()
+		currentMock.ExpectExec(update).WillReturnResult(sqlmock.NewResult(0, 1))
+		currentMock.ExpectRollback()
+
+		errAbort := errors.New("abort")
+		err = r.WithTx(ctx, func(ctx context.Context) error {
+			require.NoError(t, r.DeactivateShortLink(ctx, "ABCD"))
+			return errAbort
+		})
+		assert.ErrorIs(t, err, errAbort)
+		assert.NoError(t, currentMock.ExpectationsWereMet())
+		assert.Equal(t, int64(4), r.Stats().Writes)
+	})
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"octopus/pkg/slowlog"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// slowStartKey keys the start of a statement in its gorm instance
+const slowStartKey = "slowlog:start"
+
+// maxSlowOperation bounds the length of the statements and commands logged as slow
+const maxSlowOperation = 200
+
+// EnableSlowLog logs and counts the Redis commands and pipelines taking the detector's threshold
+func (r *RedisRepository) EnableSlowLog(detector *slowlog.Detector) {
+	r.client.AddHook(slowHook{detector: detector})
+}
+
+// EnableSlowLog logs and counts the commands sent to the shards taking the detector's threshold
+func (r *ShardedRedisRepository) EnableSlowLog(detector *slowlog.Detector) {
+	for _, shard := range r.order {
+		shard.repo.EnableSlowLog(detector)
+	}
+}
+
+// EnableSlowLog logs and counts the MySQL statements taking the detector's threshold, the statement
+// logged without its arguments
+func (r *MySQLRepository) EnableSlowLog(detector *slowlog.Detector) error {
+	start := func(db *gorm.DB) {
+		db.InstanceSet(slowStartKey, time.Now())
+	}
+	observe := func(db *gorm.DB) {
+		if started, ok := db.InstanceGet(slowStartKey); ok {
+			detector.Observe(db.Statement.Context, sqlOperation(db.Statement.SQL.String()), time.Since(started.(time.Time)))
+		}
+	}
+
+	callbacks := r.db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("slowlog:start_create", start); err != nil {
+		return err
+	}
+	if err := callbacks.Create().After("gorm:create").Register("slowlog:create", observe); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("slowlog:start_query", start); err != nil {
+		return err
+	}
+	if err := callbacks.Query().After("gorm:query").Register("slowlog:query", observe); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("slowlog:start_update", start); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("slowlog:update", observe); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("slowlog:start_delete", start); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Register("slowlog:delete", observe); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("slowlog:start_row", start); err != nil {
+		return err
+	}
+	if err := callbacks.Row().After("gorm:row").Register("slowlog:row", observe); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().Before("gorm:raw").Register("slowlog:start_raw", start); err != nil {
+		return err
+	}
+	return callbacks.Raw().After("gorm:raw").Register("slowlog:raw", observe)
+}
+
+// sqlOperation returns a statement on one line, cut to maxSlowOperation bytes
+func sqlOperation(sql string) string {
+	return truncateOperation(strings.Join(strings.Fields(sql), " "))
+}
+
+// redisOperation returns the name and key of a command, such as "get sl:v2:code:ABCD"
+func redisOperation(cmd redis.Cmder) string {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return cmd.Name()
+	}
+	return truncateOperation(fmt.Sprintf("%s %v", cmd.Name(), args[1]))
+}
+
+// truncateOperation cuts an operation to maxSlowOperation bytes
+func truncateOperation(operation string) string {
+	if len(operation) > maxSlowOperation {
+		return operation[:maxSlowOperation] + "..."
+	}
+	return operation
+}
+
+// slowHook is a go-redis hook timing commands with a slow log detector
+type slowHook struct {
+	detector *slowlog.Detector
+}
+
+func (h slowHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h slowHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.detector.Observe(ctx, redisOperation(cmd), time.Since(start))
+		return err
+	}
+}
+
+func (h slowHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+
+		names := make([]string, len(cmds))
+		for i, cmd := range cmds {
+			names[i] = cmd.Name()
+		}
+		h.detector.Observe(ctx, truncateOperation("pipeline "+strings.Join(names, " ")), time.Since(start))
+		return err
+	}
+}
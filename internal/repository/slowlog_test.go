@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"octopus/pkg/chaos"
+	"octopus/pkg/slowlog"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisRepository_EnableSlowLog(t *testing.T) {
+	ctx := slowlog.WithShortCode(context.Background(), "ABCD")
+	repo, _ := newTestRedisRepo(t)
+	detector := slowlog.NewDetector("redis", 20*time.Millisecond)
+	repo.EnableSlowLog(detector)
+
+	require.NoError(t, repo.SaveShortLink(ctx, "ABCD", "https://example.com", 0))
+	assert.Zero(t, detector.Slow())
+
+	// Hooks added later run inside the slow log, delaying the commands it times
+	repo.EnableFaultInjection(chaos.NewInjector("redis", 0, 1, 30*time.Millisecond))
+	_, err := repo.GetShortLink(ctx, "ABCD")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), detector.Slow())
+	assert.True(t, strings.HasPrefix(detector.LastOperation(), "get "), detector.LastOperation())
+
+	require.NoError(t, repo.SaveClick(ctx, "cid", "ABCD", "google", 0))
+	assert.True(t, strings.HasPrefix(detector.LastOperation(), "pipeline "), detector.LastOperation())
+}
+
+func TestMySQLRepository_EnableSlowLog(t *testing.T) {
+	ctx := slowlog.WithShortCode(context.Background(), "ABCD")
+	db, mock := newTestDB(t)
+	repo := &MySQLRepository{db: db}
+	detector := slowlog.NewDetector("mysql", 20*time.Millisecond)
+	require.NoError(t, repo.EnableSlowLog(detector))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM `short_links`")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	_, err := repo.GetTotalLinksCount(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, detector.Slow())
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM `short_links`")).
+		WillDelayFor(30 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	_, err = repo.GetTotalLinksCount(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), detector.Slow())
+	assert.Equal(t, "SELECT count(*) FROM `short_links`", detector.LastOperation())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLOperation(t *testing.T) {
+	assert.Equal(t, "SELECT * FROM short_links WHERE short_code = ?", sqlOperation("SELECT *\n\tFROM short_links\n\tWHERE short_code = ?"))
+	assert.Len(t, sqlOperation(strings.Repeat("x", 300)), maxSlowOperation+len("..."))
+}
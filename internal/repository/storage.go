@@ -0,0 +1,13 @@
+package repository
+
+import "octopus/internal/storage"
+
+// Every repository serves all the capabilities of its storage, wrappers included
+var (
+	_ storage.Database = (*MySQLRepository)(nil)
+	_ storage.Database = (*ShadowMySQLRepository)(nil)
+	_ storage.Database = (*MemoryRepository)(nil)
+	_ storage.Cache    = (*RedisRepository)(nil)
+	_ storage.Cache    = (*ShardedRedisRepository)(nil)
+	_ storage.Cache    = (*ShadowRedisRepository)(nil)
+)
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// analyticsViews are the views BI tools such as Grafana and Redash query instead of the raw tables,
+// so a read-only role granted only them never sees client IPs, user agents or full referers.
+// Definitions take the quoted JSON path of the param naming the campaign of a link.
+var analyticsViews = []struct {
+	name  string
+	query string
+}{
+	{
+		name: "analytics_daily_clicks",
+		query: `SELECT daily_stats.day, daily_stats.short_code, short_links.original_url, short_links.title,
+	daily_stats.clicks, daily_stats.visitors
+FROM daily_stats
+JOIN short_links ON short_links.short_code = daily_stats.short_code`,
+	},
+	{
+		name: "analytics_daily_sources",
+		query: `SELECT daily_source_stats.day, daily_source_stats.short_code, daily_source_stats.source,
+	daily_source_stats.clicks
+FROM daily_source_stats`,
+	},
+	{
+		name: "analytics_daily_campaigns",
+		query: `SELECT daily_stats.day, JSON_UNQUOTE(JSON_EXTRACT(short_links.params, %[1]s)) AS campaign,
+	COUNT(*) AS links, SUM(daily_stats.clicks) AS clicks, SUM(daily_stats.visitors) AS visitors
+FROM daily_stats
+JOIN short_links ON short_links.short_code = daily_stats.short_code
+WHERE JSON_EXTRACT(short_links.params, %[1]s) IS NOT NULL
+GROUP BY daily_stats.day, campaign`,
+	},
+	{
+		name: "analytics_access_logs",
+		query: `SELECT id, short_code, access_time, source, device, edge,
+	NULLIF(SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(referer, '/', 3), '/', -1), '?', 1), '') AS referer_host,
+	click_id IS NOT NULL AND click_id <> '' AS has_click_id
+FROM access_logs`,
+	},
+}
+
+// CreateAnalyticsViews creates or replaces the analytics views, the values of campaignParam in the
+// params of links naming their campaigns
+func (r *MySQLRepository) CreateAnalyticsViews(ctx context.Context, campaignParam string) error {
+	path := sqlString(paramPath(campaignParam))
+	for _, view := range analyticsViews {
+		ddl := "CREATE OR REPLACE VIEW " + view.name + " AS " + fmt.Sprintf(view.query, path)
+		if err := r.db.WithContext(ctx).Exec(ddl).Error; err != nil {
+			return fmt.Errorf("failed to create view %s: %w", view.name, mysqlError(err))
+		}
+	}
+	return nil
+}
+
+// sqlString quotes a string literal of a statement taking no arguments, such as a view definition
+func sqlString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(s) + "'"
+}
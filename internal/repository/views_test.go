@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQLRepository_CreateAnalyticsViews(t *testing.T) {
+	db, mock := newTestDB(t)
+	repo := &MySQLRepository{db: db}
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE OR REPLACE VIEW analytics_daily_clicks AS SELECT")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE OR REPLACE VIEW analytics_daily_sources AS SELECT")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`JSON_EXTRACT(short_links.params, '$."utm_campaign"')) AS campaign`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE OR REPLACE VIEW analytics_access_logs AS SELECT")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, repo.CreateAnalyticsViews(context.Background(), "utm_campaign"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	mock.ExpectExec("CREATE OR REPLACE VIEW analytics_daily_clicks").WillReturnError(errors.New("CREATE VIEW command denied"))
+	err := repo.CreateAnalyticsViews(context.Background(), "utm_campaign")
+	assert.ErrorContains(t, err, "failed to create view analytics_daily_clicks")
+}
+
+func TestSQLString(t *testing.T) {
+	assert.Equal(t, `'$."campaign"'`, sqlString(`$."campaign"`))
+	assert.Equal(t, `'it''s \\ here'`, sqlString(`it's \ here`))
+}
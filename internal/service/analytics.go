@@ -2,47 +2,110 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
+	"octopus/internal/config"
 	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/internal/storage"
+	"octopus/pkg/clock"
 
 	"github.com/rs/zerolog/log"
+	"golang.org/x/net/publicsuffix"
 )
 
 // AnalyticsService handles analytics operations
 type AnalyticsService struct {
-	redisRepo RedisRepositoryInterface
+	redisRepo storage.CounterStore
+	mysqlRepo storage.Database
+	counters  *CounterBuffer
+	snapshots *AnalyticsSnapshots
+	flags     *FeatureFlags
+	rules     *Rules
+	retention config.RetentionConfig
+	campaign  string
+	clock     clock.Clock
 }
 
+const (
+	// maxAggregateLinks bounds the links combined by one aggregate
+	maxAggregateLinks = 100
+	// maxMergedUVDays bounds the days of UV sketches merged by one aggregate, so links imported with
+	// years of history do not merge thousands of sketches each
+	maxMergedUVDays = 90
+)
+
+// ErrTooManyLinks is returned when a campaign has more links than one aggregate combines
+var ErrTooManyLinks = fmt.Errorf("more than %d links to aggregate", maxAggregateLinks)
+
 // NewAnalyticsService creates a new Analytics Service
-func NewAnalyticsService(redisRepo RedisRepositoryInterface) *AnalyticsService {
+func NewAnalyticsService(redisRepo storage.CounterStore, mysqlRepo storage.Database) *AnalyticsService {
 	return &AnalyticsService{
 		redisRepo: redisRepo,
+		mysqlRepo: mysqlRepo,
+		retention: config.RetentionConfig{
+			PV:      repository.StatsExpireDuration,
+			UV:      repository.StatsExpireDuration,
+			Sources: repository.StatsExpireDuration,
+		},
+		campaign: "campaign",
+		clock:    clock.Real,
 	}
 }
 
-// RecordAccess records a single access event
-func (as *AnalyticsService) RecordAccess(ctx context.Context, shortCode, clientIP, userAgent, referer string) error {
-	// Increment PV
-	if _, err := as.redisRepo.IncrementPV(ctx, shortCode); err != nil {
-		log.Error().Err(err).Str("short_code", shortCode).Msg("Failed to increment PV")
-	}
+// SetCounterBuffer batches counter writes in a write-behind buffer instead of writing every click
+func (as *AnalyticsService) SetCounterBuffer(counters *CounterBuffer) {
+	as.counters = counters
+}
 
-	// Add UV (using IP as visitor ID)
-	visitorID := fmt.Sprintf("%s:%s", time.Now().Format("2006-01-02"), clientIP)
-	if _, err := as.redisRepo.AddUV(ctx, shortCode, visitorID); err != nil {
-		log.Error().Err(err).Str("short_code", shortCode).Msg("Failed to add UV")
-	}
+// SetSnapshots serves analytics from short-lived per-instance snapshots instead of Redis
+func (as *AnalyticsService) SetSnapshots(snapshots *AnalyticsSnapshots) {
+	as.snapshots = snapshots
+}
+
+// SetFlags rolls the write-behind buffer out to the share of short links its flag allows
+func (as *AnalyticsService) SetFlags(flags *FeatureFlags) {
+	as.flags = flags
+}
+
+// SetRules classifies referers with the source rules set at runtime before the built-in sources
+func (as *AnalyticsService) SetRules(rules *Rules) {
+	as.rules = rules
+}
+
+// SetRetention sets the stats retention reported alongside the analytics
+func (as *AnalyticsService) SetRetention(retention *config.RetentionConfig) {
+	as.retention = *retention
+}
+
+// SetCampaignParam sets the param whose value names the campaign of a link in aggregates,
+// "campaign" by default
+func (as *AnalyticsService) SetCampaignParam(param string) {
+	as.campaign = param
+}
 
-	// Add source
+// RecordAccess records a single access event of a visitor identified by a VisitorIdentity
+func (as *AnalyticsService) RecordAccess(ctx context.Context, shortCode, visitorID, referer string) error {
+	// UV counts a visitor once a day
+	now := as.clock.Now()
+	visitorID = fmt.Sprintf("%s:%s", model.StatsDay(now), visitorID)
 	source := as.extractSource(referer)
-	if source != "" {
-		if err := as.redisRepo.AddSource(ctx, shortCode, source); err != nil {
-			log.Error().Err(err).Str("short_code", shortCode).Str("source", source).Msg("Failed to add source")
-		}
+
+	if as.counters != nil && as.flags.Enabled(ctx, FlagWriteBehindAnalytics, shortCode) {
+		as.counters.Record(ctx, shortCode, visitorID, source, now)
+		return nil
+	}
+
+	// PV, UV, source and the stats invalidation go out in one pipeline
+	if err := as.redisRepo.RecordAccessPipelined(ctx, shortCode, visitorID, source); err != nil {
+		log.Error().Err(err).Str("short_code", shortCode).Msg("Failed to record access")
 	}
 
 	return nil
@@ -51,7 +114,7 @@ func (as *AnalyticsService) RecordAccess(ctx context.Context, shortCode, clientI
 // GetStats returns PV and UV statistics for a short code
 func (as *AnalyticsService) GetStats(ctx context.Context, shortCode string) (*model.Stats, error) {
 	pv, err := as.redisRepo.GetPV(ctx, shortCode)
-	if err != nil {
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
 		log.Error().Err(err).Str("short_code", shortCode).Msg("Failed to get PV")
 		pv = 0
 	}
@@ -65,12 +128,54 @@ func (as *AnalyticsService) GetStats(ctx context.Context, shortCode string) (*mo
 	return &model.Stats{PV: pv, UV: uv}, nil
 }
 
-// GetAnalytics returns detailed analytics for a short code
-func (as *AnalyticsService) GetAnalytics(ctx context.Context, shortCode string) (*model.AnalyticsResponse, error) {
-	stats, err := as.GetStats(ctx, shortCode)
+// GetLastModified returns when the analytics of a short code last changed, zero if unknown
+func (as *AnalyticsService) GetLastModified(ctx context.Context, shortCode string) (time.Time, error) {
+	updatedAt, err := as.redisRepo.GetStatsUpdatedAt(ctx, shortCode)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get stats update time: %w", err)
+	}
+	return updatedAt, nil
+}
+
+// GetAnalytics returns detailed analytics for a short code, from a snapshot unless fresh is set or
+// snapshots are disabled. Snapshots are shared, callers must not modify the response.
+func (as *AnalyticsService) GetAnalytics(ctx context.Context, shortCode string, fresh bool) (*model.AnalyticsResponse, error) {
+	if as.snapshots == nil {
+		return as.loadAnalytics(ctx, shortCode)
+	}
+	if fresh {
+		resp, err := as.loadAnalytics(ctx, shortCode)
+		if err == nil {
+			as.snapshots.Store(shortCode, resp)
+		}
+		return resp, err
+	}
+	return as.snapshots.Load(ctx, shortCode, as.loadAnalytics)
+}
+
+// loadAnalytics reads the analytics of a short code from Redis. The stats update time is read
+// first, so the counters are at least as recent as the update time reported with them.
+func (as *AnalyticsService) loadAnalytics(ctx context.Context, shortCode string) (*model.AnalyticsResponse, error) {
+	updatedAt, err := as.redisRepo.GetStatsUpdatedAt(ctx, shortCode)
+	if err != nil {
+		log.Warn().Err(err).Str("short_code", shortCode).Msg("Failed to get stats update time")
+	}
+
+	resp, _, _, err := as.collectAnalytics(ctx, shortCode)
 	if err != nil {
 		return nil, err
 	}
+	resp.UpdatedAt = updatedAt
+	return resp, nil
+}
+
+// collectAnalytics returns the analytics of a short code along with all of its source and
+// conversion counts, not only the top ones
+func (as *AnalyticsService) collectAnalytics(ctx context.Context, shortCode string) (*model.AnalyticsResponse, map[string]int64, map[string]int64, error) {
+	stats, err := as.GetStats(ctx, shortCode)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
 	sources, err := as.redisRepo.GetSources(ctx, shortCode)
 	if err != nil {
@@ -78,57 +183,448 @@ func (as *AnalyticsService) GetAnalytics(ctx context.Context, shortCode string)
 		sources = make(map[string]int64)
 	}
 
-	// Convert to top sources
-	topSources := as.getTopSources(sources, 10)
+	conversions, err := as.redisRepo.GetConversions(ctx, shortCode)
+	if err != nil {
+		log.Error().Err(err).Str("short_code", shortCode).Msg("Failed to get conversions")
+		conversions = make(map[string]int64)
+	}
+
+	var totalConversions int64
+	for _, count := range conversions {
+		totalConversions += count
+	}
 
 	return &model.AnalyticsResponse{
-		ShortCode:  shortCode,
-		PV:         stats.PV,
-		UV:         stats.UV,
-		TopSources: topSources,
-	}, nil
+		ShortCode:      shortCode,
+		PV:             stats.PV,
+		UV:             stats.UV,
+		Conversions:    totalConversions,
+		ConversionRate: conversionRate(totalConversions, stats.PV),
+		TopSources:     as.topSourcesWithConversions(sources, conversions),
+		Retention:      as.statsRetention(),
+	}, sources, conversions, nil
+}
+
+// CampaignShortCodes returns the short codes of the links of a campaign, those whose campaign param
+// has that value, restricted to the links of owner unless empty
+func (as *AnalyticsService) CampaignShortCodes(ctx context.Context, campaign, owner string) ([]string, error) {
+	links, err := as.mysqlRepo.GetShortLinksByFilter(ctx, &model.LinkFilter{Param: as.campaign, Value: campaign, Owner: owner}, maxAggregateLinks+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign links: %w", err)
+	}
+	if len(links) > maxAggregateLinks {
+		return nil, ErrTooManyLinks
+	}
+	shortCodes := make([]string, 0, len(links))
+	for _, link := range links {
+		shortCodes = append(shortCodes, link.ShortCode)
+	}
+	return shortCodes, nil
+}
+
+// AggregateAnalytics returns the combined analytics of several short codes and the analytics of
+// each. Combined UV merges the links' HyperLogLog sketches, so it is an estimate counting a
+// visitor of several links once.
+func (as *AnalyticsService) AggregateAnalytics(ctx context.Context, shortCodes []string) (*model.AggregateResponse, error) {
+	resp := &model.AggregateResponse{
+		Links:     make([]model.AnalyticsResponse, 0, len(shortCodes)),
+		Retention: as.statsRetention(),
+	}
+	sources := make(map[string]int64)
+	conversions := make(map[string]int64)
+	seen := make(map[string]bool, len(shortCodes))
+	codes := make([]string, 0, len(shortCodes))
+	var summedUV int64
+
+	for _, shortCode := range shortCodes {
+		if seen[shortCode] {
+			continue
+		}
+		seen[shortCode] = true
+		codes = append(codes, shortCode)
+
+		link, linkSources, linkConversions, err := as.collectAnalytics(ctx, shortCode)
+		if err != nil {
+			return nil, err
+		}
+		resp.Links = append(resp.Links, *link)
+		resp.PV += link.PV
+		resp.Conversions += link.Conversions
+		summedUV += link.UV
+		for source, count := range linkSources {
+			sources[source] += count
+		}
+		for source, count := range linkConversions {
+			conversions[source] += count
+		}
+	}
+
+	if len(codes) > 0 {
+		resp.UV = as.mergedUV(ctx, codes, summedUV)
+	}
+	resp.ConversionRate = conversionRate(resp.Conversions, resp.PV)
+	resp.TopSources = as.topSourcesWithConversions(sources, conversions)
+
+	return resp, nil
+}
+
+// mergedUV returns the UV of short codes merging their sketches, or summedUV if they cannot be
+// merged
+func (as *AnalyticsService) mergedUV(ctx context.Context, shortCodes []string, summedUV int64) int64 {
+	period, err := as.uvPeriod(ctx, shortCodes)
+	uv := summedUV
+	if err == nil {
+		uv, err = as.redisRepo.GetMergedUV(ctx, shortCodes, period)
+	}
+	if err != nil {
+		// Overcounts visitors of several links, but keeps the response usable
+		log.Error().Err(err).Int("short_codes", len(shortCodes)).Msg("Failed to merge UV")
+		return summedUV
+	}
+	return uv
+}
+
+// uvPeriod returns the days the UV sketches of short links may still be kept for: the UV retention
+// window ending today, a sketch expiring at most that long after its day, or the days since the
+// oldest link was created when UV is kept for good. Either is cut to the last maxMergedUVDays.
+func (as *AnalyticsService) uvPeriod(ctx context.Context, shortCodes []string) (model.Period, error) {
+	today := as.clock.Now().UTC().Truncate(24 * time.Hour)
+	earliest := today.AddDate(0, 0, -maxMergedUVDays)
+	if as.retention.UV > 0 {
+		days := int((as.retention.UV + 24*time.Hour - 1) / (24 * time.Hour))
+		period := model.Period{From: today.AddDate(0, 0, -days), To: today}
+		if period.From.Before(earliest) {
+			period.From = earliest
+		}
+		return period, nil
+	}
+
+	links, err := as.mysqlRepo.GetShortLinksByCodes(ctx, shortCodes)
+	if err != nil {
+		return model.Period{}, fmt.Errorf("failed to get short links: %w", err)
+	}
+	period := model.Period{From: today, To: today}
+	for _, link := range links {
+		if created := link.CreatedAt.UTC().Truncate(24 * time.Hour); created.Before(period.From) {
+			period.From = created
+		}
+	}
+	if period.From.Before(earliest) {
+		period.From = earliest
+	}
+	return period, nil
+}
+
+// topSourcesWithConversions returns the top sources along with their conversions
+func (as *AnalyticsService) topSourcesWithConversions(sources, conversions map[string]int64) []model.SourceStat {
+	topSources := as.getTopSources(sources, 10)
+	for i := range topSources {
+		topSources[i].Conversions = conversions[topSources[i].Source]
+		topSources[i].ConversionRate = conversionRate(topSources[i].Conversions, topSources[i].Count)
+	}
+	return topSources
+}
+
+// statsRetention returns the configured stats retention as reported by the analytics API
+func (as *AnalyticsService) statsRetention() model.StatsRetention {
+	return model.StatsRetention{
+		PV:      formatRetention(as.retention.PV),
+		UV:      formatRetention(as.retention.UV),
+		Sources: formatRetention(as.retention.Sources),
+	}
+}
+
+// formatRetention renders a retention window, 0 keeping stats forever
+func formatRetention(d time.Duration) string {
+	if d <= 0 {
+		return "infinite"
+	}
+	return d.String()
+}
+
+// Page sizes of the access log API
+const (
+	defaultAccessLogLimit = 50
+	maxAccessLogLimit     = 500
+)
+
+// GetAccessLogs returns one page of access logs, fetching one extra row to detect a next page
+func (as *AnalyticsService) GetAccessLogs(ctx context.Context, q *model.AccessLogQuery) (*model.AccessLogPage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultAccessLogLimit
+	}
+	if limit > maxAccessLogLimit {
+		limit = maxAccessLogLimit
+	}
+
+	query := *q
+	query.Limit = limit + 1
+	logs, err := as.mysqlRepo.GetAccessLogs(ctx, &query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access logs: %w", err)
+	}
+
+	page := &model.AccessLogPage{Logs: logs}
+	if len(logs) > limit {
+		page.Logs = logs[:limit]
+		last := page.Logs[limit-1]
+		page.NextCursor = model.AccessLogCursor{AccessTime: last.AccessTime, ID: last.ID}.Encode()
+	}
+	if page.Logs == nil {
+		page.Logs = []model.AccessLog{}
+	}
+
+	return page, nil
+}
+
+// decayWindows are the lifetime windows of the decay curve, in days since creation
+var decayWindows = []struct {
+	label string
+	from  int
+	to    int // exclusive, -1 for open-ended
+}{
+	{"day_1", 0, 1},
+	{"days_2_7", 1, 7},
+	{"days_8_30", 7, 30},
+	{"days_31_90", 30, 90},
+	{"after_90_days", 90, -1},
+}
+
+// GetDecay returns the click distribution across a link's lifetime from daily aggregates
+func (as *AnalyticsService) GetDecay(ctx context.Context, shortCode string) (*model.DecayResponse, error) {
+	sl, err := as.mysqlRepo.GetShortLinkByCode(ctx, shortCode)
+	if err != nil {
+		return nil, linkError(err)
+	}
+
+	createdDay := sl.CreatedAt.UTC().Truncate(24 * time.Hour)
+	stats, err := as.mysqlRepo.GetDailyStats(ctx, shortCode, createdDay, as.clock.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily stats: %w", err)
+	}
+
+	// The first hour is finer than a daily aggregate, count it from the raw logs
+	firstHour, err := as.mysqlRepo.CountAccessLogsBetween(ctx, shortCode, sl.CreatedAt, sl.CreatedAt.Add(time.Hour))
+	if err != nil {
+		log.Warn().Err(err).Str("short_code", shortCode).Msg("Failed to count first hour clicks")
+	}
+
+	resp := &model.DecayResponse{
+		ShortCode:       shortCode,
+		CreatedAt:       sl.CreatedAt,
+		FirstHourClicks: firstHour,
+		HalfLifeDays:    -1,
+		Buckets:         make([]model.DecayBucket, len(decayWindows)),
+	}
+	for i, w := range decayWindows {
+		resp.Buckets[i].Label = w.label
+	}
+
+	for _, stat := range stats {
+		resp.TotalClicks += stat.Clicks
+		age := int(stat.Day.UTC().Sub(createdDay) / (24 * time.Hour))
+		for i, w := range decayWindows {
+			if age >= w.from && (w.to < 0 || age < w.to) {
+				resp.Buckets[i].Clicks += stat.Clicks
+				break
+			}
+		}
+	}
+
+	if resp.TotalClicks == 0 {
+		return resp, nil
+	}
+
+	// Half-life is the number of days until half of all clicks were received
+	var running int64
+	for _, stat := range stats {
+		running += stat.Clicks
+		if running*2 >= resp.TotalClicks {
+			resp.HalfLifeDays = int(stat.Day.UTC().Sub(createdDay) / (24 * time.Hour))
+			break
+		}
+	}
+
+	var cumulative int64
+	for i := range resp.Buckets {
+		cumulative += resp.Buckets[i].Clicks
+		resp.Buckets[i].Share = float64(resp.Buckets[i].Clicks) / float64(resp.TotalClicks)
+		resp.Buckets[i].Cumulative = float64(cumulative) / float64(resp.TotalClicks)
+	}
+
+	return resp, nil
 }
 
 // extractSource extracts the source from referer URL
 func (as *AnalyticsService) extractSource(referer string) string {
-	if referer == "" {
-		return "direct"
+	return as.rules.Source(referer)
+}
+
+// CompareAnalytics compares the last days days, today included, with the same number of days before
+// them, computed from the daily aggregates. UV counts a visitor once per day, like the real-time UV.
+func (as *AnalyticsService) CompareAnalytics(ctx context.Context, shortCode string, days int) (*model.CompareResponse, error) {
+	if _, err := as.mysqlRepo.GetShortLinkByCode(ctx, shortCode); err != nil {
+		return nil, linkError(err)
 	}
 
-	u, err := url.Parse(referer)
+	today := as.clock.Now().UTC().Truncate(24 * time.Hour)
+	current := model.Period{From: today.AddDate(0, 0, 1-days), To: today}
+	previous := model.Period{From: current.From.AddDate(0, 0, -days), To: current.From.AddDate(0, 0, -1)}
+
+	stats, err := as.mysqlRepo.GetDailyStats(ctx, shortCode, previous.From, current.To)
 	if err != nil {
-		return "unknown"
+		return nil, fmt.Errorf("failed to get daily stats: %w", err)
+	}
+	sourceStats, err := as.mysqlRepo.GetDailySourceStats(ctx, shortCode, previous.From, current.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily source stats: %w", err)
 	}
 
-	host := u.Host
-	if strings.HasPrefix(host, "www.") {
-		host = host[4:]
+	// Index 0 sums the current period, index 1 the previous one
+	periodOf := func(day time.Time) int {
+		if day.UTC().Before(current.From) {
+			return 1
+		}
+		return 0
 	}
 
-	// Known sources
-	switch {
-	case strings.Contains(host, "google"):
-		return "google"
-	case strings.Contains(host, "baidu"):
-		return "baidu"
-	case strings.Contains(host, "bing"):
-		return "bing"
-	case strings.Contains(host, "weibo"):
-		return "weibo"
-	case strings.Contains(host, "weixin") || strings.Contains(host, "mp.weixin.qq.com"):
-		return "wechat"
-	case strings.Contains(host, "qq"):
-		return "qq"
-	case strings.Contains(host, "zhihu"):
-		return "zhihu"
-	default:
-		// Return domain name for other sources
-		parts := strings.Split(host, ".")
-		if len(parts) >= 2 {
-			return parts[len(parts)-2]
+	var pv, uv [2]int64
+	for _, stat := range stats {
+		p := periodOf(stat.Day)
+		pv[p] += stat.Clicks
+		uv[p] += stat.Visitors
+	}
+	sources := make(map[string]*[2]int64)
+	for _, stat := range sourceStats {
+		counts, ok := sources[stat.Source]
+		if !ok {
+			counts = &[2]int64{}
+			sources[stat.Source] = counts
 		}
-		return host
+		counts[periodOf(stat.Day)] += stat.Clicks
+	}
+
+	resp := &model.CompareResponse{
+		ShortCode: shortCode,
+		Days:      days,
+		Current:   current,
+		Previous:  previous,
+		PV:        newMetricChange(pv[0], pv[1]),
+		UV:        newMetricChange(uv[0], uv[1]),
+		Sources:   make([]model.SourceChange, 0, len(sources)),
+	}
+	for source, counts := range sources {
+		resp.Sources = append(resp.Sources, model.SourceChange{Source: source, MetricChange: newMetricChange(counts[0], counts[1])})
+	}
+	sort.Slice(resp.Sources, func(i, j int) bool {
+		a, b := resp.Sources[i], resp.Sources[j]
+		if a.Current != b.Current {
+			return a.Current > b.Current
+		}
+		if a.Previous != b.Previous {
+			return a.Previous > b.Previous
+		}
+		return a.Source < b.Source
+	})
+
+	return resp, nil
+}
+
+// GetSourcesDaily returns the clicks of each source on each of the last days days, today included,
+// from the daily aggregates, which outlive the real-time source counters
+func (as *AnalyticsService) GetSourcesDaily(ctx context.Context, shortCode string, days int) (*model.SourcesDailyResponse, error) {
+	if _, err := as.mysqlRepo.GetShortLinkByCode(ctx, shortCode); err != nil {
+		return nil, linkError(err)
+	}
+
+	today := as.clock.Now().UTC().Truncate(24 * time.Hour)
+	period := model.Period{From: today.AddDate(0, 0, 1-days), To: today}
+	sourceStats, err := as.mysqlRepo.GetDailySourceStats(ctx, shortCode, period.From, period.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily source stats: %w", err)
+	}
+
+	resp := &model.SourcesDailyResponse{
+		ShortCode: shortCode,
+		Period:    period,
+		Days:      make([]string, days),
+		Sources:   []model.SourceDailyClicks{},
+	}
+	for i := range resp.Days {
+		resp.Days[i] = model.StatsDay(period.From.AddDate(0, 0, i))
 	}
+
+	rows := make(map[string]*model.SourceDailyClicks)
+	for _, stat := range sourceStats {
+		i := int(stat.Day.UTC().Sub(period.From) / (24 * time.Hour))
+		if i < 0 || i >= days {
+			continue
+		}
+		row, ok := rows[stat.Source]
+		if !ok {
+			row = &model.SourceDailyClicks{Source: stat.Source, Clicks: make([]int64, days)}
+			rows[stat.Source] = row
+		}
+		row.Clicks[i] += stat.Clicks
+		row.Total += stat.Clicks
+		resp.Max = max(resp.Max, row.Clicks[i])
+	}
+	for _, row := range rows {
+		resp.Sources = append(resp.Sources, *row)
+	}
+	sort.Slice(resp.Sources, func(i, j int) bool {
+		a, b := resp.Sources[i], resp.Sources[j]
+		if a.Total != b.Total {
+			return a.Total > b.Total
+		}
+		return a.Source < b.Source
+	})
+
+	return resp, nil
+}
+
+// GetRealtime returns the clicks of a short link in each minute of the last hour, from the ring of
+// per-minute counters the analytics pipeline keeps in Redis
+func (as *AnalyticsService) GetRealtime(ctx context.Context, shortCode string) (*model.RealtimeResponse, error) {
+	if _, err := as.mysqlRepo.GetShortLinkByCode(ctx, shortCode); err != nil {
+		return nil, linkError(err)
+	}
+
+	now := as.clock.Now().UTC()
+	clicks, err := as.redisRepo.GetMinuteClicks(ctx, shortCode, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get per-minute clicks: %w", err)
+	}
+
+	resp := &model.RealtimeResponse{
+		ShortCode: shortCode,
+		From:      now.Truncate(time.Minute).Add(-time.Duration(len(clicks)-1) * time.Minute),
+		Clicks:    clicks,
+	}
+	for _, count := range clicks {
+		resp.Total += count
+		resp.Max = max(resp.Max, count)
+	}
+	return resp, nil
+}
+
+// newMetricChange compares a metric between two periods, rounding the change to two decimals
+func newMetricChange(current, previous int64) model.MetricChange {
+	change := model.MetricChange{Current: current, Previous: previous, Delta: current - previous}
+	if previous > 0 {
+		percent := math.Round(float64(change.Delta)/float64(previous)*10000) / 100
+		change.ChangePercent = &percent
+	}
+	return change
+}
+
+// conversionRate returns the share of clicks that converted
+func conversionRate(conversions, clicks int64) float64 {
+	if clicks == 0 {
+		return 0
+	}
+	return float64(conversions) / float64(clicks)
 }
 
 // getTopSources returns the top N sources
@@ -159,3 +655,52 @@ func (as *AnalyticsService) getTopSources(sources map[string]int64, limit int) [
 
 	return stats
 }
+
+// SourceFromReferer maps a referer URL to a traffic source name: a known source, the registrable
+// domain's name without its public suffix (bbc for news.bbc.co.uk), or the IP of IP referers
+func SourceFromReferer(referer string) string {
+	if referer == "" {
+		return "direct"
+	}
+
+	u, err := url.Parse(referer)
+	if err != nil {
+		return "unknown"
+	}
+
+	// Hostname drops the port and the brackets of IPv6 literals
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return "unknown"
+	}
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	host = strings.TrimPrefix(host, "www.")
+
+	// Known sources
+	switch {
+	case strings.Contains(host, "google"):
+		return "google"
+	case strings.Contains(host, "baidu"):
+		return "baidu"
+	case strings.Contains(host, "bing"):
+		return "bing"
+	case strings.Contains(host, "weibo"):
+		return "weibo"
+	case strings.Contains(host, "weixin") || strings.Contains(host, "mp.weixin.qq.com"):
+		return "wechat"
+	case strings.Contains(host, "qq"):
+		return "qq"
+	case strings.Contains(host, "zhihu"):
+		return "zhihu"
+	default:
+		// Hosts that are a public suffix themselves, or single labels like localhost, stay as they are
+		domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+		if err != nil {
+			return host
+		}
+		suffix, _ := publicsuffix.PublicSuffix(domain)
+		return strings.TrimSuffix(domain, "."+suffix)
+	}
+}
@@ -3,9 +3,14 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
+	"octopus/internal/config"
 	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/pkg/clock"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -16,11 +21,13 @@ func TestNewAnalyticsService(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
-	svc := NewAnalyticsService(mockRepo)
+	mockRepo := mocks.NewMockCache(ctrl)
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	svc := NewAnalyticsService(mockRepo, mockMySQL)
 
 	assert.NotNil(t, svc)
 	assert.Equal(t, mockRepo, svc.redisRepo)
+	assert.Equal(t, mockMySQL, svc.mysqlRepo)
 }
 
 func TestAnalyticsService_RecordAccess(t *testing.T) {
@@ -28,22 +35,18 @@ func TestAnalyticsService_RecordAccess(t *testing.T) {
 		name      string
 		shortCode string
 		clientIP  string
-		userAgent string
 		referer   string
-		setupMock func(*gomock.Controller) *mocks.MockRedisRepositoryInterface
+		setupMock func(*gomock.Controller) *mocks.MockCache
 		expectErr bool
 	}{
 		{
 			name:      "successful record access",
 			shortCode: "ABCD",
 			clientIP:  "192.168.1.1",
-			userAgent: "Mozilla/5.0",
 			referer:   "https://google.com",
-			setupMock: func(ctrl *gomock.Controller) *mocks.MockRedisRepositoryInterface {
-				mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockRepo.EXPECT().IncrementPV(gomock.Any(), "ABCD").Return(int64(1), nil)
-				mockRepo.EXPECT().AddUV(gomock.Any(), "ABCD", gomock.Any()).Return(true, nil)
-				mockRepo.EXPECT().AddSource(gomock.Any(), "ABCD", "google").Return(nil)
+			setupMock: func(ctrl *gomock.Controller) *mocks.MockCache {
+				mockRepo := mocks.NewMockCache(ctrl)
+				mockRepo.EXPECT().RecordAccessPipelined(gomock.Any(), "ABCD", gomock.Any(), "google").Return(nil)
 				return mockRepo
 			},
 			expectErr: false,
@@ -52,13 +55,10 @@ func TestAnalyticsService_RecordAccess(t *testing.T) {
 			name:      "record access with direct referer",
 			shortCode: "ABCD",
 			clientIP:  "192.168.1.1",
-			userAgent: "Mozilla/5.0",
 			referer:   "",
-			setupMock: func(ctrl *gomock.Controller) *mocks.MockRedisRepositoryInterface {
-				mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockRepo.EXPECT().IncrementPV(gomock.Any(), "ABCD").Return(int64(1), nil)
-				mockRepo.EXPECT().AddUV(gomock.Any(), "ABCD", gomock.Any()).Return(true, nil)
-				mockRepo.EXPECT().AddSource(gomock.Any(), "ABCD", "direct").Return(nil)
+			setupMock: func(ctrl *gomock.Controller) *mocks.MockCache {
+				mockRepo := mocks.NewMockCache(ctrl)
+				mockRepo.EXPECT().RecordAccessPipelined(gomock.Any(), "ABCD", gomock.Any(), "direct").Return(nil)
 				return mockRepo
 			},
 			expectErr: false,
@@ -67,13 +67,10 @@ func TestAnalyticsService_RecordAccess(t *testing.T) {
 			name:      "record access with invalid referer",
 			shortCode: "ABCD",
 			clientIP:  "192.168.1.1",
-			userAgent: "Mozilla/5.0",
 			referer:   "://invalid",
-			setupMock: func(ctrl *gomock.Controller) *mocks.MockRedisRepositoryInterface {
-				mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockRepo.EXPECT().IncrementPV(gomock.Any(), "ABCD").Return(int64(1), nil)
-				mockRepo.EXPECT().AddUV(gomock.Any(), "ABCD", gomock.Any()).Return(true, nil)
-				mockRepo.EXPECT().AddSource(gomock.Any(), "ABCD", "unknown").Return(nil)
+			setupMock: func(ctrl *gomock.Controller) *mocks.MockCache {
+				mockRepo := mocks.NewMockCache(ctrl)
+				mockRepo.EXPECT().RecordAccessPipelined(gomock.Any(), "ABCD", gomock.Any(), "unknown").Return(nil)
 				return mockRepo
 			},
 			expectErr: false,
@@ -82,13 +79,10 @@ func TestAnalyticsService_RecordAccess(t *testing.T) {
 			name:      "record access with baidu referer",
 			shortCode: "ABCD",
 			clientIP:  "192.168.1.1",
-			userAgent: "Mozilla/5.0",
 			referer:   "https://www.baidu.com/s",
-			setupMock: func(ctrl *gomock.Controller) *mocks.MockRedisRepositoryInterface {
-				mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockRepo.EXPECT().IncrementPV(gomock.Any(), "ABCD").Return(int64(1), nil)
-				mockRepo.EXPECT().AddUV(gomock.Any(), "ABCD", gomock.Any()).Return(true, nil)
-				mockRepo.EXPECT().AddSource(gomock.Any(), "ABCD", "baidu").Return(nil)
+			setupMock: func(ctrl *gomock.Controller) *mocks.MockCache {
+				mockRepo := mocks.NewMockCache(ctrl)
+				mockRepo.EXPECT().RecordAccessPipelined(gomock.Any(), "ABCD", gomock.Any(), "baidu").Return(nil)
 				return mockRepo
 			},
 			expectErr: false,
@@ -97,13 +91,10 @@ func TestAnalyticsService_RecordAccess(t *testing.T) {
 			name:      "record access with wechat referer",
 			shortCode: "ABCD",
 			clientIP:  "192.168.1.1",
-			userAgent: "Mozilla/5.0",
 			referer:   "https://mp.weixin.qq.com/s",
-			setupMock: func(ctrl *gomock.Controller) *mocks.MockRedisRepositoryInterface {
-				mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockRepo.EXPECT().IncrementPV(gomock.Any(), "ABCD").Return(int64(1), nil)
-				mockRepo.EXPECT().AddUV(gomock.Any(), "ABCD", gomock.Any()).Return(true, nil)
-				mockRepo.EXPECT().AddSource(gomock.Any(), "ABCD", "wechat").Return(nil)
+			setupMock: func(ctrl *gomock.Controller) *mocks.MockCache {
+				mockRepo := mocks.NewMockCache(ctrl)
+				mockRepo.EXPECT().RecordAccessPipelined(gomock.Any(), "ABCD", gomock.Any(), "wechat").Return(nil)
 				return mockRepo
 			},
 			expectErr: false,
@@ -112,13 +103,10 @@ func TestAnalyticsService_RecordAccess(t *testing.T) {
 			name:      "record access with www prefix removed",
 			shortCode: "ABCD",
 			clientIP:  "192.168.1.1",
-			userAgent: "Mozilla/5.0",
 			referer:   "https://www.example.com",
-			setupMock: func(ctrl *gomock.Controller) *mocks.MockRedisRepositoryInterface {
-				mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockRepo.EXPECT().IncrementPV(gomock.Any(), "ABCD").Return(int64(1), nil)
-				mockRepo.EXPECT().AddUV(gomock.Any(), "ABCD", gomock.Any()).Return(true, nil)
-				mockRepo.EXPECT().AddSource(gomock.Any(), "ABCD", "example").Return(nil)
+			setupMock: func(ctrl *gomock.Controller) *mocks.MockCache {
+				mockRepo := mocks.NewMockCache(ctrl)
+				mockRepo.EXPECT().RecordAccessPipelined(gomock.Any(), "ABCD", gomock.Any(), "example").Return(nil)
 				return mockRepo
 			},
 			expectErr: false,
@@ -127,28 +115,22 @@ func TestAnalyticsService_RecordAccess(t *testing.T) {
 			name:      "record access with subdomain",
 			shortCode: "ABCD",
 			clientIP:  "192.168.1.1",
-			userAgent: "Mozilla/5.0",
 			referer:   "https://blog.example.com",
-			setupMock: func(ctrl *gomock.Controller) *mocks.MockRedisRepositoryInterface {
-				mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockRepo.EXPECT().IncrementPV(gomock.Any(), "ABCD").Return(int64(1), nil)
-				mockRepo.EXPECT().AddUV(gomock.Any(), "ABCD", gomock.Any()).Return(true, nil)
-				mockRepo.EXPECT().AddSource(gomock.Any(), "ABCD", "example").Return(nil)
+			setupMock: func(ctrl *gomock.Controller) *mocks.MockCache {
+				mockRepo := mocks.NewMockCache(ctrl)
+				mockRepo.EXPECT().RecordAccessPipelined(gomock.Any(), "ABCD", gomock.Any(), "example").Return(nil)
 				return mockRepo
 			},
 			expectErr: false,
 		},
 		{
-			name:      "record access with PV error",
+			name:      "record access with redis error",
 			shortCode: "ABCD",
 			clientIP:  "192.168.1.1",
-			userAgent: "Mozilla/5.0",
 			referer:   "https://google.com",
-			setupMock: func(ctrl *gomock.Controller) *mocks.MockRedisRepositoryInterface {
-				mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockRepo.EXPECT().IncrementPV(gomock.Any(), "ABCD").Return(int64(0), errors.New("redis error"))
-				mockRepo.EXPECT().AddUV(gomock.Any(), "ABCD", gomock.Any()).Return(true, nil)
-				mockRepo.EXPECT().AddSource(gomock.Any(), "ABCD", "google").Return(nil)
+			setupMock: func(ctrl *gomock.Controller) *mocks.MockCache {
+				mockRepo := mocks.NewMockCache(ctrl)
+				mockRepo.EXPECT().RecordAccessPipelined(gomock.Any(), "ABCD", gomock.Any(), "google").Return(errors.New("redis error"))
 				return mockRepo
 			},
 			expectErr: false,
@@ -161,9 +143,9 @@ func TestAnalyticsService_RecordAccess(t *testing.T) {
 			defer ctrl.Finish()
 
 			mockRepo := tt.setupMock(ctrl)
-			svc := NewAnalyticsService(mockRepo)
+			svc := NewAnalyticsService(mockRepo, nil)
 
-			err := svc.RecordAccess(context.Background(), tt.shortCode, tt.clientIP, tt.userAgent, tt.referer)
+			err := svc.RecordAccess(context.Background(), tt.shortCode, tt.clientIP, tt.referer)
 
 			if tt.expectErr {
 				assert.Error(t, err)
@@ -174,18 +156,56 @@ func TestAnalyticsService_RecordAccess(t *testing.T) {
 	}
 }
 
+func TestAnalyticsService_RecordAccessWriteBehind(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockCache(ctrl)
+	svc := NewAnalyticsService(mockRepo, mocks.NewMockDatabase(ctrl))
+	counters := newCounterBuffer(mockRepo, &config.WriteBehindConfig{FlushInterval: time.Hour})
+	svc.SetCounterBuffer(counters)
+
+	// Clicks only reach Redis with the next flush
+	assert.NoError(t, svc.RecordAccess(context.Background(), "ABCD", "192.168.1.1", "https://google.com"))
+	assert.NoError(t, svc.RecordAccess(context.Background(), "ABCD", "192.168.1.1", "https://google.com"))
+
+	mockRepo.EXPECT().ApplyCounters(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, deltas []*model.CounterDelta) error {
+		assert.Len(t, deltas, 1)
+		assert.Equal(t, int64(2), deltas[0].PV)
+		assert.Len(t, deltas[0].Visitors, 1)
+		assert.Equal(t, map[string]int64{"google": 2}, deltas[0].Sources)
+		return nil
+	})
+	counters.Flush(context.Background())
+}
+
+func TestAnalyticsService_RecordAccessWriteBehindFlagOff(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockCache(ctrl)
+	svc := NewAnalyticsService(mockRepo, mocks.NewMockDatabase(ctrl))
+	svc.SetCounterBuffer(newCounterBuffer(mockRepo, &config.WriteBehindConfig{FlushInterval: time.Hour}))
+	flags, _ := newTestFeatureFlags(t, map[string]config.FlagConfig{FlagWriteBehindAnalytics: {Enabled: false}})
+	svc.SetFlags(flags)
+
+	// Links outside the rollout keep writing every click
+	mockRepo.EXPECT().RecordAccessPipelined(gomock.Any(), "ABCD", gomock.Any(), "google").Return(nil)
+	assert.NoError(t, svc.RecordAccess(context.Background(), "ABCD", "192.168.1.1", "https://google.com"))
+}
+
 func TestAnalyticsService_GetStats(t *testing.T) {
 	tests := []struct {
 		name      string
 		shortCode string
-		setupMock func(*gomock.Controller) *mocks.MockRedisRepositoryInterface
+		setupMock func(*gomock.Controller) *mocks.MockCache
 		expected  *model.Stats
 	}{
 		{
 			name:      "get stats successfully",
 			shortCode: "ABCD",
-			setupMock: func(ctrl *gomock.Controller) *mocks.MockRedisRepositoryInterface {
-				mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) *mocks.MockCache {
+				mockRepo := mocks.NewMockCache(ctrl)
 				mockRepo.EXPECT().GetPV(gomock.Any(), "ABCD").Return(int64(1000), nil)
 				mockRepo.EXPECT().GetUV(gomock.Any(), "ABCD").Return(int64(500), nil)
 				return mockRepo
@@ -195,8 +215,8 @@ func TestAnalyticsService_GetStats(t *testing.T) {
 		{
 			name:      "get stats with PV error",
 			shortCode: "ABCD",
-			setupMock: func(ctrl *gomock.Controller) *mocks.MockRedisRepositoryInterface {
-				mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) *mocks.MockCache {
+				mockRepo := mocks.NewMockCache(ctrl)
 				mockRepo.EXPECT().GetPV(gomock.Any(), "ABCD").Return(int64(0), errors.New("redis error"))
 				mockRepo.EXPECT().GetUV(gomock.Any(), "ABCD").Return(int64(0), nil)
 				return mockRepo
@@ -206,8 +226,8 @@ func TestAnalyticsService_GetStats(t *testing.T) {
 		{
 			name:      "get stats with UV error",
 			shortCode: "ABCD",
-			setupMock: func(ctrl *gomock.Controller) *mocks.MockRedisRepositoryInterface {
-				mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) *mocks.MockCache {
+				mockRepo := mocks.NewMockCache(ctrl)
 				mockRepo.EXPECT().GetPV(gomock.Any(), "ABCD").Return(int64(1000), nil)
 				mockRepo.EXPECT().GetUV(gomock.Any(), "ABCD").Return(int64(0), errors.New("redis error"))
 				return mockRepo
@@ -217,8 +237,8 @@ func TestAnalyticsService_GetStats(t *testing.T) {
 		{
 			name:      "get stats with zero values",
 			shortCode: "ABCD",
-			setupMock: func(ctrl *gomock.Controller) *mocks.MockRedisRepositoryInterface {
-				mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) *mocks.MockCache {
+				mockRepo := mocks.NewMockCache(ctrl)
 				mockRepo.EXPECT().GetPV(gomock.Any(), "ABCD").Return(int64(0), nil)
 				mockRepo.EXPECT().GetUV(gomock.Any(), "ABCD").Return(int64(0), nil)
 				return mockRepo
@@ -233,7 +253,7 @@ func TestAnalyticsService_GetStats(t *testing.T) {
 			defer ctrl.Finish()
 
 			mockRepo := tt.setupMock(ctrl)
-			svc := NewAnalyticsService(mockRepo)
+			svc := NewAnalyticsService(mockRepo, nil)
 
 			result, err := svc.GetStats(context.Background(), tt.shortCode)
 
@@ -244,20 +264,41 @@ func TestAnalyticsService_GetStats(t *testing.T) {
 	}
 }
 
+func TestAnalyticsService_GetLastModified(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	updatedAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	mockRepo := mocks.NewMockCache(ctrl)
+	mockRepo.EXPECT().GetStatsUpdatedAt(gomock.Any(), "ABCD").Return(updatedAt, nil)
+	mockRepo.EXPECT().GetStatsUpdatedAt(gomock.Any(), "FAIL").Return(time.Time{}, errors.New("redis error"))
+
+	svc := NewAnalyticsService(mockRepo, nil)
+
+	lastModified, err := svc.GetLastModified(context.Background(), "ABCD")
+	assert.NoError(t, err)
+	assert.Equal(t, updatedAt, lastModified)
+
+	_, err = svc.GetLastModified(context.Background(), "FAIL")
+	assert.Error(t, err)
+}
+
 func TestAnalyticsService_GetAnalytics(t *testing.T) {
 	tests := []struct {
 		name        string
 		shortCode   string
-		setupMock   func(*gomock.Controller) *mocks.MockRedisRepositoryInterface
+		setupMock   func(*gomock.Controller) *mocks.MockCache
 		wantPV      int64
 		wantUV      int64
 		wantSourcesLen int
+		wantConversions int64
 	}{
 		{
 			name:      "get analytics with sources",
 			shortCode: "ABCD",
-			setupMock: func(ctrl *gomock.Controller) *mocks.MockRedisRepositoryInterface {
-				mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) *mocks.MockCache {
+				mockRepo := mocks.NewMockCache(ctrl)
+				mockRepo.EXPECT().GetStatsUpdatedAt(gomock.Any(), "ABCD").Return(time.Time{}, nil)
 				mockRepo.EXPECT().GetPV(gomock.Any(), "ABCD").Return(int64(1000), nil)
 				mockRepo.EXPECT().GetUV(gomock.Any(), "ABCD").Return(int64(500), nil)
 				mockRepo.EXPECT().GetSources(gomock.Any(), "ABCD").Return(map[string]int64{
@@ -265,20 +306,27 @@ func TestAnalyticsService_GetAnalytics(t *testing.T) {
 					"direct": 300,
 					"baidu":  200,
 				}, nil)
+				mockRepo.EXPECT().GetConversions(gomock.Any(), "ABCD").Return(map[string]int64{
+					"google": 50,
+					"direct": 10,
+				}, nil)
 				return mockRepo
 			},
 			wantPV:        1000,
 			wantUV:        500,
 			wantSourcesLen: 3,
+			wantConversions: 60,
 		},
 		{
 			name:      "get analytics with empty sources",
 			shortCode: "ABCD",
-			setupMock: func(ctrl *gomock.Controller) *mocks.MockRedisRepositoryInterface {
-				mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) *mocks.MockCache {
+				mockRepo := mocks.NewMockCache(ctrl)
+				mockRepo.EXPECT().GetStatsUpdatedAt(gomock.Any(), "ABCD").Return(time.Time{}, nil)
 				mockRepo.EXPECT().GetPV(gomock.Any(), "ABCD").Return(int64(100), nil)
 				mockRepo.EXPECT().GetUV(gomock.Any(), "ABCD").Return(int64(50), nil)
 				mockRepo.EXPECT().GetSources(gomock.Any(), "ABCD").Return(map[string]int64{}, nil)
+				mockRepo.EXPECT().GetConversions(gomock.Any(), "ABCD").Return(map[string]int64{}, nil)
 				return mockRepo
 			},
 			wantPV:        100,
@@ -288,11 +336,13 @@ func TestAnalyticsService_GetAnalytics(t *testing.T) {
 		{
 			name:      "get analytics with sources error",
 			shortCode: "ABCD",
-			setupMock: func(ctrl *gomock.Controller) *mocks.MockRedisRepositoryInterface {
-				mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) *mocks.MockCache {
+				mockRepo := mocks.NewMockCache(ctrl)
+				mockRepo.EXPECT().GetStatsUpdatedAt(gomock.Any(), "ABCD").Return(time.Time{}, nil)
 				mockRepo.EXPECT().GetPV(gomock.Any(), "ABCD").Return(int64(100), nil)
 				mockRepo.EXPECT().GetUV(gomock.Any(), "ABCD").Return(int64(50), nil)
 				mockRepo.EXPECT().GetSources(gomock.Any(), "ABCD").Return(nil, errors.New("redis error"))
+				mockRepo.EXPECT().GetConversions(gomock.Any(), "ABCD").Return(nil, errors.New("redis error"))
 				return mockRepo
 			},
 			wantPV:        100,
@@ -307,25 +357,259 @@ func TestAnalyticsService_GetAnalytics(t *testing.T) {
 			defer ctrl.Finish()
 
 			mockRepo := tt.setupMock(ctrl)
-			svc := NewAnalyticsService(mockRepo)
+			svc := NewAnalyticsService(mockRepo, nil)
 
-			result, err := svc.GetAnalytics(context.Background(), tt.shortCode)
+			result, err := svc.GetAnalytics(context.Background(), tt.shortCode, false)
 
 			assert.NoError(t, err)
 			assert.Equal(t, tt.shortCode, result.ShortCode)
 			assert.Equal(t, tt.wantPV, result.PV)
 			assert.Equal(t, tt.wantUV, result.UV)
 			assert.Len(t, result.TopSources, tt.wantSourcesLen)
+			assert.Equal(t, tt.wantConversions, result.Conversions)
 		})
 	}
 }
 
+func TestAnalyticsService_AggregateAnalytics(t *testing.T) {
+	expectLink := func(mockRepo *mocks.MockCache, shortCode string, pv, uv int64, sources, conversions map[string]int64) {
+		mockRepo.EXPECT().GetPV(gomock.Any(), shortCode).Return(pv, nil)
+		mockRepo.EXPECT().GetUV(gomock.Any(), shortCode).Return(uv, nil)
+		mockRepo.EXPECT().GetSources(gomock.Any(), shortCode).Return(sources, nil)
+		mockRepo.EXPECT().GetConversions(gomock.Any(), shortCode).Return(conversions, nil)
+	}
+
+	t.Run("combines links and merges UV", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRepo := mocks.NewMockCache(ctrl)
+		expectLink(mockRepo, "ABCD", 100, 40, map[string]int64{"google": 60, "direct": 40}, map[string]int64{"google": 6})
+		expectLink(mockRepo, "XYZ", 50, 30, map[string]int64{"google": 10, "baidu": 40}, map[string]int64{"baidu": 4})
+		// Sketches outlive their day by the UV retention of a day at most
+		today := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+		period := model.Period{From: today.AddDate(0, 0, -1), To: today}
+		mockRepo.EXPECT().GetMergedUV(gomock.Any(), []string{"ABCD", "XYZ"}, period).Return(int64(55), nil)
+
+		svc := NewAnalyticsService(mockRepo, nil)
+		svc.clock = clock.NewFake(today.Add(15 * time.Hour))
+		result, err := svc.AggregateAnalytics(context.Background(), []string{"ABCD", "XYZ", "ABCD"})
+		assert.NoError(t, err)
+
+		assert.Equal(t, int64(150), result.PV)
+		assert.Equal(t, int64(55), result.UV)
+		assert.Equal(t, int64(10), result.Conversions)
+		assert.InDelta(t, 10.0/150.0, result.ConversionRate, 0.0001)
+		assert.Len(t, result.Links, 2)
+		assert.Equal(t, "XYZ", result.Links[1].ShortCode)
+		assert.Equal(t, model.SourceStat{Source: "google", Count: 70, Conversions: 6, ConversionRate: 6.0 / 70.0}, result.TopSources[0])
+		assert.Len(t, result.TopSources, 3)
+	})
+
+	t.Run("falls back to summed UV", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRepo := mocks.NewMockCache(ctrl)
+		expectLink(mockRepo, "ABCD", 10, 4, map[string]int64{}, map[string]int64{})
+		expectLink(mockRepo, "XYZ", 5, 3, map[string]int64{}, map[string]int64{})
+		mockRepo.EXPECT().GetMergedUV(gomock.Any(), gomock.Any(), gomock.Any()).Return(int64(0), errors.New("redis error"))
+
+		svc := NewAnalyticsService(mockRepo, nil)
+		result, err := svc.AggregateAnalytics(context.Background(), []string{"ABCD", "XYZ"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), result.UV)
+	})
+
+	t.Run("merges UV since the oldest link when kept for good", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRepo := mocks.NewMockCache(ctrl)
+		mockDB := mocks.NewMockDatabase(ctrl)
+		expectLink(mockRepo, "ABCD", 10, 4, map[string]int64{}, map[string]int64{})
+		expectLink(mockRepo, "XYZ", 5, 3, map[string]int64{}, map[string]int64{})
+		mockDB.EXPECT().GetShortLinksByCodes(gomock.Any(), []string{"ABCD", "XYZ"}).Return([]model.ShortLink{
+			{ShortCode: "ABCD", CreatedAt: time.Date(2026, 10, 12, 18, 0, 0, 0, time.UTC)},
+			{ShortCode: "XYZ", CreatedAt: time.Date(2026, 10, 10, 9, 0, 0, 0, time.UTC)},
+		}, nil)
+		period := model.Period{From: time.Date(2026, 10, 10, 0, 0, 0, 0, time.UTC), To: time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)}
+		mockRepo.EXPECT().GetMergedUV(gomock.Any(), []string{"ABCD", "XYZ"}, period).Return(int64(6), nil)
+
+		svc := NewAnalyticsService(mockRepo, mockDB)
+		svc.SetRetention(&config.RetentionConfig{PV: time.Hour})
+		svc.clock = clock.NewFake(time.Date(2026, 10, 16, 15, 0, 0, 0, time.UTC))
+		result, err := svc.AggregateAnalytics(context.Background(), []string{"ABCD", "XYZ"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(6), result.UV)
+	})
+
+	t.Run("merges the sketches of recent days only", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRepo := mocks.NewMockCache(ctrl)
+		mockDB := mocks.NewMockDatabase(ctrl)
+		expectLink(mockRepo, "ABCD", 10, 4, map[string]int64{}, map[string]int64{})
+		// Imported with years of history
+		mockDB.EXPECT().GetShortLinksByCodes(gomock.Any(), []string{"ABCD"}).Return([]model.ShortLink{
+			{ShortCode: "ABCD", CreatedAt: time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)},
+		}, nil)
+		today := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+		period := model.Period{From: today.AddDate(0, 0, -maxMergedUVDays), To: today}
+		mockRepo.EXPECT().GetMergedUV(gomock.Any(), []string{"ABCD"}, period).Return(int64(4), nil)
+
+		svc := NewAnalyticsService(mockRepo, mockDB)
+		svc.SetRetention(&config.RetentionConfig{PV: time.Hour})
+		svc.clock = clock.NewFake(today.Add(15 * time.Hour))
+		_, err := svc.AggregateAnalytics(context.Background(), []string{"ABCD"})
+		assert.NoError(t, err)
+
+		// A longer UV retention is cut the same way
+		expectLink(mockRepo, "ABCD", 10, 4, map[string]int64{}, map[string]int64{})
+		mockRepo.EXPECT().GetMergedUV(gomock.Any(), []string{"ABCD"}, period).Return(int64(4), nil)
+		svc.SetRetention(&config.RetentionConfig{UV: 365 * 24 * time.Hour})
+		_, err = svc.AggregateAnalytics(context.Background(), []string{"ABCD"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("no links", func(t *testing.T) {
+		svc := NewAnalyticsService(nil, nil)
+		result, err := svc.AggregateAnalytics(context.Background(), []string{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), result.UV)
+		assert.Empty(t, result.Links)
+	})
+}
+
+func TestAnalyticsService_CampaignShortCodes(t *testing.T) {
+	store := repository.NewMemoryRepository()
+	for _, sl := range []model.ShortLink{
+		{ShortCode: "ABCD", Params: []byte(`{"utm_campaign":"spring"}`), Owner: "owner-1"},
+		{ShortCode: "EFGH", Params: []byte(`{"utm_campaign":"spring"}`), Owner: "owner-2"},
+		{ShortCode: "IJKL", Params: []byte(`{"utm_campaign":"autumn"}`), Owner: "owner-1"},
+	} {
+		sl := sl
+		assert.NoError(t, store.SaveShortLink(context.Background(), &sl))
+	}
+
+	svc := NewAnalyticsService(nil, store)
+	svc.SetCampaignParam("utm_campaign")
+
+	codes, err := svc.CampaignShortCodes(context.Background(), "spring", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ABCD", "EFGH"}, codes)
+
+	codes, err = svc.CampaignShortCodes(context.Background(), "spring", "owner-2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"EFGH"}, codes)
+
+	for i := 0; i < maxAggregateLinks; i++ {
+		sl := model.ShortLink{ShortCode: fmt.Sprintf("M%03d", i), Params: []byte(`{"utm_campaign":"autumn"}`)}
+		assert.NoError(t, store.SaveShortLink(context.Background(), &sl))
+	}
+	_, err = svc.CampaignShortCodes(context.Background(), "autumn", "")
+	assert.ErrorIs(t, err, ErrTooManyLinks)
+}
+
+func TestAnalyticsService_GetAnalytics_Retention(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockCache(ctrl)
+	mockRepo.EXPECT().GetStatsUpdatedAt(gomock.Any(), "ABCD").Return(time.Time{}, nil).Times(2)
+	mockRepo.EXPECT().GetPV(gomock.Any(), "ABCD").Return(int64(10), nil).Times(2)
+	mockRepo.EXPECT().GetUV(gomock.Any(), "ABCD").Return(int64(5), nil).Times(2)
+	mockRepo.EXPECT().GetSources(gomock.Any(), "ABCD").Return(map[string]int64{}, nil).Times(2)
+	mockRepo.EXPECT().GetConversions(gomock.Any(), "ABCD").Return(map[string]int64{}, nil).Times(2)
+
+	svc := NewAnalyticsService(mockRepo, nil)
+
+	result, err := svc.GetAnalytics(context.Background(), "ABCD", false)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatsRetention{PV: "24h0m0s", UV: "24h0m0s", Sources: "24h0m0s"}, result.Retention)
+
+	svc.SetRetention(&config.RetentionConfig{PV: 0, UV: time.Hour, Sources: 30 * 24 * time.Hour})
+
+	result, err = svc.GetAnalytics(context.Background(), "ABCD", false)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatsRetention{PV: "infinite", UV: "1h0m0s", Sources: "720h0m0s"}, result.Retention)
+}
+
+func TestAnalyticsService_GetAnalytics_ConversionRates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockCache(ctrl)
+	mockRepo.EXPECT().GetStatsUpdatedAt(gomock.Any(), "ABCD").Return(time.Time{}, nil)
+	mockRepo.EXPECT().GetPV(gomock.Any(), "ABCD").Return(int64(200), nil)
+	mockRepo.EXPECT().GetUV(gomock.Any(), "ABCD").Return(int64(100), nil)
+	mockRepo.EXPECT().GetSources(gomock.Any(), "ABCD").Return(map[string]int64{
+		"google": 100,
+		"direct": 100,
+	}, nil)
+	mockRepo.EXPECT().GetConversions(gomock.Any(), "ABCD").Return(map[string]int64{"google": 20}, nil)
+
+	svc := NewAnalyticsService(mockRepo, nil)
+	result, err := svc.GetAnalytics(context.Background(), "ABCD", false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20), result.Conversions)
+	assert.InDelta(t, 0.1, result.ConversionRate, 0.0001)
+	for _, source := range result.TopSources {
+		switch source.Source {
+		case "google":
+			assert.Equal(t, int64(20), source.Conversions)
+			assert.InDelta(t, 0.2, source.ConversionRate, 0.0001)
+		case "direct":
+			assert.Equal(t, int64(0), source.Conversions)
+			assert.Equal(t, float64(0), source.ConversionRate)
+		}
+	}
+}
+
+func TestAnalyticsService_GetAnalytics_Snapshots(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	updatedAt := time.Unix(1700000000, 0)
+	mockRepo := mocks.NewMockCache(ctrl)
+	mockRepo.EXPECT().GetStatsUpdatedAt(gomock.Any(), "ABCD").Return(updatedAt, nil).Times(2)
+	mockRepo.EXPECT().GetPV(gomock.Any(), "ABCD").Return(int64(10), nil)
+	mockRepo.EXPECT().GetPV(gomock.Any(), "ABCD").Return(int64(11), nil)
+	mockRepo.EXPECT().GetUV(gomock.Any(), "ABCD").Return(int64(5), nil).Times(2)
+	mockRepo.EXPECT().GetSources(gomock.Any(), "ABCD").Return(map[string]int64{}, nil).Times(2)
+	mockRepo.EXPECT().GetConversions(gomock.Any(), "ABCD").Return(map[string]int64{}, nil).Times(2)
+
+	svc := NewAnalyticsService(mockRepo, nil)
+	svc.SetSnapshots(NewAnalyticsSnapshots(&config.SnapshotConfig{TTL: time.Minute}))
+
+	result, err := svc.GetAnalytics(context.Background(), "ABCD", false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), result.PV)
+	assert.Equal(t, updatedAt, result.UpdatedAt)
+
+	// Served from the snapshot without reading Redis
+	result, err = svc.GetAnalytics(context.Background(), "ABCD", false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), result.PV)
+
+	// A fresh read bypasses the snapshot and replaces it
+	result, err = svc.GetAnalytics(context.Background(), "ABCD", true)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), result.PV)
+
+	result, err = svc.GetAnalytics(context.Background(), "ABCD", false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), result.PV)
+}
+
 func TestAnalyticsService_extractSource(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
-	svc := NewAnalyticsService(mockRepo)
+	mockRepo := mocks.NewMockCache(ctrl)
+	svc := NewAnalyticsService(mockRepo, nil)
 
 	tests := []struct {
 		name     string
@@ -387,6 +671,30 @@ func TestAnalyticsService_extractSource(t *testing.T) {
 			referer:  "https://blog.example.com",
 			expected: "example",
 		},
+		{name: "uppercase host", referer: "https://Blog.EXAMPLE.com/Path", expected: "example"},
+		{name: "port", referer: "https://example.com:8443/page", expected: "example"},
+		{name: "trailing dot", referer: "https://example.com./page", expected: "example"},
+		{name: "co.uk", referer: "https://news.bbc.co.uk/article", expected: "bbc"},
+		{name: "www co.uk", referer: "https://www.theguardian.co.uk", expected: "theguardian"},
+		{name: "com.cn", referer: "https://www.sina.com.cn/news", expected: "sina"},
+		{name: "com.au", referer: "https://www.abc.net.au/news", expected: "abc"},
+		{name: "co.jp", referer: "https://news.yahoo.co.jp/pickup", expected: "yahoo"},
+		{name: "com.br", referer: "https://www.globo.com.br", expected: "globo"},
+		{name: "gov.uk", referer: "https://www.ons.gov.uk/", expected: "ons"},
+		{name: "ac.jp", referer: "https://www.u-tokyo.ac.jp", expected: "u-tokyo"},
+		{name: "de", referer: "https://www.spiegel.de/politik", expected: "spiegel"},
+		{name: "multi-level subdomain", referer: "https://a.b.c.example.org", expected: "example"},
+		{name: "private suffix", referer: "https://octocat.github.io/blog", expected: "octocat"},
+		{name: "punycode", referer: "https://xn--fiqs8s.xn--fiqs8s.cn", expected: "xn--fiqs8s"},
+		{name: "known source on country domain", referer: "https://www.google.co.uk/search", expected: "google"},
+		{name: "known source on com.cn", referer: "https://m.baidu.com.cn/s", expected: "baidu"},
+		{name: "IPv4", referer: "http://192.168.1.10/page", expected: "192.168.1.10"},
+		{name: "IPv4 with port", referer: "http://10.0.0.1:8080/page", expected: "10.0.0.1"},
+		{name: "IPv6", referer: "http://[2001:db8::1]:8080/page", expected: "2001:db8::1"},
+		{name: "localhost", referer: "http://localhost:3000", expected: "localhost"},
+		{name: "bare public suffix", referer: "https://co.uk", expected: "co.uk"},
+		{name: "unlisted TLD", referer: "https://wiki.corp.internal", expected: "corp"},
+		{name: "no host", referer: "/relative/path", expected: "unknown"},
 	}
 
 	for _, tt := range tests {
@@ -401,8 +709,8 @@ func TestAnalyticsService_getTopSources(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mockRepo := mocks.NewMockRedisRepositoryInterface(ctrl)
-	svc := NewAnalyticsService(mockRepo)
+	mockRepo := mocks.NewMockCache(ctrl)
+	svc := NewAnalyticsService(mockRepo, nil)
 
 	tests := []struct {
 		name     string
@@ -461,3 +769,328 @@ func TestAnalyticsService_getTopSources(t *testing.T) {
 		})
 	}
 }
+
+func TestAnalyticsService_GetDecay(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time {
+		return time.Date(2024, 3, 1+n, 0, 0, 0, 0, time.UTC)
+	}
+
+	t.Run("link not found", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "NONE").Return(nil, repository.ErrNotFound)
+
+		svc := NewAnalyticsService(nil, mockMySQL)
+		_, err := svc.GetDecay(context.Background(), "NONE")
+		assert.ErrorIs(t, err, ErrShortLinkNotFound)
+	})
+
+	t.Run("distributes clicks over lifetime windows", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{
+			ShortCode: "ABCD",
+			CreatedAt: createdAt,
+		}, nil)
+		mockMySQL.EXPECT().GetDailyStats(gomock.Any(), "ABCD", day(0), gomock.Any()).Return([]model.DailyStat{
+			{ShortCode: "ABCD", Day: day(0), Clicks: 40},
+			{ShortCode: "ABCD", Day: day(2), Clicks: 30},
+			{ShortCode: "ABCD", Day: day(10), Clicks: 20},
+			{ShortCode: "ABCD", Day: day(100), Clicks: 10},
+		}, nil)
+		mockMySQL.EXPECT().CountAccessLogsBetween(gomock.Any(), "ABCD", createdAt, createdAt.Add(time.Hour)).Return(int64(25), nil)
+
+		svc := NewAnalyticsService(nil, mockMySQL)
+		decay, err := svc.GetDecay(context.Background(), "ABCD")
+		assert.NoError(t, err)
+
+		assert.Equal(t, int64(100), decay.TotalClicks)
+		assert.Equal(t, int64(25), decay.FirstHourClicks)
+		assert.Equal(t, 2, decay.HalfLifeDays)
+
+		clicks := make(map[string]int64)
+		for _, b := range decay.Buckets {
+			clicks[b.Label] = b.Clicks
+		}
+		assert.Equal(t, map[string]int64{
+			"day_1":         40,
+			"days_2_7":      30,
+			"days_8_30":     20,
+			"days_31_90":    0,
+			"after_90_days": 10,
+		}, clicks)
+		assert.InDelta(t, 0.4, decay.Buckets[0].Share, 0.0001)
+		assert.InDelta(t, 1.0, decay.Buckets[len(decay.Buckets)-1].Cumulative, 0.0001)
+	})
+
+	t.Run("link without clicks", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", CreatedAt: createdAt}, nil)
+		mockMySQL.EXPECT().GetDailyStats(gomock.Any(), "ABCD", gomock.Any(), gomock.Any()).Return(nil, nil)
+		mockMySQL.EXPECT().CountAccessLogsBetween(gomock.Any(), "ABCD", gomock.Any(), gomock.Any()).Return(int64(0), nil)
+
+		svc := NewAnalyticsService(nil, mockMySQL)
+		decay, err := svc.GetDecay(context.Background(), "ABCD")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), decay.TotalClicks)
+		assert.Equal(t, -1, decay.HalfLifeDays)
+		assert.Len(t, decay.Buckets, 5)
+	})
+}
+
+func TestAnalyticsService_CompareAnalytics(t *testing.T) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	day := func(ago int) time.Time { return today.AddDate(0, 0, -ago) }
+
+	t.Run("short link not found", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "NONE").Return(nil, repository.ErrNotFound)
+
+		svc := NewAnalyticsService(nil, mockMySQL)
+		_, err := svc.CompareAnalytics(context.Background(), "NONE", 7)
+		assert.ErrorIs(t, err, ErrShortLinkNotFound)
+	})
+
+	t.Run("compares the last days with the days before", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD"}, nil)
+		mockMySQL.EXPECT().GetDailyStats(gomock.Any(), "ABCD", day(13), day(0)).Return([]model.DailyStat{
+			{ShortCode: "ABCD", Day: day(13), Clicks: 5, Visitors: 4},
+			{ShortCode: "ABCD", Day: day(7), Clicks: 15, Visitors: 6},
+			{ShortCode: "ABCD", Day: day(6), Clicks: 20, Visitors: 10},
+			{ShortCode: "ABCD", Day: day(0), Clicks: 10, Visitors: 5},
+		}, nil)
+		mockMySQL.EXPECT().GetDailySourceStats(gomock.Any(), "ABCD", day(13), day(0)).Return([]model.DailySourceStat{
+			{ShortCode: "ABCD", Day: day(7), Source: "google", Clicks: 20},
+			{ShortCode: "ABCD", Day: day(6), Source: "google", Clicks: 25},
+			{ShortCode: "ABCD", Day: day(6), Source: "direct", Clicks: 5},
+			{ShortCode: "ABCD", Day: day(8), Source: "baidu", Clicks: 4},
+		}, nil)
+
+		svc := NewAnalyticsService(nil, mockMySQL)
+		compare, err := svc.CompareAnalytics(context.Background(), "ABCD", 7)
+		assert.NoError(t, err)
+
+		assert.Equal(t, model.Period{From: day(6), To: day(0)}, compare.Current)
+		assert.Equal(t, model.Period{From: day(13), To: day(7)}, compare.Previous)
+
+		assert.Equal(t, int64(30), compare.PV.Current)
+		assert.Equal(t, int64(20), compare.PV.Previous)
+		assert.Equal(t, int64(10), compare.PV.Delta)
+		assert.Equal(t, 50.0, *compare.PV.ChangePercent)
+		assert.Equal(t, int64(15), compare.UV.Current)
+		assert.Equal(t, 50.0, *compare.UV.ChangePercent)
+
+		assert.Len(t, compare.Sources, 3)
+		assert.Equal(t, "google", compare.Sources[0].Source)
+		assert.Equal(t, 25.0, *compare.Sources[0].ChangePercent)
+		assert.Equal(t, "direct", compare.Sources[1].Source)
+		assert.Nil(t, compare.Sources[1].ChangePercent)
+		assert.Equal(t, "baidu", compare.Sources[2].Source)
+		assert.Equal(t, int64(-4), compare.Sources[2].Delta)
+		assert.Equal(t, -100.0, *compare.Sources[2].ChangePercent)
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD"}, nil)
+		mockMySQL.EXPECT().GetDailyStats(gomock.Any(), "ABCD", gomock.Any(), gomock.Any()).Return(nil, errors.New("db error"))
+
+		svc := NewAnalyticsService(nil, mockMySQL)
+		_, err := svc.CompareAnalytics(context.Background(), "ABCD", 7)
+		assert.Error(t, err)
+	})
+}
+
+func TestAnalyticsService_GetSourcesDaily(t *testing.T) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	day := func(ago int) time.Time { return today.AddDate(0, 0, -ago) }
+
+	t.Run("short link not found", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "NONE").Return(nil, repository.ErrNotFound)
+
+		svc := NewAnalyticsService(nil, mockMySQL)
+		_, err := svc.GetSourcesDaily(context.Background(), "NONE", 3)
+		assert.ErrorIs(t, err, ErrShortLinkNotFound)
+	})
+
+	t.Run("lays out sources by day", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD"}, nil)
+		mockMySQL.EXPECT().GetDailySourceStats(gomock.Any(), "ABCD", day(2), day(0)).Return([]model.DailySourceStat{
+			{ShortCode: "ABCD", Day: day(2), Source: "direct", Clicks: 4},
+			{ShortCode: "ABCD", Day: day(2), Source: "google", Clicks: 1},
+			{ShortCode: "ABCD", Day: day(0), Source: "google", Clicks: 6},
+			{ShortCode: "ABCD", Day: day(0), Source: "twitter", Clicks: 4},
+		}, nil)
+
+		svc := NewAnalyticsService(nil, mockMySQL)
+		resp, err := svc.GetSourcesDaily(context.Background(), "ABCD", 3)
+		assert.NoError(t, err)
+
+		assert.Equal(t, model.Period{From: day(2), To: day(0)}, resp.Period)
+		assert.Equal(t, []string{model.StatsDay(day(2)), model.StatsDay(day(1)), model.StatsDay(day(0))}, resp.Days)
+		assert.Equal(t, []model.SourceDailyClicks{
+			{Source: "google", Total: 7, Clicks: []int64{1, 0, 6}},
+			{Source: "direct", Total: 4, Clicks: []int64{4, 0, 0}},
+			{Source: "twitter", Total: 4, Clicks: []int64{0, 0, 4}},
+		}, resp.Sources)
+		assert.Equal(t, int64(6), resp.Max)
+	})
+
+	t.Run("no clicks", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD"}, nil)
+		mockMySQL.EXPECT().GetDailySourceStats(gomock.Any(), "ABCD", day(29), day(0)).Return(nil, nil)
+
+		svc := NewAnalyticsService(nil, mockMySQL)
+		resp, err := svc.GetSourcesDaily(context.Background(), "ABCD", 30)
+		assert.NoError(t, err)
+		assert.Len(t, resp.Days, 30)
+		assert.Empty(t, resp.Sources)
+		assert.NotNil(t, resp.Sources)
+	})
+}
+
+func TestAnalyticsService_GetAccessLogs(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("returns next cursor when more logs exist", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockMySQL.EXPECT().GetAccessLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, q *model.AccessLogQuery) ([]model.AccessLog, error) {
+				assert.Equal(t, 3, q.Limit)
+				return []model.AccessLog{
+					{ID: 3, ShortCode: "ABCD", AccessTime: now},
+					{ID: 2, ShortCode: "ABCD", AccessTime: now.Add(-time.Minute)},
+					{ID: 1, ShortCode: "ABCD", AccessTime: now.Add(-2 * time.Minute)},
+				}, nil
+			})
+
+		svc := NewAnalyticsService(nil, mockMySQL)
+		page, err := svc.GetAccessLogs(context.Background(), &model.AccessLogQuery{ShortCode: "ABCD", Limit: 2})
+		assert.NoError(t, err)
+		assert.Len(t, page.Logs, 2)
+
+		cursor, err := model.DecodeAccessLogCursor(page.NextCursor)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), cursor.ID)
+		assert.True(t, now.Add(-time.Minute).Equal(cursor.AccessTime))
+	})
+
+	t.Run("last page has no cursor", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockMySQL.EXPECT().GetAccessLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, q *model.AccessLogQuery) ([]model.AccessLog, error) {
+				assert.Equal(t, defaultAccessLogLimit+1, q.Limit)
+				return nil, nil
+			})
+
+		svc := NewAnalyticsService(nil, mockMySQL)
+		page, err := svc.GetAccessLogs(context.Background(), &model.AccessLogQuery{ShortCode: "ABCD"})
+		assert.NoError(t, err)
+		assert.Empty(t, page.Logs)
+		assert.NotNil(t, page.Logs)
+		assert.Empty(t, page.NextCursor)
+	})
+
+	t.Run("caps page size", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockMySQL.EXPECT().GetAccessLogs(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, q *model.AccessLogQuery) ([]model.AccessLog, error) {
+				assert.Equal(t, maxAccessLogLimit+1, q.Limit)
+				return nil, nil
+			})
+
+		svc := NewAnalyticsService(nil, mockMySQL)
+		_, err := svc.GetAccessLogs(context.Background(), &model.AccessLogQuery{ShortCode: "ABCD", Limit: 10000})
+		assert.NoError(t, err)
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockMySQL.EXPECT().GetAccessLogs(gomock.Any(), gomock.Any()).Return(nil, errors.New("db error"))
+
+		svc := NewAnalyticsService(nil, mockMySQL)
+		_, err := svc.GetAccessLogs(context.Background(), &model.AccessLogQuery{ShortCode: "ABCD"})
+		assert.Error(t, err)
+	})
+}
+
+func TestAnalyticsService_GetRealtime(t *testing.T) {
+	t.Run("short link not found", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "NONE").Return(nil, repository.ErrNotFound)
+
+		svc := NewAnalyticsService(nil, mockMySQL)
+		_, err := svc.GetRealtime(context.Background(), "NONE")
+		assert.ErrorIs(t, err, ErrShortLinkNotFound)
+	})
+
+	t.Run("sums the last hour", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		now := time.Date(2026, 10, 16, 12, 30, 45, 0, time.UTC)
+		clicks := make([]int64, repository.MinuteClicksWindow)
+		clicks[0], clicks[58], clicks[59] = 2, 7, 3
+
+		mockRedis := mocks.NewMockCache(ctrl)
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD"}, nil)
+		mockRedis.EXPECT().GetMinuteClicks(gomock.Any(), "ABCD", now).Return(clicks, nil)
+
+		svc := NewAnalyticsService(mockRedis, mockMySQL)
+		svc.clock = clock.NewFake(now)
+		resp, err := svc.GetRealtime(context.Background(), "ABCD")
+		assert.NoError(t, err)
+
+		// The ring ends with the current minute
+		assert.Equal(t, time.Date(2026, 10, 16, 11, 31, 0, 0, time.UTC), resp.From)
+		assert.Len(t, resp.Clicks, repository.MinuteClicksWindow)
+		assert.Equal(t, int64(12), resp.Total)
+		assert.Equal(t, int64(7), resp.Max)
+	})
+}
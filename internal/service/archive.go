@@ -0,0 +1,212 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/pkg/clock"
+	"octopus/pkg/objstore"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// AccessArchiveService exports the stored access events to object storage for long-term retention,
+// so MySQL only keeps the recent ones. Events are buffered and written in the background as gzipped
+// NDJSON objects under "<prefix>/dt=<day>/short_code=<code>/", the Hive partitions Athena and Spark
+// prune queries by.
+type AccessArchiveService struct {
+	store    objstore.Uploader
+	cfg      *config.ArchiveConfig
+	clock    clock.Clock
+	mu       sync.Mutex
+	pending  []model.AccessEvent
+	flushing sync.Mutex
+	full     chan struct{}
+	archived atomic.Int64
+	objects  atomic.Int64
+	failed   atomic.Int64
+	dropped  atomic.Int64
+	last     time.Time
+	lastErr  string
+}
+
+// NewAccessArchiveService creates a new Access Archive Service writing to store
+func NewAccessArchiveService(store objstore.Uploader, cfg *config.ArchiveConfig) *AccessArchiveService {
+	return &AccessArchiveService{
+		store: store,
+		cfg:   cfg,
+		clock: clock.Real,
+		full:  make(chan struct{}, 1),
+	}
+}
+
+// Add buffers a stored access log for the next flush, dropping it when the buffer is full
+func (as *AccessArchiveService) Add(accessLog *model.AccessLog) {
+	as.mu.Lock()
+	if len(as.pending) >= as.cfg.BufferSize {
+		as.mu.Unlock()
+		as.dropped.Add(1)
+		log.Warn().Str("short_code", accessLog.ShortCode).Msg("Access archive buffer full, dropping event")
+		return
+	}
+	as.pending = append(as.pending, model.NewAccessEvent(accessLog))
+	full := len(as.pending) >= as.cfg.BatchSize
+	as.mu.Unlock()
+
+	// Flush early instead of waiting for the interval when many events come in
+	if full {
+		select {
+		case as.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run flushes the buffered events every flush interval, or once a batch is buffered, until ctx is
+// done. The events left are flushed by Close.
+func (as *AccessArchiveService) Run(ctx context.Context) {
+	ticker := time.NewTicker(as.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-as.full:
+		}
+		if err := as.Flush(ctx); err != nil {
+			log.Error().Err(err).Str("bucket", as.cfg.Bucket).Msg("Failed to archive access events")
+		}
+	}
+}
+
+// Close flushes the events left once no more come in
+func (as *AccessArchiveService) Close(ctx context.Context) error {
+	return as.Flush(ctx)
+}
+
+// Flush writes the buffered events, one object per day and short code. The events of a failed write
+// and of the objects after it are buffered again for the next flush.
+func (as *AccessArchiveService) Flush(ctx context.Context) error {
+	as.flushing.Lock()
+	defer as.flushing.Unlock()
+
+	as.mu.Lock()
+	pending := as.pending
+	as.pending = nil
+	as.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	partitions := make(map[string][]model.AccessEvent)
+	for _, event := range pending {
+		partition := archivePartition(event)
+		partitions[partition] = append(partitions[partition], event)
+	}
+	keys := make([]string, 0, len(partitions))
+	for partition := range partitions {
+		keys = append(keys, partition)
+	}
+	sort.Strings(keys)
+
+	now := as.clock.Now().UTC()
+	var err error
+	var unwritten []model.AccessEvent
+	for _, partition := range keys {
+		events := partitions[partition]
+		if err == nil {
+			err = as.write(ctx, as.objectKey(partition, now), events)
+		}
+		if err != nil {
+			unwritten = append(unwritten, events...)
+			continue
+		}
+		as.archived.Add(int64(len(events)))
+		as.objects.Add(1)
+	}
+
+	as.mu.Lock()
+	as.last = now
+	as.lastErr = ""
+	if err != nil {
+		as.lastErr = err.Error()
+		as.failed.Add(1)
+		// Buffered again ahead of the events added meanwhile, as many as the buffer holds
+		keep := min(len(unwritten), max(as.cfg.BufferSize-len(as.pending), 0))
+		as.dropped.Add(int64(len(unwritten) - keep))
+		as.pending = append(unwritten[:keep:keep], as.pending...)
+	}
+	as.mu.Unlock()
+
+	return err
+}
+
+// write writes the events of a partition as a gzipped NDJSON object
+func (as *AccessArchiveService) write(ctx context.Context, key string, events []model.AccessEvent) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for i := range events {
+		if err := enc.Encode(&events[i]); err != nil {
+			return fmt.Errorf("failed to encode access event: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress access events: %w", err)
+	}
+
+	if err := as.store.Put(ctx, key, buf.Bytes(), "application/x-ndjson", "gzip"); err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return nil
+}
+
+// objectKey returns the key of an object of a partition written at now, unique across flushes and
+// instances
+func (as *AccessArchiveService) objectKey(partition string, now time.Time) string {
+	name := partition + "/" + now.Format("20060102T150405Z") + "-" + uuid.NewString() + ".ndjson.gz"
+	if prefix := strings.Trim(as.cfg.Prefix, "/"); prefix != "" {
+		return prefix + "/" + name
+	}
+	return name
+}
+
+// Stats reports the events buffered and archived
+func (as *AccessArchiveService) Stats() *model.AccessArchiveStats {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	stats := &model.AccessArchiveStats{
+		Bucket:    as.cfg.Bucket,
+		Buffered:  len(as.pending),
+		Archived:  as.archived.Load(),
+		Objects:   as.objects.Load(),
+		Failed:    as.failed.Load(),
+		Dropped:   as.dropped.Load(),
+		LastError: as.lastErr,
+	}
+	if !as.last.IsZero() {
+		last := as.last
+		stats.LastFlush = &last
+	}
+	return stats
+}
+
+// archivePartition returns the partition of an event, its UTC access day and short code
+func archivePartition(event model.AccessEvent) string {
+	return "dt=" + event.AccessTime.UTC().Format(time.DateOnly) + "/short_code=" + event.ShortCode
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/pkg/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeObjectStore keeps the objects written to it, failing writes with the queued errors until
+// they run out
+type fakeObjectStore struct {
+	errs    []error
+	objects map[string][]byte
+}
+
+func (s *fakeObjectStore) Put(_ context.Context, key string, body []byte, contentType, contentEncoding string) error {
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+	if s.objects == nil {
+		s.objects = make(map[string][]byte)
+	}
+	s.objects[key] = body
+	return nil
+}
+
+// events decodes the events of the objects written under a partition
+func (s *fakeObjectStore) events(t *testing.T, partition string) []model.AccessEvent {
+	var events []model.AccessEvent
+	for key, body := range s.objects {
+		if !strings.Contains(key, "/"+partition+"/") {
+			continue
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		scanner := bufio.NewScanner(zr)
+		for scanner.Scan() {
+			var event model.AccessEvent
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+			events = append(events, event)
+		}
+		require.NoError(t, scanner.Err())
+	}
+	return events
+}
+
+func newTestAccessArchiveService(store *fakeObjectStore, bufferSize int) *AccessArchiveService {
+	as := NewAccessArchiveService(store, &config.ArchiveConfig{
+		Bucket:        "events",
+		Prefix:        "/access-events/",
+		FlushInterval: time.Minute,
+		BatchSize:     2,
+		BufferSize:    bufferSize,
+	})
+	as.clock = clock.NewFake(time.Date(2026, 10, 16, 12, 30, 0, 0, time.UTC))
+	return as
+}
+
+func testAccessLog(shortCode string, accessTime time.Time) *model.AccessLog {
+	eventID := shortCode + accessTime.Format(time.RFC3339)
+	return &model.AccessLog{EventID: &eventID, ShortCode: shortCode, Source: "direct", AccessTime: accessTime}
+}
+
+func TestAccessArchiveService_Flush(t *testing.T) {
+	store := &fakeObjectStore{}
+	as := newTestAccessArchiveService(store, 10)
+	day := time.Date(2026, 10, 15, 23, 0, 0, 0, time.UTC)
+
+	as.Add(testAccessLog("ABCD", day))
+	as.Add(testAccessLog("ABCD", day.Add(30*time.Minute)))
+	as.Add(testAccessLog("ABCD", day.Add(2*time.Hour)))
+	as.Add(testAccessLog("EFGH", day))
+	require.NoError(t, as.Flush(context.Background()))
+
+	// One object per day and short code
+	require.Len(t, store.objects, 3)
+	for key := range store.objects {
+		assert.True(t, strings.HasPrefix(key, "access-events/dt=2026-10-1"), key)
+		assert.Contains(t, key, "/20261016T123000Z-")
+		assert.True(t, strings.HasSuffix(key, ".ndjson.gz"), key)
+	}
+	events := store.events(t, "dt=2026-10-15/short_code=ABCD")
+	require.Len(t, events, 2)
+	assert.Equal(t, "ABCD2026-10-15T23:00:00Z", events[0].EventID)
+	assert.Equal(t, "direct", events[0].Source)
+	assert.Len(t, store.events(t, "dt=2026-10-16/short_code=ABCD"), 1)
+	assert.Len(t, store.events(t, "dt=2026-10-15/short_code=EFGH"), 1)
+
+	stats := as.Stats()
+	assert.Equal(t, 0, stats.Buffered)
+	assert.Equal(t, int64(4), stats.Archived)
+	assert.Equal(t, int64(3), stats.Objects)
+	require.NotNil(t, stats.LastFlush)
+
+	// Nothing buffered, nothing written
+	require.NoError(t, as.Flush(context.Background()))
+	assert.Len(t, store.objects, 3)
+}
+
+func TestAccessArchiveService_FlushFailure(t *testing.T) {
+	store := &fakeObjectStore{errs: []error{errors.New("connection reset")}}
+	as := newTestAccessArchiveService(store, 3)
+	day := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+
+	as.Add(testAccessLog("ABCD", day))
+	as.Add(testAccessLog("EFGH", day))
+	assert.Error(t, as.Flush(context.Background()))
+
+	// The failed write and the ones after it are retried on the next flush
+	stats := as.Stats()
+	assert.Equal(t, 2, stats.Buffered)
+	assert.Equal(t, int64(1), stats.Failed)
+	assert.Contains(t, stats.LastError, "connection reset")
+	assert.Empty(t, store.objects)
+
+	require.NoError(t, as.Flush(context.Background()))
+	stats = as.Stats()
+	assert.Equal(t, int64(2), stats.Archived)
+	assert.Empty(t, stats.LastError)
+	assert.Len(t, store.objects, 2)
+}
+
+func TestAccessArchiveService_Add(t *testing.T) {
+	as := newTestAccessArchiveService(&fakeObjectStore{}, 3)
+	day := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+
+	as.Add(testAccessLog("ABCD", day))
+	select {
+	case <-as.full:
+		t.Fatal("flushed before a batch was buffered")
+	default:
+	}
+
+	as.Add(testAccessLog("ABCD", day))
+	select {
+	case <-as.full:
+	default:
+		t.Fatal("not flushed once a batch was buffered")
+	}
+
+	as.Add(testAccessLog("ABCD", day))
+	as.Add(testAccessLog("ABCD", day))
+	stats := as.Stats()
+	assert.Equal(t, 3, stats.Buffered)
+	assert.Equal(t, int64(1), stats.Dropped)
+}
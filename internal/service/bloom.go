@@ -14,6 +14,8 @@ import (
 // BloomService handles Bloom Filter operations
 type BloomService struct {
 	client    RedisClient
+	key       string
+	cuckoo    bool
 	capacity  int64
 	errorRate float64
 }
@@ -28,8 +30,15 @@ type RedisClient interface {
 
 // NewBloomService creates a new Bloom Service
 func NewBloomService(client RedisClient, cfg *config.BloomConfig) *BloomService {
+	key := cfg.Key
+	if key == "" {
+		key = bloomFilterKey
+	}
+
 	bs := &BloomService{
 		client:    client,
+		key:       key,
+		cuckoo:    cfg.Type == FilterTypeCuckoo,
 		capacity:  cfg.Capacity,
 		errorRate: cfg.ErrorRate,
 	}
@@ -40,12 +49,28 @@ func NewBloomService(client RedisClient, cfg *config.BloomConfig) *BloomService
 	return bs
 }
 
+// bloomFilterKey is the default key of the Bloom Filter
 const bloomFilterKey = "shortlink:bloom"
 
+const (
+	// FilterTypeBloom is the default filter type, items can never be removed
+	FilterTypeBloom = "bloom"
+	// FilterTypeCuckoo is a Cuckoo Filter, which supports deleting items for code recycling
+	FilterTypeCuckoo = "cuckoo"
+)
+
+// command returns the RedisBloom command for the configured filter type
+func (bs *BloomService) command(op string) string {
+	if bs.cuckoo {
+		return "CF." + op
+	}
+	return "BF." + op
+}
+
 // initBloomFilter initializes the Bloom Filter
 func (bs *BloomService) initBloomFilter(ctx context.Context) {
 	// Check if Bloom Filter exists
-	exists, err := bs.client.Exists(ctx, bloomFilterKey).Result()
+	exists, err := bs.client.Exists(ctx, bs.key).Result()
 	if err != nil {
 		log.Warn().Err(err).Msg("Failed to check Bloom Filter existence")
 		return
@@ -57,10 +82,15 @@ func (bs *BloomService) initBloomFilter(ctx context.Context) {
 	}
 
 	// Create Bloom Filter
-	cmd := bs.client.Do(ctx, "BF.RESERVE", bloomFilterKey, bs.errorRate, bs.capacity)
+	var cmd *redis.Cmd
+	if bs.cuckoo {
+		cmd = bs.client.Do(ctx, "CF.RESERVE", bs.key, bs.capacity)
+	} else {
+		cmd = bs.client.Do(ctx, "BF.RESERVE", bs.key, bs.errorRate, bs.capacity)
+	}
 	if err := cmd.Err(); err != nil {
 		// BF.RESERVE may not be available, use BF.ADD instead
-		log.Warn().Err(err).Msg("BF.RESERVE not available, using dynamic Bloom Filter")
+		log.Warn().Err(err).Msgf("%s not available, using dynamic filter", bs.command("RESERVE"))
 	} else {
 		log.Info().Msgf("Bloom Filter created with capacity=%d, error_rate=%f", bs.capacity, bs.errorRate)
 	}
@@ -68,11 +98,15 @@ func (bs *BloomService) initBloomFilter(ctx context.Context) {
 
 // Add adds a short code to the Bloom Filter
 func (bs *BloomService) Add(ctx context.Context, shortCode string) error {
-	// Try BF.ADD first (RedisBloom module)
-	cmd := bs.client.Do(ctx, "BF.ADD", bloomFilterKey, shortCode)
+	// Try BF.ADD first (RedisBloom module), Cuckoo Filters must not hold duplicates
+	op := "ADD"
+	if bs.cuckoo {
+		op = "ADDNX"
+	}
+	cmd := bs.client.Do(ctx, bs.command(op), bs.key, shortCode)
 	if err := cmd.Err(); err != nil {
 		// Fallback to regular SET if Bloom Filter not available
-		log.Warn().Err(err).Msg("BF.ADD not available, using SET as fallback")
+		log.Warn().Err(err).Msgf("%s not available, using SET as fallback", bs.command(op))
 		key := bs.fallbackKey(shortCode)
 		return bs.client.Set(ctx, key, 1, 0).Err()
 	}
@@ -82,14 +116,14 @@ func (bs *BloomService) Add(ctx context.Context, shortCode string) error {
 // Exists checks if a short code might exist in the Bloom Filter
 func (bs *BloomService) Exists(ctx context.Context, shortCode string) (bool, error) {
 	// Try BF.EXISTS first
-	cmd := bs.client.Do(ctx, "BF.EXISTS", bloomFilterKey, shortCode)
+	cmd := bs.client.Do(ctx, bs.command("EXISTS"), bs.key, shortCode)
 	result, err := cmd.Int()
 	if err == nil {
 		return result == 1, nil
 	}
 
 	// Fallback to regular GET if Bloom Filter not available
-	log.Warn().Err(err).Msg("BF.EXISTS not available, using GET as fallback")
+	log.Warn().Err(err).Msgf("%s not available, using GET as fallback", bs.command("EXISTS"))
 	key := bs.fallbackKey(shortCode)
 	exists, err := bs.client.Exists(ctx, key).Result()
 	if err != nil {
@@ -98,9 +132,28 @@ func (bs *BloomService) Exists(ctx context.Context, shortCode string) (bool, err
 	return exists > 0, nil
 }
 
+// Delete removes a short code from the filter, only Cuckoo Filters support removal
+func (bs *BloomService) Delete(ctx context.Context, shortCode string) error {
+	if bs.cuckoo {
+		err := bs.client.Do(ctx, "CF.DEL", bs.key, shortCode).Err()
+		if err == nil {
+			return nil
+		}
+		log.Warn().Err(err).Msg("CF.DEL not available, using DEL as fallback")
+	}
+
+	// Bloom Filters cannot forget items, only the fallback key can be removed
+	return bs.client.Del(ctx, bs.fallbackKey(shortCode)).Err()
+}
+
+// SupportsDelete reports whether codes can be removed from the filter
+func (bs *BloomService) SupportsDelete() bool {
+	return bs.cuckoo
+}
+
 // Fallback key when Bloom Filter is not available
 func (bs *BloomService) fallbackKey(shortCode string) string {
-	return fmt.Sprintf("shortlink:bloom:fb:%s", shortCode)
+	return fmt.Sprintf("%s:fb:%s", bs.key, shortCode)
 }
 
 // GetCapacity returns the capacity of the Bloom Filter
@@ -110,7 +163,7 @@ func (bs *BloomService) GetCapacity() int64 {
 
 // IsAvailable checks if Bloom Filter is available
 func (bs *BloomService) IsAvailable(ctx context.Context) bool {
-	cmd := bs.client.Do(ctx, "BF.INFO", bloomFilterKey)
+	cmd := bs.client.Do(ctx, bs.command("INFO"), bs.key)
 	if cmd.Err() != nil {
 		return false
 	}
@@ -119,5 +172,5 @@ func (bs *BloomService) IsAvailable(ctx context.Context) bool {
 
 // Reset resets the Bloom Filter (use with caution)
 func (bs *BloomService) Reset(ctx context.Context) error {
-	return bs.client.Del(ctx, bloomFilterKey).Err()
+	return bs.client.Del(ctx, bs.key).Err()
 }
@@ -329,3 +329,57 @@ func TestBloomService_ContextCancellation(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestBloomService_Delete(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+
+	t.Run("bloom filter only removes the fallback key", func(t *testing.T) {
+		svc := NewBloomService(client, &config.BloomConfig{
+			Capacity:  1000000,
+			ErrorRate: 0.01,
+		})
+		assert.False(t, svc.SupportsDelete())
+
+		require.NoError(t, svc.Add(context.Background(), "ABCD"))
+		require.NoError(t, svc.Delete(context.Background(), "ABCD"))
+
+		exists, err := svc.Exists(context.Background(), "ABCD")
+		assert.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("cuckoo filter deletes with CF.DEL", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockClient := mocks.NewMockRedisClient(ctrl)
+		mockClient.EXPECT().Exists(gomock.Any(), "shortlink:bloom").Return(redis.NewIntCmd(context.Background()))
+		mockClient.EXPECT().Do(gomock.Any(), "CF.RESERVE", "shortlink:bloom", int64(1000000)).Return(redis.NewCmd(context.Background()))
+		mockClient.EXPECT().Do(gomock.Any(), "CF.DEL", "shortlink:bloom", "ABCD").Return(redis.NewCmd(context.Background()))
+
+		svc := NewBloomService(mockClient, &config.BloomConfig{
+			Type:      FilterTypeCuckoo,
+			Capacity:  1000000,
+			ErrorRate: 0.01,
+		})
+		assert.True(t, svc.SupportsDelete())
+		assert.NoError(t, svc.Delete(context.Background(), "ABCD"))
+	})
+
+	t.Run("cuckoo filter adds without duplicates", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockClient := mocks.NewMockRedisClient(ctrl)
+		mockClient.EXPECT().Exists(gomock.Any(), "shortlink:bloom").Return(redis.NewIntCmd(context.Background()))
+		mockClient.EXPECT().Do(gomock.Any(), "CF.RESERVE", "shortlink:bloom", int64(1000000)).Return(redis.NewCmd(context.Background()))
+		mockClient.EXPECT().Do(gomock.Any(), "CF.ADDNX", "shortlink:bloom", "ABCD").Return(redis.NewCmd(context.Background()))
+
+		svc := NewBloomService(mockClient, &config.BloomConfig{
+			Type:     FilterTypeCuckoo,
+			Capacity: 1000000,
+		})
+		assert.NoError(t, svc.Add(context.Background(), "ABCD"))
+	})
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"octopus/internal/model"
+	"octopus/internal/mq"
+	"octopus/internal/repository"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrInvalidSelector is returned when a bulk change selects links by neither or both of short
+// codes and campaign
+var ErrInvalidSelector = errors.New("select links by either short_codes or campaign")
+
+// BulkUpdateStatus disables or enables again the links a request selects in one transaction, then
+// drops them from the cache and publishes their change
+func (s *ShortLinkService) BulkUpdateStatus(ctx context.Context, req *model.BulkStatusRequest) (*model.BulkResponse, error) {
+	if s.readOnly {
+		return nil, ErrReadOnlyReplica
+	}
+	filter, err := s.linkFilter(ctx, &req.BulkSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	status := 1
+	if req.Status == model.BulkStatusDisabled {
+		status = 0
+	}
+	links, err := s.mysqlRepo.SetShortLinksStatus(ctx, filter, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set short links %s: %w", req.Status, err)
+	}
+
+	resp := s.fanOutBulk(ctx, links)
+	log.Info().Str("status", req.Status).Int("updated", len(resp.Updated)).Msg("Changed the status of short links in bulk")
+	return resp, nil
+}
+
+// BulkUpdateExpiry sets when the links a request selects expire in one transaction, then drops them
+// from the cache and publishes their change
+func (s *ShortLinkService) BulkUpdateExpiry(ctx context.Context, req *model.BulkExpireRequest) (*model.BulkResponse, error) {
+	if s.readOnly {
+		return nil, ErrReadOnlyReplica
+	}
+	filter, err := s.linkFilter(ctx, &req.BulkSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	var expireAt *time.Time
+	if req.ExpireAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ExpireAt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidExpireAt, err)
+		}
+		expireAt = &t
+	}
+	links, err := s.mysqlRepo.SetShortLinksExpiry(ctx, filter, expireAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set short links expiry: %w", err)
+	}
+
+	// Click limits expire with their links, they follow the new expiry
+	for i := range links {
+		if links[i].MaxClicks > 0 && expireAt != nil {
+			s.setClickLimit(ctx, &links[i])
+		}
+	}
+
+	resp := s.fanOutBulk(ctx, links)
+	log.Info().Int("updated", len(resp.Updated)).Msg("Changed the expiry of short links in bulk")
+	return resp, nil
+}
+
+// Extend pushes the expiry of a link back by the given duration, counting from now for a link
+// already expired. Links that never expire cannot be extended.
+func (s *ShortLinkService) Extend(ctx context.Context, shortCode string, by time.Duration) (*model.ExtendResponse, error) {
+	if s.readOnly {
+		return nil, ErrReadOnlyReplica
+	}
+	sl, err := s.mysqlRepo.GetShortLinkByCode(ctx, shortCode)
+	if err != nil {
+		return nil, linkError(err)
+	}
+	if sl.ExpireAt == nil {
+		return nil, fmt.Errorf("%w: link never expires", repository.ErrConflict)
+	}
+
+	from := s.clock.Now()
+	if sl.ExpireAt.After(from) {
+		from = *sl.ExpireAt
+	}
+	expireAt := from.Add(by).UTC().Truncate(time.Second)
+	links, err := s.mysqlRepo.SetShortLinksExpiry(ctx, &model.LinkFilter{ShortCodes: []string{shortCode}}, &expireAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extend short link: %w", err)
+	}
+	for i := range links {
+		if links[i].MaxClicks > 0 {
+			s.setClickLimit(ctx, &links[i])
+		}
+	}
+	s.fanOutBulk(ctx, links)
+
+	log.Info().Str("short_code", shortCode).Time("expire_at", expireAt).Msg("Extended short link")
+	return &model.ExtendResponse{ShortCode: shortCode, ExpireAt: expireAt}, nil
+}
+
+// linkFilter builds the storage filter of the links a bulk change selects. With claims, only the
+// links of the caller are selected, whatever short codes or campaign it names.
+func (s *ShortLinkService) linkFilter(ctx context.Context, selector *model.BulkSelector) (*model.LinkFilter, error) {
+	if (len(selector.ShortCodes) == 0) == (selector.Campaign == "") {
+		return nil, ErrInvalidSelector
+	}
+	filter := &model.LinkFilter{ShortCodes: selector.ShortCodes}
+	if len(selector.ShortCodes) == 0 {
+		filter = &model.LinkFilter{Param: s.campaign, Value: selector.Campaign}
+	}
+	if s.claims != nil {
+		if filter.Owner = s.claims.Owner(ctx); filter.Owner == "" {
+			return nil, ErrClaimUnauthenticated
+		}
+	}
+	return filter, nil
+}
+
+// fanOutBulk drops the links a bulk change updated from the cache and publishes their change, so
+// the CDN edge and the replicas follow. Disabled links are published as deleted, replicas keeping
+// them disabled.
+func (s *ShortLinkService) fanOutBulk(ctx context.Context, links []model.ShortLink) *model.BulkResponse {
+	resp := &model.BulkResponse{Updated: make([]string, 0, len(links))}
+	for i := range links {
+		sl := &links[i]
+		s.dropCached(ctx, sl.ShortCode)
+		eventType := mq.EventTypeLinkUpdated
+		if sl.Status == 0 {
+			eventType = mq.EventTypeLinkDeleted
+		}
+		s.publishLinkEvent(ctx, eventType, sl)
+		resp.Updated = append(resp.Updated, sl.ShortCode)
+	}
+	return resp
+}
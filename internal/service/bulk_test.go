@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/mq"
+	"octopus/internal/repository"
+	"octopus/pkg/clock"
+	"octopus/pkg/middleware"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortLinkService_BulkUpdateStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	mockPublisher := mocks.NewMockProducerInterface(ctrl)
+	svc := NewShortLinkService(mockMySQL, mockRedis, mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+	svc.SetEventPublisher(mockPublisher)
+	svc.SetCampaignParam("utm_campaign")
+
+	mockMySQL.EXPECT().SetShortLinksStatus(gomock.Any(), &model.LinkFilter{Param: "utm_campaign", Value: "spring"}, 0).
+		Return([]model.ShortLink{{ShortCode: "ABCD"}, {ShortCode: "EFGH"}}, nil)
+	mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "ABCD").Return(nil)
+	mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "EFGH").Return(nil)
+	var events []string
+	mockPublisher.EXPECT().SendLinkEvent(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msg *mq.LinkEventMessage) error {
+		events = append(events, msg.Type+":"+msg.ShortCode)
+		return nil
+	}).Times(2)
+
+	resp, err := svc.BulkUpdateStatus(context.Background(), &model.BulkStatusRequest{
+		BulkSelector: model.BulkSelector{Campaign: "spring"},
+		Status:       model.BulkStatusDisabled,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ABCD", "EFGH"}, resp.Updated)
+	// Replicas keep the links disabled
+	assert.Equal(t, []string{"link_deleted:ABCD", "link_deleted:EFGH"}, events)
+
+	// Links are selected one way or the other
+	_, err = svc.BulkUpdateStatus(context.Background(), &model.BulkStatusRequest{Status: model.BulkStatusActive})
+	assert.ErrorIs(t, err, ErrInvalidSelector)
+
+	// In self-serve mode, only the links of the caller are changed
+	svc.SetClaims(newTestClaims(t, repository.NewMemoryRepository(), fakeTXTResolver{}))
+	_, err = svc.BulkUpdateStatus(context.Background(), &model.BulkStatusRequest{
+		BulkSelector: model.BulkSelector{Campaign: "spring"},
+		Status:       model.BulkStatusDisabled,
+	})
+	assert.ErrorIs(t, err, ErrClaimUnauthenticated)
+	mockMySQL.EXPECT().SetShortLinksStatus(gomock.Any(), &model.LinkFilter{Param: "utm_campaign", Value: "spring", Owner: ownerOf("key-1")}, 0).
+		Return([]model.ShortLink{}, nil)
+	resp, err = svc.BulkUpdateStatus(middleware.WithAPIKey(context.Background(), "key-1"), &model.BulkStatusRequest{
+		BulkSelector: model.BulkSelector{Campaign: "spring"},
+		Status:       model.BulkStatusDisabled,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, resp.Updated)
+
+	svc.SetReadOnly(true)
+	_, err = svc.BulkUpdateStatus(context.Background(), &model.BulkStatusRequest{
+		BulkSelector: model.BulkSelector{ShortCodes: []string{"ABCD"}},
+		Status:       model.BulkStatusActive,
+	})
+	assert.ErrorIs(t, err, ErrReadOnlyReplica)
+}
+
+func TestShortLinkService_BulkUpdateExpiry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	svc := NewShortLinkService(mockMySQL, mockRedis, mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+	expireAt := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	mockMySQL.EXPECT().SetShortLinksExpiry(gomock.Any(), &model.LinkFilter{ShortCodes: []string{"ABCD", "EFGH"}}, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ *model.LinkFilter, at *time.Time) ([]model.ShortLink, error) {
+			assert.True(t, expireAt.Equal(*at))
+			return []model.ShortLink{{ShortCode: "ABCD", Status: 1, MaxClicks: 10, ExpireAt: at}}, nil
+		})
+	// Click limits follow the new expiry
+	mockRedis.EXPECT().SetClickLimit(gomock.Any(), "ABCD", int64(10), gomock.Any()).Return(nil)
+	mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "ABCD").Return(nil)
+
+	resp, err := svc.BulkUpdateExpiry(context.Background(), &model.BulkExpireRequest{
+		BulkSelector: model.BulkSelector{ShortCodes: []string{"ABCD", "EFGH"}},
+		ExpireAt:     "2026-10-16T14:00:00+02:00",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ABCD"}, resp.Updated)
+
+	_, err = svc.BulkUpdateExpiry(context.Background(), &model.BulkExpireRequest{
+		BulkSelector: model.BulkSelector{ShortCodes: []string{"ABCD"}},
+		ExpireAt:     "tomorrow",
+	})
+	assert.ErrorIs(t, err, ErrInvalidExpireAt)
+}
+
+func TestShortLinkService_Extend(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	svc := NewShortLinkService(mockMySQL, mockRedis, mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	svc.clock = clock.NewFake(now)
+	by := 30 * 24 * time.Hour
+
+	extend := func(expireAt time.Time, want time.Time) {
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").
+			Return(&model.ShortLink{ShortCode: "ABCD", Status: 1, ExpireAt: &expireAt}, nil)
+		mockMySQL.EXPECT().SetShortLinksExpiry(gomock.Any(), &model.LinkFilter{ShortCodes: []string{"ABCD"}}, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ *model.LinkFilter, at *time.Time) ([]model.ShortLink, error) {
+				assert.True(t, want.Equal(*at))
+				return []model.ShortLink{{ShortCode: "ABCD", Status: 1, ExpireAt: at}}, nil
+			})
+		mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "ABCD").Return(nil)
+
+		resp, err := svc.Extend(context.Background(), "ABCD", by)
+		require.NoError(t, err)
+		assert.True(t, want.Equal(resp.ExpireAt))
+	}
+	// From the current expiry, or from now once expired
+	extend(now.Add(48*time.Hour), now.Add(48*time.Hour+by))
+	extend(now.Add(-time.Hour), now.Add(by))
+
+	mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "EFGH").Return(&model.ShortLink{ShortCode: "EFGH", Status: 1}, nil)
+	_, err := svc.Extend(context.Background(), "EFGH", by)
+	assert.ErrorIs(t, err, repository.ErrConflict)
+
+	mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "IJKL").Return(nil, repository.ErrNotFound)
+	_, err = svc.Extend(context.Background(), "IJKL", by)
+	assert.ErrorIs(t, err, ErrShortLinkNotFound)
+}
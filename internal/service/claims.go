@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/internal/storage"
+	"octopus/pkg/clock"
+	"octopus/pkg/middleware"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/html"
+)
+
+var (
+	// ErrClaimUnauthenticated is returned when a caller without an API key claims a link or reads
+	// its analytics
+	ErrClaimUnauthenticated = errors.New("an API key is required")
+	// ErrClaimNotStarted is returned when verifying a claim that was never started or has expired
+	ErrClaimNotStarted = errors.New("claim not started or expired")
+	// ErrClaimUnverified is returned when the token of a claim is found neither in DNS nor on the
+	// destination's home page
+	ErrClaimUnverified = errors.New("claim not verified")
+	// ErrNotOwner is returned when a caller reads the analytics of a link it does not own
+	ErrNotOwner = errors.New("link not owned by this API key")
+)
+
+const (
+	// claimDNSPrefix is prepended to the destination domain to name the TXT record of a claim
+	claimDNSPrefix = "_octopus-claim."
+	// claimMetaName is the name of the meta tag carrying the token of a claim
+	claimMetaName = "octopus-claim"
+	// maxClaimPageSize bounds the part of a home page searched for the meta tag
+	maxClaimPageSize = 1 << 20
+)
+
+// TXTResolver looks up the TXT records of a DNS name, implemented by net.Resolver
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// ClaimService hands links over to the API keys creating or claiming them, for self-serve
+// deployments where anyone may create links. Links created with an API key belong to it; anonymous
+// links are claimed by publishing a token in a DNS TXT record of their destination domain or in a
+// meta tag of its home page. Only owners read the analytics of their links. Owners are kept as the
+// SHA-256 of their API key.
+type ClaimService struct {
+	links    storage.LinkStore
+	client   redis.UniversalClient
+	key      string
+	ttl      time.Duration
+	timeout  time.Duration
+	resolver TXTResolver
+	http     *http.Client
+	clock    clock.Clock
+}
+
+// NewClaimService creates a new ClaimService
+func NewClaimService(links storage.LinkStore, client redis.UniversalClient, cfg *config.ClaimsConfig) *ClaimService {
+	return &ClaimService{
+		links:    links,
+		client:   client,
+		key:      cfg.Key,
+		ttl:      cfg.TTL,
+		timeout:  cfg.Timeout,
+		resolver: net.DefaultResolver,
+		http:     &http.Client{Timeout: cfg.Timeout},
+		clock:    clock.Real,
+	}
+}
+
+// SetResolver replaces the system resolver looking up the TXT records of claims
+func (cs *ClaimService) SetResolver(resolver TXTResolver) {
+	cs.resolver = resolver
+}
+
+// Owner returns the owner links created in ctx belong to, empty for anonymous callers or without
+// claims
+func (cs *ClaimService) Owner(ctx context.Context) string {
+	if cs == nil {
+		return ""
+	}
+	return ownerOf(middleware.APIKeyFrom(ctx))
+}
+
+// ownerOf hashes an API key into the owner stored with links, so that stored links do not reveal
+// the keys
+func ownerOf(apiKey string) string {
+	if apiKey == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// Start starts the claim of a link by the caller, returning the token to publish. Starting a claim
+// again returns the same token until it expires.
+func (cs *ClaimService) Start(ctx context.Context, shortCode string) (*model.Claim, error) {
+	owner := cs.Owner(ctx)
+	if owner == "" {
+		return nil, ErrClaimUnauthenticated
+	}
+	sl, err := cs.link(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if sl.Owner == owner {
+		return nil, fmt.Errorf("%w: link already owned by this API key", repository.ErrConflict)
+	}
+	if sl.Owner != "" {
+		return nil, fmt.Errorf("%w: link already owned by another API key", repository.ErrConflict)
+	}
+	dest, err := url.Parse(sl.OriginalURL)
+	if err != nil || dest.Hostname() == "" {
+		return nil, fmt.Errorf("%w: destination has no domain", ErrInvalidURL)
+	}
+
+	key := cs.claimKey(shortCode, owner)
+	token, err := newClaimToken()
+	if err != nil {
+		return nil, err
+	}
+	started, err := cs.client.SetNX(ctx, key, token, cs.ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start claim: %w", err)
+	}
+	ttl := cs.ttl
+	if !started {
+		if token, err = cs.client.Get(ctx, key).Result(); err != nil {
+			return nil, fmt.Errorf("failed to read claim: %w", err)
+		}
+		if ttl, err = cs.client.PTTL(ctx, key).Result(); err != nil {
+			return nil, fmt.Errorf("failed to read claim: %w", err)
+		}
+	}
+
+	domain := strings.ToLower(dest.Hostname())
+	return &model.Claim{
+		ShortCode: shortCode,
+		Domain:    domain,
+		Token:     token,
+		DNSName:   claimDNSPrefix + domain,
+		DNSValue:  claimMetaName + "=" + token,
+		MetaURL:   claimPageURL(dest),
+		MetaTag:   fmt.Sprintf(`<meta name="%s" content="%s">`, claimMetaName, token),
+		ExpireAt:  cs.clock.Now().Add(ttl).UTC().Truncate(time.Second),
+	}, nil
+}
+
+// Verify looks for the token of the caller's claim in DNS, then on the destination's home page,
+// and hands the link over to the caller once found. Only anonymous links are claimed, a link owned
+// by another API key staying with it.
+func (cs *ClaimService) Verify(ctx context.Context, shortCode string) (*model.ClaimVerification, error) {
+	owner := cs.Owner(ctx)
+	if owner == "" {
+		return nil, ErrClaimUnauthenticated
+	}
+	key := cs.claimKey(shortCode, owner)
+	token, err := cs.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrClaimNotStarted
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read claim: %w", err)
+	}
+	sl, err := cs.link(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	// The link may have been created or claimed by another key since the claim started
+	if sl.Owner != "" {
+		return nil, fmt.Errorf("%w: link already owned by an API key", repository.ErrConflict)
+	}
+	// The destination may have changed since the claim started
+	dest, err := url.Parse(sl.OriginalURL)
+	if err != nil || dest.Hostname() == "" {
+		return nil, fmt.Errorf("%w: destination has no domain", ErrInvalidURL)
+	}
+
+	method := ""
+	switch {
+	case cs.verifyDNS(ctx, strings.ToLower(dest.Hostname()), token):
+		method = "dns"
+	case cs.verifyMeta(ctx, dest, token):
+		method = "meta"
+	default:
+		return nil, fmt.Errorf("%w: token found neither in the TXT record of %s nor in a meta tag of %s",
+			ErrClaimUnverified, claimDNSPrefix+strings.ToLower(dest.Hostname()), claimPageURL(dest))
+	}
+
+	if err := cs.links.SetShortLinkOwner(ctx, shortCode, owner); err != nil {
+		return nil, fmt.Errorf("failed to transfer link: %w", err)
+	}
+	if err := cs.client.Del(ctx, key).Err(); err != nil {
+		log.Warn().Err(err).Str("short_code", shortCode).Msg("Failed to remove verified claim")
+	}
+
+	log.Info().Str("short_code", shortCode).Str("method", method).Msg("Link claimed")
+	return &model.ClaimVerification{ShortCode: shortCode, Method: method}, nil
+}
+
+// Authorize checks that the caller owns a link, anonymous links being readable by nobody until
+// claimed
+func (cs *ClaimService) Authorize(ctx context.Context, shortCode string) error {
+	owner := cs.Owner(ctx)
+	if owner == "" {
+		return ErrClaimUnauthenticated
+	}
+	sl, err := cs.link(ctx, shortCode)
+	if err != nil {
+		return err
+	}
+	if sl.Owner != owner {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+// link returns the stored link of a short code, ErrShortLinkNotFound if none is active
+func (cs *ClaimService) link(ctx context.Context, shortCode string) (*model.ShortLink, error) {
+	sl, err := cs.links.GetShortLinkByCode(ctx, shortCode)
+	if err != nil {
+		return nil, linkError(err)
+	}
+	return sl, nil
+}
+
+// claimKey returns the Redis key of the claim of a link by an owner, each caller getting a token
+// of its own
+func (cs *ClaimService) claimKey(shortCode, owner string) string {
+	return cs.key + ":" + shortCode + ":" + owner
+}
+
+// verifyDNS reports whether a TXT record of the domain's claim name holds the token
+func (cs *ClaimService) verifyDNS(ctx context.Context, domain, token string) bool {
+	ctx, cancel := context.WithTimeout(ctx, cs.timeout)
+	defer cancel()
+
+	records, err := cs.resolver.LookupTXT(ctx, claimDNSPrefix+domain)
+	if err != nil {
+		log.Debug().Err(err).Str("domain", domain).Msg("Claim TXT record not found")
+		return false
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == claimMetaName+"="+token {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyMeta reports whether the home page of the destination carries the token in a meta tag.
+// Redirects are only followed within the destination host, so that a page elsewhere cannot prove
+// control of it.
+func (cs *ClaimService) verifyMeta(ctx context.Context, dest *url.URL, token string) bool {
+	ctx, cancel := context.WithTimeout(ctx, cs.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, claimPageURL(dest), nil)
+	if err != nil {
+		return false
+	}
+	client := *cs.http
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 || !strings.EqualFold(req.URL.Hostname(), dest.Hostname()) {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Debug().Err(err).Str("url", req.URL.String()).Msg("Failed to fetch claim page")
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+	return hasClaimMeta(io.LimitReader(resp.Body, maxClaimPageSize), token)
+}
+
+// hasClaimMeta reports whether an HTML page has a claim meta tag holding the token
+func hasClaimMeta(page io.Reader, token string) bool {
+	z := html.NewTokenizer(page)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return false
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			if t.Data != "meta" {
+				continue
+			}
+			var name, content string
+			for _, attr := range t.Attr {
+				switch attr.Key {
+				case "name":
+					name = attr.Val
+				case "content":
+					content = attr.Val
+				}
+			}
+			if strings.EqualFold(name, claimMetaName) && strings.TrimSpace(content) == token {
+				return true
+			}
+		}
+	}
+}
+
+// claimPageURL returns the home page of a destination, searched for the meta tag of claims
+func claimPageURL(dest *url.URL) string {
+	return dest.Scheme + "://" + dest.Host + "/"
+}
+
+// newClaimToken returns a random token for a claim
+func newClaimToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate claim token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/pkg/middleware"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTXTResolver serves TXT records from a map
+type fakeTXTResolver map[string][]string
+
+func (r fakeTXTResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	if records, ok := r[name]; ok {
+		return records, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+// unreachable fails every request, standing for destinations that cannot be fetched
+type unreachable struct{}
+
+func (unreachable) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
+
+func newTestClaims(t *testing.T, store *repository.MemoryRepository, resolver fakeTXTResolver) *ClaimService {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	cs := NewClaimService(store, client, &config.ClaimsConfig{Key: "octopus:claims", TTL: time.Hour, Timeout: time.Second})
+	cs.SetResolver(resolver)
+	return cs
+}
+
+func TestClaimService_DNS(t *testing.T) {
+	store := repository.NewMemoryRepository()
+	resolver := fakeTXTResolver{}
+	cs := newTestClaims(t, store, resolver)
+	cs.http.Transport = unreachable{}
+	ctx := middleware.WithAPIKey(context.Background(), "key-1")
+	require.NoError(t, store.SaveShortLink(ctx, &model.ShortLink{ShortCode: "abc123", OriginalURL: "https://Example.com/pricing"}))
+
+	_, err := cs.Start(context.Background(), "abc123")
+	assert.ErrorIs(t, err, ErrClaimUnauthenticated)
+	_, err = cs.Start(ctx, "zzz999")
+	assert.ErrorIs(t, err, ErrShortLinkNotFound)
+	_, err = cs.Verify(ctx, "abc123")
+	assert.ErrorIs(t, err, ErrClaimNotStarted)
+	assert.ErrorIs(t, cs.Authorize(ctx, "abc123"), ErrNotOwner)
+
+	claim, err := cs.Start(ctx, "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", claim.Domain)
+	assert.Equal(t, "_octopus-claim.example.com", claim.DNSName)
+	assert.Equal(t, "octopus-claim="+claim.Token, claim.DNSValue)
+	assert.Equal(t, "https://Example.com/", claim.MetaURL)
+
+	// Starting again keeps the token already published
+	again, err := cs.Start(ctx, "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, claim.Token, again.Token)
+	other, err := cs.Start(middleware.WithAPIKey(context.Background(), "key-2"), "abc123")
+	require.NoError(t, err)
+	assert.NotEqual(t, claim.Token, other.Token)
+
+	// Only the caller's token proves the claim, the destination has no meta tag either
+	resolver[claim.DNSName] = []string{"v=spf1 -all", other.DNSValue}
+	_, err = cs.Verify(ctx, "abc123")
+	assert.ErrorIs(t, err, ErrClaimUnverified)
+
+	resolver[claim.DNSName] = append(resolver[claim.DNSName], claim.DNSValue)
+	verification, err := cs.Verify(ctx, "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, "dns", verification.Method)
+
+	assert.NoError(t, cs.Authorize(ctx, "abc123"))
+	assert.ErrorIs(t, cs.Authorize(middleware.WithAPIKey(context.Background(), "key-2"), "abc123"), ErrNotOwner)
+	assert.ErrorIs(t, cs.Authorize(context.Background(), "abc123"), ErrClaimUnauthenticated)
+
+	// The claim is used up, and owners cannot claim their own links
+	_, err = cs.Verify(ctx, "abc123")
+	assert.ErrorIs(t, err, ErrClaimNotStarted)
+	_, err = cs.Start(ctx, "abc123")
+	assert.ErrorIs(t, err, repository.ErrConflict)
+
+	// The stored owner does not reveal the key
+	sl, err := store.GetShortLinkByCode(ctx, "abc123")
+	require.NoError(t, err)
+	assert.Len(t, sl.Owner, 64)
+	assert.NotContains(t, sl.Owner, "key-1")
+}
+
+func TestClaimService_Meta(t *testing.T) {
+	token := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.Redirect(w, r, "/home", http.StatusFound)
+		case "/home":
+			w.Write([]byte(`<html><head><title>Home</title><META name="Octopus-Claim" content="` + token + `"/></head><body></body></html>`))
+		}
+	}))
+	defer server.Close()
+
+	store := repository.NewMemoryRepository()
+	cs := newTestClaims(t, store, fakeTXTResolver{})
+	ctx := middleware.WithAPIKey(context.Background(), "key-1")
+	require.NoError(t, store.SaveShortLink(ctx, &model.ShortLink{ShortCode: "abc123", OriginalURL: server.URL + "/landing?utm=x"}))
+
+	claim, err := cs.Start(ctx, "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/", claim.MetaURL)
+	assert.Equal(t, `<meta name="octopus-claim" content="`+claim.Token+`">`, claim.MetaTag)
+
+	_, err = cs.Verify(ctx, "abc123")
+	assert.ErrorIs(t, err, ErrClaimUnverified)
+
+	token = claim.Token
+	verification, err := cs.Verify(ctx, "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, "meta", verification.Method)
+	assert.NoError(t, cs.Authorize(ctx, "abc123"))
+
+	// Claimed links stay with their owner, even for a claim started before
+	other := middleware.WithAPIKey(context.Background(), "key-0")
+	assert.ErrorIs(t, cs.Authorize(other, "abc123"), ErrNotOwner)
+	_, err = cs.Start(other, "abc123")
+	assert.ErrorIs(t, err, repository.ErrConflict)
+	require.NoError(t, cs.client.Set(context.Background(), cs.claimKey("abc123", ownerOf("key-0")), token, time.Hour).Err())
+	_, err = cs.Verify(other, "abc123")
+	assert.ErrorIs(t, err, repository.ErrConflict)
+	assert.NoError(t, cs.Authorize(ctx, "abc123"))
+}
+
+func TestHasClaimMeta(t *testing.T) {
+	assert.True(t, hasClaimMeta(strings.NewReader(`<meta content="t0k" name="octopus-claim">`), "t0k"))
+	assert.False(t, hasClaimMeta(strings.NewReader(`<meta name="octopus-claim" content="other">`), "t0k"))
+	assert.False(t, hasClaimMeta(strings.NewReader(`<p>octopus-claim t0k</p>`), "t0k"))
+	assert.False(t, hasClaimMeta(strings.NewReader(`<meta name="description" content="t0k">`), "t0k"))
+}
+
+func TestShortLinkService_GenerateOwned(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+	owner := ownerOf("key-1")
+
+	// Owned links are only shared with their owner, an anonymous link of the URL is not reused
+	mockRedis.EXPECT().GetShortLink(gomock.Any(), "owner="+owner[:16]+":https://example.com").Return("", errors.New("not found"))
+	mockMySQL.EXPECT().GetShortLinkByDedupHash(gomock.Any(), dedupHash("https://example.com", nil)).
+		Return(&model.ShortLink{ShortCode: "anon01", OriginalURL: "https://example.com", Status: 1}, nil)
+	mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, sl *model.ShortLink) error {
+		assert.Equal(t, owner, sl.Owner)
+		return nil
+	})
+	mockRedis.EXPECT().SaveShortLinkPair(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	mockBloom.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil)
+
+	svc := NewShortLinkService(mockMySQL, mockRedis, mockBloom, "https://s.example.com")
+	svc.SetClaims(newTestClaims(t, repository.NewMemoryRepository(), fakeTXTResolver{}))
+	resp, err := svc.Generate(middleware.WithAPIKey(context.Background(), "key-1"), &model.GenerateRequest{URL: "https://example.com"})
+	require.NoError(t, err)
+	assert.NotEqual(t, "anon01", resp.ShortCode)
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/internal/storage"
+	"octopus/pkg/util"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrClickNotFound is returned when a conversion references an unknown or expired click ID
+var ErrClickNotFound = errors.New("click not found")
+
+// ConversionService issues click IDs on redirect and attributes conversion postbacks to them
+type ConversionService struct {
+	mysqlRepo         storage.StatsStore
+	redisRepo         storage.Cache
+	param             string
+	attributionWindow time.Duration
+	respectDoNotTrack bool
+	cookie            config.ClickCookieConfig
+	rules             *Rules
+}
+
+// NewConversionService creates a new Conversion Service
+func NewConversionService(
+	mysqlRepo storage.StatsStore,
+	redisRepo storage.Cache,
+	cfg *config.ConversionConfig,
+) *ConversionService {
+	return &ConversionService{
+		mysqlRepo:         mysqlRepo,
+		redisRepo:         redisRepo,
+		param:             cfg.Param,
+		attributionWindow: cfg.AttributionWindow,
+		respectDoNotTrack: cfg.RespectDoNotTrack,
+		cookie:            cfg.Cookie,
+	}
+}
+
+// SetRules classifies the referers of clicks with the source rules set at runtime before the
+// built-in sources
+func (cs *ConversionService) SetRules(rules *Rules) {
+	cs.rules = rules
+}
+
+// Param returns the query parameter carrying the click ID
+func (cs *ConversionService) Param() string {
+	return cs.param
+}
+
+// NewClickID generates a new click ID
+func (cs *ConversionService) NewClickID() string {
+	return strings.ReplaceAll(util.GenerateUUID(), "-", "")
+}
+
+// ValidClickID checks if a value has the shape of a generated click ID
+func (cs *ConversionService) ValidClickID(clickID string) bool {
+	if len(clickID) != 32 {
+		return false
+	}
+	for _, c := range clickID {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// CookieName returns the name of the click ID cookie, empty when the cookie is disabled
+func (cs *ConversionService) CookieName() string {
+	if !cs.cookie.Enabled {
+		return ""
+	}
+	return cs.cookie.Name
+}
+
+// ClickCookie builds the first-party cookie carrying the click ID, nil when the cookie is disabled
+func (cs *ConversionService) ClickCookie(clickID string) *http.Cookie {
+	if !cs.cookie.Enabled {
+		return nil
+	}
+
+	return &http.Cookie{
+		Name:     cs.cookie.Name,
+		Value:    clickID,
+		Domain:   cs.cookie.Domain,
+		Path:     cs.cookie.Path,
+		MaxAge:   int(cs.cookie.MaxAge.Seconds()),
+		Secure:   cs.cookie.Secure,
+		HttpOnly: cs.cookie.HTTPOnly,
+		SameSite: parseSameSite(cs.cookie.SameSite),
+	}
+}
+
+// OptedOut checks if a redirect must not carry a click ID, either for the link or the visitor
+func (cs *ConversionService) OptedOut(ctx context.Context, sl *model.ShortLink, header http.Header) bool {
+	if cs.respectDoNotTrack && (header.Get("DNT") == "1" || header.Get("Sec-GPC") == "1") {
+		return true
+	}
+	return sl.NoClickID
+}
+
+// TagURL appends the click ID to the destination URL, leaving the rest of its query as it is
+func (cs *ConversionService) TagURL(targetURL, clickID string) string {
+	param := url.Values{cs.param: {clickID}}
+	if util.IsSignedURL(targetURL) {
+		return util.AppendQuery(targetURL, param)
+	}
+
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return targetURL
+	}
+	u.RawQuery = util.MergeQuery(u.RawQuery, param)
+
+	return u.String()
+}
+
+// RecordClick remembers the link and source of a click for the attribution window
+func (cs *ConversionService) RecordClick(ctx context.Context, clickID, shortCode, referer string) error {
+	return cs.redisRepo.SaveClick(ctx, clickID, shortCode, cs.rules.Source(referer), cs.attributionWindow)
+}
+
+// Convert records a conversion for a previously issued click ID
+func (cs *ConversionService) Convert(ctx context.Context, req *model.ConversionRequest) (*model.ConversionResponse, error) {
+	shortCode, source, err := cs.redisRepo.GetClick(ctx, req.ClickID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrClickNotFound
+		}
+		return nil, fmt.Errorf("failed to get click: %w", err)
+	}
+
+	event := req.Event
+	if event == "" {
+		event = model.DefaultConversionEvent
+	}
+
+	created, err := cs.mysqlRepo.SaveConversion(ctx, &model.Conversion{
+		ClickID:   req.ClickID,
+		Event:     event,
+		ShortCode: shortCode,
+		Source:    source,
+		Value:     req.Value,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save conversion: %w", err)
+	}
+
+	// Repeated postbacks for the same click and event are acknowledged but not counted again
+	if created {
+		if err := cs.redisRepo.IncrementConversion(ctx, shortCode, source); err != nil {
+			log.Error().Err(err).Str("short_code", shortCode).Msg("Failed to increment conversions")
+		}
+		if err := cs.redisRepo.TouchStats(ctx, shortCode); err != nil {
+			log.Error().Err(err).Str("short_code", shortCode).Msg("Failed to touch stats")
+		}
+	}
+
+	return &model.ConversionResponse{
+		ClickID:   req.ClickID,
+		ShortCode: shortCode,
+		Source:    source,
+		Event:     event,
+		Duplicate: !created,
+	}, nil
+}
+
+// parseSameSite maps the configured SameSite attribute to its cookie mode
+func parseSameSite(mode string) http.SameSite {
+	switch strings.ToLower(mode) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	case "lax":
+		return http.SameSiteLaxMode
+	default:
+		return http.SameSiteDefaultMode
+	}
+}
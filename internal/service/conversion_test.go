@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/internal/storage"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestConversionService(mysqlRepo storage.StatsStore, redisRepo storage.Cache) *ConversionService {
+	return NewConversionService(mysqlRepo, redisRepo, &config.ConversionConfig{
+		Enabled:           true,
+		Param:             "octo_cid",
+		AttributionWindow: 24 * time.Hour,
+	})
+}
+
+func TestConversionService_NewClickID(t *testing.T) {
+	svc := newTestConversionService(nil, nil)
+
+	first := svc.NewClickID()
+	second := svc.NewClickID()
+
+	assert.Len(t, first, 32)
+	assert.NotEqual(t, first, second)
+}
+
+func TestConversionService_TagURL(t *testing.T) {
+	svc := newTestConversionService(nil, nil)
+
+	assert.Equal(t, "https://example.com/path?octo_cid=c1d2", svc.TagURL("https://example.com/path", "c1d2"))
+	assert.Equal(t, "https://example.com?a=1&octo_cid=c1d2", svc.TagURL("https://example.com?a=1", "c1d2"))
+	assert.Equal(t, "://invalid", svc.TagURL("://invalid", "c1d2"))
+	assert.Equal(t, "https://example.com?b=%7e&a=1&octo_cid=c1d2#top", svc.TagURL("https://example.com?b=%7e&a=1#top", "c1d2"))
+	assert.Equal(t, "https://b.s3.amazonaws.com/k%20x?X-Amz-Signature=ab&octo_cid=c1d2", svc.TagURL("https://b.s3.amazonaws.com/k%20x?X-Amz-Signature=ab", "c1d2"))
+}
+
+func TestConversionService_ValidClickID(t *testing.T) {
+	svc := newTestConversionService(nil, nil)
+
+	assert.True(t, svc.ValidClickID(svc.NewClickID()))
+	assert.False(t, svc.ValidClickID(""))
+	assert.False(t, svc.ValidClickID("not-a-click-id"))
+	assert.False(t, svc.ValidClickID("0123456789ABCDEF0123456789ABCDEF"))
+}
+
+func TestConversionService_ClickCookie(t *testing.T) {
+	t.Run("cookie disabled", func(t *testing.T) {
+		svc := newTestConversionService(nil, nil)
+
+		assert.Empty(t, svc.CookieName())
+		assert.Nil(t, svc.ClickCookie("c1d2"))
+	})
+
+	t.Run("cookie attributes from config", func(t *testing.T) {
+		svc := NewConversionService(nil, nil, &config.ConversionConfig{
+			Enabled: true,
+			Param:   "octo_cid",
+			Cookie: config.ClickCookieConfig{
+				Enabled:  true,
+				Name:     "cid",
+				Domain:   "s.example.com",
+				Path:     "/",
+				MaxAge:   time.Hour,
+				Secure:   true,
+				HTTPOnly: true,
+				SameSite: "none",
+			},
+		})
+
+		assert.Equal(t, "cid", svc.CookieName())
+		cookie := svc.ClickCookie("c1d2")
+		assert.Equal(t, "cid", cookie.Name)
+		assert.Equal(t, "c1d2", cookie.Value)
+		assert.Equal(t, "s.example.com", cookie.Domain)
+		assert.Equal(t, 3600, cookie.MaxAge)
+		assert.True(t, cookie.Secure)
+		assert.True(t, cookie.HttpOnly)
+		assert.Equal(t, http.SameSiteNoneMode, cookie.SameSite)
+	})
+}
+
+func TestConversionService_OptedOut(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRedis := mocks.NewMockCache(ctrl)
+	svc := NewConversionService(nil, mockRedis, &config.ConversionConfig{Enabled: true, RespectDoNotTrack: true})
+	sl := &model.ShortLink{ShortCode: "ABCD"}
+
+	t.Run("do not track header", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("DNT", "1")
+		assert.True(t, svc.OptedOut(context.Background(), sl, header))
+
+		header = http.Header{}
+		header.Set("Sec-GPC", "1")
+		assert.True(t, svc.OptedOut(context.Background(), sl, header))
+	})
+
+	t.Run("link opted out", func(t *testing.T) {
+		assert.True(t, svc.OptedOut(context.Background(), &model.ShortLink{ShortCode: "ABCD", NoClickID: true}, http.Header{}))
+	})
+
+	t.Run("tracked link", func(t *testing.T) {
+		assert.False(t, svc.OptedOut(context.Background(), sl, http.Header{}))
+	})
+}
+
+func TestConversionService_RecordClick(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRedis := mocks.NewMockCache(ctrl)
+	mockRedis.EXPECT().SaveClick(gomock.Any(), "c1d2", "ABCD", "google", 24*time.Hour).Return(nil)
+
+	svc := newTestConversionService(nil, mockRedis)
+	err := svc.RecordClick(context.Background(), "c1d2", "ABCD", "https://www.google.com/search")
+	assert.NoError(t, err)
+}
+
+func TestConversionService_Convert(t *testing.T) {
+	t.Run("first conversion is counted", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockRedis := mocks.NewMockCache(ctrl)
+		mockRedis.EXPECT().GetClick(gomock.Any(), "c1d2").Return("ABCD", "google", nil)
+		mockMySQL.EXPECT().SaveConversion(gomock.Any(), &model.Conversion{
+			ClickID:   "c1d2",
+			Event:     model.DefaultConversionEvent,
+			ShortCode: "ABCD",
+			Source:    "google",
+		}).Return(true, nil)
+		mockRedis.EXPECT().IncrementConversion(gomock.Any(), "ABCD", "google").Return(nil)
+		mockRedis.EXPECT().TouchStats(gomock.Any(), "ABCD").Return(nil)
+
+		svc := newTestConversionService(mockMySQL, mockRedis)
+		resp, err := svc.Convert(context.Background(), &model.ConversionRequest{ClickID: "c1d2"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "ABCD", resp.ShortCode)
+		assert.Equal(t, model.DefaultConversionEvent, resp.Event)
+		assert.False(t, resp.Duplicate)
+	})
+
+	t.Run("repeated postback is not counted again", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockRedis := mocks.NewMockCache(ctrl)
+		mockRedis.EXPECT().GetClick(gomock.Any(), "c1d2").Return("ABCD", "google", nil)
+		mockMySQL.EXPECT().SaveConversion(gomock.Any(), gomock.Any()).Return(false, nil)
+
+		svc := newTestConversionService(mockMySQL, mockRedis)
+		resp, err := svc.Convert(context.Background(), &model.ConversionRequest{ClickID: "c1d2", Event: "purchase"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "purchase", resp.Event)
+		assert.True(t, resp.Duplicate)
+	})
+
+	t.Run("unknown click", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRedis := mocks.NewMockCache(ctrl)
+		mockRedis.EXPECT().GetClick(gomock.Any(), "unknown").Return("", "", repository.ErrNotFound)
+
+		svc := newTestConversionService(nil, mockRedis)
+		_, err := svc.Convert(context.Background(), &model.ConversionRequest{ClickID: "unknown"})
+
+		assert.ErrorIs(t, err, ErrClickNotFound)
+	})
+
+	t.Run("save error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockRedis := mocks.NewMockCache(ctrl)
+		mockRedis.EXPECT().GetClick(gomock.Any(), "c1d2").Return("ABCD", "google", nil)
+		mockMySQL.EXPECT().SaveConversion(gomock.Any(), gomock.Any()).Return(false, errors.New("db error"))
+
+		svc := newTestConversionService(mockMySQL, mockRedis)
+		_, err := svc.Convert(context.Background(), &model.ConversionRequest{ClickID: "c1d2"})
+
+		assert.Error(t, err)
+	})
+}
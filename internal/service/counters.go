@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/internal/storage"
+	"octopus/pkg/async"
+
+	"github.com/rs/zerolog/log"
+)
+
+// counterFlushTimeout bounds a single flush of the buffered counters
+const counterFlushTimeout = 5 * time.Second
+
+// counterKey identifies the counters buffered for one short link and minute, so that clicks are
+// counted in the minute and day they happened rather than the ones of the flush
+type counterKey struct {
+	shortCode string
+	minute    int64
+}
+
+// pendingCounters are the counter changes of one short link in one minute since the last flush
+type pendingCounters struct {
+	delta    *model.CounterDelta
+	visitors map[string]struct{}
+}
+
+// CounterBuffer is a write-behind cache of analytics counters: clicks are counted in memory and
+// flushed to Redis in one pipeline per interval, so hot links cost a few commands per flush instead
+// of several per click. Counts of at most one interval are lost when the instance crashes.
+type CounterBuffer struct {
+	redisRepo     storage.CounterStore
+	flushInterval time.Duration
+	maxKeys       int
+	mu            sync.Mutex
+	pending       map[counterKey]*pendingCounters
+	closed        bool
+	dropped       atomic.Int64
+	full          chan struct{}
+	stop          chan struct{}
+	done          chan struct{}
+}
+
+// NewCounterBuffer creates a new counter buffer and starts flushing it
+func NewCounterBuffer(redisRepo storage.CounterStore, cfg *config.WriteBehindConfig) *CounterBuffer {
+	b := newCounterBuffer(redisRepo, cfg)
+	async.Go(b.run)
+
+	log.Info().
+		Dur("flush_interval", cfg.FlushInterval).
+		Int("max_keys", cfg.MaxKeys).
+		Msg("Analytics write-behind buffer started")
+
+	return b
+}
+
+// newCounterBuffer creates a counter buffer without starting it
+func newCounterBuffer(redisRepo storage.CounterStore, cfg *config.WriteBehindConfig) *CounterBuffer {
+	maxKeys := cfg.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = 10000
+	}
+
+	return &CounterBuffer{
+		redisRepo:     redisRepo,
+		flushInterval: cfg.FlushInterval,
+		maxKeys:       maxKeys,
+		pending:       make(map[counterKey]*pendingCounters),
+		full:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// Record counts one click of a short link at the given time. After Close clicks are written to
+// Redis right away.
+func (b *CounterBuffer) Record(ctx context.Context, shortCode, visitorID, source string, at time.Time) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		b.apply(ctx, []*model.CounterDelta{newCounterDelta(shortCode, visitorID, source, at)})
+		return
+	}
+
+	key := counterKey{shortCode: shortCode, minute: at.Unix() / 60}
+	p, ok := b.pending[key]
+	if !ok {
+		p = &pendingCounters{
+			delta:    &model.CounterDelta{ShortCode: shortCode, Sources: make(map[string]int64), AccessTime: at},
+			visitors: make(map[string]struct{}),
+		}
+		b.pending[key] = p
+	}
+	p.delta.PV++
+	if _, seen := p.visitors[visitorID]; !seen {
+		p.visitors[visitorID] = struct{}{}
+		p.delta.Visitors = append(p.delta.Visitors, visitorID)
+	}
+	if source != "" {
+		p.delta.Sources[source]++
+	}
+	full := len(b.pending) >= b.maxKeys
+	b.mu.Unlock()
+
+	// Flush early instead of growing without bound when many links are clicked at once
+	if full {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush writes the buffered counters to Redis
+func (b *CounterBuffer) Flush(ctx context.Context) {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = make(map[counterKey]*pendingCounters, len(pending))
+	b.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	deltas := make([]*model.CounterDelta, 0, len(pending))
+	for _, p := range pending {
+		deltas = append(deltas, p.delta)
+	}
+	b.apply(ctx, deltas)
+}
+
+// apply writes counter changes to Redis, dropping them on failure like per-click writes would be
+func (b *CounterBuffer) apply(ctx context.Context, deltas []*model.CounterDelta) {
+	var clicks int64
+	for _, d := range deltas {
+		clicks += d.PV
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), counterFlushTimeout)
+	defer cancel()
+
+	if err := b.redisRepo.ApplyCounters(ctx, deltas); err != nil {
+		b.dropped.Add(clicks)
+		log.Error().Err(err).Int("short_links", len(deltas)).Int64("clicks", clicks).Msg("Failed to flush analytics counters")
+	}
+}
+
+// run flushes the buffer periodically, or early when it is full, until closed
+func (b *CounterBuffer) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.Flush(context.Background())
+		case <-b.full:
+			b.Flush(context.Background())
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Close stops the periodic flush and writes what is still buffered
+func (b *CounterBuffer) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	close(b.stop)
+	<-b.done
+	b.Flush(context.Background())
+
+	if dropped := b.dropped.Load(); dropped > 0 {
+		log.Warn().Int64("dropped", dropped).Msg("Clicks dropped by the analytics write-behind buffer")
+	}
+}
+
+// newCounterDelta returns the counter changes of a single click
+func newCounterDelta(shortCode, visitorID, source string, at time.Time) *model.CounterDelta {
+	delta := &model.CounterDelta{ShortCode: shortCode, PV: 1, Visitors: []string{visitorID}, AccessTime: at}
+	if source != "" {
+		delta.Sources = map[string]int64{source: 1}
+	}
+	return delta
+}
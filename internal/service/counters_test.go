@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"octopus/internal/mocks"
+)
+
+func TestCounterBuffer_Flush(t *testing.T) {
+	ctx := context.Background()
+	at := time.Date(2026, 10, 16, 9, 0, 30, 0, time.UTC)
+
+	t.Run("aggregates clicks per short link", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRedis := mocks.NewMockCache(ctrl)
+		b := newCounterBuffer(mockRedis, &config.WriteBehindConfig{FlushInterval: time.Hour})
+
+		b.Record(ctx, "ABCD", "1.1.1.1", "google", at)
+		b.Record(ctx, "ABCD", "1.1.1.1", "google", at)
+		b.Record(ctx, "ABCD", "2.2.2.2", "direct", at)
+		b.Record(ctx, "XYZ", "1.1.1.1", "", at)
+
+		mockRedis.EXPECT().ApplyCounters(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, deltas []*model.CounterDelta) error {
+			require.Len(t, deltas, 2)
+			byCode := map[string]*model.CounterDelta{}
+			for _, d := range deltas {
+				byCode[d.ShortCode] = d
+			}
+			assert.Equal(t, int64(3), byCode["ABCD"].PV)
+			assert.Equal(t, []string{"1.1.1.1", "2.2.2.2"}, byCode["ABCD"].Visitors)
+			assert.Equal(t, map[string]int64{"google": 2, "direct": 1}, byCode["ABCD"].Sources)
+			assert.Equal(t, int64(1), byCode["XYZ"].PV)
+			assert.Empty(t, byCode["XYZ"].Sources)
+			return nil
+		})
+		b.Flush(ctx)
+
+		// Nothing buffered, nothing sent
+		b.Flush(ctx)
+	})
+
+	t.Run("keeps clicks of each minute apart", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRedis := mocks.NewMockCache(ctrl)
+		b := newCounterBuffer(mockRedis, &config.WriteBehindConfig{FlushInterval: time.Hour})
+		beforeMidnight := time.Date(2026, 10, 16, 23, 59, 50, 0, time.UTC)
+		afterMidnight := beforeMidnight.Add(20 * time.Second)
+		b.Record(ctx, "ABCD", "1.1.1.1", "google", beforeMidnight)
+		b.Record(ctx, "ABCD", "1.1.1.1", "google", beforeMidnight.Add(5*time.Second))
+		b.Record(ctx, "ABCD", "2.2.2.2", "google", afterMidnight)
+
+		mockRedis.EXPECT().ApplyCounters(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, deltas []*model.CounterDelta) error {
+			require.Len(t, deltas, 2)
+			byTime := map[time.Time]*model.CounterDelta{}
+			for _, d := range deltas {
+				byTime[d.AccessTime] = d
+			}
+			assert.Equal(t, int64(2), byTime[beforeMidnight].PV)
+			assert.Equal(t, []string{"2.2.2.2"}, byTime[afterMidnight].Visitors)
+			return nil
+		})
+		b.Flush(ctx)
+	})
+
+	t.Run("drops clicks Redis rejected", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRedis := mocks.NewMockCache(ctrl)
+		b := newCounterBuffer(mockRedis, &config.WriteBehindConfig{FlushInterval: time.Hour})
+		b.Record(ctx, "ABCD", "1.1.1.1", "google", at)
+		b.Record(ctx, "ABCD", "1.1.1.1", "google", at)
+
+		mockRedis.EXPECT().ApplyCounters(gomock.Any(), gomock.Any()).Return(errors.New("redis down"))
+		b.Flush(ctx)
+		assert.Equal(t, int64(2), b.dropped.Load())
+	})
+}
+
+func TestCounterBuffer_Run(t *testing.T) {
+	ctx := context.Background()
+	at := time.Date(2026, 10, 16, 9, 0, 30, 0, time.UTC)
+
+	t.Run("flushes early when full", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRedis := mocks.NewMockCache(ctrl)
+		flushed := make(chan int, 1)
+		mockRedis.EXPECT().ApplyCounters(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, deltas []*model.CounterDelta) error {
+			flushed <- len(deltas)
+			return nil
+		})
+
+		b := NewCounterBuffer(mockRedis, &config.WriteBehindConfig{FlushInterval: time.Hour, MaxKeys: 2})
+		b.Record(ctx, "ABCD", "1.1.1.1", "google", at)
+		b.Record(ctx, "XYZ", "1.1.1.1", "google", at)
+
+		select {
+		case n := <-flushed:
+			assert.Equal(t, 2, n)
+		case <-time.After(time.Second):
+			t.Fatal("buffer was not flushed")
+		}
+		b.Close()
+	})
+
+	t.Run("close flushes and writes later clicks through", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRedis := mocks.NewMockCache(ctrl)
+		b := NewCounterBuffer(mockRedis, &config.WriteBehindConfig{FlushInterval: time.Hour})
+		b.Record(ctx, "ABCD", "1.1.1.1", "google", at)
+
+		gomock.InOrder(
+			mockRedis.EXPECT().ApplyCounters(gomock.Any(), gomock.Len(1)).Return(nil),
+			mockRedis.EXPECT().ApplyCounters(gomock.Any(), []*model.CounterDelta{
+				{ShortCode: "XYZ", PV: 1, Visitors: []string{"1.1.1.1"}, Sources: map[string]int64{"direct": 1}, AccessTime: at},
+			}).Return(nil),
+		)
+		b.Close()
+		b.Close()
+		b.Record(ctx, "XYZ", "1.1.1.1", "direct", at)
+	})
+}
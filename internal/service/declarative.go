@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"octopus/internal/encoder"
+	"octopus/internal/model"
+	"octopus/internal/mq"
+	"octopus/pkg/util"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrInvalidAlias is returned when an alias of a declarative link is not a valid short code
+	ErrInvalidAlias = errors.New("invalid alias")
+	// ErrAliasTaken is returned when an alias of a declarative link belongs to a link not managed as code
+	ErrAliasTaken = errors.New("alias taken by an unmanaged short link")
+)
+
+// declarativePlan is the diff between the desired and the stored managed links
+type declarativePlan struct {
+	create  []*model.ShortLink
+	update  []*model.ShortLink
+	disable []*model.ShortLink
+}
+
+// Reconcile brings the links managed as code to the desired state: missing aliases are created,
+// changed ones updated and managed links left out of the request disabled. In self-serve mode the
+// desired state only covers the managed links of the caller's API key, and aliases managed by
+// another key are refused. Reconciling the same state again changes nothing, and a failed reconcile
+// none. With dryRun the diff is computed without
+// applying it.
+func (s *ShortLinkService) Reconcile(ctx context.Context, req *model.DeclarativeRequest, dryRun bool) (*model.DeclarativeResponse, error) {
+	if s.readOnly {
+		return nil, ErrReadOnlyReplica
+	}
+
+	// Each API key manages its own links, so that a caller cannot disable those of another
+	owner := s.claims.Owner(ctx)
+	if s.claims != nil && owner == "" {
+		return nil, ErrClaimUnauthenticated
+	}
+
+	plan, resp, err := s.planReconcile(ctx, req, owner)
+	if err != nil {
+		return nil, err
+	}
+	resp.DryRun = dryRun
+	if dryRun {
+		return resp, nil
+	}
+
+	// The links change together or not at all, the caches and subscribers hearing of them once
+	// they did
+	err = s.mysqlRepo.WithTx(ctx, func(ctx context.Context) error {
+		for _, sl := range plan.create {
+			if err := s.mysqlRepo.SaveShortLink(ctx, sl); err != nil {
+				return fmt.Errorf("failed to create %s: %w", sl.ShortCode, err)
+			}
+		}
+		for _, sl := range plan.update {
+			if err := s.mysqlRepo.UpdateShortLink(ctx, sl); err != nil {
+				return fmt.Errorf("failed to update %s: %w", sl.ShortCode, err)
+			}
+		}
+		for _, sl := range plan.disable {
+			if err := s.mysqlRepo.DeactivateShortLink(ctx, sl.ShortCode); err != nil {
+				return fmt.Errorf("failed to disable %s: %w", sl.ShortCode, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sl := range plan.create {
+		if err := s.bloomSvc.Add(ctx, sl.ShortCode); err != nil {
+			log.Warn().Err(err).Str("short_code", sl.ShortCode).Msg("Failed to add to Bloom Filter")
+		}
+		s.publishLinkEvent(ctx, mq.EventTypeLinkCreated, sl)
+	}
+	for _, sl := range plan.update {
+		s.dropCached(ctx, sl.ShortCode)
+		s.publishLinkEvent(ctx, mq.EventTypeLinkUpdated, sl)
+	}
+	for _, sl := range plan.disable {
+		s.dropCached(ctx, sl.ShortCode)
+		s.publishLinkEvent(ctx, mq.EventTypeLinkDeleted, sl)
+	}
+
+	log.Info().
+		Int("created", len(resp.Created)).
+		Int("updated", len(resp.Updated)).
+		Int("disabled", len(resp.Disabled)).
+		Msg("Reconciled declarative short links")
+
+	return resp, nil
+}
+
+// planReconcile validates the desired links and compares them with the stored ones managed by owner
+func (s *ShortLinkService) planReconcile(ctx context.Context, req *model.DeclarativeRequest, owner string) (*declarativePlan, *model.DeclarativeResponse, error) {
+	aliases := make([]string, 0, len(req.Links))
+	desired := make(map[string]struct{}, len(req.Links))
+	for _, link := range req.Links {
+		if !s.validAlias(link.Alias) {
+			return nil, nil, fmt.Errorf("%w: %q must be %d to 6 characters of the short code alphabet",
+				ErrInvalidAlias, link.Alias, s.minLength)
+		}
+		if s.blocked(link.URL, nil) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrBlockedURL, link.URL)
+		}
+		if _, dup := desired[link.Alias]; dup {
+			return nil, nil, fmt.Errorf("%w: %q is listed twice", ErrInvalidAlias, link.Alias)
+		}
+		desired[link.Alias] = struct{}{}
+		aliases = append(aliases, link.Alias)
+	}
+
+	stored, err := s.mysqlRepo.GetShortLinksByCodes(ctx, aliases)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get short links: %w", err)
+	}
+	existing := make(map[string]*model.ShortLink, len(stored))
+	for i := range stored {
+		existing[stored[i].ShortCode] = &stored[i]
+	}
+
+	managed, err := s.mysqlRepo.GetManagedShortLinks(ctx, owner)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get managed short links: %w", err)
+	}
+
+	plan := &declarativePlan{}
+	resp := &model.DeclarativeResponse{
+		Created:   []string{},
+		Updated:   []string{},
+		Disabled:  []string{},
+		Unchanged: []string{},
+	}
+	for _, link := range req.Links {
+		sl, ok := existing[link.Alias]
+		if !ok {
+			plan.create = append(plan.create, newManagedLink(link, owner))
+			resp.Created = append(resp.Created, link.Alias)
+			continue
+		}
+		if !sl.Managed {
+			return nil, nil, fmt.Errorf("%w: %q", ErrAliasTaken, link.Alias)
+		}
+		if sl.Owner != owner {
+			return nil, nil, fmt.Errorf("%w: %q", ErrNotOwner, link.Alias)
+		}
+		if !applyDeclarativeLink(sl, link) {
+			resp.Unchanged = append(resp.Unchanged, link.Alias)
+			continue
+		}
+		plan.update = append(plan.update, sl)
+		resp.Updated = append(resp.Updated, link.Alias)
+	}
+	for i := range managed {
+		if _, ok := desired[managed[i].ShortCode]; !ok {
+			plan.disable = append(plan.disable, &managed[i])
+			resp.Disabled = append(resp.Disabled, managed[i].ShortCode)
+		}
+	}
+
+	return plan, resp, nil
+}
+
+// validAlias checks if an alias is a short code outside the SMS pool spelled exactly as the
+// encoder writes it, as cache keys are case-sensitive
+func (s *ShortLinkService) validAlias(alias string) bool {
+	return validAlias(s.encoder, s.minLength, alias)
+}
+
+// validAlias checks if an alias is a short code of enc at least minLength long, spelled exactly as
+// enc writes it
+func validAlias(enc *encoder.Base32Encoder, minLength int, alias string) bool {
+	if !enc.IsValid(alias) || len(alias) < minLength {
+		return false
+	}
+	n, err := enc.Decode(alias)
+	return err == nil && enc.Encode(n, len(alias)) == alias
+}
+
+// newManagedLink builds a short link of owner for an alias not stored yet. Managed links have no
+// dedup hash, so generated links never share them and their destination can change freely.
+func newManagedLink(link model.DeclarativeLink, owner string) *model.ShortLink {
+	urlHash, _ := util.URLHash(link.URL)
+	return &model.ShortLink{
+		ShortCode:   link.Alias,
+		OriginalURL: link.URL,
+		URLHash:     urlHash,
+		Status:      1,
+		Title:       link.Title,
+		Description: link.Description,
+		Notes:       link.Notes,
+		Managed:     true,
+		Owner:       owner,
+	}
+}
+
+// applyDeclarativeLink updates a stored managed link to its desired state, reactivating it, and
+// reports whether anything changed
+func applyDeclarativeLink(sl *model.ShortLink, link model.DeclarativeLink) bool {
+	if sl.OriginalURL == link.URL && sl.Title == link.Title && sl.Description == link.Description &&
+		sl.Notes == link.Notes && sl.Status == 1 && sl.ExpireAt == nil {
+		return false
+	}
+
+	sl.OriginalURL = link.URL
+	sl.URLHash, _ = util.URLHash(link.URL)
+	sl.Title = link.Title
+	sl.Description = link.Description
+	sl.Notes = link.Notes
+	sl.Status = 1
+	sl.ExpireAt = nil
+	return true
+}
+
+// dropCached removes a changed short link from the cache, it is cached again on the next redirect
+func (s *ShortLinkService) dropCached(ctx context.Context, shortCode string) {
+	if err := s.redisRepo.DeleteShortLink(ctx, shortCode); err != nil {
+		log.Warn().Err(err).Str("short_code", shortCode).Msg("Failed to drop short link from cache")
+	}
+}
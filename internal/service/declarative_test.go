@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/pkg/middleware"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortLinkService_Reconcile(t *testing.T) {
+	desired := &model.DeclarativeRequest{Links: []model.DeclarativeLink{
+		{Alias: "DOCS", URL: "https://docs.example.com", Title: "Docs"},
+		{Alias: "STAT", URL: "https://status.example.com/v2", Title: "Status"},
+		{Alias: "HELP", URL: "https://help.example.com"},
+	}}
+	stored := func() []model.ShortLink {
+		expired := time.Now().Add(-time.Hour)
+		return []model.ShortLink{
+			{ShortCode: "DOCS", OriginalURL: "https://docs.example.com", Title: "Docs", Status: 1, Managed: true},
+			{ShortCode: "STAT", OriginalURL: "https://status.example.com", Title: "Status", Status: 0, ExpireAt: &expired, Managed: true},
+		}
+	}
+	managed := func() []model.ShortLink {
+		return []model.ShortLink{
+			{ShortCode: "DOCS", OriginalURL: "https://docs.example.com", Title: "Docs", Status: 1, Managed: true},
+			{ShortCode: "OLDS", OriginalURL: "https://old.example.com", Status: 1, Managed: true},
+		}
+	}
+
+	t.Run("applies the diff", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockRedis := mocks.NewMockCache(ctrl)
+		mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+		svc := NewShortLinkService(mockMySQL, mockRedis, mockBloom, "https://s.example.com")
+
+		mockMySQL.EXPECT().GetShortLinksByCodes(gomock.Any(), []string{"DOCS", "STAT", "HELP"}).Return(stored(), nil)
+		mockMySQL.EXPECT().GetManagedShortLinks(gomock.Any(), "").Return(managed(), nil)
+		mockMySQL.EXPECT().WithTx(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, fn func(context.Context) error) error {
+			return fn(ctx)
+		})
+		mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, sl *model.ShortLink) error {
+			assert.Equal(t, "HELP", sl.ShortCode)
+			assert.True(t, sl.Managed)
+			assert.Empty(t, sl.DedupHash)
+			assert.NotEmpty(t, sl.URLHash)
+			return nil
+		})
+		mockBloom.EXPECT().Add(gomock.Any(), "HELP").Return(nil)
+		mockMySQL.EXPECT().UpdateShortLink(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, sl *model.ShortLink) error {
+			assert.Equal(t, "STAT", sl.ShortCode)
+			assert.Equal(t, "https://status.example.com/v2", sl.OriginalURL)
+			assert.Equal(t, 1, sl.Status)
+			assert.Nil(t, sl.ExpireAt)
+			return nil
+		})
+		mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "STAT").Return(nil)
+		mockMySQL.EXPECT().DeactivateShortLink(gomock.Any(), "OLDS").Return(nil)
+		mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "OLDS").Return(nil)
+
+		resp, err := svc.Reconcile(context.Background(), desired, false)
+		require.NoError(t, err)
+		assert.False(t, resp.DryRun)
+		assert.Equal(t, []string{"HELP"}, resp.Created)
+		assert.Equal(t, []string{"STAT"}, resp.Updated)
+		assert.Equal(t, []string{"OLDS"}, resp.Disabled)
+		assert.Equal(t, []string{"DOCS"}, resp.Unchanged)
+	})
+
+	t.Run("dry run applies nothing", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		svc := NewShortLinkService(mockMySQL, mocks.NewMockCache(ctrl),
+			mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+
+		mockMySQL.EXPECT().GetShortLinksByCodes(gomock.Any(), gomock.Any()).Return(stored(), nil)
+		mockMySQL.EXPECT().GetManagedShortLinks(gomock.Any(), "").Return(managed(), nil)
+
+		resp, err := svc.Reconcile(context.Background(), desired, true)
+		require.NoError(t, err)
+		assert.True(t, resp.DryRun)
+		assert.Equal(t, []string{"HELP"}, resp.Created)
+		assert.Equal(t, []string{"STAT"}, resp.Updated)
+		assert.Equal(t, []string{"OLDS"}, resp.Disabled)
+	})
+
+	t.Run("invalid aliases", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc := NewShortLinkService(mocks.NewMockDatabase(ctrl), mocks.NewMockCache(ctrl),
+			mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+
+		for _, aliases := range [][]string{{"AB"}, {"TOOLONG"}, {"D0CS"}, {"docs"}, {"DOCS", "DOCS"}} {
+			req := &model.DeclarativeRequest{}
+			for _, alias := range aliases {
+				req.Links = append(req.Links, model.DeclarativeLink{Alias: alias, URL: "https://example.com"})
+			}
+			_, err := svc.Reconcile(context.Background(), req, false)
+			assert.ErrorIs(t, err, ErrInvalidAlias, aliases)
+		}
+	})
+
+	t.Run("alias of an unmanaged link", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		svc := NewShortLinkService(mockMySQL, mocks.NewMockCache(ctrl),
+			mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+
+		mockMySQL.EXPECT().GetShortLinksByCodes(gomock.Any(), gomock.Any()).Return([]model.ShortLink{
+			{ShortCode: "DOCS", OriginalURL: "https://example.com", Status: 1},
+		}, nil)
+		mockMySQL.EXPECT().GetManagedShortLinks(gomock.Any(), "").Return(nil, nil)
+
+		_, err := svc.Reconcile(context.Background(), &model.DeclarativeRequest{Links: []model.DeclarativeLink{
+			{Alias: "DOCS", URL: "https://docs.example.com"},
+		}}, false)
+		assert.ErrorIs(t, err, ErrAliasTaken)
+	})
+
+	t.Run("failed write rolls back", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := repository.NewMemoryRepository()
+		for _, sl := range managed() {
+			require.NoError(t, store.SaveShortLink(context.Background(), &sl))
+		}
+		// Disabling OLDS fails once HELP was created and DOCS updated
+		svc := NewShortLinkService(&failingDeactivateStore{store}, mocks.NewMockCache(ctrl),
+			mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+
+		_, err := svc.Reconcile(context.Background(), &model.DeclarativeRequest{Links: []model.DeclarativeLink{
+			{Alias: "DOCS", URL: "https://docs.example.com/v2", Title: "Docs"},
+			{Alias: "HELP", URL: "https://help.example.com"},
+		}}, false)
+		assert.ErrorIs(t, err, repository.ErrUnavailable)
+
+		// Nothing was written, and no bloom filter, cache or subscriber heard of the links
+		docs, err := store.GetShortLinkByCode(context.Background(), "DOCS")
+		require.NoError(t, err)
+		assert.Equal(t, "https://docs.example.com", docs.OriginalURL)
+		_, err = store.GetShortLinkByCode(context.Background(), "HELP")
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+
+	t.Run("scoped to the API key in self-serve mode", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		svc := NewShortLinkService(mockMySQL, mocks.NewMockCache(ctrl),
+			mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+		svc.SetClaims(newTestClaims(t, repository.NewMemoryRepository(), fakeTXTResolver{}))
+
+		_, err := svc.Reconcile(context.Background(), desired, true)
+		assert.ErrorIs(t, err, ErrClaimUnauthenticated)
+
+		ctx := middleware.WithAPIKey(context.Background(), "key-1")
+		owner := svc.claims.Owner(ctx)
+		mockMySQL.EXPECT().GetShortLinksByCodes(gomock.Any(), gomock.Any()).Return(nil, nil)
+		mockMySQL.EXPECT().GetManagedShortLinks(gomock.Any(), owner).Return(nil, nil)
+
+		resp, err := svc.Reconcile(ctx, desired, true)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"DOCS", "STAT", "HELP"}, resp.Created)
+	})
+
+	t.Run("leaves the links of other API keys alone", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := repository.NewMemoryRepository()
+		mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+		svc := NewShortLinkService(store, mocks.NewMockCache(ctrl), mockBloom, "https://s.example.com")
+		svc.SetClaims(newTestClaims(t, store, fakeTXTResolver{}))
+
+		first := middleware.WithAPIKey(context.Background(), "key-1")
+		second := middleware.WithAPIKey(context.Background(), "key-2")
+		mockBloom.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		_, err := svc.Reconcile(first, &model.DeclarativeRequest{Links: []model.DeclarativeLink{
+			{Alias: "DOCS", URL: "https://docs.example.com"},
+		}}, false)
+		require.NoError(t, err)
+
+		// Another key neither disables the link by leaving it out nor overwrites it by listing it
+		resp, err := svc.Reconcile(second, &model.DeclarativeRequest{Links: []model.DeclarativeLink{
+			{Alias: "HELP", URL: "https://help.example.com"},
+		}}, false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"HELP"}, resp.Created)
+		assert.Empty(t, resp.Disabled)
+
+		_, err = svc.Reconcile(second, &model.DeclarativeRequest{Links: []model.DeclarativeLink{
+			{Alias: "DOCS", URL: "https://evil.example.com"},
+			{Alias: "HELP", URL: "https://help.example.com"},
+		}}, false)
+		assert.ErrorIs(t, err, ErrNotOwner)
+
+		docs, err := store.GetShortLinkByCode(context.Background(), "DOCS")
+		require.NoError(t, err)
+		assert.Equal(t, "https://docs.example.com", docs.OriginalURL)
+		assert.Equal(t, 1, docs.Status)
+		assert.Equal(t, svc.claims.Owner(first), docs.Owner)
+	})
+
+	t.Run("storage unavailable", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		svc := NewShortLinkService(mockMySQL, mocks.NewMockCache(ctrl),
+			mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+
+		mockMySQL.EXPECT().GetShortLinksByCodes(gomock.Any(), gomock.Any()).Return(nil, repository.ErrUnavailable)
+
+		_, err := svc.Reconcile(context.Background(), desired, false)
+		assert.ErrorIs(t, err, repository.ErrUnavailable)
+	})
+}
+
+// failingDeactivateStore fails to disable links as if the database went away
+type failingDeactivateStore struct {
+	*repository.MemoryRepository
+}
+
+func (s *failingDeactivateStore) DeactivateShortLink(_ context.Context, shortCode string) error {
+	return fmt.Errorf("%w: disabling %s", repository.ErrUnavailable, shortCode)
+}
@@ -0,0 +1,585 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/internal/storage"
+	"octopus/pkg/async"
+	"octopus/pkg/clock"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// Headers of the batches posted to log drains
+const (
+	// DrainTimestampHeader carries the Unix time a batch was signed at
+	DrainTimestampHeader = "X-Octopus-Timestamp"
+	// DrainSignatureHeader carries the signature of a batch, see SignDrainBatch
+	DrainSignatureHeader = "X-Octopus-Signature"
+)
+
+// maxDrainCampaigns bounds the campaigns of links remembered between two refreshes of the drains
+const maxDrainCampaigns = 100000
+
+// ErrDrainLimit is returned when registering a drain for a link or campaign having the most allowed
+var ErrDrainLimit = errors.New("too many log drains")
+
+// SignDrainBatch returns the signature of a batch posted to a log drain: "sha256=" followed by the
+// hex HMAC-SHA256 of the timestamp header, a dot and the body, keyed with the secret of the drain.
+// Receivers recompute it and reject old timestamps to stop replays.
+func SignDrainBatch(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// LogDrainService forwards the stored access events of links to the endpoints their owners
+// registered, for one link or for the links of a campaign. Drains are kept in a Redis hash every
+// instance reloads, and their events are buffered and posted in the background by a goroutine per
+// drain, so an endpoint that is slow or down never holds up the consumer, the other drains or the
+// reloads.
+type LogDrainService struct {
+	client redis.Cmdable
+	links  storage.LinkStore
+	cfg    *config.DrainsConfig
+	param  string
+	http   *http.Client
+	clock  clock.Clock
+	claims *ClaimService
+
+	mu        sync.RWMutex
+	drains    map[string]*logDrain
+	campaigns map[string]drainLink
+
+	full      chan struct{}
+	senders   sync.WaitGroup
+	delivered atomic.Int64
+	failed    atomic.Int64
+	retries   atomic.Int64
+	dropped   atomic.Int64
+}
+
+// logDrain is a registered drain along with the events waiting to be posted to it, and whether a
+// goroutine is posting them
+type logDrain struct {
+	model.LogDrain
+	mu      sync.Mutex
+	pending []model.AccessEvent
+	sending bool
+}
+
+// drainLink is what drains need to know of a link: its campaign and its owner
+type drainLink struct {
+	campaign string
+	owner    string
+}
+
+// NewLogDrainService creates a new Log Drain Service, campaigns being the values of param in the
+// params of links
+func NewLogDrainService(client redis.Cmdable, links storage.LinkStore, cfg *config.DrainsConfig, param string) *LogDrainService {
+	return &LogDrainService{
+		client:    client,
+		links:     links,
+		cfg:       cfg,
+		param:     param,
+		http:      &http.Client{Timeout: cfg.Timeout},
+		clock:     clock.Real,
+		drains:    make(map[string]*logDrain),
+		campaigns: make(map[string]drainLink),
+		full:      make(chan struct{}, 1),
+	}
+}
+
+// SetClaims restricts drains to the owners of links: the drains of a link are registered, listed
+// and removed by its owner only, and the drains of a campaign belong to the API key registering
+// them and only forward the events of its own links
+func (ds *LogDrainService) SetClaims(claims *ClaimService) {
+	ds.claims = claims
+}
+
+// authorize checks that the caller may manage the drains of a link or of a campaign, returning the
+// owner its drains belong to, empty without claims
+func (ds *LogDrainService) authorize(ctx context.Context, shortCode string) (string, error) {
+	if ds.claims == nil {
+		return "", nil
+	}
+	if shortCode != "" {
+		if err := ds.claims.Authorize(ctx, shortCode); err != nil {
+			return "", err
+		}
+	}
+	owner := ds.claims.Owner(ctx)
+	if owner == "" {
+		return "", ErrClaimUnauthenticated
+	}
+	return owner, nil
+}
+
+// Create registers a drain for a link or a campaign, returning it with the secret its batches are
+// signed with
+func (ds *LogDrainService) Create(ctx context.Context, req *model.LogDrainRequest) (*model.LogDrain, error) {
+	owner, err := ds.authorize(ctx, req.ShortCode)
+	if err != nil {
+		return nil, err
+	}
+	if req.ShortCode != "" {
+		exists, err := ds.links.CheckExistsByCode(ctx, req.ShortCode)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrShortLinkNotFound
+		}
+	}
+
+	drains, err := ds.List(ctx, req.ShortCode, req.Campaign)
+	if err != nil {
+		return nil, err
+	}
+	if len(drains) >= ds.cfg.MaxPerScope {
+		return nil, ErrDrainLimit
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	drain := model.LogDrain{
+		ID:        uuid.NewString(),
+		ShortCode: req.ShortCode,
+		Campaign:  req.Campaign,
+		URL:       req.URL,
+		Secret:    hex.EncodeToString(secret),
+		Owner:     owner,
+		CreatedAt: ds.clock.Now().UTC(),
+	}
+	value, err := json.Marshal(drain)
+	if err != nil {
+		return nil, err
+	}
+	if err := ds.client.HSet(ctx, ds.cfg.Key, drain.ID, value).Err(); err != nil {
+		return nil, fmt.Errorf("failed to save log drain: %w", err)
+	}
+
+	ds.mu.Lock()
+	ds.drains[drain.ID] = &logDrain{LogDrain: drain}
+	ds.mu.Unlock()
+	drain.Owner = ""
+	return &drain, nil
+}
+
+// List returns the drains of a link or a campaign, oldest first and without their secrets. With
+// claims, the drains of a campaign are the ones of the caller.
+func (ds *LogDrainService) List(ctx context.Context, shortCode, campaign string) ([]model.LogDrain, error) {
+	owner, err := ds.authorize(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if err := ds.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	ds.mu.RLock()
+	drains := make([]model.LogDrain, 0)
+	for _, drain := range ds.drains {
+		if drain.ShortCode == shortCode && drain.Campaign == campaign && (shortCode != "" || drain.Owner == owner) {
+			listed := drain.LogDrain
+			listed.Secret, listed.Owner = "", ""
+			drains = append(drains, listed)
+		}
+	}
+	ds.mu.RUnlock()
+
+	sort.Slice(drains, func(i, j int) bool { return drains[i].CreatedAt.Before(drains[j].CreatedAt) })
+	return drains, nil
+}
+
+// Delete removes a drain on every instance, the events not posted yet being dropped. It reports
+// whether the drain existed; with claims, drains the caller may not manage are reported missing.
+func (ds *LogDrainService) Delete(ctx context.Context, id string) (bool, error) {
+	if ds.claims != nil {
+		value, err := ds.client.HGet(ctx, ds.cfg.Key, id).Result()
+		if errors.Is(err, redis.Nil) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to load log drain: %w", err)
+		}
+		var drain model.LogDrain
+		if err := json.Unmarshal([]byte(value), &drain); err != nil {
+			return false, fmt.Errorf("failed to load log drain: %w", err)
+		}
+		owner, err := ds.authorize(ctx, drain.ShortCode)
+		if err != nil {
+			return false, err
+		}
+		if drain.ShortCode == "" && drain.Owner != owner {
+			return false, nil
+		}
+	}
+
+	deleted, err := ds.client.HDel(ctx, ds.cfg.Key, id).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete log drain: %w", err)
+	}
+
+	ds.mu.Lock()
+	if drain, ok := ds.drains[id]; ok {
+		drain.drop()
+	}
+	delete(ds.drains, id)
+	ds.mu.Unlock()
+	return deleted > 0, nil
+}
+
+// Refresh loads the drains registered on any instance, keeping the events buffered for the ones
+// still registered. The campaigns of links are looked up again afterwards, as they may change.
+func (ds *LogDrainService) Refresh(ctx context.Context) error {
+	values, err := ds.client.HGetAll(ctx, ds.cfg.Key).Result()
+	if err != nil {
+		return fmt.Errorf("failed to load log drains: %w", err)
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	drains := make(map[string]*logDrain, len(values))
+	for id, value := range values {
+		if drain, ok := ds.drains[id]; ok {
+			drains[id] = drain
+			continue
+		}
+		var drain model.LogDrain
+		if err := json.Unmarshal([]byte(value), &drain); err != nil {
+			log.Warn().Err(err).Str("drain", id).Msg("Ignoring malformed log drain")
+			continue
+		}
+		drain.ID = id
+		drains[id] = &logDrain{LogDrain: drain}
+	}
+	for id, drain := range ds.drains {
+		if _, ok := drains[id]; !ok {
+			drain.drop()
+		}
+	}
+	ds.drains = drains
+	ds.campaigns = make(map[string]drainLink)
+	return nil
+}
+
+// AddAccessLog buffers a stored access log for the drains of its link and of its campaign, the
+// drains of a campaign registered by an owner only getting the events of its links. It is dropped
+// for the drains whose buffer is full.
+func (ds *LogDrainService) AddAccessLog(ctx context.Context, accessLog *model.AccessLog) {
+	ds.mu.RLock()
+	var matched []*logDrain
+	byCampaign := false
+	for _, drain := range ds.drains {
+		if drain.ShortCode == accessLog.ShortCode {
+			matched = append(matched, drain)
+		}
+		byCampaign = byCampaign || drain.Campaign != ""
+	}
+	ds.mu.RUnlock()
+
+	// Links are only looked up when some drains follow a campaign
+	if byCampaign {
+		if link := ds.link(ctx, accessLog.ShortCode); link.campaign != "" {
+			ds.mu.RLock()
+			for _, drain := range ds.drains {
+				if drain.Campaign == link.campaign && (drain.Owner == "" || drain.Owner == link.owner) {
+					matched = append(matched, drain)
+				}
+			}
+			ds.mu.RUnlock()
+		}
+	}
+	if len(matched) == 0 {
+		return
+	}
+
+	event := model.NewAccessEvent(accessLog)
+	full := false
+	for _, drain := range matched {
+		drain.mu.Lock()
+		if len(drain.pending) >= ds.cfg.BufferSize {
+			drain.mu.Unlock()
+			ds.dropped.Add(1)
+			log.Warn().Str("drain", drain.ID).Str("short_code", accessLog.ShortCode).Msg("Log drain buffer full, dropping event")
+			continue
+		}
+		drain.pending = append(drain.pending, event)
+		full = full || len(drain.pending) >= ds.cfg.BatchSize
+		drain.mu.Unlock()
+	}
+
+	// Post early instead of waiting for the interval when many events come in
+	if full {
+		select {
+		case ds.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// link returns the campaign and owner of a link, empty when it cannot be looked up
+func (ds *LogDrainService) link(ctx context.Context, shortCode string) drainLink {
+	ds.mu.RLock()
+	link, ok := ds.campaigns[shortCode]
+	ds.mu.RUnlock()
+	if ok {
+		return link
+	}
+
+	// Disabled links are looked up too, as single-use links are disabled by the click being logged
+	links, err := ds.links.GetShortLinksByCodes(ctx, []string{shortCode})
+	if err != nil {
+		log.Warn().Err(err).Str("short_code", shortCode).Msg("Failed to look up the campaign of a link")
+		return drainLink{}
+	}
+	if len(links) > 0 {
+		link.campaign, _ = links[0].DecodedParams()[ds.param].(string)
+		link.owner = links[0].Owner
+	}
+
+	ds.mu.Lock()
+	if len(ds.campaigns) < maxDrainCampaigns {
+		ds.campaigns[shortCode] = link
+	}
+	ds.mu.Unlock()
+	return link
+}
+
+// Run reloads the drains every refresh interval and starts posting the buffered events every flush
+// interval, or once a batch is buffered, until ctx is done. The events left are posted by Close.
+func (ds *LogDrainService) Run(ctx context.Context) {
+	if err := ds.Refresh(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to refresh log drains")
+	}
+
+	refresh := time.NewTicker(ds.cfg.RefreshInterval)
+	defer refresh.Stop()
+	flush := time.NewTicker(ds.cfg.FlushInterval)
+	defer flush.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-refresh.C:
+			if err := ds.Refresh(ctx); err != nil {
+				log.Warn().Err(err).Msg("Failed to refresh log drains")
+			}
+			continue
+		case <-flush.C:
+		case <-ds.full:
+		}
+		ds.flush(ctx)
+	}
+}
+
+// Close posts the events left once no more events come in, retrying until ctx is done. The
+// goroutines still posting events are waited for first, their events left being posted again.
+func (ds *LogDrainService) Close(ctx context.Context) error {
+	ds.senders.Wait()
+
+	drains := ds.registered()
+	var wg sync.WaitGroup
+	errs := make([]error, len(drains))
+	for i, drain := range drains {
+		if !drain.claim() {
+			continue
+		}
+		wg.Add(1)
+		async.Go(func() {
+			defer wg.Done()
+			errs[i] = ds.send(ctx, drain)
+		})
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// flush starts posting the buffered events of every drain no goroutine is posting to already, in a
+// goroutine of its own so a slow endpoint only delays its own events. Failures are logged per batch.
+func (ds *LogDrainService) flush(ctx context.Context) {
+	for _, drain := range ds.registered() {
+		if !drain.claim() {
+			continue
+		}
+		ds.senders.Add(1)
+		async.Go(func() {
+			defer ds.senders.Done()
+			_ = ds.send(ctx, drain)
+		})
+	}
+}
+
+// registered returns the drains registered
+func (ds *LogDrainService) registered() []*logDrain {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	drains := make([]*logDrain, 0, len(ds.drains))
+	for _, drain := range ds.drains {
+		drains = append(drains, drain)
+	}
+	return drains
+}
+
+// send posts the buffered events of a drain in batches until none are left, including the ones
+// buffered meanwhile, or ctx is done, leaving the others buffered. Failed batches are dropped,
+// their errors joined.
+func (ds *LogDrainService) send(ctx context.Context, drain *logDrain) error {
+	var errs []error
+	for {
+		batch := drain.next(ctx, ds.cfg.BatchSize)
+		if batch == nil {
+			return errors.Join(errs...)
+		}
+		if err := ds.deliver(ctx, &drain.LogDrain, batch); err != nil {
+			errs = append(errs, fmt.Errorf("log drain %s: %w", drain.ID, err))
+		}
+	}
+}
+
+// claim reports whether the drain has events to post and no goroutine posting them, marking it as
+// being posted to if so
+func (d *logDrain) claim() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.sending || len(d.pending) == 0 {
+		return false
+	}
+	d.sending = true
+	return true
+}
+
+// next takes the next batch of up to size events to post, or returns nil once there are none left
+// or ctx is done, the drain no longer being posted to
+func (d *logDrain) next(ctx context.Context, size int) []model.AccessEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.pending) == 0 || ctx.Err() != nil {
+		d.sending = false
+		return nil
+	}
+	n := min(size, len(d.pending))
+	batch := d.pending[:n:n]
+	d.pending = d.pending[n:]
+	if len(d.pending) == 0 {
+		d.pending = nil
+	}
+	return batch
+}
+
+// drop drops the events not posted yet of a drain removed
+func (d *logDrain) drop() {
+	d.mu.Lock()
+	d.pending = nil
+	d.mu.Unlock()
+}
+
+// deliver posts a batch to a drain, retrying failures other than client errors up to the
+// configured attempts with an exponential backoff, and drops it once they are exhausted
+func (ds *LogDrainService) deliver(ctx context.Context, drain *model.LogDrain, events []model.AccessEvent) error {
+	body, err := json.Marshal(model.LogDrainBatch{DrainID: drain.ID, Events: events})
+	if err != nil {
+		return err
+	}
+	backoff := ds.cfg.Backoff
+
+	attempts := 1
+retry:
+	for ; ; attempts++ {
+		var retryable bool
+		retryable, err = ds.post(ctx, drain, body)
+		if err == nil || attempts >= ds.cfg.Attempts || !retryable {
+			break
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			break retry
+		case <-timer.C:
+		}
+		ds.retries.Add(1)
+		backoff *= 2
+	}
+
+	if err != nil {
+		ds.failed.Add(1)
+		ds.dropped.Add(int64(len(events)))
+		log.Warn().Err(err).Str("drain", drain.ID).Int("events", len(events)).Int("attempts", attempts).
+			Msg("Failed to post access events to log drain")
+		return err
+	}
+	ds.delivered.Add(int64(len(events)))
+	return nil
+}
+
+// post signs and posts a batch to a drain, reporting whether a failure may succeed when retried:
+// network failures, 429 and 5xx responses
+func (ds *LogDrainService) post(ctx context.Context, drain *model.LogDrain, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, drain.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("invalid log drain URL: %w", err)
+	}
+	timestamp := ds.clock.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DrainTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(DrainSignatureHeader, SignDrainBatch(drain.Secret, timestamp, body))
+
+	resp, err := ds.http.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to post to log drain: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retryable, fmt.Errorf("failed to post to log drain: endpoint responded %s", resp.Status)
+	}
+	return false, nil
+}
+
+// Stats reports the drains registered and the events buffered and delivered
+func (ds *LogDrainService) Stats() *model.LogDrainStats {
+	ds.mu.RLock()
+	stats := &model.LogDrainStats{Drains: len(ds.drains)}
+	for _, drain := range ds.drains {
+		drain.mu.Lock()
+		stats.Buffered += len(drain.pending)
+		drain.mu.Unlock()
+	}
+	ds.mu.RUnlock()
+
+	stats.Delivered = ds.delivered.Load()
+	stats.Failed = ds.failed.Load()
+	stats.Retries = ds.retries.Load()
+	stats.Dropped = ds.dropped.Load()
+	return stats
+}
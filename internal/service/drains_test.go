@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/pkg/middleware"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLogDrainService(t *testing.T) (*LogDrainService, *mocks.MockDatabase) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { client.Close() })
+	mockMySQL := mocks.NewMockDatabase(gomock.NewController(t))
+	cfg := &config.DrainsConfig{
+		Key: "octopus:drains", RefreshInterval: time.Second, FlushInterval: time.Second,
+		BatchSize: 2, BufferSize: 3, Timeout: time.Second, Attempts: 3, Backoff: time.Millisecond, MaxPerScope: 2,
+	}
+	return NewLogDrainService(client, mockMySQL, cfg, "campaign"), mockMySQL
+}
+
+// drainEndpoint records the batches posted to it, answering with the given statuses in turn
+type drainEndpoint struct {
+	mu       sync.Mutex
+	statuses []int
+	batches  []model.LogDrainBatch
+	headers  []http.Header
+	bodies   [][]byte
+}
+
+func (e *drainEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := http.StatusNoContent
+	if len(e.statuses) > 0 {
+		status, e.statuses = e.statuses[0], e.statuses[1:]
+	}
+	if status == http.StatusNoContent {
+		var batch model.LogDrainBatch
+		_ = json.Unmarshal(body, &batch)
+		e.batches = append(e.batches, batch)
+		e.headers = append(e.headers, r.Header.Clone())
+		e.bodies = append(e.bodies, body)
+	}
+	w.WriteHeader(status)
+}
+
+func TestLogDrainService_Create(t *testing.T) {
+	ctx := context.Background()
+	ds, mockMySQL := newTestLogDrainService(t)
+
+	mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), "NONE").Return(false, nil)
+	_, err := ds.Create(ctx, &model.LogDrainRequest{ShortCode: "NONE", URL: "https://logs.example.com"})
+	assert.ErrorIs(t, err, ErrShortLinkNotFound)
+
+	mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), "ABCD").Return(true, nil).Times(3)
+	first, err := ds.Create(ctx, &model.LogDrainRequest{ShortCode: "ABCD", URL: "https://logs.example.com/a"})
+	require.NoError(t, err)
+	assert.Len(t, first.Secret, 64)
+	_, err = ds.Create(ctx, &model.LogDrainRequest{ShortCode: "ABCD", URL: "https://logs.example.com/b"})
+	require.NoError(t, err)
+	_, err = ds.Create(ctx, &model.LogDrainRequest{ShortCode: "ABCD", URL: "https://logs.example.com/c"})
+	assert.ErrorIs(t, err, ErrDrainLimit)
+
+	// Campaigns have their own limit
+	_, err = ds.Create(ctx, &model.LogDrainRequest{Campaign: "launch", URL: "https://logs.example.com/d"})
+	require.NoError(t, err)
+
+	drains, err := ds.List(ctx, "ABCD", "")
+	require.NoError(t, err)
+	require.Len(t, drains, 2)
+	assert.Equal(t, first.ID, drains[0].ID)
+	assert.Empty(t, drains[0].Secret)
+
+	deleted, err := ds.Delete(ctx, first.ID)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = ds.Delete(ctx, first.ID)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+	drains, err = ds.List(ctx, "ABCD", "")
+	require.NoError(t, err)
+	assert.Len(t, drains, 1)
+}
+
+func TestLogDrainService_Owners(t *testing.T) {
+	ds, mockMySQL := newTestLogDrainService(t)
+	store := repository.NewMemoryRepository()
+	ds.SetClaims(newTestClaims(t, store, fakeTXTResolver{}))
+	owner1 := middleware.WithAPIKey(context.Background(), "key-1")
+	owner2 := middleware.WithAPIKey(context.Background(), "key-2")
+	require.NoError(t, store.SaveShortLink(owner1, &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com", Owner: ownerOf("key-1")}))
+
+	// The drains of a link are managed by its owner only
+	_, err := ds.Create(context.Background(), &model.LogDrainRequest{Campaign: "launch", URL: "https://logs.example.com"})
+	assert.ErrorIs(t, err, ErrClaimUnauthenticated)
+	_, err = ds.Create(owner2, &model.LogDrainRequest{ShortCode: "ABCD", URL: "https://logs.example.com"})
+	assert.ErrorIs(t, err, ErrNotOwner)
+	mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), "ABCD").Return(true, nil)
+	byLink, err := ds.Create(owner1, &model.LogDrainRequest{ShortCode: "ABCD", URL: "https://logs.example.com/link"})
+	require.NoError(t, err)
+	assert.Empty(t, byLink.Owner)
+	_, err = ds.List(owner2, "ABCD", "")
+	assert.ErrorIs(t, err, ErrNotOwner)
+	_, err = ds.Delete(owner2, byLink.ID)
+	assert.ErrorIs(t, err, ErrNotOwner)
+
+	// The drains of a campaign belong to the key registering them, and get the events of its links
+	mine, err := ds.Create(owner1, &model.LogDrainRequest{Campaign: "launch", URL: "https://logs.example.com/mine"})
+	require.NoError(t, err)
+	theirs, err := ds.Create(owner2, &model.LogDrainRequest{Campaign: "launch", URL: "https://logs.example.com/theirs"})
+	require.NoError(t, err)
+	drains, err := ds.List(owner2, "", "launch")
+	require.NoError(t, err)
+	require.Len(t, drains, 1)
+	assert.Equal(t, theirs.ID, drains[0].ID)
+	assert.Empty(t, drains[0].Owner)
+	deleted, err := ds.Delete(owner2, mine.ID)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+
+	mockMySQL.EXPECT().GetShortLinksByCodes(gomock.Any(), []string{"ABCD"}).
+		Return([]model.ShortLink{{ShortCode: "ABCD", Owner: ownerOf("key-1"), Params: json.RawMessage(`{"campaign":"launch"}`)}}, nil)
+	ds.AddAccessLog(context.Background(), &model.AccessLog{ShortCode: "ABCD", AccessTime: time.Now()})
+	assert.Len(t, ds.drains[byLink.ID].pending, 1)
+	assert.Len(t, ds.drains[mine.ID].pending, 1)
+	assert.Empty(t, ds.drains[theirs.ID].pending)
+}
+
+func TestLogDrainService_Deliver(t *testing.T) {
+	ctx := context.Background()
+	ds, mockMySQL := newTestLogDrainService(t)
+	endpoint := &drainEndpoint{statuses: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), "ABCD").Return(true, nil)
+	byLink, err := ds.Create(ctx, &model.LogDrainRequest{ShortCode: "ABCD", URL: server.URL + "/link"})
+	require.NoError(t, err)
+	byCampaign, err := ds.Create(ctx, &model.LogDrainRequest{Campaign: "launch", URL: server.URL + "/campaign"})
+	require.NoError(t, err)
+
+	// Campaigns are looked up once per link between refreshes
+	mockMySQL.EXPECT().GetShortLinksByCodes(gomock.Any(), []string{"ABCD"}).
+		Return([]model.ShortLink{{ShortCode: "ABCD", Params: json.RawMessage(`{"campaign":"launch"}`)}}, nil)
+	mockMySQL.EXPECT().GetShortLinksByCodes(gomock.Any(), []string{"EFGH"}).
+		Return([]model.ShortLink{{ShortCode: "EFGH"}}, nil)
+	accessTime := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	for i, shortCode := range []string{"ABCD", "ABCD", "EFGH", "ABCD", "ABCD"} {
+		eventID := "e" + strconv.Itoa(i)
+		ds.AddAccessLog(ctx, &model.AccessLog{EventID: &eventID, ShortCode: shortCode, AccessTime: accessTime})
+	}
+	// Buffers hold 3 events per drain
+	assert.Equal(t, &model.LogDrainStats{Drains: 2, Buffered: 6, Dropped: 2}, ds.Stats())
+
+	require.NoError(t, ds.Close(ctx))
+	stats := ds.Stats()
+	assert.Equal(t, int64(6), stats.Delivered)
+	assert.Equal(t, int64(1), stats.Retries)
+	assert.Zero(t, stats.Buffered)
+
+	// Batches of up to 2 events, signed with the secret of their drain
+	require.Len(t, endpoint.batches, 4)
+	secrets := map[string]string{byLink.ID: byLink.Secret, byCampaign.ID: byCampaign.Secret}
+	for i, batch := range endpoint.batches {
+		assert.NotEmpty(t, batch.Events)
+		assert.LessOrEqual(t, len(batch.Events), 2)
+		timestamp, err := strconv.ParseInt(endpoint.headers[i].Get(DrainTimestampHeader), 10, 64)
+		require.NoError(t, err)
+		assert.Equal(t, SignDrainBatch(secrets[batch.DrainID], timestamp, endpoint.bodies[i]), endpoint.headers[i].Get(DrainSignatureHeader))
+	}
+}
+
+func TestLogDrainService_SlowDrain(t *testing.T) {
+	ctx := context.Background()
+	ds, _ := newTestLogDrainService(t)
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer slow.Close()
+	endpoint := &drainEndpoint{}
+	fast := httptest.NewServer(endpoint)
+	defer fast.Close()
+
+	_, err := ds.Create(ctx, &model.LogDrainRequest{Campaign: "launch", URL: slow.URL})
+	require.NoError(t, err)
+	_, err = ds.Create(ctx, &model.LogDrainRequest{Campaign: "launch", URL: fast.URL})
+	require.NoError(t, err)
+	ds.campaigns["ABCD"] = drainLink{campaign: "launch"}
+	ds.AddAccessLog(ctx, &model.AccessLog{ShortCode: "ABCD"})
+
+	// A drain that does not answer holds up neither the other drains nor the reloads
+	ds.flush(ctx)
+	assert.Eventually(t, func() bool {
+		endpoint.mu.Lock()
+		defer endpoint.mu.Unlock()
+		return len(endpoint.batches) == 1
+	}, time.Second, 5*time.Millisecond)
+	require.NoError(t, ds.Refresh(ctx))
+	ds.campaigns["ABCD"] = drainLink{campaign: "launch"}
+	ds.AddAccessLog(ctx, &model.AccessLog{ShortCode: "ABCD"})
+	ds.flush(ctx)
+	assert.Eventually(t, func() bool {
+		endpoint.mu.Lock()
+		defer endpoint.mu.Unlock()
+		return len(endpoint.batches) == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 1, ds.Stats().Buffered, "the second event of the slow drain waits for the first")
+
+	close(release)
+	require.NoError(t, ds.Close(ctx))
+	assert.Equal(t, int64(4), ds.Stats().Delivered)
+}
+
+func TestLogDrainService_DeliverClientError(t *testing.T) {
+	ctx := context.Background()
+	ds, _ := newTestLogDrainService(t)
+	endpoint := &drainEndpoint{statuses: []int{http.StatusGone}}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	_, err := ds.Create(ctx, &model.LogDrainRequest{Campaign: "launch", URL: server.URL})
+	require.NoError(t, err)
+	ds.campaigns["ABCD"] = drainLink{campaign: "launch"}
+	ds.AddAccessLog(ctx, &model.AccessLog{ShortCode: "ABCD"})
+
+	// Client errors are not retried
+	assert.ErrorContains(t, ds.Close(ctx), "endpoint responded 410 Gone")
+	assert.Equal(t, &model.LogDrainStats{Drains: 1, Failed: 1, Dropped: 1}, ds.Stats())
+	assert.Empty(t, endpoint.batches)
+}
+
+func TestSignDrainBatch(t *testing.T) {
+	signature := SignDrainBatch("secret", 1792141200, []byte(`{"drain_id":"d1","events":[]}`))
+	assert.Regexp(t, "^sha256=[0-9a-f]{64}$", signature)
+	assert.NotEqual(t, signature, SignDrainBatch("secret", 1792141201, []byte(`{"drain_id":"d1","events":[]}`)))
+	assert.NotEqual(t, signature, SignDrainBatch("other", 1792141200, []byte(`{"drain_id":"d1","events":[]}`)))
+}
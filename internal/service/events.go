@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"octopus/internal/model"
+	"octopus/internal/mq"
+	"octopus/pkg/clock"
+	"octopus/pkg/util"
+
+	"github.com/rs/zerolog/log"
+)
+
+// linkEvents lets a service publish lifecycle events of the links it changes, dated by its clock,
+// and purge the redirects the CDN edge cached for them
+type linkEvents struct {
+	publisher EventPublisherInterface
+	purger    EdgePurgerInterface
+	clock     clock.Clock
+}
+
+// SetEventPublisher enables link lifecycle events on the MQ
+func (e *linkEvents) SetEventPublisher(publisher EventPublisherInterface) {
+	e.publisher = publisher
+}
+
+// SetEdgePurger enables purging the cached redirects of changed links from the CDN edge
+func (e *linkEvents) SetEdgePurger(purger EdgePurgerInterface) {
+	e.purger = purger
+}
+
+// EventPublishers publishes link events to every publisher, such as the MQ and the warehouses
+type EventPublishers []EventPublisherInterface
+
+// SendLinkEvent implements EventPublisherInterface, failing with the errors of the publishers that
+// failed once every publisher was tried
+func (p EventPublishers) SendLinkEvent(ctx context.Context, msg *mq.LinkEventMessage) error {
+	var errs []error
+	for _, publisher := range p {
+		if err := publisher.SendLinkEvent(ctx, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// publishLinkEvent publishes a link event, purging the cached redirects of links that existed
+// before. The change is already committed, so failures are only logged; downstream systems can
+// reconcile from MySQL.
+func (e *linkEvents) publishLinkEvent(ctx context.Context, eventType string, sl *model.ShortLink) {
+	if e.purger != nil && eventType != mq.EventTypeLinkCreated {
+		e.purger.Enqueue(sl.ShortCode)
+	}
+	if e.publisher == nil {
+		return
+	}
+
+	msg := &mq.LinkEventMessage{
+		EventID:       util.GenerateUUID(),
+		Type:          eventType,
+		ShortCode:     sl.ShortCode,
+		OriginalURL:   sl.OriginalURL,
+		Pool:          sl.Pool,
+		ExpireAt:      sl.ExpireAt,
+		OccurredAt:    e.clock.Now(),
+		NoClickID:     sl.NoClickID,
+		MaxClicks:     sl.MaxClicks,
+		PreserveQuery: sl.PreserveQuery,
+		PublicStats:   sl.PublicStats,
+		NoTracking:    sl.NoTracking,
+		CacheControl:  sl.CacheControl,
+		SignedParams:  sl.SignedParams,
+		SingleUse:     sl.SingleUse,
+		Referrers:     sl.Referrers,
+		GeoAllow:      sl.GeoAllow,
+		GeoDeny:       sl.GeoDeny,
+		Schedule:      sl.Schedule,
+		Params:        sl.Params,
+	}
+	if err := e.publisher.SendLinkEvent(ctx, msg); err != nil {
+		log.Warn().Err(err).Str("type", eventType).Str("short_code", sl.ShortCode).Msg("Failed to publish link event")
+	}
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/pkg/middleware"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// Features rolled out behind a flag
+const (
+	// FlagWriteBehindAnalytics batches the counters of a click in the write-behind buffer
+	FlagWriteBehindAnalytics = "write_behind_analytics"
+	// FlagRecycledCodes lets the generator hand out recycled short codes
+	FlagRecycledCodes = "recycled_codes"
+	// FlagShadowWrites mirrors writes of a short link to the storage a migration moves it to
+	FlagShadowWrites = "shadow_writes"
+	// FlagShadowReads compares reads of a short link with the storage a migration moves it to
+	FlagShadowReads = "shadow_reads"
+)
+
+// FeatureFlags decides whether a feature is on for a unit of traffic. Rules come from the
+// configuration and are overridden by the rules set at runtime, which are kept in a Redis hash
+// so every instance picks them up on its next refresh. A feature without a rule is fully on, its
+// own settings deciding whether it runs at all.
+type FeatureFlags struct {
+	client   redis.Cmdable
+	key      string
+	defaults map[string]model.FeatureFlag
+
+	mu        sync.RWMutex
+	overrides map[string]model.FeatureFlag
+}
+
+// NewFeatureFlags creates the feature flags with the rules of the configuration
+func NewFeatureFlags(client redis.Cmdable, cfg *config.FlagsConfig) *FeatureFlags {
+	defaults := make(map[string]model.FeatureFlag, len(cfg.Features))
+	for name, feature := range cfg.Features {
+		defaults[name] = model.FeatureFlag{
+			Name:       name,
+			Enabled:    feature.Enabled,
+			Percentage: feature.Percentage,
+			APIKeys:    feature.APIKeys,
+			Source:     model.FeatureFlagSourceConfig,
+		}
+	}
+
+	return &FeatureFlags{
+		client:    client,
+		key:       cfg.Key,
+		defaults:  defaults,
+		overrides: make(map[string]model.FeatureFlag),
+	}
+}
+
+// Enabled reports whether a feature is on for a unit of traffic, such as a short code. Callers
+// whose API key is listed get an enabled feature regardless of the percentage; other units are
+// bucketed by hashing them with the feature name, so raising the percentage only adds units.
+func (f *FeatureFlags) Enabled(ctx context.Context, name, unit string) bool {
+	if f == nil {
+		return true
+	}
+	flag, ok := f.rule(name)
+	if !ok {
+		return true
+	}
+	if !flag.Enabled {
+		return false
+	}
+	if key := middleware.APIKeyFrom(ctx); key != "" && slices.Contains(flag.APIKeys, key) {
+		return true
+	}
+	return flagBucket(name, unit) < flag.Percentage
+}
+
+// rule returns the rule of a feature, an override winning over the configuration
+func (f *FeatureFlags) rule(name string) (model.FeatureFlag, bool) {
+	f.mu.RLock()
+	flag, ok := f.overrides[name]
+	f.mu.RUnlock()
+	if ok {
+		return flag, true
+	}
+	flag, ok = f.defaults[name]
+	return flag, ok
+}
+
+// flagBucket places a unit of traffic in one of 100 buckets of a feature
+func flagBucket(name, unit string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{':'})
+	h.Write([]byte(unit))
+	return int(h.Sum32() % 100)
+}
+
+// Refresh loads the overrides set at runtime, by this instance or others
+func (f *FeatureFlags) Refresh(ctx context.Context) error {
+	values, err := f.client.HGetAll(ctx, f.key).Result()
+	if err != nil {
+		return fmt.Errorf("failed to load feature flags: %w", err)
+	}
+
+	overrides := make(map[string]model.FeatureFlag, len(values))
+	for name, value := range values {
+		var flag model.FeatureFlag
+		if err := json.Unmarshal([]byte(value), &flag); err != nil {
+			log.Warn().Err(err).Str("flag", name).Msg("Ignoring malformed feature flag override")
+			continue
+		}
+		flag.Name = name
+		flag.Source = model.FeatureFlagSourceOverride
+		overrides[name] = flag
+	}
+
+	f.mu.Lock()
+	f.overrides = overrides
+	f.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the overrides every interval until the context is canceled
+func (f *FeatureFlags) Run(ctx context.Context, interval time.Duration) {
+	if err := f.Refresh(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to refresh feature flags")
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := f.Refresh(ctx); err != nil {
+				log.Warn().Err(err).Msg("Failed to refresh feature flags")
+			}
+		}
+	}
+}
+
+// List returns the rule in effect of every configured or overridden feature, sorted by name
+func (f *FeatureFlags) List(ctx context.Context) ([]model.FeatureFlag, error) {
+	if err := f.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	f.mu.RLock()
+	flags := make([]model.FeatureFlag, 0, len(f.defaults)+len(f.overrides))
+	for _, flag := range f.overrides {
+		flags = append(flags, flag)
+	}
+	for name, flag := range f.defaults {
+		if _, ok := f.overrides[name]; !ok {
+			flags = append(flags, flag)
+		}
+	}
+	f.mu.RUnlock()
+
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags, nil
+}
+
+// Set overrides the rule of a feature on every instance
+func (f *FeatureFlags) Set(ctx context.Context, name string, req *model.FeatureFlagRequest) (*model.FeatureFlag, error) {
+	flag := model.FeatureFlag{
+		Name:       name,
+		Enabled:    *req.Enabled,
+		Percentage: req.Percentage,
+		APIKeys:    req.APIKeys,
+		Source:     model.FeatureFlagSourceOverride,
+	}
+	value, err := json.Marshal(flag)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.client.HSet(ctx, f.key, name, value).Err(); err != nil {
+		return nil, fmt.Errorf("failed to save feature flag: %w", err)
+	}
+
+	f.mu.Lock()
+	f.overrides[name] = flag
+	f.mu.Unlock()
+	return &flag, nil
+}
+
+// Delete removes the override of a feature, restoring its configured rule. It reports whether
+// the feature was overridden.
+func (f *FeatureFlags) Delete(ctx context.Context, name string) (bool, error) {
+	removed, err := f.client.HDel(ctx, f.key, name).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete feature flag: %w", err)
+	}
+
+	f.mu.Lock()
+	delete(f.overrides, name)
+	f.mu.Unlock()
+	return removed > 0, nil
+}
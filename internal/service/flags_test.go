@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/pkg/middleware"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFeatureFlags(t *testing.T, features map[string]config.FlagConfig) (*FeatureFlags, *miniredis.Miniredis) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewFeatureFlags(client, &config.FlagsConfig{Key: "octopus:flags", Features: features}), s
+}
+
+// enabledShare counts the units out of 1000 a feature is on for
+func enabledShare(ctx context.Context, f *FeatureFlags, name string) int {
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		if f.Enabled(ctx, name, fmt.Sprintf("unit-%d", i)) {
+			enabled++
+		}
+	}
+	return enabled
+}
+
+func TestFeatureFlags_Enabled(t *testing.T) {
+	ctx := context.Background()
+	f, _ := newTestFeatureFlags(t, map[string]config.FlagConfig{
+		"off":     {Enabled: false, Percentage: 100},
+		"full":    {Enabled: true, Percentage: 100},
+		"partial": {Enabled: true, Percentage: 20, APIKeys: []string{"partner-1"}},
+	})
+
+	assert.True(t, (*FeatureFlags)(nil).Enabled(ctx, "off", "unit"), "no flags leave features on")
+	assert.True(t, f.Enabled(ctx, "unknown", "unit"), "features without a rule stay on")
+	assert.Zero(t, enabledShare(ctx, f, "off"))
+	assert.Equal(t, 1000, enabledShare(ctx, f, "full"))
+	assert.InDelta(t, 200, enabledShare(ctx, f, "partial"), 50)
+
+	// The same unit always gets the same outcome
+	for i := 0; i < 100; i++ {
+		unit := fmt.Sprintf("unit-%d", i)
+		assert.Equal(t, f.Enabled(ctx, "partial", unit), f.Enabled(ctx, "partial", unit))
+	}
+
+	// Listed API keys get the feature whatever their bucket
+	keyCtx := middleware.WithAPIKey(ctx, "partner-1")
+	assert.Equal(t, 1000, enabledShare(keyCtx, f, "partial"))
+	assert.Zero(t, enabledShare(keyCtx, f, "off"))
+	assert.InDelta(t, 200, enabledShare(middleware.WithAPIKey(ctx, "partner-2"), f, "partial"), 50)
+}
+
+func TestFeatureFlags_Overrides(t *testing.T) {
+	ctx := context.Background()
+	f, s := newTestFeatureFlags(t, map[string]config.FlagConfig{
+		FlagRecycledCodes: {Enabled: true, Percentage: 100},
+	})
+	enabled := false
+
+	flag, err := f.Set(ctx, FlagRecycledCodes, &model.FeatureFlagRequest{Enabled: &enabled})
+	require.NoError(t, err)
+	assert.Equal(t, model.FeatureFlagSourceOverride, flag.Source)
+	assert.False(t, f.Enabled(ctx, FlagRecycledCodes, "unit"))
+	assert.True(t, s.Exists("octopus:flags"))
+
+	// Other instances pick the override up on refresh
+	other := NewFeatureFlags(f.client, &config.FlagsConfig{Key: "octopus:flags", Features: map[string]config.FlagConfig{
+		FlagRecycledCodes: {Enabled: true, Percentage: 100},
+	}})
+	assert.True(t, other.Enabled(ctx, FlagRecycledCodes, "unit"))
+	require.NoError(t, other.Refresh(ctx))
+	assert.False(t, other.Enabled(ctx, FlagRecycledCodes, "unit"))
+
+	// Malformed overrides are ignored
+	s.HSet("octopus:flags", "broken", "{")
+	flags, err := f.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, flags, 1)
+	assert.Equal(t, FlagRecycledCodes, flags[0].Name)
+	assert.False(t, flags[0].Enabled)
+
+	deleted, err := f.Delete(ctx, FlagRecycledCodes)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	assert.True(t, f.Enabled(ctx, FlagRecycledCodes, "unit"), "configured rule is restored")
+
+	deleted, err = f.Delete(ctx, FlagRecycledCodes)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+
+	flags, err = f.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []model.FeatureFlag{
+		{Name: FlagRecycledCodes, Enabled: true, Percentage: 100, Source: model.FeatureFlagSourceConfig},
+	}, flags)
+}
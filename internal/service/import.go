@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"octopus/internal/encoder"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/internal/storage"
+	"octopus/pkg/util"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// importBatchSize is the number of codes looked up at once when importing
+	importBatchSize = 1000
+	// maxImportedURLLength and maxImportedTitleLength are the lengths of the short_links columns
+	maxImportedURLLength   = 2048
+	maxImportedTitleLength = 255
+)
+
+// ImportService imports the links of other shorteners under their own codes, as custom aliases
+// keeping their creation date, and seeds their past clicks into the daily aggregates
+type ImportService struct {
+	database  storage.Database
+	bloomSvc  BloomServiceInterface
+	encoder   *encoder.Base32Encoder
+	minLength int
+}
+
+// NewImportService creates a new Import Service
+func NewImportService(database storage.Database, bloomSvc BloomServiceInterface) *ImportService {
+	return &ImportService{
+		database:  database,
+		bloomSvc:  bloomSvc,
+		encoder:   encoder.NewBase32Encoder(),
+		minLength: encoder.MinLength,
+	}
+}
+
+// SetEncoder replaces the default Base32 encoder, e.g. with one using a custom alphabet
+func (is *ImportService) SetEncoder(enc *encoder.Base32Encoder) {
+	is.encoder = enc
+}
+
+// SetSMSCodeLength leaves out the codes of the SMS pool length, reserved for SMS codes
+func (is *ImportService) SetSMSCodeLength(length int) {
+	if length >= is.minLength {
+		is.minLength = length + 1
+	}
+}
+
+// Import stores the links not stored yet. Links whose code is already stored for the same URL are
+// skipped, so an interrupted import can be run again; links whose code is taken by another URL,
+// cannot be served or is listed twice are reported as conflicts. With dryRun nothing is stored.
+func (is *ImportService) Import(ctx context.Context, links []model.ImportedLink, dryRun bool) (*model.ImportReport, error) {
+	report := &model.ImportReport{
+		DryRun:    dryRun,
+		Imported:  make([]string, 0),
+		Skipped:   make([]string, 0),
+		Conflicts: make([]model.ImportConflict, 0),
+	}
+
+	listed := make(map[string]struct{}, len(links))
+	valid := make([]model.ImportedLink, 0, len(links))
+	for _, link := range links {
+		if reason := is.check(link); reason != "" {
+			report.Conflicts = append(report.Conflicts, model.ImportConflict{Code: link.Code, URL: link.URL, Reason: reason})
+			continue
+		}
+		if _, dup := listed[link.Code]; dup {
+			report.Conflicts = append(report.Conflicts, model.ImportConflict{Code: link.Code, URL: link.URL, Reason: "listed twice"})
+			continue
+		}
+		listed[link.Code] = struct{}{}
+		valid = append(valid, link)
+	}
+
+	for start := 0; start < len(valid); start += importBatchSize {
+		end := min(start+importBatchSize, len(valid))
+		if err := is.importBatch(ctx, valid[start:end], report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// check returns why a link cannot be imported, "" when it can
+func (is *ImportService) check(link model.ImportedLink) string {
+	if !validAlias(is.encoder, is.minLength, link.Code) {
+		return fmt.Sprintf("code is not %d to %d characters of the short code alphabet %s",
+			is.minLength, encoder.MaxLength, is.encoder.Alphabet())
+	}
+	if len(link.URL) > maxImportedURLLength {
+		return fmt.Sprintf("URL is longer than %d characters", maxImportedURLLength)
+	}
+	if !strings.HasPrefix(link.URL, "http://") && !strings.HasPrefix(link.URL, "https://") {
+		return "URL is not http or https"
+	}
+	if _, err := util.URLHash(link.URL); err != nil {
+		return "URL is not valid"
+	}
+	return ""
+}
+
+// importBatch imports links whose codes are valid and distinct
+func (is *ImportService) importBatch(ctx context.Context, links []model.ImportedLink, report *model.ImportReport) error {
+	codes := make([]string, len(links))
+	for i, link := range links {
+		codes[i] = link.Code
+	}
+	stored, err := is.database.GetShortLinksByCodes(ctx, codes)
+	if err != nil {
+		return fmt.Errorf("failed to look up short links: %w", err)
+	}
+	existing := make(map[string]model.ShortLink, len(stored))
+	for _, sl := range stored {
+		existing[sl.ShortCode] = sl
+	}
+
+	for _, link := range links {
+		if sl, ok := existing[link.Code]; ok {
+			if sameURL(sl.OriginalURL, link.URL) {
+				report.Skipped = append(report.Skipped, link.Code)
+			} else {
+				report.Conflicts = append(report.Conflicts, model.ImportConflict{
+					Code: link.Code, URL: link.URL, Reason: "code taken by " + sl.OriginalURL,
+				})
+			}
+			continue
+		}
+
+		if !report.DryRun {
+			err := is.save(ctx, link)
+			if errors.Is(err, repository.ErrConflict) {
+				report.Conflicts = append(report.Conflicts, model.ImportConflict{Code: link.Code, URL: link.URL, Reason: "code taken"})
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		report.Imported = append(report.Imported, link.Code)
+		for _, day := range link.Clicks {
+			report.Clicks += day.Clicks
+		}
+	}
+	return nil
+}
+
+// save stores an imported link and seeds its clicks in one transaction, so that a link whose
+// clicks could not be seeded is imported again by the next run rather than skipped
+func (is *ImportService) save(ctx context.Context, link model.ImportedLink) error {
+	urlHash, _ := util.URLHash(link.URL)
+	sl := &model.ShortLink{
+		ShortCode:   link.Code,
+		OriginalURL: link.URL,
+		URLHash:     urlHash,
+		Title:       truncateTitle(link.Title),
+		CreatedAt:   link.CreatedAt,
+		Status:      1,
+	}
+	err := is.database.WithTx(ctx, func(ctx context.Context) error {
+		if err := is.database.SaveShortLink(ctx, sl); err != nil {
+			return fmt.Errorf("failed to import %s: %w", link.Code, err)
+		}
+		for _, day := range link.Clicks {
+			if day.Clicks <= 0 {
+				continue
+			}
+			if err := is.database.AddDailyClicks(ctx, link.Code, day.Day, day.Clicks); err != nil {
+				return fmt.Errorf("failed to seed the clicks of %s: %w", link.Code, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := is.bloomSvc.Add(ctx, link.Code); err != nil {
+		log.Warn().Err(err).Str("short_code", link.Code).Msg("Failed to add to Bloom Filter")
+	}
+	return nil
+}
+
+// sameURL reports whether two URLs are spellings of the same destination
+func sameURL(a, b string) bool {
+	if a == b {
+		return true
+	}
+	na, errA := util.NormalizeURL(a)
+	nb, errB := util.NormalizeURL(b)
+	return errA == nil && errB == nil && na == nb
+}
+
+// truncateTitle cuts a title to the length of its column, on a character boundary
+func truncateTitle(title string) string {
+	if utf8.RuneCountInString(title) <= maxImportedTitleLength {
+		return title
+	}
+	return string([]rune(title)[:maxImportedTitleLength])
+}
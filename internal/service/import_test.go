@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportService_Import(t *testing.T) {
+	created := time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC)
+	links := []model.ImportedLink{
+		{Code: "DOCS", URL: "https://docs.example.com", Title: "Docs", CreatedAt: created, Clicks: []model.DailyClicks{
+			{Day: created, Clicks: 40}, {Day: created.AddDate(0, 0, 1), Clicks: 2},
+		}},
+		{Code: "BLOG", URL: "https://blog.example.com/"},
+		{Code: "HELP", URL: "https://help.example.com"},
+		{Code: "abc1", URL: "https://example.com"},
+		{Code: "STAT", URL: "ftp://status.example.com"},
+		{Code: "DOCS", URL: "https://docs.example.com/v2"},
+		{Code: "NEWS", URL: "https://news.example.com"},
+	}
+	stored := []model.ShortLink{
+		{ShortCode: "BLOG", OriginalURL: "https://BLOG.example.com", Status: 1},
+		{ShortCode: "HELP", OriginalURL: "https://support.example.com", Status: 1},
+	}
+
+	t.Run("stores links and seeds their clicks", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+		svc := NewImportService(mockMySQL, mockBloom)
+
+		mockMySQL.EXPECT().GetShortLinksByCodes(gomock.Any(), []string{"DOCS", "BLOG", "HELP", "NEWS"}).Return(stored, nil)
+		mockMySQL.EXPECT().WithTx(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, fn func(context.Context) error) error {
+			return fn(ctx)
+		}).Times(2)
+		mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, sl *model.ShortLink) error {
+			assert.Equal(t, "DOCS", sl.ShortCode)
+			assert.Equal(t, created, sl.CreatedAt)
+			assert.Equal(t, "Docs", sl.Title)
+			assert.NotEmpty(t, sl.URLHash)
+			assert.Empty(t, sl.DedupHash)
+			return nil
+		})
+		mockBloom.EXPECT().Add(gomock.Any(), "DOCS").Return(nil)
+		mockMySQL.EXPECT().AddDailyClicks(gomock.Any(), "DOCS", created, int64(40)).Return(nil)
+		mockMySQL.EXPECT().AddDailyClicks(gomock.Any(), "DOCS", created.AddDate(0, 0, 1), int64(2)).Return(nil)
+		// Taken between the lookup and the insert
+		mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).Return(repository.ErrConflict)
+
+		report, err := svc.Import(context.Background(), links, false)
+		require.NoError(t, err)
+		assert.False(t, report.DryRun)
+		assert.Equal(t, []string{"DOCS"}, report.Imported)
+		assert.Equal(t, []string{"BLOG"}, report.Skipped)
+		assert.Equal(t, int64(42), report.Clicks)
+
+		reasons := make(map[string]string)
+		for _, conflict := range report.Conflicts {
+			reasons[conflict.Code+" "+conflict.URL] = conflict.Reason
+		}
+		assert.Equal(t, map[string]string{
+			"abc1 https://example.com":         "code is not 4 to 6 characters of the short code alphabet ABCDEFGHIJKLMNOPQRSTUVWXYZ234567",
+			"STAT ftp://status.example.com":    "URL is not http or https",
+			"DOCS https://docs.example.com/v2": "listed twice",
+			"HELP https://help.example.com":    "code taken by https://support.example.com",
+			"NEWS https://news.example.com":    "code taken",
+		}, reasons)
+	})
+
+	t.Run("dry run stores nothing", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		svc := NewImportService(mockMySQL, mocks.NewMockBloomServiceInterface(ctrl))
+		svc.SetSMSCodeLength(4)
+
+		mockMySQL.EXPECT().GetShortLinksByCodes(gomock.Any(), []string{"BLOGS", "STATS"}).
+			Return([]model.ShortLink{{ShortCode: "BLOGS", OriginalURL: "https://blog.example.com", Status: 1}}, nil)
+
+		report, err := svc.Import(context.Background(), []model.ImportedLink{
+			{Code: "DOCS", URL: "https://docs.example.com"},
+			{Code: "BLOGS", URL: "https://blog.example.com"},
+			{Code: "STATS", URL: "https://status.example.com", Clicks: []model.DailyClicks{{Day: created, Clicks: 7}}},
+		}, true)
+		require.NoError(t, err)
+		assert.True(t, report.DryRun)
+		assert.Equal(t, []string{"STATS"}, report.Imported)
+		assert.Equal(t, []string{"BLOGS"}, report.Skipped)
+		assert.Equal(t, int64(7), report.Clicks)
+		require.Len(t, report.Conflicts, 1)
+		assert.Equal(t, "DOCS", report.Conflicts[0].Code)
+		assert.Equal(t, "code is not 5 to 6 characters of the short code alphabet ABCDEFGHIJKLMNOPQRSTUVWXYZ234567", report.Conflicts[0].Reason)
+	})
+
+	t.Run("links whose clicks were not seeded are imported again", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := &failingClicksStore{MemoryRepository: repository.NewMemoryRepository(), failures: 1}
+		mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+		svc := NewImportService(store, mockBloom)
+		docs := []model.ImportedLink{
+			{Code: "DOCS", URL: "https://docs.example.com", Clicks: []model.DailyClicks{{Day: created, Clicks: 40}}},
+		}
+
+		_, err := svc.Import(context.Background(), docs, false)
+		assert.ErrorIs(t, err, repository.ErrUnavailable)
+		_, err = store.GetShortLinkByCode(context.Background(), "DOCS")
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+
+		mockBloom.EXPECT().Add(gomock.Any(), "DOCS").Return(nil)
+		report, err := svc.Import(context.Background(), docs, false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"DOCS"}, report.Imported)
+		assert.Empty(t, report.Skipped)
+		stats, err := store.GetDailyStats(context.Background(), "DOCS", created, created)
+		require.NoError(t, err)
+		require.Len(t, stats, 1)
+		assert.Equal(t, int64(40), stats[0].Clicks)
+	})
+}
+
+// failingClicksStore fails to seed clicks as if the database went away, failures times
+type failingClicksStore struct {
+	*repository.MemoryRepository
+	failures int
+}
+
+func (s *failingClicksStore) AddDailyClicks(ctx context.Context, shortCode string, day time.Time, clicks int64) error {
+	if s.failures > 0 {
+		s.failures--
+		return fmt.Errorf("%w: seeding %s", repository.ErrUnavailable, shortCode)
+	}
+	return s.MemoryRepository.AddDailyClicks(ctx, shortCode, day, clicks)
+}
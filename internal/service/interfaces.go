@@ -2,34 +2,14 @@ package service
 
 import (
 	"context"
+	"net/http"
+	"net/url"
 	"time"
 
 	"octopus/internal/model"
-
-	"github.com/redis/go-redis/v9"
+	"octopus/internal/mq"
 )
 
-// MySQLRepositoryInterface defines the interface for MySQL operations (for testing)
-type MySQLRepositoryInterface interface {
-	SaveShortLink(ctx context.Context, sl *model.ShortLink) error
-	GetShortLinkByCode(ctx context.Context, shortCode string) (*model.ShortLink, error)
-	GetShortLinkByURL(ctx context.Context, url string) (*model.ShortLink, error)
-	CheckExistsByCode(ctx context.Context, shortCode string) (bool, error)
-}
-
-// RedisRepositoryInterface defines the interface for Redis operations (for testing)
-type RedisRepositoryInterface interface {
-	GetClient() *redis.Client
-	SaveShortLink(ctx context.Context, shortCode, originalURL string, ttl time.Duration) error
-	GetShortLink(ctx context.Context, shortCode string) (string, error)
-	IncrementPV(ctx context.Context, shortCode string) (int64, error)
-	GetPV(ctx context.Context, shortCode string) (int64, error)
-	AddUV(ctx context.Context, shortCode, visitorID string) (bool, error)
-	GetUV(ctx context.Context, shortCode string) (int64, error)
-	AddSource(ctx context.Context, shortCode, source string) error
-	GetSources(ctx context.Context, shortCode string) (map[string]int64, error)
-}
-
 // BloomServiceInterface defines the interface for Bloom Filter operations (for testing)
 type BloomServiceInterface interface {
 	Add(ctx context.Context, shortCode string) error
@@ -37,18 +17,150 @@ type BloomServiceInterface interface {
 	GetCapacity() int64
 	IsAvailable(ctx context.Context) bool
 	Reset(ctx context.Context) error
+	Delete(ctx context.Context, shortCode string) error
+	SupportsDelete() bool
+}
+
+// EventPublisherInterface defines the interface for publishing link lifecycle events (for testing)
+type EventPublisherInterface interface {
+	SendLinkEvent(ctx context.Context, msg *mq.LinkEventMessage) error
+}
+
+// EdgePurgerInterface defines the interface for purging cached redirects from the CDN edge (for testing)
+type EdgePurgerInterface interface {
+	Enqueue(shortCode string)
 }
 
 // ShortLinkServiceInterface defines the interface for short link operations
 type ShortLinkServiceInterface interface {
 	Generate(ctx context.Context, req *model.GenerateRequest) (*model.GenerateResponse, error)
 	Get(ctx context.Context, shortCode string) (*model.ShortLink, error)
-	ExpandURL(ctx context.Context, shortCode string, queryParams map[string]string) (string, error)
+	Resolve(ctx context.Context, shortCode string) (*model.ResolveResponse, error)
+	BatchGet(ctx context.Context, shortCodes []string) (*model.BatchGetResponse, error)
+	Update(ctx context.Context, shortCode string, req *model.UpdateRequest) (*model.ResolveResponse, error)
+	Lookup(ctx context.Context, rawURL string) (*model.LookupResponse, error)
+	Search(ctx context.Context, q *model.SearchQuery) (*model.SearchResponse, error)
+	Reconcile(ctx context.Context, req *model.DeclarativeRequest, dryRun bool) (*model.DeclarativeResponse, error)
+	BulkUpdateStatus(ctx context.Context, req *model.BulkStatusRequest) (*model.BulkResponse, error)
+	BulkUpdateExpiry(ctx context.Context, req *model.BulkExpireRequest) (*model.BulkResponse, error)
+	SignParams(ctx context.Context, shortCode string, params map[string]interface{}) (*model.SignParamsResponse, error)
+	VerifyParams(sl *model.ShortLink, query url.Values) (url.Values, error)
+	ExpandURL(sl *model.ShortLink, queryParams url.Values) string
+	ConsumeClick(ctx context.Context, shortCode string) (bool, bool, error)
+	Deactivate(ctx context.Context, shortCode string) error
+}
+
+// SMSPoolServiceInterface defines the interface for SMS code pool operations
+type SMSPoolServiceInterface interface {
+	Domain() string
+	Host() string
+	CodeLength() int
+	DefaultTTL() time.Duration
+	Allocate(ctx context.Context, originalURL string) (string, error)
+	Confirm(ctx context.Context, shortCode string) error
+	Release(ctx context.Context, shortCode string) error
+	Usage(ctx context.Context) (*model.PoolUsage, error)
+	RecycleExpired(ctx context.Context) (int, error)
+}
+
+// RecyclerServiceInterface defines the interface for expired code recycling
+type RecyclerServiceInterface interface {
+	Acquire(ctx context.Context) (string, bool)
+	RecycleExpired(ctx context.Context) (int, error)
 }
 
 // AnalyticsServiceInterface defines the interface for analytics operations
 type AnalyticsServiceInterface interface {
-	RecordAccess(ctx context.Context, shortCode, clientIP, userAgent, referer string) error
+	RecordAccess(ctx context.Context, shortCode, visitorID, referer string) error
 	GetStats(ctx context.Context, shortCode string) (*model.Stats, error)
-	GetAnalytics(ctx context.Context, shortCode string) (*model.AnalyticsResponse, error)
+	GetAnalytics(ctx context.Context, shortCode string, fresh bool) (*model.AnalyticsResponse, error)
+	AggregateAnalytics(ctx context.Context, shortCodes []string) (*model.AggregateResponse, error)
+	CampaignShortCodes(ctx context.Context, campaign, owner string) ([]string, error)
+	GetDecay(ctx context.Context, shortCode string) (*model.DecayResponse, error)
+	CompareAnalytics(ctx context.Context, shortCode string, days int) (*model.CompareResponse, error)
+	GetAccessLogs(ctx context.Context, q *model.AccessLogQuery) (*model.AccessLogPage, error)
+	GetLastModified(ctx context.Context, shortCode string) (time.Time, error)
+	GetSourcesDaily(ctx context.Context, shortCode string, days int) (*model.SourcesDailyResponse, error)
+	GetRealtime(ctx context.Context, shortCode string) (*model.RealtimeResponse, error)
+}
+
+// ConversionServiceInterface defines the interface for conversion tracking operations
+type ConversionServiceInterface interface {
+	Param() string
+	NewClickID() string
+	ValidClickID(clickID string) bool
+	CookieName() string
+	ClickCookie(clickID string) *http.Cookie
+	OptedOut(ctx context.Context, sl *model.ShortLink, header http.Header) bool
+	TagURL(targetURL, clickID string) string
+	RecordClick(ctx context.Context, clickID, shortCode, referer string) error
+	Convert(ctx context.Context, req *model.ConversionRequest) (*model.ConversionResponse, error)
+}
+
+// FeatureFlagsInterface defines the interface for managing feature flags at runtime
+type FeatureFlagsInterface interface {
+	List(ctx context.Context) ([]model.FeatureFlag, error)
+	Set(ctx context.Context, name string, req *model.FeatureFlagRequest) (*model.FeatureFlag, error)
+	Delete(ctx context.Context, name string) (bool, error)
+}
+
+// RulesInterface defines the interface for the rules set at runtime on the admin port
+type RulesInterface interface {
+	List(ctx context.Context, kind string) ([]model.Rule, error)
+	Create(ctx context.Context, req *model.RuleRequest) (*model.Rule, error)
+	Update(ctx context.Context, id int64, req *model.RuleRequest) (*model.Rule, error)
+	Delete(ctx context.Context, id int64) (bool, error)
+}
+
+// ClaimServiceInterface defines the interface for claiming links and checking their ownership
+type ClaimServiceInterface interface {
+	Start(ctx context.Context, shortCode string) (*model.Claim, error)
+	Verify(ctx context.Context, shortCode string) (*model.ClaimVerification, error)
+	Authorize(ctx context.Context, shortCode string) error
+	Owner(ctx context.Context) string
+}
+
+// ReputationInterface defines the interface for reporting links and reviewing the reputation of
+// their destination domains
+type ReputationInterface interface {
+	Report(ctx context.Context, shortCode, clientIP string) error
+	List(ctx context.Context) ([]model.DomainReputation, error)
+	Get(ctx context.Context, domain string) (*model.DomainReputation, error)
+	Override(ctx context.Context, domain, verdict string) (*model.DomainReputation, error)
+	ClearOverride(ctx context.Context, domain string) (*model.DomainReputation, error)
+}
+
+// LogDrainsInterface defines the interface for registering the log drains of links and campaigns
+type LogDrainsInterface interface {
+	Create(ctx context.Context, req *model.LogDrainRequest) (*model.LogDrain, error)
+	List(ctx context.Context, shortCode, campaign string) ([]model.LogDrain, error)
+	Delete(ctx context.Context, id string) (bool, error)
+}
+
+// MaintenanceModeInterface defines the interface for turning the maintenance mode on and off
+type MaintenanceModeInterface interface {
+	Get(ctx context.Context) (*model.Maintenance, error)
+	Enable(ctx context.Context, req *model.MaintenanceRequest) (*model.Maintenance, error)
+	Disable(ctx context.Context) error
+}
+
+// ReportServiceInterface defines the interface for previewing the weekly campaign reports
+type ReportServiceInterface interface {
+	LastWeek(ctx context.Context) (*model.WeeklyReport, error)
+	RenderHTML(report *model.WeeklyReport) ([]byte, error)
+}
+
+// PublicStatsPagesInterface defines the interface for the public stats pages of links
+type PublicStatsPagesInterface interface {
+	Get(ctx context.Context, shortCode string) (*model.PublicStats, error)
+	CacheTTL() time.Duration
+}
+
+// ExpiryRemindersInterface defines the interface for subscribing to the reminders of links about
+// to expire and extending them
+type ExpiryRemindersInterface interface {
+	Subscribe(ctx context.Context, req *model.ReminderSubscriptionRequest) (*model.ReminderSubscription, error)
+	Get(ctx context.Context) (*model.ReminderSubscription, error)
+	Unsubscribe(ctx context.Context) (bool, error)
+	Extend(ctx context.Context, shortCode string) (*model.ExtendResponse, error)
 }
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/pkg/clock"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// MaintenanceMode tracks whether writes to links are suspended, e.g. during database migrations.
+// The state is kept in Redis, so turning it on from any instance reaches the others on their next
+// refresh; the request path only reads the copy held in memory.
+type MaintenanceMode struct {
+	client     redis.Cmdable
+	key        string
+	retryAfter time.Duration
+	clock      clock.Clock
+
+	mu    sync.RWMutex
+	state model.Maintenance
+}
+
+// NewMaintenanceMode creates the maintenance mode, off until a refresh finds it on
+func NewMaintenanceMode(client redis.Cmdable, cfg *config.MaintenanceConfig) *MaintenanceMode {
+	return &MaintenanceMode{
+		client:     client,
+		key:        cfg.Key,
+		retryAfter: cfg.RetryAfter,
+		clock:      clock.Real,
+	}
+}
+
+// Active reports whether writes are suspended and how long clients should wait before retrying
+func (m *MaintenanceMode) Active() (bool, time.Duration) {
+	if m == nil {
+		return false, 0
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.Enabled, time.Duration(m.state.RetryAfter) * time.Second
+}
+
+// Refresh loads the state set by this instance or others
+func (m *MaintenanceMode) Refresh(ctx context.Context) error {
+	value, err := m.client.Get(ctx, m.key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		m.setState(model.Maintenance{})
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load maintenance mode: %w", err)
+	}
+
+	var state model.Maintenance
+	if err := json.Unmarshal(value, &state); err != nil {
+		return fmt.Errorf("failed to decode maintenance mode: %w", err)
+	}
+	m.setState(state)
+	return nil
+}
+
+// Run refreshes the state every interval until the context is canceled
+func (m *MaintenanceMode) Run(ctx context.Context, interval time.Duration) {
+	if err := m.Refresh(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to refresh maintenance mode")
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Refresh(ctx); err != nil {
+				log.Warn().Err(err).Msg("Failed to refresh maintenance mode")
+			}
+		}
+	}
+}
+
+// Get returns the current state, as stored in Redis
+func (m *MaintenanceMode) Get(ctx context.Context) (*model.Maintenance, error) {
+	if err := m.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	state := m.state
+	return &state, nil
+}
+
+// Enable suspends writes on every instance
+func (m *MaintenanceMode) Enable(ctx context.Context, req *model.MaintenanceRequest) (*model.Maintenance, error) {
+	since := m.clock.Now()
+	state := model.Maintenance{
+		Enabled:    true,
+		Reason:     req.Reason,
+		Since:      &since,
+		RetryAfter: req.RetryAfter,
+	}
+	if state.RetryAfter == 0 {
+		state.RetryAfter = int(m.retryAfter / time.Second)
+	}
+
+	value, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.client.Set(ctx, m.key, value, 0).Err(); err != nil {
+		return nil, fmt.Errorf("failed to save maintenance mode: %w", err)
+	}
+	m.setState(state)
+	return &state, nil
+}
+
+// Disable resumes writes on every instance
+func (m *MaintenanceMode) Disable(ctx context.Context) error {
+	if err := m.client.Del(ctx, m.key).Err(); err != nil {
+		return fmt.Errorf("failed to delete maintenance mode: %w", err)
+	}
+	m.setState(model.Maintenance{})
+	return nil
+}
+
+// setState replaces the state held in memory
+func (m *MaintenanceMode) setState(state model.Maintenance) {
+	m.mu.Lock()
+	m.state = state
+	m.mu.Unlock()
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/pkg/clock"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	ctx := context.Background()
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+
+	cfg := &config.MaintenanceConfig{Key: "octopus:maintenance", RetryAfter: time.Minute}
+	m := NewMaintenanceMode(client, cfg)
+	since := time.Unix(1700000000, 0)
+	m.clock = clock.NewFake(since)
+	other := NewMaintenanceMode(client, cfg)
+
+	on, _ := (*MaintenanceMode)(nil).Active()
+	assert.False(t, on)
+	on, _ = m.Active()
+	assert.False(t, on)
+
+	state, err := m.Enable(ctx, &model.MaintenanceRequest{Reason: "migration"})
+	require.NoError(t, err)
+	assert.Equal(t, 60, state.RetryAfter, "configured estimate by default")
+	on, retryAfter := m.Active()
+	assert.True(t, on)
+	assert.Equal(t, time.Minute, retryAfter)
+
+	// Other instances pick the state up on refresh
+	on, _ = other.Active()
+	assert.False(t, on)
+	require.NoError(t, other.Refresh(ctx))
+	on, _ = other.Active()
+	assert.True(t, on)
+
+	state, err = other.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "migration", state.Reason)
+	require.NotNil(t, state.Since)
+	assert.True(t, since.Equal(*state.Since))
+
+	_, err = m.Enable(ctx, &model.MaintenanceRequest{RetryAfter: 300})
+	require.NoError(t, err)
+	_, retryAfter = m.Active()
+	assert.Equal(t, 5*time.Minute, retryAfter)
+
+	require.NoError(t, other.Disable(ctx))
+	assert.False(t, s.Exists("octopus:maintenance"))
+	require.NoError(t, m.Refresh(ctx))
+	on, _ = m.Active()
+	assert.False(t, on)
+
+	// A corrupt state keeps the last one known
+	s.Set("octopus:maintenance", "{")
+	assert.Error(t, m.Refresh(ctx))
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/internal/storage"
+	"octopus/pkg/clock"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// publicStatsEntry is the cached public stats of a link, nil for links without public stats
+type publicStatsEntry struct {
+	stats    *model.PublicStats
+	expireAt time.Time
+}
+
+// PublicStatsPages serves the stats of the links their owner made public. Shared pages can draw far
+// more views than dashboards, so each link is read from MySQL at most once per cache TTL on every
+// instance, links without public stats included.
+type PublicStatsPages struct {
+	mysqlRepo  storage.Database
+	days       int
+	topSources int
+	ttl        time.Duration
+	maxEntries int
+	clock      clock.Clock
+	mu         sync.Mutex
+	entries    map[string]publicStatsEntry
+	loads      singleflight.Group
+}
+
+// NewPublicStatsPages creates the public stats pages
+func NewPublicStatsPages(mysqlRepo storage.Database, cfg *config.PublicStatsConfig) *PublicStatsPages {
+	maxEntries := cfg.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+
+	return &PublicStatsPages{
+		mysqlRepo:  mysqlRepo,
+		days:       cfg.Days,
+		topSources: cfg.TopSources,
+		ttl:        cfg.CacheTTL,
+		maxEntries: maxEntries,
+		clock:      clock.Real,
+		entries:    make(map[string]publicStatsEntry),
+	}
+}
+
+// CacheTTL returns how long the stats of a link are served from the cache
+func (p *PublicStatsPages) CacheTTL() time.Duration {
+	return p.ttl
+}
+
+// Get returns the public stats of a link, ErrShortLinkNotFound unless its owner made them public
+func (p *PublicStatsPages) Get(ctx context.Context, shortCode string) (*model.PublicStats, error) {
+	stats, ok := p.get(shortCode)
+	if !ok {
+		v, err, _ := p.loads.Do(shortCode, func() (interface{}, error) {
+			if stats, ok := p.get(shortCode); ok {
+				return stats, nil
+			}
+			stats, err := p.load(context.WithoutCancel(ctx), shortCode)
+			if err != nil && !errors.Is(err, ErrShortLinkNotFound) {
+				return nil, err
+			}
+			p.store(shortCode, stats)
+			return stats, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		stats = v.(*model.PublicStats)
+	}
+
+	if stats == nil {
+		return nil, ErrShortLinkNotFound
+	}
+	return stats, nil
+}
+
+// load reads the stats of the last days days, today included
+func (p *PublicStatsPages) load(ctx context.Context, shortCode string) (*model.PublicStats, error) {
+	sl, err := p.mysqlRepo.GetShortLinkByCode(ctx, shortCode)
+	if err != nil {
+		return nil, linkError(err)
+	}
+	if !sl.PublicStats || !sl.IsActiveAt(p.clock.Now()) {
+		return nil, ErrShortLinkNotFound
+	}
+
+	today := p.clock.Now().UTC().Truncate(24 * time.Hour)
+	period := model.Period{From: today.AddDate(0, 0, 1-p.days), To: today}
+
+	stats, err := p.mysqlRepo.GetDailyStats(ctx, shortCode, period.From, period.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily stats: %w", err)
+	}
+	sourceStats, err := p.mysqlRepo.GetDailySourceStats(ctx, shortCode, period.From, period.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily source stats: %w", err)
+	}
+
+	resp := &model.PublicStats{
+		ShortCode:   sl.ShortCode,
+		OriginalURL: sl.OriginalURL,
+		Title:       sl.Title,
+		CreatedAt:   sl.CreatedAt,
+		Period:      period,
+		Daily:       make([]model.DailyClicks, p.days),
+		GeneratedAt: p.clock.Now().UTC(),
+	}
+	for i := range resp.Daily {
+		resp.Daily[i].Day = period.From.AddDate(0, 0, i)
+	}
+	for _, stat := range stats {
+		i := int(stat.Day.UTC().Truncate(24*time.Hour).Sub(period.From) / (24 * time.Hour))
+		if i < 0 || i >= len(resp.Daily) {
+			continue
+		}
+		resp.Daily[i].Clicks += stat.Clicks
+		resp.Daily[i].Visitors += stat.Visitors
+		resp.Clicks += stat.Clicks
+		resp.Visitors += stat.Visitors
+	}
+
+	sources := make(map[string]int64)
+	for _, stat := range sourceStats {
+		sources[stat.Source] += stat.Clicks
+	}
+	resp.TopSources = make([]model.SourceStat, 0, len(sources))
+	for source, clicks := range sources {
+		resp.TopSources = append(resp.TopSources, model.SourceStat{Source: source, Count: clicks})
+	}
+	sort.Slice(resp.TopSources, func(i, j int) bool {
+		a, b := resp.TopSources[i], resp.TopSources[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Source < b.Source
+	})
+	resp.TopSources = resp.TopSources[:min(len(resp.TopSources), p.topSources)]
+
+	return resp, nil
+}
+
+// get returns the cached stats of a link unless they expired
+func (p *PublicStatsPages) get(shortCode string) (*model.PublicStats, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, ok := p.entries[shortCode]
+	if !ok || !p.clock.Now().Before(entry.expireAt) {
+		return nil, false
+	}
+	return entry.stats, true
+}
+
+// store caches the stats of a link, making room by dropping expired entries or else an arbitrary one
+func (p *PublicStatsPages) store(shortCode string, stats *model.PublicStats) {
+	now := p.clock.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.entries[shortCode]; !ok && len(p.entries) >= p.maxEntries {
+		for code, entry := range p.entries {
+			if !now.Before(entry.expireAt) {
+				delete(p.entries, code)
+			}
+		}
+		for code := range p.entries {
+			if len(p.entries) < p.maxEntries {
+				break
+			}
+			delete(p.entries, code)
+		}
+	}
+	p.entries[shortCode] = publicStatsEntry{stats: stats, expireAt: now.Add(p.ttl)}
+}
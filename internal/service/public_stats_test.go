@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/pkg/clock"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPublicStatsPages(ctrl *gomock.Controller) (*PublicStatsPages, *mocks.MockDatabase, *clock.Fake) {
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	p := NewPublicStatsPages(mockMySQL, &config.PublicStatsConfig{Days: 3, TopSources: 2, CacheTTL: time.Minute})
+	now := clock.NewFake(time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC))
+	p.clock = now
+	return p, mockMySQL, now
+}
+
+func TestPublicStatsPages_Get(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	p, mockMySQL, now := newTestPublicStatsPages(ctrl)
+	from, to := day("2024-01-08"), day("2024-01-10")
+
+	mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{
+		ShortCode: "ABCD", OriginalURL: "https://example.com", Title: "Spring sale", Status: 1, PublicStats: true,
+	}, nil).Times(2)
+	mockMySQL.EXPECT().GetDailyStats(gomock.Any(), "ABCD", from, to).Return([]model.DailyStat{
+		{Day: day("2024-01-08"), Clicks: 5, Visitors: 4},
+		{Day: day("2024-01-10"), Clicks: 7, Visitors: 6},
+	}, nil).Times(2)
+	mockMySQL.EXPECT().GetDailySourceStats(gomock.Any(), "ABCD", from, to).Return([]model.DailySourceStat{
+		{Day: day("2024-01-08"), Source: "google", Clicks: 3},
+		{Day: day("2024-01-10"), Source: "google", Clicks: 2},
+		{Day: day("2024-01-10"), Source: "direct", Clicks: 6},
+		{Day: day("2024-01-10"), Source: "twitter", Clicks: 1},
+	}, nil).Times(2)
+
+	stats, err := p.Get(context.Background(), "ABCD")
+	require.NoError(t, err)
+	assert.Equal(t, "Spring sale", stats.Title)
+	assert.Equal(t, model.Period{From: from, To: to}, stats.Period)
+	assert.Equal(t, int64(12), stats.Clicks)
+	assert.Equal(t, int64(10), stats.Visitors)
+	assert.Equal(t, []model.DailyClicks{
+		{Day: day("2024-01-08"), Clicks: 5, Visitors: 4},
+		{Day: day("2024-01-09")},
+		{Day: day("2024-01-10"), Clicks: 7, Visitors: 6},
+	}, stats.Daily)
+	assert.Equal(t, []model.SourceStat{{Source: "direct", Count: 6}, {Source: "google", Count: 5}}, stats.TopSources)
+
+	// Served from the cache until it expires
+	cached, err := p.Get(context.Background(), "ABCD")
+	require.NoError(t, err)
+	assert.Same(t, stats, cached)
+
+	now.Advance(time.Minute)
+	_, err = p.Get(context.Background(), "ABCD")
+	require.NoError(t, err)
+}
+
+func TestPublicStatsPages_NotPublic(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	p, mockMySQL, _ := newTestPublicStatsPages(ctrl)
+
+	t.Run("private link is not found and cached", func(t *testing.T) {
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "PRIV").Return(&model.ShortLink{ShortCode: "PRIV", Status: 1}, nil)
+
+		for i := 0; i < 2; i++ {
+			_, err := p.Get(context.Background(), "PRIV")
+			assert.ErrorIs(t, err, ErrShortLinkNotFound)
+		}
+	})
+
+	t.Run("disabled link is not found", func(t *testing.T) {
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "DEAD").Return(&model.ShortLink{ShortCode: "DEAD", Status: 0, PublicStats: true}, nil)
+
+		_, err := p.Get(context.Background(), "DEAD")
+		assert.ErrorIs(t, err, ErrShortLinkNotFound)
+	})
+
+	t.Run("unknown link is not found", func(t *testing.T) {
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "NONE").Return(nil, repository.ErrNotFound)
+
+		_, err := p.Get(context.Background(), "NONE")
+		assert.ErrorIs(t, err, ErrShortLinkNotFound)
+	})
+
+	t.Run("storage failure is not cached", func(t *testing.T) {
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "DOWN").Return(nil, errors.New("db down")).Times(2)
+
+		for i := 0; i < 2; i++ {
+			_, err := p.Get(context.Background(), "DOWN")
+			assert.Error(t, err)
+			assert.NotErrorIs(t, err, ErrShortLinkNotFound)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/pkg/cdn"
+	"octopus/pkg/clock"
+
+	"github.com/rs/zerolog/log"
+)
+
+// recentPurges is how many of the latest deliveries the purge stats list
+const recentPurges = 20
+
+// EdgePurgeService purges the cached redirects of changed links from the CDN edge. Purges are
+// delivered in the background so the CDN API never holds up a change, temporary failures being
+// retried with an exponential backoff.
+type EdgePurgeService struct {
+	purger   cdn.Purger
+	cfg      *config.EdgePurgeConfig
+	baseURLs []string
+	queue    chan string
+	clock    clock.Clock
+	purged   atomic.Int64
+	failed   atomic.Int64
+	retries  atomic.Int64
+	dropped  atomic.Int64
+	mu       sync.Mutex
+	recent   []model.PurgeDelivery
+}
+
+// NewEdgePurgeService creates a new Edge Purge Service purging the short links served under
+// baseURLs through purger
+func NewEdgePurgeService(purger cdn.Purger, cfg *config.EdgePurgeConfig, baseURLs []string) *EdgePurgeService {
+	return &EdgePurgeService{
+		purger:   purger,
+		cfg:      cfg,
+		baseURLs: baseURLs,
+		queue:    make(chan string, cfg.QueueSize),
+		clock:    clock.Real,
+	}
+}
+
+// Enqueue queues the purge of a short link, dropping it when the queue is full
+func (ps *EdgePurgeService) Enqueue(shortCode string) {
+	select {
+	case ps.queue <- shortCode:
+	default:
+		ps.dropped.Add(1)
+		log.Warn().Str("short_code", shortCode).Msg("Edge purge queue full, dropping purge")
+	}
+}
+
+// Run delivers the queued purges until ctx is done
+func (ps *EdgePurgeService) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case shortCode := <-ps.queue:
+			ps.deliver(ctx, shortCode)
+		}
+	}
+}
+
+// deliver purges a short link, retrying temporary failures up to the configured attempts
+func (ps *EdgePurgeService) deliver(ctx context.Context, shortCode string) {
+	delivery := model.PurgeDelivery{ShortCode: shortCode, Status: model.PurgeStatusPurged}
+	urls := ps.urls(shortCode)
+	backoff := ps.cfg.Backoff
+
+	var err error
+retry:
+	for delivery.Attempts = 1; ; delivery.Attempts++ {
+		err = ps.purger.Purge(ctx, urls)
+		if err == nil || delivery.Attempts >= ps.cfg.Attempts || !retryablePurge(err) {
+			break
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			break retry
+		case <-timer.C:
+		}
+		ps.retries.Add(1)
+		backoff *= 2
+	}
+
+	if err != nil {
+		delivery.Status = model.PurgeStatusFailed
+		delivery.Error = err.Error()
+		ps.failed.Add(1)
+		log.Error().Err(err).Str("short_code", shortCode).Int("attempts", delivery.Attempts).Msg("Failed to purge cached redirects")
+	} else {
+		ps.purged.Add(1)
+	}
+	delivery.DeliveredAt = ps.clock.Now()
+
+	ps.mu.Lock()
+	ps.recent = append([]model.PurgeDelivery{delivery}, ps.recent[:min(len(ps.recent), recentPurges-1)]...)
+	ps.mu.Unlock()
+}
+
+// urls returns the URLs the CDN may cache for a short link: its redirect and public stats page on
+// every domain links are served from
+func (ps *EdgePurgeService) urls(shortCode string) []string {
+	urls := make([]string, 0, 2*len(ps.baseURLs))
+	for _, baseURL := range ps.baseURLs {
+		urls = append(urls, baseURL+"/"+shortCode, baseURL+"/"+shortCode+"+")
+	}
+	return urls
+}
+
+// Stats reports the purges queued and delivered
+func (ps *EdgePurgeService) Stats() *model.EdgePurgeStats {
+	ps.mu.Lock()
+	recent := append([]model.PurgeDelivery{}, ps.recent...)
+	ps.mu.Unlock()
+
+	return &model.EdgePurgeStats{
+		Provider: ps.cfg.Provider,
+		Queued:   len(ps.queue),
+		Purged:   ps.purged.Load(),
+		Failed:   ps.failed.Load(),
+		Retries:  ps.retries.Load(),
+		Dropped:  ps.dropped.Load(),
+		Recent:   recent,
+	}
+}
+
+// retryablePurge reports whether a failed purge may succeed when retried, network failures
+// included
+func retryablePurge(err error) bool {
+	var cdnErr *cdn.Error
+	return !errors.As(err, &cdnErr) || cdnErr.Temporary()
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/mq"
+	"octopus/pkg/cdn"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePurger answers purges with the queued errors, succeeding once they run out
+type fakePurger struct {
+	errs   []error
+	purges [][]string
+}
+
+func (p *fakePurger) Purge(_ context.Context, urls []string) error {
+	p.purges = append(p.purges, urls)
+	if len(p.errs) == 0 {
+		return nil
+	}
+	err := p.errs[0]
+	p.errs = p.errs[1:]
+	return err
+}
+
+func newTestEdgePurgeService(purger cdn.Purger) *EdgePurgeService {
+	return NewEdgePurgeService(purger, &config.EdgePurgeConfig{
+		Provider:  config.PurgeProviderFastly,
+		Attempts:  3,
+		Backoff:   time.Millisecond,
+		QueueSize: 1,
+	}, []string{"https://sho.rt", "https://s.ms"})
+}
+
+func TestEdgePurgeService_Deliver(t *testing.T) {
+	t.Run("purges every URL of the link", func(t *testing.T) {
+		purger := &fakePurger{}
+		ps := newTestEdgePurgeService(purger)
+
+		ps.deliver(context.Background(), "ABCD")
+		require.Len(t, purger.purges, 1)
+		assert.Equal(t, []string{"https://sho.rt/ABCD", "https://sho.rt/ABCD+", "https://s.ms/ABCD", "https://s.ms/ABCD+"}, purger.purges[0])
+
+		stats := ps.Stats()
+		assert.Equal(t, int64(1), stats.Purged)
+		require.Len(t, stats.Recent, 1)
+		assert.Equal(t, model.PurgeStatusPurged, stats.Recent[0].Status)
+		assert.Equal(t, 1, stats.Recent[0].Attempts)
+	})
+
+	t.Run("retries temporary failures", func(t *testing.T) {
+		purger := &fakePurger{errs: []error{
+			errors.New("connection reset"),
+			&cdn.Error{Provider: "fastly", StatusCode: http.StatusServiceUnavailable},
+		}}
+		ps := newTestEdgePurgeService(purger)
+
+		ps.deliver(context.Background(), "ABCD")
+		stats := ps.Stats()
+		assert.Equal(t, int64(1), stats.Purged)
+		assert.Equal(t, int64(2), stats.Retries)
+		assert.Equal(t, 3, stats.Recent[0].Attempts)
+	})
+
+	t.Run("gives up after the attempts", func(t *testing.T) {
+		unavailable := &cdn.Error{Provider: "fastly", StatusCode: http.StatusServiceUnavailable, Message: "down"}
+		purger := &fakePurger{errs: []error{unavailable, unavailable, unavailable}}
+		ps := newTestEdgePurgeService(purger)
+
+		ps.deliver(context.Background(), "ABCD")
+		stats := ps.Stats()
+		assert.Equal(t, int64(1), stats.Failed)
+		assert.Equal(t, model.PurgeStatusFailed, stats.Recent[0].Status)
+		assert.Equal(t, 3, stats.Recent[0].Attempts)
+		assert.Contains(t, stats.Recent[0].Error, "down")
+	})
+
+	t.Run("rejection is not retried", func(t *testing.T) {
+		purger := &fakePurger{errs: []error{&cdn.Error{Provider: "fastly", StatusCode: http.StatusForbidden}}}
+		ps := newTestEdgePurgeService(purger)
+
+		ps.deliver(context.Background(), "ABCD")
+		assert.Len(t, purger.purges, 1)
+		assert.Equal(t, int64(1), ps.Stats().Failed)
+	})
+}
+
+func TestEdgePurgeService_Enqueue(t *testing.T) {
+	ps := newTestEdgePurgeService(&fakePurger{})
+
+	ps.Enqueue("ABCD")
+	ps.Enqueue("EFGH")
+	stats := ps.Stats()
+	assert.Equal(t, 1, stats.Queued)
+	assert.Equal(t, int64(1), stats.Dropped)
+}
+
+func TestEdgePurgeService_Stats(t *testing.T) {
+	ps := newTestEdgePurgeService(&fakePurger{})
+	for i := 0; i < recentPurges+5; i++ {
+		ps.deliver(context.Background(), "ABCD")
+	}
+	ps.deliver(context.Background(), "LAST")
+
+	stats := ps.Stats()
+	assert.Len(t, stats.Recent, recentPurges)
+	assert.Equal(t, "LAST", stats.Recent[0].ShortCode)
+}
+
+func TestShortLinkService_UpdatePurgesEdge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	svc := NewShortLinkService(mockMySQL, mockRedis, mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+	purges := newTestEdgePurgeService(&fakePurger{})
+	svc.SetEdgePurger(purges)
+
+	mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", Status: 1}, nil)
+	mockMySQL.EXPECT().UpdateShortLinkMetadata(gomock.Any(), gomock.Any()).Return(nil)
+	mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "ABCD").Return(nil)
+
+	cacheControl := "public, max-age=300"
+	_, err := svc.Update(context.Background(), "ABCD", &model.UpdateRequest{CacheControl: &cacheControl})
+	require.NoError(t, err)
+	assert.Equal(t, 1, purges.Stats().Queued)
+
+	// New links have no cached redirect yet
+	svc.publishLinkEvent(context.Background(), mq.EventTypeLinkCreated, &model.ShortLink{ShortCode: "EFGH"})
+	assert.Equal(t, 1, purges.Stats().Queued)
+}
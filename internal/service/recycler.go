@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/mq"
+	"octopus/internal/repository"
+	"octopus/internal/storage"
+	"octopus/pkg/clock"
+
+	"github.com/rs/zerolog/log"
+)
+
+// recyclePool is the free list of recycled codes consulted by the generator
+const recyclePool = "recycled"
+
+// recycleAcquireAttempts bounds the free list pops per acquisition
+const recycleAcquireAttempts = 3
+
+// RecyclerService returns codes of long-expired links to an available pool
+type RecyclerService struct {
+	mysqlRepo  storage.Database
+	redisRepo  storage.Cache
+	bloomSvc   BloomServiceInterface
+	quarantine time.Duration
+	batchSize  int
+	linkEvents
+}
+
+// NewRecyclerService creates a new Recycler Service
+func NewRecyclerService(
+	mysqlRepo storage.Database,
+	redisRepo storage.Cache,
+	bloomSvc BloomServiceInterface,
+	cfg *config.RecycleConfig,
+) *RecyclerService {
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	if !bloomSvc.SupportsDelete() {
+		log.Warn().Msg("Filter does not support delete, recycled codes will remain as false positives (use bloom.type=cuckoo)")
+	}
+
+	return &RecyclerService{
+		mysqlRepo:  mysqlRepo,
+		redisRepo:  redisRepo,
+		bloomSvc:   bloomSvc,
+		quarantine: cfg.Quarantine,
+		batchSize:  batchSize,
+		linkEvents: linkEvents{clock: clock.Real},
+	}
+}
+
+// Acquire takes a recycled code from the available pool
+func (rs *RecyclerService) Acquire(ctx context.Context) (string, bool) {
+	for i := 0; i < recycleAcquireAttempts; i++ {
+		shortCode, err := rs.redisRepo.PopFreeCode(ctx, recyclePool)
+		if err != nil {
+			if !errors.Is(err, repository.ErrNotFound) {
+				log.Warn().Err(err).Msg("Failed to pop recycled code")
+			}
+			return "", false
+		}
+
+		// Guard against codes that were taken again since they were recycled
+		exists, err := rs.mysqlRepo.CheckExistsByCode(ctx, shortCode)
+		if err == nil && !exists {
+			return shortCode, true
+		}
+	}
+
+	return "", false
+}
+
+// RecycleExpired purges links whose quarantine has ended, along with their stats and access logs,
+// and returns their codes to the pool
+func (rs *RecyclerService) RecycleExpired(ctx context.Context) (int, error) {
+	before := rs.clock.Now().Add(-rs.quarantine)
+	links, err := rs.mysqlRepo.GetExpiredLinksByPool(ctx, "", before, rs.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	recycled := 0
+	for _, sl := range links {
+		// The next link given the code starts without the clicks of this one. Counters go first: a
+		// link left in place when they cannot be removed is tried again on the next run.
+		if err := rs.redisRepo.DeleteCounters(ctx, sl.ShortCode); err != nil {
+			log.Error().Err(err).Str("short_code", sl.ShortCode).Msg("Failed to purge counters of expired link")
+			continue
+		}
+		err := rs.mysqlRepo.WithTx(ctx, func(ctx context.Context) error {
+			if err := rs.mysqlRepo.DeleteShortLinkByCode(ctx, sl.ShortCode); err != nil {
+				return err
+			}
+			if err := rs.mysqlRepo.DeleteStats(ctx, sl.ShortCode); err != nil {
+				return err
+			}
+			return rs.mysqlRepo.DeleteAccessLogs(ctx, sl.ShortCode)
+		})
+		if err != nil {
+			log.Error().Err(err).Str("short_code", sl.ShortCode).Msg("Failed to delete expired link")
+			continue
+		}
+
+		// Purge cache and filter before the code becomes available again
+		if err := rs.redisRepo.DeleteShortLink(ctx, sl.ShortCode); err != nil {
+			log.Warn().Err(err).Str("short_code", sl.ShortCode).Msg("Failed to purge expired link from cache")
+		}
+		if err := rs.bloomSvc.Delete(ctx, sl.ShortCode); err != nil {
+			log.Warn().Err(err).Str("short_code", sl.ShortCode).Msg("Failed to purge expired link from filter")
+		}
+		rs.publishLinkEvent(ctx, mq.EventTypeLinkExpired, &sl)
+
+		if err := rs.redisRepo.PushFreeCode(ctx, recyclePool, sl.ShortCode); err != nil {
+			log.Error().Err(err).Str("short_code", sl.ShortCode).Msg("Failed to return code to the available pool")
+			continue
+		}
+		recycled++
+	}
+
+	return recycled, nil
+}
+
+// Run recycles expired codes periodically until the context is canceled
+func (rs *RecyclerService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			recycled, err := rs.RecycleExpired(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to recycle expired codes")
+				continue
+			}
+			if recycled > 0 {
+				log.Info().Int("recycled", recycled).Msg("Recycled expired codes")
+			}
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/internal/mq"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"octopus/internal/mocks"
+)
+
+func newTestRecycler(ctrl *gomock.Controller) (*RecyclerService, *mocks.MockDatabase, *mocks.MockCache, *mocks.MockBloomServiceInterface) {
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+	mockBloom.EXPECT().SupportsDelete().Return(true)
+
+	svc := NewRecyclerService(mockMySQL, mockRedis, mockBloom, &config.RecycleConfig{
+		Enabled:    true,
+		Quarantine: 24 * time.Hour,
+		BatchSize:  10,
+	})
+	return svc, mockMySQL, mockRedis, mockBloom
+}
+
+func TestRecyclerService_Acquire(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("empty pool", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc, _, mockRedis, _ := newTestRecycler(ctrl)
+		mockRedis.EXPECT().PopFreeCode(gomock.Any(), recyclePool).Return("", repository.ErrNotFound)
+
+		_, ok := svc.Acquire(ctx)
+		assert.False(t, ok)
+	})
+
+	t.Run("recycled code is available", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc, mockMySQL, mockRedis, _ := newTestRecycler(ctrl)
+		mockRedis.EXPECT().PopFreeCode(gomock.Any(), recyclePool).Return("ABCDE", nil)
+		mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), "ABCDE").Return(false, nil)
+
+		code, ok := svc.Acquire(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, "ABCDE", code)
+	})
+
+	t.Run("skips codes that were taken again", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc, mockMySQL, mockRedis, _ := newTestRecycler(ctrl)
+		gomock.InOrder(
+			mockRedis.EXPECT().PopFreeCode(gomock.Any(), recyclePool).Return("TAKEN", nil),
+			mockRedis.EXPECT().PopFreeCode(gomock.Any(), recyclePool).Return("FREE2", nil),
+		)
+		mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), "TAKEN").Return(true, nil)
+		mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), "FREE2").Return(false, nil)
+
+		code, ok := svc.Acquire(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, "FREE2", code)
+	})
+}
+
+func TestRecyclerService_RecycleExpired(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("purges cache and filter before returning codes", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc, mockMySQL, mockRedis, mockBloom := newTestRecycler(ctrl)
+		mockMySQL.EXPECT().GetExpiredLinksByPool(gomock.Any(), "", gomock.Any(), 10).
+			DoAndReturn(func(_ context.Context, _ string, before time.Time, _ int) ([]model.ShortLink, error) {
+				// Only links past the quarantine period are recycled
+				assert.WithinDuration(t, time.Now().Add(-24*time.Hour), before, time.Minute)
+				return []model.ShortLink{{ShortCode: "ABCD"}}, nil
+			})
+		mockMySQL.EXPECT().WithTx(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, fn func(context.Context) error) error {
+			return fn(ctx)
+		})
+		gomock.InOrder(
+			mockRedis.EXPECT().DeleteCounters(gomock.Any(), "ABCD").Return(nil),
+			mockMySQL.EXPECT().DeleteShortLinkByCode(gomock.Any(), "ABCD").Return(nil),
+			mockMySQL.EXPECT().DeleteStats(gomock.Any(), "ABCD").Return(nil),
+			mockMySQL.EXPECT().DeleteAccessLogs(gomock.Any(), "ABCD").Return(nil),
+			mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "ABCD").Return(nil),
+			mockBloom.EXPECT().Delete(gomock.Any(), "ABCD").Return(nil),
+			mockRedis.EXPECT().PushFreeCode(gomock.Any(), recyclePool, "ABCD").Return(nil),
+		)
+
+		recycled, err := svc.RecycleExpired(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, recycled)
+	})
+
+	t.Run("publishes link expired events", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc, mockMySQL, mockRedis, mockBloom := newTestRecycler(ctrl)
+		mockPublisher := mocks.NewMockProducerInterface(ctrl)
+		svc.SetEventPublisher(mockPublisher)
+
+		mockMySQL.EXPECT().GetExpiredLinksByPool(gomock.Any(), "", gomock.Any(), 10).
+			Return([]model.ShortLink{{ShortCode: "ABCD", OriginalURL: "https://example.com"}}, nil)
+		mockRedis.EXPECT().DeleteCounters(gomock.Any(), "ABCD").Return(nil)
+		mockMySQL.EXPECT().WithTx(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, fn func(context.Context) error) error {
+			return fn(ctx)
+		})
+		mockMySQL.EXPECT().DeleteShortLinkByCode(gomock.Any(), "ABCD").Return(nil)
+		mockMySQL.EXPECT().DeleteStats(gomock.Any(), "ABCD").Return(nil)
+		mockMySQL.EXPECT().DeleteAccessLogs(gomock.Any(), "ABCD").Return(nil)
+		mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "ABCD").Return(nil)
+		mockBloom.EXPECT().Delete(gomock.Any(), "ABCD").Return(nil)
+		mockPublisher.EXPECT().SendLinkEvent(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msg *mq.LinkEventMessage) error {
+			assert.Equal(t, mq.EventTypeLinkExpired, msg.Type)
+			assert.Equal(t, "ABCD", msg.ShortCode)
+			assert.Equal(t, "https://example.com", msg.OriginalURL)
+			return nil
+		})
+		mockRedis.EXPECT().PushFreeCode(gomock.Any(), recyclePool, "ABCD").Return(nil)
+
+		recycled, err := svc.RecycleExpired(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, recycled)
+	})
+
+	t.Run("keeps codes whose link could not be deleted", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc, mockMySQL, mockRedis, _ := newTestRecycler(ctrl)
+		mockMySQL.EXPECT().GetExpiredLinksByPool(gomock.Any(), "", gomock.Any(), 10).Return([]model.ShortLink{{ShortCode: "ABCD"}}, nil)
+		mockRedis.EXPECT().DeleteCounters(gomock.Any(), "ABCD").Return(nil)
+		mockMySQL.EXPECT().WithTx(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, fn func(context.Context) error) error {
+			return fn(ctx)
+		})
+		mockMySQL.EXPECT().DeleteShortLinkByCode(gomock.Any(), "ABCD").Return(errors.New("db error"))
+
+		recycled, err := svc.RecycleExpired(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, recycled)
+	})
+
+	t.Run("keeps links whose counters could not be purged", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc, mockMySQL, mockRedis, _ := newTestRecycler(ctrl)
+		mockMySQL.EXPECT().GetExpiredLinksByPool(gomock.Any(), "", gomock.Any(), 10).Return([]model.ShortLink{{ShortCode: "ABCD"}}, nil)
+		mockRedis.EXPECT().DeleteCounters(gomock.Any(), "ABCD").Return(errors.New("redis error"))
+
+		recycled, err := svc.RecycleExpired(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, recycled)
+	})
+
+	t.Run("recycled codes start without stats", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := repository.NewMemoryRepository()
+		expired := time.Now().Add(-48 * time.Hour)
+		require.NoError(t, store.SaveShortLink(ctx, &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com", ExpireAt: &expired}))
+		require.NoError(t, store.SaveShortLink(ctx, &model.ShortLink{ShortCode: "EFGH", OriginalURL: "https://example.org"}))
+		for _, code := range []string{"ABCD", "EFGH"} {
+			_, err := store.RecordAccessLog(ctx, &model.AccessLog{ShortCode: code, ClientIP: "192.0.2.1", Source: "google", AccessTime: expired})
+			require.NoError(t, err)
+			_, err = store.SaveConversion(ctx, &model.Conversion{ClickID: "click-" + code, Event: "purchase", ShortCode: code})
+			require.NoError(t, err)
+		}
+		mockRedis := mocks.NewMockCache(ctrl)
+		mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+		mockBloom.EXPECT().SupportsDelete().Return(true)
+		svc := NewRecyclerService(store, mockRedis, mockBloom, &config.RecycleConfig{Quarantine: 24 * time.Hour, BatchSize: 10})
+
+		mockRedis.EXPECT().DeleteCounters(gomock.Any(), "ABCD").Return(nil)
+		mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "ABCD").Return(nil)
+		mockBloom.EXPECT().Delete(gomock.Any(), "ABCD").Return(nil)
+		mockRedis.EXPECT().PushFreeCode(gomock.Any(), recyclePool, "ABCD").Return(nil)
+
+		recycled, err := svc.RecycleExpired(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, recycled)
+
+		day := expired.UTC().Truncate(24 * time.Hour)
+		for code, want := range map[string]int{"ABCD": 0, "EFGH": 1} {
+			stats, err := store.GetDailyStats(ctx, code, day, day)
+			require.NoError(t, err)
+			assert.Len(t, stats, want, code)
+			sources, err := store.GetDailySourceStats(ctx, code, day, day)
+			require.NoError(t, err)
+			assert.Len(t, sources, want, code)
+			logs, err := store.GetAccessLogs(ctx, &model.AccessLogQuery{ShortCode: code})
+			require.NoError(t, err)
+			assert.Len(t, logs, want, code)
+		}
+		// The click of the old link converts no more
+		saved, err := store.SaveConversion(ctx, &model.Conversion{ClickID: "click-ABCD", Event: "purchase", ShortCode: "ABCD"})
+		require.NoError(t, err)
+		assert.True(t, saved)
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc, mockMySQL, _, _ := newTestRecycler(ctrl)
+		mockMySQL.EXPECT().GetExpiredLinksByPool(gomock.Any(), "", gomock.Any(), 10).Return(nil, errors.New("db error"))
+
+		_, err := svc.RecycleExpired(ctx)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,368 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/internal/storage"
+	"octopus/pkg/clock"
+	"octopus/pkg/mailer"
+	"octopus/pkg/middleware"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrInvalidSubscription is returned when subscribing to reminders by email on a server sending
+	// none
+	ErrInvalidSubscription = errors.New("invalid reminder subscription")
+	// ErrReminderNotSubscribed is returned when reading or removing the subscription of a caller
+	// that has none
+	ErrReminderNotSubscribed = errors.New("not subscribed to reminders")
+)
+
+// ExpiryReminders tells the owners of links when their links are about to expire, so that campaign
+// links do not die silently. Owners subscribe with their API key, by a webhook posted reminders
+// signed like log drain batches, by email or both. Every check, one instance looks for the links
+// expiring within the window and reminds their owners once per expiry: a link extended is reminded
+// of again as its new expiry comes near. A failed delivery is tried again on the next check.
+type ExpiryReminders struct {
+	client redis.Cmdable
+	links  storage.LinkStore
+	short  *ShortLinkService
+	cfg    *config.RemindersConfig
+	mailer *mailer.Mailer
+	http   *http.Client
+	clock  clock.Clock
+}
+
+// NewExpiryReminders creates a new ExpiryReminders, links being extended through short. Unless the
+// mailer is enabled, owners only subscribe by webhook.
+func NewExpiryReminders(client redis.Cmdable, links storage.LinkStore, short *ShortLinkService, cfg *config.RemindersConfig, mail *mailer.Mailer) *ExpiryReminders {
+	return &ExpiryReminders{
+		client: client,
+		links:  links,
+		short:  short,
+		cfg:    cfg,
+		mailer: mail,
+		http:   &http.Client{Timeout: cfg.Timeout},
+		clock:  clock.Real,
+	}
+}
+
+// Subscribe subscribes the caller to the reminders of its links, replacing any subscription it had.
+// The subscription is returned with the secret webhook posts are signed with.
+func (er *ExpiryReminders) Subscribe(ctx context.Context, req *model.ReminderSubscriptionRequest) (*model.ReminderSubscription, error) {
+	owner := ownerOf(middleware.APIKeyFrom(ctx))
+	if owner == "" {
+		return nil, ErrClaimUnauthenticated
+	}
+	if req.Email != "" && !er.mailer.Enabled() {
+		return nil, fmt.Errorf("%w: emails are not sent by this server", ErrInvalidSubscription)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	sub := model.ReminderSubscription{
+		WebhookURL: req.WebhookURL,
+		Email:      req.Email,
+		Secret:     hex.EncodeToString(secret),
+		CreatedAt:  er.clock.Now().UTC(),
+	}
+	value, err := json.Marshal(sub)
+	if err != nil {
+		return nil, err
+	}
+	if err := er.client.HSet(ctx, er.subscriptionsKey(), owner, value).Err(); err != nil {
+		return nil, fmt.Errorf("failed to save reminder subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+// Get returns the subscription of the caller, without its secret
+func (er *ExpiryReminders) Get(ctx context.Context) (*model.ReminderSubscription, error) {
+	owner := ownerOf(middleware.APIKeyFrom(ctx))
+	if owner == "" {
+		return nil, ErrClaimUnauthenticated
+	}
+	value, err := er.client.HGet(ctx, er.subscriptionsKey(), owner).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrReminderNotSubscribed
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reminder subscription: %w", err)
+	}
+	var sub model.ReminderSubscription
+	if err := json.Unmarshal([]byte(value), &sub); err != nil {
+		return nil, fmt.Errorf("failed to read reminder subscription: %w", err)
+	}
+	sub.Secret = ""
+	return &sub, nil
+}
+
+// Unsubscribe removes the subscription of the caller, reporting whether it had one
+func (er *ExpiryReminders) Unsubscribe(ctx context.Context) (bool, error) {
+	owner := ownerOf(middleware.APIKeyFrom(ctx))
+	if owner == "" {
+		return false, ErrClaimUnauthenticated
+	}
+	deleted, err := er.client.HDel(ctx, er.subscriptionsKey(), owner).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete reminder subscription: %w", err)
+	}
+	return deleted > 0, nil
+}
+
+// Extend pushes the expiry of a link back by the configured duration. Extending twice in a row
+// extends it twice.
+func (er *ExpiryReminders) Extend(ctx context.Context, shortCode string) (*model.ExtendResponse, error) {
+	return er.short.Extend(ctx, shortCode, er.cfg.ExtendBy)
+}
+
+// Run checks for links about to expire every check interval until ctx is done
+func (er *ExpiryReminders) Run(ctx context.Context) {
+	ticker := time.NewTicker(er.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			er.checkDue(ctx)
+		}
+	}
+}
+
+// checkDue runs a check unless another instance ran one within the check interval
+func (er *ExpiryReminders) checkDue(ctx context.Context) {
+	locked, err := er.client.SetNX(ctx, er.cfg.Key+":lock", er.clock.Now().UTC().Format(time.RFC3339), er.cfg.CheckInterval).Result()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to lock the expiry reminder check")
+		return
+	}
+	if !locked {
+		return
+	}
+	sent, err := er.Check(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check for links about to expire")
+		return
+	}
+	if sent > 0 {
+		log.Info().Int("links", sent).Msg("Reminded owners of links about to expire")
+	}
+}
+
+// Check reminds the subscribed owners of the links expiring within the window they were not
+// reminded of yet, a page of links at a time. It returns the number of links reminded of.
+func (er *ExpiryReminders) Check(ctx context.Context) (int, error) {
+	now := er.clock.Now()
+	to := now.Add(er.cfg.Window)
+	sent := 0
+	var afterID int64
+	for {
+		links, err := er.links.GetExpiringShortLinks(ctx, now, to, afterID, er.cfg.Batch)
+		if err != nil {
+			return sent, fmt.Errorf("failed to find links about to expire: %w", err)
+		}
+		if len(links) == 0 {
+			return sent, nil
+		}
+		afterID = links[len(links)-1].ID
+
+		n, err := er.remind(ctx, links)
+		sent += n
+		if err != nil {
+			return sent, err
+		}
+		if len(links) < er.cfg.Batch {
+			return sent, nil
+		}
+	}
+}
+
+// remind reminds the subscribed owners of a page of links, each owner at once. Links are marked
+// reminded of before the delivery so that no other check sends them too, and unmarked when it
+// fails so that the next check tries again.
+func (er *ExpiryReminders) remind(ctx context.Context, links []model.ShortLink) (int, error) {
+	subs, err := er.subscriptions(ctx, links)
+	if err != nil {
+		return 0, err
+	}
+
+	// Links marked before Redis failed are still delivered
+	byOwner := make(map[string][]model.ShortLink)
+	var owners []string
+	var markErr error
+	for _, sl := range links {
+		if _, ok := subs[sl.Owner]; !ok {
+			continue
+		}
+		marked, err := er.client.SetNX(ctx, er.sentKey(&sl), 1, sl.ExpireAt.Sub(er.clock.Now())+er.cfg.CheckInterval).Result()
+		if err != nil {
+			markErr = fmt.Errorf("failed to mark reminder: %w", err)
+			break
+		}
+		if !marked {
+			continue
+		}
+		if byOwner[sl.Owner] == nil {
+			owners = append(owners, sl.Owner)
+		}
+		byOwner[sl.Owner] = append(byOwner[sl.Owner], sl)
+	}
+
+	sent := 0
+	for _, owner := range owners {
+		owned := byOwner[owner]
+		if err := er.deliver(ctx, subs[owner], er.reminder(owned)); err != nil {
+			log.Warn().Err(err).Int("links", len(owned)).Msg("Failed to deliver expiry reminder, trying again on the next check")
+			keys := make([]string, len(owned))
+			for i := range owned {
+				keys[i] = er.sentKey(&owned[i])
+			}
+			if err := er.client.Del(ctx, keys...).Err(); err != nil {
+				log.Warn().Err(err).Msg("Failed to unmark expiry reminders")
+			}
+			continue
+		}
+		sent += len(owned)
+	}
+	return sent, markErr
+}
+
+// subscriptions returns the subscriptions of the owners of links, keyed by owner
+func (er *ExpiryReminders) subscriptions(ctx context.Context, links []model.ShortLink) (map[string]*model.ReminderSubscription, error) {
+	var owners []string
+	seen := make(map[string]bool)
+	for _, sl := range links {
+		if !seen[sl.Owner] {
+			seen[sl.Owner] = true
+			owners = append(owners, sl.Owner)
+		}
+	}
+	values, err := er.client.HMGet(ctx, er.subscriptionsKey(), owners...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load reminder subscriptions: %w", err)
+	}
+
+	subs := make(map[string]*model.ReminderSubscription)
+	for i, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var sub model.ReminderSubscription
+		if err := json.Unmarshal([]byte(s), &sub); err != nil {
+			log.Warn().Err(err).Msg("Ignoring malformed reminder subscription")
+			continue
+		}
+		subs[owners[i]] = &sub
+	}
+	return subs, nil
+}
+
+// reminder lists links about to expire with where they are extended
+func (er *ExpiryReminders) reminder(links []model.ShortLink) *model.ExpiryReminder {
+	reminder := &model.ExpiryReminder{Links: make([]model.ExpiringLink, len(links))}
+	for i := range links {
+		sl := &links[i]
+		reminder.Links[i] = model.ExpiringLink{
+			ShortCode:   sl.ShortCode,
+			ShortLink:   er.short.buildResponse(sl).ShortLink,
+			OriginalURL: sl.OriginalURL,
+			ExpireAt:    sl.ExpireAt.UTC(),
+			ExtendURL:   er.short.domain + "/api/v1/shortlink/" + sl.ShortCode + "/extend",
+		}
+	}
+	return reminder
+}
+
+// deliver posts a reminder to the webhook of a subscription and emails it, failing if either fails
+func (er *ExpiryReminders) deliver(ctx context.Context, sub *model.ReminderSubscription, reminder *model.ExpiryReminder) error {
+	if sub.WebhookURL != "" {
+		if err := er.post(ctx, sub, reminder); err != nil {
+			return err
+		}
+	}
+	if sub.Email != "" && er.mailer.Enabled() {
+		msg, err := reminderTemplate.Render([]string{sub.Email}, reminder)
+		if err != nil {
+			return fmt.Errorf("failed to render expiry reminder: %w", err)
+		}
+		if err := er.mailer.Send(ctx, msg); err != nil {
+			return fmt.Errorf("failed to email expiry reminder: %w", err)
+		}
+	}
+	return nil
+}
+
+// post posts a reminder to the webhook of a subscription, signed with its secret, any status but
+// 2xx failing the delivery
+func (er *ExpiryReminders) post(ctx context.Context, sub *model.ReminderSubscription, reminder *model.ExpiryReminder) error {
+	body, err := json.Marshal(reminder)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid reminder webhook: %w", err)
+	}
+	timestamp := er.clock.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DrainTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(DrainSignatureHeader, SignDrainBatch(sub.Secret, timestamp, body))
+
+	resp, err := er.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post expiry reminder: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to post expiry reminder: webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// subscriptionsKey returns the Redis hash of the subscriptions, keyed by owner
+func (er *ExpiryReminders) subscriptionsKey() string {
+	return er.cfg.Key + ":subscriptions"
+}
+
+// sentKey returns the Redis key marking a link reminded of for its current expiry
+func (er *ExpiryReminders) sentKey(sl *model.ShortLink) string {
+	return er.cfg.Key + ":sent:" + sl.ShortCode + ":" + strconv.FormatInt(sl.ExpireAt.Unix(), 10)
+}
+
+// reminderTemplate renders a reminder as an HTML email
+var reminderTemplate = mailer.MustParseTemplate("reminder",
+	"{{len .Links}} short link{{if gt (len .Links) 1}}s{{end}} about to expire", reminderBody, map[string]any{
+		"time": func(t time.Time) string { return t.Format("2006-01-02 15:04 MST") },
+	})
+
+const reminderBody = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<h1>Short links about to expire</h1>
+<p>These links stop redirecting once they expire. Extend one by posting to its extend URL with your X-API-Key header.</p>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Link</th><th>Destination</th><th>Expires</th><th>Extend</th></tr>
+{{range .Links}}<tr><td>{{.ShortLink}}</td><td>{{.OriginalURL}}</td><td>{{time .ExpireAt}}</td><td><code>curl -X POST -H "X-API-Key: ..." {{.ExtendURL}}</code></td></tr>
+{{end}}</table>
+</body>
+</html>
+`
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/pkg/clock"
+	"octopus/pkg/mailer"
+	"octopus/pkg/middleware"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestExpiryReminders(t *testing.T, ctrl *gomock.Controller, mail *mailer.Mailer) (*ExpiryReminders, *mocks.MockDatabase) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	short := NewShortLinkService(mockMySQL, mocks.NewMockCache(ctrl), mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+	cfg := &config.RemindersConfig{Key: "octopus:reminders", Window: 72 * time.Hour, CheckInterval: 10 * time.Minute,
+		Batch: 2, ExtendBy: 720 * time.Hour, Timeout: time.Second}
+	er := NewExpiryReminders(client, mockMySQL, short, cfg, mail)
+	er.clock = clock.NewFake(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC))
+	return er, mockMySQL
+}
+
+func TestExpiryReminders_Subscribe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	er, _ := newTestExpiryReminders(t, ctrl, mailer.New(mailer.Config{}))
+	ctx := middleware.WithAPIKey(context.Background(), "key-1")
+
+	_, err := er.Subscribe(context.Background(), &model.ReminderSubscriptionRequest{WebhookURL: "https://hooks.example.com"})
+	assert.ErrorIs(t, err, ErrClaimUnauthenticated)
+	// Emails need a mail server
+	_, err = er.Subscribe(ctx, &model.ReminderSubscriptionRequest{Email: "owner@example.com"})
+	assert.ErrorIs(t, err, ErrInvalidSubscription)
+
+	sub, err := er.Subscribe(ctx, &model.ReminderSubscriptionRequest{WebhookURL: "https://hooks.example.com"})
+	require.NoError(t, err)
+	assert.Len(t, sub.Secret, 64)
+
+	got, err := er.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "https://hooks.example.com", got.WebhookURL)
+	assert.Empty(t, got.Secret)
+	_, err = er.Get(middleware.WithAPIKey(context.Background(), "key-2"))
+	assert.ErrorIs(t, err, ErrReminderNotSubscribed)
+
+	deleted, err := er.Unsubscribe(ctx)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = er.Unsubscribe(ctx)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+}
+
+func TestExpiryReminders_Check(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var failing atomic.Bool
+	var posted []model.ExpiryReminder
+	var secret string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(DrainTimestampHeader), 10, 64)
+		assert.Equal(t, SignDrainBatch(secret, timestamp, body), r.Header.Get(DrainSignatureHeader))
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var reminder model.ExpiryReminder
+		assert.NoError(t, json.Unmarshal(body, &reminder))
+		posted = append(posted, reminder)
+	}))
+	defer webhook.Close()
+
+	mailDir := t.TempDir()
+	er, mockMySQL := newTestExpiryReminders(t, ctrl, mailer.New(mailer.Config{From: "links@example.com", DryRunDir: mailDir}))
+	now := er.clock.Now()
+	sub, err := er.Subscribe(middleware.WithAPIKey(context.Background(), "key-1"), &model.ReminderSubscriptionRequest{WebhookURL: webhook.URL})
+	require.NoError(t, err)
+	secret = sub.Secret
+	_, err = er.Subscribe(middleware.WithAPIKey(context.Background(), "key-2"), &model.ReminderSubscriptionRequest{Email: "owner@example.com"})
+	require.NoError(t, err)
+
+	soon, later := now.Add(24*time.Hour), now.Add(48*time.Hour)
+	links := []model.ShortLink{
+		{ID: 1, ShortCode: "ABCD", OriginalURL: "https://example.com/a", Status: 1, ExpireAt: &soon, Owner: ownerOf("key-1")},
+		{ID: 2, ShortCode: "EFGH", OriginalURL: "https://example.com/b", Status: 1, ExpireAt: &later, Owner: ownerOf("key-3")},
+		{ID: 3, ShortCode: "IJKL", OriginalURL: "https://example.com/c", Status: 1, ExpireAt: &later, Owner: ownerOf("key-2")},
+	}
+	expectPages := func() {
+		to := now.Add(72 * time.Hour)
+		mockMySQL.EXPECT().GetExpiringShortLinks(gomock.Any(), now, to, int64(0), 2).Return(links[:2], nil)
+		mockMySQL.EXPECT().GetExpiringShortLinks(gomock.Any(), now, to, int64(2), 2).Return(links[2:], nil)
+	}
+
+	// The webhook fails, the email goes out
+	failing.Store(true)
+	expectPages()
+	sent, err := er.Check(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Empty(t, posted)
+	assert.Len(t, sentMails(t, mailDir), 1)
+	assert.Contains(t, sentMails(t, mailDir)[0], "https://s.example.com/api/v1/shortlink/IJKL/extend")
+
+	// The failed reminder is sent again, the other not, and the owner without a subscription never
+	failing.Store(false)
+	expectPages()
+	sent, err = er.Check(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	require.Len(t, posted, 1)
+	assert.Equal(t, []model.ExpiringLink{{
+		ShortCode:   "ABCD",
+		ShortLink:   "https://s.example.com/ABCD",
+		OriginalURL: "https://example.com/a",
+		ExpireAt:    soon,
+		ExtendURL:   "https://s.example.com/api/v1/shortlink/ABCD/extend",
+	}}, posted[0].Links)
+	assert.Len(t, sentMails(t, mailDir), 1)
+
+	// An extended link is reminded of again as its new expiry comes near
+	extended := soon.Add(720 * time.Hour)
+	er.clock.(*clock.Fake).Set(extended.Add(-time.Hour))
+	now = er.clock.Now()
+	mockMySQL.EXPECT().GetExpiringShortLinks(gomock.Any(), now, now.Add(72*time.Hour), int64(0), 2).
+		Return([]model.ShortLink{{ID: 1, ShortCode: "ABCD", Status: 1, ExpireAt: &extended, Owner: ownerOf("key-1")}}, nil)
+	sent, err = er.Check(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Len(t, posted, 2)
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/internal/mq"
+	"octopus/internal/storage"
+	"octopus/pkg/clock"
+	"octopus/pkg/util"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrReadOnlyReplica is returned for changes to links on a replica, they are made in the primary region
+var ErrReadOnlyReplica = errors.New("links are read-only on replicas, change them in the primary region")
+
+// ReplicationService keeps the links of a replica in sync with the primary region by applying its
+// link events. The primary is authoritative: the latest change made there wins, whatever order
+// its events arrive in.
+type ReplicationService struct {
+	mysqlRepo   storage.LinkStore
+	redisRepo   storage.LinkCache
+	bloomSvc    BloomServiceInterface
+	region      string
+	clock       clock.Clock
+	applied     atomic.Int64
+	skipped     atomic.Int64
+	lastEventAt atomic.Int64
+	lag         atomic.Int64
+}
+
+// NewReplicationService creates a new Replication Service for a replica
+func NewReplicationService(
+	mysqlRepo storage.LinkStore,
+	redisRepo storage.LinkCache,
+	bloomSvc BloomServiceInterface,
+	cfg *config.ReplicationConfig,
+) *ReplicationService {
+	return &ReplicationService{
+		mysqlRepo: mysqlRepo,
+		redisRepo: redisRepo,
+		bloomSvc:  bloomSvc,
+		region:    cfg.Region,
+		clock:     clock.Real,
+	}
+}
+
+// Apply applies a link event of the primary region. Events older than the change already applied
+// to the link are skipped, so redeliveries and events overtaking each other are harmless.
+func (rs *ReplicationService) Apply(ctx context.Context, msg *mq.LinkEventMessage) error {
+	// Events published in this region were applied when the change was made
+	if msg.Region == rs.region {
+		rs.skipped.Add(1)
+		return nil
+	}
+
+	sl := replicatedLink(msg)
+	applied, err := rs.mysqlRepo.ApplyReplicatedShortLink(ctx, sl)
+	if err != nil {
+		return fmt.Errorf("failed to apply %s of %s: %w", msg.Type, msg.ShortCode, err)
+	}
+	rs.observe(msg.OccurredAt)
+
+	if !applied {
+		rs.skipped.Add(1)
+		log.Debug().Str("type", msg.Type).Str("short_code", msg.ShortCode).Msg("Skipping stale link event")
+		return nil
+	}
+	rs.applied.Add(1)
+
+	// Redirects read the replicated link from MySQL until it is cached again
+	if err := rs.redisRepo.DeleteShortLink(ctx, sl.ShortCode); err != nil {
+		log.Warn().Err(err).Str("short_code", sl.ShortCode).Msg("Failed to drop replicated short link from cache")
+	}
+	if sl.Status == 1 {
+		if err := rs.bloomSvc.Add(ctx, sl.ShortCode); err != nil {
+			log.Warn().Err(err).Str("short_code", sl.ShortCode).Msg("Failed to add to Bloom Filter")
+		}
+	}
+
+	return nil
+}
+
+// Stats returns how many events were applied and how far the replica is behind the primary
+func (rs *ReplicationService) Stats() *model.ReplicationStats {
+	stats := &model.ReplicationStats{
+		Region:  rs.region,
+		Applied: rs.applied.Load(),
+		Skipped: rs.skipped.Load(),
+	}
+	if last := rs.lastEventAt.Load(); last != 0 {
+		lastEventAt := time.Unix(0, last)
+		stats.LastEventAt = &lastEventAt
+		stats.LagSeconds = time.Duration(rs.lag.Load()).Seconds()
+	}
+	return stats
+}
+
+// observe records the lag of the latest event, from when the change was made on the primary
+func (rs *ReplicationService) observe(occurredAt time.Time) {
+	rs.lastEventAt.Store(occurredAt.UnixNano())
+	rs.lag.Store(int64(rs.clock.Now().Sub(occurredAt)))
+}
+
+// replicatedLink builds the local copy of a link from its event, versioned by when the change
+// was made. Expired and deleted links are kept disabled rather than removed.
+func replicatedLink(msg *mq.LinkEventMessage) *model.ShortLink {
+	status := 1
+	if msg.Type == mq.EventTypeLinkExpired || msg.Type == mq.EventTypeLinkDeleted {
+		status = 0
+	}
+	urlHash, _ := util.URLHash(msg.OriginalURL)
+
+	return &model.ShortLink{
+		ShortCode:      msg.ShortCode,
+		OriginalURL:    msg.OriginalURL,
+		URLHash:        urlHash,
+		ExpireAt:       msg.ExpireAt,
+		Status:         status,
+		Pool:           msg.Pool,
+		NoClickID:      msg.NoClickID,
+		MaxClicks:      msg.MaxClicks,
+		PreserveQuery:  msg.PreserveQuery,
+		PublicStats:    msg.PublicStats,
+		NoTracking:     msg.NoTracking,
+		CacheControl:   msg.CacheControl,
+		SignedParams:   msg.SignedParams,
+		SingleUse:      msg.SingleUse,
+		Referrers:      msg.Referrers,
+		GeoAllow:       msg.GeoAllow,
+		GeoDeny:        msg.GeoDeny,
+		Schedule:       msg.Schedule,
+		Params:         msg.Params,
+		ReplicaVersion: msg.OccurredAt.UnixNano(),
+	}
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/mq"
+	"octopus/pkg/clock"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestReplicationService(ctrl *gomock.Controller) (*ReplicationService, *mocks.MockDatabase, *mocks.MockCache, *mocks.MockBloomServiceInterface) {
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+	svc := NewReplicationService(mockMySQL, mockRedis, mockBloom, &config.ReplicationConfig{
+		Role:   config.ReplicationRoleReplica,
+		Region: "us-east",
+	})
+	return svc, mockMySQL, mockRedis, mockBloom
+}
+
+func TestReplicationService_Apply(t *testing.T) {
+	occurredAt := time.Unix(1700000000, 0)
+	expireAt := occurredAt.Add(24 * time.Hour)
+	event := func(eventType string) *mq.LinkEventMessage {
+		return &mq.LinkEventMessage{
+			EventID:     "e1",
+			Type:        eventType,
+			ShortCode:   "ABCD",
+			OriginalURL: "https://example.com",
+			ExpireAt:    &expireAt,
+			OccurredAt:  occurredAt,
+			Region:      "eu-west",
+			MaxClicks:   10,
+			PublicStats: true,
+			Params:      json.RawMessage(`{"utm_source":"newsletter"}`),
+		}
+	}
+
+	t.Run("created link is stored and added to the filter", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc, mockMySQL, mockRedis, mockBloom := newTestReplicationService(ctrl)
+		mockMySQL.EXPECT().ApplyReplicatedShortLink(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, sl *model.ShortLink) (bool, error) {
+			assert.Equal(t, "ABCD", sl.ShortCode)
+			assert.Equal(t, "https://example.com", sl.OriginalURL)
+			assert.NotEmpty(t, sl.URLHash)
+			assert.Equal(t, &expireAt, sl.ExpireAt)
+			assert.Equal(t, 1, sl.Status)
+			assert.Equal(t, int64(10), sl.MaxClicks)
+			assert.True(t, sl.PublicStats)
+			// Replicas append the same params to redirects as the primary
+			assert.Equal(t, map[string]interface{}{"utm_source": "newsletter"}, sl.DecodedParams())
+			assert.Equal(t, occurredAt.UnixNano(), sl.ReplicaVersion)
+			return true, nil
+		})
+		mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "ABCD").Return(nil)
+		mockBloom.EXPECT().Add(gomock.Any(), "ABCD").Return(nil)
+
+		require.NoError(t, svc.Apply(context.Background(), event(mq.EventTypeLinkCreated)))
+		assert.Equal(t, int64(1), svc.Stats().Applied)
+	})
+
+	t.Run("deleted link is disabled", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc, mockMySQL, mockRedis, _ := newTestReplicationService(ctrl)
+		mockMySQL.EXPECT().ApplyReplicatedShortLink(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, sl *model.ShortLink) (bool, error) {
+			assert.Equal(t, 0, sl.Status)
+			return true, nil
+		})
+		mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "ABCD").Return(errors.New("redis error"))
+
+		require.NoError(t, svc.Apply(context.Background(), event(mq.EventTypeLinkDeleted)))
+	})
+
+	t.Run("stale event is skipped", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc, mockMySQL, _, _ := newTestReplicationService(ctrl)
+		mockMySQL.EXPECT().ApplyReplicatedShortLink(gomock.Any(), gomock.Any()).Return(false, nil)
+
+		require.NoError(t, svc.Apply(context.Background(), event(mq.EventTypeLinkUpdated)))
+		stats := svc.Stats()
+		assert.Zero(t, stats.Applied)
+		assert.Equal(t, int64(1), stats.Skipped)
+	})
+
+	t.Run("event of the own region is skipped", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc, _, _, _ := newTestReplicationService(ctrl)
+		msg := event(mq.EventTypeLinkCreated)
+		msg.Region = "us-east"
+
+		require.NoError(t, svc.Apply(context.Background(), msg))
+		assert.Equal(t, int64(1), svc.Stats().Skipped)
+	})
+
+	t.Run("storage failure is returned for redelivery", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc, mockMySQL, _, _ := newTestReplicationService(ctrl)
+		mockMySQL.EXPECT().ApplyReplicatedShortLink(gomock.Any(), gomock.Any()).Return(false, errors.New("db down"))
+
+		assert.Error(t, svc.Apply(context.Background(), event(mq.EventTypeLinkCreated)))
+		assert.Nil(t, svc.Stats().LastEventAt)
+	})
+}
+
+func TestReplicationService_Stats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	svc, mockMySQL, mockRedis, mockBloom := newTestReplicationService(ctrl)
+	occurredAt := time.Unix(1700000000, 0)
+	svc.clock = clock.NewFake(occurredAt.Add(1500 * time.Millisecond))
+
+	stats := svc.Stats()
+	assert.Equal(t, "us-east", stats.Region)
+	assert.Nil(t, stats.LastEventAt)
+	assert.Zero(t, stats.LagSeconds)
+
+	mockMySQL.EXPECT().ApplyReplicatedShortLink(gomock.Any(), gomock.Any()).Return(true, nil)
+	mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "ABCD").Return(nil)
+	mockBloom.EXPECT().Add(gomock.Any(), "ABCD").Return(nil)
+	require.NoError(t, svc.Apply(context.Background(), &mq.LinkEventMessage{
+		Type: mq.EventTypeLinkCreated, ShortCode: "ABCD", OriginalURL: "https://example.com", OccurredAt: occurredAt,
+	}))
+
+	stats = svc.Stats()
+	require.NotNil(t, stats.LastEventAt)
+	assert.True(t, occurredAt.Equal(*stats.LastEventAt))
+	assert.InDelta(t, 1.5, stats.LagSeconds, 0.001)
+}
+
+func TestShortLinkService_ReadOnly(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	svc := NewShortLinkService(mocks.NewMockDatabase(ctrl), mocks.NewMockCache(ctrl),
+		mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+	svc.SetReadOnly(true)
+
+	_, err := svc.Generate(context.Background(), &model.GenerateRequest{URL: "https://example.com"})
+	assert.ErrorIs(t, err, ErrReadOnlyReplica)
+
+	title := "Spring sale"
+	_, err = svc.Update(context.Background(), "ABCD", &model.UpdateRequest{Title: &title})
+	assert.ErrorIs(t, err, ErrReadOnlyReplica)
+
+	_, err = svc.Reconcile(context.Background(), &model.DeclarativeRequest{}, false)
+	assert.ErrorIs(t, err, ErrReadOnlyReplica)
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/pkg/mailer"
+)
+
+// mailSender emails reports as HTML
+type mailSender struct {
+	mailer *mailer.Mailer
+	to     []string
+}
+
+// Send emails a report to the recipients
+func (s *mailSender) Send(ctx context.Context, _ *model.WeeklyReport, msg *mailer.Message) error {
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to email report: %w", err)
+	}
+	return nil
+}
+
+// webhookSender posts reports as JSON
+type webhookSender struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookSender(cfg *config.WebhookConfig) *webhookSender {
+	return &webhookSender{url: cfg.URL, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// Send posts a report, any status but 2xx failing the delivery
+func (s *webhookSender) Send(ctx context.Context, report *model.WeeklyReport, _ *mailer.Message) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid report webhook: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post report: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to post report: webhook responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/internal/storage"
+	"octopus/pkg/clock"
+	"octopus/pkg/mailer"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// reportClaimTTL keeps the claim of a delivered week long after the next week is due
+const reportClaimTTL = 30 * 24 * time.Hour
+
+// reportSender delivers a compiled report, rendered as an email
+type reportSender interface {
+	Send(ctx context.Context, report *model.WeeklyReport, msg *mailer.Message) error
+}
+
+// ReportService compiles weekly summaries of the campaigns, links being grouped by the value of a
+// param, and delivers them by email or webhook once the week is over
+type ReportService struct {
+	mysqlRepo storage.StatsStore
+	client    redis.Cmdable
+	cfg       *config.ReportsConfig
+	senders   []reportSender
+	clock     clock.Clock
+}
+
+// NewReportService creates a new Report Service emailing the configured recipients through mail and
+// posting to the configured webhook
+func NewReportService(mysqlRepo storage.StatsStore, client redis.Cmdable, cfg *config.ReportsConfig, mail *mailer.Mailer) *ReportService {
+	rs := &ReportService{
+		mysqlRepo: mysqlRepo,
+		client:    client,
+		cfg:       cfg,
+		clock:     clock.Real,
+	}
+	if len(cfg.To) > 0 {
+		rs.senders = append(rs.senders, &mailSender{mailer: mail, to: cfg.To})
+	}
+	if cfg.Webhook.URL != "" {
+		rs.senders = append(rs.senders, newWebhookSender(&cfg.Webhook))
+	}
+	return rs
+}
+
+// schedule returns the latest send time at or before now and the week reported then, which ends
+// the day before
+func (rs *ReportService) schedule(now time.Time) (time.Time, model.Period) {
+	now = now.UTC()
+	sendDay := now.Truncate(24 * time.Hour)
+	sendDay = sendDay.AddDate(0, 0, -((int(sendDay.Weekday()) - int(rs.cfg.SendDay()) + 7) % 7))
+	if sendDay.Add(time.Duration(rs.cfg.Hour) * time.Hour).After(now) {
+		sendDay = sendDay.AddDate(0, 0, -7)
+	}
+	return sendDay.Add(time.Duration(rs.cfg.Hour) * time.Hour), model.Period{From: sendDay.AddDate(0, 0, -7), To: sendDay.AddDate(0, 0, -1)}
+}
+
+// LastWeek compiles the report of the latest week due
+func (rs *ReportService) LastWeek(ctx context.Context) (*model.WeeklyReport, error) {
+	_, week := rs.schedule(rs.clock.Now())
+	return rs.Generate(ctx, week)
+}
+
+// Generate compiles the report of a week, comparing every campaign with the week before
+func (rs *ReportService) Generate(ctx context.Context, week model.Period) (*model.WeeklyReport, error) {
+	previous := model.Period{From: week.From.AddDate(0, 0, -7), To: week.From.AddDate(0, 0, -1)}
+
+	stats, err := rs.mysqlRepo.GetCampaignDailyStats(ctx, rs.cfg.Param, previous.From, week.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign stats: %w", err)
+	}
+	sourceStats, err := rs.mysqlRepo.GetCampaignDailySourceStats(ctx, rs.cfg.Param, previous.From, week.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign source stats: %w", err)
+	}
+
+	// Index 0 sums the reported week, index 1 the week before
+	weekOf := func(day time.Time) int {
+		if day.UTC().Before(week.From) {
+			return 1
+		}
+		return 0
+	}
+
+	type linkCounts struct {
+		link   model.CampaignDailyStat
+		clicks [2]int64
+	}
+	type campaignCounts struct {
+		clicks, visitors [2]int64
+		links            map[string]*linkCounts
+		sources          map[string]*[2]int64
+	}
+	campaigns := make(map[string]*campaignCounts)
+	campaignOf := func(name string) *campaignCounts {
+		counts, ok := campaigns[name]
+		if !ok {
+			counts = &campaignCounts{links: make(map[string]*linkCounts), sources: make(map[string]*[2]int64)}
+			campaigns[name] = counts
+		}
+		return counts
+	}
+
+	for _, stat := range stats {
+		campaign := campaignOf(stat.Campaign)
+		w := weekOf(stat.Day)
+		campaign.clicks[w] += stat.Clicks
+		campaign.visitors[w] += stat.Visitors
+		link, ok := campaign.links[stat.ShortCode]
+		if !ok {
+			link = &linkCounts{link: stat}
+			campaign.links[stat.ShortCode] = link
+		}
+		link.clicks[w] += stat.Clicks
+	}
+	for _, stat := range sourceStats {
+		campaign := campaignOf(stat.Campaign)
+		counts, ok := campaign.sources[stat.Source]
+		if !ok {
+			counts = &[2]int64{}
+			campaign.sources[stat.Source] = counts
+		}
+		counts[weekOf(stat.Day)] += stat.Clicks
+	}
+
+	report := &model.WeeklyReport{
+		Current:     week,
+		Previous:    previous,
+		GeneratedAt: rs.clock.Now().UTC(),
+		Campaigns:   make([]model.CampaignSummary, 0, len(campaigns)),
+	}
+	for name, counts := range campaigns {
+		summary := model.CampaignSummary{
+			Campaign: name,
+			Links:    len(counts.links),
+			Clicks:   newMetricChange(counts.clicks[0], counts.clicks[1]),
+			Visitors: newMetricChange(counts.visitors[0], counts.visitors[1]),
+		}
+
+		links := make([]model.LinkClicks, 0, len(counts.links))
+		for _, link := range counts.links {
+			links = append(links, model.LinkClicks{
+				ShortCode:    link.link.ShortCode,
+				OriginalURL:  link.link.OriginalURL,
+				Title:        link.link.Title,
+				MetricChange: newMetricChange(link.clicks[0], link.clicks[1]),
+			})
+		}
+		sort.Slice(links, func(i, j int) bool {
+			return busier(links[i].MetricChange, links[j].MetricChange, links[i].ShortCode, links[j].ShortCode)
+		})
+		summary.TopLinks = links[:min(len(links), rs.cfg.TopLinks)]
+
+		sources := make([]model.SourceChange, 0, len(counts.sources))
+		for source, clicks := range counts.sources {
+			sources = append(sources, model.SourceChange{Source: source, MetricChange: newMetricChange(clicks[0], clicks[1])})
+		}
+		sort.Slice(sources, func(i, j int) bool {
+			return busier(sources[i].MetricChange, sources[j].MetricChange, sources[i].Source, sources[j].Source)
+		})
+		summary.TopSources = sources[:min(len(sources), rs.cfg.TopSources)]
+
+		report.Campaigns = append(report.Campaigns, summary)
+	}
+	sort.Slice(report.Campaigns, func(i, j int) bool {
+		a, b := report.Campaigns[i], report.Campaigns[j]
+		return busier(a.Clicks, b.Clicks, a.Campaign, b.Campaign)
+	})
+
+	return report, nil
+}
+
+// busier orders by clicks in the current period, then in the previous one, then by name
+func busier(a, b model.MetricChange, nameA, nameB string) bool {
+	if a.Current != b.Current {
+		return a.Current > b.Current
+	}
+	if a.Previous != b.Previous {
+		return a.Previous > b.Previous
+	}
+	return nameA < nameB
+}
+
+// reportTemplate renders a report as an HTML email
+var reportTemplate = mailer.MustParseTemplate("report", "Weekly link report {{day .Current.From}} to {{day .Current.To}}", reportBody, map[string]any{
+	"day": func(t time.Time) string { return t.Format("2006-01-02") },
+	"change": func(c model.MetricChange) string {
+		if c.ChangePercent == nil {
+			if c.Current == 0 {
+				return "-"
+			}
+			return "new"
+		}
+		return fmt.Sprintf("%+.2f%%", *c.ChangePercent)
+	},
+})
+
+const reportBody = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<h1>Weekly link report</h1>
+<p>{{day .Current.From}} to {{day .Current.To}}, compared with {{day .Previous.From}} to {{day .Previous.To}}</p>
+{{range .Campaigns}}
+<h2>{{.Campaign}}</h2>
+<p>{{.Clicks.Current}} clicks ({{change .Clicks}}), {{.Visitors.Current}} visitors ({{change .Visitors}}) over {{.Links}} links</p>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Link</th><th>Destination</th><th>Clicks</th><th>Change</th></tr>
+{{range .TopLinks}}<tr><td>{{.ShortCode}}</td><td>{{if .Title}}{{.Title}}{{else}}{{.OriginalURL}}{{end}}</td><td>{{.Current}}</td><td>{{change .MetricChange}}</td></tr>
+{{end}}</table>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Source</th><th>Clicks</th><th>Change</th></tr>
+{{range .TopSources}}<tr><td>{{.Source}}</td><td>{{.Current}}</td><td>{{change .MetricChange}}</td></tr>
+{{end}}</table>
+{{else}}
+<p>No campaign was clicked.</p>
+{{end}}
+</body>
+</html>
+`
+
+// render renders a report as an email to the configured recipients
+func (rs *ReportService) render(report *model.WeeklyReport) (*mailer.Message, error) {
+	msg, err := reportTemplate.Render(rs.cfg.To, report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render report: %w", err)
+	}
+	return msg, nil
+}
+
+// RenderHTML renders a report as HTML
+func (rs *ReportService) RenderHTML(report *model.WeeklyReport) ([]byte, error) {
+	msg, err := rs.render(report)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(msg.Body), nil
+}
+
+// Deliver compiles the report of a week and sends it to every destination
+func (rs *ReportService) Deliver(ctx context.Context, week model.Period) error {
+	report, err := rs.Generate(ctx, week)
+	if err != nil {
+		return err
+	}
+	msg, err := rs.render(report)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, sender := range rs.senders {
+		if err := sender.Send(ctx, report, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run delivers the report of every week once it is due, checking every interval until the
+// context is canceled
+func (rs *ReportService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rs.deliverDue(ctx)
+		}
+	}
+}
+
+// deliverDue delivers the latest week due unless an instance claimed it already. A failed delivery
+// releases the claim, so the whole report is sent again on the next check.
+func (rs *ReportService) deliverDue(ctx context.Context) {
+	_, week := rs.schedule(rs.clock.Now())
+	key := rs.cfg.Key + ":" + week.To.Format("2006-01-02")
+
+	claimed, err := rs.client.SetNX(ctx, key, rs.clock.Now().UTC().Format(time.RFC3339), reportClaimTTL).Result()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to claim the weekly report")
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	if err := rs.Deliver(ctx, week); err != nil {
+		log.Error().Err(err).Time("week", week.From).Msg("Failed to deliver the weekly report")
+		if err := rs.client.Del(ctx, key).Err(); err != nil {
+			log.Warn().Err(err).Msg("Failed to release the weekly report")
+		}
+		return
+	}
+	log.Info().Time("week", week.From).Msg("Delivered the weekly report")
+}
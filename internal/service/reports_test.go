@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/pkg/clock"
+	"octopus/pkg/mailer"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestReportsConfig() *config.ReportsConfig {
+	return &config.ReportsConfig{
+		Enabled:    true,
+		Param:      "campaign",
+		Weekday:    "monday",
+		Hour:       8,
+		TopLinks:   2,
+		TopSources: 2,
+		Key:        "octopus:reports",
+	}
+}
+
+// newTestReportService creates a Report Service emailing into a dry-run directory
+func newTestReportService(t *testing.T, ctrl *gomock.Controller, cfg *config.ReportsConfig) (*ReportService, *mocks.MockDatabase, *miniredis.Miniredis, string) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	mailDir := t.TempDir()
+	mail := mailer.New(mailer.Config{From: "reports@example.com", DryRunDir: mailDir})
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	return NewReportService(mockMySQL, client, cfg, mail), mockMySQL, mr, mailDir
+}
+
+// sentMails returns the emails written to a dry-run directory, oldest first
+func sentMails(t *testing.T, dir string) []string {
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	mails := make([]string, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(dir, file.Name()))
+		require.NoError(t, err)
+		mails = append(mails, string(data))
+	}
+	return mails
+}
+
+func day(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestReportService_Schedule(t *testing.T) {
+	rs := &ReportService{cfg: newTestReportsConfig()}
+
+	tests := []struct {
+		name   string
+		now    string
+		sendAt string
+		from   string
+		to     string
+	}{
+		{name: "on the send time", now: "2024-01-08T08:00:00Z", sendAt: "2024-01-08T08:00:00Z", from: "2024-01-01", to: "2024-01-07"},
+		{name: "later in the week", now: "2024-01-11T12:00:00Z", sendAt: "2024-01-08T08:00:00Z", from: "2024-01-01", to: "2024-01-07"},
+		{name: "before the send time", now: "2024-01-08T07:59:00Z", sendAt: "2024-01-01T08:00:00Z", from: "2023-12-25", to: "2023-12-31"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, _ := time.Parse(time.RFC3339, tt.now)
+			sendAt, week := rs.schedule(now)
+			assert.Equal(t, tt.sendAt, sendAt.Format(time.RFC3339))
+			assert.Equal(t, day(tt.from), week.From)
+			assert.Equal(t, day(tt.to), week.To)
+		})
+	}
+}
+
+func TestReportService_Generate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rs, mockMySQL, _, _ := newTestReportService(t, ctrl, newTestReportsConfig())
+	week := model.Period{From: day("2024-01-01"), To: day("2024-01-07")}
+
+	mockMySQL.EXPECT().GetCampaignDailyStats(gomock.Any(), "campaign", day("2023-12-25"), day("2024-01-07")).Return([]model.CampaignDailyStat{
+		{Campaign: "spring", ShortCode: "AAAA", OriginalURL: "https://example.com/a", Day: day("2024-01-02"), Clicks: 30, Visitors: 20},
+		{Campaign: "spring", ShortCode: "AAAA", OriginalURL: "https://example.com/a", Day: day("2023-12-26"), Clicks: 10, Visitors: 10},
+		{Campaign: "spring", ShortCode: "BBBB", OriginalURL: "https://example.com/b", Day: day("2024-01-03"), Clicks: 5, Visitors: 5},
+		{Campaign: "spring", ShortCode: "CCCC", OriginalURL: "https://example.com/c", Day: day("2024-01-04"), Clicks: 1, Visitors: 1},
+		{Campaign: "winter", ShortCode: "DDDD", OriginalURL: "https://example.com/d", Day: day("2023-12-27"), Clicks: 50, Visitors: 40},
+	}, nil)
+	mockMySQL.EXPECT().GetCampaignDailySourceStats(gomock.Any(), "campaign", day("2023-12-25"), day("2024-01-07")).Return([]model.CampaignDailySourceStat{
+		{Campaign: "spring", Day: day("2024-01-02"), Source: "google", Clicks: 20},
+		{Campaign: "spring", Day: day("2023-12-26"), Source: "google", Clicks: 10},
+		{Campaign: "spring", Day: day("2024-01-03"), Source: "direct", Clicks: 15},
+		{Campaign: "spring", Day: day("2024-01-04"), Source: "twitter", Clicks: 1},
+	}, nil)
+
+	report, err := rs.Generate(context.Background(), week)
+	require.NoError(t, err)
+	assert.Equal(t, week, report.Current)
+	assert.Equal(t, model.Period{From: day("2023-12-25"), To: day("2023-12-31")}, report.Previous)
+	require.Len(t, report.Campaigns, 2)
+
+	spring := report.Campaigns[0]
+	assert.Equal(t, "spring", spring.Campaign)
+	assert.Equal(t, 3, spring.Links)
+	assert.Equal(t, int64(36), spring.Clicks.Current)
+	assert.Equal(t, int64(10), spring.Clicks.Previous)
+	assert.Equal(t, 260.0, *spring.Clicks.ChangePercent)
+	assert.Equal(t, int64(26), spring.Visitors.Current)
+	require.Len(t, spring.TopLinks, 2)
+	assert.Equal(t, "AAAA", spring.TopLinks[0].ShortCode)
+	assert.Equal(t, "BBBB", spring.TopLinks[1].ShortCode)
+	assert.Nil(t, spring.TopLinks[1].ChangePercent)
+	require.Len(t, spring.TopSources, 2)
+	assert.Equal(t, "google", spring.TopSources[0].Source)
+	assert.Equal(t, "direct", spring.TopSources[1].Source)
+
+	winter := report.Campaigns[1]
+	assert.Equal(t, "winter", winter.Campaign)
+	assert.Zero(t, winter.Clicks.Current)
+	assert.Equal(t, -100.0, *winter.Clicks.ChangePercent)
+	assert.Empty(t, winter.TopSources)
+
+	html, err := rs.RenderHTML(report)
+	require.NoError(t, err)
+	assert.Contains(t, string(html), "2024-01-01 to 2024-01-07")
+	assert.Contains(t, string(html), "<h2>spring</h2>")
+	assert.Contains(t, string(html), "36 clicks (&#43;260.00%)")
+	assert.Contains(t, string(html), "https://example.com/b</td><td>5</td><td>new")
+}
+
+func TestReportService_GenerateError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rs, mockMySQL, _, _ := newTestReportService(t, ctrl, newTestReportsConfig())
+	mockMySQL.EXPECT().GetCampaignDailyStats(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("db error"))
+
+	_, err := rs.Generate(context.Background(), model.Period{From: day("2024-01-01"), To: day("2024-01-07")})
+	assert.ErrorContains(t, err, "db error")
+}
+
+func TestReportService_DeliverDue(t *testing.T) {
+	var posted []model.WeeklyReport
+	status := http.StatusOK
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report model.WeeklyReport
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&report))
+		posted = append(posted, report)
+		w.WriteHeader(status)
+	}))
+	defer webhook.Close()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := newTestReportsConfig()
+	cfg.To = []string{"team@example.com"}
+	cfg.Webhook = config.WebhookConfig{URL: webhook.URL, Timeout: time.Second}
+	rs, mockMySQL, mr, mailDir := newTestReportService(t, ctrl, cfg)
+	rs.clock = clock.NewFake(time.Date(2024, 1, 9, 10, 0, 0, 0, time.UTC))
+	mockMySQL.EXPECT().GetCampaignDailyStats(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil).Times(2)
+	mockMySQL.EXPECT().GetCampaignDailySourceStats(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil).Times(2)
+
+	// A failed delivery releases the week
+	status = http.StatusInternalServerError
+	rs.deliverDue(context.Background())
+	assert.Len(t, sentMails(t, mailDir), 1)
+	assert.Len(t, posted, 1)
+	assert.False(t, mr.Exists("octopus:reports:2024-01-07"))
+
+	status = http.StatusOK
+	rs.deliverDue(context.Background())
+	mails := sentMails(t, mailDir)
+	require.Len(t, mails, 2)
+	assert.Contains(t, mails[1], "Subject: Weekly link report 2024-01-01 to 2024-01-07\r\n")
+	assert.Contains(t, mails[1], "Content-Type: text/html; charset=UTF-8\r\n")
+	assert.Contains(t, mails[1], "No campaign was clicked.")
+	require.Len(t, posted, 2)
+	assert.Equal(t, day("2024-01-01"), posted[1].Current.From)
+	assert.True(t, mr.Exists("octopus:reports:2024-01-07"))
+
+	// The week is delivered once
+	rs.deliverDue(context.Background())
+	assert.Len(t, sentMails(t, mailDir), 2)
+	assert.Len(t, posted, 2)
+}
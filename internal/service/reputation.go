@@ -0,0 +1,452 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/internal/storage"
+	"octopus/pkg/clock"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/publicsuffix"
+)
+
+// ErrInvalidDomain is returned when a domain given to the reputation API is not a host name
+var ErrInvalidDomain = errors.New("invalid domain")
+
+const (
+	// reportPenalty is the score every abuse report of a domain costs, up to maxReportPenalty
+	reportPenalty    = 10
+	maxReportPenalty = 60
+	// maxDeadPenalty is the score a domain whose links are always dead loses
+	maxDeadPenalty = 40
+	// minReputationChecks is the number of checks before dead links count, one outage being no rate
+	minReputationChecks = 3
+)
+
+// SafeBrowsing tells which URLs are listed as unsafe
+type SafeBrowsing interface {
+	Unsafe(ctx context.Context, urls []string) (map[string]bool, error)
+}
+
+// Reputation scores the destination domains of links from their abuse reports, the share of checks
+// finding their links dead and their Safe Browsing listing. Low scores redirect visitors through a
+// preview of the destination, and lower ones refuse new links; operators override the verdict of
+// a domain either way. Verdicts are reloaded periodically, the request path reading them from
+// memory.
+type Reputation struct {
+	links        storage.LinkStore
+	store        storage.ReputationStore
+	client       redis.UniversalClient
+	cfg          config.ReputationConfig
+	safeBrowsing SafeBrowsing
+	http         *http.Client
+	clock        clock.Clock
+
+	// verdicts holds the domains not allowed, by their verdict
+	verdicts atomic.Pointer[map[string]string]
+}
+
+// NewReputation creates the domain reputation, allowing every domain until the first reload
+func NewReputation(links storage.LinkStore, store storage.ReputationStore, client redis.UniversalClient, cfg *config.ReputationConfig) *Reputation {
+	r := &Reputation{
+		links:  links,
+		store:  store,
+		client: client,
+		cfg:    *cfg,
+		http:   &http.Client{Timeout: cfg.Timeout},
+		clock:  clock.Real,
+	}
+	if cfg.SafeBrowsing.APIKey != "" {
+		r.safeBrowsing = NewSafeBrowsingClient(&cfg.SafeBrowsing, cfg.Timeout)
+	}
+	r.verdicts.Store(&map[string]string{})
+	return r
+}
+
+// SetSafeBrowsing replaces the Safe Browsing lookups, nil to check links for dead ones only
+func (r *Reputation) SetSafeBrowsing(safeBrowsing SafeBrowsing) {
+	r.safeBrowsing = safeBrowsing
+}
+
+// verdict returns the verdict of a destination, allow without reputation
+func (r *Reputation) verdict(rawURL string) string {
+	if r == nil {
+		return model.ReputationAllow
+	}
+	if verdict, ok := (*r.verdicts.Load())[reputationDomain(rawURL)]; ok {
+		return verdict
+	}
+	return model.ReputationAllow
+}
+
+// Interstitial reports whether visitors are shown a preview before being sent to a destination
+func (r *Reputation) Interstitial(rawURL string) bool {
+	return r.verdict(rawURL) != model.ReputationAllow
+}
+
+// Blocked reports whether new links to a destination are refused
+func (r *Reputation) Blocked(rawURL string) bool {
+	return r.verdict(rawURL) == model.ReputationBlock
+}
+
+// Track counts a link created to a destination, which the next checks of its domain check
+func (r *Reputation) Track(ctx context.Context, rawURL string) {
+	if r == nil {
+		return
+	}
+	domain := reputationDomain(rawURL)
+	if domain == "" {
+		return
+	}
+	if err := r.store.TrackDomain(ctx, domain, rawURL); err != nil {
+		log.Warn().Err(err).Str("domain", domain).Msg("Failed to track domain")
+	}
+}
+
+// Report counts an abuse report of a link against its destination domain, once per client IP and
+// domain within the report window. Reports only count while they keep coming within the window, so
+// a domain recovers once they stop.
+func (r *Reputation) Report(ctx context.Context, shortCode, clientIP string) error {
+	sl, err := r.links.GetShortLinkByCode(ctx, shortCode)
+	if err != nil {
+		return linkError(err)
+	}
+	domain := reputationDomain(sl.OriginalURL)
+	if domain == "" {
+		return nil
+	}
+
+	key := r.cfg.Key + ":report:" + domain + ":" + clientIP
+	first, err := r.client.SetNX(ctx, key, shortCode, r.cfg.ReportWindow).Result()
+	if err != nil {
+		return fmt.Errorf("failed to record report: %w", err)
+	}
+	if !first {
+		return nil
+	}
+	now := r.clock.Now().UTC()
+	if err := r.store.AddDomainReport(ctx, domain, now, now.Add(-r.cfg.ReportWindow)); err != nil {
+		return fmt.Errorf("failed to record report: %w", err)
+	}
+
+	log.Info().Str("short_code", shortCode).Str("domain", domain).Msg("Link reported")
+	r.changed(ctx)
+	return nil
+}
+
+// List returns the domains with something against them or an override, scored
+func (r *Reputation) List(ctx context.Context) ([]model.DomainReputation, error) {
+	reps, err := r.store.ListDomainReputations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domain reputations: %w", err)
+	}
+	for i := range reps {
+		r.score(&reps[i])
+	}
+	return reps, nil
+}
+
+// Get returns the scored reputation of a domain, or of the registrable domain of a host
+func (r *Reputation) Get(ctx context.Context, domain string) (*model.DomainReputation, error) {
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+	rep, err := r.store.GetDomainReputation(ctx, domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain reputation: %w", err)
+	}
+	r.score(rep)
+	return rep, nil
+}
+
+// Override sets the verdict of a domain whatever its score, on every instance within the refresh
+// interval
+func (r *Reputation) Override(ctx context.Context, domain, verdict string) (*model.DomainReputation, error) {
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.store.SetDomainOverride(ctx, domain, verdict); err != nil {
+		return nil, fmt.Errorf("failed to override domain reputation: %w", err)
+	}
+
+	log.Info().Str("domain", domain).Str("verdict", verdict).Msg("Domain reputation overridden")
+	r.changed(ctx)
+	return r.Get(ctx, domain)
+}
+
+// ClearOverride lets the score of a domain decide its verdict again
+func (r *Reputation) ClearOverride(ctx context.Context, domain string) (*model.DomainReputation, error) {
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.store.GetDomainReputation(ctx, domain); err != nil {
+		return nil, fmt.Errorf("failed to get domain reputation: %w", err)
+	}
+	if err := r.store.SetDomainOverride(ctx, domain, ""); err != nil {
+		return nil, fmt.Errorf("failed to clear domain reputation override: %w", err)
+	}
+
+	log.Info().Str("domain", domain).Msg("Domain reputation override cleared")
+	r.changed(ctx)
+	return r.Get(ctx, domain)
+}
+
+// score sets the score and verdict of a domain
+func (r *Reputation) score(rep *model.DomainReputation) {
+	rep.Score = reputationScore(rep, r.clock.Now().Add(-r.cfg.ReportWindow))
+	switch {
+	case rep.Override != "":
+		rep.Verdict = rep.Override
+	case rep.Score < r.cfg.BlockBelow:
+		rep.Verdict = model.ReputationBlock
+	case rep.Score < r.cfg.InterstitialBelow:
+		rep.Verdict = model.ReputationInterstitial
+	default:
+		rep.Verdict = model.ReputationAllow
+	}
+}
+
+// reputationScore rates a domain from 100, nothing known against it, down to 0. A Safe Browsing
+// listing is final; every report costs reportPenalty up to maxReportPenalty as long as the last one
+// was made after since, and dead links up to maxDeadPenalty in proportion of the checks finding
+// them dead.
+func reputationScore(rep *model.DomainReputation, since time.Time) int {
+	if rep.Flagged {
+		return 0
+	}
+	score := 100
+	if rep.ReportedAt != nil && !rep.ReportedAt.Before(since) {
+		score -= int(min(rep.Reports*reportPenalty, maxReportPenalty))
+	}
+	if rep.Checks >= minReputationChecks {
+		score -= int(rep.DeadChecks * maxDeadPenalty / rep.Checks)
+	}
+	return max(score, 0)
+}
+
+// changed applies a change of the stored reputations here, other instances reloading them within
+// the refresh interval
+func (r *Reputation) changed(ctx context.Context) {
+	if err := r.Refresh(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to refresh domain reputations")
+	}
+}
+
+// Refresh reloads the verdicts of the domains not allowed
+func (r *Reputation) Refresh(ctx context.Context) error {
+	reps, err := r.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	verdicts := make(map[string]string)
+	for _, rep := range reps {
+		if rep.Verdict != model.ReputationAllow {
+			verdicts[rep.Domain] = rep.Verdict
+		}
+	}
+	r.verdicts.Store(&verdicts)
+	return nil
+}
+
+// Check checks a batch of the domains due, if no other instance did within the check interval, and
+// returns the number of domains checked. Links are dead when they cannot be fetched or answer
+// with 404, 410 or a server error.
+func (r *Reputation) Check(ctx context.Context) (int, error) {
+	claimed, err := r.client.SetNX(ctx, r.cfg.Key+":check", "1", r.cfg.CheckInterval).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim domain checks: %w", err)
+	}
+	if !claimed {
+		return 0, nil
+	}
+
+	now := r.clock.Now()
+	reps, err := r.store.ListDomainsToCheck(ctx, now.Add(-r.cfg.RecheckAfter), r.cfg.CheckBatch)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list domains to check: %w", err)
+	}
+	if len(reps) == 0 {
+		return 0, nil
+	}
+
+	// A failed lookup keeps the listings of the last checks
+	var unsafe map[string]bool
+	if r.safeBrowsing != nil {
+		urls := make([]string, len(reps))
+		for i, rep := range reps {
+			urls[i] = rep.SampleURL
+		}
+		if unsafe, err = r.safeBrowsing.Unsafe(ctx, urls); err != nil {
+			log.Warn().Err(err).Msg("Failed to look up Safe Browsing")
+		}
+	}
+
+	for _, rep := range reps {
+		flagged := rep.Flagged
+		if unsafe != nil {
+			flagged = unsafe[rep.SampleURL]
+		}
+		dead := r.dead(ctx, rep.SampleURL)
+		if err := r.store.RecordDomainCheck(ctx, rep.Domain, dead, flagged, now.UTC()); err != nil {
+			return 0, fmt.Errorf("failed to record domain check: %w", err)
+		}
+		if dead || flagged {
+			log.Info().Str("domain", rep.Domain).Bool("dead", dead).Bool("flagged", flagged).Msg("Domain check failed")
+		}
+	}
+	r.changed(ctx)
+	return len(reps), nil
+}
+
+// dead reports whether a link cannot be fetched or answers that it is gone
+func (r *Reputation) dead(ctx context.Context, rawURL string) bool {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return true
+	}
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return true
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone ||
+		resp.StatusCode >= http.StatusInternalServerError
+}
+
+// Run reloads the verdicts every refresh interval and checks the domains due every check interval,
+// until the context is canceled
+func (r *Reputation) Run(ctx context.Context) {
+	refresh := time.NewTicker(r.cfg.RefreshInterval)
+	defer refresh.Stop()
+	check := time.NewTicker(r.cfg.CheckInterval)
+	defer check.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-refresh.C:
+			if err := r.Refresh(ctx); err != nil {
+				log.Warn().Err(err).Msg("Failed to refresh domain reputations")
+			}
+		case <-check.C:
+			if _, err := r.Check(ctx); err != nil {
+				log.Warn().Err(err).Msg("Failed to check domains")
+			}
+		}
+	}
+}
+
+// reputationDomain returns the registrable domain of a destination, empty when it has none
+func reputationDomain(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	domain, err := normalizeDomain(u.Hostname())
+	if err != nil {
+		return ""
+	}
+	return domain
+}
+
+// normalizeDomain returns the registrable domain of a host, such as example.co.uk for
+// shop.example.co.uk, or the host itself for IPs and hosts without a public suffix
+func normalizeDomain(host string) (string, error) {
+	host = strings.Trim(strings.ToLower(strings.TrimSpace(host)), ".")
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+	if host == "" || strings.ContainsAny(host, "/:?#@ ") {
+		return "", fmt.Errorf("%w: %q is not a host name", ErrInvalidDomain, host)
+	}
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return domain, nil
+	}
+	return host, nil
+}
+
+// safeBrowsingClient looks URLs up with the Google Safe Browsing Lookup API v4
+type safeBrowsingClient struct {
+	url    string
+	apiKey string
+	http   *http.Client
+}
+
+// NewSafeBrowsingClient creates a Safe Browsing Lookup API client
+func NewSafeBrowsingClient(cfg *config.SafeBrowsingConfig, timeout time.Duration) SafeBrowsing {
+	return &safeBrowsingClient{url: cfg.URL, apiKey: cfg.APIKey, http: &http.Client{Timeout: timeout}}
+}
+
+// safeBrowsingEntry is a URL of a Safe Browsing lookup or match
+type safeBrowsingEntry struct {
+	URL string `json:"url"`
+}
+
+// Unsafe returns the URLs listed for malware, social engineering or unwanted software
+func (c *safeBrowsingClient) Unsafe(ctx context.Context, urls []string) (map[string]bool, error) {
+	entries := make([]safeBrowsingEntry, len(urls))
+	for i, u := range urls {
+		entries[i] = safeBrowsingEntry{URL: u}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"client": map[string]string{"clientId": "octopus", "clientVersion": "1.0"},
+		"threatInfo": map[string]interface{}{
+			"threatTypes":      []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"},
+			"platformTypes":    []string{"ANY_PLATFORM"},
+			"threatEntryTypes": []string{"URL"},
+			"threatEntries":    entries,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal Safe Browsing lookup: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+"?key="+url.QueryEscape(c.apiKey), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Safe Browsing lookup: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up Safe Browsing: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to look up Safe Browsing: status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Matches []struct {
+			Threat safeBrowsingEntry `json:"threat"`
+		} `json:"matches"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode Safe Browsing matches: %w", err)
+	}
+	unsafe := make(map[string]bool, len(result.Matches))
+	for _, match := range result.Matches {
+		unsafe[match.Threat.URL] = true
+	}
+	return unsafe, nil
+}
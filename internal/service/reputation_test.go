@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/pkg/clock"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSafeBrowsing lists the URLs of a map as unsafe
+type fakeSafeBrowsing map[string]bool
+
+func (f fakeSafeBrowsing) Unsafe(_ context.Context, urls []string) (map[string]bool, error) {
+	unsafe := make(map[string]bool)
+	for _, u := range urls {
+		if f[u] {
+			unsafe[u] = true
+		}
+	}
+	return unsafe, nil
+}
+
+// rewriteHost sends every request to a test server, whatever host it was for
+type rewriteHost struct {
+	host string
+}
+
+func (r rewriteHost) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = "http", r.host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newTestReputation(t *testing.T, store *repository.MemoryRepository) (*Reputation, *miniredis.Miniredis) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	r := NewReputation(store, store, client, &config.ReputationConfig{
+		Key:               "octopus:reputation",
+		InterstitialBelow: 60,
+		BlockBelow:        30,
+		CheckInterval:     time.Minute,
+		CheckBatch:        10,
+		RecheckAfter:      time.Hour,
+		Timeout:           time.Second,
+		ReportWindow:      time.Hour,
+	})
+	return r, s
+}
+
+func TestReputation_Reports(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryRepository()
+	r, s := newTestReputation(t, store)
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	r.clock = fake
+	require.NoError(t, store.SaveShortLink(ctx, &model.ShortLink{ShortCode: "abc123", OriginalURL: "https://Shop.Example.co.uk/deal"}))
+
+	assert.ErrorIs(t, r.Report(ctx, "zzz999", "10.0.0.1"), ErrShortLinkNotFound)
+
+	// Reports count once per client IP
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, r.Report(ctx, "abc123", fmt.Sprintf("10.0.0.%d", i)))
+		require.NoError(t, r.Report(ctx, "abc123", fmt.Sprintf("10.0.0.%d", i)))
+	}
+	rep, err := r.Get(ctx, "www.example.co.uk")
+	require.NoError(t, err)
+	assert.Equal(t, "example.co.uk", rep.Domain)
+	assert.Equal(t, int64(4), rep.Reports)
+	assert.Equal(t, 60, rep.Score)
+	assert.Equal(t, model.ReputationAllow, rep.Verdict)
+	assert.False(t, r.Interstitial("https://example.co.uk/"))
+
+	require.NoError(t, r.Report(ctx, "abc123", "10.0.0.5"))
+	assert.True(t, r.Interstitial("https://cdn.example.co.uk/x"))
+	assert.False(t, r.Blocked("https://cdn.example.co.uk/x"))
+	assert.False(t, r.Interstitial("https://example.com/"))
+
+	// Overrides win over the score, until cleared
+	rep, err = r.Override(ctx, "example.co.uk", model.ReputationBlock)
+	require.NoError(t, err)
+	assert.Equal(t, model.ReputationBlock, rep.Verdict)
+	assert.True(t, r.Blocked("https://example.co.uk/other"))
+
+	rep, err = r.ClearOverride(ctx, "example.co.uk")
+	require.NoError(t, err)
+	assert.Equal(t, model.ReputationInterstitial, rep.Verdict)
+	assert.False(t, r.Blocked("https://example.co.uk/other"))
+
+	_, err = r.ClearOverride(ctx, "example.org")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = r.Override(ctx, "example.org/path", model.ReputationAllow)
+	assert.ErrorIs(t, err, ErrInvalidDomain)
+
+	reps, err := r.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, reps, 1)
+	assert.Equal(t, 50, reps[0].Score)
+
+	// Reports stop counting once none came within the window, and count again from one
+	fake.Advance(time.Hour + time.Second)
+	s.FastForward(time.Hour + time.Second)
+	rep, err = r.Get(ctx, "example.co.uk")
+	require.NoError(t, err)
+	assert.Equal(t, 100, rep.Score)
+	require.NoError(t, r.Report(ctx, "abc123", "10.0.0.1"))
+	rep, err = r.Get(ctx, "example.co.uk")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), rep.Reports)
+	assert.Equal(t, 90, rep.Score)
+}
+
+func TestReputation_Check(t *testing.T) {
+	dead := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if dead {
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	store := repository.NewMemoryRepository()
+	r, s := newTestReputation(t, store)
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	r.clock = fake
+	r.Track(ctx, server.URL+"/landing")
+	r.Track(ctx, "https://unsafe.example.net/")
+	r.SetSafeBrowsing(fakeSafeBrowsing{"https://unsafe.example.net/": true})
+	r.http.Transport = rewriteHost{host: server.Listener.Addr().String()}
+
+	check := func() int {
+		t.Helper()
+		s.FastForward(time.Minute)
+		fake.Advance(time.Hour + time.Second)
+		n, err := r.Check(ctx)
+		require.NoError(t, err)
+		return n
+	}
+
+	// Listed domains are blocked from the first check, dead links only count after a few checks
+	assert.Equal(t, 2, check())
+	assert.True(t, r.Blocked("https://unsafe.example.net/other"))
+	assert.False(t, r.Interstitial(server.URL))
+	check()
+	check()
+	rep, err := r.Get(ctx, "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), rep.DeadChecks)
+	assert.Equal(t, 60, rep.Score)
+	dead = false
+	check()
+	rep, err = r.Get(ctx, "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, 70, rep.Score)
+
+	// Checks are claimed by one instance per interval, and wait for the recheck delay
+	n, err := r.Check(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	s.FastForward(time.Minute)
+	n, err = r.Check(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestReputationScore(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	since := now.Add(-time.Hour)
+	old := since.Add(-time.Second)
+	assert.Equal(t, 100, reputationScore(&model.DomainReputation{}, since))
+	assert.Equal(t, 40, reputationScore(&model.DomainReputation{Reports: 20, ReportedAt: &now}, since))
+	assert.Equal(t, 100, reputationScore(&model.DomainReputation{Reports: 20, ReportedAt: &old}, since))
+	assert.Equal(t, 100, reputationScore(&model.DomainReputation{Checks: 2, DeadChecks: 2}, since))
+	assert.Equal(t, 0, reputationScore(&model.DomainReputation{Reports: 10, ReportedAt: &now, Checks: 5, DeadChecks: 5}, since))
+	assert.Equal(t, 0, reputationScore(&model.DomainReputation{Flagged: true}, since))
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	for host, want := range map[string]string{
+		"Shop.Example.co.uk.": "example.co.uk",
+		"example.com":         "example.com",
+		"localhost":           "localhost",
+		"::1":                 "::1",
+	} {
+		got, err := normalizeDomain(host)
+		require.NoError(t, err, host)
+		assert.Equal(t, want, got)
+	}
+	_, err := normalizeDomain("")
+	assert.ErrorIs(t, err, ErrInvalidDomain)
+	assert.Equal(t, "", reputationDomain("mailto:someone"))
+}
+
+func TestSafeBrowsingClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "k3y", r.URL.Query().Get("key"))
+		var lookup struct {
+			ThreatInfo struct {
+				ThreatEntries []safeBrowsingEntry `json:"threatEntries"`
+			} `json:"threatInfo"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&lookup))
+		assert.Len(t, lookup.ThreatInfo.ThreatEntries, 2)
+		w.Write([]byte(`{"matches":[{"threatType":"MALWARE","threat":{"url":"https://bad.example/"}}]}`))
+	}))
+	defer server.Close()
+
+	sb := NewSafeBrowsingClient(&config.SafeBrowsingConfig{APIKey: "k3y", URL: server.URL}, time.Second)
+	unsafe, err := sb.Unsafe(context.Background(), []string{"https://bad.example/", "https://good.example/"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"https://bad.example/": true}, unsafe)
+}
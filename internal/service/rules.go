@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/internal/storage"
+	"octopus/pkg/util"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrInvalidRule is returned when a rule's pattern or source does not suit its kind
+var ErrInvalidRule = errors.New("invalid rule")
+
+// Rules applies the bot, reserved word, URL blocklist and traffic source rules set at runtime on
+// top of the built-in ones. Rules are kept in MySQL; a change is announced on a Redis pub/sub
+// channel so every instance reloads them right away, and a periodic reload catches announcements
+// missed while disconnected. The request path only reads the rules held in memory.
+type Rules struct {
+	store   storage.RuleStore
+	client  redis.UniversalClient
+	channel string
+
+	set atomic.Pointer[ruleSet]
+}
+
+// ruleSet is the loaded rules, lowercased and grouped by kind for matching
+type ruleSet struct {
+	bots     []string
+	reserved map[string]bool
+	blocked  []string
+	sources  []model.Rule
+}
+
+// NewRules creates the rules, empty until the first reload
+func NewRules(store storage.RuleStore, client redis.UniversalClient, cfg *config.RulesConfig) *Rules {
+	r := &Rules{store: store, client: client, channel: cfg.Channel}
+	r.set.Store(&ruleSet{})
+	return r
+}
+
+// rules returns the loaded rules, none for nil rules
+func (r *Rules) rules() *ruleSet {
+	if r == nil {
+		return &ruleSet{}
+	}
+	return r.set.Load()
+}
+
+// IsBot reports whether a User-Agent contains the pattern of a bot rule
+func (r *Rules) IsBot(userAgent string) bool {
+	ua := strings.ToLower(userAgent)
+	for _, pattern := range r.rules().bots {
+		if strings.Contains(ua, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeviceType classifies a User-Agent like util.DeviceType, User-Agents matching a bot rule being
+// bots whatever they look like
+func (r *Rules) DeviceType(userAgent string) string {
+	if r.IsBot(userAgent) {
+		return util.DeviceBot
+	}
+	return util.DeviceType(userAgent)
+}
+
+// Reserved reports whether a short code spells a reserved word, in any case
+func (r *Rules) Reserved(shortCode string) bool {
+	return r.rules().reserved[strings.ToLower(shortCode)]
+}
+
+// Blocked reports whether a URL points to a blocklisted domain or one of its subdomains
+func (r *Rules) Blocked(rawURL string) bool {
+	blocked := r.rules().blocked
+	if len(blocked) == 0 {
+		return false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	for _, domain := range blocked {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Source maps a referer to a traffic source, the first source rule whose pattern the host contains
+// winning over SourceFromReferer. Longer patterns are tried first.
+func (r *Rules) Source(referer string) string {
+	if sources := r.rules().sources; len(sources) > 0 && referer != "" {
+		if u, err := url.Parse(referer); err == nil {
+			host := strings.ToLower(u.Hostname())
+			for _, rule := range sources {
+				if host != "" && strings.Contains(host, rule.Pattern) {
+					return rule.Source
+				}
+			}
+		}
+	}
+	return SourceFromReferer(referer)
+}
+
+// Refresh reloads the rules changed by this instance or others
+func (r *Rules) Refresh(ctx context.Context) error {
+	_, err := r.load(ctx)
+	return err
+}
+
+// load reads the rules from the store and replaces the ones held in memory, returning them
+func (r *Rules) load(ctx context.Context) ([]model.Rule, error) {
+	rules, err := r.store.ListRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rules: %w", err)
+	}
+
+	set := &ruleSet{reserved: make(map[string]bool)}
+	for _, rule := range rules {
+		pattern := strings.ToLower(rule.Pattern)
+		switch rule.Kind {
+		case model.RuleKindBotUA:
+			set.bots = append(set.bots, pattern)
+		case model.RuleKindReservedWord:
+			set.reserved[pattern] = true
+		case model.RuleKindURLBlocklist:
+			set.blocked = append(set.blocked, pattern)
+		case model.RuleKindSource:
+			set.sources = append(set.sources, model.Rule{Pattern: pattern, Source: rule.Source})
+		}
+	}
+	sort.SliceStable(set.sources, func(i, j int) bool {
+		return len(set.sources[i].Pattern) > len(set.sources[j].Pattern)
+	})
+
+	r.set.Store(set)
+	return rules, nil
+}
+
+// Run reloads the rules whenever a change is announced, and every interval, until the context is
+// canceled
+func (r *Rules) Run(ctx context.Context, interval time.Duration) {
+	sub := r.client.Subscribe(ctx, r.channel)
+	defer sub.Close()
+
+	// Load once subscribed, so that no change made in between goes unnoticed
+	if _, err := sub.Receive(ctx); err != nil && ctx.Err() == nil {
+		log.Warn().Err(err).Str("channel", r.channel).Msg("Failed to subscribe to rule changes")
+	}
+	if err := r.Refresh(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to refresh rules")
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	changes := sub.Channel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+		case <-ticker.C:
+		}
+		if err := r.Refresh(ctx); err != nil {
+			log.Warn().Err(err).Msg("Failed to refresh rules")
+		}
+	}
+}
+
+// List returns the stored rules of a kind, or of all kinds without one, by kind and pattern
+func (r *Rules) List(ctx context.Context, kind string) ([]model.Rule, error) {
+	rules, err := r.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := make([]model.Rule, 0, len(rules))
+	for _, rule := range rules {
+		if kind == "" || rule.Kind == kind {
+			listed = append(listed, rule)
+		}
+	}
+	return listed, nil
+}
+
+// Create adds a rule, applied by every instance once announced
+func (r *Rules) Create(ctx context.Context, req *model.RuleRequest) (*model.Rule, error) {
+	rule, err := newRule(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.store.SaveRule(ctx, rule); err != nil {
+		return nil, fmt.Errorf("failed to save rule: %w", err)
+	}
+
+	r.changed(ctx)
+	log.Info().Int64("id", rule.ID).Str("kind", rule.Kind).Str("pattern", rule.Pattern).Msg("Rule created")
+	return rule, nil
+}
+
+// Update replaces the kind, pattern and source of a rule
+func (r *Rules) Update(ctx context.Context, id int64, req *model.RuleRequest) (*model.Rule, error) {
+	rule, err := newRule(req)
+	if err != nil {
+		return nil, err
+	}
+	rule.ID = id
+	if err := r.store.UpdateRule(ctx, rule); err != nil {
+		return nil, fmt.Errorf("failed to update rule: %w", err)
+	}
+
+	// Reload to return the timestamps of the stored rule
+	if rules, err := r.load(ctx); err == nil {
+		for i := range rules {
+			if rules[i].ID == id {
+				rule = &rules[i]
+				break
+			}
+		}
+	}
+	r.announce(ctx)
+	log.Info().Int64("id", rule.ID).Str("kind", rule.Kind).Str("pattern", rule.Pattern).Msg("Rule updated")
+	return rule, nil
+}
+
+// Delete removes a rule, reporting whether it existed
+func (r *Rules) Delete(ctx context.Context, id int64) (bool, error) {
+	deleted, err := r.store.DeleteRule(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete rule: %w", err)
+	}
+	if deleted {
+		r.changed(ctx)
+		log.Info().Int64("id", id).Msg("Rule deleted")
+	}
+	return deleted, nil
+}
+
+// changed applies a change of the stored rules here and announces it to the other instances
+func (r *Rules) changed(ctx context.Context) {
+	if err := r.Refresh(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to refresh rules")
+	}
+	r.announce(ctx)
+}
+
+// announce tells every instance to reload the rules. Instances missing it catch up on their next
+// periodic reload.
+func (r *Rules) announce(ctx context.Context) {
+	if err := r.client.Publish(ctx, r.channel, "changed").Err(); err != nil {
+		log.Warn().Err(err).Str("channel", r.channel).Msg("Failed to announce rule change")
+	}
+}
+
+// newRule validates a rule request, lowercasing its pattern. Blocklisted URLs are given by their
+// domain, which also blocks its subdomains.
+func newRule(req *model.RuleRequest) (*model.Rule, error) {
+	rule := &model.Rule{
+		Kind:    req.Kind,
+		Pattern: strings.ToLower(strings.TrimSpace(req.Pattern)),
+		Source:  strings.TrimSpace(req.Source),
+	}
+	if rule.Pattern == "" {
+		return nil, fmt.Errorf("%w: pattern is empty", ErrInvalidRule)
+	}
+	if rule.Kind == model.RuleKindSource {
+		if rule.Source == "" {
+			return nil, fmt.Errorf("%w: source rules need a source", ErrInvalidRule)
+		}
+	} else if rule.Source != "" {
+		return nil, fmt.Errorf("%w: only source rules have a source", ErrInvalidRule)
+	}
+	if rule.Kind == model.RuleKindURLBlocklist {
+		rule.Pattern = strings.Trim(rule.Pattern, ".")
+		if strings.ContainsAny(rule.Pattern, "/:?#@ ") {
+			return nil, fmt.Errorf("%w: url_blocklist patterns are domains such as example.com", ErrInvalidRule)
+		}
+	}
+	return rule, nil
+}
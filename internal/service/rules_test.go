@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/pkg/util"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRules(t *testing.T, store *repository.MemoryRepository, s *miniredis.Miniredis) *Rules {
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRules(store, client, &config.RulesConfig{Channel: "octopus:rules"})
+}
+
+func TestRules_Match(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRules(t, repository.NewMemoryRepository(), miniredis.RunT(t))
+
+	for _, req := range []model.RuleRequest{
+		{Kind: model.RuleKindBotUA, Pattern: "HeadlessChrome"},
+		{Kind: model.RuleKindReservedWord, Pattern: "admin"},
+		{Kind: model.RuleKindURLBlocklist, Pattern: "evil.example"},
+		{Kind: model.RuleKindSource, Pattern: "example.com", Source: "partners"},
+		{Kind: model.RuleKindSource, Pattern: "news.example.com", Source: "newsletter"},
+	} {
+		_, err := r.Create(ctx, &req)
+		require.NoError(t, err)
+	}
+
+	assert.True(t, r.IsBot("Mozilla/5.0 (X11; Linux x86_64) HeadlessChrome/120.0"))
+	assert.Equal(t, util.DeviceBot, r.DeviceType("Mozilla/5.0 (iPhone) HeadlessChrome/120.0"))
+	assert.Equal(t, util.DeviceMobile, r.DeviceType("Mozilla/5.0 (iPhone; CPU iPhone OS 17_0)"))
+
+	assert.True(t, r.Reserved("ADMIN"))
+	assert.False(t, r.Reserved("ADMI"))
+
+	assert.True(t, r.Blocked("https://evil.example/login"))
+	assert.True(t, r.Blocked("https://www.EVIL.example./login"))
+	assert.False(t, r.Blocked("https://notevil.example"))
+
+	// Longer patterns win, built-in sources apply otherwise
+	assert.Equal(t, "newsletter", r.Source("https://news.example.com/issue/42"))
+	assert.Equal(t, "partners", r.Source("https://shop.example.com"))
+	assert.Equal(t, "google", r.Source("https://www.google.com/search"))
+	assert.Equal(t, "direct", r.Source(""))
+
+	// Without rules only the built-in ones apply
+	var none *Rules
+	assert.False(t, none.IsBot("HeadlessChrome"))
+	assert.False(t, none.Reserved("ADMIN"))
+	assert.Equal(t, "example", none.Source("https://news.example.com"))
+}
+
+func TestRules_CRUD(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRules(t, repository.NewMemoryRepository(), miniredis.RunT(t))
+
+	rule, err := r.Create(ctx, &model.RuleRequest{Kind: model.RuleKindBotUA, Pattern: " Curl "})
+	require.NoError(t, err)
+	assert.Equal(t, "curl", rule.Pattern)
+	_, err = r.Create(ctx, &model.RuleRequest{Kind: model.RuleKindBotUA, Pattern: "curl"})
+	assert.ErrorIs(t, err, repository.ErrConflict)
+	_, err = r.Create(ctx, &model.RuleRequest{Kind: model.RuleKindReservedWord, Pattern: "docs"})
+	require.NoError(t, err)
+
+	updated, err := r.Update(ctx, rule.ID, &model.RuleRequest{Kind: model.RuleKindBotUA, Pattern: "wget"})
+	require.NoError(t, err)
+	assert.Equal(t, "wget", updated.Pattern)
+	assert.False(t, updated.CreatedAt.IsZero())
+	assert.False(t, r.IsBot("curl/8.4.0"))
+	assert.True(t, r.IsBot("Wget/1.21"))
+	_, err = r.Update(ctx, 42, &model.RuleRequest{Kind: model.RuleKindBotUA, Pattern: "curl"})
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	rules, err := r.List(ctx, model.RuleKindBotUA)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.Equal(t, "wget", rules[0].Pattern)
+	rules, err = r.List(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, rules, 2)
+
+	deleted, err := r.Delete(ctx, rule.ID)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	assert.False(t, r.IsBot("Wget/1.21"))
+	deleted, err = r.Delete(ctx, rule.ID)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+}
+
+func TestRules_InvalidRequests(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRules(t, repository.NewMemoryRepository(), miniredis.RunT(t))
+
+	for _, req := range []model.RuleRequest{
+		{Kind: model.RuleKindBotUA, Pattern: "  "},
+		{Kind: model.RuleKindSource, Pattern: "example.com"},
+		{Kind: model.RuleKindBotUA, Pattern: "curl", Source: "cli"},
+		{Kind: model.RuleKindURLBlocklist, Pattern: "https://evil.example/login"},
+	} {
+		_, err := r.Create(ctx, &req)
+		assert.ErrorIs(t, err, ErrInvalidRule, req.Pattern)
+	}
+}
+
+func TestRules_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Two instances sharing MySQL and Redis
+	store, s := repository.NewMemoryRepository(), miniredis.RunT(t)
+	admin := newTestRules(t, store, s)
+	other := newTestRules(t, store, s)
+
+	done := make(chan struct{})
+	go func() {
+		other.Run(ctx, time.Hour)
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		return len(s.PubSubChannels("octopus:rules")) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	_, err := admin.Create(ctx, &model.RuleRequest{Kind: model.RuleKindURLBlocklist, Pattern: "evil.example"})
+	require.NoError(t, err)
+
+	// The announcement reloads the rules long before the periodic reload
+	assert.Eventually(t, func() bool {
+		return other.Blocked("https://evil.example")
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"octopus/internal/config"
+	"octopus/internal/encoder"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CodeSequence numbers new short codes from a Redis counter shared by every instance instead of
+// hashing their URL, so each code is given out once and longer codes only once the shorter ones
+// ran out. A Permutation keyed by a secret scatters the numbers over the codes of their length, so
+// that a code does not tell which codes come next.
+type CodeSequence struct {
+	client redis.Cmdable
+	key    string
+	perm   encoder.Permutation
+}
+
+// NewCodeSequence creates a CodeSequence obfuscated as configured
+func NewCodeSequence(client redis.Cmdable, cfg *config.SequenceConfig) *CodeSequence {
+	var perm encoder.Permutation = encoder.Identity{}
+	if cfg.Obfuscation == config.ObfuscationFeistel {
+		perm = encoder.NewFeistel(cfg.Secret)
+	}
+	return &CodeSequence{client: client, key: cfg.Key, perm: perm}
+}
+
+// Next returns the next code of at least minLength characters spelled by enc. Numbers past the
+// codes of the longest length report ErrMaxCapacityReached.
+func (q *CodeSequence) Next(ctx context.Context, enc *encoder.Base32Encoder, minLength int) (string, error) {
+	n, err := q.client.Incr(ctx, q.key).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to number short code: %w", err)
+	}
+
+	index := uint64(n - 1)
+	for length := minLength; length <= encoder.MaxLength; length++ {
+		capacity := enc.MaxCapacity(length)
+		if index < capacity {
+			return enc.Encode(q.perm.Permute(index, length), length), nil
+		}
+		index -= capacity
+	}
+	return "", ErrMaxCapacityReached
+}
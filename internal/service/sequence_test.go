@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"octopus/internal/config"
+	"octopus/internal/encoder"
+	"octopus/internal/mocks"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodeSequence_Next(t *testing.T) {
+	ctx := context.Background()
+	enc := encoder.NewBase32Encoder()
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+
+	t.Run("in order", func(t *testing.T) {
+		seq := NewCodeSequence(client, &config.SequenceConfig{Key: "seq:plain", Obfuscation: config.ObfuscationNone})
+		for _, want := range []string{"AAAA", "AAAB", "AAAC"} {
+			code, err := seq.Next(ctx, enc, 4)
+			require.NoError(t, err)
+			assert.Equal(t, want, code)
+		}
+
+		// Longer codes follow once the codes of a length ran out
+		s.Set("seq:plain", strconv.FormatUint(enc.MaxCapacity(4), 10))
+		code, err := seq.Next(ctx, enc, 4)
+		require.NoError(t, err)
+		assert.Equal(t, "AAAAA", code)
+
+		s.Set("seq:plain", strconv.FormatUint(enc.MaxCapacity(4)+enc.MaxCapacity(5)+enc.MaxCapacity(6), 10))
+		_, err = seq.Next(ctx, enc, 4)
+		assert.ErrorIs(t, err, ErrMaxCapacityReached)
+	})
+
+	t.Run("obfuscated", func(t *testing.T) {
+		cfg := &config.SequenceConfig{Key: "seq:feistel", Obfuscation: config.ObfuscationFeistel, Secret: "0123456789abcdef0123456789abcdef"}
+		seq := NewCodeSequence(client, cfg)
+		feistel := encoder.NewFeistel(cfg.Secret)
+
+		for n := uint64(0); n < 3; n++ {
+			code, err := seq.Next(ctx, enc, 5)
+			require.NoError(t, err)
+			assert.Len(t, code, 5)
+			permuted, err := enc.Decode(code)
+			require.NoError(t, err)
+			assert.Equal(t, n, feistel.Invert(permuted, 5), "the secret reveals the number of a code")
+		}
+	})
+}
+
+func TestShortLinkService_generateWithCollision_Sequence(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+	svc := NewShortLinkService(mockMySQL, mocks.NewMockCache(ctrl), mockBloom, "https://s.example.com")
+	svc.SetSequence(NewCodeSequence(client, &config.SequenceConfig{Key: "seq", Obfuscation: config.ObfuscationNone}))
+
+	// AAAA was taken by an alias, AAAB is free
+	mockBloom.EXPECT().Exists(gomock.Any(), "AAAA").Return(true, nil)
+	mockBloom.EXPECT().Exists(gomock.Any(), "AAAB").Return(false, nil)
+	mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), "AAAB").Return(false, nil)
+
+	code, err := svc.generateWithCollision(context.Background(), "https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "AAAB", code)
+}
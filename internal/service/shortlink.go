@@ -1,7 +1,10 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,7 +14,11 @@ import (
 
 	"octopus/internal/encoder"
 	"octopus/internal/model"
+	"octopus/internal/mq"
 	"octopus/internal/repository"
+	"octopus/internal/storage"
+	"octopus/pkg/clock"
+	"octopus/pkg/util"
 
 	"github.com/rs/zerolog/log"
 )
@@ -26,123 +33,327 @@ func hashString(s string) uint64 {
 var (
 	// ErrInvalidURL is returned when the URL is invalid
 	ErrInvalidURL = errors.New("invalid URL")
+	// ErrInvalidExpireAt is returned when the expiry time is not an RFC 3339 time
+	ErrInvalidExpireAt = errors.New("invalid expire_at")
 	// ErrShortLinkNotFound is returned when the short link is not found
 	ErrShortLinkNotFound = errors.New("short link not found")
 	// ErrShortLinkExpired is returned when the short link has expired
 	ErrShortLinkExpired = errors.New("short link has expired")
+	// ErrShortLinkUsed is returned when a single-use short link was redirected already
+	ErrShortLinkUsed = errors.New("short link was used")
 	// ErrMaxCapacityReached is returned when maximum capacity is reached
 	ErrMaxCapacityReached = errors.New("maximum capacity reached")
+	// ErrBlockedURL is returned when a destination is on the URL blocklist or its domain's reputation
+	// blocks new links
+	ErrBlockedURL = errors.New("URL is blocklisted")
 )
 
 // ShortLinkService handles short link operations
 type ShortLinkService struct {
-	encoder   *encoder.Base32Encoder
-	mysqlRepo MySQLRepositoryInterface
-	redisRepo RedisRepositoryInterface
-	bloomSvc  BloomServiceInterface
-	domain    string
+	encoder    *encoder.Base32Encoder
+	mysqlRepo  storage.LinkStore
+	redisRepo  storage.LinkCache
+	bloomSvc   BloomServiceInterface
+	smsPool    SMSPoolServiceInterface
+	recycler   RecyclerServiceInterface
+	sequence   *CodeSequence
+	flags      *FeatureFlags
+	rules      *Rules
+	claims     *ClaimService
+	reputation *Reputation
+	signer     *ParamSigner
+	domain     string
+	minLength  int
+	readOnly   bool
+	timezone   *time.Location
+	campaign   string
+	linkEvents
 }
 
 // NewShortLinkService creates a new ShortLink Service
 func NewShortLinkService(
-	mysqlRepo MySQLRepositoryInterface,
-	redisRepo RedisRepositoryInterface,
+	mysqlRepo storage.LinkStore,
+	redisRepo storage.LinkCache,
 	bloomSvc BloomServiceInterface,
 	domain string,
 ) *ShortLinkService {
 	return &ShortLinkService{
-		encoder:   encoder.NewBase32Encoder(),
-		mysqlRepo: mysqlRepo,
-		redisRepo: redisRepo,
-		bloomSvc:  bloomSvc,
-		domain:    domain,
+		encoder:    encoder.NewBase32Encoder(),
+		mysqlRepo:  mysqlRepo,
+		redisRepo:  redisRepo,
+		bloomSvc:   bloomSvc,
+		domain:     domain,
+		minLength:  encoder.MinLength,
+		timezone:   time.UTC,
+		campaign:   "campaign",
+		linkEvents: linkEvents{clock: clock.Real},
 	}
 }
 
+// SetEncoder replaces the default Base32 encoder, e.g. with one using a custom alphabet
+func (s *ShortLinkService) SetEncoder(enc *encoder.Base32Encoder) {
+	s.encoder = enc
+}
+
+// SetSMSPool enables SMS links, reserving the pool's code length for SMS codes only
+func (s *ShortLinkService) SetSMSPool(pool SMSPoolServiceInterface) {
+	s.smsPool = pool
+	if pool != nil && pool.CodeLength() >= s.minLength {
+		s.minLength = pool.CodeLength() + 1
+	}
+}
+
+// SetRecycler makes the generator prefer recycled codes over hashing new ones
+func (s *ShortLinkService) SetRecycler(recycler RecyclerServiceInterface) {
+	s.recycler = recycler
+}
+
+// SetSequence numbers new codes from a sequence instead of hashing their URL
+func (s *ShortLinkService) SetSequence(sequence *CodeSequence) {
+	s.sequence = sequence
+}
+
+// SetFlags rolls recycled codes out to the share of generated links their flag allows
+func (s *ShortLinkService) SetFlags(flags *FeatureFlags) {
+	s.flags = flags
+}
+
+// SetRules refuses destinations on the URL blocklist and keeps reserved words from being handed
+// out as short codes
+func (s *ShortLinkService) SetRules(rules *Rules) {
+	s.rules = rules
+}
+
+// SetClaims hands the links created with an API key over to it
+func (s *ShortLinkService) SetClaims(claims *ClaimService) {
+	s.claims = claims
+}
+
+// SetReputation refuses destinations on domains whose reputation blocks new links, and counts the
+// links created to each domain
+func (s *ShortLinkService) SetReputation(reputation *Reputation) {
+	s.reputation = reputation
+}
+
+// SetParamSigner enables links whose appended params must be signed
+func (s *ShortLinkService) SetParamSigner(signer *ParamSigner) {
+	s.signer = signer
+}
+
+// SetReadOnly rejects changes to links, as on replicas receiving them from the primary region
+func (s *ShortLinkService) SetReadOnly(readOnly bool) {
+	s.readOnly = readOnly
+}
+
+// SetTimezone sets the timezone of the schedules of links without their own, UTC by default
+func (s *ShortLinkService) SetTimezone(loc *time.Location) {
+	s.timezone = loc
+}
+
+// SetCampaignParam sets the param whose value names the campaign of a link in bulk changes,
+// "campaign" by default
+func (s *ShortLinkService) SetCampaignParam(param string) {
+	s.campaign = param
+}
+
 // Generate generates a short link for the given URL
 func (s *ShortLinkService) Generate(ctx context.Context, req *model.GenerateRequest) (*model.GenerateResponse, error) {
+	if s.readOnly {
+		return nil, ErrReadOnlyReplica
+	}
+
 	// Validate URL
 	if req.URL == "" {
 		return nil, ErrInvalidURL
 	}
+	if s.blocked(req.URL, req.Schedule) {
+		return nil, ErrBlockedURL
+	}
 
-	// Parse expire time if provided
-	var expireAt *time.Time
-	if req.ExpireAt != "" {
-		t, err := time.Parse(time.RFC3339, req.ExpireAt)
-		if err != nil {
-			return nil, fmt.Errorf("invalid expire_at format: %w", err)
+	// Relative expiries count from the creation time, on the clock of the service
+	now := s.clock.Now()
+	expireAt, err := expiry(req, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// SMS links come from the reserved pool and always expire so codes can be recycled
+	pool := ""
+	if req.SMS {
+		if s.smsPool == nil {
+			return nil, ErrSMSPoolDisabled
+		}
+		pool = model.PoolSMS
+		if expireAt == nil {
+			t := now.Add(s.smsPool.DefaultTTL())
+			expireAt = &t
 		}
-		expireAt = &t
 	}
 
-	// Build cache key for URL + params
-	cacheKey := s.buildCacheKey(req.URL, req.Params)
+	if req.SignedParams && s.signer == nil {
+		return nil, ErrParamSigningDisabled
+	}
 
-	// Check cache first
-	if cachedCode, err := s.redisRepo.GetShortLink(ctx, cacheKey); err == nil && cachedCode != "" {
-		// Found in cache, return existing short link
-		if sl, err := s.mysqlRepo.GetShortLinkByCode(ctx, cachedCode); err == nil {
-			return s.buildResponse(sl), nil
-		}
+	// Identical URL and params map to one code, whatever order the params came in
+	paramsJSON, err := canonicalParams(req.Params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+	hash := dedupHash(req.URL, paramsJSON)
+
+	// Build cache key for URL + params, untracked, signed and restricted links being shared among
+	// alike requests only
+	cacheKey := s.buildCacheKey(req.URL, paramsJSON)
+	if pool != "" {
+		cacheKey = pool + ":" + cacheKey
+	}
+	noTracking := !req.Tracked()
+	if noTracking {
+		cacheKey = "untracked:" + cacheKey
+	}
+	if req.SignedParams {
+		cacheKey = "signed:" + cacheKey
+	}
+	referrers := model.JoinReferrers(req.AllowedReferrers)
+	if referrers != "" {
+		cacheKey = "referrers=" + referrers + ":" + cacheKey
+	}
+	geoAllow, geoDeny := model.JoinCountries(req.AllowedCountries), model.JoinCountries(req.BlockedCountries)
+	if geoAllow != "" || geoDeny != "" {
+		cacheKey = "geo=" + geoAllow + "!" + geoDeny + ":" + cacheKey
+	}
+	schedule := encodeSchedule(req.Schedule)
+	if schedule != nil {
+		sum := sha256.Sum256(schedule)
+		cacheKey = "schedule=" + hex.EncodeToString(sum[:8]) + ":" + cacheKey
+	}
+	// Owned links are only shared with their owner
+	owner := s.claims.Owner(ctx)
+	if owner != "" {
+		cacheKey = "owner=" + owner[:16] + ":" + cacheKey
 	}
+	// shared reports whether an existing link redirects like the requested one
+	shared := func(sl *model.ShortLink) bool {
+		return sl.Pool == pool && sl.MaxClicks == 0 && sl.NoTracking == noTracking && sl.SignedParams == req.SignedParams &&
+			sl.Referrers == referrers && sl.GeoAllow == geoAllow && sl.GeoDeny == geoDeny && sl.Owner == owner &&
+			bytes.Equal(encodeSchedule(sl.DecodedSchedule()), schedule)
+	}
+
+	// Single-use links are links limited to one click, claimed by the atomic click count
+	maxClicks := req.MaxClicks
+	if req.SingleUse {
+		maxClicks = 1
+	}
+
+	// Links with a click limit are never shared, every request gets its own clicks
+	if maxClicks == 0 {
+		// Check cache first
+		if cachedCode, err := s.redisRepo.GetShortLink(ctx, cacheKey); err == nil && cachedCode != "" {
+			// Found in cache, return existing short link unless the code was recycled since
+			if sl, err := s.mysqlRepo.GetShortLinkByCode(ctx, cachedCode); err == nil && sl.DedupHash == hash && shared(sl) {
+				return s.buildResponse(sl), nil
+			}
+		}
 
-	// Check if URL already exists
-	if existing, err := s.mysqlRepo.GetShortLinkByURL(ctx, req.URL); err == nil {
-		// Cache it
-		s.redisRepo.SaveShortLink(ctx, cacheKey, existing.ShortCode, repository.ShortLinkCacheTTL)
-		return s.buildResponse(existing), nil
+		// Check if URL already exists with the same params
+		if existing, err := s.mysqlRepo.GetShortLinkByDedupHash(ctx, hash); err == nil && shared(existing) {
+			// Cache it
+			if ttl := cacheTTL(existing.ExpireAt, now); ttl > 0 {
+				s.redisRepo.SaveShortLink(ctx, cacheKey, existing.ShortCode, ttl)
+			}
+			return s.buildResponse(existing), nil
+		}
 	}
 
 	// Generate new short code with collision handling
-	shortCode, err := s.generateWithCollision(ctx, req.URL)
+	var shortCode string
+	if pool != "" {
+		shortCode, err = s.smsPool.Allocate(ctx, req.URL)
+	} else {
+		shortCode, err = s.generateWithCollision(ctx, req.URL)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	// Prepare params JSON
-	var paramsJSON []byte
-	if req.Params != nil {
-		paramsJSON, _ = json.Marshal(req.Params)
+	// Index the normalized destination for reverse lookups
+	urlHash, err := util.URLHash(req.URL)
+	if err != nil {
+		log.Warn().Err(err).Str("url", req.URL).Msg("Failed to hash URL for lookup")
 	}
 
 	// Create short link entity
-	now := time.Now()
 	sl := &model.ShortLink{
-		ShortCode:   shortCode,
-		OriginalURL: req.URL,
-		Params:      paramsJSON,
-		CreatedAt:   now,
-		ExpireAt:    expireAt,
-		Status:      1,
+		ShortCode:     shortCode,
+		OriginalURL:   req.URL,
+		URLHash:       urlHash,
+		DedupHash:     hash,
+		Params:        paramsJSON,
+		CreatedAt:     now,
+		ExpireAt:      expireAt,
+		Status:        1,
+		Pool:          pool,
+		NoClickID:     req.NoClickID,
+		MaxClicks:     maxClicks,
+		PreserveQuery: req.PreserveQuery,
+		Title:         req.Title,
+		Description:   req.Description,
+		Notes:         req.Notes,
+		PublicStats:   req.PublicStats,
+		NoTracking:    noTracking,
+		CacheControl:  req.CacheControl,
+		SignedParams:  req.SignedParams,
+		SingleUse:     req.SingleUse,
+		Referrers:     referrers,
+		GeoAllow:      geoAllow,
+		GeoDeny:       geoDeny,
+		Schedule:      schedule,
+		Owner:         owner,
 	}
 
 	// Save to MySQL
 	if err := s.mysqlRepo.SaveShortLink(ctx, sl); err != nil {
 		log.Error().Err(err).Str("short_code", shortCode).Msg("Failed to save short link to MySQL")
+		if pool != "" {
+			if err := s.smsPool.Release(ctx, shortCode); err != nil {
+				log.Warn().Err(err).Str("short_code", shortCode).Msg("Failed to release SMS code")
+			}
+		}
 		return nil, fmt.Errorf("failed to save short link: %w", err)
 	}
-
-	// Save to Redis cache
-	s.redisRepo.SaveShortLink(ctx, cacheKey, shortCode, repository.ShortLinkCacheTTL)
-	s.redisRepo.SaveShortLink(ctx, shortCode, req.URL, repository.ShortLinkCacheTTL)
+	s.reputation.Track(ctx, req.URL)
+
+	// Save to Redis cache unless already expired, lookup key and code in one round trip
+	if ttl := cacheTTL(expireAt, now); ttl > 0 {
+		if maxClicks > 0 {
+			// The click limit must be in place before the first redirect can be served from the cache
+			s.setClickLimit(ctx, sl)
+			s.redisRepo.CacheShortLink(ctx, sl, ttl)
+		} else if err := s.redisRepo.SaveShortLinkPair(ctx, cacheKey, sl, ttl); err != nil {
+			log.Warn().Err(err).Str("short_code", shortCode).Msg("Failed to cache short link")
+		}
+	}
 
 	// Add to Bloom Filter
-	if err := s.bloomSvc.Add(ctx, shortCode); err != nil {
+	if pool != "" {
+		if err := s.smsPool.Confirm(ctx, shortCode); err != nil {
+			log.Warn().Err(err).Str("short_code", shortCode).Msg("Failed to add to SMS Bloom Filter")
+		}
+	} else if err := s.bloomSvc.Add(ctx, shortCode); err != nil {
 		log.Warn().Err(err).Str("short_code", shortCode).Msg("Failed to add to Bloom Filter")
 	}
 
+	s.publishLinkEvent(ctx, mq.EventTypeLinkCreated, sl)
+
 	return s.buildResponse(sl), nil
 }
 
 // Get retrieves the original URL for a short code
 func (s *ShortLinkService) Get(ctx context.Context, shortCode string) (*model.ShortLink, error) {
-	// Try cache first
-	if url, err := s.redisRepo.GetShortLink(ctx, shortCode); err == nil && url != "" {
-		// Reconstruct short link
-		sl := &model.ShortLink{
-			ShortCode:   shortCode,
-			OriginalURL: url,
+	// Try cache first, cached links carry their status and expiry like stored ones
+	if sl, err := s.redisRepo.GetCachedShortLink(ctx, shortCode); err == nil {
+		if !sl.IsActiveAt(s.clock.Now()) {
+			return nil, inactiveError(sl)
 		}
 		return sl, nil
 	}
@@ -150,62 +361,418 @@ func (s *ShortLinkService) Get(ctx context.Context, shortCode string) (*model.Sh
 	// Try MySQL
 	sl, err := s.mysqlRepo.GetShortLinkByCode(ctx, shortCode)
 	if err != nil {
-		return nil, ErrShortLinkNotFound
+		return nil, linkError(err)
 	}
 
 	// Check if expired
-	if !sl.IsActive() {
-		return nil, ErrShortLinkExpired
+	if !sl.IsActiveAt(s.clock.Now()) {
+		return nil, inactiveError(sl)
 	}
 
-	// Cache it
-	s.redisRepo.SaveShortLink(ctx, shortCode, sl.OriginalURL, repository.ShortLinkCacheTTL)
+	// Cache it, restoring a click limit Redis may have lost
+	if sl.MaxClicks > 0 {
+		s.setClickLimit(ctx, sl)
+	}
+	if ttl := cacheTTL(sl.ExpireAt, s.clock.Now()); ttl > 0 {
+		s.redisRepo.CacheShortLink(ctx, sl, ttl)
+	}
 
 	return sl, nil
 }
 
-// ExpandURL expands a short URL with query parameters
-func (s *ShortLinkService) ExpandURL(ctx context.Context, shortCode string, queryParams map[string]string) (string, error) {
-	sl, err := s.Get(ctx, shortCode)
+// ConsumeClick counts a redirect against the click limit of a short link. It reports whether the
+// redirect may be served and whether it was the last one, after which the link must be deactivated.
+func (s *ShortLinkService) ConsumeClick(ctx context.Context, shortCode string) (bool, bool, error) {
+	return s.redisRepo.ConsumeClick(ctx, shortCode)
+}
+
+// Deactivate disables a short link that used up its clicks and drops it from the cache
+func (s *ShortLinkService) Deactivate(ctx context.Context, shortCode string) error {
+	if err := s.mysqlRepo.DeactivateShortLink(ctx, shortCode); err != nil {
+		return fmt.Errorf("failed to deactivate short link: %w", err)
+	}
+	if err := s.redisRepo.DeleteShortLink(ctx, shortCode); err != nil {
+		log.Warn().Err(err).Str("short_code", shortCode).Msg("Failed to drop deactivated short link from cache")
+	}
+
+	if sl, err := s.mysqlRepo.GetShortLinkByCode(ctx, shortCode); err == nil {
+		s.publishLinkEvent(ctx, mq.EventTypeLinkExpired, sl)
+	}
+
+	log.Info().Str("short_code", shortCode).Msg("Short link reached its click limit")
+
+	return nil
+}
+
+// setClickLimit stores the click limit of a short link in Redis, expiring it with the link
+func (s *ShortLinkService) setClickLimit(ctx context.Context, sl *model.ShortLink) {
+	var ttl time.Duration
+	if sl.ExpireAt != nil {
+		ttl = sl.ExpireAt.Sub(s.clock.Now())
+	}
+	if err := s.redisRepo.SetClickLimit(ctx, sl.ShortCode, sl.MaxClicks, ttl); err != nil {
+		log.Warn().Err(err).Str("short_code", sl.ShortCode).Msg("Failed to save click limit")
+	}
+}
+
+// Resolve returns the destination and metadata of a short link, including expired ones
+func (s *ShortLinkService) Resolve(ctx context.Context, shortCode string) (*model.ResolveResponse, error) {
+	sl, err := s.mysqlRepo.GetShortLinkByCode(ctx, shortCode)
+	if err != nil {
+		return nil, linkError(err)
+	}
+
+	return s.buildResolveResponse(sl), nil
+}
+
+// BatchGet returns the details of several short links in request order, reading them from the
+// cache with one MGET and the misses from MySQL with one query. Active links read from MySQL are
+// cached like Get does.
+func (s *ShortLinkService) BatchGet(ctx context.Context, shortCodes []string) (*model.BatchGetResponse, error) {
+	codes := make([]string, 0, len(shortCodes))
+	seen := make(map[string]bool, len(shortCodes))
+	for _, shortCode := range shortCodes {
+		if !seen[shortCode] {
+			seen[shortCode] = true
+			codes = append(codes, shortCode)
+		}
+	}
+
+	links, err := s.redisRepo.GetCachedShortLinks(ctx, codes)
+	if err != nil {
+		log.Warn().Err(err).Int("codes", len(codes)).Msg("Failed to read cached short links")
+		links = make(map[string]*model.ShortLink, len(codes))
+	}
+
+	misses := make([]string, 0, len(codes)-len(links))
+	for _, shortCode := range codes {
+		if links[shortCode] == nil {
+			misses = append(misses, shortCode)
+		}
+	}
+	if len(misses) > 0 {
+		stored, err := s.mysqlRepo.GetShortLinksByCodes(ctx, misses)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get short links: %w", err)
+		}
+		now := s.clock.Now()
+		for i := range stored {
+			sl := &stored[i]
+			links[sl.ShortCode] = sl
+			if !sl.IsActiveAt(now) {
+				continue
+			}
+			if sl.MaxClicks > 0 {
+				s.setClickLimit(ctx, sl)
+			}
+			if ttl := cacheTTL(sl.ExpireAt, now); ttl > 0 {
+				s.redisRepo.CacheShortLink(ctx, sl, ttl)
+			}
+		}
+	}
+
+	resp := &model.BatchGetResponse{
+		Links:   make([]model.ResolveResponse, 0, len(links)),
+		Missing: []string{},
+	}
+	for _, shortCode := range codes {
+		if sl := links[shortCode]; sl != nil {
+			resp.Links = append(resp.Links, *s.buildResolveResponse(sl))
+		} else {
+			resp.Missing = append(resp.Missing, shortCode)
+		}
+	}
+	return resp, nil
+}
+
+// Update changes the title, description, notes, public stats, tracking and Cache-Control settings of
+// a short link, leaving omitted fields as they are
+func (s *ShortLinkService) Update(ctx context.Context, shortCode string, req *model.UpdateRequest) (*model.ResolveResponse, error) {
+	if s.readOnly {
+		return nil, ErrReadOnlyReplica
+	}
+
+	sl, err := s.mysqlRepo.GetShortLinkByCode(ctx, shortCode)
+	if err != nil {
+		return nil, linkError(err)
+	}
+
+	if req.Title != nil {
+		sl.Title = *req.Title
+	}
+	if req.Description != nil {
+		sl.Description = *req.Description
+	}
+	if req.Notes != nil {
+		sl.Notes = *req.Notes
+	}
+	replicated := false
+	if req.PublicStats != nil {
+		replicated = *req.PublicStats != sl.PublicStats
+		sl.PublicStats = *req.PublicStats
+	}
+	if req.TrackingEnabled != nil {
+		replicated = replicated || *req.TrackingEnabled == sl.NoTracking
+		sl.NoTracking = !*req.TrackingEnabled
+	}
+	if req.CacheControl != nil {
+		replicated = replicated || *req.CacheControl != sl.CacheControl
+		sl.CacheControl = *req.CacheControl
+	}
+	if req.AllowedReferrers != nil {
+		referrers := model.JoinReferrers(*req.AllowedReferrers)
+		replicated = replicated || referrers != sl.Referrers
+		sl.Referrers = referrers
+	}
+	if req.AllowedCountries != nil {
+		geoAllow := model.JoinCountries(*req.AllowedCountries)
+		replicated = replicated || geoAllow != sl.GeoAllow
+		sl.GeoAllow = geoAllow
+		if geoAllow != "" {
+			replicated = replicated || sl.GeoDeny != ""
+			sl.GeoDeny = ""
+		}
+	}
+	if req.BlockedCountries != nil {
+		geoDeny := model.JoinCountries(*req.BlockedCountries)
+		replicated = replicated || geoDeny != sl.GeoDeny
+		sl.GeoDeny = geoDeny
+		if geoDeny != "" {
+			replicated = replicated || sl.GeoAllow != ""
+			sl.GeoAllow = ""
+		}
+	}
+	if req.Schedule != nil {
+		if s.blocked("", req.Schedule) {
+			return nil, ErrBlockedURL
+		}
+		schedule := encodeSchedule(req.Schedule)
+		replicated = replicated || !bytes.Equal(schedule, encodeSchedule(sl.DecodedSchedule()))
+		sl.Schedule = schedule
+	}
+
+	if err := s.mysqlRepo.UpdateShortLinkMetadata(ctx, sl); err != nil {
+		return nil, fmt.Errorf("failed to update short link: %w", err)
+	}
+	// The cached copy is rebuilt from MySQL on the next redirect
+	if err := s.redisRepo.DeleteShortLink(ctx, shortCode); err != nil {
+		log.Warn().Err(err).Str("short_code", shortCode).Msg("Failed to drop updated short link from cache")
+	}
+	// Replicas serve the public stats page and redirects too, unlike the descriptive metadata
+	if replicated {
+		s.publishLinkEvent(ctx, mq.EventTypeLinkUpdated, sl)
+	}
+
+	return s.buildResolveResponse(sl), nil
+}
+
+// Lookup returns all short links pointing at the normalized destination URL, across params variants
+func (s *ShortLinkService) Lookup(ctx context.Context, rawURL string) (*model.LookupResponse, error) {
+	normalized, err := util.NormalizeURL(rawURL)
 	if err != nil {
-		return "", err
+		return nil, ErrInvalidURL
 	}
+	urlHash, _ := util.URLHash(normalized)
 
-	targetURL := sl.OriginalURL
+	links, err := s.mysqlRepo.GetShortLinksByURLHash(ctx, urlHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up short links: %w", err)
+	}
+
+	resp := &model.LookupResponse{
+		URL:   normalized,
+		Links: make([]model.ResolveResponse, 0, len(links)),
+	}
+	for i := range links {
+		resp.Links = append(resp.Links, *s.buildResolveResponse(&links[i]))
+	}
+	return resp, nil
+}
+
+// Page sizes of the search API
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// Search returns one page of short links matching a full-text query, fetching one extra row to
+// detect a next page
+func (s *ShortLinkService) Search(ctx context.Context, q *model.SearchQuery) (*model.SearchResponse, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	query := *q
+	query.Limit = limit + 1
+	links, err := s.mysqlRepo.SearchShortLinks(ctx, &query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search short links: %w", err)
+	}
+
+	resp := &model.SearchResponse{
+		Query: q.Query,
+		Links: make([]model.ResolveResponse, 0, limit),
+	}
+	if len(links) > limit {
+		links = links[:limit]
+		resp.NextOffset = q.Offset + limit
+	}
+	for i := range links {
+		resp.Links = append(resp.Links, *s.buildResolveResponse(&links[i]))
+	}
+	return resp, nil
+}
+
+// ExpandURL expands the destination of a short link with its params and the query parameters of
+// the request, which replace params of the same key. The destination's own query and fragment are
+// kept as they are, except for keys set again, whose values replace them; repeated keys keep all
+// their values. Signed destinations and links preserving their query only get the parameters
+// appended, without parsing the URL at all.
+func (s *ShortLinkService) ExpandURL(sl *model.ShortLink, queryParams url.Values) string {
+	params := sl.QueryParams()
+	for key, values := range queryParams {
+		params[key] = values
+	}
+
+	targetURL := s.destination(sl)
+	if len(params) == 0 {
+		return targetURL
+	}
+
+	if sl.PreserveQuery || util.IsSignedURL(targetURL) {
+		return util.AppendQuery(targetURL, params)
+	}
 
 	// Parse existing URL
 	u, err := url.Parse(targetURL)
 	if err != nil {
-		return targetURL, nil // Return as-is if parse fails
+		return targetURL // Return as-is if parse fails
+	}
+
+	u.RawQuery = util.MergeQuery(u.RawQuery, params)
+
+	return u.String()
+}
+
+// destination returns where a redirect to the short link goes now: the URL its schedule routes to
+// at this time, or its original URL
+func (s *ShortLinkService) destination(sl *model.ShortLink) string {
+	if schedule := sl.DecodedSchedule(); schedule != nil {
+		if target := schedule.Destination(s.clock.Now(), s.timezone); target != "" {
+			return target
+		}
+	}
+	return sl.OriginalURL
+}
+
+// SignParams returns the short link with params appended and signed, for links created with
+// signed_params
+func (s *ShortLinkService) SignParams(ctx context.Context, shortCode string, params map[string]interface{}) (*model.SignParamsResponse, error) {
+	sl, err := s.mysqlRepo.GetShortLinkByCode(ctx, shortCode)
+	if err != nil {
+		return nil, linkError(err)
+	}
+	// In self-serve mode only the owner of a link may vouch for its params
+	if s.claims != nil {
+		owner := s.claims.Owner(ctx)
+		if owner == "" {
+			return nil, ErrClaimUnauthenticated
+		}
+		if sl.Owner != owner {
+			return nil, ErrNotOwner
+		}
+	}
+	if !sl.SignedParams {
+		return nil, ErrParamsNotSigned
+	}
+	if s.signer == nil {
+		return nil, ErrParamSigningDisabled
 	}
 
-	// Build query string
-	query := u.Query()
-	for key, value := range queryParams {
-		query.Set(key, value)
+	// The signature param cannot be signed, it is left out like values without a string form
+	query := make(url.Values, len(params)+1)
+	for key, value := range params {
+		if v, ok := model.ParamString(value); ok && key != s.signer.Param() {
+			query.Set(key, v)
+		}
 	}
-	u.RawQuery = query.Encode()
+	sig := s.signer.Sign(sl.ShortCode, query)
+	query.Set(s.signer.Param(), sig)
 
-	return u.String(), nil
+	return &model.SignParamsResponse{
+		ShortLink: s.buildResponse(sl).ShortLink + "?" + query.Encode(),
+		Sig:       sig,
+	}, nil
+}
+
+// VerifyParams checks the query of a request to a short link against its signature when the link
+// signs its params, returning the params to append to the destination
+func (s *ShortLinkService) VerifyParams(sl *model.ShortLink, query url.Values) (url.Values, error) {
+	if !sl.SignedParams || len(query) == 0 {
+		return query, nil
+	}
+	if s.signer == nil {
+		return nil, ErrTamperedParams
+	}
+	return s.signer.Verify(sl.ShortCode, query)
+}
+
+// inactiveError reports an inactive short link as used when its single use disabled it, as
+// expired otherwise
+func inactiveError(sl *model.ShortLink) error {
+	if sl.IsUsed() {
+		return ErrShortLinkUsed
+	}
+	return ErrShortLinkExpired
+}
+
+// linkError reports a failed short link lookup as ErrShortLinkNotFound only when the link does not
+// exist, so storage failures are not mistaken for missing links
+func linkError(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrShortLinkNotFound
+	}
+	return fmt.Errorf("failed to get short link: %w", err)
 }
 
 // generateWithCollision generates a short code with collision handling
 func (s *ShortLinkService) generateWithCollision(ctx context.Context, url string) (string, error) {
+	// Consult the recycled code pool first, skipping codes now reserved for the SMS pool
+	if s.recycler != nil && s.flags.Enabled(ctx, FlagRecycledCodes, url) {
+		if shortCode, ok := s.recycler.Acquire(ctx); ok && len(shortCode) >= s.minLength && !s.rules.Reserved(shortCode) {
+			return shortCode, nil
+		}
+	}
+
+	// Numbered codes skip those taken by aliases, imports, or hashes before the sequence was used
+	if s.sequence != nil {
+		for i := 0; i < 1000; i++ {
+			shortCode, err := s.sequence.Next(ctx, s.encoder, s.minLength)
+			if err != nil {
+				return "", err
+			}
+			if !s.rules.Reserved(shortCode) && !s.codeTaken(ctx, shortCode) {
+				return shortCode, nil
+			}
+		}
+		return "", ErrMaxCapacityReached
+	}
+
 	// Start with 4 characters
-	for length := encoder.MinLength; length <= encoder.MaxLength; length++ {
+	for length := s.minLength; length <= encoder.MaxLength; length++ {
 		hash := hashString(url)
 
 		for i := 0; i < 1000; i++ { // Retry up to 1000 times per length
 			shortCode := s.encoder.Encode(hash+uint64(i), length)
-
-			// Check Bloom Filter first (fast check)
-			exists, err := s.bloomSvc.Exists(ctx, shortCode)
-			if err != nil || !exists {
-				// Bloom Filter says not exists, check DB to be sure
-				actualExists, _ := s.mysqlRepo.CheckExistsByCode(ctx, shortCode)
-				if !actualExists {
-					return shortCode, nil
-				}
+			if s.rules.Reserved(shortCode) {
+				continue
+			}
+			if !s.codeTaken(ctx, shortCode) {
+				return shortCode, nil
 			}
 
 			// Collision detected, increment hash
@@ -217,22 +784,183 @@ func (s *ShortLinkService) generateWithCollision(ctx context.Context, url string
 	return "", ErrMaxCapacityReached
 }
 
-// buildCacheKey builds a cache key for URL and params
-func (s *ShortLinkService) buildCacheKey(url string, params map[string]interface{}) string {
+// codeTaken reports whether a generated code is in use
+func (s *ShortLinkService) codeTaken(ctx context.Context, shortCode string) bool {
+	// Check Bloom Filter first (fast check)
+	exists, err := s.bloomSvc.Exists(ctx, shortCode)
+	if err != nil || !exists {
+		// Bloom Filter says not exists, check DB to be sure
+		actualExists, _ := s.mysqlRepo.CheckExistsByCode(ctx, shortCode)
+		return actualExists
+	}
+	return true
+}
+
+// blocked reports whether a destination or one of the destinations of a schedule is on the URL
+// blocklist or on a domain whose reputation blocks new links
+func (s *ShortLinkService) blocked(url string, schedule *model.Schedule) bool {
+	if url != "" && (s.rules.Blocked(url) || s.reputation.Blocked(url)) {
+		return true
+	}
+	if schedule != nil {
+		for _, rule := range schedule.Rules {
+			if s.rules.Blocked(rule.URL) || s.reputation.Blocked(rule.URL) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cacheTTL returns how long a short link may be cached at now: the cache TTL, cut short by its
+// expiry so an expired link never redirects from the cache. It is not positive for expired links.
+func cacheTTL(expireAt *time.Time, now time.Time) time.Duration {
+	ttl := repository.ShortLinkCacheTTL
+	if expireAt != nil {
+		if untilExpiry := expireAt.Sub(now); untilExpiry < ttl {
+			return untilExpiry
+		}
+	}
+	return ttl
+}
+
+// buildCacheKey builds a cache key for URL and canonical params
+func (s *ShortLinkService) buildCacheKey(url string, params []byte) string {
 	if len(params) == 0 {
 		return url
 	}
-	return fmt.Sprintf("%s:%v", url, params)
+	sum := sha256.Sum256(params)
+	return url + ":" + hex.EncodeToString(sum[:])
+}
+
+// encodeSchedule encodes a schedule as stored with a short link, nil when it has no rules
+func encodeSchedule(schedule *model.Schedule) json.RawMessage {
+	if schedule == nil || len(schedule.Rules) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// canonicalParams encodes params as JSON with sorted keys, so equal params always encode alike.
+// Empty params encode to nil.
+func canonicalParams(params map[string]interface{}) ([]byte, error) {
+	if len(params) == 0 {
+		return nil, nil
+	}
+	// encoding/json writes map keys in sorted order, nested maps included
+	return json.Marshal(params)
+}
+
+// dedupHash identifies a destination by its URL and canonical params. Without params it is the
+// SHA-256 of the URL alone, which lets existing rows be backfilled in SQL.
+func dedupHash(url string, params []byte) string {
+	h := sha256.New()
+	h.Write([]byte(url))
+	if len(params) > 0 {
+		h.Write([]byte{'\n'})
+		h.Write(params)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// expiry returns when a new link expires, nil if never, from the absolute expire_at of the request
+// or its relative ttl or expire_in_seconds, which are exclusive
+func expiry(req *model.GenerateRequest, now time.Time) (*time.Time, error) {
+	set := 0
+	for _, isSet := range []bool{req.ExpireAt != "", req.TTL != "", req.ExpireInSeconds != 0} {
+		if isSet {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, fmt.Errorf("%w: expire_at, ttl and expire_in_seconds are exclusive", ErrInvalidExpireAt)
+	}
+
+	var expireAt time.Time
+	switch {
+	case req.ExpireAt != "":
+		t, err := time.Parse(time.RFC3339, req.ExpireAt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidExpireAt, err)
+		}
+		expireAt = t
+	case req.TTL != "":
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: ttl: %w", ErrInvalidExpireAt, err)
+		}
+		if ttl <= 0 {
+			return nil, fmt.Errorf("%w: ttl must be positive", ErrInvalidExpireAt)
+		}
+		expireAt = now.Add(ttl)
+	case req.ExpireInSeconds != 0:
+		if req.ExpireInSeconds < 0 {
+			return nil, fmt.Errorf("%w: expire_in_seconds must be positive", ErrInvalidExpireAt)
+		}
+		expireAt = now.Add(time.Duration(req.ExpireInSeconds) * time.Second)
+	default:
+		return nil, nil
+	}
+	return &expireAt, nil
+}
+
+// buildResolveResponse builds the inspection view of a short link
+func (s *ShortLinkService) buildResolveResponse(sl *model.ShortLink) *model.ResolveResponse {
+	status := model.LinkStatusActive
+	switch {
+	case sl.IsUsed():
+		status = model.LinkStatusUsed
+	case sl.Status != 1:
+		status = model.LinkStatusDisabled
+	case !sl.IsActiveAt(s.clock.Now()):
+		status = model.LinkStatusExpired
+	}
+
+	return &model.ResolveResponse{
+		ShortLink:        s.buildResponse(sl).ShortLink,
+		ShortCode:        sl.ShortCode,
+		OriginalURL:      sl.OriginalURL,
+		Status:           status,
+		Params:           sl.DecodedParams(),
+		Pool:             sl.Pool,
+		CreatedAt:        sl.CreatedAt,
+		ExpireAt:         sl.ExpireAt,
+		MaxClicks:        sl.MaxClicks,
+		Title:            sl.Title,
+		Description:      sl.Description,
+		Notes:            sl.Notes,
+		PublicStats:      sl.PublicStats,
+		TrackingEnabled:  !sl.NoTracking,
+		CacheControl:     sl.CacheControl,
+		SignedParams:     sl.SignedParams,
+		SingleUse:        sl.SingleUse,
+		AllowedReferrers: sl.AllowedReferrers(),
+		AllowedCountries: sl.AllowedCountries(),
+		BlockedCountries: sl.BlockedCountries(),
+		Schedule:         sl.DecodedSchedule(),
+	}
 }
 
 // buildResponse builds a generate response from a short link entity
 func (s *ShortLinkService) buildResponse(sl *model.ShortLink) *model.GenerateResponse {
-	shortLink := fmt.Sprintf("%s/%s", s.domain, sl.ShortCode)
+	domain := s.domain
+	if sl.Pool == model.PoolSMS && s.smsPool != nil {
+		domain = s.smsPool.Domain()
+	}
+	shortLink := fmt.Sprintf("%s/%s", domain, sl.ShortCode)
 
 	resp := &model.GenerateResponse{
-		ShortLink:   shortLink,
-		ShortCode:   sl.ShortCode,
-		OriginalURL: sl.OriginalURL,
+		ShortLink:       shortLink,
+		ShortCode:       sl.ShortCode,
+		OriginalURL:     sl.OriginalURL,
+		Params:          sl.DecodedParams(),
+		TrackingEnabled: !sl.NoTracking,
+		SignedParams:    sl.SignedParams,
+		SingleUse:       sl.SingleUse,
 	}
 
 	if sl.ExpireAt != nil {
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"testing"
+
+	"octopus/internal/model"
+	"octopus/internal/storage"
+)
+
+// occupancy marks a deterministic share of the shortest codes as taken,
+// emulating a code space filled to the given ratio
+type occupancy struct {
+	fill      float64
+	minLength int
+}
+
+func (o occupancy) taken(shortCode string) bool {
+	if len(shortCode) > o.minLength {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(shortCode))
+	return float64(h.Sum32()%10000) < o.fill*10000
+}
+
+// benchBloom answers membership from the occupancy without false positives
+type benchBloom struct {
+	BloomServiceInterface
+	occupancy
+}
+
+func (b benchBloom) Exists(ctx context.Context, shortCode string) (bool, error) {
+	return b.taken(shortCode), nil
+}
+
+// benchMySQL answers existence checks from the occupancy
+type benchMySQL struct {
+	storage.LinkStore
+	occupancy
+}
+
+func (m benchMySQL) CheckExistsByCode(ctx context.Context, shortCode string) (bool, error) {
+	return m.taken(shortCode), nil
+}
+
+// benchSink keeps benchmark results alive so the compiler cannot drop the calls
+var benchSink interface{}
+
+func BenchmarkShortLinkService_generateWithCollision(b *testing.B) {
+	ctx := context.Background()
+	urls := make([]string, 1024)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("https://example.com/%d", i)
+	}
+
+	for _, fill := range []float64{0, 0.5, 0.9, 0.99} {
+		b.Run(fmt.Sprintf("fill=%.2f", fill), func(b *testing.B) {
+			occ := occupancy{fill: fill, minLength: 4}
+			svc := NewShortLinkService(benchMySQL{occupancy: occ}, nil, benchBloom{occupancy: occ}, "http://localhost")
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				code, err := svc.generateWithCollision(ctx, urls[i%len(urls)])
+				if err != nil {
+					b.Fatal(err)
+				}
+				benchSink = code
+			}
+		})
+	}
+}
+
+func BenchmarkShortLinkService_ExpandURL(b *testing.B) {
+	cases := []struct {
+		name   string
+		url    string
+		params url.Values
+	}{
+		{"no params", "https://example.com/landing", nil},
+		{"merge params", "https://example.com/landing?utm_source=sms", url.Values{"utm_campaign": {"spring"}, "ref": {"abc"}}},
+	}
+
+	for _, tc := range cases {
+		b.Run(tc.name, func(b *testing.B) {
+			svc := NewShortLinkService(nil, nil, nil, "http://localhost")
+			sl := &model.ShortLink{ShortCode: "ABCD", OriginalURL: tc.url}
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				benchSink = svc.ExpandURL(sl, tc.params)
+			}
+		})
+	}
+}
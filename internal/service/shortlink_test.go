@@ -2,14 +2,26 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"net/url"
 	"testing"
 	"time"
 
+	"octopus/internal/config"
 	"octopus/internal/model"
+	"octopus/internal/mq"
+	"octopus/internal/repository"
+	"octopus/internal/storage"
+	"octopus/pkg/clock"
+	"octopus/pkg/util"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"octopus/internal/mocks"
 )
 
@@ -17,8 +29,8 @@ func TestNewShortLinkService(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mockMySQL := mocks.NewMockMySQLRepositoryInterface(ctrl)
-	mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
 	mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
 
 	svc := NewShortLinkService(mockMySQL, mockRedis, mockBloom, "https://s.example.com")
@@ -34,16 +46,16 @@ func TestShortLinkService_Generate(t *testing.T) {
 	tests := []struct {
 		name      string
 		req       *model.GenerateRequest
-		setupMock func(*gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface, BloomServiceInterface)
+		setupMock func(*gomock.Controller) (storage.LinkStore, storage.LinkCache, BloomServiceInterface)
 		wantErr   error
 		wantCode string
 	}{
 		{
 			name: "empty URL",
 			req:  &model.GenerateRequest{URL: ""},
-			setupMock: func(ctrl *gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface, BloomServiceInterface) {
-				return mocks.NewMockMySQLRepositoryInterface(ctrl),
-					mocks.NewMockRedisRepositoryInterface(ctrl),
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache, BloomServiceInterface) {
+				return mocks.NewMockDatabase(ctrl),
+					mocks.NewMockCache(ctrl),
 					mocks.NewMockBloomServiceInterface(ctrl)
 			},
 			wantErr: ErrInvalidURL,
@@ -51,25 +63,26 @@ func TestShortLinkService_Generate(t *testing.T) {
 		{
 			name: "invalid expire_at format",
 			req:  &model.GenerateRequest{URL: "https://example.com", ExpireAt: "invalid"},
-			setupMock: func(ctrl *gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface, BloomServiceInterface) {
-				return mocks.NewMockMySQLRepositoryInterface(ctrl),
-					mocks.NewMockRedisRepositoryInterface(ctrl),
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache, BloomServiceInterface) {
+				return mocks.NewMockDatabase(ctrl),
+					mocks.NewMockCache(ctrl),
 					mocks.NewMockBloomServiceInterface(ctrl)
 			},
-			wantErr: errors.New("invalid expire_at format"),
+			wantErr: ErrInvalidExpireAt,
 		},
 		{
 			name: "cache hit",
 			req:  &model.GenerateRequest{URL: "https://example.com"},
-			setupMock: func(ctrl *gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface, BloomServiceInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockMySQL := mocks.NewMockMySQLRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache, BloomServiceInterface) {
+				mockRedis := mocks.NewMockCache(ctrl)
+				mockMySQL := mocks.NewMockDatabase(ctrl)
 				mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
 
 				mockRedis.EXPECT().GetShortLink(gomock.Any(), "https://example.com").Return("ABCD", nil)
 				mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{
 					ShortCode:   "ABCD",
 					OriginalURL: "https://example.com",
+					DedupHash:   dedupHash("https://example.com", nil),
 					Status:      1,
 				}, nil)
 
@@ -80,13 +93,13 @@ func TestShortLinkService_Generate(t *testing.T) {
 		{
 			name: "URL already exists in MySQL",
 			req:  &model.GenerateRequest{URL: "https://example.com"},
-			setupMock: func(ctrl *gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface, BloomServiceInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockMySQL := mocks.NewMockMySQLRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache, BloomServiceInterface) {
+				mockRedis := mocks.NewMockCache(ctrl)
+				mockMySQL := mocks.NewMockDatabase(ctrl)
 				mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
 
 				mockRedis.EXPECT().GetShortLink(gomock.Any(), "https://example.com").Return("", errors.New("not found"))
-				mockMySQL.EXPECT().GetShortLinkByURL(gomock.Any(), "https://example.com").Return(&model.ShortLink{
+				mockMySQL.EXPECT().GetShortLinkByDedupHash(gomock.Any(), dedupHash("https://example.com", nil)).Return(&model.ShortLink{
 					ID:          1,
 					ShortCode:   "ABCD",
 					OriginalURL: "https://example.com",
@@ -101,20 +114,18 @@ func TestShortLinkService_Generate(t *testing.T) {
 		{
 			name: "generate new short link",
 			req:  &model.GenerateRequest{URL: "https://example.com"},
-			setupMock: func(ctrl *gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface, BloomServiceInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockMySQL := mocks.NewMockMySQLRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache, BloomServiceInterface) {
+				mockRedis := mocks.NewMockCache(ctrl)
+				mockMySQL := mocks.NewMockDatabase(ctrl)
 				mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
 
 				mockRedis.EXPECT().GetShortLink(gomock.Any(), "https://example.com").Return("", errors.New("not found"))
-				mockMySQL.EXPECT().GetShortLinkByURL(gomock.Any(), "https://example.com").Return(nil, errors.New("not found"))
+				mockMySQL.EXPECT().GetShortLinkByDedupHash(gomock.Any(), dedupHash("https://example.com", nil)).Return(nil, errors.New("not found"))
 				mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
 				mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(false, nil)
 				mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).Return(nil)
-				// First SaveShortLink: cacheKey as key, shortCode as value
-				mockRedis.EXPECT().SaveShortLink(gomock.Any(), gomock.Eq("https://example.com"), gomock.Any(), gomock.Any()).Return(nil)
-				// Second SaveShortLink: shortCode as key, URL as value
-				mockRedis.EXPECT().SaveShortLink(gomock.Any(), gomock.Any(), gomock.Eq("https://example.com"), gomock.Any()).Return(nil)
+				// cacheKey maps to the shortCode, the shortCode to the URL
+				mockRedis.EXPECT().SaveShortLinkPair(gomock.Any(), gomock.Eq("https://example.com"), gomock.Any(), gomock.Any()).Return(nil)
 				mockBloom.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil)
 
 				return mockMySQL, mockRedis, mockBloom
@@ -123,21 +134,19 @@ func TestShortLinkService_Generate(t *testing.T) {
 		},
 		{
 			name: "generate with valid expire_at",
-			req:  &model.GenerateRequest{URL: "https://example.com", ExpireAt: "2025-12-31T23:59:59Z"},
-			setupMock: func(ctrl *gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface, BloomServiceInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockMySQL := mocks.NewMockMySQLRepositoryInterface(ctrl)
+			req:  &model.GenerateRequest{URL: "https://example.com", ExpireAt: "2099-12-31T23:59:59Z"},
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache, BloomServiceInterface) {
+				mockRedis := mocks.NewMockCache(ctrl)
+				mockMySQL := mocks.NewMockDatabase(ctrl)
 				mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
 
 				mockRedis.EXPECT().GetShortLink(gomock.Any(), "https://example.com").Return("", errors.New("not found"))
-				mockMySQL.EXPECT().GetShortLinkByURL(gomock.Any(), "https://example.com").Return(nil, errors.New("not found"))
+				mockMySQL.EXPECT().GetShortLinkByDedupHash(gomock.Any(), dedupHash("https://example.com", nil)).Return(nil, errors.New("not found"))
 				mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
 				mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(false, nil)
 				mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).Return(nil)
-				// First SaveShortLink: cacheKey as key, shortCode as value
-				mockRedis.EXPECT().SaveShortLink(gomock.Any(), gomock.Eq("https://example.com"), gomock.Any(), gomock.Any()).Return(nil)
-				// Second SaveShortLink: shortCode as key, URL as value
-				mockRedis.EXPECT().SaveShortLink(gomock.Any(), gomock.Any(), gomock.Eq("https://example.com"), gomock.Any()).Return(nil)
+				// cacheKey maps to the shortCode, the shortCode to the URL
+				mockRedis.EXPECT().SaveShortLinkPair(gomock.Any(), gomock.Eq("https://example.com"), gomock.Any(), gomock.Any()).Return(nil)
 				mockBloom.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil)
 
 				return mockMySQL, mockRedis, mockBloom
@@ -150,18 +159,18 @@ func TestShortLinkService_Generate(t *testing.T) {
 				URL:    "https://example.com",
 				Params: map[string]interface{}{"utm_source": "google"},
 			},
-			setupMock: func(ctrl *gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface, BloomServiceInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockMySQL := mocks.NewMockMySQLRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache, BloomServiceInterface) {
+				mockRedis := mocks.NewMockCache(ctrl)
+				mockMySQL := mocks.NewMockDatabase(ctrl)
 				mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
 
-				mockRedis.EXPECT().GetShortLink(gomock.Any(), "https://example.com:map[utm_source:google]").Return("", errors.New("not found"))
-				mockMySQL.EXPECT().GetShortLinkByURL(gomock.Any(), "https://example.com").Return(nil, errors.New("not found"))
+				cacheKey := "https://example.com:" + sha256Hex(`{"utm_source":"google"}`)
+				mockRedis.EXPECT().GetShortLink(gomock.Any(), cacheKey).Return("", errors.New("not found"))
+				mockMySQL.EXPECT().GetShortLinkByDedupHash(gomock.Any(), dedupHash("https://example.com", []byte(`{"utm_source":"google"}`))).Return(nil, errors.New("not found"))
 				mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
 				mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(false, nil)
 				mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).Return(nil)
-				mockRedis.EXPECT().SaveShortLink(gomock.Any(), "https://example.com:map[utm_source:google]", gomock.Any(), gomock.Any()).Return(nil)
-				mockRedis.EXPECT().SaveShortLink(gomock.Any(), gomock.Any(), "https://example.com", gomock.Any()).Return(nil)
+				mockRedis.EXPECT().SaveShortLinkPair(gomock.Any(), cacheKey, gomock.Any(), gomock.Any()).Return(nil)
 				mockBloom.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil)
 
 				return mockMySQL, mockRedis, mockBloom
@@ -171,13 +180,13 @@ func TestShortLinkService_Generate(t *testing.T) {
 		{
 			name: "max capacity reached",
 			req:  &model.GenerateRequest{URL: "https://example.com"},
-			setupMock: func(ctrl *gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface, BloomServiceInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockMySQL := mocks.NewMockMySQLRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache, BloomServiceInterface) {
+				mockRedis := mocks.NewMockCache(ctrl)
+				mockMySQL := mocks.NewMockDatabase(ctrl)
 				mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
 
 				mockRedis.EXPECT().GetShortLink(gomock.Any(), "https://example.com").Return("", errors.New("not found"))
-				mockMySQL.EXPECT().GetShortLinkByURL(gomock.Any(), "https://example.com").Return(nil, errors.New("not found"))
+				mockMySQL.EXPECT().GetShortLinkByDedupHash(gomock.Any(), dedupHash("https://example.com", nil)).Return(nil, errors.New("not found"))
 				// Bloom filter says exists for all codes
 				mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(true, nil).AnyTimes()
 				mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(true, nil).AnyTimes()
@@ -189,13 +198,13 @@ func TestShortLinkService_Generate(t *testing.T) {
 		{
 			name: "save to MySQL fails",
 			req:  &model.GenerateRequest{URL: "https://example.com"},
-			setupMock: func(ctrl *gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface, BloomServiceInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockMySQL := mocks.NewMockMySQLRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache, BloomServiceInterface) {
+				mockRedis := mocks.NewMockCache(ctrl)
+				mockMySQL := mocks.NewMockDatabase(ctrl)
 				mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
 
 				mockRedis.EXPECT().GetShortLink(gomock.Any(), "https://example.com").Return("", errors.New("not found"))
-				mockMySQL.EXPECT().GetShortLinkByURL(gomock.Any(), "https://example.com").Return(nil, errors.New("not found"))
+				mockMySQL.EXPECT().GetShortLinkByDedupHash(gomock.Any(), dedupHash("https://example.com", nil)).Return(nil, errors.New("not found"))
 				mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
 				mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(false, nil)
 				mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).Return(errors.New("db error"))
@@ -207,20 +216,18 @@ func TestShortLinkService_Generate(t *testing.T) {
 		{
 			name: "Bloom filter error - fallthrough to DB check",
 			req:  &model.GenerateRequest{URL: "https://example.com"},
-			setupMock: func(ctrl *gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface, BloomServiceInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockMySQL := mocks.NewMockMySQLRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache, BloomServiceInterface) {
+				mockRedis := mocks.NewMockCache(ctrl)
+				mockMySQL := mocks.NewMockDatabase(ctrl)
 				mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
 
 				mockRedis.EXPECT().GetShortLink(gomock.Any(), "https://example.com").Return("", errors.New("not found"))
-				mockMySQL.EXPECT().GetShortLinkByURL(gomock.Any(), "https://example.com").Return(nil, errors.New("not found"))
+				mockMySQL.EXPECT().GetShortLinkByDedupHash(gomock.Any(), dedupHash("https://example.com", nil)).Return(nil, errors.New("not found"))
 				mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, errors.New("bloom error"))
 				mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(false, nil)
 				mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).Return(nil)
-				// First SaveShortLink: cacheKey as key, shortCode as value
-				mockRedis.EXPECT().SaveShortLink(gomock.Any(), gomock.Eq("https://example.com"), gomock.Any(), gomock.Any()).Return(nil)
-				// Second SaveShortLink: shortCode as key, URL as value
-				mockRedis.EXPECT().SaveShortLink(gomock.Any(), gomock.Any(), gomock.Eq("https://example.com"), gomock.Any()).Return(nil)
+				// cacheKey maps to the shortCode, the shortCode to the URL
+				mockRedis.EXPECT().SaveShortLinkPair(gomock.Any(), gomock.Eq("https://example.com"), gomock.Any(), gomock.Any()).Return(nil)
 				// Add to Bloom Filter (will be called even if Exists failed)
 				mockBloom.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil)
 
@@ -264,18 +271,18 @@ func TestShortLinkService_Get(t *testing.T) {
 	tests := []struct {
 		name      string
 		shortCode string
-		setupMock func(*gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface)
+		setupMock func(*gomock.Controller) (storage.LinkStore, storage.LinkCache)
 		wantErr   error
 		wantURL   string
 	}{
 		{
 			name:      "cache hit",
 			shortCode: "ABCD",
-			setupMock: func(ctrl *gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockMySQL := mocks.NewMockMySQLRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+				mockMySQL := mocks.NewMockDatabase(ctrl)
 
-				mockRedis.EXPECT().GetShortLink(gomock.Any(), "ABCD").Return("https://example.com", nil)
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com", Status: 1}, nil)
 
 				return mockMySQL, mockRedis
 			},
@@ -284,17 +291,17 @@ func TestShortLinkService_Get(t *testing.T) {
 		{
 			name:      "cache miss, MySQL hit",
 			shortCode: "ABCD",
-			setupMock: func(ctrl *gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockMySQL := mocks.NewMockMySQLRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+				mockMySQL := mocks.NewMockDatabase(ctrl)
 
-				mockRedis.EXPECT().GetShortLink(gomock.Any(), "ABCD").Return("", errors.New("not found"))
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(nil, errors.New("not found"))
 				mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{
 					ShortCode:   "ABCD",
 					OriginalURL: "https://example.com",
 					Status:      1,
 				}, nil)
-				mockRedis.EXPECT().SaveShortLink(gomock.Any(), "ABCD", "https://example.com", gomock.Any()).Return(nil)
+				mockRedis.EXPECT().CacheShortLink(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 				return mockMySQL, mockRedis
 			},
@@ -303,12 +310,12 @@ func TestShortLinkService_Get(t *testing.T) {
 		{
 			name:      "short link not found",
 			shortCode: "ABCD",
-			setupMock: func(ctrl *gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockMySQL := mocks.NewMockMySQLRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+				mockMySQL := mocks.NewMockDatabase(ctrl)
 
-				mockRedis.EXPECT().GetShortLink(gomock.Any(), "ABCD").Return("", errors.New("not found"))
-				mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(nil, errors.New("not found"))
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(nil, errors.New("not found"))
+				mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(nil, repository.ErrNotFound)
 
 				return mockMySQL, mockRedis
 			},
@@ -317,12 +324,12 @@ func TestShortLinkService_Get(t *testing.T) {
 		{
 			name:      "short link expired",
 			shortCode: "ABCD",
-			setupMock: func(ctrl *gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockMySQL := mocks.NewMockMySQLRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+				mockMySQL := mocks.NewMockDatabase(ctrl)
 
 				past := time.Now().Add(-1 * time.Hour)
-				mockRedis.EXPECT().GetShortLink(gomock.Any(), "ABCD").Return("", errors.New("not found"))
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(nil, errors.New("not found"))
 				mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{
 					ShortCode:   "ABCD",
 					OriginalURL: "https://example.com",
@@ -337,11 +344,11 @@ func TestShortLinkService_Get(t *testing.T) {
 		{
 			name:      "short link inactive",
 			shortCode: "ABCD",
-			setupMock: func(ctrl *gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockMySQL := mocks.NewMockMySQLRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+				mockMySQL := mocks.NewMockDatabase(ctrl)
 
-				mockRedis.EXPECT().GetShortLink(gomock.Any(), "ABCD").Return("", errors.New("not found"))
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(nil, errors.New("not found"))
 				mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{
 					ShortCode:   "ABCD",
 					OriginalURL: "https://example.com",
@@ -352,21 +359,57 @@ func TestShortLinkService_Get(t *testing.T) {
 			},
 			wantErr: ErrShortLinkExpired,
 		},
+		{
+			name:      "cache hit on an expired link",
+			shortCode: "ABCD",
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+				mockMySQL := mocks.NewMockDatabase(ctrl)
+
+				past := time.Now().Add(-1 * time.Second)
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{
+					ShortCode:   "ABCD",
+					OriginalURL: "https://example.com",
+					Status:      1,
+					ExpireAt:    &past,
+				}, nil)
+
+				return mockMySQL, mockRedis
+			},
+			wantErr: ErrShortLinkExpired,
+		},
+		{
+			name:      "cache hit on an inactive link",
+			shortCode: "ABCD",
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+				mockMySQL := mocks.NewMockDatabase(ctrl)
+
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{
+					ShortCode:   "ABCD",
+					OriginalURL: "https://example.com",
+					Status:      0,
+				}, nil)
+
+				return mockMySQL, mockRedis
+			},
+			wantErr: ErrShortLinkExpired,
+		},
 		{
 			name:      "cache and populate cache after MySQL hit",
 			shortCode: "ABCD",
-			setupMock: func(ctrl *gomock.Controller) (MySQLRepositoryInterface, RedisRepositoryInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
-				mockMySQL := mocks.NewMockMySQLRepositoryInterface(ctrl)
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkStore, storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+				mockMySQL := mocks.NewMockDatabase(ctrl)
 
-				mockRedis.EXPECT().GetShortLink(gomock.Any(), "ABCD").Return("", errors.New("not found"))
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(nil, errors.New("not found"))
 				mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{
 					ShortCode:   "ABCD",
 					OriginalURL: "https://example.com",
 					Status:      1,
 					ExpireAt:    nil,
 				}, nil)
-				mockRedis.EXPECT().SaveShortLink(gomock.Any(), "ABCD", "https://example.com", gomock.Any()).Return(nil)
+				mockRedis.EXPECT().CacheShortLink(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 				return mockMySQL, mockRedis
 			},
@@ -398,23 +441,47 @@ func TestShortLinkService_Get(t *testing.T) {
 	}
 }
 
+func TestShortLinkService_GetAtExpiry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	expireAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	mockRedis := mocks.NewMockCache(ctrl)
+	mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{
+		ShortCode: "ABCD", OriginalURL: "https://example.com", Status: 1, ExpireAt: &expireAt,
+	}, nil).Times(2)
+
+	svc := NewShortLinkService(mocks.NewMockDatabase(ctrl), mockRedis, mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+	now := clock.NewFake(expireAt)
+	svc.clock = now
+
+	// A link still redirects at its expiry and expires right after
+	sl, err := svc.Get(context.Background(), "ABCD")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", sl.OriginalURL)
+
+	now.Advance(time.Nanosecond)
+	_, err = svc.Get(context.Background(), "ABCD")
+	assert.ErrorIs(t, err, ErrShortLinkExpired)
+}
+
 func TestShortLinkService_ExpandURL(t *testing.T) {
 	tests := []struct {
 		name        string
 		shortCode   string
-		queryParams map[string]string
-		setupMock   func(*gomock.Controller) (RedisRepositoryInterface)
+		queryParams url.Values
+		setupMock   func(*gomock.Controller) (storage.LinkCache)
 		wantURL     string
 		wantErr     error
 	}{
 		{
 			name:        "expand with query params",
 			shortCode:   "ABCD",
-			queryParams: map[string]string{"utm_source": "google", "utm_campaign": "promo"},
-			setupMock: func(ctrl *gomock.Controller) (RedisRepositoryInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
+			queryParams: url.Values{"utm_source": {"google"}, "utm_campaign": {"promo"}},
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
 
-				mockRedis.EXPECT().GetShortLink(gomock.Any(), "ABCD").Return("https://example.com/page", nil)
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/page", Status: 1}, nil)
 
 				return mockRedis
 			},
@@ -423,11 +490,11 @@ func TestShortLinkService_ExpandURL(t *testing.T) {
 		{
 			name:        "expand without query params",
 			shortCode:   "ABCD",
-			queryParams: map[string]string{},
-			setupMock: func(ctrl *gomock.Controller) (RedisRepositoryInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
+			queryParams: url.Values{},
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
 
-				mockRedis.EXPECT().GetShortLink(gomock.Any(), "ABCD").Return("https://example.com/page", nil)
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/page", Status: 1}, nil)
 
 				return mockRedis
 			},
@@ -436,11 +503,11 @@ func TestShortLinkService_ExpandURL(t *testing.T) {
 		{
 			name:        "expand with existing query params",
 			shortCode:   "ABCD",
-			queryParams: map[string]string{"new_param": "value"},
-			setupMock: func(ctrl *gomock.Controller) (RedisRepositoryInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
+			queryParams: url.Values{"new_param": {"value"}},
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
 
-				mockRedis.EXPECT().GetShortLink(gomock.Any(), "ABCD").Return("https://example.com/page?existing=value", nil)
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/page?existing=value", Status: 1}, nil)
 
 				return mockRedis
 			},
@@ -449,11 +516,11 @@ func TestShortLinkService_ExpandURL(t *testing.T) {
 		{
 			name:        "expand with empty query param value",
 			shortCode:   "ABCD",
-			queryParams: map[string]string{"empty": ""},
-			setupMock: func(ctrl *gomock.Controller) (RedisRepositoryInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
+			queryParams: url.Values{"empty": {""}},
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
 
-				mockRedis.EXPECT().GetShortLink(gomock.Any(), "ABCD").Return("https://example.com/page", nil)
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/page", Status: 1}, nil)
 
 				return mockRedis
 			},
@@ -462,16 +529,146 @@ func TestShortLinkService_ExpandURL(t *testing.T) {
 		{
 			name:        "expand with special chars",
 			shortCode:   "ABCD",
-			queryParams: map[string]string{"query": "hello world"},
-			setupMock: func(ctrl *gomock.Controller) (RedisRepositoryInterface) {
-				mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
+			queryParams: url.Values{"query": {"hello world"}},
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
 
-				mockRedis.EXPECT().GetShortLink(gomock.Any(), "ABCD").Return("https://example.com", nil)
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com", Status: 1}, nil)
 
 				return mockRedis
 			},
 			wantURL: "https://example.com?query=hello+world",
 		},
+		{
+			name:        "expand with repeated keys",
+			shortCode:   "ABCD",
+			queryParams: url.Values{"tag": {"a", "b"}},
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/page", Status: 1}, nil)
+
+				return mockRedis
+			},
+			wantURL: "https://example.com/page?tag=a&tag=b",
+		},
+		{
+			name:        "expand replaces existing key",
+			shortCode:   "ABCD",
+			queryParams: url.Values{"tag": {"c", "d"}},
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/page?tag=a&tag=b&z=1", Status: 1}, nil)
+
+				return mockRedis
+			},
+			wantURL: "https://example.com/page?z=1&tag=c&tag=d",
+		},
+		{
+			name:        "expand keeps fragment",
+			shortCode:   "ABCD",
+			queryParams: url.Values{"ref": {"sms"}},
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/page?a=1#section-2", Status: 1}, nil)
+
+				return mockRedis
+			},
+			wantURL: "https://example.com/page?a=1&ref=sms#section-2",
+		},
+		{
+			name:        "expand keeps pre-encoded destination query",
+			shortCode:   "ABCD",
+			queryParams: url.Values{"ref": {"a/b"}},
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/search?q=caf%C3%A9%20bar&path=%2Fx%2Fy&b=2&a=1", Status: 1}, nil)
+
+				return mockRedis
+			},
+			wantURL: "https://example.com/search?q=caf%C3%A9%20bar&path=%2Fx%2Fy&b=2&a=1&ref=a%2Fb",
+		},
+		{
+			name:        "expand keeps pre-encoded fragment",
+			shortCode:   "ABCD",
+			queryParams: url.Values{"ref": {"sms"}},
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/app#/route%3Fid%3D1", Status: 1}, nil)
+
+				return mockRedis
+			},
+			wantURL: "https://example.com/app?ref=sms#/route%3Fid%3D1",
+		},
+		{
+			name:        "expand without query params keeps URL untouched",
+			shortCode:   "ABCD",
+			queryParams: nil,
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/page?b=2&a=%7e#top", Status: 1}, nil)
+
+				return mockRedis
+			},
+			wantURL: "https://example.com/page?b=2&a=%7e#top",
+		},
+		{
+			name:        "expand signed URL appends without reparsing",
+			shortCode:   "ABCD",
+			queryParams: url.Values{"X-Amz-Signature": {"forged"}, "ref": {"sms"}},
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://b.s3.amazonaws.com/a%2Fb?X-Amz-Date=20240101T000000Z&X-Amz-Signature=ab12", Status: 1}, nil)
+
+				return mockRedis
+			},
+			wantURL: "https://b.s3.amazonaws.com/a%2Fb?X-Amz-Date=20240101T000000Z&X-Amz-Signature=ab12&X-Amz-Signature=forged&ref=sms",
+		},
+		{
+			name:        "expand with preserve_query appends without reparsing",
+			shortCode:   "ABCD",
+			queryParams: url.Values{"a": {"2"}},
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/p?a=1&b=%7e#frag", Status: 1, PreserveQuery: true}, nil)
+
+				return mockRedis
+			},
+			wantURL: "https://example.com/p?a=1&b=%7e&a=2#frag",
+		},
+		{
+			name:        "expand with link params",
+			shortCode:   "ABCD",
+			queryParams: nil,
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/page?utm_source=site&a=1", Params: []byte(`{"utm_source":"mail","week":12,"vip":true}`), Status: 1}, nil)
+
+				return mockRedis
+			},
+			wantURL: "https://example.com/page?a=1&utm_source=mail&vip=true&week=12",
+		},
+		{
+			name:        "expand request params replace link params",
+			shortCode:   "ABCD",
+			queryParams: url.Values{"utm_source": {"sms"}},
+			setupMock: func(ctrl *gomock.Controller) (storage.LinkCache) {
+				mockRedis := mocks.NewMockCache(ctrl)
+
+				mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/page", Params: []byte(`{"utm_source":"mail","week":12}`), Status: 1}, nil)
+
+				return mockRedis
+			},
+			wantURL: "https://example.com/page?utm_source=sms&week=12",
+		},
 	}
 
 	for _, tt := range tests {
@@ -480,26 +677,52 @@ func TestShortLinkService_ExpandURL(t *testing.T) {
 			defer ctrl.Finish()
 
 			mockRedis := tt.setupMock(ctrl)
-			svc := NewShortLinkService(mocks.NewMockMySQLRepositoryInterface(ctrl), mockRedis, mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+			svc := NewShortLinkService(mocks.NewMockDatabase(ctrl), mockRedis, mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
 
-			url, err := svc.ExpandURL(context.Background(), tt.shortCode, tt.queryParams)
+			sl, err := svc.Get(context.Background(), tt.shortCode)
 
 			if tt.wantErr != nil {
 				assert.Error(t, err)
 			} else {
-				assert.NoError(t, err)
-				assert.Equal(t, tt.wantURL, url)
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantURL, svc.ExpandURL(sl, tt.queryParams))
 			}
 		})
 	}
 }
 
+func TestShortLinkService_ExpandURLSchedule(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	schedule := json.RawMessage(`{"rules":[{"days":"mon-fri","from":"09:00","to":"18:00","url":"https://example.com/open"}]}`)
+	mockRedis := mocks.NewMockCache(ctrl)
+	sl := &model.ShortLink{ShortCode: "ABCD", OriginalURL: "https://example.com/closed", Status: 1, Schedule: schedule}
+
+	svc := NewShortLinkService(mocks.NewMockDatabase(ctrl), mockRedis, mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+	// Friday 2026-10-16, 08:00 UTC
+	now := clock.NewFake(time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC))
+	svc.clock = now
+
+	assert.Equal(t, "https://example.com/closed?ref=sms", svc.ExpandURL(sl, url.Values{"ref": {"sms"}}))
+
+	now.Advance(time.Hour)
+	assert.Equal(t, "https://example.com/open?ref=sms", svc.ExpandURL(sl, url.Values{"ref": {"sms"}}))
+
+	// Schedules without a timezone run in the configured one
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	svc.SetTimezone(paris)
+	now.Advance(8 * time.Hour)
+	assert.Equal(t, "https://example.com/closed", svc.ExpandURL(sl, nil))
+}
+
 func TestShortLinkService_buildCacheKey(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mockMySQL := mocks.NewMockMySQLRepositoryInterface(ctrl)
-	mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
 	mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
 
 	svc := NewShortLinkService(mockMySQL, mockRedis, mockBloom, "https://s.example.com")
@@ -526,24 +749,140 @@ func TestShortLinkService_buildCacheKey(t *testing.T) {
 			name:   "with params",
 			url:    "https://example.com",
 			params: map[string]interface{}{"utm_source": "google"},
-			want:   "https://example.com:map[utm_source:google]",
+			// SHA-256 of {"utm_source":"google"}
+			want: "https://example.com:" + sha256Hex(`{"utm_source":"google"}`),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := svc.buildCacheKey(tt.url, tt.params)
+			params, err := canonicalParams(tt.params)
+			require.NoError(t, err)
+			result := svc.buildCacheKey(tt.url, params)
 			assert.Equal(t, tt.want, result)
 		})
 	}
 }
 
+func TestCanonicalParams(t *testing.T) {
+	a := map[string]interface{}{
+		"utm_source": "google", "utm_medium": "cpc", "campaign": "spring",
+		"meta": map[string]interface{}{"z": 1, "a": 2},
+	}
+	want := `{"campaign":"spring","meta":{"a":2,"z":1},"utm_medium":"cpc","utm_source":"google"}`
+
+	// Map iteration order differs between runs, the encoding must not
+	for i := 0; i < 20; i++ {
+		b := make(map[string]interface{}, len(a))
+		for k, v := range a {
+			b[k] = v
+		}
+		got, err := canonicalParams(b)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(got))
+	}
+
+	got, err := canonicalParams(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name string
+		req  *model.GenerateRequest
+		want *time.Time
+		err  string
+	}{
+		{name: "never", req: &model.GenerateRequest{}},
+		{name: "absolute", req: &model.GenerateRequest{ExpireAt: "2025-01-02T12:00:00Z"}, want: at(24 * time.Hour)},
+		{name: "ttl", req: &model.GenerateRequest{TTL: "72h"}, want: at(72 * time.Hour)},
+		{name: "seconds", req: &model.GenerateRequest{ExpireInSeconds: 90}, want: at(90 * time.Second)},
+		{name: "invalid absolute", req: &model.GenerateRequest{ExpireAt: "tomorrow"}, err: "invalid expire_at: parsing time"},
+		{name: "invalid ttl", req: &model.GenerateRequest{TTL: "3d"}, err: "invalid expire_at: ttl: time: unknown unit"},
+		{name: "negative ttl", req: &model.GenerateRequest{TTL: "-1h"}, err: "invalid expire_at: ttl must be positive"},
+		{name: "negative seconds", req: &model.GenerateRequest{ExpireInSeconds: -1}, err: "invalid expire_at: expire_in_seconds must be positive"},
+		{name: "combined", req: &model.GenerateRequest{TTL: "1h", ExpireInSeconds: 60}, err: "invalid expire_at: expire_at, ttl and expire_in_seconds are exclusive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expiry(tt.req, now)
+			if tt.err != "" {
+				assert.ErrorIs(t, err, ErrInvalidExpireAt)
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.want == nil {
+				assert.Nil(t, got)
+				return
+			}
+			require.NotNil(t, got)
+			assert.True(t, tt.want.Equal(*got), "%s != %s", got, tt.want)
+		})
+	}
+}
+
+func TestDedupHash(t *testing.T) {
+	assert.Equal(t, sha256Hex("https://example.com"), dedupHash("https://example.com", nil))
+	assert.NotEqual(t, dedupHash("https://example.com", nil), dedupHash("https://example.com", []byte(`{"a":1}`)))
+	assert.NotEqual(t, dedupHash("https://example.com", []byte(`{"a":1}`)), dedupHash("https://example.com", []byte(`{"a":2}`)))
+}
+
+func TestShortLinkService_Generate_SameParams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+
+	params, _ := canonicalParams(map[string]interface{}{"a": "1", "b": "2"})
+	hash := dedupHash("https://example.com", params)
+
+	// Both requests look up the same cache key and row, whatever the order of their params
+	mockRedis.EXPECT().GetShortLink(gomock.Any(), "https://example.com:"+sha256Hex(string(params))).Return("", errors.New("not found")).Times(2)
+	mockMySQL.EXPECT().GetShortLinkByDedupHash(gomock.Any(), hash).Return(&model.ShortLink{
+		ShortCode:   "ABCD",
+		OriginalURL: "https://example.com",
+		DedupHash:   hash,
+		Status:      1,
+	}, nil).Times(2)
+	mockRedis.EXPECT().SaveShortLink(gomock.Any(), gomock.Any(), "ABCD", gomock.Any()).Return(nil).Times(2)
+
+	svc := NewShortLinkService(mockMySQL, mockRedis, mockBloom, "https://s.example.com")
+
+	first, err := svc.Generate(context.Background(), &model.GenerateRequest{
+		URL:    "https://example.com",
+		Params: map[string]interface{}{"a": "1", "b": "2"},
+	})
+	require.NoError(t, err)
+	second, err := svc.Generate(context.Background(), &model.GenerateRequest{
+		URL:    "https://example.com",
+		Params: map[string]interface{}{"b": "2", "a": "1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, first.ShortCode, second.ShortCode)
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
 func TestShortLinkService_buildResponse(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mockMySQL := mocks.NewMockMySQLRepositoryInterface(ctrl)
-	mockRedis := mocks.NewMockRedisRepositoryInterface(ctrl)
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
 	mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
 
 	svc := NewShortLinkService(mockMySQL, mockRedis, mockBloom, "https://s.example.com")
@@ -583,6 +922,21 @@ func TestShortLinkService_buildResponse(t *testing.T) {
 				ExpireAt:    now,
 			},
 		},
+		{
+			name: "response with params",
+			sl: &model.ShortLink{
+				ShortCode:   "ABCD",
+				OriginalURL: "https://example.com",
+				Params:      []byte(`{"utm_source":"mail","week":12}`),
+				Status:      1,
+			},
+			want: &model.GenerateResponse{
+				ShortLink:   "https://s.example.com/ABCD",
+				ShortCode:   "ABCD",
+				OriginalURL: "https://example.com",
+				Params:      map[string]interface{}{"utm_source": "mail", "week": json.Number("12")},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -591,6 +945,7 @@ func TestShortLinkService_buildResponse(t *testing.T) {
 			assert.Equal(t, tt.want.ShortLink, result.ShortLink)
 			assert.Equal(t, tt.want.ShortCode, result.ShortCode)
 			assert.Equal(t, tt.want.OriginalURL, result.OriginalURL)
+			assert.Equal(t, tt.want.Params, result.Params)
 			if tt.want.ExpireAt.IsZero() {
 				assert.True(t, result.ExpireAt.IsZero())
 			} else {
@@ -599,3 +954,868 @@ func TestShortLinkService_buildResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestShortLinkService_GenerateSMS(t *testing.T) {
+	t.Run("SMS pool disabled", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc := NewShortLinkService(mocks.NewMockDatabase(ctrl),
+			mocks.NewMockCache(ctrl),
+			mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+
+		_, err := svc.Generate(context.Background(), &model.GenerateRequest{URL: "https://example.com", SMS: true})
+		assert.ErrorIs(t, err, ErrSMSPoolDisabled)
+	})
+
+	t.Run("allocates from the SMS pool on the SMS domain", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockRedis := mocks.NewMockCache(ctrl)
+		mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+		mockPool := mocks.NewMockSMSPoolServiceInterface(ctrl)
+
+		mockPool.EXPECT().CodeLength().Return(4).AnyTimes()
+		mockPool.EXPECT().DefaultTTL().Return(time.Hour)
+		mockPool.EXPECT().Domain().Return("https://s.ms")
+		mockRedis.EXPECT().GetShortLink(gomock.Any(), "sms:https://example.com").Return("", errors.New("not found"))
+		mockMySQL.EXPECT().GetShortLinkByDedupHash(gomock.Any(), dedupHash("https://example.com", nil)).Return(&model.ShortLink{
+			ShortCode:   "ABCDE",
+			OriginalURL: "https://example.com",
+			Status:      1,
+		}, nil)
+		mockPool.EXPECT().Allocate(gomock.Any(), "https://example.com").Return("WXYZ", nil)
+		mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, sl *model.ShortLink) error {
+			assert.Equal(t, model.PoolSMS, sl.Pool)
+			assert.NotNil(t, sl.ExpireAt)
+			return nil
+		})
+		mockRedis.EXPECT().SaveShortLinkPair(gomock.Any(), "sms:https://example.com", gomock.Any(), gomock.Any()).Return(nil)
+		mockPool.EXPECT().Confirm(gomock.Any(), "WXYZ").Return(nil)
+
+		svc := NewShortLinkService(mockMySQL, mockRedis, mockBloom, "https://s.example.com")
+		svc.SetSMSPool(mockPool)
+		assert.Equal(t, 5, svc.minLength)
+
+		resp, err := svc.Generate(context.Background(), &model.GenerateRequest{URL: "https://example.com", SMS: true})
+		assert.NoError(t, err)
+		assert.Equal(t, "WXYZ", resp.ShortCode)
+		assert.Equal(t, "https://s.ms/WXYZ", resp.ShortLink)
+		assert.False(t, resp.ExpireAt.IsZero())
+	})
+
+	t.Run("releases the code when saving fails", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockRedis := mocks.NewMockCache(ctrl)
+		mockPool := mocks.NewMockSMSPoolServiceInterface(ctrl)
+
+		mockPool.EXPECT().CodeLength().Return(4).AnyTimes()
+		mockPool.EXPECT().DefaultTTL().Return(time.Hour)
+		mockRedis.EXPECT().GetShortLink(gomock.Any(), gomock.Any()).Return("", errors.New("not found"))
+		mockMySQL.EXPECT().GetShortLinkByDedupHash(gomock.Any(), gomock.Any()).Return(nil, errors.New("not found"))
+		mockPool.EXPECT().Allocate(gomock.Any(), gomock.Any()).Return("WXYZ", nil)
+		mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).Return(errors.New("db error"))
+		mockPool.EXPECT().Release(gomock.Any(), "WXYZ").Return(nil)
+
+		svc := NewShortLinkService(mockMySQL, mockRedis, mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+		svc.SetSMSPool(mockPool)
+
+		_, err := svc.Generate(context.Background(), &model.GenerateRequest{URL: "https://example.com", SMS: true})
+		assert.Error(t, err)
+	})
+}
+
+func TestShortLinkService_generateWithCollision_Recycled(t *testing.T) {
+	t.Run("recycled code is used before hashing", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRecycler := mocks.NewMockRecyclerServiceInterface(ctrl)
+		mockRecycler.EXPECT().Acquire(gomock.Any()).Return("RECYC", true)
+
+		svc := NewShortLinkService(mocks.NewMockDatabase(ctrl),
+			mocks.NewMockCache(ctrl),
+			mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+		svc.SetRecycler(mockRecycler)
+
+		code, err := svc.generateWithCollision(context.Background(), "https://example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, "RECYC", code)
+	})
+
+	t.Run("recycled codes reserved for the SMS pool are skipped", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+		mockRecycler := mocks.NewMockRecyclerServiceInterface(ctrl)
+		mockPool := mocks.NewMockSMSPoolServiceInterface(ctrl)
+		mockPool.EXPECT().CodeLength().Return(4).AnyTimes()
+		mockRecycler.EXPECT().Acquire(gomock.Any()).Return("ABCD", true)
+		mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
+		mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(false, nil)
+
+		svc := NewShortLinkService(mockMySQL, mocks.NewMockCache(ctrl), mockBloom, "https://s.example.com")
+		svc.SetSMSPool(mockPool)
+		svc.SetRecycler(mockRecycler)
+
+		code, err := svc.generateWithCollision(context.Background(), "https://example.com")
+		assert.NoError(t, err)
+		assert.Len(t, code, 5)
+	})
+
+	t.Run("recycled codes are skipped when their flag is off", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+		mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
+		mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(false, nil)
+
+		svc := NewShortLinkService(mockMySQL, mocks.NewMockCache(ctrl), mockBloom, "https://s.example.com")
+		svc.SetRecycler(mocks.NewMockRecyclerServiceInterface(ctrl))
+		flags, _ := newTestFeatureFlags(t, map[string]config.FlagConfig{FlagRecycledCodes: {Enabled: true, Percentage: 0}})
+		svc.SetFlags(flags)
+
+		code, err := svc.generateWithCollision(context.Background(), "https://example.com")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, code)
+	})
+}
+
+func TestShortLinkService_Rules(t *testing.T) {
+	ctx := context.Background()
+	rules := newTestRules(t, repository.NewMemoryRepository(), miniredis.RunT(t))
+
+	t.Run("blocklisted destinations are refused", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		// Refused before touching storage
+		svc := NewShortLinkService(mocks.NewMockDatabase(ctrl), mocks.NewMockCache(ctrl),
+			mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+		svc.SetRules(rules)
+		_, err := rules.Create(ctx, &model.RuleRequest{Kind: model.RuleKindURLBlocklist, Pattern: "evil.example"})
+		require.NoError(t, err)
+
+		_, err = svc.Generate(ctx, &model.GenerateRequest{URL: "https://login.evil.example/"})
+		assert.ErrorIs(t, err, ErrBlockedURL)
+		_, err = svc.Generate(ctx, &model.GenerateRequest{URL: "https://example.com", Schedule: &model.Schedule{
+			Rules: []model.ScheduleRule{{Days: "*", URL: "https://evil.example"}},
+		}})
+		assert.ErrorIs(t, err, ErrBlockedURL)
+	})
+
+	t.Run("reserved words are not generated", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+		svc := NewShortLinkService(mockMySQL, mocks.NewMockCache(ctrl), mockBloom, "https://s.example.com")
+		svc.SetRules(rules)
+
+		reserved := svc.encoder.Encode(hashString("https://example.com"), svc.minLength)
+		_, err := rules.Create(ctx, &model.RuleRequest{Kind: model.RuleKindReservedWord, Pattern: reserved})
+		require.NoError(t, err)
+		mockBloom.EXPECT().Exists(gomock.Any(), gomock.Not(reserved)).Return(false, nil)
+		mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(false, nil)
+
+		code, err := svc.generateWithCollision(ctx, "https://example.com")
+		require.NoError(t, err)
+		assert.NotEqual(t, reserved, code)
+	})
+}
+
+func TestShortLinkService_GenerateNoClickID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+
+	mockRedis.EXPECT().GetShortLink(gomock.Any(), "https://example.com").Return("", errors.New("not found"))
+	mockMySQL.EXPECT().GetShortLinkByDedupHash(gomock.Any(), dedupHash("https://example.com", nil)).Return(nil, errors.New("not found"))
+	mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, sl *model.ShortLink) error {
+		assert.True(t, sl.NoClickID)
+		return nil
+	})
+	mockRedis.EXPECT().SaveShortLinkPair(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	mockBloom.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil)
+
+	svc := NewShortLinkService(mockMySQL, mockRedis, mockBloom, "https://s.example.com")
+	_, err := svc.Generate(context.Background(), &model.GenerateRequest{URL: "https://example.com", NoClickID: true})
+	assert.NoError(t, err)
+}
+
+func TestShortLinkService_GenerateNoTracking(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+
+	// Untracked links are looked up apart from tracked ones and never reuse them
+	mockRedis.EXPECT().GetShortLink(gomock.Any(), "untracked:https://example.com").Return("", errors.New("not found"))
+	mockMySQL.EXPECT().GetShortLinkByDedupHash(gomock.Any(), dedupHash("https://example.com", nil)).Return(&model.ShortLink{ShortCode: "TRCK", Status: 1}, nil)
+	mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, sl *model.ShortLink) error {
+		assert.True(t, sl.NoTracking)
+		return nil
+	})
+	mockRedis.EXPECT().SaveShortLinkPair(gomock.Any(), "untracked:https://example.com", gomock.Any(), gomock.Any()).Return(nil)
+	mockBloom.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil)
+
+	svc := NewShortLinkService(mockMySQL, mockRedis, mockBloom, "https://s.example.com")
+	tracked := false
+	resp, err := svc.Generate(context.Background(), &model.GenerateRequest{URL: "https://example.com", TrackingEnabled: &tracked})
+	require.NoError(t, err)
+	assert.NotEqual(t, "TRCK", resp.ShortCode)
+	assert.False(t, resp.TrackingEnabled)
+}
+
+func TestShortLinkService_GenerateLinkEvent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+	mockPublisher := mocks.NewMockProducerInterface(ctrl)
+
+	mockRedis.EXPECT().GetShortLink(gomock.Any(), "https://example.com").Return("", errors.New("not found"))
+	mockMySQL.EXPECT().GetShortLinkByDedupHash(gomock.Any(), dedupHash("https://example.com", nil)).Return(nil, errors.New("not found"))
+	mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).Return(nil)
+	mockRedis.EXPECT().SaveShortLinkPair(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	mockBloom.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil)
+
+	var event *mq.LinkEventMessage
+	mockPublisher.EXPECT().SendLinkEvent(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msg *mq.LinkEventMessage) error {
+		event = msg
+		// The link is already saved, a failed publish must not fail the request
+		return errors.New("broker unreachable")
+	})
+
+	svc := NewShortLinkService(mockMySQL, mockRedis, mockBloom, "https://s.example.com")
+	svc.SetEventPublisher(mockPublisher)
+	resp, err := svc.Generate(context.Background(), &model.GenerateRequest{URL: "https://example.com"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, mq.EventTypeLinkCreated, event.Type)
+	assert.Equal(t, resp.ShortCode, event.ShortCode)
+	assert.Equal(t, "https://example.com", event.OriginalURL)
+	assert.NotEmpty(t, event.EventID)
+	assert.False(t, event.OccurredAt.IsZero())
+}
+
+func TestShortLinkService_GenerateMaxClicks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+
+	// Limited links are never shared, so neither the cache nor MySQL are asked for an existing one
+	mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, sl *model.ShortLink) error {
+		assert.Equal(t, int64(3), sl.MaxClicks)
+		return nil
+	})
+	mockRedis.EXPECT().SetClickLimit(gomock.Any(), gomock.Any(), int64(3), time.Duration(0)).Return(nil)
+	mockRedis.EXPECT().CacheShortLink(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	mockBloom.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil)
+
+	svc := NewShortLinkService(mockMySQL, mockRedis, mockBloom, "https://s.example.com")
+	_, err := svc.Generate(context.Background(), &model.GenerateRequest{URL: "https://example.com", MaxClicks: 3})
+	assert.NoError(t, err)
+}
+
+func TestShortLinkService_GenerateSingleUse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+
+	// Single-use links are claimed through a click limit of one and never shared
+	mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, sl *model.ShortLink) error {
+		assert.True(t, sl.SingleUse)
+		assert.Equal(t, int64(1), sl.MaxClicks)
+		return nil
+	})
+	mockRedis.EXPECT().SetClickLimit(gomock.Any(), gomock.Any(), int64(1), time.Duration(0)).Return(nil)
+	mockRedis.EXPECT().CacheShortLink(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	mockBloom.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil)
+
+	svc := NewShortLinkService(mockMySQL, mockRedis, mockBloom, "https://s.example.com")
+	resp, err := svc.Generate(context.Background(), &model.GenerateRequest{URL: "https://example.com", SingleUse: true})
+	require.NoError(t, err)
+	assert.True(t, resp.SingleUse)
+}
+
+func TestShortLinkService_GetUsed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	svc := NewShortLinkService(mockMySQL, mockRedis, mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+
+	mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), gomock.Any()).Return(nil, errors.New("not found")).Times(2)
+	mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", SingleUse: true, MaxClicks: 1}, nil)
+	mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "EFGH").Return(&model.ShortLink{ShortCode: "EFGH", MaxClicks: 1}, nil)
+
+	_, err := svc.Get(context.Background(), "ABCD")
+	assert.ErrorIs(t, err, ErrShortLinkUsed)
+
+	// Links with a click limit of one are expired once used up, not used
+	_, err = svc.Get(context.Background(), "EFGH")
+	assert.ErrorIs(t, err, ErrShortLinkExpired)
+}
+
+func TestShortLinkService_Deactivate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	mockPublisher := mocks.NewMockProducerInterface(ctrl)
+
+	svc := NewShortLinkService(mockMySQL, mockRedis, mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+	svc.SetEventPublisher(mockPublisher)
+
+	t.Run("deactivates and publishes the expiry", func(t *testing.T) {
+		mockMySQL.EXPECT().DeactivateShortLink(gomock.Any(), "ABCD").Return(nil)
+		mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "ABCD").Return(nil)
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{
+			ShortCode:   "ABCD",
+			OriginalURL: "https://example.com",
+			MaxClicks:   3,
+		}, nil)
+		mockPublisher.EXPECT().SendLinkEvent(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msg *mq.LinkEventMessage) error {
+			assert.Equal(t, mq.EventTypeLinkExpired, msg.Type)
+			assert.Equal(t, "ABCD", msg.ShortCode)
+			return nil
+		})
+
+		assert.NoError(t, svc.Deactivate(context.Background(), "ABCD"))
+	})
+
+	t.Run("mysql error", func(t *testing.T) {
+		mockMySQL.EXPECT().DeactivateShortLink(gomock.Any(), "ABCD").Return(errors.New("db error"))
+
+		assert.Error(t, svc.Deactivate(context.Background(), "ABCD"))
+	})
+}
+
+func TestShortLinkService_GetRestoresClickLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+
+	mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(nil, errors.New("not found"))
+	mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{
+		ShortCode:   "ABCD",
+		OriginalURL: "https://example.com",
+		Status:      1,
+		MaxClicks:   3,
+	}, nil)
+	mockRedis.EXPECT().SetClickLimit(gomock.Any(), "ABCD", int64(3), time.Duration(0)).Return(nil)
+	mockRedis.EXPECT().CacheShortLink(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+
+	svc := NewShortLinkService(mockMySQL, mockRedis, mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+	sl, err := svc.Get(context.Background(), "ABCD")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), sl.MaxClicks)
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	soon := now.Add(10 * time.Minute)
+	later := now.Add(48 * time.Hour)
+	past := now.Add(-time.Minute)
+
+	assert.Equal(t, repository.ShortLinkCacheTTL, cacheTTL(nil, now))
+	assert.Equal(t, repository.ShortLinkCacheTTL, cacheTTL(&later, now))
+	assert.Equal(t, 10*time.Minute, cacheTTL(&soon, now))
+	assert.Equal(t, time.Duration(0), cacheTTL(&now, now))
+	assert.LessOrEqual(t, cacheTTL(&past, now), time.Duration(0))
+}
+
+func TestShortLinkService_GenerateNearExpiry(t *testing.T) {
+	newService := func(ctrl *gomock.Controller) (*ShortLinkService, *mocks.MockCache) {
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockRedis := mocks.NewMockCache(ctrl)
+		mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+
+		mockRedis.EXPECT().GetShortLink(gomock.Any(), "https://example.com").Return("", errors.New("not found"))
+		mockMySQL.EXPECT().GetShortLinkByDedupHash(gomock.Any(), dedupHash("https://example.com", nil)).Return(nil, errors.New("not found"))
+		mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
+		mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(false, nil)
+		mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).Return(nil)
+		mockBloom.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil)
+
+		return NewShortLinkService(mockMySQL, mockRedis, mockBloom, "https://s.example.com"), mockRedis
+	}
+
+	t.Run("cached only until the link expires", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc, mockRedis := newService(ctrl)
+		mockRedis.EXPECT().SaveShortLinkPair(gomock.Any(), "https://example.com", gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, _ *model.ShortLink, ttl time.Duration) error {
+				assert.Greater(t, ttl, time.Duration(0))
+				assert.LessOrEqual(t, ttl, 5*time.Minute)
+				return nil
+			})
+
+		expireAt := time.Now().Add(5 * time.Minute).Format(time.RFC3339)
+		_, err := svc.Generate(context.Background(), &model.GenerateRequest{URL: "https://example.com", ExpireAt: expireAt})
+		assert.NoError(t, err)
+	})
+
+	t.Run("already expired links are not cached", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		svc, _ := newService(ctrl)
+
+		expireAt := time.Now().Add(-time.Minute).Format(time.RFC3339)
+		_, err := svc.Generate(context.Background(), &model.GenerateRequest{URL: "https://example.com", ExpireAt: expireAt})
+		assert.NoError(t, err)
+	})
+}
+
+func TestShortLinkService_GetNearExpiry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+
+	expireAt := time.Now().Add(30 * time.Second)
+	mockRedis.EXPECT().GetCachedShortLink(gomock.Any(), "ABCD").Return(nil, errors.New("not found"))
+	mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{
+		ShortCode:   "ABCD",
+		OriginalURL: "https://example.com",
+		Status:      1,
+		ExpireAt:    &expireAt,
+	}, nil)
+	mockRedis.EXPECT().CacheShortLink(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ *model.ShortLink, ttl time.Duration) error {
+			// The cached redirect must not outlive the link
+			assert.Greater(t, ttl, time.Duration(0))
+			assert.LessOrEqual(t, ttl, 30*time.Second)
+			return nil
+		})
+
+	svc := NewShortLinkService(mockMySQL, mockRedis, mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+	_, err := svc.Get(context.Background(), "ABCD")
+	assert.NoError(t, err)
+}
+
+func TestShortLinkService_Resolve(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	svc := NewShortLinkService(mockMySQL, mocks.NewMockCache(ctrl),
+		mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+
+	t.Run("active link", func(t *testing.T) {
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{
+			ShortCode:   "ABCD",
+			OriginalURL: "https://example.com",
+			Params:      []byte(`{"utm_source":"newsletter"}`),
+			Status:      1,
+		}, nil)
+
+		resp, err := svc.Resolve(context.Background(), "ABCD")
+		assert.NoError(t, err)
+		assert.Equal(t, "https://s.example.com/ABCD", resp.ShortLink)
+		assert.Equal(t, "https://example.com", resp.OriginalURL)
+		assert.Equal(t, model.LinkStatusActive, resp.Status)
+		assert.Equal(t, map[string]interface{}{"utm_source": "newsletter"}, resp.Params)
+	})
+
+	t.Run("expired link", func(t *testing.T) {
+		expired := time.Now().Add(-time.Hour)
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{
+			ShortCode:   "ABCD",
+			OriginalURL: "https://example.com",
+			Status:      1,
+			ExpireAt:    &expired,
+		}, nil)
+
+		resp, err := svc.Resolve(context.Background(), "ABCD")
+		assert.NoError(t, err)
+		assert.Equal(t, model.LinkStatusExpired, resp.Status)
+		assert.Equal(t, &expired, resp.ExpireAt)
+	})
+
+	t.Run("disabled link", func(t *testing.T) {
+		// Disabled takes precedence over an expiry passed since
+		expired := time.Now().Add(-time.Hour)
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{
+			ShortCode:   "ABCD",
+			OriginalURL: "https://example.com",
+			Status:      0,
+			ExpireAt:    &expired,
+		}, nil)
+
+		resp, err := svc.Resolve(context.Background(), "ABCD")
+		assert.NoError(t, err)
+		assert.Equal(t, model.LinkStatusDisabled, resp.Status)
+	})
+
+	t.Run("used link", func(t *testing.T) {
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{
+			ShortCode:   "ABCD",
+			OriginalURL: "https://example.com",
+			SingleUse:   true,
+		}, nil)
+
+		resp, err := svc.Resolve(context.Background(), "ABCD")
+		assert.NoError(t, err)
+		assert.Equal(t, model.LinkStatusUsed, resp.Status)
+		assert.True(t, resp.SingleUse)
+	})
+
+	t.Run("unknown link", func(t *testing.T) {
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "NONE").Return(nil, repository.ErrNotFound)
+
+		_, err := svc.Resolve(context.Background(), "NONE")
+		assert.ErrorIs(t, err, ErrShortLinkNotFound)
+	})
+
+	t.Run("storage unavailable", func(t *testing.T) {
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(nil, repository.ErrUnavailable)
+
+		_, err := svc.Resolve(context.Background(), "ABCD")
+		assert.ErrorIs(t, err, repository.ErrUnavailable)
+		assert.NotErrorIs(t, err, ErrShortLinkNotFound)
+	})
+}
+
+func TestShortLinkService_Search(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	svc := NewShortLinkService(mockMySQL, mocks.NewMockCache(ctrl),
+		mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+
+	t.Run("next page", func(t *testing.T) {
+		mockMySQL.EXPECT().SearchShortLinks(gomock.Any(), &model.SearchQuery{Query: "spring", Offset: 2, Limit: 3}).Return([]model.ShortLink{
+			{ShortCode: "A", Status: 1, Title: "Spring sale"},
+			{ShortCode: "B", Status: 1},
+			{ShortCode: "C", Status: 1},
+		}, nil)
+
+		resp, err := svc.Search(context.Background(), &model.SearchQuery{Query: "spring", Offset: 2, Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, "spring", resp.Query)
+		require.Len(t, resp.Links, 2)
+		assert.Equal(t, "Spring sale", resp.Links[0].Title)
+		assert.Equal(t, "https://s.example.com/A", resp.Links[0].ShortLink)
+		assert.Equal(t, 4, resp.NextOffset)
+	})
+
+	t.Run("last page with default limit", func(t *testing.T) {
+		mockMySQL.EXPECT().SearchShortLinks(gomock.Any(), &model.SearchQuery{Query: "spring", Limit: defaultSearchLimit + 1}).Return(nil, nil)
+
+		resp, err := svc.Search(context.Background(), &model.SearchQuery{Query: "spring"})
+		require.NoError(t, err)
+		assert.NotNil(t, resp.Links)
+		assert.Empty(t, resp.Links)
+		assert.Zero(t, resp.NextOffset)
+	})
+
+	t.Run("limit capped", func(t *testing.T) {
+		mockMySQL.EXPECT().SearchShortLinks(gomock.Any(), &model.SearchQuery{Query: "spring", Limit: maxSearchLimit + 1}).Return(nil, nil)
+
+		_, err := svc.Search(context.Background(), &model.SearchQuery{Query: "spring", Limit: 1000})
+		assert.NoError(t, err)
+	})
+}
+
+func TestShortLinkService_BatchGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	svc := NewShortLinkService(mockMySQL, mockRedis, mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+
+	t.Run("cache hits and misses", func(t *testing.T) {
+		// Repeated codes are read once
+		mockRedis.EXPECT().GetCachedShortLinks(gomock.Any(), []string{"ABCD", "EFGH", "IJKL", "WXYZ"}).Return(map[string]*model.ShortLink{
+			"EFGH": {ShortCode: "EFGH", OriginalURL: "https://example.com/e", Status: 1},
+		}, nil)
+		mockMySQL.EXPECT().GetShortLinksByCodes(gomock.Any(), []string{"ABCD", "IJKL", "WXYZ"}).Return([]model.ShortLink{
+			{ShortCode: "IJKL", OriginalURL: "https://example.com/i", Status: 0},
+			{ShortCode: "ABCD", OriginalURL: "https://example.com/a", Status: 1, MaxClicks: 3},
+		}, nil)
+		// Only active links are cached
+		mockRedis.EXPECT().SetClickLimit(gomock.Any(), "ABCD", int64(3), time.Duration(0)).Return(nil)
+		mockRedis.EXPECT().CacheShortLink(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, sl *model.ShortLink, _ time.Duration) error {
+				assert.Equal(t, "ABCD", sl.ShortCode)
+				return nil
+			})
+
+		resp, err := svc.BatchGet(context.Background(), []string{"ABCD", "EFGH", "IJKL", "ABCD", "WXYZ"})
+		require.NoError(t, err)
+		require.Len(t, resp.Links, 3)
+		assert.Equal(t, "https://example.com/a", resp.Links[0].OriginalURL)
+		assert.Equal(t, "https://example.com/e", resp.Links[1].OriginalURL)
+		assert.Equal(t, "IJKL", resp.Links[2].ShortCode)
+		assert.NotEqual(t, model.LinkStatusActive, resp.Links[2].Status)
+		assert.Equal(t, []string{"WXYZ"}, resp.Missing)
+	})
+
+	t.Run("all cached", func(t *testing.T) {
+		mockRedis.EXPECT().GetCachedShortLinks(gomock.Any(), []string{"EFGH"}).Return(map[string]*model.ShortLink{
+			"EFGH": {ShortCode: "EFGH", Status: 1},
+		}, nil)
+
+		resp, err := svc.BatchGet(context.Background(), []string{"EFGH"})
+		require.NoError(t, err)
+		assert.Len(t, resp.Links, 1)
+		assert.Empty(t, resp.Missing)
+	})
+
+	t.Run("cache unavailable", func(t *testing.T) {
+		mockRedis.EXPECT().GetCachedShortLinks(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection refused"))
+		mockMySQL.EXPECT().GetShortLinksByCodes(gomock.Any(), []string{"ABCD"}).Return(nil, nil)
+
+		resp, err := svc.BatchGet(context.Background(), []string{"ABCD"})
+		require.NoError(t, err)
+		assert.Empty(t, resp.Links)
+		assert.Equal(t, []string{"ABCD"}, resp.Missing)
+	})
+
+	t.Run("storage failure", func(t *testing.T) {
+		mockRedis.EXPECT().GetCachedShortLinks(gomock.Any(), gomock.Any()).Return(map[string]*model.ShortLink{}, nil)
+		mockMySQL.EXPECT().GetShortLinksByCodes(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection refused"))
+
+		_, err := svc.BatchGet(context.Background(), []string{"ABCD"})
+		assert.Error(t, err)
+	})
+}
+
+func TestShortLinkService_Update(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	svc := NewShortLinkService(mockMySQL, mockRedis, mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+
+	t.Run("omitted fields are kept", func(t *testing.T) {
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{
+			ShortCode:   "ABCD",
+			OriginalURL: "https://example.com",
+			Status:      1,
+			Title:       "Spring sale",
+			Notes:       "old notes",
+		}, nil)
+		mockMySQL.EXPECT().UpdateShortLinkMetadata(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, sl *model.ShortLink) error {
+			assert.Equal(t, "Spring sale", sl.Title)
+			assert.Equal(t, "Newsletter banner", sl.Description)
+			assert.Empty(t, sl.Notes)
+			return nil
+		})
+		mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "ABCD").Return(nil)
+
+		description, notes := "Newsletter banner", ""
+		resp, err := svc.Update(context.Background(), "ABCD", &model.UpdateRequest{Description: &description, Notes: &notes})
+		require.NoError(t, err)
+		assert.Equal(t, "Spring sale", resp.Title)
+		assert.Equal(t, "Newsletter banner", resp.Description)
+		assert.Empty(t, resp.Notes)
+	})
+
+	t.Run("public stats change is published", func(t *testing.T) {
+		mockPublisher := mocks.NewMockProducerInterface(ctrl)
+		svc.SetEventPublisher(mockPublisher)
+		defer svc.SetEventPublisher(nil)
+
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", Status: 1}, nil).Times(2)
+		mockMySQL.EXPECT().UpdateShortLinkMetadata(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+		mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "ABCD").Return(nil).Times(2)
+		mockPublisher.EXPECT().SendLinkEvent(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msg *mq.LinkEventMessage) error {
+			assert.Equal(t, mq.EventTypeLinkUpdated, msg.Type)
+			assert.True(t, msg.PublicStats)
+			return nil
+		})
+
+		public := true
+		resp, err := svc.Update(context.Background(), "ABCD", &model.UpdateRequest{PublicStats: &public})
+		require.NoError(t, err)
+		assert.True(t, resp.PublicStats)
+
+		// Other metadata stays local to the region
+		title := "Spring sale"
+		_, err = svc.Update(context.Background(), "ABCD", &model.UpdateRequest{Title: &title})
+		require.NoError(t, err)
+	})
+
+	t.Run("tracking change is published", func(t *testing.T) {
+		mockPublisher := mocks.NewMockProducerInterface(ctrl)
+		svc.SetEventPublisher(mockPublisher)
+		defer svc.SetEventPublisher(nil)
+
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", Status: 1}, nil)
+		mockMySQL.EXPECT().UpdateShortLinkMetadata(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, sl *model.ShortLink) error {
+			assert.True(t, sl.NoTracking)
+			return nil
+		})
+		mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "ABCD").Return(nil)
+		mockPublisher.EXPECT().SendLinkEvent(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msg *mq.LinkEventMessage) error {
+			assert.True(t, msg.NoTracking)
+			return nil
+		})
+
+		tracked := false
+		resp, err := svc.Update(context.Background(), "ABCD", &model.UpdateRequest{TrackingEnabled: &tracked})
+		require.NoError(t, err)
+		assert.False(t, resp.TrackingEnabled)
+	})
+
+	t.Run("cache control change is published", func(t *testing.T) {
+		mockPublisher := mocks.NewMockProducerInterface(ctrl)
+		svc.SetEventPublisher(mockPublisher)
+		defer svc.SetEventPublisher(nil)
+
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", Status: 1, CacheControl: "no-store"}, nil)
+		mockMySQL.EXPECT().UpdateShortLinkMetadata(gomock.Any(), gomock.Any()).Return(nil)
+		mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "ABCD").Return(nil)
+		mockPublisher.EXPECT().SendLinkEvent(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msg *mq.LinkEventMessage) error {
+			assert.Equal(t, "public, max-age=300", msg.CacheControl)
+			return nil
+		})
+
+		cacheControl := "public, max-age=300"
+		resp, err := svc.Update(context.Background(), "ABCD", &model.UpdateRequest{CacheControl: &cacheControl})
+		require.NoError(t, err)
+		assert.Equal(t, "public, max-age=300", resp.CacheControl)
+	})
+
+	t.Run("allowed referrers change is published", func(t *testing.T) {
+		mockPublisher := mocks.NewMockProducerInterface(ctrl)
+		svc.SetEventPublisher(mockPublisher)
+		defer svc.SetEventPublisher(nil)
+
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", Status: 1}, nil)
+		mockMySQL.EXPECT().UpdateShortLinkMetadata(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, sl *model.ShortLink) error {
+			assert.Equal(t, "news.example.com", sl.Referrers)
+			return nil
+		})
+		mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "ABCD").Return(nil)
+		mockPublisher.EXPECT().SendLinkEvent(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msg *mq.LinkEventMessage) error {
+			assert.Equal(t, "news.example.com", msg.Referrers)
+			return nil
+		})
+
+		referrers := []string{"News.Example.com"}
+		resp, err := svc.Update(context.Background(), "ABCD", &model.UpdateRequest{AllowedReferrers: &referrers})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"news.example.com"}, resp.AllowedReferrers)
+	})
+
+	t.Run("allowed countries replace blocked ones", func(t *testing.T) {
+		mockPublisher := mocks.NewMockProducerInterface(ctrl)
+		svc.SetEventPublisher(mockPublisher)
+		defer svc.SetEventPublisher(nil)
+
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", Status: 1, GeoDeny: "US"}, nil)
+		mockMySQL.EXPECT().UpdateShortLinkMetadata(gomock.Any(), gomock.Any()).Return(nil)
+		mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "ABCD").Return(nil)
+		mockPublisher.EXPECT().SendLinkEvent(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, msg *mq.LinkEventMessage) error {
+			assert.Equal(t, "FR,BE", msg.GeoAllow)
+			assert.Empty(t, msg.GeoDeny)
+			return nil
+		})
+
+		countries := []string{"fr", "be"}
+		resp, err := svc.Update(context.Background(), "ABCD", &model.UpdateRequest{AllowedCountries: &countries})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"FR", "BE"}, resp.AllowedCountries)
+		assert.Empty(t, resp.BlockedCountries)
+	})
+
+	t.Run("unknown link", func(t *testing.T) {
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "NONE").Return(nil, repository.ErrNotFound)
+
+		_, err := svc.Update(context.Background(), "NONE", &model.UpdateRequest{})
+		assert.ErrorIs(t, err, ErrShortLinkNotFound)
+	})
+
+	t.Run("update fails", func(t *testing.T) {
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD", Status: 1}, nil)
+		mockMySQL.EXPECT().UpdateShortLinkMetadata(gomock.Any(), gomock.Any()).Return(repository.ErrUnavailable)
+
+		_, err := svc.Update(context.Background(), "ABCD", &model.UpdateRequest{})
+		assert.ErrorIs(t, err, repository.ErrUnavailable)
+	})
+}
+
+func TestShortLinkService_Lookup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	svc := NewShortLinkService(mockMySQL, mocks.NewMockCache(ctrl),
+		mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+
+	t.Run("links across params variants", func(t *testing.T) {
+		urlHash, _ := util.URLHash("https://example.com/?a=1")
+		mockMySQL.EXPECT().GetShortLinksByURLHash(gomock.Any(), urlHash).Return([]model.ShortLink{
+			{ShortCode: "ABCD", OriginalURL: "https://example.com/?a=1", Status: 1},
+			{ShortCode: "EFGH", OriginalURL: "https://Example.com?a=1", Params: []byte(`{"utm_source":"mail"}`), Status: 1},
+		}, nil)
+
+		resp, err := svc.Lookup(context.Background(), "HTTPS://example.com?a=1#top")
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com/?a=1", resp.URL)
+		assert.Len(t, resp.Links, 2)
+		assert.Equal(t, "https://s.example.com/EFGH", resp.Links[1].ShortLink)
+	})
+
+	t.Run("no links", func(t *testing.T) {
+		mockMySQL.EXPECT().GetShortLinksByURLHash(gomock.Any(), gomock.Any()).Return(nil, nil)
+
+		resp, err := svc.Lookup(context.Background(), "https://example.com/none")
+		assert.NoError(t, err)
+		assert.NotNil(t, resp.Links)
+		assert.Empty(t, resp.Links)
+	})
+
+	t.Run("invalid url", func(t *testing.T) {
+		_, err := svc.Lookup(context.Background(), "not-a-url")
+		assert.ErrorIs(t, err, ErrInvalidURL)
+	})
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+
+	"octopus/internal/config"
+)
+
+// Errors of signed params
+var (
+	// ErrParamSigningDisabled is returned for links with signed params when no signing key is configured
+	ErrParamSigningDisabled = errors.New("param signing is not configured")
+	// ErrParamsNotSigned is returned when signing params for a link created without signed_params
+	ErrParamsNotSigned = errors.New("short link does not sign its params")
+	// ErrTamperedParams is returned when the params of a request to a link with signed params do
+	// not match their signature
+	ErrTamperedParams = errors.New("params do not match their signature")
+)
+
+// ParamSigner signs the query params appended to short links, so they cannot be changed by the
+// people following them. A signature reads "<key ID>.<HMAC-SHA256>" in unpadded base64url, over the
+// short code and the params sorted by key.
+type ParamSigner struct {
+	param   string
+	keyID   string
+	secrets map[string][]byte
+}
+
+// NewParamSigner creates a ParamSigner signing with the first configured key, nil when signing has
+// no key
+func NewParamSigner(cfg *config.SigningConfig) *ParamSigner {
+	if len(cfg.Keys) == 0 {
+		return nil
+	}
+	secrets := make(map[string][]byte, len(cfg.Keys))
+	for id, secret := range cfg.Secrets() {
+		secrets[id] = []byte(secret)
+	}
+	return &ParamSigner{param: cfg.Param, keyID: cfg.Keys[0].ID, secrets: secrets}
+}
+
+// Param returns the query parameter signatures are sent in
+func (ps *ParamSigner) Param() string {
+	return ps.param
+}
+
+// Sign returns the signature of the params appended to a short link
+func (ps *ParamSigner) Sign(shortCode string, params url.Values) string {
+	return ps.keyID + "." + signature(ps.secrets[ps.keyID], shortCode, params)
+}
+
+// Verify checks the signature carried by the query of a request to a short link and returns the
+// params it signs, without the signature
+func (ps *ParamSigner) Verify(shortCode string, query url.Values) (url.Values, error) {
+	params := make(url.Values, len(query))
+	for key, values := range query {
+		if key != ps.param {
+			params[key] = values
+		}
+	}
+
+	keyID, sig, ok := strings.Cut(query.Get(ps.param), ".")
+	secret, known := ps.secrets[keyID]
+	if !ok || !known || len(query[ps.param]) != 1 {
+		return nil, ErrTamperedParams
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, shortCode, params))) {
+		return nil, ErrTamperedParams
+	}
+	return params, nil
+}
+
+// signature signs the params of a short link with a secret
+func signature(secret []byte, shortCode string, params url.Values) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(shortCode + "?" + params.Encode()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
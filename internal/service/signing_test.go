@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"octopus/internal/config"
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/pkg/middleware"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testSecret1 = strings.Repeat("a", 32)
+	testSecret2 = strings.Repeat("b", 32)
+)
+
+func newTestParamSigner(keys ...config.HMACKeyConfig) *ParamSigner {
+	if len(keys) == 0 {
+		keys = []config.HMACKeyConfig{{ID: "k1", Secret: testSecret1}}
+	}
+	return NewParamSigner(&config.SigningConfig{Param: "sig", Keys: keys})
+}
+
+func TestNewParamSigner(t *testing.T) {
+	assert.Nil(t, NewParamSigner(&config.SigningConfig{Param: "sig"}))
+	assert.Equal(t, "sig", newTestParamSigner().Param())
+}
+
+func TestParamSigner_Verify(t *testing.T) {
+	ps := newTestParamSigner()
+	params := url.Values{"coupon": {"SPRING10"}, "rid": {"42"}}
+	signed := url.Values{"coupon": {"SPRING10"}, "rid": {"42"}, "sig": {ps.Sign("ABCD", params)}}
+
+	t.Run("signed params", func(t *testing.T) {
+		got, err := ps.Verify("ABCD", signed)
+		require.NoError(t, err)
+		assert.Equal(t, params, got)
+	})
+
+	t.Run("tampered value", func(t *testing.T) {
+		query := url.Values{"coupon": {"SPRING90"}, "rid": {"42"}, "sig": signed["sig"]}
+		_, err := ps.Verify("ABCD", query)
+		assert.ErrorIs(t, err, ErrTamperedParams)
+	})
+
+	t.Run("added param", func(t *testing.T) {
+		query := url.Values{"coupon": {"SPRING10"}, "rid": {"42"}, "extra": {"1"}, "sig": signed["sig"]}
+		_, err := ps.Verify("ABCD", query)
+		assert.ErrorIs(t, err, ErrTamperedParams)
+	})
+
+	t.Run("signature of another link", func(t *testing.T) {
+		_, err := ps.Verify("EFGH", signed)
+		assert.ErrorIs(t, err, ErrTamperedParams)
+	})
+
+	t.Run("missing signature", func(t *testing.T) {
+		_, err := ps.Verify("ABCD", params)
+		assert.ErrorIs(t, err, ErrTamperedParams)
+	})
+
+	t.Run("repeated signature", func(t *testing.T) {
+		query := url.Values{"coupon": {"SPRING10"}, "rid": {"42"}, "sig": {signed.Get("sig"), signed.Get("sig")}}
+		_, err := ps.Verify("ABCD", query)
+		assert.ErrorIs(t, err, ErrTamperedParams)
+	})
+
+	t.Run("rotated key", func(t *testing.T) {
+		// Links signed with the previous key keep working once a new key signs
+		rotated := newTestParamSigner(config.HMACKeyConfig{ID: "k2", Secret: testSecret2}, config.HMACKeyConfig{ID: "k1", Secret: testSecret1})
+		got, err := rotated.Verify("ABCD", signed)
+		require.NoError(t, err)
+		assert.Equal(t, params, got)
+		assert.True(t, strings.HasPrefix(rotated.Sign("ABCD", params), "k2."))
+
+		_, err = newTestParamSigner(config.HMACKeyConfig{ID: "k2", Secret: testSecret2}).Verify("ABCD", signed)
+		assert.ErrorIs(t, err, ErrTamperedParams)
+	})
+}
+
+func TestShortLinkService_SignParams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	svc := NewShortLinkService(mockMySQL, mocks.NewMockCache(ctrl), mocks.NewMockBloomServiceInterface(ctrl), "https://s.example.com")
+	signer := newTestParamSigner()
+	svc.SetParamSigner(signer)
+
+	t.Run("signs params", func(t *testing.T) {
+		sl := &model.ShortLink{ShortCode: "ABCD", SignedParams: true}
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(sl, nil)
+
+		resp, err := svc.SignParams(context.Background(), "ABCD", map[string]interface{}{"coupon": "SPRING10", "rid": 42.0, "sig": "forged"})
+		require.NoError(t, err)
+		u, err := url.Parse(resp.ShortLink)
+		require.NoError(t, err)
+		assert.Equal(t, "https://s.example.com/ABCD", u.Scheme+"://"+u.Host+u.Path)
+		assert.Equal(t, resp.Sig, u.Query().Get("sig"))
+
+		params, err := svc.VerifyParams(sl, u.Query())
+		require.NoError(t, err)
+		assert.Equal(t, url.Values{"coupon": {"SPRING10"}, "rid": {"42"}}, params)
+	})
+
+	t.Run("link without signed params", func(t *testing.T) {
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "EFGH").Return(&model.ShortLink{ShortCode: "EFGH"}, nil)
+
+		_, err := svc.SignParams(context.Background(), "EFGH", map[string]interface{}{"coupon": "SPRING10"})
+		assert.ErrorIs(t, err, ErrParamsNotSigned)
+	})
+
+	t.Run("only the owner signs in self-serve mode", func(t *testing.T) {
+		svc.SetClaims(newTestClaims(t, repository.NewMemoryRepository(), fakeTXTResolver{}))
+		defer svc.SetClaims(nil)
+		owner := svc.claims.Owner(middleware.WithAPIKey(context.Background(), "key-1"))
+		sl := &model.ShortLink{ShortCode: "ABCD", SignedParams: true, Owner: owner}
+		mockMySQL.EXPECT().GetShortLinkByCode(gomock.Any(), "ABCD").Return(sl, nil).Times(3)
+		params := map[string]interface{}{"coupon": "SPRING90"}
+
+		_, err := svc.SignParams(context.Background(), "ABCD", params)
+		assert.ErrorIs(t, err, ErrClaimUnauthenticated)
+		_, err = svc.SignParams(middleware.WithAPIKey(context.Background(), "key-2"), "ABCD", params)
+		assert.ErrorIs(t, err, ErrNotOwner)
+		_, err = svc.SignParams(middleware.WithAPIKey(context.Background(), "key-1"), "ABCD", params)
+		assert.NoError(t, err)
+	})
+}
+
+func TestShortLinkService_VerifyParams(t *testing.T) {
+	svc := NewShortLinkService(nil, nil, nil, "https://s.example.com")
+	query := url.Values{"coupon": {"SPRING90"}}
+
+	// Links not signing their params take any
+	params, err := svc.VerifyParams(&model.ShortLink{ShortCode: "ABCD"}, query)
+	require.NoError(t, err)
+	assert.Equal(t, query, params)
+
+	// Without a signer, no param can be trusted
+	_, err = svc.VerifyParams(&model.ShortLink{ShortCode: "ABCD", SignedParams: true}, query)
+	assert.ErrorIs(t, err, ErrTamperedParams)
+
+	// The link alone needs no signature
+	params, err = svc.VerifyParams(&model.ShortLink{ShortCode: "ABCD", SignedParams: true}, url.Values{})
+	require.NoError(t, err)
+	assert.Empty(t, params)
+}
+
+func TestShortLinkService_GenerateSignedParams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+	svc := NewShortLinkService(mockMySQL, mockRedis, mockBloom, "https://s.example.com")
+
+	_, err := svc.Generate(context.Background(), &model.GenerateRequest{URL: "https://example.com", SignedParams: true})
+	assert.ErrorIs(t, err, ErrParamSigningDisabled)
+
+	// Links signing their params are looked up apart from the others and never reuse them
+	svc.SetParamSigner(newTestParamSigner())
+	mockRedis.EXPECT().GetShortLink(gomock.Any(), "signed:https://example.com").Return("", errors.New("not found"))
+	mockMySQL.EXPECT().GetShortLinkByDedupHash(gomock.Any(), dedupHash("https://example.com", nil)).Return(&model.ShortLink{ShortCode: "OPEN", Status: 1}, nil)
+	mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockMySQL.EXPECT().SaveShortLink(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, sl *model.ShortLink) error {
+		assert.True(t, sl.SignedParams)
+		return nil
+	})
+	mockRedis.EXPECT().SaveShortLinkPair(gomock.Any(), "signed:https://example.com", gomock.Any(), gomock.Any()).Return(nil)
+	mockBloom.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil)
+
+	resp, err := svc.Generate(context.Background(), &model.GenerateRequest{URL: "https://example.com", SignedParams: true})
+	require.NoError(t, err)
+	assert.NotEqual(t, "OPEN", resp.ShortCode)
+	assert.True(t, resp.SignedParams)
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/encoder"
+	"octopus/internal/model"
+	"octopus/internal/mq"
+	"octopus/internal/repository"
+	"octopus/internal/storage"
+	"octopus/pkg/clock"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrSMSPoolDisabled is returned when an SMS link is requested but the SMS pool is not enabled
+	ErrSMSPoolDisabled = errors.New("SMS code pool is not enabled")
+	// ErrSMSPoolExhausted is returned when all codes of the SMS pool are in use
+	ErrSMSPoolExhausted = errors.New("SMS code pool exhausted")
+)
+
+// smsRecycleBatchSize is the number of expired links recycled per pass
+const smsRecycleBatchSize = 500
+
+// SMSPoolService allocates ultra-short codes from a reserved pool served on a dedicated domain
+type SMSPoolService struct {
+	encoder    *encoder.Base32Encoder
+	mysqlRepo  storage.LinkStore
+	redisRepo  storage.Cache
+	bloomSvc   BloomServiceInterface
+	domain     string
+	codeLength int
+	capacity   int64
+	defaultTTL time.Duration
+	linkEvents
+}
+
+// NewSMSPoolService creates a new SMS Pool Service
+func NewSMSPoolService(
+	mysqlRepo storage.LinkStore,
+	redisRepo storage.Cache,
+	bloomSvc BloomServiceInterface,
+	cfg *config.SMSConfig,
+) *SMSPoolService {
+	enc := encoder.NewBase32Encoder()
+
+	codeLength := cfg.CodeLength
+	if codeLength < encoder.MinLength || codeLength >= encoder.MaxLength {
+		codeLength = encoder.MinLength
+	}
+
+	// Capacity can never exceed the code space of the configured length
+	capacity := cfg.Capacity
+	if space := int64(enc.MaxCapacity(codeLength)); capacity <= 0 || capacity > space {
+		capacity = space
+	}
+
+	return &SMSPoolService{
+		encoder:    enc,
+		mysqlRepo:  mysqlRepo,
+		redisRepo:  redisRepo,
+		bloomSvc:   bloomSvc,
+		domain:     cfg.Domain,
+		codeLength: codeLength,
+		capacity:   capacity,
+		defaultTTL: cfg.DefaultTTL,
+		linkEvents: linkEvents{clock: clock.Real},
+	}
+}
+
+// SetEncoder replaces the default Base32 encoder, e.g. with one using a custom alphabet
+func (ps *SMSPoolService) SetEncoder(enc *encoder.Base32Encoder) {
+	ps.encoder = enc
+}
+
+// Domain returns the dedicated domain of the SMS pool
+func (ps *SMSPoolService) Domain() string {
+	return ps.domain
+}
+
+// Host returns the host name of the SMS pool domain
+func (ps *SMSPoolService) Host() string {
+	u, err := url.Parse(ps.domain)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// CodeLength returns the length of codes in the SMS pool
+func (ps *SMSPoolService) CodeLength() int {
+	return ps.codeLength
+}
+
+// DefaultTTL returns the lifetime applied to SMS links created without expire_at
+func (ps *SMSPoolService) DefaultTTL() time.Duration {
+	return ps.defaultTTL
+}
+
+// Allocate reserves a code from the SMS pool, preferring recycled codes
+func (ps *SMSPoolService) Allocate(ctx context.Context, originalURL string) (string, error) {
+	reserved, err := ps.redisRepo.ReserveCapacity(ctx, model.PoolSMS, ps.capacity)
+	if err != nil {
+		return "", fmt.Errorf("failed to reserve SMS pool capacity: %w", err)
+	}
+	if !reserved {
+		return "", ErrSMSPoolExhausted
+	}
+
+	// Recycled codes are known to be free, no need to consult the Bloom Filter
+	if shortCode, err := ps.redisRepo.PopFreeCode(ctx, model.PoolSMS); err == nil && shortCode != "" {
+		return shortCode, nil
+	} else if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		log.Warn().Err(err).Msg("Failed to pop recycled SMS code")
+	}
+
+	hash := hashString(originalURL)
+	for i := 0; i < 1000; i++ {
+		shortCode := ps.encoder.Encode(hash+uint64(i), ps.codeLength)
+
+		exists, err := ps.bloomSvc.Exists(ctx, shortCode)
+		if err != nil || !exists {
+			actualExists, _ := ps.mysqlRepo.CheckExistsByCode(ctx, shortCode)
+			if !actualExists {
+				return shortCode, nil
+			}
+		}
+	}
+
+	if err := ps.redisRepo.ReleaseCapacity(ctx, model.PoolSMS); err != nil {
+		log.Warn().Err(err).Msg("Failed to release SMS pool capacity")
+	}
+	return "", ErrSMSPoolExhausted
+}
+
+// Confirm marks an allocated code as persisted
+func (ps *SMSPoolService) Confirm(ctx context.Context, shortCode string) error {
+	return ps.bloomSvc.Add(ctx, shortCode)
+}
+
+// Release returns a code to the SMS pool
+func (ps *SMSPoolService) Release(ctx context.Context, shortCode string) error {
+	if err := ps.redisRepo.PushFreeCode(ctx, model.PoolSMS, shortCode); err != nil {
+		return err
+	}
+	return ps.redisRepo.ReleaseCapacity(ctx, model.PoolSMS)
+}
+
+// Usage returns the capacity accounting of the SMS pool
+func (ps *SMSPoolService) Usage(ctx context.Context) (*model.PoolUsage, error) {
+	used, err := ps.redisRepo.GetPoolUsage(ctx, model.PoolSMS)
+	if err != nil {
+		return nil, err
+	}
+
+	free, err := ps.redisRepo.CountFreeCodes(ctx, model.PoolSMS)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.PoolUsage{
+		Pool:     model.PoolSMS,
+		Used:     used,
+		Free:     free,
+		Capacity: ps.capacity,
+	}, nil
+}
+
+// RecycleExpired deletes expired SMS links and returns their codes to the pool without quarantine
+func (ps *SMSPoolService) RecycleExpired(ctx context.Context) (int, error) {
+	links, err := ps.mysqlRepo.GetExpiredLinksByPool(ctx, model.PoolSMS, ps.clock.Now(), smsRecycleBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	recycled := 0
+	for _, sl := range links {
+		if err := ps.mysqlRepo.DeleteShortLinkByCode(ctx, sl.ShortCode); err != nil {
+			log.Error().Err(err).Str("short_code", sl.ShortCode).Msg("Failed to delete expired SMS link")
+			continue
+		}
+
+		// Purge the cached redirect so the code cannot resolve to the old URL
+		if err := ps.redisRepo.DeleteShortLink(ctx, sl.ShortCode); err != nil {
+			log.Warn().Err(err).Str("short_code", sl.ShortCode).Msg("Failed to purge expired SMS link from cache")
+		}
+		if err := ps.bloomSvc.Delete(ctx, sl.ShortCode); err != nil {
+			log.Warn().Err(err).Str("short_code", sl.ShortCode).Msg("Failed to purge expired SMS link from filter")
+		}
+		ps.publishLinkEvent(ctx, mq.EventTypeLinkExpired, &sl)
+
+		if err := ps.Release(ctx, sl.ShortCode); err != nil {
+			log.Error().Err(err).Str("short_code", sl.ShortCode).Msg("Failed to release SMS code")
+			continue
+		}
+		recycled++
+	}
+
+	return recycled, nil
+}
+
+// Run recycles expired SMS codes periodically until the context is canceled
+func (ps *SMSPoolService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			recycled, err := ps.RecycleExpired(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to recycle expired SMS codes")
+				continue
+			}
+			if recycled > 0 {
+				log.Info().Int("recycled", recycled).Msg("Recycled expired SMS codes")
+			}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"octopus/internal/mocks"
+)
+
+func newTestSMSConfig() *config.SMSConfig {
+	return &config.SMSConfig{
+		Enabled:    true,
+		Domain:     "https://s.ms",
+		CodeLength: 4,
+		Capacity:   100,
+		DefaultTTL: time.Hour,
+	}
+}
+
+func TestNewSMSPoolService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	t.Run("uses configured values", func(t *testing.T) {
+		svc := NewSMSPoolService(nil, nil, nil, newTestSMSConfig())
+
+		assert.Equal(t, "https://s.ms", svc.Domain())
+		assert.Equal(t, "s.ms", svc.Host())
+		assert.Equal(t, 4, svc.CodeLength())
+		assert.Equal(t, time.Hour, svc.DefaultTTL())
+		assert.Equal(t, int64(100), svc.capacity)
+	})
+
+	t.Run("capacity is capped at the code space", func(t *testing.T) {
+		cfg := newTestSMSConfig()
+		cfg.Capacity = 0
+		svc := NewSMSPoolService(nil, nil, nil, cfg)
+		assert.Equal(t, int64(1048576), svc.capacity)
+
+		cfg.Capacity = 1 << 40
+		svc = NewSMSPoolService(nil, nil, nil, cfg)
+		assert.Equal(t, int64(1048576), svc.capacity)
+	})
+
+	t.Run("invalid code length falls back to minimum", func(t *testing.T) {
+		cfg := newTestSMSConfig()
+		cfg.CodeLength = 6
+		svc := NewSMSPoolService(nil, nil, nil, cfg)
+		assert.Equal(t, 4, svc.CodeLength())
+	})
+}
+
+func TestSMSPoolService_Allocate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("pool exhausted", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRedis := mocks.NewMockCache(ctrl)
+		mockRedis.EXPECT().ReserveCapacity(gomock.Any(), model.PoolSMS, int64(100)).Return(false, nil)
+
+		svc := NewSMSPoolService(nil, mockRedis, nil, newTestSMSConfig())
+		_, err := svc.Allocate(ctx, "https://example.com")
+		assert.ErrorIs(t, err, ErrSMSPoolExhausted)
+	})
+
+	t.Run("reservation error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRedis := mocks.NewMockCache(ctrl)
+		mockRedis.EXPECT().ReserveCapacity(gomock.Any(), model.PoolSMS, int64(100)).Return(false, errors.New("redis down"))
+
+		svc := NewSMSPoolService(nil, mockRedis, nil, newTestSMSConfig())
+		_, err := svc.Allocate(ctx, "https://example.com")
+		assert.Error(t, err)
+	})
+
+	t.Run("recycled code is preferred", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRedis := mocks.NewMockCache(ctrl)
+		mockRedis.EXPECT().ReserveCapacity(gomock.Any(), model.PoolSMS, int64(100)).Return(true, nil)
+		mockRedis.EXPECT().PopFreeCode(gomock.Any(), model.PoolSMS).Return("WXYZ", nil)
+
+		svc := NewSMSPoolService(nil, mockRedis, nil, newTestSMSConfig())
+		code, err := svc.Allocate(ctx, "https://example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, "WXYZ", code)
+	})
+
+	t.Run("hashes a fresh code when nothing was recycled", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockRedis := mocks.NewMockCache(ctrl)
+		mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+		mockRedis.EXPECT().ReserveCapacity(gomock.Any(), model.PoolSMS, int64(100)).Return(true, nil)
+		mockRedis.EXPECT().PopFreeCode(gomock.Any(), model.PoolSMS).Return("", repository.ErrNotFound)
+		mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
+		mockMySQL.EXPECT().CheckExistsByCode(gomock.Any(), gomock.Any()).Return(false, nil)
+
+		svc := NewSMSPoolService(mockMySQL, mockRedis, mockBloom, newTestSMSConfig())
+		code, err := svc.Allocate(ctx, "https://example.com")
+		assert.NoError(t, err)
+		assert.Len(t, code, 4)
+	})
+
+	t.Run("releases the reservation when no code is free", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockMySQL := mocks.NewMockDatabase(ctrl)
+		mockRedis := mocks.NewMockCache(ctrl)
+		mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+		mockRedis.EXPECT().ReserveCapacity(gomock.Any(), model.PoolSMS, int64(100)).Return(true, nil)
+		mockRedis.EXPECT().PopFreeCode(gomock.Any(), model.PoolSMS).Return("", repository.ErrNotFound)
+		mockBloom.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(true, nil).Times(1000)
+		mockRedis.EXPECT().ReleaseCapacity(gomock.Any(), model.PoolSMS).Return(nil)
+
+		svc := NewSMSPoolService(mockMySQL, mockRedis, mockBloom, newTestSMSConfig())
+		_, err := svc.Allocate(ctx, "https://example.com")
+		assert.ErrorIs(t, err, ErrSMSPoolExhausted)
+	})
+}
+
+func TestSMSPoolService_Release(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRedis := mocks.NewMockCache(ctrl)
+	gomock.InOrder(
+		mockRedis.EXPECT().PushFreeCode(gomock.Any(), model.PoolSMS, "ABCD").Return(nil),
+		mockRedis.EXPECT().ReleaseCapacity(gomock.Any(), model.PoolSMS).Return(nil),
+	)
+
+	svc := NewSMSPoolService(nil, mockRedis, nil, newTestSMSConfig())
+	assert.NoError(t, svc.Release(context.Background(), "ABCD"))
+}
+
+func TestSMSPoolService_Usage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRedis := mocks.NewMockCache(ctrl)
+	mockRedis.EXPECT().GetPoolUsage(gomock.Any(), model.PoolSMS).Return(int64(42), nil)
+	mockRedis.EXPECT().CountFreeCodes(gomock.Any(), model.PoolSMS).Return(int64(3), nil)
+
+	svc := NewSMSPoolService(nil, mockRedis, nil, newTestSMSConfig())
+	usage, err := svc.Usage(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, &model.PoolUsage{Pool: model.PoolSMS, Used: 42, Free: 3, Capacity: 100}, usage)
+}
+
+func TestSMSPoolService_RecycleExpired(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMySQL := mocks.NewMockDatabase(ctrl)
+	mockRedis := mocks.NewMockCache(ctrl)
+	mockBloom := mocks.NewMockBloomServiceInterface(ctrl)
+
+	mockMySQL.EXPECT().GetExpiredLinksByPool(gomock.Any(), model.PoolSMS, gomock.Any(), smsRecycleBatchSize).Return([]model.ShortLink{
+		{ShortCode: "AAAA", Pool: model.PoolSMS},
+		{ShortCode: "BBBB", Pool: model.PoolSMS},
+	}, nil)
+	mockMySQL.EXPECT().DeleteShortLinkByCode(gomock.Any(), "AAAA").Return(nil)
+	mockMySQL.EXPECT().DeleteShortLinkByCode(gomock.Any(), "BBBB").Return(errors.New("db error"))
+	mockRedis.EXPECT().DeleteShortLink(gomock.Any(), "AAAA").Return(nil)
+	mockBloom.EXPECT().Delete(gomock.Any(), "AAAA").Return(nil)
+	mockRedis.EXPECT().PushFreeCode(gomock.Any(), model.PoolSMS, "AAAA").Return(nil)
+	mockRedis.EXPECT().ReleaseCapacity(gomock.Any(), model.PoolSMS).Return(nil)
+
+	svc := NewSMSPoolService(mockMySQL, mockRedis, mockBloom, newTestSMSConfig())
+	recycled, err := svc.RecycleExpired(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, recycled)
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/pkg/clock"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// analyticsSnapshot is a copy of the analytics of a short link and when it stops being served
+type analyticsSnapshot struct {
+	analytics *model.AnalyticsResponse
+	expireAt  time.Time
+}
+
+// AnalyticsSnapshots is a per-instance cache of analytics responses. Dashboards polling many links
+// every few seconds are served copies at most ttl plus jitter old, and concurrent misses of a link
+// share a single Redis read instead of stampeding it.
+type AnalyticsSnapshots struct {
+	ttl        time.Duration
+	jitter     time.Duration
+	maxEntries int
+	clock      clock.Clock
+	mu         sync.Mutex
+	entries    map[string]analyticsSnapshot
+	loads      singleflight.Group
+}
+
+// NewAnalyticsSnapshots creates a new analytics snapshot cache
+func NewAnalyticsSnapshots(cfg *config.SnapshotConfig) *AnalyticsSnapshots {
+	maxEntries := cfg.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+
+	return &AnalyticsSnapshots{
+		ttl:        cfg.TTL,
+		jitter:     cfg.Jitter,
+		maxEntries: maxEntries,
+		clock:      clock.Real,
+		entries:    make(map[string]analyticsSnapshot),
+	}
+}
+
+// Load returns the snapshot of a short link, loading it when missing or expired. The load runs
+// detached from the caller's cancellation, as other requests may be waiting for it.
+func (s *AnalyticsSnapshots) Load(ctx context.Context, shortCode string,
+	load func(context.Context, string) (*model.AnalyticsResponse, error)) (*model.AnalyticsResponse, error) {
+	if analytics, ok := s.get(shortCode); ok {
+		return analytics, nil
+	}
+
+	v, err, _ := s.loads.Do(shortCode, func() (interface{}, error) {
+		// A load finishing just before this one started may have stored it already
+		if analytics, ok := s.get(shortCode); ok {
+			return analytics, nil
+		}
+		analytics, err := load(context.WithoutCancel(ctx), shortCode)
+		if err != nil {
+			return nil, err
+		}
+		s.Store(shortCode, analytics)
+		return analytics, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*model.AnalyticsResponse), nil
+}
+
+// Store replaces the snapshot of a short link
+func (s *AnalyticsSnapshots) Store(shortCode string, analytics *model.AnalyticsResponse) {
+	lifetime := s.ttl
+	if s.jitter > 0 {
+		lifetime += rand.N(s.jitter)
+	}
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[shortCode]; !ok && len(s.entries) >= s.maxEntries {
+		s.evict(now)
+	}
+	s.entries[shortCode] = analyticsSnapshot{analytics: analytics, expireAt: now.Add(lifetime)}
+}
+
+// get returns the snapshot of a short link unless it expired
+func (s *AnalyticsSnapshots) get(shortCode string) (*model.AnalyticsResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot, ok := s.entries[shortCode]
+	if !ok || !s.clock.Now().Before(snapshot.expireAt) {
+		return nil, false
+	}
+	return snapshot.analytics, true
+}
+
+// evict makes room for a snapshot, dropping expired ones or else an arbitrary one
+func (s *AnalyticsSnapshots) evict(now time.Time) {
+	for shortCode, snapshot := range s.entries {
+		if !now.Before(snapshot.expireAt) {
+			delete(s.entries, shortCode)
+		}
+	}
+	if len(s.entries) < s.maxEntries {
+		return
+	}
+	for shortCode := range s.entries {
+		delete(s.entries, shortCode)
+		return
+	}
+}
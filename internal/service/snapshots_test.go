@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/pkg/clock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSnapshots(ttl time.Duration, maxEntries int) (*AnalyticsSnapshots, *clock.Fake) {
+	now := clock.NewFake(time.Unix(1700000000, 0))
+	s := NewAnalyticsSnapshots(&config.SnapshotConfig{TTL: ttl, MaxEntries: maxEntries})
+	s.clock = now
+	return s, now
+}
+
+func TestAnalyticsSnapshots_Load(t *testing.T) {
+	s, now := newTestSnapshots(5*time.Second, 10)
+
+	var loads int64
+	load := func(ctx context.Context, shortCode string) (*model.AnalyticsResponse, error) {
+		n := atomic.AddInt64(&loads, 1)
+		return &model.AnalyticsResponse{ShortCode: shortCode, PV: n}, nil
+	}
+
+	result, err := s.Load(context.Background(), "ABCD", load)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.PV)
+
+	now.Advance(4 * time.Second)
+	result, err = s.Load(context.Background(), "ABCD", load)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.PV, "served from the snapshot within the TTL")
+
+	now.Advance(time.Second)
+	result, err = s.Load(context.Background(), "ABCD", load)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), result.PV, "loaded again once expired")
+}
+
+func TestAnalyticsSnapshots_LoadError(t *testing.T) {
+	s, _ := newTestSnapshots(5*time.Second, 10)
+
+	_, err := s.Load(context.Background(), "ABCD", func(ctx context.Context, shortCode string) (*model.AnalyticsResponse, error) {
+		return nil, errors.New("redis error")
+	})
+	assert.Error(t, err)
+
+	// Failures are not cached
+	result, err := s.Load(context.Background(), "ABCD", func(ctx context.Context, shortCode string) (*model.AnalyticsResponse, error) {
+		return &model.AnalyticsResponse{ShortCode: shortCode}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "ABCD", result.ShortCode)
+}
+
+func TestAnalyticsSnapshots_LoadCoalesces(t *testing.T) {
+	s, _ := newTestSnapshots(5*time.Second, 10)
+
+	var loads int64
+	release := make(chan struct{})
+	load := func(ctx context.Context, shortCode string) (*model.AnalyticsResponse, error) {
+		atomic.AddInt64(&loads, 1)
+		<-release
+		return &model.AnalyticsResponse{ShortCode: shortCode}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := s.Load(context.Background(), "ABCD", load)
+			assert.NoError(t, err)
+			assert.Equal(t, "ABCD", result.ShortCode)
+		}()
+	}
+
+	// Let the callers pile up on the pending load before it finishes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int64(1), atomic.LoadInt64(&loads))
+}
+
+func TestAnalyticsSnapshots_Store(t *testing.T) {
+	t.Run("jitter stays within bounds", func(t *testing.T) {
+		s, now := newTestSnapshots(5*time.Second, 10)
+		s.jitter = time.Second
+
+		for i := 0; i < 100; i++ {
+			s.Store("ABCD", &model.AnalyticsResponse{})
+			expireAt := s.entries["ABCD"].expireAt
+			assert.False(t, expireAt.Before(now.Now().Add(5*time.Second)))
+			assert.True(t, expireAt.Before(now.Now().Add(6*time.Second)))
+		}
+	})
+
+	t.Run("evicts expired snapshots first", func(t *testing.T) {
+		s, now := newTestSnapshots(5*time.Second, 2)
+
+		s.Store("OLD", &model.AnalyticsResponse{})
+		now.Advance(3 * time.Second)
+		s.Store("ABCD", &model.AnalyticsResponse{})
+		now.Advance(3 * time.Second)
+		s.Store("XYZ", &model.AnalyticsResponse{})
+
+		assert.Len(t, s.entries, 2)
+		assert.NotContains(t, s.entries, "OLD")
+		assert.Contains(t, s.entries, "ABCD")
+	})
+
+	t.Run("stays bounded without expired snapshots", func(t *testing.T) {
+		s, _ := newTestSnapshots(5*time.Second, 2)
+
+		s.Store("ABCD", &model.AnalyticsResponse{})
+		s.Store("EFGH", &model.AnalyticsResponse{})
+		s.Store("XYZ", &model.AnalyticsResponse{})
+
+		assert.Len(t, s.entries, 2)
+		assert.Contains(t, s.entries, "XYZ")
+	})
+}
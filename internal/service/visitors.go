@@ -0,0 +1,101 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"octopus/internal/config"
+	"octopus/pkg/util"
+)
+
+// Visitor is the visitor of a redirect, as counted in the unique visitors
+type Visitor struct {
+	// ID is what the visitor is counted under, at most 64 bytes
+	ID string
+	// Strategy is the strategy that identified the visitor, recorded with the access log
+	Strategy string
+}
+
+// VisitorIdentity identifies the visitors of redirects with the configured strategy
+type VisitorIdentity struct {
+	strategy string
+	header   string
+	cookie   config.VisitorCookieConfig
+}
+
+// NewVisitorIdentity creates a VisitorIdentity, identifying visitors by IP without a strategy
+func NewVisitorIdentity(cfg *config.VisitorConfig) *VisitorIdentity {
+	strategy := cfg.Strategy
+	if strategy == "" {
+		strategy = config.VisitorStrategyIP
+	}
+	return &VisitorIdentity{
+		strategy: strategy,
+		header:   cfg.Header,
+		cookie:   cfg.Cookie,
+	}
+}
+
+// Identify returns the visitor of a request from clientIP, and the cookie to set when the visitor
+// was given a new ID
+func (vi *VisitorIdentity) Identify(r *http.Request, clientIP string) (Visitor, *http.Cookie) {
+	switch vi.strategy {
+	case config.VisitorStrategyIPUserAgent:
+		return byIPUserAgent(clientIP, r.UserAgent()), nil
+	case config.VisitorStrategyHeader:
+		// Header values may carry account IDs or emails, only their hash is kept
+		if id := strings.TrimSpace(r.Header.Get(vi.header)); id != "" {
+			return Visitor{ID: hashVisitorID(id, 32), Strategy: config.VisitorStrategyHeader}, nil
+		}
+	case config.VisitorStrategyCookie:
+		if r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1" {
+			return byIPUserAgent(clientIP, r.UserAgent()), nil
+		}
+		if cookie, err := r.Cookie(vi.cookie.Name); err == nil && validVisitorID(cookie.Value) {
+			return Visitor{ID: cookie.Value, Strategy: config.VisitorStrategyCookie}, nil
+		}
+		id := strings.ReplaceAll(util.GenerateUUID(), "-", "")
+		return Visitor{ID: id, Strategy: config.VisitorStrategyCookie}, vi.visitorCookie(id)
+	}
+	return Visitor{ID: clientIP, Strategy: config.VisitorStrategyIP}, nil
+}
+
+// visitorCookie builds the first-party cookie carrying the ID of a visitor
+func (vi *VisitorIdentity) visitorCookie(id string) *http.Cookie {
+	return &http.Cookie{
+		Name:     vi.cookie.Name,
+		Value:    id,
+		Domain:   vi.cookie.Domain,
+		Path:     "/",
+		MaxAge:   int(vi.cookie.MaxAge.Seconds()),
+		Secure:   vi.cookie.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// byIPUserAgent identifies a visitor by IP and a hash of its User-Agent
+func byIPUserAgent(clientIP, userAgent string) Visitor {
+	return Visitor{ID: clientIP + "/" + hashVisitorID(userAgent, 16), Strategy: config.VisitorStrategyIPUserAgent}
+}
+
+// hashVisitorID returns the first n hex digits of the SHA-256 of a value
+func hashVisitorID(value string, n int) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])[:n]
+}
+
+// validVisitorID checks if a cookie value has the shape of a generated visitor ID
+func validVisitorID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
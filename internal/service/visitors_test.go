@@ -0,0 +1,85 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"octopus/internal/config"
+)
+
+func TestVisitorIdentity_Identify(t *testing.T) {
+	newRequest := func(header map[string]string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/ABCD", nil)
+		r.Header.Set("User-Agent", "Mozilla/5.0")
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		return r
+	}
+	cookieCfg := config.VisitorCookieConfig{Name: "octo_vid", MaxAge: 24 * time.Hour}
+
+	t.Run("ip by default", func(t *testing.T) {
+		visitor, cookie := NewVisitorIdentity(&config.VisitorConfig{}).Identify(newRequest(nil), "10.0.0.1")
+		assert.Equal(t, Visitor{ID: "10.0.0.1", Strategy: config.VisitorStrategyIP}, visitor)
+		assert.Nil(t, cookie)
+	})
+
+	t.Run("ip and user agent", func(t *testing.T) {
+		vi := NewVisitorIdentity(&config.VisitorConfig{Strategy: config.VisitorStrategyIPUserAgent})
+		visitor, _ := vi.Identify(newRequest(nil), "10.0.0.1")
+		assert.Equal(t, config.VisitorStrategyIPUserAgent, visitor.Strategy)
+		assert.Regexp(t, `^10\.0\.0\.1/[0-9a-f]{16}$`, visitor.ID)
+
+		other, _ := vi.Identify(newRequest(map[string]string{"User-Agent": "curl/8.0"}), "10.0.0.1")
+		assert.NotEqual(t, visitor.ID, other.ID)
+	})
+
+	t.Run("header", func(t *testing.T) {
+		vi := NewVisitorIdentity(&config.VisitorConfig{Strategy: config.VisitorStrategyHeader, Header: "X-Visitor-ID"})
+		visitor, _ := vi.Identify(newRequest(map[string]string{"X-Visitor-ID": "jane@example.com"}), "10.0.0.1")
+		assert.Equal(t, config.VisitorStrategyHeader, visitor.Strategy)
+		assert.Len(t, visitor.ID, 32)
+		assert.NotContains(t, visitor.ID, "jane")
+
+		// Requests without the header fall back to their IP
+		visitor, _ = vi.Identify(newRequest(nil), "10.0.0.1")
+		assert.Equal(t, Visitor{ID: "10.0.0.1", Strategy: config.VisitorStrategyIP}, visitor)
+	})
+
+	t.Run("cookie", func(t *testing.T) {
+		vi := NewVisitorIdentity(&config.VisitorConfig{Strategy: config.VisitorStrategyCookie, Cookie: cookieCfg})
+
+		// New visitors get an ID in a cookie
+		visitor, cookie := vi.Identify(newRequest(nil), "10.0.0.1")
+		assert.Equal(t, config.VisitorStrategyCookie, visitor.Strategy)
+		require.NotNil(t, cookie)
+		assert.Equal(t, "octo_vid", cookie.Name)
+		assert.Equal(t, visitor.ID, cookie.Value)
+		assert.Equal(t, 86400, cookie.MaxAge)
+		assert.True(t, cookie.HttpOnly)
+
+		// Returning visitors keep theirs
+		r := newRequest(nil)
+		r.AddCookie(cookie)
+		returning, cookie := vi.Identify(r, "10.0.0.2")
+		assert.Equal(t, visitor, returning)
+		assert.Nil(t, cookie)
+
+		// Malformed cookies are replaced
+		r = newRequest(nil)
+		r.AddCookie(&http.Cookie{Name: "octo_vid", Value: "forged"})
+		replaced, cookie := vi.Identify(r, "10.0.0.1")
+		assert.NotEqual(t, "forged", replaced.ID)
+		assert.NotNil(t, cookie)
+
+		// Visitors opting out of tracking get no cookie
+		visitor, cookie = vi.Identify(newRequest(map[string]string{"Sec-GPC": "1"}), "10.0.0.1")
+		assert.Equal(t, config.VisitorStrategyIPUserAgent, visitor.Strategy)
+		assert.Nil(t, cookie)
+	})
+}
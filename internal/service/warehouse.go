@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/internal/mq"
+	"octopus/pkg/async"
+	"octopus/pkg/clock"
+	"octopus/pkg/warehouse"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Columns of the tables access events and link mutations are streamed to
+var (
+	accessEventColumns = []warehouse.Column{
+		{Name: "event_id", Type: warehouse.TypeString},
+		{Name: "short_code", Type: warehouse.TypeString},
+		{Name: "access_time", Type: warehouse.TypeTimestamp},
+		{Name: "client_ip", Type: warehouse.TypeString},
+		{Name: "user_agent", Type: warehouse.TypeString},
+		{Name: "referer", Type: warehouse.TypeString},
+		{Name: "source", Type: warehouse.TypeString},
+		{Name: "device", Type: warehouse.TypeString},
+		{Name: "click_id", Type: warehouse.TypeString},
+		{Name: "edge", Type: warehouse.TypeString},
+	}
+	linkEventColumns = []warehouse.Column{
+		{Name: "event_id", Type: warehouse.TypeString},
+		{Name: "type", Type: warehouse.TypeString},
+		{Name: "short_code", Type: warehouse.TypeString},
+		{Name: "occurred_at", Type: warehouse.TypeTimestamp},
+		{Name: "original_url", Type: warehouse.TypeString},
+		{Name: "pool", Type: warehouse.TypeString},
+		{Name: "expire_at", Type: warehouse.TypeTimestamp},
+		{Name: "region", Type: warehouse.TypeString},
+		{Name: "max_clicks", Type: warehouse.TypeInteger},
+		{Name: "no_click_id", Type: warehouse.TypeBoolean},
+		{Name: "preserve_query", Type: warehouse.TypeBoolean},
+		{Name: "public_stats", Type: warehouse.TypeBoolean},
+		{Name: "no_tracking", Type: warehouse.TypeBoolean},
+		{Name: "cache_control", Type: warehouse.TypeString},
+		{Name: "signed_params", Type: warehouse.TypeBoolean},
+		{Name: "single_use", Type: warehouse.TypeBoolean},
+		{Name: "referrers", Type: warehouse.TypeString},
+		{Name: "geo_allow", Type: warehouse.TypeString},
+		{Name: "geo_deny", Type: warehouse.TypeString},
+		{Name: "schedule", Type: warehouse.TypeString},
+	}
+)
+
+// WarehouseService streams the stored access events and the link mutations to data warehouses.
+// Every destination buffers its rows and inserts them in the background, so a slow or unavailable
+// warehouse never holds up redirects, link changes or the other destinations.
+type WarehouseService struct {
+	destinations []*warehouseDestination
+}
+
+// warehouseRow is a buffered row along with the table it goes to
+type warehouseRow struct {
+	table *warehouse.Table
+	row   warehouse.Row
+}
+
+// warehouseDestination buffers the rows of a warehouse and inserts them in batches
+type warehouseDestination struct {
+	cfg      *config.WarehouseDestinationConfig
+	writer   warehouse.Writer
+	access   *warehouse.Table
+	links    *warehouse.Table
+	clock    clock.Clock
+	mu       sync.Mutex
+	pending  []warehouseRow
+	flushing sync.Mutex
+	ensured  map[string]bool
+	full     chan struct{}
+	inserted atomic.Int64
+	failed   atomic.Int64
+	dropped  atomic.Int64
+	last     time.Time
+	lastErr  string
+}
+
+// NewWarehouseService creates a new Warehouse Service without destinations
+func NewWarehouseService() *WarehouseService {
+	return &WarehouseService{}
+}
+
+// AddDestination streams the events of the configured streams to a warehouse through writer
+func (ws *WarehouseService) AddDestination(cfg *config.WarehouseDestinationConfig, writer warehouse.Writer) {
+	ws.destinations = append(ws.destinations, &warehouseDestination{
+		cfg:     cfg,
+		writer:  writer,
+		access:  &warehouse.Table{Name: cfg.AccessTable, Key: "event_id", Columns: accessEventColumns},
+		links:   &warehouse.Table{Name: cfg.LinkTable, Key: "event_id", Columns: linkEventColumns},
+		clock:   clock.Real,
+		ensured: make(map[string]bool),
+		full:    make(chan struct{}, 1),
+	})
+}
+
+// AddAccessLog streams a stored access log to the destinations of access events
+func (ws *WarehouseService) AddAccessLog(accessLog *model.AccessLog) {
+	event := model.NewAccessEvent(accessLog)
+	row := warehouse.Row{
+		"event_id":    event.EventID,
+		"short_code":  event.ShortCode,
+		"access_time": event.AccessTime,
+		"client_ip":   event.ClientIP,
+		"user_agent":  event.UserAgent,
+		"referer":     event.Referer,
+		"source":      event.Source,
+		"device":      event.Device,
+		"click_id":    event.ClickID,
+		"edge":        event.Edge,
+	}
+	for _, dest := range ws.destinations {
+		if dest.cfg.Receives(config.WarehouseStreamAccess) {
+			dest.add(dest.access, row)
+		}
+	}
+}
+
+// SendLinkEvent streams a link mutation to the destinations of link events, it never fails as
+// rows are inserted in the background
+func (ws *WarehouseService) SendLinkEvent(_ context.Context, msg *mq.LinkEventMessage) error {
+	var expireAt any
+	if msg.ExpireAt != nil {
+		expireAt = *msg.ExpireAt
+	}
+	row := warehouse.Row{
+		"event_id":       msg.EventID,
+		"type":           msg.Type,
+		"short_code":     msg.ShortCode,
+		"occurred_at":    msg.OccurredAt,
+		"original_url":   msg.OriginalURL,
+		"pool":           msg.Pool,
+		"expire_at":      expireAt,
+		"region":         msg.Region,
+		"max_clicks":     msg.MaxClicks,
+		"no_click_id":    msg.NoClickID,
+		"preserve_query": msg.PreserveQuery,
+		"public_stats":   msg.PublicStats,
+		"no_tracking":    msg.NoTracking,
+		"cache_control":  msg.CacheControl,
+		"signed_params":  msg.SignedParams,
+		"single_use":     msg.SingleUse,
+		"referrers":      msg.Referrers,
+		"geo_allow":      msg.GeoAllow,
+		"geo_deny":       msg.GeoDeny,
+		"schedule":       string(msg.Schedule),
+	}
+	for _, dest := range ws.destinations {
+		if dest.cfg.Receives(config.WarehouseStreamLinks) {
+			dest.add(dest.links, row)
+		}
+	}
+	return nil
+}
+
+// Run inserts the buffered rows of every destination until ctx is done. The rows left are
+// inserted by Close.
+func (ws *WarehouseService) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, dest := range ws.destinations {
+		wg.Add(1)
+		async.Go(func() {
+			defer wg.Done()
+			dest.run(ctx)
+		})
+	}
+	wg.Wait()
+}
+
+// Close inserts the rows left once no more events come in
+func (ws *WarehouseService) Close(ctx context.Context) error {
+	var errs []error
+	for _, dest := range ws.destinations {
+		if err := dest.flush(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("warehouse %s: %w", dest.cfg.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stats reports the rows buffered and inserted per destination
+func (ws *WarehouseService) Stats() []model.WarehouseStats {
+	stats := make([]model.WarehouseStats, len(ws.destinations))
+	for i, dest := range ws.destinations {
+		stats[i] = dest.stats()
+	}
+	return stats
+}
+
+// add buffers a row, dropping it when the buffer is full
+func (d *warehouseDestination) add(table *warehouse.Table, row warehouse.Row) {
+	d.mu.Lock()
+	if len(d.pending) >= d.cfg.BufferSize {
+		d.mu.Unlock()
+		d.dropped.Add(1)
+		log.Warn().Str("warehouse", d.cfg.Name).Str("table", table.Name).Msg("Warehouse buffer full, dropping row")
+		return
+	}
+	d.pending = append(d.pending, warehouseRow{table: table, row: row})
+	full := len(d.pending) >= d.cfg.BatchSize
+	d.mu.Unlock()
+
+	// Insert early instead of waiting for the interval when many events come in
+	if full {
+		select {
+		case d.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run inserts the buffered rows every flush interval, or once a batch is buffered
+func (d *warehouseDestination) run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.full:
+		}
+		if err := d.flush(ctx); err != nil {
+			log.Error().Err(err).Str("warehouse", d.cfg.Name).Msg("Failed to stream events to the warehouse")
+		}
+	}
+}
+
+// flush inserts the buffered rows table by table, ensuring every table before its first insert.
+// The rows of a failed insert and of the tables after it are buffered again for the next flush.
+func (d *warehouseDestination) flush(ctx context.Context) error {
+	d.flushing.Lock()
+	defer d.flushing.Unlock()
+
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = nil
+	d.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), d.cfg.Timeout)
+	defer cancel()
+
+	var err error
+	var uninserted []warehouseRow
+	for _, table := range []*warehouse.Table{d.access, d.links} {
+		var batch []warehouseRow
+		for _, r := range pending {
+			if r.table == table {
+				batch = append(batch, r)
+			}
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		if err == nil {
+			err = d.insert(ctx, table, batch)
+		}
+		if err != nil {
+			uninserted = append(uninserted, batch...)
+			continue
+		}
+		d.inserted.Add(int64(len(batch)))
+	}
+
+	d.mu.Lock()
+	d.last = d.clock.Now()
+	d.lastErr = ""
+	if err != nil {
+		d.lastErr = err.Error()
+		d.failed.Add(1)
+		// Buffered again ahead of the rows added meanwhile, as many as the buffer holds
+		keep := min(len(uninserted), max(d.cfg.BufferSize-len(d.pending), 0))
+		d.dropped.Add(int64(len(uninserted) - keep))
+		d.pending = append(uninserted[:keep:keep], d.pending...)
+	}
+	d.mu.Unlock()
+
+	return err
+}
+
+// insert inserts rows into a table, ensuring its schema first when not done yet
+func (d *warehouseDestination) insert(ctx context.Context, table *warehouse.Table, batch []warehouseRow) error {
+	if !d.ensured[table.Name] {
+		if err := d.writer.EnsureTable(ctx, table); err != nil {
+			return err
+		}
+		d.ensured[table.Name] = true
+	}
+
+	rows := make([]warehouse.Row, len(batch))
+	for i, r := range batch {
+		rows[i] = r.row
+	}
+	return d.writer.Insert(ctx, table, rows)
+}
+
+// stats reports the rows buffered and inserted
+func (d *warehouseDestination) stats() model.WarehouseStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := model.WarehouseStats{
+		Name:      d.cfg.Name,
+		Type:      d.cfg.Type,
+		Buffered:  len(d.pending),
+		Inserted:  d.inserted.Load(),
+		Failed:    d.failed.Load(),
+		Dropped:   d.dropped.Load(),
+		LastError: d.lastErr,
+	}
+	if !d.last.IsZero() {
+		last := d.last
+		stats.LastFlush = &last
+	}
+	return stats
+}
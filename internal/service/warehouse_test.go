@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"octopus/internal/config"
+	"octopus/internal/model"
+	"octopus/internal/mq"
+	"octopus/pkg/warehouse"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWarehouse keeps the tables ensured and the rows inserted, failing inserts with the queued
+// errors until they run out
+type fakeWarehouse struct {
+	errs    []error
+	ensured []string
+	rows    map[string][]warehouse.Row
+}
+
+func (w *fakeWarehouse) EnsureTable(_ context.Context, table *warehouse.Table) error {
+	w.ensured = append(w.ensured, table.Name)
+	return nil
+}
+
+func (w *fakeWarehouse) Insert(_ context.Context, table *warehouse.Table, rows []warehouse.Row) error {
+	if len(w.errs) > 0 {
+		err := w.errs[0]
+		w.errs = w.errs[1:]
+		return err
+	}
+	if w.rows == nil {
+		w.rows = make(map[string][]warehouse.Row)
+	}
+	w.rows[table.Name] = append(w.rows[table.Name], rows...)
+	return nil
+}
+
+func newTestWarehouseService(dw *fakeWarehouse, streams ...string) *WarehouseService {
+	ws := NewWarehouseService()
+	ws.AddDestination(&config.WarehouseDestinationConfig{
+		Name:          "dw",
+		Type:          config.WarehouseTypeSQL,
+		Streams:       streams,
+		AccessTable:   "access_events",
+		LinkTable:     "link_events",
+		FlushInterval: time.Minute,
+		BatchSize:     2,
+		BufferSize:    3,
+		Timeout:       time.Second,
+	}, dw)
+	return ws
+}
+
+func TestWarehouseService_Flush(t *testing.T) {
+	dw := &fakeWarehouse{}
+	ws := newTestWarehouseService(dw)
+	accessTime := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	ws.AddAccessLog(testAccessLog("ABCD", accessTime))
+	require.NoError(t, ws.SendLinkEvent(context.Background(), &mq.LinkEventMessage{
+		EventID: "l1", Type: mq.EventTypeLinkCreated, ShortCode: "ABCD", OriginalURL: "https://example.com", MaxClicks: 5, OccurredAt: accessTime,
+	}))
+	require.NoError(t, ws.Close(context.Background()))
+
+	assert.Equal(t, []string{"access_events", "link_events"}, dw.ensured)
+	require.Len(t, dw.rows["access_events"], 1)
+	assert.Equal(t, "ABCD2026-10-16T09:00:00Z", dw.rows["access_events"][0]["event_id"])
+	assert.Equal(t, accessTime, dw.rows["access_events"][0]["access_time"])
+	require.Len(t, dw.rows["link_events"], 1)
+	assert.Equal(t, "link_created", dw.rows["link_events"][0]["type"])
+	assert.Equal(t, int64(5), dw.rows["link_events"][0]["max_clicks"])
+	assert.Nil(t, dw.rows["link_events"][0]["expire_at"])
+
+	// Tables are ensured once
+	ws.AddAccessLog(testAccessLog("EFGH", accessTime))
+	require.NoError(t, ws.Close(context.Background()))
+	assert.Len(t, dw.ensured, 2)
+
+	stats := ws.Stats()
+	require.Len(t, stats, 1)
+	assert.Equal(t, "dw", stats[0].Name)
+	assert.Equal(t, int64(3), stats[0].Inserted)
+	require.NotNil(t, stats[0].LastFlush)
+}
+
+func TestWarehouseService_FlushFailure(t *testing.T) {
+	dw := &fakeWarehouse{errs: []error{&warehouse.Error{Warehouse: "bigquery", StatusCode: 503, Message: "backend error"}}}
+	ws := newTestWarehouseService(dw)
+	accessTime := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	ws.AddAccessLog(testAccessLog("ABCD", accessTime))
+	require.NoError(t, ws.SendLinkEvent(context.Background(), &mq.LinkEventMessage{EventID: "l1", ShortCode: "ABCD"}))
+	err := ws.Close(context.Background())
+	assert.ErrorContains(t, err, "warehouse dw: warehouse: bigquery: backend error")
+
+	// The failed insert and the ones after it are retried on the next flush
+	stats := ws.Stats()[0]
+	assert.Equal(t, 2, stats.Buffered)
+	assert.Equal(t, int64(1), stats.Failed)
+	assert.Empty(t, dw.rows)
+
+	require.NoError(t, ws.Close(context.Background()))
+	assert.Len(t, dw.rows["access_events"], 1)
+	assert.Len(t, dw.rows["link_events"], 1)
+	assert.Empty(t, ws.Stats()[0].LastError)
+}
+
+func TestWarehouseService_Streams(t *testing.T) {
+	dw := &fakeWarehouse{}
+	ws := newTestWarehouseService(dw, config.WarehouseStreamLinks)
+
+	ws.AddAccessLog(testAccessLog("ABCD", time.Now()))
+	require.NoError(t, ws.SendLinkEvent(context.Background(), &mq.LinkEventMessage{EventID: "l1", ShortCode: "ABCD"}))
+	require.NoError(t, ws.Close(context.Background()))
+
+	assert.Equal(t, []string{"link_events"}, dw.ensured)
+	assert.Len(t, dw.rows["link_events"], 1)
+}
+
+func TestWarehouseService_Buffer(t *testing.T) {
+	ws := newTestWarehouseService(&fakeWarehouse{})
+	dest := ws.destinations[0]
+
+	ws.AddAccessLog(testAccessLog("ABCD", time.Now()))
+	ws.AddAccessLog(testAccessLog("ABCD", time.Now()))
+	select {
+	case <-dest.full:
+	default:
+		t.Fatal("not flushed once a batch was buffered")
+	}
+
+	ws.AddAccessLog(testAccessLog("ABCD", time.Now()))
+	ws.AddAccessLog(testAccessLog("ABCD", time.Now()))
+	stats := ws.Stats()[0]
+	assert.Equal(t, 3, stats.Buffered)
+	assert.Equal(t, int64(1), stats.Dropped)
+}
+
+// failingPublisher fails every link event
+type failingPublisher struct{}
+
+func (failingPublisher) SendLinkEvent(context.Context, *mq.LinkEventMessage) error {
+	return errors.New("broker down")
+}
+
+func TestEventPublishers(t *testing.T) {
+	dw := &fakeWarehouse{}
+	ws := newTestWarehouseService(dw)
+	publishers := EventPublishers{failingPublisher{}, ws}
+
+	// A failing publisher does not keep the event from the others
+	err := publishers.SendLinkEvent(context.Background(), &mq.LinkEventMessage{EventID: "l1", ShortCode: "ABCD"})
+	assert.ErrorContains(t, err, "broker down")
+	assert.Equal(t, 1, ws.Stats()[0].Buffered)
+	assert.Equal(t, []model.WarehouseStats{{Name: "dw", Type: "sql", Buffered: 1}}, ws.Stats())
+}
@@ -0,0 +1,144 @@
+// Package storage defines what the services need from storage, one narrow interface per
+// capability, so that an alternate backend implements only the capabilities it serves. The MySQL
+// and Redis repositories implement them all, as Database and Cache.
+package storage
+
+import (
+	"context"
+	"time"
+
+	"octopus/internal/model"
+)
+
+// LinkStore keeps short links durably, it is the source of truth for redirects
+type LinkStore interface {
+	SaveShortLink(ctx context.Context, sl *model.ShortLink) error
+	GetShortLinkByCode(ctx context.Context, shortCode string) (*model.ShortLink, error)
+	GetShortLinkByDedupHash(ctx context.Context, dedupHash string) (*model.ShortLink, error)
+	GetShortLinksByURLHash(ctx context.Context, urlHash string) ([]model.ShortLink, error)
+	SearchShortLinks(ctx context.Context, q *model.SearchQuery) ([]model.ShortLink, error)
+	GetShortLinksByCodes(ctx context.Context, shortCodes []string) ([]model.ShortLink, error)
+	GetShortLinksByFilter(ctx context.Context, filter *model.LinkFilter, limit int) ([]model.ShortLink, error)
+	GetManagedShortLinks(ctx context.Context, owner string) ([]model.ShortLink, error)
+	CheckExistsByCode(ctx context.Context, shortCode string) (bool, error)
+	GetExpiredLinksByPool(ctx context.Context, pool string, before time.Time, limit int) ([]model.ShortLink, error)
+	GetExpiringShortLinks(ctx context.Context, from, to time.Time, afterID int64, limit int) ([]model.ShortLink, error)
+	DeleteShortLinkByCode(ctx context.Context, shortCode string) error
+	DeactivateShortLink(ctx context.Context, shortCode string) error
+	SetShortLinkOwner(ctx context.Context, shortCode, owner string) error
+	SetShortLinksStatus(ctx context.Context, filter *model.LinkFilter, status int) ([]model.ShortLink, error)
+	SetShortLinksExpiry(ctx context.Context, filter *model.LinkFilter, expireAt *time.Time) ([]model.ShortLink, error)
+	UpdateShortLink(ctx context.Context, sl *model.ShortLink) error
+	UpdateShortLinkMetadata(ctx context.Context, sl *model.ShortLink) error
+	ApplyReplicatedShortLink(ctx context.Context, sl *model.ShortLink) (bool, error)
+	// WithTx runs fn in a transaction: the writes fn makes with the context it is given commit or
+	// roll back together
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// StatsStore keeps the daily aggregates of redirects and the conversions they led to
+type StatsStore interface {
+	IncrementDailyStat(ctx context.Context, shortCode string, day time.Time) error
+	AddDailyClicks(ctx context.Context, shortCode string, day time.Time, clicks int64) error
+	GetDailyStats(ctx context.Context, shortCode string, from, to time.Time) ([]model.DailyStat, error)
+	GetDailySourceStats(ctx context.Context, shortCode string, from, to time.Time) ([]model.DailySourceStat, error)
+	GetCampaignDailyStats(ctx context.Context, param string, from, to time.Time) ([]model.CampaignDailyStat, error)
+	GetCampaignDailySourceStats(ctx context.Context, param string, from, to time.Time) ([]model.CampaignDailySourceStat, error)
+	SaveConversion(ctx context.Context, conversion *model.Conversion) (bool, error)
+	DeleteStats(ctx context.Context, shortCode string) error
+}
+
+// LogStore keeps the access log of every redirect
+type LogStore interface {
+	SaveAccessLog(ctx context.Context, accessLog *model.AccessLog) error
+	RecordAccessLog(ctx context.Context, accessLog *model.AccessLog) (bool, error)
+	GetAccessLogs(ctx context.Context, q *model.AccessLogQuery) ([]model.AccessLog, error)
+	CountAccessLogsBetween(ctx context.Context, shortCode string, from, to time.Time) (int64, error)
+	DeleteAccessLogs(ctx context.Context, shortCode string) error
+}
+
+// RuleStore keeps the bot, reserved word, URL blocklist and traffic source rules set at runtime
+type RuleStore interface {
+	ListRules(ctx context.Context) ([]model.Rule, error)
+	SaveRule(ctx context.Context, rule *model.Rule) error
+	UpdateRule(ctx context.Context, rule *model.Rule) error
+	DeleteRule(ctx context.Context, id int64) (bool, error)
+}
+
+// ReputationStore keeps the reports, checks and overrides of link destination domains
+type ReputationStore interface {
+	TrackDomain(ctx context.Context, domain, sampleURL string) error
+	AddDomainReport(ctx context.Context, domain string, at, since time.Time) error
+	RecordDomainCheck(ctx context.Context, domain string, dead, flagged bool, at time.Time) error
+	SetDomainOverride(ctx context.Context, domain, verdict string) error
+	GetDomainReputation(ctx context.Context, domain string) (*model.DomainReputation, error)
+	ListDomainReputations(ctx context.Context) ([]model.DomainReputation, error)
+	ListDomainsToCheck(ctx context.Context, before time.Time, limit int) ([]model.DomainReputation, error)
+}
+
+// Database is the durable storage of links, stats, logs, rules and domain reputations, MySQL by
+// default
+type Database interface {
+	LinkStore
+	StatsStore
+	LogStore
+	RuleStore
+	ReputationStore
+}
+
+// LinkCache caches short links in front of the LinkStore and counts clicks against their limits
+type LinkCache interface {
+	SaveShortLink(ctx context.Context, cacheKey, shortCode string, ttl time.Duration) error
+	SaveShortLinkPair(ctx context.Context, cacheKey string, sl *model.ShortLink, ttl time.Duration) error
+	GetShortLink(ctx context.Context, cacheKey string) (string, error)
+	CacheShortLink(ctx context.Context, sl *model.ShortLink, ttl time.Duration) error
+	GetCachedShortLink(ctx context.Context, shortCode string) (*model.ShortLink, error)
+	GetCachedShortLinks(ctx context.Context, shortCodes []string) (map[string]*model.ShortLink, error)
+	DeleteShortLink(ctx context.Context, shortCode string) error
+	SetClickLimit(ctx context.Context, shortCode string, limit int64, ttl time.Duration) error
+	ConsumeClick(ctx context.Context, shortCode string) (bool, bool, error)
+}
+
+// CounterStore keeps the real-time analytics counters of short links
+type CounterStore interface {
+	IncrementPV(ctx context.Context, shortCode string) (int64, error)
+	GetPV(ctx context.Context, shortCode string) (int64, error)
+	AddUV(ctx context.Context, shortCode, visitorID string) (bool, error)
+	GetUV(ctx context.Context, shortCode string) (int64, error)
+	GetMergedUV(ctx context.Context, shortCodes []string, period model.Period) (int64, error)
+	AddSource(ctx context.Context, shortCode, source string) error
+	RecordAccessPipelined(ctx context.Context, shortCode, visitorID, source string) error
+	ApplyCounters(ctx context.Context, deltas []*model.CounterDelta) error
+	GetMinuteClicks(ctx context.Context, shortCode string, to time.Time) ([]int64, error)
+	GetSources(ctx context.Context, shortCode string) (map[string]int64, error)
+	IncrementConversion(ctx context.Context, shortCode, source string) error
+	GetConversions(ctx context.Context, shortCode string) (map[string]int64, error)
+	TouchStats(ctx context.Context, shortCode string) error
+	GetStatsUpdatedAt(ctx context.Context, shortCode string) (time.Time, error)
+	DeleteCounters(ctx context.Context, shortCode string) error
+}
+
+// PoolStore keeps the capacity and the free codes of reserved code pools
+type PoolStore interface {
+	ReserveCapacity(ctx context.Context, pool string, capacity int64) (bool, error)
+	ReleaseCapacity(ctx context.Context, pool string) error
+	GetPoolUsage(ctx context.Context, pool string) (int64, error)
+	PushFreeCode(ctx context.Context, pool, shortCode string) error
+	PopFreeCode(ctx context.Context, pool string) (string, error)
+	CountFreeCodes(ctx context.Context, pool string) (int64, error)
+}
+
+// ClickStore keeps the click IDs of redirects until their conversions are reported
+type ClickStore interface {
+	SaveClick(ctx context.Context, clickID, shortCode, source string, ttl time.Duration) error
+	GetClick(ctx context.Context, clickID string) (string, string, error)
+}
+
+// Cache is the fast storage next to the Database: cached links, counters, code pools and clicks,
+// Redis by default
+type Cache interface {
+	LinkCache
+	CounterStore
+	PoolStore
+	ClickStore
+}
@@ -0,0 +1,134 @@
+// Package apiresp writes the responses of the HTTP APIs in the format of the request: data and
+// errors wrapped in the {"code", "message"} envelope, or data as is and errors as RFC 9457 problem
+// details. It also holds the page envelope and cursor helpers shared by list endpoints.
+package apiresp
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// envelopeKey keys in the gin context whether a request is answered in the envelope
+const envelopeKey = "apiresp.envelope"
+
+// ProblemContentType is the media type of RFC 9457 problem details
+const ProblemContentType = "application/problem+json"
+
+// Response is the standard API response
+type Response struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// ErrorResponse is the error API response
+type ErrorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	// Errors lists the rejected fields of an invalid request
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes why a field of a request was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Problem is an error reported as RFC 9457 problem details
+type Problem struct {
+	Type     string      `json:"type"`
+	Title    string      `json:"title"`
+	Status   int         `json:"status"`
+	Detail   string      `json:"detail,omitempty"`
+	Instance string      `json:"instance,omitempty"`
+	Errors   interface{} `json:"errors,omitempty"`
+}
+
+// SetEnvelope sets whether a request is answered in the envelope rather than with data as is and
+// problem details
+func SetEnvelope(c *gin.Context, envelope bool) {
+	c.Set(envelopeKey, envelope)
+}
+
+// Envelope reports whether a request is answered in the envelope, the default of requests whose
+// format was not set such as those of the admin API
+func Envelope(c *gin.Context) bool {
+	if envelope, ok := c.Get(envelopeKey); ok {
+		return envelope.(bool)
+	}
+	return true
+}
+
+// OK responds 200 with data, wrapped in the envelope of the requests having one
+func OK(c *gin.Context, data interface{}) {
+	if Envelope(c) {
+		c.JSON(http.StatusOK, Response{
+			Code:    0,
+			Message: "success",
+			Data:    data,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, data)
+}
+
+// NoContent responds to a request succeeding without data: an empty envelope, or 204 without one
+func NoContent(c *gin.Context) {
+	if Envelope(c) {
+		c.JSON(http.StatusOK, Response{
+			Code:    0,
+			Message: "success",
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Fail responds with an error status and message, in the format of the request
+func Fail(c *gin.Context, status int, message string) {
+	FailFields(c, status, message, nil)
+}
+
+// FailFields responds with an error status and message along with the rejected fields of an
+// invalid request, in the format of the request
+func FailFields(c *gin.Context, status int, message string, errs []FieldError) {
+	if Envelope(c) {
+		c.JSON(status, ErrorResponse{
+			Code:    status,
+			Message: message,
+			Errors:  errs,
+		})
+		return
+	}
+
+	problem := NewProblem(c, status, message)
+	if len(errs) > 0 {
+		problem.Errors = errs
+	}
+	WriteProblem(c, problem)
+}
+
+// Abort aborts a request with an error status and message, in the format of the request
+func Abort(c *gin.Context, status int, message string) {
+	c.Abort()
+	Fail(c, status, message)
+}
+
+// NewProblem describes an error status of a request, detailed by message
+func NewProblem(c *gin.Context, status int, message string) *Problem {
+	return &Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   message,
+		Instance: c.Request.URL.Path,
+	}
+}
+
+// WriteProblem responds with problem details
+func WriteProblem(c *gin.Context, problem *Problem) {
+	c.Header("Content-Type", ProblemContentType)
+	c.JSON(problem.Status, problem)
+}
@@ -0,0 +1,124 @@
+package apiresp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRouter(envelope bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if c.Query("format") != "" {
+			SetEnvelope(c, envelope)
+		}
+	})
+	router.GET("/ok", func(c *gin.Context) {
+		OK(c, gin.H{"short_code": "ABCD"})
+	})
+	router.DELETE("/ok", func(c *gin.Context) {
+		NoContent(c)
+	})
+	router.POST("/invalid", func(c *gin.Context) {
+		FailFields(c, http.StatusBadRequest, "Invalid request: url is required", []FieldError{{Field: "url", Message: "is required"}})
+	})
+	router.GET("/abort", func(c *gin.Context) {
+		Abort(c, http.StatusServiceUnavailable, "Service under maintenance, retry later")
+	}, func(c *gin.Context) {
+		OK(c, "unreachable")
+	})
+	router.GET("/page", func(c *gin.Context) {
+		q, err := ParsePageQuery(c)
+		if err != nil {
+			Fail(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+			return
+		}
+		OK(c, NewPage([]string{q.Cursor}, EncodeCursor("next")).WithTotal(3))
+	})
+	return router
+}
+
+func serve(router *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, nil)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestEnvelope(t *testing.T) {
+	router := newTestRouter(true)
+
+	// Requests whose format was never set are answered in the envelope
+	w := serve(router, "GET", "/ok")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"code": 0, "message": "success", "data": {"short_code": "ABCD"}}`, w.Body.String())
+
+	w = serve(router, "DELETE", "/ok?format=1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"code": 0, "message": "success"}`, w.Body.String())
+
+	w = serve(router, "POST", "/invalid?format=1")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"code": 400, "message": "Invalid request: url is required", "errors": [{"field": "url", "message": "is required"}]}`, w.Body.String())
+
+	w = serve(router, "GET", "/abort")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"code": 503, "message": "Service under maintenance, retry later"}`, w.Body.String())
+}
+
+func TestProblemDetails(t *testing.T) {
+	router := newTestRouter(false)
+
+	w := serve(router, "GET", "/ok?format=1")
+	assert.JSONEq(t, `{"short_code": "ABCD"}`, w.Body.String())
+
+	w = serve(router, "DELETE", "/ok?format=1")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = serve(router, "POST", "/invalid?format=1")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	var problem Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, "Bad Request", problem.Title)
+	assert.Equal(t, "/invalid", problem.Instance)
+	assert.Equal(t, []interface{}{map[string]interface{}{"field": "url", "message": "is required"}}, problem.Errors)
+
+	w = serve(router, "GET", "/abort?format=1")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotContains(t, w.Body.String(), "unreachable")
+}
+
+func TestPage(t *testing.T) {
+	router := newTestRouter(false)
+
+	w := serve(router, "GET", "/page?format=1&cursor="+EncodeCursor("2026-03-01T12:00:00Z:42")+"&limit=10")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"items": ["2026-03-01T12:00:00Z:42"], "next_cursor": "`+EncodeCursor("next")+`", "has_more": true, "total": 3}`, w.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, serve(router, "GET", "/page?cursor=%21%21").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(router, "GET", "/page?limit=0").Code)
+
+	// The last page has no next cursor
+	data, err := json.Marshal(NewPage([]int{}, ""))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"items": [], "has_more": false}`, string(data))
+}
+
+func TestOffsetCursor(t *testing.T) {
+	offset, err := DecodeOffset(EncodeOffset(40))
+	require.NoError(t, err)
+	assert.Equal(t, 40, offset)
+
+	for _, cursor := range []string{"", "!!", EncodeCursor("40"), EncodeOffset(-1), EncodeCursor("offset:x")} {
+		_, err := DecodeOffset(cursor)
+		assert.ErrorIs(t, err, ErrInvalidCursor, cursor)
+	}
+}
@@ -0,0 +1,108 @@
+package apiresp
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// offsetPrefix marks the cursors of lists paged with offsets underneath
+const offsetPrefix = "offset:"
+
+// Page is a page of a list paged with cursors. Items holds the page's items, NextCursor the cursor
+// of the next page, given back as the cursor query parameter while HasMore is true. Total counts
+// the items of the whole list, for the lists able to tell it cheaply.
+type Page struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	HasMore    bool        `json:"has_more"`
+	Total      *int64      `json:"total,omitempty"`
+}
+
+// NewPage returns a page of items, followed by the page at nextCursor unless it is empty
+func NewPage(items interface{}, nextCursor string) *Page {
+	return &Page{Items: items, NextCursor: nextCursor, HasMore: nextCursor != ""}
+}
+
+// WithTotal sets the number of items of the whole list
+func (p *Page) WithTotal(total int64) *Page {
+	p.Total = &total
+	return p
+}
+
+// PageQuery is the position and size of the page a request asks for
+type PageQuery struct {
+	// Cursor is the position decoded from the cursor query parameter, empty for the first page
+	Cursor string
+	// Limit is the page size of the limit query parameter, 0 for the list's default
+	Limit int
+}
+
+// ParsePageQuery reads the page of a request from its cursor and limit query parameters
+func ParsePageQuery(c *gin.Context) (*PageQuery, error) {
+	q := &PageQuery{}
+	if cursor := c.Query("cursor"); cursor != "" {
+		position, err := DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		q.Cursor = position
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return nil, errors.New("limit must be a positive integer")
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// EncodeCursor returns the opaque cursor of a position in a list, such as the sort key of the last
+// item of a page
+func EncodeCursor(position string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(position))
+}
+
+// DecodeCursor returns the position of a cursor produced by EncodeCursor
+func DecodeCursor(cursor string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(raw) == 0 {
+		return "", ErrInvalidCursor
+	}
+	return string(raw), nil
+}
+
+// EncodeOffset returns the opaque cursor of a page starting at offset, for lists paged with
+// offsets underneath
+func EncodeOffset(offset int) string {
+	return EncodeCursor(offsetPrefix + strconv.Itoa(offset))
+}
+
+// DecodeOffset returns the offset of a cursor produced by EncodeOffset
+func DecodeOffset(cursor string) (int, error) {
+	position, err := DecodeCursor(cursor)
+	if err != nil {
+		return 0, err
+	}
+	return OffsetOf(position)
+}
+
+// OffsetOf returns the offset of a position decoded from a cursor produced by EncodeOffset
+func OffsetOf(position string) (int, error) {
+	value, ok := strings.CutPrefix(position, offsetPrefix)
+	if !ok {
+		return 0, ErrInvalidCursor
+	}
+	offset, err := strconv.Atoi(value)
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
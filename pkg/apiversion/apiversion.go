@@ -0,0 +1,122 @@
+// Package apiversion registers the versions of the public API served side by side, tags requests
+// with the version they were routed to and its response format, so shared handlers can respond in
+// it with apiresp, and announces the deprecation and sunset of old versions in the Deprecation,
+// Sunset and Link headers.
+package apiversion
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"octopus/pkg/apiresp"
+	"octopus/pkg/clock"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contextKey keys the version of a request in its gin context
+const contextKey = "apiversion"
+
+// Version is a version of the public API, served under /api/<Name>. The fields describing its
+// responses are frozen once it is released; changes go to a new version.
+type Version struct {
+	// Name is the path segment of the version, e.g. "v1"
+	Name string
+	// Envelope wraps data in {"code", "message", "data"} and reports errors as {"code",
+	// "message", "errors"}; without it data is returned as is and errors as problem details
+	Envelope bool
+	// Cursors pages lists with opaque cursors rather than offsets
+	Cursors bool
+	// Successor names the version replacing this one once it is deprecated
+	Successor string
+
+	// Deprecated is when the version was or will be deprecated, zero when it is not
+	Deprecated time.Time
+	// Sunset is when the version stops being served, zero when no date is set
+	Sunset time.Time
+	// Link is the URL of the migration guide of a deprecated version
+	Link string
+}
+
+// Unversioned is the format of the responses of requests not routed to a version, such as the
+// admin API: the envelope of v1
+var Unversioned = &Version{Envelope: true}
+
+// Registry holds the versions of the public API, oldest first
+type Registry struct {
+	versions []*Version
+	clock    clock.Clock
+}
+
+// NewRegistry creates a registry of versions, oldest first
+func NewRegistry(versions ...*Version) *Registry {
+	return &Registry{
+		versions: versions,
+		clock:    clock.Real,
+	}
+}
+
+// SetClock replaces the system clock telling whether versions are sunset
+func (r *Registry) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// Versions returns the registered versions, oldest first
+func (r *Registry) Versions() []*Version {
+	return r.versions
+}
+
+// Lookup returns the version with the given name
+func (r *Registry) Lookup(name string) (*Version, bool) {
+	for _, v := range r.versions {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// Handler returns a gin middleware tagging the requests of a route group with a registered
+// version, announcing its deprecation and answering 410 once it is sunset
+func (r *Registry) Handler(name string) gin.HandlerFunc {
+	v, ok := r.Lookup(name)
+	if !ok {
+		panic(fmt.Sprintf("apiversion: %s is not registered", name))
+	}
+
+	return func(c *gin.Context) {
+		c.Set(contextKey, v)
+		apiresp.SetEnvelope(c, v.Envelope)
+
+		if !v.Deprecated.IsZero() {
+			c.Header("Deprecation", fmt.Sprintf("@%d", v.Deprecated.Unix()))
+			if v.Successor != "" {
+				c.Writer.Header().Add("Link", fmt.Sprintf(`</api/%s>; rel="successor-version"`, v.Successor))
+			}
+			if v.Link != "" {
+				c.Writer.Header().Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"`, v.Link))
+			}
+		}
+		if !v.Sunset.IsZero() {
+			c.Header("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+			if !r.clock.Now().Before(v.Sunset) {
+				message := fmt.Sprintf("API %s was sunset on %s", v.Name, v.Sunset.UTC().Format(time.DateOnly))
+				if v.Successor != "" {
+					message += ", use /api/" + v.Successor
+				}
+				apiresp.Abort(c, http.StatusGone, message)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// From returns the version a request was routed to, Unversioned when it was not
+func From(c *gin.Context) *Version {
+	if v, ok := c.Get(contextKey); ok {
+		return v.(*Version)
+	}
+	return Unversioned
+}
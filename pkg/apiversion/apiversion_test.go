@@ -0,0 +1,114 @@
+package apiversion
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"octopus/pkg/apiresp"
+	"octopus/pkg/clock"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRouter(registry *Registry) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	for _, v := range registry.Versions() {
+		api := router.Group("/api/"+v.Name, registry.Handler(v.Name))
+		api.GET("/ping", func(c *gin.Context) {
+			c.String(http.StatusOK, From(c).Name)
+		})
+		api.GET("/fail", func(c *gin.Context) {
+			apiresp.Abort(c, http.StatusServiceUnavailable, "Service under maintenance, retry later")
+		})
+	}
+	router.GET("/admin/fail", func(c *gin.Context) {
+		apiresp.Abort(c, http.StatusNotFound, "Not found")
+	})
+	return router
+}
+
+func get(router *gin.Engine, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path, nil)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	registry := NewRegistry(
+		&Version{Name: "v1", Envelope: true, Successor: "v2"},
+		&Version{Name: "v2"},
+	)
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	registry.SetClock(fake)
+	router := newTestRouter(registry)
+
+	// Supported versions announce nothing
+	w := get(router, "/api/v1/ping")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "v1", w.Body.String())
+	assert.Empty(t, w.Header().Get("Deprecation"))
+	assert.Empty(t, w.Header().Get("Sunset"))
+
+	v1, ok := registry.Lookup("v1")
+	require.True(t, ok)
+	v1.Deprecated = time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	v1.Sunset = time.Date(2027, 4, 1, 0, 0, 0, 0, time.UTC)
+	v1.Link = "https://docs.example.com/migrate-to-v2"
+
+	w = get(router, "/api/v1/ping")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "@1790812800", w.Header().Get("Deprecation"))
+	assert.Equal(t, "Thu, 01 Apr 2027 00:00:00 GMT", w.Header().Get("Sunset"))
+	assert.Equal(t, []string{
+		`</api/v2>; rel="successor-version"`,
+		`<https://docs.example.com/migrate-to-v2>; rel="deprecation"`,
+	}, w.Header().Values("Link"))
+
+	w = get(router, "/api/v2/ping")
+	assert.Equal(t, "v2", w.Body.String())
+	assert.Empty(t, w.Header().Get("Deprecation"))
+
+	// Sunset versions are gone
+	fake.Set(v1.Sunset)
+	w = get(router, "/api/v1/ping")
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.JSONEq(t, `{"code": 410, "message": "API v1 was sunset on 2027-04-01, use /api/v2"}`, w.Body.String())
+}
+
+func TestRegistry_HandlerUnknownVersion(t *testing.T) {
+	assert.Panics(t, func() { NewRegistry(&Version{Name: "v1"}).Handler("v3") })
+}
+
+func TestRegistry_HandlerFormat(t *testing.T) {
+	router := newTestRouter(NewRegistry(&Version{Name: "v1", Envelope: true}, &Version{Name: "v2"}))
+
+	w := get(router, "/api/v1/fail")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"code": 503, "message": "Service under maintenance, retry later"}`, w.Body.String())
+
+	w = get(router, "/api/v2/fail")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, apiresp.ProblemContentType, w.Header().Get("Content-Type"))
+	var problem apiresp.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, apiresp.Problem{
+		Type:     "about:blank",
+		Title:    "Service Unavailable",
+		Status:   http.StatusServiceUnavailable,
+		Detail:   "Service under maintenance, retry later",
+		Instance: "/api/v2/fail",
+	}, problem)
+
+	// Requests outside the versioned API keep the envelope
+	w = get(router, "/admin/fail")
+	assert.JSONEq(t, `{"code": 404, "message": "Not found"}`, w.Body.String())
+}
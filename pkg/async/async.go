@@ -0,0 +1,33 @@
+package async
+
+import (
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+// panics counts the panics recovered in goroutines started by Go
+var panics atomic.Int64
+
+// Go runs fn in a new goroutine. A panic in fn is recovered, logged with its stack and counted
+// instead of crashing the process, which the HTTP recovery middleware cannot prevent for goroutines.
+func Go(fn func()) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				panics.Add(1)
+				log.Error().
+					Interface("error", err).
+					Bytes("stack", debug.Stack()).
+					Msg("Panic recovered in background goroutine")
+			}
+		}()
+		fn()
+	}()
+}
+
+// Panics returns the number of panics recovered in background goroutines so far
+func Panics() int64 {
+	return panics.Load()
+}
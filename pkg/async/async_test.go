@@ -0,0 +1,33 @@
+package async
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGo(t *testing.T) {
+	t.Run("runs fn", func(t *testing.T) {
+		done := make(chan struct{})
+		Go(func() { close(done) })
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("fn did not run")
+		}
+	})
+
+	t.Run("recovers and counts panics", func(t *testing.T) {
+		before := Panics()
+		deferred := make(chan struct{})
+		Go(func() {
+			defer close(deferred)
+			panic("boom")
+		})
+
+		<-deferred
+		assert.Eventually(t, func() bool { return Panics() == before+1 }, time.Second, time.Millisecond)
+	})
+}
@@ -0,0 +1,66 @@
+// Package buildinfo reports the build of the running binary, stamped at link time:
+//
+//	go build -ldflags "-X octopus/pkg/buildinfo.Version=v1.4.0 -X octopus/pkg/buildinfo.Commit=$(git rev-parse HEAD) \
+//		-X octopus/pkg/buildinfo.Time=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/server
+//
+// Binaries built without the flags fall back to the commit and time the Go toolchain records.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Stamped by the linker with -X
+var (
+	Version = "dev"
+	Commit  = ""
+	Time    = ""
+)
+
+// Info describes the build of the running binary
+type Info struct {
+	Version   string
+	Commit    string
+	Time      string
+	GoVersion string
+	// Modified is set when the binary was built from a tree with uncommitted changes
+	Modified bool
+}
+
+// Get returns the build of the running binary
+var Get = sync.OnceValue(func() Info {
+	info := Info{Version: Version, Commit: Commit, Time: Time, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		fill(&info, bi.Settings)
+	}
+	return info
+})
+
+// fill completes the info with the version control settings recorded by the Go toolchain, the
+// stamped values winning
+func fill(info *Info, settings []debug.BuildSetting) {
+	for _, s := range settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = s.Value
+			}
+		case "vcs.time":
+			if info.Time == "" {
+				info.Time = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+}
+
+// ShortCommit returns the first 12 characters of the commit, enough to tell builds apart in logs
+func (i Info) ShortCommit() string {
+	if len(i.Commit) > 12 {
+		return i.Commit[:12]
+	}
+	return i.Commit
+}
@@ -0,0 +1,37 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFill(t *testing.T) {
+	settings := []debug.BuildSetting{
+		{Key: "vcs.revision", Value: "0123456789abcdef0123456789abcdef01234567"},
+		{Key: "vcs.time", Value: "2026-10-16T09:00:00Z"},
+		{Key: "vcs.modified", Value: "true"},
+	}
+
+	info := Info{Version: "dev"}
+	fill(&info, settings)
+	assert.Equal(t, "0123456789abcdef0123456789abcdef01234567", info.Commit)
+	assert.Equal(t, "2026-10-16T09:00:00Z", info.Time)
+	assert.True(t, info.Modified)
+	assert.Equal(t, "0123456789ab", info.ShortCommit())
+
+	// Stamped values win over the recorded ones
+	info = Info{Version: "v1.4.0", Commit: "abc123", Time: "2026-10-17T00:00:00Z"}
+	fill(&info, settings)
+	assert.Equal(t, "abc123", info.Commit)
+	assert.Equal(t, "abc123", info.ShortCommit())
+	assert.Equal(t, "2026-10-17T00:00:00Z", info.Time)
+}
+
+func TestGet(t *testing.T) {
+	info := Get()
+	assert.Equal(t, Version, info.Version)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+}
@@ -0,0 +1,139 @@
+// Package cdn purges cached URLs from the edge of a CDN through its API, so responses cached there
+// do not outlive the changes behind them.
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Base URLs of the supported CDN APIs
+const (
+	CloudflareAPI = "https://api.cloudflare.com/client/v4"
+	FastlyAPI     = "https://api.fastly.com"
+)
+
+// cloudflareBatchSize is the most URLs Cloudflare purges in one request on every plan
+const cloudflareBatchSize = 30
+
+// Purger purges URLs from the cache of a CDN
+type Purger interface {
+	Purge(ctx context.Context, urls []string) error
+}
+
+// Error is returned when a CDN API answers with an error status
+type Error struct {
+	Provider   string
+	StatusCode int
+	Message    string
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	return fmt.Sprintf("cdn: %s responded %d: %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// Temporary reports whether the request may succeed when retried, unlike rejected credentials or
+// requests
+func (e *Error) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Cloudflare purges URLs from the cache of a Cloudflare zone
+type Cloudflare struct {
+	zoneID   string
+	apiToken string
+	baseURL  string
+	client   *http.Client
+}
+
+// NewCloudflare creates a Cloudflare purger for a zone, authenticating with an API token allowed to
+// purge its cache and giving up on every request after timeout
+func NewCloudflare(zoneID, apiToken string, timeout time.Duration) *Cloudflare {
+	return &Cloudflare{zoneID: zoneID, apiToken: apiToken, baseURL: CloudflareAPI, client: &http.Client{Timeout: timeout}}
+}
+
+// Purge purges URLs, in batches Cloudflare accepts
+func (p *Cloudflare) Purge(ctx context.Context, urls []string) error {
+	for start := 0; start < len(urls); start += cloudflareBatchSize {
+		body, err := json.Marshal(map[string][]string{"files": urls[start:min(start+cloudflareBatchSize, len(urls))]})
+		if err != nil {
+			return err
+		}
+		endpoint := p.baseURL + "/zones/" + url.PathEscape(p.zoneID) + "/purge_cache"
+		if err := send(ctx, p.client, "cloudflare", endpoint, body, map[string]string{
+			"Authorization": "Bearer " + p.apiToken,
+			"Content-Type":  "application/json",
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fastly purges URLs from the cache of the Fastly services serving them
+type Fastly struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// NewFastly creates a Fastly purger authenticating with an API key allowed to purge, giving up on
+// every request after timeout
+func NewFastly(apiKey string, timeout time.Duration) *Fastly {
+	return &Fastly{apiKey: apiKey, baseURL: FastlyAPI, client: &http.Client{Timeout: timeout}}
+}
+
+// Purge purges URLs one by one, as Fastly purges single URLs
+func (p *Fastly) Purge(ctx context.Context, urls []string) error {
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("cdn: invalid URL %q: %w", raw, err)
+		}
+		// The URL is addressed without its scheme, which Fastly ignores
+		endpoint := p.baseURL + "/purge/" + u.Host + u.EscapedPath()
+		if err := send(ctx, p.client, "fastly", endpoint, nil, map[string]string{
+			"Fastly-Key": p.apiKey,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send posts a request to a CDN API, any status but 2xx failing with an Error
+func send(ctx context.Context, client *http.Client, provider, endpoint string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cdn: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cdn: %s purge failed: %w", provider, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	// The body explains the failure, only its start is kept as it ends up in logs and metrics
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	message := strings.TrimSpace(string(data))
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	return &Error{Provider: provider, StatusCode: resp.StatusCode, Message: message}
+}
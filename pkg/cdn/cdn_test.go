@@ -0,0 +1,85 @@
+package cdn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudflare_Purge(t *testing.T) {
+	var batches [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/zones/zone1/purge_cache", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+
+		var body struct {
+			Files []string `json:"files"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		batches = append(batches, body.Files)
+		fmt.Fprint(w, `{"success":true}`)
+	}))
+	defer srv.Close()
+
+	p := NewCloudflare("zone1", "token", time.Second)
+	p.baseURL = srv.URL
+
+	urls := make([]string, cloudflareBatchSize+2)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("https://sho.rt/C%03d", i)
+	}
+	require.NoError(t, p.Purge(context.Background(), urls))
+	require.Len(t, batches, 2)
+	assert.Len(t, batches[0], cloudflareBatchSize)
+	assert.Equal(t, urls[cloudflareBatchSize:], batches[1])
+}
+
+func TestFastly_Purge(t *testing.T) {
+	var purged []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "key", r.Header.Get("Fastly-Key"))
+		purged = append(purged, r.URL.EscapedPath())
+		fmt.Fprint(w, `{"status":"ok"}`)
+	}))
+	defer srv.Close()
+
+	p := NewFastly("key", time.Second)
+	p.baseURL = srv.URL
+
+	require.NoError(t, p.Purge(context.Background(), []string{"https://sho.rt/ABCD", "https://sho.rt/ABCD+"}))
+	assert.Equal(t, []string{"/purge/sho.rt/ABCD", "/purge/sho.rt/ABCD+"}, purged)
+}
+
+func TestPurge_Error(t *testing.T) {
+	status := http.StatusForbidden
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, `{"success":false}`)
+	}))
+	defer srv.Close()
+
+	p := NewFastly("key", time.Second)
+	p.baseURL = srv.URL
+
+	var cdnErr *Error
+	err := p.Purge(context.Background(), []string{"https://sho.rt/ABCD"})
+	require.True(t, errors.As(err, &cdnErr))
+	assert.Equal(t, "fastly", cdnErr.Provider)
+	assert.Equal(t, `{"success":false}`, cdnErr.Message)
+	assert.False(t, cdnErr.Temporary())
+
+	status = http.StatusServiceUnavailable
+	err = p.Purge(context.Background(), []string{"https://sho.rt/ABCD"})
+	require.True(t, errors.As(err, &cdnErr))
+	assert.True(t, cdnErr.Temporary())
+}
@@ -0,0 +1,63 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// ErrInjected is returned for calls failed on purpose by an Injector
+var ErrInjected = errors.New("chaos: injected fault")
+
+// Injector delays or fails calls to a dependency at configurable rates
+type Injector struct {
+	target      string
+	errorRate   float64
+	latencyRate float64
+	latency     time.Duration
+	roll        func() float64
+}
+
+// NewInjector creates an Injector for the named dependency.
+// Rates are probabilities between 0 and 1 applied independently to every call.
+func NewInjector(target string, errorRate, latencyRate float64, latency time.Duration) *Injector {
+	return &Injector{
+		target:      target,
+		errorRate:   errorRate,
+		latencyRate: latencyRate,
+		latency:     latency,
+		roll:        rand.Float64,
+	}
+}
+
+// Target returns the name of the dependency faults are injected into
+func (i *Injector) Target() string {
+	return i.target
+}
+
+// Active reports whether the Injector can affect any call
+func (i *Injector) Active() bool {
+	return i.errorRate > 0 || (i.latencyRate > 0 && i.latency > 0)
+}
+
+// Inject runs before a call: it may sleep for the configured latency and
+// returns ErrInjected when the call should fail
+func (i *Injector) Inject(ctx context.Context) error {
+	if i.latency > 0 && i.roll() < i.latencyRate {
+		timer := time.NewTimer(i.latency)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if i.roll() < i.errorRate {
+		return fmt.Errorf("%w into %s", ErrInjected, i.target)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package chaos
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInjector_Active(t *testing.T) {
+	assert.False(t, NewInjector("redis", 0, 0, 0).Active())
+	assert.False(t, NewInjector("redis", 0, 1, 0).Active())
+	assert.True(t, NewInjector("redis", 0.1, 0, 0).Active())
+	assert.True(t, NewInjector("redis", 0, 0.5, time.Millisecond).Active())
+}
+
+func TestInjector_Inject(t *testing.T) {
+	t.Run("never fails with zero rates", func(t *testing.T) {
+		injector := NewInjector("mysql", 0, 0, time.Hour)
+		for i := 0; i < 100; i++ {
+			assert.NoError(t, injector.Inject(context.Background()))
+		}
+	})
+
+	t.Run("always fails with full error rate", func(t *testing.T) {
+		injector := NewInjector("mysql", 1, 0, 0)
+		err := injector.Inject(context.Background())
+		assert.ErrorIs(t, err, ErrInjected)
+		assert.Contains(t, err.Error(), "mysql")
+	})
+
+	t.Run("fails when the roll is below the rate", func(t *testing.T) {
+		injector := NewInjector("mq", 0.3, 0, 0)
+		injector.roll = func() float64 { return 0.2 }
+		assert.ErrorIs(t, injector.Inject(context.Background()), ErrInjected)
+
+		injector.roll = func() float64 { return 0.3 }
+		assert.NoError(t, injector.Inject(context.Background()))
+	})
+
+	t.Run("adds latency", func(t *testing.T) {
+		injector := NewInjector("redis", 0, 1, 20*time.Millisecond)
+		start := time.Now()
+		assert.NoError(t, injector.Inject(context.Background()))
+		assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	})
+
+	t.Run("latency honours cancellation", func(t *testing.T) {
+		injector := NewInjector("redis", 0, 1, time.Hour)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, injector.Inject(ctx), context.Canceled)
+	})
+}
@@ -0,0 +1,251 @@
+// Package client is the Go SDK of the short link service: it creates short links and reads their
+// destination and stats over the HTTP API, retrying transient failures and authenticating with an
+// API key.
+//
+//	c, err := client.New(client.Config{BaseURL: "https://s.example.com", APIKey: key})
+//	link, err := c.Create(ctx, &client.CreateRequest{URL: "https://example.com/spring-sale"})
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIKeyHeader is the header the API key is sent in
+const APIKeyHeader = "X-API-Key"
+
+// Default settings of Config
+const (
+	DefaultTimeout  = 5 * time.Second
+	DefaultAttempts = 3
+	DefaultBackoff  = 200 * time.Millisecond
+)
+
+// maxRetryAfter caps how long a Retry-After header makes the client wait before retrying
+const maxRetryAfter = 30 * time.Second
+
+// ErrNotFound matches the errors of requests for short links that do not exist or expired
+var ErrNotFound = errors.New("client: short link not found")
+
+// Config represents the service a Client talks to
+type Config struct {
+	// BaseURL is the root of the service, like https://s.example.com
+	BaseURL string
+	// APIKey identifies the caller, sent in the X-API-Key header when set
+	APIKey string
+	// Timeout bounds every attempt of a request, DefaultTimeout when zero
+	Timeout time.Duration
+	// Attempts bounds the tries of a request, transient failures being retried after Backoff,
+	// doubled on every retry. DefaultAttempts and DefaultBackoff apply when zero.
+	Attempts int
+	Backoff  time.Duration
+	// HTTPClient sends the requests, http.DefaultClient when nil
+	HTTPClient *http.Client
+	// UserAgent is sent with every request when set
+	UserAgent string
+}
+
+// Client calls the short link service
+type Client struct {
+	cfg     Config
+	baseURL string
+}
+
+// Error is returned when the service answers with an error status
+type Error struct {
+	StatusCode int
+	Message    string
+	// Fields lists the rejected fields of an invalid request
+	Fields []FieldError
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	return fmt.Sprintf("client: status %d: %s", e.StatusCode, e.Message)
+}
+
+// Is matches ErrNotFound for 404 responses
+func (e *Error) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// New creates a Client
+func New(cfg Config) (*Client, error) {
+	u, err := url.Parse(cfg.BaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("client: invalid base URL %q", cfg.BaseURL)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.Attempts < 1 {
+		cfg.Attempts = DefaultAttempts
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultBackoff
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	return &Client{cfg: cfg, baseURL: strings.TrimSuffix(cfg.BaseURL, "/")}, nil
+}
+
+// Create creates a short link, or returns the existing one of the same destination. Since the
+// service deduplicates destinations, a retried creation does not create a second link.
+func (c *Client) Create(ctx context.Context, req *CreateRequest) (*Link, error) {
+	var link Link
+	if err := c.do(ctx, http.MethodPost, "/api/v1/shortlink/generate", req, &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// Resolve returns where a short link points without following it, expired links included with
+// their status
+func (c *Client) Resolve(ctx context.Context, shortCode string) (*Resolution, error) {
+	var resolution Resolution
+	if err := c.do(ctx, http.MethodGet, "/api/v1/shortlink/"+url.PathEscape(shortCode)+"/resolve", nil, &resolution); err != nil {
+		return nil, err
+	}
+	return &resolution, nil
+}
+
+// Sign returns a short link created with SignedParams with params appended and signed, so the
+// people following it cannot change them
+func (c *Client) Sign(ctx context.Context, shortCode string, params map[string]interface{}) (*SignedLink, error) {
+	var link SignedLink
+	body := map[string]interface{}{"params": params}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/shortlink/"+url.PathEscape(shortCode)+"/sign", body, &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// Stats returns the analytics of a short link, possibly lagging behind by the snapshot TTL of the
+// instance answering
+func (c *Client) Stats(ctx context.Context, shortCode string) (*Stats, error) {
+	var stats Stats
+	if err := c.do(ctx, http.MethodGet, "/api/v1/analytics/"+url.PathEscape(shortCode), nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// envelope is the standard response of the API, data being decoded into the caller's value
+type envelope struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+	Errors  []FieldError    `json:"errors"`
+}
+
+// do sends a request, retrying network failures, 429 and 5xx statuses except 501, and decodes the
+// data of the response into out
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("client: failed to encode request: %w", err)
+		}
+	}
+
+	backoff := c.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		wait, err := c.attempt(ctx, method, path, body, out)
+		if err == nil {
+			return nil
+		}
+		if wait < 0 || attempt >= c.cfg.Attempts || ctx.Err() != nil {
+			return err
+		}
+
+		if wait < backoff {
+			wait = backoff
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// attempt sends a request once. A failure is retried after at least the returned wait, or never
+// when it is negative.
+func (c *Client) attempt(ctx context.Context, method, path string, body []byte, out interface{}) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return -1, fmt.Errorf("client: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.cfg.APIKey != "" {
+		req.Header.Set(APIKeyHeader, c.cfg.APIKey)
+	}
+	if c.cfg.UserAgent != "" {
+		req.Header.Set("User-Agent", c.cfg.UserAgent)
+	}
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("client: %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("client: %s %s: %w", method, path, err)
+	}
+
+	var env envelope
+	decodeErr := json.Unmarshal(data, &env)
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &Error{StatusCode: resp.StatusCode, Message: env.Message, Fields: env.Errors}
+		if decodeErr != nil || apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		if !retryable(resp.StatusCode) {
+			return -1, apiErr
+		}
+		return retryAfter(resp.Header.Get("Retry-After")), apiErr
+	}
+	if decodeErr != nil {
+		return -1, fmt.Errorf("client: unexpected response to %s %s: %w", method, path, decodeErr)
+	}
+	if err := json.Unmarshal(env.Data, out); err != nil {
+		return -1, fmt.Errorf("client: unexpected data in response to %s %s: %w", method, path, err)
+	}
+	return 0, nil
+}
+
+// retryable reports whether a status is worth retrying
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || (status >= 500 && status != http.StatusNotImplemented)
+}
+
+// retryAfter parses the seconds of a Retry-After header, capped at maxRetryAfter
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return min(time.Duration(seconds)*time.Second, maxRetryAfter)
+}
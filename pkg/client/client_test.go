@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc, cfg Config) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg.BaseURL = server.URL + "/"
+	if cfg.Backoff == 0 {
+		cfg.Backoff = time.Millisecond
+	}
+	c, err := New(cfg)
+	require.NoError(t, err)
+	return c
+}
+
+func TestNew(t *testing.T) {
+	for _, baseURL := range []string{"", "s.example.com", "ftp://s.example.com", "https://"} {
+		_, err := New(Config{BaseURL: baseURL})
+		assert.Error(t, err, baseURL)
+	}
+
+	c, err := New(Config{BaseURL: "https://s.example.com/"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://s.example.com", c.baseURL)
+	assert.Equal(t, DefaultTimeout, c.cfg.Timeout)
+	assert.Equal(t, DefaultAttempts, c.cfg.Attempts)
+	assert.Equal(t, DefaultBackoff, c.cfg.Backoff)
+}
+
+func TestClient_Headers(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/shortlink/generate", r.URL.Path)
+		assert.Equal(t, "secret", r.Header.Get(APIKeyHeader))
+		assert.Equal(t, "billing/1.0", r.Header.Get("User-Agent"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		w.Write([]byte(`{"code":0,"message":"success","data":{"short_code":"ABCD"}}`))
+	}, Config{APIKey: "secret", UserAgent: "billing/1.0"})
+
+	link, err := c.Create(context.Background(), &CreateRequest{URL: "https://example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "ABCD", link.ShortCode)
+}
+
+func TestClient_Retries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int32
+		err      string
+	}{
+		{name: "transient failure", statuses: []int{http.StatusServiceUnavailable, http.StatusOK}, attempts: 2},
+		{name: "rate limited", statuses: []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusOK}, attempts: 3},
+		{name: "gives up", statuses: []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError}, attempts: 3,
+			err: "client: status 500: boom"},
+		{name: "client error is not retried", statuses: []int{http.StatusBadRequest}, attempts: 1, err: "client: status 400: boom"},
+		{name: "not implemented is not retried", statuses: []int{http.StatusNotImplemented}, attempts: 1, err: "client: status 501: boom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				status := tt.statuses[attempts.Add(1)-1]
+				w.WriteHeader(status)
+				if status != http.StatusOK {
+					w.Write([]byte(`{"code":1,"message":"boom"}`))
+					return
+				}
+				w.Write([]byte(`{"code":0,"message":"success","data":{"short_code":"ABCD","pv":3}}`))
+			}, Config{})
+
+			stats, err := c.Stats(context.Background(), "ABCD")
+			assert.Equal(t, tt.attempts, attempts.Load())
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), stats.PV)
+		})
+	}
+}
+
+func TestClient_RetryAfter(t *testing.T) {
+	var attempts atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"code":0,"message":"success","data":{"short_code":"ABCD"}}`))
+	}, Config{})
+
+	start := time.Now()
+	_, err := c.Resolve(context.Background(), "ABCD")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	t.Run("canceled context stops the retries", func(t *testing.T) {
+		attempts.Store(0)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := c.Resolve(ctx, "ABCD")
+		var apiErr *Error
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+		assert.Equal(t, "Service Unavailable", apiErr.Message)
+		assert.Equal(t, int32(1), attempts.Load())
+	})
+}
+
+func TestClient_Timeout(t *testing.T) {
+	var attempts atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		<-r.Context().Done()
+	}, Config{Timeout: 20 * time.Millisecond, Attempts: 2})
+
+	_, err := c.Resolve(context.Background(), "ABCD")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err)
+	assert.Equal(t, int32(2), attempts.Load())
+}
+
+func TestClient_NotFound(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":404,"message":"Short link not found"}`))
+	}, Config{})
+
+	_, err := c.Resolve(context.Background(), "ABCD")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.EqualError(t, err, "client: status 404: Short link not found")
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, 5*time.Second, retryAfter("5"))
+	assert.Equal(t, maxRetryAfter, retryAfter("3600"))
+	assert.Zero(t, retryAfter(""))
+	assert.Zero(t, retryAfter("Wed, 21 Oct 2015 07:28:00 GMT"))
+	assert.Zero(t, retryAfter("-1"))
+}
@@ -0,0 +1,212 @@
+package client_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"octopus/internal/handler"
+	"octopus/internal/mocks"
+	"octopus/internal/model"
+	"octopus/internal/repository"
+	"octopus/internal/service"
+	"octopus/pkg/client"
+	"octopus/pkg/middleware"
+)
+
+// newContractClient serves the handlers behind the SDK calls like the server does, on mocked
+// services, so that the SDK breaks when the API it decodes changes
+func newContractClient(t *testing.T, ctrl *gomock.Controller) (*client.Client, *mocks.MockShortLinkServiceInterface, *mocks.MockAnalyticsServiceInterface) {
+	gin.SetMode(gin.TestMode)
+	shortLinks := mocks.NewMockShortLinkServiceInterface(ctrl)
+	analytics := mocks.NewMockAnalyticsServiceInterface(ctrl)
+
+	router := gin.New()
+	router.Use(middleware.APIKey())
+	v1 := router.Group("/api/v1")
+	v1.POST("/shortlink/generate", handler.NewGenerateHandler(shortLinks).Generate)
+	v1.GET("/shortlink/:shortCode/resolve", handler.NewShortLinkHandler(shortLinks).Resolve)
+	v1.POST("/shortlink/:shortCode/sign", handler.NewShortLinkHandler(shortLinks).Sign)
+	v1.GET("/analytics/:shortCode", handler.NewRedirectHandler(shortLinks, analytics, nil).GetStats)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	c, err := client.New(client.Config{BaseURL: server.URL, APIKey: "billing", Backoff: time.Millisecond})
+	require.NoError(t, err)
+	return c, shortLinks, analytics
+}
+
+func TestContract_Create(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	c, shortLinks, _ := newContractClient(t, ctrl)
+
+	expireAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	shortLinks.EXPECT().Generate(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, req *model.GenerateRequest) (*model.GenerateResponse, error) {
+		assert.Equal(t, "billing", middleware.APIKeyFrom(ctx))
+		assert.Equal(t, &model.GenerateRequest{
+			URL:       "https://example.com/spring-sale",
+			Params:    map[string]interface{}{"utm_source": "mail"},
+			ExpireAt:  "2030-01-02T03:04:05Z",
+			MaxClicks: 100,
+			Title:     "Spring sale",
+		}, req)
+		return &model.GenerateResponse{
+			ShortLink: "https://s.example.com/ABCD", ShortCode: "ABCD", OriginalURL: req.URL, Params: req.Params, ExpireAt: expireAt,
+		}, nil
+	})
+
+	link, err := c.Create(context.Background(), &client.CreateRequest{
+		URL:       "https://example.com/spring-sale",
+		Params:    map[string]interface{}{"utm_source": "mail"},
+		ExpireAt:  expireAt.Format(time.RFC3339),
+		MaxClicks: 100,
+		Title:     "Spring sale",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &client.Link{
+		ShortLink: "https://s.example.com/ABCD", ShortCode: "ABCD", OriginalURL: "https://example.com/spring-sale",
+		Params: map[string]interface{}{"utm_source": "mail"}, ExpireAt: expireAt,
+	}, link)
+
+	t.Run("relative expiry", func(t *testing.T) {
+		shortLinks.EXPECT().Generate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, req *model.GenerateRequest) (*model.GenerateResponse, error) {
+			assert.Equal(t, "72h", req.TTL)
+			assert.Empty(t, req.ExpireAt)
+			return &model.GenerateResponse{ShortCode: "EFGH"}, nil
+		})
+
+		link, err := c.Create(context.Background(), &client.CreateRequest{URL: "https://example.com", TTL: "72h"})
+		require.NoError(t, err)
+		assert.Equal(t, "EFGH", link.ShortCode)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		_, err := c.Create(context.Background(), &client.CreateRequest{URL: "not a url"})
+		var apiErr *client.Error
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, 400, apiErr.StatusCode)
+		assert.Contains(t, apiErr.Message, "Invalid request")
+		assert.Equal(t, []client.FieldError{{Field: "url", Message: "must be an absolute URL"}}, apiErr.Fields)
+	})
+}
+
+func TestContract_Resolve(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	c, shortLinks, _ := newContractClient(t, ctrl)
+
+	createdAt := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	shortLinks.EXPECT().Resolve(gomock.Any(), "ABCD").Return(&model.ResolveResponse{
+		ShortLink:       "https://s.example.com/ABCD",
+		ShortCode:       "ABCD",
+		OriginalURL:     "https://example.com",
+		Status:          model.LinkStatusExpired,
+		Params:          map[string]interface{}{"utm_source": "mail"},
+		CreatedAt:       createdAt,
+		MaxClicks:       10,
+		Title:           "Spring sale",
+		PublicStats:     true,
+		TrackingEnabled: true,
+	}, nil)
+
+	resolution, err := c.Resolve(context.Background(), "ABCD")
+	require.NoError(t, err)
+	assert.Equal(t, &client.Resolution{
+		ShortLink:       "https://s.example.com/ABCD",
+		ShortCode:       "ABCD",
+		OriginalURL:     "https://example.com",
+		Status:          client.StatusExpired,
+		Params:          map[string]interface{}{"utm_source": "mail"},
+		CreatedAt:       createdAt,
+		MaxClicks:       10,
+		Title:           "Spring sale",
+		PublicStats:     true,
+		TrackingEnabled: true,
+	}, resolution)
+
+	t.Run("not found", func(t *testing.T) {
+		shortLinks.EXPECT().Resolve(gomock.Any(), "NONE").Return(nil, service.ErrShortLinkNotFound)
+
+		_, err := c.Resolve(context.Background(), "NONE")
+		assert.ErrorIs(t, err, client.ErrNotFound)
+	})
+
+	t.Run("storage outage is retried", func(t *testing.T) {
+		gomock.InOrder(
+			shortLinks.EXPECT().Resolve(gomock.Any(), "ABCD").Return(nil, repository.ErrUnavailable),
+			shortLinks.EXPECT().Resolve(gomock.Any(), "ABCD").Return(&model.ResolveResponse{ShortCode: "ABCD"}, nil),
+		)
+
+		resolution, err := c.Resolve(context.Background(), "ABCD")
+		require.NoError(t, err)
+		assert.Equal(t, "ABCD", resolution.ShortCode)
+	})
+}
+
+func TestContract_Sign(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	c, shortLinks, _ := newContractClient(t, ctrl)
+
+	shortLinks.EXPECT().SignParams(gomock.Any(), "ABCD", map[string]interface{}{"coupon": "SPRING10"}).Return(&model.SignParamsResponse{
+		ShortLink: "https://s.example.com/ABCD?coupon=SPRING10&sig=k1.c2ln",
+		Sig:       "k1.c2ln",
+	}, nil)
+
+	link, err := c.Sign(context.Background(), "ABCD", map[string]interface{}{"coupon": "SPRING10"})
+	require.NoError(t, err)
+	assert.Equal(t, &client.SignedLink{ShortLink: "https://s.example.com/ABCD?coupon=SPRING10&sig=k1.c2ln", Sig: "k1.c2ln"}, link)
+
+	t.Run("link without signed params", func(t *testing.T) {
+		shortLinks.EXPECT().SignParams(gomock.Any(), "EFGH", gomock.Any()).Return(nil, service.ErrParamsNotSigned)
+
+		_, err := c.Sign(context.Background(), "EFGH", map[string]interface{}{"coupon": "SPRING10"})
+		var apiErr *client.Error
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, 400, apiErr.StatusCode)
+	})
+}
+
+func TestContract_Stats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	c, shortLinks, analytics := newContractClient(t, ctrl)
+
+	shortLinks.EXPECT().Get(gomock.Any(), "ABCD").Return(&model.ShortLink{ShortCode: "ABCD"}, nil)
+	analytics.EXPECT().GetAnalytics(gomock.Any(), "ABCD", false).Return(&model.AnalyticsResponse{
+		ShortCode:      "ABCD",
+		PV:             120,
+		UV:             80,
+		Conversions:    6,
+		ConversionRate: 0.05,
+		TopSources:     []model.SourceStat{{Source: "google", Count: 100, Conversions: 5, ConversionRate: 0.05}},
+		Retention:      model.StatsRetention{PV: "forever", UV: "90d", Sources: "90d"},
+	}, nil)
+
+	stats, err := c.Stats(context.Background(), "ABCD")
+	require.NoError(t, err)
+	assert.Equal(t, &client.Stats{
+		ShortCode:      "ABCD",
+		PV:             120,
+		UV:             80,
+		Conversions:    6,
+		ConversionRate: 0.05,
+		TopSources:     []client.SourceStat{{Source: "google", Count: 100, Conversions: 5, ConversionRate: 0.05}},
+		Retention:      client.StatsRetention{PV: "forever", UV: "90d", Sources: "90d"},
+	}, stats)
+
+	t.Run("not found", func(t *testing.T) {
+		shortLinks.EXPECT().Get(gomock.Any(), "NONE").Return(nil, service.ErrShortLinkNotFound)
+
+		_, err := c.Stats(context.Background(), "NONE")
+		assert.ErrorIs(t, err, client.ErrNotFound)
+	})
+}
@@ -0,0 +1,157 @@
+package client
+
+import "time"
+
+// Link statuses of a Resolution, used single-use links being reported as used rather than disabled
+const (
+	StatusActive   = "active"
+	StatusDisabled = "disabled"
+	StatusExpired  = "expired"
+	StatusUsed     = "used"
+)
+
+// CreateRequest represents a short link to create
+type CreateRequest struct {
+	URL string `json:"url"`
+	// Params are added to the query of the destination on every redirect, values being strings,
+	// numbers or booleans
+	Params map[string]interface{} `json:"params,omitempty"`
+	// ExpireAt is an RFC 3339 time, the link never expires when empty
+	ExpireAt string `json:"expire_at,omitempty"`
+	// TTL or ExpireInSeconds expire the link relative to its creation on the clock of the service,
+	// instead of ExpireAt. TTL is a Go duration like 72h.
+	TTL             string `json:"ttl,omitempty"`
+	ExpireInSeconds int64  `json:"expire_in_seconds,omitempty"`
+	// SMS creates an ultra-short code of the SMS pool
+	SMS           bool   `json:"sms,omitempty"`
+	NoClickID     bool   `json:"no_click_id,omitempty"`
+	MaxClicks     int64  `json:"max_clicks,omitempty"`
+	PreserveQuery bool   `json:"preserve_query,omitempty"`
+	Title         string `json:"title,omitempty"`
+	Description   string `json:"description,omitempty"`
+	Notes         string `json:"notes,omitempty"`
+	PublicStats   bool   `json:"public_stats,omitempty"`
+	// TrackingEnabled set to false redirects without recording analytics, nil keeps tracking on
+	TrackingEnabled *bool `json:"tracking_enabled,omitempty"`
+	// CacheControl replaces the Cache-Control the service sends with redirects, like
+	// "public, max-age=300"
+	CacheControl string `json:"cache_control,omitempty"`
+	// SignedParams only honors params appended to the link with a signature from Client.Sign
+	SignedParams bool `json:"signed_params,omitempty"`
+	// SingleUse disables the link on its first redirect, later visitors being told it was used
+	SingleUse bool `json:"single_use,omitempty"`
+	// AllowedReferrers only redirects visitors referred from these domains or their subdomains,
+	// like "news.example.com"
+	AllowedReferrers []string `json:"allowed_referrers,omitempty"`
+	// AllowedCountries only redirects visitors from these countries, given by their ISO 3166-1
+	// alpha-2 codes like "FR"; BlockedCountries refuses visitors from these instead
+	AllowedCountries []string `json:"allowed_countries,omitempty"`
+	BlockedCountries []string `json:"blocked_countries,omitempty"`
+	// Schedule routes redirects to other destinations by day of the week and time of day
+	Schedule *Schedule `json:"schedule,omitempty"`
+}
+
+// Schedule routes the redirects of a link by the first rule matching their time, in Timezone or
+// the one configured on the service. Redirects matching no rule go to the URL of the link.
+type Schedule struct {
+	Timezone string         `json:"timezone,omitempty"`
+	Rules    []ScheduleRule `json:"rules"`
+}
+
+// ScheduleRule routes redirects on Days, a cron day-of-week field like "mon-fri", from From to
+// To, HH:MM times omitted for the whole day, to URL
+type ScheduleRule struct {
+	Days string `json:"days"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	URL  string `json:"url"`
+}
+
+// Link represents a created short link
+type Link struct {
+	ShortLink   string                 `json:"short_link"`
+	ShortCode   string                 `json:"short_code"`
+	OriginalURL string                 `json:"original_url"`
+	Params      map[string]interface{} `json:"params,omitempty"`
+	ExpireAt    time.Time              `json:"expire_at"`
+	// TrackingEnabled tells whether redirects are recorded in the analytics
+	TrackingEnabled bool `json:"tracking_enabled"`
+	// SignedParams tells whether params appended to the link must be signed
+	SignedParams bool `json:"signed_params,omitempty"`
+	// SingleUse tells whether the link is disabled by its first redirect
+	SingleUse bool `json:"single_use,omitempty"`
+}
+
+// SignedLink represents a short link with params appended and signed
+type SignedLink struct {
+	ShortLink string `json:"short_link"`
+	Sig       string `json:"sig"`
+}
+
+// Resolution represents where a short link points
+type Resolution struct {
+	ShortLink   string                 `json:"short_link"`
+	ShortCode   string                 `json:"short_code"`
+	OriginalURL string                 `json:"original_url"`
+	Status      string                 `json:"status"`
+	Params      map[string]interface{} `json:"params,omitempty"`
+	Pool        string                 `json:"pool,omitempty"`
+	CreatedAt   time.Time              `json:"created_at"`
+	ExpireAt    *time.Time             `json:"expire_at,omitempty"`
+	MaxClicks   int64                  `json:"max_clicks,omitempty"`
+	Title       string                 `json:"title,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Notes       string                 `json:"notes,omitempty"`
+	Managed     bool                   `json:"managed,omitempty"`
+	PublicStats bool                   `json:"public_stats,omitempty"`
+	// TrackingEnabled tells whether redirects are recorded in the analytics
+	TrackingEnabled bool `json:"tracking_enabled"`
+	// CacheControl is sent with redirects instead of the configured Cache-Control when set
+	CacheControl string `json:"cache_control,omitempty"`
+	// SignedParams tells whether params appended to the link must be signed
+	SignedParams bool `json:"signed_params,omitempty"`
+	// SingleUse tells whether the link is disabled by its first redirect, its status being used
+	// once it was
+	SingleUse bool `json:"single_use,omitempty"`
+	// AllowedReferrers are the domains visitors must be referred from, any when empty
+	AllowedReferrers []string `json:"allowed_referrers,omitempty"`
+	// AllowedCountries or BlockedCountries are the countries redirects are limited to or
+	// refused in
+	AllowedCountries []string `json:"allowed_countries,omitempty"`
+	BlockedCountries []string `json:"blocked_countries,omitempty"`
+	// Schedule routes redirects to other destinations by day and time, nil when it does not
+	Schedule *Schedule `json:"schedule,omitempty"`
+}
+
+// Stats represents the analytics of a short link
+type Stats struct {
+	ShortCode      string       `json:"short_code"`
+	PV             int64        `json:"pv"`
+	UV             int64        `json:"uv"`
+	Conversions    int64        `json:"conversions"`
+	ConversionRate float64      `json:"conversion_rate"`
+	TopSources     []SourceStat `json:"top_sources"`
+	// Retention tells how long the counters are kept, per counter
+	Retention StatsRetention `json:"retention"`
+}
+
+// SourceStat represents the clicks and conversions of a traffic source
+type SourceStat struct {
+	Source         string  `json:"source"`
+	Count          int64   `json:"count"`
+	Conversions    int64   `json:"conversions"`
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+// StatsRetention represents how long each counter of Stats is kept
+type StatsRetention struct {
+	PV      string `json:"pv"`
+	UV      string `json:"uv"`
+	Sources string `json:"sources"`
+}
+
+// FieldError describes why a field of a request was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,55 @@
+// Package clock abstracts the current time, so that expiry, daily bucketing and cleanup can be
+// tested at the instants they are hard to reach at, like midnight or an expiry boundary.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time
+type Clock interface {
+	Now() time.Time
+}
+
+// Real is the system clock
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+// Now returns time.Now()
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Fake is a clock standing still until set or advanced, safe for concurrent use
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFake creates a Fake clock telling now
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the time the clock was set to
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Set moves the clock to now
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+}
+
+// Advance moves the clock forward by d
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
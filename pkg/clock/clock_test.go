@@ -0,0 +1,41 @@
+package clock
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReal(t *testing.T) {
+	before := time.Now()
+	now := Real.Now()
+	assert.False(t, now.Before(before))
+	assert.False(t, now.After(time.Now()))
+}
+
+func TestFake(t *testing.T) {
+	start := time.Date(2024, 3, 1, 23, 59, 59, 0, time.UTC)
+	f := NewFake(start)
+	assert.Equal(t, start, f.Now())
+	assert.Equal(t, start, f.Now(), "stands still")
+
+	f.Advance(time.Second)
+	assert.Equal(t, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), f.Now())
+
+	f.Set(start)
+	assert.Equal(t, start, f.Now())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.Advance(time.Minute)
+			f.Now()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, start.Add(10*time.Minute), f.Now())
+}
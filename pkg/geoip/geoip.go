@@ -0,0 +1,146 @@
+// Package geoip finds the country of visitors, from the header a CDN sets with it or from a
+// database of IP ranges in the CSV format published by DB-IP and others: one start_ip,end_ip,
+// country row per range, countries being ISO 3166-1 alpha-2 codes.
+package geoip
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ipRange is a range of IP addresses located in a country
+type ipRange struct {
+	from    netip.Addr
+	to      netip.Addr
+	country string
+}
+
+// Database locates IP addresses by the ranges they fall in
+type Database struct {
+	ranges []ipRange
+}
+
+// Load reads a database of IP ranges from a CSV file
+func Load(path string) (*Database, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse reads a database of IP ranges from CSV rows of start_ip,end_ip,country, IPv4 and IPv6
+// alike. Further columns are ignored, as are rows without a country such as ZZ for reserved
+// ranges.
+func Parse(r io.Reader) (*Database, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	db := &Database{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("geoip: line %d: expected start_ip,end_ip,country", line)
+		}
+		from, err := netip.ParseAddr(strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, fmt.Errorf("geoip: line %d: %w", line, err)
+		}
+		to, err := netip.ParseAddr(strings.TrimSpace(record[1]))
+		if err != nil {
+			return nil, fmt.Errorf("geoip: line %d: %w", line, err)
+		}
+		from, to = from.Unmap(), to.Unmap()
+		if from.BitLen() != to.BitLen() || to.Less(from) {
+			return nil, fmt.Errorf("geoip: line %d: %s-%s is not a range", line, from, to)
+		}
+		country, ok := NormalizeCountry(record[2])
+		if !ok {
+			continue
+		}
+		db.ranges = append(db.ranges, ipRange{from: from, to: to, country: country})
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return db.ranges[i].from.Less(db.ranges[j].from)
+	})
+	return db, nil
+}
+
+// Len returns the number of ranges located in a country
+func (d *Database) Len() int {
+	return len(d.ranges)
+}
+
+// Country returns the country of an IP address, "" when it is in no range
+func (d *Database) Country(ip netip.Addr) string {
+	ip = ip.Unmap()
+	// The last range starting at or before the address is the only one that may hold it
+	i := sort.Search(len(d.ranges), func(i int) bool {
+		return ip.Less(d.ranges[i].from)
+	}) - 1
+	if i < 0 || d.ranges[i].to.Less(ip) || d.ranges[i].from.BitLen() != ip.BitLen() {
+		return ""
+	}
+	return d.ranges[i].country
+}
+
+// NormalizeCountry returns the upper case form of an ISO 3166-1 alpha-2 country code, reporting
+// false for anything else and for the codes standing for an unknown country
+func NormalizeCountry(code string) (string, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return "", false
+	}
+	if code == "XX" || code == "ZZ" {
+		return "", false
+	}
+	return code, true
+}
+
+// Locator finds the country of the visitor of a request
+type Locator struct {
+	db     *Database
+	header string
+}
+
+// NewLocator creates a Locator trusting the country a CDN sets in header, when not empty, and
+// otherwise looking the client IP up in db, when not nil
+func NewLocator(db *Database, header string) *Locator {
+	return &Locator{
+		db:     db,
+		header: header,
+	}
+}
+
+// Country returns the country of the visitor of a request from clientIP, "" when it is unknown
+func (l *Locator) Country(r *http.Request, clientIP string) string {
+	if l.header != "" {
+		if country, ok := NormalizeCountry(r.Header.Get(l.header)); ok {
+			return country
+		}
+	}
+	if l.db == nil {
+		return ""
+	}
+	ip, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return ""
+	}
+	return l.db.Country(ip)
+}
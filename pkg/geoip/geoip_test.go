@@ -0,0 +1,79 @@
+package geoip
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDatabase = `1.0.0.0,1.0.0.255,AU
+"2.16.0.0","2.16.255.255","fr","extra"
+10.0.0.0,10.255.255.255,ZZ
+81.2.69.0,81.2.69.255,GB
+2001:db8::,2001:db8:ffff:ffff:ffff:ffff:ffff:ffff,DE
+`
+
+func TestDatabase_Country(t *testing.T) {
+	db, err := Parse(strings.NewReader(testDatabase))
+	require.NoError(t, err)
+	assert.Equal(t, 4, db.Len())
+
+	for ip, want := range map[string]string{
+		"1.0.0.0":          "AU",
+		"1.0.0.255":        "AU",
+		"1.0.1.0":          "",
+		"2.16.4.1":         "FR",
+		"::ffff:81.2.69.7": "GB",
+		"10.1.2.3":         "",
+		"0.0.0.1":          "",
+		"2001:db8::1":      "DE",
+		"2001:db9::1":      "",
+		"::1":              "",
+	} {
+		assert.Equal(t, want, db.Country(netip.MustParseAddr(ip)), ip)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for name, data := range map[string]string{
+		"missing column":  "1.0.0.0,1.0.0.255\n",
+		"invalid address": "1.0.0.0,1.0.0.256,AU\n",
+		"reversed range":  "1.0.0.255,1.0.0.0,AU\n",
+		"mixed families":  "1.0.0.0,2001:db8::,AU\n",
+	} {
+		_, err := Parse(strings.NewReader(data))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestNormalizeCountry(t *testing.T) {
+	country, ok := NormalizeCountry(" de ")
+	assert.True(t, ok)
+	assert.Equal(t, "DE", country)
+	for _, code := range []string{"", "DEU", "T1", "XX", "zz"} {
+		_, ok := NormalizeCountry(code)
+		assert.False(t, ok, code)
+	}
+}
+
+func TestLocator_Country(t *testing.T) {
+	db, err := Parse(strings.NewReader(testDatabase))
+	require.NoError(t, err)
+	locator := NewLocator(db, "CF-IPCountry")
+
+	r, _ := http.NewRequest(http.MethodGet, "/ABCD", nil)
+	assert.Equal(t, "GB", locator.Country(r, "81.2.69.7"))
+	assert.Empty(t, locator.Country(r, "not an ip"))
+
+	// The country set by the CDN wins, unless it does not know it either
+	r.Header.Set("CF-IPCountry", "ch")
+	assert.Equal(t, "CH", locator.Country(r, "81.2.69.7"))
+	r.Header.Set("CF-IPCountry", "XX")
+	assert.Equal(t, "GB", locator.Country(r, "81.2.69.7"))
+
+	assert.Empty(t, NewLocator(nil, "").Country(r, "81.2.69.7"))
+}
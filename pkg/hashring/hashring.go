@@ -0,0 +1,78 @@
+package hashring
+
+import (
+	"hash/fnv"
+	"slices"
+	"strconv"
+)
+
+// Ring maps keys onto a set of named nodes by consistent hashing. Every node is placed on the
+// ring at several virtual points, so keys spread evenly and adding or removing a node only moves
+// the keys of the points it gains or loses.
+type Ring struct {
+	points []uint64
+	owners map[uint64]string
+	nodes  []string
+}
+
+// New creates a ring of the given nodes, each placed at virtualNodes points
+func New(virtualNodes int, nodes ...string) *Ring {
+	if virtualNodes <= 0 {
+		virtualNodes = 1
+	}
+
+	r := &Ring{
+		owners: make(map[uint64]string, len(nodes)*virtualNodes),
+		nodes:  slices.Clone(nodes),
+	}
+	for _, node := range nodes {
+		for i := 0; i < virtualNodes; i++ {
+			point := hash(node + "#" + strconv.Itoa(i))
+			owner, taken := r.owners[point]
+			if !taken {
+				r.points = append(r.points, point)
+			}
+			// Colliding points go to the lowest node name, whatever the order of the nodes
+			if !taken || node < owner {
+				r.owners[point] = node
+			}
+		}
+	}
+	slices.Sort(r.points)
+	return r
+}
+
+// Get returns the node owning a key, the one at the first point clockwise from its hash, or an
+// empty string for a ring without nodes
+func (r *Ring) Get(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+
+	h := hash(key)
+	i, _ := slices.BinarySearch(r.points, h)
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// Nodes returns the nodes of the ring in the order they were given
+func (r *Ring) Nodes() []string {
+	return slices.Clone(r.nodes)
+}
+
+// hash places a key or virtual node on the ring. FNV-1a alone barely spreads keys differing in
+// their last characters, such as consecutive virtual nodes, so its sum is mixed with the
+// MurmurHash3 finalizer.
+func hash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,56 @@
+package hashring
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing_Get(t *testing.T) {
+	t.Run("empty ring owns nothing", func(t *testing.T) {
+		assert.Equal(t, "", New(100).Get("ABCD"))
+	})
+
+	t.Run("single node owns every key", func(t *testing.T) {
+		r := New(100, "a")
+		assert.Equal(t, "a", r.Get("ABCD"))
+		assert.Equal(t, "a", r.Get("https://example.com"))
+	})
+
+	t.Run("owner does not depend on the node order", func(t *testing.T) {
+		r1 := New(100, "a", "b", "c")
+		r2 := New(100, "c", "a", "b")
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			assert.Equal(t, r1.Get(key), r2.Get(key))
+		}
+	})
+
+	t.Run("keys spread over the nodes", func(t *testing.T) {
+		r := New(160, "a", "b", "c", "d")
+		counts := make(map[string]int)
+		for i := 0; i < 10000; i++ {
+			counts[r.Get(fmt.Sprintf("key-%d", i))]++
+		}
+		for _, node := range r.Nodes() {
+			assert.InDelta(t, 2500, counts[node], 750, "keys of %s", node)
+		}
+	})
+}
+
+func TestRing_AddNode(t *testing.T) {
+	before := New(160, "a", "b", "c")
+	after := New(160, "a", "b", "c", "d")
+
+	moved := 0
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if owner := after.Get(key); owner != before.Get(key) {
+			// Keys only ever move to the new node
+			assert.Equal(t, "d", owner)
+			moved++
+		}
+	}
+	assert.InDelta(t, 2500, moved, 750)
+}
@@ -0,0 +1,117 @@
+// Package logging filters log events by the module logging them and samples high-volume messages,
+// without changing the call sites using the global zerolog logger.
+package logging
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// Filter is a zerolog hook discarding the events below the level of the module logging them, and
+// the high-volume messages sampled out. The logger must let through MinLevel, as hooks only see
+// the events passing its level.
+type Filter struct {
+	level    zerolog.Level
+	modules  map[string]zerolog.Level
+	samplers map[string]zerolog.Sampler
+
+	// callers caches the module of program counters, "" for the frames of zerolog and this package
+	callers sync.Map
+}
+
+// NewFilter creates a filter logging the events of modules without their own level from level up
+func NewFilter(level zerolog.Level) *Filter {
+	return &Filter{
+		level:    level,
+		modules:  make(map[string]zerolog.Level),
+		samplers: make(map[string]zerolog.Sampler),
+	}
+}
+
+// SetModuleLevel logs the events of a module, the last element of its package path, from level up
+func (f *Filter) SetModuleLevel(module string, level zerolog.Level) {
+	f.modules[module] = level
+}
+
+// Sample samples the debug and info events with the given message
+func (f *Filter) Sample(message string, sampler zerolog.Sampler) {
+	f.samplers[message] = sampler
+}
+
+// MinLevel returns the lowest level any module logs
+func (f *Filter) MinLevel() zerolog.Level {
+	level := f.level
+	for _, l := range f.modules {
+		if l < level {
+			level = l
+		}
+	}
+	return level
+}
+
+// Run implements zerolog.Hook
+func (f *Filter) Run(e *zerolog.Event, level zerolog.Level, message string) {
+	min := f.level
+	if len(f.modules) > 0 {
+		if l, ok := f.modules[f.caller()]; ok {
+			min = l
+		}
+	}
+	if level < min {
+		e.Discard()
+		return
+	}
+
+	if level > zerolog.InfoLevel {
+		return
+	}
+	if sampler, ok := f.samplers[message]; ok && !sampler.Sample(level) {
+		e.Discard()
+	}
+}
+
+// caller returns the module of the function logging the event being run
+func (f *Filter) caller() string {
+	var pcs [16]uintptr
+	n := runtime.Callers(3, pcs[:])
+	for _, pc := range pcs[:n] {
+		if module := f.module(pc); module != "" {
+			return module
+		}
+	}
+	return ""
+}
+
+// module returns the module of the function at a program counter, "" for zerolog and this package
+func (f *Filter) module(pc uintptr) string {
+	if module, ok := f.callers.Load(pc); ok {
+		return module.(string)
+	}
+
+	var module string
+	if fn := runtime.FuncForPC(pc - 1); fn != nil {
+		module = Module(fn.Name())
+	}
+	f.callers.Store(pc, module)
+	return module
+}
+
+// Module returns the module of a function name as reported by the runtime, the last element of its
+// package path: "repository" for "octopus/internal/repository.(*MySQLRepository).Close". Functions
+// of zerolog and of this package have none.
+func Module(function string) string {
+	if strings.HasPrefix(function, "github.com/rs/zerolog") || strings.HasPrefix(function, "octopus/pkg/logging.") {
+		return ""
+	}
+	pkg := function
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	if i := strings.Index(pkg, "."); i >= 0 {
+		pkg = pkg[:i]
+	}
+	return pkg
+}
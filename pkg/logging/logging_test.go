@@ -0,0 +1,64 @@
+// Tests log from outside the package, as the filter skips its frames looking for the module
+package logging_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"octopus/pkg/logging"
+)
+
+func TestModule(t *testing.T) {
+	assert.Equal(t, "repository", logging.Module("octopus/internal/repository.(*MySQLRepository).Close"))
+	assert.Equal(t, "main", logging.Module("main.main"))
+	assert.Equal(t, "handler", logging.Module("octopus/internal/handler.(*RedirectHandler).Redirect.func1"))
+	assert.Empty(t, logging.Module("github.com/rs/zerolog.(*Event).Msg"))
+	assert.Empty(t, logging.Module("octopus/pkg/logging.(*Filter).Run"))
+}
+
+func TestFilter_ModuleLevels(t *testing.T) {
+	filter := logging.NewFilter(zerolog.WarnLevel)
+	filter.SetModuleLevel("logging_test", zerolog.DebugLevel)
+	assert.Equal(t, zerolog.DebugLevel, filter.MinLevel())
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf).Level(filter.MinLevel()).Hook(filter)
+	logger.Debug().Msg("test module")
+	assert.Contains(t, buf.String(), "test module")
+
+	// Modules without their own level log from the base level up
+	filter = logging.NewFilter(zerolog.WarnLevel)
+	filter.SetModuleLevel("repository", zerolog.DebugLevel)
+	buf.Reset()
+	logger = zerolog.New(&buf).Level(filter.MinLevel()).Hook(filter)
+	logger.Info().Msg("other module")
+	assert.Empty(t, buf.String())
+	logger.Warn().Msg("warning")
+	assert.Contains(t, buf.String(), "warning")
+}
+
+func TestFilter_Sample(t *testing.T) {
+	filter := logging.NewFilter(zerolog.DebugLevel)
+	filter.Sample("HTTP request", &zerolog.BurstSampler{Burst: 2, Period: time.Hour})
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf).Hook(filter)
+	for range 5 {
+		logger.Info().Msg("HTTP request")
+	}
+	assert.Equal(t, 2, strings.Count(buf.String(), "HTTP request"))
+
+	// Other messages and errors are never sampled
+	buf.Reset()
+	for range 3 {
+		logger.Info().Msg("Link created")
+		logger.Error().Msg("HTTP request")
+	}
+	assert.Equal(t, 3, strings.Count(buf.String(), "Link created"))
+	assert.Equal(t, 3, strings.Count(buf.String(), "HTTP request"))
+}
@@ -0,0 +1,152 @@
+// Package mailer sends emails through an SMTP server, retrying transient failures, or writes them
+// to a directory instead when running dry for development.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"octopus/pkg/clock"
+)
+
+// ErrDisabled is returned when sending without a server or a dry-run directory
+var ErrDisabled = errors.New("mailer: no SMTP server configured")
+
+// Config represents the SMTP server emails are sent through
+type Config struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+	// DryRunDir receives the emails as .eml files instead of the server when set
+	DryRunDir string
+	// Attempts bounds the tries of an email, transient failures being retried after Backoff,
+	// doubled on every retry
+	Attempts int
+	Backoff  time.Duration
+}
+
+// Message represents an email
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+	// HTML sends Body as text/html instead of text/plain
+	HTML bool
+}
+
+// Mailer sends emails
+type Mailer struct {
+	cfg      Config
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+	clock    clock.Clock
+}
+
+// New creates a Mailer
+func New(cfg Config) *Mailer {
+	if cfg.Attempts < 1 {
+		cfg.Attempts = 1
+	}
+	return &Mailer{cfg: cfg, sendMail: smtp.SendMail, clock: clock.Real}
+}
+
+// Enabled reports whether emails go anywhere
+func (m *Mailer) Enabled() bool {
+	return m.cfg.Addr != "" || m.cfg.DryRunDir != ""
+}
+
+// Send sends an email. The SMTP client does not take a context, so ctx only stops the retries and
+// the server's own timeouts apply to every attempt. Rejections with a permanent 5xx status are not
+// retried.
+func (m *Mailer) Send(ctx context.Context, msg *Message) error {
+	if len(msg.To) == 0 {
+		return errors.New("mailer: no recipient")
+	}
+	data := m.build(msg)
+
+	if m.cfg.DryRunDir != "" {
+		return m.writeDryRun(msg, data)
+	}
+	if m.cfg.Addr == "" {
+		return ErrDisabled
+	}
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		host, _, err := net.SplitHostPort(m.cfg.Addr)
+		if err != nil {
+			return fmt.Errorf("mailer: invalid address: %w", err)
+		}
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, host)
+	}
+
+	backoff := m.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		err := m.sendMail(m.cfg.Addr, auth, m.cfg.From, msg.To, data)
+		if err == nil {
+			return nil
+		}
+		if attempt >= m.cfg.Attempts || permanent(err) {
+			return fmt.Errorf("mailer: failed to send %q after %d attempts: %w", msg.Subject, attempt, err)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("mailer: failed to send %q: %w", msg.Subject, err)
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// permanent reports whether the server rejected an email for good
+func permanent(err error) bool {
+	var protoErr *textproto.Error
+	return errors.As(err, &protoErr) && protoErr.Code >= 500
+}
+
+// build formats an email with its headers
+func (m *Mailer) build(msg *Message) []byte {
+	contentType := "text/plain"
+	if msg.HTML {
+		contentType = "text/html"
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", m.clock.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: %s; charset=UTF-8\r\n\r\n", contentType)
+	buf.WriteString(msg.Body)
+	return buf.Bytes()
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+
+// writeDryRun writes an email to the dry-run directory, named after its time and subject
+func (m *Mailer) writeDryRun(msg *Message, data []byte) error {
+	if err := os.MkdirAll(m.cfg.DryRunDir, 0o755); err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	name := m.clock.Now().UTC().Format("20060102T150405.000000000") + "-" +
+		strings.Trim(unsafeFileChars.ReplaceAllString(msg.Subject, "-"), "-") + ".eml"
+	if err := os.WriteFile(filepath.Join(m.cfg.DryRunDir, name), data, 0o644); err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	return nil
+}
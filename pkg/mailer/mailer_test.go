@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"octopus/pkg/clock"
+)
+
+func newTestMailer(cfg Config, send func(to []string, msg []byte) error) *Mailer {
+	m := New(cfg)
+	m.clock = clock.NewFake(time.Date(2024, 1, 8, 8, 0, 0, 0, time.UTC))
+	m.sendMail = func(_ string, _ smtp.Auth, _ string, to []string, msg []byte) error {
+		return send(to, msg)
+	}
+	return m
+}
+
+func TestMailer_Send(t *testing.T) {
+	msg := &Message{To: []string{"team@example.com", "ops@example.com"}, Subject: "Weekly report", Body: "<p>Hi</p>", HTML: true}
+	cfg := Config{Addr: "smtp.example.com:587", Username: "reports", Password: "secret", From: "reports@example.com", Attempts: 3, Backoff: time.Millisecond}
+
+	t.Run("formats the email", func(t *testing.T) {
+		var sent []byte
+		m := newTestMailer(cfg, func(to []string, data []byte) error {
+			assert.Equal(t, msg.To, to)
+			sent = data
+			return nil
+		})
+
+		require.NoError(t, m.Send(context.Background(), msg))
+		assert.Equal(t, "From: reports@example.com\r\n"+
+			"To: team@example.com, ops@example.com\r\n"+
+			"Subject: Weekly report\r\n"+
+			"Date: Mon, 08 Jan 2024 08:00:00 +0000\r\n"+
+			"MIME-Version: 1.0\r\n"+
+			"Content-Type: text/html; charset=UTF-8\r\n\r\n"+
+			"<p>Hi</p>", string(sent))
+	})
+
+	t.Run("retries transient failures", func(t *testing.T) {
+		attempts := 0
+		m := newTestMailer(cfg, func([]string, []byte) error {
+			attempts++
+			if attempts < 3 {
+				return &textproto.Error{Code: 421, Msg: "try again later"}
+			}
+			return nil
+		})
+
+		require.NoError(t, m.Send(context.Background(), msg))
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("gives up after the attempts", func(t *testing.T) {
+		attempts := 0
+		m := newTestMailer(cfg, func([]string, []byte) error {
+			attempts++
+			return errors.New("connection refused")
+		})
+
+		assert.ErrorContains(t, m.Send(context.Background(), msg), "after 3 attempts: connection refused")
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("permanent rejection is not retried", func(t *testing.T) {
+		attempts := 0
+		m := newTestMailer(cfg, func([]string, []byte) error {
+			attempts++
+			return &textproto.Error{Code: 550, Msg: "mailbox unavailable"}
+		})
+
+		assert.Error(t, m.Send(context.Background(), msg))
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("without recipient", func(t *testing.T) {
+		m := newTestMailer(cfg, func([]string, []byte) error { return nil })
+		assert.Error(t, m.Send(context.Background(), &Message{Subject: "Weekly report"}))
+	})
+
+	t.Run("without server", func(t *testing.T) {
+		m := New(Config{})
+		assert.False(t, m.Enabled())
+		assert.ErrorIs(t, m.Send(context.Background(), msg), ErrDisabled)
+	})
+}
+
+func TestMailer_DryRun(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := newTestMailer(Config{From: "reports@example.com", DryRunDir: dir}, func([]string, []byte) error {
+		t.Fatal("dry run reached the server")
+		return nil
+	})
+	assert.True(t, m.Enabled())
+
+	require.NoError(t, m.Send(context.Background(), &Message{To: []string{"team@example.com"}, Subject: "Weekly report: 2024/01", Body: "Hi"}))
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "20240108T080000.000000000-Weekly-report-2024-01.eml", files[0].Name())
+	data, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "Content-Type: text/plain; charset=UTF-8\r\n\r\nHi")
+}
@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// Template renders emails, the subject as text and the body as HTML escaping the data
+type Template struct {
+	subject *texttemplate.Template
+	body    *htmltemplate.Template
+}
+
+// ParseTemplate parses the subject and body of an email, both calling funcs
+func ParseTemplate(name, subject, body string, funcs map[string]any) (*Template, error) {
+	s, err := texttemplate.New(name + ".subject").Funcs(funcs).Parse(subject)
+	if err != nil {
+		return nil, fmt.Errorf("mailer: %w", err)
+	}
+	b, err := htmltemplate.New(name + ".body").Funcs(funcs).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("mailer: %w", err)
+	}
+	return &Template{subject: s, body: b}, nil
+}
+
+// MustParseTemplate is like ParseTemplate but panics on errors, for templates known at compile time
+func MustParseTemplate(name, subject, body string, funcs map[string]any) *Template {
+	t, err := ParseTemplate(name, subject, body, funcs)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Render renders an HTML email to the recipients
+func (t *Template) Render(to []string, data any) (*Message, error) {
+	var subject, body bytes.Buffer
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return nil, fmt.Errorf("mailer: %w", err)
+	}
+	if err := t.body.Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("mailer: %w", err)
+	}
+	return &Message{To: to, Subject: subject.String(), Body: body.String(), HTML: true}, nil
+}
@@ -0,0 +1,24 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_Render(t *testing.T) {
+	tmpl := MustParseTemplate("alert", "{{upper .Name}} & co", "<p>{{.Name}}</p>", map[string]any{"upper": strings.ToUpper})
+
+	msg, err := tmpl.Render([]string{"ops@example.com"}, map[string]string{"Name": "<b>spring</b>"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ops@example.com"}, msg.To)
+	assert.Equal(t, "<B>SPRING</B> & co", msg.Subject)
+	assert.Equal(t, "<p>&lt;b&gt;spring&lt;/b&gt;</p>", msg.Body)
+	assert.True(t, msg.HTML)
+
+	_, err = ParseTemplate("broken", "{{.Name", "", nil)
+	assert.Error(t, err)
+	assert.Panics(t, func() { MustParseTemplate("broken", "", "{{end}}", nil) })
+}
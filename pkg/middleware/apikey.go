@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader is the header callers identify themselves with
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyContextKey keys the API key of the caller in a request context
+type apiKeyContextKey struct{}
+
+// APIKey returns a gin middleware keeping the API key of the caller in the request context, so
+// features can be rolled out per caller. The key only identifies the caller, it is not verified.
+func APIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key := c.GetHeader(APIKeyHeader); key != "" {
+			c.Request = c.Request.WithContext(WithAPIKey(c.Request.Context(), key))
+		}
+		c.Next()
+	}
+}
+
+// WithAPIKey returns a copy of ctx carrying the API key of the caller
+func WithAPIKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
+
+// APIKeyFrom returns the API key of the caller carried by ctx, empty if none
+func APIKeyFrom(ctx context.Context) string {
+	key, _ := ctx.Value(apiKeyContextKey{}).(string)
+	return key
+}
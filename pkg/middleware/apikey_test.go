@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var got string
+	router := gin.New()
+	router.Use(APIKey())
+	router.GET("/test", func(c *gin.Context) {
+		got = APIKeyFrom(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest("GET", "/test", nil)
+	req.Header.Set(APIKeyHeader, "partner-1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "partner-1", got)
+
+	req, _ = http.NewRequest("GET", "/test", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Empty(t, got)
+}
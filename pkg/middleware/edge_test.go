@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"octopus/pkg/clock"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEdgeVerifier_Verify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	verifier := NewEdgeVerifier(map[string]string{"k2": "new-secret", "k1": "old-secret"}, 5*time.Minute)
+	verifier.clock = clock.NewFake(now)
+
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr error
+	}{
+		{name: "current key", token: SignEdgeToken("k2", "new-secret", now, EdgeCacheHit, "/ABCD"), want: EdgeCacheHit},
+		{name: "key being rotated out", token: SignEdgeToken("k1", "old-secret", now.Add(-time.Minute), EdgeCacheMiss, "/ABCD"), want: EdgeCacheMiss},
+		{name: "clock skew", token: SignEdgeToken("k2", "new-secret", now.Add(time.Minute), EdgeCacheMiss, "/ABCD"), want: EdgeCacheMiss},
+		{name: "unknown key", token: SignEdgeToken("k0", "new-secret", now, EdgeCacheHit, "/ABCD"), wantErr: ErrEdgeTokenKey},
+		{name: "wrong secret", token: SignEdgeToken("k2", "old-secret", now, EdgeCacheHit, "/ABCD"), wantErr: ErrEdgeTokenSignature},
+		{name: "other path", token: SignEdgeToken("k2", "new-secret", now, EdgeCacheHit, "/EFGH"), wantErr: ErrEdgeTokenSignature},
+		{name: "expired", token: SignEdgeToken("k2", "new-secret", now.Add(-6*time.Minute), EdgeCacheHit, "/ABCD"), wantErr: ErrEdgeTokenExpired},
+		{name: "unknown cache status", token: SignEdgeToken("k2", "new-secret", now, "stale", "/ABCD"), wantErr: ErrEdgeTokenMalformed},
+		{name: "missing", wantErr: ErrEdgeTokenMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, err := verifier.Verify(tt.token, "/ABCD")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cache)
+		})
+	}
+}
+
+func TestEdgeAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	verifier := NewEdgeVerifier(map[string]string{"k1": "secret"}, time.Minute)
+	newRouter := func(required bool, got *string) *gin.Engine {
+		router := gin.New()
+		router.Use(EdgeAuth(verifier, EdgeTokenHeader, required))
+		router.GET("/:shortCode", func(c *gin.Context) {
+			*got = EdgeCacheFrom(c.Request.Context())
+			c.Status(http.StatusFound)
+		})
+		return router
+	}
+
+	t.Run("signed request", func(t *testing.T) {
+		var got string
+		req, _ := http.NewRequest("GET", "/ABCD?utm_source=mail", nil)
+		req.Header.Set(EdgeTokenHeader, SignEdgeToken("k1", "secret", time.Now(), EdgeCacheHit, "/ABCD"))
+		w := httptest.NewRecorder()
+		newRouter(true, &got).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, EdgeCacheHit, got)
+	})
+
+	t.Run("direct request", func(t *testing.T) {
+		got := "unset"
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		w := httptest.NewRecorder()
+		newRouter(false, &got).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Empty(t, got)
+	})
+
+	t.Run("direct request rejected", func(t *testing.T) {
+		var got string
+		req, _ := http.NewRequest("GET", "/ABCD", nil)
+		req.Header.Set(EdgeTokenHeader, "k1:0:hit:forged")
+		w := httptest.NewRecorder()
+		newRouter(true, &got).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"octopus/pkg/apiresp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Maintenance returns a gin middleware rejecting requests with 503 while active reports the
+// maintenance mode on, advertising in Retry-After when clients should try again
+func Maintenance(active func() (bool, time.Duration)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		on, retryAfter := active()
+		if !on {
+			c.Next()
+			return
+		}
+
+		if retryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+		}
+		apiresp.Abort(c, http.StatusServiceUnavailable, "Service under maintenance, retry later")
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	on := false
+	router := gin.New()
+	router.Use(Maintenance(func() (bool, time.Duration) { return on, 90 * time.Second }))
+	router.POST("/test", func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/test", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	on = true
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "90", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), `"code":503`)
+}
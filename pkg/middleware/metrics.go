@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestCounter counts the requests served by a router
+type RequestCounter struct {
+	total    atomic.Int64
+	inFlight atomic.Int64
+}
+
+// NewRequestCounter creates a new RequestCounter
+func NewRequestCounter() *RequestCounter {
+	return &RequestCounter{}
+}
+
+// Middleware returns a gin middleware that counts requests
+func (rc *RequestCounter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rc.total.Add(1)
+		rc.inFlight.Add(1)
+		defer rc.inFlight.Add(-1)
+
+		c.Next()
+	}
+}
+
+// Total returns the number of requests received so far
+func (rc *RequestCounter) Total() int64 {
+	return rc.total.Load()
+}
+
+// InFlight returns the number of requests being served right now
+func (rc *RequestCounter) InFlight() int64 {
+	return rc.inFlight.Load()
+}
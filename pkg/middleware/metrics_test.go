@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestCounter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	counter := NewRequestCounter()
+	router := gin.New()
+	router.Use(counter.Middleware())
+	router.GET("/test", func(c *gin.Context) {
+		assert.Equal(t, int64(1), counter.InFlight())
+		c.Status(http.StatusOK)
+	})
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/test", nil)
+		router.ServeHTTP(w, req)
+	}
+
+	assert.Equal(t, int64(3), counter.Total())
+	assert.Equal(t, int64(0), counter.InFlight())
+}
@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"octopus/pkg/apiresp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pruneInterval is how often the buckets of callers idle long enough to have refilled are dropped
+const pruneInterval = time.Minute
+
+// RateLimiter limits the requests of each caller, identified by its client IP, with a token bucket
+// refilled at rate per second up to burst. Requests over the limit are rejected with 429, or with a
+// queue held until the limit lets them through, so that the bursts of batch clients are smoothed
+// out rather than failed.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	pruned  time.Time
+	// queueSize bounds the requests held at a time, none without a queue
+	queueSize    int
+	queueTimeout time.Duration
+	waiting      int
+
+	allowed   int64
+	queued    int64
+	rejected  int64
+	abandoned int64
+	waitTotal time.Duration
+	waitMax   time.Duration
+}
+
+// tokenBucket holds the requests a caller can still make right away, negative when requests are
+// queued for the tokens refilled next
+type tokenBucket struct {
+	tokens float64
+	at     time.Time
+}
+
+// RateLimitStats represents the requests let through, queued and rejected by a RateLimiter
+type RateLimitStats struct {
+	QueueSize  int
+	QueueDepth int
+	Allowed    int64
+	Queued     int64
+	Rejected   int64
+	// Abandoned counts the queued requests whose client went away before their turn
+	Abandoned int64
+	WaitTotal time.Duration
+	WaitMax   time.Duration
+}
+
+// NewRateLimiter creates a RateLimiter of rate requests per second with bursts of burst, rejecting
+// requests over the limit
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		pruned:  time.Now(),
+	}
+}
+
+// SetQueue queues up to size requests over the limit instead of rejecting them, each for at most
+// timeout. Requests that would wait longer, or find the queue full, are still rejected.
+func (l *RateLimiter) SetQueue(size int, timeout time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.queueSize = size
+	l.queueTimeout = timeout
+}
+
+// Middleware returns a gin middleware holding or rejecting the requests over the limit. Rejected
+// requests are told in Retry-After when their caller gets a request through again.
+func (l *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := rateLimitKey(c)
+		wait, ok := l.reserve(key, time.Now())
+		if !ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds())))))
+			apiresp.Abort(c, http.StatusTooManyRequests, "Too many requests, retry later")
+			return
+		}
+
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+				l.release(wait)
+			case <-c.Request.Context().Done():
+				timer.Stop()
+				l.abandon(key)
+				apiresp.Abort(c, http.StatusServiceUnavailable, "Request canceled while queued")
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// rateLimitKey identifies the caller of a request by its client IP. API keys are not verified, so
+// keying on them would let a caller get a fresh bucket with every request by making up keys.
+func rateLimitKey(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// reserve takes a token of a caller's bucket, and reports how long the request waits for it and
+// whether it may. Requests rejected are told how long they would have waited.
+func (l *RateLimiter) reserve(key string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.pruned) >= pruneInterval {
+		l.prune(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, at: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.at).Seconds()*l.rate)
+	b.at = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		l.allowed++
+		return 0, true
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	if l.waiting >= l.queueSize || wait > l.queueTimeout {
+		l.rejected++
+		return wait, false
+	}
+	b.tokens--
+	l.waiting++
+	l.queued++
+	return wait, true
+}
+
+// release lets a queued request through once it waited for its token
+func (l *RateLimiter) release(wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.waiting--
+	l.allowed++
+	l.waitTotal += wait
+	l.waitMax = max(l.waitMax, wait)
+}
+
+// abandon gives the token of a queued request back to its caller when its client went away
+func (l *RateLimiter) abandon(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.waiting--
+	l.abandoned++
+	if b, ok := l.buckets[key]; ok {
+		b.tokens = math.Min(l.burst, b.tokens+1)
+	}
+}
+
+// prune drops the buckets refilled by now, their callers starting over with a full bucket anyway
+func (l *RateLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.at).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.pruned = now
+}
+
+// Stats returns the requests let through, queued and rejected so far, and those queued right now
+func (l *RateLimiter) Stats() RateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return RateLimitStats{
+		QueueSize:  l.queueSize,
+		QueueDepth: l.waiting,
+		Allowed:    l.allowed,
+		Queued:     l.queued,
+		Rejected:   l.rejected,
+		Abandoned:  l.abandoned,
+		WaitTotal:  l.waitTotal,
+		WaitMax:    l.waitMax,
+	}
+}
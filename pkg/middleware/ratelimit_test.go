@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_Reserve(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	t.Run("rejects over the limit", func(t *testing.T) {
+		l := NewRateLimiter(2, 2)
+		for i := 0; i < 2; i++ {
+			wait, ok := l.reserve("ip:10.0.0.1", now)
+			assert.True(t, ok)
+			assert.Zero(t, wait)
+		}
+		wait, ok := l.reserve("ip:10.0.0.1", now)
+		assert.False(t, ok)
+		assert.Equal(t, 500*time.Millisecond, wait)
+
+		// Other callers have their own bucket, and tokens refill over time
+		_, ok = l.reserve("ip:10.0.0.2", now)
+		assert.True(t, ok)
+		_, ok = l.reserve("ip:10.0.0.1", now.Add(500*time.Millisecond))
+		assert.True(t, ok)
+		assert.Equal(t, RateLimitStats{Allowed: 4, Rejected: 1}, l.Stats())
+	})
+
+	t.Run("queues within the timeout", func(t *testing.T) {
+		l := NewRateLimiter(2, 1)
+		l.SetQueue(2, 800*time.Millisecond)
+
+		_, ok := l.reserve("key:batch", now)
+		assert.True(t, ok)
+		wait, ok := l.reserve("key:batch", now)
+		assert.True(t, ok)
+		assert.Equal(t, 500*time.Millisecond, wait)
+		// The next token comes after the one reserved, past the timeout
+		wait, ok = l.reserve("key:batch", now)
+		assert.False(t, ok)
+		assert.Equal(t, time.Second, wait)
+
+		// The queue is bounded whatever the wait
+		_, ok = l.reserve("key:other", now)
+		assert.True(t, ok)
+		_, ok = l.reserve("key:other", now)
+		assert.True(t, ok)
+		_, ok = l.reserve("key:third", now)
+		assert.True(t, ok)
+		_, ok = l.reserve("key:third", now)
+		assert.False(t, ok, "queue full")
+
+		stats := l.Stats()
+		assert.Equal(t, 2, stats.QueueDepth)
+		assert.Equal(t, int64(2), stats.Queued)
+		assert.Equal(t, int64(2), stats.Rejected)
+	})
+
+	t.Run("prunes refilled buckets", func(t *testing.T) {
+		l := NewRateLimiter(1, 1)
+		l.reserve("ip:10.0.0.1", now)
+		l.reserve("ip:10.0.0.2", now.Add(pruneInterval))
+		l.prune(now.Add(pruneInterval))
+		assert.Len(t, l.buckets, 1)
+	})
+}
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(l *RateLimiter) *gin.Engine {
+		router := gin.New()
+		router.Use(APIKey(), l.Middleware())
+		router.POST("/test", func(c *gin.Context) {
+			c.Status(http.StatusCreated)
+		})
+		return router
+	}
+	serveKey := func(router *gin.Engine, ctx context.Context, apiKey string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(ctx, "POST", "/test", nil)
+		req.Header.Set(APIKeyHeader, apiKey)
+		req.RemoteAddr = "10.0.0.1:40000"
+		router.ServeHTTP(w, req)
+		return w
+	}
+	serve := func(router *gin.Engine, ctx context.Context) *httptest.ResponseRecorder {
+		return serveKey(router, ctx, "batch")
+	}
+
+	t.Run("rejects with Retry-After", func(t *testing.T) {
+		router := newRouter(NewRateLimiter(0.5, 1))
+
+		assert.Equal(t, http.StatusCreated, serve(router, context.Background()).Code)
+		w := serve(router, context.Background())
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "2", w.Header().Get("Retry-After"))
+		assert.Contains(t, w.Body.String(), `"code":429`)
+	})
+
+	t.Run("ignores API keys", func(t *testing.T) {
+		router := newRouter(NewRateLimiter(0.5, 1))
+
+		// Making up a new key for every request does not get around the limit of the client IP
+		assert.Equal(t, http.StatusCreated, serveKey(router, context.Background(), "key-1").Code)
+		assert.Equal(t, http.StatusTooManyRequests, serveKey(router, context.Background(), "key-2").Code)
+		assert.Equal(t, http.StatusTooManyRequests, serveKey(router, context.Background(), "").Code)
+	})
+
+	t.Run("queues bursts", func(t *testing.T) {
+		l := NewRateLimiter(50, 1)
+		l.SetQueue(10, time.Second)
+		router := newRouter(l)
+
+		var wg sync.WaitGroup
+		codes := make([]int, 4)
+		start := time.Now()
+		for i := range codes {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				codes[i] = serve(router, context.Background()).Code
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, []int{http.StatusCreated, http.StatusCreated, http.StatusCreated, http.StatusCreated}, codes)
+		assert.GreaterOrEqual(t, time.Since(start), 55*time.Millisecond, "3 requests queued 20ms apart")
+		stats := l.Stats()
+		assert.Equal(t, int64(3), stats.Queued)
+		assert.Equal(t, int64(4), stats.Allowed)
+		assert.Zero(t, stats.QueueDepth)
+		assert.GreaterOrEqual(t, stats.WaitMax, 55*time.Millisecond)
+	})
+
+	t.Run("gives tokens back when clients go away", func(t *testing.T) {
+		l := NewRateLimiter(1, 1)
+		l.SetQueue(10, 2*time.Second)
+		router := newRouter(l)
+
+		assert.Equal(t, http.StatusCreated, serve(router, context.Background()).Code)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.Equal(t, http.StatusServiceUnavailable, serve(router, ctx).Code)
+
+		stats := l.Stats()
+		assert.Equal(t, int64(1), stats.Abandoned)
+		assert.Zero(t, stats.QueueDepth)
+		assert.InDelta(t, 0, l.buckets["ip:10.0.0.1"].tokens, 0.1)
+	})
+}
@@ -3,6 +3,8 @@ package middleware
 import (
 	"net/http"
 
+	"octopus/pkg/apiresp"
+
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 )
@@ -17,11 +19,7 @@ func Recovery() gin.HandlerFunc {
 					Interface("error", err).
 					Msg("Panic recovered")
 
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"code":    500,
-					"message": "Internal server error",
-				})
-				c.Abort()
+				apiresp.Abort(c, http.StatusInternalServerError, "Internal server error")
 			}
 		}()
 		c.Next()
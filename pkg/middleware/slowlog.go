@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"time"
+
+	"octopus/pkg/slowlog"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SlowRequests returns a gin middleware that names the short code of the request in its context, for
+// the slow MySQL queries and Redis commands it makes, and logs and counts the slow requests
+func SlowRequests(detector *slowlog.Detector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if shortCode := c.Param("shortCode"); shortCode != "" {
+			c.Request = c.Request.WithContext(slowlog.WithShortCode(c.Request.Context(), shortCode))
+		}
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		detector.Observe(c.Request.Context(), c.Request.Method+" "+route, time.Since(start))
+	}
+}
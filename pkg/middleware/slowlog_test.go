@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"octopus/pkg/slowlog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowRequests(t *testing.T) {
+	detector := slowlog.NewDetector("http", 20*time.Millisecond)
+	router := gin.New()
+	router.Use(SlowRequests(detector))
+	router.GET("/:shortCode", func(c *gin.Context) {
+		assert.Equal(t, c.Param("shortCode"), slowlog.ShortCodeFrom(c.Request.Context()))
+		if c.Param("shortCode") == "SLOW" {
+			time.Sleep(30 * time.Millisecond)
+		}
+		c.Status(http.StatusFound)
+	})
+
+	for _, path := range []string{"/FAST", "/SLOW"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusFound, w.Code)
+	}
+	assert.Equal(t, int64(1), detector.Slow())
+	assert.Equal(t, "GET /:shortCode", detector.LastOperation())
+}
@@ -0,0 +1,131 @@
+// Package objstore writes objects to S3-compatible object storage, AWS S3 or self-hosted stores
+// such as MinIO, for data kept longer than the databases hold it.
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// Uploader writes objects to a bucket
+type Uploader interface {
+	Put(ctx context.Context, key string, body []byte, contentType, contentEncoding string) error
+}
+
+// Error is returned when the object store answers with an error status
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	return fmt.Sprintf("objstore: responded %d: %s", e.StatusCode, e.Message)
+}
+
+// Temporary reports whether the request may succeed when retried, unlike rejected credentials or
+// requests
+func (e *Error) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// S3 writes objects to a bucket through the S3 API, signing requests with AWS Signature Version 4
+type S3 struct {
+	bucket   string
+	region   string
+	endpoint string
+	creds    aws.CredentialsProvider
+	signer   *v4.Signer
+	client   *http.Client
+}
+
+// NewS3 creates an S3 uploader for a bucket of a region, giving up on every request after timeout.
+// Objects are addressed virtual-hosted style on AWS, and path style under a custom endpoint, as
+// S3-compatible stores expect.
+func NewS3(bucket, region, endpoint string, creds aws.CredentialsProvider, timeout time.Duration) *S3 {
+	return &S3{
+		bucket:   bucket,
+		region:   region,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		creds:    creds,
+		// Keys are escaped once, the way S3 canonicalizes them
+		signer: v4.NewSigner(func(o *v4.SignerOptions) {
+			o.DisableURIPathEscaping = true
+		}),
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Put writes an object, replacing any object of the same key
+func (s *S3) Put(ctx context.Context, key string, body []byte, contentType, contentEncoding string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("objstore: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
+
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	creds, err := s.creds.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("objstore: failed to retrieve credentials: %w", err)
+	}
+	if err := s.signer.SignHTTP(ctx, creds, req, payloadHash, "s3", s.region, time.Now()); err != nil {
+		return fmt.Errorf("objstore: failed to sign request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("objstore: put %s failed: %w", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	// The body explains the failure, only its start is kept as it ends up in logs
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	message := strings.TrimSpace(string(data))
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: message}
+}
+
+// objectURL returns the URL of an object
+func (s *S3) objectURL(key string) string {
+	if s.endpoint == "" {
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, s.region, escapeKey(key))
+	}
+	return s.endpoint + "/" + escapeKey(s.bucket) + "/" + escapeKey(key)
+}
+
+// escapeKey escapes every byte of an object key but the unreserved characters and slashes, as the
+// signature of S3 requests expects
+func escapeKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
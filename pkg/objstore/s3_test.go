@@ -0,0 +1,65 @@
+package objstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testCreds = aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+	return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+})
+
+func TestS3_Put(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/archive/events/dt%3D2026-10-16/short_code%3DABCD/1.ndjson.gz", r.URL.EscapedPath())
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/eu-west-1/s3/aws4_request")
+		assert.NotEmpty(t, r.Header.Get("X-Amz-Content-Sha256"))
+
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer srv.Close()
+
+	s := NewS3("archive", "eu-west-1", srv.URL+"/", testCreds, time.Second)
+	err := s.Put(context.Background(), "events/dt=2026-10-16/short_code=ABCD/1.ndjson.gz", []byte("{}\n"), "application/x-ndjson", "gzip")
+	require.NoError(t, err)
+	assert.Equal(t, "{}\n", body)
+}
+
+func TestS3_PutError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<Error><Code>AccessDenied</Code></Error>")
+	}))
+	defer srv.Close()
+
+	s := NewS3("archive", "eu-west-1", srv.URL, testCreds, time.Second)
+	err := s.Put(context.Background(), "key", nil, "application/x-ndjson", "")
+
+	var storeErr *Error
+	require.True(t, errors.As(err, &storeErr))
+	assert.Equal(t, http.StatusForbidden, storeErr.StatusCode)
+	assert.Contains(t, storeErr.Message, "AccessDenied")
+	assert.False(t, storeErr.Temporary())
+	assert.True(t, (&Error{StatusCode: http.StatusServiceUnavailable}).Temporary())
+}
+
+func TestS3_ObjectURL(t *testing.T) {
+	s := NewS3("archive", "us-east-2", "", testCreds, time.Second)
+	assert.Equal(t, "https://archive.s3.us-east-2.amazonaws.com/a/b%20c", s.objectURL("a/b c"))
+}
@@ -0,0 +1,32 @@
+package retry
+
+import (
+	"context"
+	"time"
+)
+
+// Do calls fn until it succeeds or ctx is done, waiting between attempts with an exponential
+// backoff that starts at initial and is capped at max. fn is called at least once, also with a
+// context that is already done, and the last error of fn is returned when giving up.
+func Do(ctx context.Context, initial, max time.Duration, fn func() error) error {
+	backoff := initial
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > max {
+			backoff = max
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDo(t *testing.T) {
+	t.Run("retries until success", func(t *testing.T) {
+		attempts := 0
+		err := Do(context.Background(), time.Millisecond, 4*time.Millisecond, func() error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("unavailable")
+			}
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("gives up with the last error", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		defer cancel()
+
+		attempts := 0
+		start := time.Now()
+		err := Do(ctx, time.Millisecond, 5*time.Millisecond, func() error {
+			attempts++
+			return errors.New("unavailable")
+		})
+
+		assert.EqualError(t, err, "unavailable")
+		assert.Greater(t, attempts, 1)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("done context tries once", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		attempts := 0
+		err := Do(ctx, time.Hour, time.Hour, func() error {
+			attempts++
+			return errors.New("unavailable")
+		})
+
+		assert.Error(t, err)
+		assert.Equal(t, 1, attempts)
+	})
+}
@@ -0,0 +1,77 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrStageTimeout is returned for stages that did not finish within their timeout
+var ErrStageTimeout = errors.New("shutdown: stage timed out")
+
+// stage is one step of the shutdown
+type stage struct {
+	name    string
+	timeout time.Duration
+	run     func(ctx context.Context) error
+}
+
+// Manager runs shutdown stages one after another in the order they were added, each with its own
+// timeout, so that later stages only start once the earlier ones finished or gave up
+type Manager struct {
+	stages []stage
+}
+
+// New creates an empty shutdown manager
+func New() *Manager {
+	return &Manager{}
+}
+
+// Add appends a stage. Its context expires after the timeout, 0 meaning no timeout; a stage that
+// ignores its context is abandoned once the timeout passed.
+func (m *Manager) Add(name string, timeout time.Duration, run func(ctx context.Context) error) {
+	m.stages = append(m.stages, stage{name: name, timeout: timeout, run: run})
+}
+
+// Shutdown runs all stages, continuing past failed and timed out ones, and returns their errors
+func (m *Manager) Shutdown() error {
+	var errs []error
+	for _, s := range m.stages {
+		start := time.Now()
+		log.Info().Str("stage", s.name).Dur("timeout", s.timeout).Msg("Shutdown stage started")
+
+		if err := s.execute(); err != nil {
+			log.Error().Err(err).Str("stage", s.name).Dur("elapsed", time.Since(start)).Msg("Shutdown stage failed")
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+			continue
+		}
+
+		log.Info().Str("stage", s.name).Dur("elapsed", time.Since(start)).Msg("Shutdown stage finished")
+	}
+	return errors.Join(errs...)
+}
+
+// execute runs the stage, giving up on it when its timeout passes
+func (s stage) execute() error {
+	ctx := context.Background()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.run(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ErrStageTimeout
+	}
+}
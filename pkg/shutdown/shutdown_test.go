@@ -0,0 +1,87 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_RunsStagesInOrder(t *testing.T) {
+	m := New()
+	var order []string
+	for _, name := range []string{"http", "workers", "analytics", "mq", "storage"} {
+		m.Add(name, time.Second, func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		})
+	}
+
+	assert.NoError(t, m.Shutdown())
+	assert.Equal(t, []string{"http", "workers", "analytics", "mq", "storage"}, order)
+}
+
+func TestManager_ContinuesPastFailures(t *testing.T) {
+	m := New()
+	var ran []string
+	m.Add("failing", time.Second, func(ctx context.Context) error {
+		ran = append(ran, "failing")
+		return errors.New("boom")
+	})
+	m.Add("next", time.Second, func(ctx context.Context) error {
+		ran = append(ran, "next")
+		return nil
+	})
+
+	err := m.Shutdown()
+	assert.EqualError(t, err, "failing: boom")
+	assert.Equal(t, []string{"failing", "next"}, ran)
+}
+
+func TestManager_StageTimeout(t *testing.T) {
+	t.Run("stage context expires", func(t *testing.T) {
+		m := New()
+		m.Add("slow", 20*time.Millisecond, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		err := m.Shutdown()
+		assert.Error(t, err)
+	})
+
+	t.Run("stage ignoring its context is abandoned", func(t *testing.T) {
+		m := New()
+		release := make(chan struct{})
+		defer close(release)
+		m.Add("stuck", 20*time.Millisecond, func(ctx context.Context) error {
+			<-release
+			return nil
+		})
+		ranNext := false
+		m.Add("next", time.Second, func(ctx context.Context) error {
+			ranNext = true
+			return nil
+		})
+
+		start := time.Now()
+		err := m.Shutdown()
+		assert.ErrorIs(t, err, ErrStageTimeout)
+		assert.True(t, ranNext)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("zero timeout waits for the stage", func(t *testing.T) {
+		m := New()
+		m.Add("unbounded", 0, func(ctx context.Context) error {
+			_, hasDeadline := ctx.Deadline()
+			assert.False(t, hasDeadline)
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+
+		assert.NoError(t, m.Shutdown())
+	})
+}
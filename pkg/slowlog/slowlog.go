@@ -0,0 +1,90 @@
+// Package slowlog logs and counts the calls to a dependency taking longer than a threshold, with the
+// short code of the request making them, so tail latency offenders can be found without tracing.
+package slowlog
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// shortCodeContextKey keys the short code a request is about in its context
+type shortCodeContextKey struct{}
+
+// WithShortCode returns a copy of ctx naming the short code the calls made with it are about
+func WithShortCode(ctx context.Context, shortCode string) context.Context {
+	return context.WithValue(ctx, shortCodeContextKey{}, shortCode)
+}
+
+// ShortCodeFrom returns the short code of ctx, "" when it is not about a short link
+func ShortCodeFrom(ctx context.Context) string {
+	shortCode, _ := ctx.Value(shortCodeContextKey{}).(string)
+	return shortCode
+}
+
+// Detector logs and counts the calls to a dependency taking at least its threshold
+type Detector struct {
+	target        string
+	threshold     time.Duration
+	slow          atomic.Int64
+	lastOperation atomic.Pointer[string]
+}
+
+// NewDetector creates a Detector for the named dependency, detecting nothing when threshold is 0
+func NewDetector(target string, threshold time.Duration) *Detector {
+	return &Detector{
+		target:    target,
+		threshold: threshold,
+	}
+}
+
+// Target returns the name of the dependency calls are timed to
+func (d *Detector) Target() string {
+	return d.target
+}
+
+// Threshold returns the duration from which calls are slow
+func (d *Detector) Threshold() time.Duration {
+	return d.threshold
+}
+
+// Active reports whether the Detector can find any call slow
+func (d *Detector) Active() bool {
+	return d.threshold > 0
+}
+
+// Observe runs after a call of operation that took elapsed: it logs and counts the call and returns
+// true when it was slow
+func (d *Detector) Observe(ctx context.Context, operation string, elapsed time.Duration) bool {
+	if !d.Active() || elapsed < d.threshold {
+		return false
+	}
+	d.slow.Add(1)
+	d.lastOperation.Store(&operation)
+
+	event := log.Warn().
+		Str("target", d.target).
+		Str("operation", operation).
+		Dur("elapsed", elapsed).
+		Dur("threshold", d.threshold)
+	if shortCode := ShortCodeFrom(ctx); shortCode != "" {
+		event = event.Str("short_code", shortCode)
+	}
+	event.Msg("Slow call")
+	return true
+}
+
+// Slow returns the number of slow calls so far
+func (d *Detector) Slow() int64 {
+	return d.slow.Load()
+}
+
+// LastOperation returns the operation of the latest slow call, "" before the first
+func (d *Detector) LastOperation() string {
+	if operation := d.lastOperation.Load(); operation != nil {
+		return *operation
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+package slowlog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShortCode(t *testing.T) {
+	assert.Empty(t, ShortCodeFrom(context.Background()))
+	assert.Equal(t, "ABCD", ShortCodeFrom(WithShortCode(context.Background(), "ABCD")))
+}
+
+func TestDetector_Observe(t *testing.T) {
+	ctx := WithShortCode(context.Background(), "ABCD")
+
+	t.Run("detects nothing without a threshold", func(t *testing.T) {
+		detector := NewDetector("mysql", 0)
+		assert.False(t, detector.Active())
+		assert.False(t, detector.Observe(ctx, "SELECT 1", time.Hour))
+		assert.Zero(t, detector.Slow())
+	})
+
+	t.Run("counts calls from the threshold", func(t *testing.T) {
+		detector := NewDetector("redis", 50*time.Millisecond)
+		assert.True(t, detector.Active())
+		assert.Empty(t, detector.LastOperation())
+
+		assert.False(t, detector.Observe(ctx, "get sl:v2:code:ABCD", 49*time.Millisecond))
+		assert.True(t, detector.Observe(ctx, "get sl:v2:code:ABCD", 50*time.Millisecond))
+		assert.True(t, detector.Observe(context.Background(), "pfadd uv:ABCD", time.Second))
+		assert.Equal(t, int64(2), detector.Slow())
+		assert.Equal(t, "pfadd uv:ABCD", detector.LastOperation())
+	})
+}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cacheDirectives are the Cache-Control response directives, mapped to whether they take seconds
+var cacheDirectives = map[string]bool{
+	"public":                 false,
+	"private":                false,
+	"no-cache":               false,
+	"no-store":               false,
+	"no-transform":           false,
+	"must-revalidate":        false,
+	"proxy-revalidate":       false,
+	"must-understand":        false,
+	"immutable":              false,
+	"max-age":                true,
+	"s-maxage":               true,
+	"stale-while-revalidate": true,
+	"stale-if-error":         true,
+}
+
+// ValidateCacheControl checks that a Cache-Control header value is a comma separated list of
+// response directives, like "public, max-age=300", those taking seconds with a non-negative integer
+func ValidateCacheControl(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return errors.New("empty Cache-Control")
+	}
+
+	for _, directive := range strings.Split(value, ",") {
+		name, arg, hasArg := strings.Cut(strings.TrimSpace(directive), "=")
+		name = strings.ToLower(name)
+		seconds, known := cacheDirectives[name]
+		switch {
+		case !known:
+			return fmt.Errorf("unknown Cache-Control directive %q", name)
+		case seconds && !hasArg:
+			return fmt.Errorf("Cache-Control directive %s needs seconds", name)
+		case !seconds && hasArg:
+			return fmt.Errorf("Cache-Control directive %s takes no value", name)
+		case seconds:
+			if n, err := strconv.ParseUint(arg, 10, 32); err != nil || n > 1<<31-1 {
+				return fmt.Errorf("Cache-Control directive %s needs seconds, not %q", name, arg)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCacheControl(t *testing.T) {
+	for _, value := range []string{
+		"no-store",
+		"public, max-age=300",
+		"Public,Max-Age=0 , immutable",
+		"private, no-cache, stale-while-revalidate=30, stale-if-error=86400",
+	} {
+		assert.NoError(t, ValidateCacheControl(value), value)
+	}
+
+	for _, value := range []string{
+		"",
+		" ",
+		"max-age",
+		"max-age=-1",
+		"max-age=5m",
+		"no-store=1",
+		"public, max-age=300, bogus",
+		"public,,max-age=300",
+		"max-age=300\r\nSet-Cookie: a=b",
+	} {
+		assert.Error(t, ValidateCacheControl(value), value)
+	}
+}
@@ -0,0 +1,31 @@
+package util
+
+import (
+	"strings"
+)
+
+// Device types derived from the User-Agent
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// DeviceType classifies a User-Agent into a coarse device type
+func DeviceType(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return DeviceUnknown
+	case strings.Contains(ua, "bot") || strings.Contains(ua, "spider") || strings.Contains(ua, "crawler"):
+		return DeviceBot
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet"):
+		return DeviceTablet
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone") || strings.Contains(ua, "android"):
+		return DeviceMobile
+	default:
+		return DeviceDesktop
+	}
+}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceType(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		expected  string
+	}{
+		{
+			name:      "empty user agent",
+			userAgent: "",
+			expected:  DeviceUnknown,
+		},
+		{
+			name:      "crawler",
+			userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			expected:  DeviceBot,
+		},
+		{
+			name:      "ipad",
+			userAgent: "Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148",
+			expected:  DeviceTablet,
+		},
+		{
+			name:      "iphone",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148",
+			expected:  DeviceMobile,
+		},
+		{
+			name:      "android phone",
+			userAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36",
+			expected:  DeviceMobile,
+		},
+		{
+			name:      "desktop browser",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36",
+			expected:  DeviceDesktop,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, DeviceType(tt.userAgent))
+		})
+	}
+}
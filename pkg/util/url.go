@@ -0,0 +1,121 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// ErrInvalidURL is returned when a URL cannot be normalized
+var ErrInvalidURL = errors.New("invalid URL")
+
+// NormalizeURL returns a canonical form of an absolute URL so equivalent spellings compare equal:
+// lower-case scheme and host, no default port, no fragment, "/" for an empty path and sorted query parameters
+func NormalizeURL(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", ErrInvalidURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	u.Host = host
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	// Encode sorts the parameters by key
+	u.RawQuery = u.Query().Encode()
+
+	return u.String(), nil
+}
+
+// URLHash returns the hex SHA-256 of the normalized URL
+func URLHash(rawURL string) (string, error) {
+	normalized, err := NormalizeURL(rawURL)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// signatureParams are query keys, in lower case, of URLs signed over their query string, such as
+// presigned S3 and GCS URLs, CloudFront signed URLs and Azure SAS tokens
+var signatureParams = map[string]struct{}{
+	"x-amz-signature":  {},
+	"x-goog-signature": {},
+	"signature":        {},
+	"sig":              {},
+}
+
+// IsSignedURL checks if the query of a URL carries a signature, so that re-encoding it would
+// invalidate the URL
+func IsSignedURL(rawURL string) bool {
+	_, rawQuery, ok := strings.Cut(rawURL, "?")
+	if !ok {
+		return false
+	}
+	rawQuery, _, _ = strings.Cut(rawQuery, "#")
+
+	for _, pair := range strings.Split(rawQuery, "&") {
+		key, _, _ := strings.Cut(pair, "=")
+		if _, ok := signatureParams[strings.ToLower(key)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AppendQuery appends parameters to a URL without parsing it, leaving everything but the new
+// parameters byte for byte as it was
+func AppendQuery(rawURL string, params url.Values) string {
+	encoded := params.Encode()
+	if encoded == "" {
+		return rawURL
+	}
+
+	base, fragment, hasFragment := strings.Cut(rawURL, "#")
+	switch {
+	case !strings.Contains(base, "?"):
+		base += "?"
+	case !strings.HasSuffix(base, "?") && !strings.HasSuffix(base, "&"):
+		base += "&"
+	}
+	base += encoded
+
+	if hasFragment {
+		return base + "#" + fragment
+	}
+	return base
+}
+
+// MergeQuery adds parameters to a raw query without re-encoding it, dropping the pairs of keys the
+// parameters set again
+func MergeQuery(rawQuery string, params url.Values) string {
+	var pairs []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(pair, "=")
+		if decoded, err := url.QueryUnescape(key); err == nil {
+			if _, ok := params[decoded]; ok {
+				continue
+			}
+		}
+		pairs = append(pairs, pair)
+	}
+
+	if encoded := params.Encode(); encoded != "" {
+		pairs = append(pairs, encoded)
+	}
+	return strings.Join(pairs, "&")
+}
@@ -0,0 +1,144 @@
+package util
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "already normalized",
+			input:    "https://example.com/path",
+			expected: "https://example.com/path",
+		},
+		{
+			name:     "case of scheme and host",
+			input:    "HTTPS://Example.COM/Path",
+			expected: "https://example.com/Path",
+		},
+		{
+			name:     "default port and empty path",
+			input:    "http://example.com:80",
+			expected: "http://example.com/",
+		},
+		{
+			name:     "custom port kept",
+			input:    "https://example.com:8443/",
+			expected: "https://example.com:8443/",
+		},
+		{
+			name:     "query sorted and fragment dropped",
+			input:    "https://example.com/?b=2&a=1#section",
+			expected: "https://example.com/?a=1&b=2",
+		},
+		{
+			name:    "relative URL",
+			input:   "/path",
+			wantErr: true,
+		},
+		{
+			name:    "unparsable URL",
+			input:   "://invalid",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NormalizeURL(tt.input)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidURL)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestURLHash(t *testing.T) {
+	a, err := URLHash("https://Example.com?b=2&a=1")
+	assert.NoError(t, err)
+	assert.Len(t, a, 64)
+
+	b, err := URLHash("https://example.com/?a=1&b=2#top")
+	assert.NoError(t, err)
+	assert.Equal(t, a, b)
+
+	c, err := URLHash("https://example.com/other")
+	assert.NoError(t, err)
+	assert.NotEqual(t, a, c)
+
+	_, err = URLHash("not a url")
+	assert.Error(t, err)
+}
+
+func TestIsSignedURL(t *testing.T) {
+	assert.True(t, IsSignedURL("https://bucket.s3.amazonaws.com/key?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Signature=abc"))
+	assert.True(t, IsSignedURL("https://storage.googleapis.com/b/o?X-Goog-Signature=abc#top"))
+	assert.True(t, IsSignedURL("https://d111.cloudfront.net/img.png?Expires=1&Signature=abc&Key-Pair-Id=K1"))
+	assert.True(t, IsSignedURL("https://acct.blob.core.windows.net/c/b?sv=2020-08-04&sig=abc%3D"))
+	assert.False(t, IsSignedURL("https://example.com/page?utm_source=sms"))
+	assert.False(t, IsSignedURL("https://example.com/page#sig=abc"))
+	assert.False(t, IsSignedURL("https://example.com/signature"))
+}
+
+func TestAppendQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		params   url.Values
+		expected string
+	}{
+		{
+			name:     "no query",
+			input:    "https://example.com/page",
+			params:   url.Values{"ref": {"sms"}},
+			expected: "https://example.com/page?ref=sms",
+		},
+		{
+			name:     "existing query kept byte for byte",
+			input:    "https://b.s3.amazonaws.com/k?X-Amz-Credential=AK%2F20240101%2Fus-east-1&X-Amz-Signature=ab12",
+			params:   url.Values{"ref": {"a b"}},
+			expected: "https://b.s3.amazonaws.com/k?X-Amz-Credential=AK%2F20240101%2Fus-east-1&X-Amz-Signature=ab12&ref=a+b",
+		},
+		{
+			name:     "fragment stays last",
+			input:    "https://example.com/page?a=1#section?x=1",
+			params:   url.Values{"tag": {"a", "b"}},
+			expected: "https://example.com/page?a=1&tag=a&tag=b#section?x=1",
+		},
+		{
+			name:     "trailing separator",
+			input:    "https://example.com/page?",
+			params:   url.Values{"ref": {"sms"}},
+			expected: "https://example.com/page?ref=sms",
+		},
+		{
+			name:     "no params",
+			input:    "https://example.com/page?b=%7e",
+			expected: "https://example.com/page?b=%7e",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, AppendQuery(tt.input, tt.params))
+		})
+	}
+}
+
+func TestMergeQuery(t *testing.T) {
+	assert.Equal(t, "b=2&a=%7e&ref=sms", MergeQuery("b=2&a=%7e", url.Values{"ref": {"sms"}}))
+	assert.Equal(t, "z=1&tag=c", MergeQuery("tag=a&z=1&tag=b", url.Values{"tag": {"c"}}))
+	assert.Equal(t, "q=a%20b", MergeQuery("q=a%20b", nil))
+	assert.Equal(t, "ref=sms", MergeQuery("", url.Values{"ref": {"sms"}}))
+}
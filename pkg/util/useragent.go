@@ -0,0 +1,16 @@
+package util
+
+import (
+	"strings"
+)
+
+// IsBot reports whether the User-Agent matches any of the crawler patterns (case-insensitive substrings)
+func IsBot(userAgent string, patterns []string) bool {
+	ua := strings.ToLower(userAgent)
+	for _, pattern := range patterns {
+		if pattern != "" && strings.Contains(ua, strings.ToLower(pattern)) {
+			return true
+		}
+	}
+	return false
+}
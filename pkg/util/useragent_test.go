@@ -0,0 +1,54 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsBot(t *testing.T) {
+	patterns := []string{"Googlebot", "bingbot", "crawler"}
+
+	tests := []struct {
+		name      string
+		userAgent string
+		expected  bool
+	}{
+		{
+			name:      "googlebot",
+			userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			expected:  true,
+		},
+		{
+			name:      "case-insensitive match",
+			userAgent: "Mozilla/5.0 (compatible; BingBot/2.0)",
+			expected:  true,
+		},
+		{
+			name:      "generic crawler",
+			userAgent: "SomeCrawler/1.0",
+			expected:  true,
+		},
+		{
+			name:      "browser",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0",
+			expected:  false,
+		},
+		{
+			name:      "empty user agent",
+			userAgent: "",
+			expected:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, IsBot(tt.userAgent, patterns))
+		})
+	}
+
+	t.Run("empty patterns never match", func(t *testing.T) {
+		assert.False(t, IsBot("Googlebot", []string{""}))
+		assert.False(t, IsBot("Googlebot", nil))
+	})
+}
@@ -0,0 +1,202 @@
+package warehouse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// BigQueryAPI is the base URL of the BigQuery API
+const BigQueryAPI = "https://bigquery.googleapis.com/bigquery/v2"
+
+// bigQueryTypes maps column types to BigQuery types
+var bigQueryTypes = map[string]string{
+	TypeString:    "STRING",
+	TypeInteger:   "INT64",
+	TypeBoolean:   "BOOL",
+	TypeTimestamp: "TIMESTAMP",
+}
+
+// BigQuery streams rows into the tables of a BigQuery dataset. Tables are partitioned by day on
+// their first timestamp column, and the key of rows is sent as their insert ID so BigQuery drops
+// retried rows.
+type BigQuery struct {
+	project string
+	dataset string
+	tokens  TokenSource
+	baseURL string
+	client  *http.Client
+}
+
+// NewBigQuery creates a BigQuery writer for a dataset of a project, authenticating with tokens
+// allowed to manage its tables and giving up on every request after timeout
+func NewBigQuery(project, dataset string, tokens TokenSource, timeout time.Duration) *BigQuery {
+	return &BigQuery{project: project, dataset: dataset, tokens: tokens, baseURL: BigQueryAPI, client: &http.Client{Timeout: timeout}}
+}
+
+// bigQueryField is a field of the schema of a BigQuery table
+type bigQueryField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Mode string `json:"mode,omitempty"`
+}
+
+// bigQuerySchema is the schema of a BigQuery table
+type bigQuerySchema struct {
+	Fields []bigQueryField `json:"fields"`
+}
+
+// EnsureTable creates a table, or adds the columns it misses as nullable fields
+func (w *BigQuery) EnsureTable(ctx context.Context, table *Table) error {
+	var existing struct {
+		Schema bigQuerySchema `json:"schema"`
+	}
+	err := w.do(ctx, http.MethodGet, w.tablesURL()+"/"+url.PathEscape(table.Name), nil, &existing)
+	var bqErr *Error
+	if errors.As(err, &bqErr) && bqErr.StatusCode == http.StatusNotFound {
+		return w.createTable(ctx, table)
+	}
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]bool, len(existing.Schema.Fields))
+	for _, field := range existing.Schema.Fields {
+		known[strings.ToLower(field.Name)] = true
+	}
+	fields := existing.Schema.Fields
+	for _, column := range table.Columns {
+		if !known[strings.ToLower(column.Name)] {
+			fields = append(fields, bigQueryField{Name: column.Name, Type: bigQueryTypes[column.Type], Mode: "NULLABLE"})
+		}
+	}
+	if len(fields) == len(existing.Schema.Fields) {
+		return nil
+	}
+	body := map[string]any{"schema": bigQuerySchema{Fields: fields}}
+	return w.do(ctx, http.MethodPatch, w.tablesURL()+"/"+url.PathEscape(table.Name), body, nil)
+}
+
+// createTable creates a table partitioned by day on its first timestamp column
+func (w *BigQuery) createTable(ctx context.Context, table *Table) error {
+	fields := make([]bigQueryField, len(table.Columns))
+	partition := ""
+	for i, column := range table.Columns {
+		fields[i] = bigQueryField{Name: column.Name, Type: bigQueryTypes[column.Type], Mode: "NULLABLE"}
+		if partition == "" && column.Type == TypeTimestamp {
+			partition = column.Name
+		}
+	}
+
+	body := map[string]any{
+		"tableReference": map[string]string{"projectId": w.project, "datasetId": w.dataset, "tableId": table.Name},
+		"schema":         bigQuerySchema{Fields: fields},
+	}
+	if partition != "" {
+		body["timePartitioning"] = map[string]string{"type": "DAY", "field": partition}
+	}
+	return w.do(ctx, http.MethodPost, w.tablesURL(), body, nil)
+}
+
+// Insert streams rows into a table, failing when BigQuery rejects any of them
+func (w *BigQuery) Insert(ctx context.Context, table *Table, rows []Row) error {
+	type insertRow struct {
+		InsertID string         `json:"insertId,omitempty"`
+		JSON     map[string]any `json:"json"`
+	}
+	body := struct {
+		Rows []insertRow `json:"rows"`
+	}{Rows: make([]insertRow, len(rows))}
+	for i, row := range rows {
+		values := make(map[string]any, len(row))
+		for name, value := range row {
+			// BigQuery parses timestamps down to the microsecond
+			if t, ok := value.(time.Time); ok {
+				value = t.UTC().Format("2006-01-02T15:04:05.999999Z")
+			}
+			values[name] = value
+		}
+		body.Rows[i] = insertRow{JSON: values}
+		if id, ok := row[table.Key].(string); ok {
+			body.Rows[i].InsertID = id
+		}
+	}
+
+	var resp struct {
+		InsertErrors []struct {
+			Index  int `json:"index"`
+			Errors []struct {
+				Reason  string `json:"reason"`
+				Message string `json:"message"`
+			} `json:"errors"`
+		} `json:"insertErrors"`
+	}
+	if err := w.do(ctx, http.MethodPost, w.tablesURL()+"/"+url.PathEscape(table.Name)+"/insertAll", body, &resp); err != nil {
+		return err
+	}
+	if len(resp.InsertErrors) > 0 {
+		first := resp.InsertErrors[0]
+		message := fmt.Sprintf("%d of %d rows rejected", len(resp.InsertErrors), len(rows))
+		if len(first.Errors) > 0 {
+			message += fmt.Sprintf(", row %d: %s: %s", first.Index, first.Errors[0].Reason, first.Errors[0].Message)
+		}
+		return &Error{Warehouse: "bigquery", Message: message}
+	}
+	return nil
+}
+
+// tablesURL returns the URL of the tables of the dataset
+func (w *BigQuery) tablesURL() string {
+	return w.baseURL + "/projects/" + url.PathEscape(w.project) + "/datasets/" + url.PathEscape(w.dataset) + "/tables"
+}
+
+// do sends a request to the BigQuery API, any status but 2xx failing with an Error
+func (w *BigQuery) do(ctx context.Context, method, endpoint string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("warehouse: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return fmt.Errorf("warehouse: %w", err)
+	}
+	token, err := w.tokens.Token(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("warehouse: bigquery request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// The body explains the failure, only its start is kept as it ends up in logs
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		message := strings.TrimSpace(string(data))
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		return &Error{Warehouse: "bigquery", StatusCode: resp.StatusCode, Message: message}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("warehouse: invalid bigquery response: %w", err)
+	}
+	return nil
+}
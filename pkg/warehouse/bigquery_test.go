@@ -0,0 +1,148 @@
+package warehouse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticTokens always returns the same token
+type staticTokens string
+
+func (t staticTokens) Token(context.Context) (string, error) {
+	return string(t), nil
+}
+
+var testTable = &Table{
+	Name: "access_events",
+	Key:  "event_id",
+	Columns: []Column{
+		{Name: "event_id", Type: TypeString},
+		{Name: "short_code", Type: TypeString},
+		{Name: "access_time", Type: TypeTimestamp},
+	},
+}
+
+func newTestBigQuery(t *testing.T, handler http.HandlerFunc) *BigQuery {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	w := NewBigQuery("proj", "links", staticTokens("token"), time.Second)
+	w.baseURL = srv.URL
+	return w
+}
+
+func TestBigQuery_EnsureTable(t *testing.T) {
+	t.Run("creates missing table", func(t *testing.T) {
+		var created map[string]any
+		w := newTestBigQuery(t, func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				assert.Equal(t, "/projects/proj/datasets/links/tables/access_events", r.URL.Path)
+				http.Error(w, `{"error":{"code":404}}`, http.StatusNotFound)
+			case http.MethodPost:
+				assert.Equal(t, "/projects/proj/datasets/links/tables", r.URL.Path)
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+				fmt.Fprint(w, `{}`)
+			}
+		})
+
+		require.NoError(t, w.EnsureTable(context.Background(), testTable))
+		assert.Equal(t, map[string]any{"type": "DAY", "field": "access_time"}, created["timePartitioning"])
+		fields := created["schema"].(map[string]any)["fields"].([]any)
+		require.Len(t, fields, 3)
+		assert.Equal(t, map[string]any{"name": "access_time", "type": "TIMESTAMP", "mode": "NULLABLE"}, fields[2])
+	})
+
+	t.Run("adds missing columns", func(t *testing.T) {
+		var patched bigQuerySchema
+		w := newTestBigQuery(t, func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				fmt.Fprint(w, `{"schema":{"fields":[{"name":"event_id","type":"STRING"},{"name":"SHORT_CODE","type":"STRING"},{"name":"legacy","type":"STRING"}]}}`)
+			case http.MethodPatch:
+				var body struct {
+					Schema bigQuerySchema `json:"schema"`
+				}
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				patched = body.Schema
+				fmt.Fprint(w, `{}`)
+			}
+		})
+
+		require.NoError(t, w.EnsureTable(context.Background(), testTable))
+		require.Len(t, patched.Fields, 4)
+		assert.Equal(t, "legacy", patched.Fields[2].Name)
+		assert.Equal(t, bigQueryField{Name: "access_time", Type: "TIMESTAMP", Mode: "NULLABLE"}, patched.Fields[3])
+	})
+
+	t.Run("leaves complete table", func(t *testing.T) {
+		w := newTestBigQuery(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodGet, r.Method)
+			fmt.Fprint(w, `{"schema":{"fields":[{"name":"event_id"},{"name":"short_code"},{"name":"access_time"}]}}`)
+		})
+		require.NoError(t, w.EnsureTable(context.Background(), testTable))
+	})
+}
+
+func TestBigQuery_Insert(t *testing.T) {
+	accessTime := time.Date(2026, 10, 16, 12, 0, 0, 123456789, time.UTC)
+	rows := []Row{
+		{"event_id": "e1", "short_code": "ABCD", "access_time": accessTime},
+		{"event_id": "e2", "short_code": "EFGH", "access_time": nil},
+	}
+
+	t.Run("streams rows", func(t *testing.T) {
+		var body struct {
+			Rows []struct {
+				InsertID string         `json:"insertId"`
+				JSON     map[string]any `json:"json"`
+			} `json:"rows"`
+		}
+		w := newTestBigQuery(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/projects/proj/datasets/links/tables/access_events/insertAll", r.URL.Path)
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			fmt.Fprint(w, `{"kind":"bigquery#tableDataInsertAllResponse"}`)
+		})
+
+		require.NoError(t, w.Insert(context.Background(), testTable, rows))
+		require.Len(t, body.Rows, 2)
+		assert.Equal(t, "e1", body.Rows[0].InsertID)
+		assert.Equal(t, "2026-10-16T12:00:00.123456Z", body.Rows[0].JSON["access_time"])
+		assert.Nil(t, body.Rows[1].JSON["access_time"])
+	})
+
+	t.Run("rejected rows", func(t *testing.T) {
+		w := newTestBigQuery(t, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"insertErrors":[{"index":1,"errors":[{"reason":"invalid","message":"no such field: extra"}]}]}`)
+		})
+
+		err := w.Insert(context.Background(), testTable, rows)
+		var whErr *Error
+		require.True(t, errors.As(err, &whErr))
+		assert.Contains(t, whErr.Message, "1 of 2 rows rejected, row 1: invalid: no such field: extra")
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		w := newTestBigQuery(t, func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "quota exceeded", http.StatusForbidden)
+		})
+
+		err := w.Insert(context.Background(), testTable, rows)
+		var whErr *Error
+		require.True(t, errors.As(err, &whErr))
+		assert.Equal(t, http.StatusForbidden, whErr.StatusCode)
+		assert.Equal(t, "quota exceeded", whErr.Message)
+	})
+}
@@ -0,0 +1,104 @@
+package warehouse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// sqlBatchRows is the most rows inserted per statement, keeping the placeholders of wide tables
+// under the limit of the MySQL protocol
+const sqlBatchRows = 500
+
+// sqlTypes maps column types to SQL types most MySQL-compatible warehouses accept
+var sqlTypes = map[string]string{
+	TypeString:    "VARCHAR(2048)",
+	TypeInteger:   "BIGINT",
+	TypeBoolean:   "BOOLEAN",
+	TypeTimestamp: "DATETIME",
+}
+
+// SQL inserts rows into the tables of a SQL warehouse speaking the MySQL protocol, such as TiDB,
+// StarRocks or Doris, in multi-row INSERT statements. Retried rows are inserted again, queries
+// telling them apart by the key of the table.
+type SQL struct {
+	db *sql.DB
+}
+
+// NewSQL creates a SQL writer inserting through db
+func NewSQL(db *sql.DB) *SQL {
+	return &SQL{db: db}
+}
+
+// EnsureTable creates a table, or adds the columns it misses
+func (w *SQL) EnsureTable(ctx context.Context, table *Table) error {
+	definitions := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		definitions[i] = quoteIdent(column.Name) + " " + sqlTypes[column.Type] + " NULL"
+	}
+	create := "CREATE TABLE IF NOT EXISTS " + quoteIdent(table.Name) + " (" + strings.Join(definitions, ", ") + ")"
+	if _, err := w.db.ExecContext(ctx, create); err != nil {
+		return fmt.Errorf("warehouse: failed to create %s: %w", table.Name, err)
+	}
+
+	rows, err := w.db.QueryContext(ctx,
+		"SELECT column_name FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ?", table.Name)
+	if err != nil {
+		return fmt.Errorf("warehouse: failed to read the columns of %s: %w", table.Name, err)
+	}
+	defer rows.Close()
+	known := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("warehouse: failed to read the columns of %s: %w", table.Name, err)
+		}
+		known[strings.ToLower(name)] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("warehouse: failed to read the columns of %s: %w", table.Name, err)
+	}
+
+	for i, column := range table.Columns {
+		if known[strings.ToLower(column.Name)] {
+			continue
+		}
+		alter := "ALTER TABLE " + quoteIdent(table.Name) + " ADD COLUMN " + definitions[i]
+		if _, err := w.db.ExecContext(ctx, alter); err != nil {
+			return fmt.Errorf("warehouse: failed to add %s to %s: %w", column.Name, table.Name, err)
+		}
+	}
+	return nil
+}
+
+// Insert inserts rows into a table, sqlBatchRows per statement
+func (w *SQL) Insert(ctx context.Context, table *Table, rows []Row) error {
+	names := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		names[i] = quoteIdent(column.Name)
+	}
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(table.Columns)), ", ") + ")"
+	prefix := "INSERT INTO " + quoteIdent(table.Name) + " (" + strings.Join(names, ", ") + ") VALUES "
+
+	for start := 0; start < len(rows); start += sqlBatchRows {
+		batch := rows[start:min(start+sqlBatchRows, len(rows))]
+		values := make([]string, len(batch))
+		args := make([]any, 0, len(batch)*len(table.Columns))
+		for i, row := range batch {
+			values[i] = placeholders
+			for _, column := range table.Columns {
+				args = append(args, row[column.Name])
+			}
+		}
+		if _, err := w.db.ExecContext(ctx, prefix+strings.Join(values, ", "), args...); err != nil {
+			return fmt.Errorf("warehouse: failed to insert into %s: %w", table.Name, err)
+		}
+	}
+	return nil
+}
+
+// quoteIdent quotes a table or column name
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
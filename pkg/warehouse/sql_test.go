@@ -0,0 +1,49 @@
+package warehouse
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQL_EnsureTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS `access_events` (`event_id` VARCHAR(2048) NULL, `short_code` VARCHAR(2048) NULL, `access_time` DATETIME NULL)")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT column_name FROM information_schema.columns")).
+		WithArgs("access_events").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("EVENT_ID").AddRow("short_code"))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE `access_events` ADD COLUMN `access_time` DATETIME NULL")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, NewSQL(db).EnsureTable(context.Background(), testTable))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQL_Insert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	accessTime := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	rows := make([]Row, sqlBatchRows+1)
+	for i := range rows {
+		rows[i] = Row{"event_id": "e", "short_code": "ABCD", "access_time": accessTime}
+	}
+
+	// A full batch, then the row left
+	insert := regexp.QuoteMeta("INSERT INTO `access_events` (`event_id`, `short_code`, `access_time`) VALUES (?, ?, ?)")
+	mock.ExpectExec(insert + regexp.QuoteMeta(", (?, ?, ?)")).WillReturnResult(sqlmock.NewResult(0, sqlBatchRows))
+	mock.ExpectExec(insert+"$").WithArgs("e", "ABCD", accessTime).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, NewSQL(db).Insert(context.Background(), testTable, rows))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,196 @@
+package warehouse
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Google OAuth2 endpoints and scopes
+const (
+	// GoogleTokenURL is the token endpoint of service account keys without a token_uri
+	GoogleTokenURL = "https://oauth2.googleapis.com/token"
+	// MetadataTokenURL is where the GCE metadata server hands out tokens of the attached service
+	// account
+	MetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	// bigQueryScope allows managing tables and inserting their rows
+	bigQueryScope = "https://www.googleapis.com/auth/bigquery"
+)
+
+// tokenMargin is how long before their expiry tokens are renewed
+const tokenMargin = time.Minute
+
+// TokenSource returns OAuth2 access tokens
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// cachedToken keeps a token until shortly before it expires
+type cachedToken struct {
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// get returns the cached token, fetching a new one once it is about to expire
+func (c *cachedToken) get(ctx context.Context, fetch func(ctx context.Context) (string, time.Duration, error)) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expiry) {
+		return c.token, nil
+	}
+	token, ttl, err := fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.token = token
+	c.expiry = time.Now().Add(ttl - tokenMargin)
+	return token, nil
+}
+
+// ServiceAccountTokens exchanges JWTs signed with the key of a Google service account for tokens
+type ServiceAccountTokens struct {
+	email    string
+	key      *rsa.PrivateKey
+	tokenURL string
+	client   *http.Client
+	cache    cachedToken
+}
+
+// NewServiceAccountTokens creates a token source from the JSON key file of a service account
+func NewServiceAccountTokens(keyFile []byte, timeout time.Duration) (*ServiceAccountTokens, error) {
+	var account struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(keyFile, &account); err != nil {
+		return nil, fmt.Errorf("warehouse: invalid service account key: %w", err)
+	}
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if account.ClientEmail == "" || block == nil {
+		return nil, errors.New("warehouse: invalid service account key: client_email or private_key missing")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("warehouse: invalid service account private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("warehouse: service account private key is not an RSA key")
+	}
+
+	tokenURL := account.TokenURI
+	if tokenURL == "" {
+		tokenURL = GoogleTokenURL
+	}
+	return &ServiceAccountTokens{email: account.ClientEmail, key: key, tokenURL: tokenURL, client: &http.Client{Timeout: timeout}}, nil
+}
+
+// Token returns an access token of the service account
+func (s *ServiceAccountTokens) Token(ctx context.Context) (string, error) {
+	return s.cache.get(ctx, s.fetch)
+}
+
+// fetch exchanges a new signed JWT for a token
+func (s *ServiceAccountTokens) fetch(ctx context.Context) (string, time.Duration, error) {
+	assertion, err := s.assertion(time.Now())
+	if err != nil {
+		return "", 0, err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("warehouse: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return fetchToken(s.client, req)
+}
+
+// assertion returns a JWT asking for a BigQuery token, signed with the key of the service account
+func (s *ServiceAccountTokens) assertion(now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		"iss":   s.email,
+		"scope": bigQueryScope,
+		"aud":   s.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("warehouse: %w", err)
+	}
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("warehouse: failed to sign token request: %w", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// MetadataTokens gets the tokens of the service account attached to the GCE instance or GKE
+// workload the service runs on
+type MetadataTokens struct {
+	tokenURL string
+	client   *http.Client
+	cache    cachedToken
+}
+
+// NewMetadataTokens creates a token source asking the metadata server
+func NewMetadataTokens(timeout time.Duration) *MetadataTokens {
+	return &MetadataTokens{tokenURL: MetadataTokenURL, client: &http.Client{Timeout: timeout}}
+}
+
+// Token returns an access token of the attached service account
+func (m *MetadataTokens) Token(ctx context.Context) (string, error) {
+	return m.cache.get(ctx, func(ctx context.Context) (string, time.Duration, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.tokenURL, nil)
+		if err != nil {
+			return "", 0, fmt.Errorf("warehouse: %w", err)
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+		return fetchToken(m.client, req)
+	})
+}
+
+// fetchToken sends a token request and returns the token along with its lifetime
+func fetchToken(client *http.Client, req *http.Request) (string, time.Duration, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("warehouse: token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", 0, &Error{Warehouse: "oauth2", StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return "", 0, errors.New("warehouse: invalid token response")
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
@@ -0,0 +1,90 @@
+package warehouse
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceAccountTokens(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.PostForm.Get("grant_type"))
+
+		// The assertion is signed by the key of the service account
+		parts := strings.Split(r.PostForm.Get("assertion"), ".")
+		require.Len(t, parts, 3)
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig))
+
+		data, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.NoError(t, err)
+		var claims map[string]any
+		require.NoError(t, json.Unmarshal(data, &claims))
+		assert.Equal(t, "loader@proj.iam.gserviceaccount.com", claims["iss"])
+		assert.Equal(t, bigQueryScope, claims["scope"])
+
+		fmt.Fprint(w, `{"access_token":"token1","expires_in":3600}`)
+	}))
+	defer srv.Close()
+
+	keyFile, err := json.Marshal(map[string]string{
+		"client_email": "loader@proj.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    srv.URL,
+	})
+	require.NoError(t, err)
+	tokens, err := NewServiceAccountTokens(keyFile, time.Second)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		token, err := tokens.Token(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "token1", token)
+	}
+	assert.Equal(t, 1, requests)
+
+	_, err = NewServiceAccountTokens([]byte(`{"client_email":"loader@proj.iam.gserviceaccount.com"}`), time.Second)
+	assert.Error(t, err)
+}
+
+func TestMetadataTokens(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing Metadata-Flavor", http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"token2","expires_in":1800,"token_type":"Bearer"}`)
+	}))
+	defer srv.Close()
+
+	tokens := NewMetadataTokens(time.Second)
+	tokens.tokenURL = srv.URL
+	token, err := tokens.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token2", token)
+}
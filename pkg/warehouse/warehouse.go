@@ -0,0 +1,54 @@
+// Package warehouse streams rows to data warehouses, BigQuery or a SQL warehouse speaking the MySQL
+// protocol, creating their tables and adding the columns they miss before inserting.
+package warehouse
+
+import (
+	"context"
+	"fmt"
+)
+
+// Column types, mapped to the closest type of each warehouse
+const (
+	TypeString    = "string"
+	TypeInteger   = "integer"
+	TypeBoolean   = "boolean"
+	TypeTimestamp = "timestamp"
+)
+
+// Column represents a column of a table, every column being nullable
+type Column struct {
+	Name string
+	Type string
+}
+
+// Table represents the schema of a table. Key names the column identifying rows, which warehouses
+// deduplicating inserts use to drop retried rows.
+type Table struct {
+	Name    string
+	Key     string
+	Columns []Column
+}
+
+// Row maps the columns of a table to their values: strings, int64, bools, time.Time or nil
+type Row map[string]any
+
+// Writer inserts rows into the tables of a warehouse
+type Writer interface {
+	// EnsureTable creates a table, or adds the columns it misses when it exists
+	EnsureTable(ctx context.Context, table *Table) error
+	// Insert inserts rows into a table ensured before
+	Insert(ctx context.Context, table *Table, rows []Row) error
+}
+
+// Error is returned when a warehouse rejects a request or some of the rows inserted, StatusCode
+// being the HTTP status of warehouses served over HTTP
+type Error struct {
+	Warehouse  string
+	StatusCode int
+	Message    string
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	return fmt.Sprintf("warehouse: %s: %s", e.Warehouse, e.Message)
+}
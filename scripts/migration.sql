@@ -10,24 +10,159 @@ CREATE TABLE IF NOT EXISTS short_links (
     id BIGINT PRIMARY KEY AUTO_INCREMENT,
     short_code VARCHAR(6) UNIQUE NOT NULL COMMENT 'Short code for the link',
     original_url VARCHAR(2048) NOT NULL COMMENT 'Original long URL',
+    url_hash CHAR(64) COMMENT 'SHA-256 of the normalized original URL, for reverse lookups',
+    dedup_hash CHAR(64) COMMENT 'SHA-256 of the original URL and canonical params, for deduplication',
     params JSON COMMENT 'Additional parameters for the link',
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT 'Creation timestamp',
     expire_at DATETIME COMMENT 'Expiration timestamp (optional)',
     status TINYINT DEFAULT 1 COMMENT '1=active, 0=disabled',
+    pool VARCHAR(16) NOT NULL DEFAULT '' COMMENT 'Reserved code pool (sms) or empty',
+    no_click_id TINYINT(1) NOT NULL DEFAULT 0 COMMENT '1=redirect without click ID',
+    max_clicks BIGINT NOT NULL DEFAULT 0 COMMENT 'Clicks before the link expires, 0=unlimited',
+    preserve_query TINYINT(1) NOT NULL DEFAULT 0 COMMENT '1=append redirect parameters without re-encoding the URL',
+    title VARCHAR(255) COMMENT 'Title describing the purpose of the link (optional)',
+    description VARCHAR(1024) COMMENT 'Description of the link (optional)',
+    notes TEXT COMMENT 'Free-form notes of the team owning the link (optional)',
+    managed TINYINT(1) NOT NULL DEFAULT 0 COMMENT '1=provisioned through the declarative API',
+    replica_version BIGINT NOT NULL DEFAULT 0 COMMENT 'Unix nanoseconds of the last change replicated from the primary region',
+    public_stats TINYINT(1) NOT NULL DEFAULT 0 COMMENT '1=anyone may view the aggregated stats at /{short_code}+',
+    no_tracking TINYINT(1) NOT NULL DEFAULT 0 COMMENT '1=redirect without recording analytics',
+    cache_control VARCHAR(128) NOT NULL DEFAULT '' COMMENT 'Cache-Control of redirects, empty=the configured one',
+    signed_params TINYINT(1) NOT NULL DEFAULT 0 COMMENT '1=params appended to the link must be signed',
+    single_use TINYINT(1) NOT NULL DEFAULT 0 COMMENT '1=disabled by its first redirect',
+    referrers VARCHAR(1024) NOT NULL DEFAULT '' COMMENT 'comma separated domains redirects must be referred from, empty=any',
+    geo_allow VARCHAR(1024) NOT NULL DEFAULT '' COMMENT 'comma separated countries redirects are limited to, empty=any',
+    geo_deny VARCHAR(1024) NOT NULL DEFAULT '' COMMENT 'comma separated countries redirects are refused in',
+    schedule JSON COMMENT 'weekly windows routing redirects to other destinations',
+    owner CHAR(64) NOT NULL DEFAULT '' COMMENT 'SHA-256 of the API key owning the link, empty for anonymous links',
     INDEX idx_short_code (short_code),
     INDEX idx_expire_at (expire_at),
-    INDEX idx_status (status)
+    INDEX idx_status (status),
+    INDEX idx_pool (pool),
+    INDEX idx_url_hash (url_hash),
+    INDEX idx_dedup_hash (dedup_hash),
+    INDEX idx_managed (managed),
+    INDEX idx_owner (owner),
+    FULLTEXT INDEX idx_search (title, notes, original_url)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Short links storage';
 
+-- Backfill the dedup hash of links created before it existed. Links without params hash their URL
+-- alone, links with params are left out and get a new code when requested again.
+UPDATE short_links SET dedup_hash = SHA2(original_url, 256) WHERE dedup_hash IS NULL AND (params IS NULL OR JSON_LENGTH(params) = 0);
+
 -- Access logs table
 CREATE TABLE IF NOT EXISTS access_logs (
     id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    event_id VARCHAR(64) COMMENT 'ID of the access event, set once per redirect to ignore redeliveries',
     short_code VARCHAR(6) NOT NULL COMMENT 'Short code of the accessed link',
     client_ip VARCHAR(64) COMMENT 'Client IP address',
     user_agent VARCHAR(512) COMMENT 'User-Agent header',
     referer VARCHAR(512) COMMENT 'Referer header',
+    source VARCHAR(64) COMMENT 'Traffic source derived from the referer',
+    device VARCHAR(16) COMMENT 'Device type derived from the User-Agent',
+    click_id VARCHAR(32) COMMENT 'Click ID appended to the redirect (optional)',
+    edge VARCHAR(8) COMMENT 'hit or miss of the CDN edge forwarding the access, empty for direct requests',
     access_time DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT 'Access timestamp',
     INDEX idx_short_code (short_code),
     INDEX idx_access_time (access_time),
-    INDEX idx_client_ip (client_ip)
+    INDEX idx_client_ip (client_ip),
+    INDEX idx_click_id (click_id),
+    INDEX idx_source (source),
+    INDEX idx_device (device),
+    INDEX idx_code_time (short_code, access_time, id),
+    UNIQUE INDEX idx_event_id (event_id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Access logs for analytics';
+
+-- Daily click aggregates, maintained by the access log consumer
+CREATE TABLE IF NOT EXISTS daily_stats (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    short_code VARCHAR(6) NOT NULL COMMENT 'Short code of the aggregated link',
+    day DATE NOT NULL COMMENT 'Aggregated day (UTC)',
+    clicks BIGINT NOT NULL DEFAULT 0 COMMENT 'Clicks received on the day',
+    visitors BIGINT NOT NULL DEFAULT 0 COMMENT 'Distinct client IPs seen on the day',
+    UNIQUE INDEX idx_code_day (short_code, day)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Daily click aggregates';
+
+-- Visitors seen on each link and day, counting every visitor once in daily_stats.visitors
+CREATE TABLE IF NOT EXISTS daily_visitors (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    short_code VARCHAR(6) NOT NULL COMMENT 'Short code of the visited link',
+    day DATE NOT NULL COMMENT 'Day of the visits (UTC)',
+    visitor VARCHAR(64) NOT NULL COMMENT 'Visitor ID, or client IP of access logs without one',
+    UNIQUE INDEX idx_code_day_visitor (short_code, day, visitor)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Daily visitors of links';
+
+-- Daily click aggregates per traffic source, maintained by the access log consumer
+CREATE TABLE IF NOT EXISTS daily_source_stats (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    short_code VARCHAR(6) NOT NULL COMMENT 'Short code of the aggregated link',
+    day DATE NOT NULL COMMENT 'Aggregated day (UTC)',
+    source VARCHAR(64) NOT NULL COMMENT 'Traffic source',
+    clicks BIGINT NOT NULL DEFAULT 0 COMMENT 'Clicks from the source on the day',
+    UNIQUE INDEX idx_code_day_source (short_code, day, source)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Daily click aggregates per source';
+
+-- Conversions reported through the postback API
+CREATE TABLE IF NOT EXISTS conversions (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    click_id VARCHAR(32) NOT NULL COMMENT 'Click ID appended to the redirect',
+    event VARCHAR(64) NOT NULL COMMENT 'Conversion event name',
+    short_code VARCHAR(6) NOT NULL COMMENT 'Short code the click went through',
+    source VARCHAR(64) COMMENT 'Traffic source of the click',
+    value DOUBLE NOT NULL DEFAULT 0 COMMENT 'Conversion value reported by the advertiser',
+    converted_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT 'Conversion timestamp',
+    UNIQUE INDEX idx_click_event (click_id, event),
+    INDEX idx_short_code (short_code)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Conversion postbacks';
+
+CREATE TABLE IF NOT EXISTS rules (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    kind VARCHAR(32) NOT NULL COMMENT 'bot_ua, reserved_word, url_blocklist or source',
+    pattern VARCHAR(255) NOT NULL COMMENT 'Pattern matched case-insensitively',
+    source VARCHAR(64) NOT NULL DEFAULT '' COMMENT 'Traffic source of source rules',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT 'Creation timestamp',
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT 'Last change timestamp',
+    UNIQUE INDEX idx_kind_pattern (kind, pattern)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Bot, reserved word, URL blocklist and traffic source rules set at runtime';
+
+CREATE TABLE IF NOT EXISTS domain_reputation (
+    domain VARCHAR(255) PRIMARY KEY COMMENT 'Registrable domain of link destinations',
+    links BIGINT NOT NULL DEFAULT 0 COMMENT 'Links created to the domain',
+    reports BIGINT NOT NULL DEFAULT 0 COMMENT 'Abuse reports of links to the domain',
+    checks BIGINT NOT NULL DEFAULT 0 COMMENT 'Checks of a link to the domain',
+    dead_checks BIGINT NOT NULL DEFAULT 0 COMMENT 'Checks finding the link dead',
+    flagged TINYINT(1) NOT NULL DEFAULT 0 COMMENT '1=listed by Safe Browsing at the last check',
+    sample_url VARCHAR(2048) NOT NULL DEFAULT '' COMMENT 'Latest link destination, the one checked',
+    override VARCHAR(16) NOT NULL DEFAULT '' COMMENT 'allow, interstitial or block set by an operator, empty=computed from the score',
+    checked_at DATETIME COMMENT 'Last check, NULL=never checked',
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT 'Last change timestamp',
+    INDEX idx_checked_at (checked_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Reputation of link destination domains';
+
+-- Views BI tools such as Grafana and Redash query instead of the raw tables, so a read-only role
+-- granted only them never sees client IPs, user agents or full referers. Campaigns are the values of
+-- the "campaign" link param, set database.mysql.analytics_views to recreate them for reports.param.
+CREATE OR REPLACE VIEW analytics_daily_clicks AS
+SELECT daily_stats.day, daily_stats.short_code, short_links.original_url, short_links.title,
+    daily_stats.clicks, daily_stats.visitors
+FROM daily_stats
+JOIN short_links ON short_links.short_code = daily_stats.short_code;
+
+CREATE OR REPLACE VIEW analytics_daily_sources AS
+SELECT daily_source_stats.day, daily_source_stats.short_code, daily_source_stats.source,
+    daily_source_stats.clicks
+FROM daily_source_stats;
+
+CREATE OR REPLACE VIEW analytics_daily_campaigns AS
+SELECT daily_stats.day, JSON_UNQUOTE(JSON_EXTRACT(short_links.params, '$."campaign"')) AS campaign,
+    COUNT(*) AS links, SUM(daily_stats.clicks) AS clicks, SUM(daily_stats.visitors) AS visitors
+FROM daily_stats
+JOIN short_links ON short_links.short_code = daily_stats.short_code
+WHERE JSON_EXTRACT(short_links.params, '$."campaign"') IS NOT NULL
+GROUP BY daily_stats.day, campaign;
+
+CREATE OR REPLACE VIEW analytics_access_logs AS
+SELECT id, short_code, access_time, source, device, edge,
+    NULLIF(SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(referer, '/', 3), '/', -1), '?', 1), '') AS referer_host,
+    click_id IS NOT NULL AND click_id <> '' AS has_click_id
+FROM access_logs;